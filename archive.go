@@ -0,0 +1,533 @@
+package git
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-git/go-git/v6/plumbing"
+	"github.com/go-git/go-git/v6/plumbing/filemode"
+	"github.com/go-git/go-git/v6/plumbing/format/gitattributes"
+	"github.com/go-git/go-git/v6/plumbing/object"
+	"github.com/go-git/go-git/v6/utils/ioutil"
+)
+
+const (
+	exportIgnoreAttribute = "export-ignore"
+	exportSubstAttribute  = "export-subst"
+
+	// substPrefix starts the placeholders replaced in the files with the
+	// export-subst attribute, ending with a dollar sign.
+	substPrefix = "$Format:"
+)
+
+// ErrUnsupportedArchiveFormat is returned by Archive when the format of the
+// archive is not supported.
+var ErrUnsupportedArchiveFormat = errors.New("unsupported archive format")
+
+// ArchiveFormat is the format of an archive created by Archive.
+type ArchiveFormat int8
+
+const (
+	// TarArchive is an uncompressed tar archive.
+	TarArchive ArchiveFormat = iota
+	// TarGzArchive is a tar archive compressed with gzip.
+	TarGzArchive
+	// ZipArchive is a zip archive, its files being compressed with deflate.
+	ZipArchive
+)
+
+// ArchiveOptions describes how an archive is created by Archive.
+type ArchiveOptions struct {
+	// Format is the format of the archive, TarArchive by default.
+	Format ArchiveFormat
+	// Commit is the hash of the commit, or the tree, whose files are
+	// archived, HEAD if zero.
+	Commit plumbing.Hash
+	// Prefix is prepended to the paths of the archived files. It usually
+	// ends with a slash, such as "project-1.0/", the files being then
+	// archived in this directory.
+	Prefix string
+}
+
+// Validate validates the fields and sets the default values.
+func (o *ArchiveOptions) Validate(r *Repository) error {
+	switch o.Format {
+	case TarArchive, TarGzArchive, ZipArchive:
+	default:
+		return fmt.Errorf("%w: %d", ErrUnsupportedArchiveFormat, o.Format)
+	}
+
+	if o.Commit.IsZero() {
+		ref, err := r.Head()
+		if err != nil {
+			return err
+		}
+
+		o.Commit = ref.Hash()
+	}
+
+	return nil
+}
+
+// Archive writes to w an archive of the files of a commit, as
+// `git archive` does. The files are converted as when they are checked out,
+// according to their attributes, read from the archived tree, and the files
+// with the export-ignore attribute are left out. The $Format:...$
+// placeholders of the files with the export-subst attribute are replaced
+// with the formatted commit, supporting the %H, %h, %T, %t, %P, %p, %an,
+// %ae, %ad, %aD, %ai, %aI, %at, %cn, %ce, %cd, %cD, %ci, %cI, %ct, %s, %b,
+// %B, %n and %% placeholders of `git log --format`.
+//
+// The modification time of the files is the committer time of the commit,
+// or the current time if a tree is archived, so that the archives of a
+// commit are reproducible. The hash of the commit is recorded in the pax
+// global header of the tar archives, and in the comment of the zip ones.
+func (r *Repository) Archive(w io.Writer, opts *ArchiveOptions) (err error) {
+	if opts == nil {
+		opts = &ArchiveOptions{}
+	}
+
+	if err := opts.Validate(r); err != nil {
+		return err
+	}
+
+	obj, err := r.Object(plumbing.AnyObject, opts.Commit)
+	if err != nil {
+		return err
+	}
+
+	var commit *object.Commit
+	mtime := time.Now()
+	if c, err := object.PeelToCommit(obj); err == nil {
+		commit, mtime = c, c.Committer.When
+	}
+
+	obj, err = peelObject(obj, plumbing.TreeObject.String())
+	if err != nil {
+		return err
+	}
+
+	tree := obj.(*object.Tree)
+	c, err := r.newTreeConverter(tree)
+	if err != nil {
+		return err
+	}
+
+	var aw archiveWriter
+	switch opts.Format {
+	case TarGzArchive:
+		gw := gzip.NewWriter(w)
+		defer ioutil.CheckClose(gw, &err)
+		aw = newTarArchiveWriter(gw, mtime)
+	case ZipArchive:
+		aw = newZipArchiveWriter(w, mtime)
+	default:
+		aw = newTarArchiveWriter(w, mtime)
+	}
+
+	if commit != nil {
+		if err := aw.writeCommit(commit.Hash); err != nil {
+			return err
+		}
+	}
+
+	a := &archiver{r: r, c: c, w: aw, commit: commit, prefix: opts.Prefix}
+	if strings.HasSuffix(opts.Prefix, "/") {
+		if err := aw.writeDir(opts.Prefix); err != nil {
+			return err
+		}
+	}
+
+	if err := a.writeTree(tree, ""); err != nil {
+		return err
+	}
+
+	return aw.Close()
+}
+
+// archiver writes the files of a tree to an archive.
+type archiver struct {
+	r      *Repository
+	c      *converter
+	w      archiveWriter
+	commit *object.Commit
+	prefix string
+}
+
+func (a *archiver) writeTree(t *object.Tree, dir string) error {
+	for _, e := range t.Entries {
+		name := path.Join(dir, e.Name)
+		attrs, err := a.attributes(name)
+		if err != nil {
+			return err
+		}
+
+		if attr, ok := attrs[exportIgnoreAttribute]; ok && attr.IsSet() {
+			continue
+		}
+
+		switch e.Mode {
+		case filemode.Dir:
+			if err := a.w.writeDir(a.prefix + name + "/"); err != nil {
+				return err
+			}
+
+			sub, err := a.r.TreeObject(e.Hash)
+			if err != nil {
+				return err
+			}
+
+			if err := a.writeTree(sub, name); err != nil {
+				return err
+			}
+		case filemode.Submodule:
+			// The submodules are archived as empty directories.
+			if err := a.w.writeDir(a.prefix + name + "/"); err != nil {
+				return err
+			}
+		default:
+			attr, ok := attrs[exportSubstAttribute]
+			if err := a.writeFile(name, e, ok && attr.IsSet()); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+func (a *archiver) attributes(name string) (map[string]gitattributes.Attribute, error) {
+	a.c.mu.Lock()
+	defer a.c.mu.Unlock()
+
+	return a.c.match(name, []string{exportIgnoreAttribute, exportSubstAttribute})
+}
+
+// writeFile writes the file of the given tree entry, whose content is kept
+// in memory only if it is converted or its placeholders are replaced.
+func (a *archiver) writeFile(name string, e object.TreeEntry, subst bool) (err error) {
+	blob, err := a.r.BlobObject(e.Hash)
+	if err != nil {
+		return err
+	}
+
+	f := object.NewFile(name, e.Mode, blob)
+	conv, err := a.c.conversion(name)
+	if err != nil {
+		return err
+	}
+
+	if e.Mode == filemode.Symlink || conv == nil && (!subst || a.commit == nil) {
+		rd, err := f.Reader()
+		if err != nil {
+			return err
+		}
+		defer ioutil.CheckClose(rd, &err)
+
+		return a.w.writeFile(a.prefix+name, e.Mode, f.Size, rd)
+	}
+
+	rd, err := a.c.toWorktree(f)
+	if err != nil {
+		return err
+	}
+	defer ioutil.CheckClose(rd, &err)
+
+	content, err := io.ReadAll(rd)
+	if err != nil {
+		return err
+	}
+
+	if subst && a.commit != nil {
+		content = a.subst(content)
+	}
+
+	return a.w.writeFile(a.prefix+name, e.Mode, int64(len(content)), bytes.NewReader(content))
+}
+
+// subst replaces the $Format:...$ placeholders of content with the commit
+// formatted accordingly, as format_subst in git.
+func (a *archiver) subst(content []byte) []byte {
+	var b bytes.Buffer
+	for {
+		i := bytes.Index(content, []byte(substPrefix))
+		if i < 0 {
+			break
+		}
+
+		format, rest, ok := bytes.Cut(content[i+len(substPrefix):], []byte("$"))
+		if !ok {
+			break
+		}
+
+		b.Write(content[:i])
+		b.WriteString(a.r.formatCommit(a.commit, string(format)))
+		content = rest
+	}
+
+	b.Write(content)
+	return b.Bytes()
+}
+
+// formatCommit formats c as `git log --format` does, the unknown
+// placeholders being left as is.
+func (r *Repository) formatCommit(c *object.Commit, format string) string {
+	subject, body := splitCommitMessage(c.Message)
+
+	var b strings.Builder
+	for i := 0; i < len(format); i++ {
+		if format[i] != '%' || i+1 == len(format) {
+			b.WriteByte(format[i])
+			continue
+		}
+
+		placeholder := format[i+1:]
+		var n int
+		switch {
+		case strings.HasPrefix(placeholder, "%"):
+			b.WriteByte('%')
+			n = 1
+		case strings.HasPrefix(placeholder, "n"):
+			b.WriteByte('\n')
+			n = 1
+		case strings.HasPrefix(placeholder, "H"):
+			b.WriteString(c.Hash.String())
+			n = 1
+		case strings.HasPrefix(placeholder, "h"):
+			b.WriteString(r.abbrevHash(c.Hash, 0))
+			n = 1
+		case strings.HasPrefix(placeholder, "T"):
+			b.WriteString(c.TreeHash.String())
+			n = 1
+		case strings.HasPrefix(placeholder, "t"):
+			b.WriteString(r.abbrevHash(c.TreeHash, 0))
+			n = 1
+		case strings.HasPrefix(placeholder, "P"), strings.HasPrefix(placeholder, "p"):
+			parents := make([]string, len(c.ParentHashes))
+			for j, h := range c.ParentHashes {
+				if placeholder[0] == 'P' {
+					parents[j] = h.String()
+				} else {
+					parents[j] = r.abbrevHash(h, 0)
+				}
+			}
+
+			b.WriteString(strings.Join(parents, " "))
+			n = 1
+		case strings.HasPrefix(placeholder, "s"):
+			b.WriteString(subject)
+			n = 1
+		case strings.HasPrefix(placeholder, "b"):
+			b.WriteString(body)
+			n = 1
+		case strings.HasPrefix(placeholder, "B"):
+			b.WriteString(c.Message)
+			n = 1
+		case strings.HasPrefix(placeholder, "a"), strings.HasPrefix(placeholder, "c"):
+			sig := c.Author
+			if placeholder[0] == 'c' {
+				sig = c.Committer
+			}
+
+			var ok bool
+			if len(placeholder) > 1 {
+				ok = writeSignaturePlaceholder(&b, sig, placeholder[1])
+			}
+
+			if ok {
+				n = 2
+			}
+		}
+
+		if n == 0 {
+			b.WriteByte('%')
+			continue
+		}
+
+		i += n
+	}
+
+	return b.String()
+}
+
+// writeSignaturePlaceholder writes the field of sig selected by the given
+// letter of a %a or %c placeholder, and returns whether it is known.
+func writeSignaturePlaceholder(b *strings.Builder, sig object.Signature, field byte) bool {
+	switch field {
+	case 'n':
+		b.WriteString(sig.Name)
+	case 'e':
+		b.WriteString(sig.Email)
+	case 'd':
+		b.WriteString(sig.When.Format("Mon Jan 2 15:04:05 2006 -0700"))
+	case 'D':
+		b.WriteString(sig.When.Format("Mon, 2 Jan 2006 15:04:05 -0700"))
+	case 'i':
+		b.WriteString(sig.When.Format("2006-01-02 15:04:05 -0700"))
+	case 'I':
+		b.WriteString(sig.When.Format("2006-01-02T15:04:05-07:00"))
+	case 't':
+		b.WriteString(strconv.FormatInt(sig.When.Unix(), 10))
+	default:
+		return false
+	}
+
+	return true
+}
+
+// splitCommitMessage returns the subject of a commit message, its first
+// paragraph with its lines joined by spaces, and its body, the rest of the
+// message.
+func splitCommitMessage(msg string) (subject, body string) {
+	lines := strings.Split(msg, "\n")
+	i := 0
+	for i < len(lines) && strings.TrimSpace(lines[i]) == "" {
+		i++
+	}
+
+	var parts []string
+	for ; i < len(lines) && strings.TrimSpace(lines[i]) != ""; i++ {
+		parts = append(parts, strings.TrimSpace(lines[i]))
+	}
+
+	for i < len(lines) && strings.TrimSpace(lines[i]) == "" {
+		i++
+	}
+
+	return strings.Join(parts, " "), strings.Join(lines[i:], "\n")
+}
+
+// archiveWriter writes the entries of an archive.
+type archiveWriter interface {
+	// writeCommit records the hash of the archived commit.
+	writeCommit(h plumbing.Hash) error
+	// writeDir writes a directory, whose name ends with a slash.
+	writeDir(name string) error
+	// writeFile writes a file, the content of a symlink being its target.
+	writeFile(name string, mode filemode.FileMode, size int64, r io.Reader) error
+	io.Closer
+}
+
+// tarArchiveWriter writes a tar archive as git does, the files being owned by
+// root and their permissions masked with the default tar.umask, 0002.
+type tarArchiveWriter struct {
+	w     *tar.Writer
+	mtime time.Time
+}
+
+func newTarArchiveWriter(w io.Writer, mtime time.Time) *tarArchiveWriter {
+	return &tarArchiveWriter{w: tar.NewWriter(w), mtime: mtime}
+}
+
+func (w *tarArchiveWriter) writeCommit(h plumbing.Hash) error {
+	return w.w.WriteHeader(&tar.Header{
+		Typeflag:   tar.TypeXGlobalHeader,
+		PAXRecords: map[string]string{"comment": h.String()},
+	})
+}
+
+func (w *tarArchiveWriter) writeDir(name string) error {
+	return w.w.WriteHeader(w.header(tar.TypeDir, name, 0o775))
+}
+
+func (w *tarArchiveWriter) writeFile(name string, mode filemode.FileMode, size int64, r io.Reader) error {
+	if mode == filemode.Symlink {
+		target, err := io.ReadAll(r)
+		if err != nil {
+			return err
+		}
+
+		hdr := w.header(tar.TypeSymlink, name, 0o777)
+		hdr.Linkname = string(target)
+		return w.w.WriteHeader(hdr)
+	}
+
+	perm := int64(0o664)
+	if mode == filemode.Executable {
+		perm = 0o775
+	}
+
+	hdr := w.header(tar.TypeReg, name, perm)
+	hdr.Size = size
+	if err := w.w.WriteHeader(hdr); err != nil {
+		return err
+	}
+
+	_, err := io.Copy(w.w, r)
+	return err
+}
+
+func (w *tarArchiveWriter) header(typ byte, name string, mode int64) *tar.Header {
+	return &tar.Header{
+		Typeflag: typ,
+		Name:     name,
+		Mode:     mode,
+		ModTime:  w.mtime,
+		Uname:    "root",
+		Gname:    "root",
+	}
+}
+
+func (w *tarArchiveWriter) Close() error {
+	return w.w.Close()
+}
+
+// zipArchiveWriter writes a zip archive, storing the directories and the
+// symlinks, and compressing the files with deflate.
+type zipArchiveWriter struct {
+	w     *zip.Writer
+	mtime time.Time
+}
+
+func newZipArchiveWriter(w io.Writer, mtime time.Time) *zipArchiveWriter {
+	return &zipArchiveWriter{w: zip.NewWriter(w), mtime: mtime}
+}
+
+func (w *zipArchiveWriter) writeCommit(h plumbing.Hash) error {
+	return w.w.SetComment(h.String())
+}
+
+func (w *zipArchiveWriter) writeDir(name string) error {
+	_, err := w.w.CreateHeader(w.header(name, zip.Store, os.ModeDir|0o755))
+	return err
+}
+
+func (w *zipArchiveWriter) writeFile(name string, mode filemode.FileMode, _ int64, r io.Reader) error {
+	var hdr *zip.FileHeader
+	switch mode {
+	case filemode.Symlink:
+		hdr = w.header(name, zip.Store, os.ModeSymlink|0o777)
+	case filemode.Executable:
+		hdr = w.header(name, zip.Deflate, 0o755)
+	default:
+		hdr = w.header(name, zip.Deflate, 0o644)
+	}
+
+	fw, err := w.w.CreateHeader(hdr)
+	if err != nil {
+		return err
+	}
+
+	_, err = io.Copy(fw, r)
+	return err
+}
+
+func (w *zipArchiveWriter) header(name string, method uint16, mode os.FileMode) *zip.FileHeader {
+	hdr := &zip.FileHeader{Name: name, Method: method, Modified: w.mtime}
+	hdr.SetMode(mode)
+	return hdr
+}
+
+func (w *zipArchiveWriter) Close() error {
+	return w.w.Close()
+}
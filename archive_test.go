@@ -0,0 +1,207 @@
+package git
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-git/go-billy/v6"
+	"github.com/go-git/go-billy/v6/memfs"
+	"github.com/go-git/go-billy/v6/util"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/go-git/go-git/v6/plumbing/object"
+	"github.com/go-git/go-git/v6/storage/memory"
+)
+
+// commitArchivedFiles commits files covering the features of Archive to the
+// repository of the given worktree, and returns the commit.
+func commitArchivedFiles(t *testing.T, r *Repository, fs billy.Filesystem) *object.Commit {
+	t.Helper()
+
+	files := map[string]string{
+		".gitattributes": "ignored.txt export-ignore\nsecret export-ignore\nversion.txt export-subst\n",
+		"README":         "hello\n",
+		"ignored.txt":    "ignored\n",
+		"secret/key":     "key\n",
+		"src/main.go":    "package main\n",
+		"version.txt":    "$Format:%H %h %an <%ae> %ct %s%n$ $Format:%x%$\n",
+	}
+	for name, content := range files {
+		require.NoError(t, util.WriteFile(fs, name, []byte(content), 0o644))
+	}
+
+	require.NoError(t, util.WriteFile(fs, "run.sh", []byte("#!/bin/sh\n"), 0o755))
+	require.NoError(t, fs.Symlink("README", "link"))
+
+	w, err := r.Worktree()
+	require.NoError(t, err)
+	require.NoError(t, w.AddWithOptions(&AddOptions{All: true}))
+
+	sig := &object.Signature{Name: "foo", Email: "foo@foo.foo", When: time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)}
+	h, err := w.Commit("archived\n\nThe body.\n", &CommitOptions{Author: sig, Committer: sig})
+	require.NoError(t, err)
+
+	c, err := r.CommitObject(h)
+	require.NoError(t, err)
+	return c
+}
+
+type archivedEntry struct {
+	name    string
+	mode    int64
+	content string
+}
+
+func readTarArchive(t *testing.T, rd io.Reader, mtime time.Time) (string, []archivedEntry) {
+	t.Helper()
+
+	var comment string
+	var entries []archivedEntry
+	tr := tar.NewReader(rd)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return comment, entries
+		}
+		require.NoError(t, err)
+
+		if hdr.Typeflag == tar.TypeXGlobalHeader {
+			comment = hdr.PAXRecords["comment"]
+			continue
+		}
+
+		assert.True(t, mtime.Equal(hdr.ModTime), hdr.Name)
+		assert.Equal(t, "root", hdr.Uname)
+		content, err := io.ReadAll(tr)
+		require.NoError(t, err)
+		if hdr.Typeflag == tar.TypeSymlink {
+			content = []byte("-> " + hdr.Linkname)
+		}
+
+		entries = append(entries, archivedEntry{hdr.Name, hdr.Mode, string(content)})
+	}
+}
+
+func expectedArchivedEntries(c *object.Commit, r *Repository, prefix string) []archivedEntry {
+	version := fmt.Sprintf("%s %s foo <foo@foo.foo> %d archived\n %%x%%\n", c.Hash, r.abbrevHash(c.Hash, 0), c.Committer.When.Unix())
+	return []archivedEntry{
+		{prefix, 0o775, ""},
+		{prefix + ".gitattributes", 0o664, "ignored.txt export-ignore\nsecret export-ignore\nversion.txt export-subst\n"},
+		{prefix + "README", 0o664, "hello\n"},
+		{prefix + "link", 0o777, "-> README"},
+		{prefix + "run.sh", 0o775, "#!/bin/sh\n"},
+		{prefix + "src/", 0o775, ""},
+		{prefix + "src/main.go", 0o664, "package main\n"},
+		{prefix + "version.txt", 0o664, version},
+	}
+}
+
+func TestArchive(t *testing.T) {
+	t.Parallel()
+
+	fs := memfs.New()
+	r, err := Init(memory.NewStorage(), WithWorkTree(fs))
+	require.NoError(t, err)
+	c := commitArchivedFiles(t, r, fs)
+	expected := expectedArchivedEntries(c, r, "p/")
+
+	var buf bytes.Buffer
+	require.NoError(t, r.Archive(&buf, &ArchiveOptions{Prefix: "p/"}))
+	comment, entries := readTarArchive(t, &buf, c.Committer.When)
+	assert.Equal(t, c.Hash.String(), comment)
+	assert.Equal(t, expected, entries)
+
+	buf.Reset()
+	require.NoError(t, r.Archive(&buf, &ArchiveOptions{Format: TarGzArchive, Commit: c.Hash, Prefix: "p/"}))
+	gr, err := gzip.NewReader(&buf)
+	require.NoError(t, err)
+	_, entries = readTarArchive(t, gr, c.Committer.When)
+	assert.Equal(t, expected, entries)
+
+	buf.Reset()
+	require.NoError(t, r.Archive(&buf, &ArchiveOptions{Format: ZipArchive, Prefix: "p/"}))
+	zr, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	require.NoError(t, err)
+	assert.Equal(t, c.Hash.String(), zr.Comment)
+
+	modes := map[int64]int64{0o775: 0o755, 0o664: 0o644, 0o777: 0o777}
+	entries = nil
+	for _, f := range zr.File {
+		assert.True(t, c.Committer.When.Equal(f.Modified), f.Name)
+		rc, err := f.Open()
+		require.NoError(t, err)
+		content, err := io.ReadAll(rc)
+		require.NoError(t, err)
+		require.NoError(t, rc.Close())
+
+		mode := f.Mode()
+		if mode&os.ModeSymlink != 0 {
+			content = []byte("-> " + string(content))
+		}
+
+		entries = append(entries, archivedEntry{f.Name, int64(mode.Perm()), string(content)})
+	}
+
+	for i := range expected {
+		expected[i].mode = modes[expected[i].mode]
+	}
+	assert.Equal(t, expected, entries)
+
+	// The files of a tree are archived without their placeholders replaced.
+	buf.Reset()
+	require.NoError(t, r.Archive(&buf, &ArchiveOptions{Commit: c.TreeHash}))
+	tr := tar.NewReader(&buf)
+	for {
+		hdr, err := tr.Next()
+		require.NoError(t, err)
+		assert.NotEqual(t, byte(tar.TypeXGlobalHeader), hdr.Typeflag)
+		if hdr.Name == "version.txt" {
+			content, err := io.ReadAll(tr)
+			require.NoError(t, err)
+			assert.True(t, strings.HasPrefix(string(content), "$Format:%H"))
+			break
+		}
+	}
+
+	err = r.Archive(&buf, &ArchiveOptions{Format: ArchiveFormat(42)})
+	assert.ErrorIs(t, err, ErrUnsupportedArchiveFormat)
+}
+
+func TestArchiveGit(t *testing.T) {
+	t.Parallel()
+
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git is not available")
+	}
+
+	dir := t.TempDir()
+	r, err := PlainInit(dir, false)
+	require.NoError(t, err)
+	w, err := r.Worktree()
+	require.NoError(t, err)
+	c := commitArchivedFiles(t, r, w.Filesystem)
+
+	cmd := exec.Command("git", "archive", "--prefix=p/", "HEAD")
+	cmd.Dir = dir
+	out, err := cmd.Output()
+	require.NoError(t, err)
+
+	var buf bytes.Buffer
+	require.NoError(t, r.Archive(&buf, &ArchiveOptions{Prefix: "p/"}))
+
+	expectedComment, expected := readTarArchive(t, bytes.NewReader(out), c.Committer.When)
+	comment, entries := readTarArchive(t, &buf, c.Committer.When)
+	assert.Equal(t, expectedComment, comment)
+	assert.Equal(t, expected, entries)
+	assert.Equal(t, expectedArchivedEntries(c, r, "p/"), entries)
+}
@@ -25,6 +25,9 @@ type Backend struct {
 	// ReceivePack indicates whether the handler should handle
 	// git-receive-pack requests.
 	ReceivePack bool
+	// Hooks, if not nil, runs the hooks of the pushes received by
+	// git-receive-pack.
+	Hooks transport.HookRunner
 	// ArchivePack indicates whether the handler should handle
 	// git-upload-archive requests.
 	// ArchivePack bool // TODO: Implement git-upload-archive support
@@ -104,6 +107,7 @@ func (b *Backend) ServeTCP(ctx context.Context, c io.ReadWriteCloser, req *packp
 			io.NopCloser(r), ioutil.WriteNopCloser(wc),
 			&transport.ReceivePackOptions{
 				GitProtocol: version,
+				Hooks:       b.Hooks,
 			})
 	}
 
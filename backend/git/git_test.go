@@ -0,0 +1,104 @@
+package git
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	fixtures "github.com/go-git/go-git-fixtures/v5"
+	"github.com/stretchr/testify/require"
+
+	"github.com/go-git/go-git/v6/plumbing/protocol/packp"
+	"github.com/go-git/go-git/v6/plumbing/transport"
+	"github.com/go-git/go-git/v6/storage"
+	"github.com/go-git/go-git/v6/storage/filesystem"
+)
+
+type storageLoader struct {
+	st storage.Storer
+}
+
+// Load implements transport.Loader.
+func (l storageLoader) Load(*transport.Endpoint) (storage.Storer, error) {
+	return l.st, nil
+}
+
+func TestUploadPackGit(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not found")
+	}
+
+	dot := fixtures.Basic().One().DotGit(fixtures.WithTargetDir(t.TempDir))
+	b := NewBackend(storageLoader{filesystem.NewStorage(dot, nil)})
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer l.Close() //nolint:errcheck
+
+	go func() {
+		for {
+			c, err := l.Accept()
+			if err != nil {
+				return
+			}
+
+			go func() {
+				var req packp.GitProtoRequest
+				if err := req.Decode(c); err != nil {
+					c.Close() //nolint:errcheck
+					return
+				}
+
+				b.ServeTCP(context.Background(), c, &req)
+			}()
+		}
+	}()
+
+	url := fmt.Sprintf("git://%s/basic.git", l.Addr())
+	git := func(dir string, args ...string) string {
+		cmd := exec.Command("git", args...)
+		cmd.Dir = dir
+		cmd.Env = append(os.Environ(),
+			"GIT_CONFIG_NOSYSTEM=1", "GIT_CONFIG_GLOBAL=/dev/null",
+			"GIT_AUTHOR_NAME=foo", "GIT_AUTHOR_EMAIL=foo@foo.foo",
+			"GIT_COMMITTER_NAME=foo", "GIT_COMMITTER_EMAIL=foo@foo.foo",
+		)
+		out, err := cmd.CombinedOutput()
+		require.NoError(t, err, string(out))
+		return strings.TrimSpace(string(out))
+	}
+
+	full, other, shallow := t.TempDir(), t.TempDir(), t.TempDir()
+	git(full, "clone", url, ".")
+	git(other, "clone", url, ".")
+	git(shallow, "clone", "--depth=2", url, ".")
+	require.Equal(t, "8", git(full, "rev-list", "--count", "HEAD"))
+	require.Equal(t, "2", git(shallow, "rev-list", "--count", "HEAD"))
+
+	// The clones fetch new commits, negotiating the ones they have. The
+	// commits are fetched by the server repository, receive-pack being
+	// disabled.
+	for i := range 3 {
+		name := fmt.Sprintf("new%d", i)
+		require.NoError(t, os.WriteFile(filepath.Join(full, name), []byte(name), 0o644))
+		git(full, "add", name)
+		git(full, "commit", "-m", name)
+	}
+
+	git(full, "--git-dir", dot.Root(), "fetch", "--update-head-ok", full, "master:master")
+	git(other, "fetch", "origin")
+	require.Equal(t, git(full, "rev-parse", "HEAD"), git(other, "rev-parse", "origin/master"))
+	git(shallow, "fetch", "--deepen=1", "origin")
+	require.Equal(t, "6", git(shallow, "rev-list", "--count", "origin/master"))
+	git(shallow, "fetch", "--unshallow", "origin")
+	require.Equal(t, "11", git(shallow, "rev-list", "--count", "origin/master"))
+
+	for _, dir := range []string{full, other, shallow} {
+		git(dir, "fsck", "--strict")
+	}
+}
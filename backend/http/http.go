@@ -55,6 +55,9 @@ type Backend struct {
 	// Prefix is a path prefix that will be stripped from the URL path before
 	// matching the service patterns.
 	Prefix string
+	// Hooks, if not nil, runs the hooks of the pushes received by the
+	// git-receive-pack service.
+	Hooks transport.HookRunner
 }
 
 // NewBackend returns a Git HTTP handler that serves git repositories over
@@ -66,6 +69,13 @@ type Backend struct {
 // repositories that wish to be server using the Dumb-HTTP protocol must update
 // the server info files. This can be done by using
 // [transport.UpdateServerInfo] before serving the repository.
+//
+// The Smart-HTTP services are served in the stateless-rpc mode of
+// git-http-backend: each request is self-contained, the clients sending again
+// the state of the negotiation in each of its requests, and no state is kept
+// between them. The requests of a client may thus be served by distinct
+// instances, such as the ones of a serverless deployment, as long as they load
+// the same repositories.
 func NewBackend(loader transport.Loader) *Backend {
 	if loader == nil {
 		loader = transport.DefaultLoader
@@ -109,6 +119,7 @@ func (b *Backend) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 			ctx = context.WithValue(ctx, contextKey("service"), s.svc)
 			ctx = context.WithValue(ctx, contextKey("storer"), st)
 			ctx = context.WithValue(ctx, contextKey("endpoint"), ep)
+			ctx = context.WithValue(ctx, contextKey("hooks"), b.Hooks)
 
 			s.handler(w, r.WithContext(ctx))
 			return
@@ -143,6 +154,8 @@ func serviceRpc(w http.ResponseWriter, r *http.Request) {
 		renderStatusError(w, http.StatusInternalServerError)
 		return
 	}
+	// The hooks are optional.
+	hooks, _ := ctx.Value(contextKey("hooks")).(transport.HookRunner)
 	version := r.Header.Get("Git-Protocol")
 	contentType := strings.ToLower(strings.TrimSpace(r.Header.Get("Content-Type")))
 
@@ -188,6 +201,7 @@ func serviceRpc(w http.ResponseWriter, r *http.Request) {
 				GitProtocol:   version,
 				AdvertiseRefs: false,
 				StatelessRPC:  true,
+				Hooks:         hooks,
 			})
 	default:
 		// TODO: Support git-upload-archive
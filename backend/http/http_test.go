@@ -1,13 +1,25 @@
 package http
 
 import (
+	"fmt"
 	"io"
+	"net/http"
 	"net/http/httptest"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
 	"testing"
 
+	"github.com/go-git/go-billy/v6/osfs"
 	fixtures "github.com/go-git/go-git-fixtures/v5"
 	"github.com/stretchr/testify/require"
 
+	git "github.com/go-git/go-git/v6"
+	"github.com/go-git/go-git/v6/config"
+	"github.com/go-git/go-git/v6/plumbing"
+	"github.com/go-git/go-git/v6/plumbing/protocol"
 	"github.com/go-git/go-git/v6/plumbing/protocol/packp/capability"
 	"github.com/go-git/go-git/v6/plumbing/transport"
 	"github.com/go-git/go-git/v6/storage"
@@ -30,6 +42,15 @@ func (f *fixturesLoader) Load(ep *transport.Endpoint) (storage.Storer, error) {
 	return st, nil
 }
 
+type storageLoader struct {
+	st storage.Storer
+}
+
+// Load implements transport.Loader.
+func (l storageLoader) Load(*transport.Endpoint) (storage.Storer, error) {
+	return l.st, nil
+}
+
 func TestNilLoaderBackend(t *testing.T) {
 	h := NewBackend(nil)
 	req := httptest.NewRequest("GET", "/", nil)
@@ -46,7 +67,7 @@ e8d3ffab552895c19b9fcf7aa264d277cde33881	refs/remotes/origin/branch
 6ecf0ef2c2dffb796033e5a02219af86ec6584e5	refs/remotes/origin/master
 `
 	expectedSmart := `001e# service=git-upload-pack
-000000b46ecf0ef2c2dffb796033e5a02219af86ec6584e5 HEAD` + "\x00" + `agent=` + capability.DefaultAgent() + ` ofs-delta side-band-64k multi_ack multi_ack_detailed side-band no-progress shallow symref=HEAD:refs/heads/master
+000000c46ecf0ef2c2dffb796033e5a02219af86ec6584e5 HEAD` + "\x00" + `agent=` + capability.DefaultAgent() + ` ofs-delta side-band-64k multi_ack multi_ack_detailed side-band no-progress shallow deepen-relative symref=HEAD:refs/heads/master
 003fe8d3ffab552895c19b9fcf7aa264d277cde33881 refs/heads/branch
 003f6ecf0ef2c2dffb796033e5a02219af86ec6584e5 refs/heads/master
 00466ecf0ef2c2dffb796033e5a02219af86ec6584e5 refs/remotes/origin/HEAD
@@ -84,3 +105,217 @@ func TestDumbInfoRefs(t *testing.T) {
 func TestSmartInfoRefs(t *testing.T) {
 	testInfoRefs(t, true)
 }
+
+func TestReceivePackGitAtomic(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not found")
+	}
+
+	dot := fixtures.Basic().One().DotGit(fixtures.WithTargetDir(t.TempDir))
+	st := filesystem.NewStorage(dot, nil)
+	srv := httptest.NewServer(NewBackend(storageLoader{st}))
+	defer srv.Close()
+
+	dir := t.TempDir()
+	git := func(args ...string) (string, error) {
+		return runGit(dir, args...)
+	}
+
+	// The repository is cloned from the fixture, as only pushes are tested.
+	out, err := git("clone", fixtures.Basic().One().DotGit(fixtures.WithTargetDir(t.TempDir)).Root(), ".")
+	require.NoError(t, err, out)
+	out, err = git("remote", "set-url", "origin", srv.URL+"/basic.git")
+	require.NoError(t, err, out)
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "new"), []byte("new\n"), 0o644))
+	out, err = git("add", "new")
+	require.NoError(t, err, out)
+	out, err = git("commit", "-m", "new")
+	require.NoError(t, err, out)
+
+	out, err = git("push", "--atomic", "origin", "master", "master:refs/heads/new", ":refs/heads/branch")
+	require.NoError(t, err, out)
+	head, err := git("rev-parse", "HEAD")
+	require.NoError(t, err, head)
+	for _, name := range []plumbing.ReferenceName{plumbing.Master, "refs/heads/new"} {
+		ref, err := st.Reference(name)
+		require.NoError(t, err)
+		require.Equal(t, strings.TrimSpace(head), ref.Hash().String())
+	}
+
+	_, err = st.Reference("refs/heads/branch")
+	require.ErrorIs(t, err, plumbing.ErrReferenceNotFound)
+}
+
+func TestUploadPackGit(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not found")
+	}
+
+	dot := fixtures.Basic().One().DotGit(fixtures.WithTargetDir(t.TempDir))
+	st := filesystem.NewStorage(dot, nil)
+	srv := httptest.NewServer(NewBackend(storageLoader{st}))
+	defer srv.Close()
+
+	url := srv.URL + "/basic.git"
+	git := func(dir string, args ...string) string {
+		out, err := runGit(dir, args...)
+		require.NoError(t, err, out)
+		return strings.TrimSpace(out)
+	}
+
+	full, other, shallow := t.TempDir(), t.TempDir(), t.TempDir()
+	git(full, "clone", url, ".")
+	git(other, "clone", url, ".")
+	git(shallow, "clone", "--depth=1", url, ".")
+	require.Equal(t, "8", git(full, "rev-list", "--count", "HEAD"))
+	require.Equal(t, "1", git(shallow, "rev-list", "--count", "HEAD"))
+	shallowFile, err := os.ReadFile(filepath.Join(shallow, ".git", "shallow"))
+	require.NoError(t, err)
+	require.Equal(t, git(full, "rev-parse", "HEAD"), strings.TrimSpace(string(shallowFile)))
+
+	// The clones fetch new commits, negotiating the ones they have.
+	for i := range 3 {
+		name := fmt.Sprintf("new%d", i)
+		require.NoError(t, os.WriteFile(filepath.Join(full, name), []byte(name), 0o644))
+		git(full, "add", name)
+		git(full, "commit", "-m", name)
+	}
+
+	git(full, "push", "origin", "master")
+	git(other, "fetch", "origin")
+	require.Equal(t, git(full, "rev-parse", "HEAD"), git(other, "rev-parse", "origin/master"))
+	git(shallow, "fetch", "origin")
+	require.Equal(t, "4", git(shallow, "rev-list", "--count", "origin/master"))
+
+	git(shallow, "fetch", "--deepen=2", "origin")
+	require.Equal(t, "6", git(shallow, "rev-list", "--count", "origin/master"))
+	git(shallow, "fetch", "--unshallow", "origin")
+	require.Equal(t, "11", git(shallow, "rev-list", "--count", "origin/master"))
+	require.NoFileExists(t, filepath.Join(shallow, ".git", "shallow"))
+
+	for _, dir := range []string{full, other, shallow} {
+		git(dir, "fsck", "--strict")
+	}
+}
+
+func TestStatelessRPC(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not found")
+	}
+
+	base := t.TempDir()
+	repo := filepath.Join(base, "repo.git")
+	out, err := runGit(base, "init", "--bare", "-b", "master", repo)
+	require.NoError(t, err, out)
+	writeCommits(t, repo, "base", 5)
+
+	// Each request is served by a new backend, loading the repository
+	// again, as the instances of a serverless deployment do: no state is
+	// kept between the requests of a negotiation.
+	var posts atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodPost {
+			posts.Add(1)
+		}
+
+		NewBackend(transport.NewFilesystemLoader(osfs.New(base), false)).ServeHTTP(w, r)
+	}))
+	defer srv.Close()
+
+	url := srv.URL + "/repo.git"
+	run := func(dir string, args ...string) string {
+		out, err := runGit(dir, args...)
+		require.NoError(t, err, out)
+		return strings.TrimSpace(out)
+	}
+
+	// The clients have many commits the server does not have, and forget
+	// the commits of the remote, for their haves to be sent over several
+	// requests.
+	diverge := func(dir, name string) {
+		writeCommits(t, filepath.Join(dir, ".git"), name, 300)
+		run(dir, "update-ref", "-d", "refs/remotes/origin/master")
+		run(dir, "update-ref", "-d", "refs/remotes/origin/HEAD")
+		writeCommits(t, repo, "new-"+name, 2)
+	}
+
+	dir := t.TempDir()
+	r, err := git.PlainClone(dir, &git.CloneOptions{URL: url})
+	require.NoError(t, err)
+	for _, version := range []int{0, 2} {
+		// The repository is opened again to read the commits written
+		// by git.
+		diverge(dir, fmt.Sprintf("go-git-v%d", version))
+		r, err = git.PlainOpen(dir)
+		require.NoError(t, err)
+		cfg, err := r.Config()
+		require.NoError(t, err)
+		cfg.Protocol.Version = protocol.Version(version)
+		require.NoError(t, r.SetConfig(cfg))
+
+		posts.Store(0)
+		require.NoError(t, r.Fetch(&git.FetchOptions{}))
+		require.Greater(t, posts.Load(), int32(1), "go-git v%d", version)
+		require.Equal(t, run(repo, "rev-parse", "master"), run(dir, "rev-parse", "origin/master"))
+		run(dir, "fsck", "--strict")
+	}
+
+	require.NoError(t, r.Push(&git.PushOptions{
+		RefSpecs: []config.RefSpec{"refs/heads/master:refs/heads/pushed"},
+	}))
+	require.Equal(t, run(dir, "rev-parse", "master"), run(repo, "rev-parse", "pushed"))
+
+	for _, version := range []string{"0", "2"} {
+		dir := t.TempDir()
+		run(dir, "clone", url, ".")
+		diverge(dir, "git-v"+version)
+
+		posts.Store(0)
+		run(dir, "-c", "protocol.version="+version, "fetch", "origin")
+		require.Greater(t, posts.Load(), int32(1), "git v%s", version)
+		require.Equal(t, run(repo, "rev-parse", "master"), run(dir, "rev-parse", "origin/master"))
+		run(dir, "fsck", "--strict")
+	}
+
+	run(repo, "fsck", "--strict")
+}
+
+// writeCommits writes n commits on the master branch of the repository whose
+// git directory is gitDir, each adding a file.
+func writeCommits(t *testing.T, gitDir, name string, n int) {
+	t.Helper()
+
+	// The commits follow the one of the branch, if any.
+	from, err := exec.Command("git", "--git-dir", gitDir, "rev-parse", "--verify", "-q", "master").Output()
+	if err != nil {
+		from = nil
+	}
+
+	var stream strings.Builder
+	for i := range n {
+		msg := fmt.Sprintf("%s %d\n", name, i)
+		fmt.Fprintf(&stream, "commit refs/heads/master\ncommitter foo <foo@foo.foo> %d +0000\ndata %d\n%s", 1700000000+i, len(msg), msg)
+		if i == 0 && len(from) > 0 {
+			fmt.Fprintf(&stream, "from %s", from)
+		}
+
+		fmt.Fprintf(&stream, "M 644 inline %s-%d\ndata %d\n%s\n", name, i, len(msg), msg)
+	}
+
+	cmd := exec.Command("git", "--git-dir", gitDir, "fast-import", "--quiet")
+	cmd.Stdin = strings.NewReader(stream.String())
+	out, err := cmd.CombinedOutput()
+	require.NoError(t, err, string(out))
+}
+
+func runGit(dir string, args ...string) (string, error) {
+	cmd := exec.Command("git", args...)
+	cmd.Dir = dir
+	cmd.Env = append(os.Environ(),
+		"GIT_CONFIG_NOSYSTEM=1", "GIT_CONFIG_GLOBAL=/dev/null",
+		"GIT_AUTHOR_NAME=foo", "GIT_AUTHOR_EMAIL=foo@foo.foo",
+		"GIT_COMMITTER_NAME=foo", "GIT_COMMITTER_EMAIL=foo@foo.foo",
+	)
+	out, err := cmd.CombinedOutput()
+	return string(out), err
+}
@@ -0,0 +1,408 @@
+package git
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+
+	"github.com/go-git/go-git/v6/plumbing"
+	"github.com/go-git/go-git/v6/plumbing/format/packfile/bitmap"
+	"github.com/go-git/go-git/v6/plumbing/object"
+)
+
+var (
+	// ErrBisectSkipped is returned by Bisect.Next and Bisect.Run when only
+	// skipped commits are left to test, the first bad commit being one of
+	// Bisect.Candidates.
+	ErrBisectSkipped = errors.New("only skipped commits are left to test")
+	// ErrBisectBadReachableFromGood is returned when the bad commit is
+	// reachable from a good one, the first bad commit being undefined.
+	ErrBisectBadReachableFromGood = errors.New("bad commit is reachable from a good one")
+	// ErrBisectSkip is returned by the test of Bisect.Run for the commit to be
+	// skipped, as the exit code 125 does with `git bisect run`.
+	ErrBisectSkip = errors.New("skip the commit")
+)
+
+// Bisect finds the commit which introduced a change, the first bad commit,
+// by a binary search of the history, as `git bisect` does. Each commit to
+// test, returned by Next, is marked good or bad, and the search converges to
+// the first bad commit, returned by FirstBad. The worktree is not checked
+// out, the commits being tested as the caller sees fit.
+type Bisect struct {
+	r    *Repository
+	bad  *object.Commit
+	skip map[plumbing.Hash]bool
+	// good are the commits reachable from the good ones.
+	good    map[plumbing.Hash]bool
+	bitmaps []*bitmap.Index
+	commits map[plumbing.Hash]*object.Commit
+	// candidates are the commits reachable from bad but not from the good
+	// ones, newest first, nil once a commit is marked.
+	candidates []*object.Commit
+}
+
+// Bisect starts a bisection between the bad commit and the good ones, none
+// meaning that the first bad commit may be any commit of the history of the
+// bad one. If the objects are stored with pack bitmaps, the history of the
+// good commits is read from them instead of being walked.
+func (r *Repository) Bisect(bad plumbing.Hash, good ...plumbing.Hash) (*Bisect, error) {
+	b := &Bisect{
+		r:       r,
+		skip:    make(map[plumbing.Hash]bool),
+		good:    make(map[plumbing.Hash]bool),
+		commits: make(map[plumbing.Hash]*object.Commit),
+	}
+
+	if bs, ok := r.Storer.(bitmap.Storer); ok {
+		var err error
+		if b.bitmaps, err = bs.BitmapIndexes(); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := b.Mark(bad, false); err != nil {
+		return nil, err
+	}
+
+	for _, h := range good {
+		if err := b.Mark(h, true); err != nil {
+			return nil, err
+		}
+	}
+
+	return b, nil
+}
+
+// Mark marks the given commit good or bad. A bad commit replaces the bad
+// one, the first bad commit being searched in its history.
+// ErrBisectBadReachableFromGood is returned if the commit contradicts the
+// commits already marked.
+func (b *Bisect) Mark(h plumbing.Hash, good bool) error {
+	c, err := b.commit(h)
+	if err != nil {
+		return err
+	}
+
+	if !good {
+		if b.good[c.Hash] {
+			return fmt.Errorf("%w: %s", ErrBisectBadReachableFromGood, c.Hash)
+		}
+
+		b.bad = c
+		b.candidates = nil
+		return nil
+	}
+
+	reachable, err := b.reachableFromGood(c)
+	if err != nil {
+		return err
+	}
+
+	if b.bad != nil && reachable[b.bad.Hash] {
+		return fmt.Errorf("%w: %s from %s", ErrBisectBadReachableFromGood, b.bad.Hash, c.Hash)
+	}
+
+	for h := range reachable {
+		b.good[h] = true
+	}
+
+	b.candidates = nil
+	return nil
+}
+
+// Skip marks the given commit as untestable, another commit being tested
+// instead.
+func (b *Bisect) Skip(h plumbing.Hash) error {
+	c, err := b.commit(h)
+	if err != nil {
+		return err
+	}
+
+	b.skip[c.Hash] = true
+	return nil
+}
+
+// Next returns the commit to test, the one splitting the candidates the
+// most evenly, where the first bad commit is as likely to be reachable from
+// it as not. nil is returned once the first bad commit is found, and
+// ErrBisectSkipped if only skipped commits are left to test.
+//
+// The commit is the one git chooses: the candidates are weighted from the
+// oldest one by the number of candidates reachable from them, the merges
+// first, the first commit weighted halfway being returned, or else the first
+// one closest to halfway.
+func (b *Bisect) Next() (*object.Commit, error) {
+	candidates, err := b.update()
+	if err != nil {
+		return nil, err
+	}
+
+	n := len(candidates)
+	if n == 1 {
+		return nil, nil
+	}
+
+	isCandidate := make(map[plumbing.Hash]bool, n)
+	for _, c := range candidates {
+		isCandidate[c.Hash] = true
+	}
+
+	parents := func(c *object.Commit) []plumbing.Hash {
+		var hashes []plumbing.Hash
+		for _, p := range c.ParentHashes {
+			if isCandidate[p] {
+				hashes = append(hashes, p)
+			}
+		}
+
+		return hashes
+	}
+
+	weights := make(map[plumbing.Hash]int, n)
+	halfway := func(c *object.Commit) bool {
+		d := 2*weights[c.Hash] - n
+		return !b.skip[c.Hash] && d >= -1 && d <= 1
+	}
+
+	list := make([]*object.Commit, n)
+	for i, c := range candidates {
+		list[n-1-i] = c
+	}
+
+	for _, c := range list {
+		if len(parents(c)) == 0 {
+			weights[c.Hash] = 1
+		}
+	}
+
+	// The weight of a merge is counted, the one of a commit having a single
+	// parent being the one of its parent plus one.
+	for _, c := range list {
+		if len(parents(c)) > 1 {
+			weights[c.Hash] = b.countReachable(c, isCandidate)
+			if halfway(c) {
+				return c, nil
+			}
+		}
+	}
+
+	for len(weights) < n {
+		for _, c := range list {
+			if _, ok := weights[c.Hash]; ok {
+				continue
+			}
+
+			w, ok := weights[parents(c)[0]]
+			if !ok {
+				continue
+			}
+
+			weights[c.Hash] = w + 1
+			if halfway(c) {
+				return c, nil
+			}
+		}
+	}
+
+	var best *object.Commit
+	bestScore := 0
+	for _, c := range list {
+		score := min(weights[c.Hash], n-weights[c.Hash])
+		if !b.skip[c.Hash] && score > bestScore {
+			best, bestScore = c, score
+		}
+	}
+
+	if best == nil {
+		return nil, ErrBisectSkipped
+	}
+
+	return best, nil
+}
+
+// FirstBad returns the first bad commit, nil until it is found.
+func (b *Bisect) FirstBad() (*object.Commit, error) {
+	candidates, err := b.update()
+	if err != nil {
+		return nil, err
+	}
+
+	if len(candidates) != 1 {
+		return nil, nil
+	}
+
+	return candidates[0], nil
+}
+
+// Candidates returns the commits which may be the first bad commit, the bad
+// one included, newest first.
+func (b *Bisect) Candidates() ([]plumbing.Hash, error) {
+	candidates, err := b.update()
+	if err != nil {
+		return nil, err
+	}
+
+	hashes := make([]plumbing.Hash, len(candidates))
+	for i, c := range candidates {
+		hashes[i] = c.Hash
+	}
+
+	return hashes, nil
+}
+
+// Run bisects until the first bad commit is found, and returns it. The
+// commits to test are passed to test, which reports whether they are good,
+// or returns ErrBisectSkip for them to be skipped. The other errors of test
+// stop the bisection and are returned.
+func (b *Bisect) Run(test func(*object.Commit) (bool, error)) (*object.Commit, error) {
+	for {
+		c, err := b.Next()
+		if err != nil {
+			return nil, err
+		}
+
+		if c == nil {
+			return b.FirstBad()
+		}
+
+		good, err := test(c)
+		switch {
+		case errors.Is(err, ErrBisectSkip):
+			err = b.Skip(c.Hash)
+		case err != nil:
+			return nil, err
+		default:
+			err = b.Mark(c.Hash, good)
+		}
+
+		if err != nil {
+			return nil, err
+		}
+	}
+}
+
+func (b *Bisect) commit(h plumbing.Hash) (*object.Commit, error) {
+	if c, ok := b.commits[h]; ok {
+		return c, nil
+	}
+
+	c, err := b.r.CommitObject(h)
+	if err != nil {
+		return nil, err
+	}
+
+	b.commits[h] = c
+	return c, nil
+}
+
+// reachableFromGood returns the commits reachable from c which are not yet
+// known to be reachable from the good commits, read from the bitmaps of the
+// commits having one.
+func (b *Bisect) reachableFromGood(c *object.Commit) (map[plumbing.Hash]bool, error) {
+	reachable := make(map[plumbing.Hash]bool)
+	pending := []plumbing.Hash{c.Hash}
+	for len(pending) > 0 {
+		h := pending[len(pending)-1]
+		pending = pending[:len(pending)-1]
+		if b.good[h] || reachable[h] {
+			continue
+		}
+
+		if b.reachableFromBitmap(h, reachable) {
+			continue
+		}
+
+		c, err := b.commit(h)
+		if err != nil {
+			return nil, err
+		}
+
+		reachable[h] = true
+		pending = append(pending, c.ParentHashes...)
+	}
+
+	return reachable, nil
+}
+
+// reachableFromBitmap adds the commits reachable from h to reachable, using
+// the first bitmap of h. false is returned if h has none.
+func (b *Bisect) reachableFromBitmap(h plumbing.Hash, reachable map[plumbing.Hash]bool) bool {
+	for _, idx := range b.bitmaps {
+		bm, ok := idx.Bitmap(h)
+		if !ok {
+			continue
+		}
+
+		objects := idx.Objects()
+		bm.ForEach(func(pos uint32) bool {
+			if idx.Commits.Contains(pos) && int(pos) < len(objects) {
+				reachable[objects[pos]] = true
+			}
+			return true
+		})
+
+		reachable[h] = true
+		return true
+	}
+
+	return false
+}
+
+// update returns the candidates, walking the history of the bad commit
+// until the commits reachable from the good ones if they changed.
+func (b *Bisect) update() ([]*object.Commit, error) {
+	if b.candidates != nil {
+		return b.candidates, nil
+	}
+
+	var candidates []*object.Commit
+	seen := make(map[plumbing.Hash]bool)
+	pending := []plumbing.Hash{b.bad.Hash}
+	for len(pending) > 0 {
+		h := pending[len(pending)-1]
+		pending = pending[:len(pending)-1]
+		if seen[h] || b.good[h] {
+			continue
+		}
+		seen[h] = true
+
+		c, err := b.commit(h)
+		if err != nil {
+			return nil, err
+		}
+
+		candidates = append(candidates, c)
+		pending = append(pending, c.ParentHashes...)
+	}
+
+	sort.Slice(candidates, func(i, j int) bool {
+		ti, tj := candidates[i].Committer.When, candidates[j].Committer.When
+		if !ti.Equal(tj) {
+			return ti.After(tj)
+		}
+
+		return candidates[i].Hash.Compare(candidates[j].Hash.Bytes()) < 0
+	})
+
+	b.candidates = candidates
+	return candidates, nil
+}
+
+// countReachable returns the number of candidates reachable from c, itself
+// included.
+func (b *Bisect) countReachable(c *object.Commit, isCandidate map[plumbing.Hash]bool) int {
+	seen := map[plumbing.Hash]bool{c.Hash: true}
+	pending := []*object.Commit{c}
+	for len(pending) > 0 {
+		c := pending[len(pending)-1]
+		pending = pending[:len(pending)-1]
+		for _, p := range c.ParentHashes {
+			if isCandidate[p] && !seen[p] {
+				seen[p] = true
+				pending = append(pending, b.commits[p])
+			}
+		}
+	}
+
+	return len(seen)
+}
@@ -0,0 +1,252 @@
+package git
+
+import (
+	"fmt"
+	"math/bits"
+	"os/exec"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-git/go-billy/v6/memfs"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/go-git/go-git/v6/plumbing"
+	"github.com/go-git/go-git/v6/plumbing/object"
+	"github.com/go-git/go-git/v6/storage/memory"
+)
+
+// newLinearRepository returns a repository with n commits, c0 to c(n-1),
+// each one being the parent of the next one.
+func newLinearRepository(t *testing.T, r *Repository, n int) []plumbing.Hash {
+	t.Helper()
+
+	tree, err := NewTreeBuilder(r.Storer, nil).Write()
+	require.NoError(t, err)
+
+	var commits []plumbing.Hash
+	for i := 0; i < n; i++ {
+		cb := NewCommitBuilder(r.Storer)
+		cb.Tree = tree
+		cb.Parents = commits[max(0, i-1):]
+		cb.Author = &object.Signature{Name: "foo", Email: "foo@foo.foo", When: time.Unix(int64(1e9+i*60), 0).UTC()}
+		cb.Message = fmt.Sprintf("c%d\n", i)
+		h, err := cb.Write()
+		require.NoError(t, err)
+		commits = append(commits, h)
+	}
+
+	return commits
+}
+
+func TestBisectLinear(t *testing.T) {
+	t.Parallel()
+
+	r, err := Init(memory.NewStorage())
+	require.NoError(t, err)
+	commits := newLinearRepository(t, r, 20)
+	index := make(map[plumbing.Hash]int)
+	for i, h := range commits {
+		index[h] = i
+	}
+
+	maxSteps := bits.Len(uint(len(commits)))
+	for first := 1; first < len(commits); first++ {
+		b, err := r.Bisect(commits[len(commits)-1], commits[0])
+		require.NoError(t, err)
+
+		steps := 0
+		c, err := b.Run(func(c *object.Commit) (bool, error) {
+			steps++
+			return index[c.Hash] < first, nil
+		})
+		require.NoError(t, err)
+		assert.Equal(t, commits[first], c.Hash, first)
+		assert.LessOrEqual(t, steps, maxSteps, first)
+
+		next, err := b.Next()
+		require.NoError(t, err)
+		assert.Nil(t, next)
+	}
+}
+
+func TestBisectMerges(t *testing.T) {
+	t.Parallel()
+
+	r, err := Init(memory.NewStorage(), WithWorkTree(memfs.New()))
+	require.NoError(t, err)
+	commits := newDescribeRepository(t, r)
+
+	// The first bad commit is found for every commit of the history but the
+	// good one, the bad commits being the ones from which it is reachable.
+	for name, first := range commits {
+		if name == "c1" {
+			continue
+		}
+
+		b, err := r.Bisect(commits["c5"], commits["c1"])
+		require.NoError(t, err)
+
+		c, err := b.Run(func(c *object.Commit) (bool, error) {
+			if c.Hash == first {
+				return false, nil
+			}
+
+			fc, err := r.CommitObject(first)
+			if err != nil {
+				return false, err
+			}
+
+			bad, err := fc.IsAncestor(c)
+			return !bad, err
+		})
+		require.NoError(t, err, name)
+		assert.Equal(t, first, c.Hash, name)
+	}
+}
+
+func TestBisectSkip(t *testing.T) {
+	t.Parallel()
+
+	r, err := Init(memory.NewStorage())
+	require.NoError(t, err)
+	commits := newLinearRepository(t, r, 10)
+
+	b, err := r.Bisect(commits[9], commits[0])
+	require.NoError(t, err)
+
+	// The first bad commit, c5, is skipped.
+	var tested []plumbing.Hash
+	_, err = b.Run(func(c *object.Commit) (bool, error) {
+		tested = append(tested, c.Hash)
+		if c.Hash == commits[5] {
+			return false, ErrBisectSkip
+		}
+
+		return c.Committer.When.Before(time.Unix(1e9+5*60, 0)), nil
+	})
+	assert.ErrorIs(t, err, ErrBisectSkipped)
+	assert.Contains(t, tested, commits[5])
+
+	candidates, err := b.Candidates()
+	require.NoError(t, err)
+	assert.Equal(t, []plumbing.Hash{commits[6], commits[5]}, candidates)
+
+	// Once marked, it is the first bad commit.
+	require.NoError(t, b.Mark(commits[5], false))
+	c, err := b.FirstBad()
+	require.NoError(t, err)
+	assert.Equal(t, commits[5], c.Hash)
+}
+
+func TestBisectErrors(t *testing.T) {
+	t.Parallel()
+
+	r, err := Init(memory.NewStorage())
+	require.NoError(t, err)
+	commits := newLinearRepository(t, r, 5)
+
+	_, err = r.Bisect(commits[2], commits[3])
+	assert.ErrorIs(t, err, ErrBisectBadReachableFromGood)
+	_, err = r.Bisect(commits[2], commits[2])
+	assert.ErrorIs(t, err, ErrBisectBadReachableFromGood)
+	_, err = r.Bisect(plumbing.NewHash("6ecf0ef2c2dffb796033e5a02219af86ec6584e5"))
+	assert.ErrorIs(t, err, plumbing.ErrObjectNotFound)
+
+	b, err := r.Bisect(commits[4], commits[1])
+	require.NoError(t, err)
+	assert.ErrorIs(t, b.Mark(commits[0], false), ErrBisectBadReachableFromGood)
+
+	// Without good commit, the whole history is searched.
+	b, err = r.Bisect(commits[4])
+	require.NoError(t, err)
+	candidates, err := b.Candidates()
+	require.NoError(t, err)
+	assert.Len(t, candidates, 5)
+
+	c, err := b.FirstBad()
+	require.NoError(t, err)
+	assert.Nil(t, c)
+
+	fail := fmt.Errorf("test failed")
+	_, err = b.Run(func(*object.Commit) (bool, error) { return false, fail })
+	assert.ErrorIs(t, err, fail)
+}
+
+func TestBisectGit(t *testing.T) {
+	t.Parallel()
+
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not found")
+	}
+
+	dir := t.TempDir()
+	r, err := PlainInit(dir, false)
+	require.NoError(t, err)
+	commits := newDescribeRepository(t, r)
+	linear := newLinearRepository(t, r, 15)
+
+	// on top of master, whose history is read from its bitmap.
+	tree, err := NewTreeBuilder(r.Storer, nil).Write()
+	require.NoError(t, err)
+	top := []plumbing.Hash{commits["c5"]}
+	for i := 0; i < 3; i++ {
+		cb := NewCommitBuilder(r.Storer)
+		cb.Tree = tree
+		cb.Parents = top[i:]
+		cb.Author = &object.Signature{Name: "foo", Email: "foo@foo.foo", When: time.Date(2021, 1, i+1, 0, 0, 0, 0, time.UTC)}
+		cb.Message = fmt.Sprintf("top%d\n", i)
+		h, err := cb.Write()
+		require.NoError(t, err)
+		top = append(top, h)
+	}
+
+	git := func(args ...string) string {
+		cmd := exec.Command("git", args...)
+		cmd.Dir = dir
+		out, err := cmd.CombinedOutput()
+		require.NoError(t, err, string(out))
+		return strings.TrimSpace(string(out))
+	}
+
+	cases := []struct {
+		bad  plumbing.Hash
+		good []plumbing.Hash
+	}{
+		{commits["c5"], []plumbing.Hash{commits["c1"]}},
+		{commits["c5"], []plumbing.Hash{commits["s1"]}},
+		{commits["c5"], []plumbing.Hash{commits["c3"], commits["s1"]}},
+		{commits["merge"], []plumbing.Hash{commits["c2"]}},
+		{linear[14], []plumbing.Hash{linear[0]}},
+		{linear[14], []plumbing.Hash{linear[3]}},
+		{linear[9], nil},
+		{top[3], []plumbing.Hash{commits["c5"]}},
+		{top[3], []plumbing.Hash{commits["c4"]}},
+	}
+
+	// The bitmaps of the good commits give the same candidates.
+	for _, bitmaps := range []bool{false, true} {
+		if bitmaps {
+			git("repack", "-adq", "--write-bitmap-index")
+		}
+
+		r, err := PlainOpen(dir)
+		require.NoError(t, err)
+		for _, tc := range cases {
+			args := []string{"rev-list", "--bisect", tc.bad.String()}
+			for _, h := range tc.good {
+				args = append(args, "^"+h.String())
+			}
+
+			b, err := r.Bisect(tc.bad, tc.good...)
+			require.NoError(t, err)
+			c, err := b.Next()
+			require.NoError(t, err)
+			assert.Equal(t, git(args...), c.Hash.String(), "%s %v", tc.bad, tc.good)
+
+			// master has a bitmap once repacked.
+			assert.Equal(t, bitmaps, b.reachableFromBitmap(commits["c5"], make(map[plumbing.Hash]bool)))
+		}
+	}
+}
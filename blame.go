@@ -3,6 +3,7 @@ package git
 import (
 	"bytes"
 	"container/heap"
+	"context"
 	"errors"
 	"fmt"
 	"io"
@@ -23,13 +24,28 @@ type BlameResult struct {
 	Path string
 	// Rev (Revision) is the hash of the specified Commit used to generate this result.
 	Rev plumbing.Hash
-	// Lines contains every line with its authorship.
+	// StartLine is the number, starting from 1, of the first line in Lines.
+	StartLine int
+	// Lines contains every line with its authorship, or those in the
+	// LineRange of the BlameOptions.
 	Lines []*Line
 }
 
 // Blame returns a BlameResult with the information about the last author of
-// each line from file `path` at commit `c`.
+// each line from file `path` at commit `c`. The file is followed across
+// renames.
 func Blame(c *object.Commit, path string) (*BlameResult, error) {
+	return BlameWithOptions(c, path, nil)
+}
+
+// BlameWithOptions returns a BlameResult with the information about the last
+// author of each line, or of the lines in opts.LineRange, from file `path` at
+// commit `c`. If opts is nil, the file is followed across renames, as Blame
+// does.
+func BlameWithOptions(c *object.Commit, path string, opts *BlameOptions) (*BlameResult, error) {
+	if opts == nil {
+		opts = &BlameOptions{FollowRenames: true}
+	}
 	// The file to blame is identified by the input arguments:
 	// commit and path. commit is a Commit object obtained from a Repository. Path
 	// represents a path to a specific file contained in the repository.
@@ -50,6 +66,7 @@ func Blame(c *object.Commit, path string) (*BlameResult, error) {
 	b.fRev = c
 	b.path = path
 	b.q = new(priorityQueue)
+	b.followRenames = opts.FollowRenames
 
 	file, err := b.fRev.File(path)
 	if err != nil {
@@ -59,11 +76,17 @@ func Blame(c *object.Commit, path string) (*BlameResult, error) {
 	if err != nil {
 		return nil, err
 	}
+	start, end, err := opts.lineRange(len(finalLines))
+	if err != nil {
+		return nil, err
+	}
+
+	finalLines = finalLines[start:end]
 	finalLength := len(finalLines)
 
 	needsMap := make([]lineMap, finalLength)
 	for i := range needsMap {
-		needsMap[i] = lineMap{i, i, nil, -1}
+		needsMap[i] = lineMap{start + i, start + i, nil, "", -1}
 	}
 	contents, err := file.Contents()
 	if err != nil {
@@ -109,11 +132,17 @@ func Blame(c *object.Commit, path string) (*BlameResult, error) {
 	}
 
 	lines := newLines(finalLines, b.lineToCommit)
+	for i := range needsMap {
+		if needsMap[i].Path != path {
+			lines[i].Path = needsMap[i].Path
+		}
+	}
 
 	return &BlameResult{
-		Path:  path,
-		Rev:   c.Hash,
-		Lines: lines,
+		Path:      path,
+		Rev:       c.Hash,
+		StartLine: start + 1,
+		Lines:     lines,
 	}, nil
 }
 
@@ -129,6 +158,10 @@ type Line struct {
 	Date time.Time
 	// Hash is the commit hash that introduced the original line
 	Hash plumbing.Hash
+	// Path is the path of the file in the commit that introduced the line,
+	// if it differs from the path blamed, as the file has been renamed since.
+	// Otherwise, it is empty.
+	Path string
 }
 
 func newLine(author, authorName, text string, date time.Time, hash plumbing.Hash) *Line {
@@ -164,11 +197,14 @@ type blame struct {
 	lineToCommit []*object.Commit
 	// queue of commits that need resolving
 	q *priorityQueue
+	// whether to follow the file across renames
+	followRenames bool
 }
 
 type lineMap struct {
 	Orig, Cur    int
 	Commit       *object.Commit
+	Path         string
 	FromParentNo int
 }
 
@@ -241,7 +277,7 @@ func (b *blame) addBlames(curItems []*queueItem) (bool, error) {
 		curItem.Child = nil
 	}
 
-	parents, err := parentsContainingPath(curItem.path, curItem.Commit)
+	parents, err := parentsContainingPath(curItem.path, curItem.Commit, b.followRenames)
 	if err != nil {
 		return false, err
 	}
@@ -309,7 +345,7 @@ func (b *blame) addBlames(curItems []*queueItem) (bool, error) {
 					curl++
 					if curl == curItem.NeedsMap[need].Cur {
 						// add to needs
-						getFromParent = append(getFromParent, lineMap{curl, prevl, nil, -1})
+						getFromParent = append(getFromParent, lineMap{curl, prevl, nil, "", -1})
 						// move to next need
 						need++
 						if need >= len(curItem.NeedsMap) {
@@ -365,6 +401,7 @@ func finishNeeds(curItem *queueItem) (bool, error) {
 	for i := range curItem.NeedsMap {
 		if curItem.NeedsMap[i].Commit == nil {
 			curItem.NeedsMap[i].Commit = curItem.Commit
+			curItem.NeedsMap[i].Path = curItem.path
 			curItem.NeedsMap[i].FromParentNo = -1
 		}
 	}
@@ -383,6 +420,7 @@ func finishNeeds(curItem *queueItem) (bool, error) {
 		for p < len(ctn.NeedsMap) {
 			if ctn.NeedsMap[p].Cur == curItem.NeedsMap[m].Cur {
 				ctn.NeedsMap[p].Commit = curItem.NeedsMap[m].Commit
+				ctn.NeedsMap[p].Path = curItem.NeedsMap[m].Path
 				m++
 				p++
 			} else if ctn.NeedsMap[p].Cur < curItem.NeedsMap[m].Cur {
@@ -409,6 +447,7 @@ func applyNeeds(child *queueItem, needsMap []lineMap, identicalToChild bool, par
 			}
 			if l.Commit == nil || parentNo < l.FromParentNo {
 				l.Commit = needsMap[i].Commit
+				l.Path = needsMap[i].Path
 				l.FromParentNo = parentNo
 			}
 		}
@@ -426,6 +465,7 @@ func applyNeeds(child *queueItem, needsMap []lineMap, identicalToChild bool, par
 			if l.Cur == needsMap[i].Orig {
 				if l.Commit == nil || parentNo < l.FromParentNo {
 					l.Commit = needsMap[i].Commit
+					l.Path = needsMap[i].Path
 					l.FromParentNo = parentNo
 				}
 			}
@@ -447,14 +487,14 @@ func (b BlameResult) String() string {
 	var buf bytes.Buffer
 
 	// max line number length
-	mlnl := len(strconv.Itoa(len(b.Lines)))
+	mlnl := len(strconv.Itoa(b.StartLine + len(b.Lines) - 1))
 	// max author length
 	mal := b.maxAuthorLength()
 	format := fmt.Sprintf("%%s (%%-%ds %%s %%%dd) %%s\n", mal, mlnl)
 
 	for ln := range b.Lines {
 		_, _ = fmt.Fprintf(&buf, format, b.Lines[ln].Hash.String()[:8],
-			b.Lines[ln].AuthorName, b.Lines[ln].Date.Format("2006-01-02 15:04:05 -0700"), ln+1, b.Lines[ln].Text)
+			b.Lines[ln].AuthorName, b.Lines[ln].Date.Format("2006-01-02 15:04:05 -0700"), b.StartLine+ln, b.Lines[ln].Text)
 	}
 	return buf.String()
 }
@@ -530,7 +570,7 @@ type parentCommit struct {
 	Path   string
 }
 
-func parentsContainingPath(path string, c *object.Commit) ([]parentCommit, error) {
+func parentsContainingPath(path string, c *object.Commit, followRenames bool) ([]parentCommit, error) {
 	// TODO: benchmark this method making git.object.Commit.parent public instead of using
 	// an iterator
 	var result []parentCommit
@@ -545,24 +585,45 @@ func parentsContainingPath(path string, c *object.Commit) ([]parentCommit, error
 		}
 		if _, err := parent.File(path); err == nil {
 			result = append(result, parentCommit{parent, path})
-		} else {
-			// look for renames
-			patch, err := parent.Patch(c)
+		} else if followRenames {
+			from, err := renamedFrom(parent, c, path)
 			if err != nil {
 				return nil, err
-			} else if patch != nil {
-				for _, fp := range patch.FilePatches() {
-					from, to := fp.Files()
-					if from != nil && to != nil && to.Path() == path {
-						result = append(result, parentCommit{parent, from.Path()})
-						break
-					}
-				}
+			}
+			if from != "" {
+				result = append(result, parentCommit{parent, from})
 			}
 		}
 	}
 }
 
+// renamedFrom returns the path in parent of the file renamed to path in c,
+// or an empty string if it has not been renamed.
+func renamedFrom(parent, c *object.Commit, path string) (string, error) {
+	parentTree, err := parent.Tree()
+	if err != nil {
+		return "", err
+	}
+
+	tree, err := c.Tree()
+	if err != nil {
+		return "", err
+	}
+
+	changes, err := object.DiffTreeWithOptions(context.Background(), parentTree, tree, object.DefaultDiffTreeOptions)
+	if err != nil {
+		return "", err
+	}
+
+	for _, ch := range changes {
+		if ch.Kind == object.Renamed && ch.To.Name == path {
+			return ch.From.Name, nil
+		}
+	}
+
+	return "", nil
+}
+
 func blobHash(path string, commit *object.Commit) (plumbing.Hash, error) {
 	file, err := commit.File(path)
 	if err != nil {
@@ -68,6 +68,47 @@ func (s *BlameSuite) TestBlame() {
 	}
 }
 
+func (s *BlameSuite) TestBlameWithOptions() {
+	r := s.NewRepositoryFromPackfile(fixtures.ByURL("https://github.com/spinnaker/spinnaker.git").One())
+	commit, err := r.CommitObject(plumbing.NewHash("f39d86f59a0781f130e8de6b2115329c1fbe9545"))
+	s.Require().NoError(err)
+
+	path := "dev/create_google_dev_vm.sh"
+	full, err := Blame(commit, path)
+	s.Require().NoError(err)
+
+	noFollow, err := BlameWithOptions(commit, path, &BlameOptions{})
+	s.Require().NoError(err)
+	s.Len(noFollow.Lines, len(full.Lines))
+
+	var renamed int
+	for i, l := range noFollow.Lines {
+		s.Empty(l.Path)
+		if full.Lines[i].Path != "" {
+			renamed++
+			s.NotEqual(full.Lines[i].Hash, l.Hash)
+		} else {
+			s.Equal(full.Lines[i], l)
+		}
+	}
+	s.NotZero(renamed)
+
+	ranged, err := BlameWithOptions(commit, path, &BlameOptions{FollowRenames: true, LineRange: [2]int{3, 5}})
+	s.Require().NoError(err)
+	s.Equal(3, ranged.StartLine)
+	s.Equal(full.Lines[2:5], ranged.Lines)
+	s.Contains(ranged.String(), " 3) "+full.Lines[2].Text+"\n")
+
+	toEnd, err := BlameWithOptions(commit, path, &BlameOptions{FollowRenames: true, LineRange: [2]int{len(full.Lines), 0}})
+	s.Require().NoError(err)
+	s.Equal(full.Lines[len(full.Lines)-1:], toEnd.Lines)
+
+	for _, lineRange := range [][2]int{{0, 3}, {5, 3}, {1, len(full.Lines) + 1}} {
+		_, err = BlameWithOptions(commit, path, &BlameOptions{LineRange: lineRange})
+		s.ErrorIs(err, ErrInvalidLineRange, lineRange)
+	}
+}
+
 func (s *BlameSuite) mockBlame(t blameTest, r *Repository) (blame *BlameResult) {
 	commit, err := r.CommitObject(plumbing.NewHash(t.rev))
 	s.Require().NoError(err, fmt.Sprintf("%v: repo=%s, rev=%s", err, t.repo, t.rev))
@@ -90,16 +131,25 @@ func (s *BlameSuite) mockBlame(t blameTest, r *Repository) (blame *BlameResult)
 			Date:       commit.Author.When,
 			Hash:       commit.Hash,
 		}
+		if _, err := commit.File(t.path); err != nil {
+			l.Path = blameRenamedPaths[t.path]
+		}
 		blamedLines = append(blamedLines, l)
 	}
 
 	return &BlameResult{
-		Path:  t.path,
-		Rev:   plumbing.NewHash(t.rev),
-		Lines: blamedLines,
+		Path:      t.path,
+		Rev:       plumbing.NewHash(t.rev),
+		StartLine: 1,
+		Lines:     blamedLines,
 	}
 }
 
+// the paths the files of the blame tests have been renamed from
+var blameRenamedPaths = map[string]string{
+	"dev/create_google_dev_vm.sh": "dev/create_dev_vm.sh",
+}
+
 // utility function to avoid writing so many repeated commits
 func repeat(s string, n int) []string {
 	if n < 0 {
@@ -0,0 +1,276 @@
+package git
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+
+	"github.com/go-git/go-git/v6/config"
+	"github.com/go-git/go-git/v6/plumbing"
+	"github.com/go-git/go-git/v6/plumbing/object"
+	"github.com/go-git/go-git/v6/storage"
+)
+
+var (
+	// ErrBranchCheckedOut is returned when deleting or resetting the current
+	// branch, or adding a linked worktree for a branch checked out in another
+	// worktree.
+	ErrBranchCheckedOut = errors.New("branch is checked out")
+	// ErrInvalidUpstream is returned when the upstream of a branch is
+	// neither a local branch nor a remote-tracking branch of a remote.
+	ErrInvalidUpstream = errors.New("invalid upstream")
+)
+
+// CreateBranchOptions describes how a branch is created by CreateBranchAt.
+type CreateBranchOptions struct {
+	// Upstream is the branch tracked by the created branch, recorded in its
+	// config: a remote-tracking branch, such as refs/remotes/origin/main,
+	// or a local branch. If the hash of the branch is not given, the branch
+	// starts at its upstream.
+	Upstream plumbing.ReferenceName
+	// Force resets the branch if it already exists, as `git branch --force`
+	// does. The current branch can't be reset.
+	Force bool
+}
+
+// CreateBranchAt creates the branch with the given short name, such as
+// "feature", starting at the commit of the given hash, or at the tagged
+// commit if it is the hash of a tag. The branch starts at HEAD, or at the
+// upstream of opts if any, if the hash is zero. The creation is logged in
+// the reflog of the branch, and its upstream is recorded in its config, as
+// `git branch --track <name> <start>` does.
+//
+// Unlike CreateBranch, which only writes the config of a branch, the branch
+// reference is created. ErrBranchExists is returned if the branch already
+// exists, unless opts.Force is set.
+func (r *Repository) CreateBranchAt(name string, hash plumbing.Hash, opts *CreateBranchOptions) (*plumbing.Reference, error) {
+	if opts == nil {
+		opts = &CreateBranchOptions{}
+	}
+
+	rname := plumbing.NewBranchReferenceName(name)
+	if err := rname.Validate(); err != nil {
+		return nil, err
+	}
+
+	_, err := r.Storer.Reference(rname)
+	exists := err == nil
+	switch {
+	case exists:
+		if !opts.Force {
+			return nil, ErrBranchExists
+		}
+
+		current, err := r.isCurrentBranch(rname)
+		if err != nil {
+			return nil, err
+		}
+
+		if current {
+			return nil, ErrBranchCheckedOut
+		}
+	case !errors.Is(err, plumbing.ErrReferenceNotFound):
+		return nil, err
+	}
+
+	cfg, err := r.Config()
+	if err != nil {
+		return nil, err
+	}
+
+	var upstream *config.Branch
+	if opts.Upstream != "" {
+		if upstream, err = branchUpstream(cfg, name, opts.Upstream); err != nil {
+			return nil, err
+		}
+	}
+
+	start := hash.String()
+	switch {
+	case !hash.IsZero():
+	case opts.Upstream != "":
+		ref, err := r.Reference(opts.Upstream, true)
+		if err != nil {
+			return nil, err
+		}
+
+		hash, start = ref.Hash(), opts.Upstream.String()
+	default:
+		ref, err := r.Head()
+		if err != nil {
+			return nil, err
+		}
+
+		hash, start = ref.Hash(), plumbing.HEAD.String()
+	}
+
+	obj, err := r.Object(plumbing.AnyObject, hash)
+	if err != nil {
+		return nil, err
+	}
+
+	commit, err := object.PeelToCommit(obj)
+	if err != nil {
+		return nil, err
+	}
+
+	if exists {
+		err = r.setReferenceWithLog(plumbing.NewHashReference(rname, commit.Hash), nil, "branch: Reset to "+start)
+	} else {
+		err = r.createBranchReference(rname, commit.Hash, start)
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	if upstream != nil {
+		cfg.Branches[name] = upstream
+		if err := r.Storer.SetConfig(cfg); err != nil {
+			return nil, err
+		}
+	}
+
+	return plumbing.NewHashReference(rname, commit.Hash), nil
+}
+
+// RenameBranch renames the branch with the given short name, along with its
+// reflog and config, as `git branch --move` does. HEAD is updated if the
+// branch is the current one. ErrBranchNotFound is returned if the branch
+// doesn't exist, and ErrBranchExists if the new name is already used.
+func (r *Repository) RenameBranch(oldName, newName string) error {
+	from := plumbing.NewBranchReferenceName(oldName)
+	to := plumbing.NewBranchReferenceName(newName)
+	if err := to.Validate(); err != nil {
+		return err
+	}
+
+	ref, err := r.Storer.Reference(from)
+	if errors.Is(err, plumbing.ErrReferenceNotFound) {
+		return ErrBranchNotFound
+	}
+	if err != nil {
+		return err
+	}
+
+	if _, err := r.Storer.Reference(to); err == nil {
+		return ErrBranchExists
+	} else if !errors.Is(err, plumbing.ErrReferenceNotFound) {
+		return err
+	}
+
+	current, err := r.isCurrentBranch(from)
+	if err != nil {
+		return err
+	}
+
+	if err := r.Storer.SetReference(plumbing.NewHashReference(to, ref.Hash())); err != nil {
+		return err
+	}
+
+	if s, ok := r.Storer.(storage.ReflogStorer); ok {
+		entries, err := s.Reflog(from)
+		if err != nil {
+			return err
+		}
+
+		if len(entries) > 0 {
+			if err := s.SetReflog(to, entries); err != nil {
+				return err
+			}
+		}
+	}
+
+	if current {
+		if err := r.Storer.SetReference(plumbing.NewSymbolicReference(plumbing.HEAD, to)); err != nil {
+			return err
+		}
+	}
+
+	if err := r.Storer.RemoveReference(from); err != nil {
+		return err
+	}
+
+	msg := fmt.Sprintf("Branch: renamed %s to %s", from, to)
+	if err := r.logRefUpdateWithHead(to, ref.Hash(), ref.Hash(), nil, msg); err != nil {
+		return err
+	}
+
+	cfg, err := r.Config()
+	if err != nil {
+		return err
+	}
+
+	b, ok := cfg.Branches[oldName]
+	if !ok {
+		return nil
+	}
+
+	delete(cfg.Branches, oldName)
+	b.Name = newName
+	cfg.Branches[newName] = b
+	return r.Storer.SetConfig(cfg)
+}
+
+// createBranchReference creates the given branch at commit, logging start
+// as its start point in its reflog.
+func (r *Repository) createBranchReference(name plumbing.ReferenceName, commit plumbing.Hash, start string) error {
+	return r.setReferenceWithLog(
+		plumbing.NewHashReference(name, commit),
+		nil, "branch: Created from "+start,
+	)
+}
+
+// isCurrentBranch returns whether HEAD points to the given branch.
+func (r *Repository) isCurrentBranch(name plumbing.ReferenceName) (bool, error) {
+	head, err := r.Storer.Reference(plumbing.HEAD)
+	if errors.Is(err, plumbing.ErrReferenceNotFound) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+
+	return head.Type() == plumbing.SymbolicReference && head.Target() == name, nil
+}
+
+// branchUpstream returns the config of the branch with the given name
+// tracking the given upstream: a local branch, or a remote-tracking branch
+// fetched by one of the remotes of cfg.
+func branchUpstream(cfg *config.Config, name string, upstream plumbing.ReferenceName) (*config.Branch, error) {
+	b := &config.Branch{Name: name}
+	if existing, ok := cfg.Branches[name]; ok {
+		b = existing
+	}
+
+	if upstream.IsBranch() {
+		b.Remote, b.Merge = ".", upstream
+		return b, nil
+	}
+
+	remotes := make([]string, 0, len(cfg.Remotes))
+	for remote := range cfg.Remotes {
+		remotes = append(remotes, remote)
+	}
+
+	sort.Strings(remotes)
+	for _, remoteName := range remotes {
+		remote := cfg.Remotes[remoteName]
+		for _, spec := range remote.Fetch {
+			reversed := spec.Reverse()
+			if !reversed.Match(upstream) {
+				continue
+			}
+
+			merge := reversed.Dst(upstream)
+			if !merge.IsBranch() {
+				continue
+			}
+
+			b.Remote, b.Merge = remote.Name, merge
+			return b, nil
+		}
+	}
+
+	return nil, fmt.Errorf("%w: %s", ErrInvalidUpstream, upstream)
+}
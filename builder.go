@@ -0,0 +1,309 @@
+package git
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/go-git/go-git/v6/plumbing"
+	"github.com/go-git/go-git/v6/plumbing/filemode"
+	"github.com/go-git/go-git/v6/plumbing/object"
+	"github.com/go-git/go-git/v6/plumbing/storer"
+)
+
+var (
+	// ErrMalformedMode is returned by TreeBuilder.Insert when the mode of
+	// the entry is not one of a git tree, see filemode.FileMode.IsMalformed.
+	ErrMalformedMode = errors.New("malformed file mode")
+	// ErrMissingTree is returned by CommitBuilder.Write when the tree of the
+	// commit is not set.
+	ErrMissingTree = errors.New("tree field is required")
+)
+
+// TreeBuilder builds trees from their entries, inserted and removed by
+// path, without a worktree nor an index. The trees are written to the
+// storer by Write, the intermediate trees of the paths being created as
+// needed.
+type TreeBuilder struct {
+	s    storer.EncodedObjectStorer
+	root *treeBuilderNode
+}
+
+// treeBuilderNode is a tree of a TreeBuilder, whose entries are read from
+// its tree object once they are needed.
+type treeBuilderNode struct {
+	hash    plumbing.Hash
+	entries map[string]*treeBuilderEntry
+	// changed is set once the entries differ from the ones of hash.
+	changed bool
+}
+
+type treeBuilderEntry struct {
+	mode filemode.FileMode
+	hash plumbing.Hash
+	// tree is the node of the entries of a tree, nil until they are needed.
+	tree *treeBuilderNode
+}
+
+// NewTreeBuilder returns a TreeBuilder writing the trees to s, starting
+// from the entries of base, or from an empty tree if base is nil. The
+// subtrees of base are read from s.
+func NewTreeBuilder(s storer.EncodedObjectStorer, base *object.Tree) *TreeBuilder {
+	root := &treeBuilderNode{
+		entries: make(map[string]*treeBuilderEntry),
+		changed: true,
+	}
+
+	if base != nil {
+		root.hash = base.Hash
+		root.changed = false
+		for _, e := range base.Entries {
+			root.entries[e.Name] = &treeBuilderEntry{mode: e.Mode, hash: e.Hash}
+		}
+	}
+
+	return &TreeBuilder{s: s, root: root}
+}
+
+// Insert sets the entry of the given path, slash separated, to the object
+// h with the given mode, replacing the one already there, if any. The
+// entries of the intermediate directories which are files are replaced by
+// trees. With filemode.Dir, h is the hash of a tree, inserted as a whole.
+func (b *TreeBuilder) Insert(path string, mode filemode.FileMode, h plumbing.Hash) error {
+	if mode.IsMalformed() {
+		return fmt.Errorf("%w: %s for %q", ErrMalformedMode, mode, path)
+	}
+
+	parts, err := splitTreePath(path)
+	if err != nil {
+		return err
+	}
+
+	nodes, err := b.walk(parts[:len(parts)-1], true)
+	if err != nil {
+		return err
+	}
+
+	for _, n := range nodes {
+		n.changed = true
+	}
+
+	nodes[len(nodes)-1].entries[parts[len(parts)-1]] = &treeBuilderEntry{mode: mode, hash: h}
+	return nil
+}
+
+// Remove removes the entry of the given path, a file or a whole tree, the
+// trees left empty with it being removed too. object.ErrEntryNotFound is
+// returned if there is no such entry.
+func (b *TreeBuilder) Remove(path string) error {
+	parts, err := splitTreePath(path)
+	if err != nil {
+		return err
+	}
+
+	nodes, err := b.walk(parts[:len(parts)-1], false)
+	if err != nil {
+		return err
+	}
+
+	name := parts[len(parts)-1]
+	if nodes == nil || nodes[len(nodes)-1].entries[name] == nil {
+		return fmt.Errorf("%w: %s", object.ErrEntryNotFound, path)
+	}
+
+	for i := len(nodes) - 1; i >= 0; i-- {
+		n := nodes[i]
+		delete(n.entries, name)
+		n.changed = true
+		if i == 0 || len(n.entries) > 0 {
+			for _, n := range nodes[:i] {
+				n.changed = true
+			}
+
+			break
+		}
+
+		name = parts[i-1]
+	}
+
+	return nil
+}
+
+// Write writes the trees changed since the last call, or since the
+// TreeBuilder was created, to the storer and returns the hash of the root
+// tree. The entries are sorted as git does, the trees as if their name
+// ended with a slash, for the trees to be the ones of git.
+func (b *TreeBuilder) Write() (plumbing.Hash, error) {
+	return b.write(b.root)
+}
+
+func (b *TreeBuilder) write(n *treeBuilderNode) (plumbing.Hash, error) {
+	if !n.changed {
+		return n.hash, nil
+	}
+
+	t := &object.Tree{Entries: make([]object.TreeEntry, 0, len(n.entries))}
+	for name, e := range n.entries {
+		if e.tree != nil {
+			h, err := b.write(e.tree)
+			if err != nil {
+				return plumbing.ZeroHash, err
+			}
+
+			e.hash = h
+		}
+
+		t.Entries = append(t.Entries, object.TreeEntry{Name: name, Mode: e.mode, Hash: e.hash})
+	}
+
+	sort.Sort(object.TreeEntrySorter(t.Entries))
+	o := b.s.NewEncodedObject()
+	if err := t.Encode(o); err != nil {
+		return plumbing.ZeroHash, err
+	}
+
+	h := o.Hash()
+	if b.s.HasEncodedObject(h) != nil {
+		if _, err := b.s.SetEncodedObject(o); err != nil {
+			return plumbing.ZeroHash, err
+		}
+	}
+
+	n.hash = h
+	n.changed = false
+	return h, nil
+}
+
+// walk returns the nodes of the root tree and of the trees of the given
+// path. If create is set, the missing trees are created, replacing the
+// files of the path, otherwise nil is returned if a tree is missing.
+func (b *TreeBuilder) walk(parts []string, create bool) ([]*treeBuilderNode, error) {
+	nodes := []*treeBuilderNode{b.root}
+	for _, name := range parts {
+		n := nodes[len(nodes)-1]
+		e := n.entries[name]
+		if e == nil || e.mode != filemode.Dir {
+			if !create {
+				return nil, nil
+			}
+
+			e = &treeBuilderEntry{
+				mode: filemode.Dir,
+				tree: &treeBuilderNode{entries: make(map[string]*treeBuilderEntry), changed: true},
+			}
+			n.entries[name] = e
+		}
+
+		if e.tree == nil {
+			t, err := object.GetTree(b.s, e.hash)
+			if err != nil {
+				return nil, err
+			}
+
+			e.tree = &treeBuilderNode{hash: t.Hash, entries: make(map[string]*treeBuilderEntry, len(t.Entries))}
+			for _, te := range t.Entries {
+				e.tree.entries[te.Name] = &treeBuilderEntry{mode: te.Mode, hash: te.Hash}
+			}
+		}
+
+		nodes = append(nodes, e.tree)
+	}
+
+	return nodes, nil
+}
+
+// splitTreePath returns the names of the path of an entry of a tree,
+// refusing the paths refused in the worktree.
+func splitTreePath(path string) ([]string, error) {
+	if err := validPath(path); err != nil {
+		return nil, err
+	}
+
+	parts := strings.Split(path, "/")
+	for _, part := range parts {
+		if part == "" || part == "." {
+			return nil, &InvalidPathError{Path: path, Err: ErrMalformedPath}
+		}
+	}
+
+	return parts, nil
+}
+
+// CommitBuilder builds a commit from a tree, as `git commit-tree` does,
+// without a worktree nor an index. The commit is written to the storer by
+// Write, no reference being updated.
+type CommitBuilder struct {
+	// Tree is the hash of the tree of the commit, such as the one written
+	// by a TreeBuilder. It is required.
+	Tree plumbing.Hash
+	// Parents are the hashes of the parents of the commit, none for a root
+	// commit.
+	Parents []plumbing.Hash
+	// Author is the author of the commit. It is required.
+	Author *object.Signature
+	// Committer is the committer of the commit, the author if nil.
+	Committer *object.Signature
+	// Message is the message of the commit.
+	Message string
+	// Signer signs the commit if set.
+	Signer Signer
+
+	s storer.EncodedObjectStorer
+}
+
+// NewCommitBuilder returns a CommitBuilder writing the commit to s.
+func NewCommitBuilder(s storer.EncodedObjectStorer) *CommitBuilder {
+	return &CommitBuilder{s: s}
+}
+
+// Write writes the commit to the storer and returns its hash. Its tree and
+// its parents must be in the storer.
+func (b *CommitBuilder) Write() (plumbing.Hash, error) {
+	if b.Tree.IsZero() {
+		return plumbing.ZeroHash, ErrMissingTree
+	}
+
+	if b.Author == nil {
+		return plumbing.ZeroHash, ErrMissingAuthor
+	}
+
+	if _, err := object.GetTree(b.s, b.Tree); err != nil {
+		return plumbing.ZeroHash, fmt.Errorf("tree %s: %w", b.Tree, err)
+	}
+
+	for _, p := range b.Parents {
+		if _, err := b.s.EncodedObject(plumbing.CommitObject, p); err != nil {
+			return plumbing.ZeroHash, fmt.Errorf("parent %s: %w", p, err)
+		}
+	}
+
+	committer := b.Author
+	if b.Committer != nil {
+		committer = b.Committer
+	}
+
+	commit := &object.Commit{
+		Author:       sanitizeSignature(*b.Author),
+		Committer:    sanitizeSignature(*committer),
+		Message:      b.Message,
+		TreeHash:     b.Tree,
+		ParentHashes: b.Parents,
+	}
+
+	if b.Signer != nil {
+		sig, err := signObject(b.Signer, commit)
+		if err != nil {
+			return plumbing.ZeroHash, err
+		}
+
+		commit.PGPSignature = string(sig)
+	}
+
+	o := b.s.NewEncodedObject()
+	if err := commit.Encode(o); err != nil {
+		return plumbing.ZeroHash, err
+	}
+
+	return b.s.SetEncodedObject(o)
+}
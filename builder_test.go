@@ -0,0 +1,281 @@
+package git
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	fixtures "github.com/go-git/go-git-fixtures/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/go-git/go-git/v6/plumbing"
+	"github.com/go-git/go-git/v6/plumbing/filemode"
+	"github.com/go-git/go-git/v6/plumbing/object"
+	"github.com/go-git/go-git/v6/plumbing/storer"
+	"github.com/go-git/go-git/v6/storage/filesystem"
+	"github.com/go-git/go-git/v6/storage/memory"
+)
+
+func storeBlob(t *testing.T, s storer.EncodedObjectStorer, content string) plumbing.Hash {
+	t.Helper()
+
+	o := s.NewEncodedObject()
+	o.SetType(plumbing.BlobObject)
+	w, err := o.Writer()
+	require.NoError(t, err)
+	_, err = w.Write([]byte(content))
+	require.NoError(t, err)
+	require.NoError(t, w.Close())
+
+	h, err := s.SetEncodedObject(o)
+	require.NoError(t, err)
+	return h
+}
+
+func TestTreeBuilder(t *testing.T) {
+	t.Parallel()
+
+	s := memory.NewStorage()
+	blob := storeBlob(t, s, "foo\n")
+	b := NewTreeBuilder(s, nil)
+	for _, path := range []string{"foo.txt", "foo/bar/baz", "foo-bar", "foo/qux", "a b/c"} {
+		require.NoError(t, b.Insert(path, filemode.Regular, blob))
+	}
+
+	require.NoError(t, b.Insert("foo/exe", filemode.Executable, blob))
+	h, err := b.Write()
+	require.NoError(t, err)
+
+	root, err := object.GetTree(s, h)
+	require.NoError(t, err)
+
+	// The tree foo sorts as "foo/", after foo-bar and foo.txt.
+	var names []string
+	for _, e := range root.Entries {
+		names = append(names, e.Name)
+	}
+	assert.Equal(t, []string{"a b", "foo-bar", "foo.txt", "foo"}, names)
+
+	var files []string
+	require.NoError(t, root.Files().ForEach(func(f *object.File) error {
+		files = append(files, fmt.Sprintf("%s %s", f.Mode, f.Name))
+		return nil
+	}))
+	assert.ElementsMatch(t, []string{
+		"0100644 a b/c",
+		"0100644 foo-bar",
+		"0100644 foo.txt",
+		"0100644 foo/bar/baz",
+		"0100755 foo/exe",
+		"0100644 foo/qux",
+	}, files)
+
+	// The trees left empty are removed, and the files replaced by trees.
+	require.NoError(t, b.Remove("foo/bar/baz"))
+	require.NoError(t, b.Insert("foo.txt/new", filemode.Regular, blob))
+	h, err = b.Write()
+	require.NoError(t, err)
+
+	root, err = object.GetTree(s, h)
+	require.NoError(t, err)
+	_, err = root.FindEntry("foo/bar")
+	assert.ErrorIs(t, err, object.ErrEntryNotFound)
+	e, err := root.FindEntry("foo.txt")
+	require.NoError(t, err)
+	assert.Equal(t, filemode.Dir, e.Mode)
+	_, err = root.File("foo.txt/new")
+	assert.NoError(t, err)
+
+	// Writing again without changes gives the same tree.
+	again, err := b.Write()
+	require.NoError(t, err)
+	assert.Equal(t, h, again)
+}
+
+func TestTreeBuilderBase(t *testing.T) {
+	t.Parallel()
+
+	s := filesystem.NewStorage(fixtures.Basic().One().DotGit(), nil)
+	commit, err := object.GetCommit(s, plumbing.NewHash("6ecf0ef2c2dffb796033e5a02219af86ec6584e5"))
+	require.NoError(t, err)
+	base, err := commit.Tree()
+	require.NoError(t, err)
+
+	// Without changes, the tree is the base.
+	b := NewTreeBuilder(s, base)
+	h, err := b.Write()
+	require.NoError(t, err)
+	assert.Equal(t, base.Hash, h)
+
+	blob := storeBlob(t, s, "package main\n")
+	require.NoError(t, b.Remove("go/example.go"))
+	require.NoError(t, b.Insert("vendor/new.go", filemode.Regular, blob))
+	h, err = b.Write()
+	require.NoError(t, err)
+
+	tree, err := object.GetTree(s, h)
+	require.NoError(t, err)
+	_, err = tree.FindEntry("go")
+	assert.ErrorIs(t, err, object.ErrEntryNotFound)
+	e, err := tree.FindEntry("vendor/new.go")
+	require.NoError(t, err)
+	assert.Equal(t, blob, e.Hash)
+	e, err = tree.FindEntry("vendor/foo.go")
+	require.NoError(t, err)
+	assert.Equal(t, plumbing.NewHash("9dea2395f5403188298c1dabe8bdafe562c491e3"), e.Hash)
+
+	// A whole tree is inserted with filemode.Dir.
+	vendor, err := tree.FindEntry("vendor")
+	require.NoError(t, err)
+	require.NoError(t, b.Insert("copy/vendor", filemode.Dir, vendor.Hash))
+	h, err = b.Write()
+	require.NoError(t, err)
+	tree, err = object.GetTree(s, h)
+	require.NoError(t, err)
+	e, err = tree.FindEntry("copy/vendor")
+	require.NoError(t, err)
+	assert.Equal(t, vendor.Hash, e.Hash)
+}
+
+func TestTreeBuilderErrors(t *testing.T) {
+	t.Parallel()
+
+	s := memory.NewStorage()
+	blob := storeBlob(t, s, "foo\n")
+	b := NewTreeBuilder(s, nil)
+	require.NoError(t, b.Insert("foo", filemode.Regular, blob))
+
+	assert.ErrorIs(t, b.Remove("bar"), object.ErrEntryNotFound)
+	assert.ErrorIs(t, b.Remove("foo/bar"), object.ErrEntryNotFound)
+	assert.ErrorIs(t, b.Insert("foo", filemode.Empty, blob), ErrMalformedMode)
+	for path, expected := range map[string]error{
+		"":            ErrMalformedPath,
+		"foo//bar":    ErrMalformedPath,
+		"./foo":       ErrMalformedPath,
+		"foo/../bar":  ErrPathTraversal,
+		"/foo":        ErrPathTraversal,
+		".git/config": ErrPathInGitDir,
+		"foo/.git":    ErrPathInGitDir,
+	} {
+		assert.ErrorIs(t, b.Insert(path, filemode.Regular, blob), expected, path)
+	}
+}
+
+func TestTreeBuilderGit(t *testing.T) {
+	t.Parallel()
+
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not found")
+	}
+
+	dir := t.TempDir()
+	r, err := PlainInit(dir, true)
+	require.NoError(t, err)
+
+	// The trees sort as if their name ended with a slash: a-b, a.b, a, a0.
+	blob := storeBlob(t, r.Storer, "foo\n")
+	b := NewTreeBuilder(r.Storer, nil)
+	var info strings.Builder
+	for _, path := range []string{"a0", "a/c/d", "a.b", "a/b", "a-b", "b", "b.c/d", "b-c", "c/d"} {
+		require.NoError(t, b.Insert(path, filemode.Regular, blob))
+		fmt.Fprintf(&info, "100644 %s\t%s\n", blob, path)
+	}
+
+	h, err := b.Write()
+	require.NoError(t, err)
+
+	index := filepath.Join(t.TempDir(), "index")
+	git := func(stdin string, args ...string) string {
+		cmd := exec.Command("git", args...)
+		cmd.Dir = dir
+		cmd.Env = append(os.Environ(), "GIT_INDEX_FILE="+index)
+		cmd.Stdin = strings.NewReader(stdin)
+		out, err := cmd.CombinedOutput()
+		require.NoError(t, err, string(out))
+		return strings.TrimSpace(string(out))
+	}
+
+	git(info.String(), "update-index", "--add", "--index-info")
+	assert.Equal(t, git("", "write-tree"), h.String())
+	git("", "fsck", "--strict")
+}
+
+func TestCommitBuilder(t *testing.T) {
+	t.Parallel()
+
+	s := memory.NewStorage()
+	b := NewTreeBuilder(s, nil)
+	require.NoError(t, b.Insert("foo", filemode.Regular, storeBlob(t, s, "foo\n")))
+	tree, err := b.Write()
+	require.NoError(t, err)
+
+	author := &object.Signature{Name: "John <Doe>", Email: "john@example.com", When: time.Unix(1234567890, 0).UTC()}
+	cb := NewCommitBuilder(s)
+	cb.Tree = tree
+	cb.Author = author
+	cb.Message = "root\n"
+	root, err := cb.Write()
+	require.NoError(t, err)
+
+	c, err := object.GetCommit(s, root)
+	require.NoError(t, err)
+	assert.Equal(t, tree, c.TreeHash)
+	assert.Empty(t, c.ParentHashes)
+	assert.Equal(t, "John Doe", c.Author.Name)
+	assert.Equal(t, c.Author, c.Committer)
+	assert.Equal(t, "root\n", c.Message)
+	assert.Empty(t, c.PGPSignature)
+
+	committer := &object.Signature{Name: "Jane Doe", Email: "jane@example.com", When: time.Unix(1234567900, 0).UTC()}
+	cb = NewCommitBuilder(s)
+	cb.Tree = tree
+	cb.Parents = []plumbing.Hash{root}
+	cb.Author = author
+	cb.Committer = committer
+	cb.Message = "signed\n"
+	cb.Signer = b64signer{}
+	h, err := cb.Write()
+	require.NoError(t, err)
+
+	c, err = object.GetCommit(s, h)
+	require.NoError(t, err)
+	assert.Equal(t, []plumbing.Hash{root}, c.ParentHashes)
+	assert.Equal(t, "Jane Doe", c.Committer.Name)
+	assert.True(t, committer.When.Equal(c.Committer.When))
+	assert.NotEmpty(t, c.PGPSignature)
+}
+
+func TestCommitBuilderErrors(t *testing.T) {
+	t.Parallel()
+
+	s := memory.NewStorage()
+	author := &object.Signature{Name: "John Doe", Email: "john@example.com"}
+	tree, err := NewTreeBuilder(s, nil).Write()
+	require.NoError(t, err)
+
+	cb := NewCommitBuilder(s)
+	cb.Author = author
+	_, err = cb.Write()
+	assert.ErrorIs(t, err, ErrMissingTree)
+
+	cb = NewCommitBuilder(s)
+	cb.Tree = tree
+	_, err = cb.Write()
+	assert.ErrorIs(t, err, ErrMissingAuthor)
+
+	cb.Author = author
+	cb.Parents = []plumbing.Hash{plumbing.NewHash("6ecf0ef2c2dffb796033e5a02219af86ec6584e5")}
+	_, err = cb.Write()
+	assert.ErrorIs(t, err, plumbing.ErrObjectNotFound)
+
+	cb = NewCommitBuilder(s)
+	cb.Tree = plumbing.NewHash("a8d315b2b1c615d43042c3a62402b8a54288cf5c")
+	cb.Author = author
+	_, err = cb.Write()
+	assert.ErrorIs(t, err, plumbing.ErrObjectNotFound)
+}
@@ -0,0 +1,190 @@
+package git
+
+import (
+	"errors"
+	"io"
+	"sort"
+	"strings"
+
+	"github.com/go-git/go-git/v6/config"
+	"github.com/go-git/go-git/v6/plumbing"
+	"github.com/go-git/go-git/v6/plumbing/format/bundle"
+	"github.com/go-git/go-git/v6/plumbing/format/packfile"
+	"github.com/go-git/go-git/v6/plumbing/object"
+	"github.com/go-git/go-git/v6/plumbing/revlist"
+	"github.com/go-git/go-git/v6/plumbing/storer"
+	"github.com/go-git/go-git/v6/storage"
+)
+
+// ErrEmptyBundle is returned by CreateBundle when no reference matches the
+// given refspecs.
+var ErrEmptyBundle = errors.New("refusing to create an empty bundle")
+
+// CreateBundle writes to w a bundle with the references matching the given
+// refspecs, and the objects needed to complete their histories, as
+// `git bundle create` does. The destination of the refspecs is the name of
+// the references in the bundle, e.g. "refs/heads/*:refs/heads/*" bundles
+// all the branches. Symbolic references, like HEAD, are resolved.
+//
+// The bundle can be cloned or fetched from with the file transport, or with
+// the bundle transport for other sources.
+func (r *Repository) CreateBundle(w io.Writer, refs []config.RefSpec, opts *CreateBundleOptions) error {
+	if opts == nil {
+		opts = &CreateBundleOptions{}
+	}
+
+	for _, spec := range refs {
+		if err := spec.Validate(); err != nil {
+			return err
+		}
+	}
+
+	cfg, err := r.Config()
+	if err != nil {
+		return err
+	}
+
+	h := &bundle.Header{
+		Version:      opts.Version,
+		ObjectFormat: cfg.Extensions.ObjectFormat,
+	}
+
+	h.References, err = r.bundleReferences(refs)
+	if err != nil {
+		return err
+	}
+
+	if len(h.References) == 0 {
+		return ErrEmptyBundle
+	}
+
+	tips := make([]plumbing.Hash, 0, len(h.References))
+	for _, ref := range h.References {
+		tips = append(tips, ref.Hash())
+	}
+
+	// As git, the objects are bundled as they are stored, whatever the
+	// replace references.
+	st := storage.NoReplaceObjects(r.Storer)
+	objs, err := revlist.Objects(st, tips, opts.Exclude)
+	if err != nil {
+		return err
+	}
+
+	h.Prerequisites, err = bundlePrerequisites(st, objs)
+	if err != nil {
+		return err
+	}
+
+	if err := bundle.NewEncoder(w).Encode(h); err != nil {
+		return err
+	}
+
+	_, err = packfile.NewEncoder(w, st, false, packfile.WithMaxDeltaDepth(cfg.Pack.Depth)).Encode(objs, cfg.Pack.Window)
+	return err
+}
+
+// bundleReferences returns the references matching the given refspecs,
+// renamed to their destination and resolved to hash references.
+func (r *Repository) bundleReferences(specs []config.RefSpec) ([]*plumbing.Reference, error) {
+	iter, err := r.Storer.IterReferences()
+	if err != nil {
+		return nil, err
+	}
+
+	found := map[plumbing.ReferenceName]plumbing.Hash{}
+	err = iter.ForEach(func(ref *plumbing.Reference) error {
+		for _, spec := range specs {
+			if !spec.Match(ref.Name()) {
+				continue
+			}
+
+			resolved, err := storer.ResolveReference(r.Storer, ref.Name())
+			if err != nil {
+				return err
+			}
+
+			found[spec.Dst(ref.Name())] = resolved.Hash()
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	refs := make([]*plumbing.Reference, 0, len(found))
+	for name, hash := range found {
+		refs = append(refs, plumbing.NewHashReference(name, hash))
+	}
+
+	sort.Slice(refs, func(i, j int) bool {
+		return refs[i].Name() < refs[j].Name()
+	})
+
+	return refs, nil
+}
+
+// bundlePrerequisites returns the parents of the commits of objs that are
+// not part of it.
+func bundlePrerequisites(st storage.Storer, objs []plumbing.Hash) ([]bundle.Prerequisite, error) {
+	included := make(map[plumbing.Hash]bool, len(objs))
+	for _, h := range objs {
+		included[h] = true
+	}
+
+	var prerequisites []bundle.Prerequisite
+	seen := map[plumbing.Hash]bool{}
+	for _, h := range objs {
+		obj, err := st.EncodedObject(plumbing.AnyObject, h)
+		if err != nil {
+			return nil, err
+		}
+
+		if obj.Type() != plumbing.CommitObject {
+			continue
+		}
+
+		c, err := object.DecodeCommit(st, obj)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, parent := range c.ParentHashes {
+			if included[parent] || seen[parent] {
+				continue
+			}
+
+			seen[parent] = true
+			p := bundle.Prerequisite{Hash: parent}
+			if pc, err := object.GetCommit(st, parent); err == nil {
+				p.Comment, _, _ = strings.Cut(pc.Message, "\n")
+			}
+
+			prerequisites = append(prerequisites, p)
+		}
+	}
+
+	sort.Slice(prerequisites, func(i, j int) bool {
+		return prerequisites[i].Hash.Compare(prerequisites[j].Hash.Bytes()) < 0
+	})
+
+	return prerequisites, nil
+}
+
+// VerifyBundle reads the header of the bundle read from rd, and checks
+// that the repository has its prerequisites, as `git bundle verify` does.
+// It returns the header, or bundle.ErrMissingPrerequisites if any of the
+// prerequisites is missing.
+func (r *Repository) VerifyBundle(rd io.Reader) (*bundle.Header, error) {
+	var h bundle.Header
+	if err := bundle.NewDecoder(rd).Decode(&h); err != nil {
+		return nil, err
+	}
+
+	if err := h.Verify(r.Storer); err != nil {
+		return nil, err
+	}
+
+	return &h, nil
+}
@@ -0,0 +1,151 @@
+package git
+
+import (
+	"bytes"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/go-git/go-git/v6/config"
+	"github.com/go-git/go-git/v6/plumbing"
+	"github.com/go-git/go-git/v6/plumbing/format/bundle"
+	"github.com/go-git/go-git/v6/plumbing/object"
+	"github.com/go-git/go-git/v6/storage/memory"
+)
+
+func writeBundle(t *testing.T, r *Repository, refs []config.RefSpec, opts *CreateBundleOptions) string {
+	t.Helper()
+
+	var buf bytes.Buffer
+	require.NoError(t, r.CreateBundle(&buf, refs, opts))
+
+	path := filepath.Join(t.TempDir(), "repo.bundle")
+	require.NoError(t, os.WriteFile(path, buf.Bytes(), 0o644))
+	return path
+}
+
+func TestCreateBundle(t *testing.T) {
+	t.Parallel()
+
+	r, _ := newRebaseRepository(t, memory.NewStorage(), "b")
+	path := writeBundle(t, r, []config.RefSpec{"refs/heads/*:refs/heads/*", "HEAD:HEAD"}, nil)
+
+	clone, err := PlainClone(t.TempDir(), &CloneOptions{URL: path})
+	require.NoError(t, err)
+
+	head, err := clone.Storer.Reference(plumbing.HEAD)
+	require.NoError(t, err)
+	assert.Equal(t, plumbing.ReferenceName("refs/heads/feature"), head.Target())
+
+	for _, name := range []plumbing.ReferenceName{"refs/heads/feature", plumbing.Master} {
+		expected, err := r.Reference(name, false)
+		require.NoError(t, err)
+
+		ref, err := clone.Reference(plumbing.NewRemoteReferenceName(DefaultRemoteName, name.Short()), false)
+		require.NoError(t, err)
+		assert.Equal(t, expected.Hash(), ref.Hash(), name)
+	}
+
+	w, err := clone.Worktree()
+	require.NoError(t, err)
+	status, err := w.Status()
+	require.NoError(t, err)
+	assert.True(t, status.IsClean())
+}
+
+func TestCreateBundleExclude(t *testing.T) {
+	t.Parallel()
+
+	r, _ := newRebaseRepository(t, memory.NewStorage(), "b")
+	master, err := r.Reference(plumbing.Master, false)
+	require.NoError(t, err)
+	c, err := r.CommitObject(master.Hash())
+	require.NoError(t, err)
+	base := c.ParentHashes[0]
+
+	full := writeBundle(t, r, []config.RefSpec{"refs/heads/master:refs/heads/master"}, nil)
+	incremental := writeBundle(t, r, []config.RefSpec{"refs/heads/feature:refs/heads/feature"},
+		&CreateBundleOptions{Exclude: []plumbing.Hash{master.Hash()}})
+
+	f, err := os.Open(incremental)
+	require.NoError(t, err)
+	defer f.Close()
+
+	empty, err := Init(memory.NewStorage())
+	require.NoError(t, err)
+	_, err = empty.VerifyBundle(f)
+	assert.ErrorIs(t, err, bundle.ErrMissingPrerequisites)
+
+	clone, err := PlainClone(t.TempDir(), &CloneOptions{URL: full, ReferenceName: plumbing.Master})
+	require.NoError(t, err)
+
+	_, err = f.Seek(0, 0)
+	require.NoError(t, err)
+	h, err := clone.VerifyBundle(f)
+	require.NoError(t, err)
+	assert.Equal(t, []bundle.Prerequisite{{Hash: base, Comment: "base"}}, h.Prerequisites)
+
+	require.NoError(t, clone.Fetch(&FetchOptions{
+		RemoteURL: incremental,
+		RefSpecs:  []config.RefSpec{"refs/heads/*:refs/remotes/incremental/*"},
+	}))
+
+	expected, err := r.Reference("refs/heads/feature", false)
+	require.NoError(t, err)
+	ref, err := clone.Reference("refs/remotes/incremental/feature", false)
+	require.NoError(t, err)
+	assert.Equal(t, expected.Hash(), ref.Hash())
+
+	iter, err := clone.Log(&LogOptions{From: ref.Hash()})
+	require.NoError(t, err)
+	var count int
+	require.NoError(t, iter.ForEach(func(*object.Commit) error {
+		count++
+		return nil
+	}))
+	assert.Equal(t, 3, count)
+}
+
+func TestCreateBundleEmpty(t *testing.T) {
+	t.Parallel()
+
+	r, _ := newRebaseRepository(t, memory.NewStorage(), "b")
+	err := r.CreateBundle(&bytes.Buffer{}, []config.RefSpec{"refs/tags/*:refs/tags/*"}, nil)
+	assert.ErrorIs(t, err, ErrEmptyBundle)
+}
+
+func TestCloneGitBundle(t *testing.T) {
+	t.Parallel()
+
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git is not available")
+	}
+
+	r, _ := newRebaseRepository(t, memory.NewStorage(), "b")
+	src := writeBundle(t, r, []config.RefSpec{"refs/heads/*:refs/heads/*", "HEAD:HEAD"}, nil)
+
+	// The bundle created by go-git is recreated by git, with a v3 header.
+	dir := t.TempDir()
+	path := filepath.Join(dir, "git.bundle")
+	for _, args := range [][]string{
+		{"bundle", "verify", src},
+		{"clone", "--quiet", "--mirror", src, filepath.Join(dir, "mirror")},
+		{"-C", filepath.Join(dir, "mirror"), "bundle", "create", "--version=3", path, "--all"},
+	} {
+		out, err := exec.Command("git", args...).CombinedOutput()
+		require.NoError(t, err, string(out))
+	}
+
+	clone, err := PlainClone(t.TempDir(), &CloneOptions{URL: path, ReferenceName: "refs/heads/feature"})
+	require.NoError(t, err)
+
+	expected, err := r.Reference("refs/heads/feature", false)
+	require.NoError(t, err)
+	head, err := clone.Head()
+	require.NoError(t, err)
+	assert.Equal(t, expected.Hash(), head.Hash())
+}
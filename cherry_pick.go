@@ -0,0 +1,227 @@
+package git
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/go-git/go-git/v6/config"
+	"github.com/go-git/go-git/v6/plumbing"
+	"github.com/go-git/go-git/v6/plumbing/object"
+)
+
+// CherryPickHead is the reference to the commit being cherry-picked, while
+// the cherry-pick is stopped on conflicts.
+const CherryPickHead plumbing.ReferenceName = "CHERRY_PICK_HEAD"
+
+var (
+	// ErrCherryPickInProgress is returned by CherryPick when a cherry-pick
+	// is already in progress.
+	ErrCherryPickInProgress = errors.New("a cherry-pick is already in progress")
+	// ErrNoCherryPickInProgress is returned when there is no cherry-pick to
+	// continue or abort.
+	ErrNoCherryPickInProgress = errors.New("no cherry-pick in progress")
+	// ErrCherryPickConflict is returned when the changes of the commit being
+	// cherry-picked conflict with the current ones. Once they are resolved
+	// and the files added to the index, the cherry-pick can be continued
+	// with CherryPickContinue.
+	ErrCherryPickConflict = errors.New("conflicts cherry-picking commit")
+)
+
+// CherryPick applies the changes introduced by a commit to the current
+// branch, as `git cherry-pick` does. The changes, from the first parent of
+// the commit or from the one given by Mainline, are merged into the index
+// and the working tree, and committed with the same author and message.
+//
+// If the changes conflict with the current ones, the cherry-pick stops and
+// returns ErrCherryPickConflict, leaving the conflicting files unmerged in
+// the index and CHERRY_PICK_HEAD pointing to the commit. It can be resumed
+// with CherryPickContinue once the conflicts are resolved, or cancelled with
+// CherryPickAbort. ErrEmptyCommit is returned if the changes are already
+// applied.
+func (r *Repository) CherryPick(commit plumbing.Hash, opts *CherryPickOptions) error {
+	if opts == nil {
+		opts = &CherryPickOptions{}
+	}
+
+	c, err := r.CommitObject(commit)
+	if err != nil {
+		return err
+	}
+
+	if err := opts.Validate(c); err != nil {
+		return err
+	}
+
+	if _, err := r.Storer.Reference(CherryPickHead); err == nil {
+		return ErrCherryPickInProgress
+	} else if !errors.Is(err, plumbing.ErrReferenceNotFound) {
+		return err
+	}
+
+	w, err := r.Worktree()
+	if err != nil {
+		return err
+	}
+
+	status, err := w.Status()
+	if err != nil {
+		return err
+	}
+
+	if hasLocalChanges(status, false) {
+		return ErrWorktreeNotClean
+	}
+
+	parent := 0
+	if opts.Mainline > 0 {
+		parent = opts.Mainline - 1
+	}
+
+	conflicts, err := r.pickCommit(w, c, parent)
+	if err != nil {
+		return err
+	}
+
+	if len(conflicts) > 0 {
+		if err := r.Storer.SetReference(plumbing.NewHashReference(CherryPickHead, c.Hash)); err != nil {
+			return err
+		}
+
+		return fmt.Errorf("%w %s: %s", ErrCherryPickConflict, c.Hash, strings.Join(conflicts, ", "))
+	}
+
+	_, err = r.commitPicked(w, c, cherryPickMessage(c, opts), opts.Committer)
+	return err
+}
+
+// CherryPickContinue resumes the cherry-pick in progress, committing the
+// content of the index, which must not contain unresolved conflicts. The
+// options must be the same given to CherryPick.
+func (r *Repository) CherryPickContinue(opts *CherryPickOptions) error {
+	if opts == nil {
+		opts = &CherryPickOptions{}
+	}
+
+	ref, err := r.Storer.Reference(CherryPickHead)
+	if errors.Is(err, plumbing.ErrReferenceNotFound) {
+		return ErrNoCherryPickInProgress
+	}
+
+	if err != nil {
+		return err
+	}
+
+	c, err := r.CommitObject(ref.Hash())
+	if err != nil {
+		return err
+	}
+
+	w, err := r.Worktree()
+	if err != nil {
+		return err
+	}
+
+	idx, err := r.Storer.Index()
+	if err != nil {
+		return err
+	}
+
+	if unmerged := unmergedPaths(idx.Entries); len(unmerged) > 0 {
+		return fmt.Errorf("%w: %s", ErrUnmergedPaths, strings.Join(unmerged, ", "))
+	}
+
+	if _, err := r.commitPicked(w, c, cherryPickMessage(c, opts), opts.Committer); err != nil {
+		return err
+	}
+
+	return r.Storer.RemoveReference(CherryPickHead)
+}
+
+// CherryPickAbort cancels the cherry-pick in progress, restoring the index
+// and the working tree to HEAD.
+func (r *Repository) CherryPickAbort() error {
+	if _, err := r.Storer.Reference(CherryPickHead); errors.Is(err, plumbing.ErrReferenceNotFound) {
+		return ErrNoCherryPickInProgress
+	} else if err != nil {
+		return err
+	}
+
+	w, err := r.Worktree()
+	if err != nil {
+		return err
+	}
+
+	if err := w.Reset(&ResetOptions{Mode: HardReset}); err != nil {
+		return err
+	}
+
+	return r.Storer.RemoveReference(CherryPickHead)
+}
+
+func cherryPickMessage(c *object.Commit, opts *CherryPickOptions) string {
+	if !opts.RecordOrigin {
+		return c.Message
+	}
+
+	return fmt.Sprintf("%s\n\n(cherry picked from commit %s)\n", strings.TrimRight(c.Message, "\n"), c.Hash)
+}
+
+// pickCommit merges the changes of a commit, from the given parent, into the
+// index and the working tree. The names of the conflicting files are
+// returned.
+func (r *Repository) pickCommit(w *Worktree, c *object.Commit, parent int) ([]string, error) {
+	var parentTree *object.Tree
+	if c.NumParents() > 0 {
+		p, err := c.Parent(parent)
+		if err != nil {
+			return nil, err
+		}
+
+		if parentTree, err = p.Tree(); err != nil {
+			return nil, err
+		}
+	}
+
+	tree, err := c.Tree()
+	if err != nil {
+		return nil, err
+	}
+
+	changes, err := object.DiffTree(parentTree, tree)
+	if err != nil {
+		return nil, err
+	}
+
+	subject, _, _ := strings.Cut(c.Message, "\n")
+	return w.mergeChanges(changes, tree, &changesMerge{
+		ours:   "HEAD",
+		theirs: fmt.Sprintf("%s (%s)", c.Hash.String()[:7], subject),
+		stage:  true,
+	})
+}
+
+// commitPicked commits the index with the author of the given commit and
+// the given message. If committer is nil, it is resolved as the one of a
+// commit, or is the committer of the given commit if it cannot be.
+func (r *Repository) commitPicked(w *Worktree, c *object.Commit, msg string, committer *object.Signature) (plumbing.Hash, error) {
+	if committer == nil {
+		cfg, err := r.ConfigScoped(config.SystemScope)
+		if err != nil {
+			return plumbing.ZeroHash, err
+		}
+
+		committer, err = resolveIdentity(cfg, committerRole, nil)
+		if err != nil && !errors.Is(err, ErrMissingCommitter) {
+			return plumbing.ZeroHash, err
+		}
+
+		if committer == nil {
+			committer = &object.Signature{Name: c.Committer.Name, Email: c.Committer.Email, When: time.Now()}
+		}
+	}
+
+	author := c.Author
+	return w.Commit(msg, &CommitOptions{Author: &author, Committer: committer, AllowEmptyMessage: true})
+}
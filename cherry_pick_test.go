@@ -0,0 +1,204 @@
+package git
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/go-git/go-billy/v6/memfs"
+	"github.com/go-git/go-billy/v6/util"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/go-git/go-git/v6/plumbing"
+	"github.com/go-git/go-git/v6/plumbing/cache"
+	"github.com/go-git/go-git/v6/plumbing/object"
+	"github.com/go-git/go-git/v6/storage/filesystem"
+	"github.com/go-git/go-git/v6/storage/memory"
+)
+
+func TestCherryPick(t *testing.T) {
+	t.Parallel()
+
+	r, fs := newRebaseRepository(t, memory.NewStorage(), "b")
+
+	w, err := r.Worktree()
+	require.NoError(t, err)
+	require.NoError(t, w.Checkout(&CheckoutOptions{Branch: plumbing.Master}))
+
+	master, err := r.Head()
+	require.NoError(t, err)
+	feature, err := r.CommitObject(mustReference(t, r, "refs/heads/feature"))
+	require.NoError(t, err)
+	first, err := feature.Parent(0)
+	require.NoError(t, err)
+
+	require.NoError(t, r.CherryPick(first.Hash, &CherryPickOptions{RecordOrigin: true}))
+
+	head, err := r.Head()
+	require.NoError(t, err)
+	assert.Equal(t, plumbing.Master, head.Name())
+
+	picked, err := r.CommitObject(head.Hash())
+	require.NoError(t, err)
+	assert.Equal(t, fmt.Sprintf("feature 1\n\n(cherry picked from commit %s)\n", first.Hash), picked.Message)
+	assert.Equal(t, []plumbing.Hash{master.Hash()}, picked.ParentHashes)
+	assert.Equal(t, first.Author.When.Unix(), picked.Author.When.Unix())
+
+	for name, content := range map[string]string{"a": "feature\n", "b": "master\n"} {
+		data, err := util.ReadFile(fs, name)
+		require.NoError(t, err)
+		assert.Equal(t, content, string(data), name)
+	}
+	assert.False(t, fileExists(fs, "c"))
+
+	assert.ErrorIs(t, r.CherryPick(first.Hash, nil), ErrEmptyCommit)
+}
+
+func TestCherryPickMainline(t *testing.T) {
+	t.Parallel()
+
+	r, fs := newRebaseRepository(t, memory.NewStorage(), "b")
+
+	w, err := r.Worktree()
+	require.NoError(t, err)
+
+	feature := mustReference(t, r, "refs/heads/feature")
+	master := mustReference(t, r, plumbing.Master)
+	merge, err := w.Commit("merge\n", &CommitOptions{
+		Author:            defaultSignature(),
+		Parents:           []plumbing.Hash{feature, master},
+		AllowEmptyCommits: true,
+	})
+	require.NoError(t, err)
+
+	require.NoError(t, w.Checkout(&CheckoutOptions{Branch: plumbing.Master}))
+
+	assert.ErrorIs(t, r.CherryPick(merge, nil), ErrInvalidMainline)
+	assert.ErrorIs(t, r.CherryPick(merge, &CherryPickOptions{Mainline: 3}), ErrInvalidMainline)
+	assert.ErrorIs(t, r.CherryPick(feature, &CherryPickOptions{Mainline: 1}), ErrInvalidMainline)
+	assert.ErrorIs(t, r.CherryPick(merge, &CherryPickOptions{Mainline: 1}), ErrEmptyCommit)
+
+	require.NoError(t, r.CherryPick(merge, &CherryPickOptions{Mainline: 2}))
+	for name, content := range map[string]string{"a": "feature\n", "b": "b\n", "c": "c\n"} {
+		data, err := util.ReadFile(fs, name)
+		require.NoError(t, err)
+		assert.Equal(t, content, string(data), name)
+	}
+}
+
+func TestCherryPickMergeLines(t *testing.T) {
+	t.Parallel()
+
+	r, fs := newRebaseRepository(t, memory.NewStorage(), "b")
+
+	w, err := r.Worktree()
+	require.NoError(t, err)
+
+	commit := func(content string) plumbing.Hash {
+		require.NoError(t, util.WriteFile(fs, "b", []byte(content), 0o644))
+		h, err := w.Commit("update b\n", &CommitOptions{All: true, Author: defaultSignature()})
+		require.NoError(t, err)
+		return h
+	}
+
+	require.NoError(t, w.Checkout(&CheckoutOptions{Branch: "refs/heads/feature"}))
+	commit("b\nfoo\nbar\n")
+	picked := commit("b\nfoo\nqux\n")
+
+	require.NoError(t, w.Checkout(&CheckoutOptions{Branch: plumbing.Master}))
+	commit("master\nfoo\nbar\n")
+
+	// The commit picked changes the last line of b, and master the first one.
+	require.NoError(t, r.CherryPick(picked, nil))
+
+	data, err := util.ReadFile(fs, "b")
+	require.NoError(t, err)
+	assert.Equal(t, "master\nfoo\nqux\n", string(data))
+
+	status, err := w.Status()
+	require.NoError(t, err)
+	assert.True(t, status.IsClean(), status)
+}
+
+func TestCherryPickConflict(t *testing.T) {
+	t.Parallel()
+
+	r, fs := newRebaseRepository(t, filesystem.NewStorage(memfs.New(), cache.NewObjectLRUDefault()), "a")
+
+	w, err := r.Worktree()
+	require.NoError(t, err)
+	require.NoError(t, w.Checkout(&CheckoutOptions{Branch: plumbing.Master}))
+
+	master := mustReference(t, r, plumbing.Master)
+	feature, err := r.CommitObject(mustReference(t, r, "refs/heads/feature"))
+	require.NoError(t, err)
+	first, err := feature.Parent(0)
+	require.NoError(t, err)
+
+	assert.ErrorIs(t, r.CherryPickContinue(nil), ErrNoCherryPickInProgress)
+	assert.ErrorIs(t, r.CherryPickAbort(), ErrNoCherryPickInProgress)
+
+	require.ErrorIs(t, r.CherryPick(first.Hash, nil), ErrCherryPickConflict)
+	assert.Equal(t, first.Hash, mustReference(t, r, CherryPickHead))
+	assert.Equal(t, master, mustReference(t, r, plumbing.Master))
+
+	data, err := util.ReadFile(fs, "a")
+	require.NoError(t, err)
+	assert.Equal(t, "<<<<<<< HEAD\nmaster\n=======\nfeature\n>>>>>>> "+
+		first.Hash.String()[:7]+" (feature 1)\n", string(data))
+
+	assert.ErrorIs(t, r.CherryPick(first.Hash, nil), ErrCherryPickInProgress)
+	assert.ErrorIs(t, r.CherryPickContinue(nil), ErrUnmergedPaths)
+
+	require.NoError(t, util.WriteFile(fs, "a", []byte("resolved\n"), 0o644))
+	_, err = w.Add("a")
+	require.NoError(t, err)
+
+	committer := &object.Signature{Name: "bar", Email: "bar@bar.bar"}
+	require.NoError(t, r.CherryPickContinue(&CherryPickOptions{Committer: committer}))
+
+	_, err = r.Reference(CherryPickHead, false)
+	assert.ErrorIs(t, err, plumbing.ErrReferenceNotFound)
+
+	picked, err := r.CommitObject(mustReference(t, r, plumbing.Master))
+	require.NoError(t, err)
+	assert.Equal(t, "feature 1\n", picked.Message)
+	assert.Equal(t, "bar", picked.Committer.Name)
+	assert.Equal(t, []plumbing.Hash{master}, picked.ParentHashes)
+}
+
+func TestCherryPickAbort(t *testing.T) {
+	t.Parallel()
+
+	r, fs := newRebaseRepository(t, memory.NewStorage(), "a")
+
+	w, err := r.Worktree()
+	require.NoError(t, err)
+	require.NoError(t, w.Checkout(&CheckoutOptions{Branch: plumbing.Master}))
+
+	feature, err := r.CommitObject(mustReference(t, r, "refs/heads/feature"))
+	require.NoError(t, err)
+
+	require.ErrorIs(t, r.CherryPick(feature.ParentHashes[0], nil), ErrCherryPickConflict)
+	require.NoError(t, r.CherryPickAbort())
+
+	data, err := util.ReadFile(fs, "a")
+	require.NoError(t, err)
+	assert.Equal(t, "master\n", string(data))
+
+	status, err := w.Status()
+	require.NoError(t, err)
+	assert.True(t, status.IsClean(), status)
+
+	_, err = r.Reference(CherryPickHead, false)
+	assert.ErrorIs(t, err, plumbing.ErrReferenceNotFound)
+}
+
+func mustReference(t *testing.T, r *Repository, name plumbing.ReferenceName) plumbing.Hash {
+	t.Helper()
+
+	ref, err := r.Reference(name, false)
+	require.NoError(t, err)
+
+	return ref.Hash()
+}
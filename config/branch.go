@@ -70,9 +70,11 @@ func (b *Branch) marshal() *format.Subsection {
 		b.raw.SetOption(remoteSection, b.Remote)
 	}
 
+	// The merge option may have several values, as for an octopus merge,
+	// which are kept unless the last one, read as Merge, changed.
 	if b.Merge == "" {
 		b.raw.RemoveOption(mergeKey)
-	} else {
+	} else if b.raw.Options.Get(mergeKey) != string(b.Merge) {
 		b.raw.SetOption(mergeKey, string(b.Merge))
 	}
 
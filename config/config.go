@@ -9,6 +9,7 @@ import (
 	"os"
 	"path/filepath"
 	"reflect"
+	"slices"
 	"sort"
 	"strconv"
 
@@ -30,7 +31,9 @@ const (
 	// should be marshalled or not.
 	// Note that this does not need to align with the default protocol
 	// version from plumbing/protocol.
-	DefaultProtocolVersion = protocol.V0 // go-git only supports V0 at the moment
+	// Setting protocol.version to 2 makes fetches and lists use protocol v2
+	// with the remotes that support it.
+	DefaultProtocolVersion = protocol.V0
 )
 
 // ConfigStorer generic storage of Config object
@@ -54,8 +57,29 @@ const (
 	LocalScope Scope = iota
 	GlobalScope
 	SystemScope
+	// WorktreeScope is the scope of the config.worktree file of a worktree,
+	// read when extensions.worktreeConfig is set, whose options take
+	// precedence over the ones of the local config.
+	WorktreeScope
 )
 
+// String returns the name of the scope, as the --show-scope option of
+// git config prints it.
+func (s Scope) String() string {
+	switch s {
+	case LocalScope:
+		return "local"
+	case GlobalScope:
+		return "global"
+	case SystemScope:
+		return "system"
+	case WorktreeScope:
+		return "worktree"
+	default:
+		return "unknown"
+	}
+}
+
 // Config contains the repository configuration
 // https://www.kernel.org/pub/software/scm/git/docs/git-config.html#FILES
 type Config struct {
@@ -79,6 +103,22 @@ type Config struct {
 		// against local file, 0644 will be used as the value of its mode. The original
 		// value of mode is left unchanged in the index.
 		FileMode bool
+		// SparseCheckout enables sparse checkout: only the paths matching
+		// the patterns of the $GIT_DIR/info/sparse-checkout file are
+		// materialized in the working tree.
+		SparseCheckout bool
+		// SparseCheckoutCone, if true, the patterns of the sparse-checkout
+		// file are directories, whose content is checked out recursively.
+		// Otherwise they are matched as gitignore-style patterns. Defaults
+		// to true, as in git.
+		SparseCheckoutCone bool
+		// LogAllRefUpdates defines whether the updates of the references are
+		// logged in their reflog. If "true", the reflogs of the branches,
+		// remote-tracking branches, notes and HEAD are created when needed,
+		// "always" creates the reflogs of all the references, and "false"
+		// only appends to the existing ones. If empty, it defaults to "true"
+		// in non-bare repositories, and to "false" in bare ones.
+		LogAllRefUpdates string
 	}
 
 	User struct {
@@ -86,6 +126,10 @@ type Config struct {
 		Name string
 		// Email is the email of the author and the committer of a commit.
 		Email string
+		// UseConfigOnly disables the identity guessed from the user of the
+		// system when no name or email is configured, the commits failing
+		// instead, as user.useConfigOnly does.
+		UseConfigOnly bool
 	}
 
 	Author struct {
@@ -107,6 +151,39 @@ type Config struct {
 		// compression.  The default is 10.  A value of 0 turns off
 		// delta compression entirely.
 		Window uint
+		// Depth is the maximum length of the delta chains, the number of
+		// deltas between an object and its full base. The default is 50.
+		// A value of 0 turns off delta compression entirely.
+		Depth uint
+	}
+
+	Index struct {
+		// Version is the version of the new index files, 2, 3 or 4. Version
+		// 4 prefix-compresses the paths of the entries, reducing the size of
+		// the index of large worktrees. If zero, version 2 is used, or 4 if
+		// Feature.ManyFiles is set.
+		Version uint
+	}
+
+	UploadPack struct {
+		// AllowTipSHA1InWant allows the clients fetching from the
+		// repository to request the objects pointed by the references, such
+		// as the ones hidden, by their hash, advertising the
+		// allow-tip-sha1-in-want capability.
+		AllowTipSHA1InWant bool
+		// AllowReachableSHA1InWant allows the clients to request any object
+		// reachable from the references by its hash, advertising the
+		// allow-reachable-sha1-in-want capability.
+		AllowReachableSHA1InWant bool
+		// AllowAnySHA1InWant allows the clients to request any object by its
+		// hash, advertising both capabilities.
+		AllowAnySHA1InWant bool
+	}
+
+	Feature struct {
+		// ManyFiles enables the options optimizing for repositories with
+		// many files, such as index.version set to 4.
+		ManyFiles bool
 	}
 
 	Init struct {
@@ -125,6 +202,20 @@ type Config struct {
 		// This setting must not be changed after repository initialization
 		// (e.g. clone or init).
 		ObjectFormat format.ObjectFormat
+		// PartialClone is the name of the promisor remote of a partial
+		// clone, from which the missing objects can be fetched. It is an
+		// error to specify this key unless core.repositoryFormatVersion
+		// is 1.
+		PartialClone string
+		// RefStorage specifies the format the references are stored in:
+		// files, the loose references and the packed-refs file, if empty,
+		// or reftable, the stack of tables of the reftable directory. It is
+		// an error to specify this key unless core.repositoryFormatVersion
+		// is 1.
+		RefStorage string
+		// WorktreeConfig makes the config.worktree file of each worktree
+		// be read after the local config, with the WorktreeScope.
+		WorktreeConfig bool
 	}
 
 	Protocol struct {
@@ -225,6 +316,7 @@ func NewConfig() *Config {
 
 	config.Core.FileMode = DefaultFileMode
 	config.Pack.Window = DefaultPackWindow
+	config.Pack.Depth = DefaultPackDepth
 	config.Protocol.Version = DefaultProtocolVersion
 
 	return config
@@ -245,12 +337,43 @@ func ReadConfig(r io.Reader) (*Config, error) {
 	return cfg, nil
 }
 
+// ReadConfigWithIncludes reads a config file from a io.Reader, along with the
+// files included by its include and includeIf sections, as given by opts.
+// The returned Config is meant to be read, as its Raw config holds the
+// options of the included files too.
+func ReadConfigWithIncludes(r io.Reader, opts *format.IncludeOptions) (*Config, error) {
+	b, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+
+	cfg := NewConfig()
+	if err = cfg.unmarshal(b, opts); err != nil {
+		return nil, err
+	}
+
+	return cfg, nil
+}
+
 // LoadConfig loads a config file from a given scope. The returned Config,
 // contains exclusively information from the given scope. If it couldn't find a
 // config file to the given scope, an empty one is returned.
+//
+// The files included by the config file are loaded too, the includeIf
+// sections whose conditions depend on a repository being skipped. See
+// LoadConfigWithIncludes.
 func LoadConfig(scope Scope) (*Config, error) {
-	if scope == LocalScope {
-		return nil, fmt.Errorf("LocalScope should be read from the a ConfigStorer")
+	return LoadConfigWithIncludes(scope, &format.IncludeOptions{})
+}
+
+// LoadConfigWithIncludes loads a config file from a given scope like
+// LoadConfig, along with the files included by its include and includeIf
+// sections, the conditions of the includeIf sections being evaluated with
+// opts. The included files are read from opts.Filesystem, or from the OS
+// filesystem if nil, and opts.Path is set to the path of the config file.
+func LoadConfigWithIncludes(scope Scope, opts *format.IncludeOptions) (*Config, error) {
+	if scope == LocalScope || scope == WorktreeScope {
+		return nil, fmt.Errorf("%s scope should be read from the repository", scope)
 	}
 
 	files, err := Paths(scope)
@@ -269,7 +392,14 @@ func LoadConfig(scope Scope) (*Config, error) {
 		}
 
 		defer f.Close()
-		return ReadConfig(f)
+
+		o := *opts
+		o.Path = file
+		if o.Filesystem == nil {
+			o.Filesystem = osfs.Default
+		}
+
+		return ReadConfigWithIncludes(f, &o)
 	}
 
 	return NewConfig(), nil
@@ -301,6 +431,63 @@ func Paths(scope Scope) ([]string, error) {
 	return files, nil
 }
 
+// ScopePath returns the path of the config file of the given global or system
+// scope, the one read by LoadConfig: the first existing file of Paths, or
+// ~/.gitconfig and /etc/gitconfig if none exists.
+func ScopePath(scope Scope) (string, error) {
+	files, err := Paths(scope)
+	if err != nil {
+		return "", err
+	}
+
+	if len(files) == 0 {
+		return "", fmt.Errorf("%s scope should be written to the repository", scope)
+	}
+
+	for _, file := range files {
+		if _, err := os.Stat(file); err == nil {
+			return file, nil
+		}
+	}
+
+	if scope == GlobalScope {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return "", err
+		}
+
+		return filepath.Join(home, ".gitconfig"), nil
+	}
+
+	return files[0], nil
+}
+
+// SaveConfig writes cfg to the config file of the given global or system
+// scope, as given by ScopePath, creating it if needed. cfg should be read
+// from the file alone, without its included files, or they would be written
+// in it too.
+func SaveConfig(scope Scope, cfg *Config) error {
+	file, err := ScopePath(scope)
+	if err != nil {
+		return err
+	}
+
+	if err := cfg.Validate(); err != nil {
+		return err
+	}
+
+	b, err := cfg.MarshalScope(scope)
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(file), 0o755); err != nil {
+		return err
+	}
+
+	return os.WriteFile(file, b, 0o644)
+}
+
 // Validate validates the fields and sets the default values.
 func (c *Config) Validate() error {
 	for name, r := range c.Remotes {
@@ -339,6 +526,9 @@ const (
 	urlSection                 = "url"
 	extensionsSection          = "extensions"
 	protocolSection            = "protocol"
+	indexSection               = "index"
+	featureSection             = "feature"
+	uploadPackSection          = "uploadpack"
 	fetchKey                   = "fetch"
 	urlKey                     = "url"
 	pushurlKey                 = "pushurl"
@@ -346,33 +536,63 @@ const (
 	worktreeKey                = "worktree"
 	commentCharKey             = "commentChar"
 	windowKey                  = "window"
+	depthKey                   = "depth"
 	mergeKey                   = "merge"
 	rebaseKey                  = "rebase"
 	nameKey                    = "name"
 	emailKey                   = "email"
+	useConfigOnlyKey           = "useconfigonly"
 	descriptionKey             = "description"
 	defaultBranchKey           = "defaultBranch"
 	repositoryFormatVersionKey = "repositoryformatversion"
 	objectFormatKey            = "objectformat"
+	partialCloneKey            = "partialclone"
+	refStorageKey              = "refstorage"
+	worktreeConfigKey          = "worktreeconfig"
+	promisorKey                = "promisor"
+	partialCloneFilterKey      = "partialclonefilter"
 	mirrorKey                  = "mirror"
 	versionKey                 = "version"
 	autoCRLFKey                = "autocrlf"
 	fileModeKey                = "filemode"
+	sparseCheckoutKey          = "sparseCheckout"
+	logAllRefUpdatesKey        = "logAllRefUpdates"
+	sparseCheckoutConeKey      = "sparseCheckoutCone"
+	manyFilesKey               = "manyFiles"
+	allowTipKey                = "allowTipSHA1InWant"
+	allowReachableKey          = "allowReachableSHA1InWant"
+	allowAnyKey                = "allowAnySHA1InWant"
 
 	// DefaultPackWindow holds the number of previous objects used to
 	// generate deltas. The value 10 is the same used by git command.
 	DefaultPackWindow = uint(10)
+	// DefaultPackDepth holds the maximum length of the delta chains. The
+	// value 50 is the same used by git command.
+	DefaultPackDepth = uint(50)
 	// The value true is the same used by git command
 	DefaultFileMode = true
 )
 
 // Unmarshal parses a git-config file and stores it.
 func (c *Config) Unmarshal(b []byte) error {
+	return c.unmarshal(b, nil)
+}
+
+// unmarshal parses a git-config file, along with the files it includes if
+// opts is not nil, and stores it.
+func (c *Config) unmarshal(b []byte, opts *format.IncludeOptions) error {
 	r := bytes.NewBuffer(b)
 	d := format.NewDecoder(r)
 
 	c.Raw = format.New()
-	if err := d.Decode(c.Raw); err != nil {
+	decode := d.Decode
+	if opts != nil {
+		decode = func(cfg *format.Config) error {
+			return d.DecodeWithIncludes(cfg, opts)
+		}
+	}
+
+	if err := decode(c.Raw); err != nil {
 		return err
 	}
 
@@ -383,6 +603,13 @@ func (c *Config) Unmarshal(b []byte) error {
 	if err := c.unmarshalPack(); err != nil {
 		return err
 	}
+
+	if err := c.unmarshalIndex(); err != nil {
+		return err
+	}
+
+	c.unmarshalUploadPack()
+	c.unmarshalFeature()
 	unmarshalSubmodules(c.Raw, c.Submodules)
 
 	if err := c.unmarshalBranches(); err != nil {
@@ -409,11 +636,15 @@ func (c *Config) unmarshalCore() {
 	c.Core.Worktree = s.Options.Get(worktreeKey)
 	c.Core.CommentChar = s.Options.Get(commentCharKey)
 	c.Core.AutoCRLF = s.Options.Get(autoCRLFKey)
+	c.Core.LogAllRefUpdates = s.Options.Get(logAllRefUpdatesKey)
 
 	if fileMode := s.Options.Get(fileModeKey); fileMode == "false" {
 		c.Core.FileMode = false
 	}
 
+	c.Core.SparseCheckout = s.Options.Get(sparseCheckoutKey) == "true"
+	c.Core.SparseCheckoutCone = s.Options.Get(sparseCheckoutConeKey) != "false"
+
 	if s.Options.Get(repositoryFormatVersionKey) == string(format.Version_1) {
 		c.Core.RepositoryFormatVersion = format.Version_1
 	}
@@ -424,12 +655,17 @@ func (c *Config) unmarshalExtensions() {
 	if s.Options.Get(objectFormatKey) == format.SHA256.String() {
 		c.Extensions.ObjectFormat = format.SHA256
 	}
+
+	c.Extensions.PartialClone = s.Options.Get(partialCloneKey)
+	c.Extensions.RefStorage = s.Options.Get(refStorageKey)
+	c.Extensions.WorktreeConfig = s.Options.Get(worktreeConfigKey) == "true"
 }
 
 func (c *Config) unmarshalUser() {
 	s := c.Raw.Section(userSection)
 	c.User.Name = s.Options.Get(nameKey)
 	c.User.Email = s.Options.Get(emailKey)
+	c.User.UseConfigOnly = s.Options.Get(useConfigOnlyKey) == "true"
 
 	s = c.Raw.Section(authorSection)
 	c.Author.Name = s.Options.Get(nameKey)
@@ -452,9 +688,46 @@ func (c *Config) unmarshalPack() error {
 		}
 		c.Pack.Window = uint(winUint)
 	}
+
+	depth := s.Options.Get(depthKey)
+	if depth == "" {
+		c.Pack.Depth = DefaultPackDepth
+	} else {
+		depthUint, err := strconv.ParseUint(depth, 10, 32)
+		if err != nil {
+			return err
+		}
+		c.Pack.Depth = uint(depthUint)
+	}
+	return nil
+}
+
+func (c *Config) unmarshalIndex() error {
+	s := c.Raw.Section(indexSection)
+	if version := s.Options.Get(versionKey); version != "" {
+		v, err := strconv.ParseUint(version, 10, 32)
+		if err != nil {
+			return err
+		}
+
+		c.Index.Version = uint(v)
+	}
+
 	return nil
 }
 
+func (c *Config) unmarshalUploadPack() {
+	s := c.Raw.Section(uploadPackSection)
+	c.UploadPack.AllowTipSHA1InWant = s.Options.Get(allowTipKey) == "true"
+	c.UploadPack.AllowReachableSHA1InWant = s.Options.Get(allowReachableKey) == "true"
+	c.UploadPack.AllowAnySHA1InWant = s.Options.Get(allowAnyKey) == "true"
+}
+
+func (c *Config) unmarshalFeature() {
+	s := c.Raw.Section(featureSection)
+	c.Feature.ManyFiles = s.Options.Get(manyFilesKey) == "true"
+}
+
 func (c *Config) unmarshalRemotes() error {
 	s := c.Raw.Section(remoteSection)
 	for _, sub := range s.Subsections {
@@ -560,6 +833,9 @@ func (c *Config) Marshal() ([]byte, error) {
 	c.marshalExtensions()
 	c.marshalUser()
 	c.marshalPack()
+	c.marshalIndex()
+	c.marshalUploadPack()
+	c.marshalFeature()
 	c.marshalRemotes()
 	c.marshalSubmodules()
 	c.marshalBranches()
@@ -575,6 +851,42 @@ func (c *Config) Marshal() ([]byte, error) {
 	return buf.Bytes(), nil
 }
 
+// MarshalScope returns the config as Marshal does, for the config file of the
+// given scope. Out of the local scope, the core.bare and core.filemode
+// options, which Marshal always writes, are only written if the file set
+// them.
+func (c *Config) MarshalScope(scope Scope) ([]byte, error) {
+	if scope == LocalScope {
+		return c.Marshal()
+	}
+
+	core := c.Raw.Section(coreSection)
+	hasBare, hasFileMode := core.HasOption(bareKey), core.HasOption(fileModeKey)
+	if _, err := c.Marshal(); err != nil {
+		return nil, err
+	}
+
+	core = c.Raw.Section(coreSection)
+	if !hasBare {
+		core.RemoveOption(bareKey)
+	}
+
+	if !hasFileMode {
+		core.RemoveOption(fileModeKey)
+	}
+
+	if len(core.Options) == 0 && len(core.Subsections) == 0 {
+		c.Raw.RemoveSection(coreSection)
+	}
+
+	buf := bytes.NewBuffer(nil)
+	if err := format.NewEncoder(buf).Encode(c.Raw); err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
+
 func (c *Config) marshalCore() {
 	s := c.Raw.Section(coreSection)
 	s.SetOption(bareKey, fmt.Sprintf("%t", c.Core.IsBare))
@@ -590,7 +902,19 @@ func (c *Config) marshalCore() {
 		s.SetOption(autoCRLFKey, c.Core.AutoCRLF)
 	}
 
+	if c.Core.LogAllRefUpdates != "" {
+		s.SetOption(logAllRefUpdatesKey, c.Core.LogAllRefUpdates)
+	}
+
 	s.SetOption(fileModeKey, fmt.Sprintf("%t", c.Core.FileMode))
+
+	if c.Core.SparseCheckout {
+		s.SetOption(sparseCheckoutKey, "true")
+		s.SetOption(sparseCheckoutConeKey, fmt.Sprintf("%t", c.Core.SparseCheckoutCone))
+	} else {
+		s.RemoveOption(sparseCheckoutKey)
+		s.RemoveOption(sparseCheckoutConeKey)
+	}
 }
 
 func (c *Config) marshalExtensions() {
@@ -599,6 +923,17 @@ func (c *Config) marshalExtensions() {
 	if c.Core.RepositoryFormatVersion == format.Version_1 {
 		s := c.Raw.Section(extensionsSection)
 		s.SetOption(objectFormatKey, c.Extensions.ObjectFormat.String())
+		if c.Extensions.PartialClone != "" {
+			s.SetOption(partialCloneKey, c.Extensions.PartialClone)
+		}
+
+		if c.Extensions.RefStorage != "" {
+			s.SetOption(refStorageKey, c.Extensions.RefStorage)
+		}
+
+		if c.Extensions.WorktreeConfig {
+			s.SetOption(worktreeConfigKey, "true")
+		}
 	}
 }
 
@@ -612,6 +947,10 @@ func (c *Config) marshalUser() {
 		s.SetOption(emailKey, c.User.Email)
 	}
 
+	if c.User.UseConfigOnly {
+		s.SetOption(useConfigOnlyKey, "true")
+	}
+
 	s = c.Raw.Section(authorSection)
 	if c.Author.Name != "" {
 		s.SetOption(nameKey, c.Author.Name)
@@ -636,6 +975,38 @@ func (c *Config) marshalPack() {
 	if c.Pack.Window != DefaultPackWindow {
 		s.SetOption(windowKey, fmt.Sprintf("%d", c.Pack.Window))
 	}
+	if c.Pack.Depth != DefaultPackDepth {
+		s.SetOption(depthKey, fmt.Sprintf("%d", c.Pack.Depth))
+	}
+}
+
+func (c *Config) marshalIndex() {
+	if c.Index.Version != 0 {
+		s := c.Raw.Section(indexSection)
+		s.SetOption(versionKey, fmt.Sprintf("%d", c.Index.Version))
+	}
+}
+
+func (c *Config) marshalUploadPack() {
+	s := c.Raw.Section(uploadPackSection)
+	if c.UploadPack.AllowTipSHA1InWant {
+		s.SetOption(allowTipKey, "true")
+	}
+
+	if c.UploadPack.AllowReachableSHA1InWant {
+		s.SetOption(allowReachableKey, "true")
+	}
+
+	if c.UploadPack.AllowAnySHA1InWant {
+		s.SetOption(allowAnyKey, "true")
+	}
+}
+
+func (c *Config) marshalFeature() {
+	if c.Feature.ManyFiles {
+		s := c.Raw.Section(featureSection)
+		s.SetOption(manyFilesKey, "true")
+	}
 }
 
 func (c *Config) marshalRemotes() {
@@ -741,7 +1112,9 @@ type RemoteConfig struct {
 	// Name of the remote
 	Name string
 	// URLs the URLs of a remote repository. It must be non-empty. Fetch will
-	// always use the first URL, while push will use all of them.
+	// always use the first URL, while push will use all of them. The URLs
+	// of the pushurl options follow the ones of the url options, and are
+	// written back as pushurl options.
 	URLs []string
 	// Mirror indicates that the repository is a mirror of remote.
 	Mirror bool
@@ -750,9 +1123,21 @@ type RemoteConfig struct {
 	insteadOfRulesApplied bool
 	// originalURLs are the urls before applying insteadOf rules
 	originalURLs []string
+	// pushURLs are the urls read from the pushurl options, which are kept as
+	// such when marshaled
+	pushURLs []string
+	// urlRules are the url rules applied to the urls, kept for the
+	// pushInsteadOf ones
+	urlRules map[string]*URL
 
 	// Fetch the default set of "refspec" for fetch operation
 	Fetch []RefSpec
+	// Promisor indicates that the remote may be used to fetch the objects
+	// missing from a partial clone.
+	Promisor bool
+	// PartialCloneFilter is the filter used when fetching from a promisor
+	// remote, such as "blob:none".
+	PartialCloneFilter string
 
 	// raw representation of the subsection, filled by marshal or unmarshal are
 	// called
@@ -797,9 +1182,15 @@ func (c *RemoteConfig) unmarshal(s *format.Subsection) error {
 
 	c.Name = c.raw.Name
 	c.URLs = append([]string(nil), c.raw.Options.GetAll(urlKey)...)
-	c.URLs = append(c.URLs, c.raw.Options.GetAll(pushurlKey)...)
+	c.pushURLs = nil
+	if pushURLs := c.raw.Options.GetAll(pushurlKey); len(pushURLs) > 0 {
+		c.pushURLs = pushURLs
+		c.URLs = append(c.URLs, pushURLs...)
+	}
 	c.Fetch = fetch
 	c.Mirror = c.raw.Options.Get(mirrorKey) == "true"
+	c.Promisor = c.raw.Options.Get(promisorKey) == "true"
+	c.PartialCloneFilter = c.raw.Options.Get(partialCloneFilterKey)
 
 	return nil
 }
@@ -810,15 +1201,30 @@ func (c *RemoteConfig) marshal() *format.Subsection {
 	}
 
 	c.raw.Name = c.Name
-	if len(c.URLs) == 0 {
+	urls := c.URLs
+	if c.insteadOfRulesApplied {
+		urls = c.originalURLs
+	}
+
+	var fetchURLs, pushURLs []string
+	for _, u := range urls {
+		if slices.Contains(c.pushURLs, u) {
+			pushURLs = append(pushURLs, u)
+		} else {
+			fetchURLs = append(fetchURLs, u)
+		}
+	}
+
+	if len(fetchURLs) == 0 {
 		c.raw.RemoveOption(urlKey)
 	} else {
-		urls := c.URLs
-		if c.insteadOfRulesApplied {
-			urls = c.originalURLs
-		}
+		c.raw.SetOption(urlKey, fetchURLs...)
+	}
 
-		c.raw.SetOption(urlKey, urls...)
+	if len(pushURLs) == 0 {
+		c.raw.RemoveOption(pushurlKey)
+	} else {
+		c.raw.SetOption(pushurlKey, pushURLs...)
 	}
 
 	if len(c.Fetch) == 0 {
@@ -836,6 +1242,14 @@ func (c *RemoteConfig) marshal() *format.Subsection {
 		c.raw.SetOption(mirrorKey, strconv.FormatBool(c.Mirror))
 	}
 
+	if c.Promisor {
+		c.raw.SetOption(promisorKey, strconv.FormatBool(c.Promisor))
+	}
+
+	if c.PartialCloneFilter != "" {
+		c.raw.SetOption(partialCloneFilterKey, c.PartialCloneFilter)
+	}
+
 	return c.raw
 }
 
@@ -843,7 +1257,49 @@ func (c *RemoteConfig) IsFirstURLLocal() bool {
 	return url.IsLocalEndpoint(c.URLs[0])
 }
 
+// PushURL returns the URL push uses, the last of URLs. Unless the remote has
+// pushurl options, it is rewritten by the longest matching pushInsteadOf of
+// the url rules applied to the remote, instead of their insteadOf, as git does.
+func (c *RemoteConfig) PushURL() string {
+	if len(c.URLs) == 0 {
+		return ""
+	}
+
+	last := len(c.URLs) - 1
+	if len(c.pushURLs) == 0 {
+		u := c.URLs[last]
+		if c.insteadOfRulesApplied && len(c.originalURLs) == len(c.URLs) {
+			u = c.originalURLs[last]
+		}
+
+		if rule := findLongestPushInsteadOfMatch(u, c.urlRules); rule != nil {
+			return rule.ApplyPushInsteadOf(u)
+		}
+	}
+
+	return c.URLs[last]
+}
+
+// ApplyURLRules rewrites the URLs with the longest matching insteadOf of the
+// given url rules, as done for the remotes of a config when it is read, and
+// keeps the rules for PushURL. The URLs are rewritten from the ones they were
+// rewritten from by a previous call, which are the ones marshaled.
+func (c *RemoteConfig) ApplyURLRules(urlRules map[string]*URL) {
+	if c.insteadOfRulesApplied && len(c.originalURLs) == len(c.URLs) {
+		copy(c.URLs, c.originalURLs)
+	}
+
+	c.insteadOfRulesApplied = false
+	c.originalURLs = nil
+	c.applyURLRules(urlRules)
+}
+
 func (c *RemoteConfig) applyURLRules(urlRules map[string]*URL) {
+	c.urlRules = nil
+	if len(urlRules) > 0 {
+		c.urlRules = urlRules
+	}
+
 	// save original urls
 	originalURLs := make([]string, len(c.URLs))
 	copy(originalURLs, c.URLs)
@@ -32,6 +32,7 @@ func (s *ConfigSuite) TestUnmarshal() {
 		commentchar = bar
 		autocrlf = true
 		filemode = false
+		logallrefupdates = always
 [user]
 		name = John Doe
 		email = john@example.com
@@ -43,6 +44,7 @@ func (s *ConfigSuite) TestUnmarshal() {
 		email = richard@example.com
 [pack]
 		window = 20
+		depth = 30
 [remote "origin"]
 		url = git@github.com:mcuadros/go-git.git
 		fetch = +refs/heads/*:refs/remotes/origin/*
@@ -78,6 +80,7 @@ func (s *ConfigSuite) TestUnmarshal() {
 	s.Equal("bar", cfg.Core.CommentChar)
 	s.Equal("true", cfg.Core.AutoCRLF)
 	s.False(cfg.Core.FileMode)
+	s.Equal("always", cfg.Core.LogAllRefUpdates)
 	s.Equal("John Doe", cfg.User.Name)
 	s.Equal("john@example.com", cfg.User.Email)
 	s.Equal("Jane Roe", cfg.Author.Name)
@@ -85,6 +88,7 @@ func (s *ConfigSuite) TestUnmarshal() {
 	s.Equal("Richard Roe", cfg.Committer.Name)
 	s.Equal("richard@example.com", cfg.Committer.Email)
 	s.Equal(uint(20), cfg.Pack.Window)
+	s.Equal(uint(30), cfg.Pack.Depth)
 	s.Len(cfg.Remotes, 4)
 	s.Equal("origin", cfg.Remotes["origin"].Name)
 	s.Equal([]string{"git@github.com:mcuadros/go-git.git"}, cfg.Remotes["origin"].URLs)
@@ -113,6 +117,7 @@ func (s *ConfigSuite) TestMarshal() {
 	filemode = true
 [pack]
 	window = 20
+	depth = 30
 [remote "alt"]
 	url = git@github.com:mcuadros/go-git.git
 	url = git@github.com:src-d/go-git.git
@@ -141,6 +146,7 @@ func (s *ConfigSuite) TestMarshal() {
 	cfg.Core.Worktree = "bar"
 	cfg.Core.AutoCRLF = "true"
 	cfg.Pack.Window = 20
+	cfg.Pack.Depth = 30
 	cfg.Init.DefaultBranch = "main"
 	cfg.Remotes["origin"] = &RemoteConfig{
 		Name: "origin",
@@ -247,6 +253,39 @@ func TestUnmarshalMarshal(t *testing.T) {
 	rebase = true
 [extensions]
 	objectformat = sha1
+`,
+		},
+		{
+			`[core]
+	repositoryformatversion = 1
+	bare = false
+	filemode = true
+[remote "origin"]
+	url = https://github.com/go-git/go-git.git
+	fetch = +refs/heads/*:refs/remotes/origin/*
+	promisor = true
+	partialclonefilter = blob:none
+[extensions]
+	objectformat = sha1
+	partialclone = origin
+`,
+		},
+		{
+			`[core]
+	bare = false
+	filemode = true
+[remote "origin"]
+	url = https://github.com/go-git/go-git.git
+	pushurl = git@github.com:go-git/go-git.git
+	pushurl = git@example.com:go-git/go-git.git
+	fetch = +refs/heads/*:refs/remotes/origin/*
+	fetch = +refs/tags/*:refs/tags/*
+	custom = a
+	custom = b
+[branch "octopus"]
+	remote = origin
+	merge = refs/heads/a
+	merge = refs/heads/b
 `,
 		},
 	}
@@ -395,6 +434,7 @@ func (s *ConfigSuite) TestRemoteConfigDefaultValues() {
 	s.Len(config.Submodules, 0)
 	s.NotNil(config.Raw)
 	s.Equal(DefaultPackWindow, config.Pack.Window)
+	s.Equal(DefaultPackDepth, config.Pack.Depth)
 }
 
 func (s *ConfigSuite) TestLoadConfigLocalScope() {
@@ -403,6 +443,70 @@ func (s *ConfigSuite) TestLoadConfigLocalScope() {
 	s.Nil(cfg)
 }
 
+func TestSaveConfig(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	t.Setenv("XDG_CONFIG_HOME", "")
+
+	path, err := ScopePath(GlobalScope)
+	require.NoError(t, err)
+	assert.Equal(t, filepath.Join(home, ".gitconfig"), path)
+
+	cfg, err := LoadConfig(GlobalScope)
+	require.NoError(t, err)
+	cfg.User.Name = "foo"
+	require.NoError(t, SaveConfig(GlobalScope, cfg))
+
+	// Only the options set are written, and not the ones of the local scope.
+	b, err := os.ReadFile(path)
+	require.NoError(t, err)
+	assert.Equal(t, "[user]\n\tname = foo\n", string(b))
+
+	cfg, err = LoadConfig(GlobalScope)
+	require.NoError(t, err)
+	assert.Equal(t, "foo", cfg.User.Name)
+
+	// The existing XDG file is written rather than ~/.gitconfig.
+	require.NoError(t, os.Remove(path))
+	xdg := t.TempDir()
+	t.Setenv("XDG_CONFIG_HOME", xdg)
+	require.NoError(t, os.MkdirAll(filepath.Join(xdg, "git"), 0o755))
+	require.NoError(t, os.WriteFile(filepath.Join(xdg, "git", "config"), []byte("[core]\n\tfilemode = false\n"), 0o644))
+
+	cfg, err = LoadConfig(GlobalScope)
+	require.NoError(t, err)
+	assert.False(t, cfg.Core.FileMode)
+	cfg.User.Email = "foo@foo.foo"
+	require.NoError(t, SaveConfig(GlobalScope, cfg))
+
+	b, err = os.ReadFile(filepath.Join(xdg, "git", "config"))
+	require.NoError(t, err)
+	assert.Equal(t, "[core]\n\tfilemode = false\n[user]\n\temail = foo@foo.foo\n", string(b))
+
+	assert.Error(t, SaveConfig(LocalScope, cfg))
+	assert.Error(t, SaveConfig(WorktreeScope, cfg))
+}
+
+func (s *ConfigSuite) TestWorktreeConfig() {
+	input := []byte(`[core]
+	repositoryformatversion = 1
+[extensions]
+	worktreeConfig = true
+`)
+
+	cfg := NewConfig()
+	s.NoError(cfg.Unmarshal(input))
+	s.True(cfg.Extensions.WorktreeConfig)
+
+	output, err := cfg.Marshal()
+	s.NoError(err)
+	s.Regexp(`(?i)worktreeconfig = true`, string(output))
+
+	s.Equal("worktree", WorktreeScope.String())
+	_, err = LoadConfig(WorktreeScope)
+	s.Error(err)
+}
+
 func (s *ConfigSuite) TestRemoveUrlOptions() {
 	buf := []byte(`
 [remote "alt"]
@@ -468,6 +572,197 @@ func (s *ConfigSuite) TestUnmarshalRemotes() {
 	s.Equal("git@git.sr.ht:~mcepl/go-git.git", cfg.Remotes["origin"].URLs[1])
 }
 
+func (s *ConfigSuite) TestMarshalPushURLs() {
+	cfg := NewConfig()
+	s.NoError(cfg.Unmarshal([]byte(`[remote "origin"]
+	url = https://example.com/a.git
+	pushurl = git@example.com:a.git
+	pushurl = git@example.com:b.git
+[url "https://mirror.example.com/"]
+	insteadOf = https://example.com/
+`)))
+
+	remote := cfg.Remotes["origin"]
+	s.Equal([]string{
+		"https://mirror.example.com/a.git",
+		"git@example.com:a.git",
+		"git@example.com:b.git",
+	}, remote.URLs)
+
+	b, err := cfg.Marshal()
+	s.NoError(err)
+	s.Equal(`[remote "origin"]
+	url = https://example.com/a.git
+	pushurl = git@example.com:a.git
+	pushurl = git@example.com:b.git
+[url "https://mirror.example.com/"]
+	insteadOf = https://example.com/
+[core]
+	bare = false
+	filemode = true
+`, string(b))
+
+	// The URLs read from pushurl options stay so, while the added ones are
+	// written as url options.
+	remote.URLs = []string{"https://example.com/a.git", "git@example.com:b.git", "https://example.com/c.git"}
+	remote.insteadOfRulesApplied = false
+	b, err = cfg.Marshal()
+	s.NoError(err)
+	s.Contains(string(b), "\turl = https://example.com/a.git\n\tpushurl = git@example.com:b.git\n\turl = https://example.com/c.git\n")
+	s.NotContains(string(b), "git@example.com:a.git")
+}
+
+func (s *ConfigSuite) TestRemoteConfigPushURL() {
+	cfg := NewConfig()
+	s.NoError(cfg.Unmarshal([]byte(`[remote "origin"]
+	url = https://example.com/org/a.git
+[remote "pushurl"]
+	url = https://example.com/org/a.git
+	pushurl = https://example.com/org/b.git
+[remote "other"]
+	url = https://other.com/a.git
+[url "https://mirror.example.com/"]
+	insteadOf = https://example.com/
+[url "ssh://git@example.com/"]
+	pushInsteadOf = https://example.com/
+[url "ssh://git@org.example.com/"]
+	pushInsteadOf = https://example.com/org/
+`)))
+
+	origin := cfg.Remotes["origin"]
+	s.Equal([]string{"https://mirror.example.com/org/a.git"}, origin.URLs)
+	s.Equal("ssh://git@org.example.com/a.git", origin.PushURL())
+
+	// The pushInsteadOf rules don't apply to the remotes with a pushurl.
+	s.Equal("https://mirror.example.com/org/b.git", cfg.Remotes["pushurl"].PushURL())
+	s.Equal("https://other.com/a.git", cfg.Remotes["other"].PushURL())
+
+	origin.ApplyURLRules(map[string]*URL{
+		"ssh://git@example.com/": {Name: "ssh://git@example.com/", InsteadOfs: []string{"https://example.com/"}},
+	})
+	s.Equal([]string{"ssh://git@example.com/org/a.git"}, origin.URLs)
+	s.Equal("ssh://git@example.com/org/a.git", origin.PushURL())
+
+	b, err := cfg.Marshal()
+	s.NoError(err)
+	s.Contains(string(b), "[remote \"origin\"]\n\turl = https://example.com/org/a.git\n")
+	s.Equal("", (&RemoteConfig{}).PushURL())
+}
+
+func (s *ConfigSuite) TestUnmarshalPartialClone() {
+	input := []byte(`[core]
+	repositoryformatversion = 1
+[remote "origin"]
+	url = https://github.com/go-git/go-git.git
+	promisor = true
+	partialclonefilter = blob:limit=1m
+[extensions]
+	partialclone = origin
+`)
+
+	cfg := NewConfig()
+	s.NoError(cfg.Unmarshal(input))
+
+	s.Equal("origin", cfg.Extensions.PartialClone)
+	s.True(cfg.Remotes["origin"].Promisor)
+	s.Equal("blob:limit=1m", cfg.Remotes["origin"].PartialCloneFilter)
+}
+
+func (s *ConfigSuite) TestUploadPack() {
+	input := []byte(`[uploadpack]
+	allowTipSHA1InWant = true
+	allowReachableSHA1InWant = false
+`)
+
+	cfg := NewConfig()
+	s.NoError(cfg.Unmarshal(input))
+	s.True(cfg.UploadPack.AllowTipSHA1InWant)
+	s.False(cfg.UploadPack.AllowReachableSHA1InWant)
+	s.False(cfg.UploadPack.AllowAnySHA1InWant)
+
+	cfg.UploadPack.AllowAnySHA1InWant = true
+	output, err := cfg.Marshal()
+	s.NoError(err)
+
+	cfg = NewConfig()
+	s.NoError(cfg.Unmarshal(output))
+	s.True(cfg.UploadPack.AllowTipSHA1InWant)
+	s.True(cfg.UploadPack.AllowAnySHA1InWant)
+}
+
+func (s *ConfigSuite) TestUserUseConfigOnly() {
+	input := []byte(`[user]
+	name = foo
+	useConfigOnly = true
+`)
+
+	cfg := NewConfig()
+	s.NoError(cfg.Unmarshal(input))
+	s.True(cfg.User.UseConfigOnly)
+
+	output, err := cfg.Marshal()
+	s.NoError(err)
+	s.Regexp(`(?i)useconfigonly = true`, string(output))
+}
+
+func (s *ConfigSuite) TestRefStorage() {
+	input := []byte(`[core]
+	repositoryformatversion = 1
+[extensions]
+	refStorage = reftable
+`)
+
+	cfg := NewConfig()
+	s.NoError(cfg.Unmarshal(input))
+	s.Equal("reftable", cfg.Extensions.RefStorage)
+
+	output, err := cfg.Marshal()
+	s.NoError(err)
+	s.Regexp(`(?i)refstorage = reftable`, string(output))
+}
+
+func (s *ConfigSuite) TestSparseCheckout() {
+	input := []byte(`[core]
+	sparseCheckout = true
+`)
+
+	cfg := NewConfig()
+	s.NoError(cfg.Unmarshal(input))
+	s.True(cfg.Core.SparseCheckout)
+	s.True(cfg.Core.SparseCheckoutCone)
+
+	cfg.Core.SparseCheckoutCone = false
+	b, err := cfg.Marshal()
+	s.NoError(err)
+	s.Contains(string(b), "sparseCheckout = true")
+	s.Contains(string(b), "sparseCheckoutCone = false")
+
+	cfg.Core.SparseCheckout = false
+	b, err = cfg.Marshal()
+	s.NoError(err)
+	s.NotContains(string(b), "sparseCheckout")
+}
+
+func (s *ConfigSuite) TestIndexVersion() {
+	input := []byte(`[index]
+	version = 4
+[feature]
+	manyFiles = true
+`)
+
+	cfg := NewConfig()
+	s.NoError(cfg.Unmarshal(input))
+	s.Equal(uint(4), cfg.Index.Version)
+	s.True(cfg.Feature.ManyFiles)
+
+	b, err := cfg.Marshal()
+	s.NoError(err)
+	s.Contains(string(b), "version = 4")
+	s.Contains(string(b), "manyFiles = true")
+
+	s.Error(cfg.Unmarshal([]byte("[index]\n\tversion = foo\n")))
+}
+
 func (s *ConfigSuite) TestUnmarshalRemotesUnnamedFirst() {
 	input := []byte(`
 [remote ""]
@@ -534,26 +829,38 @@ func TestMerge(t *testing.T) {
 			name: "separate objs",
 			input: []*Config{
 				{User: struct {
-					Name  string
-					Email string
+					Name          string
+					Email         string
+					UseConfigOnly bool
 				}{
 					Name: "foo", Email: "bar@test",
 				}},
 				{
-					Extensions: struct{ ObjectFormat config.ObjectFormat }{
+					Extensions: struct {
+						ObjectFormat   config.ObjectFormat
+						PartialClone   string
+						RefStorage     string
+						WorktreeConfig bool
+					}{
 						ObjectFormat: config.SHA256,
 					},
 				},
 			},
 			want: Config{
 				User: struct {
-					Name  string
-					Email string
+					Name          string
+					Email         string
+					UseConfigOnly bool
 				}{
 					Name:  "foo",
 					Email: "bar@test",
 				},
-				Extensions: struct{ ObjectFormat config.ObjectFormat }{
+				Extensions: struct {
+					ObjectFormat   config.ObjectFormat
+					PartialClone   string
+					RefStorage     string
+					WorktreeConfig bool
+				}{
 					ObjectFormat: config.SHA256,
 				},
 			},
@@ -562,18 +869,21 @@ func TestMerge(t *testing.T) {
 			name: "merge nested fields",
 			input: []*Config{
 				{User: struct {
-					Name  string
-					Email string
+					Name          string
+					Email         string
+					UseConfigOnly bool
 				}{Name: "foo"}},
 				{User: struct {
-					Name  string
-					Email string
+					Name          string
+					Email         string
+					UseConfigOnly bool
 				}{Email: "bar@test"}},
 			},
 			want: Config{
 				User: struct {
-					Name  string
-					Email string
+					Name          string
+					Email         string
+					UseConfigOnly bool
 				}{
 					Name:  "foo",
 					Email: "bar@test",
@@ -584,18 +894,21 @@ func TestMerge(t *testing.T) {
 			name: "override nested fields",
 			input: []*Config{
 				{User: struct {
-					Name  string
-					Email string
+					Name          string
+					Email         string
+					UseConfigOnly bool
 				}{Name: "foo"}},
 				{User: struct {
-					Name  string
-					Email string
+					Name          string
+					Email         string
+					UseConfigOnly bool
 				}{Name: "bar", Email: "foo@test"}},
 			},
 			want: Config{
 				User: struct {
-					Name  string
-					Email string
+					Name          string
+					Email         string
+					UseConfigOnly bool
 				}{
 					Name:  "bar",
 					Email: "foo@test",
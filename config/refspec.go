@@ -132,11 +132,19 @@ func (s RefSpec) Dst(n plumbing.ReferenceName) plumbing.ReferenceName {
 	return plumbing.ReferenceName(dst[0:wd] + match + dst[wd+1:])
 }
 
+// Reverse returns the RefSpec mapping its destination to its source, and
+// forcing the update as this one does.
 func (s RefSpec) Reverse() RefSpec {
 	spec := string(s)
+	var force string
+	if s.IsForceUpdate() {
+		force = refSpecForce
+		spec = spec[1:]
+	}
+
 	separator := strings.Index(spec, refSpecSeparator)
 
-	return RefSpec(spec[separator+1:] + refSpecSeparator + spec[:separator])
+	return RefSpec(force + spec[separator+1:] + refSpecSeparator + spec[:separator])
 }
 
 func (s RefSpec) String() string {
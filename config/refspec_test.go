@@ -185,6 +185,9 @@ func (s *RefSpecSuite) TestRefSpecDstBlob() {
 func (s *RefSpecSuite) TestRefSpecReverse() {
 	spec := RefSpec("refs/heads/*:refs/remotes/origin/*")
 	s.Equal(RefSpec("refs/remotes/origin/*:refs/heads/*"), spec.Reverse())
+
+	spec = RefSpec("+refs/heads/*:refs/remotes/origin/*")
+	s.Equal(RefSpec("+refs/remotes/origin/*:refs/heads/*"), spec.Reverse())
 }
 
 func (s *RefSpecSuite) TestMatchAny() {
@@ -16,6 +16,11 @@ type URL struct {
 	// Any URL that starts with this value will be rewritten to start, instead, with <base>.
 	// When more than one insteadOf strings match a given URL, the longest match is used.
 	InsteadOfs []string
+	// Any URL that starts with this value will not be pushed to; instead, it will be
+	// rewritten to start with <base>, and the resulting URL will be pushed to. When
+	// more than one pushInsteadOf strings match a given URL, the longest match is used.
+	// It doesn't apply to the remotes with a pushurl.
+	PushInsteadOfs []string
 
 	// raw representation of the subsection, filled by marshal or unmarshal are
 	// called.
@@ -24,7 +29,7 @@ type URL struct {
 
 // Validate validates fields of branch
 func (b *URL) Validate() error {
-	if len(b.InsteadOfs) == 0 {
+	if len(b.InsteadOfs) == 0 && len(b.PushInsteadOfs) == 0 {
 		return errURLEmptyInsteadOf
 	}
 
@@ -32,7 +37,8 @@ func (b *URL) Validate() error {
 }
 
 const (
-	insteadOfKey = "insteadOf"
+	insteadOfKey     = "insteadOf"
+	pushInsteadOfKey = "pushInsteadOf"
 )
 
 func (u *URL) unmarshal(s *format.Subsection) error {
@@ -40,6 +46,7 @@ func (u *URL) unmarshal(s *format.Subsection) error {
 
 	u.Name = s.Name
 	u.InsteadOfs = u.raw.OptionAll(insteadOfKey)
+	u.PushInsteadOfs = u.raw.OptionAll(pushInsteadOfKey)
 	return nil
 }
 
@@ -50,26 +57,36 @@ func (u *URL) marshal() *format.Subsection {
 
 	u.raw.Name = u.Name
 	u.raw.SetOption(insteadOfKey, u.InsteadOfs...)
+	u.raw.SetOption(pushInsteadOfKey, u.PushInsteadOfs...)
 
 	return u.raw
 }
 
 func findLongestInsteadOfMatch(remoteURL string, urls map[string]*URL) *URL {
+	return findLongestMatch(remoteURL, urls, func(u *URL) []string { return u.InsteadOfs })
+}
+
+func findLongestPushInsteadOfMatch(remoteURL string, urls map[string]*URL) *URL {
+	return findLongestMatch(remoteURL, urls, func(u *URL) []string { return u.PushInsteadOfs })
+}
+
+func findLongestMatch(remoteURL string, urls map[string]*URL, prefixes func(*URL) []string) *URL {
 	var longestMatch *URL
 	var longestMatchLength int
 
 	for _, u := range urls {
-		for _, currentInsteadOf := range u.InsteadOfs {
-			if !strings.HasPrefix(remoteURL, currentInsteadOf) {
+		for _, prefix := range prefixes(u) {
+			if !strings.HasPrefix(remoteURL, prefix) {
 				continue
 			}
 
-			lengthCurrentInsteadOf := len(currentInsteadOf)
-
-			// according to spec if there is more than one match, take the longest
-			if longestMatch == nil || longestMatchLength < lengthCurrentInsteadOf {
+			// according to spec if there is more than one match, take the
+			// longest, the tie being broken by the name of the rule so that
+			// the result doesn't depend on the map order
+			if longestMatch == nil || longestMatchLength < len(prefix) ||
+				longestMatchLength == len(prefix) && u.Name < longestMatch.Name {
 				longestMatch = u
-				longestMatchLength = lengthCurrentInsteadOf
+				longestMatchLength = len(prefix)
 			}
 		}
 	}
@@ -77,12 +94,30 @@ func findLongestInsteadOfMatch(remoteURL string, urls map[string]*URL) *URL {
 	return longestMatch
 }
 
+// ApplyInsteadOf rewrites the given url with the longest of the InsteadOfs it
+// starts with, if any.
 func (u *URL) ApplyInsteadOf(url string) string {
-	for _, j := range u.InsteadOfs {
-		if strings.HasPrefix(url, j) {
-			return u.Name + url[len(j):]
+	return u.apply(url, u.InsteadOfs)
+}
+
+// ApplyPushInsteadOf rewrites the given url with the longest of the
+// PushInsteadOfs it starts with, if any.
+func (u *URL) ApplyPushInsteadOf(url string) string {
+	return u.apply(url, u.PushInsteadOfs)
+}
+
+func (u *URL) apply(url string, prefixes []string) string {
+	var longest string
+	var found bool
+	for _, prefix := range prefixes {
+		if strings.HasPrefix(url, prefix) && (!found || len(prefix) > len(longest)) {
+			longest, found = prefix, true
 		}
 	}
 
-	return url
+	if !found {
+		return url
+	}
+
+	return u.Name + url[len(longest):]
 }
@@ -141,3 +141,60 @@ func (b *URLSuite) TestFindLongestInsteadOfMatch() {
 
 	b.Equal("ssh://somethingelse.com", longestUrl.Name)
 }
+
+func (b *URLSuite) TestValidatePushInsteadOf() {
+	url := URL{
+		Name:           "ssh://github.com",
+		PushInsteadOfs: []string{"https://github.com"},
+	}
+	b.NoError(url.Validate())
+}
+
+func (b *URLSuite) TestUnmarshalPushInsteadOf() {
+	input := []byte(`[core]
+	bare = false
+	filemode = true
+[url "ssh://git@github.com/"]
+	pushInsteadOf = https://github.com/
+`)
+
+	cfg := NewConfig()
+	b.NoError(cfg.Unmarshal(input))
+	url := cfg.URLs["ssh://git@github.com/"]
+	b.Empty(url.InsteadOfs)
+	b.Equal([]string{"https://github.com/"}, url.PushInsteadOfs)
+	b.Equal("ssh://git@github.com/foobar", url.ApplyPushInsteadOf("https://github.com/foobar"))
+	b.Equal("https://github.com/foobar", url.ApplyInsteadOf("https://github.com/foobar"))
+
+	output, err := cfg.Marshal()
+	b.NoError(err)
+	b.Equal(string(input), string(output))
+}
+
+func (b *URLSuite) TestApplyInsteadOfLongest() {
+	urlRule := URL{
+		Name:       "ssh://github.com/",
+		InsteadOfs: []string{"https://github.com/", "https://github.com/org/"},
+	}
+
+	b.Equal("ssh://github.com/repo", urlRule.ApplyInsteadOf("https://github.com/org/repo"))
+	b.Equal("ssh://github.com/other/repo", urlRule.ApplyInsteadOf("https://github.com/other/repo"))
+}
+
+func (b *URLSuite) TestFindLongestPushInsteadOfMatch() {
+	urlRules := map[string]*URL{
+		"ssh://github.com/": {
+			Name:           "ssh://github.com/",
+			InsteadOfs:     []string{"https://github.com/foobar/"},
+			PushInsteadOfs: []string{"https://github.com/"},
+		},
+		"ssh://mirror.com/": {
+			Name:           "ssh://mirror.com/",
+			PushInsteadOfs: []string{"https://github.com/foo"},
+		},
+	}
+
+	b.Equal("ssh://mirror.com/", findLongestPushInsteadOfMatch("https://github.com/foobar/repo.git", urlRules).Name)
+	b.Equal("ssh://github.com/", findLongestPushInsteadOfMatch("https://github.com/other/repo.git", urlRules).Name)
+	b.Nil(findLongestPushInsteadOfMatch("https://gitlab.com/repo.git", urlRules))
+}
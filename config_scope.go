@@ -0,0 +1,193 @@
+package git
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/go-git/go-billy/v6"
+	"github.com/go-git/go-billy/v6/osfs"
+
+	"github.com/go-git/go-git/v6/config"
+	formatcfg "github.com/go-git/go-git/v6/plumbing/format/config"
+	"github.com/go-git/go-git/v6/plumbing/storer"
+	"github.com/go-git/go-git/v6/utils/ioutil"
+)
+
+// worktreeConfigPath is the path of the config file of the worktree in its
+// git directory.
+const worktreeConfigPath = "config.worktree"
+
+var (
+	// ErrWorktreeConfigDisabled is returned when the config of the worktree
+	// is read or written while extensions.worktreeConfig is not set.
+	ErrWorktreeConfigDisabled = errors.New("worktree config not enabled by extensions.worktreeConfig")
+	// ErrWorktreeConfigNotSupported is returned when the config of the
+	// worktree is read or written while the storer is not backed by a
+	// filesystem.
+	ErrWorktreeConfigNotSupported = errors.New("worktree config not supported by the storer")
+)
+
+// ConfigOfScope returns the config of the file of the given scope alone, as
+// `git config --local`, `--global`, `--system` or `--worktree` reads it, and
+// an empty config if the file does not exist. Its included files are not
+// read, so that it can be given to SetConfigScoped.
+//
+// ErrWorktreeConfigDisabled is returned for config.WorktreeScope if
+// extensions.worktreeConfig is not set.
+func (r *Repository) ConfigOfScope(scope config.Scope) (*config.Config, error) {
+	switch scope {
+	case config.LocalScope:
+		return r.Storer.Config()
+	case config.WorktreeScope:
+		local, err := r.Storer.Config()
+		if err != nil {
+			return nil, err
+		}
+
+		fs, err := r.worktreeConfigFilesystem(local)
+		if err != nil {
+			return nil, err
+		}
+
+		return readConfigFile(fs, worktreeConfigPath, nil)
+	case config.GlobalScope, config.SystemScope:
+		path, err := config.ScopePath(scope)
+		if err != nil {
+			return nil, err
+		}
+
+		return readConfigFile(osfs.Default, path, nil)
+	default:
+		return nil, fmt.Errorf("unknown config scope %d", scope)
+	}
+}
+
+// SetConfigScoped writes cfg to the file of the given scope alone, as
+// `git config --local`, `--global`, `--system` or `--worktree` does, creating
+// it if needed, such as ~/.gitconfig for config.GlobalScope. This function
+// should be called with the result of ConfigOfScope for the same scope, and
+// never with the output of ConfigScoped.
+//
+// ErrWorktreeConfigDisabled is returned for config.WorktreeScope if
+// extensions.worktreeConfig is not set.
+func (r *Repository) SetConfigScoped(scope config.Scope, cfg *config.Config) (err error) {
+	switch scope {
+	case config.LocalScope:
+		return r.Storer.SetConfig(cfg)
+	case config.GlobalScope, config.SystemScope:
+		return config.SaveConfig(scope, cfg)
+	case config.WorktreeScope:
+	default:
+		return fmt.Errorf("unknown config scope %d", scope)
+	}
+
+	local, err := r.Storer.Config()
+	if err != nil {
+		return err
+	}
+
+	fs, err := r.worktreeConfigFilesystem(local)
+	if err != nil {
+		return err
+	}
+
+	if err := cfg.Validate(); err != nil {
+		return err
+	}
+
+	b, err := cfg.MarshalScope(config.WorktreeScope)
+	if err != nil {
+		return err
+	}
+
+	f, err := fs.Create(worktreeConfigPath)
+	if err != nil {
+		return err
+	}
+
+	defer ioutil.CheckClose(f, &err)
+
+	_, err = f.Write(b)
+	return err
+}
+
+// ConfigOrigin returns the scope of the config file the effective value of
+// the given option comes from, the one of the highest precedence among the
+// worktree, local, global and system configs setting it, as
+// `git config --show-scope` prints it. The options of an included file are
+// given the scope of the file including it. The path of the global and
+// system config files is given by config.ScopePath.
+//
+// The subsection is empty for the options of the section itself. false is
+// returned if no config sets the option.
+func (r *Repository) ConfigOrigin(section, subsection, key string) (config.Scope, bool, error) {
+	cfgs, err := r.scopedConfigs(config.SystemScope)
+	if err != nil {
+		return 0, false, err
+	}
+
+	scopes := []config.Scope{config.SystemScope, config.GlobalScope, config.LocalScope, config.WorktreeScope}
+	for i := len(cfgs) - 1; i >= 0; i-- {
+		if hasConfigOption(cfgs[i].Raw, section, subsection, key) {
+			return scopes[i], true, nil
+		}
+	}
+
+	return 0, false, nil
+}
+
+func hasConfigOption(raw *formatcfg.Config, section, subsection, key string) bool {
+	if raw == nil || !raw.HasSection(section) {
+		return false
+	}
+
+	s := raw.Section(section)
+	if subsection == "" {
+		return s.HasOption(key)
+	}
+
+	return s.HasSubsection(subsection) && s.Subsection(subsection).HasOption(key)
+}
+
+// worktreeConfigFilesystem returns the filesystem holding the config file of
+// the worktree, the git directory of the worktree, if it is enabled by the
+// given local config.
+func (r *Repository) worktreeConfigFilesystem(local *config.Config) (billy.Filesystem, error) {
+	if !local.Extensions.WorktreeConfig {
+		return nil, ErrWorktreeConfigDisabled
+	}
+
+	fss, ok := r.Storer.(storer.FilesystemStorer)
+	if !ok {
+		return nil, ErrWorktreeConfigNotSupported
+	}
+
+	return fss.Filesystem(), nil
+}
+
+// readConfigFile reads the config file at the given path of fs, or returns an
+// empty config if it does not exist. The files it includes are read too if
+// opts is given with the git directory on the OS filesystem.
+func readConfigFile(fs billy.Basic, path string, opts *formatcfg.IncludeOptions) (cfg *config.Config, err error) {
+	f, err := fs.Open(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return config.NewConfig(), nil
+		}
+
+		return nil, err
+	}
+
+	defer ioutil.CheckClose(f, &err)
+
+	if opts == nil || opts.GitDir == "" {
+		return config.ReadConfig(f)
+	}
+
+	o := *opts
+	o.Filesystem = osfs.Default
+	o.Path = filepath.Join(opts.GitDir, path)
+	return config.ReadConfigWithIncludes(f, &o)
+}
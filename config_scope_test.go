@@ -0,0 +1,107 @@
+package git
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/go-git/go-git/v6/config"
+	formatcfg "github.com/go-git/go-git/v6/plumbing/format/config"
+	"github.com/go-git/go-git/v6/storage/memory"
+)
+
+func TestConfigOfScope(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	t.Setenv("XDG_CONFIG_HOME", "")
+
+	r, err := PlainInit(filepath.Join(home, "project"), false)
+	require.NoError(t, err)
+
+	global, err := r.ConfigOfScope(config.GlobalScope)
+	require.NoError(t, err)
+	global.User.Name = "Global"
+	global.User.Email = "global@foo.foo"
+	require.NoError(t, r.SetConfigScoped(config.GlobalScope, global))
+
+	b, err := os.ReadFile(filepath.Join(home, ".gitconfig"))
+	require.NoError(t, err)
+	assert.Equal(t, "[user]\n\tname = Global\n\temail = global@foo.foo\n", string(b))
+
+	// The local config is left untouched.
+	local, err := r.ConfigOfScope(config.LocalScope)
+	require.NoError(t, err)
+	assert.Equal(t, "", local.User.Name)
+
+	_, err = r.ConfigOfScope(config.WorktreeScope)
+	assert.ErrorIs(t, err, ErrWorktreeConfigDisabled)
+	assert.ErrorIs(t, r.SetConfigScoped(config.WorktreeScope, config.NewConfig()), ErrWorktreeConfigDisabled)
+
+	local.Core.RepositoryFormatVersion = formatcfg.Version_1
+	local.Extensions.WorktreeConfig = true
+	local.User.Name = "Local"
+	require.NoError(t, r.SetConfigScoped(config.LocalScope, local))
+
+	worktree, err := r.ConfigOfScope(config.WorktreeScope)
+	require.NoError(t, err)
+	worktree.User.Name = "Worktree"
+	require.NoError(t, r.SetConfigScoped(config.WorktreeScope, worktree))
+
+	b, err = os.ReadFile(filepath.Join(home, "project", GitDirName, "config.worktree"))
+	require.NoError(t, err)
+	assert.Equal(t, "[user]\n\tname = Worktree\n", string(b))
+
+	// The worktree config takes precedence over the other scopes.
+	cfg, err := r.ConfigScoped(config.SystemScope)
+	require.NoError(t, err)
+	assert.Equal(t, "Worktree", cfg.User.Name)
+	assert.Equal(t, "global@foo.foo", cfg.User.Email)
+
+	cfg, err = r.ConfigScoped(config.LocalScope)
+	require.NoError(t, err)
+	assert.Equal(t, "Worktree", cfg.User.Name)
+	assert.Equal(t, "", cfg.User.Email)
+
+	tests := []struct {
+		section, subsection, key string
+		want                     config.Scope
+		ok                       bool
+	}{
+		{"user", "", "name", config.WorktreeScope, true},
+		{"user", "", "email", config.GlobalScope, true},
+		{"core", "", "bare", config.LocalScope, true},
+		{"extensions", "", "worktreeConfig", config.LocalScope, true},
+		{"user", "", "signingkey", 0, false},
+		{"remote", "origin", "url", 0, false},
+	}
+
+	for _, tc := range tests {
+		scope, ok, err := r.ConfigOrigin(tc.section, tc.subsection, tc.key)
+		require.NoError(t, err)
+		assert.Equal(t, tc.ok, ok, tc.key)
+		assert.Equal(t, tc.want, scope, tc.key)
+	}
+}
+
+func TestConfigOfScopeWorktreeNotSupported(t *testing.T) {
+	t.Parallel()
+
+	r, err := Init(memory.NewStorage())
+	require.NoError(t, err)
+
+	cfg, err := r.Config()
+	require.NoError(t, err)
+	cfg.Core.RepositoryFormatVersion = formatcfg.Version_1
+	cfg.Extensions.WorktreeConfig = true
+	require.NoError(t, r.SetConfig(cfg))
+
+	_, err = r.ConfigOfScope(config.WorktreeScope)
+	assert.ErrorIs(t, err, ErrWorktreeConfigNotSupported)
+
+	// The worktree config is left out of the merged one.
+	_, err = r.ConfigScoped(config.LocalScope)
+	assert.NoError(t, err)
+}
@@ -0,0 +1,362 @@
+package git
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/emirpasic/gods/trees/binaryheap"
+
+	"github.com/go-git/go-git/v6/internal/pathspec"
+	"github.com/go-git/go-git/v6/plumbing"
+	"github.com/go-git/go-git/v6/plumbing/object"
+)
+
+const (
+	defaultDescribeAbbrev     = 7
+	defaultDescribeCandidates = 10
+	// maxDescribeCandidates is the max number of candidates, each one
+	// having a bit of the flags of the walked commits, the last one being
+	// the seen flag.
+	maxDescribeCandidates = 63
+	describeSeen          = uint64(1) << maxDescribeCandidates
+)
+
+// ErrNoDescription is returned by Describe when no tag describes the commit.
+var ErrNoDescription = errors.New("no tag can describe the commit")
+
+// DescribeOptions describes how a commit is described by Describe.
+type DescribeOptions struct {
+	// Tags describes the commit with the lightweight tags too, not only with
+	// the annotated ones, as `git describe --tags` does.
+	Tags bool
+	// Match, if not empty, are the patterns one of which the names of the
+	// tags must match, such as "v*", the "*" wildcard matching slashes.
+	Match []string
+	// Exclude are the patterns of the names of the tags not to describe the
+	// commit with.
+	Exclude []string
+	// Abbrev is the minimal number of hexadecimal digits of the abbreviated
+	// hashes, 7 if zero. The hashes are abbreviated with as many digits as
+	// needed to be unique. If negative, only the name of the tag is returned,
+	// as `git describe --abbrev=0` does.
+	Abbrev int
+	// Always describes the commit with its abbreviated hash, or its full
+	// hash if Abbrev is negative, if no tag describes it.
+	Always bool
+	// Candidates is the number of most recent tags considered, 10 if zero.
+	// The history is walked until as many tags are found.
+	Candidates int
+}
+
+// describeName is a tag describing a commit.
+type describeName struct {
+	name      string
+	annotated bool
+	when      time.Time
+}
+
+// describeCandidate is a tag reachable from the described commit, depth
+// commits being reachable from the described commit but not from the tag.
+type describeCandidate struct {
+	name  describeName
+	depth int
+	flag  uint64
+}
+
+// Describe returns the most recent tag reachable from the given commit, as
+// `git describe` does: the name of the tag if it points to the commit, or the
+// name of the tag followed by the number of commits on top of it and the
+// abbreviated hash of the commit, such as v1.0.0-3-g6ecf0ef. The annotated
+// tags are preferred to the lightweight ones, and the most recent one is
+// used between the tags of a commit. ErrNoDescription is returned if no tag
+// describes the commit, unless opts.Always is set.
+func (r *Repository) Describe(commit plumbing.Hash, opts *DescribeOptions) (string, error) {
+	if opts == nil {
+		opts = &DescribeOptions{}
+	}
+
+	obj, err := r.Object(plumbing.AnyObject, commit)
+	if err != nil {
+		return "", err
+	}
+
+	c, err := object.PeelToCommit(obj)
+	if err != nil {
+		return "", err
+	}
+
+	names, err := r.describeNames(opts)
+	if err != nil {
+		return "", err
+	}
+
+	if n, ok := names[c.Hash]; ok {
+		return n.name, nil
+	}
+
+	best, err := r.describeCandidate(c, names, opts)
+	if err != nil {
+		return "", err
+	}
+
+	if best == nil {
+		if !opts.Always {
+			return "", ErrNoDescription
+		}
+
+		if opts.Abbrev < 0 {
+			return c.Hash.String(), nil
+		}
+
+		return r.abbrevHash(c.Hash, opts.Abbrev), nil
+	}
+
+	if opts.Abbrev < 0 {
+		return best.name.name, nil
+	}
+
+	return fmt.Sprintf("%s-%d-g%s", best.name.name, best.depth, r.abbrevHash(c.Hash, opts.Abbrev)), nil
+}
+
+// describeNames returns the tags describing the commits, by commit hash,
+// being annotated unless opts.Tags is set, and matching the patterns of opts.
+// The annotated tags are preferred to the lightweight ones, and the most
+// recent annotated tag between the ones of a commit.
+func (r *Repository) describeNames(opts *DescribeOptions) (map[plumbing.Hash]describeName, error) {
+	names := make(map[plumbing.Hash]describeName)
+	err := r.ForEachTag(func(ref *plumbing.Reference, tag *object.Tag) error {
+		name := ref.Name().Short()
+		if tag == nil && !opts.Tags || !describeMatches(name, opts) {
+			return nil
+		}
+
+		var obj object.Object
+		var err error
+		n := describeName{name: name}
+		if tag != nil {
+			n.annotated, n.when, obj = true, tag.Tagger.When, tag
+		} else if obj, err = r.Object(plumbing.AnyObject, ref.Hash()); err != nil {
+			return err
+		}
+
+		commit, err := object.PeelToCommit(obj)
+		if err != nil {
+			// The tags of other objects than commits describe nothing.
+			return nil
+		}
+
+		if existing, ok := names[commit.Hash]; ok && !existing.replacedBy(n) {
+			return nil
+		}
+
+		names[commit.Hash] = n
+		return nil
+	})
+
+	return names, err
+}
+
+// replacedBy returns whether n describes the commit of the tag rather than
+// it, being annotated while it is not, more recent if both are annotated, or
+// first by name otherwise.
+func (t describeName) replacedBy(n describeName) bool {
+	switch {
+	case t.annotated != n.annotated:
+		return n.annotated
+	case t.annotated && !t.when.Equal(n.when):
+		return n.when.After(t.when)
+	default:
+		return n.name < t.name
+	}
+}
+
+func describeMatches(name string, opts *DescribeOptions) bool {
+	for _, p := range opts.Exclude {
+		if pathspec.Wildmatch(p, name) {
+			return false
+		}
+	}
+
+	if len(opts.Match) == 0 {
+		return true
+	}
+
+	for _, p := range opts.Match {
+		if pathspec.Wildmatch(p, name) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// describeCandidate walks the history of c, the most recent commits first,
+// until finding as many tags as opts.Candidates, and returns the tag with
+// the fewest commits on top of it, the first one found between the ones at
+// the same depth. It returns nil if no tag is reachable from c.
+func (r *Repository) describeCandidate(c *object.Commit, names map[plumbing.Hash]describeName, opts *DescribeOptions) (*describeCandidate, error) {
+	limit := opts.Candidates
+	if limit <= 0 {
+		limit = defaultDescribeCandidates
+	}
+
+	limit = min(limit, maxDescribeCandidates)
+
+	q := newDescribeQueue()
+	flags := map[plumbing.Hash]uint64{c.Hash: describeSeen}
+	q.push(c)
+
+	var candidates []*describeCandidate
+	annotated, seen := 0, 0
+	for q.Len() > 0 {
+		cur := q.pop()
+		seen++
+		if n, ok := names[cur.Hash]; ok {
+			if len(candidates) == limit {
+				// The commit is walked again to compute the depth of
+				// the best candidate.
+				q.push(cur)
+				break
+			}
+
+			t := &describeCandidate{name: n, depth: seen - 1, flag: 1 << len(candidates)}
+			flags[cur.Hash] |= t.flag
+			candidates = append(candidates, t)
+			if n.annotated {
+				annotated++
+			}
+		}
+
+		for _, t := range candidates {
+			if flags[cur.Hash]&t.flag == 0 {
+				t.depth++
+			}
+		}
+
+		// The last remaining path is covered by the candidates.
+		if annotated > 0 && q.Len() == 0 {
+			break
+		}
+
+		if err := r.describePushParents(q, flags, cur); err != nil {
+			return nil, err
+		}
+	}
+
+	if len(candidates) == 0 {
+		return nil, nil
+	}
+
+	best := candidates[0]
+	for _, t := range candidates[1:] {
+		if t.depth < best.depth {
+			best = t
+		}
+	}
+
+	// The commits left are counted in the depth of the best candidate,
+	// until they are all reachable from it.
+	for q.Len() > 0 {
+		cur := q.pop()
+		if flags[cur.Hash]&best.flag != 0 {
+			if q.all(func(c *object.Commit) bool { return flags[c.Hash]&best.flag != 0 }) {
+				break
+			}
+		} else {
+			best.depth++
+		}
+
+		if err := r.describePushParents(q, flags, cur); err != nil {
+			return nil, err
+		}
+	}
+
+	return best, nil
+}
+
+// describePushParents pushes the parents of c not walked yet to q, and
+// propagates the flags of c to its parents.
+func (r *Repository) describePushParents(q *describeQueue, flags map[plumbing.Hash]uint64, c *object.Commit) error {
+	for _, h := range c.ParentHashes {
+		if flags[h]&describeSeen == 0 {
+			p, err := r.CommitObject(h)
+			if err != nil {
+				return err
+			}
+
+			q.push(p)
+		}
+
+		flags[h] |= flags[c.Hash]
+	}
+
+	return nil
+}
+
+// abbrevHash returns the shortest unique prefix of h, of at least the given
+// number of hexadecimal digits, or 7 if zero.
+func (r *Repository) abbrevHash(h plumbing.Hash, digits int) string {
+	if digits <= 0 {
+		digits = defaultDescribeAbbrev
+	}
+
+	hex := h.String()
+	for n := digits; n < len(hex); n++ {
+		if len(r.resolveHashPrefix(hex[:n])) <= 1 {
+			return hex[:n]
+		}
+	}
+
+	return hex
+}
+
+// describeQueue is a queue of commits, the most recent commits first, and
+// the first pushed between the ones committed at the same time.
+type describeQueue struct {
+	*binaryheap.Heap
+	pushed int
+}
+
+type describeQueueItem struct {
+	commit *object.Commit
+	order  int
+}
+
+func newDescribeQueue() *describeQueue {
+	return &describeQueue{Heap: binaryheap.NewWith(func(a, b any) int {
+		x, y := a.(describeQueueItem), b.(describeQueueItem)
+		switch {
+		case x.commit.Committer.When.After(y.commit.Committer.When):
+			return -1
+		case x.commit.Committer.When.Before(y.commit.Committer.When):
+			return 1
+		default:
+			return x.order - y.order
+		}
+	})}
+}
+
+func (q *describeQueue) Len() int {
+	return q.Size()
+}
+
+func (q *describeQueue) push(c *object.Commit) {
+	q.Push(describeQueueItem{commit: c, order: q.pushed})
+	q.pushed++
+}
+
+func (q *describeQueue) pop() *object.Commit {
+	v, _ := q.Pop()
+	return v.(describeQueueItem).commit
+}
+
+func (q *describeQueue) all(fn func(*object.Commit) bool) bool {
+	for _, v := range q.Values() {
+		if !fn(v.(describeQueueItem).commit) {
+			return false
+		}
+	}
+
+	return true
+}
@@ -0,0 +1,166 @@
+package git
+
+import (
+	"os/exec"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-git/go-billy/v6/memfs"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/go-git/go-git/v6/plumbing"
+	"github.com/go-git/go-git/v6/plumbing/object"
+	"github.com/go-git/go-git/v6/storage/memory"
+)
+
+// newDescribeRepository returns a repository whose history is:
+//
+//	o c5
+//	o   merge
+//	|\
+//	| o s2
+//	| o s1 (side-old, side-new)
+//	o | c4
+//	o | c3 (light)
+//	|/
+//	o c2
+//	o c1 (v1)
+//
+// All the tags are annotated but light, and side-new is more recent than
+// side-old.
+func newDescribeRepository(t *testing.T, r *Repository) map[string]plumbing.Hash {
+	t.Helper()
+
+	w, err := r.Worktree()
+	require.NoError(t, err)
+
+	day := 0
+	sig := func() *object.Signature {
+		day++
+		return &object.Signature{Name: "foo", Email: "foo@foo.foo", When: time.Date(2020, 1, day, 0, 0, 0, 0, time.UTC)}
+	}
+
+	commits := make(map[string]plumbing.Hash)
+	commit := func(msg string, parents ...string) {
+		opts := &CommitOptions{Author: sig(), AllowEmptyCommits: true}
+		for _, p := range parents {
+			opts.Parents = append(opts.Parents, commits[p])
+		}
+
+		h, err := w.Commit(msg, opts)
+		require.NoError(t, err)
+		commits[msg] = h
+	}
+
+	tag := func(name, commit string, annotated bool) {
+		var opts *CreateTagOptions
+		if annotated {
+			opts = &CreateTagOptions{Tagger: sig(), Message: name}
+		}
+
+		_, err := r.CreateTag(name, commits[commit], opts)
+		require.NoError(t, err)
+	}
+
+	commit("c1")
+	tag("v1", "c1", true)
+	commit("c2")
+	commit("s1")
+	tag("side-old", "s1", true)
+	tag("side-new", "s1", true)
+	commit("s2")
+	commit("c3", "c2")
+	tag("light", "c3", false)
+	commit("c4")
+	commit("merge", "c4", "s2")
+	commit("c5")
+
+	return commits
+}
+
+func TestDescribe(t *testing.T) {
+	t.Parallel()
+
+	r, err := Init(memory.NewStorage(), WithWorkTree(memfs.New()))
+	require.NoError(t, err)
+	commits := newDescribeRepository(t, r)
+	head := commits["c5"].String()[:7]
+
+	for _, tc := range []struct {
+		commit   string
+		opts     *DescribeOptions
+		expected string
+	}{
+		{"c5", nil, "side-new-5-g" + head},
+		// light and side-new are at the same depth, light being found first.
+		{"c5", &DescribeOptions{Tags: true}, "light-5-g" + head},
+		{"c5", &DescribeOptions{Match: []string{"v*"}}, "v1-7-g" + head},
+		{"c5", &DescribeOptions{Exclude: []string{"side-*"}}, "v1-7-g" + head},
+		{"c5", &DescribeOptions{Abbrev: -1}, "side-new"},
+		{"c5", &DescribeOptions{Tags: true, Abbrev: 10}, "light-5-g" + commits["c5"].String()[:10]},
+		{"c5", &DescribeOptions{Candidates: 1}, "side-new-5-g" + head},
+		{"s2", nil, "side-new-1-g" + commits["s2"].String()[:7]},
+		{"c3", nil, "v1-2-g" + commits["c3"].String()[:7]},
+		{"c3", &DescribeOptions{Tags: true}, "light"},
+		{"c1", nil, "v1"},
+	} {
+		desc, err := r.Describe(commits[tc.commit], tc.opts)
+		require.NoError(t, err)
+		assert.Equal(t, tc.expected, desc, "%s %+v", tc.commit, tc.opts)
+	}
+
+	_, err = r.Describe(commits["c5"], &DescribeOptions{Match: []string{"v2*"}})
+	assert.ErrorIs(t, err, ErrNoDescription)
+	desc, err := r.Describe(commits["c5"], &DescribeOptions{Match: []string{"v2*"}, Always: true})
+	require.NoError(t, err)
+	assert.Equal(t, head, desc)
+}
+
+func TestDescribeGit(t *testing.T) {
+	t.Parallel()
+
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git is not available")
+	}
+
+	dir := t.TempDir()
+	r, err := PlainInit(dir, false)
+	require.NoError(t, err)
+	newDescribeRepository(t, r)
+
+	for _, args := range [][]string{
+		{}, {"--tags"}, {"--match=v*"}, {"--exclude=side-*"}, {"--abbrev=0"},
+		{"--tags", "--abbrev=10"}, {"--candidates=1"}, {"--tags", "--candidates=1"},
+	} {
+		cmd := exec.Command("git", append([]string{"describe"}, args...)...)
+		cmd.Dir = dir
+		out, err := cmd.CombinedOutput()
+		require.NoError(t, err, string(out))
+
+		opts := &DescribeOptions{}
+		for _, arg := range args {
+			switch {
+			case arg == "--tags":
+				opts.Tags = true
+			case strings.HasPrefix(arg, "--match="):
+				opts.Match = append(opts.Match, strings.TrimPrefix(arg, "--match="))
+			case strings.HasPrefix(arg, "--exclude="):
+				opts.Exclude = append(opts.Exclude, strings.TrimPrefix(arg, "--exclude="))
+			case arg == "--abbrev=0":
+				opts.Abbrev = -1
+			case arg == "--abbrev=10":
+				opts.Abbrev = 10
+			case arg == "--candidates=1":
+				opts.Candidates = 1
+			}
+		}
+
+		head, err := r.Head()
+		require.NoError(t, err)
+		desc, err := r.Describe(head.Hash(), opts)
+		require.NoError(t, err)
+		assert.Equal(t, strings.TrimSpace(string(out)), desc, args)
+	}
+}
@@ -0,0 +1,48 @@
+package git
+
+import (
+	"io"
+	"sync"
+)
+
+// FilterDriver converts the content of the files whose filter attribute, set
+// in the .gitattributes files, is the name the driver is registered with, as
+// the filter drivers of git.
+type FilterDriver interface {
+	// Clean converts the content of a worktree file into the content stored
+	// in the repository, when the file is added.
+	Clean(r io.Reader) io.Reader
+	// Smudge converts the content stored in the repository into the content
+	// of the worktree file, when the file is checked out.
+	Smudge(r io.Reader) io.Reader
+}
+
+// NewFilterDriverFunc returns the filter driver used in the worktree of the
+// given repository.
+type NewFilterDriverFunc func(r *Repository) (FilterDriver, error)
+
+var (
+	filterDrivers = map[string]NewFilterDriverFunc{
+		"lfs": func(r *Repository) (FilterDriver, error) {
+			return NewLFSFilterDriver(r, nil)
+		},
+	}
+	filterDriversMu sync.RWMutex
+)
+
+// RegisterFilterDriver adds or replaces the filter driver with the given
+// name, used for the files with the filter=<name> attribute. The Git LFS
+// filter driver is registered as "lfs" by default.
+func RegisterFilterDriver(name string, f NewFilterDriverFunc) {
+	filterDriversMu.Lock()
+	filterDrivers[name] = f
+	filterDriversMu.Unlock()
+}
+
+// UnregisterFilterDriver removes the filter driver with the given name, the
+// files with the filter=<name> attribute being no longer converted.
+func UnregisterFilterDriver(name string) {
+	filterDriversMu.Lock()
+	delete(filterDrivers, name)
+	filterDriversMu.Unlock()
+}
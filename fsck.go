@@ -0,0 +1,871 @@
+package git
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/go-git/go-git/v6/config"
+	"github.com/go-git/go-git/v6/plumbing"
+	"github.com/go-git/go-git/v6/plumbing/filemode"
+	formatcfg "github.com/go-git/go-git/v6/plumbing/format/config"
+	"github.com/go-git/go-git/v6/plumbing/storer"
+	"github.com/go-git/go-git/v6/storage"
+)
+
+// FsckSeverity is the severity of an issue found by Fsck.
+type FsckSeverity int
+
+const (
+	// FsckError is the severity of the issues making the repository
+	// corrupted, such as missing objects.
+	FsckError FsckSeverity = iota
+	// FsckWarning is the severity of the issues git tolerates, such as
+	// unusual file modes in trees.
+	FsckWarning
+	// FsckInfo is the severity of the issues that are only informative,
+	// such as dangling objects.
+	FsckInfo
+	// FsckIgnore is the severity of the issues left out of the report.
+	FsckIgnore
+)
+
+func (s FsckSeverity) String() string {
+	switch s {
+	case FsckError:
+		return "error"
+	case FsckWarning:
+		return "warning"
+	case FsckInfo:
+		return "info"
+	case FsckIgnore:
+		return "ignore"
+	default:
+		return fmt.Sprintf("FsckSeverity(%d)", int(s))
+	}
+}
+
+// parseFsckSeverity parses the value of a fsck.<msg-id> config option.
+func parseFsckSeverity(value string) (FsckSeverity, bool) {
+	switch strings.ToLower(value) {
+	case "error":
+		return FsckError, true
+	case "warn":
+		return FsckWarning, true
+	case "info":
+		return FsckInfo, true
+	case "ignore":
+		return FsckIgnore, true
+	default:
+		return 0, false
+	}
+}
+
+// FsckMessageID identifies the kind of an issue found by Fsck. The ids of the
+// issues reported by git fsck are the same as git's message ids.
+type FsckMessageID string
+
+const (
+	FsckBadDate                 FsckMessageID = "badDate"
+	FsckBadDateOverflow         FsckMessageID = "badDateOverflow"
+	FsckBadEmail                FsckMessageID = "badEmail"
+	FsckBadFilemode             FsckMessageID = "badFilemode"
+	FsckBadName                 FsckMessageID = "badName"
+	FsckBadObjectSha1           FsckMessageID = "badObjectSha1"
+	FsckBadParentSha1           FsckMessageID = "badParentSha1"
+	FsckBadRefName              FsckMessageID = "badRefName"
+	FsckBadRefTarget            FsckMessageID = "badRefTarget"
+	FsckBadTagName              FsckMessageID = "badTagName"
+	FsckBadTimezone             FsckMessageID = "badTimezone"
+	FsckBadTree                 FsckMessageID = "badTree"
+	FsckBadTreeSha1             FsckMessageID = "badTreeSha1"
+	FsckBadType                 FsckMessageID = "badType"
+	FsckBrokenLink              FsckMessageID = "brokenLink"
+	FsckDangling                FsckMessageID = "dangling"
+	FsckDanglingSymref          FsckMessageID = "danglingSymref"
+	FsckDuplicateEntries        FsckMessageID = "duplicateEntries"
+	FsckEmptyName               FsckMessageID = "emptyName"
+	FsckFullPathname            FsckMessageID = "fullPathname"
+	FsckHasDot                  FsckMessageID = "hasDot"
+	FsckHasDotdot               FsckMessageID = "hasDotdot"
+	FsckHasDotgit               FsckMessageID = "hasDotgit"
+	FsckHashMismatch            FsckMessageID = "hashMismatch"
+	FsckMissingAuthor           FsckMessageID = "missingAuthor"
+	FsckMissingCommitter        FsckMessageID = "missingCommitter"
+	FsckMissingEmail            FsckMessageID = "missingEmail"
+	FsckMissingNameBeforeEmail  FsckMessageID = "missingNameBeforeEmail"
+	FsckMissingObject           FsckMessageID = "missingObject"
+	FsckMissingSpaceBeforeDate  FsckMessageID = "missingSpaceBeforeDate"
+	FsckMissingSpaceBeforeEmail FsckMessageID = "missingSpaceBeforeEmail"
+	FsckMissingTagEntry         FsckMessageID = "missingTagEntry"
+	FsckMissingTaggerEntry      FsckMessageID = "missingTaggerEntry"
+	FsckMissingTree             FsckMessageID = "missingTree"
+	FsckMissingTypeEntry        FsckMessageID = "missingTypeEntry"
+	FsckMultipleAuthors         FsckMessageID = "multipleAuthors"
+	FsckNulInCommit             FsckMessageID = "nulInCommit"
+	FsckNulInHeader             FsckMessageID = "nulInHeader"
+	FsckNullSha1                FsckMessageID = "nullSha1"
+	FsckTreeNotSorted           FsckMessageID = "treeNotSorted"
+	FsckUnterminatedHeader      FsckMessageID = "unterminatedHeader"
+	FsckZeroPaddedDate          FsckMessageID = "zeroPaddedDate"
+	FsckZeroPaddedFilemode      FsckMessageID = "zeroPaddedFilemode"
+)
+
+// fsckSeverities are the default severities of the issues, the ones of git
+// for its message ids. The issues missing from it are errors.
+var fsckSeverities = map[FsckMessageID]FsckSeverity{
+	FsckBadFilemode:        FsckWarning,
+	FsckBadTagName:         FsckInfo,
+	FsckDangling:           FsckInfo,
+	FsckDanglingSymref:     FsckWarning,
+	FsckEmptyName:          FsckWarning,
+	FsckFullPathname:       FsckWarning,
+	FsckHasDot:             FsckWarning,
+	FsckHasDotdot:          FsckWarning,
+	FsckHasDotgit:          FsckWarning,
+	FsckMissingTaggerEntry: FsckInfo,
+	FsckNulInCommit:        FsckWarning,
+	FsckNullSha1:           FsckWarning,
+	FsckZeroPaddedFilemode: FsckWarning,
+}
+
+// FsckIssue is an issue found by Fsck, in an object or a reference.
+type FsckIssue struct {
+	// ID identifies the kind of the issue.
+	ID FsckMessageID
+	// Severity is the severity of the issue, after applying the
+	// FsckOptions.Severities and the fsck.<msg-id> config options.
+	Severity FsckSeverity
+	// Object is the object the issue was found in, zero for the issues of
+	// references.
+	Object plumbing.Hash
+	// Type is the type of Object.
+	Type plumbing.ObjectType
+	// Reference is the reference the issue was found in, empty for the
+	// issues of objects.
+	Reference plumbing.ReferenceName
+	// Message describes the issue.
+	Message string
+}
+
+// String returns the issue formatted as git fsck does, such as
+// "error in tree <hash>: hasDot: contains '.'".
+func (i FsckIssue) String() string {
+	if i.Reference != "" {
+		return fmt.Sprintf("%s: %s: %s: %s", i.Severity, i.Reference, i.ID, i.Message)
+	}
+
+	return fmt.Sprintf("%s in %s %s: %s: %s", i.Severity, i.Type, i.Object, i.ID, i.Message)
+}
+
+// FsckReport is the result of Fsck.
+type FsckReport struct {
+	// Objects is the number of objects checked.
+	Objects int
+	// Issues are the issues found, of any severity but FsckIgnore.
+	Issues []FsckIssue
+}
+
+// Errors returns the issues of the report with the FsckError severity.
+func (r *FsckReport) Errors() []FsckIssue {
+	var errs []FsckIssue
+	for _, i := range r.Issues {
+		if i.Severity == FsckError {
+			errs = append(errs, i)
+		}
+	}
+
+	return errs
+}
+
+// HasErrors returns whether an issue of the report has the FsckError
+// severity, git fsck failing for them.
+func (r *FsckReport) HasErrors() bool {
+	return len(r.Errors()) != 0
+}
+
+// fsckLink is a link from an object to another one.
+type fsckLink struct {
+	hash plumbing.Hash
+	typ  plumbing.ObjectType
+}
+
+// fsck holds the state of a run of Repository.Fsck.
+type fsck struct {
+	r *Repository
+	// s is the storer of the repository, whose objects are read as they
+	// are stored, whatever the replace references.
+	s          storage.Storer
+	opts       *FsckOptions
+	severities map[FsckMessageID]FsckSeverity
+	report     *FsckReport
+
+	// order are the objects in the order they were read.
+	order []plumbing.Hash
+	types map[plumbing.Hash]plumbing.ObjectType
+	links map[plumbing.Hash][]fsckLink
+}
+
+// Fsck checks the integrity of the repository, as git fsck does:
+//
+//   - the objects are well formed: their hash matches their content, the
+//     headers of the commits and tags are valid and the entries of the trees
+//     sorted, with valid names and modes.
+//   - the objects they link to exist, with the expected type, except the
+//     parents of the shallow commits and, in a partial clone, the objects
+//     still to be fetched from the promisor remote.
+//   - the references point to existing objects, and have valid names.
+//   - the dangling objects, not reachable from the references, their reflogs
+//     or the index, and not linked to by any other object, are reported with
+//     the FsckInfo severity.
+//
+// The issues found are returned in the report, with the severity of git, that
+// can be changed with the fsck.<msg-id> config options and
+// FsckOptions.Severities. An error is only returned if the repository can't
+// be read.
+func (r *Repository) Fsck(opts *FsckOptions) (*FsckReport, error) {
+	if opts == nil {
+		opts = &FsckOptions{}
+	}
+
+	f := &fsck{
+		r:      r,
+		s:      storage.NoReplaceObjects(r.Storer),
+		opts:   opts,
+		report: &FsckReport{},
+		types:  make(map[plumbing.Hash]plumbing.ObjectType),
+		links:  make(map[plumbing.Hash][]fsckLink),
+	}
+
+	if err := f.loadSeverities(); err != nil {
+		return nil, err
+	}
+
+	if err := f.checkObjects(); err != nil {
+		return nil, err
+	}
+
+	if err := f.checkLinks(); err != nil {
+		return nil, err
+	}
+
+	roots, err := f.checkReferences()
+	if err != nil {
+		return nil, err
+	}
+
+	if !opts.NoDangling {
+		f.checkDangling(roots)
+	}
+
+	return f.report, nil
+}
+
+// loadSeverities sets the severities of the issues from the defaults, the
+// fsck.<msg-id> config options and the options, in this order.
+func (f *fsck) loadSeverities() error {
+	// The message ids are case insensitive, as the config keys.
+	f.severities = make(map[FsckMessageID]FsckSeverity, len(fsckSeverities))
+	for id, s := range fsckSeverities {
+		f.severities[fsckKey(id)] = s
+	}
+
+	cfgs, err := f.r.scopedConfigs(config.SystemScope)
+	if err != nil {
+		return err
+	}
+
+	for _, cfg := range cfgs {
+		if cfg == nil || cfg.Raw == nil {
+			continue
+		}
+
+		for _, o := range cfg.Raw.Section("fsck").Options {
+			if s, ok := parseFsckSeverity(o.Value); ok {
+				f.severities[fsckKey(FsckMessageID(o.Key))] = s
+			}
+		}
+	}
+
+	for id, s := range f.opts.Severities {
+		f.severities[fsckKey(id)] = s
+	}
+
+	return nil
+}
+
+func fsckKey(id FsckMessageID) FsckMessageID {
+	return FsckMessageID(strings.ToLower(string(id)))
+}
+
+func (f *fsck) severity(id FsckMessageID) FsckSeverity {
+	if s, ok := f.severities[fsckKey(id)]; ok {
+		return s
+	}
+
+	return FsckError
+}
+
+// objectIssue reports an issue of the given object, unless it is ignored.
+func (f *fsck) objectIssue(h plumbing.Hash, t plumbing.ObjectType, id FsckMessageID, format string, args ...any) {
+	s := f.severity(id)
+	if s == FsckIgnore {
+		return
+	}
+
+	f.report.Issues = append(f.report.Issues, FsckIssue{
+		ID:       id,
+		Severity: s,
+		Object:   h,
+		Type:     t,
+		Message:  fmt.Sprintf(format, args...),
+	})
+}
+
+// refIssue reports an issue of the given reference, unless it is ignored.
+func (f *fsck) refIssue(name plumbing.ReferenceName, id FsckMessageID, format string, args ...any) {
+	s := f.severity(id)
+	if s == FsckIgnore {
+		return
+	}
+
+	f.report.Issues = append(f.report.Issues, FsckIssue{
+		ID:        id,
+		Severity:  s,
+		Reference: name,
+		Message:   fmt.Sprintf(format, args...),
+	})
+}
+
+// checkObjects reads and checks the format of every object of the
+// repository, recording the links between them.
+func (f *fsck) checkObjects() error {
+	iter, err := f.s.IterEncodedObjects(plumbing.AnyObject)
+	if err != nil {
+		return err
+	}
+
+	return iter.ForEach(func(obj plumbing.EncodedObject) error {
+		h := obj.Hash()
+		if _, ok := f.types[h]; ok {
+			return nil
+		}
+
+		data, err := readEncodedObject(obj)
+		if err != nil {
+			return fmt.Errorf("reading object %s: %w", h, err)
+		}
+
+		f.order = append(f.order, h)
+		f.types[h] = obj.Type()
+		f.report.Objects++
+
+		hf := formatcfg.SHA1
+		if h.Size() == formatcfg.SHA256Size {
+			hf = formatcfg.SHA256
+		}
+
+		hasher := plumbing.NewHasher(hf, obj.Type(), int64(len(data)))
+		hasher.Write(data)
+		if sum := hasher.Sum(); sum != h {
+			f.objectIssue(h, obj.Type(), FsckHashMismatch, "hash mismatch, the content hashes to %s", sum)
+		}
+
+		switch obj.Type() {
+		case plumbing.CommitObject:
+			f.checkCommit(h, data)
+		case plumbing.TreeObject:
+			f.checkTree(h, data)
+		case plumbing.TagObject:
+			f.checkTag(h, data)
+		}
+
+		return nil
+	})
+}
+
+func readEncodedObject(obj plumbing.EncodedObject) (data []byte, err error) {
+	r, err := obj.Reader()
+	if err != nil {
+		return nil, err
+	}
+
+	defer func() {
+		if cerr := r.Close(); err == nil {
+			err = cerr
+		}
+	}()
+
+	return io.ReadAll(r)
+}
+
+// fsckHeaders returns the header lines of a commit or a tag, and its message,
+// reporting the issues of the headers.
+func (f *fsck) fsckHeaders(h plumbing.Hash, t plumbing.ObjectType, data []byte) (headers []string, msg []byte, ok bool) {
+	end := bytes.Index(data, []byte("\n\n"))
+	if end < 0 {
+		if len(data) == 0 || data[len(data)-1] != '\n' {
+			f.objectIssue(h, t, FsckUnterminatedHeader, "unterminated header")
+			return nil, nil, false
+		}
+
+		end = len(data) - 1
+	} else {
+		msg = data[end+2:]
+	}
+
+	header := data[:end]
+	if i := bytes.IndexByte(header, 0); i >= 0 {
+		f.objectIssue(h, t, FsckNulInHeader, "unterminated header: NUL at offset %d", i)
+		return nil, nil, false
+	}
+
+	return strings.Split(string(header), "\n"), msg, true
+}
+
+// fsckHash parses the hash of a header, of the same format as the one of the
+// object it was read from.
+func fsckHash(value string, of plumbing.Hash) (plumbing.Hash, bool) {
+	if len(value) != of.HexSize() {
+		return plumbing.ZeroHash, false
+	}
+
+	h, ok := plumbing.FromHex(value)
+	return h, ok
+}
+
+// checkCommit checks the headers of a commit, as fsck_commit of git does.
+func (f *fsck) checkCommit(h plumbing.Hash, data []byte) {
+	t := plumbing.CommitObject
+	headers, msg, ok := f.fsckHeaders(h, t, data)
+	if !ok {
+		return
+	}
+
+	if bytes.IndexByte(msg, 0) >= 0 {
+		f.objectIssue(h, t, FsckNulInCommit, "NUL byte in the commit object body")
+	}
+
+	value, ok := strings.CutPrefix(headers[0], "tree ")
+	if !ok {
+		f.objectIssue(h, t, FsckMissingTree, "invalid format - expected 'tree' line")
+		return
+	}
+
+	tree, ok := fsckHash(value, h)
+	if !ok {
+		f.objectIssue(h, t, FsckBadTreeSha1, "invalid 'tree' line format - bad sha1")
+		return
+	}
+
+	f.links[h] = append(f.links[h], fsckLink{tree, plumbing.TreeObject})
+
+	i := 1
+	for ; i < len(headers); i++ {
+		value, ok := strings.CutPrefix(headers[i], "parent ")
+		if !ok {
+			break
+		}
+
+		parent, ok := fsckHash(value, h)
+		if !ok {
+			f.objectIssue(h, t, FsckBadParentSha1, "invalid 'parent' line format - bad sha1")
+			return
+		}
+
+		f.links[h] = append(f.links[h], fsckLink{parent, plumbing.CommitObject})
+	}
+
+	authors := 0
+	for ; i < len(headers); i++ {
+		value, ok := strings.CutPrefix(headers[i], "author ")
+		if !ok {
+			break
+		}
+
+		authors++
+		if !f.checkIdent(h, t, value) {
+			return
+		}
+	}
+
+	switch {
+	case authors == 0:
+		f.objectIssue(h, t, FsckMissingAuthor, "invalid format - expected 'author' line")
+		return
+	case authors > 1:
+		f.objectIssue(h, t, FsckMultipleAuthors, "invalid format - multiple 'author' lines")
+	}
+
+	if i == len(headers) || !strings.HasPrefix(headers[i], "committer ") {
+		f.objectIssue(h, t, FsckMissingCommitter, "invalid format - expected 'committer' line")
+		return
+	}
+
+	f.checkIdent(h, t, strings.TrimPrefix(headers[i], "committer "))
+}
+
+// checkTag checks the headers of a tag, as fsck_tag of git does.
+func (f *fsck) checkTag(h plumbing.Hash, data []byte) {
+	t := plumbing.TagObject
+	headers, _, ok := f.fsckHeaders(h, t, data)
+	if !ok {
+		return
+	}
+
+	value, ok := strings.CutPrefix(headers[0], "object ")
+	if !ok {
+		f.objectIssue(h, t, FsckMissingObject, "invalid format - expected 'object' line")
+		return
+	}
+
+	target, ok := fsckHash(value, h)
+	if !ok {
+		f.objectIssue(h, t, FsckBadObjectSha1, "invalid 'object' line format - bad sha1")
+		return
+	}
+
+	if len(headers) < 2 || !strings.HasPrefix(headers[1], "type ") {
+		f.objectIssue(h, t, FsckMissingTypeEntry, "invalid format - expected 'type' line")
+		return
+	}
+
+	typ, err := plumbing.ParseObjectType(strings.TrimPrefix(headers[1], "type "))
+	if err != nil || typ.IsDelta() {
+		f.objectIssue(h, t, FsckBadType, "invalid 'type' value")
+		return
+	}
+
+	f.links[h] = append(f.links[h], fsckLink{target, typ})
+
+	if len(headers) < 3 || !strings.HasPrefix(headers[2], "tag ") {
+		f.objectIssue(h, t, FsckMissingTagEntry, "invalid format - expected 'tag' line")
+		return
+	}
+
+	name := strings.TrimPrefix(headers[2], "tag ")
+	if err := plumbing.NewTagReferenceName(name).Validate(); err != nil {
+		f.objectIssue(h, t, FsckBadTagName, "invalid 'tag' name: %s", name)
+	}
+
+	if len(headers) < 4 || !strings.HasPrefix(headers[3], "tagger ") {
+		// The tags of early versions of git have no tagger.
+		f.objectIssue(h, t, FsckMissingTaggerEntry, "invalid format - expected 'tagger' line")
+		return
+	}
+
+	f.checkIdent(h, t, strings.TrimPrefix(headers[3], "tagger "))
+}
+
+// checkIdent checks an identity of a commit or a tag, "name <email> date tz",
+// as fsck_ident of git does. It returns false if an issue was found.
+func (f *fsck) checkIdent(h plumbing.Hash, t plumbing.ObjectType, ident string) bool {
+	issue := func(id FsckMessageID, msg string) bool {
+		f.objectIssue(h, t, id, "invalid author/committer line - %s", msg)
+		return false
+	}
+
+	if strings.HasPrefix(ident, "<") {
+		return issue(FsckMissingNameBeforeEmail, "missing name before email")
+	}
+
+	i := strings.IndexAny(ident, "<>")
+	switch {
+	case i < 0:
+		return issue(FsckMissingEmail, "missing email")
+	case ident[i] == '>':
+		return issue(FsckBadName, "bad name")
+	case ident[i-1] != ' ':
+		return issue(FsckMissingSpaceBeforeEmail, "missing space before email")
+	}
+
+	rest := ident[i+1:]
+	i = strings.IndexAny(rest, "<>")
+	if i < 0 || rest[i] != '>' {
+		return issue(FsckBadEmail, "bad email")
+	}
+
+	rest = rest[i+1:]
+	if !strings.HasPrefix(rest, " ") {
+		return issue(FsckMissingSpaceBeforeDate, "missing space before date")
+	}
+
+	date, tz, ok := strings.Cut(rest[1:], " ")
+	if strings.HasPrefix(date, "0") && len(date) > 1 {
+		return issue(FsckZeroPaddedDate, "zero-padded date")
+	}
+
+	if date == "" || !ok || strings.Trim(date, "0123456789") != "" {
+		return issue(FsckBadDate, "bad date")
+	}
+
+	if _, err := strconv.ParseInt(date, 10, 64); err != nil {
+		return issue(FsckBadDateOverflow, "date causes integer overflow")
+	}
+
+	if len(tz) != 5 || (tz[0] != '+' && tz[0] != '-') || strings.Trim(tz[1:], "0123456789") != "" {
+		return issue(FsckBadTimezone, "bad time zone")
+	}
+
+	return true
+}
+
+// checkTree checks the entries of a tree, as fsck_tree of git does.
+func (f *fsck) checkTree(h plumbing.Hash, data []byte) {
+	t := plumbing.TreeObject
+	// The entry issues are reported once for every tree, as git does.
+	found := make(map[FsckMessageID]bool)
+	issue := func(id FsckMessageID, msg string) {
+		if !found[id] {
+			found[id] = true
+			f.objectIssue(h, t, id, "%s", msg)
+		}
+	}
+
+	var prevName string
+	var prevMode filemode.FileMode
+	for first := true; len(data) > 0; first = false {
+		sp := bytes.IndexByte(data, ' ')
+		nul := bytes.IndexByte(data, 0)
+		if sp <= 0 || nul < sp || len(data) < nul+1+h.Size() {
+			issue(FsckBadTree, "cannot be parsed as a tree")
+			return
+		}
+
+		rawMode := string(data[:sp])
+		name := string(data[sp+1 : nul])
+		entry, _ := plumbing.FromBytes(data[nul+1 : nul+1+h.Size()])
+		data = data[nul+1+h.Size():]
+
+		m, err := strconv.ParseUint(rawMode, 8, 32)
+		if err != nil {
+			issue(FsckBadTree, "cannot be parsed as a tree")
+			return
+		}
+
+		mode := filemode.FileMode(m)
+		if rawMode[0] == '0' {
+			issue(FsckZeroPaddedFilemode, "contains zero-padded file modes")
+		}
+
+		switch mode {
+		case filemode.Regular, filemode.Executable, filemode.Symlink,
+			filemode.Dir, filemode.Submodule:
+		case filemode.Deprecated:
+			// Modes 100664 are written by early versions of git.
+		default:
+			issue(FsckBadFilemode, "contains bad file modes")
+		}
+
+		switch {
+		case name == "":
+			issue(FsckEmptyName, "contains empty pathname")
+		case strings.Contains(name, "/"):
+			issue(FsckFullPathname, "contains full pathnames")
+		case name == ".":
+			issue(FsckHasDot, "contains '.'")
+		case name == "..":
+			issue(FsckHasDotdot, "contains '..'")
+		case strings.EqualFold(name, ".git"):
+			issue(FsckHasDotgit, "contains '.git'")
+		}
+
+		if entry.IsZero() {
+			issue(FsckNullSha1, "contains entries pointing to null sha1")
+		}
+
+		if !first {
+			switch {
+			case name == prevName:
+				issue(FsckDuplicateEntries, "contains duplicate file entries")
+			case fsckTreeNameCompare(prevName, prevMode, name, mode) > 0:
+				issue(FsckTreeNotSorted, "not properly sorted")
+			}
+		}
+
+		prevName, prevMode = name, mode
+
+		switch mode {
+		case filemode.Submodule:
+			// The commits of the submodules are in their own repositories.
+		case filemode.Dir:
+			f.links[h] = append(f.links[h], fsckLink{entry, plumbing.TreeObject})
+		default:
+			f.links[h] = append(f.links[h], fsckLink{entry, plumbing.BlobObject})
+		}
+	}
+}
+
+// fsckTreeNameCompare compares the names of two tree entries in the order of
+// the trees, the ones of the directories ending with a slash.
+func fsckTreeNameCompare(a string, am filemode.FileMode, b string, bm filemode.FileMode) int {
+	if am == filemode.Dir {
+		a += "/"
+	}
+
+	if bm == filemode.Dir {
+		b += "/"
+	}
+
+	return strings.Compare(a, b)
+}
+
+// checkLinks checks that the objects linked to by the objects exist, with
+// the expected type.
+func (f *fsck) checkLinks() error {
+	shallow, err := f.s.Shallow()
+	if err != nil {
+		return err
+	}
+
+	shallows := make(map[plumbing.Hash]bool, len(shallow))
+	for _, h := range shallow {
+		shallows[h] = true
+	}
+
+	for _, h := range f.order {
+		for _, l := range f.links[h] {
+			if l.typ == plumbing.CommitObject && f.types[h] == plumbing.CommitObject && shallows[h] {
+				continue
+			}
+
+			typ, ok := f.types[l.hash]
+			if !ok {
+				// The object may be in an alternate object directory. It is
+				// looked up first, so that it isn't fetched in partial clones.
+				if f.s.HasEncodedObject(l.hash) == nil {
+					obj, err := f.s.EncodedObject(plumbing.AnyObject, l.hash)
+					if err != nil {
+						return err
+					}
+
+					typ, ok = obj.Type(), true
+				}
+			}
+
+			switch {
+			case !ok && f.r.promisor != nil:
+				// The object is to be fetched from the promisor remote.
+			case !ok:
+				f.objectIssue(h, f.types[h], FsckBrokenLink, "broken link to %s %s, missing", l.typ, l.hash)
+			case typ != l.typ:
+				f.objectIssue(h, f.types[h], FsckBrokenLink, "broken link to %s %s, which is a %s", l.typ, l.hash, typ)
+			}
+		}
+	}
+
+	return nil
+}
+
+// checkReferences checks that the references have valid names and point to
+// existing objects. It returns the objects they, their reflogs and the index
+// point to, the roots of the reachable objects.
+func (f *fsck) checkReferences() ([]plumbing.Hash, error) {
+	iter, err := f.s.IterReferences()
+	if err != nil {
+		return nil, err
+	}
+
+	var roots []plumbing.Hash
+	var names []plumbing.ReferenceName
+	err = iter.ForEach(func(ref *plumbing.Reference) error {
+		name := ref.Name()
+		names = append(names, name)
+		if name != plumbing.HEAD {
+			if err := name.Validate(); err != nil {
+				f.refIssue(name, FsckBadRefName, "invalid reference name")
+			}
+		}
+
+		switch ref.Type() {
+		case plumbing.SymbolicReference:
+			_, err := storer.ResolveReference(f.s, ref.Target())
+			switch {
+			case errors.Is(err, plumbing.ErrReferenceNotFound) && name == plumbing.HEAD:
+				// HEAD points to an unborn branch, such as in a new
+				// repository.
+			case errors.Is(err, plumbing.ErrReferenceNotFound):
+				f.refIssue(name, FsckDanglingSymref, "dangling symbolic reference to %s", ref.Target())
+			case err != nil:
+				return err
+			}
+		case plumbing.HashReference:
+			if err := f.s.HasEncodedObject(ref.Hash()); err != nil {
+				f.refIssue(name, FsckBadRefTarget, "invalid sha1 pointer %s", ref.Hash())
+				return nil
+			}
+
+			roots = append(roots, ref.Hash())
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if !f.opts.NoReflogs {
+		for _, name := range append(names, plumbing.HEAD) {
+			entries, err := f.r.Reflog(name)
+			if err != nil {
+				return nil, err
+			}
+
+			for _, e := range entries {
+				roots = append(roots, e.Old, e.New)
+			}
+		}
+	}
+
+	idx, err := f.s.Index()
+	if err == nil {
+		for _, e := range idx.Entries {
+			if e.Mode != filemode.Submodule {
+				roots = append(roots, e.Hash)
+			}
+		}
+	}
+
+	return roots, nil
+}
+
+// checkDangling reports the objects not reachable from the given roots, that
+// no other object links to.
+func (f *fsck) checkDangling(roots []plumbing.Hash) {
+	reachable := make(map[plumbing.Hash]bool, len(f.types))
+	for len(roots) > 0 {
+		h := roots[len(roots)-1]
+		roots = roots[:len(roots)-1]
+		if reachable[h] {
+			continue
+		}
+
+		reachable[h] = true
+		for _, l := range f.links[h] {
+			roots = append(roots, l.hash)
+		}
+	}
+
+	linked := make(map[plumbing.Hash]bool, len(f.types))
+	for _, links := range f.links {
+		for _, l := range links {
+			linked[l.hash] = true
+		}
+	}
+
+	var dangling []plumbing.Hash
+	for _, h := range f.order {
+		if !reachable[h] && !linked[h] {
+			dangling = append(dangling, h)
+		}
+	}
+
+	sort.Sort(plumbing.HashSlice(dangling))
+	for _, h := range dangling {
+		f.objectIssue(h, f.types[h], FsckDangling, "dangling %s %s", f.types[h], h)
+	}
+}
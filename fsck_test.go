@@ -0,0 +1,376 @@
+package git
+
+import (
+	"bytes"
+	"encoding/hex"
+	"testing"
+
+	fixtures "github.com/go-git/go-git-fixtures/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/go-git/go-git/v6/plumbing"
+	"github.com/go-git/go-git/v6/plumbing/cache"
+	"github.com/go-git/go-git/v6/storage/filesystem"
+	"github.com/go-git/go-git/v6/storage/memory"
+)
+
+const fsckIdent = "A U Thor <author@example.com> 1700000000 +0100"
+
+func writeFsckObject(t *testing.T, r *Repository, typ plumbing.ObjectType, content string) plumbing.Hash {
+	obj := r.Storer.NewEncodedObject()
+	obj.SetType(typ)
+	w, err := obj.Writer()
+	require.NoError(t, err)
+	_, err = w.Write([]byte(content))
+	require.NoError(t, err)
+	require.NoError(t, w.Close())
+
+	h, err := r.Storer.SetEncodedObject(obj)
+	require.NoError(t, err)
+	return h
+}
+
+// fsckTree returns the raw content of a tree with the given entries, each of
+// them a mode, a name and a hash.
+func fsckTree(entries ...string) string {
+	var buf bytes.Buffer
+	for i := 0; i+2 < len(entries); i += 3 {
+		h, _ := hex.DecodeString(entries[i+2])
+		buf.WriteString(entries[i] + " " + entries[i+1] + "\x00")
+		buf.Write(h)
+	}
+
+	return buf.String()
+}
+
+func fsckIssues(report *FsckReport) map[FsckMessageID]FsckSeverity {
+	ids := make(map[FsckMessageID]FsckSeverity)
+	for _, i := range report.Issues {
+		ids[i.ID] = i.Severity
+	}
+
+	return ids
+}
+
+func TestFsckFixture(t *testing.T) {
+	t.Parallel()
+
+	for _, f := range fixtures.Basic().ByTag(".git") {
+		st := filesystem.NewStorage(f.DotGit(fixtures.WithTargetDir(t.TempDir)), cache.NewObjectLRUDefault())
+		r, err := Open(st, nil)
+		require.NoError(t, err)
+
+		report, err := r.Fsck(nil)
+		require.NoError(t, err)
+		assert.False(t, report.HasErrors(), "%s: %v", f.URL, report.Errors())
+		assert.NotZero(t, report.Objects)
+	}
+}
+
+func TestFsckBrokenLinks(t *testing.T) {
+	t.Parallel()
+
+	r, err := Init(memory.NewStorage())
+	require.NoError(t, err)
+
+	blob := writeFsckObject(t, r, plumbing.BlobObject, "hello\n")
+	missing := "0123456789012345678901234567890123456789"
+	tree := writeFsckObject(t, r, plumbing.TreeObject, fsckTree(
+		"100644", "a", blob.String(),
+		"40000", "b", missing,
+		"160000", "sub", missing,
+	))
+	commit := writeFsckObject(t, r, plumbing.CommitObject,
+		"tree "+tree.String()+"\nparent "+blob.String()+"\nauthor "+fsckIdent+"\ncommitter "+fsckIdent+"\n\nmsg\n")
+	require.NoError(t, r.Storer.SetReference(plumbing.NewHashReference(plumbing.Master, commit)))
+	require.NoError(t, r.Storer.SetReference(plumbing.NewHashReference("refs/heads/missing", plumbing.NewHash(missing))))
+	require.NoError(t, r.Storer.SetReference(plumbing.NewSymbolicReference("refs/heads/sym", "refs/heads/none")))
+
+	report, err := r.Fsck(nil)
+	require.NoError(t, err)
+	assert.Equal(t, 3, report.Objects)
+	assert.ElementsMatch(t, []FsckIssue{{
+		ID:       FsckBrokenLink,
+		Severity: FsckError,
+		Object:   tree,
+		Type:     plumbing.TreeObject,
+		Message:  "broken link to tree " + missing + ", missing",
+	}, {
+		ID:       FsckBrokenLink,
+		Severity: FsckError,
+		Object:   commit,
+		Type:     plumbing.CommitObject,
+		Message:  "broken link to commit " + blob.String() + ", which is a blob",
+	}, {
+		ID:        FsckBadRefTarget,
+		Severity:  FsckError,
+		Reference: "refs/heads/missing",
+		Message:   "invalid sha1 pointer " + missing,
+	}, {
+		ID:        FsckDanglingSymref,
+		Severity:  FsckWarning,
+		Reference: "refs/heads/sym",
+		Message:   "dangling symbolic reference to refs/heads/none",
+	}}, report.Issues)
+	assert.True(t, report.HasErrors())
+	assert.Equal(t, "error: refs/heads/missing: badRefTarget: invalid sha1 pointer "+missing, report.Errors()[2].String())
+}
+
+func TestFsckFormat(t *testing.T) {
+	t.Parallel()
+
+	blob := "ce013625030ba8dba906f756967f9e9ca394464a"
+	tree := "4b825dc642cb6eb9a060e54bf8d69288fbee4904"
+	commit := func(headers string) (plumbing.ObjectType, string) {
+		return plumbing.CommitObject, headers + "\nmsg\n"
+	}
+	tag := func(headers string) (plumbing.ObjectType, string) {
+		return plumbing.TagObject, headers + "\nmsg\n"
+	}
+	treeOf := func(entries ...string) (plumbing.ObjectType, string) {
+		return plumbing.TreeObject, fsckTree(entries...)
+	}
+
+	for _, tc := range []struct {
+		name    string
+		typ     plumbing.ObjectType
+		content string
+		id      FsckMessageID
+	}{
+		{"missing tree", plumbing.CommitObject, "author " + fsckIdent + "\n\n", FsckMissingTree},
+		{"unterminated header", plumbing.CommitObject, "tree " + tree, FsckUnterminatedHeader},
+		{"nul in header", plumbing.CommitObject, "tree " + tree + "\x00\n\n", FsckNulInHeader},
+		{"nul in commit", plumbing.CommitObject, "tree " + tree + "\nauthor " + fsckIdent + "\ncommitter " + fsckIdent + "\n\nm\x00sg", FsckNulInCommit},
+		{"bad tree sha1", plumbing.CommitObject, "tree 1234\n\n", FsckBadTreeSha1},
+		{"bad parent sha1", plumbing.CommitObject, "tree " + tree + "\nparent xyz\n\n", FsckBadParentSha1},
+		{"missing author", plumbing.CommitObject, "tree " + tree + "\ncommitter " + fsckIdent + "\n\n", FsckMissingAuthor},
+		{"multiple authors", plumbing.CommitObject, "tree " + tree + "\nauthor " + fsckIdent + "\nauthor " + fsckIdent + "\ncommitter " + fsckIdent + "\n\n", FsckMultipleAuthors},
+		{"missing committer", plumbing.CommitObject, "tree " + tree + "\nauthor " + fsckIdent + "\n\n", FsckMissingCommitter},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+			checkFsckFormat(t, tc.typ, tc.content, tc.id)
+		})
+	}
+
+	for _, tc := range []struct {
+		name  string
+		ident string
+		id    FsckMessageID
+	}{
+		{"missing name", "<a@b> 1 +0000", FsckMissingNameBeforeEmail},
+		{"missing email", "A U Thor 1 +0000", FsckMissingEmail},
+		{"bad name", "A > <a@b> 1 +0000", FsckBadName},
+		{"missing space before email", "A<a@b> 1 +0000", FsckMissingSpaceBeforeEmail},
+		{"bad email", "A <a<b> 1 +0000", FsckBadEmail},
+		{"missing space before date", "A <a@b>1 +0000", FsckMissingSpaceBeforeDate},
+		{"zero padded date", "A <a@b> 01 +0000", FsckZeroPaddedDate},
+		{"bad date", "A <a@b> x +0000", FsckBadDate},
+		{"bad date overflow", "A <a@b> 99999999999999999999 +0000", FsckBadDateOverflow},
+		{"bad timezone", "A <a@b> 1 0000", FsckBadTimezone},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+			typ, content := commit("tree " + tree + "\nauthor " + tc.ident + "\ncommitter " + fsckIdent + "\n")
+			checkFsckFormat(t, typ, content, tc.id)
+		})
+	}
+
+	for _, tc := range []struct {
+		name    string
+		headers string
+		id      FsckMessageID
+	}{
+		{"missing object", "type blob\ntag v1\n", FsckMissingObject},
+		{"bad object sha1", "object 12\ntype blob\ntag v1\n", FsckBadObjectSha1},
+		{"missing type entry", "object " + blob + "\ntag v1\n", FsckMissingTypeEntry},
+		{"bad type", "object " + blob + "\ntype ofs-delta\ntag v1\n", FsckBadType},
+		{"missing tag entry", "object " + blob + "\ntype blob\n", FsckMissingTagEntry},
+		{"bad tag name", "object " + blob + "\ntype blob\ntag v1..2\ntagger " + fsckIdent + "\n", FsckBadTagName},
+		{"missing tagger entry", "object " + blob + "\ntype blob\ntag v1\n", FsckMissingTaggerEntry},
+		{"bad tagger", "object " + blob + "\ntype blob\ntag v1\ntagger A <a@b> 1\n", FsckBadDate},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+			typ, content := tag(tc.headers)
+			checkFsckFormat(t, typ, content, tc.id)
+		})
+	}
+
+	for _, tc := range []struct {
+		name    string
+		entries []string
+		id      FsckMessageID
+	}{
+		{"zero padded filemode", []string{"040000", "a", tree}, FsckZeroPaddedFilemode},
+		{"bad filemode", []string{"100600", "a", blob}, FsckBadFilemode},
+		{"empty name", []string{"100644", "", blob}, FsckEmptyName},
+		{"full pathname", []string{"100644", "a/b", blob}, FsckFullPathname},
+		{"has dot", []string{"40000", ".", tree}, FsckHasDot},
+		{"has dotdot", []string{"40000", "..", tree}, FsckHasDotdot},
+		{"has dotgit", []string{"40000", ".GIT", tree}, FsckHasDotgit},
+		{"null sha1", []string{"160000", "sub", plumbing.ZeroHash.String()}, FsckNullSha1},
+		{"duplicate entries", []string{"100644", "a", blob, "40000", "a", tree}, FsckDuplicateEntries},
+		{"not sorted", []string{"100644", "b", blob, "100644", "a", blob}, FsckTreeNotSorted},
+		{"directory not sorted", []string{"40000", "a", tree, "100644", "a.c", blob}, FsckTreeNotSorted},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+			typ, content := treeOf(tc.entries...)
+			checkFsckFormat(t, typ, content, tc.id)
+		})
+	}
+
+	t.Run("bad tree", func(t *testing.T) {
+		t.Parallel()
+		checkFsckFormat(t, plumbing.TreeObject, "100644 a\x00\x01\x02", FsckBadTree)
+	})
+}
+
+// checkFsckFormat checks that the issue of an object with the given content
+// is found.
+func checkFsckFormat(t *testing.T, typ plumbing.ObjectType, content string, id FsckMessageID) {
+	r, err := Init(memory.NewStorage())
+	require.NoError(t, err)
+
+	writeFsckObject(t, r, plumbing.BlobObject, "hello\n")
+	writeFsckObject(t, r, plumbing.TreeObject, "")
+	h := writeFsckObject(t, r, typ, content)
+
+	report, err := r.Fsck(&FsckOptions{NoDangling: true})
+	require.NoError(t, err)
+	require.Len(t, report.Issues, 1, "%v", report.Issues)
+	assert.Equal(t, id, report.Issues[0].ID)
+	assert.Equal(t, h, report.Issues[0].Object)
+	assert.Equal(t, typ, report.Issues[0].Type)
+	assert.Equal(t, fsckSeverities[id], report.Issues[0].Severity)
+}
+
+// wrongHashObject is an object stored under another hash than the one of its
+// content.
+type wrongHashObject struct {
+	plumbing.EncodedObject
+	hash plumbing.Hash
+}
+
+func (o *wrongHashObject) Hash() plumbing.Hash { return o.hash }
+
+func TestFsckHashMismatch(t *testing.T) {
+	t.Parallel()
+
+	st := memory.NewStorage()
+	r, err := Init(st)
+	require.NoError(t, err)
+
+	blob := writeFsckObject(t, r, plumbing.BlobObject, "hello\n")
+	obj, err := st.EncodedObject(plumbing.BlobObject, blob)
+	require.NoError(t, err)
+	wrong := plumbing.NewHash("0123456789012345678901234567890123456789")
+	_, err = st.SetEncodedObject(&wrongHashObject{obj, wrong})
+	require.NoError(t, err)
+
+	report, err := r.Fsck(&FsckOptions{NoDangling: true})
+	require.NoError(t, err)
+	require.Len(t, report.Issues, 1)
+	assert.Equal(t, FsckHashMismatch, report.Issues[0].ID)
+	assert.Equal(t, wrong, report.Issues[0].Object)
+	assert.Equal(t, "hash mismatch, the content hashes to "+blob.String(), report.Issues[0].Message)
+}
+
+func TestFsckDangling(t *testing.T) {
+	t.Parallel()
+
+	st := filesystem.NewStorage(fixtures.Basic().One().DotGit(fixtures.WithTargetDir(t.TempDir)), cache.NewObjectLRUDefault())
+	r, err := Open(st, nil)
+	require.NoError(t, err)
+
+	report, err := r.Fsck(nil)
+	require.NoError(t, err)
+	assert.Empty(t, report.Issues)
+
+	blob := writeFsckObject(t, r, plumbing.BlobObject, "dangling\n")
+	tree := writeFsckObject(t, r, plumbing.TreeObject, fsckTree("100644", "a", blob.String()))
+	unreachable := writeFsckObject(t, r, plumbing.BlobObject, "unreachable\n")
+	writeFsckObject(t, r, plumbing.TreeObject, fsckTree("100644", "b", unreachable.String()))
+	require.NoError(t, st.SetReference(plumbing.NewHashReference("refs/heads/tree", tree)))
+
+	report, err = r.Fsck(nil)
+	require.NoError(t, err)
+	require.Len(t, report.Issues, 1)
+	assert.Equal(t, FsckDangling, report.Issues[0].ID)
+	assert.Equal(t, FsckInfo, report.Issues[0].Severity)
+	assert.Equal(t, plumbing.TreeObject, report.Issues[0].Type)
+	assert.False(t, report.HasErrors())
+
+	// A commit undone by a reset stays reachable from the reflogs.
+	head, err := r.Head()
+	require.NoError(t, err)
+	commit, err := r.CommitObject(head.Hash())
+	require.NoError(t, err)
+	undone := writeFsckObject(t, r, plumbing.CommitObject,
+		"tree "+commit.TreeHash.String()+"\nparent "+head.Hash().String()+"\nauthor "+fsckIdent+"\ncommitter "+fsckIdent+"\n\nundone\n")
+	require.NoError(t, r.setReferenceWithLog(plumbing.NewHashReference(plumbing.Master, undone), nil, "commit: undone"))
+	require.NoError(t, r.setReferenceWithLog(head, nil, "reset: moving to HEAD~1"))
+
+	report, err = r.Fsck(&FsckOptions{Severities: map[FsckMessageID]FsckSeverity{FsckDangling: FsckIgnore}})
+	require.NoError(t, err)
+	assert.Empty(t, report.Issues)
+	report, err = r.Fsck(nil)
+	require.NoError(t, err)
+	assert.Len(t, report.Issues, 1)
+
+	report, err = r.Fsck(&FsckOptions{NoReflogs: true})
+	require.NoError(t, err)
+	assert.Equal(t, []FsckIssue{report.Issues[0], {
+		ID:       FsckDangling,
+		Severity: FsckInfo,
+		Object:   undone,
+		Type:     plumbing.CommitObject,
+		Message:  "dangling commit " + undone.String(),
+	}}, report.Issues)
+
+	report, err = r.Fsck(&FsckOptions{NoDangling: true, NoReflogs: true})
+	require.NoError(t, err)
+	assert.Empty(t, report.Issues)
+}
+
+func TestFsckSeverities(t *testing.T) {
+	t.Parallel()
+
+	r, err := Init(memory.NewStorage())
+	require.NoError(t, err)
+
+	blob := writeFsckObject(t, r, plumbing.BlobObject, "hello\n")
+	writeFsckObject(t, r, plumbing.TreeObject, fsckTree(
+		"100644", ".", blob.String(),
+		"100644", "..", blob.String(),
+		"100644", "a/b", blob.String(),
+	))
+
+	report, err := r.Fsck(&FsckOptions{NoDangling: true})
+	require.NoError(t, err)
+	assert.Equal(t, map[FsckMessageID]FsckSeverity{
+		FsckHasDot:       FsckWarning,
+		FsckHasDotdot:    FsckWarning,
+		FsckFullPathname: FsckWarning,
+	}, fsckIssues(report))
+	assert.False(t, report.HasErrors())
+
+	cfg, err := r.Config()
+	require.NoError(t, err)
+	cfg.Raw.Section("fsck").SetOption("hasdot", "error")
+	cfg.Raw.Section("fsck").SetOption("hasDotdot", "ignore")
+	require.NoError(t, r.SetConfig(cfg))
+
+	report, err = r.Fsck(&FsckOptions{
+		NoDangling: true,
+		Severities: map[FsckMessageID]FsckSeverity{FsckFullPathname: FsckInfo},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, map[FsckMessageID]FsckSeverity{
+		FsckHasDot:       FsckError,
+		FsckFullPathname: FsckInfo,
+	}, fsckIssues(report))
+	assert.True(t, report.HasErrors())
+}
@@ -0,0 +1,552 @@
+package git
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"time"
+
+	"github.com/go-git/go-billy/v6"
+
+	"github.com/go-git/go-git/v6/config"
+	"github.com/go-git/go-git/v6/internal/revision"
+	"github.com/go-git/go-git/v6/plumbing"
+	"github.com/go-git/go-git/v6/plumbing/filemode"
+	"github.com/go-git/go-git/v6/plumbing/format/reflog"
+	"github.com/go-git/go-git/v6/plumbing/storer"
+	"github.com/go-git/go-git/v6/storage"
+)
+
+// ErrGCInProgress is returned by GC when another GC of the repository is in
+// progress.
+var ErrGCInProgress = errors.New("gc already in progress")
+
+const (
+	gcSection = "gc"
+	// gcPidFile is the lock file of the GCs of a repository, holding the pid
+	// and the hostname of the process running them, as for git gc.
+	gcPidFile = "gc.pid"
+	// gcPidExpire is the age after which the lock file of a GC is considered
+	// left over by a GC that died.
+	gcPidExpire = 12 * time.Hour
+
+	defaultPruneExpire             = "2.weeks.ago"
+	defaultReflogExpire            = "90.days.ago"
+	defaultReflogExpireUnreachable = "30.days.ago"
+)
+
+// GCReport describes what was done by GC, or would be done for a dry run.
+type GCReport struct {
+	// Pack is the pack the reachable objects were written to, zero if they
+	// weren't repacked, for a dry run or if they already were in a single
+	// pack.
+	Pack plumbing.Hash
+	// PackedObjects is the number of objects written to Pack.
+	PackedObjects int
+	// RemovedPacks are the packs removed, their objects being in Pack or
+	// pruned.
+	RemovedPacks []plumbing.Hash
+	// PrunedObjects are the unreachable objects removed.
+	PrunedObjects []plumbing.Hash
+	// ExpiredReflogEntries are the number of entries expired by reflog.
+	ExpiredReflogEntries map[plumbing.ReferenceName]int
+}
+
+// gcExpiry are the expiry dates of a GC, zero if they never expire.
+type gcExpiry struct {
+	prune, reflog, reflogUnreachable time.Time
+}
+
+// GC cleans up the repository, as git gc does: the references are packed,
+// the old entries of the reflogs expired, the objects reachable from the
+// references, the reflogs and the index repacked in a single pack, along
+// with the loose ones and the ones of the other packs, and the unreachable
+// objects older than PruneExpire pruned.
+//
+// GC is safe to run while the repository is being written to, such as by a
+// push: the unreachable objects newer than PruneExpire are kept, as the ones
+// of the packs written after GC started, and the objects reachable from the
+// references after the repack are never pruned. Running it twice in a row is
+// a no-op the second time. ErrGCInProgress is returned if another GC is
+// already running, and ErrPackedObjectsNotSupported if the storer can't
+// repack its objects.
+func (r *Repository) GC(opts *GCOptions) (*GCReport, error) {
+	if opts == nil {
+		opts = &GCOptions{}
+	}
+
+	pos, ok := r.Storer.(storer.PackedObjectStorer)
+	if !ok {
+		return nil, ErrPackedObjectsNotSupported
+	}
+
+	pis, ok := r.Storer.(storer.PackedObjectInfoStorer)
+	if !ok {
+		return nil, ErrPackedObjectsNotSupported
+	}
+
+	now := time.Now()
+	expiry, err := r.gcExpiry(opts, now)
+	if err != nil {
+		return nil, err
+	}
+
+	if !opts.DryRun {
+		unlock, err := r.lockGC(now)
+		if err != nil {
+			return nil, err
+		}
+
+		defer unlock()
+
+		if err := r.Storer.PackRefs(); err != nil {
+			return nil, err
+		}
+	}
+
+	report := &GCReport{ExpiredReflogEntries: make(map[plumbing.ReferenceName]int)}
+	reflogs, err := r.expireReflogs(expiry, opts.DryRun, report)
+	if err != nil {
+		return nil, err
+	}
+
+	// Only the packs existing before the objects are walked may be removed,
+	// the ones written since then being kept.
+	packs, err := pos.ObjectPacks()
+	if err != nil {
+		return nil, err
+	}
+
+	reachable, err := r.gcReachable(reflogs)
+	if err != nil {
+		return nil, err
+	}
+
+	packObjects := make(map[plumbing.Hash][]plumbing.Hash, len(packs))
+	for _, p := range packs {
+		if packObjects[p], err = pis.ObjectPackHashes(p); err != nil {
+			return nil, err
+		}
+	}
+
+	loose, err := r.gcLooseObjects()
+	if err != nil {
+		return nil, err
+	}
+
+	// pack is the pack holding the reachable objects, and packed its
+	// objects.
+	var pack plumbing.Hash
+	packed := reachable
+	switch {
+	case len(reachable) == 0:
+	case len(packs) == 1 && sameObjects(packObjects[packs[0]], reachable) && !hasAnyObject(loose, reachable):
+		pack = packs[0]
+	default:
+		objs := make([]plumbing.Hash, 0, len(reachable))
+		for h := range reachable {
+			objs = append(objs, h)
+		}
+
+		sort.Sort(plumbing.HashSlice(objs))
+		if !opts.DryRun {
+			if pack, err = r.encodeObjectPack(objs, false); err != nil {
+				return nil, err
+			}
+
+			report.Pack = pack
+		}
+
+		report.PackedObjects = len(objs)
+		if !opts.DryRun {
+			// The references may have been updated while repacking, so the
+			// objects reachable from them are kept even if not packed.
+			if reflogs, err = r.currentReflogs(); err != nil {
+				return nil, err
+			}
+
+			if reachable, err = r.gcReachable(reflogs); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	keep := func(h plumbing.Hash) bool {
+		_, isPacked := packed[h]
+		_, isReachable := reachable[h]
+		return isPacked || isReachable
+	}
+
+	expired := func(t time.Time) bool {
+		return !expiry.prune.IsZero() && t.Before(expiry.prune)
+	}
+
+	// pruned are the objects removed with a loose object or a pack, which
+	// may still be in another pack.
+	pruned := make(map[plumbing.Hash]struct{})
+	kept := make(map[plumbing.Hash]struct{})
+	for _, p := range packs {
+		if p == pack {
+			continue
+		}
+
+		t, err := pis.ObjectPackTime(p)
+		if err != nil {
+			return nil, err
+		}
+
+		removable := true
+		for _, h := range packObjects[p] {
+			if _, ok := packed[h]; !ok && (keep(h) || !expired(t)) {
+				removable = false
+				break
+			}
+		}
+
+		if !removable {
+			for _, h := range packObjects[p] {
+				kept[h] = struct{}{}
+			}
+
+			continue
+		}
+
+		report.RemovedPacks = append(report.RemovedPacks, p)
+		for _, h := range packObjects[p] {
+			if !keep(h) {
+				pruned[h] = struct{}{}
+			}
+		}
+	}
+
+	var removedLoose []plumbing.Hash
+	for h, t := range loose {
+		_, isPacked := packed[h]
+		switch {
+		case isPacked:
+			removedLoose = append(removedLoose, h)
+		case !keep(h) && expired(t):
+			removedLoose = append(removedLoose, h)
+			pruned[h] = struct{}{}
+		default:
+			kept[h] = struct{}{}
+		}
+	}
+
+	for h := range pruned {
+		if _, ok := kept[h]; !ok {
+			report.PrunedObjects = append(report.PrunedObjects, h)
+		}
+	}
+
+	sort.Sort(plumbing.HashSlice(report.PrunedObjects))
+	sort.Sort(plumbing.HashSlice(report.RemovedPacks))
+	if opts.DryRun {
+		return report, nil
+	}
+
+	if err := r.removeGCObjects(pos, report.RemovedPacks, removedLoose); err != nil {
+		return nil, err
+	}
+
+	return report, nil
+}
+
+// removeGCObjects removes the given packs and loose objects.
+func (r *Repository) removeGCObjects(pos storer.PackedObjectStorer, packs, loose []plumbing.Hash) error {
+	if len(loose) > 0 {
+		los, ok := r.Storer.(storer.LooseObjectStorer)
+		if !ok {
+			return ErrLooseObjectsNotSupported
+		}
+
+		for _, h := range loose {
+			if err := los.DeleteLooseObject(h); err != nil && !os.IsNotExist(err) {
+				return err
+			}
+		}
+	}
+
+	for _, p := range packs {
+		if err := pos.DeleteOldObjectPackAndIndex(p, time.Time{}); err != nil {
+			return err
+		}
+	}
+
+	// The packs removed may be indexed by the storer.
+	if ri, ok := r.Storer.(interface{ Reindex() }); ok && len(packs) > 0 {
+		ri.Reindex()
+	}
+
+	return nil
+}
+
+// sameObjects returns whether the given objects are exactly the ones of the
+// set.
+func sameObjects(objs []plumbing.Hash, set map[plumbing.Hash]struct{}) bool {
+	if len(objs) != len(set) {
+		return false
+	}
+
+	for _, h := range objs {
+		if _, ok := set[h]; !ok {
+			return false
+		}
+	}
+
+	return true
+}
+
+// hasAnyObject returns whether any of the given objects is in the set.
+func hasAnyObject(objs map[plumbing.Hash]time.Time, set map[plumbing.Hash]struct{}) bool {
+	for h := range objs {
+		if _, ok := set[h]; ok {
+			return true
+		}
+	}
+
+	return false
+}
+
+// gcExpiry returns the expiry dates of a GC, from its options or the gc.*
+// config.
+func (r *Repository) gcExpiry(opts *GCOptions, now time.Time) (*gcExpiry, error) {
+	cfgs, err := r.scopedConfigs(config.SystemScope)
+	if err != nil {
+		return nil, err
+	}
+
+	date := func(t time.Time, key, def string) (time.Time, error) {
+		if !t.IsZero() {
+			return t, nil
+		}
+
+		value := def
+		for _, cfg := range cfgs {
+			if cfg != nil && cfg.Raw != nil && cfg.Raw.Section(gcSection).HasOption(key) {
+				value = cfg.Raw.Section(gcSection).Option(key)
+			}
+		}
+
+		t, ok := revision.ParseExpiryDate(value, now)
+		if !ok {
+			return time.Time{}, fmt.Errorf("invalid %s.%s: %q", gcSection, key, value)
+		}
+
+		return t, nil
+	}
+
+	var e gcExpiry
+	if e.prune, err = date(opts.PruneExpire, "pruneExpire", defaultPruneExpire); err != nil {
+		return nil, err
+	}
+
+	if e.reflog, err = date(opts.ReflogExpire, "reflogExpire", defaultReflogExpire); err != nil {
+		return nil, err
+	}
+
+	if e.reflogUnreachable, err = date(opts.ReflogExpireUnreachable, "reflogExpireUnreachable", defaultReflogExpireUnreachable); err != nil {
+		return nil, err
+	}
+
+	return &e, nil
+}
+
+// lockGC creates the lock file of the GCs of the repository, if the storer
+// has a filesystem, and returns the func removing it.
+func (r *Repository) lockGC(now time.Time) (func(), error) {
+	s, ok := r.Storer.(interface{ Filesystem() billy.Filesystem })
+	if !ok {
+		return func() {}, nil
+	}
+
+	fs := s.Filesystem()
+	f, err := fs.OpenFile(gcPidFile, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0o644)
+	if os.IsExist(err) {
+		fi, serr := fs.Stat(gcPidFile)
+		if serr == nil && now.Sub(fi.ModTime()) < gcPidExpire {
+			return nil, ErrGCInProgress
+		}
+
+		// The lock file was left over by a GC that died.
+		if err := fs.Remove(gcPidFile); err != nil && !os.IsNotExist(err) {
+			return nil, err
+		}
+
+		f, err = fs.OpenFile(gcPidFile, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0o644)
+	}
+	if os.IsExist(err) {
+		return nil, ErrGCInProgress
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	hostname, _ := os.Hostname()
+	_, err = fmt.Fprintf(f, "%d %s", os.Getpid(), hostname)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		_ = fs.Remove(gcPidFile)
+		return nil, err
+	}
+
+	return func() { _ = fs.Remove(gcPidFile) }, nil
+}
+
+// currentReflogs returns the entries of the reflogs of the references and
+// HEAD, by reference.
+func (r *Repository) currentReflogs() (map[plumbing.ReferenceName][]*reflog.Entry, error) {
+	rs, ok := r.Storer.(storage.ReflogStorer)
+	if !ok {
+		return nil, nil
+	}
+
+	iter, err := r.Storer.IterReferences()
+	if err != nil {
+		return nil, err
+	}
+
+	names := []plumbing.ReferenceName{plumbing.HEAD}
+	err = iter.ForEach(func(ref *plumbing.Reference) error {
+		if ref.Name() != plumbing.HEAD {
+			names = append(names, ref.Name())
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	reflogs := make(map[plumbing.ReferenceName][]*reflog.Entry, len(names))
+	for _, name := range names {
+		entries, err := rs.Reflog(name)
+		if err != nil {
+			return nil, err
+		}
+
+		if len(entries) > 0 {
+			reflogs[name] = entries
+		}
+	}
+
+	return reflogs, nil
+}
+
+// expireReflogs expires the entries of the reflogs, as git reflog expire
+// does, and returns the entries kept.
+func (r *Repository) expireReflogs(e *gcExpiry, dryRun bool, report *GCReport) (map[plumbing.ReferenceName][]*reflog.Entry, error) {
+	reflogs, err := r.currentReflogs()
+	if err != nil || len(reflogs) == 0 {
+		return reflogs, err
+	}
+
+	rs := r.Storer.(storage.ReflogStorer)
+	for name, entries := range reflogs {
+		var tip plumbing.Hash
+		if ref, err := storer.ResolveReference(r.Storer, name); err == nil {
+			tip = ref.Hash()
+		}
+
+		kept := make([]*reflog.Entry, 0, len(entries))
+		for _, entry := range entries {
+			expired := !e.reflog.IsZero() && entry.When.Before(e.reflog)
+			if !expired && !e.reflogUnreachable.IsZero() && entry.When.Before(e.reflogUnreachable) {
+				expired = !r.reachableFromTip(entry.New, tip)
+			}
+
+			if !expired {
+				kept = append(kept, entry)
+			}
+		}
+
+		if len(kept) == len(entries) {
+			continue
+		}
+
+		report.ExpiredReflogEntries[name] = len(entries) - len(kept)
+		reflogs[name] = kept
+		if !dryRun {
+			if err := rs.SetReflog(name, kept); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	return reflogs, nil
+}
+
+// reachableFromTip returns whether the given object is the tip of a
+// reference, or a commit of its history.
+func (r *Repository) reachableFromTip(h, tip plumbing.Hash) bool {
+	if h == tip {
+		return true
+	}
+
+	if h.IsZero() || tip.IsZero() {
+		return false
+	}
+
+	ok, err := r.IsAncestor(h, tip)
+	return err == nil && ok
+}
+
+// gcReachable returns the objects reachable from the references, the given
+// reflog entries and the index.
+func (r *Repository) gcReachable(reflogs map[plumbing.ReferenceName][]*reflog.Entry) (map[plumbing.Hash]struct{}, error) {
+	ow := newObjectWalker(r.Storer)
+	if err := ow.walkAllRefs(); err != nil {
+		return nil, err
+	}
+
+	for _, entries := range reflogs {
+		for _, e := range entries {
+			for _, h := range []plumbing.Hash{e.Old, e.New} {
+				// The objects of the old entries may have been pruned.
+				if h.IsZero() || r.Storer.HasEncodedObject(h) != nil {
+					continue
+				}
+
+				if err := ow.walkObjectTree(h); err != nil {
+					return nil, err
+				}
+			}
+		}
+	}
+
+	idx, err := r.Storer.Index()
+	if err == nil {
+		for _, e := range idx.Entries {
+			if e.Mode != filemode.Submodule && r.Storer.HasEncodedObject(e.Hash) == nil {
+				ow.add(e.Hash)
+			}
+		}
+	}
+
+	return ow.seen, nil
+}
+
+// gcLooseObjects returns the loose objects and their modification time.
+func (r *Repository) gcLooseObjects() (map[plumbing.Hash]time.Time, error) {
+	loose := make(map[plumbing.Hash]time.Time)
+	los, ok := r.Storer.(storer.LooseObjectStorer)
+	if !ok {
+		return loose, nil
+	}
+
+	err := los.ForEachObjectHash(func(h plumbing.Hash) error {
+		t, err := los.LooseObjectTime(h)
+		if err != nil {
+			// The object may have been concurrently deleted.
+			return nil
+		}
+
+		loose[h] = t
+		return nil
+	})
+
+	return loose, err
+}
@@ -0,0 +1,243 @@
+package git
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/go-git/go-billy/v6/osfs"
+	fixtures "github.com/go-git/go-git-fixtures/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/go-git/go-git/v6/plumbing"
+	"github.com/go-git/go-git/v6/plumbing/cache"
+	"github.com/go-git/go-git/v6/plumbing/format/reflog"
+	"github.com/go-git/go-git/v6/storage/filesystem"
+	"github.com/go-git/go-git/v6/storage/memory"
+)
+
+// newGCRepository returns a copy of the basic fixture, and its git directory.
+func newGCRepository(t *testing.T) (*Repository, *filesystem.Storage, string) {
+	t.Helper()
+
+	dir := t.TempDir()
+	dot := fixtures.Basic().One().DotGit(fixtures.WithTargetDir(func() string { return dir }))
+	// The reflogs of the fixture are old, and would be expired.
+	require.NoError(t, os.RemoveAll(filepath.Join(dot.Root(), "logs")))
+	// The filesystem is bound to the git directory, as PlainOpen builds it.
+	st := filesystem.NewStorage(osfs.New(dot.Root(), osfs.WithBoundOS()), cache.NewObjectLRUDefault())
+	r, err := Open(st, nil)
+	require.NoError(t, err)
+
+	return r, st, dot.Root()
+}
+
+// writeLooseObject writes a loose blob, modified at the given time.
+func writeLooseObject(t *testing.T, r *Repository, dir, content string, mtime time.Time) plumbing.Hash {
+	t.Helper()
+
+	h := writeFsckObject(t, r, plumbing.BlobObject, content)
+	path := filepath.Join(dir, "objects", h.String()[:2], h.String()[2:])
+	require.NoError(t, os.Chtimes(path, mtime, mtime))
+	return h
+}
+
+func packsOf(t *testing.T, st *filesystem.Storage) []plumbing.Hash {
+	t.Helper()
+
+	packs, err := st.ObjectPacks()
+	require.NoError(t, err)
+	return packs
+}
+
+func TestGC(t *testing.T) {
+	t.Parallel()
+
+	r, st, dir := newGCRepository(t)
+	packs := packsOf(t, st)
+	require.Len(t, packs, 1)
+
+	old := writeLooseObject(t, r, dir, "old\n", time.Now().Add(-30*24*time.Hour))
+	recent := writeLooseObject(t, r, dir, "recent\n", time.Now())
+
+	// A new commit is added on master, as a loose object.
+	head, err := r.Head()
+	require.NoError(t, err)
+	parent, err := r.CommitObject(head.Hash())
+	require.NoError(t, err)
+	commit := writeFsckObject(t, r, plumbing.CommitObject,
+		"tree "+parent.TreeHash.String()+"\nparent "+head.Hash().String()+"\nauthor "+fsckIdent+"\ncommitter "+fsckIdent+"\n\nnew\n")
+	require.NoError(t, st.SetReference(plumbing.NewHashReference(plumbing.Master, commit)))
+
+	report, err := r.GC(&GCOptions{DryRun: true})
+	require.NoError(t, err)
+	assert.Equal(t, &GCReport{
+		PackedObjects:        32,
+		RemovedPacks:         packs,
+		PrunedObjects:        []plumbing.Hash{old},
+		ExpiredReflogEntries: map[plumbing.ReferenceName]int{},
+	}, report)
+
+	// Nothing is changed by a dry run.
+	assert.Equal(t, packs, packsOf(t, st))
+	for _, h := range []plumbing.Hash{old, recent, commit} {
+		_, err := st.LooseObjectTime(h)
+		assert.NoError(t, err)
+	}
+
+	report, err = r.GC(nil)
+	require.NoError(t, err)
+	assert.False(t, report.Pack.IsZero())
+	assert.Equal(t, 32, report.PackedObjects)
+	assert.Equal(t, packs, report.RemovedPacks)
+	assert.Equal(t, []plumbing.Hash{old}, report.PrunedObjects)
+	assert.Equal(t, []plumbing.Hash{report.Pack}, packsOf(t, st))
+
+	// The loose objects are packed, but the recent unreachable one.
+	_, err = st.LooseObjectTime(commit)
+	assert.Error(t, err)
+	assert.NoError(t, st.HasEncodedObject(commit))
+	_, err = st.LooseObjectTime(recent)
+	assert.NoError(t, err)
+	assert.ErrorIs(t, st.HasEncodedObject(old), plumbing.ErrObjectNotFound)
+
+	fsck, err := r.Fsck(&FsckOptions{NoDangling: true})
+	require.NoError(t, err)
+	assert.Empty(t, fsck.Issues)
+
+	_, err = os.Stat(filepath.Join(dir, gcPidFile))
+	assert.True(t, os.IsNotExist(err))
+
+	// A second GC has nothing to do.
+	pack := report.Pack
+	report, err = r.GC(nil)
+	require.NoError(t, err)
+	assert.Equal(t, &GCReport{ExpiredReflogEntries: map[plumbing.ReferenceName]int{}}, report)
+	assert.Equal(t, []plumbing.Hash{pack}, packsOf(t, st))
+}
+
+func TestGCPruneExpire(t *testing.T) {
+	t.Parallel()
+
+	r, st, dir := newGCRepository(t)
+	blob := writeLooseObject(t, r, dir, "blob\n", time.Now().Add(-time.Hour))
+
+	cfg, err := r.Config()
+	require.NoError(t, err)
+	cfg.Raw.Section("gc").SetOption("pruneExpire", "never")
+	require.NoError(t, r.SetConfig(cfg))
+
+	report, err := r.GC(nil)
+	require.NoError(t, err)
+	assert.Empty(t, report.PrunedObjects)
+
+	report, err = r.GC(&GCOptions{PruneExpire: time.Now()})
+	require.NoError(t, err)
+	assert.Equal(t, []plumbing.Hash{blob}, report.PrunedObjects)
+	assert.ErrorIs(t, st.HasEncodedObject(blob), plumbing.ErrObjectNotFound)
+
+	cfg.Raw.Section("gc").SetOption("pruneExpire", "someday")
+	require.NoError(t, r.SetConfig(cfg))
+	_, err = r.GC(nil)
+	assert.ErrorContains(t, err, `invalid gc.pruneExpire: "someday"`)
+}
+
+// TestGCConcurrentPack checks that the objects of a pack written while GC
+// runs, such as by a push not having updated its references yet, are kept.
+func TestGCConcurrentPack(t *testing.T) {
+	t.Parallel()
+
+	r, st, dir := newGCRepository(t)
+	blob := writeLooseObject(t, r, dir, "pushed\n", time.Now())
+	pushed, err := r.encodeObjectPack([]plumbing.Hash{blob}, false)
+	require.NoError(t, err)
+	require.NoError(t, st.DeleteLooseObject(blob))
+	packs := packsOf(t, st)
+	require.Len(t, packs, 2)
+
+	report, err := r.GC(nil)
+	require.NoError(t, err)
+	assert.Empty(t, report.PrunedObjects)
+	assert.NotContains(t, report.RemovedPacks, pushed)
+	assert.Contains(t, packsOf(t, st), pushed)
+	assert.NoError(t, st.HasEncodedObject(blob))
+
+	// Once the push updated its reference, the pack is repacked.
+	require.NoError(t, st.SetReference(plumbing.NewHashReference("refs/tags/pushed", blob)))
+	report, err = r.GC(nil)
+	require.NoError(t, err)
+	assert.Contains(t, report.RemovedPacks, pushed)
+	assert.Equal(t, []plumbing.Hash{report.Pack}, packsOf(t, st))
+	assert.NoError(t, st.HasEncodedObject(blob))
+}
+
+func TestGCReflogExpire(t *testing.T) {
+	t.Parallel()
+
+	r, st, _ := newGCRepository(t)
+	head, err := r.Head()
+	require.NoError(t, err)
+	commit, err := r.CommitObject(head.Hash())
+	require.NoError(t, err)
+	unreachable := plumbing.NewHash("e8d3ffab552895c19b9fcf7aa264d277cde33881")
+
+	now := time.Now()
+	entries := []*reflog.Entry{
+		{New: commit.ParentHashes[0], When: now.Add(-100 * 24 * time.Hour), Message: "old"},
+		{Old: commit.ParentHashes[0], New: unreachable, When: now.Add(-40 * 24 * time.Hour), Message: "old unreachable"},
+		{Old: unreachable, New: commit.ParentHashes[0], When: now.Add(-40 * 24 * time.Hour), Message: "old reachable"},
+		{Old: commit.ParentHashes[0], New: unreachable, When: now.Add(-24 * time.Hour), Message: "unreachable"},
+		{Old: unreachable, New: head.Hash(), When: now, Message: "current"},
+	}
+	require.NoError(t, st.SetReflog(plumbing.Master, entries))
+
+	report, err := r.GC(&GCOptions{DryRun: true})
+	require.NoError(t, err)
+	assert.Equal(t, map[plumbing.ReferenceName]int{plumbing.Master: 2}, report.ExpiredReflogEntries)
+	assert.Len(t, reflogMessages(t, r, plumbing.Master), 5)
+
+	report, err = r.GC(nil)
+	require.NoError(t, err)
+	assert.Equal(t, map[plumbing.ReferenceName]int{plumbing.Master: 2}, report.ExpiredReflogEntries)
+	assert.Equal(t, []string{"current", "unreachable", "old reachable"}, reflogMessages(t, r, plumbing.Master))
+
+	report, err = r.GC(&GCOptions{ReflogExpire: now.Add(-time.Hour)})
+	require.NoError(t, err)
+	assert.Equal(t, map[plumbing.ReferenceName]int{plumbing.Master: 2}, report.ExpiredReflogEntries)
+	assert.Equal(t, []string{"current"}, reflogMessages(t, r, plumbing.Master))
+}
+
+func TestGCInProgress(t *testing.T) {
+	t.Parallel()
+
+	r, _, dir := newGCRepository(t)
+	pid := filepath.Join(dir, gcPidFile)
+	require.NoError(t, os.WriteFile(pid, []byte("1 host"), 0o644))
+
+	_, err := r.GC(nil)
+	assert.ErrorIs(t, err, ErrGCInProgress)
+
+	// A dry run doesn't lock the repository.
+	_, err = r.GC(&GCOptions{DryRun: true})
+	assert.NoError(t, err)
+
+	// The lock file of a GC that died is ignored.
+	mtime := time.Now().Add(-gcPidExpire - time.Minute)
+	require.NoError(t, os.Chtimes(pid, mtime, mtime))
+	_, err = r.GC(nil)
+	assert.NoError(t, err)
+	_, err = os.Stat(pid)
+	assert.True(t, os.IsNotExist(err))
+}
+
+func TestGCNotSupported(t *testing.T) {
+	t.Parallel()
+
+	r, err := Init(memory.NewStorage())
+	require.NoError(t, err)
+
+	_, err = r.GC(nil)
+	assert.ErrorIs(t, err, ErrPackedObjectsNotSupported)
+}
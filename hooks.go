@@ -0,0 +1,291 @@
+package git
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/go-git/go-billy/v6"
+
+	"github.com/go-git/go-git/v6/plumbing"
+	"github.com/go-git/go-git/v6/plumbing/storer"
+	"github.com/go-git/go-git/v6/storage"
+)
+
+// HookError is returned when a hook aborts a commit or a push.
+type HookError struct {
+	// Hook is the name of the hook, such as pre-commit.
+	Hook string
+	// Err is the error returned by the hook.
+	Err error
+}
+
+func (e *HookError) Error() string {
+	return fmt.Sprintf("%s hook failed: %s", e.Hook, e.Err)
+}
+
+// Unwrap returns the error returned by the hook.
+func (e *HookError) Unwrap() error {
+	return e.Err
+}
+
+// HookRequest is the repository whose hooks are run.
+type HookRequest struct {
+	// Storer is the storer of the repository.
+	Storer storage.Storer
+	// Worktree is the worktree of the repository, nil if it is bare.
+	Worktree billy.Filesystem
+	// Output, if not nil, receives the human readable output of the hook,
+	// which is otherwise only reported when the hook fails.
+	Output io.Writer
+}
+
+// PrePushUpdate is a reference update of a push, as given to the pre-push
+// hook.
+type PrePushUpdate struct {
+	// LocalRef is the local reference pushed, empty if the remote reference
+	// is deleted.
+	LocalRef plumbing.ReferenceName
+	// LocalHash is the hash pushed, zero if the remote reference is deleted.
+	LocalHash plumbing.Hash
+	// RemoteRef is the remote reference updated.
+	RemoteRef plumbing.ReferenceName
+	// RemoteHash is the hash of the remote reference before the push, zero
+	// if it is created.
+	RemoteHash plumbing.Hash
+}
+
+// HookRunner runs the client hooks of a repository, such as the scripts of
+// its hooks directory, to enforce the policies of the project. A hook aborts
+// the commit or the push by returning an error, reported as a HookError.
+type HookRunner interface {
+	// PreCommit is run by Worktree.Commit before the commit is created,
+	// once the files to commit are staged.
+	PreCommit(ctx context.Context, req *HookRequest) error
+	// CommitMsg is run by Worktree.Commit with the message of the commit,
+	// after PreCommit, and returns the message to commit, which it may
+	// rewrite.
+	CommitMsg(ctx context.Context, req *HookRequest, msg string) (string, error)
+	// PrePush is run by Remote.Push with the name and the URL of the
+	// remote and the reference updates, before the objects are sent.
+	PrePush(ctx context.Context, req *HookRequest, remote, url string, updates []*PrePushUpdate) error
+}
+
+// ScriptHookRunner is a HookRunner running the pre-commit, commit-msg and
+// pre-push scripts of a hooks directory, as git does. The missing scripts are
+// not run. The commit-msg script gets the path of a file holding the message
+// as argument, which it may rewrite, and the pre-push script reads the
+// "<local ref> <local hash> <remote ref> <remote hash>" lines of the updates
+// from its standard input. A script aborts the commit or the push by exiting
+// with a non-zero status.
+type ScriptHookRunner struct {
+	// Dir is the hooks directory. If empty, it is the one given by the
+	// core.hooksPath config, else the hooks directory of the git directory
+	// of the storer, which must then be a storer.FilesystemStorer on the OS
+	// filesystem.
+	Dir string
+	// Env are environment variables set for the scripts, in addition to
+	// the ones of the process and GIT_DIR.
+	Env []string
+}
+
+var _ HookRunner = (*ScriptHookRunner)(nil)
+
+// PreCommit implements HookRunner.
+func (h *ScriptHookRunner) PreCommit(ctx context.Context, req *HookRequest) error {
+	path, err := h.hook(req, "pre-commit")
+	if err != nil || path == "" {
+		return err
+	}
+
+	return h.run(ctx, req, path, nil)
+}
+
+// CommitMsg implements HookRunner.
+func (h *ScriptHookRunner) CommitMsg(ctx context.Context, req *HookRequest, msg string) (string, error) {
+	path, err := h.hook(req, "commit-msg")
+	if err != nil || path == "" {
+		return msg, err
+	}
+
+	// As git, the message is written to the git directory, or to a
+	// temporary file if it is not on the OS filesystem.
+	var file string
+	if gitDir := hooksGitDir(req.Storer); gitDir != "" {
+		file = filepath.Join(gitDir, "COMMIT_EDITMSG")
+	} else {
+		f, err := os.CreateTemp("", "COMMIT_EDITMSG")
+		if err != nil {
+			return "", err
+		}
+
+		file = f.Name()
+		defer os.Remove(file) //nolint:errcheck
+		if err := f.Close(); err != nil {
+			return "", err
+		}
+	}
+
+	if err := os.WriteFile(file, []byte(msg), 0o644); err != nil {
+		return "", err
+	}
+
+	if err := h.run(ctx, req, path, nil, file); err != nil {
+		return "", err
+	}
+
+	content, err := os.ReadFile(file)
+	if err != nil {
+		return "", err
+	}
+
+	return string(content), nil
+}
+
+// PrePush implements HookRunner.
+func (h *ScriptHookRunner) PrePush(ctx context.Context, req *HookRequest, remote, url string, updates []*PrePushUpdate) error {
+	path, err := h.hook(req, "pre-push")
+	if err != nil || path == "" {
+		return err
+	}
+
+	var stdin bytes.Buffer
+	for _, u := range updates {
+		local := u.LocalRef.String()
+		if local == "" {
+			local = "(delete)"
+		}
+
+		fmt.Fprintf(&stdin, "%s %s %s %s\n", local, u.LocalHash, u.RemoteRef, u.RemoteHash)
+	}
+
+	return h.run(ctx, req, path, stdin.Bytes(), remote, url)
+}
+
+// hook returns the path of the script of the hook, or an empty string if it
+// is missing or not executable, as git ignores those.
+func (h *ScriptHookRunner) hook(req *HookRequest, name string) (string, error) {
+	dir := h.Dir
+	if dir == "" {
+		cfg, err := req.Storer.Config()
+		if err != nil {
+			return "", err
+		}
+
+		dir = cfg.Raw.Section("core").Option("hooksPath")
+		switch {
+		case dir == "":
+			gitDir := hooksGitDir(req.Storer)
+			if gitDir == "" {
+				return "", nil
+			}
+
+			dir = filepath.Join(gitDir, "hooks")
+		case !filepath.IsAbs(dir):
+			// As git, a relative path is relative to the directory where
+			// the hooks are run.
+			dir = filepath.Join(hooksWorkDir(req), dir)
+		}
+	}
+
+	path := filepath.Join(dir, name)
+	if fi, err := os.Stat(path); err != nil || fi.IsDir() || fi.Mode()&0o111 == 0 {
+		return "", nil
+	}
+
+	return path, nil
+}
+
+func (h *ScriptHookRunner) run(ctx context.Context, req *HookRequest, path string, stdin []byte, args ...string) error {
+	var out bytes.Buffer
+	var w io.Writer = &out
+	if req.Output != nil {
+		w = io.MultiWriter(&out, req.Output)
+	}
+
+	cmd := exec.CommandContext(ctx, path, args...)
+	cmd.Stdin = bytes.NewReader(stdin)
+	cmd.Stdout = w
+	cmd.Stderr = w
+	cmd.Dir = hooksWorkDir(req)
+	cmd.Env = append(os.Environ(), h.Env...)
+	if gitDir := hooksGitDir(req.Storer); gitDir != "" {
+		cmd.Env = append(cmd.Env, "GIT_DIR="+gitDir)
+	}
+
+	if err := cmd.Run(); err != nil {
+		if msg := strings.TrimSpace(out.String()); msg != "" {
+			return fmt.Errorf("%w: %s", err, msg)
+		}
+
+		return err
+	}
+
+	return nil
+}
+
+// hooksGitDir returns the git directory of the storer, if it is stored on
+// the OS filesystem, or an empty string.
+func hooksGitDir(st storage.Storer) string {
+	fss, ok := st.(storer.FilesystemStorer)
+	if !ok {
+		return ""
+	}
+
+	return osDirectory(fss.Filesystem())
+}
+
+// hooksWorkDir returns the directory the hooks are run in, the root of the
+// worktree, or the git directory if the repository is bare, if they are on
+// the OS filesystem.
+func hooksWorkDir(req *HookRequest) string {
+	if req.Worktree != nil {
+		if dir := osDirectory(req.Worktree); dir != "" {
+			return dir
+		}
+	}
+
+	return hooksGitDir(req.Storer)
+}
+
+// osDirectory returns the root of the filesystem, if it is a directory of the
+// OS filesystem, or an empty string.
+func osDirectory(fs billy.Filesystem) string {
+	root := fs.Root()
+	if fi, err := os.Stat(root); err != nil || !fi.IsDir() {
+		return ""
+	}
+
+	return root
+}
+
+// runCommitHooks runs the pre-commit and commit-msg hooks of the commit, and
+// returns its message, as rewritten by commit-msg.
+func (w *Worktree) runCommitHooks(msg string, opts *CommitOptions) (string, error) {
+	hooks := opts.Hooks
+	if hooks == nil {
+		hooks = &ScriptHookRunner{}
+	}
+
+	ctx := context.Background()
+	req := &HookRequest{Storer: w.r.Storer, Worktree: w.Filesystem}
+	if err := hooks.PreCommit(ctx, req); err != nil {
+		return "", &HookError{Hook: "pre-commit", Err: err}
+	}
+
+	msg, err := hooks.CommitMsg(ctx, req, msg)
+	if err != nil {
+		return "", &HookError{Hook: "commit-msg", Err: err}
+	}
+
+	if !opts.AllowEmptyMessage && strings.TrimSpace(msg) == "" {
+		return "", ErrEmptyCommitMessage
+	}
+
+	return msg, nil
+}
@@ -0,0 +1,245 @@
+package git
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+
+	"github.com/go-git/go-billy/v6/memfs"
+	"github.com/go-git/go-billy/v6/util"
+	fixtures "github.com/go-git/go-git-fixtures/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/go-git/go-git/v6/config"
+	"github.com/go-git/go-git/v6/plumbing"
+	"github.com/go-git/go-git/v6/storage/memory"
+)
+
+// testHookRunner is a HookRunner recording the hooks run, the files staged
+// when PreCommit is run, and the updates of PrePush.
+type testHookRunner struct {
+	err error
+	// msg is appended to the message by CommitMsg, which clears it if
+	// clear is set.
+	msg   string
+	clear bool
+
+	hooks   []string
+	staged  []string
+	updates []*PrePushUpdate
+}
+
+func (h *testHookRunner) PreCommit(_ context.Context, req *HookRequest) error {
+	h.hooks = append(h.hooks, "pre-commit")
+	idx, err := req.Storer.Index()
+	if err != nil {
+		return err
+	}
+
+	for _, e := range idx.Entries {
+		h.staged = append(h.staged, e.Name)
+	}
+
+	return h.err
+}
+
+func (h *testHookRunner) CommitMsg(_ context.Context, _ *HookRequest, msg string) (string, error) {
+	h.hooks = append(h.hooks, "commit-msg")
+	if h.clear {
+		return "\n", nil
+	}
+
+	return msg + h.msg, nil
+}
+
+func (h *testHookRunner) PrePush(_ context.Context, _ *HookRequest, remote, url string, updates []*PrePushUpdate) error {
+	h.hooks = append(h.hooks, "pre-push "+remote+" "+url)
+	h.updates = updates
+	return h.err
+}
+
+func TestCommitHooks(t *testing.T) {
+	t.Parallel()
+
+	fs := memfs.New()
+	r, err := Init(memory.NewStorage(), WithWorkTree(fs))
+	require.NoError(t, err)
+	w, err := r.Worktree()
+	require.NoError(t, err)
+	require.NoError(t, util.WriteFile(fs, "foo", []byte("foo"), 0o644))
+	_, err = w.Add("foo")
+	require.NoError(t, err)
+
+	// The hooks are not run by default.
+	hooks := &testHookRunner{err: errors.New("not today")}
+	_, err = w.Commit("foo\n", &CommitOptions{Author: defaultSignature(), Hooks: hooks})
+	require.NoError(t, err)
+	assert.Nil(t, hooks.hooks)
+
+	require.NoError(t, util.WriteFile(fs, "foo", []byte("bar"), 0o644))
+	require.NoError(t, util.WriteFile(fs, "bar", []byte("bar"), 0o644))
+	_, err = w.Add("bar")
+	require.NoError(t, err)
+
+	head, err := r.Head()
+	require.NoError(t, err)
+	_, err = w.Commit("bar\n", &CommitOptions{Author: defaultSignature(), Hooks: hooks, RunHooks: true})
+	var herr *HookError
+	require.ErrorAs(t, err, &herr)
+	assert.Equal(t, "pre-commit", herr.Hook)
+	assert.EqualError(t, err, "pre-commit hook failed: not today")
+	assert.Equal(t, []string{"pre-commit"}, hooks.hooks)
+
+	// The aborted commit is not created.
+	ref, err := r.Head()
+	require.NoError(t, err)
+	assert.Equal(t, head.Hash(), ref.Hash())
+
+	// The hook sees the files staged by All, and commit-msg rewrites the
+	// message.
+	hooks = &testHookRunner{msg: "\nChange-Id: 42\n"}
+	h, err := w.Commit("bar\n", &CommitOptions{Author: defaultSignature(), Hooks: hooks, RunHooks: true, All: true})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"pre-commit", "commit-msg"}, hooks.hooks)
+	assert.ElementsMatch(t, []string{"bar", "foo"}, hooks.staged)
+
+	commit, err := r.CommitObject(h)
+	require.NoError(t, err)
+	assert.Equal(t, "bar\n\nChange-Id: 42\n", commit.Message)
+	f, err := commit.File("foo")
+	require.NoError(t, err)
+	content, err := f.Contents()
+	require.NoError(t, err)
+	assert.Equal(t, "bar", content)
+
+	// The message rewritten by commit-msg must not be empty.
+	hooks = &testHookRunner{clear: true}
+	_, err = w.Commit("baz\n", &CommitOptions{Author: defaultSignature(), Hooks: hooks, RunHooks: true, Amend: true})
+	assert.ErrorIs(t, err, ErrEmptyCommitMessage)
+	assert.Equal(t, []string{"pre-commit", "commit-msg"}, hooks.hooks)
+}
+
+// writeHook writes the script of a hook to the given directory.
+func writeHook(t *testing.T, dir, name, script string) {
+	t.Helper()
+
+	require.NoError(t, os.MkdirAll(dir, 0o755))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, name), []byte("#!/bin/sh\n"+script), 0o755))
+}
+
+func TestCommitScriptHooks(t *testing.T) {
+	t.Parallel()
+
+	if runtime.GOOS == "windows" {
+		t.Skip("the hooks are shell scripts")
+	}
+
+	dir := t.TempDir()
+	r, err := PlainInit(dir, false)
+	require.NoError(t, err)
+	w, err := r.Worktree()
+	require.NoError(t, err)
+
+	hooks := filepath.Join(dir, GitDirName, "hooks")
+	writeHook(t, hooks, "pre-commit", "test ! -e forbidden || { echo forbidden file >&2; exit 1; }\n")
+	writeHook(t, hooks, "commit-msg", "test -f \"$GIT_DIR/index\" && echo 'Checked-by: commit-msg' >> \"$1\"\n")
+
+	require.NoError(t, util.WriteFile(w.Filesystem, "forbidden", []byte("foo"), 0o644))
+	_, err = w.Add("forbidden")
+	require.NoError(t, err)
+	_, err = w.Commit("foo\n", &CommitOptions{Author: defaultSignature(), RunHooks: true})
+	var herr *HookError
+	require.ErrorAs(t, err, &herr)
+	assert.Equal(t, "pre-commit", herr.Hook)
+	assert.EqualError(t, err, "pre-commit hook failed: exit status 1: forbidden file")
+
+	require.NoError(t, w.RemoveWithOptions(&RemoveOptions{Path: "forbidden", Force: true}))
+	require.NoError(t, util.WriteFile(w.Filesystem, "foo", []byte("foo"), 0o644))
+	_, err = w.Add("foo")
+	require.NoError(t, err)
+	h, err := w.Commit("foo\n", &CommitOptions{Author: defaultSignature(), RunHooks: true})
+	require.NoError(t, err)
+
+	commit, err := r.CommitObject(h)
+	require.NoError(t, err)
+	assert.Equal(t, "foo\nChecked-by: commit-msg\n", commit.Message)
+
+	// core.hooksPath is relative to the worktree.
+	cfg, err := r.Config()
+	require.NoError(t, err)
+	cfg.Raw.Section("core").SetOption("hooksPath", "githooks")
+	require.NoError(t, r.SetConfig(cfg))
+	writeHook(t, filepath.Join(dir, "githooks"), "commit-msg", "echo rejected >&2; exit 1\n")
+
+	_, err = w.Commit("bar\n", &CommitOptions{Author: defaultSignature(), RunHooks: true, AllowEmptyCommits: true})
+	assert.EqualError(t, err, "commit-msg hook failed: exit status 1: rejected")
+}
+
+func TestPushHooks(t *testing.T) {
+	t.Parallel()
+
+	url := fixtures.Basic().One().DotGit(fixtures.WithTargetDir(t.TempDir)).Root()
+	r, err := PlainClone(t.TempDir(), &CloneOptions{URL: url})
+	require.NoError(t, err)
+
+	master := plumbing.NewHash("6ecf0ef2c2dffb796033e5a02219af86ec6584e5")
+	branch := plumbing.NewHash("e8d3ffab552895c19b9fcf7aa264d277cde33881")
+	refspecs := []config.RefSpec{"refs/heads/master:refs/heads/other", ":refs/heads/branch"}
+
+	hooks := &testHookRunner{err: errors.New("not today")}
+	err = r.Push(&PushOptions{RefSpecs: refspecs, RunHooks: true, Hooks: hooks})
+	assert.EqualError(t, err, "pre-push hook failed: not today")
+	assert.Equal(t, []string{"pre-push origin " + url}, hooks.hooks)
+	assert.Equal(t, []*PrePushUpdate{
+		{LocalRef: "refs/heads/master", LocalHash: master, RemoteRef: "refs/heads/other"},
+		{RemoteRef: "refs/heads/branch", RemoteHash: branch},
+	}, hooks.updates)
+
+	server, err := PlainOpen(url)
+	require.NoError(t, err)
+	AssertReferencesMissing(t, server, []string{"refs/heads/other"})
+
+	hooks = &testHookRunner{}
+	require.NoError(t, r.Push(&PushOptions{RefSpecs: refspecs, RunHooks: true, Hooks: hooks}))
+	AssertReferences(t, server, map[string]string{"refs/heads/other": master.String()})
+	AssertReferencesMissing(t, server, []string{"refs/heads/branch"})
+}
+
+func TestPushScriptHooks(t *testing.T) {
+	t.Parallel()
+
+	if runtime.GOOS == "windows" {
+		t.Skip("the hooks are shell scripts")
+	}
+
+	url := fixtures.Basic().One().DotGit(fixtures.WithTargetDir(t.TempDir)).Root()
+	dir := t.TempDir()
+	r, err := PlainClone(dir, &CloneOptions{URL: url})
+	require.NoError(t, err)
+
+	writeHook(t, filepath.Join(dir, GitDirName, "hooks"), "pre-push",
+		"echo \"$@\" > \"$GIT_DIR/push.log\"\ncat >> \"$GIT_DIR/push.log\"\n"+
+			"! grep -q '(delete)' \"$GIT_DIR/push.log\" || { echo no deletes >&2; exit 1; }\n")
+
+	err = r.Push(&PushOptions{
+		RefSpecs: []config.RefSpec{"refs/heads/master:refs/heads/other", ":refs/heads/branch"},
+		RunHooks: true,
+	})
+	assert.EqualError(t, err, "pre-push hook failed: exit status 1: no deletes")
+
+	log, err := os.ReadFile(filepath.Join(dir, GitDirName, "push.log"))
+	require.NoError(t, err)
+	assert.Equal(t, "origin "+url+"\n"+
+		"refs/heads/master 6ecf0ef2c2dffb796033e5a02219af86ec6584e5 refs/heads/other 0000000000000000000000000000000000000000\n"+
+		"(delete) 0000000000000000000000000000000000000000 refs/heads/branch e8d3ffab552895c19b9fcf7aa264d277cde33881\n",
+		string(log))
+
+	require.NoError(t, r.Push(&PushOptions{
+		RefSpecs: []config.RefSpec{"refs/heads/master:refs/heads/other"},
+		RunHooks: true,
+	}))
+}
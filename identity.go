@@ -0,0 +1,168 @@
+package git
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/user"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-git/go-git/v6/config"
+	"github.com/go-git/go-git/v6/plumbing/object"
+)
+
+// ErrMissingCommitter is returned when no committer is given nor can be
+// resolved, as ErrMissingAuthor for the author.
+var ErrMissingCommitter = errors.New("committer field is required")
+
+// identityRole is the role of a signature of a commit, resolved from the
+// environment variables and the config section of its own.
+type identityRole struct {
+	// env is the prefix of the environment variables, such as GIT_AUTHOR_.
+	env string
+	// err is the error returned when the identity cannot be resolved.
+	err error
+	// config returns the name and the email of the config section of the
+	// role, such as author.name and author.email.
+	config func(*config.Config) (name, email string)
+}
+
+var (
+	authorRole = identityRole{
+		env: "GIT_AUTHOR_",
+		err: ErrMissingAuthor,
+		config: func(c *config.Config) (string, string) {
+			return c.Author.Name, c.Author.Email
+		},
+	}
+
+	committerRole = identityRole{
+		env: "GIT_COMMITTER_",
+		err: ErrMissingCommitter,
+		config: func(c *config.Config) (string, string) {
+			return c.Committer.Name, c.Committer.Email
+		},
+	}
+)
+
+// identityDateLayouts are the layouts of the dates of GIT_AUTHOR_DATE and
+// GIT_COMMITTER_DATE, besides git's internal "<unix timestamp> <offset>".
+// The dates without offset are in the time zone of the signature.
+var identityDateLayouts = []string{
+	time.RFC1123Z,
+	"2 Jan 2006 15:04:05 -0700",
+	time.RFC3339,
+	"2006-01-02T15:04:05-0700",
+	"2006-01-02 15:04:05 -0700",
+	"2006-01-02T15:04:05",
+	"2006-01-02 15:04:05",
+}
+
+// resolveIdentity returns the signature of the given role as git does, each
+// of its fields being read from the first of:
+//   - the environment variables of the role, such as GIT_AUTHOR_NAME,
+//     GIT_AUTHOR_EMAIL and GIT_AUTHOR_DATE,
+//   - the config section of the role, such as author.name,
+//   - the user section of the config,
+//   - the EMAIL environment variable, for the email,
+//   - the user of the system and the name of the host, unless
+//     user.useConfigOnly is set.
+//
+// The date defaults to the current time, in loc or in the local time zone if
+// loc is nil.
+func resolveIdentity(cfg *config.Config, role identityRole, loc *time.Location) (*object.Signature, error) {
+	name, email := role.config(cfg)
+	name = firstNonEmpty(os.Getenv(role.env+"NAME"), name, cfg.User.Name)
+	email = firstNonEmpty(os.Getenv(role.env+"EMAIL"), email, cfg.User.Email, os.Getenv("EMAIL"))
+
+	if name == "" || email == "" {
+		if cfg.User.UseConfigOnly {
+			field := "name"
+			if email == "" {
+				field = "email"
+			}
+
+			return nil, fmt.Errorf("%w: no %s was given and auto-detection is disabled by user.useConfigOnly", role.err, field)
+		}
+
+		defaultName, defaultEmail, err := systemIdentity()
+		if err != nil {
+			return nil, fmt.Errorf("%w: %w", role.err, err)
+		}
+
+		name = firstNonEmpty(name, defaultName)
+		email = firstNonEmpty(email, defaultEmail)
+	}
+
+	when := signatureTime(loc)
+	if date := os.Getenv(role.env + "DATE"); date != "" {
+		var ok bool
+		if when, ok = parseIdentityDate(date, when.Location()); !ok {
+			return nil, fmt.Errorf("invalid date %q of %sDATE", date, role.env)
+		}
+	}
+
+	return &object.Signature{Name: name, Email: email, When: when}, nil
+}
+
+// systemIdentity returns the name and the email guessed from the user of the
+// system, its full name and <username>@<hostname>. As git, the email is not
+// guessed if the name of the host is not fully qualified.
+func systemIdentity() (name, email string, err error) {
+	u, err := user.Current()
+	if err != nil {
+		return "", "", fmt.Errorf("unable to auto-detect the user: %w", err)
+	}
+
+	// The full name is the first field of the GECOS field on unix.
+	name, _, _ = strings.Cut(u.Name, ",")
+	name = firstNonEmpty(strings.TrimSpace(name), u.Username)
+
+	host, err := os.Hostname()
+	if err != nil || !strings.Contains(strings.Trim(host, "."), ".") {
+		return name, "", fmt.Errorf("unable to auto-detect the email address of %s, the host name %q is not fully qualified", u.Username, host)
+	}
+
+	return name, u.Username + "@" + host, nil
+}
+
+// parseIdentityDate parses the date of GIT_AUTHOR_DATE or GIT_COMMITTER_DATE,
+// either "[@]<unix timestamp> <offset>", as in the commits, or a date of
+// identityDateLayouts, in loc if it has no offset.
+func parseIdentityDate(s string, loc *time.Location) (time.Time, bool) {
+	s = strings.TrimSpace(s)
+	stamp, offset, hasOffset := strings.Cut(strings.TrimPrefix(s, "@"), " ")
+	if sec, err := strconv.ParseInt(stamp, 10, 64); err == nil {
+		t := time.Unix(sec, 0).In(loc)
+		if !hasOffset {
+			return t, true
+		}
+
+		tz, err := time.Parse("-0700", offset)
+		if err != nil {
+			return time.Time{}, false
+		}
+
+		return t.In(tz.Location()), true
+	}
+
+	for _, layout := range identityDateLayouts {
+		if t, err := time.ParseInLocation(layout, s, loc); err == nil {
+			return t, true
+		}
+	}
+
+	return time.Time{}, false
+}
+
+func firstNonEmpty(values ...string) string {
+	for _, v := range values {
+		if v != "" {
+			return v
+		}
+	}
+
+	return ""
+}
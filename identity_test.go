@@ -0,0 +1,147 @@
+package git
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/go-git/go-git/v6/config"
+	"github.com/go-git/go-git/v6/storage/memory"
+)
+
+// setIdentityEnv sets the environment variables of the identities, the
+// empty ones being ignored as unset.
+func setIdentityEnv(t *testing.T, env map[string]string) {
+	t.Helper()
+
+	for _, k := range []string{
+		"GIT_AUTHOR_NAME", "GIT_AUTHOR_EMAIL", "GIT_AUTHOR_DATE",
+		"GIT_COMMITTER_NAME", "GIT_COMMITTER_EMAIL", "GIT_COMMITTER_DATE",
+		"EMAIL",
+	} {
+		t.Setenv(k, env[k])
+	}
+}
+
+func TestResolveIdentity(t *testing.T) {
+	setIdentityEnv(t, map[string]string{
+		"GIT_AUTHOR_NAME":     "Env Author",
+		"GIT_COMMITTER_EMAIL": "env-committer@foo.foo",
+	})
+
+	cfg := config.NewConfig()
+	cfg.User.Name = "User"
+	cfg.User.Email = "user@foo.foo"
+	cfg.Author.Name = "Config Author"
+	cfg.Committer.Name = "Config Committer"
+
+	author, err := resolveIdentity(cfg, authorRole, time.UTC)
+	require.NoError(t, err)
+	assert.Equal(t, "Env Author", author.Name)
+	assert.Equal(t, "user@foo.foo", author.Email)
+	assert.Equal(t, time.UTC, author.When.Location())
+
+	committer, err := resolveIdentity(cfg, committerRole, nil)
+	require.NoError(t, err)
+	assert.Equal(t, "Config Committer", committer.Name)
+	assert.Equal(t, "env-committer@foo.foo", committer.Email)
+}
+
+func TestResolveIdentityEmail(t *testing.T) {
+	setIdentityEnv(t, map[string]string{"EMAIL": "email@foo.foo"})
+
+	cfg := config.NewConfig()
+	cfg.User.Name = "User"
+
+	author, err := resolveIdentity(cfg, authorRole, nil)
+	require.NoError(t, err)
+	assert.Equal(t, "email@foo.foo", author.Email)
+}
+
+func TestResolveIdentityUseConfigOnly(t *testing.T) {
+	setIdentityEnv(t, nil)
+
+	cfg := config.NewConfig()
+	cfg.User.Name = "User"
+	cfg.User.UseConfigOnly = true
+
+	_, err := resolveIdentity(cfg, authorRole, nil)
+	assert.ErrorIs(t, err, ErrMissingAuthor)
+	assert.ErrorContains(t, err, "no email was given")
+
+	_, err = resolveIdentity(cfg, committerRole, nil)
+	assert.ErrorIs(t, err, ErrMissingCommitter)
+
+	// The environment is enough.
+	t.Setenv("GIT_COMMITTER_EMAIL", "committer@foo.foo")
+	committer, err := resolveIdentity(cfg, committerRole, nil)
+	require.NoError(t, err)
+	assert.Equal(t, "User", committer.Name)
+	assert.Equal(t, "committer@foo.foo", committer.Email)
+}
+
+func TestResolveIdentityDate(t *testing.T) {
+	setIdentityEnv(t, nil)
+
+	cfg := config.NewConfig()
+	cfg.User.Name = "User"
+	cfg.User.Email = "user@foo.foo"
+
+	ist := time.FixedZone("", 5*3600+30*60)
+	want := time.Date(2009, 11, 10, 23, 0, 0, 0, time.UTC)
+	tests := []struct {
+		date   string
+		offset int
+	}{
+		{"1257894000 +0530", 5*3600 + 30*60},
+		{"@1257894000 -0700", -7 * 3600},
+		{"@1257894000", 5*3600 + 30*60},
+		{"Tue, 10 Nov 2009 23:00:00 +0000", 0},
+		{"2009-11-10T23:00:00Z", 0},
+		{"2009-11-11 04:30:00", 5*3600 + 30*60},
+	}
+
+	for _, tc := range tests {
+		t.Setenv("GIT_AUTHOR_DATE", tc.date)
+		author, err := resolveIdentity(cfg, authorRole, ist)
+		require.NoError(t, err, tc.date)
+		assert.True(t, want.Equal(author.When), "%s: %s", tc.date, author.When)
+
+		_, offset := author.When.Zone()
+		assert.Equal(t, tc.offset, offset, tc.date)
+	}
+
+	t.Setenv("GIT_AUTHOR_DATE", "tomorrow")
+	_, err := resolveIdentity(cfg, authorRole, nil)
+	assert.ErrorContains(t, err, "GIT_AUTHOR_DATE")
+}
+
+func TestCommitOptionsIdentityFromEnv(t *testing.T) {
+	setIdentityEnv(t, map[string]string{
+		"GIT_AUTHOR_NAME":    "Env Author",
+		"GIT_AUTHOR_EMAIL":   "env-author@foo.foo",
+		"GIT_COMMITTER_DATE": "1257894000 +0000",
+	})
+	t.Setenv("XDG_CONFIG_HOME", t.TempDir())
+	t.Setenv("HOME", t.TempDir())
+
+	r, err := Init(memory.NewStorage())
+	require.NoError(t, err)
+
+	cfg, err := r.Config()
+	require.NoError(t, err)
+	cfg.User.Name = "User"
+	cfg.User.Email = "user@foo.foo"
+	cfg.User.UseConfigOnly = true
+	require.NoError(t, r.SetConfig(cfg))
+
+	o := &CommitOptions{}
+	require.NoError(t, o.Validate(r))
+	assert.Equal(t, "Env Author", o.Author.Name)
+	assert.Equal(t, "env-author@foo.foo", o.Author.Email)
+	assert.Equal(t, "User", o.Committer.Name)
+	assert.Equal(t, "user@foo.foo", o.Committer.Email)
+	assert.Equal(t, int64(1257894000), o.Committer.When.Unix())
+}
@@ -0,0 +1,199 @@
+// Package pathspec implements the pathspecs of git, the patterns selecting
+// paths of a working tree, an index or a tree, such as "vendor",
+// "*.go" or ":(exclude)vendor/**".
+//
+// See https://git-scm.com/docs/gitglossary#Documentation/gitglossary.txt-aiddefpathspecapathspec
+package pathspec
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// ErrInvalidMagic is returned when parsing a pathspec with an unknown or
+// unsupported magic.
+var ErrInvalidMagic = errors.New("invalid pathspec magic")
+
+// Pattern is an item of a pathspec.
+type Pattern struct {
+	// Pattern is the pattern, without its magic, relative to the root of the
+	// repository.
+	Pattern string
+	// Exclude is set by the exclude magic, as in ":(exclude)vendor" or
+	// ":!vendor": the paths matching the pattern are removed from the ones
+	// matched by the other patterns.
+	Exclude bool
+	// Literal is set by the literal magic: the wildcards of the pattern are
+	// matched literally.
+	Literal bool
+	// Glob is set by the glob magic: the wildcards do not match slashes,
+	// except for "**", as in the gitignore files. By default, "*" matches
+	// slashes as well.
+	Glob bool
+	// ICase is set by the icase magic: the pattern is matched ignoring case.
+	ICase bool
+}
+
+// ParsePattern parses a pathspec item, along with its magic in its long
+// form, such as ":(exclude,glob)vendor/**", or in its short form, such as
+// ":!vendor". As the patterns are relative to the root of the repository, the
+// top magic, ":/" or ":(top)", is accepted and ignored.
+func ParsePattern(s string) (Pattern, error) {
+	var p Pattern
+	if !strings.HasPrefix(s, ":") {
+		p.Pattern = clean(s)
+		return p, nil
+	}
+
+	s = s[1:]
+	if strings.HasPrefix(s, "(") {
+		end := strings.IndexByte(s, ')')
+		if end < 0 {
+			return p, fmt.Errorf("%w: missing ')' in %q", ErrInvalidMagic, s)
+		}
+
+		for _, magic := range strings.Split(s[1:end], ",") {
+			switch strings.TrimSpace(magic) {
+			case "top", "":
+			case "exclude":
+				p.Exclude = true
+			case "literal":
+				p.Literal = true
+			case "glob":
+				p.Glob = true
+			case "icase":
+				p.ICase = true
+			default:
+				return p, fmt.Errorf("%w: %q", ErrInvalidMagic, magic)
+			}
+		}
+
+		s = s[end+1:]
+	} else {
+	short:
+		for len(s) > 0 {
+			switch s[0] {
+			case '/':
+			case '!', '^':
+				p.Exclude = true
+			case ':':
+				s = s[1:]
+				break short
+			default:
+				break short
+			}
+
+			s = s[1:]
+		}
+	}
+
+	if p.Literal && p.Glob {
+		return p, fmt.Errorf("%w: literal and glob are incompatible", ErrInvalidMagic)
+	}
+
+	p.Pattern = clean(s)
+	return p, nil
+}
+
+// clean removes the leading "./" of a pattern, and returns "" for the
+// patterns matching the whole repository.
+func clean(s string) string {
+	for strings.HasPrefix(s, "./") {
+		s = s[2:]
+	}
+
+	if s == "." {
+		return ""
+	}
+
+	return s
+}
+
+// Match returns whether the path, relative to the root of the repository and
+// slash separated, matches the pattern. As in git, a pattern matches the paths
+// it names, and the paths inside the directories it names, such as "vendor"
+// matching "vendor/foo.go". The exclude magic is ignored.
+func (p Pattern) Match(path string) bool {
+	pattern := p.Pattern
+	if p.ICase {
+		pattern, path = strings.ToLower(pattern), strings.ToLower(path)
+	}
+
+	// As in git, the patterns with wildcards also match the paths they name
+	// literally.
+	if matchPrefix(pattern, path) {
+		return true
+	}
+
+	// The leading part of the pattern without wildcards must match as is.
+	literal := pattern[:wildcardIndex(pattern)]
+	if p.Literal || literal == pattern || !strings.HasPrefix(path, literal) {
+		return false
+	}
+
+	return wildmatch(pattern, path, p.Glob)
+}
+
+// matchPrefix returns whether path is, or is inside, the given path prefix.
+func matchPrefix(prefix, path string) bool {
+	if prefix == "" || prefix == path {
+		return true
+	}
+
+	if strings.HasSuffix(prefix, "/") {
+		return strings.HasPrefix(path, prefix)
+	}
+
+	return strings.HasPrefix(path, prefix+"/")
+}
+
+// wildcardIndex returns the index of the first wildcard of the pattern, or
+// its length.
+func wildcardIndex(pattern string) int {
+	if i := strings.IndexAny(pattern, `*?[\`); i >= 0 {
+		return i
+	}
+
+	return len(pattern)
+}
+
+// PathSpec is a list of patterns, as given on the command line of git.
+type PathSpec []Pattern
+
+// Parse parses a list of pathspec items, as ParsePattern.
+func Parse(specs []string) (PathSpec, error) {
+	ps := make(PathSpec, 0, len(specs))
+	for _, s := range specs {
+		p, err := ParsePattern(s)
+		if err != nil {
+			return nil, err
+		}
+
+		ps = append(ps, p)
+	}
+
+	return ps, nil
+}
+
+// Match returns whether the path, relative to the root of the repository and
+// slash separated, matches at least one of the patterns without the exclude
+// magic, and none of the ones with it. When all the patterns are exclude
+// ones, or without patterns, all the paths but the excluded ones match.
+func (ps PathSpec) Match(path string) bool {
+	var included, hasIncludes bool
+	for _, p := range ps {
+		if p.Exclude {
+			if p.Match(path) {
+				return false
+			}
+
+			continue
+		}
+
+		hasIncludes = true
+		included = included || p.Match(path)
+	}
+
+	return included || !hasIncludes
+}
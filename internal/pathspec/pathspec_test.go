@@ -0,0 +1,143 @@
+package pathspec
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var paths = []string{
+	"README.md",
+	"main.go",
+	"cmd/foo/main.go",
+	"cmd/foo/main_test.go",
+	"vendor/a/a.go",
+	"vendor/b.go",
+	"docs/Guide.md",
+	"a[1].txt",
+}
+
+func TestPathSpecMatch(t *testing.T) {
+	t.Parallel()
+
+	for _, tc := range []struct {
+		specs    []string
+		expected []string
+	}{
+		{nil, paths},
+		{[]string{"."}, paths},
+		{[]string{"cmd"}, []string{"cmd/foo/main.go", "cmd/foo/main_test.go"}},
+		{[]string{"cmd/"}, []string{"cmd/foo/main.go", "cmd/foo/main_test.go"}},
+		{[]string{"./cmd/foo"}, []string{"cmd/foo/main.go", "cmd/foo/main_test.go"}},
+		{[]string{"cm"}, nil},
+		{[]string{"*.go"}, []string{"main.go", "cmd/foo/main.go", "cmd/foo/main_test.go", "vendor/a/a.go", "vendor/b.go"}},
+		{[]string{":(glob)*.go"}, []string{"main.go"}},
+		{[]string{":(glob)**/*.go"}, []string{"main.go", "cmd/foo/main.go", "cmd/foo/main_test.go", "vendor/a/a.go", "vendor/b.go"}},
+		{[]string{":(glob)vendor/**"}, []string{"vendor/a/a.go", "vendor/b.go"}},
+		{[]string{":(glob)cmd/**/main.go"}, []string{"cmd/foo/main.go"}},
+		{[]string{"cmd/*_test.go"}, []string{"cmd/foo/main_test.go"}},
+		{[]string{"*.go", ":!vendor/**"}, []string{"main.go", "cmd/foo/main.go", "cmd/foo/main_test.go"}},
+		{[]string{":!vendor", ":^cmd"}, []string{"README.md", "main.go", "docs/Guide.md", "a[1].txt"}},
+		{[]string{":(exclude)*.go"}, []string{"README.md", "docs/Guide.md", "a[1].txt"}},
+		{[]string{":/cmd"}, []string{"cmd/foo/main.go", "cmd/foo/main_test.go"}},
+		{[]string{":(icase)docs/guide.md"}, []string{"docs/Guide.md"}},
+		{[]string{"docs/guide.md"}, nil},
+		{[]string{"a[1].txt"}, []string{"a[1].txt"}},
+		{[]string{":(literal)a[1].txt"}, []string{"a[1].txt"}},
+		{[]string{"a\\[1].txt"}, []string{"a[1].txt"}},
+		{[]string{"[mR]*"}, []string{"README.md", "main.go"}},
+		{[]string{"[!a-m]*"}, []string{"README.md", "vendor/a/a.go", "vendor/b.go"}},
+		{[]string{"?ain.go"}, []string{"main.go"}},
+	} {
+		ps, err := Parse(tc.specs)
+		require.NoError(t, err)
+
+		var matched []string
+		for _, path := range paths {
+			if ps.Match(path) {
+				matched = append(matched, path)
+			}
+		}
+
+		assert.Equal(t, tc.expected, matched, "%q", tc.specs)
+	}
+}
+
+func TestParsePattern(t *testing.T) {
+	t.Parallel()
+
+	for s, expected := range map[string]Pattern{
+		"foo":                   {Pattern: "foo"},
+		":!foo":                 {Pattern: "foo", Exclude: true},
+		":/!:foo":               {Pattern: "foo", Exclude: true},
+		"::foo":                 {Pattern: "foo"},
+		":(exclude,icase)./foo": {Pattern: "foo", Exclude: true, ICase: true},
+		":(top,glob)**/foo":     {Pattern: "**/foo", Glob: true},
+		":(literal)*":           {Pattern: "*", Literal: true},
+	} {
+		p, err := ParsePattern(s)
+		require.NoError(t, err, s)
+		assert.Equal(t, expected, p, s)
+	}
+
+	for _, s := range []string{":(attr:foo)bar", ":(exclude", ":(literal,glob)foo"} {
+		_, err := ParsePattern(s)
+		assert.ErrorIs(t, err, ErrInvalidMagic, s)
+	}
+}
+
+func TestWildmatch(t *testing.T) {
+	t.Parallel()
+
+	for _, tc := range []struct {
+		pattern, name string
+		pathname      bool
+		expected      bool
+	}{
+		{"*", "a/b", false, true},
+		{"*", "a/b", true, false},
+		{"a/**/b", "a/b", true, true},
+		{"a/**/b", "a/x/y/b", true, true},
+		{"a/**", "a/x/y", true, true},
+		{"**", "a/x", true, true},
+		{"a**b", "a/b", true, false},
+		{"a**b", "axxb", true, true},
+		{"a?b", "a/b", false, true},
+		{"a?b", "a/b", true, false},
+		{"[a-c]x", "bx", true, true},
+		{"[^a-c]x", "bx", true, false},
+		{"[]]x", "]x", true, true},
+		{"[a", "[a", true, true},
+		{"\\*", "*", true, true},
+		{"\\*", "a", true, false},
+	} {
+		assert.Equal(t, tc.expected, wildmatch(tc.pattern, tc.name, tc.pathname), "%q %q %v", tc.pattern, tc.name, tc.pathname)
+	}
+}
+
+func TestWildmatchPathname(t *testing.T) {
+	t.Parallel()
+
+	for _, tc := range []struct {
+		pattern, name string
+		fold          bool
+		expected      bool
+	}{
+		{"/home/*/src/**", "/home/foo/src/a/.git", false, true},
+		{"/home/*/src/**", "/home/foo/bar/src/a/.git", false, false},
+		{"**/src/**", "/Home/Foo/Src/a/.git", false, false},
+		{"**/src/**", "/Home/Foo/Src/a/.git", true, true},
+		{"feature/[A-C]*", "feature/b-1", true, true},
+		{"feature/[A-C]*", "feature/b-1", false, false},
+		{"a/*/c", "a/b/c", false, true},
+		{"a/*/c", "a/b/b/c", false, false},
+		{"a/**/c", "a/c", false, true},
+		{"a?c", "a/c", false, false},
+		{"a[!bc]d", "aed", false, true},
+		{`a\*c`, "abc", false, false},
+		{"a.c", "abc", false, false},
+	} {
+		assert.Equal(t, tc.expected, WildmatchPathname(tc.pattern, tc.name, tc.fold), "%q %q %v", tc.pattern, tc.name, tc.fold)
+	}
+}
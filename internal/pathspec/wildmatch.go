@@ -0,0 +1,158 @@
+package pathspec
+
+import "strings"
+
+// wildmatch returns whether name matches the shell wildcard pattern, as the
+// wildmatch function of git. The "*" and "?" wildcards match slashes unless
+// pathname is set, in which case only "**" does when it is a whole path
+// component, as in "a/**/b" and "a/**".
+func wildmatch(pattern, name string, pathname bool) bool {
+	return match(pattern, name, pathname, true)
+}
+
+// Wildmatch returns whether name matches the shell wildcard pattern, the "*"
+// and "?" wildcards matching slashes, as git matches the names of the
+// references against patterns.
+func Wildmatch(pattern, name string) bool {
+	return wildmatch(pattern, name, false)
+}
+
+// WildmatchPathname returns whether name matches the shell wildcard pattern,
+// the "*" and "?" wildcards not matching slashes, as git matches the paths
+// and branches of the conditions of the included config files. The case is
+// ignored if fold is set.
+func WildmatchPathname(pattern, name string, fold bool) bool {
+	if fold {
+		pattern, name = strings.ToLower(pattern), strings.ToLower(name)
+	}
+
+	return wildmatch(pattern, name, true)
+}
+
+// match matches name against pattern, which is at the start of a path
+// component if componentStart is set.
+func match(pattern, name string, pathname, componentStart bool) bool {
+	for len(pattern) > 0 {
+		switch c := pattern[0]; c {
+		case '*':
+			rest := pattern[1:]
+			for len(rest) > 0 && rest[0] == '*' {
+				rest = rest[1:]
+			}
+
+			doubleStar := len(pattern)-len(rest) > 1 && componentStart &&
+				(len(rest) == 0 || rest[0] == '/')
+
+			if !pathname || doubleStar {
+				// "**/" also matches no directory, as in "a/**/b" matching
+				// "a/b".
+				if pathname && len(rest) > 0 && rest[0] == '/' && match(rest[1:], name, pathname, true) {
+					return true
+				}
+
+				for i := 0; i <= len(name); i++ {
+					if match(rest, name[i:], pathname, false) {
+						return true
+					}
+				}
+
+				return false
+			}
+
+			for i := 0; i <= len(name); i++ {
+				if match(rest, name[i:], pathname, false) {
+					return true
+				}
+
+				if i < len(name) && name[i] == '/' {
+					return false
+				}
+			}
+
+			return false
+		case '?':
+			if len(name) == 0 || pathname && name[0] == '/' {
+				return false
+			}
+
+			pattern, name, componentStart = pattern[1:], name[1:], false
+		case '[':
+			if len(name) == 0 || pathname && name[0] == '/' {
+				return false
+			}
+
+			matched, n, ok := matchClass(pattern, name[0])
+			if !ok {
+				// An unterminated class is matched literally.
+				if name[0] != '[' {
+					return false
+				}
+
+				pattern, name, componentStart = pattern[1:], name[1:], false
+				continue
+			}
+
+			if !matched {
+				return false
+			}
+
+			pattern, name, componentStart = pattern[n:], name[1:], false
+		case '\\':
+			if len(pattern) > 1 {
+				pattern = pattern[1:]
+			}
+
+			fallthrough
+		default:
+			if len(name) == 0 || name[0] != pattern[0] {
+				return false
+			}
+
+			componentStart = pattern[0] == '/'
+			pattern, name = pattern[1:], name[1:]
+		}
+	}
+
+	return len(name) == 0
+}
+
+// matchClass matches c against the character class at the start of pattern,
+// such as "[a-z]" or "[!0-9]", returning whether c matches and the length of
+// the class. ok is false if the class is not terminated.
+func matchClass(pattern string, c byte) (matched bool, n int, ok bool) {
+	i := 1
+	negated := i < len(pattern) && (pattern[i] == '!' || pattern[i] == '^')
+	if negated {
+		i++
+	}
+
+	for first := true; i < len(pattern); first = false {
+		if pattern[i] == ']' && !first {
+			return matched != negated, i + 1, true
+		}
+
+		lo := pattern[i]
+		if lo == '\\' && i+1 < len(pattern) {
+			i++
+			lo = pattern[i]
+		}
+
+		i++
+		hi := lo
+		if i+1 < len(pattern) && pattern[i] == '-' && pattern[i+1] != ']' {
+			hi = pattern[i+1]
+			if hi == '\\' && i+2 < len(pattern) {
+				i++
+				hi = pattern[i+1]
+			}
+
+			i += 2
+		}
+
+		if lo <= c && c <= hi {
+			matched = true
+		}
+	}
+
+	return false, 0, false
+}
@@ -0,0 +1,95 @@
+package revision
+
+import (
+	"strconv"
+	"strings"
+	"time"
+)
+
+// dateLayouts are the layouts of the absolute dates of @{<date>}. The dates
+// without timezone are in the local time, as in git.
+var dateLayouts = []string{
+	time.RFC3339,
+	"2006-01-02T15:04:05",
+	"2006-01-02 15:04:05 -0700",
+	"2006-01-02 15:04:05",
+	"2006-01-02",
+}
+
+// dateUnits are the units of the relative dates of @{<date>}.
+var dateUnits = map[string]time.Duration{
+	"second": time.Second,
+	"minute": time.Minute,
+	"hour":   time.Hour,
+	"day":    24 * time.Hour,
+	"week":   7 * 24 * time.Hour,
+}
+
+// parseDate parses the date of @{<date>}, either an absolute date such as
+// 2006-01-02T15:04:05Z, or a relative one such as "yesterday", "2 days ago"
+// or "1.week.ago", relative to now.
+func parseDate(s string, now time.Time) (time.Time, bool) {
+	for _, layout := range dateLayouts {
+		if t, err := time.ParseInLocation(layout, s, time.Local); err == nil {
+			return t, true
+		}
+	}
+
+	fields := strings.FieldsFunc(strings.ToLower(s), func(r rune) bool {
+		return r == ' ' || r == '.'
+	})
+
+	switch {
+	case len(fields) == 1 && fields[0] == "now":
+		return now, true
+	case len(fields) == 1 && fields[0] == "yesterday":
+		return now.AddDate(0, 0, -1), true
+	case len(fields) < 3 || len(fields)%2 == 0 || fields[len(fields)-1] != "ago":
+		return time.Time{}, false
+	}
+
+	t := now
+	for i := 0; i < len(fields)-1; i += 2 {
+		n, err := strconv.Atoi(fields[i])
+		if err != nil || n < 0 {
+			return time.Time{}, false
+		}
+
+		unit := strings.TrimSuffix(fields[i+1], "s")
+		switch unit {
+		case "month":
+			t = t.AddDate(0, -n, 0)
+		case "year":
+			t = t.AddDate(-n, 0, 0)
+		default:
+			d, ok := dateUnits[unit]
+			if !ok {
+				return time.Time{}, false
+			}
+
+			t = t.Add(-time.Duration(n) * d)
+		}
+	}
+
+	return t, true
+}
+
+// ParseExpiryDate parses an expiry date of the gc.* config, such as
+// gc.pruneExpire, as git does: "never" or "false" never expire, returning a
+// zero time, "now" or "all" expire everything, returning now, and the other
+// values are dates as the ones of @{<date>}, the relative ones being
+// relative to now even without "ago", such as "2.weeks".
+func ParseExpiryDate(s string, now time.Time) (time.Time, bool) {
+	switch strings.ToLower(s) {
+	case "never", "false":
+		return time.Time{}, true
+	case "now", "all":
+		return now, true
+	}
+
+	if t, ok := parseDate(s, now); ok {
+		return t, true
+	}
+
+	return parseDate(s+" ago", now)
+}
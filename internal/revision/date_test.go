@@ -0,0 +1,69 @@
+package revision
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseDate(t *testing.T) {
+	t.Parallel()
+
+	now := time.Date(2024, 3, 31, 12, 0, 0, 0, time.UTC)
+	for input, expected := range map[string]time.Time{
+		"2016-12-16T21:42:47Z":      time.Date(2016, 12, 16, 21, 42, 47, 0, time.UTC),
+		"2016-12-16T21:42:47+02:00": time.Date(2016, 12, 16, 19, 42, 47, 0, time.UTC),
+		"2016-12-16 21:42:47 -0100": time.Date(2016, 12, 16, 22, 42, 47, 0, time.UTC),
+		"2016-12-16 21:42:47":       time.Date(2016, 12, 16, 21, 42, 47, 0, time.Local),
+		"2016-12-16":                time.Date(2016, 12, 16, 0, 0, 0, 0, time.Local),
+		"now":                       now,
+		"yesterday":                 now.AddDate(0, 0, -1),
+		"2 days ago":                now.Add(-48 * time.Hour),
+		"1.week.ago":                now.Add(-7 * 24 * time.Hour),
+		"3 hours 30 minutes ago":    now.Add(-3*time.Hour - 30*time.Minute),
+		"10.seconds.ago":            now.Add(-10 * time.Second),
+		"1 month ago":               time.Date(2024, 3, 2, 12, 0, 0, 0, time.UTC),
+		"2 Years ago":               time.Date(2022, 3, 31, 12, 0, 0, 0, time.UTC),
+	} {
+		result, ok := parseDate(input, now)
+		if assert.True(t, ok, input) {
+			assert.True(t, expected.Equal(result), "%s: expected %s, got %s", input, expected, result)
+		}
+	}
+
+	for _, input := range []string{"", "test", "2 days", "days ago", "2 fortnights ago", "-1 day ago", "1 day 2 ago"} {
+		_, ok := parseDate(input, now)
+		assert.False(t, ok, input)
+	}
+}
+
+func TestParseExpiryDate(t *testing.T) {
+	t.Parallel()
+
+	now := time.Date(2024, 3, 31, 12, 0, 0, 0, time.UTC)
+	for input, expected := range map[string]time.Time{
+		"now":                  now,
+		"all":                  now,
+		"2.weeks.ago":          now.Add(-14 * 24 * time.Hour),
+		"2.weeks":              now.Add(-14 * 24 * time.Hour),
+		"90 days":              now.Add(-90 * 24 * time.Hour),
+		"2016-12-16T21:42:47Z": time.Date(2016, 12, 16, 21, 42, 47, 0, time.UTC),
+	} {
+		result, ok := ParseExpiryDate(input, now)
+		if assert.True(t, ok, input) {
+			assert.True(t, expected.Equal(result), "%s: expected %s, got %s", input, expected, result)
+		}
+	}
+
+	for _, input := range []string{"never", "false"} {
+		result, ok := ParseExpiryDate(input, now)
+		assert.True(t, ok, input)
+		assert.True(t, result.IsZero(), input)
+	}
+
+	for _, input := range []string{"", "test", "days", "2 fortnights"} {
+		_, ok := ParseExpiryDate(input, now)
+		assert.False(t, ok, input)
+	}
+}
@@ -46,7 +46,7 @@ type CaretReg struct {
 	Negate bool
 }
 
-// CaretType represents ^{commit}
+// CaretType represents ^{commit}, or ^{} when ObjectType is empty
 type CaretType struct {
 	ObjectType string
 }
@@ -71,7 +71,7 @@ type AtPush struct {
 	BranchName string
 }
 
-// AtDate represents @{"2006-01-02T15:04:05Z"}
+// AtDate represents @{"2006-01-02T15:04:05Z"}, @{yesterday}, @{2 days ago}
 type AtDate struct {
 	Date time.Time
 }
@@ -93,6 +93,10 @@ type ColonStagePath struct {
 	Stage int
 }
 
+// TripleDot represents the ... of <rev>...<rev>, whose merge base is
+// resolved, HEAD being used for an empty side
+type TripleDot struct{}
+
 // Parser represents a parser
 // use to tokenize and transform to revisioner chunks
 // a given string
@@ -155,6 +159,8 @@ func (p *Parser) Parse() ([]Revisioner, error) {
 			rev, err = p.parseCaret()
 		case colon:
 			rev, err = p.parseColon()
+		case tripleDot:
+			rev = TripleDot{}
 		case eof:
 			err = p.validateFullRevision(&revs)
 			if err != nil {
@@ -177,6 +183,26 @@ func (p *Parser) Parse() ([]Revisioner, error) {
 
 // validateFullRevision ensures all revisioner chunks make a valid revision
 func (p *Parser) validateFullRevision(chunks *[]Revisioner) error {
+	// Both sides of <rev>...<rev> are revisions of their own.
+	for i, chunk := range *chunks {
+		if _, ok := chunk.(TripleDot); !ok {
+			continue
+		}
+
+		left, right := (*chunks)[:i], (*chunks)[i+1:]
+		for _, chunk := range right {
+			if _, ok := chunk.(TripleDot); ok {
+				return &ErrInvalidRevision{`"..." statement must be defined once, between two revisions`}
+			}
+		}
+
+		if err := p.validateFullRevision(&left); err != nil {
+			return err
+		}
+
+		return p.validateFullRevision(&right)
+	}
+
 	var hasReference bool
 
 	for i, chunk := range *chunks {
@@ -188,20 +214,24 @@ func (p *Parser) validateFullRevision(chunks *[]Revisioner) error {
 				return &ErrInvalidRevision{`reference must be defined once at the beginning`}
 			}
 		case AtDate:
-			if len(*chunks) == 1 || hasReference && len(*chunks) == 2 {
-				return nil
+			if i == 0 || hasReference && i == 1 {
+				// The reflog entry can be followed by a path, as a reference.
+				hasReference = true
+				continue
 			}
 
 			return &ErrInvalidRevision{`"@" statement is not valid, could be : <refname>@{<ISO-8601 date>}, @{<ISO-8601 date>}`}
 		case AtReflog:
-			if len(*chunks) == 1 || hasReference && len(*chunks) == 2 {
-				return nil
+			if i == 0 || hasReference && i == 1 {
+				hasReference = true
+				continue
 			}
 
 			return &ErrInvalidRevision{`"@" statement is not valid, could be : <refname>@{<n>}, @{<n>}`}
 		case AtCheckout:
-			if len(*chunks) == 1 {
-				return nil
+			if i == 0 {
+				hasReference = true
+				continue
 			}
 
 			return &ErrInvalidRevision{`"@" statement is not valid, could be : @{-<n>}`}
@@ -307,9 +337,9 @@ func (p *Parser) parseAt() (Revisioner, error) {
 
 			switch tok {
 			case cbrace:
-				t, err := time.Parse("2006-01-02T15:04:05Z", date)
-				if err != nil {
-					return nil, &ErrInvalidRevision{fmt.Sprintf(`wrong date "%s" must fit ISO-8601 format : 2006-01-02T15:04:05Z`, date)}
+				t, ok := parseDate(date, time.Now())
+				if !ok {
+					return nil, &ErrInvalidRevision{fmt.Sprintf(`wrong date "%s" must fit ISO-8601 format : 2006-01-02T15:04:05Z, or be relative : yesterday, 2 days ago`, date)}
 				}
 
 				return AtDate{t}, nil
@@ -401,7 +431,7 @@ func (p *Parser) parseCaretBraces() (Revisioner, error) {
 		case tok == word && nextTok == cbrace && (lit == "commit" || lit == "tree" || lit == "blob" || lit == "tag" || lit == "object"):
 			return CaretType{lit}, nil
 		case re == "" && tok == cbrace:
-			return CaretType{"tag"}, nil
+			return CaretType{}, nil
 		case re == "" && tok == emark && nextTok == emark:
 			re += lit
 		case re == "" && tok == emark && nextTok == minus:
@@ -554,7 +584,7 @@ func (p *Parser) parseRef() (Revisioner, error) {
 		}
 
 		switch tok {
-		case eof, at, colon, tilde, caret:
+		case eof, at, colon, tilde, caret, tripleDot:
 			endOfRef = true
 		}
 
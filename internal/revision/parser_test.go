@@ -135,7 +135,20 @@ func (s *ParserSuite) TestParseWithValidExpression() {
 		},
 		"v0.99.8^{}": []Revisioner{
 			Ref("v0.99.8"),
-			CaretType{"tag"},
+			CaretType{},
+		},
+		"master@{1}~2": []Revisioner{
+			Ref("master"),
+			AtReflog{1},
+			TildePath{2},
+		},
+		"@{2016-12-16T21:42:47Z}^{tree}": []Revisioner{
+			AtDate{tim},
+			CaretType{"tree"},
+		},
+		"@{-1}~": []Revisioner{
+			AtCheckout{1},
+			TildePath{1},
 		},
 		"HEAD^{/fix nasty bug}": []Revisioner{
 			Ref("HEAD"),
@@ -167,6 +180,29 @@ func (s *ParserSuite) TestParseWithValidExpression() {
 		":3:README": []Revisioner{
 			ColonStagePath{"README", 3},
 		},
+		"master...branch~1": []Revisioner{
+			Ref("master"),
+			TripleDot{},
+			Ref("branch"),
+			TildePath{1},
+		},
+		"...HEAD^{/wip...}": []Revisioner{
+			TripleDot{},
+			Ref("HEAD"),
+			CaretReg{regexp.MustCompile("wip..."), false},
+		},
+		"HEAD^{/wip...}": []Revisioner{
+			Ref("HEAD"),
+			CaretReg{regexp.MustCompile("wip..."), false},
+		},
+		":/fix...bug": []Revisioner{
+			ColonReg{regexp.MustCompile("fix...bug"), false},
+		},
+		"@~...": []Revisioner{
+			Ref("HEAD"),
+			TildePath{1},
+			TripleDot{},
+		},
 		"master~1^{/update}~5~^^1": []Revisioner{
 			Ref("master"),
 			TildePath{1},
@@ -191,6 +227,8 @@ func (s *ParserSuite) TestParseWithValidExpression() {
 func (s *ParserSuite) TestParseWithInvalidExpression() {
 	datas := map[string]error{
 		"..":                              &ErrInvalidRevision{`must not start with "."`},
+		"master....branch":                &ErrInvalidRevision{`must not start with "."`},
+		"master...branch...HEAD":          &ErrInvalidRevision{`"..." statement must be defined once, between two revisions`},
 		"master^1master":                  &ErrInvalidRevision{`reference must be defined once at the beginning`},
 		"master^1@{2016-12-16T21:42:47Z}": &ErrInvalidRevision{`"@" statement is not valid, could be : <refname>@{<ISO-8601 date>}, @{<ISO-8601 date>}`},
 		"master^1@{1}":                    &ErrInvalidRevision{`"@" statement is not valid, could be : <refname>@{<n>}, @{<n>}`},
@@ -240,7 +278,7 @@ func (s *ParserSuite) TestParseAtWithValidExpression() {
 
 func (s *ParserSuite) TestParseAtWithInvalidExpression() {
 	datas := map[string]error{
-		"{test}": &ErrInvalidRevision{`wrong date "test" must fit ISO-8601 format : 2006-01-02T15:04:05Z`},
+		"{test}": &ErrInvalidRevision{`wrong date "test" must fit ISO-8601 format : 2006-01-02T15:04:05Z, or be relative : yesterday, 2 days ago`},
 		"{-1":    &ErrInvalidRevision{`missing "}" in @{-n} structure`},
 	}
 
@@ -257,7 +295,7 @@ func (s *ParserSuite) TestParseCaretWithValidExpression() {
 	datas := map[string]Revisioner{
 		"":                    CaretPath{1},
 		"2":                   CaretPath{2},
-		"{}":                  CaretType{"tag"},
+		"{}":                  CaretType{},
 		"{commit}":            CaretType{"commit"},
 		"{tree}":              CaretType{"tree"},
 		"{blob}":              CaretType{"blob"},
@@ -78,6 +78,12 @@ func (s *scanner) scan() (token, string, error) {
 	case '^':
 		return caret, string(ch), nil
 	case '.':
+		// The merge base of A...B is the only use of three dots in a row.
+		if next, err := s.r.Peek(2); err == nil && string(next) == ".." {
+			_, _ = s.r.Discard(2)
+			return tripleDot, "...", nil
+		}
+
 		return dot, string(ch), nil
 	case '/':
 		return slash, string(ch), nil
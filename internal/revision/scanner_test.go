@@ -51,6 +51,21 @@ func (s *ScannerSuite) TestReadDot() {
 	s.Equal(dot, tok)
 }
 
+func (s *ScannerSuite) TestReadTripleDot() {
+	scanner := newScanner(bytes.NewBufferString("...."))
+	tok, data, err := scanner.scan()
+
+	s.NoError(err)
+	s.Equal("...", data)
+	s.Equal(tripleDot, tok)
+
+	tok, data, err = scanner.scan()
+
+	s.NoError(err)
+	s.Equal(".", data)
+	s.Equal(dot, tok)
+}
+
 func (s *ScannerSuite) TestReadSlash() {
 	scanner := newScanner(bytes.NewBufferString("/"))
 	tok, data, err := scanner.scan()
@@ -24,5 +24,6 @@ const (
 	space
 	tilde
 	tokenError
+	tripleDot
 	word
 )
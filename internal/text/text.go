@@ -0,0 +1,37 @@
+// Package text splits the contents of files in lines, as they are compared
+// by the diffs and the merges.
+package text
+
+// SplitLines returns the lines of s, each with its line break, the last one
+// lacking it if s does not end with a newline.
+func SplitLines[T ~string | ~[]byte](s T) []T {
+	var lines []T
+	start := 0
+	for i := 0; i < len(s); i++ {
+		if s[i] == '\n' {
+			lines = append(lines, s[start:i+1])
+			start = i + 1
+		}
+	}
+
+	if start < len(s) {
+		lines = append(lines, s[start:])
+	}
+
+	return lines
+}
+
+// EqualLines reports whether a and b hold the same lines.
+func EqualLines[T ~string | ~[]byte](a, b []T) bool {
+	if len(a) != len(b) {
+		return false
+	}
+
+	for i := range a {
+		if string(a[i]) != string(b[i]) {
+			return false
+		}
+	}
+
+	return true
+}
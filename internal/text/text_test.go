@@ -0,0 +1,43 @@
+package text
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSplitLines(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		content string
+		want    []string
+	}{
+		{"", nil},
+		{"\n", []string{"\n"}},
+		{"a", []string{"a"}},
+		{"a\nb\n", []string{"a\n", "b\n"}},
+		{"a\r\n\nb", []string{"a\r\n", "\n", "b"}},
+	}
+
+	for _, tc := range tests {
+		assert.Equal(t, tc.want, SplitLines(tc.content), tc.content)
+
+		var want [][]byte
+		for _, l := range tc.want {
+			want = append(want, []byte(l))
+		}
+
+		assert.Equal(t, want, SplitLines([]byte(tc.content)), tc.content)
+	}
+}
+
+func TestEqualLines(t *testing.T) {
+	t.Parallel()
+
+	assert.True(t, EqualLines([]string{"a\n", "b"}, []string{"a\n", "b"}))
+	assert.True(t, EqualLines[string](nil, []string{}))
+	assert.False(t, EqualLines([]string{"a\n", "b"}, []string{"a\n", "b\n"}))
+	assert.False(t, EqualLines([]string{"a\n"}, []string{"a\n", "b"}))
+	assert.True(t, EqualLines([][]byte{[]byte("a\n")}, [][]byte{[]byte("a\n")}))
+}
@@ -1,7 +1,9 @@
 package url
 
 import (
+	neturl "net/url"
 	"regexp"
+	"strings"
 )
 
 var (
@@ -37,3 +39,35 @@ func FindScpLikeComponents(url string) (user, host, port, path string) {
 func IsLocalEndpoint(url string) bool {
 	return !MatchesScheme(url) && !MatchesScpLike(url)
 }
+
+// MatchesConfigURL returns true if the URL of a <section>.<url> subsection of
+// the git config, as credential.<url> or http.<url>, matches u: their schemes
+// and hosts must be the same, a *. prefix of the host matching any subdomain,
+// and the path of the subsection, if any, must be a prefix of the one of u. A
+// subsection without a scheme matches the host only.
+func MatchesConfigURL(pattern string, u *neturl.URL) bool {
+	if !strings.Contains(pattern, "://") {
+		return matchesHost(pattern, u.Host)
+	}
+
+	p, err := neturl.Parse(pattern)
+	if err != nil || !strings.EqualFold(p.Scheme, u.Scheme) || !matchesHost(p.Host, u.Host) {
+		return false
+	}
+
+	if p.User != nil && u.User != nil && p.User.Username() != u.User.Username() {
+		return false
+	}
+
+	path := strings.TrimSuffix(p.Path, "/")
+	return path == "" || u.Path == path || strings.HasPrefix(u.Path, path+"/")
+}
+
+func matchesHost(pattern, host string) bool {
+	if suffix, ok := strings.CutPrefix(pattern, "*."); ok {
+		name, domain, found := strings.Cut(host, ".")
+		return found && name != "" && strings.EqualFold(domain, suffix)
+	}
+
+	return strings.EqualFold(pattern, host)
+}
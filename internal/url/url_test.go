@@ -1,6 +1,7 @@
 package url
 
 import (
+	neturl "net/url"
 	"testing"
 
 	"github.com/stretchr/testify/suite"
@@ -102,3 +103,27 @@ func (s *URLSuite) TestFindScpLikeComponents() {
 		s.Equal(tc.path, path, tc.url)
 	}
 }
+
+func (s *URLSuite) TestMatchesConfigURL() {
+	for _, tc := range []struct {
+		pattern, url string
+		expected     bool
+	}{
+		{"https://example.com", "https://example.com/repo.git", true},
+		{"https://example.com/", "https://example.com/repo.git", true},
+		{"http://example.com", "https://example.com/repo.git", false},
+		{"https://example.com:8443", "https://example.com/repo.git", false},
+		{"https://example.com/org", "https://example.com/org/repo.git", true},
+		{"https://example.com/org", "https://example.com/organization/repo.git", false},
+		{"https://*.example.com", "https://git.example.com/repo.git", true},
+		{"https://*.example.com", "https://example.com/repo.git", false},
+		{"https://user@example.com", "https://user@example.com/repo.git", true},
+		{"https://user@example.com", "https://other@example.com/repo.git", false},
+		{"example.com", "https://example.com/repo.git", true},
+		{"example.com", "https://other.com/repo.git", false},
+	} {
+		u, err := neturl.Parse(tc.url)
+		s.Require().NoError(err)
+		s.Equal(tc.expected, MatchesConfigURL(tc.pattern, u), "%s %s", tc.pattern, tc.url)
+	}
+}
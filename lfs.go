@@ -0,0 +1,277 @@
+package git
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path"
+	"sync"
+
+	"github.com/go-git/go-billy/v6"
+	"github.com/go-git/go-billy/v6/memfs"
+
+	formatlfs "github.com/go-git/go-git/v6/plumbing/format/lfs"
+	githttp "github.com/go-git/go-git/v6/plumbing/transport/http"
+	"github.com/go-git/go-git/v6/plumbing/transport/lfs"
+)
+
+const (
+	lfsObjectsPath = "lfs/objects"
+	lfsTmpPath     = "lfs/tmp"
+)
+
+// ErrLFSObjectMismatch is returned when the content of a file fetched by the
+// Git LFS filter driver doesn't match its pointer.
+var ErrLFSObjectMismatch = errors.New("lfs object does not match its pointer")
+
+// LFSOptions describes how the Git LFS filter driver fetches the content of
+// the files.
+type LFSOptions struct {
+	// Endpoint is the URL of the LFS API. By default, it is read from the
+	// lfs.url and remote.<name>.lfsurl config options, or derived from the
+	// URL of the remote.
+	Endpoint string
+	// RemoteName is the name of the remote the LFS API is derived from,
+	// origin by default.
+	RemoteName string
+	// Client is the HTTP client used to request the LFS API,
+	// http.DefaultClient if nil.
+	Client *http.Client
+	// Auth credentials, if required, to use with the LFS API.
+	Auth githttp.AuthMethod
+}
+
+// NewLFSFilterDriver returns the Git LFS filter driver of the given
+// repository. On checkout, the pointers stored in the repository are
+// replaced by the content of the files, read from the lfs/objects directory
+// of the repository, or fetched from the LFS API of the remote. On add, the
+// content of the files is stored in that directory, and replaced by a
+// pointer. The objects are only kept in memory by the storers not based on a
+// filesystem.
+func NewLFSFilterDriver(r *Repository, o *LFSOptions) (FilterDriver, error) {
+	if o == nil {
+		o = &LFSOptions{}
+	}
+
+	fs := memfs.New()
+	if s, ok := r.Storer.(interface{ Filesystem() billy.Filesystem }); ok {
+		fs = s.Filesystem()
+	}
+
+	return &lfsFilterDriver{r: r, o: *o, fs: fs}, nil
+}
+
+type lfsFilterDriver struct {
+	r  *Repository
+	o  LFSOptions
+	fs billy.Filesystem
+
+	once   sync.Once
+	client *lfs.Client
+	err    error
+}
+
+// Smudge returns the content of the file of the pointer read from r, or the
+// content read from r if it is not a pointer.
+func (d *lfsFilterDriver) Smudge(r io.Reader) io.Reader {
+	p, br, err := readPointer(r)
+	if err != nil {
+		return errReader{err}
+	}
+
+	if p == nil {
+		return br
+	}
+
+	f, err := d.fs.Open(lfsObjectPath(p.Oid))
+	if os.IsNotExist(err) {
+		if err = d.download(p); err == nil {
+			f, err = d.fs.Open(lfsObjectPath(p.Oid))
+		}
+	}
+
+	if err != nil {
+		return errReader{fmt.Errorf("lfs object %s: %w", p.Oid, err)}
+	}
+
+	return &closeOnEOF{f}
+}
+
+// Clean stores the content read from r as an LFS object, and returns its
+// pointer. If r is already a pointer, it is returned as is.
+func (d *lfsFilterDriver) Clean(r io.Reader) io.Reader {
+	p, br, err := readPointer(r)
+	if err != nil {
+		return errReader{err}
+	}
+
+	if p != nil {
+		return br
+	}
+
+	p, err = d.store(br, nil)
+	if err != nil {
+		return errReader{err}
+	}
+
+	var buf bytes.Buffer
+	if err := formatlfs.NewEncoder(&buf).Encode(p); err != nil {
+		return errReader{err}
+	}
+
+	return &buf
+}
+
+// readPointer reads the pointer from r, if any, and returns a reader of the
+// whole content of r.
+func readPointer(r io.Reader) (*formatlfs.Pointer, io.Reader, error) {
+	br := bufio.NewReaderSize(r, formatlfs.MaxPointerSize+1)
+	peek, err := br.Peek(formatlfs.MaxPointerSize + 1)
+	if err != nil && !errors.Is(err, io.EOF) {
+		return nil, nil, err
+	}
+
+	var p formatlfs.Pointer
+	if len(peek) > formatlfs.MaxPointerSize || formatlfs.NewDecoder(bytes.NewReader(peek)).Decode(&p) != nil {
+		return nil, br, nil
+	}
+
+	return &p, br, nil
+}
+
+// store stores the content read from r as an LFS object, and returns its
+// pointer. If expected is not nil, the content must match it.
+func (d *lfsFilterDriver) store(r io.Reader, expected *formatlfs.Pointer) (_ *formatlfs.Pointer, err error) {
+	if err := d.fs.MkdirAll(lfsTmpPath, 0o755); err != nil {
+		return nil, err
+	}
+
+	tmp, err := d.fs.TempFile(lfsTmpPath, "object")
+	if err != nil {
+		return nil, err
+	}
+
+	defer func() {
+		if err != nil {
+			_ = d.fs.Remove(tmp.Name())
+		}
+	}()
+
+	h := sha256.New()
+	size, err := io.Copy(io.MultiWriter(tmp, h), r)
+	if cerr := tmp.Close(); err == nil {
+		err = cerr
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	p := &formatlfs.Pointer{Oid: hex.EncodeToString(h.Sum(nil)), Size: size}
+	if expected != nil && *p != *expected {
+		return nil, fmt.Errorf("%w: %s", ErrLFSObjectMismatch, expected.Oid)
+	}
+
+	name := lfsObjectPath(p.Oid)
+	if _, err := d.fs.Lstat(name); err == nil {
+		return p, d.fs.Remove(tmp.Name())
+	}
+
+	if err := d.fs.MkdirAll(path.Dir(name), 0o755); err != nil {
+		return nil, err
+	}
+
+	return p, d.fs.Rename(tmp.Name(), name)
+}
+
+// download fetches the content of the given pointer from the LFS API, and
+// stores it.
+func (d *lfsFilterDriver) download(p *formatlfs.Pointer) error {
+	d.once.Do(func() {
+		d.client, d.err = d.newClient()
+	})
+
+	if d.err != nil {
+		return d.err
+	}
+
+	rc, err := d.client.Download(context.Background(), p)
+	if err != nil {
+		return err
+	}
+
+	defer rc.Close()
+	_, err = d.store(rc, p)
+	return err
+}
+
+// newClient returns the client of the LFS API, read from the config or
+// derived from the URL of the remote.
+func (d *lfsFilterDriver) newClient() (*lfs.Client, error) {
+	endpoint := d.o.Endpoint
+	if endpoint == "" {
+		cfg, err := d.r.Config()
+		if err != nil {
+			return nil, err
+		}
+
+		name := d.o.RemoteName
+		if name == "" {
+			name = DefaultRemoteName
+		}
+
+		endpoint = cfg.Raw.Section("lfs").Option("url")
+		if endpoint == "" {
+			endpoint = cfg.Raw.Section("remote").Subsection(name).Option("lfsurl")
+		}
+
+		if endpoint == "" {
+			remote, ok := cfg.Remotes[name]
+			if !ok || len(remote.URLs) == 0 {
+				return nil, fmt.Errorf("%w: %s", ErrRemoteNotFound, name)
+			}
+
+			if endpoint, err = lfs.Endpoint(remote.URLs[0]); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	return lfs.NewClient(endpoint, d.o.Client, d.o.Auth)
+}
+
+// lfsObjectPath returns the path of the LFS object with the given oid, in
+// the git directory.
+func lfsObjectPath(oid string) string {
+	return path.Join(lfsObjectsPath, oid[0:2], oid[2:4], oid)
+}
+
+type errReader struct {
+	err error
+}
+
+func (r errReader) Read([]byte) (int, error) {
+	return 0, r.err
+}
+
+// closeOnEOF closes the reader once read, as the readers returned by the
+// filter drivers are not closed.
+type closeOnEOF struct {
+	rc io.ReadCloser
+}
+
+func (r *closeOnEOF) Read(p []byte) (int, error) {
+	n, err := r.rc.Read(p)
+	if err != nil {
+		_ = r.rc.Close()
+	}
+
+	return n, err
+}
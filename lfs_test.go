@@ -0,0 +1,223 @@
+package git
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/go-git/go-billy/v6"
+	"github.com/go-git/go-billy/v6/memfs"
+	"github.com/go-git/go-billy/v6/util"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/go-git/go-git/v6/config"
+	"github.com/go-git/go-git/v6/plumbing"
+	"github.com/go-git/go-git/v6/plumbing/cache"
+	"github.com/go-git/go-git/v6/plumbing/object"
+	"github.com/go-git/go-git/v6/plumbing/transport/lfs"
+	"github.com/go-git/go-git/v6/storage/filesystem"
+)
+
+const (
+	lfsContent = "content\n"
+	lfsOid     = "434728a410a78f56fc1b5899c3593436e61ab0c731e9072d95e96db290205e53"
+	lfsPointer = "version https://git-lfs.github.com/spec/v1\noid sha256:" + lfsOid + "\nsize 8\n"
+)
+
+// newLFSServer returns a server of the LFS API of the repo.git repository,
+// serving the lfsContent object.
+func newLFSServer(t *testing.T) *httptest.Server {
+	t.Helper()
+
+	mux := http.NewServeMux()
+	srv := httptest.NewServer(mux)
+	t.Cleanup(srv.Close)
+
+	type object struct {
+		Oid     string         `json:"oid"`
+		Size    int64          `json:"size"`
+		Actions map[string]any `json:"actions,omitempty"`
+		Error   map[string]any `json:"error,omitempty"`
+	}
+
+	mux.HandleFunc("POST /repo.git/info/lfs/objects/batch", func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			Objects []*object `json:"objects"`
+		}
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&req))
+
+		for _, o := range req.Objects {
+			if o.Oid == lfsOid {
+				o.Actions = map[string]any{"download": map[string]any{"href": srv.URL + "/objects/" + o.Oid}}
+			} else {
+				o.Error = map[string]any{"code": http.StatusNotFound, "message": "Object does not exist"}
+			}
+		}
+
+		w.Header().Set("Content-Type", "application/vnd.git-lfs+json")
+		require.NoError(t, json.NewEncoder(w).Encode(map[string]any{"transfer": "basic", "objects": req.Objects}))
+	})
+
+	mux.HandleFunc("GET /objects/"+lfsOid, func(w http.ResponseWriter, _ *http.Request) {
+		_, _ = io.WriteString(w, lfsContent)
+	})
+
+	return srv
+}
+
+func readBlob(t *testing.T, r *Repository, name string) string {
+	t.Helper()
+
+	head, err := r.Head()
+	require.NoError(t, err)
+	c, err := r.CommitObject(head.Hash())
+	require.NoError(t, err)
+	f, err := c.File(name)
+	require.NoError(t, err)
+	content, err := f.Contents()
+	require.NoError(t, err)
+
+	return content
+}
+
+func commitFiles(t *testing.T, r *Repository, fs billy.Filesystem, files map[string]string) {
+	t.Helper()
+
+	w, err := r.Worktree()
+	require.NoError(t, err)
+	// The files are all written before being added, for the attributes to
+	// be read from the .gitattributes files.
+	for name, content := range files {
+		require.NoError(t, util.WriteFile(fs, name, []byte(content), 0o644))
+	}
+
+	for name := range files {
+		_, err := w.Add(name)
+		require.NoError(t, err)
+	}
+
+	_, err = w.Commit("files\n", &CommitOptions{Author: &object.Signature{Name: "foo", Email: "foo@foo.foo"}})
+	require.NoError(t, err)
+}
+
+func TestLFSFilterDriver(t *testing.T) {
+	t.Parallel()
+
+	srv := newLFSServer(t)
+	st := filesystem.NewStorage(memfs.New(), cache.NewObjectLRUDefault())
+	fs := memfs.New()
+	r, err := Init(st, WithWorkTree(fs))
+	require.NoError(t, err)
+	_, err = r.CreateRemote(&config.RemoteConfig{Name: DefaultRemoteName, URLs: []string{srv.URL + "/repo.git"}})
+	require.NoError(t, err)
+
+	commitFiles(t, r, fs, map[string]string{
+		".gitattributes": "*.bin filter=lfs\n",
+		"a.bin":          lfsContent,
+		"b.txt":          lfsContent,
+	})
+
+	// The content of the filtered files is stored in the lfs directory, and
+	// replaced by a pointer.
+	assert.Equal(t, lfsPointer, readBlob(t, r, "a.bin"))
+	assert.Equal(t, lfsContent, readBlob(t, r, "b.txt"))
+	object := "lfs/objects/43/47/" + lfsOid
+	content, err := util.ReadFile(st.Filesystem(), object)
+	require.NoError(t, err)
+	assert.Equal(t, lfsContent, string(content))
+
+	w, err := r.Worktree()
+	require.NoError(t, err)
+	status, err := w.Status()
+	require.NoError(t, err)
+	assert.True(t, status.IsClean(), status)
+
+	// The missing objects are fetched from the LFS API of the remote.
+	require.NoError(t, util.RemoveAll(st.Filesystem(), "lfs"))
+	require.NoError(t, fs.Remove("a.bin"))
+	require.NoError(t, w.Reset(&ResetOptions{Mode: HardReset}))
+
+	content, err = util.ReadFile(fs, "a.bin")
+	require.NoError(t, err)
+	assert.Equal(t, lfsContent, string(content))
+	_, err = st.Filesystem().Lstat(object)
+	require.NoError(t, err)
+
+	status, err = w.Status()
+	require.NoError(t, err)
+	assert.True(t, status.IsClean(), status)
+
+	// The pointers are added as is.
+	missing := strings.ReplaceAll(lfsPointer, lfsOid, strings.Repeat("0", 64))
+	commitFiles(t, r, fs, map[string]string{"c.bin": missing})
+	assert.Equal(t, missing, readBlob(t, r, "c.bin"))
+
+	require.NoError(t, fs.Remove("c.bin"))
+	err = w.Reset(&ResetOptions{Mode: HardReset})
+	assert.ErrorIs(t, err, lfs.ErrObjectNotFound)
+}
+
+type rot13FilterDriver struct{}
+
+func rot13(r io.Reader) io.Reader {
+	b, err := io.ReadAll(r)
+	if err != nil {
+		return errReader{err}
+	}
+
+	return strings.NewReader(strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z':
+			return 'a' + (r-'a'+13)%26
+		case r >= 'A' && r <= 'Z':
+			return 'A' + (r-'A'+13)%26
+		}
+
+		return r
+	}, string(b)))
+}
+
+func (rot13FilterDriver) Clean(r io.Reader) io.Reader  { return rot13(r) }
+func (rot13FilterDriver) Smudge(r io.Reader) io.Reader { return rot13(r) }
+
+func TestRegisterFilterDriver(t *testing.T) {
+	t.Parallel()
+
+	RegisterFilterDriver("rot13", func(*Repository) (FilterDriver, error) {
+		return rot13FilterDriver{}, nil
+	})
+	t.Cleanup(func() { UnregisterFilterDriver("rot13") })
+
+	fs := memfs.New()
+	r, err := Init(filesystem.NewStorage(memfs.New(), cache.NewObjectLRUDefault()), WithWorkTree(fs))
+	require.NoError(t, err)
+
+	commitFiles(t, r, fs, map[string]string{
+		".gitattributes":     "*.txt filter=rot13\nother/* filter=unknown\n",
+		"a.txt":              "hello\n",
+		"dir/b.txt":          "hello\n",
+		"other/c.txt":        "hello\n",
+		"dir/.gitattributes": "b.txt -filter\n",
+	})
+
+	assert.Equal(t, "uryyb\n", readBlob(t, r, "a.txt"))
+	assert.Equal(t, "hello\n", readBlob(t, r, "dir/b.txt"))
+	// The files with an unknown filter driver are not converted.
+	assert.Equal(t, "hello\n", readBlob(t, r, "other/c.txt"))
+
+	w, err := r.Worktree()
+	require.NoError(t, err)
+	status, err := w.Status()
+	require.NoError(t, err)
+	assert.True(t, status.IsClean(), status)
+
+	require.NoError(t, fs.Remove("a.txt"))
+	require.NoError(t, w.Checkout(&CheckoutOptions{Branch: plumbing.Master, Force: true}))
+	content, err := util.ReadFile(fs, "a.txt")
+	require.NoError(t, err)
+	assert.Equal(t, "hello\n", string(content))
+}
@@ -0,0 +1,454 @@
+package git
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/go-git/go-billy/v6"
+	"github.com/go-git/go-billy/v6/osfs"
+	"github.com/go-git/go-billy/v6/util"
+
+	"github.com/go-git/go-git/v6/plumbing"
+	"github.com/go-git/go-git/v6/plumbing/cache"
+	"github.com/go-git/go-git/v6/storage/filesystem"
+)
+
+const (
+	linkedWorktreesPath = "worktrees"
+	linkedGitDirFile    = "gitdir"
+	linkedCommonDirFile = "commondir"
+	linkedLockedFile    = "locked"
+)
+
+var (
+	// ErrLinkedWorktreesNotSupported is returned when the linked worktrees
+	// of a repository are managed while its storer is not a filesystem one.
+	ErrLinkedWorktreesNotSupported = errors.New("linked worktrees not supported by the storer")
+	// ErrLinkedWorktreeNotFound is returned when a linked worktree does not
+	// exist.
+	ErrLinkedWorktreeNotFound = errors.New("linked worktree not found")
+	// ErrLinkedWorktreeLocked is returned by RemoveWorktree when the linked
+	// worktree is locked, as `git worktree lock` does.
+	ErrLinkedWorktreeLocked = errors.New("linked worktree is locked")
+)
+
+// LinkedWorktree is a worktree linked to a repository, as the ones added by
+// `git worktree add`, sharing the objects, the references and the config of
+// the repository, but having its own HEAD and index.
+type LinkedWorktree struct {
+	// Name is the name of the worktree, the one of its administrative
+	// directory, in the worktrees directory of the repository.
+	Name string
+	// Path is the path of the worktree.
+	Path string
+	// Head is the HEAD of the worktree, a symbolic reference to the branch
+	// checked out or the hash of a detached HEAD.
+	Head *plumbing.Reference
+	// Locked is set if the worktree is locked, not to be removed.
+	Locked bool
+}
+
+// AddWorktreeOptions describes how a linked worktree is added by
+// AddWorktree.
+type AddWorktreeOptions struct {
+	// Name is the name of the worktree, the base name of its path if empty.
+	// A number is appended to it if a worktree already has it.
+	Name string
+	// Hash is the commit the branch is created at with Create, or the one
+	// HEAD is detached at without branch, the HEAD commit if zero.
+	Hash plumbing.Hash
+	// Create creates the branch, as `git worktree add -b` does.
+	Create bool
+	// Force checks out the branch even if it is checked out in another
+	// worktree.
+	Force bool
+}
+
+// RemoveWorktreeOptions describes how a linked worktree is removed by
+// RemoveWorktree.
+type RemoveWorktreeOptions struct {
+	// Force removes the worktree even if it is not clean or locked.
+	Force bool
+}
+
+// Worktrees returns the linked worktrees of the repository, sorted by name.
+// The main worktree is not one of them.
+func (r *Repository) Worktrees() ([]*LinkedWorktree, error) {
+	admin, err := r.linkedWorktreesDir()
+	if err != nil {
+		return nil, err
+	}
+
+	entries, err := admin.ReadDir("")
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var worktrees []*LinkedWorktree
+	for _, e := range entries {
+		if !e.IsDir() {
+			continue
+		}
+
+		wt, err := readLinkedWorktree(admin, e.Name())
+		if err != nil {
+			return nil, err
+		}
+
+		worktrees = append(worktrees, wt)
+	}
+
+	sort.Slice(worktrees, func(i, j int) bool { return worktrees[i].Name < worktrees[j].Name })
+	return worktrees, nil
+}
+
+// AddWorktree adds a linked worktree at the given path, as `git worktree
+// add` does, and returns the repository opened from it. The worktree has
+// the branch ref checked out, which must exist unless opts.Create is set,
+// or a HEAD detached at opts.Hash if ref is empty. ErrBranchCheckedOut is
+// returned if the branch is checked out in another worktree, unless
+// opts.Force is set, and ErrTargetDirNotEmpty if the path is not empty.
+func (r *Repository) AddWorktree(path string, ref plumbing.ReferenceName, opts *AddWorktreeOptions) (_ *Repository, err error) {
+	if opts == nil {
+		opts = &AddWorktreeOptions{}
+	}
+
+	admin, err := r.linkedWorktreesDir()
+	if err != nil {
+		return nil, err
+	}
+
+	if ref != "" && !ref.IsBranch() {
+		return nil, fmt.Errorf("%w: %s is not a branch", ErrInvalidReference, ref)
+	}
+
+	if path, err = filepath.Abs(path); err != nil {
+		return nil, err
+	}
+
+	wfs := osfs.New(path, osfs.WithBoundOS())
+	if entries, err := wfs.ReadDir(""); err == nil && len(entries) > 0 {
+		return nil, ErrTargetDirNotEmpty
+	}
+
+	h, err := r.linkedWorktreeCommit(ref, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	name, err := linkedWorktreeName(admin, path, opts.Name)
+	if err != nil {
+		return nil, err
+	}
+
+	defer func() {
+		if err != nil {
+			_ = util.RemoveAll(admin, name)
+			_ = util.RemoveAll(wfs, "")
+		}
+	}()
+
+	if err := admin.MkdirAll(name, 0o755); err != nil {
+		return nil, err
+	}
+
+	files := map[string]string{
+		linkedGitDirFile:    filepath.Join(path, GitDirName) + "\n",
+		linkedCommonDirFile: "../..\n",
+	}
+	for file, content := range files {
+		if err := util.WriteFile(admin, admin.Join(name, file), []byte(content), 0o644); err != nil {
+			return nil, err
+		}
+	}
+
+	s, err := linkedWorktreeStorage(admin, name)
+	if err != nil {
+		return nil, err
+	}
+
+	head := plumbing.NewHashReference(plumbing.HEAD, h)
+	if ref != "" {
+		head = plumbing.NewSymbolicReference(plumbing.HEAD, ref)
+	}
+
+	if err := s.SetReference(head); err != nil {
+		return nil, err
+	}
+
+	if opts.Create {
+		if err := r.Storer.SetReference(plumbing.NewHashReference(ref, h)); err != nil {
+			return nil, err
+		}
+	}
+
+	gitdir := fmt.Sprintf("gitdir: %s\n", filepath.Join(admin.Root(), name))
+	if err := util.WriteFile(wfs, GitDirName, []byte(gitdir), 0o644); err != nil {
+		return nil, err
+	}
+
+	wr, err := PlainOpen(path)
+	if err != nil {
+		return nil, err
+	}
+
+	w, err := wr.Worktree()
+	if err != nil {
+		return nil, err
+	}
+
+	if err := w.Reset(&ResetOptions{Commit: h, Mode: HardReset}); err != nil {
+		return nil, err
+	}
+
+	return wr, nil
+}
+
+// RemoveWorktree removes the linked worktree of the given name, as `git
+// worktree remove` does: its files and its administrative files. Unless
+// opts.Force is set, ErrWorktreeNotClean is returned if it has changes or
+// untracked files, and ErrLinkedWorktreeLocked if it is locked.
+func (r *Repository) RemoveWorktree(name string, opts *RemoveWorktreeOptions) error {
+	if opts == nil {
+		opts = &RemoveWorktreeOptions{}
+	}
+
+	admin, err := r.linkedWorktreesDir()
+	if err != nil {
+		return err
+	}
+
+	wt, err := readLinkedWorktree(admin, name)
+	if err != nil {
+		return err
+	}
+
+	if !opts.Force {
+		if wt.Locked {
+			return fmt.Errorf("%w: %s", ErrLinkedWorktreeLocked, name)
+		}
+
+		if err := linkedWorktreeClean(wt.Path); err != nil {
+			return err
+		}
+	}
+
+	if err := os.RemoveAll(wt.Path); err != nil {
+		return err
+	}
+
+	return util.RemoveAll(admin, name)
+}
+
+// linkedWorktreesDir returns the filesystem of the worktrees directory of
+// the git directory shared by the worktrees, the common one.
+func (r *Repository) linkedWorktreesDir() (billy.Filesystem, error) {
+	s, ok := r.Storer.(*filesystem.Storage)
+	if !ok {
+		return nil, ErrLinkedWorktreesNotSupported
+	}
+
+	// The worktrees directory is mapped to the common directory by the
+	// filesystem of a linked worktree.
+	return s.Filesystem().Chroot(linkedWorktreesPath)
+}
+
+// linkedWorktreeCommit returns the commit checked out in a linked worktree
+// added by AddWorktree, checking that its branch can be.
+func (r *Repository) linkedWorktreeCommit(ref plumbing.ReferenceName, opts *AddWorktreeOptions) (plumbing.Hash, error) {
+	if ref != "" && !opts.Create {
+		b, err := r.Storer.Reference(ref)
+		if err != nil {
+			return plumbing.ZeroHash, fmt.Errorf("branch %s: %w", ref.Short(), err)
+		}
+
+		if !opts.Force {
+			if err := r.checkBranchNotCheckedOut(ref); err != nil {
+				return plumbing.ZeroHash, err
+			}
+		}
+
+		return b.Hash(), nil
+	}
+
+	if ref != "" {
+		if _, err := r.Storer.Reference(ref); err == nil {
+			return plumbing.ZeroHash, fmt.Errorf("%w: %s", ErrBranchExists, ref.Short())
+		}
+	}
+
+	if !opts.Hash.IsZero() {
+		c, err := r.CommitObject(opts.Hash)
+		if err != nil {
+			return plumbing.ZeroHash, err
+		}
+
+		return c.Hash, nil
+	}
+
+	head, err := r.Head()
+	if err != nil {
+		return plumbing.ZeroHash, err
+	}
+
+	return head.Hash(), nil
+}
+
+// checkBranchNotCheckedOut returns ErrBranchCheckedOut if the branch is the
+// one of the HEAD of the main worktree or of a linked one.
+func (r *Repository) checkBranchNotCheckedOut(branch plumbing.ReferenceName) error {
+	admin, err := r.linkedWorktreesDir()
+	if err != nil {
+		return err
+	}
+
+	// The HEAD of a bare repository is not checked out.
+	var heads []string
+	var refs []*plumbing.Reference
+	common := filesystem.NewStorage(osfs.New(filepath.Dir(admin.Root()), osfs.WithBoundOS()), cache.NewObjectLRUDefault())
+	cfg, err := common.Config()
+	if err != nil {
+		return err
+	}
+
+	if !cfg.Core.IsBare {
+		head, err := common.Reference(plumbing.HEAD)
+		if err != nil {
+			return err
+		}
+
+		heads = append(heads, "main worktree")
+		refs = append(refs, head)
+	}
+
+	worktrees, err := r.Worktrees()
+	if err != nil {
+		return err
+	}
+
+	for _, wt := range worktrees {
+		heads = append(heads, wt.Path)
+		refs = append(refs, wt.Head)
+	}
+
+	for i, ref := range refs {
+		if ref != nil && ref.Type() == plumbing.SymbolicReference && ref.Target() == branch {
+			return fmt.Errorf("%w: %s at %s", ErrBranchCheckedOut, branch.Short(), heads[i])
+		}
+	}
+
+	return nil
+}
+
+// readLinkedWorktree reads the linked worktree of the given name from its
+// administrative files.
+func readLinkedWorktree(admin billy.Filesystem, name string) (*LinkedWorktree, error) {
+	if fi, err := admin.Stat(name); err != nil || !fi.IsDir() {
+		return nil, fmt.Errorf("%w: %s", ErrLinkedWorktreeNotFound, name)
+	}
+
+	wt := &LinkedWorktree{Name: name}
+	gitdir, err := util.ReadFile(admin, admin.Join(name, linkedGitDirFile))
+	if err != nil {
+		return nil, err
+	}
+
+	// The path of the .git file of the worktree may be relative to the
+	// administrative directory.
+	path := strings.TrimSpace(string(gitdir))
+	if !filepath.IsAbs(path) {
+		path = filepath.Join(admin.Root(), name, path)
+	}
+	wt.Path = filepath.Dir(path)
+
+	if _, err := admin.Stat(admin.Join(name, linkedLockedFile)); err == nil {
+		wt.Locked = true
+	}
+
+	s, err := linkedWorktreeStorage(admin, name)
+	if err != nil {
+		return nil, err
+	}
+
+	wt.Head, err = s.Reference(plumbing.HEAD)
+	if err != nil && !errors.Is(err, plumbing.ErrReferenceNotFound) {
+		return nil, err
+	}
+
+	return wt, nil
+}
+
+// linkedWorktreeStorage returns the storage of the administrative directory
+// of the linked worktree of the given name, holding its HEAD.
+func linkedWorktreeStorage(admin billy.Filesystem, name string) (*filesystem.Storage, error) {
+	dot, err := admin.Chroot(name)
+	if err != nil {
+		return nil, err
+	}
+
+	return filesystem.NewStorage(dot, cache.NewObjectLRUDefault()), nil
+}
+
+// linkedWorktreeName returns the name of the administrative directory of a
+// new linked worktree, the given one or the base name of its path, followed
+// by a number if it exists, as git does.
+func linkedWorktreeName(admin billy.Filesystem, path, name string) (string, error) {
+	if name == "" {
+		name = filepath.Base(path)
+	}
+
+	if name == "" || name == "." || name == ".." || strings.ContainsAny(name, `/\`) {
+		return "", fmt.Errorf("invalid worktree name %q", name)
+	}
+
+	candidate := name
+	for i := 1; ; i++ {
+		_, err := admin.Stat(candidate)
+		if os.IsNotExist(err) {
+			return candidate, nil
+		}
+		if err != nil {
+			return "", err
+		}
+
+		candidate = name + strconv.Itoa(i)
+	}
+}
+
+// linkedWorktreeClean returns ErrWorktreeNotClean if the worktree at the
+// given path has changes or untracked files.
+func linkedWorktreeClean(path string) error {
+	r, err := PlainOpen(path)
+	if err != nil {
+		// A worktree whose files are gone is clean.
+		if errors.Is(err, ErrRepositoryNotExists) {
+			return nil
+		}
+
+		return err
+	}
+
+	w, err := r.Worktree()
+	if err != nil {
+		return err
+	}
+
+	status, err := w.Status()
+	if err != nil {
+		return err
+	}
+
+	if !status.IsClean() {
+		return fmt.Errorf("%w: %s", ErrWorktreeNotClean, path)
+	}
+
+	return nil
+}
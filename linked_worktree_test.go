@@ -0,0 +1,255 @@
+package git
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	fixtures "github.com/go-git/go-git-fixtures/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/go-git/go-git/v6/plumbing"
+	"github.com/go-git/go-git/v6/storage/memory"
+)
+
+// newLinkedRepository returns a repository initialized at dir, having a
+// commit on master.
+func newLinkedRepository(t *testing.T, dir string) *Repository {
+	t.Helper()
+
+	r, err := PlainInit(dir, false)
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "a"), []byte("a\n"), 0o644))
+
+	w, err := r.Worktree()
+	require.NoError(t, err)
+	_, err = w.Add("a")
+	require.NoError(t, err)
+	_, err = w.Commit("a\n", &CommitOptions{Author: defaultSignature()})
+	require.NoError(t, err)
+
+	return r
+}
+
+func TestPlainOpenLinkedWorktree(t *testing.T) {
+	t.Parallel()
+
+	fs := fixtures.ByTag("linked-worktree").One().Worktree(fixtures.WithTargetDir(t.TempDir))
+
+	// The commondir is followed without option.
+	r, err := PlainOpen(filepath.Join(fs.Root(), "linked-worktree-1"))
+	require.NoError(t, err)
+	head, err := r.Head()
+	require.NoError(t, err)
+	assert.Equal(t, plumbing.ReferenceName("refs/heads/linked-worktree-1"), head.Name())
+
+	master, err := r.Reference(plumbing.Master, false)
+	require.NoError(t, err)
+	w, err := r.Worktree()
+	require.NoError(t, err)
+	status, err := w.Status()
+	require.NoError(t, err)
+	assert.Contains(t, status, "linked-worktree-1-unique-file.txt")
+
+	// The linked worktrees are the same from any of them.
+	main, err := PlainOpen(filepath.Join(fs.Root(), "main"))
+	require.NoError(t, err)
+	mainHead, err := main.Head()
+	require.NoError(t, err)
+	assert.Equal(t, master.Hash(), mainHead.Hash())
+
+	for _, r := range []*Repository{main, r} {
+		worktrees, err := r.Worktrees()
+		require.NoError(t, err)
+		require.Len(t, worktrees, 3)
+
+		heads := make(map[string]plumbing.ReferenceName)
+		for _, wt := range worktrees {
+			heads[wt.Name] = wt.Head.Target()
+			assert.False(t, wt.Locked)
+		}
+
+		assert.Equal(t, map[string]plumbing.ReferenceName{
+			"linked-worktree-1":                 "refs/heads/linked-worktree-1",
+			"linked-worktree-2":                 "refs/heads/branch-with-different-name",
+			"linked-worktree-invalid-commondir": "refs/heads/linked-worktree-invalid-commondir",
+		}, heads)
+	}
+
+	_, err = PlainOpen(filepath.Join(fs.Root(), "linked-worktree-invalid-commondir"))
+	assert.ErrorIs(t, err, ErrRepositoryIncomplete)
+}
+
+func TestAddWorktree(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	r := newLinkedRepository(t, filepath.Join(dir, "main"))
+	head, err := r.Head()
+	require.NoError(t, err)
+
+	path := filepath.Join(dir, "feature")
+	wr, err := r.AddWorktree(path, "refs/heads/feature", &AddWorktreeOptions{Create: true})
+	require.NoError(t, err)
+
+	data, err := os.ReadFile(filepath.Join(path, "a"))
+	require.NoError(t, err)
+	assert.Equal(t, "a\n", string(data))
+
+	// The commits of the linked worktree are the ones of the repository.
+	require.NoError(t, os.WriteFile(filepath.Join(path, "b"), []byte("b\n"), 0o644))
+	w, err := wr.Worktree()
+	require.NoError(t, err)
+	_, err = w.Add("b")
+	require.NoError(t, err)
+	h, err := w.Commit("b\n", &CommitOptions{Author: defaultSignature()})
+	require.NoError(t, err)
+	assert.Equal(t, h, mustReference(t, r, "refs/heads/feature"))
+	mainHead, err := r.Head()
+	require.NoError(t, err)
+	assert.Equal(t, head, mainHead)
+
+	worktrees, err := r.Worktrees()
+	require.NoError(t, err)
+	require.Len(t, worktrees, 1)
+	assert.Equal(t, "feature", worktrees[0].Name)
+	assert.Equal(t, path, worktrees[0].Path)
+	assert.Equal(t, plumbing.ReferenceName("refs/heads/feature"), worktrees[0].Head.Target())
+
+	// The branches checked out are refused, but with Force.
+	_, err = r.AddWorktree(filepath.Join(dir, "master"), plumbing.Master, nil)
+	assert.ErrorIs(t, err, ErrBranchCheckedOut)
+	_, err = wr.AddWorktree(filepath.Join(dir, "other"), "refs/heads/feature", nil)
+	assert.ErrorIs(t, err, ErrBranchCheckedOut)
+	_, err = r.AddWorktree(filepath.Join(dir, "other"), "refs/heads/feature", &AddWorktreeOptions{Create: true})
+	assert.ErrorIs(t, err, ErrBranchExists)
+	_, err = r.AddWorktree(filepath.Join(dir, "main"), "", nil)
+	assert.ErrorIs(t, err, ErrTargetDirNotEmpty)
+	_, err = r.AddWorktree(filepath.Join(dir, "other"), plumbing.HEAD, nil)
+	assert.ErrorIs(t, err, ErrInvalidReference)
+	assert.NoDirExists(t, filepath.Join(dir, "other"))
+
+	_, err = r.AddWorktree(filepath.Join(dir, "master"), plumbing.Master, &AddWorktreeOptions{Force: true})
+	require.NoError(t, err)
+
+	// A detached HEAD is added from a linked worktree, its name being made
+	// unique.
+	detached, err := wr.AddWorktree(filepath.Join(dir, "sub", "feature"), "", &AddWorktreeOptions{Hash: head.Hash()})
+	require.NoError(t, err)
+	dh, err := detached.Head()
+	require.NoError(t, err)
+	assert.Equal(t, plumbing.NewHashReference(plumbing.HEAD, head.Hash()), dh)
+
+	worktrees, err = r.Worktrees()
+	require.NoError(t, err)
+	var names []string
+	for _, wt := range worktrees {
+		names = append(names, wt.Name)
+	}
+	assert.Equal(t, []string{"feature", "feature1", "master"}, names)
+}
+
+func TestRemoveWorktree(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	r := newLinkedRepository(t, filepath.Join(dir, "main"))
+	path := filepath.Join(dir, "feature")
+	_, err := r.AddWorktree(path, "refs/heads/feature", &AddWorktreeOptions{Create: true})
+	require.NoError(t, err)
+
+	assert.ErrorIs(t, r.RemoveWorktree("missing", nil), ErrLinkedWorktreeNotFound)
+
+	require.NoError(t, os.WriteFile(filepath.Join(path, "b"), []byte("b\n"), 0o644))
+	assert.ErrorIs(t, r.RemoveWorktree("feature", nil), ErrWorktreeNotClean)
+	require.NoError(t, os.Remove(filepath.Join(path, "b")))
+
+	locked := filepath.Join(dir, "main", GitDirName, "worktrees", "feature", "locked")
+	require.NoError(t, os.WriteFile(locked, nil, 0o644))
+	worktrees, err := r.Worktrees()
+	require.NoError(t, err)
+	require.Len(t, worktrees, 1)
+	assert.True(t, worktrees[0].Locked)
+	assert.ErrorIs(t, r.RemoveWorktree("feature", nil), ErrLinkedWorktreeLocked)
+	require.NoError(t, os.Remove(locked))
+
+	require.NoError(t, r.RemoveWorktree("feature", nil))
+	assert.NoDirExists(t, path)
+	worktrees, err = r.Worktrees()
+	require.NoError(t, err)
+	assert.Empty(t, worktrees)
+
+	// The branch is kept.
+	mustReference(t, r, "refs/heads/feature")
+
+	// A worktree not clean is removed with Force.
+	_, err = r.AddWorktree(path, "refs/heads/feature", nil)
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(filepath.Join(path, "b"), []byte("b\n"), 0o644))
+	require.NoError(t, r.RemoveWorktree("feature", &RemoveWorktreeOptions{Force: true}))
+	assert.NoDirExists(t, path)
+}
+
+func TestWorktreesNotSupported(t *testing.T) {
+	t.Parallel()
+
+	r, err := Init(memory.NewStorage())
+	require.NoError(t, err)
+	_, err = r.Worktrees()
+	assert.ErrorIs(t, err, ErrLinkedWorktreesNotSupported)
+}
+
+func TestWorktreesGit(t *testing.T) {
+	t.Parallel()
+
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not found")
+	}
+
+	dir := t.TempDir()
+	main := filepath.Join(dir, "main")
+	r := newLinkedRepository(t, main)
+
+	git := func(dir string, args ...string) string {
+		cmd := exec.Command("git", args...)
+		cmd.Dir = dir
+		out, err := cmd.CombinedOutput()
+		require.NoError(t, err, string(out))
+		return strings.TrimSpace(string(out))
+	}
+
+	// git uses the worktrees added by go-git.
+	path := filepath.Join(dir, "feature")
+	_, err := r.AddWorktree(path, "refs/heads/feature", &AddWorktreeOptions{Create: true})
+	require.NoError(t, err)
+	assert.Empty(t, git(path, "status", "--porcelain"))
+	assert.Equal(t, "feature", git(path, "rev-parse", "--abbrev-ref", "HEAD"))
+	assert.Contains(t, git(main, "worktree", "list", "--porcelain"), "worktree "+path+"\nHEAD "+mustReference(t, r, "refs/heads/feature").String()+"\nbranch refs/heads/feature")
+
+	// go-git uses the worktrees added by git.
+	other := filepath.Join(dir, "other")
+	git(main, "worktree", "add", "-q", "-b", "other", other)
+	git(other, "-c", "user.name=foo", "-c", "user.email=foo@foo.foo", "commit", "-q", "--allow-empty", "-m", "other")
+	wr, err := PlainOpen(other)
+	require.NoError(t, err)
+	head, err := wr.Head()
+	require.NoError(t, err)
+	assert.Equal(t, plumbing.ReferenceName("refs/heads/other"), head.Name())
+	assert.Equal(t, git(other, "rev-parse", "HEAD"), head.Hash().String())
+	w, err := wr.Worktree()
+	require.NoError(t, err)
+	status, err := w.Status()
+	require.NoError(t, err)
+	assert.True(t, status.IsClean(), status)
+
+	worktrees, err := r.Worktrees()
+	require.NoError(t, err)
+	require.Len(t, worktrees, 2)
+	assert.Equal(t, other, worktrees[1].Path)
+
+	require.NoError(t, r.RemoveWorktree("other", nil))
+	assert.NotContains(t, git(main, "worktree", "list", "--porcelain"), other)
+}
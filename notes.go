@@ -0,0 +1,158 @@
+package git
+
+import (
+	"errors"
+
+	"github.com/go-git/go-git/v6/plumbing"
+	"github.com/go-git/go-git/v6/plumbing/object"
+)
+
+// DefaultNotesReferenceName is the notes reference used by default by git,
+// holding the notes of the commits.
+const DefaultNotesReferenceName plumbing.ReferenceName = "refs/notes/commits"
+
+// NotesTree is the notes of a notes reference. Each update of the notes is
+// committed to the reference, as done by `git notes`.
+type NotesTree struct {
+	// Author is the author and committer of the commits of the notes. They
+	// are read from the config when nil.
+	Author *object.Signature
+
+	r      *Repository
+	name   plumbing.ReferenceName
+	parent plumbing.Hash
+	notes  *object.NotesTree
+}
+
+// NotesTree returns the notes of the given notes reference, or of
+// DefaultNotesReferenceName if name is empty. The notes are empty if the
+// reference does not exist yet. The notes references themselves are listed
+// by Notes.
+func (r *Repository) NotesTree(name plumbing.ReferenceName) (*NotesTree, error) {
+	if name == "" {
+		name = DefaultNotesReferenceName
+	}
+
+	t := &NotesTree{r: r, name: name}
+
+	var tree *object.Tree
+	ref, err := r.Reference(name, true)
+	switch {
+	case errors.Is(err, plumbing.ErrReferenceNotFound):
+	case err != nil:
+		return nil, err
+	default:
+		c, err := r.CommitObject(ref.Hash())
+		if err != nil {
+			return nil, err
+		}
+
+		if tree, err = c.Tree(); err != nil {
+			return nil, err
+		}
+
+		t.parent = c.Hash
+	}
+
+	t.notes, err = object.NewNotesTree(r.Storer, tree)
+	if err != nil {
+		return nil, err
+	}
+
+	return t, nil
+}
+
+// Name returns the name of the notes reference.
+func (t *NotesTree) Name() plumbing.ReferenceName {
+	return t.name
+}
+
+// Len returns the number of notes.
+func (t *NotesTree) Len() int {
+	return t.notes.Len()
+}
+
+// Get returns the note of the given object, or object.ErrNoteNotFound.
+func (t *NotesTree) Get(target plumbing.Hash) (*object.Note, error) {
+	return t.notes.Get(target)
+}
+
+// ForEach calls cb for each note, sorted by the hash of the annotated object,
+// as object.NotesTree.ForEach.
+func (t *NotesTree) ForEach(cb func(*object.Note) error) error {
+	return t.notes.ForEach(cb)
+}
+
+// Set makes message the note of the given object, replacing its existing
+// note, and commits it, as `git notes add --force`. The object must exist.
+func (t *NotesTree) Set(target plumbing.Hash, message string) error {
+	if err := t.r.Storer.HasEncodedObject(target); err != nil {
+		return err
+	}
+
+	if err := t.notes.Set(target, message); err != nil {
+		return err
+	}
+
+	return t.commit("Notes added by 'git notes add'")
+}
+
+// Remove removes the note of the given object and commits it, as
+// `git notes remove`. object.ErrNoteNotFound is returned if the object has
+// no note.
+func (t *NotesTree) Remove(target plumbing.Hash) error {
+	if err := t.notes.Remove(target); err != nil {
+		return err
+	}
+
+	return t.commit("Notes removed by 'git notes remove'")
+}
+
+// commit commits the notes to the notes reference, logging the update in its
+// reflog.
+func (t *NotesTree) commit(msg string) error {
+	tree, err := t.notes.WriteTree()
+	if err != nil {
+		return err
+	}
+
+	opts := &CommitOptions{Author: t.Author, Committer: t.Author}
+	if opts.Author == nil {
+		if err := opts.loadConfigAuthorAndCommitter(t.r); err != nil {
+			return err
+		}
+	}
+
+	if opts.Committer == nil {
+		opts.Committer = opts.Author
+	}
+
+	c := &object.Commit{
+		Author:    *opts.Author,
+		Committer: *opts.Committer,
+		Message:   msg + "\n",
+		TreeHash:  tree,
+	}
+
+	if !t.parent.IsZero() {
+		c.ParentHashes = []plumbing.Hash{t.parent}
+	}
+
+	o := t.r.Storer.NewEncodedObject()
+	if err := c.Encode(o); err != nil {
+		return err
+	}
+
+	h, err := t.r.Storer.SetEncodedObject(o)
+	if err != nil {
+		return err
+	}
+
+	ref := plumbing.NewHashReference(t.name, h)
+	if err := t.r.setReferenceWithLog(ref, opts.Committer, "notes: "+msg); err != nil {
+		return err
+	}
+
+	t.parent = h
+	return nil
+}
@@ -0,0 +1,135 @@
+package git
+
+import (
+	"fmt"
+	"os/exec"
+	"strings"
+	"testing"
+
+	"github.com/go-git/go-billy/v6/osfs"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/go-git/go-git/v6/plumbing"
+	"github.com/go-git/go-git/v6/plumbing/object"
+	"github.com/go-git/go-git/v6/storage/memory"
+)
+
+func TestNotesTree(t *testing.T) {
+	t.Parallel()
+
+	r, _ := newRebaseRepository(t, memory.NewStorage(), "b")
+	head, err := r.Head()
+	require.NoError(t, err)
+
+	notes, err := r.NotesTree("")
+	require.NoError(t, err)
+	assert.Equal(t, DefaultNotesReferenceName, notes.Name())
+	assert.Equal(t, 0, notes.Len())
+
+	notes.Author = &object.Signature{Name: "foo", Email: "foo@foo.foo"}
+	require.NoError(t, notes.Set(head.Hash(), "reviewed\n"))
+	require.NoError(t, notes.Set(head.Hash(), "approved\n"))
+
+	err = notes.Set(plumbing.NewHash("aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa"), "missing\n")
+	assert.ErrorIs(t, err, plumbing.ErrObjectNotFound)
+
+	// Each update is committed to the notes reference.
+	read, err := r.NotesTree(DefaultNotesReferenceName)
+	require.NoError(t, err)
+	note, err := read.Get(head.Hash())
+	require.NoError(t, err)
+	msg, err := note.Message()
+	require.NoError(t, err)
+	assert.Equal(t, "approved\n", msg)
+
+	assert.Equal(t, []string{
+		"notes: Notes added by 'git notes add'",
+		"notes: Notes added by 'git notes add'",
+	}, reflogMessages(t, r, DefaultNotesReferenceName))
+
+	read.Author = notes.Author
+	require.NoError(t, read.Remove(head.Hash()))
+	assert.ErrorIs(t, read.Remove(head.Hash()), object.ErrNoteNotFound)
+
+	ref, err := r.Reference(DefaultNotesReferenceName, false)
+	require.NoError(t, err)
+	c, err := r.CommitObject(ref.Hash())
+	require.NoError(t, err)
+	assert.Equal(t, "Notes removed by 'git notes remove'\n", c.Message)
+	assert.Equal(t, "foo", c.Author.Name)
+	assert.Equal(t, 3, countCommits(t, c))
+
+	_, err = read.Get(head.Hash())
+	assert.ErrorIs(t, err, object.ErrNoteNotFound)
+}
+
+func countCommits(t *testing.T, c *object.Commit) int {
+	t.Helper()
+
+	var count int
+	require.NoError(t, object.NewCommitPreorderIter(c, nil, nil).ForEach(func(*object.Commit) error {
+		count++
+		return nil
+	}))
+
+	return count
+}
+
+func TestNotesTreeGit(t *testing.T) {
+	t.Parallel()
+
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git is not available")
+	}
+
+	dir := t.TempDir()
+	r, err := PlainInit(dir, false)
+	require.NoError(t, err)
+	commitFiles(t, r, osfs.New(dir), map[string]string{"a": "a\n"})
+	head, err := r.Head()
+	require.NoError(t, err)
+
+	git := func(args ...string) string {
+		cmd := exec.Command("git", append([]string{"-C", dir, "-c", "user.name=foo", "-c", "user.email=foo@foo.foo"}, args...)...)
+		out, err := cmd.CombinedOutput()
+		require.NoError(t, err, string(out))
+		return string(out)
+	}
+
+	notes, err := r.NotesTree("")
+	require.NoError(t, err)
+	notes.Author = &object.Signature{Name: "foo", Email: "foo@foo.foo"}
+	require.NoError(t, notes.Set(head.Hash(), "reviewed\n"))
+	assert.Equal(t, "reviewed\n", git("notes", "show", head.Hash().String()))
+
+	git("notes", "--ref", "review", "add", "-m", "approved", head.Hash().String())
+	review, err := r.NotesTree("refs/notes/review")
+	require.NoError(t, err)
+	note, err := review.Get(head.Hash())
+	require.NoError(t, err)
+	msg, err := note.Message()
+	require.NoError(t, err)
+	assert.Equal(t, "approved\n", msg)
+
+	require.NoError(t, notes.Remove(head.Hash()))
+	assert.Empty(t, strings.TrimSpace(git("notes", "list")))
+
+	// The notes fanned out are read by git.
+	var blob plumbing.Hash
+	for i := 0; i < 300; i++ {
+		o := &plumbing.MemoryObject{}
+		o.SetType(plumbing.BlobObject)
+		_, err := fmt.Fprintln(o, i)
+		require.NoError(t, err)
+		blob, err = r.Storer.SetEncodedObject(o)
+		require.NoError(t, err)
+		require.NoError(t, notes.Set(blob, fmt.Sprintln("note", i)))
+	}
+
+	ref, err := r.Reference(DefaultNotesReferenceName, false)
+	require.NoError(t, err)
+	assert.Contains(t, git("ls-tree", "--name-only", ref.Hash().String()), blob.String()[:2]+"\n")
+	assert.Equal(t, 300, strings.Count(git("notes", "list"), "\n"))
+	assert.Equal(t, "note 299\n", git("notes", "show", blob.String()))
+}
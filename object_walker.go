@@ -15,10 +15,25 @@ type objectWalker struct {
 	// seen map can become huge if walking over large
 	// repos. Thus using struct{} as the value type.
 	seen map[plumbing.Hash]struct{}
+	// shallow are the shallow commits, whose parents are not walked.
+	shallow map[plumbing.Hash]struct{}
 }
 
+// newObjectWalker returns a walker of the objects of s, read as they are
+// stored, whatever the replace references, for the objects they replace not
+// to be considered unreachable.
 func newObjectWalker(s storage.Storer) *objectWalker {
-	return &objectWalker{s, map[plumbing.Hash]struct{}{}}
+	s = storage.NoReplaceObjects(s)
+	p := &objectWalker{Storer: s, seen: map[plumbing.Hash]struct{}{}}
+	// Ignore error as not having a shallow list is optional here.
+	if hashes, _ := s.Shallow(); len(hashes) > 0 {
+		p.shallow = make(map[plumbing.Hash]struct{}, len(hashes))
+		for _, h := range hashes {
+			p.shallow[h] = struct{}{}
+		}
+	}
+
+	return p
 }
 
 // walkAllRefs walks all (hash) references from the repo.
@@ -69,6 +84,9 @@ func (p *objectWalker) walkObjectTree(hash plumbing.Hash) error {
 		if err != nil {
 			return err
 		}
+		if _, ok := p.shallow[hash]; ok {
+			return nil
+		}
 		for _, h := range obj.ParentHashes {
 			err = p.walkObjectTree(h)
 			if err != nil {
@@ -88,6 +106,10 @@ func (p *objectWalker) walkObjectTree(hash plumbing.Hash) error {
 				p.add(obj.Entries[i].Hash)
 				continue
 			}
+			// The commits of the submodules are in their own repositories.
+			if obj.Entries[i].Mode == filemode.Submodule {
+				continue
+			}
 			// Normal walk for sub-trees (and symlinks etc).
 			err = p.walkObjectTree(obj.Entries[i].Hash)
 			if err != nil {
@@ -96,6 +118,8 @@ func (p *objectWalker) walkObjectTree(hash plumbing.Hash) error {
 		}
 	case *object.Tag:
 		return p.walkObjectTree(obj.Target)
+	case *object.Blob:
+		// Blobs link to no other object, such as the ones of symlinks.
 	default:
 		// Error out on unhandled object types.
 		return fmt.Errorf("unknown object %X %s %T", obj.ID(), obj.Type(), obj)
@@ -12,6 +12,7 @@ import (
 	"github.com/go-git/go-git/v6/config"
 	"github.com/go-git/go-git/v6/plumbing"
 	"github.com/go-git/go-git/v6/plumbing/object"
+	"github.com/go-git/go-git/v6/plumbing/protocol"
 	"github.com/go-git/go-git/v6/plumbing/protocol/packp"
 	"github.com/go-git/go-git/v6/plumbing/protocol/packp/sideband"
 	"github.com/go-git/go-git/v6/plumbing/transport"
@@ -41,7 +42,11 @@ type CloneOptions struct {
 	Auth transport.AuthMethod
 	// Name of the remote to be added, by default `origin`.
 	RemoteName string
-	// Remote branch to clone.
+	// Remote branch to clone. If empty, the branch the HEAD of the remote
+	// points to is cloned, as advertised by the remote, or guessed from the
+	// hash of its HEAD if the remote doesn't advertise it. The HEAD of the
+	// remote, such as refs/remotes/origin/HEAD, then points to its
+	// remote-tracking branch.
 	ReferenceName plumbing.ReferenceName
 	// Fetch only ReferenceName if true.
 	SingleBranch bool
@@ -77,6 +82,9 @@ type CloneOptions struct {
 	CABundle []byte
 	// ProxyOptions provides info required for connecting to a proxy.
 	ProxyOptions transport.ProxyOptions
+	// Timeouts bounds the time waiting for the server, such as the idle
+	// time after which a stalled packfile transfer is aborted.
+	Timeouts transport.TimeoutOptions
 	// When the repository to clone is on the local machine, instead of
 	// using hard links, automatically setup .git/objects/info/alternates
 	// to share the objects with the source repository.
@@ -89,17 +97,74 @@ type CloneOptions struct {
 	// Filter requests that the server to send only a subset of the objects.
 	// See https://git-scm.com/docs/git-clone#Documentation/git-clone.txt-code--filterltfilter-specgtcode
 	Filter packp.Filter
+	// ProtocolVersion is the version of the Git wire protocol requested to
+	// the remote, which answers using protocol v0 if it does not support it.
+	// When not set, the protocol.version of the repository configuration
+	// is used.
+	ProtocolVersion protocol.Version
 	// Bare determines whether the repository will have a worktree (non-bare)
 	// or not (bare).
 	Bare bool
+	// Resumable keeps what was received when the clone fails, so that
+	// cloning again the same URL into the same target resumes the clone
+	// instead of returning ErrTargetDirNotEmpty or
+	// ErrRepositoryAlreadyExists. See FetchOptions.Resumable.
+	Resumable bool
 }
 
 // MergeOptions describes how a merge should be performed.
 type MergeOptions struct {
-	// Strategy defines the merge strategy to be used.
+	// Strategy defines the merge strategy to be used by Repository.Merge.
+	// Worktree.Merge does a three-way merge of the trees once the current
+	// branch can't be fast-forwarded, see FastForward.
 	Strategy MergeStrategy
+	// FastForward defines whether Worktree.Merge fast-forwards the current
+	// branch when possible, as `git merge --ff`, `--ff-only` and `--no-ff`.
+	FastForward FastForwardMode
+	// Squash makes Worktree.Merge merge the changes into the index and the
+	// working tree without committing them, as `git merge --squash`: the
+	// commit made afterwards with Worktree.Commit has a single parent.
+	Squash bool
+	// Message is the message of the merge commit of Worktree.Merge,
+	// "Merge commit '<hash>'" by default.
+	Message string
+	// Author is the author of the merge commit of Worktree.Merge. If nil,
+	// it is read from the config, as with CommitOptions.
+	Author *object.Signature
+	// Committer is the committer of the merge commit of Worktree.Merge. If
+	// nil, the Author signature is used.
+	Committer *object.Signature
 }
 
+// Validate validates the fields and sets the default values.
+func (o *MergeOptions) Validate() error {
+	if o.FastForward < FastForwardAuto || o.FastForward > FastForwardNever {
+		return fmt.Errorf("invalid fast-forward mode %d", o.FastForward)
+	}
+
+	if o.Squash && o.FastForward == FastForwardNever {
+		return errors.New("squash and no fast-forward cannot be used together")
+	}
+
+	return nil
+}
+
+// FastForwardMode defines whether a merge fast-forwards the current branch.
+type FastForwardMode int8
+
+const (
+	// FastForwardAuto fast-forwards the current branch when the merged
+	// commit descends from it, and creates a merge commit otherwise. This
+	// is the default option.
+	FastForwardAuto FastForwardMode = iota
+	// FastForwardOnly only fast-forwards the current branch, the merge
+	// failing with ErrFastForwardMergeNotPossible otherwise.
+	FastForwardOnly
+	// FastForwardNever always creates a merge commit, even if the current
+	// branch could be fast-forwarded.
+	FastForwardNever
+)
+
 // MergeStrategy represents the different types of merge strategies.
 type MergeStrategy int8
 
@@ -176,6 +241,23 @@ type PullOptions struct {
 	CABundle []byte
 	// ProxyOptions provides info required for connecting to a proxy.
 	ProxyOptions transport.ProxyOptions
+	// Timeouts bounds the time waiting for the server, such as the idle
+	// time after which a stalled packfile transfer is aborted.
+	Timeouts transport.TimeoutOptions
+	// Rebase, if true, rebases the local commits of the current branch on
+	// the fetched branch when it can't be fast-forwarded, as `git pull
+	// --rebase` does, instead of failing with ErrNonFastForwardUpdate. See
+	// Repository.Rebase for the handling of the conflicts.
+	Rebase bool
+	// Autostash, if true, stashes the local changes before the current
+	// branch is fast-forwarded or rebased, and applies them back once done,
+	// as `git pull --autostash` does. The stash is created by the user of
+	// the config.
+	Autostash bool
+	// FastForwardOnly, if true, only fast-forwards the current branch, as
+	// `git pull --ff-only` does: ErrNonFastForwardUpdate is returned if it
+	// has to be rebased, even if Rebase is set.
+	FastForwardOnly bool
 }
 
 // Validate validates the fields and sets the default values.
@@ -210,10 +292,24 @@ type FetchOptions struct {
 	RemoteName string
 	// RemoteURL overrides the remote repo address with a custom URL
 	RemoteURL string
-	RefSpecs  []config.RefSpec
+	// RefSpecs are the refspecs of the references fetched. The source of a
+	// refspec can be the hash of a commit, as "<hash>:refs/heads/foo": it is
+	// requested as is, if the server allows it, advertising the
+	// allow-tip-sha1-in-want or allow-reachable-sha1-in-want capability or
+	// speaking protocol v2, and written to the destination reference.
+	RefSpecs []config.RefSpec
 	// Depth limit fetching to the specified number of commits from the tip of
 	// each remote branch history.
 	Depth int
+	// Deepen extends the history of a shallow repository by the specified
+	// number of commits from its current shallow boundary.
+	Deepen int
+	// ShallowSince limits fetching to the commits more recent than the
+	// specified time.
+	ShallowSince time.Time
+	// ShallowExclude limits fetching to the commits not reachable from the
+	// specified remote branches or tags.
+	ShallowExclude []string
 	// Auth credentials, if required, to use with the remote repository.
 	Auth transport.AuthMethod
 	// Progress is where the human readable information sent by the server is
@@ -232,20 +328,78 @@ type FetchOptions struct {
 	CABundle []byte
 	// ProxyOptions provides info required for connecting to a proxy.
 	ProxyOptions transport.ProxyOptions
+	// Timeouts bounds the time waiting for the server, such as the idle
+	// time after which a stalled packfile transfer is aborted.
+	Timeouts transport.TimeoutOptions
 	// Prune specify that local refs that match given RefSpecs and that do
-	// not exist remotely will be removed.
+	// not exist remotely will be removed. It is implied when fetching the
+	// refspecs of a mirror remote. The symbolic references, such as
+	// refs/remotes/origin/HEAD, are never removed.
 	Prune bool
+	// PruneTags specify that the local tags that do not exist remotely will
+	// be removed, as if the refspec refs/tags/*:refs/tags/* was fetched with
+	// Prune. It implies Prune.
+	PruneTags bool
+	// OnPrune, if not nil, is called with each reference removed by Prune or
+	// PruneTags.
+	OnPrune func(*plumbing.Reference)
 	// Filter requests that the server to send only a subset of the objects.
 	// See https://git-scm.com/docs/git-clone#Documentation/git-clone.txt-code--filterltfilter-specgtcode
 	Filter packp.Filter
+	// ProtocolVersion is the version of the Git wire protocol requested to
+	// the remote, which answers using protocol v0 if it does not support it.
+	// When not set, the protocol.version of the repository configuration
+	// is used.
+	ProtocolVersion protocol.Version
+	// Resumable keeps the packfiles partially downloaded when the fetch
+	// fails, so that the next fetch resumes their download from the bytes
+	// already received. Only the dumb HTTP protocol, which downloads the
+	// packfiles of the remote as files, supports it: the packfiles sent by
+	// the other protocols are generated for each fetch.
+	Resumable bool
+	// ThinPack requests a thin pack from the server, as git does, whose
+	// deltas may be based on objects the local repository has instead of
+	// being sent in it. The bases of these deltas are appended to the stored
+	// packfile, making it whole again.
+	ThinPack bool
+	// Haves are objects the local repository is known to have, sent to the
+	// server during the negotiation along with the ones of the local
+	// references, such as the commits of the repositories it borrows
+	// objects from using alternates.
+	Haves []plumbing.Hash
+	// Negotiator, if not nil, returns the Negotiator choosing the haves
+	// sent to the server, given the commits of the local references and
+	// Haves. transport.NewCommitNegotiator walks their history as git does,
+	// from the most recent commits and until the server acknowledges some
+	// as common. By default, the local references are sent, along with up
+	// to 100 of their ancestors each.
+	Negotiator transport.NewNegotiatorFunc
 }
 
+var (
+	ErrDepthDeepenExclusive  = errors.New("Depth and Deepen are mutually exclusive")
+	ErrDepthShallowExclusive = errors.New("Depth or Deepen cannot be used with ShallowSince or ShallowExclude")
+	ErrNegativeDepth         = errors.New("Depth and Deepen must be positive")
+)
+
 // Validate validates the fields and sets the default values.
 func (o *FetchOptions) Validate() error {
 	if o.RemoteName == "" {
 		o.RemoteName = DefaultRemoteName
 	}
 
+	if o.Depth < 0 || o.Deepen < 0 {
+		return ErrNegativeDepth
+	}
+
+	if o.Depth > 0 && o.Deepen > 0 {
+		return ErrDepthDeepenExclusive
+	}
+
+	if (o.Depth > 0 || o.Deepen > 0) && o.deepensBySinceOrExclude() {
+		return ErrDepthShallowExclusive
+	}
+
 	if o.Tags == plumbing.InvalidTagMode {
 		o.Tags = plumbing.TagFollowing
 	}
@@ -259,6 +413,17 @@ func (o *FetchOptions) Validate() error {
 	return nil
 }
 
+// deepensBySinceOrExclude returns whether the history is limited by date or
+// by the remote references to exclude.
+func (o *FetchOptions) deepensBySinceOrExclude() bool {
+	return !o.ShallowSince.IsZero() || len(o.ShallowExclude) > 0
+}
+
+// isShallow returns whether the fetch changes the shallow boundary.
+func (o *FetchOptions) isShallow() bool {
+	return o.Depth > 0 || o.Deepen > 0 || o.deepensBySinceOrExclude()
+}
+
 // PushOptions describes how a push should be performed.
 type PushOptions struct {
 	// RemoteName is the name of the remote to be pushed to.
@@ -298,23 +463,43 @@ type PushOptions struct {
 	// ForceWithLease allows a force push as long as the remote ref adheres to a "lease"
 	ForceWithLease *ForceWithLease
 	// PushOptions sets options to be transferred to the server during push.
+	// The push fails with ErrPushOptionsNotSupported if the server does not
+	// advertise the push-options capability.
 	Options []string
-	// Atomic sets option to be an atomic push
+	// Atomic sets option to be an atomic push, either all the references
+	// are updated or none is. The push fails with ErrAtomicNotSupported if
+	// the server does not advertise the atomic capability.
 	Atomic bool
 	// ProxyOptions provides info required for connecting to a proxy.
 	ProxyOptions transport.ProxyOptions
+	// Timeouts bounds the time waiting for the server, such as the idle
+	// time after which a stalled packfile transfer is aborted.
+	Timeouts transport.TimeoutOptions
 	// Quiet indicates whether the server should suppress human-readable
 	// output.
 	Quiet bool
+	// RunHooks runs the pre-push hook of the repository before the objects
+	// are sent, the push being aborted with a HookError if it fails. Its
+	// output is written to Progress.
+	RunHooks bool
+	// Hooks is the HookRunner running the hooks if RunHooks is set. If nil,
+	// the scripts of the hooks directory of the repository are run.
+	Hooks HookRunner
 }
 
 // ForceWithLease sets fields on the lease
 // If neither RefName nor Hash are set, ForceWithLease protects
 // all refs in the refspec by ensuring the ref of the remote in the local repsitory
 // matches the one in the ref advertisement.
+//
+// The ref of the remote is the remote-tracking ref given by the fetch refspecs
+// of the remote. When there is none, the ref is expected not to exist on the
+// remote. The expected value is sent as the old value of the ref update, so
+// the server rejects it if the ref was changed since it was advertised.
 type ForceWithLease struct {
 	// RefName, when set will protect the ref by ensuring it matches the
-	// hash in the ref advertisement.
+	// hash in the ref advertisement. The other refs are then updated as
+	// without lease.
 	RefName plumbing.ReferenceName
 	// Hash is the expected object id of RefName. The push will be rejected unless this
 	// matches the corresponding object id of RefName in the refs advertisement.
@@ -363,6 +548,27 @@ type SubmoduleUpdateOptions struct {
 var (
 	ErrBranchHashExclusive  = errors.New("Branch and Hash are mutually exclusive")
 	ErrCreateRequiresBranch = errors.New("Branch is mandatory when Create is used")
+	ErrCreatePathsExclusive = errors.New("Create and Paths are mutually exclusive")
+	ErrOrphanRequiresCreate = errors.New("Create is mandatory when Orphan is used")
+	ErrOrphanHashExclusive  = errors.New("Orphan and Hash are mutually exclusive")
+)
+
+// SymlinkMode defines how the symbolic links are written to the worktree.
+type SymlinkMode int8
+
+const (
+	// RealSymlinks writes the symbolic links as symbolic links, unless
+	// core.symlinks is false in the config. It is the default.
+	RealSymlinks SymlinkMode = iota
+	// RegularSymlinks writes the symbolic links as regular files holding
+	// their target, as git does with core.symlinks set to false, for the
+	// filesystems which don't support them. They are kept as symbolic links
+	// in the index; the status reports them as modified unless core.symlinks
+	// is false.
+	RegularSymlinks
+	// SkipSymlinks doesn't write the symbolic links to the worktree. They
+	// are kept in the index, flagged as skip-worktree.
+	SkipSymlinks
 )
 
 // CheckoutOptions describes how a checkout operation should be performed.
@@ -375,6 +581,13 @@ type CheckoutOptions struct {
 	Branch plumbing.ReferenceName
 	// Create a new branch named Branch and start it at Hash.
 	Create bool
+	// Orphan, along with Create, points HEAD at the new branch Branch
+	// without creating it, the next commit being a root commit starting its
+	// history, as `git switch --orphan` does: the tracked files are removed
+	// from the index and the working tree, the untracked ones being kept.
+	// With Keep, the index and the working tree are left as they are, as
+	// with `git checkout --orphan`. Hash must be empty.
+	Orphan bool
 	// Force, if true when switching branches, proceed even if the index or the
 	// working tree differs from HEAD. This is used to throw away local changes
 	Force bool
@@ -383,8 +596,34 @@ type CheckoutOptions struct {
 	// target branch. Force and Keep are mutually exclusive, should not be both
 	// set to true.
 	Keep bool
-	// SparseCheckoutDirectories
+	// SparseCheckoutDirectories enables a sparse checkout in cone mode: only
+	// the files within these directories are checked out, the rest are
+	// flagged as skip-worktree in the index. The directories are persisted
+	// in the sparse-checkout file, and used by the following checkouts.
 	SparseCheckoutDirectories []string
+	// SparseCheckoutPatterns enables a sparse checkout in non-cone mode: only
+	// the files matching these gitignore-style patterns are checked out.
+	// Ignored if SparseCheckoutDirectories is set.
+	SparseCheckoutPatterns []string
+	// Paths, if not empty, is a pathspec restricting the checkout to the
+	// files matching it, which are written to the working tree and the index
+	// from the commit given by Hash or Branch, HEAD being left unchanged, as
+	// `git checkout <commit> -- <pathspec>...` does. If Hash and Branch are
+	// empty, the files are restored from the index instead, discarding their
+	// unstaged changes, as `git checkout -- <pathspec>...` does; the unmerged
+	// files are then skipped if Force is set, and fail the checkout
+	// otherwise.
+	Paths []string
+	// SymlinkMode defines how the symbolic links are written to the
+	// worktree. The submodules are written as empty directories whatever
+	// the mode.
+	SymlinkMode SymlinkMode
+	// AllowPathCollisions checks out the files whose paths collide on a
+	// case-insensitive filesystem, the last one written overwriting the
+	// others, instead of failing with a PathCollisionError. The paths are
+	// checked for collisions if core.ignoreCase is true, or, if it is not
+	// set, on Windows and macOS. It is meant for the trusted repositories.
+	AllowPathCollisions bool
 }
 
 // Validate validates the fields and sets the default values.
@@ -397,6 +636,25 @@ func (o *CheckoutOptions) Validate() error {
 		return ErrCreateRequiresBranch
 	}
 
+	if o.Orphan {
+		if !o.Create {
+			return ErrOrphanRequiresCreate
+		}
+
+		if !o.Hash.IsZero() {
+			return ErrOrphanHashExclusive
+		}
+	}
+
+	if len(o.Paths) > 0 {
+		if o.Create {
+			return ErrCreatePathsExclusive
+		}
+
+		// Without Hash and Branch, the paths are checked out of the index.
+		return nil
+	}
+
 	if o.Branch == "" {
 		o.Branch = plumbing.Master
 	}
@@ -421,12 +679,19 @@ const (
 	// which have not been added).
 	//
 	// If a file that is different between Commit and the index has unstaged
-	// changes, reset is aborted.
+	// changes, or is untracked, reset is aborted with a ResetError.
 	MergeReset
 	// SoftReset does not touch the index file or the working tree at all (but
 	// resets the head to <commit>, just like all modes do). This leaves all
 	// your changed files "Changes to be committed", as git status would put it.
 	SoftReset
+	// KeepReset resets the index entries and updates the files in the working
+	// tree that are different between Commit and HEAD, keeping the local
+	// changes, staged or not, of the other files.
+	//
+	// If a file that is different between Commit and HEAD has local changes,
+	// reset is aborted with a ResetError.
+	KeepReset
 )
 
 // ResetOptions describes how a reset operation should be performed.
@@ -445,8 +710,21 @@ type ResetOptions struct {
 	// Directories not listed here will not appear in the worktree.
 	SparseDirs []string
 
+	// SparsePatterns specifies which files should be checked out, using
+	// gitignore-style patterns. Ignored if SparseDirs is set.
+	SparsePatterns []string
+
 	// SkipSparseDirValidation will skip the validation for SparseDirs.
 	SkipSparseDirValidation bool
+
+	// SymlinkMode defines how the symbolic links are written to the
+	// worktree.
+	SymlinkMode SymlinkMode
+
+	// AllowPathCollisions writes the files whose paths collide on a
+	// case-insensitive filesystem, reporting the collisions to the progress,
+	// if any, instead of failing, as CheckoutOptions.AllowPathCollisions.
+	AllowPathCollisions bool
 }
 
 // Validate validates the fields and sets the default values.
@@ -477,6 +755,13 @@ const (
 	LogOrderBSF
 	LogOrderCommitterTime
 	LogOrderDFSPostFirstParent
+	// LogOrderTopo visits the commits as `git log --topo-order` does: no
+	// commit before all its children, without interleaving the lines of
+	// history, as needed to draw the graph of the history.
+	LogOrderTopo
+	// LogOrderDate visits the commits as `git log --date-order` does: no
+	// commit before all its children, and by committer time otherwise.
+	LogOrderDate
 )
 
 // LogOptions describes how a log action should be performed.
@@ -491,19 +776,33 @@ type LogOptions struct {
 	To plumbing.Hash
 
 	// The default traversal algorithm is Depth-first search
-	// set Order=LogOrderCommitterTime for ordering by committer time (more compatible with `git log`)
+	// set Order=LogOrderCommitterTime for ordering by committer time (more compatible with `git log`),
+	// walked with the commit-graph of the repository if it has one
 	// set Order=LogOrderBSF for Breadth-first search
+	// set Order=LogOrderTopo or LogOrderDate for the orders of `git log
+	// --topo-order` and `git log --date-order`, which read the whole history
+	// before returning the first commit
 	Order LogOrder
 
-	// Show only those commits in which the specified file was inserted/updated.
-	// It is equivalent to running `git log -- <file-name>`.
-	// this field is kept for compatibility, it can be replaced with PathFilter
+	// Show only those commits in which the specified file, or directory, was
+	// inserted/updated. It is equivalent to running `git log -- <file-name>`.
+	//
+	// As with git, the history is simplified: the commits in which the file
+	// is the same as in one of their parents are skipped, and so are the
+	// other parents of the merges, unless Order is neither LogOrderDefault
+	// nor LogOrderCommitterTime. The history is then walked by committer
+	// time.
 	FileName *string
 
+	// Follow, if true, continues the history of FileName before it was
+	// renamed. It is equivalent to running `git log --follow -- <file-name>`.
+	Follow bool
+
 	// Filter commits based on the path of files that are updated
 	// takes file path as argument and should return true if the file is desired
 	// It can be used to implement `git log -- <path>`
 	// either <path> is a file path, or directory path, or a regexp of file/directory path
+	// The history is simplified as with FileName.
 	PathFilter func(string) bool
 
 	// Pretend as if all the refs in refs/, along with HEAD, are listed on the command line as <commit>.
@@ -535,6 +834,25 @@ type AddOptions struct {
 	// Glob adds all paths, matching pattern, to the index. If pattern matches a
 	// directory path, all directory contents are added to the index recursively.
 	Glob string
+	// PathSpec adds the paths matching the given pathspec, equivalent to
+	// `git add -- <pathspec>...`. The pathspec items are patterns relative to
+	// the root of the worktree, matching the paths they name and the ones
+	// inside the directories they name, and supporting the wildcards and
+	// magic of git, such as "*.go", ":(glob)cmd/**" or ":!vendor/**" to
+	// exclude the vendor directory. The deleted files matching the pathspec
+	// are removed from the index, and the ignored files are skipped, unless
+	// Force is set. An error is returned if one of the items matches no
+	// file, or only ignored ones, in which case nothing is added.
+	PathSpec []string
+	// Update equivalent to `git add --update`, only updates the index where
+	// it already has an entry, staging the modifications and deletions of
+	// the tracked files, but not the new files. Without PathSpec, all the
+	// tracked files of the worktree are updated.
+	Update bool
+	// Force adds the ignored files as well, equivalent to `git add --force`.
+	// It applies to the files matched by PathSpec, or to all the files of
+	// the worktree when used with All.
+	Force bool
 	// SkipStatus adds the path with no status check. This option is relevant only
 	// when the `Path` option is specified and does not apply when the `All` option is used.
 	// Notice that when passing an ignored path it will be added anyway.
@@ -544,6 +862,50 @@ type AddOptions struct {
 
 // Validate validates the fields and sets the default values.
 func (o *AddOptions) Validate(r *Repository) error {
+	var paths int
+	for _, set := range []bool{o.Path != "", o.Glob != "", len(o.PathSpec) > 0} {
+		if set {
+			paths++
+		}
+	}
+
+	if paths > 1 {
+		return fmt.Errorf("fields Path, Glob and PathSpec are mutual exclusive")
+	}
+
+	if o.All && o.Update {
+		return fmt.Errorf("fields All and Update are mutual exclusive")
+	}
+
+	if (o.Path != "" || o.Glob != "") && (o.Update || o.Force) {
+		return fmt.Errorf("fields Update and Force require PathSpec or All")
+	}
+
+	return nil
+}
+
+// RemoveOptions describes how a remove operation should be performed.
+type RemoveOptions struct {
+	// Path is the path of the file or directory to remove, a directory being
+	// removed recursively.
+	Path string
+	// Glob removes all paths matching the pattern. If the pattern matches a
+	// directory path, all directory contents are removed recursively.
+	Glob string
+	// Cached only removes the files from the index, keeping them in the
+	// working tree, equivalent to `git rm --cached`.
+	Cached bool
+	// Force removes the files with changes, staged or not, equivalent to
+	// `git rm --force`.
+	Force bool
+}
+
+// Validate validates the fields and sets the default values.
+func (o *RemoveOptions) Validate() error {
+	if o.Path == "" && o.Glob == "" {
+		return fmt.Errorf("one of the fields Path and Glob is required")
+	}
+
 	if o.Path != "" && o.Glob != "" {
 		return fmt.Errorf("fields Path and Glob are mutual exclusive")
 	}
@@ -551,6 +913,13 @@ func (o *AddOptions) Validate(r *Repository) error {
 	return nil
 }
 
+// MoveOptions describes how a move operation should be performed.
+type MoveOptions struct {
+	// Force overwrites the destination file if it exists, equivalent to
+	// `git mv --force`.
+	Force bool
+}
+
 // CommitOptions describes how a commit operation should be performed.
 type CommitOptions struct {
 	// All automatically stage files that have been modified and deleted, but
@@ -559,13 +928,29 @@ type CommitOptions struct {
 	// AllowEmptyCommits enable empty commits to be created. An empty commit
 	// is when no changes to the tree were made, but a new commit message is
 	// provided. The default behavior is false, which results in ErrEmptyCommit.
+	// A merge commit, having several parents, is created even if its tree is
+	// the one of its first parent, as git does.
 	AllowEmptyCommits bool
-	// Author is the author's signature of the commit. If Author is empty the
-	// Name and Email is read from the config, and time.Now it's used as When.
+	// AllowEmptyMessage allows the message to be empty, or made of
+	// whitespaces only. The default behavior is false, which results in
+	// ErrEmptyCommitMessage.
+	AllowEmptyMessage bool
+	// Author is the author's signature of the commit. If Author is nil,
+	// the author and the committer are resolved as git does: from the
+	// GIT_AUTHOR_NAME, GIT_AUTHOR_EMAIL and GIT_AUTHOR_DATE environment
+	// variables, or the GIT_COMMITTER_ ones, then the author.name or
+	// committer.name config, then user.name, and finally from the user of
+	// the system, unless user.useConfigOnly is set, in which case
+	// ErrMissingAuthor or ErrMissingCommitter is returned. time.Now is used
+	// as When, unless a date is given by the environment.
 	Author *object.Signature
 	// Committer is the committer's signature of the commit. If Committer is
-	// nil the Author signature is used.
+	// nil the Author signature is used, if given.
 	Committer *object.Signature
+	// Location is the time zone of the signatures read from the config,
+	// the local one if nil. With time.UTC, the signatures do not depend on
+	// the time zone of the machine creating the commit.
+	Location *time.Location
 	// Parents are the parents commits for the new commit, by default when
 	// len(Parents) is zero, the hash of HEAD reference is used.
 	Parents []plumbing.Hash
@@ -578,8 +963,22 @@ type CommitOptions struct {
 	// Takes precedence over SignKey.
 	Signer Signer
 	// Amend will create a new commit object and replace the commit that HEAD currently
-	// points to. Cannot be used with All nor Parents.
+	// points to. Cannot be used with All nor Parents. The message of the
+	// replaced commit is reused if the message is empty. ErrNoCommitToAmend
+	// is returned if HEAD has no commit.
 	Amend bool
+	// SignOff appends a Signed-off-by trailer of the committer to the
+	// message, as `git commit --signoff` does, unless it is already the last
+	// trailer of the message.
+	SignOff bool
+	// RunHooks runs the pre-commit and commit-msg hooks of the repository,
+	// once the files to commit are staged, the commit being aborted with a
+	// HookError if either fails. The commit-msg hook may rewrite the
+	// message.
+	RunHooks bool
+	// Hooks is the HookRunner running the hooks if RunHooks is set. If nil,
+	// the scripts of the hooks directory of the repository are run.
+	Hooks HookRunner
 }
 
 // Validate validates the fields and sets the default values.
@@ -611,46 +1010,53 @@ func (o *CommitOptions) Validate(r *Repository) error {
 		if head != nil {
 			o.Parents = []plumbing.Hash{head.Hash()}
 		}
+
+		// The commit concluding a merge stopped on conflicts is the merge
+		// commit.
+		merge, err := r.Storer.Reference(MergeHead)
+		if err != nil && !errors.Is(err, plumbing.ErrReferenceNotFound) {
+			return err
+		}
+
+		if head != nil && merge != nil && !o.Amend {
+			o.Parents = append(o.Parents, merge.Hash())
+		}
 	}
 
 	return nil
 }
 
+// loadConfigAuthorAndCommitter resolves the author and the committer that
+// are nil, see resolveIdentity.
 func (o *CommitOptions) loadConfigAuthorAndCommitter(r *Repository) error {
 	cfg, err := r.ConfigScoped(config.SystemScope)
 	if err != nil {
 		return err
 	}
 
-	if o.Author == nil && cfg.Author.Email != "" && cfg.Author.Name != "" {
-		o.Author = &object.Signature{
-			Name:  cfg.Author.Name,
-			Email: cfg.Author.Email,
-			When:  time.Now(),
+	if o.Author == nil {
+		if o.Author, err = resolveIdentity(cfg, authorRole, o.Location); err != nil {
+			return err
 		}
 	}
 
-	if o.Committer == nil && cfg.Committer.Email != "" && cfg.Committer.Name != "" {
-		o.Committer = &object.Signature{
-			Name:  cfg.Committer.Name,
-			Email: cfg.Committer.Email,
-			When:  time.Now(),
+	if o.Committer == nil {
+		if o.Committer, err = resolveIdentity(cfg, committerRole, o.Location); err != nil {
+			return err
 		}
 	}
 
-	if o.Author == nil && cfg.User.Email != "" && cfg.User.Name != "" {
-		o.Author = &object.Signature{
-			Name:  cfg.User.Name,
-			Email: cfg.User.Email,
-			When:  time.Now(),
-		}
-	}
+	return nil
+}
 
-	if o.Author == nil {
-		return ErrMissingAuthor
+// signatureTime returns the current time in loc, or in the local time zone
+// if loc is nil.
+func signatureTime(loc *time.Location) time.Time {
+	if loc == nil {
+		return time.Now()
 	}
 
-	return nil
+	return time.Now().In(loc)
 }
 
 var (
@@ -664,6 +1070,9 @@ type CreateTagOptions struct {
 	// Tagger defines the signature of the tag creator. If Tagger is empty the
 	// Name and Email is read from the config, and time.Now it's used as When.
 	Tagger *object.Signature
+	// Location is the time zone of the signature read from the config, the
+	// local one if nil, as CommitOptions.Location.
+	Location *time.Location
 	// Message defines the annotation of the tag. It is canonicalized during
 	// validation into the format expected by git - no leading whitespace and
 	// ending in a newline.
@@ -671,6 +1080,10 @@ type CreateTagOptions struct {
 	// SignKey denotes a key to sign the tag with. A nil value here means the tag
 	// will not be signed. The private key must be present and already decrypted.
 	SignKey *openpgp.Entity
+	// Signer denotes a cryptographic signer to sign the tag with, such as
+	// NewSSHSigner. A nil value here means the tag will not be signed.
+	// Takes precedence over SignKey.
+	Signer Signer
 }
 
 // Validate validates the fields and sets the default values.
@@ -701,7 +1114,7 @@ func (o *CreateTagOptions) loadConfigTagger(r *Repository) error {
 		o.Tagger = &object.Signature{
 			Name:  cfg.Author.Name,
 			Email: cfg.Author.Email,
-			When:  time.Now(),
+			When:  signatureTime(o.Location),
 		}
 	}
 
@@ -709,7 +1122,7 @@ func (o *CreateTagOptions) loadConfigTagger(r *Repository) error {
 		o.Tagger = &object.Signature{
 			Name:  cfg.User.Name,
 			Email: cfg.User.Email,
-			When:  time.Now(),
+			When:  signatureTime(o.Location),
 		}
 	}
 
@@ -733,8 +1146,21 @@ type ListOptions struct {
 	PeelingOption PeelingOption
 	// ProxyOptions provides info required for connecting to a proxy.
 	ProxyOptions transport.ProxyOptions
+	// Timeouts bounds the time waiting for the server, such as the idle
+	// time after which a stalled packfile transfer is aborted.
+	Timeouts transport.TimeoutOptions
 	// Timeout specifies the timeout in seconds for list operations
 	Timeout int
+	// RefPrefixes limits the listed references to the ones whose name
+	// starts with one of the prefixes. When the remote speaks protocol v2,
+	// the filtering is done by the remote and the rest of the references
+	// are not transferred. All the references are listed when empty.
+	RefPrefixes []string
+	// ProtocolVersion is the version of the Git wire protocol requested to
+	// the remote, which answers using protocol v0 if it does not support it.
+	// When not set, the protocol.version of the repository configuration
+	// is used.
+	ProtocolVersion protocol.Version
 }
 
 // PeelingOption represents the different ways to handle peeled references.
@@ -755,7 +1181,34 @@ const (
 
 // CleanOptions describes how a clean should be performed.
 type CleanOptions struct {
+	// Dir removes the untracked directories too, as `git clean -d`. Without
+	// it, the untracked files are only removed from the tracked directories.
 	Dir bool
+	// IgnoredOnly only removes the files ignored by the .gitignore files and
+	// the excludes of the worktree, as `git clean -X`.
+	IgnoredOnly bool
+	// IncludeIgnored removes the ignored files along with the untracked
+	// ones, as `git clean -x`.
+	IncludeIgnored bool
+	// DryRun leaves the worktree untouched, Worktree.CleanPaths returning
+	// the paths that would be removed.
+	DryRun bool
+	// PathSpec limits the clean to the given files and directories, relative
+	// to the root of the worktree.
+	PathSpec []string
+}
+
+// ErrIgnoredOnlyIncludeIgnoredExclusive is returned by CleanOptions.Validate
+// when both IgnoredOnly and IncludeIgnored are set.
+var ErrIgnoredOnlyIncludeIgnoredExclusive = errors.New("IgnoredOnly and IncludeIgnored are mutually exclusive")
+
+// Validate validates the fields and sets the default values.
+func (o *CleanOptions) Validate() error {
+	if o.IgnoredOnly && o.IncludeIgnored {
+		return ErrIgnoredOnlyIncludeIgnoredExclusive
+	}
+
+	return nil
 }
 
 // GrepOptions describes how a grep should be performed.
@@ -770,8 +1223,27 @@ type GrepOptions struct {
 	ReferenceName plumbing.ReferenceName
 	// PathSpecs are compiled Regexp objects of pathspec to use in the matching.
 	PathSpecs []*regexp.Regexp
+	// FixedStrings are strings matched literally, as the patterns of
+	// `git grep --fixed-strings` are, in addition to Patterns.
+	FixedStrings []string
+	// IgnoreCase ignores the case differences between the patterns and the
+	// lines.
+	IgnoreCase bool
+	// WordRegexp only matches the patterns at word boundaries, as
+	// `git grep --word-regexp` does: the match starts at the beginning of the
+	// line or after a non-word character, and ends at the end of the line or
+	// before a non-word character, the word characters being the ASCII
+	// letters, digits and underscores.
+	WordRegexp bool
+	// Text searches the binary files as if they were text. The binary files,
+	// with a NUL byte in their first 8000 bytes, are skipped otherwise.
+	Text bool
 }
 
+// grepBinarySniffLen is the number of first bytes of a file searched for a
+// NUL byte to tell whether it is binary.
+const grepBinarySniffLen = 8000
+
 var ErrHashOrReference = errors.New("ambiguous options, only one of CommitHash or ReferenceName can be passed")
 
 // Validate validates the fields and sets the default values.
@@ -799,6 +1271,48 @@ func (o *GrepOptions) validate(r *Repository) error {
 	return nil
 }
 
+// patterns returns the regular expressions matching the lines selected by
+// the Patterns and the FixedStrings of the options.
+func (o *GrepOptions) patterns() ([]*regexp.Regexp, error) {
+	exprs := make([]string, 0, len(o.Patterns)+len(o.FixedStrings))
+	var patterns []*regexp.Regexp
+	for _, p := range o.Patterns {
+		if p == nil {
+			continue
+		}
+
+		if !o.IgnoreCase && !o.WordRegexp {
+			patterns = append(patterns, p)
+			continue
+		}
+
+		exprs = append(exprs, p.String())
+	}
+
+	for _, s := range o.FixedStrings {
+		exprs = append(exprs, regexp.QuoteMeta(s))
+	}
+
+	for _, expr := range exprs {
+		if o.WordRegexp {
+			expr = `(?:^|[^0-9A-Za-z_])(?:` + expr + `)(?:$|[^0-9A-Za-z_])`
+		}
+
+		if o.IgnoreCase {
+			expr = `(?i)` + expr
+		}
+
+		p, err := regexp.Compile(expr)
+		if err != nil {
+			return nil, err
+		}
+
+		patterns = append(patterns, p)
+	}
+
+	return patterns, nil
+}
+
 // PlainOpenOptions describes how opening a plain repository should be
 // performed.
 type PlainOpenOptions struct {
@@ -806,7 +1320,9 @@ type PlainOpenOptions struct {
 	// walked until a .git directory or file is found.
 	DetectDotGit bool
 	// Enable .git/commondir support (see https://git-scm.com/docs/gitrepository-layout#Documentation/gitrepository-layout.txt).
-	// NOTE: This option will only work with the filesystem storage.
+	//
+	// Deprecated: the commondir file of the linked worktrees is always
+	// followed, this option has no effect.
 	EnableDotGitCommonDir bool
 }
 
@@ -819,17 +1335,288 @@ var ErrNoRestorePaths = errors.New("you must specify path(s) to restore")
 type RestoreOptions struct {
 	// Marks to restore the content in the index
 	Staged bool
-	// Marks to restore the content of the working tree
+	// Marks to restore the content of the working tree. It is the default
+	// if Staged is not set.
 	Worktree bool
+	// Source is the commit the files are restored from. If zero, they are
+	// restored from HEAD if Staged is set, and from the index otherwise.
+	Source plumbing.Hash
 	// List of file paths that will be restored
 	Files []string
+	// PathSpec restores the files matching the given pathspec, along with
+	// Files, with the same syntax as AddOptions.PathSpec.
+	PathSpec []string
 }
 
 // Validate validates the fields and sets the default values.
 func (o *RestoreOptions) Validate() error {
-	if len(o.Files) == 0 {
+	if len(o.Files) == 0 && len(o.PathSpec) == 0 {
 		return ErrNoRestorePaths
 	}
 
+	if !o.Staged {
+		o.Worktree = true
+	}
+
+	return nil
+}
+
+// StashOptions describes how a stash should be created.
+type StashOptions struct {
+	// Message is the description of the stash. If empty, the stash is
+	// described with the current branch and the HEAD commit.
+	Message string
+	// IncludeUntracked also stashes the untracked files, and removes them
+	// from the working tree. Ignored files are not stashed.
+	IncludeUntracked bool
+	// Author is the signature used for the commits of the stash. If Author
+	// is empty the Name and Email is read from the config, and time.Now it's
+	// used as When.
+	Author *object.Signature
+}
+
+// Validate validates the fields and sets the default values.
+func (o *StashOptions) Validate(r *Repository) error {
+	if o.Author == nil {
+		co := &CommitOptions{}
+		if err := co.loadConfigAuthorAndCommitter(r); err != nil {
+			return err
+		}
+
+		o.Author = co.Author
+	}
+
+	return nil
+}
+
+// ErrNoUpstream is returned by a rebase when no upstream is given and the
+// current branch has no upstream configured, and by Repository.TrackingStatus
+// when the branch has none.
+var ErrNoUpstream = errors.New("no upstream configured for the branch")
+
+// RebaseOptions describes how a rebase should be performed.
+type RebaseOptions struct {
+	// Upstream is the commit the current branch is rebased on. The commits
+	// reachable from HEAD but not from Upstream are replayed, merge commits
+	// excepted. If empty, the upstream of the current branch is used, as
+	// configured by branch.<name>.remote and branch.<name>.merge.
+	Upstream plumbing.Hash
+	// Onto is the commit the commits are replayed on. If empty, Upstream is
+	// used.
+	Onto plumbing.Hash
+	// Committer is the committer of the replayed commits. If empty, the Name
+	// and Email is read from the config, and time.Now it's used as When. The
+	// author of the replayed commits, including the date, is preserved.
+	Committer *object.Signature
+	// Autostash, if true, stashes the local changes before the rebase, and
+	// applies them back once it is finished or aborted, as `git rebase
+	// --autostash` does. If they can't be applied, they are kept in the
+	// stash list.
+	Autostash bool
+}
+
+// Validate validates the fields and sets the default values.
+func (o *RebaseOptions) Validate(r *Repository) error {
+	if o.Upstream.IsZero() {
+		upstream, err := r.branchUpstream()
+		if err != nil {
+			return err
+		}
+
+		o.Upstream = upstream
+	}
+
+	if o.Onto.IsZero() {
+		o.Onto = o.Upstream
+	}
+
 	return nil
 }
+
+// ErrInvalidMainline is returned when the Mainline of a cherry-pick does not
+// correspond to a parent of the commit.
+var ErrInvalidMainline = errors.New("invalid mainline")
+
+// CherryPickOptions describes how a cherry-pick should be performed.
+type CherryPickOptions struct {
+	// Mainline is the number, starting from 1, of the parent of a merge
+	// commit its changes are computed from. It is required to cherry-pick a
+	// merge commit, and must be zero otherwise.
+	Mainline int
+	// RecordOrigin, if true, appends a "(cherry picked from commit ...)"
+	// line to the message of the commit, as `git cherry-pick -x` does.
+	RecordOrigin bool
+	// Committer is the committer of the commit. If empty, the Name and Email
+	// is read from the config, and time.Now it's used as When. The author of
+	// the commit, including the date, is preserved.
+	Committer *object.Signature
+}
+
+// Validate validates the fields and sets the default values.
+func (o *CherryPickOptions) Validate(c *object.Commit) error {
+	if c.NumParents() > 1 && o.Mainline == 0 {
+		return fmt.Errorf("%w: commit %s is a merge but no mainline was given", ErrInvalidMainline, c.Hash)
+	}
+
+	if o.Mainline < 0 || o.Mainline > c.NumParents() || (c.NumParents() <= 1 && o.Mainline != 0) {
+		return fmt.Errorf("%w: commit %s has no parent %d", ErrInvalidMainline, c.Hash, o.Mainline)
+	}
+
+	return nil
+}
+
+// ErrInvalidLineRange is returned when the LineRange of a blame is not
+// within the lines of the file.
+var ErrInvalidLineRange = errors.New("invalid line range")
+
+// BlameOptions describes how a blame should be performed.
+type BlameOptions struct {
+	// FollowRenames, if true, follows the file across renames, blaming the
+	// lines coming from the file it has been renamed from.
+	FollowRenames bool
+	// LineRange is the range of lines to blame, numbered from 1 and both
+	// included. If the end is zero, the lines until the end of the file are
+	// blamed. If both are zero, all the lines are blamed.
+	LineRange [2]int
+}
+
+// lineRange returns the indexes of the range of lines to blame, in a file
+// with the given number of lines.
+func (o *BlameOptions) lineRange(lines int) (start, end int, err error) {
+	start, end = o.LineRange[0], o.LineRange[1]
+	if start == 0 && end == 0 {
+		return 0, lines, nil
+	}
+
+	if end == 0 {
+		end = lines
+	}
+
+	if start < 1 || start > end || end > lines {
+		return 0, 0, fmt.Errorf("%w: %d,%d for a file with %d lines", ErrInvalidLineRange, o.LineRange[0], o.LineRange[1], lines)
+	}
+
+	return start - 1, end, nil
+}
+
+// CreateBundleOptions describes how a bundle should be created.
+type CreateBundleOptions struct {
+	// Exclude are the commits whose history is left out of the bundle, as
+	// the repositories reading it already have it, like the ^<commit>
+	// arguments of `git bundle create`. The excluded commits the bundle
+	// depends on are listed as its prerequisites.
+	Exclude []plumbing.Hash
+	// Version is the version of the bundle format, 2 or 3. If zero, version
+	// 2 is used, unless the repository uses SHA-256 object ids.
+	Version int
+}
+
+// ApplyOptions describes how a patch should be applied.
+type ApplyOptions struct {
+	// Index, if true, also applies the patch to the index, as
+	// `git apply --index` does.
+	Index bool
+	// ThreeWay, if true, falls back to a three-way merge for the files whose
+	// hunks don't apply, if the patch identifies the blobs of their original
+	// contents, which must be in the repository. The conflicts are left
+	// unmerged in the index, and delimited by conflict markers in the
+	// working tree, as `git apply --3way` does. It implies Index.
+	ThreeWay bool
+	// Reverse, if true, applies the patch in reverse, undoing its changes.
+	Reverse bool
+	// Check, if true, only checks whether the patch applies, without
+	// changing anything.
+	Check bool
+	// Reject, if true, applies the hunks of the patch that apply, instead of
+	// failing, and writes the rejected hunks of the working tree files to
+	// .rej files next to them.
+	Reject bool
+}
+
+// FsckOptions describes how the integrity of a repository should be checked.
+type FsckOptions struct {
+	// Severities overrides the severities of the issues by id, as the
+	// fsck.<msg-id> config options do. The issues with the FsckIgnore
+	// severity are left out of the report.
+	Severities map[FsckMessageID]FsckSeverity
+	// NoDangling, if true, doesn't report the dangling objects, as
+	// `git fsck --no-dangling` does.
+	NoDangling bool
+	// NoReflogs, if true, doesn't consider the objects only reachable from
+	// the reflogs as reachable, as `git fsck --no-reflogs` does.
+	NoReflogs bool
+}
+
+// GCOptions describes how a repository should be cleaned up by GC.
+type GCOptions struct {
+	// PruneExpire is the time before which the unreachable objects are
+	// pruned. If zero, the gc.pruneExpire config is used, which defaults to
+	// 2 weeks ago.
+	PruneExpire time.Time
+	// ReflogExpire is the time before which the entries of the reflogs are
+	// expired. If zero, the gc.reflogExpire config is used, which defaults
+	// to 90 days ago.
+	ReflogExpire time.Time
+	// ReflogExpireUnreachable is the time before which the entries of the
+	// reflogs not reachable from the current tip of their reference are
+	// expired. If zero, the gc.reflogExpireUnreachable config is used, which
+	// defaults to 30 days ago.
+	ReflogExpireUnreachable time.Time
+	// DryRun, if true, only reports what would be done, without changing
+	// anything.
+	DryRun bool
+}
+
+// ErrBaseRequiresHead is returned by ReadTree when the base of a three-way
+// merge is given without the head.
+var ErrBaseRequiresHead = errors.New("Head is mandatory when Base is used")
+
+// ReadTreeOptions describes how a tree should be read into the index.
+type ReadTreeOptions struct {
+	// Merge, if true, merges the tree into the index, as `git read-tree -m`
+	// does, instead of replacing the index: the entries which are left
+	// unchanged keep their stat data, and the index must not have unmerged
+	// entries. It is implied by Reset, Head and Base.
+	Merge bool
+	// Reset, if true, is like Merge, but discards the unmerged entries of
+	// the index instead of failing, as `git read-tree --reset` does.
+	Reset bool
+	// Head is the tree, or the commit, the index is switched from to the
+	// tree read, in a two-way merge, as `git read-tree -m <head> <tree>`
+	// does, or the one of ours in a three-way merge.
+	Head plumbing.Hash
+	// Base is the tree, or the commit, of the merge base of Head and the
+	// tree read, in a three-way merge, as `git read-tree -m <base> <head>
+	// <tree>` does. The paths which cannot be merged trivially are left
+	// unmerged in the index, in the stages of the base, ours and theirs.
+	Base plumbing.Hash
+	// Aggressive, if true, also merges trivially in a three-way merge the
+	// paths removed on both sides, or on one side and unchanged on the
+	// other, and the ones added identically on both sides, as
+	// `git read-tree --aggressive` does.
+	Aggressive bool
+}
+
+// Validate validates the fields and sets the default values.
+func (o *ReadTreeOptions) Validate() error {
+	if !o.Base.IsZero() && o.Head.IsZero() {
+		return ErrBaseRequiresHead
+	}
+
+	if o.Reset || !o.Head.IsZero() {
+		o.Merge = true
+	}
+
+	return nil
+}
+
+// CheckoutIndexOptions describes how the files of the index should be
+// written to the working tree.
+type CheckoutIndexOptions struct {
+	// Paths is the pathspec of the files to write. If empty, all the files
+	// of the index are written, as `git checkout-index --all` does.
+	Paths []string
+	// Force, if true, overwrites the files already in the working tree,
+	// which are otherwise left as they are.
+	Force bool
+}
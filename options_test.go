@@ -1,8 +1,11 @@
 package git
 
 import (
+	"bytes"
 	"os"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/go-git/go-billy/v6/util"
 	"github.com/stretchr/testify/suite"
@@ -100,6 +103,29 @@ func (s *OptionsSuite) TestCreateTagOptionsLoadGlobal() {
 	s.Equal("foo@foo.com", o.Tagger.Email)
 }
 
+func (s *OptionsSuite) TestSignaturesLocation() {
+	cfg := config.NewConfig()
+	cfg.User.Name = "foo"
+	cfg.User.Email = "foo@foo.com"
+
+	clean := s.writeGlobalConfig(cfg)
+	defer clean()
+
+	ist := time.FixedZone("", 5*3600+30*60)
+	o := CommitOptions{Location: ist}
+	s.NoError(o.Validate(s.Repository))
+	s.Equal(ist, o.Author.When.Location())
+	s.Equal(ist, o.Committer.When.Location())
+
+	var b bytes.Buffer
+	s.NoError(o.Author.Encode(&b))
+	s.True(strings.HasSuffix(b.String(), " +0530"), b.String())
+
+	t := CreateTagOptions{Message: "foo", Location: time.UTC}
+	s.NoError(t.Validate(s.Repository, plumbing.ZeroHash))
+	s.Equal(time.UTC, t.Tagger.When.Location())
+}
+
 func (s *OptionsSuite) writeGlobalConfig(cfg *config.Config) func() {
 	fs := s.TemporalFilesystem()
 
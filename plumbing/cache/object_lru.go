@@ -8,14 +8,36 @@ import (
 )
 
 // ObjectLRU implements an object cache with an LRU eviction policy and a
-// maximum size (measured in object size).
+// maximum size (measured in object size). It is safe for concurrent use: as
+// the objects are identified by their hash, a single ObjectLRU can be shared
+// by the storers of several repositories, bounding the memory of all their
+// cached objects.
 type ObjectLRU struct {
 	MaxSize FileSize
+	// MaxEntrySize is the size above which the objects are not cached, for
+	// a large object not to evict all the others. If left unset or set to 0,
+	// the objects are cached up to MaxSize.
+	MaxEntrySize FileSize
 
 	actualSize FileSize
 	ll         *list.List
 	cache      map[any]*list.Element
 	mut        sync.Mutex
+	stats      ObjectStats
+}
+
+// ObjectStats are the counters of an object cache.
+type ObjectStats struct {
+	// Hits is the number of objects found in the cache by Get.
+	Hits uint64
+	// Misses is the number of objects not found in the cache by Get.
+	Misses uint64
+	// Evictions is the number of objects evicted to make room for others.
+	Evictions uint64
+	// Objects is the number of objects in the cache.
+	Objects int
+	// Size is the size of the objects in the cache.
+	Size FileSize
 }
 
 // NewObjectLRU creates a new ObjectLRU with the given maximum size. The maximum
@@ -46,12 +68,19 @@ func (c *ObjectLRU) Put(obj plumbing.EncodedObject) {
 	key := obj.Hash()
 	if ee, ok := c.cache[key]; ok {
 		oldObj := ee.Value.(plumbing.EncodedObject)
+		if c.MaxEntrySize > 0 && objSize > c.MaxEntrySize {
+			c.ll.Remove(ee)
+			delete(c.cache, key)
+			c.actualSize -= FileSize(oldObj.Size())
+			return
+		}
+
 		// in this case objSize is a delta: new size - old size
 		objSize -= FileSize(oldObj.Size())
 		c.ll.MoveToFront(ee)
 		ee.Value = obj
 	} else {
-		if objSize > c.MaxSize {
+		if objSize > c.MaxSize || c.MaxEntrySize > 0 && objSize > c.MaxEntrySize {
 			return
 		}
 		ee := c.ll.PushFront(obj)
@@ -72,6 +101,7 @@ func (c *ObjectLRU) Put(obj plumbing.EncodedObject) {
 		c.ll.Remove(last)
 		delete(c.cache, lastObj.Hash())
 		c.actualSize -= lastSize
+		c.stats.Evictions++
 	}
 }
 
@@ -83,13 +113,27 @@ func (c *ObjectLRU) Get(k plumbing.Hash) (plumbing.EncodedObject, bool) {
 
 	ee, ok := c.cache[k]
 	if !ok {
+		c.stats.Misses++
 		return nil, false
 	}
 
+	c.stats.Hits++
 	c.ll.MoveToFront(ee)
 	return ee.Value.(plumbing.EncodedObject), true
 }
 
+// Stats returns the counters of the cache. The hits, misses and evictions are
+// counted since the creation of the cache, and are not reset by Clear.
+func (c *ObjectLRU) Stats() ObjectStats {
+	c.mut.Lock()
+	defer c.mut.Unlock()
+
+	stats := c.stats
+	stats.Objects = len(c.cache)
+	stats.Size = c.actualSize
+	return stats
+}
+
 // Clear the content of this object cache.
 func (c *ObjectLRU) Clear() {
 	c.mut.Lock()
@@ -167,6 +167,77 @@ func (s *ObjectSuite) TestObjectUpdateOverflow() {
 	o.Put(b)
 }
 
+func (s *ObjectSuite) TestStats() {
+	o := NewObjectLRU(2 * Byte)
+	s.Equal(ObjectStats{}, o.Stats())
+
+	o.Put(s.cObject)
+	o.Put(s.dObject)
+	_, ok := o.Get(s.cObject.Hash())
+	s.True(ok)
+	_, ok = o.Get(s.aObject.Hash())
+	s.False(ok)
+	s.Equal(ObjectStats{Hits: 1, Misses: 1, Objects: 2, Size: 2 * Byte}, o.Stats())
+
+	// The least recently used object, d, is evicted.
+	o.Put(s.aObject)
+	_, ok = o.Get(s.dObject.Hash())
+	s.False(ok)
+	s.Equal(ObjectStats{Hits: 1, Misses: 2, Evictions: 1, Objects: 2, Size: 2 * Byte}, o.Stats())
+
+	o.Put(s.eObject)
+	s.Equal(ObjectStats{Hits: 1, Misses: 2, Evictions: 3, Objects: 1, Size: 2 * Byte}, o.Stats())
+
+	o.Clear()
+	s.Equal(ObjectStats{Hits: 1, Misses: 2, Evictions: 3}, o.Stats())
+}
+
+func (s *ObjectSuite) TestMaxEntrySize() {
+	o := NewObjectLRU(4 * Byte)
+	o.MaxEntrySize = 2 * Byte
+
+	o.Put(s.aObject)
+	o.Put(s.eObject)
+	o.Put(s.bObject)
+
+	_, ok := o.Get(s.bObject.Hash())
+	s.False(ok)
+	s.Equal(ObjectStats{Misses: 1, Objects: 2, Size: 3 * Byte}, o.Stats())
+
+	// An object growing above MaxEntrySize is removed.
+	o.Put(newObject(s.eObject.Hash().String(), 3*Byte))
+	_, ok = o.Get(s.eObject.Hash())
+	s.False(ok)
+	_, ok = o.Get(s.aObject.Hash())
+	s.True(ok)
+	s.Equal(ObjectStats{Hits: 1, Misses: 2, Objects: 1, Size: 1 * Byte}, o.Stats())
+}
+
+func (s *ObjectSuite) TestConcurrentStats() {
+	o := NewObjectLRU(10 * Byte)
+
+	var wg sync.WaitGroup
+	for i := range 100 {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			o.Put(newObject(fmt.Sprint(i%20), 1*Byte))
+			o.Get(plumbing.NewHash(fmt.Sprint(i % 20)))
+		}()
+
+		go func() {
+			defer wg.Done()
+			o.Stats()
+		}()
+	}
+
+	wg.Wait()
+	stats := o.Stats()
+	s.Equal(uint64(100), stats.Hits+stats.Misses)
+	s.LessOrEqual(stats.Size, 10*Byte)
+	s.Equal(int(stats.Size), stats.Objects)
+}
+
 type dummyObject struct {
 	hash plumbing.Hash
 	size FileSize
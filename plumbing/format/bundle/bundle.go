@@ -0,0 +1,89 @@
+package bundle
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/go-git/go-git/v6/plumbing"
+	"github.com/go-git/go-git/v6/plumbing/format/config"
+	"github.com/go-git/go-git/v6/plumbing/storer"
+)
+
+const (
+	// V2 is the version of the bundles without capabilities, which can
+	// only hold SHA-1 objects.
+	V2 = 2
+	// V3 is the version of the bundles with capabilities.
+	V3 = 3
+
+	signatureV2 = "# v2 git bundle"
+	signatureV3 = "# v3 git bundle"
+
+	objectFormatCapability = "object-format"
+	filterCapability       = "filter"
+)
+
+var (
+	// ErrUnsupportedVersion is returned when the bundle version is not
+	// supported, or the signature is not the one of a bundle.
+	ErrUnsupportedVersion = errors.New("unsupported bundle version")
+	// ErrUnsupportedCapability is returned by Decode when the bundle
+	// requires an unknown capability.
+	ErrUnsupportedCapability = errors.New("unsupported bundle capability")
+	// ErrMalformedHeader is returned by Decode when the bundle header is
+	// corrupted.
+	ErrMalformedHeader = errors.New("malformed bundle header")
+	// ErrMissingPrerequisites is returned by Verify when the commits
+	// required by the bundle are not in the repository.
+	ErrMissingPrerequisites = errors.New("repository lacks the prerequisite commits")
+)
+
+// Header is the header of a bundle, describing the packfile following it.
+type Header struct {
+	// Version is the version of the bundle, V2 or V3. If zero, Encode uses
+	// V2 when possible, and V3 otherwise.
+	Version int
+	// ObjectFormat is the hash algorithm of the object ids of the bundle.
+	ObjectFormat config.ObjectFormat
+	// Filter is the object filter used to create the bundle, if any. It
+	// requires V3.
+	Filter string
+	// Prerequisites are the commits required to use the bundle.
+	Prerequisites []Prerequisite
+	// References are the references contained in the bundle. They are
+	// always hash references.
+	References []*plumbing.Reference
+}
+
+// Prerequisite is a commit that must already be in the repository reading
+// a bundle, as its history is not included in the packfile.
+type Prerequisite struct {
+	Hash plumbing.Hash
+	// Comment is a human readable description of the commit, usually the
+	// subject of its message.
+	Comment string
+}
+
+// Verify checks that the prerequisites of the bundle are in the given
+// storer, returning ErrMissingPrerequisites otherwise.
+func (h *Header) Verify(s storer.EncodedObjectStorer) error {
+	var missing []string
+	for _, p := range h.Prerequisites {
+		err := s.HasEncodedObject(p.Hash)
+		if errors.Is(err, plumbing.ErrObjectNotFound) {
+			missing = append(missing, p.Hash.String())
+			continue
+		}
+
+		if err != nil {
+			return err
+		}
+	}
+
+	if len(missing) > 0 {
+		return fmt.Errorf("%w: %s", ErrMissingPrerequisites, strings.Join(missing, ", "))
+	}
+
+	return nil
+}
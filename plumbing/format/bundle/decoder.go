@@ -0,0 +1,131 @@
+package bundle
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/go-git/go-git/v6/plumbing"
+	"github.com/go-git/go-git/v6/plumbing/format/config"
+)
+
+// A Decoder reads a bundle from an input stream.
+type Decoder struct {
+	r *bufio.Reader
+}
+
+// NewDecoder returns a new decoder that reads from r.
+func NewDecoder(r io.Reader) *Decoder {
+	return &Decoder{r: bufio.NewReader(r)}
+}
+
+// Decode reads the header of the bundle and stores it in the value pointed
+// to by h. The packfile following it can then be read with Packfile.
+func (d *Decoder) Decode(h *Header) error {
+	line, err := d.readLine()
+	if err != nil {
+		return err
+	}
+
+	switch line {
+	case signatureV2:
+		h.Version = V2
+	case signatureV3:
+		h.Version = V3
+	default:
+		return fmt.Errorf("%w: %q", ErrUnsupportedVersion, line)
+	}
+
+	h.ObjectFormat = config.SHA1
+	for {
+		line, err := d.readLine()
+		if err != nil {
+			return err
+		}
+
+		if line == "" {
+			return nil
+		}
+
+		switch line[0] {
+		case '@':
+			if h.Version < V3 {
+				return fmt.Errorf("%w: capability in a v%d bundle", ErrMalformedHeader, h.Version)
+			}
+
+			if err := decodeCapability(h, line[1:]); err != nil {
+				return err
+			}
+		case '-':
+			hex, comment, _ := strings.Cut(line[1:], " ")
+			hash, err := decodeHash(h, hex)
+			if err != nil {
+				return err
+			}
+
+			h.Prerequisites = append(h.Prerequisites, Prerequisite{Hash: hash, Comment: comment})
+		default:
+			hex, name, ok := strings.Cut(line, " ")
+			if !ok || name == "" {
+				return fmt.Errorf("%w: invalid reference %q", ErrMalformedHeader, line)
+			}
+
+			hash, err := decodeHash(h, hex)
+			if err != nil {
+				return err
+			}
+
+			h.References = append(h.References, plumbing.NewHashReference(plumbing.ReferenceName(name), hash))
+		}
+	}
+}
+
+// Packfile returns a reader of the packfile following the header. It must
+// be called after Decode.
+func (d *Decoder) Packfile() io.Reader {
+	return d.r
+}
+
+func (d *Decoder) readLine() (string, error) {
+	line, err := d.r.ReadString('\n')
+	if err == io.EOF {
+		return "", fmt.Errorf("%w: unexpected end of header", ErrMalformedHeader)
+	}
+
+	if err != nil {
+		return "", err
+	}
+
+	return strings.TrimSuffix(line, "\n"), nil
+}
+
+func decodeCapability(h *Header, capability string) error {
+	key, value, _ := strings.Cut(capability, "=")
+	switch key {
+	case objectFormatCapability:
+		switch value {
+		case config.SHA1.String():
+			h.ObjectFormat = config.SHA1
+		case config.SHA256.String():
+			h.ObjectFormat = config.SHA256
+		default:
+			return fmt.Errorf("%w: object format %q", ErrUnsupportedCapability, value)
+		}
+	case filterCapability:
+		h.Filter = value
+	default:
+		return fmt.Errorf("%w: %q", ErrUnsupportedCapability, key)
+	}
+
+	return nil
+}
+
+func decodeHash(h *Header, hex string) (plumbing.Hash, error) {
+	hash, ok := plumbing.FromHex(hex)
+	if !ok || len(hex) != h.ObjectFormat.HexSize() {
+		return plumbing.ZeroHash, fmt.Errorf("%w: invalid object id %q", ErrMalformedHeader, hex)
+	}
+
+	return hash, nil
+}
@@ -0,0 +1,90 @@
+package bundle
+
+import (
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/go-git/go-git/v6/plumbing"
+	"github.com/go-git/go-git/v6/plumbing/format/config"
+)
+
+func TestDecode(t *testing.T) {
+	t.Parallel()
+
+	input := "# v2 git bundle\n" +
+		"-f6c013c9a5cbdc0f871c183beaf9255f1cce38ee c2\n" +
+		"d1b679b73c1da78feb0699b7de0f501d18acdb53 refs/heads/master\n" +
+		"d1b679b73c1da78feb0699b7de0f501d18acdb53 HEAD\n" +
+		"\n" +
+		"PACK"
+
+	d := NewDecoder(strings.NewReader(input))
+	var h Header
+	require.NoError(t, d.Decode(&h))
+
+	assert.Equal(t, V2, h.Version)
+	assert.Equal(t, config.SHA1, h.ObjectFormat)
+	assert.Equal(t, []Prerequisite{
+		{Hash: plumbing.NewHash("f6c013c9a5cbdc0f871c183beaf9255f1cce38ee"), Comment: "c2"},
+	}, h.Prerequisites)
+	assert.Equal(t, []*plumbing.Reference{
+		plumbing.NewReferenceFromStrings("refs/heads/master", "d1b679b73c1da78feb0699b7de0f501d18acdb53"),
+		plumbing.NewReferenceFromStrings("HEAD", "d1b679b73c1da78feb0699b7de0f501d18acdb53"),
+	}, h.References)
+
+	pack, err := io.ReadAll(d.Packfile())
+	require.NoError(t, err)
+	assert.Equal(t, "PACK", string(pack))
+}
+
+func TestDecodeV3(t *testing.T) {
+	t.Parallel()
+
+	hash := strings.Repeat("ab", 32)
+	input := "# v3 git bundle\n" +
+		"@object-format=sha256\n" +
+		"@filter=blob:none\n" +
+		hash + " refs/heads/main\n" +
+		"\n"
+
+	var h Header
+	require.NoError(t, NewDecoder(strings.NewReader(input)).Decode(&h))
+	assert.Equal(t, V3, h.Version)
+	assert.Equal(t, config.SHA256, h.ObjectFormat)
+	assert.Equal(t, "blob:none", h.Filter)
+	require.Len(t, h.References, 1)
+	assert.Equal(t, hash, h.References[0].Hash().String())
+}
+
+func TestDecodeErrors(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name  string
+		input string
+		err   error
+	}{
+		{"signature", "# v4 git bundle\n\n", ErrUnsupportedVersion},
+		{"not a bundle", "PACK", ErrMalformedHeader},
+		{"capability in v2", "# v2 git bundle\n@object-format=sha1\n\n", ErrMalformedHeader},
+		{"unknown capability", "# v3 git bundle\n@foo\n\n", ErrUnsupportedCapability},
+		{"unknown object format", "# v3 git bundle\n@object-format=md5\n\n", ErrUnsupportedCapability},
+		{"invalid hash", "# v2 git bundle\nfoo refs/heads/master\n\n", ErrMalformedHeader},
+		{"missing name", "# v2 git bundle\nd1b679b73c1da78feb0699b7de0f501d18acdb53\n\n", ErrMalformedHeader},
+		{"truncated", "# v2 git bundle\nd1b679b73c1da78feb0699b7de0f501d18acdb53 HEAD\n", ErrMalformedHeader},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			var h Header
+			err := NewDecoder(strings.NewReader(tc.input)).Decode(&h)
+			assert.ErrorIs(t, err, tc.err)
+		})
+	}
+}
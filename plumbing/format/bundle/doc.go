@@ -0,0 +1,27 @@
+// Package bundle implements encoding and decoding of git bundle files.
+//
+// A bundle contains a packfile along with the references pointing into it,
+// allowing to transfer objects between repositories without a network
+// connection, as `git bundle` does.
+//
+//	Git bundle format
+//
+//	bundle    = signature *capability *prerequisite *reference LF pack
+//	signature = "# v2 git bundle" LF / "# v3 git bundle" LF
+//
+//	capability   = "@" key ["=" value] LF
+//	prerequisite = "-" obj-id SP comment LF
+//	comment      = *CHAR
+//	reference    = obj-id SP refname LF
+//
+//	pack         = ... ; packfile
+//
+// Capabilities are only allowed in version 3. The known ones are
+// "object-format", the hash algorithm of the object ids, and "filter", the
+// filter used to create a partial bundle.
+//
+// Prerequisites are the commits the repository reading the bundle must
+// already have, as the history behind them is left out of the packfile.
+//
+// See https://git-scm.com/docs/gitformat-bundle
+package bundle
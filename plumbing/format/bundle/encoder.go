@@ -0,0 +1,61 @@
+package bundle
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+
+	"github.com/go-git/go-git/v6/plumbing/format/config"
+)
+
+// An Encoder writes a bundle header to an output stream.
+type Encoder struct {
+	w io.Writer
+}
+
+// NewEncoder returns a new encoder that writes to w.
+func NewEncoder(w io.Writer) *Encoder {
+	return &Encoder{w: w}
+}
+
+// Encode writes the header of a bundle. The packfile must be written right
+// after it. The references are written as hash references, with the hash
+// they point to.
+func (e *Encoder) Encode(h *Header) error {
+	version := h.Version
+	if version == 0 {
+		version = V2
+		if h.ObjectFormat != config.SHA1 || h.Filter != "" {
+			version = V3
+		}
+	}
+
+	w := bufio.NewWriter(e.w)
+	switch version {
+	case V2:
+		if h.ObjectFormat != config.SHA1 || h.Filter != "" {
+			return fmt.Errorf("%w: v2 bundles only support sha1 objects and no filter", ErrUnsupportedVersion)
+		}
+
+		fmt.Fprintln(w, signatureV2)
+	case V3:
+		fmt.Fprintln(w, signatureV3)
+		fmt.Fprintf(w, "@%s=%s\n", objectFormatCapability, h.ObjectFormat)
+		if h.Filter != "" {
+			fmt.Fprintf(w, "@%s=%s\n", filterCapability, h.Filter)
+		}
+	default:
+		return fmt.Errorf("%w: %d", ErrUnsupportedVersion, version)
+	}
+
+	for _, p := range h.Prerequisites {
+		fmt.Fprintf(w, "-%s %s\n", p.Hash, p.Comment)
+	}
+
+	for _, ref := range h.References {
+		fmt.Fprintf(w, "%s %s\n", ref.Hash(), ref.Name())
+	}
+
+	fmt.Fprintln(w)
+	return w.Flush()
+}
@@ -0,0 +1,56 @@
+package bundle
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/go-git/go-git/v6/plumbing"
+	"github.com/go-git/go-git/v6/plumbing/format/config"
+)
+
+func TestEncode(t *testing.T) {
+	t.Parallel()
+
+	h := &Header{
+		Prerequisites: []Prerequisite{
+			{Hash: plumbing.NewHash("f6c013c9a5cbdc0f871c183beaf9255f1cce38ee"), Comment: "c2"},
+		},
+		References: []*plumbing.Reference{
+			plumbing.NewReferenceFromStrings("refs/heads/master", "d1b679b73c1da78feb0699b7de0f501d18acdb53"),
+		},
+	}
+
+	var buf bytes.Buffer
+	require.NoError(t, NewEncoder(&buf).Encode(h))
+	assert.Equal(t, "# v2 git bundle\n"+
+		"-f6c013c9a5cbdc0f871c183beaf9255f1cce38ee c2\n"+
+		"d1b679b73c1da78feb0699b7de0f501d18acdb53 refs/heads/master\n"+
+		"\n", buf.String())
+
+	var decoded Header
+	require.NoError(t, NewDecoder(&buf).Decode(&decoded))
+	assert.Equal(t, V2, decoded.Version)
+	assert.Equal(t, h.Prerequisites, decoded.Prerequisites)
+	assert.Equal(t, h.References, decoded.References)
+}
+
+func TestEncodeV3(t *testing.T) {
+	t.Parallel()
+
+	hash := strings.Repeat("ab", 32)
+	h := &Header{
+		ObjectFormat: config.SHA256,
+		References:   []*plumbing.Reference{plumbing.NewReferenceFromStrings("refs/heads/main", hash)},
+	}
+
+	var buf bytes.Buffer
+	require.NoError(t, NewEncoder(&buf).Encode(h))
+	assert.Equal(t, "# v3 git bundle\n@object-format=sha256\n"+hash+" refs/heads/main\n\n", buf.String())
+
+	h.Version = V2
+	assert.ErrorIs(t, NewEncoder(&buf).Encode(h), ErrUnsupportedVersion)
+}
@@ -0,0 +1,136 @@
+package commitgraph
+
+import (
+	"errors"
+	"math/bits"
+)
+
+// ErrNoBloomFilter is returned when no changed-path Bloom filter is
+// available for a commit.
+var ErrNoBloomFilter = errors.New("bloom filter not available")
+
+const (
+	szBloomHeader = 3 * szUint32
+
+	bloomSeed0 = 0x293ae76f
+	bloomSeed1 = 0x7e646e2c
+)
+
+// BloomSettings holds the parameters of the changed-path Bloom filters
+// of a commit graph, as found in the header of the BDAT chunk.
+type BloomSettings struct {
+	// HashVersion is the version of the murmur3 hash function used. Version
+	// 1 is the one written by older versions of git, which sign-extends bytes
+	// with the high bit set; version 2 is the standard murmur3.
+	HashVersion uint32
+	// NumHashes is the number of hashes computed for each key.
+	NumHashes uint32
+	// BitsPerEntry is the number of bits allocated for each changed path.
+	BitsPerEntry uint32
+}
+
+// BloomFilter is the changed-path Bloom filter of a commit. It records the
+// paths, and their leading directories, that changed between the commit and
+// its first parent.
+type BloomFilter struct {
+	data     []byte
+	settings BloomSettings
+}
+
+// NewBloomFilter returns a BloomFilter over data, using the given settings.
+func NewBloomFilter(data []byte, settings BloomSettings) *BloomFilter {
+	return &BloomFilter{data: data, settings: settings}
+}
+
+// MightContain reports whether the given path may have changed in the
+// commit. A false result means the path definitely did not change, a true
+// result may be a false positive. An empty filter carries no
+// information, so it might contain any path.
+//
+// Paths use forward slashes and have no leading or trailing slashes.
+func (b *BloomFilter) MightContain(path string) bool {
+	if len(b.data) == 0 {
+		return true
+	}
+
+	mod := uint64(len(b.data)) * 8
+	for _, h := range bloomKey(path, b.settings) {
+		pos := uint64(h) % mod
+		if b.data[pos/8]&(1<<(pos%8)) == 0 {
+			return false
+		}
+	}
+
+	return true
+}
+
+// bloomKey returns the hashes of the Bloom filter key for path.
+func bloomKey(path string, settings BloomSettings) []uint32 {
+	h0 := murmur3(bloomSeed0, []byte(path), settings.HashVersion)
+	h1 := murmur3(bloomSeed1, []byte(path), settings.HashVersion)
+
+	hashes := make([]uint32, settings.NumHashes)
+	for i := range hashes {
+		hashes[i] = h0 + uint32(i)*h1
+	}
+
+	return hashes
+}
+
+// murmur3 implements the 32-bit murmur3 hash as used by git. When version is
+// 1 bytes are sign-extended, reproducing the behaviour of the hash function
+// in older versions of git on platforms where char is signed.
+func murmur3(seed uint32, data []byte, version uint32) uint32 {
+	const (
+		c1 = 0xcc9e2d51
+		c2 = 0x1b873593
+		r1 = 15
+		r2 = 13
+		m  = 5
+		n  = 0xe6546b64
+	)
+
+	b := func(i int) uint32 {
+		if version == 1 {
+			return uint32(int32(int8(data[i])))
+		}
+		return uint32(data[i])
+	}
+
+	len4 := len(data) / 4
+	for i := range len4 {
+		k := b(4*i) | b(4*i+1)<<8 | b(4*i+2)<<16 | b(4*i+3)<<24
+		k *= c1
+		k = bits.RotateLeft32(k, r1)
+		k *= c2
+
+		seed ^= k
+		seed = bits.RotateLeft32(seed, r2)*m + n
+	}
+
+	var k1 uint32
+	tail := len4 * 4
+	switch len(data) & 3 {
+	case 3:
+		k1 ^= b(tail+2) << 16
+		fallthrough
+	case 2:
+		k1 ^= b(tail+1) << 8
+		fallthrough
+	case 1:
+		k1 ^= b(tail)
+		k1 *= c1
+		k1 = bits.RotateLeft32(k1, r1)
+		k1 *= c2
+		seed ^= k1
+	}
+
+	seed ^= uint32(len(data))
+	seed ^= seed >> 16
+	seed *= 0x85ebca6b
+	seed ^= seed >> 13
+	seed *= 0xc2b2ae35
+	seed ^= seed >> 16
+
+	return seed
+}
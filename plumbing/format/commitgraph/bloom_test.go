@@ -0,0 +1,101 @@
+package commitgraph
+
+import (
+	"testing"
+
+	"github.com/go-git/go-billy/v6/osfs"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/go-git/go-git/v6/plumbing"
+)
+
+func TestMurmur3(t *testing.T) {
+	tests := []struct {
+		seed     uint32
+		data     string
+		expected uint32
+	}{
+		{0, "", 0},
+		{1, "", 0x514e28b7},
+		{0xffffffff, "", 0x81f16f39},
+		{0, "\x00\x00\x00\x00", 0x2362f9de},
+		{0, "!", 0x72661cf4},
+		{0, "!C", 0xa0f7b07a},
+		{0, "!Ce", 0x7e4a8634},
+		{0, "!Ce\x87", 0xf55b516b},
+		{0, "Hello world!", 0x627b0c2c},
+		{0, "The quick brown fox jumps over the lazy dog", 0x2e4ff723},
+		{0, "\xff\xff\xff\xff", 0x76293b50},
+	}
+
+	for _, tc := range tests {
+		assert.Equal(t, tc.expected, murmur3(tc.seed, []byte(tc.data), 2), "%q", tc.data)
+	}
+
+	// Version 1 only differs for bytes with the high bit set.
+	assert.Equal(t, uint32(0x627b0c2c), murmur3(0, []byte("Hello world!"), 1))
+	assert.NotEqual(t, murmur3(0, []byte("caf\xc3\xa9"), 2), murmur3(0, []byte("caf\xc3\xa9"), 1))
+}
+
+func TestBloomFilterEmpty(t *testing.T) {
+	f := NewBloomFilter(nil, BloomSettings{HashVersion: 2, NumHashes: 7, BitsPerEntry: 10})
+	assert.True(t, f.MightContain("any/path"))
+}
+
+var bloomCommits = []struct {
+	hash      string
+	changed   []string
+	unchanged []string
+}{
+	{"60da7eccb1f9a7cb187424c08829c1b4fe0142c1", []string{"README"}, []string{"dir", "other.txt"}},
+	{"d6a5ad3613a04348b76460161f8a89e2711650f0", []string{"dir", "dir/sub", "dir/sub/file.txt"}, []string{"README", "other.txt"}},
+	{"4c03962f11e7a8c6a6fe3e12e366f5f371637de5", []string{"other.txt"}, []string{"README", "dir"}},
+	{"6faad7f92b9680cafa5c8f3ae159bbcb3980161e", []string{"dir", "dir/x.go"}, []string{"README", "dir/sub"}},
+	{"71ec4fe07adc06412ff68ece7104d16bd21108cc", []string{"README"}, []string{"dir", "other.txt"}},
+}
+
+func TestBloomFilters(t *testing.T) {
+	for _, name := range []string{"bloom", "bloom-chain"} {
+		t.Run(name, func(t *testing.T) {
+			index, err := OpenChainOrFileIndex(osfs.New("testdata/" + name))
+			require.NoError(t, err)
+			defer index.Close()
+
+			bi, ok := index.(BloomFilterIndex)
+			require.True(t, ok)
+
+			for _, c := range bloomCommits {
+				h := plumbing.NewHash(c.hash)
+				require.True(t, index.HasCommit(h))
+
+				filter, err := bi.GetBloomFilterByHash(h)
+				require.NoError(t, err)
+
+				for _, path := range c.changed {
+					assert.True(t, filter.MightContain(path), "%s: %s", c.hash, path)
+				}
+				for _, path := range c.unchanged {
+					assert.False(t, filter.MightContain(path), "%s: %s", c.hash, path)
+				}
+			}
+		})
+	}
+}
+
+func TestGetCommitDataByHash(t *testing.T) {
+	index, err := OpenChainOrFileIndex(osfs.New("testdata/bloom-chain"))
+	require.NoError(t, err)
+	defer index.Close()
+
+	data, err := index.GetCommitDataByHash(plumbing.NewHash("6faad7f92b9680cafa5c8f3ae159bbcb3980161e"))
+	require.NoError(t, err)
+	assert.Equal(t, []plumbing.Hash{plumbing.NewHash("4c03962f11e7a8c6a6fe3e12e366f5f371637de5")}, data.ParentHashes)
+	assert.Equal(t, uint64(4), data.Generation)
+	assert.Equal(t, int64(1577836800), data.When.Unix())
+
+	missing := plumbing.NewHash("0000000000000000000000000000000000000001")
+	assert.False(t, index.HasCommit(missing))
+	_, err = index.GetCommitDataByHash(missing)
+	assert.ErrorIs(t, err, plumbing.ErrObjectNotFound)
+}
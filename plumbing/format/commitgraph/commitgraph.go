@@ -46,6 +46,11 @@ type Index interface {
 	// GetNodeByIndex gets the commit node from the commit graph using index
 	// obtained from child node, if available
 	GetCommitDataByIndex(i uint32) (*CommitData, error)
+	// GetCommitDataByHash gets the commit node from the commit graph using
+	// the commit hash, if available
+	GetCommitDataByHash(h plumbing.Hash) (*CommitData, error)
+	// HasCommit returns true if the commit is available in the index
+	HasCommit(h plumbing.Hash) bool
 	// Hashes returns all the hashes that are available in the index
 	Hashes() []plumbing.Hash
 	// HasGenerationV2 returns true if the commit graph has the corrected commit date data
@@ -55,3 +60,23 @@ type Index interface {
 
 	io.Closer
 }
+
+// BloomFilterIndex is implemented by the indexes able to return the
+// changed-path Bloom filters stored in the BIDX and BDAT chunks of a
+// commit-graph file.
+type BloomFilterIndex interface {
+	// GetBloomFilterByIndex gets the Bloom filter of the commit at the given
+	// index in the commit graph, or ErrNoBloomFilter if none is available
+	GetBloomFilterByIndex(i uint32) (*BloomFilter, error)
+	// GetBloomFilterByHash gets the Bloom filter of the given commit, or
+	// ErrNoBloomFilter if none is available
+	GetBloomFilterByHash(h plumbing.Hash) (*BloomFilter, error)
+}
+
+// Storer is implemented by the storages able to provide a commit-graph of
+// the commits they hold.
+type Storer interface {
+	// CommitGraph returns the commit-graph of the storage. The returned index
+	// is owned by the storage and must not be closed by the caller.
+	CommitGraph() (Index, error)
+}
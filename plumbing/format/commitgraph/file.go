@@ -50,6 +50,7 @@ type fileIndex struct {
 	offsets               [lenChunks]int64
 	parent                Index
 	hasGenerationV2       bool
+	bloomSettings         *BloomSettings
 	minimumNumberOfHashes uint32
 	objSize               int
 }
@@ -93,6 +94,10 @@ func OpenFileIndexWithParent(reader ReaderAtCloser, parent Index) (Index, error)
 		fi.minimumNumberOfHashes = fi.parent.MaximumNumberOfHashes()
 	}
 
+	if err := fi.readBloomSettings(); err != nil {
+		return nil, err
+	}
+
 	return fi, nil
 }
 
@@ -185,6 +190,27 @@ func (fi *fileIndex) readFanout() error {
 	return nil
 }
 
+func (fi *fileIndex) readBloomSettings() error {
+	if fi.offsets[BloomFilterIndexChunk] <= 0 || fi.offsets[BloomFilterDataChunk] <= 0 {
+		return nil
+	}
+
+	header := io.NewSectionReader(fi.reader, fi.offsets[BloomFilterDataChunk], szBloomHeader)
+	var settings BloomSettings
+	if err := binary.Read(header, &settings.HashVersion, &settings.NumHashes, &settings.BitsPerEntry); err != nil {
+		return err
+	}
+
+	// Filters written with an unknown hash version cannot be queried,
+	// so they are ignored just like git does.
+	if settings.HashVersion != 1 && settings.HashVersion != 2 {
+		return nil
+	}
+
+	fi.bloomSettings = &settings
+	return nil
+}
+
 // GetIndexByHash looks up the provided hash in the commit-graph fanout and returns the index of the commit data for the given hash.
 func (fi *fileIndex) GetIndexByHash(h plumbing.Hash) (uint32, error) {
 	var oid plumbing.Hash
@@ -224,6 +250,82 @@ func (fi *fileIndex) GetIndexByHash(h plumbing.Hash) (uint32, error) {
 	return 0, plumbing.ErrObjectNotFound
 }
 
+// GetCommitDataByHash returns the commit data for the given commit hash.
+func (fi *fileIndex) GetCommitDataByHash(h plumbing.Hash) (*CommitData, error) {
+	idx, err := fi.GetIndexByHash(h)
+	if err != nil {
+		return nil, err
+	}
+
+	return fi.GetCommitDataByIndex(idx)
+}
+
+// HasCommit returns true if the commit-graph contains the given commit.
+func (fi *fileIndex) HasCommit(h plumbing.Hash) bool {
+	_, err := fi.GetIndexByHash(h)
+	return err == nil
+}
+
+// GetBloomFilterByIndex returns the changed-path Bloom filter for the given
+// index in the commit-graph. ErrNoBloomFilter is returned if the graph file
+// holding the commit has no Bloom filters.
+func (fi *fileIndex) GetBloomFilterByIndex(idx uint32) (*BloomFilter, error) {
+	if idx < fi.minimumNumberOfHashes {
+		if bi, ok := fi.parent.(BloomFilterIndex); ok {
+			return bi.GetBloomFilterByIndex(idx)
+		}
+
+		return nil, ErrNoBloomFilter
+	}
+	idx -= fi.minimumNumberOfHashes
+	if idx >= fi.fanout[0xff] {
+		return nil, plumbing.ErrObjectNotFound
+	}
+	if fi.bloomSettings == nil {
+		return nil, ErrNoBloomFilter
+	}
+
+	// The BIDX chunk holds the cumulative end offset of each filter within
+	// the data that follows the BDAT header.
+	var start uint32
+	buf := make([]byte, 2*szUint32)
+	if idx > 0 {
+		offset := fi.offsets[BloomFilterIndexChunk] + int64(idx-1)*szUint32
+		if _, err := fi.reader.ReadAt(buf, offset); err != nil {
+			return nil, err
+		}
+		start = encbin.BigEndian.Uint32(buf)
+	} else {
+		offset := fi.offsets[BloomFilterIndexChunk]
+		if _, err := fi.reader.ReadAt(buf[szUint32:], offset); err != nil {
+			return nil, err
+		}
+	}
+	end := encbin.BigEndian.Uint32(buf[szUint32:])
+	if end < start {
+		return nil, ErrMalformedCommitGraphFile
+	}
+
+	data := make([]byte, end-start)
+	offset := fi.offsets[BloomFilterDataChunk] + szBloomHeader + int64(start)
+	if _, err := fi.reader.ReadAt(data, offset); err != nil {
+		return nil, err
+	}
+
+	return NewBloomFilter(data, *fi.bloomSettings), nil
+}
+
+// GetBloomFilterByHash returns the changed-path Bloom filter for the given
+// commit hash.
+func (fi *fileIndex) GetBloomFilterByHash(h plumbing.Hash) (*BloomFilter, error) {
+	idx, err := fi.GetIndexByHash(h)
+	if err != nil {
+		return nil, err
+	}
+
+	return fi.GetBloomFilterByIndex(idx)
+}
+
 // GetCommitDataByIndex returns the commit data for the given index in the commit-graph.
 func (fi *fileIndex) GetCommitDataByIndex(idx uint32) (*CommitData, error) {
 	if idx < fi.minimumNumberOfHashes {
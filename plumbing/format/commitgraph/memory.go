@@ -70,6 +70,23 @@ func (mi *MemoryIndex) GetCommitDataByIndex(i uint32) (*CommitData, error) {
 	return commitData.CommitData, nil
 }
 
+// GetCommitDataByHash gets the commit node from the commit graph using the
+// commit hash, if available
+func (mi *MemoryIndex) GetCommitDataByHash(h plumbing.Hash) (*CommitData, error) {
+	i, err := mi.GetIndexByHash(h)
+	if err != nil {
+		return nil, err
+	}
+
+	return mi.GetCommitDataByIndex(i)
+}
+
+// HasCommit returns true if the commit is available in the index
+func (mi *MemoryIndex) HasCommit(h plumbing.Hash) bool {
+	_, ok := mi.indexMap[h]
+	return ok
+}
+
 // Hashes returns all the hashes that are available in the index
 func (mi *MemoryIndex) Hashes() []plumbing.Hash {
 	hashes := make([]plumbing.Hash, 0, len(mi.indexMap))
@@ -20,18 +20,22 @@ func NewDecoder(r io.Reader) *Decoder {
 // value pointed to by config.
 func (d *Decoder) Decode(config *Config) error {
 	cb := func(s, ss, k, v string, bv bool) error {
-		if ss == "" && k == "" {
-			config.Section(s)
-			return nil
-		}
+		return decodeOption(config, s, ss, k, v)
+	}
+	return gcfg.ReadWithCallback(d, cb)
+}
 
-		if ss != "" && k == "" {
-			config.Section(s).Subsection(ss)
-			return nil
-		}
+func decodeOption(config *Config, s, ss, k, v string) error {
+	if ss == "" && k == "" {
+		config.Section(s)
+		return nil
+	}
 
-		config.AddOption(s, ss, k, v)
+	if ss != "" && k == "" {
+		config.Section(s).Subsection(ss)
 		return nil
 	}
-	return gcfg.ReadWithCallback(d, cb)
+
+	config.AddOption(s, ss, k, v)
+	return nil
 }
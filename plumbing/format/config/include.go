@@ -0,0 +1,241 @@
+package config
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/go-git/gcfg/v2"
+	"github.com/go-git/go-billy/v6"
+	"github.com/go-git/go-billy/v6/util"
+
+	"github.com/go-git/go-git/v6/internal/path_util"
+	"github.com/go-git/go-git/v6/internal/pathspec"
+)
+
+const (
+	includeSection   = "include"
+	includeIfSection = "includeIf"
+	pathKey          = "path"
+
+	gitdirCondition          = "gitdir:"
+	gitdirFoldCondition      = "gitdir/i:"
+	onbranchCondition        = "onbranch:"
+	hasconfigRemoteCondition = "hasconfig:remote.*.url:"
+)
+
+// MaxIncludeDepth is the maximum depth of the config files included by the
+// include and includeIf sections, as in git.
+const MaxIncludeDepth = 10
+
+// ErrIncludeDepth is returned when the config files are included deeper than
+// MaxIncludeDepth.
+var ErrIncludeDepth = errors.New("exceeded maximum include depth")
+
+// IncludeOptions describes how the files included by the include and
+// includeIf sections of a config file are found, and how the conditions of
+// the includeIf sections are evaluated.
+type IncludeOptions struct {
+	// Filesystem is the filesystem the included files are read from, with
+	// their absolute paths. If nil, they are not read.
+	Filesystem billy.Basic
+	// Path is the absolute path of the config file, against whose directory
+	// the relative paths of its included files are resolved. If empty, the
+	// files with a relative path are not included.
+	Path string
+	// GitDir is the absolute path of the git directory the config is read
+	// for, matched by the gitdir: and gitdir/i: conditions. If empty, they
+	// are false.
+	GitDir string
+	// Branch is the short name of the branch checked out, matched by the
+	// onbranch: conditions. If empty, they are false.
+	Branch string
+	// RemoteURLs are the URLs of the remotes matched by the
+	// hasconfig:remote.*.url: conditions, along with the ones of the config
+	// file and of the files it includes.
+	RemoteURLs []string
+}
+
+// DecodeWithIncludes reads the whole config from its input like Decode,
+// along with the files included by its include and includeIf sections, and
+// the ones they include in turn, as git does. The options of an included file
+// are added where it is included, the ones following it taking precedence
+// over them. The included files which don't exist are skipped, as the ones
+// which are already being included.
+func (d *Decoder) DecodeWithIncludes(config *Config, opts *IncludeOptions) error {
+	b, err := io.ReadAll(d)
+	if err != nil {
+		return err
+	}
+
+	r := &includeResolver{opts: opts, including: make(map[string]bool)}
+	if opts.Path != "" {
+		r.including[filepath.Clean(opts.Path)] = true
+	}
+
+	// The URLs of the remotes are read first, along with the files included
+	// without a hasconfig: condition, so that the ones defined after the
+	// includeIf sections can be matched too.
+	remotes := New()
+	if err := r.decode(remotes, b, opts.Path, 0); err != nil {
+		return err
+	}
+
+	r.remoteURLs = append([]string(nil), opts.RemoteURLs...)
+	for _, ss := range remotes.Section("remote").Subsections {
+		r.remoteURLs = append(r.remoteURLs, ss.Options.GetAll("url")...)
+	}
+
+	r.hasconfig = true
+	return r.decode(config, b, opts.Path, 0)
+}
+
+type includeResolver struct {
+	opts       *IncludeOptions
+	including  map[string]bool
+	hasconfig  bool
+	remoteURLs []string
+}
+
+func (r *includeResolver) decode(config *Config, b []byte, path string, depth int) error {
+	cb := func(s, ss, k, v string, bv bool) error {
+		if err := decodeOption(config, s, ss, k, v); err != nil {
+			return err
+		}
+
+		if k == "" || !strings.EqualFold(k, pathKey) || v == "" {
+			return nil
+		}
+
+		switch {
+		case strings.EqualFold(s, includeSection) && ss == "":
+		case strings.EqualFold(s, includeIfSection) && ss != "" && r.matches(ss, path):
+		default:
+			return nil
+		}
+
+		return r.include(config, v, path, depth+1)
+	}
+
+	return gcfg.ReadWithCallback(bytes.NewReader(b), cb)
+}
+
+// include decodes the file at the given path, included by the config file
+// at from.
+func (r *includeResolver) include(config *Config, path, from string, depth int) error {
+	if r.opts.Filesystem == nil {
+		return nil
+	}
+
+	path, ok := r.resolve(path, from)
+	if !ok || r.including[path] {
+		return nil
+	}
+
+	if depth > MaxIncludeDepth {
+		return fmt.Errorf("%w (%d) while including %q from %q", ErrIncludeDepth, MaxIncludeDepth, path, from)
+	}
+
+	b, err := util.ReadFile(r.opts.Filesystem, path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+
+	if err != nil {
+		return err
+	}
+
+	r.including[path] = true
+	defer delete(r.including, path)
+
+	return r.decode(config, b, path, depth)
+}
+
+// resolve returns the absolute path of the given path, relative to the
+// directory of the config file at from. It returns false if the path is
+// relative and from is unknown.
+func (r *includeResolver) resolve(path, from string) (string, bool) {
+	path, err := path_util.ReplaceTildeWithHome(path)
+	if err != nil {
+		return "", false
+	}
+
+	if filepath.IsAbs(path) {
+		return filepath.Clean(path), true
+	}
+
+	if from == "" {
+		return "", false
+	}
+
+	return filepath.Join(filepath.Dir(from), path), true
+}
+
+// matches returns whether the condition of an includeIf section, of the
+// config file at from, is true.
+func (r *includeResolver) matches(condition, from string) bool {
+	switch {
+	case strings.HasPrefix(condition, gitdirCondition):
+		return r.matchesGitDir(condition[len(gitdirCondition):], from, false)
+	case strings.HasPrefix(condition, gitdirFoldCondition):
+		return r.matchesGitDir(condition[len(gitdirFoldCondition):], from, true)
+	case strings.HasPrefix(condition, onbranchCondition):
+		pattern := condition[len(onbranchCondition):]
+		if strings.HasSuffix(pattern, "/") {
+			pattern += "**"
+		}
+
+		return r.opts.Branch != "" && pathspec.WildmatchPathname(pattern, r.opts.Branch, false)
+	case strings.HasPrefix(condition, hasconfigRemoteCondition):
+		if !r.hasconfig {
+			return false
+		}
+
+		pattern := condition[len(hasconfigRemoteCondition):]
+		for _, url := range r.remoteURLs {
+			if pathspec.WildmatchPathname(pattern, url, false) {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// matchesGitDir returns whether the git directory matches the pattern of a
+// gitdir: condition, as git does: the patterns starting with ./ are relative
+// to the directory of the config file, the other relative ones match at any
+// depth, and the ones ending with / match the directories under them.
+func (r *includeResolver) matchesGitDir(pattern, from string, fold bool) bool {
+	if r.opts.GitDir == "" {
+		return false
+	}
+
+	pattern, err := path_util.ReplaceTildeWithHome(pattern)
+	if err != nil {
+		return false
+	}
+
+	pattern = filepath.ToSlash(pattern)
+	switch {
+	case strings.HasPrefix(pattern, "./"):
+		if from == "" {
+			return false
+		}
+
+		pattern = filepath.ToSlash(filepath.Dir(from)) + pattern[1:]
+	case !filepath.IsAbs(pattern) && !strings.HasPrefix(pattern, "/"):
+		pattern = "**/" + pattern
+	}
+
+	if strings.HasSuffix(pattern, "/") {
+		pattern += "**"
+	}
+
+	gitDir := filepath.ToSlash(filepath.Clean(r.opts.GitDir))
+	return pathspec.WildmatchPathname(pattern, gitDir, fold)
+}
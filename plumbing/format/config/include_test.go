@@ -0,0 +1,210 @@
+package config
+
+import (
+	"bytes"
+	"fmt"
+	"testing"
+
+	"github.com/go-git/go-billy/v6"
+	"github.com/go-git/go-billy/v6/memfs"
+	"github.com/go-git/go-billy/v6/util"
+	"github.com/stretchr/testify/suite"
+)
+
+type IncludeSuite struct {
+	suite.Suite
+	fs billy.Filesystem
+}
+
+func TestIncludeSuite(t *testing.T) {
+	suite.Run(t, new(IncludeSuite))
+}
+
+func (s *IncludeSuite) SetupTest() {
+	s.fs = memfs.New()
+}
+
+func (s *IncludeSuite) write(path, content string) {
+	s.Require().NoError(util.WriteFile(s.fs, path, []byte(content), 0o644))
+}
+
+func (s *IncludeSuite) decode(content string, opts *IncludeOptions) (*Config, error) {
+	if opts.Filesystem == nil {
+		opts.Filesystem = s.fs
+	}
+
+	if opts.Path == "" {
+		opts.Path = "/home/user/.gitconfig"
+	}
+
+	cfg := New()
+	err := NewDecoder(bytes.NewBufferString(content)).DecodeWithIncludes(cfg, opts)
+	return cfg, err
+}
+
+func (s *IncludeSuite) TestInclude() {
+	s.write("/home/user/.gitconfig.d/user", "[user]\n\tname = included\n\temail = included@example.com\n")
+	s.write("/etc/git/core", "[core]\n\teditor = vim\n")
+
+	cfg, err := s.decode(`[user]
+	name = main
+[include]
+	path = .gitconfig.d/user
+	path = /etc/git/core
+	path = missing
+[user]
+	email = main@example.com
+`, &IncludeOptions{})
+	s.Require().NoError(err)
+
+	// The options of the included files take precedence over the ones
+	// before the include section, but not over the ones after it.
+	s.Equal("included", cfg.Section("user").Option("name"))
+	s.Equal("main@example.com", cfg.Section("user").Option("email"))
+	s.Equal("vim", cfg.Section("core").Option("editor"))
+}
+
+func (s *IncludeSuite) TestIncludeNested() {
+	s.write("/home/user/a/a.inc", "[include]\n\tpath = b/b.inc\n[a]\n\tkey = a\n")
+	s.write("/home/user/a/b/b.inc", "[b]\n\tkey = b\n")
+
+	// The relative paths are resolved against the directory of the file
+	// including them.
+	cfg, err := s.decode("[include]\n\tpath = a/a.inc\n", &IncludeOptions{})
+	s.Require().NoError(err)
+	s.Equal("a", cfg.Section("a").Option("key"))
+	s.Equal("b", cfg.Section("b").Option("key"))
+}
+
+func (s *IncludeSuite) TestIncludeWithoutPath() {
+	s.write("/home/user/user.inc", "[user]\n\tname = included\n")
+
+	cfg := New()
+	err := NewDecoder(bytes.NewBufferString("[include]\n\tpath = user.inc\n[include]\n\tpath = /home/user/user.inc\n")).
+		DecodeWithIncludes(cfg, &IncludeOptions{Filesystem: s.fs})
+	s.Require().NoError(err)
+	s.Equal("included", cfg.Section("user").Option("name"))
+	s.Len(cfg.Section("user").Options, 1)
+}
+
+func (s *IncludeSuite) TestIncludeCycle() {
+	s.write("/home/user/a.inc", "[include]\n\tpath = b.inc\n[a]\n\tkey = a\n")
+	s.write("/home/user/b.inc", "[include]\n\tpath = a.inc\n\tpath = .gitconfig\n[b]\n\tkey = b\n")
+
+	cfg, err := s.decode("[include]\n\tpath = a.inc\n", &IncludeOptions{})
+	s.Require().NoError(err)
+	s.Equal([]string{"a"}, cfg.Section("a").OptionAll("key"))
+	s.Equal([]string{"b"}, cfg.Section("b").OptionAll("key"))
+}
+
+func (s *IncludeSuite) TestIncludeDepth() {
+	for i := 0; i < MaxIncludeDepth; i++ {
+		s.write(fmt.Sprintf("/home/user/%d.inc", i), fmt.Sprintf("[include]\n\tpath = %d.inc\n", i+1))
+	}
+
+	s.write(fmt.Sprintf("/home/user/%d.inc", MaxIncludeDepth), "[user]\n\tname = deep\n")
+	cfg, err := s.decode("[include]\n\tpath = 1.inc\n", &IncludeOptions{})
+	s.Require().NoError(err)
+	s.Equal("deep", cfg.Section("user").Option("name"))
+
+	_, err = s.decode("[include]\n\tpath = 0.inc\n", &IncludeOptions{})
+	s.ErrorIs(err, ErrIncludeDepth)
+}
+
+func (s *IncludeSuite) TestIncludeIfGitDir() {
+	s.write("/home/user/work.inc", "[user]\n\temail = work@example.com\n")
+	content := `[user]
+	email = home@example.com
+[includeIf "gitdir:/home/user/work/"]
+	path = work.inc
+`
+
+	for _, tc := range []struct {
+		gitDir   string
+		expected string
+	}{
+		{"/home/user/work/project/.git", "work@example.com"},
+		{"/home/user/work/a/b/.git", "work@example.com"},
+		{"/home/user/Work/project/.git", "home@example.com"},
+		{"/home/user/other/.git", "home@example.com"},
+		{"", "home@example.com"},
+	} {
+		cfg, err := s.decode(content, &IncludeOptions{GitDir: tc.gitDir})
+		s.Require().NoError(err)
+		s.Equal(tc.expected, cfg.Section("user").Option("email"), tc.gitDir)
+	}
+}
+
+func (s *IncludeSuite) TestIncludeIfGitDirPatterns() {
+	s.write("/home/user/match.inc", "[user]\n\tname = match\n")
+
+	for _, tc := range []struct {
+		condition string
+		gitDir    string
+		expected  bool
+	}{
+		{"gitdir:project/.git", "/src/project/.git", true},
+		{"gitdir:project/.git", "/src/other/.git", false},
+		{"gitdir:project/", "/src/a/project/.git", true},
+		{"gitdir:/src/*/.git", "/src/project/.git", true},
+		{"gitdir:/src/*/.git", "/src/a/project/.git", false},
+		{"gitdir:/src/**/.git", "/src/a/project/.git", true},
+		{"gitdir:./repos/", "/home/user/repos/project/.git", true},
+		{"gitdir:./repos/", "/repos/project/.git", false},
+		{"gitdir:/SRC/", "/src/project/.git", false},
+		{"gitdir/i:/SRC/", "/src/project/.git", true},
+		{"gitdir:~/repos/", "/home/user/repos/project/.git", true},
+	} {
+		s.T().Setenv("HOME", "/home/user")
+		cfg, err := s.decode(fmt.Sprintf("[includeIf %q]\n\tpath = match.inc\n", tc.condition), &IncludeOptions{
+			GitDir: tc.gitDir,
+		})
+		s.Require().NoError(err)
+		s.Equal(tc.expected, cfg.Section("user").Option("name") == "match", "%s %s", tc.condition, tc.gitDir)
+	}
+}
+
+func (s *IncludeSuite) TestIncludeIfOnBranch() {
+	s.write("/home/user/match.inc", "[user]\n\tname = match\n")
+
+	for _, tc := range []struct {
+		condition string
+		branch    string
+		expected  bool
+	}{
+		{"onbranch:main", "main", true},
+		{"onbranch:main", "maint", false},
+		{"onbranch:feature/", "feature/a/b", true},
+		{"onbranch:feature/*", "feature/a", true},
+		{"onbranch:feature/*", "feature/a/b", false},
+		{"onbranch:main", "", false},
+	} {
+		cfg, err := s.decode(fmt.Sprintf("[includeIf %q]\n\tpath = match.inc\n", tc.condition), &IncludeOptions{
+			Branch: tc.branch,
+		})
+		s.Require().NoError(err)
+		s.Equal(tc.expected, cfg.Section("user").Option("name") == "match", "%s %s", tc.condition, tc.branch)
+	}
+}
+
+func (s *IncludeSuite) TestIncludeIfHasConfigRemoteURL() {
+	s.write("/home/user/org.inc", "[user]\n\temail = org@example.com\n")
+	s.write("/home/user/remote.inc", "[remote \"upstream\"]\n\turl = https://example.com/other/repo.git\n")
+	content := `[includeIf "hasconfig:remote.*.url:https://github.com/org/**"]
+	path = org.inc
+`
+
+	// The remotes are matched even if they are defined after the includeIf
+	// section, or in an included file.
+	cfg, err := s.decode(content+"[remote \"origin\"]\n\turl = https://github.com/org/repo.git\n", &IncludeOptions{})
+	s.Require().NoError(err)
+	s.Equal("org@example.com", cfg.Section("user").Option("email"))
+
+	cfg, err = s.decode(content+"[include]\n\tpath = remote.inc\n", &IncludeOptions{})
+	s.Require().NoError(err)
+	s.Equal("", cfg.Section("user").Option("email"))
+
+	cfg, err = s.decode(content, &IncludeOptions{RemoteURLs: []string{"https://github.com/org/repo.git"}})
+	s.Require().NoError(err)
+	s.Equal("org@example.com", cfg.Section("user").Option("email"))
+}
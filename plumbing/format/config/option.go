@@ -17,6 +17,17 @@ type Option struct {
 
 type Options []*Option
 
+// IsTrue returns whether value is a true boolean of git config, one of true,
+// yes, on or 1 in any case.
+func IsTrue(value string) bool {
+	switch strings.ToLower(value) {
+	case "true", "yes", "on", "1":
+		return true
+	}
+
+	return false
+}
+
 // IsKey returns true if the given key matches
 // this option's key in a case-insensitive comparison.
 func (o *Option) IsKey(key string) bool {
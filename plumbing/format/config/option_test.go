@@ -52,3 +52,13 @@ func (s *OptionSuite) TestOption_IsKey() {
 	s.False((&Option{Key: "key"}).IsKey(""))
 	s.False((&Option{Key: ""}).IsKey("key"))
 }
+
+func (s *OptionSuite) TestIsTrue() {
+	for _, v := range []string{"true", "TRUE", "yes", "Yes", "on", "1"} {
+		s.True(IsTrue(v), v)
+	}
+
+	for _, v := range []string{"false", "no", "off", "0", "", "2"} {
+		s.False(IsTrue(v), v)
+	}
+}
@@ -0,0 +1,201 @@
+package diff
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+
+	"github.com/go-git/go-git/v6/internal/text"
+	"github.com/go-git/go-git/v6/plumbing/format/packfile"
+)
+
+var (
+	// ErrNoBinaryPatch is returned when applying the diff of a binary file
+	// without a binary patch, which only reports that the file differs.
+	ErrNoBinaryPatch = errors.New("binary file without binary patch")
+	// ErrIrreversibleBinaryPatch is returned when applying a reversed binary
+	// patch without the reverse changes.
+	ErrIrreversibleBinaryPatch = errors.New("binary patch cannot be reversed")
+)
+
+// Reverse returns the diff undoing the changes of f.
+func (f *FileDiff) Reverse() *FileDiff {
+	r := *f
+	r.OldName, r.NewName = f.NewName, f.OldName
+	r.OldMode, r.NewMode = f.NewMode, f.OldMode
+	r.OldHash, r.NewHash = f.NewHash, f.OldHash
+
+	if f.Binary != nil {
+		r.Binary = &BinaryDiff{Forward: f.Binary.Reverse, Reverse: f.Binary.Forward}
+	}
+
+	r.Hunks = make([]*Hunk, len(f.Hunks))
+	for i, h := range f.Hunks {
+		rh := &Hunk{
+			OldStart: h.NewStart, OldLines: h.NewLines,
+			NewStart: h.OldStart, NewLines: h.OldLines,
+			Section: h.Section,
+			Lines:   make([]Line, len(h.Lines)),
+		}
+
+		for j, l := range h.Lines {
+			switch l.Op {
+			case Add:
+				l.Op = Delete
+			case Delete:
+				l.Op = Add
+			}
+
+			rh.Lines[j] = l
+		}
+
+		r.Hunks[i] = rh
+	}
+
+	return &r
+}
+
+// Apply applies the changes of the diff to content, the old content of the
+// file, and returns the new content. As git apply does, a hunk is applied
+// where its old lines are found, which may be before or after its position
+// if the other hunks have changed the content; the hunks whose old lines are
+// not found are not applied, and returned.
+func (f *FileDiff) Apply(content []byte) (result []byte, rejected []*Hunk, err error) {
+	if f.IsBinary {
+		result, err = f.applyBinary(content)
+		return result, nil, err
+	}
+
+	lines := splitLines(string(content))
+	out := make([]string, 0, len(lines))
+
+	var pos, offset int
+	for _, h := range f.Hunks {
+		preimage, postimage := h.images()
+
+		expected := h.OldStart - 1
+		if h.OldLines == 0 {
+			expected = h.OldStart
+		}
+
+		at, ok := h.find(lines, preimage, expected+offset, pos)
+		if !ok {
+			rejected = append(rejected, h)
+			continue
+		}
+
+		out = append(out, lines[pos:at]...)
+		out = append(out, postimage...)
+		pos = at + len(preimage)
+		offset = at - expected
+	}
+
+	out = append(out, lines[pos:]...)
+	return []byte(strings.Join(out, "")), rejected, nil
+}
+
+func (f *FileDiff) applyBinary(content []byte) ([]byte, error) {
+	if f.Binary == nil {
+		return nil, ErrNoBinaryPatch
+	}
+
+	data := f.Binary.Forward
+	if data == nil {
+		return nil, ErrIrreversibleBinaryPatch
+	}
+
+	if data.IsDelta {
+		return packfile.PatchDelta(content, data.Data)
+	}
+
+	return data.Data, nil
+}
+
+// images returns the old and new lines of the hunk.
+func (h *Hunk) images() (preimage, postimage []string) {
+	for _, l := range h.Lines {
+		if l.Op != Add {
+			preimage = append(preimage, l.Content)
+		}
+
+		if l.Op != Delete {
+			postimage = append(postimage, l.Content)
+		}
+	}
+
+	return preimage, postimage
+}
+
+// find returns the index of the first of the old lines of the hunk in lines
+// at or after pos, as close as possible to expected.
+func (h *Hunk) find(lines, preimage []string, expected, pos int) (int, bool) {
+	// As git does, a hunk with context lines, but none before or after
+	// the changes, must be applied at the beginning or at the end of the
+	// content. The hunks without any context lines can't tell.
+	var trailing, context int
+	for _, l := range h.Lines {
+		if l.Op == Equal {
+			context++
+		}
+	}
+
+	for i := len(h.Lines) - 1; i >= 0 && h.Lines[i].Op == Equal; i-- {
+		trailing++
+	}
+
+	matchBeginning := h.OldStart == 0 || h.OldStart == 1 && context > 0
+	matchEnd := context > 0 && trailing == 0
+
+	last := len(lines) - len(preimage)
+	for d := 0; expected-d >= pos || expected+d <= last; d++ {
+		for _, at := range []int{expected - d, expected + d} {
+			if at < pos || at > last ||
+				matchBeginning && at != 0 || matchEnd && at != last {
+				continue
+			}
+
+			if text.EqualLines(lines[at:at+len(preimage)], preimage) {
+				return at, true
+			}
+		}
+	}
+
+	return 0, false
+}
+
+// String returns the hunk in the unified diff format, as written in the
+// .rej files of the rejected hunks.
+func (h *Hunk) String() string {
+	sb := &strings.Builder{}
+	sb.WriteString("@@ -")
+	writeRange(sb, h.OldStart, h.OldLines)
+	sb.WriteString(" +")
+	writeRange(sb, h.NewStart, h.NewLines)
+	sb.WriteString(" @@")
+	if h.Section != "" {
+		sb.WriteByte(' ')
+		sb.WriteString(h.Section)
+	}
+
+	sb.WriteByte('\n')
+	for _, l := range h.Lines {
+		sb.WriteByte(operationChar[l.Op])
+		if text, found := strings.CutSuffix(l.Content, "\n"); found {
+			sb.WriteString(text)
+		} else {
+			sb.WriteString(l.Content + "\n\\ No newline at end of file")
+		}
+
+		sb.WriteByte('\n')
+	}
+
+	return sb.String()
+}
+
+func writeRange(sb *strings.Builder, start, lines int) {
+	sb.WriteString(strconv.Itoa(start))
+	if lines != 1 {
+		sb.WriteByte(',')
+		sb.WriteString(strconv.Itoa(lines))
+	}
+}
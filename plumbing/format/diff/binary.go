@@ -0,0 +1,177 @@
+package diff
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/go-git/go-git/v6/utils/sync"
+)
+
+// base85Alphabet is the alphabet of the base85 encoding of the binary
+// patches, which is not the one of encoding/ascii85.
+const base85Alphabet = "0123456789" +
+	"ABCDEFGHIJKLMNOPQRSTUVWXYZ" +
+	"abcdefghijklmnopqrstuvwxyz" +
+	"!#$%&()*+-;<=>?@^_`{|}~"
+
+// binaryLineLength is the maximum number of bytes of deflated data encoded
+// per line of a binary patch.
+const binaryLineLength = 52
+
+// writeBinaryPatch writes the body of the binary patch of bp, after its "GIT
+// binary patch" header: the literal contents of the to File, and then of the
+// from File, so that the patch can be reversed.
+func writeBinaryPatch(sb *strings.Builder, bp BinaryFilePatch) error {
+	from, to, err := bp.BinaryContents()
+	if err != nil {
+		return err
+	}
+
+	for _, content := range [][]byte{to, from} {
+		if err := writeBinaryLiteral(sb, content); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// writeBinaryLiteral writes content as a literal of a binary patch: its
+// size, and its deflated data, encoded in base85, each line being prefixed
+// by the number of bytes it encodes.
+func writeBinaryLiteral(sb *strings.Builder, content []byte) error {
+	buf := sync.GetBytesBuffer()
+	defer sync.PutBytesBuffer(buf)
+
+	zw := sync.GetZlibWriter(buf)
+	defer sync.PutZlibWriter(zw)
+
+	if _, err := zw.Write(content); err != nil {
+		return err
+	}
+
+	if err := zw.Close(); err != nil {
+		return err
+	}
+
+	sb.WriteString("literal ")
+	sb.WriteString(strconv.Itoa(len(content)))
+	sb.WriteByte('\n')
+
+	data := buf.Bytes()
+	for len(data) > 0 {
+		n := min(len(data), binaryLineLength)
+		if n <= 26 {
+			sb.WriteByte(byte('A' + n - 1))
+		} else {
+			sb.WriteByte(byte('a' + n - 27))
+		}
+
+		encodeBase85(sb, data[:n])
+		sb.WriteByte('\n')
+		data = data[n:]
+	}
+
+	sb.WriteByte('\n')
+	return nil
+}
+
+// encodeBase85 writes data encoded in base85, as 5 characters per group of
+// 4 bytes, the last group being padded with zeros.
+func encodeBase85(sb *strings.Builder, data []byte) {
+	var group [5]byte
+	for len(data) > 0 {
+		var acc uint32
+		for i := range 4 {
+			acc <<= 8
+			if i < len(data) {
+				acc |= uint32(data[i])
+			}
+		}
+
+		for i := 4; i >= 0; i-- {
+			group[i] = base85Alphabet[acc%85]
+			acc /= 85
+		}
+
+		sb.Write(group[:])
+		data = data[min(len(data), 4):]
+	}
+}
+
+// decodeBinaryLiteral decodes the lines of a literal, or delta, of a binary
+// patch, whose inflated size is size.
+func decodeBinaryLiteral(lines []string, size int64) ([]byte, error) {
+	var data []byte
+	for _, line := range lines {
+		if line == "" {
+			return nil, errors.New("empty binary patch line")
+		}
+
+		var n int
+		switch c := line[0]; {
+		case 'A' <= c && c <= 'Z':
+			n = int(c-'A') + 1
+		case 'a' <= c && c <= 'z':
+			n = int(c-'a') + 27
+		default:
+			return nil, fmt.Errorf("malformed binary patch line %q", line)
+		}
+
+		decoded, err := decodeBase85(line[1:], n)
+		if err != nil {
+			return nil, err
+		}
+
+		data = append(data, decoded...)
+	}
+
+	zr, err := sync.GetZlibReader(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	defer sync.PutZlibReader(zr)
+
+	content, err := io.ReadAll(zr)
+	if err != nil {
+		return nil, err
+	}
+
+	if int64(len(content)) != size {
+		return nil, fmt.Errorf("binary patch size is %d instead of %d", len(content), size)
+	}
+
+	return content, nil
+}
+
+// decodeBase85 decodes the first n bytes of the data encoded in s.
+func decodeBase85(s string, n int) ([]byte, error) {
+	if len(s) != (n+3)/4*5 {
+		return nil, fmt.Errorf("malformed binary patch data %q", s)
+	}
+
+	out := make([]byte, 0, len(s)/5*4)
+	for ; len(s) > 0; s = s[5:] {
+		var acc uint64
+		for i := range 5 {
+			v := strings.IndexByte(base85Alphabet, s[i])
+			if v < 0 {
+				return nil, fmt.Errorf("invalid base85 character %q", s[i])
+			}
+
+			acc = acc*85 + uint64(v)
+		}
+
+		if acc > 0xffffffff {
+			return nil, fmt.Errorf("malformed binary patch data %q", s[:5])
+		}
+
+		out = append(out, byte(acc>>24), byte(acc>>16), byte(acc>>8), byte(acc))
+	}
+
+	return out[:n], nil
+}
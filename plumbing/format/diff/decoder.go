@@ -0,0 +1,520 @@
+package diff
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/go-git/go-git/v6/plumbing/filemode"
+)
+
+// ErrMalformedPatch is returned when decoding a patch which is not a valid
+// unified diff.
+var ErrMalformedPatch = errors.New("malformed patch")
+
+// FileDiff is the diff of a single file of a patch, decoded by a
+// UnifiedDecoder. The names are empty if the file is created or deleted,
+// and the modes are zero if they are not in the patch.
+type FileDiff struct {
+	OldName, NewName string
+	OldMode, NewMode filemode.FileMode
+	// OldHash and NewHash are the hashes of the index line of git patches,
+	// which may be abbreviated.
+	OldHash, NewHash string
+	// IsRename and IsCopy are whether the file is renamed or copied, with
+	// the similarity of the contents.
+	IsRename, IsCopy bool
+	Similarity       int
+	// IsBinary is whether the file is binary. Its changes are then in
+	// Binary, if the patch is a binary patch, and there are no Hunks.
+	IsBinary bool
+	Binary   *BinaryDiff
+	Hunks    []*Hunk
+}
+
+// IsNew returns whether the file is created by the diff.
+func (f *FileDiff) IsNew() bool {
+	return f.OldName == "" && f.NewName != ""
+}
+
+// IsDelete returns whether the file is deleted by the diff.
+func (f *FileDiff) IsDelete() bool {
+	return f.OldName != "" && f.NewName == ""
+}
+
+// BinaryDiff is a binary patch: the changes from the old to the new content
+// of the file, and, if the patch can be reversed, from the new to the old.
+type BinaryDiff struct {
+	Forward, Reverse *BinaryData
+}
+
+// BinaryData is the change of a binary patch: either the literal content,
+// or a delta, as the ones of the packfiles, to apply to the content.
+type BinaryData struct {
+	IsDelta bool
+	// Size is the size of the content or of the delta.
+	Size int64
+	Data []byte
+}
+
+// Hunk is a hunk of the diff of a file, starting with its "@@" line.
+type Hunk struct {
+	// OldStart and NewStart are the numbers, starting from 1, of the first
+	// lines of the hunk, or of the line before it if it has none.
+	OldStart, OldLines int
+	NewStart, NewLines int
+	// Section is the text after the "@@" line, like the function name.
+	Section string
+	Lines   []Line
+}
+
+// Line is a line of a hunk. Its content ends with its line break, unless
+// it is the last line of the file, and the file doesn't end with one.
+type Line struct {
+	Op      Operation
+	Content string
+}
+
+// UnifiedDecoder decodes the patches in the unified diff format, as the ones
+// written by git diff or by UnifiedEncoder, including the extended headers
+// and the binary patches of git.
+type UnifiedDecoder struct {
+	r    *bufio.Reader
+	line string
+	eof  bool
+	n    int
+}
+
+// NewUnifiedDecoder returns a new UnifiedDecoder that reads from r.
+func NewUnifiedDecoder(r io.Reader) *UnifiedDecoder {
+	return &UnifiedDecoder{r: bufio.NewReader(r)}
+}
+
+// Decode decodes the diffs of the files of the patch. Any text before the
+// first diff, like the message of a commit, is skipped.
+func (d *UnifiedDecoder) Decode() ([]*FileDiff, error) {
+	if err := d.next(); err != nil {
+		return nil, err
+	}
+
+	var files []*FileDiff
+	for !d.eof {
+		var f *FileDiff
+		var err error
+		switch {
+		case strings.HasPrefix(d.line, "diff --git "):
+			f, err = d.decodeGitFile()
+		case strings.HasPrefix(d.line, "--- ") && d.peekPrefix("+++ "):
+			f, err = d.decodeFile(&FileDiff{})
+		default:
+			err = d.next()
+		}
+
+		if err != nil {
+			return nil, err
+		}
+
+		if f != nil {
+			files = append(files, f)
+		}
+	}
+
+	return files, nil
+}
+
+// next reads the next line, without its line break.
+func (d *UnifiedDecoder) next() error {
+	line, err := d.r.ReadString('\n')
+	if err != nil && err != io.EOF {
+		return err
+	}
+
+	d.eof = err == io.EOF && line == ""
+	d.line = strings.TrimSuffix(line, "\n")
+	d.n++
+	return nil
+}
+
+// rawNext reads the next line, with its line break.
+func (d *UnifiedDecoder) rawNext() (string, error) {
+	line, err := d.r.ReadString('\n')
+	if err != nil && err != io.EOF {
+		return "", err
+	}
+
+	d.n++
+	return line, nil
+}
+
+func (d *UnifiedDecoder) peekPrefix(prefix string) bool {
+	b, _ := d.r.Peek(len(prefix))
+	return string(b) == prefix
+}
+
+func (d *UnifiedDecoder) errorf(format string, args ...any) error {
+	return fmt.Errorf("%w: line %d: %s", ErrMalformedPatch, d.n, fmt.Sprintf(format, args...))
+}
+
+// decodeGitFile decodes a file starting with a "diff --git" line and its
+// extended headers.
+func (d *UnifiedDecoder) decodeGitFile() (*FileDiff, error) {
+	f := &FileDiff{}
+	f.OldName, f.NewName = gitDiffNames(strings.TrimPrefix(d.line, "diff --git "))
+
+	for {
+		if err := d.next(); err != nil {
+			return nil, err
+		}
+
+		if d.eof {
+			return f, nil
+		}
+
+		header, value, _ := strings.Cut(d.line, " ")
+		var err error
+		switch header {
+		case "old", "new", "deleted":
+			err = d.decodeModeHeader(f, d.line)
+		case "rename", "copy":
+			err = d.decodeNameHeader(f, d.line)
+		case "similarity":
+			f.Similarity, err = strconv.Atoi(strings.TrimSuffix(strings.TrimPrefix(value, "index "), "%"))
+		case "dissimilarity":
+		case "index":
+			d.decodeIndexHeader(f, value)
+		case "Binary":
+			f.IsBinary = true
+		case "GIT":
+			f.IsBinary = true
+			if f.Binary, err = d.decodeBinary(); err != nil {
+				return nil, err
+			}
+
+			return f, nil
+		case "---":
+			return d.decodeFile(f)
+		default:
+			return f, nil
+		}
+
+		if err != nil {
+			return nil, d.errorf("%s", err)
+		}
+	}
+}
+
+func (d *UnifiedDecoder) decodeModeHeader(f *FileDiff, line string) error {
+	for _, h := range []struct {
+		prefix string
+		mode   *filemode.FileMode
+		name   *string
+	}{
+		{"old mode ", &f.OldMode, nil},
+		{"new mode ", &f.NewMode, nil},
+		{"new file mode ", &f.NewMode, &f.OldName},
+		{"deleted file mode ", &f.OldMode, &f.NewName},
+	} {
+		value, ok := strings.CutPrefix(line, h.prefix)
+		if !ok {
+			continue
+		}
+
+		m, err := filemode.New(value)
+		if err != nil {
+			return err
+		}
+
+		*h.mode = m
+		if h.name != nil {
+			*h.name = ""
+		}
+
+		return nil
+	}
+
+	return fmt.Errorf("unknown header %q", line)
+}
+
+func (d *UnifiedDecoder) decodeNameHeader(f *FileDiff, line string) error {
+	for _, h := range []struct {
+		prefix string
+		name   *string
+		kind   *bool
+	}{
+		{"rename from ", &f.OldName, &f.IsRename},
+		{"rename to ", &f.NewName, &f.IsRename},
+		{"copy from ", &f.OldName, &f.IsCopy},
+		{"copy to ", &f.NewName, &f.IsCopy},
+	} {
+		value, ok := strings.CutPrefix(line, h.prefix)
+		if !ok {
+			continue
+		}
+
+		*h.name = unquoteName(value)
+		*h.kind = true
+		return nil
+	}
+
+	return fmt.Errorf("unknown header %q", line)
+}
+
+func (d *UnifiedDecoder) decodeIndexHeader(f *FileDiff, value string) {
+	hashes, mode, _ := strings.Cut(value, " ")
+	f.OldHash, f.NewHash, _ = strings.Cut(hashes, "..")
+	if m, err := filemode.New(mode); err == nil && mode != "" {
+		f.OldMode, f.NewMode = m, m
+	}
+}
+
+// decodeFile decodes the "---" and "+++" lines of a file, and its hunks.
+func (d *UnifiedDecoder) decodeFile(f *FileDiff) (*FileDiff, error) {
+	oldName := diffName(strings.TrimPrefix(d.line, "--- "))
+	if err := d.next(); err != nil {
+		return nil, err
+	}
+
+	newLine, ok := strings.CutPrefix(d.line, "+++ ")
+	if !ok {
+		return nil, d.errorf("expected +++ line")
+	}
+
+	newName := diffName(newLine)
+	if !f.IsRename && !f.IsCopy {
+		f.OldName, f.NewName = oldName, newName
+	}
+
+	if err := d.next(); err != nil {
+		return nil, err
+	}
+
+	for !d.eof && strings.HasPrefix(d.line, "@@ ") {
+		h, err := d.decodeHunk()
+		if err != nil {
+			return nil, err
+		}
+
+		f.Hunks = append(f.Hunks, h)
+	}
+
+	return f, nil
+}
+
+// decodeHunk decodes a hunk, from its "@@" line to the line after its last
+// one.
+func (d *UnifiedDecoder) decodeHunk() (*Hunk, error) {
+	h := &Hunk{}
+	ranges, section, ok := strings.Cut(strings.TrimPrefix(d.line, "@@ "), " @@")
+	if !ok {
+		return nil, d.errorf("malformed hunk header %q", d.line)
+	}
+
+	h.Section = strings.TrimPrefix(section, " ")
+	oldRange, newRange, ok := strings.Cut(ranges, " ")
+	if !ok || !strings.HasPrefix(oldRange, "-") || !strings.HasPrefix(newRange, "+") {
+		return nil, d.errorf("malformed hunk header %q", d.line)
+	}
+
+	var err error
+	if h.OldStart, h.OldLines, err = parseRange(oldRange[1:]); err != nil {
+		return nil, d.errorf("malformed hunk header %q", d.line)
+	}
+
+	if h.NewStart, h.NewLines, err = parseRange(newRange[1:]); err != nil {
+		return nil, d.errorf("malformed hunk header %q", d.line)
+	}
+
+	oldLines, newLines := h.OldLines, h.NewLines
+	for oldLines > 0 || newLines > 0 {
+		line, err := d.rawNext()
+		if err != nil {
+			return nil, err
+		}
+
+		if line == "" {
+			return nil, d.errorf("unexpected end of hunk")
+		}
+
+		var op Operation
+		switch line[0] {
+		case ' ', '\n':
+			// Some tools trim the space of the empty context lines.
+			op = Equal
+			oldLines--
+			newLines--
+		case '-':
+			op = Delete
+			oldLines--
+		case '+':
+			op = Add
+			newLines--
+		case '\\':
+			d.noNewline(h)
+			continue
+		default:
+			return nil, d.errorf("unexpected line in hunk %q", strings.TrimSuffix(line, "\n"))
+		}
+
+		if oldLines < 0 || newLines < 0 {
+			return nil, d.errorf("hunk is longer than its header")
+		}
+
+		content := line
+		if line[0] != '\n' {
+			content = line[1:]
+		}
+
+		h.Lines = append(h.Lines, Line{Op: op, Content: content})
+	}
+
+	if err := d.next(); err != nil {
+		return nil, err
+	}
+
+	if strings.HasPrefix(d.line, `\`) {
+		d.noNewline(h)
+		if err := d.next(); err != nil {
+			return nil, err
+		}
+	}
+
+	return h, nil
+}
+
+// noNewline removes the line break of the last line of the hunk, which is
+// followed by a "\ No newline at end of file" line.
+func (d *UnifiedDecoder) noNewline(h *Hunk) {
+	if len(h.Lines) == 0 {
+		return
+	}
+
+	last := &h.Lines[len(h.Lines)-1]
+	last.Content = strings.TrimSuffix(last.Content, "\n")
+}
+
+// decodeBinary decodes a binary patch, after its "GIT binary patch" line.
+func (d *UnifiedDecoder) decodeBinary() (*BinaryDiff, error) {
+	b := &BinaryDiff{}
+	for _, data := range []**BinaryData{&b.Forward, &b.Reverse} {
+		if err := d.next(); err != nil {
+			return nil, err
+		}
+
+		kind, size, ok := strings.Cut(d.line, " ")
+		if !ok || kind != "literal" && kind != "delta" {
+			if data == &b.Forward {
+				return nil, d.errorf("malformed binary patch")
+			}
+
+			// The binary patch cannot be reversed.
+			return b, nil
+		}
+
+		n, err := strconv.ParseInt(size, 10, 64)
+		if err != nil {
+			return nil, d.errorf("malformed binary patch size %q", size)
+		}
+
+		var encoded []string
+		for {
+			if err := d.next(); err != nil {
+				return nil, err
+			}
+
+			if d.eof || d.line == "" {
+				break
+			}
+
+			encoded = append(encoded, d.line)
+		}
+
+		content, err := decodeBinaryLiteral(encoded, n)
+		if err != nil {
+			return nil, d.errorf("%s", err)
+		}
+
+		*data = &BinaryData{IsDelta: kind == "delta", Size: n, Data: content}
+	}
+
+	if err := d.next(); err != nil {
+		return nil, err
+	}
+
+	return b, nil
+}
+
+// parseRange parses the range of a hunk header, as "start,lines" or
+// "start", of a single line.
+func parseRange(s string) (start, lines int, err error) {
+	startStr, linesStr, ok := strings.Cut(s, ",")
+	if start, err = strconv.Atoi(startStr); err != nil {
+		return 0, 0, err
+	}
+
+	if !ok {
+		return start, 1, nil
+	}
+
+	lines, err = strconv.Atoi(linesStr)
+	return start, lines, err
+}
+
+// gitDiffNames returns the names of a "diff --git a/old b/new" line.
+func gitDiffNames(s string) (oldName, newName string) {
+	// The names are the same, unless the file is renamed or copied, whose
+	// names are then read from the extended headers.
+	if len(s)%2 == 1 {
+		half := len(s) / 2
+		if s[half] == ' ' && stripPrefix(s[:half]) == stripPrefix(s[half+1:]) {
+			name := stripPrefix(unquoteName(s[:half]))
+			return name, name
+		}
+	}
+
+	if i := strings.Index(s, " b/"); i >= 0 {
+		return stripPrefix(unquoteName(s[:i])), stripPrefix(unquoteName(s[i+1:]))
+	}
+
+	return "", ""
+}
+
+// diffName returns the name of a "---" or "+++" line, which is empty for
+// /dev/null.
+func diffName(s string) string {
+	// The name may be followed by a timestamp, after a tab.
+	if !strings.HasPrefix(s, `"`) {
+		s, _, _ = strings.Cut(s, "\t")
+	}
+
+	if s == "/dev/null" {
+		return ""
+	}
+
+	return stripPrefix(unquoteName(s))
+}
+
+// stripPrefix strips the first component of the name, like the a/ and b/
+// prefixes of git.
+func stripPrefix(name string) string {
+	if _, rest, ok := strings.Cut(name, "/"); ok {
+		return rest
+	}
+
+	return name
+}
+
+// unquoteName unquotes the names with special characters, quoted by git.
+func unquoteName(name string) string {
+	if !strings.HasPrefix(name, `"`) {
+		return name
+	}
+
+	if s, err := strconv.Unquote(name); err == nil {
+		return s
+	}
+
+	return name
+}
@@ -0,0 +1,399 @@
+package diff
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/suite"
+
+	"github.com/go-git/go-git/v6/plumbing/filemode"
+)
+
+type UnifiedDecoderTestSuite struct {
+	suite.Suite
+}
+
+func TestUnifiedDecoderTestSuite(t *testing.T) {
+	suite.Run(t, new(UnifiedDecoderTestSuite))
+}
+
+// TestDecodeEncoded decodes the patches of the fixtures of UnifiedEncoder,
+// and applies them to the old contents of their files, forward and reversed.
+func (s *UnifiedDecoderTestSuite) TestDecodeEncoded() {
+	for _, f := range fixtures {
+		if f.color != nil {
+			continue
+		}
+
+		s.Run(f.desc, func() {
+			files, err := NewUnifiedDecoder(strings.NewReader(f.diff)).Decode()
+			s.Require().NoError(err)
+
+			fps := f.patch.FilePatches()
+			s.Require().Len(files, len(fps))
+
+			for i, fp := range fps {
+				fd := files[i]
+				from, to := fp.Files()
+				if from != nil {
+					s.Equal(from.Path(), fd.OldName)
+				} else {
+					s.True(fd.IsNew())
+				}
+
+				if to != nil {
+					s.Equal(to.Path(), fd.NewName)
+				} else {
+					s.True(fd.IsDelete())
+				}
+
+				// The file patches without chunks are either binary, or
+				// only change the name or the mode of the file.
+				if len(fp.Chunks()) == 0 {
+					continue
+				}
+
+				s.False(fd.IsBinary)
+				if from != nil {
+					s.Equal(from.Mode(), fd.OldMode)
+					s.Equal(from.Hash().String(), fd.OldHash)
+				}
+
+				if to != nil {
+					s.Equal(to.Mode(), fd.NewMode)
+					s.Equal(to.Hash().String(), fd.NewHash)
+				}
+
+				var oldContent, newContent string
+				for _, c := range fp.Chunks() {
+					if c.Type() != Add {
+						oldContent += c.Content()
+					}
+
+					if c.Type() != Delete {
+						newContent += c.Content()
+					}
+				}
+
+				result, rejected, err := fd.Apply([]byte(oldContent))
+				s.NoError(err)
+				s.Empty(rejected)
+				s.Equal(newContent, string(result))
+
+				result, rejected, err = fd.Reverse().Apply([]byte(newContent))
+				s.NoError(err)
+				s.Empty(rejected)
+				s.Equal(oldContent, string(result))
+			}
+		})
+	}
+}
+
+func (s *UnifiedDecoderTestSuite) TestDecodeGitHeaders() {
+	patch := `From 1e5ab383b0bc6ad0aa5b4f8eb1f5a8dc6b3b1ef3 Mon Sep 17 00:00:00 2001
+Subject: [PATCH] some changes
+
+---
+diff --git a/old.txt b/new.txt
+similarity index 94%
+rename from old.txt
+rename to new.txt
+index 3f4a6d2..9c2e9b1 100644
+--- a/old.txt
++++ b/new.txt
+@@ -1,2 +1,2 @@ func main() {
+ a
+-b
++c
+diff --git a/script.sh b/script.sh
+old mode 100644
+new mode 100755
+diff --git a/empty b/empty
+new file mode 100644
+index 0000000..e69de29
+diff --git a/gone.txt b/gone.txt
+deleted file mode 100644
+index 78981922..00000000
+--- a/gone.txt
++++ /dev/null
+@@ -1 +0,0 @@
+-a
+\ No newline at end of file
+diff --git a/image.png b/image.png
+index 1234567..89abcde 100644
+Binary files a/image.png and b/image.png differ
+diff --git "a/with \"quotes\"" "b/with \"quotes\""
+index 0000001..0000002 100644
+--- "a/with \"quotes\""
++++ "b/with \"quotes\""
+@@ -1 +1 @@
+-a
++b
+--
+2.39.5
+`
+
+	files, err := NewUnifiedDecoder(strings.NewReader(patch)).Decode()
+	s.Require().NoError(err)
+	s.Require().Len(files, 6)
+
+	rename := files[0]
+	s.Equal("old.txt", rename.OldName)
+	s.Equal("new.txt", rename.NewName)
+	s.True(rename.IsRename)
+	s.Equal(94, rename.Similarity)
+	s.Equal("3f4a6d2", rename.OldHash)
+	s.Equal("9c2e9b1", rename.NewHash)
+	s.Equal(filemode.Regular, rename.OldMode)
+	s.Equal(filemode.Regular, rename.NewMode)
+	s.Require().Len(rename.Hunks, 1)
+	s.Equal(&Hunk{
+		OldStart: 1, OldLines: 2, NewStart: 1, NewLines: 2,
+		Section: "func main() {",
+		Lines: []Line{
+			{Op: Equal, Content: "a\n"},
+			{Op: Delete, Content: "b\n"},
+			{Op: Add, Content: "c\n"},
+		},
+	}, rename.Hunks[0])
+
+	mode := files[1]
+	s.Equal("script.sh", mode.OldName)
+	s.Equal("script.sh", mode.NewName)
+	s.Equal(filemode.Regular, mode.OldMode)
+	s.Equal(filemode.Executable, mode.NewMode)
+	s.Empty(mode.Hunks)
+
+	created := files[2]
+	s.True(created.IsNew())
+	s.Equal("empty", created.NewName)
+	s.Equal(filemode.Regular, created.NewMode)
+	s.Empty(created.Hunks)
+
+	deleted := files[3]
+	s.True(deleted.IsDelete())
+	s.Equal("gone.txt", deleted.OldName)
+	s.Require().Len(deleted.Hunks, 1)
+	s.Equal([]Line{{Op: Delete, Content: "a"}}, deleted.Hunks[0].Lines)
+
+	binary := files[4]
+	s.True(binary.IsBinary)
+	s.Nil(binary.Binary)
+	_, _, err = binary.Apply(nil)
+	s.ErrorIs(err, ErrNoBinaryPatch)
+
+	quoted := files[5]
+	s.Equal(`with "quotes"`, quoted.OldName)
+	s.Equal(`with "quotes"`, quoted.NewName)
+}
+
+func (s *UnifiedDecoderTestSuite) TestDecodeMalformed() {
+	for _, patch := range []string{
+		"--- a/file\n+++ b/file\n@@ -1 +1 @\n",
+		"--- a/file\n+++ b/file\n@@ -1,2 +1,2 @@\n a\n",
+		"--- a/file\n+++ b/file\n@@ -1 +1 @@\n*a\n+b\n",
+		"--- a/file\n+++ b/file\n@@ -1 +1 @@\n-a\n-b\n+c\n",
+		"diff --git a/file b/file\nnew mode abc\n",
+		"diff --git a/file b/file\nindex 1..2 100644\nGIT binary patch\nliteral 3\nzzz\n",
+	} {
+		_, err := NewUnifiedDecoder(strings.NewReader(patch)).Decode()
+		s.ErrorIs(err, ErrMalformedPatch, patch)
+	}
+}
+
+func (s *UnifiedDecoderTestSuite) TestApplyOffset() {
+	patch := `--- a/file
++++ b/file
+@@ -2,3 +2,3 @@
+ b
+-c
++C
+ d
+@@ -8,3 +8,3 @@
+ h
+-i
++I
+ j
+`
+
+	files, err := NewUnifiedDecoder(strings.NewReader(patch)).Decode()
+	s.Require().NoError(err)
+	s.Require().Len(files, 1)
+
+	// Two lines were added before the first hunk, and one removed between
+	// the hunks.
+	content := "x\ny\na\nb\nc\nd\ne\ng\nh\ni\nj\nk\n"
+	result, rejected, err := files[0].Apply([]byte(content))
+	s.NoError(err)
+	s.Empty(rejected)
+	s.Equal("x\ny\na\nb\nC\nd\ne\ng\nh\nI\nj\nk\n", string(result))
+}
+
+func (s *UnifiedDecoderTestSuite) TestApplyRejected() {
+	patch := `--- a/file
++++ b/file
+@@ -1,3 +1,3 @@ section
+ a
+-b
++B
+ c
+@@ -5,3 +5,3 @@
+ e
+-f
++F
+ g
+\ No newline at end of file
+`
+
+	files, err := NewUnifiedDecoder(strings.NewReader(patch)).Decode()
+	s.Require().NoError(err)
+	s.Require().Len(files, 1)
+
+	result, rejected, err := files[0].Apply([]byte("a\nb\nc\nd\ne\nx\ng"))
+	s.NoError(err)
+	s.Equal("a\nB\nc\nd\ne\nx\ng", string(result))
+	s.Require().Len(rejected, 1)
+	s.Equal(files[0].Hunks[1], rejected[0])
+	s.Equal("@@ -5,3 +5,3 @@\n e\n-f\n+F\n g\n\\ No newline at end of file\n", rejected[0].String())
+	s.Equal("@@ -1,3 +1,3 @@ section\n a\n-b\n+B\n c\n", files[0].Hunks[0].String())
+
+	// The hunks at the beginning of the file are not applied anywhere else.
+	_, rejected, err = files[0].Apply([]byte("z\na\nb\nc\nd\ne\nf\ng"))
+	s.NoError(err)
+	s.Len(rejected, 1)
+	s.Equal(files[0].Hunks[0], rejected[0])
+}
+
+func (s *UnifiedDecoderTestSuite) TestApplyNewAndDeletedFile() {
+	patch := `diff --git a/new b/new
+new file mode 100644
+index 0000000..3be9c81
+--- /dev/null
++++ b/new
+@@ -0,0 +1,2 @@
++a
++b
+`
+
+	files, err := NewUnifiedDecoder(strings.NewReader(patch)).Decode()
+	s.Require().NoError(err)
+	s.Require().Len(files, 1)
+	s.True(files[0].IsNew())
+
+	result, rejected, err := files[0].Apply(nil)
+	s.NoError(err)
+	s.Empty(rejected)
+	s.Equal("a\nb\n", string(result))
+
+	reversed := files[0].Reverse()
+	s.True(reversed.IsDelete())
+	s.Equal(filemode.Regular, reversed.OldMode)
+	s.Equal(filemode.Empty, reversed.NewMode)
+
+	result, rejected, err = reversed.Apply([]byte("a\nb\n"))
+	s.NoError(err)
+	s.Empty(rejected)
+	s.Empty(result)
+}
+
+func (s *UnifiedDecoderTestSuite) TestBinaryPatch() {
+	from := bytes.Repeat([]byte{0, 1, 2, 3}, 100)
+	to := append(bytes.Repeat([]byte{0xff}, 70), from...)
+
+	buffer := bytes.NewBuffer(nil)
+	e := NewUnifiedEncoder(buffer, DefaultContextLines).SetBinary(true)
+	err := e.Encode(binaryTestPatch{
+		testFilePatch: testFilePatch{
+			from: &testFile{path: "data.bin", mode: filemode.Regular, seed: string(from)},
+			to:   &testFile{path: "data.bin", mode: filemode.Regular, seed: string(to)},
+		},
+		from: from, to: to,
+	})
+	s.Require().NoError(err)
+	s.Contains(buffer.String(), "GIT binary patch\nliteral 470\n")
+
+	files, err := NewUnifiedDecoder(buffer).Decode()
+	s.Require().NoError(err)
+	s.Require().Len(files, 1)
+
+	fd := files[0]
+	s.True(fd.IsBinary)
+	s.Require().NotNil(fd.Binary)
+	s.Equal(&BinaryData{Size: int64(len(to)), Data: to}, fd.Binary.Forward)
+	s.Equal(&BinaryData{Size: int64(len(from)), Data: from}, fd.Binary.Reverse)
+
+	result, rejected, err := fd.Apply(from)
+	s.NoError(err)
+	s.Empty(rejected)
+	s.Equal(to, result)
+
+	result, _, err = fd.Reverse().Apply(to)
+	s.NoError(err)
+	s.Equal(from, result)
+
+	fd.Binary.Reverse = nil
+	_, _, err = fd.Reverse().Apply(to)
+	s.True(errors.Is(err, ErrIrreversibleBinaryPatch))
+}
+
+func (s *UnifiedDecoderTestSuite) TestBinaryPatchDelta() {
+	// Written by git diff --binary, which changes a byte of the file, and
+	// appends "end" to it.
+	patch := `diff --git a/file b/file
+index 51e14664fcab480f7772d3f30bbecf877bcb0878..cdf5fda498601e29182a1c767dd5dbef2828f3c1 100644
+GIT binary patch
+delta 15
+XcmZ3(w4Q0gG{%b)r%z>0%}W6QGQ0*)
+
+delta 11
+TcmZ3_w1#QIG)BFN)29Le8D|7?
+
+`
+
+	from := make([]byte, 300)
+	for i := range from {
+		from[i] = byte(i * 7 % 251)
+	}
+
+	to := append(bytes.Clone(from), "end"...)
+	to[150] ^= 0xff
+
+	files, err := NewUnifiedDecoder(strings.NewReader(patch)).Decode()
+	s.Require().NoError(err)
+	s.Require().Len(files, 1)
+
+	fd := files[0]
+	s.Require().NotNil(fd.Binary)
+	s.True(fd.Binary.Forward.IsDelta)
+	s.Equal(int64(15), fd.Binary.Forward.Size)
+
+	result, _, err := fd.Apply(from)
+	s.NoError(err)
+	s.Equal(to, result)
+
+	result, _, err = fd.Reverse().Apply(to)
+	s.NoError(err)
+	s.Equal(from, result)
+
+	_, _, err = fd.Apply(to[:10])
+	s.Error(err)
+}
+
+type binaryTestPatch struct {
+	testFilePatch
+	from, to []byte
+}
+
+func (t binaryTestPatch) FilePatches() []FilePatch {
+	return []FilePatch{t}
+}
+
+func (t binaryTestPatch) Message() string {
+	return ""
+}
+
+func (t binaryTestPatch) BinaryContents() (from, to []byte, err error) {
+	return t.from, t.to, nil
+}
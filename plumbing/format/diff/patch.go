@@ -39,6 +39,28 @@ type FilePatch interface {
 	Chunks() []Chunk
 }
 
+// RenameFilePatch is an optional interface of the FilePatches whose from and
+// to Files have different paths, telling whether it is a rename or a copy.
+type RenameFilePatch interface {
+	FilePatch
+	// IsCopy returns true if the to File is a copy of the from File, which
+	// is kept, and false if it is a rename.
+	IsCopy() bool
+	// Similarity returns the percentage of the content of the from File
+	// found in the to File, or 0 if unknown.
+	Similarity() int
+}
+
+// BinaryFilePatch is an optional interface of the binary FilePatches, giving
+// the contents of their from and to Files, so that they can be encoded as
+// binary patches.
+type BinaryFilePatch interface {
+	FilePatch
+	// BinaryContents returns the contents of the from and to Files, which
+	// are empty if the File is missing.
+	BinaryContents() (from, to []byte, err error)
+}
+
 // File contains all the file metadata necessary to print some patch formats.
 type File interface {
 	// Hash returns the File Hash.
@@ -56,3 +78,12 @@ type Chunk interface {
 	// Type contains the Operation to do with this Chunk.
 	Type() Operation
 }
+
+// IgnorableChunk is an optional interface of the Chunks of changes which may
+// be ignored, as the changes of blank lines ignored by git diff
+// --ignore-blank-lines: the hunks of only ignorable changes are not encoded.
+type IgnorableChunk interface {
+	Chunk
+	// Ignorable returns whether the change may be ignored.
+	Ignorable() bool
+}
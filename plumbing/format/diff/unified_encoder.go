@@ -6,6 +6,9 @@ import (
 	"regexp"
 	"strconv"
 	"strings"
+	"unicode"
+
+	"github.com/sergi/go-diff/diffmatchpatch"
 
 	"github.com/go-git/go-git/v6/plumbing"
 )
@@ -30,7 +33,7 @@ var (
 )
 
 // UnifiedEncoder encodes an unified diff into the provided Writer. It does not
-// support similarity index for renames or sorting hash representations.
+// support sorting hash representations.
 type UnifiedEncoder struct {
 	io.Writer
 
@@ -44,6 +47,12 @@ type UnifiedEncoder struct {
 
 	// colorConfig is the color configuration. The default is no color.
 	color ColorConfig
+
+	// binary is whether the binary files are encoded as binary patches.
+	binary bool
+
+	// wordDiff is whether the changes are encoded word by word.
+	wordDiff bool
 }
 
 // NewUnifiedEncoder returns a new UnifiedEncoder that writes to w.
@@ -74,6 +83,24 @@ func (e *UnifiedEncoder) SetDstPrefix(prefix string) *UnifiedEncoder {
 	return e
 }
 
+// SetBinary sets whether the binary files implementing BinaryFilePatch are
+// encoded as binary patches, which can be applied, as `git diff --binary`
+// does, instead of only being reported as differing, and returns e.
+func (e *UnifiedEncoder) SetBinary(binary bool) *UnifiedEncoder {
+	e.binary = binary
+	return e
+}
+
+// SetWordDiff sets whether the changes are encoded word by word, as
+// `git diff --word-diff=plain` does, and returns e. The lines of the hunks
+// are then the ones of the to File, with no leading character, the removed
+// words between [- and -] and the added ones between {+ and +}, the words
+// being the runs of non-whitespace characters.
+func (e *UnifiedEncoder) SetWordDiff(wordDiff bool) *UnifiedEncoder {
+	e.wordDiff = wordDiff
+	return e
+}
+
 // Encode encodes patch.
 func (e *UnifiedEncoder) Encode(patch Patch) error {
 	sb := &strings.Builder{}
@@ -87,9 +114,21 @@ func (e *UnifiedEncoder) Encode(patch Patch) error {
 
 	for _, filePatch := range patch.FilePatches() {
 		e.writeFilePatchHeader(sb, filePatch)
+		if bp, ok := e.binaryPatch(filePatch); ok {
+			if err := writeBinaryPatch(sb, bp); err != nil {
+				return err
+			}
+
+			continue
+		}
+
 		g := newHunksGenerator(filePatch.Chunks(), e.contextLines)
 		for _, hunk := range g.Generate() {
-			hunk.writeTo(sb, e.color)
+			if e.wordDiff {
+				hunk.writeWordDiffTo(sb, e.color)
+			} else {
+				hunk.writeTo(sb, e.color)
+			}
 		}
 	}
 
@@ -102,8 +141,6 @@ func (e *UnifiedEncoder) writeFilePatchHeader(sb *strings.Builder, filePatch Fil
 	if from == nil && to == nil {
 		return
 	}
-	isBinary := filePatch.IsBinary()
-
 	var lines []string
 	switch {
 	case from != nil && to != nil:
@@ -119,9 +156,20 @@ func (e *UnifiedEncoder) writeFilePatchHeader(sb *strings.Builder, filePatch Fil
 			)
 		}
 		if from.Path() != to.Path() {
+			kind := "rename"
+			if rp, ok := filePatch.(RenameFilePatch); ok {
+				if rp.IsCopy() {
+					kind = "copy"
+				}
+
+				if similarity := rp.Similarity(); similarity > 0 {
+					lines = append(lines, fmt.Sprintf("similarity index %d%%", similarity))
+				}
+			}
+
 			lines = append(lines,
-				fmt.Sprintf("rename from %s", from.Path()),
-				fmt.Sprintf("rename to %s", to.Path()),
+				fmt.Sprintf("%s from %s", kind, from.Path()),
+				fmt.Sprintf("%s to %s", kind, to.Path()),
 			)
 		}
 		if from.Mode() != to.Mode() && !hashEquals {
@@ -134,7 +182,7 @@ func (e *UnifiedEncoder) writeFilePatchHeader(sb *strings.Builder, filePatch Fil
 			)
 		}
 		if !hashEquals {
-			lines = e.appendPathLines(lines, e.srcPrefix+from.Path(), e.dstPrefix+to.Path(), isBinary)
+			lines = e.appendPathLines(lines, e.srcPrefix+from.Path(), e.dstPrefix+to.Path(), filePatch)
 		}
 	case from == nil:
 		lines = append(lines,
@@ -142,14 +190,14 @@ func (e *UnifiedEncoder) writeFilePatchHeader(sb *strings.Builder, filePatch Fil
 			fmt.Sprintf("new file mode %o", to.Mode()),
 			fmt.Sprintf("index %s..%s", plumbing.ZeroHash, to.Hash()),
 		)
-		lines = e.appendPathLines(lines, "/dev/null", e.dstPrefix+to.Path(), isBinary)
+		lines = e.appendPathLines(lines, "/dev/null", e.dstPrefix+to.Path(), filePatch)
 	case to == nil:
 		lines = append(lines,
 			fmt.Sprintf("diff --git %s %s", e.srcPrefix+from.Path(), e.dstPrefix+from.Path()),
 			fmt.Sprintf("deleted file mode %o", from.Mode()),
 			fmt.Sprintf("index %s..%s", from.Hash(), plumbing.ZeroHash),
 		)
-		lines = e.appendPathLines(lines, e.srcPrefix+from.Path(), "/dev/null", isBinary)
+		lines = e.appendPathLines(lines, e.srcPrefix+from.Path(), "/dev/null", filePatch)
 	}
 
 	sb.WriteString(e.color[Meta])
@@ -162,18 +210,45 @@ func (e *UnifiedEncoder) writeFilePatchHeader(sb *strings.Builder, filePatch Fil
 	sb.WriteByte('\n')
 }
 
-func (e *UnifiedEncoder) appendPathLines(lines []string, fromPath, toPath string, isBinary bool) []string {
-	if isBinary {
+func (e *UnifiedEncoder) appendPathLines(lines []string, fromPath, toPath string, filePatch FilePatch) []string {
+	if _, ok := e.binaryPatch(filePatch); ok {
+		return append(lines, "GIT binary patch")
+	}
+
+	if filePatch.IsBinary() {
 		return append(lines,
 			fmt.Sprintf("Binary files %s and %s differ", fromPath, toPath),
 		)
 	}
+
+	// As git does, the paths are omitted if there are no hunks, like when
+	// an empty file is created or deleted.
+	if len(filePatch.Chunks()) == 0 {
+		return lines
+	}
+
 	return append(lines,
 		fmt.Sprintf("--- %s", fromPath),
 		fmt.Sprintf("+++ %s", toPath),
 	)
 }
 
+// binaryPatch returns the filePatch as a BinaryFilePatch, if it is encoded
+// as a binary patch, which is only needed if the content changes.
+func (e *UnifiedEncoder) binaryPatch(filePatch FilePatch) (BinaryFilePatch, bool) {
+	if !e.binary || !filePatch.IsBinary() {
+		return nil, false
+	}
+
+	from, to := filePatch.Files()
+	if from == nil && to == nil || from != nil && to != nil && from.Hash() == to.Hash() {
+		return nil, false
+	}
+
+	bp, ok := filePatch.(BinaryFilePatch)
+	return bp, ok
+}
+
 type hunksGenerator struct {
 	fromLine, toLine            int
 	ctxLines                    int
@@ -181,6 +256,9 @@ type hunksGenerator struct {
 	current                     *hunk
 	hunks                       []*hunk
 	beforeContext, afterContext []string
+	// fromLines are the lines of the from File, searched for the function
+	// names of the hunks.
+	fromLines []string
 }
 
 func newHunksGenerator(chunks []Chunk, ctxLines int) *hunksGenerator {
@@ -195,6 +273,10 @@ func (g *hunksGenerator) Generate() []*hunk {
 		lines := splitLines(chunk.Content())
 		nLines := len(lines)
 
+		if chunk.Type() != Add {
+			g.fromLines = append(g.fromLines, lines...)
+		}
+
 		switch chunk.Type() {
 		case Equal:
 			g.fromLine += nLines
@@ -208,6 +290,7 @@ func (g *hunksGenerator) Generate() []*hunk {
 			g.processHunk(i, chunk.Type())
 			g.fromLine += nLines - 1
 			g.current.AddOp(chunk.Type(), lines...)
+			g.current.changed = g.current.changed || !isIgnorable(chunk)
 		case Add:
 			if nLines != 0 {
 				g.toLine++
@@ -215,6 +298,7 @@ func (g *hunksGenerator) Generate() []*hunk {
 			g.processHunk(i, chunk.Type())
 			g.toLine += nLines - 1
 			g.current.AddOp(chunk.Type(), lines...)
+			g.current.changed = g.current.changed || !isIgnorable(chunk)
 		}
 
 		if i == len(g.chunks)-1 && g.current != nil {
@@ -222,23 +306,63 @@ func (g *hunksGenerator) Generate() []*hunk {
 		}
 	}
 
+	// The hunks of only ignorable changes are not encoded.
+	hunks := g.hunks[:0]
+	for _, h := range g.hunks {
+		if h.changed {
+			hunks = append(hunks, h)
+		}
+	}
+
+	g.hunks = hunks
+	g.addFuncNames()
 	return g.hunks
 }
 
+func isIgnorable(chunk Chunk) bool {
+	ic, ok := chunk.(IgnorableChunk)
+	return ok && ic.Ignorable()
+}
+
+// addFuncNames sets the function names of the hunks, as git does by default
+// without a diff driver: the first line before the hunk, down to the start
+// of the previous hunk, which starts with a letter, '_' or '$', or else the
+// function name of the previous hunk.
+func (g *hunksGenerator) addFuncNames() {
+	var current string
+	limit := -1
+	for _, h := range g.hunks {
+		// The first line of the hunk, or the line after which the lines
+		// are added if none are from the from File.
+		start := h.fromLine - 1
+		if h.fromCount == 0 {
+			start++
+		}
+
+		for i := start - 1; i > limit && i < len(g.fromLines); i-- {
+			if name, ok := funcName(g.fromLines[i]); ok {
+				current = name
+				break
+			}
+		}
+
+		h.ctxPrefix = current
+		limit = start - 1
+	}
+}
+
 func (g *hunksGenerator) processHunk(i int, op Operation) {
 	if g.current != nil {
 		return
 	}
 
-	var ctxPrefix string
 	linesBefore := len(g.beforeContext)
 	if linesBefore > g.ctxLines {
-		ctxPrefix = g.beforeContext[linesBefore-g.ctxLines-1]
 		g.beforeContext = g.beforeContext[linesBefore-g.ctxLines:]
 		linesBefore = g.ctxLines
 	}
 
-	g.current = &hunk{ctxPrefix: strings.TrimSuffix(ctxPrefix, "\n")}
+	g.current = &hunk{}
 	g.current.AddOp(Equal, g.beforeContext...)
 
 	switch op {
@@ -296,6 +420,28 @@ func (g *hunksGenerator) processEqualsLines(ls []string, i int) {
 	}
 }
 
+// maxFuncNameLength is the maximum length of the function names of the
+// hunks, including the line break, as git truncates them.
+const maxFuncNameLength = 80
+
+// funcName returns the function name of the line, if it starts with a
+// letter, '_' or '$', without its trailing spaces.
+func funcName(line string) (string, bool) {
+	if line == "" {
+		return "", false
+	}
+
+	if c := line[0]; !('a' <= c && c <= 'z' || 'A' <= c && c <= 'Z' || c == '_' || c == '$') {
+		return "", false
+	}
+
+	if len(line) > maxFuncNameLength {
+		line = line[:maxFuncNameLength]
+	}
+
+	return strings.TrimRight(line, " \t\n\v\f\r"), true
+}
+
 func splitLines(s string) []string {
 	out := splitLinesRegexp.FindAllString(s, -1)
 	if out[len(out)-1] == "" {
@@ -313,9 +459,47 @@ type hunk struct {
 
 	ctxPrefix string
 	ops       []*op
+
+	// changed is whether the hunk has changes which are not ignorable.
+	changed bool
 }
 
 func (h *hunk) writeTo(sb *strings.Builder, color ColorConfig) {
+	h.writeHeaderTo(sb, color)
+	for _, op := range h.ops {
+		op.writeTo(sb, color)
+	}
+}
+
+// writeWordDiffTo writes the hunk as `git diff --word-diff=plain` does, the
+// lines removed and added between two lines of context being diffed word
+// by word.
+func (h *hunk) writeWordDiffTo(sb *strings.Builder, color ColorConfig) {
+	h.writeHeaderTo(sb, color)
+	for i := 0; i < len(h.ops); {
+		if h.ops[i].t == Equal {
+			sb.WriteString(color[Context])
+			sb.WriteString(strings.TrimSuffix(h.ops[i].text, "\n"))
+			sb.WriteString(color.Reset(Context))
+			sb.WriteByte('\n')
+			i++
+			continue
+		}
+
+		var from, to strings.Builder
+		for ; i < len(h.ops) && h.ops[i].t != Equal; i++ {
+			if h.ops[i].t == Delete {
+				from.WriteString(h.ops[i].text)
+			} else {
+				to.WriteString(h.ops[i].text)
+			}
+		}
+
+		writeWordDiff(sb, from.String(), to.String(), color)
+	}
+}
+
+func (h *hunk) writeHeaderTo(sb *strings.Builder, color ColorConfig) {
 	sb.WriteString(color[Frag])
 	sb.WriteString("@@ -")
 
@@ -348,10 +532,6 @@ func (h *hunk) writeTo(sb *strings.Builder, color ColorConfig) {
 	}
 
 	sb.WriteByte('\n')
-
-	for _, op := range h.ops {
-		op.writeTo(sb, color)
-	}
 }
 
 func (h *hunk) AddOp(t Operation, ss ...string) {
@@ -388,3 +568,113 @@ func (o *op) writeTo(sb *strings.Builder, color ColorConfig) {
 	sb.WriteString(color.Reset(colorKey))
 	sb.WriteByte('\n')
 }
+
+// writeWordDiff writes the diff of the words of from to the ones of to, the
+// text of to with the removed words between [- and -] and the added ones
+// between {+ and +}. As git does, the whitespace is the one of to, the
+// removed words being written after the word preceding them in to.
+func writeWordDiff(sb *strings.Builder, from, to string, color ColorConfig) {
+	fromWords, toWords := splitWords(from), splitWords(to)
+	dict := make(map[string]rune)
+	toRunes := func(s string, words [][2]int) []rune {
+		runes := make([]rune, len(words))
+		for i, w := range words {
+			r, ok := dict[s[w[0]:w[1]]]
+			if !ok {
+				r = rune(len(dict))
+				dict[s[w[0]:w[1]]] = r
+			}
+
+			runes[i] = r
+		}
+
+		return runes
+	}
+
+	diffs := diffmatchpatch.New().DiffMainRunes(toRunes(from, fromWords), toRunes(to, toWords), false)
+	var pos, i, j int
+	for k := 0; k < len(diffs); {
+		if diffs[k].Type == diffmatchpatch.DiffEqual {
+			n := len([]rune(diffs[k].Text))
+			i, j = i+n, j+n
+			k++
+			continue
+		}
+
+		var removed, added int
+		for ; k < len(diffs) && diffs[k].Type != diffmatchpatch.DiffEqual; k++ {
+			if diffs[k].Type == diffmatchpatch.DiffDelete {
+				removed += len([]rune(diffs[k].Text))
+			} else {
+				added += len([]rune(diffs[k].Text))
+			}
+		}
+
+		start := 0
+		switch {
+		case added > 0:
+			start = toWords[j][0]
+		case j > 0:
+			start = toWords[j-1][1]
+		}
+
+		sb.WriteString(to[pos:start])
+		pos = start
+		if removed > 0 {
+			writeMarked(sb, from[fromWords[i][0]:fromWords[i+removed-1][1]], "[-", "-]", color, Old)
+		}
+
+		if added > 0 {
+			pos = toWords[j+added-1][1]
+			writeMarked(sb, to[start:pos], "{+", "+}", color, New)
+		}
+
+		i, j = i+removed, j+added
+	}
+
+	sb.WriteString(to[pos:])
+	if !strings.HasSuffix(sb.String(), "\n") {
+		sb.WriteByte('\n')
+	}
+}
+
+// writeMarked writes s between the prefix and the suffix, line by line.
+func writeMarked(sb *strings.Builder, s, prefix, suffix string, color ColorConfig, key ColorKey) {
+	for i, line := range strings.Split(s, "\n") {
+		if i > 0 {
+			sb.WriteByte('\n')
+		}
+
+		if line == "" {
+			continue
+		}
+
+		sb.WriteString(color[key])
+		sb.WriteString(prefix)
+		sb.WriteString(line)
+		sb.WriteString(suffix)
+		sb.WriteString(color.Reset(key))
+	}
+}
+
+// splitWords returns the offsets of the start and the end of the words of
+// s, its runs of non-whitespace characters.
+func splitWords(s string) [][2]int {
+	var words [][2]int
+	start := -1
+	for i, r := range s {
+		switch {
+		case unicode.IsSpace(r) && start >= 0:
+			words = append(words, [2]int{start, i})
+			start = -1
+		case !unicode.IsSpace(r) && start < 0:
+			start = i
+		}
+	}
+
+	if start >= 0 {
+		words = append(words, [2]int{start, len(s)})
+	}
+
+	return words
+}
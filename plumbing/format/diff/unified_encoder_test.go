@@ -1068,8 +1068,9 @@ func (t testFile) Path() string {
 }
 
 type testChunk struct {
-	content string
-	op      Operation
+	content   string
+	op        Operation
+	ignorable bool
 }
 
 func (t testChunk) Content() string {
@@ -1080,6 +1081,68 @@ func (t testChunk) Type() Operation {
 	return t.op
 }
 
+func (t testChunk) Ignorable() bool {
+	return t.ignorable
+}
+
+func (s *UnifiedEncoderTestSuite) TestEncodeIgnorable() {
+	p := testPatch{filePatches: []testFilePatch{{
+		from: &testFile{mode: filemode.Regular, path: "file", seed: "A\nB\nC\nD\nE\nF\nG\nH\nI\nJ\n"},
+		to:   &testFile{mode: filemode.Regular, path: "file", seed: "A\n\nB\nC\nD\nE\nF\nG\nH\nI\nj\n"},
+		chunks: []testChunk{
+			{content: "A\n", op: Equal},
+			{content: "\n", op: Add, ignorable: true},
+			{content: "B\nC\nD\nE\nF\nG\nH\nI\n", op: Equal},
+			{content: "J\n", op: Delete},
+			{content: "j\n", op: Add},
+		},
+	}}}
+
+	// The hunk of only the added blank line is not encoded, the line
+	// numbers of the other ones accounting for it.
+	buffer := bytes.NewBuffer(nil)
+	s.NoError(NewUnifiedEncoder(buffer, 1).Encode(p))
+	s.Equal(`diff --git a/file b/file
+index 719a59f3b2f9615233c9b616bae23aa297ed0958..f67c1192cf684c7de92a6e5e2e0eef9dae5924b8 100644
+--- a/file
++++ b/file
+@@ -9,2 +10,2 @@ H
+ I
+-J
++j
+`, buffer.String())
+}
+
+func (s *UnifiedEncoderTestSuite) TestEncodeWordDiff() {
+	p := testPatch{filePatches: []testFilePatch{{
+		from: &testFile{mode: filemode.Regular, path: "file", seed: "from"},
+		to:   &testFile{mode: filemode.Regular, path: "file", seed: "to"},
+		chunks: []testChunk{
+			{content: "a b c\nthe quick fox\n", op: Delete},
+			{content: "a c\nthe slow fox\n", op: Add},
+			{content: "keep\n", op: Equal},
+			{content: "old\nlines\n", op: Delete},
+			{content: "new\n\nline", op: Add},
+		},
+	}}}
+
+	buffer := bytes.NewBuffer(nil)
+	s.NoError(NewUnifiedEncoder(buffer, 3).SetWordDiff(true).Encode(p))
+	s.Equal(`diff --git a/file b/file
+index f90c39e988fcd5938642ff931c5b5d5869a72b91..788636ffba34694361f7d7ee1970d96fb92c3168 100644
+--- a/file
++++ b/file
+@@ -1,5 +1,6 @@
+a[-b-] c
+the [-quick-]{+slow+} fox
+keep
+[-old-]
+[-lines-]{+new+}
+
+{+line+}
+`, buffer.String())
+}
+
 type fixture struct {
 	desc    string
 	context int
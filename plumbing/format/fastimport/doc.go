@@ -0,0 +1,51 @@
+// Package fastimport implements the reading and the writing of git
+// fast-import streams.
+//
+// A fast-import stream is a list of commands creating the blobs, the commits
+// and the tags of a repository along with its branches, as written by
+// `git fast-export` or by the tools migrating a history from other version
+// control systems. An Importer reads them and writes the resulting objects and
+// references to a storer, as `git fast-import` does, and an Exporter writes
+// the history of the references of a storer as such a stream.
+//
+//	Git fast-import stream
+//
+//	stream     = *(command / comment / LF)
+//	comment    = "#" *CHAR LF
+//	command    = blob / commit / tag / reset / alias / feature / option /
+//	             checkpoint / progress / done
+//
+//	blob       = "blob" LF [mark] [original-oid] data
+//	commit     = "commit" SP refname LF [mark] [original-oid]
+//	             ["author" SP ident LF] "committer" SP ident LF
+//	             ["encoding" SP encoding LF] data
+//	             ["from" SP commit-ish LF] *("merge" SP commit-ish LF)
+//	             *fileop [LF]
+//	tag        = "tag" SP name LF [mark] "from" SP commit-ish LF
+//	             [original-oid] ["tagger" SP ident LF] data
+//	reset      = "reset" SP refname LF ["from" SP commit-ish LF] [LF]
+//	alias      = "alias" LF mark "to" SP commit-ish LF [LF]
+//
+//	mark       = "mark" SP ":" idnum LF
+//	ident      = [name SP] "<" email ">" SP when
+//	data       = "data" SP count LF raw [LF] /
+//	             "data" SP "<<" delim LF *(line LF) delim LF [LF]
+//	commit-ish = ":" idnum / obj-id / refname
+//
+//	fileop     = "M" SP mode SP dataref SP path LF ["data" ...] /
+//	             "D" SP path LF / "R" SP path SP path LF /
+//	             "C" SP path SP path LF / "deleteall" LF /
+//	             "N" SP dataref SP commit-ish LF ["data" ...]
+//	dataref    = ":" idnum / obj-id / "inline"
+//
+// The marks, ":1" for instance, name the objects of the stream, to be
+// referenced by the later commands without knowing their hashes. The paths
+// may be quoted as C strings, as the ones holding spaces must be when they
+// are the source of a rename or a copy.
+//
+// The get-mark, cat-blob and ls commands, which answer to the program
+// writing the stream, are not supported, nor are the import-marks and
+// export-marks features.
+//
+// See https://git-scm.com/docs/git-fast-import
+package fastimport
@@ -0,0 +1,512 @@
+package fastimport
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"slices"
+	"strings"
+
+	"github.com/go-git/go-git/v6/plumbing"
+	"github.com/go-git/go-git/v6/plumbing/filemode"
+	"github.com/go-git/go-git/v6/plumbing/object"
+	"github.com/go-git/go-git/v6/plumbing/storer"
+	"github.com/go-git/go-git/v6/utils/ioutil"
+)
+
+// ErrSignedTag is returned when a signed tag is exported with SignedTagsAbort.
+var ErrSignedTag = errors.New("signed tag")
+
+// SignedTags is how the signatures of the tags are exported.
+type SignedTags int
+
+const (
+	// SignedTagsAbort aborts the export on the first signed tag, as git
+	// fast-export does by default.
+	SignedTagsAbort SignedTags = iota
+	// SignedTagsVerbatim exports the signatures as part of the message of
+	// the tags, importing them along with the tags.
+	SignedTagsVerbatim
+	// SignedTagsStrip exports the tags without their signature, changing
+	// their hash.
+	SignedTagsStrip
+)
+
+// Exporter writes the history of the references of a storer as a fast-import
+// stream, as git fast-export does, from which git fast-import, or an
+// Importer, creates the same objects.
+//
+// The signatures of the commits, as the mergetag and the other extra headers,
+// are not exported: their hash changes when they are imported. The references
+// of trees and blobs are skipped, as the tags of trees.
+type Exporter struct {
+	// Refs are the references to export, along with their history. If empty,
+	// all the references are exported, except HEAD and the symbolic ones.
+	Refs []plumbing.ReferenceName
+	// SignedTags is how the signed tags are exported.
+	SignedTags SignedTags
+
+	w *bufio.Writer
+	s Storer
+
+	// marks are the marks of the objects exported, and last the last mark.
+	marks map[plumbing.Hash]uint64
+	last  uint64
+	// tags are the tags exported, which create their own reference.
+	tags map[plumbing.Hash]bool
+}
+
+// NewExporter returns a new Exporter writing the stream of the references of
+// s to w.
+func NewExporter(w io.Writer, s Storer) *Exporter {
+	return &Exporter{
+		w:     bufio.NewWriter(w),
+		s:     s,
+		marks: make(map[plumbing.Hash]uint64),
+		tags:  make(map[plumbing.Hash]bool),
+	}
+}
+
+// Marks returns the hashes of the objects named by the marks of the stream
+// written so far.
+func (e *Exporter) Marks() map[uint64]plumbing.Hash {
+	marks := make(map[uint64]plumbing.Hash, len(e.marks))
+	for h, id := range e.marks {
+		marks[id] = h
+	}
+
+	return marks
+}
+
+// Export writes the blobs, the commits and the tags of the references, the
+// parents always before their children, and then the references.
+func (e *Exporter) Export() error {
+	refs, err := e.references()
+	if err != nil {
+		return err
+	}
+
+	// The commits are written on the branch of the first reference they are
+	// reached from, and the references are set once they are all written.
+	var resets []*plumbing.Reference
+	for _, ref := range refs {
+		mark, reset, err := e.exportObject(ref.Name(), ref.Hash())
+		if err != nil {
+			return err
+		}
+
+		if reset && mark != 0 {
+			resets = append(resets, ref)
+		}
+	}
+
+	for _, ref := range resets {
+		fmt.Fprintf(e.w, "reset %s\nfrom :%d\n\n", ref.Name(), e.marks[ref.Hash()])
+	}
+
+	return e.w.Flush()
+}
+
+// references returns the references to export, sorted by name.
+func (e *Exporter) references() ([]*plumbing.Reference, error) {
+	var refs []*plumbing.Reference
+	if len(e.Refs) == 0 {
+		iter, err := e.s.IterReferences()
+		if err != nil {
+			return nil, err
+		}
+
+		err = iter.ForEach(func(ref *plumbing.Reference) error {
+			if ref.Type() == plumbing.HashReference && ref.Name() != plumbing.HEAD {
+				refs = append(refs, ref)
+			}
+
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	} else {
+		for _, name := range e.Refs {
+			// The symbolic references are exported as the ones they point
+			// to, such as HEAD as the current branch.
+			ref, err := e.s.Reference(name)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %w", name, err)
+			}
+
+			if ref, err = e.target(ref); err != nil {
+				return nil, err
+			}
+
+			refs = append(refs, ref)
+		}
+	}
+
+	slices.SortFunc(refs, func(a, b *plumbing.Reference) int {
+		return strings.Compare(a.Name().String(), b.Name().String())
+	})
+
+	return slices.CompactFunc(refs, func(a, b *plumbing.Reference) bool {
+		return a.Name() == b.Name()
+	}), nil
+}
+
+// target returns the hash reference a symbolic reference points to.
+func (e *Exporter) target(ref *plumbing.Reference) (*plumbing.Reference, error) {
+	for range storer.MaxResolveRecursion {
+		if ref.Type() != plumbing.SymbolicReference {
+			return ref, nil
+		}
+
+		next, err := e.s.Reference(ref.Target())
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", ref.Name(), err)
+		}
+
+		ref = next
+	}
+
+	return nil, storer.ErrMaxResolveRecursion
+}
+
+// exportObject exports the object of a reference and its history, and
+// returns its mark, zero if it is skipped, and whether the reference is to be
+// reset to it, which is not needed for the tags.
+func (e *Exporter) exportObject(name plumbing.ReferenceName, h plumbing.Hash) (uint64, bool, error) {
+	if mark, ok := e.marks[h]; ok {
+		return mark, !e.tags[h], nil
+	}
+
+	o, err := e.s.EncodedObject(plumbing.AnyObject, h)
+	if err != nil {
+		return 0, false, fmt.Errorf("%s: %w", name, err)
+	}
+
+	switch o.Type() {
+	case plumbing.CommitObject:
+		mark, err := e.exportCommits(name, h)
+		return mark, true, err
+	case plumbing.TagObject:
+		mark, err := e.exportTag(name, o)
+		return mark, false, err
+	default:
+		// The references of blobs and trees are skipped, as the branches
+		// can't point to them.
+		return 0, false, nil
+	}
+}
+
+func (e *Exporter) exportTag(name plumbing.ReferenceName, o plumbing.EncodedObject) (uint64, error) {
+	t := &object.Tag{}
+	if err := t.Decode(o); err != nil {
+		return 0, err
+	}
+
+	from, ok := e.marks[t.Target]
+	switch {
+	case ok:
+	case t.TargetType == plumbing.BlobObject:
+		blob, err := e.s.EncodedObject(plumbing.BlobObject, t.Target)
+		if err != nil {
+			return 0, err
+		}
+
+		if from, err = e.exportBlob(blob); err != nil {
+			return 0, err
+		}
+	default:
+		var err error
+		if from, _, err = e.exportObject(name, t.Target); err != nil {
+			return 0, err
+		}
+	}
+
+	if from == 0 {
+		return 0, nil
+	}
+
+	msg := t.Message
+	if t.PGPSignature != "" {
+		switch e.SignedTags {
+		case SignedTagsVerbatim:
+			msg += t.PGPSignature
+		case SignedTagsStrip:
+		default:
+			return 0, fmt.Errorf("%w: %s", ErrSignedTag, t.Name)
+		}
+	}
+
+	mark := e.mark(t.Hash)
+	e.tags[t.Hash] = true
+	fmt.Fprintf(e.w, "tag %s\nmark :%d\nfrom :%d\n", t.Name, mark, from)
+	if t.Tagger != (object.Signature{}) {
+		if err := e.ident("tagger", &t.Tagger); err != nil {
+			return 0, err
+		}
+	}
+
+	e.data([]byte(msg))
+	e.w.WriteByte('\n')
+	return mark, nil
+}
+
+// exportCommits exports the commit and the commits of its history which are
+// not exported yet, along with their blobs, the parents first, on the given
+// branch.
+func (e *Exporter) exportCommits(name plumbing.ReferenceName, h plumbing.Hash) (uint64, error) {
+	commits, err := e.sortCommits(h)
+	if err != nil {
+		return 0, err
+	}
+
+	for _, c := range commits {
+		if err := e.exportCommit(name, c); err != nil {
+			return 0, err
+		}
+	}
+
+	return e.marks[h], nil
+}
+
+// sortCommits returns the commits of the history of the given one which are
+// not exported yet, the parents before their children.
+func (e *Exporter) sortCommits(h plumbing.Hash) ([]*object.Commit, error) {
+	type frame struct {
+		c    *object.Commit
+		next int
+	}
+
+	c, err := object.GetCommit(e.s, h)
+	if err != nil {
+		return nil, err
+	}
+
+	var sorted []*object.Commit
+	seen := map[plumbing.Hash]bool{h: true}
+	stack := []*frame{{c: c}}
+	for len(stack) > 0 {
+		top := stack[len(stack)-1]
+		if top.next == len(top.c.ParentHashes) {
+			sorted = append(sorted, top.c)
+			stack = stack[:len(stack)-1]
+			continue
+		}
+
+		p := top.c.ParentHashes[top.next]
+		top.next++
+		if _, ok := e.marks[p]; ok || seen[p] {
+			continue
+		}
+
+		seen[p] = true
+		c, err := object.GetCommit(e.s, p)
+		if err != nil {
+			return nil, err
+		}
+
+		stack = append(stack, &frame{c: c})
+	}
+
+	return sorted, nil
+}
+
+func (e *Exporter) exportCommit(name plumbing.ReferenceName, c *object.Commit) error {
+	var parent *object.Tree
+	if len(c.ParentHashes) > 0 {
+		p, err := object.GetCommit(e.s, c.ParentHashes[0])
+		if err != nil {
+			return err
+		}
+
+		if parent, err = p.Tree(); err != nil {
+			return err
+		}
+	}
+
+	tree, err := c.Tree()
+	if err != nil {
+		return err
+	}
+
+	var ops bytes.Buffer
+	if err := e.diffTrees(&ops, "", parent, tree); err != nil {
+		return err
+	}
+
+	if len(c.ParentHashes) == 0 {
+		// The root commits must not continue the branch.
+		fmt.Fprintf(e.w, "reset %s\n", name)
+	}
+
+	fmt.Fprintf(e.w, "commit %s\nmark :%d\n", name, e.mark(c.Hash))
+	if err := e.ident("author", &c.Author); err != nil {
+		return err
+	}
+
+	if err := e.ident("committer", &c.Committer); err != nil {
+		return err
+	}
+
+	if c.Encoding != "" && c.Encoding != "UTF-8" {
+		fmt.Fprintf(e.w, "encoding %s\n", c.Encoding)
+	}
+
+	e.data([]byte(c.Message))
+	for i, p := range c.ParentHashes {
+		cmd := "merge"
+		if i == 0 {
+			cmd = "from"
+		}
+
+		fmt.Fprintf(e.w, "%s :%d\n", cmd, e.marks[p])
+	}
+
+	e.w.Write(ops.Bytes())
+	e.w.WriteByte('\n')
+	return nil
+}
+
+// diffTrees writes the file operations turning the tree from into the tree to,
+// exporting the blobs they add. The removals are written first, as the files
+// may become directories.
+func (e *Exporter) diffTrees(ops *bytes.Buffer, dir string, from, to *object.Tree) error {
+	var entries []object.TreeEntry
+	if from != nil {
+		for _, fe := range from.Entries {
+			if _, err := to.FindEntry(fe.Name); errors.Is(err, object.ErrEntryNotFound) {
+				fmt.Fprintf(ops, "D %s\n", quotePath(dir+fe.Name))
+			} else if err != nil {
+				return err
+			}
+		}
+
+		entries = from.Entries
+	}
+
+	for _, te := range to.Entries {
+		path := dir + te.Name
+		var fe *object.TreeEntry
+		if i := slices.IndexFunc(entries, func(e object.TreeEntry) bool { return e.Name == te.Name }); i != -1 {
+			fe = &entries[i]
+		}
+
+		if fe != nil && fe.Hash == te.Hash && fe.Mode == te.Mode {
+			continue
+		}
+
+		if te.Mode == filemode.Dir {
+			var sub *object.Tree
+			if fe != nil && fe.Mode == filemode.Dir {
+				var err error
+				if sub, err = object.GetTree(e.s, fe.Hash); err != nil {
+					return err
+				}
+			} else if fe != nil {
+				fmt.Fprintf(ops, "D %s\n", quotePath(path))
+			}
+
+			t, err := object.GetTree(e.s, te.Hash)
+			if err != nil {
+				return err
+			}
+
+			if err := e.diffTrees(ops, path+"/", sub, t); err != nil {
+				return err
+			}
+
+			continue
+		}
+
+		if te.Mode == filemode.Submodule {
+			fmt.Fprintf(ops, "M %o %s %s\n", te.Mode, te.Hash, quotePath(path))
+			continue
+		}
+
+		mark, ok := e.marks[te.Hash]
+		if !ok {
+			o, err := e.s.EncodedObject(plumbing.BlobObject, te.Hash)
+			if err != nil {
+				return err
+			}
+
+			if mark, err = e.exportBlob(o); err != nil {
+				return err
+			}
+		}
+
+		fmt.Fprintf(ops, "M %o :%d %s\n", te.Mode, mark, quotePath(path))
+	}
+
+	return nil
+}
+
+func (e *Exporter) exportBlob(o plumbing.EncodedObject) (mark uint64, err error) {
+	r, err := o.Reader()
+	if err != nil {
+		return 0, err
+	}
+
+	defer ioutil.CheckClose(r, &err)
+
+	mark = e.mark(o.Hash())
+	fmt.Fprintf(e.w, "blob\nmark :%d\ndata %d\n", mark, o.Size())
+	if _, err := io.Copy(e.w, r); err != nil {
+		return 0, err
+	}
+
+	return mark, e.w.WriteByte('\n')
+}
+
+func (e *Exporter) mark(h plumbing.Hash) uint64 {
+	e.last++
+	e.marks[h] = e.last
+	return e.last
+}
+
+func (e *Exporter) ident(cmd string, sig *object.Signature) error {
+	fmt.Fprintf(e.w, "%s ", cmd)
+	if err := sig.Encode(e.w); err != nil {
+		return err
+	}
+
+	return e.w.WriteByte('\n')
+}
+
+func (e *Exporter) data(data []byte) {
+	fmt.Fprintf(e.w, "data %d\n", len(data))
+	e.w.Write(data)
+}
+
+// quotePath quotes the path as a C string if it holds characters which would
+// otherwise be misread, such as LF, or the ones out of the ASCII range.
+func quotePath(path string) string {
+	if !strings.ContainsFunc(path, func(r rune) bool {
+		return r < 0x20 || r >= 0x7f || r == '\\'
+	}) && !strings.HasPrefix(path, `"`) {
+		return path
+	}
+
+	var b strings.Builder
+	b.WriteByte('"')
+	for i := 0; i < len(path); i++ {
+		switch c := path[i]; {
+		case c == '"' || c == '\\':
+			b.WriteByte('\\')
+			b.WriteByte(c)
+		case c == '\n':
+			b.WriteString(`\n`)
+		case c == '\t':
+			b.WriteString(`\t`)
+		case c < 0x20 || c >= 0x7f:
+			fmt.Fprintf(&b, `\%03o`, c)
+		default:
+			b.WriteByte(c)
+		}
+	}
+
+	b.WriteByte('"')
+	return b.String()
+}
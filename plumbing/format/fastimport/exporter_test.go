@@ -0,0 +1,223 @@
+package fastimport
+
+import (
+	"bytes"
+	"os/exec"
+	"strings"
+	"testing"
+
+	fixtures "github.com/go-git/go-git-fixtures/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/go-git/go-git/v6/plumbing"
+	"github.com/go-git/go-git/v6/plumbing/cache"
+	"github.com/go-git/go-git/v6/plumbing/object"
+	"github.com/go-git/go-git/v6/plumbing/storer"
+	"github.com/go-git/go-git/v6/storage/filesystem"
+	"github.com/go-git/go-git/v6/storage/memory"
+)
+
+// exportedRefs returns the references of the storer an Exporter exports, the
+// ones of trees and blobs excepted.
+func exportedRefs(t *testing.T, s Storer) map[plumbing.ReferenceName]plumbing.Hash {
+	t.Helper()
+
+	refs := make(map[plumbing.ReferenceName]plumbing.Hash)
+	iter, err := s.IterReferences()
+	require.NoError(t, err)
+	require.NoError(t, iter.ForEach(func(ref *plumbing.Reference) error {
+		if ref.Type() != plumbing.HashReference || ref.Name() == plumbing.HEAD {
+			return nil
+		}
+
+		h := ref.Hash()
+		for {
+			o, err := s.EncodedObject(plumbing.AnyObject, h)
+			require.NoError(t, err)
+			switch o.Type() {
+			case plumbing.CommitObject:
+				refs[ref.Name()] = ref.Hash()
+				return nil
+			case plumbing.TagObject:
+				tag, err := object.DecodeTag(s, o)
+				require.NoError(t, err)
+				h = tag.Target
+			default:
+				return nil
+			}
+		}
+	}))
+
+	return refs
+}
+
+func assertRefs(t *testing.T, expected map[plumbing.ReferenceName]plumbing.Hash, s storer.ReferenceStorer) {
+	t.Helper()
+
+	for name, h := range expected {
+		ref, err := s.Reference(name)
+		if assert.NoError(t, err, name) {
+			assert.Equal(t, h, ref.Hash(), name)
+		}
+	}
+}
+
+func TestExportRoundTrip(t *testing.T) {
+	t.Parallel()
+
+	imported := memory.NewStorage()
+	require.NoError(t, NewImporter(strings.NewReader(testStream), imported).Import())
+
+	for name, s := range map[string]Storer{
+		"basic":  filesystem.NewStorage(fixtures.Basic().One().DotGit(), cache.NewObjectLRUDefault()),
+		"tags":   filesystem.NewStorage(fixtures.ByURL("https://github.com/git-fixtures/tags.git").One().DotGit(), cache.NewObjectLRUDefault()),
+		"import": imported,
+	} {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			var stream bytes.Buffer
+			e := NewExporter(&stream, s)
+			e.SignedTags = SignedTagsVerbatim
+			require.NoError(t, e.Export())
+
+			expected := exportedRefs(t, s)
+			require.NotEmpty(t, expected)
+			dst := memory.NewStorage()
+			require.NoError(t, NewImporter(&stream, dst).Import())
+			assertRefs(t, expected, dst)
+		})
+	}
+}
+
+func TestExportGit(t *testing.T) {
+	t.Parallel()
+
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git is not available")
+	}
+
+	s := filesystem.NewStorage(fixtures.Basic().One().DotGit(), cache.NewObjectLRUDefault())
+	var stream bytes.Buffer
+	require.NoError(t, NewExporter(&stream, s).Export())
+
+	dir := t.TempDir()
+	out, err := exec.Command("git", "init", "--bare", dir).CombinedOutput()
+	require.NoError(t, err, string(out))
+	cmd := exec.Command("git", "fast-import", "--quiet")
+	cmd.Dir = dir
+	cmd.Stdin = &stream
+	out, err = cmd.CombinedOutput()
+	require.NoError(t, err, string(out))
+
+	for name, h := range exportedRefs(t, s) {
+		cmd := exec.Command("git", "rev-parse", name.String())
+		cmd.Dir = dir
+		out, err := cmd.Output()
+		require.NoError(t, err)
+		assert.Equal(t, h.String(), strings.TrimSpace(string(out)), name)
+	}
+}
+
+func TestExportRefs(t *testing.T) {
+	t.Parallel()
+
+	s := filesystem.NewStorage(fixtures.Basic().One().DotGit(), cache.NewObjectLRUDefault())
+	var stream bytes.Buffer
+	e := NewExporter(&stream, s)
+	e.Refs = []plumbing.ReferenceName{plumbing.HEAD}
+	require.NoError(t, e.Export())
+
+	dst := memory.NewStorage()
+	require.NoError(t, NewImporter(&stream, dst).Import())
+	head, err := storer.ResolveReference(s, plumbing.HEAD)
+	require.NoError(t, err)
+	assertRefs(t, map[plumbing.ReferenceName]plumbing.Hash{"refs/heads/master": head.Hash()}, dst)
+
+	iter, err := dst.IterReferences()
+	require.NoError(t, err)
+	var names []string
+	require.NoError(t, iter.ForEach(func(ref *plumbing.Reference) error {
+		names = append(names, ref.Name().String())
+		return nil
+	}))
+	assert.Equal(t, []string{"refs/heads/master"}, names)
+
+	// The history of master holds 8 commits, and their blobs.
+	commits := 0
+	for _, h := range e.Marks() {
+		if _, err := object.GetCommit(dst, h); err == nil {
+			commits++
+		}
+	}
+
+	assert.Equal(t, 8, commits)
+}
+
+func TestExportSignedTags(t *testing.T) {
+	t.Parallel()
+
+	stream := "commit refs/heads/master\n" +
+		"mark :1\n" +
+		"committer John Doe <john@example.com> 1136239500 +0100\n" +
+		"data 4\nfoo\n"
+	s := memory.NewStorage()
+	i := NewImporter(strings.NewReader(stream), s)
+	require.NoError(t, i.Import())
+
+	tag := &object.Tag{
+		Name:         "v1.0",
+		Tagger:       object.Signature{Name: "John Doe", Email: "john@example.com"},
+		Message:      "v1.0\n",
+		TargetType:   plumbing.CommitObject,
+		Target:       i.Marks()[1],
+		PGPSignature: "-----BEGIN PGP SIGNATURE-----\n\nfoo\n-----END PGP SIGNATURE-----\n",
+	}
+	o := s.NewEncodedObject()
+	require.NoError(t, tag.Encode(o))
+	h, err := s.SetEncodedObject(o)
+	require.NoError(t, err)
+	require.NoError(t, s.SetReference(plumbing.NewHashReference("refs/tags/v1.0", h)))
+
+	err = NewExporter(&bytes.Buffer{}, s).Export()
+	assert.ErrorIs(t, err, ErrSignedTag)
+
+	for mode, signed := range map[SignedTags]bool{SignedTagsVerbatim: true, SignedTagsStrip: false} {
+		var buf bytes.Buffer
+		e := NewExporter(&buf, s)
+		e.SignedTags = mode
+		require.NoError(t, e.Export())
+
+		dst := memory.NewStorage()
+		require.NoError(t, NewImporter(&buf, dst).Import())
+		ref, err := dst.Reference("refs/tags/v1.0")
+		require.NoError(t, err)
+
+		imported, err := object.GetTag(dst, ref.Hash())
+		require.NoError(t, err)
+		assert.Equal(t, "v1.0\n", imported.Message)
+		if signed {
+			assert.Equal(t, h, ref.Hash())
+			assert.Equal(t, tag.PGPSignature, imported.PGPSignature)
+		} else {
+			assert.NotEqual(t, h, ref.Hash())
+			assert.Empty(t, imported.PGPSignature)
+		}
+	}
+}
+
+func TestQuotePath(t *testing.T) {
+	t.Parallel()
+
+	for path, expected := range map[string]string{
+		"foo/bar":     "foo/bar",
+		"with space":  "with space",
+		"caf\xc3\xa9": `"caf\303\251"`,
+		"new\nline":   `"new\nline"`,
+		`"quoted"`:    `"\"quoted\""`,
+		`back\slash`:  `"back\\slash"`,
+	} {
+		assert.Equal(t, expected, quotePath(path), path)
+	}
+}
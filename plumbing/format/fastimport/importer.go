@@ -0,0 +1,1110 @@
+package fastimport
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"net/mail"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-git/go-git/v6/plumbing"
+	"github.com/go-git/go-git/v6/plumbing/filemode"
+	"github.com/go-git/go-git/v6/plumbing/object"
+	"github.com/go-git/go-git/v6/plumbing/storer"
+)
+
+var (
+	// ErrMalformedStream is returned when the stream doesn't follow the
+	// fast-import format.
+	ErrMalformedStream = errors.New("malformed fast-import stream")
+	// ErrUnsupportedCommand is returned for the commands of the stream which
+	// are not supported, such as cat-blob.
+	ErrUnsupportedCommand = errors.New("unsupported fast-import command")
+	// ErrUnsupportedFeature is returned for the features required by the
+	// stream which are not supported, such as export-marks.
+	ErrUnsupportedFeature = errors.New("unsupported fast-import feature")
+	// ErrNonFastForward is returned when a branch imported is not a
+	// fast-forward of the existing one, unless Force is set.
+	ErrNonFastForward = errors.New("non fast-forward update")
+)
+
+// Storer is the storage the objects and the references of a stream are
+// written to.
+type Storer interface {
+	storer.EncodedObjectStorer
+	storer.ReferenceStorer
+}
+
+// Importer reads a fast-import stream and writes its objects to a Storer,
+// along with the branches and the tags it creates once it is read.
+type Importer struct {
+	// Force updates the existing branches when they are not a fast-forward
+	// to the ones of the stream, which are otherwise left untouched and
+	// reported as ErrNonFastForward. It is set by the force feature.
+	Force bool
+	// Progress, if not nil, receives the progress commands of the stream.
+	Progress io.Writer
+
+	r    *bufio.Reader
+	s    Storer
+	line int
+	// next is the line read ahead, if any.
+	next  *string
+	marks map[uint64]plumbing.Hash
+
+	branches map[plumbing.ReferenceName]*branch
+	// refs are the branches and the tags, in the order they are created.
+	refs []plumbing.ReferenceName
+	tags map[plumbing.ReferenceName]plumbing.Hash
+
+	dateFormat  string
+	requireDone bool
+}
+
+// branch is a branch of the stream, with the tree of its next commit.
+type branch struct {
+	tip  plumbing.Hash
+	root *node
+}
+
+// NewImporter returns a new Importer reading the stream from r and writing
+// its objects and references to s.
+func NewImporter(r io.Reader, s Storer) *Importer {
+	return &Importer{
+		r:          bufio.NewReader(r),
+		s:          s,
+		marks:      make(map[uint64]plumbing.Hash),
+		branches:   make(map[plumbing.ReferenceName]*branch),
+		tags:       make(map[plumbing.ReferenceName]plumbing.Hash),
+		dateFormat: "raw",
+	}
+}
+
+// Marks returns the hashes of the objects named by the marks of the stream
+// read so far.
+func (i *Importer) Marks() map[uint64]plumbing.Hash {
+	return i.marks
+}
+
+// Import reads the stream until its end, or its done command, and updates the
+// branches and the tags it creates.
+func (i *Importer) Import() error {
+	for {
+		line, err := i.readLine()
+		if err == io.EOF {
+			if i.requireDone {
+				return i.errorf("missing done command")
+			}
+
+			break
+		}
+
+		if err != nil {
+			return err
+		}
+
+		if line == "done" {
+			break
+		}
+
+		if err := i.command(line); err != nil {
+			return err
+		}
+	}
+
+	return i.updateReferences()
+}
+
+func (i *Importer) command(line string) error {
+	cmd, arg, _ := strings.Cut(line, " ")
+	switch cmd {
+	case "":
+		return nil
+	case "blob":
+		return i.blob()
+	case "commit":
+		return i.commit(plumbing.ReferenceName(arg))
+	case "tag":
+		return i.tag(arg)
+	case "reset":
+		return i.reset(plumbing.ReferenceName(arg))
+	case "alias":
+		return i.alias()
+	case "checkpoint":
+		return i.updateReferences()
+	case "progress":
+		if i.Progress != nil {
+			if _, err := fmt.Fprintln(i.Progress, line); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	case "feature":
+		return i.feature(arg)
+	case "option":
+		// The options only change the behavior of git fast-import, such as
+		// its memory limits, and those of the other programs are ignored.
+		return nil
+	case "get-mark", "cat-blob", "ls":
+		return fmt.Errorf("%w: %s", ErrUnsupportedCommand, cmd)
+	default:
+		return i.errorf("unknown command %q", line)
+	}
+}
+
+func (i *Importer) feature(arg string) error {
+	name, value, _ := strings.Cut(arg, "=")
+	switch name {
+	case "date-format":
+		switch value {
+		case "raw", "raw-permissive", "rfc2822", "now":
+			i.dateFormat = value
+		default:
+			return i.errorf("unknown date format %q", value)
+		}
+	case "done":
+		i.requireDone = true
+	case "force":
+		i.Force = true
+	case "notes", "relative-marks", "no-relative-marks":
+	default:
+		return fmt.Errorf("%w: %s", ErrUnsupportedFeature, name)
+	}
+
+	return nil
+}
+
+func (i *Importer) blob() error {
+	mark, err := i.optionalMark()
+	if err != nil {
+		return err
+	}
+
+	if _, err := i.optional("original-oid "); err != nil {
+		return err
+	}
+
+	data, err := i.data()
+	if err != nil {
+		return err
+	}
+
+	h, err := i.writeBlob(data)
+	if err != nil {
+		return err
+	}
+
+	i.setMark(mark, h)
+	return nil
+}
+
+func (i *Importer) commit(ref plumbing.ReferenceName) error {
+	if ref == "" {
+		return i.errorf("missing reference name")
+	}
+
+	mark, err := i.optionalMark()
+	if err != nil {
+		return err
+	}
+
+	if _, err := i.optional("original-oid "); err != nil {
+		return err
+	}
+
+	c := &object.Commit{}
+	author, err := i.optional("author ")
+	if err != nil {
+		return err
+	}
+
+	committer, err := i.optional("committer ")
+	if err != nil {
+		return err
+	}
+
+	if committer == nil {
+		return i.errorf("missing committer")
+	}
+
+	if c.Committer, err = i.signature(*committer); err != nil {
+		return err
+	}
+
+	c.Author = c.Committer
+	if author != nil {
+		if c.Author, err = i.signature(*author); err != nil {
+			return err
+		}
+	}
+
+	if sig, err := i.optional("gpgsig "); err != nil {
+		return err
+	} else if sig != nil {
+		data, err := i.data()
+		if err != nil {
+			return err
+		}
+
+		c.PGPSignature = string(data)
+	}
+
+	if enc, err := i.optional("encoding "); err != nil {
+		return err
+	} else if enc != nil {
+		c.Encoding = object.MessageEncoding(*enc)
+	}
+
+	msg, err := i.data()
+	if err != nil {
+		return err
+	}
+
+	c.Message = string(msg)
+	b, err := i.parents(ref, c)
+	if err != nil {
+		return err
+	}
+
+	if err := i.fileOps(b); err != nil {
+		return err
+	}
+
+	if c.TreeHash, err = b.root.write(i.s); err != nil {
+		return err
+	}
+
+	h, err := i.writeObject(c)
+	if err != nil {
+		return err
+	}
+
+	b.tip = h
+	i.setMark(mark, h)
+	return nil
+}
+
+// parents reads the from and merge commands of the commit of the branch,
+// setting its parents, and returns the branch, whose tree is the one of the
+// first parent.
+func (i *Importer) parents(ref plumbing.ReferenceName, c *object.Commit) (*branch, error) {
+	b := i.branch(ref)
+	from, err := i.optional("from ")
+	if err != nil {
+		return nil, err
+	}
+
+	if from != nil {
+		if err := i.resetBranch(b, *from); err != nil {
+			return nil, err
+		}
+	}
+
+	if !b.tip.IsZero() {
+		c.ParentHashes = append(c.ParentHashes, b.tip)
+	}
+
+	for {
+		merge, err := i.optional("merge ")
+		if err != nil || merge == nil {
+			return b, err
+		}
+
+		h, err := i.commitish(*merge)
+		if err != nil {
+			return nil, err
+		}
+
+		c.ParentHashes = append(c.ParentHashes, h)
+	}
+}
+
+// resetBranch sets the tip of the branch to the given commit-ish, and its
+// tree to the one of the commit.
+func (i *Importer) resetBranch(b *branch, from string) error {
+	if from == plumbing.ZeroHash.String() {
+		b.tip = plumbing.ZeroHash
+		b.root = newDir(plumbing.ZeroHash)
+		return nil
+	}
+
+	h, err := i.commitish(from)
+	if err != nil {
+		return err
+	}
+
+	if h == b.tip {
+		return nil
+	}
+
+	c, err := object.GetCommit(i.s, h)
+	if err != nil {
+		return fmt.Errorf("from %s: %w", from, err)
+	}
+
+	b.tip = h
+	b.root = newDir(c.TreeHash)
+	return nil
+}
+
+func (i *Importer) fileOps(b *branch) error {
+	for {
+		line, err := i.readLine()
+		if err == io.EOF {
+			return nil
+		}
+
+		if err != nil {
+			return err
+		}
+
+		op, arg, _ := strings.Cut(line, " ")
+		switch op {
+		case "":
+			return nil
+		case "M":
+			err = i.modify(b.root, arg)
+		case "D":
+			var path string
+			if path, err = i.path(arg); err == nil {
+				err = b.root.remove(i.s, path)
+			}
+		case "R", "C":
+			err = i.copy(b.root, arg, op == "R")
+		case "deleteall":
+			b.root = newDir(plumbing.ZeroHash)
+		case "N":
+			err = i.note(b.root, arg)
+		default:
+			i.unread(line)
+			return nil
+		}
+
+		if err != nil {
+			return err
+		}
+	}
+}
+
+func (i *Importer) modify(root *node, arg string) error {
+	fields := strings.SplitN(arg, " ", 3)
+	if len(fields) != 3 {
+		return i.errorf("malformed file modification %q", arg)
+	}
+
+	mode, err := parseMode(fields[0])
+	if err != nil {
+		return i.errorf("%s", err)
+	}
+
+	path, err := i.path(fields[2])
+	if err != nil {
+		return err
+	}
+
+	h, err := i.dataref(fields[1], mode)
+	if err != nil {
+		return err
+	}
+
+	if mode == filemode.Dir {
+		if path == "" {
+			root.replace(newDir(h))
+			return nil
+		}
+
+		return root.set(i.s, path, newDir(h))
+	}
+
+	if path == "" {
+		return i.errorf("missing path")
+	}
+
+	return root.set(i.s, path, &node{mode: mode, hash: h})
+}
+
+// dataref returns the hash of the object referenced by a file modification,
+// writing the blob of the data following it if it is inline.
+func (i *Importer) dataref(ref string, mode filemode.FileMode) (plumbing.Hash, error) {
+	if ref == "inline" {
+		if mode == filemode.Dir || mode == filemode.Submodule {
+			return plumbing.ZeroHash, i.errorf("inline data for mode %o", mode)
+		}
+
+		data, err := i.data()
+		if err != nil {
+			return plumbing.ZeroHash, err
+		}
+
+		return i.writeBlob(data)
+	}
+
+	if strings.HasPrefix(ref, ":") {
+		return i.mark(ref)
+	}
+
+	h, ok := plumbing.FromHex(ref)
+	if !ok {
+		return plumbing.ZeroHash, i.errorf("malformed data reference %q", ref)
+	}
+
+	// As git, the commits of the submodules don't need to be in the
+	// storer.
+	if mode != filemode.Submodule {
+		if err := i.s.HasEncodedObject(h); err != nil {
+			return plumbing.ZeroHash, fmt.Errorf("object %s: %w", h, err)
+		}
+	}
+
+	return h, nil
+}
+
+func (i *Importer) copy(root *node, arg string, rename bool) error {
+	src, rest, err := i.sourcePath(arg)
+	if err != nil {
+		return err
+	}
+
+	dst, err := i.path(rest)
+	if err != nil {
+		return err
+	}
+
+	n, err := root.lookup(i.s, src)
+	if err != nil {
+		return err
+	}
+
+	if n == nil {
+		return i.errorf("path %q not in branch", src)
+	}
+
+	if rename {
+		if err := root.remove(i.s, src); err != nil {
+			return err
+		}
+	} else {
+		n = n.clone()
+	}
+
+	if dst == "" {
+		if !n.isDir() {
+			return i.errorf("missing path")
+		}
+
+		root.replace(n)
+		return nil
+	}
+
+	return root.set(i.s, dst, n)
+}
+
+// note adds the note of a commit to the notes tree of the commit. The notes
+// are written without fanout, replacing the existing note of the commit
+// whatever its fanout.
+func (i *Importer) note(root *node, arg string) error {
+	ref, target, ok := strings.Cut(arg, " ")
+	if !ok {
+		return i.errorf("malformed note %q", arg)
+	}
+
+	h, err := i.commitish(target)
+	if err != nil {
+		return err
+	}
+
+	path := h.String()
+	for _, p := range []string{path, path[:2] + "/" + path[2:], path[:2] + "/" + path[2:4] + "/" + path[4:]} {
+		if err := root.remove(i.s, p); err != nil {
+			return err
+		}
+	}
+
+	blob, err := i.dataref(ref, filemode.Regular)
+	if err != nil {
+		return err
+	}
+
+	return root.set(i.s, path, &node{mode: filemode.Regular, hash: blob})
+}
+
+func (i *Importer) tag(name string) error {
+	if name == "" {
+		return i.errorf("missing tag name")
+	}
+
+	mark, err := i.optionalMark()
+	if err != nil {
+		return err
+	}
+
+	from, err := i.optional("from ")
+	if err != nil {
+		return err
+	}
+
+	if from == nil {
+		return i.errorf("missing from in tag %s", name)
+	}
+
+	target, err := i.commitish(*from)
+	if err != nil {
+		return err
+	}
+
+	o, err := i.s.EncodedObject(plumbing.AnyObject, target)
+	if err != nil {
+		return fmt.Errorf("tag %s: %w", name, err)
+	}
+
+	if _, err := i.optional("original-oid "); err != nil {
+		return err
+	}
+
+	tagger, err := i.optional("tagger ")
+	if err != nil {
+		return err
+	}
+
+	msg, err := i.data()
+	if err != nil {
+		return err
+	}
+
+	t := &object.Tag{Name: name, Target: target, TargetType: o.Type(), Message: string(msg)}
+	var h plumbing.Hash
+	if tagger != nil {
+		if t.Tagger, err = i.signature(*tagger); err != nil {
+			return err
+		}
+
+		h, err = i.writeObject(t)
+	} else {
+		h, err = i.writeTaggerless(t)
+	}
+
+	if err != nil {
+		return err
+	}
+
+	ref := plumbing.NewTagReferenceName(name)
+	if _, ok := i.tags[ref]; !ok {
+		i.refs = append(i.refs, ref)
+	}
+
+	i.tags[ref] = h
+	i.setMark(mark, h)
+	return nil
+}
+
+// writeTaggerless writes a tag without tagger, which object.Tag can't encode.
+func (i *Importer) writeTaggerless(t *object.Tag) (plumbing.Hash, error) {
+	o := i.s.NewEncodedObject()
+	o.SetType(plumbing.TagObject)
+	w, err := o.Writer()
+	if err != nil {
+		return plumbing.ZeroHash, err
+	}
+
+	if _, err := fmt.Fprintf(w, "object %s\ntype %s\ntag %s\n\n%s",
+		t.Target, t.TargetType, t.Name, t.Message); err != nil {
+		_ = w.Close()
+		return plumbing.ZeroHash, err
+	}
+
+	if err := w.Close(); err != nil {
+		return plumbing.ZeroHash, err
+	}
+
+	return i.s.SetEncodedObject(o)
+}
+
+func (i *Importer) reset(ref plumbing.ReferenceName) error {
+	if ref == "" {
+		return i.errorf("missing reference name")
+	}
+
+	b := i.branch(ref)
+	b.tip = plumbing.ZeroHash
+	b.root = newDir(plumbing.ZeroHash)
+
+	from, err := i.optional("from ")
+	if err != nil {
+		return err
+	}
+
+	if from != nil {
+		if err := i.resetBranch(b, *from); err != nil {
+			return err
+		}
+	}
+
+	return i.optionalLF()
+}
+
+func (i *Importer) alias() error {
+	mark, err := i.optionalMark()
+	if err != nil {
+		return err
+	}
+
+	if mark == 0 {
+		return i.errorf("missing mark in alias")
+	}
+
+	to, err := i.optional("to ")
+	if err != nil {
+		return err
+	}
+
+	if to == nil {
+		return i.errorf("missing to in alias")
+	}
+
+	h, err := i.commitish(*to)
+	if err != nil {
+		return err
+	}
+
+	i.setMark(mark, h)
+	return i.optionalLF()
+}
+
+// branch returns the branch of the stream with the given name, which has no
+// commit if it is created.
+func (i *Importer) branch(ref plumbing.ReferenceName) *branch {
+	b, ok := i.branches[ref]
+	if !ok {
+		b = &branch{root: newDir(plumbing.ZeroHash)}
+		i.branches[ref] = b
+		i.refs = append(i.refs, ref)
+	}
+
+	return b
+}
+
+// commitish returns the hash of a mark, of an object id, or of the tip of a
+// branch of the stream or of the storer.
+func (i *Importer) commitish(s string) (plumbing.Hash, error) {
+	if strings.HasPrefix(s, ":") {
+		return i.mark(s)
+	}
+
+	if h, ok := plumbing.FromHex(s); ok {
+		return h, nil
+	}
+
+	name := plumbing.ReferenceName(strings.TrimSuffix(s, "^0"))
+	if b, ok := i.branches[name]; ok {
+		if b.tip.IsZero() {
+			return plumbing.ZeroHash, i.errorf("branch %s has no commit", name)
+		}
+
+		return b.tip, nil
+	}
+
+	if h, ok := i.tags[name]; ok {
+		return h, nil
+	}
+
+	ref, err := storer.ResolveReference(i.s, name)
+	if err != nil {
+		return plumbing.ZeroHash, fmt.Errorf("%s: %w", s, err)
+	}
+
+	return ref.Hash(), nil
+}
+
+func (i *Importer) mark(s string) (plumbing.Hash, error) {
+	id, err := strconv.ParseUint(strings.TrimPrefix(s, ":"), 10, 64)
+	if err != nil || id == 0 {
+		return plumbing.ZeroHash, i.errorf("malformed mark %q", s)
+	}
+
+	h, ok := i.marks[id]
+	if !ok {
+		return plumbing.ZeroHash, i.errorf("unknown mark %q", s)
+	}
+
+	return h, nil
+}
+
+func (i *Importer) optionalMark() (uint64, error) {
+	line, err := i.optional("mark ")
+	if err != nil || line == nil {
+		return 0, err
+	}
+
+	id, err := strconv.ParseUint(strings.TrimPrefix(*line, ":"), 10, 64)
+	if err != nil || id == 0 || !strings.HasPrefix(*line, ":") {
+		return 0, i.errorf("malformed mark %q", *line)
+	}
+
+	return id, nil
+}
+
+func (i *Importer) setMark(id uint64, h plumbing.Hash) {
+	if id != 0 {
+		i.marks[id] = h
+	}
+}
+
+// signature parses an ident of the stream, whose date is in the date format
+// of the stream.
+func (i *Importer) signature(ident string) (object.Signature, error) {
+	open := strings.IndexByte(ident, '<')
+	end := strings.IndexByte(ident, '>')
+	if open == -1 || end < open || !strings.HasPrefix(ident[end+1:], " ") {
+		return object.Signature{}, i.errorf("malformed ident %q", ident)
+	}
+
+	sig := object.Signature{
+		Name:  strings.TrimSuffix(ident[:open], " "),
+		Email: ident[open+1 : end],
+	}
+
+	when := ident[end+2:]
+	switch i.dateFormat {
+	case "raw", "raw-permissive":
+		t, err := parseRawDate(when)
+		if err != nil {
+			return sig, i.errorf("malformed date %q", when)
+		}
+
+		sig.When = t
+	case "rfc2822":
+		t, err := mail.ParseDate(when)
+		if err != nil {
+			return sig, i.errorf("malformed date %q: %s", when, err)
+		}
+
+		sig.When = t
+	case "now":
+		if when != "now" {
+			return sig, i.errorf("malformed date %q", when)
+		}
+
+		sig.When = time.Now()
+	}
+
+	return sig, nil
+}
+
+// parseRawDate parses a date in the raw format, the seconds since the epoch
+// followed by the offset of the time zone, such as "1136239445 -0700".
+func parseRawDate(s string) (time.Time, error) {
+	secs, zone, ok := strings.Cut(s, " ")
+	if !ok || len(zone) != 5 || zone[0] != '+' && zone[0] != '-' {
+		return time.Time{}, ErrMalformedStream
+	}
+
+	ts, err := strconv.ParseInt(secs, 10, 64)
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	offset, err := strconv.Atoi(zone[1:])
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	offset = offset/100*3600 + offset%100*60
+	if zone[0] == '-' {
+		offset = -offset
+	}
+
+	return time.Unix(ts, 0).In(time.FixedZone("", offset)), nil
+}
+
+func parseMode(s string) (filemode.FileMode, error) {
+	switch s {
+	case "644", "100644":
+		return filemode.Regular, nil
+	case "755", "100755":
+		return filemode.Executable, nil
+	case "120000":
+		return filemode.Symlink, nil
+	case "160000":
+		return filemode.Submodule, nil
+	case "040000", "40000":
+		return filemode.Dir, nil
+	default:
+		return filemode.Empty, fmt.Errorf("unknown file mode %q", s)
+	}
+}
+
+// path returns the path of a file operation, unquoting it if it is quoted.
+func (i *Importer) path(s string) (string, error) {
+	if !strings.HasPrefix(s, `"`) {
+		return s, nil
+	}
+
+	p, err := strconv.Unquote(s)
+	if err != nil {
+		return "", i.errorf("malformed path %s", s)
+	}
+
+	return p, nil
+}
+
+// sourcePath returns the source path of a rename or a copy, which must be
+// quoted if it holds a space, and the rest of the operation.
+func (i *Importer) sourcePath(s string) (string, string, error) {
+	if !strings.HasPrefix(s, `"`) {
+		src, rest, ok := strings.Cut(s, " ")
+		if !ok {
+			return "", "", i.errorf("missing destination path in %q", s)
+		}
+
+		return src, rest, nil
+	}
+
+	quoted, err := strconv.QuotedPrefix(s)
+	if err != nil || !strings.HasPrefix(s[len(quoted):], " ") {
+		return "", "", i.errorf("malformed path %s", s)
+	}
+
+	src, err := strconv.Unquote(quoted)
+	if err != nil {
+		return "", "", i.errorf("malformed path %s", s)
+	}
+
+	return src, s[len(quoted)+1:], nil
+}
+
+// data reads a data command and its payload, whose size is either given or
+// delimited by a line.
+func (i *Importer) data() ([]byte, error) {
+	line, err := i.readLine()
+	if err == io.EOF {
+		return nil, i.errorf("missing data")
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	arg, ok := strings.CutPrefix(line, "data ")
+	if !ok {
+		return nil, i.errorf("expected data, got %q", line)
+	}
+
+	if delim, ok := strings.CutPrefix(arg, "<<"); ok {
+		return i.delimitedData(delim)
+	}
+
+	n, err := strconv.ParseUint(arg, 10, 63)
+	if err != nil {
+		return nil, i.errorf("malformed data size %q", arg)
+	}
+
+	data := make([]byte, n)
+	if _, err := io.ReadFull(i.r, data); err != nil {
+		return nil, i.errorf("reading %d bytes of data: %s", n, err)
+	}
+
+	i.line += bytes.Count(data, []byte("\n"))
+	return data, i.optionalLF()
+}
+
+func (i *Importer) delimitedData(delim string) ([]byte, error) {
+	if delim == "" {
+		return nil, i.errorf("missing data delimiter")
+	}
+
+	var data []byte
+	for {
+		line, err := i.r.ReadString('\n')
+		if err != nil {
+			return nil, i.errorf("missing data delimiter %q", delim)
+		}
+
+		i.line++
+		if line == delim+"\n" {
+			break
+		}
+
+		data = append(data, line...)
+	}
+
+	return data, i.optionalLF()
+}
+
+// optional returns the argument of the next line if it starts with the given
+// prefix, or nil leaving the line to be read.
+func (i *Importer) optional(prefix string) (*string, error) {
+	line, err := i.readLine()
+	if err == io.EOF {
+		return nil, nil
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	arg, ok := strings.CutPrefix(line, prefix)
+	if !ok {
+		i.unread(line)
+		return nil, nil
+	}
+
+	return &arg, nil
+}
+
+// optionalLF skips the empty line following a command, if any.
+func (i *Importer) optionalLF() error {
+	if i.next != nil {
+		if *i.next == "" {
+			i.next = nil
+		}
+
+		return nil
+	}
+
+	b, err := i.r.Peek(1)
+	if err == io.EOF {
+		return nil
+	}
+
+	if err != nil {
+		return err
+	}
+
+	if b[0] == '\n' {
+		i.line++
+		_, err = i.r.Discard(1)
+	}
+
+	return err
+}
+
+// readLine returns the next line of the stream, without its LF, skipping
+// the comments.
+func (i *Importer) readLine() (string, error) {
+	if i.next != nil {
+		line := *i.next
+		i.next = nil
+		return line, nil
+	}
+
+	for {
+		line, err := i.r.ReadString('\n')
+		if err == io.EOF && line == "" {
+			return "", io.EOF
+		}
+
+		if err != nil && err != io.EOF {
+			return "", err
+		}
+
+		i.line++
+		line = strings.TrimSuffix(line, "\n")
+		if !strings.HasPrefix(line, "#") {
+			return line, nil
+		}
+	}
+}
+
+func (i *Importer) unread(line string) {
+	i.next = &line
+}
+
+func (i *Importer) errorf(format string, a ...any) error {
+	return fmt.Errorf("%w: line %d: %s", ErrMalformedStream, i.line, fmt.Sprintf(format, a...))
+}
+
+func (i *Importer) writeBlob(data []byte) (plumbing.Hash, error) {
+	o := i.s.NewEncodedObject()
+	o.SetType(plumbing.BlobObject)
+	o.SetSize(int64(len(data)))
+	w, err := o.Writer()
+	if err != nil {
+		return plumbing.ZeroHash, err
+	}
+
+	if _, err := w.Write(data); err != nil {
+		_ = w.Close()
+		return plumbing.ZeroHash, err
+	}
+
+	if err := w.Close(); err != nil {
+		return plumbing.ZeroHash, err
+	}
+
+	return i.s.SetEncodedObject(o)
+}
+
+func (i *Importer) writeObject(obj interface {
+	Encode(plumbing.EncodedObject) error
+},
+) (plumbing.Hash, error) {
+	o := i.s.NewEncodedObject()
+	if err := obj.Encode(o); err != nil {
+		return plumbing.ZeroHash, err
+	}
+
+	return i.s.SetEncodedObject(o)
+}
+
+// updateReferences sets the branches and the tags created by the stream so
+// far, keeping the existing branches which are not fast-forwarded unless
+// Force is set.
+func (i *Importer) updateReferences() error {
+	var errs []error
+	for _, name := range i.refs {
+		h, ok := i.tags[name]
+		if b, isBranch := i.branches[name]; isBranch && !ok {
+			h = b.tip
+		}
+
+		if h.IsZero() {
+			continue
+		}
+
+		old, err := i.s.Reference(name)
+		switch {
+		case errors.Is(err, plumbing.ErrReferenceNotFound):
+		case err != nil:
+			return err
+		case old.Hash() == h:
+			continue
+		case !i.Force && old.Type() == plumbing.HashReference:
+			if ff, err := i.isFastForward(old.Hash(), h); err != nil {
+				return err
+			} else if !ff {
+				errs = append(errs, fmt.Errorf("%w: %s, %s doesn't contain %s", ErrNonFastForward, name, h, old.Hash()))
+				continue
+			}
+		}
+
+		if err := i.s.SetReference(plumbing.NewHashReference(name, h)); err != nil {
+			return err
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+func (i *Importer) isFastForward(old, h plumbing.Hash) (bool, error) {
+	oc, err := object.GetCommit(i.s, old)
+	if err != nil {
+		// As git, a branch which doesn't point to a commit is replaced.
+		if errors.Is(err, plumbing.ErrObjectNotFound) || errors.Is(err, object.ErrUnsupportedObject) {
+			return true, nil
+		}
+
+		return false, err
+	}
+
+	c, err := object.GetCommit(i.s, h)
+	if err != nil {
+		return false, err
+	}
+
+	return oc.IsAncestor(c)
+}
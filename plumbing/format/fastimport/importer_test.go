@@ -0,0 +1,273 @@
+package fastimport
+
+import (
+	"bytes"
+	"os/exec"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/go-git/go-git/v6/plumbing"
+	"github.com/go-git/go-git/v6/plumbing/filemode"
+	"github.com/go-git/go-git/v6/plumbing/object"
+	"github.com/go-git/go-git/v6/storage/memory"
+)
+
+const testStream = `feature done
+# the blobs
+blob
+mark :1
+data 6
+hello
+
+blob
+mark :2
+data <<EOF
+with a space
+EOF
+
+commit refs/heads/master
+mark :3
+author Jane Doe <jane@example.com> 1136239445 -0700
+committer John Doe <john@example.com> 1136239500 +0100
+data 8
+initial
+M 100644 :1 README
+M 644 :2 "dir/with space.txt"
+M 755 inline bin/run
+data 10
+#!/bin/sh
+
+M 120000 inline link
+data 6
+README
+
+commit refs/heads/master
+mark :4
+committer John Doe <john@example.com> 1136239600 +0100
+data <<EOF
+move
+EOF
+R README docs/README
+C bin/run bin/run2
+D link
+D dir/with space.txt
+
+reset refs/heads/side
+from :3
+
+commit refs/heads/side
+mark :5
+committer John Doe <john@example.com> 1136239700 +0100
+data 5
+side
+deleteall
+M 644 :1 only
+
+commit refs/heads/master
+mark :6
+committer John Doe <john@example.com> 1136239800 +0100
+data 6
+merge
+merge :5
+M 644 inline "docs/caf\303\251"
+data 5
+caf\
+
+tag v1.0
+from :4
+tagger John Doe <john@example.com> 1136239900 +0100
+data 5
+v1.0
+
+commit refs/notes/commits
+committer John Doe <john@example.com> 1136240000 +0100
+data 6
+notes
+N inline :3
+data 5
+note
+
+progress imported
+done
+`
+
+var testRefs = []plumbing.ReferenceName{
+	"refs/heads/master", "refs/heads/side", "refs/tags/v1.0", "refs/notes/commits",
+}
+
+func TestImport(t *testing.T) {
+	t.Parallel()
+
+	s := memory.NewStorage()
+	var progress bytes.Buffer
+	i := NewImporter(strings.NewReader(testStream), s)
+	i.Progress = &progress
+	require.NoError(t, i.Import())
+	assert.Equal(t, "progress imported\n", progress.String())
+	assert.Len(t, i.Marks(), 6)
+
+	master, err := s.Reference("refs/heads/master")
+	require.NoError(t, err)
+	assert.Equal(t, i.Marks()[6], master.Hash())
+
+	c, err := object.GetCommit(s, master.Hash())
+	require.NoError(t, err)
+	assert.Equal(t, "merge\n", c.Message)
+	assert.Equal(t, []plumbing.Hash{i.Marks()[4], i.Marks()[5]}, c.ParentHashes)
+	assertFiles(t, c, map[string]string{
+		"docs/README": "hello\n",
+		"docs/café":   "caf\\\n",
+		"bin/run":     "#!/bin/sh\n",
+		"bin/run2":    "#!/bin/sh\n",
+	})
+
+	initial, err := object.GetCommit(s, i.Marks()[3])
+	require.NoError(t, err)
+	assert.Equal(t, "Jane Doe", initial.Author.Name)
+	assert.Equal(t, int64(1136239445), initial.Author.When.Unix())
+	_, offset := initial.Author.When.Zone()
+	assert.Equal(t, -7*3600, offset)
+	assert.Empty(t, initial.ParentHashes)
+	assertFiles(t, initial, map[string]string{
+		"README":             "hello\n",
+		"dir/with space.txt": "with a space\n",
+		"bin/run":            "#!/bin/sh\n",
+		"link":               "README",
+	})
+
+	f, err := initial.File("bin/run")
+	require.NoError(t, err)
+	assert.Equal(t, filemode.Executable, f.Mode)
+	f, err = initial.File("link")
+	require.NoError(t, err)
+	assert.Equal(t, filemode.Symlink, f.Mode)
+
+	side, err := object.GetCommit(s, i.Marks()[5])
+	require.NoError(t, err)
+	assert.Equal(t, []plumbing.Hash{i.Marks()[3]}, side.ParentHashes)
+	assertFiles(t, side, map[string]string{"only": "hello\n"})
+
+	ref, err := s.Reference("refs/tags/v1.0")
+	require.NoError(t, err)
+	tag, err := object.GetTag(s, ref.Hash())
+	require.NoError(t, err)
+	assert.Equal(t, i.Marks()[4], tag.Target)
+	assert.Equal(t, plumbing.CommitObject, tag.TargetType)
+
+	ref, err = s.Reference("refs/notes/commits")
+	require.NoError(t, err)
+	notes, err := object.GetCommit(s, ref.Hash())
+	require.NoError(t, err)
+	assertFiles(t, notes, map[string]string{i.Marks()[3].String(): "note\n"})
+}
+
+func assertFiles(t *testing.T, c *object.Commit, expected map[string]string) {
+	t.Helper()
+
+	files := make(map[string]string)
+	iter, err := c.Files()
+	require.NoError(t, err)
+	require.NoError(t, iter.ForEach(func(f *object.File) error {
+		content, err := f.Contents()
+		files[f.Name] = content
+		return err
+	}))
+
+	assert.Equal(t, expected, files)
+}
+
+func TestImportGit(t *testing.T) {
+	t.Parallel()
+
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git is not available")
+	}
+
+	dir := t.TempDir()
+	out, err := exec.Command("git", "init", "--bare", dir).CombinedOutput()
+	require.NoError(t, err, string(out))
+	cmd := exec.Command("git", "fast-import", "--quiet")
+	cmd.Dir = dir
+	cmd.Stdin = strings.NewReader(testStream)
+	out, err = cmd.CombinedOutput()
+	require.NoError(t, err, string(out))
+
+	s := memory.NewStorage()
+	require.NoError(t, NewImporter(strings.NewReader(testStream), s).Import())
+	for _, name := range testRefs {
+		cmd := exec.Command("git", "rev-parse", name.String())
+		cmd.Dir = dir
+		out, err := cmd.Output()
+		require.NoError(t, err)
+
+		ref, err := s.Reference(name)
+		require.NoError(t, err)
+		assert.Equal(t, strings.TrimSpace(string(out)), ref.Hash().String(), name)
+	}
+}
+
+func TestImportFastForward(t *testing.T) {
+	t.Parallel()
+
+	s := memory.NewStorage()
+	stream := "commit refs/heads/master\n" +
+		"mark :1\n" +
+		"committer John Doe <john@example.com> 1136239500 +0100\n" +
+		"data 4\nfoo\n" +
+		"M 644 inline foo\ndata 3\nfoo\n"
+	i := NewImporter(strings.NewReader(stream), s)
+	require.NoError(t, i.Import())
+	first := i.Marks()[1]
+
+	// The next import continues the branch from the existing commit.
+	i = NewImporter(strings.NewReader(stream+"\n"+
+		"commit refs/heads/master\n"+
+		"mark :2\n"+
+		"committer John Doe <john@example.com> 1136239600 +0100\n"+
+		"data 4\nbar\n"+
+		"from refs/heads/master^0\n"+
+		"M 644 inline bar\ndata 3\nbar\n"), s)
+	require.NoError(t, i.Import())
+	ref, err := s.Reference("refs/heads/master")
+	require.NoError(t, err)
+	assert.Equal(t, i.Marks()[2], ref.Hash())
+
+	c, err := object.GetCommit(s, ref.Hash())
+	require.NoError(t, err)
+	assert.Equal(t, []plumbing.Hash{first}, c.ParentHashes)
+
+	// A branch rewritten is not a fast-forward, unless forced.
+	rewritten := strings.Replace(stream, "1136239500", "1136239501", 1)
+	err = NewImporter(strings.NewReader(rewritten), s).Import()
+	assert.ErrorIs(t, err, ErrNonFastForward)
+	ref, err = s.Reference("refs/heads/master")
+	require.NoError(t, err)
+	assert.Equal(t, c.Hash, ref.Hash())
+
+	i = NewImporter(strings.NewReader("feature force\n"+rewritten), s)
+	require.NoError(t, i.Import())
+	ref, err = s.Reference("refs/heads/master")
+	require.NoError(t, err)
+	assert.Equal(t, i.Marks()[1], ref.Hash())
+}
+
+func TestImportErrors(t *testing.T) {
+	t.Parallel()
+
+	for stream, expected := range map[string]error{
+		"cat-blob :1\n":                      ErrUnsupportedCommand,
+		"feature export-marks=marks\n":       ErrUnsupportedFeature,
+		"feature done\nblob\ndata 0\n":       ErrMalformedStream,
+		"blob\ndata 10\nshort":               ErrMalformedStream,
+		"blob\ndata <<EOF\nunterminated\n":   ErrMalformedStream,
+		"reset refs/heads/master\nfrom :1\n": ErrMalformedStream,
+		"commit refs/heads/master\ndata 0\n": ErrMalformedStream,
+		"unknown\n":                          ErrMalformedStream,
+	} {
+		err := NewImporter(strings.NewReader(stream), memory.NewStorage()).Import()
+		assert.ErrorIs(t, err, expected, stream)
+	}
+}
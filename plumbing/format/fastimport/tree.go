@@ -0,0 +1,201 @@
+package fastimport
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/go-git/go-git/v6/plumbing"
+	"github.com/go-git/go-git/v6/plumbing/filemode"
+	"github.com/go-git/go-git/v6/plumbing/object"
+	"github.com/go-git/go-git/v6/plumbing/storer"
+)
+
+// node is a file or a directory of the tree of a branch. The directories are
+// only read from the storer once changed, and their hash is zero from then on,
+// until they are written again.
+type node struct {
+	mode filemode.FileMode
+	hash plumbing.Hash
+	// entries are the entries of a directory, nil until it is read.
+	entries map[string]*node
+}
+
+func newDir(h plumbing.Hash) *node {
+	return &node{mode: filemode.Dir, hash: h}
+}
+
+func (n *node) isDir() bool {
+	return n.mode == filemode.Dir
+}
+
+// load reads the entries of the directory, if they are not read yet.
+func (n *node) load(s storer.EncodedObjectStorer) error {
+	if n.entries != nil {
+		return nil
+	}
+
+	n.entries = make(map[string]*node)
+	if n.hash.IsZero() {
+		return nil
+	}
+
+	t, err := object.GetTree(s, n.hash)
+	if err != nil {
+		return err
+	}
+
+	for _, e := range t.Entries {
+		n.entries[e.Name] = &node{mode: e.Mode, hash: e.Hash}
+	}
+
+	return nil
+}
+
+// lookup returns the node at the given path of the directory, or nil if it is
+// missing.
+func (n *node) lookup(s storer.EncodedObjectStorer, path string) (*node, error) {
+	cur := n
+	for _, name := range splitPath(path) {
+		if !cur.isDir() {
+			return nil, nil
+		}
+
+		if err := cur.load(s); err != nil {
+			return nil, err
+		}
+
+		if cur = cur.entries[name]; cur == nil {
+			return nil, nil
+		}
+	}
+
+	return cur, nil
+}
+
+// set puts the node at the given path of the directory, creating its parent
+// directories, replacing the files in the way.
+func (n *node) set(s storer.EncodedObjectStorer, path string, child *node) error {
+	names := splitPath(path)
+	cur := n
+	for _, name := range names[:len(names)-1] {
+		if err := cur.load(s); err != nil {
+			return err
+		}
+
+		cur.hash = plumbing.ZeroHash
+		next := cur.entries[name]
+		if next == nil || !next.isDir() {
+			next = &node{mode: filemode.Dir, entries: make(map[string]*node)}
+			cur.entries[name] = next
+		}
+
+		cur = next
+	}
+
+	if err := cur.load(s); err != nil {
+		return err
+	}
+
+	cur.hash = plumbing.ZeroHash
+	cur.entries[names[len(names)-1]] = child
+	return nil
+}
+
+// remove removes the node at the given path of the directory, if any, along
+// with its parent directories left empty.
+func (n *node) remove(s storer.EncodedObjectStorer, path string) error {
+	_, err := n.removePath(s, splitPath(path))
+	return err
+}
+
+func (n *node) removePath(s storer.EncodedObjectStorer, names []string) (bool, error) {
+	if err := n.load(s); err != nil {
+		return false, err
+	}
+
+	child, ok := n.entries[names[0]]
+	if !ok {
+		return false, nil
+	}
+
+	if len(names) > 1 {
+		if !child.isDir() {
+			return false, nil
+		}
+
+		removed, err := child.removePath(s, names[1:])
+		if err != nil || !removed {
+			return false, err
+		}
+
+		if len(child.entries) == 0 {
+			delete(n.entries, names[0])
+		}
+	} else {
+		delete(n.entries, names[0])
+	}
+
+	n.hash = plumbing.ZeroHash
+	return true, nil
+}
+
+// replace replaces the content of the directory with the one of another.
+func (n *node) replace(dir *node) {
+	*n = *dir
+}
+
+// clone returns a copy of the node, sharing the directories which didn't
+// change since they were read.
+func (n *node) clone() *node {
+	c := &node{mode: n.mode, hash: n.hash}
+	if !n.isDir() || !n.hash.IsZero() || n.entries == nil {
+		return c
+	}
+
+	c.entries = make(map[string]*node, len(n.entries))
+	for name, e := range n.entries {
+		c.entries[name] = e.clone()
+	}
+
+	return c
+}
+
+// write writes the trees of the directories which changed, and returns the
+// hash of the node.
+func (n *node) write(s storer.EncodedObjectStorer) (plumbing.Hash, error) {
+	if !n.isDir() || !n.hash.IsZero() {
+		return n.hash, nil
+	}
+
+	if err := n.load(s); err != nil {
+		return plumbing.ZeroHash, err
+	}
+
+	t := &object.Tree{Entries: make([]object.TreeEntry, 0, len(n.entries))}
+	for name, e := range n.entries {
+		h, err := e.write(s)
+		if err != nil {
+			return plumbing.ZeroHash, err
+		}
+
+		t.Entries = append(t.Entries, object.TreeEntry{Name: name, Mode: e.mode, Hash: h})
+	}
+
+	sort.Sort(object.TreeEntrySorter(t.Entries))
+	o := s.NewEncodedObject()
+	if err := t.Encode(o); err != nil {
+		return plumbing.ZeroHash, err
+	}
+
+	h, err := s.SetEncodedObject(o)
+	if err != nil {
+		return plumbing.ZeroHash, err
+	}
+
+	n.hash = h
+	return h, nil
+}
+
+func splitPath(path string) []string {
+	return strings.Split(strings.Trim(path, "/"), "/")
+}
@@ -12,12 +12,13 @@ import (
 )
 
 const (
-	coreSection       = "core"
-	attributesfile    = "attributesfile"
-	gitDir            = ".git"
-	gitattributesFile = ".gitattributes"
-	gitconfigFile     = ".gitconfig"
-	systemFile        = "/etc/gitconfig"
+	coreSection        = "core"
+	attributesfile     = "attributesfile"
+	gitDir             = ".git"
+	gitattributesFile  = ".gitattributes"
+	infoAttributesFile = gitDir + "/info/attributes"
+	gitconfigFile      = ".gitconfig"
+	systemFile         = "/etc/gitconfig"
 )
 
 func ReadAttributesFile(fs billy.Filesystem, path []string, attributesFile string, allowMacro bool) ([]MatchAttribute, error) {
@@ -35,11 +36,12 @@ func ReadAttributesFile(fs billy.Filesystem, path []string, attributesFile strin
 }
 
 // ReadPatterns reads gitattributes patterns recursively through the directory
-// structure. The result is in ascending order of priority (last higher).
+// structure, and then the ones of .git/info/attributes. The result is in
+// ascending order of priority (last higher).
 //
-// The .gitattribute file in the root directory will allow custom macro
-// definitions. Custom macro definitions in other directories .gitattributes
-// will return an error.
+// The .gitattribute file in the root directory and .git/info/attributes will
+// allow custom macro definitions. Custom macro definitions in other
+// directories .gitattributes will return an error.
 func ReadPatterns(fs billy.Filesystem, path []string) (attributes []MatchAttribute, err error) {
 	attributes, err = ReadAttributesFile(fs, path, gitattributesFile, true)
 	if err != nil {
@@ -47,6 +49,12 @@ func ReadPatterns(fs billy.Filesystem, path []string) (attributes []MatchAttribu
 	}
 
 	attrs, err := walkDirectory(fs, path)
+	attributes = append(attributes, attrs...)
+	if err != nil {
+		return attributes, err
+	}
+
+	attrs, err = ReadAttributesFile(fs, path, infoAttributesFile, true)
 	return append(attributes, attrs...), err
 }
 
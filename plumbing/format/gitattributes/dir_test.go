@@ -151,8 +151,29 @@ func (s *MatcherSuite) TestDir_ReadPatterns() {
 	results, _ := m.Match([]string{"vendor", "gopkg.in", "file"}, nil)
 	s.Equal("bar", results["foo"].Value())
 
+	// vendor/.gitattributes overrides the attributes of the root one.
 	results, _ = m.Match([]string{"vendor", "github.com", "file"}, nil)
-	s.False(results["foo"].IsUnset())
+	s.True(results["foo"].IsUnset())
+}
+
+func (s *MatcherSuite) TestDir_ReadPatternsInfoAttributes() {
+	s.NoError(s.GFS.MkdirAll(".git/info", os.ModePerm))
+	f, err := s.GFS.Create(".git/info/attributes")
+	s.NoError(err)
+	_, err = f.Write([]byte("[attr]vendored foo=baz\nvendor/** vendored\n"))
+	s.NoError(err)
+	s.NoError(f.Close())
+
+	ps, err := ReadPatterns(s.GFS, nil)
+	s.NoError(err)
+	s.Len(ps, 4)
+
+	// .git/info/attributes overrides the attributes of the .gitattributes
+	// files.
+	m := NewMatcher(ps)
+	results, _ := m.Match([]string{"vendor", "github.com", "file"}, nil)
+	s.Equal("baz", results["foo"].Value())
+	s.True(results["vendored"].IsSet())
 }
 
 func (s *MatcherSuite) TestDir_LoadGlobalPatterns() {
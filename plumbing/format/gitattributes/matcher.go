@@ -1,5 +1,7 @@
 package gitattributes
 
+import "slices"
+
 // Matcher defines a global multi-pattern matcher for gitattributes patterns
 type Matcher interface {
 	// Match matches patterns in the order of priorities.
@@ -24,10 +26,20 @@ type matcher struct {
 	macros map[string]MatchAttribute
 }
 
+// builtinMacros are the macros defined by git, which can be redefined.
+var builtinMacros = []MatchAttribute{{
+	Name: "binary",
+	Attributes: []Attribute{
+		attribute{name: "diff", state: attributeUnset},
+		attribute{name: "merge", state: attributeUnset},
+		attribute{name: "text", state: attributeUnset},
+	},
+}}
+
 func (m *matcher) init() {
 	m.macros = make(map[string]MatchAttribute)
 
-	for _, attr := range m.stack {
+	for _, attr := range append(builtinMacros, m.stack...) {
 		if attr.Pattern == nil {
 			m.macros[attr.Name] = attr
 		}
@@ -41,13 +53,18 @@ func (m *matcher) init() {
 //
 // Matched is true if any path was matched to a rule, even if the results map
 // is empty.
+//
+// As git does, each attribute is given by the line of highest priority
+// setting it, and by its last occurrence in the line. The macros set are
+// expanded where they are, the attributes they set being overridden by the
+// ones following them in the line, and macros can refer to other macros.
 func (m *matcher) Match(path, attributes []string) (results map[string]Attribute, matched bool) {
-	results = make(map[string]Attribute, len(attributes))
+	known := make(map[string]Attribute)
 
 	n := len(m.stack)
 	for i := n - 1; i >= 0; i-- {
-		if len(attributes) > 0 && len(attributes) == len(results) {
-			return results, matched
+		if len(attributes) > 0 && allKnown(known, attributes) {
+			break
 		}
 
 		pattern := m.stack[i].Pattern
@@ -57,22 +74,42 @@ func (m *matcher) Match(path, attributes []string) (results map[string]Attribute
 
 		if match := pattern.Match(path); match {
 			matched = true
-			for _, attr := range m.stack[i].Attributes {
-				if attr.IsSet() {
-					m.expandMacro(attr.Name(), results)
-				}
-				results[attr.Name()] = attr
-			}
+			m.fill(known, m.stack[i].Attributes)
 		}
 	}
+
+	results = make(map[string]Attribute, len(attributes))
+	for name, attr := range known {
+		if len(attributes) == 0 || slices.Contains(attributes, name) {
+			results[name] = attr
+		}
+	}
+
 	return results, matched
 }
 
-func (m *matcher) expandMacro(name string, results map[string]Attribute) bool {
-	if macro, ok := m.macros[name]; ok {
-		for _, attr := range macro.Attributes {
-			results[attr.Name()] = attr
+// fill adds the attributes which are not known yet to known, from the last
+// one, expanding the macros set.
+func (m *matcher) fill(known map[string]Attribute, attrs []Attribute) {
+	for i := len(attrs) - 1; i >= 0; i-- {
+		attr := attrs[i]
+		if _, ok := known[attr.Name()]; ok {
+			continue
+		}
+
+		known[attr.Name()] = attr
+		if macro, ok := m.macros[attr.Name()]; ok && attr.IsSet() {
+			m.fill(known, macro.Attributes)
+		}
+	}
+}
+
+func allKnown(known map[string]Attribute, attributes []string) bool {
+	for _, name := range attributes {
+		if _, ok := known[name]; !ok {
+			return false
 		}
 	}
-	return false
+
+	return true
 }
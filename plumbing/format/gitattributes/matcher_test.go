@@ -25,3 +25,97 @@ func (s *MatcherSuite) TestMatcher_Match() {
 	s.True(results["text"].IsSet())
 	s.Equal("crlf", results["eol"].Value())
 }
+
+func (s *MatcherSuite) TestMatcher_MatchPriority() {
+	lines := []string{
+		"*.txt text eol=crlf diff",
+		"a.txt -text",
+		"b.txt binary",
+	}
+
+	ma, err := ReadAttributes(strings.NewReader(strings.Join(lines, "\n")), nil, true)
+	s.NoError(err)
+	macro, err := ParseAttributesLine("[attr]binary -diff -text", nil, true)
+	s.NoError(err)
+	ma = append([]MatchAttribute{macro}, ma...)
+
+	m := NewMatcher(ma)
+	results, matched := m.Match([]string{"a.txt"}, []string{"text", "eol"})
+	s.True(matched)
+	s.Len(results, 2)
+	s.True(results["text"].IsUnset())
+	s.Equal("crlf", results["eol"].Value())
+
+	results, _ = m.Match([]string{"b.txt"}, []string{"text", "diff"})
+	s.True(results["text"].IsUnset())
+	s.True(results["diff"].IsUnset())
+
+	results, _ = m.Match([]string{"c.txt"}, []string{"text"})
+	s.Len(results, 1)
+	s.True(results["text"].IsSet())
+}
+
+func (s *MatcherSuite) TestMatcher_MatchMacros() {
+	root, err := ReadAttributes(strings.NewReader(strings.Join([]string{
+		"[attr]lfs filter=lfs -text binary",
+		"*.bin binary",
+		"*.dat binary",
+		"*.lfs lfs",
+	}, "\n")), nil, true)
+	s.NoError(err)
+
+	sub, err := ReadAttributes(strings.NewReader(strings.Join([]string{
+		"*.bin diff",
+		"*.dat -binary",
+		"*.lfs text",
+	}, "\n")), []string{"sub"}, false)
+	s.NoError(err)
+
+	info, err := ReadAttributes(strings.NewReader("*.bin text\n"), nil, true)
+	s.NoError(err)
+
+	m := NewMatcher(append(append(root, sub...), info...))
+	assertAttributes := func(path string, expected ...string) {
+		results, matched := m.Match(strings.Split(path, "/"), nil)
+		s.True(matched, path)
+
+		var attrs []string
+		for _, attr := range results {
+			attrs = append(attrs, attr.String())
+		}
+
+		s.ElementsMatch(expected, attrs, path)
+	}
+
+	// binary is built in, and expanded without being defined.
+	assertAttributes("a.dat", "binary: set", "diff: unset", "merge: unset", "text: unset")
+
+	// The attributes set by a macro are overridden in a deeper file, and
+	// by .git/info/attributes.
+	assertAttributes("sub/a.bin", "binary: set", "diff: set", "merge: unset", "text: set")
+
+	// A macro which is unset in a deeper file is not expanded.
+	assertAttributes("sub/a.dat", "binary: unset")
+
+	// Macros are expanded inside macros.
+	assertAttributes("a.lfs", "lfs: set", "filter: lfs", "binary: set", "diff: unset", "merge: unset", "text: unset")
+	assertAttributes("sub/a.lfs", "lfs: set", "filter: lfs", "binary: set", "diff: unset", "merge: unset", "text: set")
+
+	results, _ := m.Match([]string{"sub", "a.bin"}, []string{"diff", "text"})
+	s.Len(results, 2)
+	s.True(results["diff"].IsSet())
+	s.True(results["text"].IsSet())
+}
+
+func (s *MatcherSuite) TestMatcher_MatchRedefinedMacro() {
+	ma, err := ReadAttributes(strings.NewReader(strings.Join([]string{
+		"[attr]binary -diff",
+		"*.bin binary",
+	}, "\n")), nil, true)
+	s.NoError(err)
+
+	results, _ := NewMatcher(ma).Match([]string{"a.bin"}, nil)
+	s.Len(results, 2)
+	s.True(results["binary"].IsSet())
+	s.True(results["diff"].IsUnset())
+}
@@ -6,6 +6,7 @@ import (
 	"io"
 	gofs "io/fs"
 	"os"
+	"path/filepath"
 	"strings"
 
 	"github.com/go-git/go-billy/v6"
@@ -24,6 +25,8 @@ const (
 	gitconfigFile   = ".gitconfig"
 	systemFile      = "/etc/gitconfig"
 	infoExcludeFile = gitDir + "/info/exclude"
+	repoConfigFile  = gitDir + "/config"
+	xdgIgnoreFile   = "git/ignore"
 )
 
 // readIgnoreFile reads a specific git ignore file.
@@ -84,36 +87,112 @@ func ReadPatterns(fs billy.Filesystem, path []string) (ps []Pattern, err error)
 	return ps, err
 }
 
-func loadPatterns(fs billy.Filesystem, path string) (ps []Pattern, err error) {
+// LoadMatcher returns a Matcher of the paths of the worktree at fs which are
+// ignored, as git reads them: with the patterns of the file given by
+// core.excludesFile, then the ones of .git/info/exclude, then the ones of the
+// .gitignore files of the worktree, the deepest ones last. Any of them can be
+// missing, so fs needs not be a git repository.
+//
+// core.excludesFile is read from the .git/config of fs, then from the
+// ~/.gitconfig and /etc/gitconfig of root, and defaults to
+// $XDG_CONFIG_HOME/git/ignore. The file is read from root, unless it is a
+// relative path given by .git/config, which is read from fs. If root is nil,
+// only the .git/config of fs is read.
+//
+// The function assumes root is rooted at the root filesystem.
+func LoadMatcher(fs, root billy.Filesystem) (Matcher, error) {
+	ps, err := loadExcludesFile(fs, root)
+	if err != nil {
+		return nil, err
+	}
+
+	wps, err := ReadPatterns(fs, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	return NewMatcher(append(ps, wps...)), nil
+}
+
+// loadExcludesFile reads the patterns of the file given by core.excludesFile,
+// in the order of precedence of the configurations.
+func loadExcludesFile(fs, root billy.Filesystem) ([]Pattern, error) {
+	efo, err := readExcludesFile(fs, repoConfigFile)
+	if err != nil {
+		return nil, err
+	}
+
+	if efo != "" {
+		if p, _ := path_util.ReplaceTildeWithHome(efo); root == nil || !filepath.IsAbs(p) {
+			return readExcludesPatterns(fs, efo)
+		}
+	}
+
+	if root == nil {
+		return nil, nil
+	}
+
+	if efo == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return nil, err
+		}
+
+		for _, path := range []string{root.Join(home, gitconfigFile), systemFile} {
+			if efo, err = readExcludesFile(root, path); err != nil {
+				return nil, err
+			}
+
+			if efo != "" {
+				break
+			}
+		}
+
+		if efo == "" {
+			xdg := os.Getenv("XDG_CONFIG_HOME")
+			if xdg == "" {
+				xdg = root.Join(home, ".config")
+			}
+
+			efo = root.Join(xdg, xdgIgnoreFile)
+		}
+	}
+
+	return readExcludesPatterns(root, efo)
+}
+
+// readExcludesFile returns the core.excludesFile of the git config file at
+// path, or an empty string if it is not set or the file doesn't exist.
+func readExcludesFile(fs billy.Filesystem, path string) (efo string, err error) {
 	f, err := fs.Open(path)
 	if err != nil {
 		if os.IsNotExist(err) {
-			return nil, nil
+			return "", nil
 		}
-		return nil, err
+		return "", err
 	}
 
 	defer gioutil.CheckClose(f, &err)
 
 	b, err := io.ReadAll(f)
 	if err != nil {
-		return ps, err
+		return "", err
 	}
 
 	d := config.NewDecoder(bytes.NewBuffer(b))
 
 	raw := config.New()
 	if err = d.Decode(raw); err != nil {
-		return ps, err
+		return "", err
 	}
 
 	s := raw.Section(coreSection)
-	efo := s.Options.Get(excludesfile)
-	if efo == "" {
-		return nil, nil
-	}
+	return s.Options.Get(excludesfile), nil
+}
 
-	ps, err = readIgnoreFile(fs, nil, efo)
+// readExcludesPatterns reads the patterns of an excludes file, if it exists.
+func readExcludesPatterns(fs billy.Filesystem, efo string) ([]Pattern, error) {
+	ps, err := readIgnoreFile(fs, nil, efo)
 	if os.IsNotExist(err) {
 		return nil, nil
 	}
@@ -121,6 +200,15 @@ func loadPatterns(fs billy.Filesystem, path string) (ps []Pattern, err error) {
 	return ps, err
 }
 
+func loadPatterns(fs billy.Filesystem, path string) (ps []Pattern, err error) {
+	efo, err := readExcludesFile(fs, path)
+	if err != nil || efo == "" {
+		return nil, err
+	}
+
+	return readExcludesPatterns(fs, efo)
+}
+
 // LoadGlobalPatterns loads gitignore patterns from the gitignore file
 // declared in a user's ~/.gitconfig file.  If the ~/.gitconfig file does not
 // exist the function will return nil.  If the core.excludesfile property
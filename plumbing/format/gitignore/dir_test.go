@@ -356,3 +356,58 @@ func (s *MatcherSuite) TestDir_LoadSystemPatterns() {
 	s.True(m.Match([]string{"go-git.v4.iml"}, true))
 	s.True(m.Match([]string{".idea"}, true))
 }
+
+func (s *MatcherSuite) TestDir_LoadMatcher() {
+	m, err := LoadMatcher(s.GFS, s.RFS)
+	s.NoError(err)
+
+	s.True(m.Match([]string{"exclude.crlf"}, true))
+	s.True(m.Match([]string{"vendor", "gopkg.in"}, true))
+	s.False(m.Match([]string{"vendor", "github.com"}, true))
+	s.True(m.Match([]string{"go-git.v4.iml"}, false))
+	s.True(m.Match([]string{"vendor", ".idea"}, true))
+	s.False(m.Match([]string{"another"}, true))
+
+	// Without a root, only the worktree is read.
+	m, err = LoadMatcher(s.GFS, nil)
+	s.NoError(err)
+	s.True(m.Match([]string{"exclude.crlf"}, true))
+	s.False(m.Match([]string{"go-git.v4.iml"}, false))
+}
+
+func (s *MatcherSuite) TestDir_LoadMatcherRepositoryExcludesFile() {
+	f, err := s.GFS.Create(".git/config")
+	s.NoError(err)
+	_, err = f.Write([]byte("[core]\n\texcludesfile = .git/excludes\n"))
+	s.NoError(err)
+	s.NoError(f.Close())
+
+	f, err = s.GFS.Create(".git/excludes")
+	s.NoError(err)
+	_, err = f.Write([]byte("*.tmp\n!ignore_dir\n"))
+	s.NoError(err)
+	s.NoError(f.Close())
+
+	// The excludes file of the repository takes precedence over the global
+	// one, and the patterns of the worktree over it.
+	m, err := LoadMatcher(s.GFS, s.RFS)
+	s.NoError(err)
+	s.True(m.Match([]string{"another", "file.tmp"}, false))
+	s.False(m.Match([]string{"go-git.v4.iml"}, false))
+	s.True(m.Match([]string{"ignore_dir"}, true))
+}
+
+func (s *MatcherSuite) TestDir_LoadMatcherDefaultExcludesFile() {
+	s.T().Setenv("XDG_CONFIG_HOME", "/xdg")
+	s.NoError(s.MEFS.MkdirAll("/xdg/git", os.ModePerm))
+	f, err := s.MEFS.Create("/xdg/git/ignore")
+	s.NoError(err)
+	_, err = f.Write([]byte("*.swp\n"))
+	s.NoError(err)
+	s.NoError(f.Close())
+
+	m, err := LoadMatcher(s.GFS, s.MEFS)
+	s.NoError(err)
+	s.True(m.Match([]string{"vendor", "file.swp"}, false))
+	s.False(m.Match([]string{"go-git.v4.iml"}, false))
+}
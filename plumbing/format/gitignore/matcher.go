@@ -11,6 +11,10 @@ type Matcher interface {
 // increasing priority. That is most generic settings files first, then the content of
 // the repo .gitignore, then content of .gitignore down the path or the repo and then
 // the content command line arguments.
+//
+// As git does, the parent directories of the path are matched first, and the path
+// is excluded if one of them is, as the files of an excluded directory can't be
+// included again.
 func NewMatcher(ps []Pattern) Matcher {
 	return &matcher{ps}
 }
@@ -20,11 +24,30 @@ type matcher struct {
 }
 
 func (m *matcher) Match(path []string, isDir bool) bool {
+	for i := 1; i < len(path); i++ {
+		if m.match(path[:i], true) == Exclude {
+			return true
+		}
+	}
+
+	return m.match(path, isDir) == Exclude
+}
+
+// match returns the result of the pattern with the highest priority matching
+// the path itself, rather than one of its parent directories.
+func (m *matcher) match(path []string, isDir bool) MatchResult {
 	n := len(m.patterns)
 	for i := n - 1; i >= 0; i-- {
-		if match := m.patterns[i].Match(path, isDir); match > NoMatch {
-			return match == Exclude
+		var match MatchResult
+		if p, ok := m.patterns[i].(*pattern); ok {
+			match = p.matchPath(path, isDir)
+		} else {
+			match = m.patterns[i].Match(path, isDir)
+		}
+
+		if match > NoMatch {
+			return match
 		}
 	}
-	return false
+	return NoMatch
 }
@@ -41,3 +41,67 @@ func (s *MatcherSuite) TestMatcher_EverythingExceptExample() {
 	s.True(m.Match([]string{"foo", "baz"}, false))
 	s.True(m.Match([]string{"foo", "baz"}, true))
 }
+
+func (s *MatcherSuite) TestMatcher_Negation() {
+	ps := []Pattern{
+		ParsePattern("*.log", nil),
+		ParsePattern("!important.log", nil),
+		ParsePattern("build/", nil),
+		ParsePattern("!build/keep.txt", nil),
+		ParsePattern("/tmp", nil),
+		ParsePattern("cache/", nil),
+		ParsePattern("!cache/", []string{"sub"}),
+		ParsePattern("docs/**/*.pdf", nil),
+		ParsePattern("!docs/**/manual.pdf", nil),
+		ParsePattern("docs/private/manual.pdf", nil),
+	}
+
+	m := NewMatcher(ps)
+	s.True(m.Match([]string{"debug.log"}, false))
+	s.True(m.Match([]string{"sub", "debug.log"}, false))
+	s.False(m.Match([]string{"important.log"}, false))
+	s.False(m.Match([]string{"sub", "important.log"}, false))
+
+	// The files of an excluded directory can't be included again.
+	s.True(m.Match([]string{"build"}, true))
+	s.False(m.Match([]string{"build"}, false))
+	s.True(m.Match([]string{"build", "keep.txt"}, false))
+	s.True(m.Match([]string{"sub", "build", "keep.txt"}, false))
+
+	// Anchored patterns only match at the root of their domain.
+	s.True(m.Match([]string{"tmp", "file"}, false))
+	s.False(m.Match([]string{"sub", "tmp", "file"}, false))
+
+	// The patterns of the deepest directories take precedence.
+	s.True(m.Match([]string{"cache", "file"}, false))
+	s.False(m.Match([]string{"sub", "cache", "file"}, false))
+	s.True(m.Match([]string{"other", "cache", "file"}, false))
+
+	s.True(m.Match([]string{"docs", "a.pdf"}, false))
+	s.True(m.Match([]string{"docs", "a", "b", "a.pdf"}, false))
+	s.False(m.Match([]string{"docs", "manual.pdf"}, false))
+	s.False(m.Match([]string{"docs", "public", "manual.pdf"}, false))
+	s.True(m.Match([]string{"docs", "private", "manual.pdf"}, false))
+	s.False(m.Match([]string{"other", "docs", "a.pdf"}, false))
+}
+
+func (s *MatcherSuite) TestMatcher_NegatedDirectory() {
+	ps := []Pattern{
+		ParsePattern("foo/bar/", nil),
+		ParsePattern("!foo/", nil),
+		ParsePattern("logs/**", nil),
+		ParsePattern("!logs/keep/", nil),
+	}
+
+	// A negation of a directory doesn't apply to its files and directories.
+	m := NewMatcher(ps)
+	s.False(m.Match([]string{"foo"}, true))
+	s.True(m.Match([]string{"foo", "bar"}, true))
+	s.True(m.Match([]string{"foo", "bar", "file"}, false))
+	s.False(m.Match([]string{"foo", "baz", "file"}, false))
+
+	s.False(m.Match([]string{"logs"}, true))
+	s.True(m.Match([]string{"logs", "file"}, false))
+	s.False(m.Match([]string{"logs", "keep"}, true))
+	s.True(m.Match([]string{"logs", "keep", "file"}, false))
+}
@@ -66,16 +66,11 @@ func ParsePattern(p string, domain []string) Pattern {
 }
 
 func (p *pattern) Match(path []string, isDir bool) MatchResult {
-	if len(path) <= len(p.domain) {
+	path, ok := p.relative(path)
+	if !ok {
 		return NoMatch
 	}
-	for i, e := range p.domain {
-		if path[i] != e {
-			return NoMatch
-		}
-	}
 
-	path = path[len(p.domain):]
 	if p.isGlob && !p.globMatch(path, isDir) {
 		return NoMatch
 	} else if !p.isGlob && !p.simpleNameMatch(path, isDir) {
@@ -89,6 +84,83 @@ func (p *pattern) Match(path []string, isDir bool) MatchResult {
 	}
 }
 
+// matchPath matches the given path itself to the pattern, while Match also
+// matches the paths under the directories matching it.
+func (p *pattern) matchPath(path []string, isDir bool) MatchResult {
+	path, ok := p.relative(path)
+	if !ok || (p.dirOnly && !isDir) {
+		return NoMatch
+	}
+
+	if p.isGlob {
+		names := p.pattern
+		if names[0] == "" {
+			names = names[1:]
+		}
+
+		ok = matchNames(names, path)
+	} else {
+		ok, _ = filepath.Match(p.pattern[0], path[len(path)-1])
+	}
+
+	switch {
+	case !ok:
+		return NoMatch
+	case p.inclusion:
+		return Include
+	default:
+		return Exclude
+	}
+}
+
+// relative returns the path relative to the domain of the pattern, and false
+// if it is not in the domain.
+func (p *pattern) relative(path []string) ([]string, bool) {
+	if len(path) <= len(p.domain) {
+		return nil, false
+	}
+	for i, e := range p.domain {
+		if path[i] != e {
+			return nil, false
+		}
+	}
+
+	return path[len(p.domain):], true
+}
+
+// matchNames returns whether all the names of path match the ones of the
+// pattern, where "**" matches zero or more directories, or everything inside
+// if it is the last component.
+func matchNames(pattern, path []string) bool {
+	if len(pattern) == 0 {
+		return len(path) == 0
+	}
+
+	if pattern[0] == zeroToManyDirs {
+		if len(pattern) == 1 {
+			return len(path) > 0
+		}
+
+		for i := range path {
+			if matchNames(pattern[1:], path[i:]) {
+				return true
+			}
+		}
+
+		return false
+	}
+
+	if len(path) == 0 {
+		return false
+	}
+
+	if match, err := filepath.Match(pattern[0], path[0]); err != nil || !match {
+		return false
+	}
+
+	return matchNames(pattern[1:], path[1:])
+}
+
 func (p *pattern) simpleNameMatch(path []string, isDir bool) bool {
 	for i, name := range path {
 		if match, err := filepath.Match(p.pattern[0], name); err != nil {
@@ -12,18 +12,24 @@ import (
 type Encoder struct {
 	io.Writer
 	hash hash.Hash
+	w    io.Writer
 }
 
 // NewEncoder returns a new stream encoder that writes to w.
 func NewEncoder(w io.Writer) *Encoder {
-	// TODO: Support passing an ObjectFormat (sha256)
 	h := hash.New(crypto.SHA1)
 	mw := io.MultiWriter(w, h)
-	return &Encoder{mw, h}
+	return &Encoder{mw, h, w}
 }
 
-// Encode encodes an MemoryIndex to the encoder writer.
+// Encode encodes an MemoryIndex to the encoder writer. The checksum of the
+// index is computed with the hash function of its object format.
 func (e *Encoder) Encode(idx *MemoryIndex) (int, error) {
+	if idx.idSize() == crypto.SHA256.Size() {
+		e.hash = hash.New(crypto.SHA256)
+		e.Writer = io.MultiWriter(e.w, e.hash)
+	}
+
 	flow := []func(*MemoryIndex) (int, error){
 		e.encodeHeader,
 		e.encodeFanout,
@@ -135,6 +141,7 @@ func (e *Encoder) encodeChecksums(idx *MemoryIndex) (int, error) {
 		return 0, err
 	}
 
+	idx.IdxChecksum.ResetBySize(e.hash.Size())
 	if _, err := idx.IdxChecksum.Write(e.hash.Sum(nil)[:e.hash.Size()]); err != nil {
 		return 0, err
 	}
@@ -132,6 +132,25 @@ func (s *IndexSuite) TestEntriesByOffset() {
 	}
 }
 
+func (s *IndexSuite) TestEntriesHashesAreComparable() {
+	idx, err := fixtureIndex()
+	s.NoError(err)
+
+	want := make(map[plumbing.Hash]bool, len(fixtureHashes))
+	for _, h := range fixtureHashes {
+		want[h] = true
+	}
+
+	entries, err := idx.Entries()
+	s.NoError(err)
+
+	for range fixtureHashes {
+		e, err := entries.Next()
+		s.NoError(err)
+		s.True(want[e.Hash], e.Hash.String())
+	}
+}
+
 var fixtureHashes = []plumbing.Hash{
 	plumbing.NewHash("303953e5aa461c203a324821bc1717f9b4fff895"),
 	plumbing.NewHash("5296768e3d9f661387ccbff18c4dea6c997fd78c"),
@@ -8,6 +8,7 @@ import (
 	"sync"
 
 	"github.com/go-git/go-git/v6/plumbing"
+	format "github.com/go-git/go-git/v6/plumbing/format/config"
 	"github.com/go-git/go-git/v6/utils/binary"
 )
 
@@ -94,8 +95,11 @@ func (w *Writer) createIndex() (*MemoryIndex, error) {
 		return nil, fmt.Errorf("the index still hasn't finished building")
 	}
 
+	// The index is created again once the objects appended by
+	// packfile.FixThinPack are added, its large offsets with it.
 	idx := new(MemoryIndex)
 	w.index = idx
+	w.offset64 = 0
 
 	sort.Sort(w.objects)
 
@@ -161,6 +165,10 @@ func (w *Writer) createIndex() (*MemoryIndex, error) {
 
 	idx.Version = VersionSupported
 	idx.PackfileChecksum = w.checksum
+	// The hashes are the ones of the object format of the packfile.
+	if w.checksum.Size() == format.SHA256Size {
+		idx.objectIDSize = format.SHA256Size
+	}
 
 	return idx, nil
 }
@@ -77,6 +77,19 @@ func (s *WriterSuite) TestWriterLarge() {
 	s.Len(expected, n)
 
 	s.Equal(expected, buf.Bytes())
+
+	// The index created again, as after packfile.FixThinPack, keeps its
+	// large offsets.
+	err = writer.OnFooter(fixture4GbChecksum)
+	s.NoError(err)
+
+	idx, err = writer.Index()
+	s.NoError(err)
+
+	buf.Reset()
+	_, err = idxfile.NewEncoder(buf).Encode(idx)
+	s.NoError(err)
+	s.Equal(expected, buf.Bytes())
 }
 
 var (
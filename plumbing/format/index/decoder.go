@@ -6,9 +6,11 @@ import (
 	"errors"
 	"io"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/go-git/go-git/v6/plumbing"
+	"github.com/go-git/go-git/v6/plumbing/format/packfile/bitmap"
 	"github.com/go-git/go-git/v6/plumbing/hash"
 	"github.com/go-git/go-git/v6/utils/binary"
 )
@@ -23,6 +25,12 @@ var (
 	// ErrInvalidChecksum is returned by Decode if the SHA1/SHA256 hash mismatch with
 	// the read content.
 	ErrInvalidChecksum = errors.New("index decoder: invalid checksum")
+	// ErrMalformedEntryName is returned by Decode when the prefix-compressed
+	// name of an entry of a version 4 index is malformed.
+	ErrMalformedEntryName = errors.New("index decoder: malformed entry name")
+	// ErrMalformedUntrackedCache is returned by Decode when the untracked
+	// cache extension is malformed.
+	ErrMalformedUntrackedCache = errors.New("index decoder: malformed untracked cache")
 	// ErrUnknownExtension is returned when an index extension is encountered that is considered mandatory.
 	ErrUnknownExtension = errors.New("index decoder: unknown extension")
 )
@@ -72,6 +80,8 @@ func (d *Decoder) Decode(idx *Index) error {
 		return err
 	}
 
+	d.lastEntry = nil
+
 	if err := d.readEntries(idx, int(entryCount)); err != nil {
 		return err
 	}
@@ -183,9 +193,15 @@ func (d *Decoder) doReadEntryNameV4() (string, error) {
 
 	var base string
 	if d.lastEntry != nil {
-		base = d.lastEntry.Name[:len(d.lastEntry.Name)-int(l)]
+		base = d.lastEntry.Name
+	}
+
+	if l < 0 || l > int64(len(base)) {
+		return "", ErrMalformedEntryName
 	}
 
+	base = base[:len(base)-int(l)]
+
 	name, err := binary.ReadUntil(d.r, '\x00')
 	if err != nil {
 		return "", err
@@ -215,8 +231,8 @@ func (d *Decoder) padEntry(idx *Index, e *Entry, read int) error {
 }
 
 func (d *Decoder) readExtensions(idx *Index) error {
-	// TODO: support 'Split index' and 'Untracked cache' extensions, take in
-	// count that they are not supported by jgit or libgit
+	// TODO: support 'Split index' extension, take in count that it is not
+	// supported by jgit or libgit
 
 	var expected []byte
 	var peeked []byte
@@ -277,6 +293,12 @@ func (d *Decoder) readExtension(idx *Index) error {
 		if err := d.Decode(idx.EndOfIndexEntry); err != nil {
 			return err
 		}
+	case bytes.Equal(header[:], untrackedCacheExtSignature):
+		idx.UntrackedCache = &UntrackedCache{}
+		d := &untrackedCacheDecoder{r, d.hash}
+		if err := d.Decode(idx.UntrackedCache); err != nil {
+			return err
+		}
 	default:
 		// See https://git-scm.com/docs/index-format, which says:
 		// If the first byte is 'A'..'Z' the extension is optional and can be ignored.
@@ -496,6 +518,210 @@ func (d *endOfIndexEntryDecoder) Decode(e *EndOfIndexEntry) error {
 	return err
 }
 
+type untrackedCacheDecoder struct {
+	r *bufio.Reader
+	h hash.Hash
+}
+
+func (d *untrackedCacheDecoder) Decode(c *UntrackedCache) error {
+	data, err := io.ReadAll(d.r)
+	if err != nil {
+		return err
+	}
+
+	r := bytes.NewReader(data)
+	l, err := binary.ReadVariableWidthInt(r)
+	if err != nil {
+		return err
+	}
+
+	if l < 0 || l > int64(r.Len()) {
+		return ErrMalformedUntrackedCache
+	}
+
+	ident := make([]byte, l)
+	if _, err := io.ReadFull(r, ident); err != nil {
+		return err
+	}
+
+	if len(ident) > 0 {
+		c.Ident = strings.Split(strings.TrimSuffix(string(ident), "\x00"), "\x00")
+	}
+
+	if err := readUntrackedCacheStat(r, &c.InfoExcludeStat); err != nil {
+		return err
+	}
+
+	if err := readUntrackedCacheStat(r, &c.ExcludesFileStat); err != nil {
+		return err
+	}
+
+	if c.DirFlags, err = binary.ReadUint32(r); err != nil {
+		return err
+	}
+
+	if err := d.readHash(r, &c.InfoExcludeHash); err != nil {
+		return err
+	}
+
+	if err := d.readHash(r, &c.ExcludesFileHash); err != nil {
+		return err
+	}
+
+	perDir, err := binary.ReadUntil(r, '\x00')
+	if err != nil {
+		return err
+	}
+
+	c.ExcludePerDir = string(perDir)
+
+	count, err := binary.ReadVariableWidthInt(r)
+	if err != nil {
+		return err
+	}
+
+	if count == 0 {
+		return nil
+	}
+
+	var dirs []*UntrackedCacheDir
+	if c.Root, err = d.readDir(r, &dirs); err != nil {
+		return err
+	}
+
+	if int64(len(dirs)) != count {
+		return ErrMalformedUntrackedCache
+	}
+
+	return d.readDirsData(data[len(data)-r.Len():], dirs)
+}
+
+// readDir reads the block of a directory and the ones of its subdirectories,
+// appending them to dirs in depth-first order.
+func (d *untrackedCacheDecoder) readDir(r *bytes.Reader, dirs *[]*UntrackedCacheDir) (*UntrackedCacheDir, error) {
+	untracked, err := binary.ReadVariableWidthInt(r)
+	if err != nil {
+		return nil, err
+	}
+
+	subdirs, err := binary.ReadVariableWidthInt(r)
+	if err != nil {
+		return nil, err
+	}
+
+	name, err := binary.ReadUntil(r, '\x00')
+	if err != nil {
+		return nil, err
+	}
+
+	dir := &UntrackedCacheDir{Name: string(name)}
+	*dirs = append(*dirs, dir)
+
+	for ; untracked > 0; untracked-- {
+		name, err := binary.ReadUntil(r, '\x00')
+		if err != nil {
+			return nil, err
+		}
+
+		dir.Untracked = append(dir.Untracked, string(name))
+	}
+
+	for ; subdirs > 0; subdirs-- {
+		sub, err := d.readDir(r, dirs)
+		if err != nil {
+			return nil, err
+		}
+
+		dir.Dirs = append(dir.Dirs, sub)
+	}
+
+	return dir, nil
+}
+
+// readDirsData reads the bitmaps following the directory blocks, and the
+// stat data and exclude hashes of the directories.
+func (d *untrackedCacheDecoder) readDirsData(data []byte, dirs []*UntrackedCacheDir) error {
+	var bitmaps [3]*bitmap.Bitmap
+	for i := range bitmaps {
+		b, n, err := bitmap.ReadEWAH(data)
+		if err != nil {
+			return ErrMalformedUntrackedCache
+		}
+
+		bitmaps[i], data = b, data[n:]
+	}
+
+	valid, checkOnly, hashValid := bitmaps[0], bitmaps[1], bitmaps[2]
+	r := bytes.NewReader(data)
+
+	err := forEachUntrackedCacheDir(checkOnly, dirs, func(dir *UntrackedCacheDir) error {
+		dir.CheckOnly = true
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	err = forEachUntrackedCacheDir(valid, dirs, func(dir *UntrackedCacheDir) error {
+		dir.Valid = true
+		return readUntrackedCacheStat(r, &dir.Stat)
+	})
+	if err != nil {
+		return err
+	}
+
+	return forEachUntrackedCacheDir(hashValid, dirs, func(dir *UntrackedCacheDir) error {
+		return d.readHash(r, &dir.ExcludeHash)
+	})
+}
+
+func (d *untrackedCacheDecoder) readHash(r io.Reader, h *plumbing.Hash) error {
+	h.ResetBySize(d.h.Size())
+	_, err := h.ReadFrom(r)
+	return err
+}
+
+// forEachUntrackedCacheDir calls f for each directory whose position is in
+// b.
+func forEachUntrackedCacheDir(b *bitmap.Bitmap, dirs []*UntrackedCacheDir, f func(*UntrackedCacheDir) error) error {
+	var err error
+	b.ForEach(func(pos uint32) bool {
+		if int(pos) >= len(dirs) {
+			err = ErrMalformedUntrackedCache
+			return false
+		}
+
+		err = f(dirs[pos])
+		return err == nil
+	})
+
+	return err
+}
+
+func readUntrackedCacheStat(r io.Reader, s *UntrackedCacheStat) error {
+	var sec, nsec, msec, mnsec uint32
+	err := binary.Read(r,
+		&sec, &nsec,
+		&msec, &mnsec,
+		&s.Dev, &s.Inode,
+		&s.UID, &s.GID,
+		&s.Size,
+	)
+	if err != nil {
+		return err
+	}
+
+	if sec != 0 || nsec != 0 {
+		s.CreatedAt = time.Unix(int64(sec), int64(nsec))
+	}
+
+	if msec != 0 || mnsec != 0 {
+		s.ModifiedAt = time.Unix(int64(msec), int64(mnsec))
+	}
+
+	return nil
+}
+
 type unknownExtensionDecoder struct {
 	r *bufio.Reader
 }
@@ -322,6 +322,21 @@ func TestDecodeMergeConflict(t *testing.T) {
 	}
 }
 
+func TestDecodeV4MalformedEntryName(t *testing.T) {
+	idx := &Index{Version: 4, Entries: []*Entry{{Name: "foo"}, {Name: "foo/bar"}}}
+	buf := bytes.NewBuffer(nil)
+	require.NoError(t, NewEncoder(buf, crypto.SHA1.New()).Encode(idx))
+
+	// The second entry removes more than the name of the first one.
+	data := buf.Bytes()
+	offset := 12 + 2*(entryHeaderLength+crypto.SHA1.Size()) + len("foo") + 2
+	require.Equal(t, byte(0), data[offset])
+	data[offset] = 4
+
+	err := NewDecoder(bytes.NewReader(data), crypto.SHA1.New()).Decode(&Index{})
+	assert.ErrorIs(t, err, ErrMalformedEntryName)
+}
+
 func (s *IndexSuite) readSimpleIndex() *Index {
 	f, err := fixtures.Basic().One().DotGit().Open("index")
 	s.NoError(err)
@@ -5,11 +5,12 @@ import (
 	"errors"
 	"fmt"
 	"io"
-	"path"
+	"slices"
 	"sort"
-	"strings"
 	"time"
 
+	"github.com/go-git/go-git/v6/plumbing"
+	"github.com/go-git/go-git/v6/plumbing/format/packfile/bitmap"
 	"github.com/go-git/go-git/v6/plumbing/hash"
 	"github.com/go-git/go-git/v6/utils/binary"
 )
@@ -43,11 +44,13 @@ func (e *Encoder) Encode(idx *Index) error {
 }
 
 func (e *Encoder) encode(idx *Index, footer bool) error {
-	// TODO: support extensions
+	// TODO: support the other extensions
 	if idx.Version > EncodeVersionSupported {
 		return ErrUnsupportedVersion
 	}
 
+	e.lastEntry = nil
+
 	if err := e.encodeHeader(idx); err != nil {
 		return err
 	}
@@ -56,6 +59,10 @@ func (e *Encoder) encode(idx *Index, footer bool) error {
 		return err
 	}
 
+	if err := e.encodeExtensions(idx); err != nil {
+		return err
+	}
+
 	if footer {
 		return e.encodeFooter()
 	}
@@ -63,9 +70,18 @@ func (e *Encoder) encode(idx *Index, footer bool) error {
 }
 
 func (e *Encoder) encodeHeader(idx *Index) error {
+	// As git, a version 2 index is written as a version 3 one if any of
+	// its entries has extended flags, which version 2 doesn't support.
+	version := idx.Version
+	if version == 2 && slices.ContainsFunc(idx.Entries, func(e *Entry) bool {
+		return e.IntentToAdd || e.SkipWorktree
+	}) {
+		version = 3
+	}
+
 	return binary.Write(e.w,
 		indexSignature,
-		idx.Version,
+		version,
 		uint32(len(idx.Entries)),
 	)
 }
@@ -158,27 +174,185 @@ func (e *Encoder) encodeEntryName(entry *Entry) error {
 	return binary.Write(e.w, []byte(entry.Name))
 }
 
+// encodeEntryNameV4 writes the name of the entry prefix-compressed, as
+// git does: the longest common prefix with the name of the previous entry is
+// kept, and the rest of the name is written.
 func (e *Encoder) encodeEntryNameV4(entry *Entry) error {
-	name := entry.Name
-	l := 0
+	var last string
 	if e.lastEntry != nil {
-		dir := path.Dir(e.lastEntry.Name) + "/"
-		if strings.HasPrefix(entry.Name, dir) {
-			l = len(e.lastEntry.Name) - len(dir)
-			name = strings.TrimPrefix(entry.Name, dir)
-		} else {
-			l = len(e.lastEntry.Name)
-		}
+		last = e.lastEntry.Name
+	}
+
+	var common int
+	for common < len(last) && common < len(entry.Name) && last[common] == entry.Name[common] {
+		common++
 	}
 
 	e.lastEntry = entry
 
-	err := binary.WriteVariableWidthInt(e.w, int64(l))
+	err := binary.WriteVariableWidthInt(e.w, int64(len(last)-common))
+	if err != nil {
+		return err
+	}
+
+	return binary.Write(e.w, []byte(entry.Name[common:]+string('\x00')))
+}
+
+func (e *Encoder) encodeExtensions(idx *Index) error {
+	if idx.UntrackedCache == nil {
+		return nil
+	}
+
+	var buf bytes.Buffer
+	if err := e.encodeUntrackedCache(&buf, idx.UntrackedCache); err != nil {
+		return err
+	}
+
+	return e.encodeRawExtension(string(untrackedCacheExtSignature), buf.Bytes())
+}
+
+func (e *Encoder) encodeUntrackedCache(w *bytes.Buffer, c *UntrackedCache) error {
+	var ident string
+	for _, s := range c.Ident {
+		ident += s + "\x00"
+	}
+
+	if err := binary.WriteVariableWidthInt(w, int64(len(ident))); err != nil {
+		return err
+	}
+
+	w.WriteString(ident)
+	if err := e.encodeUntrackedCacheStat(w, &c.InfoExcludeStat); err != nil {
+		return err
+	}
+
+	if err := e.encodeUntrackedCacheStat(w, &c.ExcludesFileStat); err != nil {
+		return err
+	}
+
+	if err := binary.WriteUint32(w, c.DirFlags); err != nil {
+		return err
+	}
+
+	e.encodeUntrackedCacheHash(w, c.InfoExcludeHash)
+	e.encodeUntrackedCacheHash(w, c.ExcludesFileHash)
+	w.WriteString(c.ExcludePerDir + "\x00")
+
+	if c.Root == nil {
+		return binary.WriteVariableWidthInt(w, 0)
+	}
+
+	d := &untrackedCacheDirsEncoder{
+		valid:     bitmap.NewBitmap(),
+		checkOnly: bitmap.NewBitmap(),
+		hashValid: bitmap.NewBitmap(),
+	}
+
+	if err := e.encodeUntrackedCacheDir(d, c.Root); err != nil {
+		return err
+	}
+
+	if err := binary.WriteVariableWidthInt(w, int64(d.count)); err != nil {
+		return err
+	}
+
+	w.Write(d.dirs.Bytes())
+	for _, b := range []*bitmap.Bitmap{d.valid, d.checkOnly, d.hashValid} {
+		if err := bitmap.WriteEWAH(w, b); err != nil {
+			return err
+		}
+	}
+
+	w.Write(d.stats.Bytes())
+	w.Write(d.hashes.Bytes())
+
+	// git ends the extension with a NUL, as a safeguard for its string lists.
+	return w.WriteByte('\x00')
+}
+
+// untrackedCacheDirsEncoder holds the data of the directories of an
+// untracked cache being encoded, which are grouped by type.
+type untrackedCacheDirsEncoder struct {
+	count                       uint32
+	dirs, stats, hashes         bytes.Buffer
+	valid, checkOnly, hashValid *bitmap.Bitmap
+}
+
+// encodeUntrackedCacheDir encodes dir and its subdirectories in depth-first
+// order.
+func (e *Encoder) encodeUntrackedCacheDir(d *untrackedCacheDirsEncoder, dir *UntrackedCacheDir) error {
+	pos := d.count
+	d.count++
+
+	var untracked []string
+	if dir.Valid {
+		untracked = dir.Untracked
+		d.valid.Set(pos)
+		if err := e.encodeUntrackedCacheStat(&d.stats, &dir.Stat); err != nil {
+			return err
+		}
+
+		if dir.CheckOnly {
+			d.checkOnly.Set(pos)
+		}
+	}
+
+	if !dir.ExcludeHash.IsZero() {
+		d.hashValid.Set(pos)
+		e.encodeUntrackedCacheHash(&d.hashes, dir.ExcludeHash)
+	}
+
+	if err := binary.WriteVariableWidthInt(&d.dirs, int64(len(untracked))); err != nil {
+		return err
+	}
+
+	if err := binary.WriteVariableWidthInt(&d.dirs, int64(len(dir.Dirs))); err != nil {
+		return err
+	}
+
+	d.dirs.WriteString(dir.Name + "\x00")
+	for _, name := range untracked {
+		d.dirs.WriteString(name + "\x00")
+	}
+
+	for _, sub := range dir.Dirs {
+		if err := e.encodeUntrackedCacheDir(d, sub); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (e *Encoder) encodeUntrackedCacheStat(w io.Writer, s *UntrackedCacheStat) error {
+	sec, nsec, err := e.timeToUint32(&s.CreatedAt)
 	if err != nil {
 		return err
 	}
 
-	return binary.Write(e.w, []byte(name+string('\x00')))
+	msec, mnsec, err := e.timeToUint32(&s.ModifiedAt)
+	if err != nil {
+		return err
+	}
+
+	return binary.Write(w,
+		sec, nsec,
+		msec, mnsec,
+		s.Dev, s.Inode,
+		s.UID, s.GID,
+		s.Size,
+	)
+}
+
+// encodeUntrackedCacheHash writes h, as many zeros as the size of the hashes
+// of the index if it is zero.
+func (e *Encoder) encodeUntrackedCacheHash(w *bytes.Buffer, h plumbing.Hash) {
+	if h.IsZero() {
+		w.Write(make([]byte, e.hash.Size()))
+		return
+	}
+
+	w.Write(h.Bytes())
 }
 
 func (e *Encoder) encodeRawExtension(signature string, data []byte) error {
@@ -233,6 +407,12 @@ func (e *Encoder) encodeFooter() error {
 
 type byName []*Entry
 
-func (l byName) Len() int           { return len(l) }
-func (l byName) Swap(i, j int)      { l[i], l[j] = l[j], l[i] }
-func (l byName) Less(i, j int) bool { return l[i].Name < l[j].Name }
+func (l byName) Len() int      { return len(l) }
+func (l byName) Swap(i, j int) { l[i], l[j] = l[j], l[i] }
+func (l byName) Less(i, j int) bool {
+	if l[i].Name == l[j].Name {
+		return l[i].Stage < l[j].Stage
+	}
+
+	return l[i].Name < l[j].Name
+}
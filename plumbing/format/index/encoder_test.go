@@ -3,6 +3,7 @@ package index
 import (
 	"bytes"
 	"crypto"
+	"fmt"
 	"strings"
 	"testing"
 	"time"
@@ -57,6 +58,38 @@ func TestEncode(t *testing.T) {
 	assert.Equal(t, "foo", output.Entries[2].Name)
 }
 
+func TestEncodeStages(t *testing.T) {
+	t.Parallel()
+
+	h := plumbing.NewHash("e25b29c8946e0e192fae2edc1dabf7be71e8ecf3")
+	idx := &Index{
+		Version: 2,
+		Entries: []*Entry{
+			{Name: "foo", Hash: h, Stage: TheirMode},
+			{Name: "foo", Hash: h, Stage: AncestorMode},
+			{Name: "bar", Hash: h},
+			{Name: "foo", Hash: h, Stage: OurMode},
+		},
+	}
+
+	buf := bytes.NewBuffer(nil)
+	require.NoError(t, NewEncoder(buf, crypto.SHA1.New()).Encode(idx))
+
+	output := &Index{}
+	require.NoError(t, NewDecoder(buf, crypto.SHA1.New()).Decode(output))
+
+	// The entries of a path are sorted by stage, and the merged ones are
+	// decoded with the Merged stage, distinct from the one of the ancestor.
+	var stages []string
+	for _, e := range output.Entries {
+		stages = append(stages, e.Name+":"+string(rune('0'+e.Stage)))
+	}
+
+	assert.Equal(t, []string{"bar:0", "foo:1", "foo:2", "foo:3"}, stages)
+	assert.Equal(t, Merged, output.Entries[0].Stage)
+	assert.NotEqual(t, Merged, AncestorMode)
+}
+
 func TestEncodeV4(t *testing.T) {
 	idx := &Index{
 		Version: 4,
@@ -113,6 +146,36 @@ func TestEncodeV4(t *testing.T) {
 	assert.Equal(t, "foo", output.Entries[4].Name)
 }
 
+func TestEncodeV4PrefixCompression(t *testing.T) {
+	idx := &Index{Version: 4}
+	for _, name := range []string{"a/b/c", "a/b/d", "a/bc", "x"} {
+		idx.Entries = append(idx.Entries, &Entry{Name: name})
+	}
+
+	buf := bytes.NewBuffer(nil)
+	e := NewEncoder(buf, crypto.SHA1.New())
+	require.NoError(t, e.Encode(idx))
+
+	// As in git, the longest common prefix with the previous name is kept.
+	entrySize := entryHeaderLength + crypto.SHA1.Size()
+	data := buf.Bytes()[12:]
+	var names []string
+	for range idx.Entries {
+		data = data[entrySize:]
+		end := 1 + bytes.IndexByte(data[1:], 0)
+		names = append(names, fmt.Sprintf("%d:%s", data[0], data[1:end]))
+		data = data[end+1:]
+	}
+
+	assert.Equal(t, []string{"0:a/b/c", "1:d", "2:c", "4:x"}, names)
+
+	// The names are compressed from the first entry on each encoding.
+	l := buf.Len() - crypto.SHA1.Size()
+	require.NoError(t, e.Encode(idx))
+	encoded := buf.Bytes()
+	assert.Equal(t, encoded[:l], encoded[l+crypto.SHA1.Size():len(encoded)-crypto.SHA1.Size()])
+}
+
 func TestEncodeUnsupportedVersion(t *testing.T) {
 	idx := &Index{Version: 5}
 
@@ -161,3 +224,92 @@ func TestEncodeWithSkipWorktreeUnsupportedVersion(t *testing.T) {
 	assert.EqualExportedValues(t, idx, output)
 	assert.Equal(t, true, output.Entries[0].SkipWorktree)
 }
+
+func TestEncodeV2WithIntentToAdd(t *testing.T) {
+	idx := &Index{
+		Version: 2,
+		Entries: []*Entry{{Name: "foo", IntentToAdd: true}, {Name: "bar"}},
+	}
+
+	buf := bytes.NewBuffer(nil)
+	e := NewEncoder(buf, crypto.SHA1.New())
+	err := e.Encode(idx)
+	assert.NoError(t, err)
+
+	output := &Index{}
+	d := NewDecoder(buf, crypto.SHA1.New())
+	err = d.Decode(output)
+	assert.NoError(t, err)
+
+	assert.Equal(t, uint32(3), output.Version)
+	assert.Len(t, output.Entries, 2)
+	assert.False(t, output.Entries[0].IntentToAdd)
+	assert.True(t, output.Entries[1].IntentToAdd)
+}
+
+func TestEncodeUntrackedCache(t *testing.T) {
+	t.Parallel()
+
+	now := time.Unix(1700000000, 42)
+	idx := &Index{
+		Version: 2,
+		Entries: []*Entry{{Name: "a/tracked"}},
+		UntrackedCache: &UntrackedCache{
+			Ident:            []string{"Location /foo, system Linux"},
+			InfoExcludeStat:  UntrackedCacheStat{ModifiedAt: now, Size: 240},
+			DirFlags:         6,
+			InfoExcludeHash:  plumbing.NewHash("e25b29c8946e0e192fae2edc1dabf7be71e8ecf3"),
+			ExcludePerDir:    ".gitignore",
+			ExcludesFileHash: plumbing.ZeroHash,
+			Root: &UntrackedCacheDir{
+				Untracked: []string{"foo", "bar/"},
+				Valid:     true,
+				Stat:      UntrackedCacheStat{CreatedAt: now, ModifiedAt: now, Inode: 42},
+				Dirs: []*UntrackedCacheDir{{
+					Name:        "a",
+					Untracked:   []string{"b"},
+					Valid:       true,
+					CheckOnly:   true,
+					Stat:        UntrackedCacheStat{ModifiedAt: now, Dev: 1, UID: 2, GID: 3},
+					ExcludeHash: plumbing.NewHash("dfa8868a2b0f2dbf3c4dfc1e6bbd30e1d3e8b59a"),
+					Dirs:        []*UntrackedCacheDir{{Name: "c"}},
+				}, {
+					Name: "d",
+				}},
+			},
+		},
+	}
+
+	buf := bytes.NewBuffer(nil)
+	require.NoError(t, NewEncoder(buf, crypto.SHA1.New()).Encode(idx))
+
+	output := &Index{}
+	require.NoError(t, NewDecoder(buf, crypto.SHA1.New()).Decode(output))
+	assert.EqualExportedValues(t, idx.UntrackedCache, output.UntrackedCache)
+
+	// The untracked files of the invalid directories are not written.
+	idx.UntrackedCache.Invalidate("a/b")
+	assert.False(t, idx.UntrackedCache.Root.Dirs[0].Valid)
+
+	buf.Reset()
+	require.NoError(t, NewEncoder(buf, crypto.SHA1.New()).Encode(idx))
+	output = &Index{}
+	require.NoError(t, NewDecoder(buf, crypto.SHA1.New()).Decode(output))
+	a := output.UntrackedCache.Root.Dir("a")
+	require.NotNil(t, a)
+	assert.False(t, a.Valid)
+	assert.False(t, a.CheckOnly)
+	assert.Empty(t, a.Untracked)
+	assert.Equal(t, idx.UntrackedCache.Root.Dirs[0].ExcludeHash, a.ExcludeHash)
+	assert.True(t, output.UntrackedCache.Root.Valid)
+
+	// Without directories, the cache is still written.
+	idx.UntrackedCache.Root = nil
+	buf.Reset()
+	require.NoError(t, NewEncoder(buf, crypto.SHA1.New()).Encode(idx))
+	output = &Index{}
+	require.NoError(t, NewDecoder(buf, crypto.SHA1.New()).Decode(output))
+	require.NotNil(t, output.UntrackedCache)
+	assert.Nil(t, output.UntrackedCache.Root)
+	assert.Equal(t, ".gitignore", output.UntrackedCache.ExcludePerDir)
+}
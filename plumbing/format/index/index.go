@@ -23,6 +23,7 @@ var (
 	treeExtSignature            = []byte{'T', 'R', 'E', 'E'}
 	resolveUndoExtSignature     = []byte{'R', 'E', 'U', 'C'}
 	endOfIndexEntryExtSignature = []byte{'E', 'O', 'I', 'E'}
+	untrackedCacheExtSignature  = []byte{'U', 'N', 'T', 'R'}
 )
 
 // Stage during merge
@@ -30,7 +31,7 @@ type Stage int
 
 const (
 	// Merged is the default stage, fully merged
-	Merged Stage = 1
+	Merged Stage = 0
 	// AncestorMode is the base revision
 	AncestorMode Stage = 1
 	// OurMode is the first tree revision, ours
@@ -54,6 +55,21 @@ type Index struct {
 	ResolveUndo *ResolveUndo
 	// EndOfIndexEntry represents the 'End of Index Entry' extension
 	EndOfIndexEntry *EndOfIndexEntry
+	// UntrackedCache represents the 'Untracked cache' extension
+	UntrackedCache *UntrackedCache
+	// ModTime is the modification time of the index file it was read from
+	// or written to, if any. It is not encoded. The entries modified at or
+	// after it are racily clean: a change made to their files right after
+	// the index was written may not be reflected by their stat data.
+	ModTime time.Time
+}
+
+// IsRacilyClean returns whether the stat data of the given entry can't be
+// trusted to tell whether its file changed since it was recorded: it was
+// modified at or after the index, or the modification time of the index is
+// unknown.
+func (i *Index) IsRacilyClean(e *Entry) bool {
+	return i.ModTime.IsZero() || !e.ModifiedAt.Before(i.ModTime)
 }
 
 // Add creates a new Entry and returns it. The caller should first check that
@@ -64,6 +80,7 @@ func (i *Index) Add(path string) *Entry {
 	}
 
 	i.Entries = append(i.Entries, e)
+	i.UntrackedCache.Invalidate(e.Name)
 	return e
 }
 
@@ -85,6 +102,7 @@ func (i *Index) Remove(path string) (*Entry, error) {
 	for index, e := range i.Entries {
 		if e.Name == path {
 			i.Entries = append(i.Entries[:index], i.Entries[index+1:]...)
+			i.UntrackedCache.Invalidate(path)
 			return e, nil
 		}
 	}
@@ -213,6 +231,97 @@ type EndOfIndexEntry struct {
 	Hash plumbing.Hash
 }
 
+// UntrackedCache saves the untracked files of the directories of the
+// worktree, along with the data needed to check whether they are still
+// valid, so that the directories not modified since are not read again.
+type UntrackedCache struct {
+	// Ident describes the environments where the cache can be used, such as
+	// "Location /path/to/worktree, system Linux" for git.
+	Ident []string
+	// InfoExcludeStat is the stat data of $GIT_DIR/info/exclude.
+	InfoExcludeStat UntrackedCacheStat
+	// ExcludesFileStat is the stat data of core.excludesFile.
+	ExcludesFileStat UntrackedCacheStat
+	// DirFlags are the flags of the directory traversal the cache was
+	// computed with, the dir_flags of git.
+	DirFlags uint32
+	// InfoExcludeHash is the hash of $GIT_DIR/info/exclude, zero if the file
+	// does not exist.
+	InfoExcludeHash plumbing.Hash
+	// ExcludesFileHash is the hash of core.excludesFile, zero if the file
+	// does not exist.
+	ExcludesFileHash plumbing.Hash
+	// ExcludePerDir is the name of the per-directory exclude files, usually
+	// ".gitignore".
+	ExcludePerDir string
+	// Root is the root directory of the worktree, nil if nothing is cached.
+	Root *UntrackedCacheDir
+}
+
+// UntrackedCacheStat is the stat data of a file or a directory, as in the
+// index entries.
+type UntrackedCacheStat struct {
+	CreatedAt  time.Time
+	ModifiedAt time.Time
+	Dev, Inode uint32
+	UID, GID   uint32
+	Size       uint32
+}
+
+// UntrackedCacheDir is a directory of the untracked cache.
+type UntrackedCacheDir struct {
+	// Name is the name of the directory, relative to its parent directory,
+	// empty for the root directory.
+	Name string
+	// Untracked are the names of the untracked entries of the directory,
+	// ending with a slash for the directories.
+	Untracked []string
+	// Dirs are the cached subdirectories of the directory.
+	Dirs []*UntrackedCacheDir
+	// Valid is whether Untracked and Stat are valid.
+	Valid bool
+	// CheckOnly records the check-only bit of the directory traversal of git.
+	CheckOnly bool
+	// Stat is the stat data of the directory when Untracked was computed.
+	Stat UntrackedCacheStat
+	// ExcludeHash is the hash of the per-directory exclude file of the
+	// directory, zero if there is none.
+	ExcludeHash plumbing.Hash
+}
+
+// Dir returns the subdirectory with the given name, or nil.
+func (d *UntrackedCacheDir) Dir(name string) *UntrackedCacheDir {
+	for _, sub := range d.Dirs {
+		if sub.Name == name {
+			return sub
+		}
+	}
+
+	return nil
+}
+
+// Invalidate invalidates the cached directory holding the given path, as
+// done by git when an entry is added to or removed from the index: the
+// untracked files of a directory change without the directory being
+// modified. It is a no-op on a nil cache.
+func (c *UntrackedCache) Invalidate(path string) {
+	if c == nil || c.Root == nil {
+		return
+	}
+
+	d := c.Root
+	parts := strings.Split(filepath.ToSlash(path), "/")
+	for _, name := range parts[:len(parts)-1] {
+		if d = d.Dir(name); d == nil {
+			return
+		}
+	}
+
+	d.Valid = false
+	d.CheckOnly = false
+	d.Untracked = nil
+}
+
 // SkipUnless applies patterns in the form of A, A/B, A/B/C
 // to the index to prevent the files from being checked out
 func (i *Index) SkipUnless(patterns []string) {
@@ -2,7 +2,10 @@ package index
 
 import (
 	"path/filepath"
+	"testing"
+	"time"
 
+	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/suite"
 )
 
@@ -78,3 +81,40 @@ func (s *IndexSuite) TestIndexGlob() {
 	s.NoError(err)
 	s.Len(m, 1)
 }
+
+func (s *IndexSuite) TestIndexInvalidatesUntrackedCache() {
+	sub := &UntrackedCacheDir{Name: "foo", Valid: true, Untracked: []string{"qux"}}
+	root := &UntrackedCacheDir{Valid: true, Untracked: []string{"bar"}, Dirs: []*UntrackedCacheDir{sub}}
+	idx := &Index{UntrackedCache: &UntrackedCache{Root: root}}
+
+	idx.Add("foo/qux")
+	s.False(sub.Valid)
+	s.Nil(sub.Untracked)
+	s.True(root.Valid)
+
+	_, err := idx.Remove("bar")
+	s.NoError(err)
+	s.False(root.Valid)
+
+	// Paths in directories which are not cached are ignored.
+	idx.Add("baz/qux")
+
+	idx = &Index{}
+	idx.Add("foo")
+}
+
+func TestIndexIsRacilyClean(t *testing.T) {
+	t.Parallel()
+
+	now := time.Now()
+	e := &Entry{ModifiedAt: now}
+
+	idx := &Index{}
+	assert.True(t, idx.IsRacilyClean(e))
+
+	idx.ModTime = now
+	assert.True(t, idx.IsRacilyClean(e))
+
+	idx.ModTime = now.Add(time.Second)
+	assert.False(t, idx.IsRacilyClean(e))
+}
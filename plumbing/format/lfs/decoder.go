@@ -0,0 +1,82 @@
+package lfs
+
+import (
+	"bytes"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// A Decoder reads a pointer from an input stream.
+type Decoder struct {
+	r io.Reader
+}
+
+// NewDecoder returns a new decoder that reads from r.
+func NewDecoder(r io.Reader) *Decoder {
+	return &Decoder{r: r}
+}
+
+// Decode reads a pointer and stores it in the value pointed to by p. It
+// returns ErrInvalidPointer if the content is not a pointer, such as when it
+// is larger than MaxPointerSize.
+func (d *Decoder) Decode(p *Pointer) error {
+	content, err := io.ReadAll(io.LimitReader(d.r, MaxPointerSize+1))
+	if err != nil {
+		return err
+	}
+
+	if len(content) > MaxPointerSize {
+		return fmt.Errorf("%w: larger than %d bytes", ErrInvalidPointer, MaxPointerSize)
+	}
+
+	return decode(content, p)
+}
+
+func decode(content []byte, p *Pointer) error {
+	lines := strings.Split(strings.TrimSuffix(string(content), "\n"), "\n")
+	version, ok := strings.CutPrefix(lines[0], "version ")
+	if !ok || !bytes.HasSuffix(content, []byte("\n")) {
+		return fmt.Errorf("%w: missing version", ErrInvalidPointer)
+	}
+
+	if version != Version && !slices.Contains(legacyVersions, version) {
+		return fmt.Errorf("%w: unknown version %q", ErrInvalidPointer, version)
+	}
+
+	*p = Pointer{Size: -1}
+	var last string
+	for _, line := range lines[1:] {
+		key, value, ok := strings.Cut(line, " ")
+		if !ok || key <= last {
+			return fmt.Errorf("%w: malformed line %q", ErrInvalidPointer, line)
+		}
+
+		last = key
+		switch key {
+		case "oid":
+			oid, ok := strings.CutPrefix(value, oidType+":")
+			if _, err := hex.DecodeString(oid); !ok || err != nil || len(oid) != 64 {
+				return fmt.Errorf("%w: invalid oid %q", ErrInvalidPointer, value)
+			}
+
+			p.Oid = oid
+		case "size":
+			size, err := strconv.ParseInt(value, 10, 64)
+			if err != nil || size < 0 {
+				return fmt.Errorf("%w: invalid size %q", ErrInvalidPointer, value)
+			}
+
+			p.Size = size
+		}
+	}
+
+	if p.Oid == "" || p.Size < 0 {
+		return fmt.Errorf("%w: missing oid or size", ErrInvalidPointer)
+	}
+
+	return nil
+}
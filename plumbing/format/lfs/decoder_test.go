@@ -0,0 +1,45 @@
+package lfs
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const oid = "4d7a214614ab2935c943f9e0ff69d22eadbb8f32b1258daaa5e2ca24d17e2393"
+
+func TestDecode(t *testing.T) {
+	t.Parallel()
+
+	for _, content := range []string{
+		"version https://git-lfs.github.com/spec/v1\noid sha256:" + oid + "\nsize 12345\n",
+		"version https://git-lfs.github.com/spec/v1\next-0-foo sha256:" + oid + "\noid sha256:" + oid + "\nsize 12345\n",
+		"version https://hawser.github.com/spec/v1\noid sha256:" + oid + "\nsize 12345\n",
+	} {
+		var p Pointer
+		require.NoError(t, NewDecoder(strings.NewReader(content)).Decode(&p), content)
+		assert.Equal(t, Pointer{Oid: oid, Size: 12345}, p)
+	}
+}
+
+func TestDecodeInvalid(t *testing.T) {
+	t.Parallel()
+
+	for _, content := range []string{
+		"",
+		"content\n",
+		"version https://git-lfs.github.com/spec/v1\noid sha256:" + oid + "\nsize 12345",
+		"version https://git-lfs.github.com/spec/v2\noid sha256:" + oid + "\nsize 12345\n",
+		"version https://git-lfs.github.com/spec/v1\noid sha256:" + oid + "\n",
+		"version https://git-lfs.github.com/spec/v1\noid sha256:1234\nsize 12345\n",
+		"version https://git-lfs.github.com/spec/v1\noid md5:" + oid + "\nsize 12345\n",
+		"version https://git-lfs.github.com/spec/v1\noid sha256:" + oid + "\nsize -1\n",
+		"version https://git-lfs.github.com/spec/v1\nsize 12345\noid sha256:" + oid + "\n",
+		"version https://git-lfs.github.com/spec/v1\noid sha256:" + oid + "\nsize 12345\n" + strings.Repeat("x", MaxPointerSize),
+	} {
+		var p Pointer
+		assert.ErrorIs(t, NewDecoder(strings.NewReader(content)).Decode(&p), ErrInvalidPointer, content)
+	}
+}
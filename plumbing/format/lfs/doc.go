@@ -0,0 +1,18 @@
+// Package lfs implements encoding and decoding of Git LFS pointer files.
+//
+// Git LFS stores large files outside of the repository: the blobs stored in
+// the repository are pointers to the content of the files, converted from and
+// to the content by the lfs filter driver, on add and checkout.
+//
+//	Git LFS pointer format
+//
+//	pointer = version *key-value
+//	version = "version" SP "https://git-lfs.github.com/spec/v1" LF
+//	key-value = key SP value LF
+//
+// The keys are sorted after version, and the known ones are "oid", the
+// SHA-256 of the content as "sha256:" hex-digest, and "size", its size in
+// bytes. A pointer is at most 1024 bytes long.
+//
+// See https://github.com/git-lfs/git-lfs/blob/main/docs/spec.md
+package lfs
@@ -0,0 +1,22 @@
+package lfs
+
+import (
+	"fmt"
+	"io"
+)
+
+// An Encoder writes a pointer to an output stream.
+type Encoder struct {
+	w io.Writer
+}
+
+// NewEncoder returns a new encoder that writes to w.
+func NewEncoder(w io.Writer) *Encoder {
+	return &Encoder{w: w}
+}
+
+// Encode writes the given pointer.
+func (e *Encoder) Encode(p *Pointer) error {
+	_, err := fmt.Fprintf(e.w, "version %s\noid %s:%s\nsize %d\n", Version, oidType, p.Oid, p.Size)
+	return err
+}
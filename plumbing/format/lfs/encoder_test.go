@@ -0,0 +1,21 @@
+package lfs
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEncode(t *testing.T) {
+	t.Parallel()
+
+	var buf bytes.Buffer
+	require.NoError(t, NewEncoder(&buf).Encode(&Pointer{Oid: oid, Size: 12345}))
+	assert.Equal(t, "version https://git-lfs.github.com/spec/v1\noid sha256:"+oid+"\nsize 12345\n", buf.String())
+
+	var p Pointer
+	require.NoError(t, NewDecoder(&buf).Decode(&p))
+	assert.Equal(t, Pointer{Oid: oid, Size: 12345}, p)
+}
@@ -0,0 +1,32 @@
+package lfs
+
+import "errors"
+
+const (
+	// Version is the version of the pointer format.
+	Version = "https://git-lfs.github.com/spec/v1"
+	// MaxPointerSize is the maximum size of a pointer, larger files are not
+	// pointers.
+	MaxPointerSize = 1024
+
+	oidType = "sha256"
+)
+
+// legacyVersions are the versions of the pointer format used by the pre-1.0
+// releases of Git LFS, still decoded.
+var legacyVersions = []string{
+	"https://hawser.github.com/spec/v1",
+	"http://git-media.io/v/2",
+}
+
+// ErrInvalidPointer is returned when decoding content that is not a valid
+// pointer.
+var ErrInvalidPointer = errors.New("invalid lfs pointer")
+
+// Pointer is a pointer to the content of a file stored by Git LFS.
+type Pointer struct {
+	// Oid is the SHA-256 of the content, as a hex string.
+	Oid string
+	// Size is the size of the content in bytes.
+	Size int64
+}
@@ -0,0 +1,170 @@
+package midx
+
+import (
+	"bytes"
+	"crypto"
+	encbin "encoding/binary"
+	"fmt"
+	"io"
+
+	"github.com/go-git/go-git/v6/plumbing"
+	format "github.com/go-git/go-git/v6/plumbing/format/config"
+	"github.com/go-git/go-git/v6/plumbing/hash"
+)
+
+// Decoder reads and decodes multi-pack-index files from an input stream.
+type Decoder struct {
+	r io.Reader
+}
+
+// NewDecoder builds a new multi-pack-index decoder, that reads from r.
+func NewDecoder(r io.Reader) *Decoder {
+	return &Decoder{r: r}
+}
+
+// Decode reads from the stream and decodes the content into the
+// MultiPackIndex struct.
+func (d *Decoder) Decode(idx *MultiPackIndex) error {
+	data, err := io.ReadAll(d.r)
+	if err != nil {
+		return err
+	}
+
+	if len(data) < szHeader || !bytes.Equal(data[:4], midxSignature) {
+		return ErrMalformedMultiPackIndex
+	}
+	if data[4] != VersionSupported {
+		return ErrUnsupportedVersion
+	}
+
+	var h crypto.Hash
+	switch data[5] {
+	case 1:
+		idx.objectFormat = format.SHA1
+		h = crypto.SHA1
+	case 2:
+		idx.objectFormat = format.SHA256
+		h = crypto.SHA256
+	default:
+		return ErrUnsupportedHash
+	}
+
+	// Base multi-pack-index files (incremental MIDX chains) are not
+	// supported.
+	if data[7] != 0 {
+		return fmt.Errorf("%w: unsupported base multi-pack-index files", ErrMalformedMultiPackIndex)
+	}
+
+	sz := idx.objectFormat.Size()
+	if len(data) < szHeader+sz {
+		return ErrMalformedMultiPackIndex
+	}
+
+	body, trailer := data[:len(data)-sz], data[len(data)-sz:]
+	hh := hash.New(h)
+	hh.Write(body)
+	if !bytes.Equal(hh.Sum(nil), trailer) {
+		return fmt.Errorf("%w: checksum mismatch", ErrMalformedMultiPackIndex)
+	}
+	idx.Checksum, _ = plumbing.FromBytes(trailer)
+
+	chunks, err := readChunks(body, int(data[6]))
+	if err != nil {
+		return err
+	}
+
+	for _, id := range [][4]byte{chunkPackNames, chunkOIDFanout, chunkOIDLookup, chunkObjectOffset} {
+		if _, ok := chunks[id]; !ok {
+			return fmt.Errorf("%w: missing %s chunk", ErrMalformedMultiPackIndex, id[:])
+		}
+	}
+
+	packs := encbin.BigEndian.Uint32(data[8:])
+	if err := idx.readPackNames(chunks[chunkPackNames], int(packs)); err != nil {
+		return err
+	}
+	if err := idx.readFanout(chunks[chunkOIDFanout]); err != nil {
+		return err
+	}
+
+	count := idx.EntryCount()
+	idx.Names = chunks[chunkOIDLookup]
+	if len(idx.Names) != count*sz {
+		return fmt.Errorf("%w: invalid OIDL chunk size", ErrMalformedMultiPackIndex)
+	}
+	idx.Offsets = chunks[chunkObjectOffset]
+	if len(idx.Offsets) != count*szOffset {
+		return fmt.Errorf("%w: invalid OOFF chunk size", ErrMalformedMultiPackIndex)
+	}
+	idx.LargeOffsets = chunks[chunkLargeOffset]
+	if len(idx.LargeOffsets)%szLargeOffset != 0 {
+		return fmt.Errorf("%w: invalid LOFF chunk size", ErrMalformedMultiPackIndex)
+	}
+
+	return nil
+}
+
+// readChunks reads the chunk lookup table and returns the contents of each
+// known chunk.
+func readChunks(body []byte, count int) (map[[4]byte][]byte, error) {
+	if len(body) < szHeader+(count+1)*szChunkHeader {
+		return nil, ErrMalformedMultiPackIndex
+	}
+
+	type chunk struct {
+		id     [4]byte
+		offset uint64
+	}
+
+	table := make([]chunk, count+1)
+	for i := range table {
+		b := body[szHeader+i*szChunkHeader:]
+		copy(table[i].id[:], b[:4])
+		table[i].offset = encbin.BigEndian.Uint64(b[4:])
+	}
+
+	if table[count].id != [4]byte{} {
+		return nil, fmt.Errorf("%w: missing chunk table terminator", ErrMalformedMultiPackIndex)
+	}
+
+	chunks := make(map[[4]byte][]byte, count)
+	for i := range count {
+		start, end := table[i].offset, table[i+1].offset
+		if start > end || end > uint64(len(body)) {
+			return nil, fmt.Errorf("%w: invalid chunk offset", ErrMalformedMultiPackIndex)
+		}
+		chunks[table[i].id] = body[start:end]
+	}
+
+	return chunks, nil
+}
+
+func (idx *MultiPackIndex) readPackNames(data []byte, count int) error {
+	idx.PackNames = make([]string, 0, count)
+	for len(idx.PackNames) < count {
+		i := bytes.IndexByte(data, 0)
+		if i <= 0 {
+			return fmt.Errorf("%w: invalid PNAM chunk", ErrMalformedMultiPackIndex)
+		}
+
+		idx.PackNames = append(idx.PackNames, string(data[:i]))
+		data = data[i+1:]
+	}
+
+	return nil
+}
+
+func (idx *MultiPackIndex) readFanout(data []byte) error {
+	if len(data) != lenFanout*4 {
+		return fmt.Errorf("%w: invalid OIDF chunk size", ErrMalformedMultiPackIndex)
+	}
+
+	for i := range idx.Fanout {
+		idx.Fanout[i] = encbin.BigEndian.Uint32(data[i*4:])
+		if i > 0 && idx.Fanout[i] < idx.Fanout[i-1] {
+			return fmt.Errorf("%w: invalid fanout", ErrMalformedMultiPackIndex)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,67 @@
+// Package midx implements encoding and decoding of multi-pack-index files.
+//
+// A multi-pack-index (MIDX) indexes the objects of several packfiles at
+// once, so that looking up an object does not require a search in each
+// individual pack index. It is stored at objects/pack/multi-pack-index.
+//
+// The format is described at
+// https://github.com/git/git/blob/master/Documentation/gitformat-pack.adoc
+//
+//	HEADER:
+//
+//	  4-byte signature: The signature is: {'M', 'I', 'D', 'X'}
+//
+//	  1-byte version number: Git only writes or recognizes version 1.
+//
+//	  1-byte Object Id Version: 1 for SHA-1, 2 for SHA-256.
+//
+//	  1-byte number of "chunks".
+//
+//	  1-byte number of base multi-pack-index files: Git only writes or
+//	  recognizes 0.
+//
+//	  4-byte number of pack files.
+//
+//	CHUNK LOOKUP:
+//
+//	  (C + 1) * 12 bytes providing the chunk offsets: First 4 bytes
+//	  describe chunk id. Value 0 is a terminating label. Other 8 bytes
+//	  provide offset in current file for chunk to start.
+//
+//	CHUNK DATA:
+//
+//	  Packfile Names (ID: {'P', 'N', 'A', 'M'})
+//	      Stores the packfile names as concatenated, NUL-terminated
+//	      strings, in lexicographic order. The position of a pack in
+//	      this list is its pack-int-id. The chunk is padded with zeroes
+//	      to a multiple of 4 bytes.
+//
+//	  OID Fanout (ID: {'O', 'I', 'D', 'F'})
+//	      The ith entry, F[i], stores the number of OIDs with first
+//	      byte at most i. Thus F[255] stores the total number of
+//	      objects.
+//
+//	  OID Lookup (ID: {'O', 'I', 'D', 'L'})
+//	      The OIDs for all objects in the MIDX are stored in
+//	      lexicographic order in this chunk.
+//
+//	  Object Offsets (ID: {'O', 'O', 'F', 'F'})
+//	      Stores two 4-byte values for every object.
+//	      1: The pack-int-id for the pack storing this object.
+//	      2: The offset within the pack.
+//	         If all offsets are less than 2^32, then the large offset
+//	         chunk will not exist and offsets are stored as in IDX v1.
+//	         If there is at least one offset value larger than 2^32-1,
+//	         then the large offset chunk must exist, and offsets larger
+//	         than 2^31-1 must be stored in it instead. If the large
+//	         offset chunk exists and the 31st bit is on, then removing
+//	         that bit reveals the row in the large offsets containing
+//	         the 8-byte offset of this object.
+//
+//	  [Optional] Object Large Offsets (ID: {'L', 'O', 'F', 'F'})
+//	      8-byte offsets into large packfiles.
+//
+//	TRAILER:
+//
+//	  Index checksum of the above contents.
+package midx
@@ -0,0 +1,250 @@
+package midx
+
+import (
+	"crypto"
+	"errors"
+	"io"
+	"math"
+	"sort"
+
+	"github.com/go-git/go-git/v6/plumbing"
+	format "github.com/go-git/go-git/v6/plumbing/format/config"
+	"github.com/go-git/go-git/v6/plumbing/format/idxfile"
+	"github.com/go-git/go-git/v6/plumbing/hash"
+	"github.com/go-git/go-git/v6/utils/binary"
+)
+
+// Pack is a packfile to be indexed by a multi-pack-index.
+type Pack struct {
+	// Name is the name of the pack index file, e.g. pack-<hash>.idx.
+	Name string
+	// Index is the index of the packfile.
+	Index idxfile.Index
+}
+
+// Encoder writes multi-pack-index files to an output stream.
+type Encoder struct {
+	io.Writer
+	hash   hash.Hash
+	format format.ObjectFormat
+}
+
+// NewEncoder returns a new stream encoder that writes to w, for objects
+// of the given format.
+func NewEncoder(w io.Writer, f format.ObjectFormat) *Encoder {
+	h := hash.New(crypto.SHA1)
+	if f == format.SHA256 {
+		h = hash.New(crypto.SHA256)
+	}
+
+	mw := io.MultiWriter(w, h)
+	return &Encoder{mw, h, f}
+}
+
+type entry struct {
+	hash   plumbing.Hash
+	pack   uint32
+	offset uint64
+}
+
+// Encode writes a multi-pack-index for the given packs. When an object is
+// present in more than one pack, the first pack in packs that contains it
+// is the one referenced by the index.
+func (e *Encoder) Encode(packs []Pack) error {
+	if len(packs) == 0 {
+		return errors.New("no packs to index")
+	}
+
+	names := make([]string, len(packs))
+	for i, p := range packs {
+		names[i] = p.Name
+	}
+	sort.Strings(names)
+
+	packIDs := make(map[string]uint32, len(names))
+	for i, n := range names {
+		if _, ok := packIDs[n]; ok {
+			return errors.New("duplicated pack name: " + n)
+		}
+		packIDs[n] = uint32(i)
+	}
+
+	entries, err := e.collect(packs, packIDs)
+	if err != nil {
+		return err
+	}
+
+	var largeOffsets int
+	needLarge := false
+	for _, en := range entries {
+		if en.offset > math.MaxUint32 {
+			needLarge = true
+		}
+		if en.offset > uint64(largeOffsetMask) {
+			largeOffsets++
+		}
+	}
+	if !needLarge {
+		largeOffsets = 0
+	}
+
+	var pnam []byte
+	for _, n := range names {
+		pnam = append(pnam, n...)
+		pnam = append(pnam, 0)
+	}
+	for len(pnam)%4 != 0 {
+		pnam = append(pnam, 0)
+	}
+
+	ids := [][4]byte{chunkPackNames, chunkOIDFanout, chunkOIDLookup, chunkObjectOffset}
+	sizes := []uint64{
+		uint64(len(pnam)),
+		lenFanout * 4,
+		uint64(len(entries) * e.format.Size()),
+		uint64(len(entries) * szOffset),
+	}
+	if largeOffsets > 0 {
+		ids = append(ids, chunkLargeOffset)
+		sizes = append(sizes, uint64(largeOffsets*szLargeOffset))
+	}
+
+	if err := e.encodeHeader(len(ids), len(names)); err != nil {
+		return err
+	}
+	if err := e.encodeChunkTable(ids, sizes); err != nil {
+		return err
+	}
+	if _, err := e.Write(pnam); err != nil {
+		return err
+	}
+	if err := e.encodeFanout(entries); err != nil {
+		return err
+	}
+	for _, en := range entries {
+		if _, err := e.Write(en.hash.Bytes()); err != nil {
+			return err
+		}
+	}
+
+	var large []uint64
+	for _, en := range entries {
+		off := uint32(en.offset)
+		if largeOffsets > 0 && en.offset > uint64(largeOffsetMask) {
+			off = largeOffsetFlag | uint32(len(large))
+			large = append(large, en.offset)
+		}
+
+		if err := binary.WriteUint32(e, en.pack); err != nil {
+			return err
+		}
+		if err := binary.WriteUint32(e, off); err != nil {
+			return err
+		}
+	}
+	for _, off := range large {
+		if err := binary.WriteUint64(e, off); err != nil {
+			return err
+		}
+	}
+
+	_, err = e.Write(e.hash.Sum(nil))
+	return err
+}
+
+// collect returns the entries of all packs sorted by hash, without
+// duplicates.
+func (e *Encoder) collect(packs []Pack, packIDs map[string]uint32) ([]entry, error) {
+	seen := make(map[plumbing.Hash]struct{})
+	var entries []entry
+	for _, p := range packs {
+		iter, err := p.Index.Entries()
+		if err != nil {
+			return nil, err
+		}
+
+		for {
+			en, err := iter.Next()
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				iter.Close()
+				return nil, err
+			}
+
+			if en.Hash.Size() != e.format.Size() {
+				iter.Close()
+				return nil, ErrUnsupportedHash
+			}
+
+			if _, ok := seen[en.Hash]; ok {
+				continue
+			}
+			seen[en.Hash] = struct{}{}
+			entries = append(entries, entry{hash: en.Hash, pack: packIDs[p.Name], offset: en.Offset})
+		}
+
+		if err := iter.Close(); err != nil {
+			return nil, err
+		}
+	}
+
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].hash.Compare(entries[j].hash.Bytes()) < 0
+	})
+
+	return entries, nil
+}
+
+func (e *Encoder) encodeHeader(chunks, packs int) error {
+	version := byte(1)
+	if e.format == format.SHA256 {
+		version = 2
+	}
+
+	if _, err := e.Write(midxSignature); err != nil {
+		return err
+	}
+	if _, err := e.Write([]byte{VersionSupported, version, byte(chunks), 0}); err != nil {
+		return err
+	}
+
+	return binary.WriteUint32(e, uint32(packs))
+}
+
+func (e *Encoder) encodeChunkTable(ids [][4]byte, sizes []uint64) error {
+	offset := uint64(szHeader + (len(ids)+1)*szChunkHeader)
+	for i, id := range ids {
+		if _, err := e.Write(id[:]); err != nil {
+			return err
+		}
+		if err := binary.WriteUint64(e, offset); err != nil {
+			return err
+		}
+		offset += sizes[i]
+	}
+
+	if _, err := e.Write([]byte{0, 0, 0, 0}); err != nil {
+		return err
+	}
+
+	return binary.WriteUint64(e, offset)
+}
+
+func (e *Encoder) encodeFanout(entries []entry) error {
+	var fanout [lenFanout]uint32
+	for _, en := range entries {
+		fanout[en.hash.Bytes()[0]]++
+	}
+
+	var total uint32
+	for i := range fanout {
+		total += fanout[i]
+		if err := binary.WriteUint32(e, total); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
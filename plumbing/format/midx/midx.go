@@ -0,0 +1,158 @@
+package midx
+
+import (
+	"bytes"
+	encbin "encoding/binary"
+	"errors"
+
+	"github.com/go-git/go-git/v6/plumbing"
+	format "github.com/go-git/go-git/v6/plumbing/format/config"
+)
+
+var (
+	// ErrUnsupportedVersion is returned by Decode when the multi-pack-index
+	// version is not supported.
+	ErrUnsupportedVersion = errors.New("unsupported version")
+	// ErrUnsupportedHash is returned by Decode when the multi-pack-index
+	// object id version is not supported.
+	ErrUnsupportedHash = errors.New("unsupported hash algorithm")
+	// ErrMalformedMultiPackIndex is returned by Decode when the
+	// multi-pack-index file is corrupted.
+	ErrMalformedMultiPackIndex = errors.New("malformed multi-pack-index file")
+
+	midxSignature = []byte{'M', 'I', 'D', 'X'}
+
+	chunkPackNames    = [4]byte{'P', 'N', 'A', 'M'}
+	chunkOIDFanout    = [4]byte{'O', 'I', 'D', 'F'}
+	chunkOIDLookup    = [4]byte{'O', 'I', 'D', 'L'}
+	chunkObjectOffset = [4]byte{'O', 'O', 'F', 'F'}
+	chunkLargeOffset  = [4]byte{'L', 'O', 'F', 'F'}
+)
+
+const (
+	// VersionSupported is the only multi-pack-index version supported.
+	VersionSupported = 1
+
+	szHeader      = 12
+	szChunkHeader = 12
+	szOffset      = 8
+	szLargeOffset = 8
+	lenFanout     = 256
+
+	largeOffsetFlag = uint32(0x80000000)
+	largeOffsetMask = uint32(0x7fffffff)
+)
+
+// MultiPackIndex is the in memory representation of a multi-pack-index
+// file.
+type MultiPackIndex struct {
+	// PackNames holds the names of the indexed packs, in lexicographic
+	// order. The position of a name is the pack-int-id used to refer
+	// to it.
+	PackNames []string
+	Fanout    [lenFanout]uint32
+	// Names holds the concatenated object ids, in lexicographic order.
+	Names []byte
+	// Offsets holds the pack-int-id and offset pair of each object.
+	Offsets []byte
+	// LargeOffsets holds the 8-byte offsets referred to from Offsets.
+	LargeOffsets []byte
+	Checksum     plumbing.Hash
+
+	objectFormat format.ObjectFormat
+}
+
+// NewMultiPackIndex returns a new empty MultiPackIndex for the given
+// object format.
+func NewMultiPackIndex(f format.ObjectFormat) *MultiPackIndex {
+	return &MultiPackIndex{objectFormat: f}
+}
+
+// ObjectFormat returns the object format of the indexed objects.
+func (idx *MultiPackIndex) ObjectFormat() format.ObjectFormat {
+	return idx.objectFormat
+}
+
+// EntryCount returns the number of objects in the index.
+func (idx *MultiPackIndex) EntryCount() int {
+	return int(idx.Fanout[lenFanout-1])
+}
+
+// Contains checks whether the given hash is in the index.
+func (idx *MultiPackIndex) Contains(h plumbing.Hash) bool {
+	_, ok := idx.find(h)
+	return ok
+}
+
+// FindObject returns the name of the pack containing the object with the
+// given hash, and the offset of the object within that pack.
+func (idx *MultiPackIndex) FindObject(h plumbing.Hash) (packName string, offset int64, ok bool) {
+	i, ok := idx.find(h)
+	if !ok {
+		return "", 0, false
+	}
+
+	pack, offset, ok := idx.entry(i)
+	if !ok {
+		return "", 0, false
+	}
+
+	return idx.PackNames[pack], offset, true
+}
+
+func (idx *MultiPackIndex) find(h plumbing.Hash) (int, bool) {
+	sz := idx.objectFormat.Size()
+	if h.Size() != sz {
+		return 0, false
+	}
+
+	first := h.Bytes()[0]
+	var low uint32
+	if first > 0 {
+		low = idx.Fanout[first-1]
+	}
+	high := idx.Fanout[first]
+	if int(high)*sz > len(idx.Names) {
+		return 0, false
+	}
+
+	for low < high {
+		mid := (low + high) >> 1
+		offset := int(mid) * sz
+
+		cmp := bytes.Compare(h.Bytes(), idx.Names[offset:offset+sz])
+		if cmp < 0 {
+			high = mid
+		} else if cmp == 0 {
+			return int(mid), true
+		} else {
+			low = mid + 1
+		}
+	}
+
+	return 0, false
+}
+
+func (idx *MultiPackIndex) entry(i int) (pack uint32, offset int64, ok bool) {
+	o := i * szOffset
+	if o+szOffset > len(idx.Offsets) {
+		return 0, 0, false
+	}
+
+	pack = encbin.BigEndian.Uint32(idx.Offsets[o:])
+	off := encbin.BigEndian.Uint32(idx.Offsets[o+4:])
+	if int(pack) >= len(idx.PackNames) {
+		return 0, 0, false
+	}
+
+	if len(idx.LargeOffsets) == 0 || off&largeOffsetFlag == 0 {
+		return pack, int64(off), true
+	}
+
+	lo := int(off&largeOffsetMask) * szLargeOffset
+	if lo+szLargeOffset > len(idx.LargeOffsets) {
+		return 0, 0, false
+	}
+
+	return pack, int64(encbin.BigEndian.Uint64(idx.LargeOffsets[lo:])), true
+}
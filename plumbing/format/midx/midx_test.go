@@ -0,0 +1,259 @@
+package midx_test
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	fixtures "github.com/go-git/go-git-fixtures/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/go-git/go-git/v6/plumbing"
+	format "github.com/go-git/go-git/v6/plumbing/format/config"
+	"github.com/go-git/go-git/v6/plumbing/format/idxfile"
+	"github.com/go-git/go-git/v6/plumbing/format/midx"
+)
+
+func fixturePack(t *testing.T, f *fixtures.Fixture) midx.Pack {
+	t.Helper()
+
+	idx := idxfile.NewMemoryIndex(format.SHA1Size)
+	require.NoError(t, idxfile.NewDecoder(f.Idx()).Decode(idx))
+
+	return midx.Pack{Name: "pack-" + f.PackfileHash + ".idx", Index: idx}
+}
+
+func TestEncodeDecode(t *testing.T) {
+	packs := []midx.Pack{
+		fixturePack(t, fixtures.Basic().One()),
+		fixturePack(t, fixtures.ByTag("ofs-delta").One()),
+	}
+
+	var buf bytes.Buffer
+	require.NoError(t, midx.NewEncoder(&buf, format.SHA1).Encode(packs))
+
+	idx := midx.NewMultiPackIndex(format.SHA1)
+	require.NoError(t, midx.NewDecoder(&buf).Decode(idx))
+
+	assert.Equal(t, format.SHA1, idx.ObjectFormat())
+	assert.Len(t, idx.PackNames, len(packs))
+	assert.LessOrEqual(t, idx.PackNames[0], idx.PackNames[1])
+
+	seen := map[plumbing.Hash]bool{}
+	for _, p := range packs {
+		iter, err := p.Index.Entries()
+		require.NoError(t, err)
+
+		for {
+			e, err := iter.Next()
+			if err == io.EOF {
+				break
+			}
+			require.NoError(t, err)
+			seen[e.Hash] = true
+
+			name, offset, ok := idx.FindObject(e.Hash)
+			require.True(t, ok, e.Hash.String())
+
+			for _, other := range packs {
+				if other.Name != name {
+					continue
+				}
+				o, err := other.Index.FindOffset(e.Hash)
+				require.NoError(t, err)
+				assert.Equal(t, o, offset)
+			}
+		}
+	}
+
+	assert.Equal(t, len(seen), idx.EntryCount())
+
+	_, _, ok := idx.FindObject(plumbing.NewHash("0000000000000000000000000000000000000001"))
+	assert.False(t, ok)
+}
+
+func TestEncodeLargeOffsets(t *testing.T) {
+	h1 := plumbing.NewHash("1669dce138d9b841a518c64b10914d88f5e488ea")
+	h2 := plumbing.NewHash("32858aad3c383ed1ff0a0f9bdf231d54a00c9e88")
+	h3 := plumbing.NewHash("35e85108805c84807bc66a02d91535e1e24b38b9")
+
+	w := idxfile.Writer{}
+	w.OnHeader(3)
+	w.OnInflatedObjectContent(h1, 12, 0, nil)
+	w.OnInflatedObjectContent(h2, 3<<30, 0, nil)
+	w.OnInflatedObjectContent(h3, 5<<30, 0, nil)
+	w.OnFooter(plumbing.NewHash("b8e471f58bcbca63b07bda20e428190409c2db47"))
+	packIdx, err := w.Index()
+	require.NoError(t, err)
+
+	var buf bytes.Buffer
+	err = midx.NewEncoder(&buf, format.SHA1).Encode([]midx.Pack{{Name: "pack-a.idx", Index: packIdx}})
+	require.NoError(t, err)
+
+	idx := midx.NewMultiPackIndex(format.SHA1)
+	require.NoError(t, midx.NewDecoder(&buf).Decode(idx))
+	assert.Len(t, idx.LargeOffsets, 16)
+
+	for h, want := range map[plumbing.Hash]int64{h1: 12, h2: 3 << 30, h3: 5 << 30} {
+		name, offset, ok := idx.FindObject(h)
+		assert.True(t, ok)
+		assert.Equal(t, "pack-a.idx", name)
+		assert.Equal(t, want, offset)
+	}
+}
+
+func TestDecodeMalformed(t *testing.T) {
+	packs := []midx.Pack{fixturePack(t, fixtures.Basic().One())}
+
+	var buf bytes.Buffer
+	require.NoError(t, midx.NewEncoder(&buf, format.SHA1).Encode(packs))
+
+	data := buf.Bytes()
+	data[len(data)/2] ^= 0xff
+
+	idx := midx.NewMultiPackIndex(format.SHA1)
+	err := midx.NewDecoder(bytes.NewReader(data)).Decode(idx)
+	assert.ErrorIs(t, err, midx.ErrMalformedMultiPackIndex)
+
+	err = midx.NewDecoder(bytes.NewReader([]byte("PACK"))).Decode(idx)
+	assert.ErrorIs(t, err, midx.ErrMalformedMultiPackIndex)
+}
+
+// newGitPackRepository returns a repository written by git, whose commits
+// are each written to a pack of its own, the git command run in it, and its
+// packs.
+func newGitPackRepository(t *testing.T, f format.ObjectFormat) (dir string, git func(...string) string, packs []midx.Pack) {
+	t.Helper()
+
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not found")
+	}
+
+	dir = t.TempDir()
+	git = func(args ...string) string {
+		cmd := exec.Command("git", args...)
+		cmd.Dir = dir
+		cmd.Env = append(os.Environ(), "GIT_CONFIG_NOSYSTEM=1", "HOME="+dir)
+		out, err := cmd.CombinedOutput()
+		require.NoError(t, err, string(out))
+		return string(out)
+	}
+
+	git("init", "-q", "--object-format="+f.String())
+	for i := 0; i < 3; i++ {
+		require.NoError(t, os.WriteFile(filepath.Join(dir, "file"), bytes.Repeat([]byte{byte('a' + i)}, i+1), 0o644))
+		git("add", "file")
+		git("-c", "user.name=foo", "-c", "user.email=foo@foo.foo", "commit", "-q", "-m", "commit")
+		git("repack", "-d", "-q")
+	}
+
+	names, err := filepath.Glob(filepath.Join(dir, ".git", "objects", "pack", "*.idx"))
+	require.NoError(t, err)
+	require.Len(t, names, 3)
+
+	for _, name := range names {
+		file, err := os.Open(name)
+		require.NoError(t, err)
+		idx := idxfile.NewMemoryIndex(f.Size())
+		require.NoError(t, idxfile.NewDecoder(file).Decode(idx))
+		require.NoError(t, file.Close())
+		packs = append(packs, midx.Pack{Name: filepath.Base(name), Index: idx})
+	}
+
+	return dir, git, packs
+}
+
+func TestEncodeGit(t *testing.T) {
+	t.Parallel()
+
+	for _, f := range []format.ObjectFormat{format.SHA1, format.SHA256} {
+		t.Run(f.String(), func(t *testing.T) {
+			t.Parallel()
+
+			dir, git, packs := newGitPackRepository(t, f)
+
+			var buf bytes.Buffer
+			require.NoError(t, midx.NewEncoder(&buf, f).Encode(packs))
+			path := filepath.Join(dir, ".git", "objects", "pack", "multi-pack-index")
+			require.NoError(t, os.WriteFile(path, buf.Bytes(), 0o644))
+			git("multi-pack-index", "verify")
+
+			// The multi-pack-index is the one written by git, which is
+			// read back.
+			require.NoError(t, os.Remove(path))
+			git("multi-pack-index", "write")
+			expected, err := os.ReadFile(path)
+			require.NoError(t, err)
+			assert.Equal(t, expected, buf.Bytes())
+
+			objects := strings.Fields(git("cat-file", "--batch-all-objects", "--batch-check=%(objectname)"))
+			idx := midx.NewMultiPackIndex(f)
+			require.NoError(t, midx.NewDecoder(bytes.NewReader(expected)).Decode(idx))
+			assert.Equal(t, len(objects), idx.EntryCount())
+		})
+	}
+}
+
+func TestEncodeLargeOffsetsGit(t *testing.T) {
+	t.Parallel()
+
+	dir, git, packs := newGitPackRepository(t, format.SHA1)
+
+	// The index of a pack is rewritten with offsets over 4GiB, which git
+	// does not check against the pack when verifying the multi-pack-index,
+	// so that they are written to the LOFF chunk.
+	iter, err := packs[0].Index.Entries()
+	require.NoError(t, err)
+	count, err := packs[0].Index.Count()
+	require.NoError(t, err)
+	w := idxfile.Writer{}
+	require.NoError(t, w.OnHeader(uint32(count)))
+	for i := int64(0); ; i++ {
+		e, err := iter.Next()
+		if err == io.EOF {
+			break
+		}
+		require.NoError(t, err)
+
+		// As git checks, the first object of the pack is not moved.
+		offset := e.Offset
+		if offset > 12 {
+			offset += uint64(i+2) << 31
+		}
+
+		w.Add(e.Hash, offset, e.CRC32)
+	}
+
+	require.NoError(t, w.OnFooter(packs[0].Index.(*idxfile.MemoryIndex).PackfileChecksum))
+	large, err := w.Index()
+	require.NoError(t, err)
+
+	packDir := filepath.Join(dir, ".git", "objects", "pack")
+	file, err := os.Create(filepath.Join(packDir, packs[0].Name))
+	require.NoError(t, err)
+	_, err = idxfile.NewEncoder(file).Encode(large)
+	require.NoError(t, err)
+	require.NoError(t, file.Close())
+	packs[0].Index = large
+
+	var buf bytes.Buffer
+	require.NoError(t, midx.NewEncoder(&buf, format.SHA1).Encode(packs))
+	path := filepath.Join(packDir, "multi-pack-index")
+	require.NoError(t, os.WriteFile(path, buf.Bytes(), 0o644))
+	git("multi-pack-index", "verify")
+
+	require.NoError(t, os.Remove(path))
+	git("multi-pack-index", "write")
+	expected, err := os.ReadFile(path)
+	require.NoError(t, err)
+	assert.Equal(t, expected, buf.Bytes())
+
+	idx := midx.NewMultiPackIndex(format.SHA1)
+	require.NoError(t, midx.NewDecoder(&buf).Decode(idx))
+	assert.NotEmpty(t, idx.LargeOffsets)
+}
@@ -0,0 +1,34 @@
+package objfile
+
+import "github.com/go-git/go-git/v6/plumbing/format/packfile"
+
+// ErrZstd is returned by NewReader when the zstd-compressed objfile data
+// cannot be decompressed.
+var ErrZstd = packfile.NewError("zstd reading error")
+
+// Compression is the compression of the objfile data.
+type Compression int
+
+const (
+	// ZlibCompression is the zlib compression of the object files of git.
+	ZlibCompression Compression = iota
+	// ZstdCompression is the zstd compression. Its object files start with
+	// the magic number of the zstd frames, which is not a valid zlib header,
+	// so they are not confused with the zlib ones: NewReader detects them,
+	// but git cannot read them, and reports them as corrupt.
+	ZstdCompression
+)
+
+// zstdMagic is the magic number starting the zstd frames.
+var zstdMagic = []byte{0x28, 0xb5, 0x2f, 0xfd}
+
+func (c Compression) String() string {
+	switch c {
+	case ZlibCompression:
+		return "zlib"
+	case ZstdCompression:
+		return "zstd"
+	default:
+		return "unknown"
+	}
+}
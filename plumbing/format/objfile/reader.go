@@ -1,6 +1,7 @@
 package objfile
 
 import (
+	"bytes"
 	"errors"
 	"io"
 	"strconv"
@@ -22,19 +23,51 @@ var (
 // the Reader. Close will not close the underlying io.Reader.
 type Reader struct {
 	multi  io.Reader
-	zlib   *sync.ZLibReader
+	data   io.Reader
 	hasher plumbing.Hasher
+	format format.ObjectFormat
 	closed bool
+	// release puts the decompressor back into its pool.
+	release func() error
 }
 
-// NewReader returns a new Reader reading from r.
+// NewReader returns a new Reader reading from r. The compression of the
+// objfile data, zlib or zstd, is detected from its first bytes.
 func NewReader(r io.Reader) (*Reader, error) {
+	magic := make([]byte, len(zstdMagic))
+	n, err := io.ReadFull(r, magic)
+	if err != nil && err != io.ErrUnexpectedEOF {
+		return nil, packfile.ErrZLib.AddDetails("%s", err.Error())
+	}
+
+	r = io.MultiReader(bytes.NewReader(magic[:n]), r)
+	if bytes.Equal(magic[:n], zstdMagic) {
+		zstd, err := sync.GetZstdReader(r)
+		if err != nil {
+			return nil, ErrZstd.AddDetails("%s", err.Error())
+		}
+
+		return &Reader{data: zstd, release: func() error {
+			sync.PutZstdReader(zstd)
+			return nil
+		}}, nil
+	}
+
 	zlib, err := sync.GetZlibReader(r)
 	if err != nil {
 		return nil, packfile.ErrZLib.AddDetails("%s", err.Error())
 	}
 
-	return &Reader{zlib: zlib}, nil
+	return &Reader{data: zlib, release: func() error {
+		defer sync.PutZlibReader(zlib)
+		return zlib.Close()
+	}}, nil
+}
+
+// SetObjectFormat sets the object format of the hash of the object, SHA1 by
+// default. It must be called before Header.
+func (r *Reader) SetObjectFormat(f format.ObjectFormat) {
+	r.format = f
 }
 
 // Header reads the type and the size of object, and prepares the reader for read
@@ -71,7 +104,7 @@ func (r *Reader) readUntil(delim byte) ([]byte, error) {
 	var buf [1]byte
 	value := make([]byte, 0, 16)
 	for {
-		if n, err := r.zlib.Read(buf[:]); err != nil && (err != io.EOF || n == 0) {
+		if n, err := r.data.Read(buf[:]); err != nil && (err != io.EOF || n == 0) {
 			if err == io.EOF {
 				return nil, ErrHeader
 			}
@@ -87,8 +120,8 @@ func (r *Reader) readUntil(delim byte) ([]byte, error) {
 }
 
 func (r *Reader) prepareForRead(t plumbing.ObjectType, size int64) {
-	r.hasher = plumbing.NewHasher(format.SHA1, t, size)
-	r.multi = io.TeeReader(r.zlib, r.hasher)
+	r.hasher = plumbing.NewHasher(r.format, t, size)
+	r.multi = io.TeeReader(r.data, r.hasher)
 }
 
 // Read reads len(p) bytes into p from the object data stream. It returns
@@ -115,6 +148,5 @@ func (r *Reader) Close() error {
 	}
 	r.closed = true
 
-	defer sync.PutZlibReader(r.zlib)
-	return r.zlib.Close()
+	return r.release()
 }
@@ -5,6 +5,9 @@ import (
 	"encoding/base64"
 	"fmt"
 	"io"
+	"math/rand"
+	"os"
+	"path/filepath"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -70,3 +73,118 @@ func (s *SuiteReader) TestReadCorruptZLib() {
 	_, _, err = r.Header()
 	s.NotNil(err)
 }
+
+func (s *SuiteReader) TestReadCorruptZstd() {
+	data := append(append([]byte{}, zstdMagic...), "garbage"...)
+	r, err := NewReader(bytes.NewReader(data))
+	if err != nil {
+		s.ErrorIs(err, ErrZstd)
+		return
+	}
+
+	_, _, err = r.Header()
+	s.Error(err)
+	s.NoError(r.Close())
+}
+
+// benchmarkObjects returns a mix of objects as found in a repository of
+// source code: commits, trees, and source files of various sizes.
+func benchmarkObjects(b *testing.B) []objfileFixture {
+	rnd := rand.New(rand.NewSource(42))
+	var objects []objfileFixture
+	add := func(t plumbing.ObjectType, content []byte) {
+		objects = append(objects, objfileFixture{t: t, content: string(content)})
+	}
+
+	files, err := filepath.Glob(filepath.Join("..", "*", "*.go"))
+	if err != nil || len(files) == 0 {
+		b.Fatalf("no source files: %v", err)
+	}
+
+	for i, name := range files {
+		content, err := os.ReadFile(name)
+		if err != nil {
+			b.Fatal(err)
+		}
+
+		add(plumbing.BlobObject, content)
+		add(plumbing.CommitObject, fmt.Appendf(nil, "tree %040x\nparent %040x\n"+
+			"author John Doe <john@example.com> %d +0200\ncommitter John Doe <john@example.com> %d +0200\n\n"+
+			"Update %s\n\nChange %d of the file.\n", rnd.Uint64(), rnd.Uint64(), 1700000000+i, 1700000000+i, name, i))
+
+		var tree []byte
+		for j := 0; j < 2+rnd.Intn(30); j++ {
+			hash := make([]byte, 20)
+			rnd.Read(hash)
+			tree = fmt.Appendf(tree, "100644 file_%d.go\x00", j)
+			tree = append(tree, hash...)
+		}
+
+		add(plumbing.TreeObject, tree)
+	}
+
+	return objects
+}
+
+func BenchmarkReader(b *testing.B) {
+	objects := benchmarkObjects(b)
+	var size int64
+	for _, o := range objects {
+		size += int64(len(o.content))
+	}
+
+	for _, bc := range []struct {
+		name      string
+		newWriter func(io.Writer) *Writer
+	}{
+		{ZlibCompression.String(), NewWriter},
+		{ZstdCompression.String(), NewZstdWriter},
+	} {
+		data := make([][]byte, 0, len(objects))
+		var compressed int
+		for _, o := range objects {
+			buf := bytes.NewBuffer(nil)
+			w := bc.newWriter(buf)
+			if err := w.WriteHeader(o.t, int64(len(o.content))); err != nil {
+				b.Fatal(err)
+			}
+
+			if _, err := io.WriteString(w, o.content); err != nil {
+				b.Fatal(err)
+			}
+
+			if err := w.Close(); err != nil {
+				b.Fatal(err)
+			}
+
+			data = append(data, buf.Bytes())
+			compressed += buf.Len()
+		}
+
+		b.Run(bc.name, func(b *testing.B) {
+			b.ReportAllocs()
+			b.SetBytes(size)
+			b.ReportMetric(float64(compressed)/float64(size), "ratio")
+			for i := 0; i < b.N; i++ {
+				for _, d := range data {
+					r, err := NewReader(bytes.NewReader(d))
+					if err != nil {
+						b.Fatal(err)
+					}
+
+					if _, _, err := r.Header(); err != nil {
+						b.Fatal(err)
+					}
+
+					if _, err := io.Copy(io.Discard, r); err != nil {
+						b.Fatal(err)
+					}
+
+					if err := r.Close(); err != nil {
+						b.Fatal(err)
+					}
+				}
+			}
+		})
+	}
+}
@@ -17,13 +17,15 @@ var ErrOverflow = errors.New("objfile: declared data length exceeded (overflow)"
 // io.Writer. Close should be called when finished with the Writer. Close will
 // not close the underlying io.Writer.
 type Writer struct {
-	raw    io.Writer
-	hasher plumbing.Hasher
-	multi  io.Writer
-	zlib   *zlib.Writer
+	raw        io.Writer
+	hasher     plumbing.Hasher
+	format     format.ObjectFormat
+	multi      io.Writer
+	compressor io.WriteCloser
 
 	closed  bool
-	pending int64 // number of unwritten bytes
+	release func() // puts the pooled compressor back, if any
+	pending int64  // number of unwritten bytes
 
 	closeErr error
 }
@@ -35,11 +37,47 @@ type Writer struct {
 func NewWriter(w io.Writer) *Writer {
 	zlib := sync.GetZlibWriter(w)
 	return &Writer{
-		raw:  w,
-		zlib: zlib,
+		raw:        w,
+		compressor: zlib,
+		release:    func() { sync.PutZlibWriter(zlib) },
 	}
 }
 
+// NewWriterLevel is like NewWriter but specifies the zlib compression level,
+// whose valid values are the ones of zlib.NewWriterLevel.
+func NewWriterLevel(w io.Writer, level int) (*Writer, error) {
+	if level == zlib.DefaultCompression {
+		return NewWriter(w), nil
+	}
+
+	z, err := zlib.NewWriterLevel(w, level)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Writer{
+		raw:        w,
+		compressor: z,
+	}, nil
+}
+
+// NewZstdWriter is like NewWriter but compresses the objfile data with zstd,
+// as described by ZstdCompression, which makes it unreadable by git.
+func NewZstdWriter(w io.Writer) *Writer {
+	zstd := sync.GetZstdWriter(w)
+	return &Writer{
+		raw:        w,
+		compressor: zstd,
+		release:    func() { sync.PutZstdWriter(zstd) },
+	}
+}
+
+// SetObjectFormat sets the object format of the hash of the object, SHA1 by
+// default. It must be called before WriteHeader.
+func (w *Writer) SetObjectFormat(f format.ObjectFormat) {
+	w.format = f
+}
+
 // WriteHeader writes the type and the size and prepares to accept the object's
 // contents. If an invalid t is provided, plumbing.ErrInvalidType is returned. If a
 // negative size is provided, ErrNegativeSize is returned.
@@ -57,7 +95,7 @@ func (w *Writer) WriteHeader(t plumbing.ObjectType, size int64) error {
 	b = append(b, 0)
 
 	defer w.prepareForWrite(t, size)
-	_, err := w.zlib.Write(b)
+	_, err := w.compressor.Write(b)
 
 	return err
 }
@@ -65,8 +103,8 @@ func (w *Writer) WriteHeader(t plumbing.ObjectType, size int64) error {
 func (w *Writer) prepareForWrite(t plumbing.ObjectType, size int64) {
 	w.pending = size
 
-	w.hasher = plumbing.NewHasher(format.SHA1, t, size)
-	w.multi = io.MultiWriter(w.zlib, w.hasher)
+	w.hasher = plumbing.NewHasher(w.format, t, size)
+	w.multi = io.MultiWriter(w.compressor, w.hasher)
 }
 
 // Write writes the object's contents. Write returns the error ErrOverflow if
@@ -106,12 +144,15 @@ func (w *Writer) Hash() plumbing.Hash {
 // It returns an error, if any. Close will return the same error if called
 // multiple times.
 func (w *Writer) Close() error {
-	if w.closed {
+	if w.closed || w.closeErr != nil {
 		return w.closeErr
 	}
 
-	defer sync.PutZlibWriter(w.zlib)
-	if err := w.zlib.Close(); err != nil {
+	if w.release != nil {
+		defer w.release()
+	}
+
+	if err := w.compressor.Close(); err != nil {
 		w.closeErr = err
 		return err
 	}
@@ -2,6 +2,7 @@ package objfile
 
 import (
 	"bytes"
+	"compress/zlib"
 	"encoding/base64"
 	"fmt"
 	"io"
@@ -85,3 +86,52 @@ func (s *SuiteWriter) TestNewWriterInvalidSize() {
 	err = w.WriteHeader(plumbing.BlobObject, -1651860)
 	s.ErrorIs(err, ErrNegativeSize)
 }
+
+func (s *SuiteWriter) TestNewWriterLevel() {
+	content := bytes.Repeat([]byte("go-git "), 1024)
+	var sizes []int
+	for _, level := range []int{zlib.NoCompression, zlib.BestCompression} {
+		buf := bytes.NewBuffer(nil)
+		w, err := NewWriterLevel(buf, level)
+		s.Require().NoError(err)
+		s.Require().NoError(w.WriteHeader(plumbing.BlobObject, int64(len(content))))
+		_, err = w.Write(content)
+		s.Require().NoError(err)
+		s.Require().NoError(w.Close())
+		sizes = append(sizes, buf.Len())
+
+		r, err := NewReader(buf)
+		s.Require().NoError(err)
+		_, _, err = r.Header()
+		s.Require().NoError(err)
+		data, err := io.ReadAll(r)
+		s.Require().NoError(err)
+		s.Equal(content, data)
+	}
+
+	s.Greater(sizes[0], len(content))
+	s.Less(sizes[1], len(content)/10)
+
+	_, err := NewWriterLevel(nil, 42)
+	s.Error(err)
+}
+
+func (s *SuiteWriter) TestNewZstdWriter() {
+	for k, fixture := range objfileFixtures {
+		buffer := bytes.NewBuffer(nil)
+
+		com := fmt.Sprintf("test %d: ", k)
+		hash := plumbing.NewHash(fixture.hash)
+		content, _ := base64.StdEncoding.DecodeString(fixture.content)
+
+		w := NewZstdWriter(buffer)
+		s.Require().NoError(w.WriteHeader(fixture.t, int64(len(content))))
+		_, err := w.Write(content)
+		s.Require().NoError(err)
+		s.Equal(hash, w.Hash())
+		s.Require().NoError(w.Close())
+
+		s.Equal(zstdMagic, buffer.Bytes()[:len(zstdMagic)], com)
+		testReader(s.T(), buffer, hash, fixture.t, content, com)
+	}
+}
@@ -0,0 +1,107 @@
+package bitmap
+
+import "math/bits"
+
+// Bitmap is an uncompressed set of object positions.
+type Bitmap struct {
+	words []uint64
+}
+
+// NewBitmap returns a new empty Bitmap.
+func NewBitmap() *Bitmap {
+	return &Bitmap{}
+}
+
+// Set adds pos to the bitmap.
+func (b *Bitmap) Set(pos uint32) {
+	w := int(pos / 64)
+	for len(b.words) <= w {
+		b.words = append(b.words, 0)
+	}
+
+	b.words[w] |= 1 << (pos % 64)
+}
+
+// Contains checks whether pos is in the bitmap.
+func (b *Bitmap) Contains(pos uint32) bool {
+	w := int(pos / 64)
+	if w >= len(b.words) {
+		return false
+	}
+
+	return b.words[w]&(1<<(pos%64)) != 0
+}
+
+// Count returns the number of positions in the bitmap.
+func (b *Bitmap) Count() int {
+	var n int
+	for _, w := range b.words {
+		n += bits.OnesCount64(w)
+	}
+
+	return n
+}
+
+// ForEach calls f for each position in the bitmap, in increasing order,
+// until f returns false.
+func (b *Bitmap) ForEach(f func(pos uint32) bool) {
+	for i, w := range b.words {
+		for w != 0 {
+			t := bits.TrailingZeros64(w)
+			if !f(uint32(i*64 + t)) {
+				return
+			}
+			w &= w - 1
+		}
+	}
+}
+
+// Or returns a new Bitmap with the positions that are in b or in o.
+func (b *Bitmap) Or(o *Bitmap) *Bitmap {
+	r := b.clone(max(len(b.words), len(o.words)))
+	for i, w := range o.words {
+		r.words[i] |= w
+	}
+
+	return r
+}
+
+// AndNot returns a new Bitmap with the positions that are in b but not
+// in o.
+func (b *Bitmap) AndNot(o *Bitmap) *Bitmap {
+	r := b.clone(len(b.words))
+	for i := 0; i < len(r.words) && i < len(o.words); i++ {
+		r.words[i] &^= o.words[i]
+	}
+
+	r.trim()
+	return r
+}
+
+// Xor returns a new Bitmap with the positions that are either in b or in
+// o, but not in both.
+func (b *Bitmap) Xor(o *Bitmap) *Bitmap {
+	r := b.clone(max(len(b.words), len(o.words)))
+	for i, w := range o.words {
+		r.words[i] ^= w
+	}
+
+	r.trim()
+	return r
+}
+
+func (b *Bitmap) clone(n int) *Bitmap {
+	r := &Bitmap{words: make([]uint64, n)}
+	copy(r.words, b.words)
+	return r
+}
+
+// trim drops trailing empty words.
+func (b *Bitmap) trim() {
+	n := len(b.words)
+	for n > 0 && b.words[n-1] == 0 {
+		n--
+	}
+
+	b.words = b.words[:n]
+}
@@ -0,0 +1,47 @@
+// Package bitmap implements encoding and decoding of pack bitmap indexes.
+//
+// A pack bitmap index (pack-*.bitmap) stores, for a selection of commits,
+// the set of objects reachable from each of them. Each set is a bitmap in
+// which the ith bit refers to the ith object of the packfile, in pack
+// order. Bitmaps are compressed using EWAH.
+//
+// The format is described at
+// https://github.com/git/git/blob/master/Documentation/technical/bitmap-format.adoc
+//
+//   - A header appears at the beginning:
+//
+//     4-byte signature: {'B', 'I', 'T', 'M'}
+//
+//     2-byte version number (network byte order): Git only writes or
+//     recognizes version 1.
+//
+//     2-byte flags (network byte order). BITMAP_OPT_FULL_DAG (0x1) is
+//     required; BITMAP_OPT_HASH_CACHE (0x4) and
+//     BITMAP_OPT_LOOKUP_TABLE (0x10) are optional.
+//
+//     4-byte entry count (network byte order): The total count of
+//     entries (bitmapped commits) in this bitmap index.
+//
+//     H-byte checksum: The checksum of the packfile this index belongs
+//     to.
+//
+//   - 4 EWAH bitmaps that act as type indexes, for commits, trees, blobs
+//     and tags, in that order.
+//
+//   - N entries with compressed bitmaps, one for each indexed commit.
+//     Each entry contains:
+//
+//     4-byte object position (network byte order): The position in the
+//     index of the packfile (sorted by object id) of the commit.
+//
+//     1-byte XOR-offset: If non-zero, the bitmap of this entry must be
+//     XORed with the bitmap of the entry that appears that many entries
+//     before it.
+//
+//     1-byte flag bits.
+//
+//     EWAH bitmap: The compressed bitmap for the commit.
+//
+//   - An optional name-hash cache and lookup table, followed by the
+//     checksum of all of the above.
+package bitmap
@@ -0,0 +1,90 @@
+package bitmap
+
+import (
+	"crypto"
+	"errors"
+	"io"
+	"sort"
+
+	"github.com/go-git/go-git/v6/plumbing"
+	"github.com/go-git/go-git/v6/plumbing/format/config"
+	"github.com/go-git/go-git/v6/plumbing/hash"
+	"github.com/go-git/go-git/v6/utils/binary"
+)
+
+// Encoder writes bitmap Index structs to an output stream.
+type Encoder struct {
+	io.Writer
+	hash hash.Hash
+}
+
+// NewEncoder returns a new stream encoder that writes to w.
+func NewEncoder(w io.Writer, f config.ObjectFormat) *Encoder {
+	h := hash.New(crypto.SHA1)
+	if f == config.SHA256 {
+		h = hash.New(crypto.SHA256)
+	}
+
+	mw := io.MultiWriter(w, h)
+	return &Encoder{mw, h}
+}
+
+// Encode writes the bitmap index. The written bitmaps are not XORed
+// against each other.
+func (e *Encoder) Encode(bi *Index) error {
+	if bi.Commits == nil || bi.Trees == nil || bi.Blobs == nil || bi.Tags == nil {
+		return errors.New("missing type indexes")
+	}
+
+	commits := make([]plumbing.Hash, 0, len(bi.entries))
+	for h := range bi.entries {
+		commits = append(commits, h)
+	}
+	plumbing.HashesSort(commits)
+
+	if _, err := e.Write(bitmapSignature); err != nil {
+		return err
+	}
+	if err := binary.Write(e, uint16(VersionSupported), uint16(optFullDAG), uint32(len(commits))); err != nil {
+		return err
+	}
+	if _, err := e.Write(bi.PackfileChecksum.Bytes()); err != nil {
+		return err
+	}
+
+	for _, b := range []*Bitmap{bi.Commits, bi.Trees, bi.Blobs, bi.Tags} {
+		if err := writeEWAH(e, b); err != nil {
+			return err
+		}
+	}
+
+	// Entries refer to commits by their position in the pack index,
+	// which is sorted by object id.
+	byName := make([]plumbing.Hash, len(bi.objects))
+	copy(byName, bi.objects)
+	plumbing.HashesSort(byName)
+
+	for _, c := range commits {
+		objPos := sort.Search(len(byName), func(i int) bool {
+			return byName[i].Compare(c.Bytes()) >= 0
+		})
+
+		b, err := bi.entries[c].resolve()
+		if err != nil {
+			return err
+		}
+
+		if err := binary.WriteUint32(e, uint32(objPos)); err != nil {
+			return err
+		}
+		if _, err := e.Write([]byte{0, 0}); err != nil {
+			return err
+		}
+		if err := writeEWAH(e, b); err != nil {
+			return err
+		}
+	}
+
+	_, err := e.Write(e.hash.Sum(nil))
+	return err
+}
@@ -0,0 +1,154 @@
+package bitmap
+
+import (
+	encbin "encoding/binary"
+	"errors"
+	"io"
+
+	"github.com/go-git/go-git/v6/utils/binary"
+)
+
+// errMalformedEWAH is returned when an EWAH bitmap cannot be decoded.
+var errMalformedEWAH = errors.New("malformed EWAH bitmap")
+
+const (
+	rlwRunningBits = 32
+	rlwLiteralBits = 31
+	rlwRunningMask = (uint64(1) << rlwRunningBits) - 1
+	rlwMaxLiterals = (uint64(1) << rlwLiteralBits) - 1
+)
+
+// ewah is a bitmap compressed using the Enhanced Word-Aligned Hybrid
+// scheme, as used by git. Its words are a sequence of run length words
+// (RLW), each followed by a number of literal words:
+//
+//	bit 0:      the bit the running words are filled with.
+//	bits 1-32:  the number of running words.
+//	bits 33-63: the number of literal words following this RLW.
+type ewah struct {
+	bits  uint32
+	words []uint64
+}
+
+// readEWAH reads a serialized EWAH bitmap from the start of data and
+// returns it, along with the number of bytes consumed.
+func readEWAH(data []byte) (*ewah, int, error) {
+	if len(data) < 8 {
+		return nil, 0, errMalformedEWAH
+	}
+
+	e := &ewah{bits: encbin.BigEndian.Uint32(data)}
+	count := int(encbin.BigEndian.Uint32(data[4:]))
+	n := 8 + count*8 + 4
+	if count < 0 || len(data) < n {
+		return nil, 0, errMalformedEWAH
+	}
+
+	e.words = make([]uint64, count)
+	for i := range e.words {
+		e.words[i] = encbin.BigEndian.Uint64(data[8+i*8:])
+	}
+
+	return e, n, nil
+}
+
+// decode inflates the EWAH bitmap into a Bitmap.
+func (e *ewah) decode() (*Bitmap, error) {
+	b := &Bitmap{words: make([]uint64, 0, (e.bits+63)/64)}
+	for i := 0; i < len(e.words); {
+		rlw := e.words[i]
+		i++
+
+		run := (rlw >> 1) & rlwRunningMask
+		literals := int(rlw >> (1 + rlwRunningBits))
+		if i+literals > len(e.words) {
+			return nil, errMalformedEWAH
+		}
+
+		var fill uint64
+		if rlw&1 == 1 {
+			fill = ^uint64(0)
+		}
+		for ; run > 0; run-- {
+			b.words = append(b.words, fill)
+		}
+
+		b.words = append(b.words, e.words[i:i+literals]...)
+		i += literals
+	}
+
+	b.trim()
+	return b, nil
+}
+
+// writeEWAH compresses b and writes it to w in the serialized EWAH
+// format.
+func writeEWAH(w io.Writer, b *Bitmap) error {
+	var words []uint64
+	rlwPos := 0
+
+	for i := 0; i < len(b.words); {
+		var run uint64
+		var fill uint64
+		if w := b.words[i]; w == 0 || w == ^uint64(0) {
+			fill = w
+			for i < len(b.words) && b.words[i] == fill && run < rlwRunningMask {
+				run++
+				i++
+			}
+		}
+
+		start := i
+		for i < len(b.words) && uint64(i-start) < rlwMaxLiterals {
+			if w := b.words[i]; w == 0 || w == ^uint64(0) {
+				break
+			}
+			i++
+		}
+
+		rlw := run<<1 | uint64(i-start)<<(1+rlwRunningBits)
+		if fill != 0 {
+			rlw |= 1
+		}
+
+		rlwPos = len(words)
+		words = append(words, rlw)
+		words = append(words, b.words[start:i]...)
+	}
+
+	if err := binary.WriteUint32(w, uint32(len(b.words)*64)); err != nil {
+		return err
+	}
+	if err := binary.WriteUint32(w, uint32(len(words))); err != nil {
+		return err
+	}
+	for _, word := range words {
+		if err := binary.WriteUint64(w, word); err != nil {
+			return err
+		}
+	}
+
+	return binary.WriteUint32(w, uint32(rlwPos))
+}
+
+// ReadEWAH reads a bitmap serialized in the EWAH format, as stored by git in
+// the bitmap indexes and in some index extensions, from the start of data. It
+// returns the bitmap along with the number of bytes consumed.
+func ReadEWAH(data []byte) (*Bitmap, int, error) {
+	e, n, err := readEWAH(data)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	b, err := e.decode()
+	if err != nil {
+		return nil, 0, err
+	}
+
+	return b, n, nil
+}
+
+// WriteEWAH writes b to w serialized in the EWAH format.
+func WriteEWAH(w io.Writer, b *Bitmap) error {
+	return writeEWAH(w, b)
+}
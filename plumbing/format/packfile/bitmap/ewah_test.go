@@ -0,0 +1,63 @@
+package bitmap
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEWAHRoundTrip(t *testing.T) {
+	b := NewBitmap()
+	for _, pos := range []uint32{0, 3, 63, 64, 1000} {
+		b.Set(pos)
+	}
+	// A long run of set bits, to be compressed into a running word.
+	for pos := uint32(2048); pos < 2048+64*10; pos++ {
+		b.Set(pos)
+	}
+
+	var buf bytes.Buffer
+	require.NoError(t, writeEWAH(&buf, b))
+
+	e, n, err := readEWAH(buf.Bytes())
+	require.NoError(t, err)
+	assert.Equal(t, buf.Len(), n)
+	assert.Less(t, len(e.words), len(b.words))
+
+	got, err := e.decode()
+	require.NoError(t, err)
+	assert.Equal(t, b.words, got.words)
+	assert.Equal(t, 5+64*10, got.Count())
+}
+
+func TestEWAHMalformed(t *testing.T) {
+	_, _, err := readEWAH([]byte{0, 0, 0, 64, 0, 0, 0, 2, 0})
+	assert.ErrorIs(t, err, errMalformedEWAH)
+
+	// An RLW claiming more literal words than there are.
+	e := &ewah{bits: 64, words: []uint64{2 << 33}}
+	_, err = e.decode()
+	assert.ErrorIs(t, err, errMalformedEWAH)
+}
+
+func TestBitmapOperations(t *testing.T) {
+	a, b := NewBitmap(), NewBitmap()
+	a.Set(1)
+	a.Set(70)
+	b.Set(70)
+	b.Set(200)
+
+	var got []uint32
+	a.Or(b).ForEach(func(pos uint32) bool {
+		got = append(got, pos)
+		return true
+	})
+	assert.Equal(t, []uint32{1, 70, 200}, got)
+
+	assert.True(t, a.AndNot(b).Contains(1))
+	assert.False(t, a.AndNot(b).Contains(70))
+	assert.Equal(t, 2, a.Xor(b).Count())
+	assert.False(t, a.Contains(200))
+}
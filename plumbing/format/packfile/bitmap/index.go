@@ -0,0 +1,344 @@
+package bitmap
+
+import (
+	"bytes"
+	"crypto"
+	encbin "encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+
+	"github.com/go-git/go-git/v6/plumbing"
+	"github.com/go-git/go-git/v6/plumbing/format/config"
+	"github.com/go-git/go-git/v6/plumbing/format/idxfile"
+	"github.com/go-git/go-git/v6/plumbing/hash"
+)
+
+var (
+	// ErrUnsupportedVersion is returned by Decode when the bitmap version is
+	// not supported.
+	ErrUnsupportedVersion = errors.New("unsupported version")
+	// ErrMalformedBitmap is returned by Decode when the bitmap file is
+	// corrupted.
+	ErrMalformedBitmap = errors.New("malformed bitmap file")
+	// ErrPackMismatch is returned by Decode when the bitmap file does not
+	// belong to the given pack index.
+	ErrPackMismatch = errors.New("bitmap does not match packfile")
+	// ErrBitmapNotFound is returned when no bitmap is available for a
+	// commit.
+	ErrBitmapNotFound = errors.New("bitmap not found")
+
+	bitmapSignature = []byte{'B', 'I', 'T', 'M'}
+)
+
+const (
+	// VersionSupported is the only bitmap version supported.
+	VersionSupported = 1
+
+	optFullDAG = 0x1
+
+	szHeader = 4 + 2 + 2 + 4
+)
+
+// Index is the in memory representation of a pack bitmap index.
+type Index struct {
+	// PackfileChecksum is the checksum of the packfile the bitmaps
+	// belong to.
+	PackfileChecksum plumbing.Hash
+
+	// Commits, Trees, Blobs and Tags are the type indexes of the pack:
+	// each holds the positions of the objects of that type.
+	Commits, Trees, Blobs, Tags *Bitmap
+
+	// objects holds the hashes of the objects in pack order, which are
+	// the positions used by the bitmaps.
+	objects   []plumbing.Hash
+	positions map[plumbing.Hash]uint32
+
+	m       sync.Mutex
+	entries map[plumbing.Hash]*entry
+}
+
+type entry struct {
+	bitmap   *ewah
+	xor      *entry
+	resolved *Bitmap
+}
+
+// Decode reads a bitmap file from r. The bitmap positions are resolved
+// using idx, which must be the index of the packfile the bitmap belongs
+// to.
+func Decode(r io.Reader, idx idxfile.Index) (*Index, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+
+	bi := &Index{entries: make(map[plumbing.Hash]*entry)}
+	byName, err := bi.readPackOrder(idx)
+	if err != nil {
+		return nil, err
+	}
+
+	objFormat := config.SHA1
+	if len(bi.objects) > 0 && bi.objects[0].Size() == config.SHA256Size {
+		objFormat = config.SHA256
+	}
+	sz := objFormat.Size()
+
+	if len(data) < szHeader+2*sz || !bytes.Equal(data[:4], bitmapSignature) {
+		return nil, ErrMalformedBitmap
+	}
+	if v := encbin.BigEndian.Uint16(data[4:]); v != VersionSupported {
+		return nil, ErrUnsupportedVersion
+	}
+
+	flags := encbin.BigEndian.Uint16(data[6:])
+	if flags&optFullDAG == 0 {
+		return nil, fmt.Errorf("%w: unsupported bitmap without full DAG", ErrMalformedBitmap)
+	}
+
+	h := hash.New(crypto.SHA1)
+	if objFormat == config.SHA256 {
+		h = hash.New(crypto.SHA256)
+	}
+	body, trailer := data[:len(data)-sz], data[len(data)-sz:]
+	h.Write(body)
+	if !bytes.Equal(h.Sum(nil), trailer) {
+		return nil, fmt.Errorf("%w: checksum mismatch", ErrMalformedBitmap)
+	}
+
+	count := int(encbin.BigEndian.Uint32(data[8:]))
+	bi.PackfileChecksum, _ = plumbing.FromBytes(data[szHeader : szHeader+sz])
+	if mi, ok := idx.(*idxfile.MemoryIndex); ok && !mi.PackfileChecksum.Equal(bi.PackfileChecksum) {
+		return nil, ErrPackMismatch
+	}
+
+	pos := szHeader + sz
+	types := []**Bitmap{&bi.Commits, &bi.Trees, &bi.Blobs, &bi.Tags}
+	for _, t := range types {
+		e, n, err := readEWAH(body[pos:])
+		if err != nil {
+			return nil, err
+		}
+		pos += n
+
+		if *t, err = e.decode(); err != nil {
+			return nil, err
+		}
+	}
+
+	ordered := make([]*entry, count)
+	for i := range ordered {
+		if len(body) < pos+6 {
+			return nil, ErrMalformedBitmap
+		}
+
+		objPos := encbin.BigEndian.Uint32(body[pos:])
+		xor := int(body[pos+4])
+		pos += 6
+
+		e, n, err := readEWAH(body[pos:])
+		if err != nil {
+			return nil, err
+		}
+		pos += n
+
+		if int(objPos) >= len(byName) || xor > i {
+			return nil, ErrMalformedBitmap
+		}
+
+		ordered[i] = &entry{bitmap: e}
+		if xor > 0 {
+			ordered[i].xor = ordered[i-xor]
+		}
+		bi.entries[byName[objPos]] = ordered[i]
+	}
+
+	// The optional name-hash cache and lookup table that may follow are
+	// not needed to answer queries, so they are not read.
+	return bi, nil
+}
+
+// NewIndex returns a new bitmap Index for the packfile indexed by idx,
+// with empty type indexes and no bitmaps.
+func NewIndex(idx *idxfile.MemoryIndex) (*Index, error) {
+	bi := &Index{
+		PackfileChecksum: idx.PackfileChecksum,
+		Commits:          NewBitmap(),
+		Trees:            NewBitmap(),
+		Blobs:            NewBitmap(),
+		Tags:             NewBitmap(),
+		entries:          make(map[plumbing.Hash]*entry),
+	}
+
+	if _, err := bi.readPackOrder(idx); err != nil {
+		return nil, err
+	}
+
+	return bi, nil
+}
+
+// readPackOrder loads the objects of idx in pack order, and returns them
+// in index (object id) order.
+func (bi *Index) readPackOrder(idx idxfile.Index) ([]plumbing.Hash, error) {
+	var byName []plumbing.Hash
+	iter, err := idx.Entries()
+	if err != nil {
+		return nil, err
+	}
+	if err := forEachEntry(iter, func(e *idxfile.Entry) {
+		byName = append(byName, e.Hash)
+	}); err != nil {
+		return nil, err
+	}
+
+	bi.objects = make([]plumbing.Hash, 0, len(byName))
+	bi.positions = make(map[plumbing.Hash]uint32, len(byName))
+	iter, err = idx.EntriesByOffset()
+	if err != nil {
+		return nil, err
+	}
+	if err := forEachEntry(iter, func(e *idxfile.Entry) {
+		bi.positions[e.Hash] = uint32(len(bi.objects))
+		bi.objects = append(bi.objects, e.Hash)
+	}); err != nil {
+		return nil, err
+	}
+
+	return byName, nil
+}
+
+func forEachEntry(iter idxfile.EntryIter, f func(*idxfile.Entry)) error {
+	defer iter.Close()
+	for {
+		e, err := iter.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		f(e)
+	}
+}
+
+// Bitmap returns the bitmap of the objects reachable from the given
+// commit, if the commit has one.
+func (bi *Index) Bitmap(commit plumbing.Hash) (*Bitmap, bool) {
+	bi.m.Lock()
+	defer bi.m.Unlock()
+
+	e, ok := bi.entries[commit]
+	if !ok {
+		return nil, false
+	}
+
+	b, err := e.resolve()
+	if err != nil {
+		return nil, false
+	}
+
+	return b, true
+}
+
+// SetBitmap sets the bitmap of the objects reachable from the given
+// commit, which must be in the packfile.
+func (bi *Index) SetBitmap(commit plumbing.Hash, b *Bitmap) error {
+	if _, ok := bi.positions[commit]; !ok {
+		return fmt.Errorf("%w: commit %s", plumbing.ErrObjectNotFound, commit)
+	}
+
+	bi.m.Lock()
+	defer bi.m.Unlock()
+
+	bi.entries[commit] = &entry{resolved: b}
+	return nil
+}
+
+// HasBitmap checks whether the given commit has a bitmap.
+func (bi *Index) HasBitmap(commit plumbing.Hash) bool {
+	bi.m.Lock()
+	defer bi.m.Unlock()
+
+	_, ok := bi.entries[commit]
+	return ok
+}
+
+// Position returns the position of the object with the given hash, as
+// used by the bitmaps.
+func (bi *Index) Position(h plumbing.Hash) (uint32, bool) {
+	pos, ok := bi.positions[h]
+	return pos, ok
+}
+
+// Objects returns the hashes of the objects of the packfile, in pack
+// order. The position of an object in the returned slice is its position
+// in the bitmaps.
+func (bi *Index) Objects() []plumbing.Hash {
+	return bi.objects
+}
+
+// Hashes returns the hashes of the objects in b.
+func (bi *Index) Hashes(b *Bitmap) []plumbing.Hash {
+	hashes := make([]plumbing.Hash, 0, b.Count())
+	b.ForEach(func(pos uint32) bool {
+		if int(pos) < len(bi.objects) {
+			hashes = append(hashes, bi.objects[pos])
+		}
+		return true
+	})
+
+	return hashes
+}
+
+// Reachable reports whether target is reachable from the given commit,
+// using the bitmap of the commit. ErrBitmapNotFound is returned if the
+// commit has no bitmap.
+func (bi *Index) Reachable(commit, target plumbing.Hash) (bool, error) {
+	b, ok := bi.Bitmap(commit)
+	if !ok {
+		return false, ErrBitmapNotFound
+	}
+
+	pos, ok := bi.positions[target]
+	if !ok {
+		// Bitmaps cover the whole closure of a commit, so an object
+		// that is not in the pack can't be reachable from it.
+		return false, nil
+	}
+
+	return b.Contains(pos), nil
+}
+
+func (e *entry) resolve() (*Bitmap, error) {
+	if e.resolved != nil {
+		return e.resolved, nil
+	}
+
+	b, err := e.bitmap.decode()
+	if err != nil {
+		return nil, err
+	}
+
+	if e.xor != nil {
+		base, err := e.xor.resolve()
+		if err != nil {
+			return nil, err
+		}
+		b = b.Xor(base)
+	}
+
+	e.resolved = b
+	return b, nil
+}
+
+// Storer is implemented by object storers that are able to provide the
+// bitmap indexes of their packfiles.
+type Storer interface {
+	// BitmapIndexes returns the bitmap indexes available, which may be
+	// none.
+	BitmapIndexes() ([]*Index, error)
+}
@@ -0,0 +1,116 @@
+package bitmap_test
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+
+	fixtures "github.com/go-git/go-git-fixtures/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/go-git/go-git/v6/plumbing"
+	format "github.com/go-git/go-git/v6/plumbing/format/config"
+	"github.com/go-git/go-git/v6/plumbing/format/idxfile"
+	"github.com/go-git/go-git/v6/plumbing/format/packfile/bitmap"
+)
+
+// The testdata pack was written by git repack -adb, on a repository with
+// 5 linear commits, each adding the files top<n> and d<n>/f with content
+// "x<n>" and "<n>" respectively.
+const testPack = "pack-bb79d100148789e871741050a5e5269e77050977"
+
+var (
+	testHead  = plumbing.NewHash("3273b972aad2cdc22cca797ba5fbc51d41372191")
+	testFirst = plumbing.NewHash("d4dccc930781f500e154fd6641937189f961ba7f")
+	// Blobs of d1/f and d5/f.
+	testBlob1 = plumbing.NewHash("d00491fd7e5bb6fa28c517a0bb32b8b506539d4d")
+	testBlob5 = plumbing.NewHash("7ed6ff82de6bcc2a78243fc9c54d3ef5ac14da69")
+)
+
+func testIndex(t *testing.T) *idxfile.MemoryIndex {
+	t.Helper()
+
+	f, err := os.Open(filepath.Join("testdata", testPack+".idx"))
+	require.NoError(t, err)
+	defer f.Close()
+
+	idx := idxfile.NewMemoryIndex(format.SHA1Size)
+	require.NoError(t, idxfile.NewDecoder(f).Decode(idx))
+	return idx
+}
+
+func TestDecode(t *testing.T) {
+	f, err := os.Open(filepath.Join("testdata", testPack+".bitmap"))
+	require.NoError(t, err)
+	defer f.Close()
+
+	bi, err := bitmap.Decode(f, testIndex(t))
+	require.NoError(t, err)
+
+	assert.Equal(t, 5, bi.Commits.Count())
+	assert.Equal(t, 25, bi.Commits.Count()+bi.Trees.Count()+bi.Blobs.Count()+bi.Tags.Count())
+
+	b, ok := bi.Bitmap(testHead)
+	require.True(t, ok)
+	assert.Equal(t, 25, b.Count())
+	assert.Contains(t, bi.Hashes(b), testFirst)
+
+	found, err := bi.Reachable(testHead, testBlob1)
+	require.NoError(t, err)
+	assert.True(t, found)
+
+	found, err = bi.Reachable(testFirst, testBlob5)
+	require.NoError(t, err)
+	assert.False(t, found)
+
+	found, err = bi.Reachable(testHead, plumbing.NewHash("0000000000000000000000000000000000000001"))
+	require.NoError(t, err)
+	assert.False(t, found)
+
+	_, err = bi.Reachable(plumbing.NewHash("0000000000000000000000000000000000000001"), testBlob1)
+	assert.ErrorIs(t, err, bitmap.ErrBitmapNotFound)
+}
+
+func TestDecodePackMismatch(t *testing.T) {
+	f, err := os.Open(filepath.Join("testdata", testPack+".bitmap"))
+	require.NoError(t, err)
+	defer f.Close()
+
+	idx := idxfile.NewMemoryIndex(format.SHA1Size)
+	require.NoError(t, idxfile.NewDecoder(fixtures.Basic().One().Idx()).Decode(idx))
+
+	_, err = bitmap.Decode(f, idx)
+	assert.ErrorIs(t, err, bitmap.ErrPackMismatch)
+}
+
+func TestEncodeDecode(t *testing.T) {
+	idx := testIndex(t)
+	bi, err := bitmap.NewIndex(idx)
+	require.NoError(t, err)
+
+	objects := bi.Objects()
+	require.Len(t, objects, 25)
+
+	b := bitmap.NewBitmap()
+	for pos := range objects {
+		b.Set(uint32(pos))
+		bi.Blobs.Set(uint32(pos))
+	}
+	require.NoError(t, bi.SetBitmap(testHead, b))
+	assert.Error(t, bi.SetBitmap(plumbing.NewHash("0000000000000000000000000000000000000001"), b))
+
+	var buf bytes.Buffer
+	require.NoError(t, bitmap.NewEncoder(&buf, format.SHA1).Encode(bi))
+
+	decoded, err := bitmap.Decode(&buf, idx)
+	require.NoError(t, err)
+	assert.Equal(t, 25, decoded.Blobs.Count())
+	assert.True(t, decoded.HasBitmap(testHead))
+	assert.False(t, decoded.HasBitmap(testFirst))
+
+	got, ok := decoded.Bitmap(testHead)
+	require.True(t, ok)
+	assert.ElementsMatch(t, objects, decoded.Hashes(got))
+}
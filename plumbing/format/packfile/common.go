@@ -26,21 +26,61 @@ const (
 // UpdateObjectStorage updates the storer with the objects in the given
 // packfile.
 func UpdateObjectStorage(s storer.Storer, packfile io.Reader) error {
+	return UpdateObjectStorageWithOptions(s, packfile)
+}
+
+// UpdateObjectStorageWithOptions updates the storer with the objects in the
+// given packfile, as UpdateObjectStorage does, the packfile being parsed with
+// the given options, such as WithProgress or WithContext. The options are
+// only used for the storers implementing storer.PackfileWriter if they
+// implement ParserOptionsPackfileWriter.
+func UpdateObjectStorageWithOptions(s storer.Storer, packfile io.Reader, opts ...ParserOption) error {
 	start := time.Now()
 	defer func() {
 		trace.Performance.Printf("performance: %.9f s: update_obj_storage", time.Since(start).Seconds())
 	}()
 
+	if pw, ok := s.(ParserOptionsPackfileWriter); ok && len(opts) > 0 {
+		w, err := pw.PackfileWriterWithOptions(opts...)
+		if err != nil {
+			return err
+		}
+
+		return writePackfile(w, packfile)
+	}
+
 	if pw, ok := s.(storer.PackfileWriter); ok {
 		return WritePackfileToObjectStorage(pw, packfile)
 	}
 
-	p := NewParser(packfile, WithStorage(s))
+	p := NewParser(packfile, append([]ParserOption{WithStorage(s)}, opts...)...)
 
 	_, err := p.Parse()
 	return err
 }
 
+// ParserOptionsPackfileWriter is a storer.PackfileWriter whose packfile
+// writers can parse the packfiles written with additional options, such as
+// WithProgress or WithContext.
+type ParserOptionsPackfileWriter interface {
+	storer.PackfileWriter
+	// PackfileWriterWithOptions returns a writer of a packfile, as
+	// PackfileWriter does, parsing the packfile with the given options.
+	PackfileWriterWithOptions(opts ...ParserOption) (io.WriteCloser, error)
+}
+
+// AcceptsThinPacks returns whether UpdateObjectStorage can store thin packs,
+// whose deltas are based on objects missing from them, in the storer. The
+// bases of their deltas are then read from the storer.
+func AcceptsThinPacks(s storer.Storer) bool {
+	if _, ok := s.(storer.PackfileWriter); !ok {
+		return true
+	}
+
+	tw, ok := s.(storer.ThinPackfileWriter)
+	return ok && tw.AcceptsThinPacks()
+}
+
 // WritePackfileToObjectStorage writes all the packfile objects into the given
 // object storage.
 func WritePackfileToObjectStorage(
@@ -52,6 +92,10 @@ func WritePackfileToObjectStorage(
 		return err
 	}
 
+	return writePackfile(w, packfile)
+}
+
+func writePackfile(w io.WriteCloser, packfile io.Reader) (err error) {
 	defer ioutil.CheckClose(w, &err)
 
 	n, err := ioutil.CopyBufferPool(w, packfile)
@@ -0,0 +1,127 @@
+package packfile
+
+import (
+	"container/list"
+	"sync"
+
+	"github.com/go-git/go-git/v6/plumbing"
+)
+
+// DefaultDeltaBaseCacheLimit is the default size of a DeltaBaseCache, the
+// default of core.deltaBaseCacheLimit in git.
+const DefaultDeltaBaseCacheLimit = 96 << 20
+
+// DeltaBaseCache holds the inflated contents of the bases of the deltas read
+// from packfiles, keyed by their packfile and offset, so that the bases
+// shared by many deltas are not inflated again when the chains of deltas are
+// resolved, as with core.deltaBaseCacheLimit in git. Unlike the object cache,
+// which holds any object read, only the bases of the deltas are held, the
+// least recently used ones being evicted once its limit is exceeded.
+//
+// A DeltaBaseCache is safe for concurrent use, and may be shared by the
+// Packfiles of a storage with WithDeltaBaseCache.
+type DeltaBaseCache struct {
+	m       sync.Mutex
+	limit   int64
+	size    int64
+	ll      *list.List
+	entries map[deltaBaseKey]*list.Element
+}
+
+type deltaBaseKey struct {
+	pack   plumbing.Hash
+	offset int64
+}
+
+type deltaBase struct {
+	key     deltaBaseKey
+	typ     plumbing.ObjectType
+	content []byte
+}
+
+// NewDeltaBaseCache returns a DeltaBaseCache holding up to limit bytes of
+// contents, DefaultDeltaBaseCacheLimit if limit is 0. A negative limit holds
+// nothing.
+func NewDeltaBaseCache(limit int64) *DeltaBaseCache {
+	if limit == 0 {
+		limit = DefaultDeltaBaseCacheLimit
+	}
+
+	return &DeltaBaseCache{
+		limit:   limit,
+		ll:      list.New(),
+		entries: make(map[deltaBaseKey]*list.Element),
+	}
+}
+
+// Get returns the type and the content of the base at the given offset of
+// the packfile, whose checksum is pack. The content must not be modified.
+func (c *DeltaBaseCache) Get(pack plumbing.Hash, offset int64) (plumbing.ObjectType, []byte, bool) {
+	if c == nil {
+		return plumbing.InvalidObject, nil, false
+	}
+
+	c.m.Lock()
+	defer c.m.Unlock()
+
+	e, ok := c.entries[deltaBaseKey{pack, offset}]
+	if !ok {
+		return plumbing.InvalidObject, nil, false
+	}
+
+	c.ll.MoveToFront(e)
+	b := e.Value.(*deltaBase)
+	return b.typ, b.content, true
+}
+
+// Put adds the type and the content of the base at the given offset of the
+// packfile, whose checksum is pack, unless the content is larger than the
+// limit of the cache. The content must not be modified afterwards.
+func (c *DeltaBaseCache) Put(pack plumbing.Hash, offset int64, typ plumbing.ObjectType, content []byte) {
+	if c == nil || int64(len(content)) > c.limit {
+		return
+	}
+
+	c.m.Lock()
+	defer c.m.Unlock()
+
+	key := deltaBaseKey{pack, offset}
+	if e, ok := c.entries[key]; ok {
+		c.ll.MoveToFront(e)
+		return
+	}
+
+	c.entries[key] = c.ll.PushFront(&deltaBase{key: key, typ: typ, content: content})
+	c.size += int64(len(content))
+	for c.size > c.limit {
+		b := c.ll.Remove(c.ll.Back()).(*deltaBase)
+		delete(c.entries, b.key)
+		c.size -= int64(len(b.content))
+	}
+}
+
+// Size returns the size of the contents held.
+func (c *DeltaBaseCache) Size() int64 {
+	if c == nil {
+		return 0
+	}
+
+	c.m.Lock()
+	defer c.m.Unlock()
+
+	return c.size
+}
+
+// Clear removes all the contents held.
+func (c *DeltaBaseCache) Clear() {
+	if c == nil {
+		return
+	}
+
+	c.m.Lock()
+	defer c.m.Unlock()
+
+	c.ll.Init()
+	clear(c.entries)
+	c.size = 0
+}
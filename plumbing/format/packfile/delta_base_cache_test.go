@@ -0,0 +1,176 @@
+package packfile
+
+import (
+	"bytes"
+	"io"
+	"testing"
+
+	"github.com/go-git/go-billy/v6"
+	"github.com/go-git/go-billy/v6/memfs"
+	"github.com/go-git/go-billy/v6/util"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/go-git/go-git/v6/plumbing"
+	"github.com/go-git/go-git/v6/plumbing/cache"
+	"github.com/go-git/go-git/v6/plumbing/format/idxfile"
+	"github.com/go-git/go-git/v6/storage/memory"
+)
+
+func TestDeltaBaseCache(t *testing.T) {
+	t.Parallel()
+
+	pack := plumbing.NewHash("6ecf0ef2c2dffb796033e5a02219af86ec6584e5")
+	other := plumbing.NewHash("918c48b83bd081e863dbe1b80f8998f058cd8294")
+	c := NewDeltaBaseCache(10)
+	c.Put(pack, 12, plumbing.BlobObject, []byte("abcd"))
+	c.Put(pack, 34, plumbing.TreeObject, []byte("efgh"))
+
+	typ, content, ok := c.Get(pack, 12)
+	require.True(t, ok)
+	assert.Equal(t, plumbing.BlobObject, typ)
+	assert.Equal(t, []byte("abcd"), content)
+
+	// The bases are keyed by packfile.
+	_, _, ok = c.Get(other, 12)
+	assert.False(t, ok)
+
+	// The least recently used base is evicted.
+	c.Put(other, 12, plumbing.CommitObject, []byte("ijkl"))
+	assert.Equal(t, int64(8), c.Size())
+	_, _, ok = c.Get(pack, 34)
+	assert.False(t, ok)
+	_, _, ok = c.Get(pack, 12)
+	assert.True(t, ok)
+
+	// The bases larger than the limit are not held.
+	c.Put(pack, 56, plumbing.BlobObject, make([]byte, 11))
+	_, _, ok = c.Get(pack, 56)
+	assert.False(t, ok)
+	assert.Equal(t, int64(8), c.Size())
+
+	c.Clear()
+	assert.Zero(t, c.Size())
+	_, _, ok = c.Get(pack, 12)
+	assert.False(t, ok)
+
+	// A negative limit, or a nil cache, holds nothing.
+	for _, c := range []*DeltaBaseCache{NewDeltaBaseCache(-1), nil} {
+		c.Put(pack, 12, plumbing.BlobObject, []byte("abcd"))
+		_, _, ok = c.Get(pack, 12)
+		assert.False(t, ok)
+		assert.Zero(t, c.Size())
+	}
+
+	assert.Equal(t, int64(DefaultDeltaBaseCacheLimit), NewDeltaBaseCache(0).limit)
+}
+
+// newDeltaChainPack returns the packfile and the index of variants of a
+// blob, stored as a chain of deltas, and the hashes of the variants.
+func newDeltaChainPack(tb testing.TB, variants [][]byte) (billy.Filesystem, idxfile.Index, []plumbing.Hash) {
+	tb.Helper()
+
+	store := memory.NewStorage()
+	var hashes []plumbing.Hash
+	for _, v := range variants {
+		h, err := store.SetEncodedObject(newObject(plumbing.BlobObject, v))
+		require.NoError(tb, err)
+		hashes = append(hashes, h)
+	}
+
+	var pack, idxBuf bytes.Buffer
+	_, err := NewEncoder(&pack, store, false).Encode(hashes, 10)
+	require.NoError(tb, err)
+	_, err = IndexPack(bytes.NewReader(pack.Bytes()), &idxBuf, nil)
+	require.NoError(tb, err)
+
+	idx := idxfile.NewMemoryIndex(plumbing.ZeroHash.Size())
+	require.NoError(tb, idxfile.NewDecoder(&idxBuf).Decode(idx))
+
+	fs := memfs.New()
+	require.NoError(tb, util.WriteFile(fs, "pack", pack.Bytes(), 0o644))
+	return fs, idx, hashes
+}
+
+// countingFile counts the bytes read from a file.
+type countingFile struct {
+	billy.File
+	n int
+}
+
+func (f *countingFile) Read(p []byte) (int, error) {
+	n, err := f.File.Read(p)
+	f.n += n
+	return n, err
+}
+
+func TestPackfileDeltaBaseCache(t *testing.T) {
+	t.Parallel()
+
+	variants := minifiedVariants(30)
+	fs, idx, hashes := newDeltaChainPack(t, variants)
+
+	read := func(dbc *DeltaBaseCache) int {
+		f, err := fs.Open("pack")
+		require.NoError(t, err)
+		cf := &countingFile{File: f}
+
+		// The object cache holds none of the bases.
+		p := NewPackfile(cf, WithIdx(idx), WithCache(cache.NewObjectLRU(1)), WithDeltaBaseCache(dbc))
+		defer p.Close()
+
+		for i, h := range hashes {
+			obj, err := p.Get(h)
+			require.NoError(t, err)
+			r, err := obj.Reader()
+			require.NoError(t, err)
+			content, err := io.ReadAll(r)
+			require.NoError(t, err)
+			assert.Equal(t, variants[i], content, i)
+		}
+
+		return cf.n
+	}
+
+	withoutCache := read(nil)
+	dbc := NewDeltaBaseCache(int64(4 * len(variants[0])))
+	withCache := read(dbc)
+	assert.Less(t, withCache, withoutCache)
+	assert.NotZero(t, dbc.Size())
+	assert.LessOrEqual(t, dbc.Size(), int64(4*len(variants[0])))
+
+	// The bases held are read by the other Packfiles of the packfile.
+	assert.Less(t, read(dbc), withCache)
+}
+
+func BenchmarkPackfileDeltaBaseCache(b *testing.B) {
+	variants := minifiedVariants(50)
+	fs, idx, hashes := newDeltaChainPack(b, variants)
+
+	for _, limit := range []int64{-1, DefaultDeltaBaseCacheLimit} {
+		name := "without"
+		if limit > 0 {
+			name = "with"
+		}
+
+		b.Run(name, func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				f, err := fs.Open("pack")
+				require.NoError(b, err)
+
+				p := NewPackfile(f, WithIdx(idx),
+					WithCache(cache.NewObjectLRU(cache.FileSize(len(variants[0])))),
+					WithDeltaBaseCache(NewDeltaBaseCache(limit)),
+				)
+
+				for _, h := range hashes {
+					if _, err := p.Get(h); err != nil {
+						b.Fatal(err)
+					}
+				}
+
+				require.NoError(b, p.Close())
+			}
+		})
+	}
+}
@@ -1,6 +1,7 @@
 package packfile
 
 import (
+	"errors"
 	"sort"
 	"sync"
 
@@ -9,8 +10,8 @@ import (
 )
 
 const (
-	// deltas based on deltas, how many steps we can do.
-	// 50 is the default value used in JGit
+	// deltas based on deltas, how many steps we can do by default.
+	// 50 is the default value used in JGit and git
 	maxDepth = int64(50)
 )
 
@@ -22,21 +23,30 @@ var applyDelta = map[plumbing.ObjectType]bool{
 
 type deltaSelector struct {
 	storer storer.EncodedObjectStorer
+	// maxDepth is the maximum length of the delta chains.
+	maxDepth int64
+	// bases are the objects the receiver of the packfile has, which may be
+	// used as bases of deltas, making a thin pack.
+	bases []plumbing.Hash
 }
 
 func newDeltaSelector(s storer.EncodedObjectStorer) *deltaSelector {
-	return &deltaSelector{s}
+	return &deltaSelector{storer: s, maxDepth: maxDepth}
 }
 
 // ObjectsToPack creates a list of ObjectToPack from the hashes
 // provided, creating deltas if it's suitable, using an specific
 // internal logic.  `packWindow` specifies the size of the sliding
 // window used to compare objects for delta compression; 0 turns off
-// delta compression entirely.
+// delta compression entirely, as a maximum depth of 0 does.
 func (dw *deltaSelector) ObjectsToPack(
 	hashes []plumbing.Hash,
 	packWindow uint,
 ) ([]*ObjectToPack, error) {
+	if dw.maxDepth <= 0 {
+		packWindow = 0
+	}
+
 	otp, err := dw.objectsToPack(hashes, packWindow)
 	if err != nil {
 		return nil, err
@@ -112,6 +122,11 @@ func (dw *deltaSelector) objectsToPack(
 		return objectsToPack, nil
 	}
 
+	objectsToPack, err := dw.appendBases(objectsToPack)
+	if err != nil {
+		return nil, err
+	}
+
 	if err := dw.fixAndBreakChains(objectsToPack); err != nil {
 		return nil, err
 	}
@@ -119,6 +134,46 @@ func (dw *deltaSelector) objectsToPack(
 	return objectsToPack, nil
 }
 
+// appendBases appends to the objects the bases of the thin pack which are
+// not packed, as external objects. The bases missing from the storer are
+// ignored.
+func (dw *deltaSelector) appendBases(objectsToPack []*ObjectToPack) ([]*ObjectToPack, error) {
+	if len(dw.bases) == 0 {
+		return objectsToPack, nil
+	}
+
+	packed := make(map[plumbing.Hash]bool, len(objectsToPack))
+	for _, otp := range objectsToPack {
+		packed[otp.Hash()] = true
+	}
+
+	for _, h := range dw.bases {
+		if packed[h] {
+			continue
+		}
+
+		o, err := dw.encodedObject(h)
+		if errors.Is(err, plumbing.ErrObjectNotFound) {
+			continue
+		}
+
+		if err != nil {
+			return nil, err
+		}
+
+		if !applyDelta[o.Type()] {
+			continue
+		}
+
+		packed[h] = true
+		otp := newObjectToPack(o)
+		otp.external = true
+		objectsToPack = append(objectsToPack, otp)
+	}
+
+	return objectsToPack, nil
+}
+
 func (dw *deltaSelector) encodedDeltaObject(h plumbing.Hash) (plumbing.EncodedObject, error) {
 	edos, ok := dw.storer.(storer.DeltaObjectStorer)
 	if !ok {
@@ -177,6 +232,12 @@ func (dw *deltaSelector) fixAndBreakChainsOne(objectsToPack map[plumbing.Hash]*O
 		return err
 	}
 
+	// The reused delta would make the chain too long, so we break it here,
+	// the object being deltified again if a suitable base is found.
+	if int64(base.Depth) >= dw.maxDepth {
+		return dw.undeltify(otp)
+	}
+
 	otp.SetDelta(base, otp.Object)
 	return nil
 }
@@ -239,8 +300,9 @@ func (dw *deltaSelector) walk(
 
 		// If we already have a delta, we don't try to find a new one for this
 		// object. This happens when a delta is set to be reused from an existing
-		// packfile.
-		if target.IsDelta() {
+		// packfile. The external objects are not packed, so they are never
+		// deltified.
+		if target.IsDelta() || target.external {
 			continue
 		}
 
@@ -329,7 +391,7 @@ func (dw *deltaSelector) deltaSizeLimit(targetSize int64, baseDepth int,
 		// Evenly distribute delta size limits over allowed depth.
 		// If src is non-delta (depth = 0), delta <= 50% of original.
 		// If src is almost at limit (9/10), delta <= 10% of original.
-		return n * (maxDepth - int64(baseDepth)) / maxDepth
+		return n * (dw.maxDepth - int64(baseDepth)) / dw.maxDepth
 	}
 
 	// With a delta base chosen any new delta must be "better".
@@ -338,7 +400,7 @@ func (dw *deltaSelector) deltaSizeLimit(targetSize int64, baseDepth int,
 	n := targetSize
 
 	// If target depth is bigger than maxDepth, this delta is not suitable to be used.
-	if d >= maxDepth {
+	if d >= dw.maxDepth {
 		return 0
 	}
 
@@ -347,7 +409,7 @@ func (dw *deltaSelector) deltaSizeLimit(targetSize int64, baseDepth int,
 	//
 	// If src is near limit (depth=9/10) and base is whole (depth=0)
 	// a new delta dependent on src must be 1/10th the size.
-	return n * (maxDepth - int64(baseDepth)) / (maxDepth - d)
+	return n * (dw.maxDepth - int64(baseDepth)) / (dw.maxDepth - d)
 }
 
 type byTypeAndSize []*ObjectToPack
@@ -365,5 +427,11 @@ func (a byTypeAndSize) Less(i, j int) bool {
 		return true
 	}
 
+	// The external objects come first, so that they are in the window of
+	// the packed objects, as they are only used as bases.
+	if a[i].external != a[j].external {
+		return a[i].external
+	}
+
 	return a[i].Size() > a[j].Size()
 }
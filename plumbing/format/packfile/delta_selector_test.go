@@ -239,3 +239,23 @@ func (s *DeltaSelectorSuite) TestMaxDepth() {
 	dsl := s.ds.deltaSizeLimit(0, 0, int(maxDepth), true)
 	s.Equal(int64(0), dsl)
 }
+
+func (s *DeltaSelectorSuite) TestObjectsToPackMaxDepth() {
+	deltaWindowSize := uint(10)
+	hashes := []plumbing.Hash{s.hashes["o1"], s.hashes["o2"], s.hashes["o3"]}
+
+	s.ds.maxDepth = 1
+	otp, err := s.ds.ObjectsToPack(hashes, deltaWindowSize)
+	s.NoError(err)
+	s.Len(otp, 3)
+	for _, o := range otp {
+		s.LessOrEqual(o.Depth, 1)
+	}
+
+	s.ds.maxDepth = 0
+	otp, err = s.ds.ObjectsToPack(hashes, deltaWindowSize)
+	s.NoError(err)
+	for _, o := range otp {
+		s.False(o.IsDelta())
+	}
+}
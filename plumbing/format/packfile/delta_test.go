@@ -5,10 +5,14 @@ import (
 	"io"
 	"math/rand"
 	"testing"
+	"testing/iotest"
 
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 	"github.com/stretchr/testify/suite"
 
 	"github.com/go-git/go-git/v6/plumbing"
+	format "github.com/go-git/go-git/v6/plumbing/format/config"
 )
 
 type DeltaSuite struct {
@@ -142,6 +146,32 @@ func (s *DeltaSuite) TestAddDeltaReader() {
 	}
 }
 
+func (s *DeltaSuite) TestDeltaReader() {
+	for _, t := range s.testCases {
+		baseBuf := genBytes(t.base)
+		targetBuf := genBytes(t.target)
+		delta := DiffDelta(baseBuf, targetBuf)
+
+		s.T().Log("Executing test case:", t.description)
+
+		r, err := newDeltaReader(baseBuf, io.NopCloser(bytes.NewReader(delta)))
+		s.Require().NoError(err)
+
+		result, err := io.ReadAll(iotest.OneByteReader(r))
+		s.NoError(err)
+		s.NoError(r.Close())
+		s.Equal(targetBuf, result)
+
+		r, err = newDeltaReader(baseBuf, io.NopCloser(bytes.NewReader(delta[:len(delta)-2])))
+		s.Require().NoError(err)
+		_, err = io.ReadAll(r)
+		s.ErrorIs(err, ErrInvalidDelta)
+	}
+
+	_, err := newDeltaReader([]byte("foo"), io.NopCloser(bytes.NewReader(DiffDelta([]byte("bar!"), []byte("baz")))))
+	s.ErrorIs(err, ErrInvalidDelta)
+}
+
 func (s *DeltaSuite) TestIncompleteDelta() {
 	for _, t := range s.testCases {
 		s.T().Log("Incomplete delta on:", t.description)
@@ -193,13 +223,127 @@ func (s *DeltaSuite) TestMaxCopySizeDeltaReader() {
 	s.Equal(targetBuf, result)
 }
 
+func TestPatchDeltaMalformed(t *testing.T) {
+	t.Parallel()
+
+	src := []byte("0123456789")
+	for _, tc := range []struct {
+		name     string
+		delta    []byte
+		expected error
+	}{
+		{"huge result", []byte{10, 0x80, 0x80, 0x80, 0x80, 0x80, 0x80, 0x80, 0x80, 0x40, 1, 'a'}, ErrInvalidDelta},
+		{"other base", []byte{11, 1, 1, 'a'}, ErrInvalidDelta},
+		{"truncated size", []byte{10, 0x81, 0x81, 0x81}, ErrInvalidDelta},
+		{"copy out of the base", []byte{10, 4, 0x91, 8, 4}, ErrInvalidDelta},
+		{"copy overflowing", []byte{10, 4, 0xbf, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff}, ErrInvalidDelta},
+		{"copy past the result", []byte{10, 2, 0x91, 0, 4}, ErrInvalidDelta},
+		{"insertion past the result", []byte{10, 1, 2, 'a', 'b'}, ErrInvalidDelta},
+		{"truncated insertion", []byte{10, 4, 4, 'a', 'b'}, ErrInvalidDelta},
+		{"truncated copy", []byte{10, 4, 0x91, 0}, ErrInvalidDelta},
+		{"missing command", []byte{10, 4, 2, 'a', 'b'}, ErrInvalidDelta},
+		{"command past the result", []byte{10, 1, 1, 'a', 1, 'b'}, ErrInvalidDelta},
+		{"reserved command", []byte{10, 1, 0, 'a'}, ErrDeltaCmd},
+	} {
+		_, err := PatchDelta(src, tc.delta)
+		assert.ErrorIs(t, err, tc.expected, tc.name)
+
+		for name, r := range streamDelta(src, tc.delta) {
+			assert.Implements(t, (*error)(nil), r, "%s: %s", tc.name, name)
+		}
+	}
+
+	// A base copied in the order of the commands, and inserted bytes.
+	result, err := PatchDelta(src, []byte{10, 8, 0x91, 6, 4, 0x90, 2, 2, 'a', 'b'})
+	require.NoError(t, err)
+	assert.Equal(t, []byte("678901ab"), result)
+}
+
+// streamDelta applies the delta to src with the implementations streaming
+// the result, and returns their results or their errors by name.
+func streamDelta(src, delta []byte) map[string]any {
+	results := make(map[string]any)
+	result := func(name string, b []byte, err error) {
+		if err != nil {
+			results[name] = err
+		} else {
+			results[name] = b
+		}
+	}
+
+	base := &plumbing.MemoryObject{}
+	base.Write(src)
+	if r, err := ReaderFromDelta(base, bytes.NewReader(delta)); err != nil {
+		result("ReaderFromDelta", nil, err)
+	} else {
+		b, err := io.ReadAll(r)
+		result("ReaderFromDelta", b, err)
+	}
+
+	if r, err := newDeltaReader(src, io.NopCloser(bytes.NewReader(delta))); err != nil {
+		result("deltaReader", nil, err)
+	} else {
+		b, err := io.ReadAll(r)
+		result("deltaReader", b, err)
+	}
+
+	var buf bytes.Buffer
+	_, _, err := patchDeltaWriter(&buf, bytes.NewReader(src), bytes.NewReader(delta), plumbing.BlobObject, format.SHA1, nil)
+	result("patchDeltaWriter", buf.Bytes(), err)
+
+	return results
+}
+
 func FuzzPatchDelta(f *testing.F) {
 	f.Add([]byte("some value"), []byte("\n\f\fsomenewvalue"))
 	f.Add([]byte("some value"), []byte("\n\x0e\x0evalue"))
 	f.Add([]byte("some value"), []byte("\n\x0e\x0eva"))
 	f.Add([]byte("some value"), []byte("\n\x80\x80\x80\x80\x80\x802\x7fvalue"))
+	f.Add([]byte("some value"), []byte("\n\x08\x91\x06\x04\x90\x02\x02ab"))
+	f.Add([]byte("some value"), []byte("\n\x08\x91\x06\x04\x90\x02\x02ab\x01c"))
+
+	f.Fuzz(func(t *testing.T, src, delta []byte) {
+		result, err := PatchDelta(src, delta)
+		if len(delta) < minDeltaSize {
+			return
+		}
+
+		// All the implementations agree on the malformed deltas.
+		for name, r := range streamDelta(src, delta) {
+			if err != nil {
+				if _, ok := r.(error); !ok {
+					t.Fatalf("%s: no error, PatchDelta failed with %v", name, err)
+				}
+				continue
+			}
+
+			if !bytes.Equal(result, r.([]byte)) {
+				t.Fatalf("%s: %v, PatchDelta returned %q", name, r, result)
+			}
+		}
+	})
+}
 
-	f.Fuzz(func(t *testing.T, input1, input2 []byte) {
-		PatchDelta(input1, input2)
+func FuzzDiffDelta(f *testing.F) {
+	f.Add([]byte("some value"), []byte("some new value"))
+	f.Add([]byte(""), []byte("value"))
+	f.Add([]byte("0123456789abcdef0123456789abcdef"), []byte("abcdef0123456789abcdef0123456789"))
+
+	f.Fuzz(func(t *testing.T, src, tgt []byte) {
+		delta := DiffDelta(src, tgt)
+		result, err := PatchDelta(src, delta)
+		if err != nil {
+			// The deltas of the empty objects are shorter than the shortest
+			// delta accepted.
+			if len(delta) < minDeltaSize {
+				return
+			}
+
+			t.Fatalf("delta %q of %q to %q: %v", delta, src, tgt, err)
+		}
+
+		if !bytes.Equal(tgt, result) {
+			t.Fatalf("delta %q of %q to %q: %q", delta, src, tgt, result)
+		}
 	})
 }
@@ -76,7 +76,10 @@ func getDelta(index *deltaIndex, base, target plumbing.EncodedObject) (o plumbin
 	return delta, nil
 }
 
-// DiffDelta returns the delta that transforms src into tgt.
+// DiffDelta returns the delta that transforms src into tgt, in the binary
+// delta format of git applied by PatchDelta: the copies of the ranges of src
+// found in tgt, and the insertions of the other bytes of tgt. It is the delta
+// of GetDelta, for the contents of the objects.
 func DiffDelta(src, tgt []byte) []byte {
 	return diffDelta(new(deltaIndex), src, tgt)
 }
@@ -2,12 +2,10 @@ package packfile
 
 import (
 	"compress/zlib"
-	"crypto"
 	"fmt"
 	"io"
 
 	"github.com/go-git/go-git/v6/plumbing"
-	"github.com/go-git/go-git/v6/plumbing/hash"
 	"github.com/go-git/go-git/v6/plumbing/storer"
 	"github.com/go-git/go-git/v6/utils/binary"
 	"github.com/go-git/go-git/v6/utils/ioutil"
@@ -24,30 +22,62 @@ type Encoder struct {
 	useRefDeltas bool
 }
 
+// EncoderOption configures an Encoder.
+type EncoderOption func(*Encoder)
+
+// WithMaxDeltaDepth sets the maximum length of the delta chains of the
+// packfile, the number of deltas between an object and its full base, as
+// pack.depth does for git. The default is 50. The deltas reused from the
+// storer making longer chains are computed again, and a depth of 0 turns
+// off delta compression entirely.
+func WithMaxDeltaDepth(depth uint) EncoderOption {
+	return func(e *Encoder) {
+		e.selector.maxDepth = int64(depth)
+	}
+}
+
+// WithThinPack makes the packfile a thin pack, whose deltas may be based
+// on the given objects, which the receiver of the packfile has, such as the
+// objects of the parents of the packed commits. The bases are not written
+// to the packfile, and the deltas based on them are ref-deltas. The bases
+// missing from the storer are ignored.
+func WithThinPack(bases []plumbing.Hash) EncoderOption {
+	return func(e *Encoder) {
+		e.selector.bases = bases
+	}
+}
+
 // NewEncoder creates a new packfile encoder using a specific Writer and
 // EncodedObjectStorer. By default deltas used to generate the packfile will be
 // OFSDeltaObject. To use Reference deltas, set useRefDeltas to true.
-func NewEncoder(w io.Writer, s storer.EncodedObjectStorer, useRefDeltas bool) *Encoder {
+func NewEncoder(w io.Writer, s storer.EncodedObjectStorer, useRefDeltas bool, opts ...EncoderOption) *Encoder {
 	h := plumbing.Hasher{
-		// TODO: Support passing an ObjectFormat (sha256)
-		Hash: hash.New(crypto.SHA1),
+		Hash: newPackHash(storer.ObjectFormat(s)),
 	}
 	mw := io.MultiWriter(w, h)
 	ow := newOffsetWriter(mw)
 	zw := zlib.NewWriter(mw)
-	return &Encoder{
+	e := &Encoder{
 		selector:     newDeltaSelector(s),
 		w:            ow,
 		zw:           zw,
 		hasher:       h,
 		useRefDeltas: useRefDeltas,
 	}
+
+	for _, opt := range opts {
+		opt(e)
+	}
+
+	return e
 }
 
 // Encode creates a packfile containing all the objects referenced in
 // hashes and writes it to the writer in the Encoder.  `packWindow`
 // specifies the size of the sliding window used to compare objects
-// for delta compression; 0 turns off delta compression entirely.
+// for delta compression, as pack.window does for git; 0 turns off delta
+// compression entirely. The objects are compared with the objects of the
+// same type and similar size, and stored as deltas when these are smaller.
 func (e *Encoder) Encode(
 	hashes []plumbing.Hash,
 	packWindow uint,
@@ -60,8 +90,45 @@ func (e *Encoder) Encode(
 	return e.encode(objects)
 }
 
+// EncodeObject creates a packfile containing the single object of the given
+// type and size, whose content is read from r, and writes it to the writer in
+// the Encoder. The content is compressed as it is read, and not held in
+// memory, so that huge objects are packed with bounded memory.
+func (e *Encoder) EncodeObject(typ plumbing.ObjectType, size int64, r io.Reader) (plumbing.Hash, error) {
+	if err := e.head(1); err != nil {
+		return plumbing.ZeroHash, err
+	}
+
+	if err := e.entryHead(typ, size); err != nil {
+		return plumbing.ZeroHash, err
+	}
+
+	e.zw.Reset(e.w)
+	n, err := ioutil.CopyBufferPool(e.zw, r)
+	if err != nil {
+		return plumbing.ZeroHash, err
+	}
+
+	if n != size {
+		return plumbing.ZeroHash, fmt.Errorf("object content of %d bytes, expected %d", n, size)
+	}
+
+	if err := e.zw.Close(); err != nil {
+		return plumbing.ZeroHash, err
+	}
+
+	return e.footer()
+}
+
 func (e *Encoder) encode(objects []*ObjectToPack) (plumbing.Hash, error) {
-	if err := e.head(len(objects)); err != nil {
+	n := 0
+	for _, o := range objects {
+		if !o.external {
+			n++
+		}
+	}
+
+	if err := e.head(n); err != nil {
 		return plumbing.ZeroHash, err
 	}
 
@@ -94,7 +161,7 @@ func (e *Encoder) entry(o *ObjectToPack) (err error) {
 		o.BackToOriginal()
 	}
 
-	if o.IsWritten() {
+	if o.IsWritten() || o.external {
 		return nil
 	}
 
@@ -137,7 +204,7 @@ func (e *Encoder) entry(o *ObjectToPack) (err error) {
 }
 
 func (e *Encoder) writeBaseIfDelta(o *ObjectToPack) error {
-	if o.IsDelta() && !o.Base.IsWritten() {
+	if o.IsDelta() && !o.Base.IsWritten() && !o.Base.external {
 		// We must write base first
 		return e.entry(o.Base)
 	}
@@ -146,9 +213,11 @@ func (e *Encoder) writeBaseIfDelta(o *ObjectToPack) error {
 }
 
 func (e *Encoder) writeDeltaHeader(o *ObjectToPack) error {
-	// Write offset deltas by default
+	// Write offset deltas by default, the deltas based on external objects
+	// can only be ref-deltas.
+	useRefDeltas := e.useRefDeltas || o.Base.external
 	t := plumbing.OFSDeltaObject
-	if e.useRefDeltas {
+	if useRefDeltas {
 		t = plumbing.REFDeltaObject
 	}
 
@@ -156,7 +225,7 @@ func (e *Encoder) writeDeltaHeader(o *ObjectToPack) error {
 		return err
 	}
 
-	if e.useRefDeltas {
+	if useRefDeltas {
 		return e.writeRefDeltaHeader(o.Base.Hash())
 	} else {
 		return e.writeOfsDeltaHeader(o)
@@ -180,6 +249,13 @@ func (e *Encoder) writeOfsDeltaHeader(o *ObjectToPack) error {
 }
 
 func (e *Encoder) entryHead(typeNum plumbing.ObjectType, size int64) error {
+	_, err := e.w.Write(entryHeader(typeNum, size))
+	return err
+}
+
+// entryHeader returns the header of a packfile entry of the given type and
+// size.
+func entryHeader(typeNum plumbing.ObjectType, size int64) []byte {
 	t := int64(typeNum)
 	header := []byte{}
 	c := (t << firstLengthBits) | (size & maskFirstLength)
@@ -190,10 +266,7 @@ func (e *Encoder) entryHead(typeNum plumbing.ObjectType, size int64) error {
 		size >>= lengthBits
 	}
 
-	header = append(header, byte(c))
-	_, err := e.w.Write(header)
-
-	return err
+	return append(header, byte(c))
 }
 
 func (e *Encoder) footer() (plumbing.Hash, error) {
@@ -2,7 +2,14 @@ package packfile
 
 import (
 	"bytes"
+	"fmt"
 	"io"
+	"math/rand"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strconv"
 	"testing"
 
 	"github.com/go-git/go-billy/v6/memfs"
@@ -73,6 +80,25 @@ func (s *EncoderSuite) TestCorrectPackWithOneEmptyObject() {
 	s.Equal(expectedResult, result)
 }
 
+func (s *EncoderSuite) TestEncodeObject() {
+	content := bytes.Repeat([]byte("content\n"), 1<<12)
+	expected := newObject(plumbing.BlobObject, content)
+
+	_, err := s.enc.EncodeObject(plumbing.BlobObject, int64(len(content)), bytes.NewReader(content))
+	s.Require().NoError(err)
+
+	p, cleanup := packfileFromReader(s, s.buf)
+	defer cleanup()
+	obj, err := p.Get(expected.Hash())
+	s.Require().NoError(err)
+	objectsEqual(s, expected, obj)
+
+	// The content must be of the given size.
+	s.buf.Reset()
+	_, err = s.enc.EncodeObject(plumbing.BlobObject, 1, bytes.NewReader(content))
+	s.Error(err)
+}
+
 func (s *EncoderSuite) TestMaxObjectSize() {
 	o := s.store.NewEncodedObject()
 	o.SetSize(9223372036854775807)
@@ -325,3 +351,175 @@ func packfileFromReader(s *EncoderSuite, buf *bytes.Buffer) (*Packfile, func())
 		s.NoError(file.Close())
 	}
 }
+
+// minifiedVariants returns n variants of the same minified script, as
+// found in the repositories holding several builds of a bundle.
+func minifiedVariants(n int) [][]byte {
+	rnd := rand.New(rand.NewSource(42))
+	var base []byte
+	for i := 0; i < 1000; i++ {
+		base = fmt.Appendf(base, "var _%x=function(e,t){return e[%d]+t.%c%d||null};",
+			rnd.Uint32(), rnd.Intn(100), 'a'+rune(rnd.Intn(26)), rnd.Intn(1000))
+	}
+
+	variants := make([][]byte, 0, n)
+	for i := 0; i < n; i++ {
+		v := append([]byte(nil), base...)
+		for j := 0; j < 10; j++ {
+			copy(v[rnd.Intn(len(v)-8):], fmt.Sprintf("%08x", rnd.Uint32()))
+		}
+
+		variants = append(variants, fmt.Appendf(v, "/* build %d */", i))
+		base = v
+	}
+
+	return variants
+}
+
+func (s *EncoderSuite) storeBlobs(contents [][]byte) []plumbing.Hash {
+	hashes := make([]plumbing.Hash, 0, len(contents))
+	for _, c := range contents {
+		h, err := s.store.SetEncodedObject(newObject(plumbing.BlobObject, c))
+		s.Require().NoError(err)
+		hashes = append(hashes, h)
+	}
+
+	return hashes
+}
+
+func (s *EncoderSuite) TestEncodeSimilarBlobs() {
+	variants := minifiedVariants(30)
+	hashes := s.storeBlobs(variants)
+
+	_, err := NewEncoder(s.buf, s.store, false).Encode(hashes, 0)
+	s.Require().NoError(err)
+	fullSize := s.buf.Len()
+
+	buf := bytes.NewBuffer(nil)
+	_, err = NewEncoder(buf, s.store, false).Encode(hashes, 10)
+	s.Require().NoError(err)
+	s.Less(buf.Len()*5, fullSize)
+
+	p, cleanup := packfileFromReader(s, buf)
+	defer cleanup()
+	for i, h := range hashes {
+		o, err := p.Get(h)
+		s.Require().NoError(err)
+		r, err := o.Reader()
+		s.Require().NoError(err)
+		content, err := io.ReadAll(r)
+		s.Require().NoError(err)
+		s.Equal(variants[i], content)
+	}
+}
+
+func (s *EncoderSuite) TestEncodeMaxDeltaDepthGit() {
+	if _, err := exec.LookPath("git"); err != nil {
+		s.T().Skip("git not found")
+	}
+
+	hashes := s.storeBlobs(minifiedVariants(30))
+	for _, depth := range []uint{50, 3} {
+		dir := s.T().TempDir()
+		git := func(args ...string) string {
+			cmd := exec.Command("git", args...)
+			cmd.Dir = dir
+			out, err := cmd.CombinedOutput()
+			s.Require().NoError(err, string(out))
+			return string(out)
+		}
+
+		git("init", "-q", "--bare")
+		f, err := os.Create(filepath.Join(dir, "test.pack"))
+		s.Require().NoError(err)
+		_, err = NewEncoder(f, s.store, false, WithMaxDeltaDepth(depth)).Encode(hashes, 10)
+		s.Require().NoError(err)
+		s.Require().NoError(f.Close())
+
+		git("index-pack", "--strict", "test.pack")
+		out := git("verify-pack", "-v", "test.idx")
+
+		// The chains are reported as "chain length = N: M objects".
+		var maxChain uint
+		for _, m := range regexp.MustCompile(`chain length = (\d+)`).FindAllStringSubmatch(out, -1) {
+			n, err := strconv.ParseUint(m[1], 10, 32)
+			s.Require().NoError(err)
+			maxChain = max(maxChain, uint(n))
+		}
+
+		s.NotZero(maxChain)
+		s.LessOrEqual(maxChain, depth)
+	}
+}
+
+func (s *EncoderSuite) TestEncodeThinPack() {
+	variants := minifiedVariants(3)
+	hashes := s.storeBlobs(variants)
+
+	// The first variant, missing from the pack, is a base of the others.
+	_, err := NewEncoder(s.buf, s.store, false, WithThinPack(hashes[:1])).Encode(hashes[1:], 10)
+	s.Require().NoError(err)
+
+	scanner := NewScanner(bytes.NewReader(s.buf.Bytes()))
+	s.Require().True(scanner.Scan())
+	s.Equal(uint32(2), scanner.Data().Value().(Header).ObjectsQty)
+
+	var types []plumbing.ObjectType
+	for scanner.Scan() {
+		if scanner.Data().Section == ObjectSection {
+			types = append(types, scanner.Data().Value().(ObjectHeader).Type)
+		}
+	}
+
+	s.Require().NoError(scanner.Error())
+	s.Contains(types, plumbing.REFDeltaObject)
+
+	_, err = NewParser(bytes.NewReader(s.buf.Bytes())).Parse()
+	s.ErrorIs(err, ErrReferenceDeltaNotFound)
+
+	storage := memory.NewStorage()
+	p := NewParser(bytes.NewReader(s.buf.Bytes()), WithStorage(storage), WithThinPackBases(s.store))
+	_, err = p.Parse()
+	s.Require().NoError(err)
+	s.Equal(hashes[:1], p.ExternalBases())
+
+	for i, h := range hashes[1:] {
+		o, err := storage.EncodedObject(plumbing.BlobObject, h)
+		s.Require().NoError(err)
+		r, err := o.Reader()
+		s.Require().NoError(err)
+		content, err := io.ReadAll(r)
+		s.Require().NoError(err)
+		s.Equal(variants[i+1], content)
+	}
+}
+
+func BenchmarkEncodeSimilarBlobs(b *testing.B) {
+	store := memory.NewStorage()
+	var hashes []plumbing.Hash
+	for _, c := range minifiedVariants(50) {
+		h, err := store.SetEncodedObject(newObject(plumbing.BlobObject, c))
+		if err != nil {
+			b.Fatal(err)
+		}
+
+		hashes = append(hashes, h)
+	}
+
+	for _, window := range []uint{0, 10, 50} {
+		b.Run(fmt.Sprintf("window=%d", window), func(b *testing.B) {
+			b.ReportAllocs()
+			var size int
+			for i := 0; i < b.N; i++ {
+				buf := bytes.NewBuffer(nil)
+				if _, err := NewEncoder(buf, store, false).Encode(hashes, window); err != nil {
+					b.Fatal(err)
+				}
+
+				size = buf.Len()
+			}
+
+			b.ReportMetric(float64(size), "pack-bytes")
+		})
+	}
+}
@@ -1,6 +1,10 @@
 package packfile
 
-import "fmt"
+import (
+	"fmt"
+
+	"github.com/go-git/go-git/v6/plumbing"
+)
 
 // Error specifies errors returned during packfile parsing.
 type Error struct {
@@ -28,3 +32,29 @@ func (e *Error) AddDetails(format string, args ...any) *Error {
 		details: fmt.Sprintf(format, args...),
 	}
 }
+
+// CorruptionError is a corrupted object of a packfile, or its corrupted
+// checksum, or index. It is returned by Verify, and for each corrupted object
+// skipped by a Parser, see WithContinueOnError.
+type CorruptionError struct {
+	// Offset is the offset of the first corrupted object, or of the checksum
+	// of the packfile if the objects are valid.
+	Offset int64
+	// Hash is the hash of the corrupted object, if known.
+	Hash plumbing.Hash
+	// Err is the corruption found.
+	Err error
+}
+
+func (e *CorruptionError) Error() string {
+	if e.Hash.IsZero() {
+		return fmt.Sprintf("packfile corrupted at offset %d: %s", e.Offset, e.Err)
+	}
+
+	return fmt.Sprintf("packfile corrupted at offset %d, object %s: %s", e.Offset, e.Hash, e.Err)
+}
+
+// Unwrap returns the corruption found.
+func (e *CorruptionError) Unwrap() error {
+	return e.Err
+}
@@ -0,0 +1,119 @@
+package packfile
+
+import (
+	"encoding/binary"
+	"fmt"
+	"hash/crc32"
+	"io"
+
+	"github.com/go-git/go-git/v6/plumbing"
+	format "github.com/go-git/go-git/v6/plumbing/format/config"
+	"github.com/go-git/go-git/v6/utils/ioutil"
+	"github.com/go-git/go-git/v6/utils/sync"
+)
+
+// FixThinPack completes the thin pack in rw, whose deltas are based on
+// objects missing from it, by appending these objects, as `git index-pack
+// --fix-thin` does. The number of objects of the header of the packfile and
+// its checksum are updated, and the new checksum is returned.
+//
+// The observers are notified of the appended objects, and then of the new
+// checksum, so that an index built while the thin pack was parsed can be
+// completed.
+func FixThinPack(rw io.ReadWriteSeeker, bases []plumbing.EncodedObject, observers ...Observer) (h plumbing.Hash, err error) {
+	// The checksum is the one of the object format of the bases.
+	f := format.SHA1
+	if len(bases) > 0 && bases[0].Hash().Size() == format.SHA256Size {
+		f = format.SHA256
+	}
+
+	hasher := plumbing.Hasher{Hash: newPackHash(f)}
+	end, err := rw.Seek(-int64(hasher.Size()), io.SeekEnd)
+	if err != nil {
+		return h, err
+	}
+
+	// The objects overwrite the checksum.
+	offset := end
+	for _, o := range bases {
+		crc := crc32.NewIEEE()
+		w := newOffsetWriter(io.MultiWriter(rw, crc))
+		if _, err := w.Write(entryHeader(o.Type(), o.Size())); err != nil {
+			return h, err
+		}
+
+		if err := writeZlib(w, o); err != nil {
+			return h, err
+		}
+
+		for _, ob := range observers {
+			if err := ob.OnInflatedObjectHeader(o.Type(), o.Size(), offset); err != nil {
+				return h, err
+			}
+
+			if err := ob.OnInflatedObjectContent(o.Hash(), offset, crc.Sum32(), nil); err != nil {
+				return h, err
+			}
+		}
+
+		offset += w.Offset()
+	}
+
+	var header [12]byte
+	if _, err := rw.Seek(0, io.SeekStart); err != nil {
+		return h, err
+	}
+
+	if _, err := io.ReadFull(rw, header[:]); err != nil {
+		return h, err
+	}
+
+	count := binary.BigEndian.Uint32(header[8:]) + uint32(len(bases))
+	binary.BigEndian.PutUint32(header[8:], count)
+	if _, err := rw.Seek(0, io.SeekStart); err != nil {
+		return h, err
+	}
+
+	if _, err := rw.Write(header[:]); err != nil {
+		return h, err
+	}
+
+	if _, err := hasher.Write(header[:]); err != nil {
+		return h, err
+	}
+
+	if n, err := io.CopyN(hasher, rw, offset-int64(len(header))); err != nil {
+		return h, fmt.Errorf("reading packfile after %d bytes: %w", n, err)
+	}
+
+	h = hasher.Sum()
+	if _, err := h.WriteTo(rw); err != nil {
+		return h, err
+	}
+
+	for _, ob := range observers {
+		if err := ob.OnFooter(h); err != nil {
+			return h, err
+		}
+	}
+
+	return h, nil
+}
+
+func writeZlib(w io.Writer, o plumbing.EncodedObject) (err error) {
+	zw := sync.GetZlibWriter(w)
+	defer sync.PutZlibWriter(zw)
+
+	r, err := o.Reader()
+	if err != nil {
+		return err
+	}
+
+	defer ioutil.CheckClose(r, &err)
+
+	if _, err := ioutil.CopyBufferPool(zw, r); err != nil {
+		return err
+	}
+
+	return zw.Close()
+}
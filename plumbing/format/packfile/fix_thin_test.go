@@ -0,0 +1,194 @@
+package packfile
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"encoding/binary"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/go-git/go-git/v6/plumbing"
+	"github.com/go-git/go-git/v6/plumbing/format/idxfile"
+	"github.com/go-git/go-git/v6/storage/memory"
+	binutil "github.com/go-git/go-git/v6/utils/binary"
+)
+
+// thinPackEntry is an entry of a packfile written by writeThinPack. It is a
+// ref-delta if ref is set, an ofs-delta if ofs is set, to the entry at that
+// index, and a full object otherwise.
+type thinPackEntry struct {
+	object plumbing.EncodedObject
+	ref    plumbing.EncodedObject
+	ofs    int
+	isOfs  bool
+}
+
+// writeThinPack writes the entries as a packfile, the deltas being computed
+// against their bases.
+func writeThinPack(t *testing.T, entries []thinPackEntry) []byte {
+	t.Helper()
+
+	buf := bytes.NewBuffer(nil)
+	buf.Write(signature)
+	require.NoError(t, binary.Write(buf, binary.BigEndian, []uint32{VersionSupported, uint32(len(entries))}))
+
+	offsets := make([]int64, len(entries))
+	for i, e := range entries {
+		offsets[i] = int64(buf.Len())
+
+		var base plumbing.EncodedObject
+		switch {
+		case e.ref != nil:
+			base = e.ref
+		case e.isOfs:
+			base = entries[e.ofs].object
+		default:
+			buf.Write(entryHeader(e.object.Type(), e.object.Size()))
+			require.NoError(t, writeZlib(buf, e.object))
+			continue
+		}
+
+		delta, err := GetDelta(base, e.object)
+		require.NoError(t, err)
+
+		if e.ref != nil {
+			buf.Write(entryHeader(plumbing.REFDeltaObject, delta.Size()))
+			buf.Write(e.ref.Hash().Bytes())
+		} else {
+			buf.Write(entryHeader(plumbing.OFSDeltaObject, delta.Size()))
+			require.NoError(t, binutil.WriteVariableWidthInt(buf, offsets[i]-offsets[e.ofs]))
+		}
+
+		require.NoError(t, writeZlib(buf, delta))
+	}
+
+	sum := sha1.Sum(buf.Bytes())
+	buf.Write(sum[:])
+	return buf.Bytes()
+}
+
+func blob(content string) plumbing.EncodedObject {
+	return newObject(plumbing.BlobObject, []byte(content))
+}
+
+// rwBuffer is an io.ReadWriteSeeker on an in-memory packfile.
+type rwBuffer struct {
+	data []byte
+	pos  int64
+}
+
+func (b *rwBuffer) Read(p []byte) (int, error) {
+	r := bytes.NewReader(b.data[b.pos:])
+	n, err := r.Read(p)
+	b.pos += int64(n)
+	return n, err
+}
+
+func (b *rwBuffer) Write(p []byte) (int, error) {
+	end := b.pos + int64(len(p))
+	if end > int64(len(b.data)) {
+		b.data = append(b.data, make([]byte, end-int64(len(b.data)))...)
+	}
+
+	copy(b.data[b.pos:], p)
+	b.pos = end
+	return len(p), nil
+}
+
+func (b *rwBuffer) Seek(offset int64, whence int) (int64, error) {
+	r := bytes.NewReader(b.data)
+	_, _ = r.Seek(b.pos, 0)
+	pos, err := r.Seek(offset, whence)
+	if err == nil {
+		b.pos = pos
+	}
+
+	return pos, err
+}
+
+func TestParseAndFixThinPack(t *testing.T) {
+	t.Parallel()
+
+	content := bytes.Repeat([]byte("some content shared by all the objects\n"), 20)
+	external1 := blob(string(content) + "external 1")
+	external2 := blob(string(content) + "external 2")
+	a := blob(string(content) + "a")
+	b := blob(string(content) + "b")
+	c := blob(string(content) + "c")
+	f := blob(string(content) + "f")
+	g := blob(string(content) + "g")
+
+	// The base of b comes later in the pack, interleaved with the deltas
+	// based on external objects.
+	pack := writeThinPack(t, []thinPackEntry{
+		{object: b, ref: a},
+		{object: c, ref: external2},
+		{object: a, ref: external1},
+		{object: f},
+		{object: g, ofs: 3, isOfs: true},
+	})
+
+	_, err := NewParser(bytes.NewReader(pack)).Parse()
+	assert.ErrorIs(t, err, ErrReferenceDeltaNotFound)
+
+	bases := memory.NewStorage()
+	for _, o := range []plumbing.EncodedObject{external1, external2} {
+		_, err := bases.SetEncodedObject(o)
+		require.NoError(t, err)
+	}
+
+	storage := memory.NewStorage()
+	idx := new(idxfile.Writer)
+	p := NewParser(bytes.NewReader(pack), WithStorage(storage), WithThinPackBases(bases), WithScannerObservers(idx))
+	_, err = p.Parse()
+	require.NoError(t, err)
+
+	assert.ElementsMatch(t, []plumbing.Hash{external1.Hash(), external2.Hash()}, p.ExternalBases())
+	for _, o := range []plumbing.EncodedObject{a, b, c, f, g} {
+		obj, err := storage.EncodedObject(plumbing.AnyObject, o.Hash())
+		require.NoError(t, err)
+		assert.Equal(t, o.Size(), obj.Size())
+	}
+
+	for _, o := range []plumbing.EncodedObject{external1, external2} {
+		_, err := storage.EncodedObject(plumbing.AnyObject, o.Hash())
+		assert.ErrorIs(t, err, plumbing.ErrObjectNotFound)
+	}
+
+	rw := &rwBuffer{data: pack}
+	h, err := FixThinPack(rw, []plumbing.EncodedObject{external1, external2}, idx)
+	require.NoError(t, err)
+
+	index, err := idx.Index()
+	require.NoError(t, err)
+	count, err := index.Count()
+	require.NoError(t, err)
+	assert.Equal(t, int64(7), count)
+
+	p = NewParser(bytes.NewReader(rw.data))
+	checksum, err := p.Parse()
+	require.NoError(t, err)
+	assert.Equal(t, h, checksum)
+	assert.Empty(t, p.ExternalBases())
+
+	for _, o := range []plumbing.EncodedObject{a, b, c, f, g, external1, external2} {
+		_, err := index.FindOffset(o.Hash())
+		assert.NoError(t, err)
+	}
+
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not found")
+	}
+
+	dir := t.TempDir()
+	path := filepath.Join(dir, "fixed.pack")
+	require.NoError(t, os.WriteFile(path, rw.data, 0o644))
+	out, err := exec.Command("git", "index-pack", "--strict", path).CombinedOutput()
+	require.NoError(t, err, string(out))
+	assert.Contains(t, string(out), h.String())
+}
@@ -2,6 +2,7 @@ package packfile
 
 import (
 	"bufio"
+	"bytes"
 	"errors"
 	"io"
 	"os"
@@ -143,3 +144,87 @@ func (o *FSObject) Type() plumbing.ObjectType {
 func (o *FSObject) Writer() (io.WriteCloser, error) {
 	return nil, nil
 }
+
+// fsDeltaObject is an object from the packfile on the filesystem stored as a
+// delta, read by patching its base as its delta is inflated instead of being
+// held in memory.
+type fsDeltaObject struct {
+	hash          plumbing.Hash
+	base          plumbing.EncodedObject
+	size          int64
+	contentOffset int64
+	fs            billy.Filesystem
+	packPath      string
+}
+
+// Reader implements the plumbing.EncodedObject interface. The base is
+// inflated once in memory, and the delta is read from a new descriptor of
+// the packfile, so that the reader doesn't conflict with the other objects
+// of the packfile.
+func (o *fsDeltaObject) Reader() (io.ReadCloser, error) {
+	br, err := o.base.Reader()
+	if err != nil {
+		return nil, err
+	}
+
+	var buf bytes.Buffer
+	buf.Grow(int(o.base.Size()))
+	_, err = buf.ReadFrom(br)
+	if cerr := br.Close(); err == nil {
+		err = cerr
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	f, err := o.fs.Open(o.packPath)
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := f.Seek(o.contentOffset, io.SeekStart); err != nil {
+		_ = f.Close()
+		return nil, err
+	}
+
+	rbuf := sync.GetBufioReader(f)
+	zr, err := sync.GetZlibReader(rbuf)
+	if err != nil {
+		sync.PutBufioReader(rbuf)
+		_ = f.Close()
+		return nil, err
+	}
+
+	delta := &zlibReadCloser{r: zr, f: f, rbuf: rbuf}
+	r, err := newDeltaReader(buf.Bytes(), delta)
+	if err != nil {
+		_ = delta.Close()
+		return nil, err
+	}
+
+	return r, nil
+}
+
+// SetSize implements the plumbing.EncodedObject interface. This method
+// is a noop.
+func (o *fsDeltaObject) SetSize(int64) {}
+
+// SetType implements the plumbing.EncodedObject interface. This method is
+// a noop.
+func (o *fsDeltaObject) SetType(plumbing.ObjectType) {}
+
+// Hash implements the plumbing.EncodedObject interface.
+func (o *fsDeltaObject) Hash() plumbing.Hash { return o.hash }
+
+// Size implements the plumbing.EncodedObject interface.
+func (o *fsDeltaObject) Size() int64 { return o.size }
+
+// Type implements the plumbing.EncodedObject interface.
+func (o *fsDeltaObject) Type() plumbing.ObjectType { return o.base.Type() }
+
+// Writer implements the plumbing.EncodedObject interface. This method always
+// returns a nil writer.
+func (o *fsDeltaObject) Writer() (io.WriteCloser, error) {
+	return nil, nil
+}
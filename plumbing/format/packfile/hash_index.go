@@ -0,0 +1,129 @@
+package packfile
+
+import (
+	"sort"
+	"sync"
+
+	"github.com/go-git/go-git/v6/plumbing"
+)
+
+// HashIndex maps object hashes to their offsets in a packfile. It is
+// the reverse of OffsetIndex and follows the same design: entries are
+// kept in a single slice, which is lazily sorted by hash the first
+// time it is queried, or when Finalize is called.
+type HashIndex struct {
+	adding    sync.Mutex
+	m         sync.Mutex
+	entries   []offsetEntry
+	sortedLen int
+}
+
+func compareHash(a, b offsetEntry) int {
+	return a.hash.Compare(b.hash.Bytes())
+}
+
+// NewHashIndex returns a new HashIndex with room for capacity entries.
+func NewHashIndex(capacity int) *HashIndex {
+	return &HashIndex{
+		entries: make([]offsetEntry, 0, capacity),
+	}
+}
+
+// Add records that the object with hash h starts at the given offset.
+func (idx *HashIndex) Add(h plumbing.Hash, offset int64) {
+	idx.adding.Lock()
+	defer idx.adding.Unlock()
+	idx.m.Lock()
+	defer idx.m.Unlock()
+
+	idx.entries, idx.sortedLen = addEntry(idx.entries, idx.sortedLen,
+		offsetEntry{offset: offset, hash: h}, compareHash)
+}
+
+// LookupOffset returns the offset of the object with hash h. The index
+// is sorted first if needed.
+func (idx *HashIndex) LookupOffset(h plumbing.Hash) (int64, bool) {
+	idx.m.Lock()
+	defer idx.m.Unlock()
+
+	idx.sort()
+
+	b := h.Bytes()
+	i := sort.Search(len(idx.entries), func(i int) bool {
+		return idx.entries[i].hash.Compare(b) >= 0
+	})
+	if i < len(idx.entries) && idx.entries[i].hash.Equal(h) {
+		return idx.entries[i].offset, true
+	}
+
+	return 0, false
+}
+
+// Len returns the number of entries in the index.
+func (idx *HashIndex) Len() int {
+	idx.m.Lock()
+	defer idx.m.Unlock()
+
+	return len(idx.entries)
+}
+
+// Finalize eagerly sorts the index. See OffsetIndex.Finalize.
+func (idx *HashIndex) Finalize() error {
+	if !idx.adding.TryLock() {
+		return ErrIndexBusy
+	}
+	defer idx.adding.Unlock()
+	idx.m.Lock()
+	defer idx.m.Unlock()
+
+	idx.sort()
+	return nil
+}
+
+func (idx *HashIndex) sorted() bool {
+	return idx.sortedLen == len(idx.entries)
+}
+
+func (idx *HashIndex) sort() {
+	idx.sortedLen = sortEntries(idx.entries, idx.sortedLen, compareHash)
+}
+
+// IndexObserver is an Observer that builds both an OffsetIndex and a
+// HashIndex in a single pass, while a packfile is being parsed.
+type IndexObserver struct {
+	Offsets *OffsetIndex
+	Hashes  *HashIndex
+}
+
+// NewIndexObserver returns a new IndexObserver. The indexes are sized
+// once the packfile header is read.
+func NewIndexObserver() *IndexObserver {
+	return &IndexObserver{
+		Offsets: NewOffsetIndex(0),
+		Hashes:  NewHashIndex(0),
+	}
+}
+
+// OnHeader implements the Observer interface.
+func (o *IndexObserver) OnHeader(count uint32) error {
+	o.Offsets = NewOffsetIndex(int(count))
+	o.Hashes = NewHashIndex(int(count))
+	return nil
+}
+
+// OnInflatedObjectHeader implements the Observer interface.
+func (o *IndexObserver) OnInflatedObjectHeader(_ plumbing.ObjectType, _, _ int64) error {
+	return nil
+}
+
+// OnInflatedObjectContent implements the Observer interface.
+func (o *IndexObserver) OnInflatedObjectContent(h plumbing.Hash, pos int64, _ uint32, _ []byte) error {
+	o.Offsets.Add(pos, h)
+	o.Hashes.Add(h, pos)
+	return nil
+}
+
+// OnFooter implements the Observer interface.
+func (o *IndexObserver) OnFooter(_ plumbing.Hash) error {
+	return nil
+}
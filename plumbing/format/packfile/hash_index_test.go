@@ -0,0 +1,149 @@
+package packfile
+
+import (
+	"crypto/sha1"
+	"encoding/binary"
+	"testing"
+
+	fixtures "github.com/go-git/go-git-fixtures/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/go-git/go-git/v6/plumbing"
+)
+
+func TestHashIndexLookupOffset(t *testing.T) {
+	idx := NewHashIndex(3)
+	h1 := plumbing.NewHash("918c48b83bd081e863dbe1b80f8998f058cd8294")
+	h2 := plumbing.NewHash("6ecf0ef2c2dffb796033e5a02219af86ec6584e5")
+	h3 := plumbing.NewHash("af2d6a6954d532f8ffb47615169c8fdf9d383a1a")
+
+	idx.Add(h1, 286)
+	idx.Add(h2, 186)
+	idx.Add(h3, 449)
+	assert.Equal(t, 3, idx.Len())
+	assert.False(t, idx.sorted())
+
+	for h, want := range map[plumbing.Hash]int64{h1: 286, h2: 186, h3: 449} {
+		offset, ok := idx.LookupOffset(h)
+		assert.True(t, ok)
+		assert.Equal(t, want, offset)
+	}
+
+	_, ok := idx.LookupOffset(plumbing.NewHash("e8d3ffab552895c19b9fcf7aa264d277cde33881"))
+	assert.False(t, ok)
+}
+
+func TestIndexObserver(t *testing.T) {
+	f := fixtures.Basic().One()
+
+	obs := NewIndexObserver()
+	p := NewParser(f.Packfile(), WithScannerObservers(obs))
+	_, err := p.Parse()
+	require.NoError(t, err)
+
+	assert.Equal(t, 31, obs.Offsets.Len())
+	assert.Equal(t, 31, obs.Hashes.Len())
+
+	// 6ecf0ef2 is an ofs-delta, so it is only observed after objects
+	// at higher offsets.
+	h := plumbing.NewHash("6ecf0ef2c2dffb796033e5a02219af86ec6584e5")
+	got, ok := obs.Offsets.Lookup(186)
+	assert.True(t, ok)
+	assert.Equal(t, h, got)
+
+	offset, ok := obs.Hashes.LookupOffset(h)
+	assert.True(t, ok)
+	assert.Equal(t, int64(186), offset)
+}
+
+const benchmarkIndexSize = 1_000_000
+
+func benchmarkHashes(n int) []plumbing.Hash {
+	hashes := make([]plumbing.Hash, n)
+	var buf [8]byte
+	for i := range hashes {
+		binary.BigEndian.PutUint64(buf[:], uint64(i))
+		sum := sha1.Sum(buf[:])
+		hashes[i], _ = plumbing.FromBytes(sum[:])
+	}
+	return hashes
+}
+
+func BenchmarkHashIndexLookupOffset(b *testing.B) {
+	hashes := benchmarkHashes(benchmarkIndexSize)
+	idx := NewHashIndex(len(hashes))
+	for i, h := range hashes {
+		idx.Add(h, int64(i))
+	}
+	idx.sort()
+
+	i := 0
+	for b.Loop() {
+		if _, ok := idx.LookupOffset(hashes[i%len(hashes)]); !ok {
+			b.Fatal("hash not found")
+		}
+		i++
+	}
+}
+
+func BenchmarkHashMapLookupOffset(b *testing.B) {
+	hashes := benchmarkHashes(benchmarkIndexSize)
+	idx := make(map[plumbing.Hash]int64, len(hashes))
+	for i, h := range hashes {
+		idx[h] = int64(i)
+	}
+
+	i := 0
+	for b.Loop() {
+		if _, ok := idx[hashes[i%len(hashes)]]; !ok {
+			b.Fatal("hash not found")
+		}
+		i++
+	}
+}
+
+func BenchmarkHashIndexBuild(b *testing.B) {
+	hashes := benchmarkHashes(benchmarkIndexSize)
+	b.ReportAllocs()
+	for b.Loop() {
+		idx := NewHashIndex(len(hashes))
+		for i, h := range hashes {
+			idx.Add(h, int64(i))
+		}
+		idx.sort()
+	}
+}
+
+func BenchmarkHashMapBuild(b *testing.B) {
+	hashes := benchmarkHashes(benchmarkIndexSize)
+	b.ReportAllocs()
+	for b.Loop() {
+		idx := make(map[plumbing.Hash]int64, len(hashes))
+		for i, h := range hashes {
+			idx[h] = int64(i)
+		}
+	}
+}
+
+func TestHashIndexFinalize(t *testing.T) {
+	hashes := benchmarkHashes(100)
+	idx := NewHashIndex(len(hashes))
+	for i, h := range hashes {
+		idx.Add(h, int64(i))
+	}
+	assert.False(t, idx.sorted())
+
+	assert.NoError(t, idx.Finalize())
+	assert.True(t, idx.sorted())
+
+	for i, h := range hashes {
+		offset, ok := idx.LookupOffset(h)
+		assert.True(t, ok)
+		assert.Equal(t, int64(i), offset)
+	}
+
+	idx.adding.Lock()
+	assert.ErrorIs(t, idx.Finalize(), ErrIndexBusy)
+	idx.adding.Unlock()
+}
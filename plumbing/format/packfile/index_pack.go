@@ -0,0 +1,58 @@
+package packfile
+
+import (
+	"crypto"
+	"io"
+
+	"github.com/go-git/go-git/v6/plumbing"
+	"github.com/go-git/go-git/v6/plumbing/format/idxfile"
+	"github.com/go-git/go-git/v6/plumbing/format/revfile"
+	"github.com/go-git/go-git/v6/plumbing/hash"
+)
+
+// IndexPack reads the packfile and writes its index to idx, and its reverse
+// index to rev if it is not nil, as `git index-pack --rev-index` does, the
+// files C git expects next to the packfile as its .idx and .rev files. The
+// checksum of the packfile is returned.
+//
+// The packfile must hold the bases of all its deltas, thin packs being
+// completed first with FixThinPack. The options are added to the ones of the
+// parser of the packfile, as WithProgress.
+func IndexPack(pack io.Reader, idx, rev io.Writer, opts ...ParserOption) (plumbing.Hash, error) {
+	w := new(idxfile.Writer)
+	opts = append([]ParserOption{WithScannerObservers(w)}, opts...)
+	h, err := NewParser(pack, opts...).Parse()
+	if err != nil {
+		return plumbing.ZeroHash, err
+	}
+
+	return h, WriteIndex(w, idx, rev)
+}
+
+// WriteIndex writes the index built by w, observer of the parser of a
+// packfile, to idx in the version 2 format: the fanout table, the sorted
+// hashes, their CRC32 and their offsets, the ones past 2GiB in the table of
+// large offsets. The reverse index, mapping the position of the objects in
+// the packfile to their position in the index, is written to rev if it is
+// not nil.
+func WriteIndex(w *idxfile.Writer, idx, rev io.Writer) error {
+	index, err := w.Index()
+	if err != nil {
+		return err
+	}
+
+	if _, err := idxfile.NewEncoder(idx).Encode(index); err != nil {
+		return err
+	}
+
+	if rev == nil {
+		return nil
+	}
+
+	h := hash.New(crypto.SHA1)
+	if index.PackfileChecksum.Size() == crypto.SHA256.Size() {
+		h = hash.New(crypto.SHA256)
+	}
+
+	return revfile.Encode(rev, h, index)
+}
@@ -0,0 +1,95 @@
+package packfile
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+
+	fixtures "github.com/go-git/go-git-fixtures/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	format "github.com/go-git/go-git/v6/plumbing/format/config"
+)
+
+func TestIndexPack(t *testing.T) {
+	t.Parallel()
+
+	for _, f := range fixtures.Basic().ByTag("packfile") {
+		pack, err := io.ReadAll(f.Packfile())
+		require.NoError(t, err)
+		expected, err := io.ReadAll(f.Idx())
+		require.NoError(t, err)
+
+		var idx, rev bytes.Buffer
+		h, err := IndexPack(bytes.NewReader(pack), &idx, &rev)
+		require.NoError(t, err)
+		assert.Equal(t, f.PackfileHash, h.String())
+		assert.Equal(t, expected, idx.Bytes())
+		assert.NotEmpty(t, rev.Bytes())
+
+		// The reverse index is optional.
+		idx.Reset()
+		_, err = IndexPack(bytes.NewReader(pack), &idx, nil)
+		require.NoError(t, err)
+		assert.Equal(t, expected, idx.Bytes())
+	}
+}
+
+func TestIndexPackSHA256(t *testing.T) {
+	t.Parallel()
+
+	f := fixtures.ByTag("packfile-sha256").One()
+	pack, err := io.ReadAll(f.Packfile())
+	require.NoError(t, err)
+	expected, err := io.ReadAll(f.Idx())
+	require.NoError(t, err)
+
+	var idx bytes.Buffer
+	h, err := IndexPack(bytes.NewReader(pack), &idx, nil, WithObjectFormat(format.SHA256))
+	require.NoError(t, err)
+	assert.Equal(t, f.PackfileHash, h.String())
+	assert.Equal(t, expected, idx.Bytes())
+}
+
+func TestIndexPackGit(t *testing.T) {
+	t.Parallel()
+
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not found")
+	}
+
+	for _, f := range fixtures.Basic().ByTag("packfile") {
+		pack, err := io.ReadAll(f.Packfile())
+		require.NoError(t, err)
+
+		var idx, rev bytes.Buffer
+		_, err = IndexPack(bytes.NewReader(pack), &idx, &rev)
+		require.NoError(t, err)
+
+		// The files are the ones written by git.
+		dir := t.TempDir()
+		path := filepath.Join(dir, "pack-"+f.PackfileHash+".pack")
+		require.NoError(t, os.WriteFile(path, pack, 0o644))
+		out, err := exec.Command("git", "index-pack", "--rev-index", path).CombinedOutput()
+		require.NoError(t, err, string(out))
+
+		for ext, content := range map[string][]byte{".idx": idx.Bytes(), ".rev": rev.Bytes()} {
+			expected, err := os.ReadFile(filepath.Join(dir, "pack-"+f.PackfileHash+ext))
+			require.NoError(t, err)
+			assert.Equal(t, expected, content, ext)
+		}
+
+		// git reads them.
+		dir = t.TempDir()
+		path = filepath.Join(dir, "pack-"+f.PackfileHash+".pack")
+		require.NoError(t, os.WriteFile(path, pack, 0o644))
+		require.NoError(t, os.WriteFile(filepath.Join(dir, "pack-"+f.PackfileHash+".idx"), idx.Bytes(), 0o644))
+		require.NoError(t, os.WriteFile(filepath.Join(dir, "pack-"+f.PackfileHash+".rev"), rev.Bytes(), 0o644))
+		out, err = exec.Command("git", "verify-pack", path).CombinedOutput()
+		require.NoError(t, err, string(out))
+	}
+}
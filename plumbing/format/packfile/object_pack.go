@@ -24,6 +24,10 @@ type ObjectToPack struct {
 	// has not been written yet
 	Offset int64
 
+	// external is set for the objects the receiver of a thin pack has,
+	// which are only used as bases of deltas, and not written.
+	external bool
+
 	// Information from the original object
 	resolvedOriginal bool
 	originalType     plumbing.ObjectType
@@ -0,0 +1,176 @@
+package packfile
+
+import (
+	"cmp"
+	"errors"
+	"slices"
+	"sort"
+	"sync"
+
+	"github.com/go-git/go-git/v6/plumbing"
+)
+
+// ErrIndexBusy is returned by Finalize when entries are being added to
+// the index at the same time. Lookups never make Finalize fail.
+var ErrIndexBusy = errors.New("index is being modified")
+
+// OffsetIndex maps packfile offsets to object hashes.
+//
+// Entries are kept in a single slice, which is considerably cheaper
+// than a map for packfiles with millions of objects. The slice is only
+// sorted when it is first queried, so entries can be added in any
+// order while the packfile is being parsed. Entries added in
+// increasing offset order, as they are found when scanning a
+// packfile, are kept sorted as they arrive; only the out of order
+// entries need to be sorted and merged in on the next lookup.
+//
+// Callers that cannot afford to pay for that sort on their first
+// lookup should call Finalize once all entries were added.
+type OffsetIndex struct {
+	// adding is held by Add, so that Finalize can tell a concurrent Add
+	// from a concurrent lookup, which only holds m.
+	adding    sync.Mutex
+	m         sync.Mutex
+	entries   []offsetEntry
+	sortedLen int
+}
+
+type offsetEntry struct {
+	offset int64
+	hash   plumbing.Hash
+}
+
+func compareOffset(a, b offsetEntry) int {
+	return cmp.Compare(a.offset, b.offset)
+}
+
+// NewOffsetIndex returns a new OffsetIndex with room for capacity
+// entries.
+func NewOffsetIndex(capacity int) *OffsetIndex {
+	return &OffsetIndex{
+		entries: make([]offsetEntry, 0, capacity),
+	}
+}
+
+// Add records that the object with hash h starts at the given offset.
+func (idx *OffsetIndex) Add(offset int64, h plumbing.Hash) {
+	idx.adding.Lock()
+	defer idx.adding.Unlock()
+	idx.m.Lock()
+	defer idx.m.Unlock()
+
+	idx.entries, idx.sortedLen = addEntry(idx.entries, idx.sortedLen,
+		offsetEntry{offset: offset, hash: h}, compareOffset)
+}
+
+// Lookup returns the hash of the object that starts at the given
+// offset. The index is sorted first if needed.
+func (idx *OffsetIndex) Lookup(offset int64) (plumbing.Hash, bool) {
+	idx.m.Lock()
+	defer idx.m.Unlock()
+
+	idx.sort()
+
+	i := sort.Search(len(idx.entries), func(i int) bool {
+		return idx.entries[i].offset >= offset
+	})
+	if i < len(idx.entries) && idx.entries[i].offset == offset {
+		return idx.entries[i].hash, true
+	}
+
+	return plumbing.ZeroHash, false
+}
+
+// Len returns the number of entries in the index.
+func (idx *OffsetIndex) Len() int {
+	idx.m.Lock()
+	defer idx.m.Unlock()
+
+	return len(idx.entries)
+}
+
+// Range calls f for each entry in increasing offset order, until f
+// returns false. Like Lookup, Range sorts the index first if needed.
+// The entries are iterated from a copy of the index, so that the ones
+// added meanwhile, from within f or not, are left out.
+func (idx *OffsetIndex) Range(f func(offset int64, h plumbing.Hash) bool) {
+	idx.m.Lock()
+	idx.sort()
+	entries := slices.Clone(idx.entries)
+	idx.m.Unlock()
+
+	for _, e := range entries {
+		if !f(e.offset, e.hash) {
+			return
+		}
+	}
+}
+
+// Finalize eagerly sorts the index, so that the cost is not paid by
+// the next lookup. It is meant to be called once parsing is done,
+// possibly from a different goroutine; lookups made in the meantime
+// wait for it to finish, and Finalize waits for the ones in progress.
+// ErrIndexBusy is returned if an entry is being added at the same time.
+func (idx *OffsetIndex) Finalize() error {
+	if !idx.adding.TryLock() {
+		return ErrIndexBusy
+	}
+	defer idx.adding.Unlock()
+	idx.m.Lock()
+	defer idx.m.Unlock()
+
+	idx.sort()
+	return nil
+}
+
+func (idx *OffsetIndex) sorted() bool {
+	return idx.sortedLen == len(idx.entries)
+}
+
+func (idx *OffsetIndex) sort() {
+	idx.sortedLen = sortEntries(idx.entries, idx.sortedLen, compareOffset)
+}
+
+// addEntry appends e to entries, growing the sorted prefix of entries
+// if e does not break its order.
+func addEntry(entries []offsetEntry, sortedLen int, e offsetEntry,
+	cmp func(a, b offsetEntry) int,
+) ([]offsetEntry, int) {
+	n := len(entries)
+	if sortedLen == n && (n == 0 || cmp(entries[n-1], e) <= 0) {
+		sortedLen++
+	}
+
+	return append(entries, e), sortedLen
+}
+
+// sortEntries sorts the entries after the sorted prefix and merges them
+// into it, returning the new length of the sorted prefix.
+func sortEntries(entries []offsetEntry, sortedLen int,
+	cmp func(a, b offsetEntry) int,
+) int {
+	if sortedLen == len(entries) {
+		return sortedLen
+	}
+
+	tail := entries[sortedLen:]
+	slices.SortFunc(tail, cmp)
+	if sortedLen == 0 || cmp(entries[sortedLen-1], tail[0]) <= 0 {
+		return len(entries)
+	}
+
+	// Merge from the back, so that only the tail needs to be copied.
+	buf := slices.Clone(tail)
+	i, j := sortedLen-1, len(buf)-1
+	for k := len(entries) - 1; j >= 0; k-- {
+		if i >= 0 && cmp(entries[i], buf[j]) > 0 {
+			entries[k] = entries[i]
+			i--
+		} else {
+			entries[k] = buf[j]
+			j--
+		}
+	}
+
+	return len(entries)
+}
@@ -0,0 +1,154 @@
+package packfile
+
+import (
+	"slices"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/go-git/go-git/v6/plumbing"
+)
+
+func TestOffsetIndexLookup(t *testing.T) {
+	idx := NewOffsetIndex(3)
+	h1 := plumbing.NewHash("6ecf0ef2c2dffb796033e5a02219af86ec6584e5")
+	h2 := plumbing.NewHash("918c48b83bd081e863dbe1b80f8998f058cd8294")
+	h3 := plumbing.NewHash("af2d6a6954d532f8ffb47615169c8fdf9d383a1a")
+
+	idx.Add(12, h1)
+	idx.Add(300, h2)
+	idx.Add(150, h3)
+	assert.Equal(t, 3, idx.Len())
+
+	h, ok := idx.Lookup(150)
+	assert.True(t, ok)
+	assert.Equal(t, h3, h)
+
+	h, ok = idx.Lookup(300)
+	assert.True(t, ok)
+	assert.Equal(t, h2, h)
+
+	_, ok = idx.Lookup(13)
+	assert.False(t, ok)
+}
+
+func TestOffsetIndexAddAfterLookup(t *testing.T) {
+	idx := NewOffsetIndex(0)
+	h1 := plumbing.NewHash("6ecf0ef2c2dffb796033e5a02219af86ec6584e5")
+	h2 := plumbing.NewHash("918c48b83bd081e863dbe1b80f8998f058cd8294")
+
+	idx.Add(100, h1)
+	_, ok := idx.Lookup(100)
+	assert.True(t, ok)
+	assert.True(t, idx.sorted())
+
+	idx.Add(200, h1)
+	assert.True(t, idx.sorted())
+
+	idx.Add(50, h2)
+	assert.False(t, idx.sorted())
+
+	h, ok := idx.Lookup(50)
+	assert.True(t, ok)
+	assert.Equal(t, h2, h)
+}
+
+func TestOffsetIndexRange(t *testing.T) {
+	var idx OffsetIndex
+	idx.Add(30, plumbing.ZeroHash)
+	idx.Add(10, plumbing.ZeroHash)
+	idx.Add(20, plumbing.ZeroHash)
+
+	var offsets []int64
+	idx.Range(func(offset int64, _ plumbing.Hash) bool {
+		offsets = append(offsets, offset)
+		return true
+	})
+	assert.Equal(t, []int64{10, 20, 30}, offsets)
+
+	offsets = offsets[:0]
+	idx.Range(func(offset int64, _ plumbing.Hash) bool {
+		offsets = append(offsets, offset)
+		return len(offsets) < 2
+	})
+	assert.Equal(t, []int64{10, 20}, offsets)
+}
+
+func TestOffsetIndexRangeConcurrentAdd(t *testing.T) {
+	idx := NewOffsetIndex(0)
+	for offset := range int64(100) {
+		idx.Add(offset*2, plumbing.ZeroHash)
+	}
+
+	// The entries added out of order while ranging are sorted and merged in
+	// by the lookups, which must not change the entries being iterated.
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for offset := range int64(100) {
+			idx.Add(offset*2+1, plumbing.ZeroHash)
+			idx.Lookup(0)
+		}
+	}()
+
+	var offsets []int64
+	idx.Range(func(offset int64, _ plumbing.Hash) bool {
+		offsets = append(offsets, offset)
+		return true
+	})
+	wg.Wait()
+
+	assert.GreaterOrEqual(t, len(offsets), 100)
+	assert.True(t, slices.IsSorted(offsets))
+	assert.Equal(t, 200, idx.Len())
+}
+
+func TestOffsetIndexMergeOutOfOrder(t *testing.T) {
+	idx := NewOffsetIndex(0)
+	for _, offset := range []int64{10, 20, 40, 50, 45, 5, 30, 60} {
+		idx.Add(offset, plumbing.ZeroHash)
+	}
+	assert.Equal(t, 4, idx.sortedLen)
+
+	var offsets []int64
+	idx.Range(func(offset int64, _ plumbing.Hash) bool {
+		offsets = append(offsets, offset)
+		return true
+	})
+	assert.Equal(t, []int64{5, 10, 20, 30, 40, 45, 50, 60}, offsets)
+	assert.True(t, idx.sorted())
+}
+
+func TestOffsetIndexFinalize(t *testing.T) {
+	idx := NewOffsetIndex(0)
+	idx.Add(20, plumbing.ZeroHash)
+	idx.Add(10, plumbing.ZeroHash)
+	assert.False(t, idx.sorted())
+
+	assert.NoError(t, idx.Finalize())
+	assert.True(t, idx.sorted())
+
+	idx.adding.Lock()
+	assert.ErrorIs(t, idx.Finalize(), ErrIndexBusy)
+	idx.adding.Unlock()
+}
+
+func TestOffsetIndexFinalizeDuringLookup(t *testing.T) {
+	idx := NewOffsetIndex(0)
+	idx.Add(20, plumbing.ZeroHash)
+	idx.Add(10, plumbing.ZeroHash)
+
+	// A lookup in progress holds m: Finalize waits for it instead of
+	// failing with ErrIndexBusy.
+	idx.m.Lock()
+	done := make(chan error)
+	go func() { done <- idx.Finalize() }()
+	time.Sleep(10 * time.Millisecond)
+	idx.m.Unlock()
+
+	assert.NoError(t, <-done)
+	assert.True(t, idx.sorted())
+}
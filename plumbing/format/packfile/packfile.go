@@ -2,6 +2,7 @@ package packfile
 
 import (
 	"bufio"
+	"bytes"
 	"crypto"
 	"fmt"
 	"io"
@@ -34,12 +35,14 @@ type Packfile struct {
 	file    billy.File
 	scanner *Scanner
 
-	cache cache.Object
-	rbuf  *bufio.Reader
+	cache          cache.Object
+	deltaBaseCache *DeltaBaseCache
+	rbuf           *bufio.Reader
 
-	id           plumbing.Hash
-	m            sync.Mutex
-	objectIdSize int
+	id                   plumbing.Hash
+	m                    sync.Mutex
+	objectIdSize         int
+	largeObjectThreshold int64
 
 	once    sync.Once
 	onceErr error
@@ -88,18 +91,85 @@ func (p *Packfile) GetByOffset(offset int64) (plumbing.EncodedObject, error) {
 }
 
 // GetSizeByOffset retrieves the size of the encoded object from the
-// packfile with the given offset.
+// packfile with the given offset. Only the header of the object is read, and
+// the header of its delta if it is a delta, its content not being inflated.
 func (p *Packfile) GetSizeByOffset(offset int64) (size int64, err error) {
 	if err := p.init(); err != nil {
 		return 0, err
 	}
+	p.m.Lock()
+	defer p.m.Unlock()
 
-	d, err := p.GetByOffset(offset)
+	h, err := p.FindHash(offset)
 	if err != nil {
 		return 0, err
 	}
 
-	return d.Size(), nil
+	if obj, ok := p.cache.Get(h); ok {
+		return obj.Size(), nil
+	}
+
+	oh, err := p.headerFromOffset(offset)
+	if err != nil {
+		return 0, err
+	}
+
+	if !oh.Type.IsDelta() {
+		return oh.Size, nil
+	}
+
+	return p.scanner.deltaTargetSize(oh.ContentOffset)
+}
+
+// GetTypeByOffset retrieves the type of the encoded object at the given
+// offset, the one of its base for a delta, read from the headers of the
+// chain of deltas without inflating them.
+func (p *Packfile) GetTypeByOffset(offset int64) (plumbing.ObjectType, error) {
+	if err := p.init(); err != nil {
+		return plumbing.InvalidObject, err
+	}
+	p.m.Lock()
+	defer p.m.Unlock()
+
+	h, err := p.FindHash(offset)
+	if err != nil {
+		return plumbing.InvalidObject, err
+	}
+
+	if obj, ok := p.cache.Get(h); ok {
+		return obj.Type(), nil
+	}
+
+	// A chain of deltas can't be longer than the number of objects, unless
+	// the packfile is corrupted.
+	count, err := p.Count()
+	if err != nil {
+		return plumbing.InvalidObject, err
+	}
+
+	for range count {
+		oh, err := p.headerFromOffset(offset)
+		if err != nil {
+			return plumbing.InvalidObject, err
+		}
+
+		switch oh.Type {
+		case plumbing.OFSDeltaObject:
+			offset = oh.OffsetReference
+		case plumbing.REFDeltaObject:
+			if base, ok := p.cache.Get(oh.Reference); ok {
+				return base.Type(), nil
+			}
+
+			if offset, err = p.FindOffset(oh.Reference); err != nil {
+				return plumbing.InvalidObject, err
+			}
+		default:
+			return oh.Type, nil
+		}
+	}
+
+	return plumbing.InvalidObject, ErrInvalidObject.AddDetails("delta chain loops at offset %d", offset)
 }
 
 // GetAll returns an iterator with all encoded objects in the packfile.
@@ -213,7 +283,7 @@ func (p *Packfile) init() error {
 		opts := []ScannerOption{WithBufioReader(p.rbuf)}
 
 		if p.objectIdSize == format.SHA256Size {
-			opts = append(opts, WithSHA256())
+			opts = append(opts, WithScannerObjectFormat(format.SHA256))
 		}
 
 		p.scanner = NewScanner(p.file, opts...)
@@ -296,11 +366,71 @@ func (p *Packfile) objectFromHeader(oh *ObjectHeader) (plumbing.EncodedObject, e
 		return fs, nil
 	}
 
+	if oh.Type.IsDelta() && p.fs != nil && p.largeObjectThreshold > 0 {
+		obj, err := p.getLargeDeltaObject(oh)
+		if obj != nil || err != nil {
+			return obj, err
+		}
+	}
+
 	return p.getMemoryObject(oh)
 }
 
+// getLargeDeltaObject returns the object stored as the given delta as an
+// fsDeltaObject if it is larger than the large object threshold, or nil.
+func (p *Packfile) getLargeDeltaObject(oh *ObjectHeader) (plumbing.EncodedObject, error) {
+	size, err := p.scanner.deltaTargetSize(oh.ContentOffset)
+	if err != nil {
+		return nil, err
+	}
+
+	if size <= p.largeObjectThreshold {
+		return nil, nil
+	}
+
+	h, err := p.FindHash(oh.Offset)
+	if err != nil {
+		return nil, err
+	}
+
+	var base plumbing.EncodedObject
+	switch oh.Type {
+	case plumbing.REFDeltaObject:
+		var ok bool
+		base, ok = p.cache.Get(oh.Reference)
+		if !ok {
+			base, err = p.get(oh.Reference)
+		}
+	default:
+		base, err = p.getByOffset(oh.OffsetReference)
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf("cannot find base object: %w", err)
+	}
+
+	obj := &fsDeltaObject{
+		hash:          h,
+		base:          base,
+		size:          size,
+		contentOffset: oh.ContentOffset,
+		fs:            p.fs,
+		packPath:      p.file.Name(),
+	}
+
+	// As the large loose objects, the object is not cached, its size not
+	// being the one held in memory.
+	return obj, nil
+}
+
 func (p *Packfile) getMemoryObject(oh *ObjectHeader) (plumbing.EncodedObject, error) {
-	obj := new(plumbing.MemoryObject)
+	// The object is hashed with the object format of the packfile.
+	f := format.SHA1
+	if p.objectIdSize == format.SHA256Size {
+		f = format.SHA256
+	}
+
+	obj := plumbing.NewMemoryObject(plumbing.FromObjectFormat(f))
 	obj.SetSize(oh.Size)
 	obj.SetType(oh.Type)
 
@@ -315,25 +445,19 @@ func (p *Packfile) getMemoryObject(oh *ObjectHeader) (plumbing.EncodedObject, er
 		err = p.scanner.inflateContent(oh.ContentOffset, w)
 
 	case plumbing.REFDeltaObject, plumbing.OFSDeltaObject:
-		var parent plumbing.EncodedObject
-
-		switch oh.Type {
-		case plumbing.REFDeltaObject:
-			var ok bool
-			parent, ok = p.cache.Get(oh.Reference)
-			if !ok {
-				parent, err = p.get(oh.Reference)
-			}
-		case plumbing.OFSDeltaObject:
-			parent, err = p.getByOffset(oh.OffsetReference)
-		}
-
+		var typ plumbing.ObjectType
+		var base []byte
+		typ, base, err = p.deltaBase(oh)
 		if err != nil {
 			return nil, fmt.Errorf("cannot find base object: %w", err)
 		}
 
+		// The content of a header read before is inflated again, not
+		// appended to.
 		if oh.content == nil {
 			oh.content = gogitsync.GetBytesBuffer()
+		} else {
+			oh.content.Reset()
 		}
 
 		err = p.scanner.inflateContent(oh.ContentOffset, oh.content)
@@ -341,8 +465,8 @@ func (p *Packfile) getMemoryObject(oh *ObjectHeader) (plumbing.EncodedObject, er
 			return nil, fmt.Errorf("cannot inflate content: %w", err)
 		}
 
-		obj.SetType(parent.Type())
-		err = ApplyDelta(obj, parent, oh.content) //nolint:ineffassign
+		obj.SetType(typ)
+		err = patchDeltaObject(obj, base, oh.content.Bytes())
 
 	default:
 		err = ErrInvalidObject.AddDetails("type %q", oh.Type)
@@ -356,3 +480,54 @@ func (p *Packfile) getMemoryObject(oh *ObjectHeader) (plumbing.EncodedObject, er
 
 	return obj, nil
 }
+
+// deltaBase returns the type and the content of the base of the given delta,
+// from the delta base cache if it holds it, or else read and added to it.
+func (p *Packfile) deltaBase(oh *ObjectHeader) (plumbing.ObjectType, []byte, error) {
+	offset := oh.OffsetReference
+	if oh.Type == plumbing.REFDeltaObject {
+		if base, ok := p.cache.Get(oh.Reference); ok {
+			content, err := readObjectContent(base)
+			return base.Type(), content, err
+		}
+
+		var err error
+		if offset, err = p.FindOffset(oh.Reference); err != nil {
+			return plumbing.InvalidObject, nil, err
+		}
+	}
+
+	if typ, content, ok := p.deltaBaseCache.Get(p.id, offset); ok {
+		return typ, content, nil
+	}
+
+	base, err := p.getByOffset(offset)
+	if err != nil {
+		return plumbing.InvalidObject, nil, err
+	}
+
+	content, err := readObjectContent(base)
+	if err != nil {
+		return plumbing.InvalidObject, nil, err
+	}
+
+	p.deltaBaseCache.Put(p.id, offset, base.Type(), content)
+	return base.Type(), content, nil
+}
+
+// readObjectContent returns the content of the object.
+func readObjectContent(obj plumbing.EncodedObject) (_ []byte, err error) {
+	r, err := obj.Reader()
+	if err != nil {
+		return nil, err
+	}
+	defer ioutil.CheckClose(r, &err)
+
+	content := make([]byte, 0, obj.Size())
+	buf := bytes.NewBuffer(content)
+	if _, err := ioutil.CopyBufferPool(buf, r); err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
@@ -18,6 +18,17 @@ func WithCache(cache cache.Object) PackfileOption {
 	}
 }
 
+// WithDeltaBaseCache sets the cache of the bases of the deltas, holding the
+// contents of the bases resolved independently of the object cache, so that
+// the bases shared by many deltas are not inflated again once evicted from
+// it. The cache may be shared by several Packfiles, its contents being keyed
+// by packfile. If not used, the bases are only held by the object cache.
+func WithDeltaBaseCache(c *DeltaBaseCache) PackfileOption {
+	return func(p *Packfile) {
+		p.deltaBaseCache = c
+	}
+}
+
 // WithIdx sets the idxfile for the packfile.
 func WithIdx(idx idxfile.Index) PackfileOption {
 	return func(p *Packfile) {
@@ -41,3 +52,14 @@ func WithObjectIDSize(sz int) PackfileOption {
 		p.objectIdSize = sz
 	}
 }
+
+// WithLargeObjectThreshold sets the size, in bytes, above which the objects
+// stored as deltas are not held in memory: they are read by patching their
+// base as their delta is inflated, the base being held in memory. It
+// requires the filesystem to be set. If left unset or set to 0, all the
+// objects stored as deltas are held in memory.
+func WithLargeObjectThreshold(threshold int64) PackfileOption {
+	return func(p *Packfile) {
+		p.largeObjectThreshold = threshold
+	}
+}
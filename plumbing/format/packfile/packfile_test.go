@@ -269,6 +269,87 @@ func TestSize(t *testing.T) {
 	assert.Equal(t, int64(245), size)
 }
 
+func TestSizeOfAllObjects(t *testing.T) {
+	t.Parallel()
+
+	for _, f := range fixtures.Basic().ByTag("packfile") {
+		index := getIndexFromIdxFile(f.Idx())
+		c := cache.NewObjectLRUDefault()
+		p := packfile.NewPackfile(f.Packfile(),
+			packfile.WithIdx(index),
+			packfile.WithCache(c),
+		)
+
+		entries, err := index.EntriesByOffset()
+		require.NoError(t, err)
+
+		sizes := make(map[int64]int64)
+		for {
+			e, err := entries.Next()
+			if err == io.EOF {
+				break
+			}
+			require.NoError(t, err)
+
+			sizes[int64(e.Offset)], err = p.GetSizeByOffset(int64(e.Offset))
+			require.NoError(t, err)
+		}
+		require.NoError(t, entries.Close())
+
+		// The objects are not inflated to get their size.
+		assert.Zero(t, c.Stats().Objects)
+
+		for offset, size := range sizes {
+			obj, err := p.GetByOffset(offset)
+			require.NoError(t, err)
+			assert.Equal(t, obj.Size(), size)
+		}
+
+		require.NoError(t, p.Close())
+	}
+}
+
+func TestTypeOfAllObjects(t *testing.T) {
+	t.Parallel()
+
+	for _, f := range fixtures.Basic().ByTag("packfile") {
+		index := getIndexFromIdxFile(f.Idx())
+		c := cache.NewObjectLRUDefault()
+		p := packfile.NewPackfile(f.Packfile(),
+			packfile.WithIdx(index),
+			packfile.WithCache(c),
+		)
+
+		entries, err := index.EntriesByOffset()
+		require.NoError(t, err)
+
+		types := make(map[int64]plumbing.ObjectType)
+		for {
+			e, err := entries.Next()
+			if err == io.EOF {
+				break
+			}
+			require.NoError(t, err)
+
+			types[int64(e.Offset)], err = p.GetTypeByOffset(int64(e.Offset))
+			require.NoError(t, err)
+		}
+		require.NoError(t, entries.Close())
+
+		// Neither the objects nor the bases of the deltas are inflated to get
+		// their type.
+		assert.Zero(t, c.Stats().Objects)
+
+		for offset, typ := range types {
+			obj, err := p.GetByOffset(offset)
+			require.NoError(t, err)
+			assert.Equal(t, obj.Type(), typ)
+		}
+
+		require.NoError(t, p.Close())
+	}
+}
+
 func BenchmarkGetByOffset(b *testing.B) {
 	f := fixtures.Basic().One()
 	idx := idxfile.NewMemoryIndex(crypto.SHA1.Size())
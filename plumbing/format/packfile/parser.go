@@ -2,9 +2,13 @@ package packfile
 
 import (
 	"bytes"
+	"cmp"
+	"context"
 	"errors"
 	"fmt"
 	"io"
+	"runtime"
+	"slices"
 	stdsync "sync"
 
 	"github.com/go-git/go-git/v6/plumbing"
@@ -27,19 +31,42 @@ var (
 	ErrDeltaNotCached = errors.New("delta could not be found in cache")
 )
 
+// contextCheckInterval is the number of objects read, or deltas resolved,
+// between two checks of the context of the parser.
+const contextCheckInterval = 64
+
 // Parser decodes a packfile and calls any observer associated to it. Is used
 // to generate indexes.
 type Parser struct {
 	storage       storer.EncodedObjectStorer
+	bases         storer.EncodedObjectStorer
 	cache         *parserCache
 	lowMemoryMode bool
 
+	// externalBases are the bases of the deltas missing from the packfile.
+	externalBases []plumbing.Hash
+
+	// continueOnError is set for the corrupted objects to be skipped, and
+	// recorded in corruptions, the scan resuming at the next offset of
+	// offsets, if set.
+	continueOnError bool
+	offsets         []int64
+	corruptions     []*CorruptionError
+
 	scanner   *Scanner
 	observers []Observer
-	hasher    plumbing.Hasher
+	progress  ParserProgress
+	ctx       context.Context
+	format    format.ObjectFormat
+	workers   int
+	maxMemory int64
+	contents  *contentLRU
 
 	checksum plumbing.Hash
 	m        stdsync.Mutex
+	// shared guards the scanner and the storages while the deltas are
+	// resolved concurrently.
+	shared stdsync.Mutex
 }
 
 // LowMemoryCapable is implemented by storage types that are capable of
@@ -55,7 +82,7 @@ type LowMemoryCapable interface {
 // are parsed.
 func NewParser(data io.Reader, opts ...ParserOption) *Parser {
 	p := &Parser{
-		hasher: plumbing.NewHasher(format.SHA1, plumbing.AnyObject, 0),
+		workers: runtime.NumCPU(),
 	}
 	for _, opt := range opts {
 		if opt != nil {
@@ -63,7 +90,18 @@ func NewParser(data io.Reader, opts ...ParserOption) *Parser {
 		}
 	}
 
-	p.scanner = NewScanner(data)
+	// Unless set, the object format is the one of the storages.
+	if p.format == format.SHA1 {
+		if p.storage != nil {
+			p.format = storer.ObjectFormat(p.storage)
+		} else if p.bases != nil {
+			p.format = storer.ObjectFormat(p.bases)
+		}
+	}
+
+	p.scanner = NewScanner(data, WithScannerObjectFormat(p.format))
+	p.scanner.continueOnError = p.continueOnError
+	p.scanner.offsets = p.offsets
 
 	if p.storage != nil {
 		p.scanner.storage = p.storage
@@ -78,37 +116,41 @@ func NewParser(data io.Reader, opts ...ParserOption) *Parser {
 	p.scanner.lowMemoryMode = p.lowMemoryMode
 	p.cache = newParserCache()
 
+	// The delta data can only be dropped if it can be inflated again from
+	// the packfile, and is only read in high memory mode.
+	if p.maxMemory > 0 && p.scanner.seeker != nil && !p.lowMemoryMode {
+		p.contents = newContentLRU(p.maxMemory)
+	}
+
 	return p
 }
 
-func (p *Parser) storeOrCache(oh *ObjectHeader) error {
-	// Only need to store deltas, as the scanner already stored non-delta
-	// objects.
-	if p.storage != nil && oh.diskType.IsDelta() {
-		w, err := p.storage.RawObjectWriter(oh.Type, oh.Size)
-		if err != nil {
-			return err
-		}
+// storeDelta writes the resolved delta to the storage, if set, as the
+// scanner already stored the other objects.
+func (p *Parser) storeDelta(oh *ObjectHeader) error {
+	if p.storage == nil {
+		return nil
+	}
 
-		defer w.Close()
+	p.shared.Lock()
+	defer p.shared.Unlock()
 
-		_, err = ioutil.CopyBufferPool(w, oh.content)
-		if err != nil {
-			return err
-		}
+	w, err := p.storage.RawObjectWriter(oh.Type, oh.Size)
+	if err != nil {
+		return err
 	}
 
-	if p.cache != nil {
-		o := oh
-		for p.lowMemoryMode && o.content != nil {
-			sync.PutBytesBuffer(o.content)
-			o.content = nil
+	defer w.Close()
 
-			if o.parent == nil || o.parent.content == nil {
-				break
-			}
-			o = o.parent
-		}
+	// The content is kept for the deltas based on the object.
+	_, err = ioutil.CopyBufferPool(w, bytes.NewReader(oh.content.Bytes()))
+	return err
+}
+
+// cacheObject adds the parsed object to the cache, and notifies the
+// observers.
+func (p *Parser) cacheObject(oh *ObjectHeader) error {
+	if p.cache != nil {
 		p.cache.Add(oh)
 	}
 
@@ -136,17 +178,28 @@ func (p *Parser) Parse() (plumbing.Hash, error) {
 
 	var pendingDeltas []*ObjectHeader
 	var pendingDeltaREFs []*ObjectHeader
+	var objects, read uint32
 
 	for p.scanner.Scan() {
 		data := p.scanner.Data()
 		switch data.Section {
 		case HeaderSection:
 			header := data.Value().(Header)
+			objects = header.ObjectsQty
 
 			p.resetCache(int(header.ObjectsQty))
 			p.onHeader(header.ObjectsQty)
 
 		case ObjectSection:
+			read++
+			if err := p.checkContext(read); err != nil {
+				return plumbing.ZeroHash, err
+			}
+
+			if p.progress != nil {
+				p.progress.OnObjectRead(read, objects)
+			}
+
 			oh := data.Value().(ObjectHeader)
 			if oh.Type.IsDelta() {
 				switch oh.Type {
@@ -155,6 +208,8 @@ func (p *Parser) Parse() (plumbing.Hash, error) {
 				case plumbing.REFDeltaObject:
 					pendingDeltaREFs = append(pendingDeltaREFs, &oh)
 				}
+
+				p.contents.Hold(&oh)
 				continue
 			}
 
@@ -163,7 +218,7 @@ func (p *Parser) Parse() (plumbing.Hash, error) {
 				oh.content = nil
 			}
 
-			p.storeOrCache(&oh)
+			p.cacheObject(&oh)
 
 		case FooterSection:
 			p.checksum = data.Value().(plumbing.Hash)
@@ -174,18 +229,15 @@ func (p *Parser) Parse() (plumbing.Hash, error) {
 		return plumbing.ZeroHash, ErrEmptyPackfile
 	}
 
-	for _, oh := range pendingDeltaREFs {
-		err := p.processDelta(oh)
-		if err != nil {
-			return plumbing.ZeroHash, fmt.Errorf("processing ref-delta at offset %v: %w", oh.Offset, err)
-		}
+	// The corruptions are recorded by the scanner when the corrupted
+	// objects are skipped.
+	var cerr *CorruptionError
+	if err := p.scanner.Error(); err != nil && !errors.As(err, &cerr) {
+		return plumbing.ZeroHash, err
 	}
 
-	for _, oh := range pendingDeltas {
-		err := p.processDelta(oh)
-		if err != nil {
-			return plumbing.ZeroHash, fmt.Errorf("processing ofs-delta at offset %v: %w", oh.Offset, err)
-		}
+	if err := p.processDeltas(append(pendingDeltaREFs, pendingDeltas...)); err != nil {
+		return plumbing.ZeroHash, err
 	}
 
 	// Return to pool all objects used.
@@ -198,7 +250,83 @@ func (p *Parser) Parse() (plumbing.Hash, error) {
 		}
 	}()
 
-	return p.checksum, p.onFooter(p.checksum)
+	if !p.continueOnError {
+		return p.checksum, p.onFooter(p.checksum)
+	}
+
+	p.corruptions = slices.Concat(p.scanner.corruptions, p.corruptions)
+	slices.SortStableFunc(p.corruptions, func(a, b *CorruptionError) int {
+		return cmp.Compare(a.Offset, b.Offset)
+	})
+
+	// The checksum is not read if the packfile couldn't be read up to it.
+	if !p.checksum.IsZero() {
+		if err := p.onFooter(p.checksum); err != nil {
+			return p.checksum, err
+		}
+	}
+
+	errs := make([]error, len(p.corruptions))
+	for i, c := range p.corruptions {
+		errs[i] = c
+	}
+
+	return p.checksum, errors.Join(errs...)
+}
+
+// Corruptions returns the corrupted objects of the packfile, and its
+// corrupted checksum, skipped by the parser, by offset, see
+// WithContinueOnError. It must be called once Parse returns.
+func (p *Parser) Corruptions() []*CorruptionError {
+	return p.corruptions
+}
+
+// ExternalBases returns the hashes of the bases of the deltas missing from
+// the parsed packfile, a thin pack, which were read from the storage. It
+// must be called once Parse returns.
+func (p *Parser) ExternalBases() []plumbing.Hash {
+	var bases []plumbing.Hash
+	for _, h := range p.externalBases {
+		// The base may have been found in the packfile afterwards.
+		if oh := p.cache.oiByHash[h]; oh != nil && oh.externalRef {
+			bases = append(bases, h)
+		}
+	}
+
+	return bases
+}
+
+// checkContext returns the error of the context of the parser if it is done,
+// checking it only every contextCheckInterval objects or deltas.
+func (p *Parser) checkContext(n uint32) error {
+	if p.ctx == nil || n%contextCheckInterval != 0 {
+		return nil
+	}
+
+	return p.ctx.Err()
+}
+
+func deltaError(oh *ObjectHeader, err error) error {
+	return &deltaOffsetError{ref: oh.Type == plumbing.REFDeltaObject, offset: oh.Offset, err: err}
+}
+
+// deltaOffsetError is an error processing the delta at offset.
+type deltaOffsetError struct {
+	ref    bool
+	offset int64
+	err    error
+}
+
+func (e *deltaOffsetError) Error() string {
+	if e.ref {
+		return fmt.Sprintf("processing ref-delta at offset %v: %v", e.offset, e.err)
+	}
+
+	return fmt.Sprintf("processing ofs-delta at offset %v: %v", e.offset, e.err)
+}
+
+func (e *deltaOffsetError) Unwrap() error {
+	return e.err
 }
 
 func (p *Parser) ensureContent(oh *ObjectHeader) error {
@@ -223,7 +351,7 @@ func (p *Parser) ensureContent(oh *ObjectHeader) error {
 		deltaData := sync.GetBytesBuffer()
 		defer sync.PutBytesBuffer(deltaData)
 
-		err = p.scanner.inflateContent(oh.ContentOffset, deltaData)
+		err = p.inflateContent(oh.ContentOffset, deltaData)
 		if err != nil {
 			return fmt.Errorf("inflating content at offset %v: %w", oh.ContentOffset, err)
 		}
@@ -239,42 +367,6 @@ func (p *Parser) ensureContent(oh *ObjectHeader) error {
 	return nil
 }
 
-func (p *Parser) processDelta(oh *ObjectHeader) error {
-	switch oh.Type {
-	case plumbing.OFSDeltaObject:
-		pa, ok := p.cache.oiByOffset[oh.OffsetReference]
-		if !ok {
-			return plumbing.ErrObjectNotFound
-		}
-		oh.parent = pa
-
-	case plumbing.REFDeltaObject:
-		pa, ok := p.cache.oiByHash[oh.Reference]
-		if !ok {
-			// can't find referenced object in this pack file
-			// this must be a "thin" pack.
-			oh.parent = &ObjectHeader{ // Placeholder parent
-				Hash:        oh.Reference,
-				externalRef: true, // mark as an external reference that must be resolved
-				Type:        plumbing.AnyObject,
-				diskType:    plumbing.AnyObject,
-			}
-		} else {
-			oh.parent = pa
-		}
-		p.cache.oiByHash[oh.Reference] = oh.parent
-
-	default:
-		return fmt.Errorf("unsupported delta type: %v", oh.Type)
-	}
-
-	if err := p.ensureContent(oh); err != nil {
-		return err
-	}
-
-	return p.storeOrCache(oh)
-}
-
 // parentReader returns a [io.ReaderAt] for the decompressed contents
 // of the parent.
 func (p *Parser) parentReader(parent *ObjectHeader) (io.ReaderAt, error) {
@@ -286,33 +378,22 @@ func (p *Parser) parentReader(parent *ObjectHeader) (io.ReaderAt, error) {
 	// from either cache or storage, else we would need to inflate
 	// it to then inflate the current object, which could go on
 	// indefinitely.
-	if p.storage != nil && parent.Hash != plumbing.ZeroHash {
-		obj, err := p.storage.EncodedObject(parent.Type, parent.Hash)
-		if err == nil {
-			// Ensure that external references have the correct type and size.
-			parent.Type = obj.Type()
-			parent.Size = obj.Size()
-			r, err := obj.Reader()
-			if err == nil {
-				defer r.Close()
-
-				if parent.content == nil {
-					parent.content = sync.GetBytesBuffer()
-				}
-				parent.content.Grow(int(parent.Size))
+	if r, ok := p.readParent(p.storage, parent); ok {
+		return r, nil
+	}
 
-				_, err = ioutil.CopyBufferPool(parent.content, r)
-				if err == nil {
-					return bytes.NewReader(parent.content.Bytes()), nil
-				}
-			}
+	// The external references are only found in storage.
+	if parent.externalRef {
+		if r, ok := p.readParent(p.bases, parent); ok {
+			return r, nil
 		}
+
+		return nil, fmt.Errorf("%w: %s", ErrReferenceDeltaNotFound, parent.Hash)
 	}
 
-	// If the parent is not an external ref and we don't have the
-	// content offset, we won't be able to inflate via seeking through
-	// the packfile.
-	if !parent.externalRef && parent.ContentOffset == 0 {
+	// If we don't have the content offset, we won't be able to inflate
+	// via seeking through the packfile.
+	if parent.ContentOffset == 0 {
 		return nil, plumbing.ErrObjectNotFound
 	}
 
@@ -326,13 +407,62 @@ func (p *Parser) parentReader(parent *ObjectHeader) (io.ReaderAt, error) {
 	}
 	parent.content.Grow(int(parent.Size))
 
-	err := p.scanner.inflateContent(parent.ContentOffset, parent.content)
+	err := p.inflateContent(parent.ContentOffset, parent.content)
 	if err != nil {
 		return nil, ErrReferenceDeltaNotFound
 	}
+
+	p.contents.Pin(int64(parent.content.Len()))
 	return bytes.NewReader(parent.content.Bytes()), nil
 }
 
+// inflateContent inflates the content at the given offset of the packfile,
+// the scanner being shared by the goroutines resolving the deltas.
+func (p *Parser) inflateContent(offset int64, w io.Writer) error {
+	p.shared.Lock()
+	defer p.shared.Unlock()
+
+	return p.scanner.inflateContent(offset, w)
+}
+
+// readParent reads the content of the parent from the storage s, if set.
+func (p *Parser) readParent(s storer.EncodedObjectStorer, parent *ObjectHeader) (io.ReaderAt, bool) {
+	if s == nil || parent.Hash == plumbing.ZeroHash {
+		return nil, false
+	}
+
+	p.shared.Lock()
+	defer p.shared.Unlock()
+
+	obj, err := s.EncodedObject(parent.Type, parent.Hash)
+	if err != nil {
+		return nil, false
+	}
+
+	// Ensure that external references have the correct type and size.
+	parent.Type = obj.Type()
+	parent.Size = obj.Size()
+	r, err := obj.Reader()
+	if err != nil {
+		return nil, false
+	}
+
+	defer r.Close()
+
+	if parent.content == nil {
+		parent.content = sync.GetBytesBuffer()
+	}
+	parent.content.Reset()
+	parent.content.Grow(int(parent.Size))
+
+	if _, err := ioutil.CopyBufferPool(parent.content, r); err != nil {
+		return nil, false
+	}
+
+	p.contents.Pin(int64(parent.content.Len()))
+	return bytes.NewReader(parent.content.Bytes()), true
+}
+
 func (p *Parser) applyPatchBaseHeader(ota *ObjectHeader, delta io.Reader, target io.Writer, wh objectHeaderWriter) error {
 	if target == nil {
 		return fmt.Errorf("cannot apply patch against nil target")
@@ -348,7 +478,7 @@ func (p *Parser) applyPatchBaseHeader(ota *ObjectHeader, delta io.Reader, target
 		typ = ota.parent.Type
 	}
 
-	sz, h, err := patchDeltaWriter(target, parentContents, delta, typ, wh)
+	sz, h, err := patchDeltaWriter(target, parentContents, delta, typ, p.format, wh)
 	if err != nil {
 		return err
 	}
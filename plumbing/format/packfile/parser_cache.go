@@ -1,9 +1,12 @@
 package packfile
 
 import (
+	"container/list"
 	"slices"
+	stdsync "sync"
 
 	"github.com/go-git/go-git/v6/plumbing"
+	"github.com/go-git/go-git/v6/utils/sync"
 )
 
 func newParserCache() *parserCache {
@@ -39,3 +42,97 @@ func (c *parserCache) Reset(n int) {
 		clear(c.oiByOffset)
 	}
 }
+
+// contentLRU accounts the size of the inflated contents held by the parser,
+// bounded by WithMaxMemory. The delta data read from the packfile is held
+// until the delta is resolved, and dropped, least recently read first, once
+// the limit is exceeded: it is then inflated again from the packfile when
+// the delta is resolved. Unlike the parserCache, it is safe for concurrent
+// use by the goroutines resolving the deltas.
+type contentLRU struct {
+	m     stdsync.Mutex
+	max   int64
+	size  int64
+	peak  int64
+	ll    *list.List
+	elems map[*ObjectHeader]*list.Element
+}
+
+func newContentLRU(max int64) *contentLRU {
+	return &contentLRU{
+		max:   max,
+		ll:    list.New(),
+		elems: make(map[*ObjectHeader]*list.Element),
+	}
+}
+
+// Hold adds the content of the object, which may be dropped until it is
+// taken.
+func (c *contentLRU) Hold(oh *ObjectHeader) {
+	if c == nil || oh.content == nil {
+		return
+	}
+
+	c.m.Lock()
+	defer c.m.Unlock()
+
+	c.elems[oh] = c.ll.PushFront(oh)
+	c.add(int64(oh.content.Len()))
+}
+
+// Take removes the content of the object from the contents which may be
+// dropped, as it is about to be used. The content is nil if it was dropped.
+func (c *contentLRU) Take(oh *ObjectHeader) {
+	if c == nil {
+		return
+	}
+
+	c.m.Lock()
+	defer c.m.Unlock()
+
+	if e, ok := c.elems[oh]; ok {
+		c.ll.Remove(e)
+		delete(c.elems, oh)
+		c.size -= int64(oh.content.Len())
+	}
+}
+
+// Pin accounts n bytes of contents being used, which cannot be dropped.
+func (c *contentLRU) Pin(n int64) {
+	if c == nil {
+		return
+	}
+
+	c.m.Lock()
+	defer c.m.Unlock()
+
+	c.add(n)
+}
+
+// Unpin accounts n bytes of contents no longer used, which were pinned.
+func (c *contentLRU) Unpin(n int64) {
+	if c == nil {
+		return
+	}
+
+	c.m.Lock()
+	defer c.m.Unlock()
+
+	c.size -= n
+}
+
+// add accounts n bytes of contents, dropping the least recently held ones
+// while the limit is exceeded.
+func (c *contentLRU) add(n int64) {
+	c.size += n
+	for c.size > c.max && c.ll.Len() > 0 {
+		oh := c.ll.Remove(c.ll.Back()).(*ObjectHeader)
+		delete(c.elems, oh)
+
+		c.size -= int64(oh.content.Len())
+		sync.PutBytesBuffer(oh.content)
+		oh.content = nil
+	}
+
+	c.peak = max(c.peak, c.size)
+}
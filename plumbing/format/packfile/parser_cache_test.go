@@ -0,0 +1,55 @@
+package packfile
+
+import (
+	"io"
+	"testing"
+
+	fixtures "github.com/go-git/go-git-fixtures/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/go-git/go-git/v6/plumbing/format/idxfile"
+)
+
+func TestParserMaxMemory(t *testing.T) {
+	t.Parallel()
+
+	f := fixtures.ByURL("https://github.com/spinnaker/spinnaker.git").ByTag("packfile").One()
+
+	parse := func(opts ...ParserOption) (*Parser, *idxfile.MemoryIndex) {
+		w := new(idxfile.Writer)
+		p := NewParser(f.Packfile(), append(opts, WithScannerObservers(w), WithWorkers(1))...)
+
+		checksum, err := p.Parse()
+		require.NoError(t, err)
+		assert.Equal(t, f.PackfileHash, checksum.String())
+
+		idx, err := w.Index()
+		require.NoError(t, err)
+		return p, idx
+	}
+
+	// Without a limit, the delta data is held until the deltas are resolved.
+	unbounded, expected := parse(WithMaxMemory(1 << 40))
+
+	const limit = 256 << 10
+	require.Greater(t, unbounded.contents.peak, int64(limit))
+
+	p, idx := parse(WithMaxMemory(limit))
+	assert.Equal(t, expected, idx)
+	assert.LessOrEqual(t, p.contents.peak, int64(limit))
+	assert.Zero(t, p.contents.size)
+	assert.Zero(t, p.contents.ll.Len())
+}
+
+func TestParserMaxMemoryNotSeekable(t *testing.T) {
+	t.Parallel()
+
+	f := fixtures.Basic().One()
+	p := NewParser(struct{ io.Reader }{f.Packfile()}, WithMaxMemory(1))
+	assert.Nil(t, p.contents)
+
+	checksum, err := p.Parse()
+	require.NoError(t, err)
+	assert.Equal(t, f.PackfileHash, checksum.String())
+}
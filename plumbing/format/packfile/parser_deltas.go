@@ -0,0 +1,355 @@
+package packfile
+
+import (
+	"fmt"
+	"slices"
+	stdsync "sync"
+
+	"github.com/go-git/go-git/v6/plumbing"
+	"github.com/go-git/go-git/v6/plumbing/storer"
+	"github.com/go-git/go-git/v6/utils/sync"
+)
+
+// deltaResolver resolves the deltas of a packfile as a tree, whose roots are
+// the objects of the packfile which are not deltas, and the bases missing
+// from the packfile. The subtrees of the roots are independent, and resolved
+// concurrently by the workers of the parser, each subtree depth first by a
+// single worker: only the contents of the bases of the deltas being resolved
+// are held in memory.
+type deltaResolver struct {
+	p *Parser
+	// byOffset are the ofs-deltas by the offset of their base.
+	byOffset map[int64][]*ObjectHeader
+
+	mu stdsync.Mutex
+	// byHash are the ref-deltas by the hash of their base, which are
+	// removed once the base is resolved, as several objects of the packfile
+	// may have the same hash.
+	byHash   map[plumbing.Hash][]*ObjectHeader
+	resolved uint32
+	total    uint32
+	err      error
+	// corrupted are the deltas which couldn't be resolved, if the corrupted
+	// objects are skipped, with their error.
+	corrupted map[*ObjectHeader]error
+}
+
+func newDeltaResolver(p *Parser, pending []*ObjectHeader) *deltaResolver {
+	r := &deltaResolver{
+		p:         p,
+		byOffset:  make(map[int64][]*ObjectHeader),
+		byHash:    make(map[plumbing.Hash][]*ObjectHeader),
+		total:     uint32(len(pending)),
+		corrupted: make(map[*ObjectHeader]error),
+	}
+
+	for _, oh := range pending {
+		switch oh.Type {
+		case plumbing.OFSDeltaObject:
+			r.byOffset[oh.OffsetReference] = append(r.byOffset[oh.OffsetReference], oh)
+		case plumbing.REFDeltaObject:
+			r.byHash[oh.Reference] = append(r.byHash[oh.Reference], oh)
+		}
+	}
+
+	return r
+}
+
+// processDeltas resolves the deltas, first from the objects of the packfile,
+// and then from the bases missing from it, read from the storage, as the
+// base of a ref-delta may be anywhere in the packfile. The deltas are then
+// added to the cache, and notified to the observers, in the given order.
+func (p *Parser) processDeltas(pending []*ObjectHeader) error {
+	if len(pending) == 0 {
+		return nil
+	}
+
+	if err := p.checkContext(0); err != nil {
+		return err
+	}
+
+	r := newDeltaResolver(p, pending)
+
+	var roots []*ObjectHeader
+	for _, oh := range p.cache.oi {
+		if r.hasChildren(oh) {
+			roots = append(roots, oh)
+		}
+	}
+
+	if err := r.run(roots); err != nil {
+		return err
+	}
+
+	if err := r.run(r.externalRoots(pending)); err != nil {
+		return err
+	}
+
+	if p.continueOnError {
+		pending = r.skipCorrupted(pending)
+	}
+
+	// None of the deltas left can be resolved: their bases are neither in
+	// the packfile nor in the storage.
+	for _, oh := range pending {
+		if oh.Type == plumbing.REFDeltaObject && oh.Hash.IsZero() {
+			return deltaError(oh, fmt.Errorf("%w: %s", ErrReferenceDeltaNotFound, oh.Reference))
+		}
+	}
+
+	for _, oh := range pending {
+		if oh.Hash.IsZero() {
+			return deltaError(oh, plumbing.ErrObjectNotFound)
+		}
+	}
+
+	for _, oh := range pending {
+		if err := p.cacheObject(oh); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// skipCorrupted records the deltas which couldn't be resolved as corrupted,
+// the ones which couldn't be applied, and the ones whose base is missing or
+// corrupted, and returns the resolved ones.
+func (r *deltaResolver) skipCorrupted(pending []*ObjectHeader) []*ObjectHeader {
+	var resolved []*ObjectHeader
+	for _, oh := range pending {
+		if !oh.Hash.IsZero() {
+			resolved = append(resolved, oh)
+			continue
+		}
+
+		err, ok := r.corrupted[oh]
+		switch {
+		case ok:
+		case oh.Type == plumbing.REFDeltaObject:
+			err = fmt.Errorf("%w: %s", ErrReferenceDeltaNotFound, oh.Reference)
+		default:
+			err = fmt.Errorf("%w: delta base at offset %d", plumbing.ErrObjectNotFound, oh.OffsetReference)
+		}
+
+		r.p.corruptions = append(r.p.corruptions, &CorruptionError{Offset: oh.Offset, Err: err})
+	}
+
+	return resolved
+}
+
+// externalRoots returns placeholders of the bases of the ref-deltas left,
+// which are missing from the packfile but can be read from the storage.
+func (r *deltaResolver) externalRoots(pending []*ObjectHeader) []*ObjectHeader {
+	var refs []plumbing.Hash
+	for _, oh := range pending {
+		if oh.Type != plumbing.REFDeltaObject || !oh.Hash.IsZero() {
+			continue
+		}
+
+		if _, ok := r.byHash[oh.Reference]; ok {
+			refs = append(refs, oh.Reference)
+		}
+	}
+
+	if len(refs) == 0 {
+		return nil
+	}
+
+	external := r.externalBases(refs)
+	var roots []*ObjectHeader
+	for _, oh := range pending {
+		if oh.Type != plumbing.REFDeltaObject || !oh.Hash.IsZero() || !external[oh.Reference] {
+			continue
+		}
+
+		if base := r.p.cache.oiByHash[oh.Reference]; base != nil && base.externalRef {
+			continue
+		}
+
+		base := &ObjectHeader{
+			Hash:        oh.Reference,
+			externalRef: true, // mark as an external reference that must be resolved
+			Type:        plumbing.AnyObject,
+			diskType:    plumbing.AnyObject,
+		}
+
+		r.p.externalBases = append(r.p.externalBases, oh.Reference)
+		r.p.cache.oiByHash[oh.Reference] = base
+		roots = append(roots, base)
+	}
+
+	return roots
+}
+
+// externalBases returns whether each of the given bases missing from the
+// packfile can be read from the storage, checking them at once.
+func (r *deltaResolver) externalBases(hashes []plumbing.Hash) map[plumbing.Hash]bool {
+	external := make(map[plumbing.Hash]bool, len(hashes))
+	for _, s := range []storer.EncodedObjectStorer{r.p.storage, r.p.bases} {
+		if s == nil || len(hashes) == 0 {
+			continue
+		}
+
+		found, err := storer.HasObjects(s, hashes)
+		if err != nil {
+			continue
+		}
+
+		hashes = slices.DeleteFunc(hashes, func(h plumbing.Hash) bool {
+			external[h] = found[h]
+			return found[h]
+		})
+	}
+
+	return external
+}
+
+// run resolves the deltas based on the given roots, directly or not, with
+// the workers of the parser.
+func (r *deltaResolver) run(roots []*ObjectHeader) error {
+	if len(roots) == 0 {
+		return nil
+	}
+
+	jobs := make(chan *ObjectHeader)
+	var wg stdsync.WaitGroup
+	for range min(max(r.p.workers, 1), len(roots)) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			for base := range jobs {
+				if r.failed() {
+					continue
+				}
+
+				if err := r.resolveChildren(base); err != nil {
+					r.fail(err)
+				}
+			}
+		}()
+	}
+
+	for _, base := range roots {
+		jobs <- base
+	}
+
+	close(jobs)
+	wg.Wait()
+
+	return r.err
+}
+
+// resolveChildren resolves the deltas based on base, depth first, and then
+// releases the content of base, which is no longer needed.
+func (r *deltaResolver) resolveChildren(base *ObjectHeader) error {
+	defer func() {
+		if base.content != nil {
+			r.p.contents.Unpin(int64(base.content.Len()))
+			sync.PutBytesBuffer(base.content)
+			base.content = nil
+		}
+	}()
+
+	for _, oh := range r.children(base) {
+		if r.failed() {
+			return nil
+		}
+
+		oh.parent = base
+		r.p.contents.Take(oh)
+		if err := r.p.ensureContent(oh); err != nil {
+			if !r.p.continueOnError {
+				return deltaError(oh, err)
+			}
+
+			// The deltas based on the corrupted one are left unresolved.
+			r.corrupt(oh, err)
+			continue
+		}
+
+		r.p.contents.Pin(int64(oh.content.Len()))
+
+		if err := r.p.storeDelta(oh); err != nil {
+			return deltaError(oh, err)
+		}
+
+		if err := r.onResolved(); err != nil {
+			return err
+		}
+
+		if err := r.resolveChildren(oh); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// hasChildren returns whether deltas are based on the object.
+func (r *deltaResolver) hasChildren(oh *ObjectHeader) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	_, ok := r.byHash[oh.Hash]
+	return ok || len(r.byOffset[oh.Offset]) > 0
+}
+
+// children returns the deltas based on base, the ref-deltas being claimed so
+// that they are only resolved once.
+func (r *deltaResolver) children(base *ObjectHeader) []*ObjectHeader {
+	var children []*ObjectHeader
+	if !base.externalRef {
+		children = r.byOffset[base.Offset]
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if refs, ok := r.byHash[base.Hash]; ok {
+		delete(r.byHash, base.Hash)
+		children = slices.Concat(children, refs)
+	}
+
+	return children
+}
+
+// onResolved notifies the progress of the parser of a resolved delta, and
+// checks its context.
+func (r *deltaResolver) onResolved() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.resolved++
+	if r.p.progress != nil {
+		r.p.progress.OnDeltaResolved(r.resolved, r.total)
+	}
+
+	return r.p.checkContext(r.resolved)
+}
+
+// corrupt records the delta as corrupted, releasing its content.
+func (r *deltaResolver) corrupt(oh *ObjectHeader, err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	releaseContent(oh)
+	r.corrupted[oh] = err
+}
+
+func (r *deltaResolver) failed() bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return r.err != nil
+}
+
+func (r *deltaResolver) fail(err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.err == nil {
+		r.err = err
+	}
+}
@@ -1,6 +1,11 @@
 package packfile
 
 import (
+	"context"
+	"slices"
+
+	format "github.com/go-git/go-git/v6/plumbing/format/config"
+	"github.com/go-git/go-git/v6/plumbing/format/idxfile"
 	"github.com/go-git/go-git/v6/plumbing/storer"
 )
 
@@ -13,6 +18,17 @@ func WithStorage(storage storer.EncodedObjectStorer) ParserOption {
 	}
 }
 
+// WithThinPackBases sets the storage where the bases of the deltas missing
+// from the packfile, a thin pack, are read from. Unlike with WithStorage,
+// the parsed objects are not written to it. The hashes of the bases read are
+// returned by Parser.ExternalBases, so that the thin pack can be completed
+// by FixThinPack.
+func WithThinPackBases(s storer.EncodedObjectStorer) ParserOption {
+	return func(p *Parser) {
+		p.bases = s
+	}
+}
+
 // WithScannerObservers sets the observers to be notified during the
 // scanning or parsing of a pack file. The scanner is responsible for
 // notifying observers around general pack file information, such as
@@ -26,6 +42,58 @@ func WithScannerObservers(ob ...Observer) ParserOption {
 	}
 }
 
+// WithProgress sets the ParserProgress notified as the objects of the
+// packfile are read, and then as its deltas are resolved.
+func WithProgress(progress ParserProgress) ParserOption {
+	return func(p *Parser) {
+		p.progress = progress
+	}
+}
+
+// WithContext sets the context of the parsing, which is stopped once the
+// context is done, Parse returning its error. The context is checked
+// periodically while the objects are read and the deltas resolved.
+func WithContext(ctx context.Context) ParserOption {
+	return func(p *Parser) {
+		p.ctx = ctx
+	}
+}
+
+// WithObjectFormat sets the object format of the packfile, SHA1 by default.
+// The objects are hashed, and the bases of the ref-deltas and the checksum
+// read, as hashes of this format, see WithScannerObjectFormat.
+func WithObjectFormat(f format.ObjectFormat) ParserOption {
+	return func(p *Parser) {
+		p.format = f
+	}
+}
+
+// WithWorkers sets the number of goroutines resolving the deltas of the
+// packfile concurrently, runtime.NumCPU() by default. The chains of deltas
+// based on different objects are resolved independently, a value of 1
+// resolving all of them sequentially.
+func WithWorkers(n int) ParserOption {
+	return func(p *Parser) {
+		p.workers = n
+	}
+}
+
+// WithMaxMemory sets the maximum size, in bytes, of the inflated contents held
+// in memory while parsing a packfile. Once it is exceeded, the delta data read
+// from the packfile is dropped, least recently read first, and inflated again
+// from the packfile when the delta is resolved, trading CPU for memory. The
+// contents of the bases of the deltas being resolved are accounted as well,
+// but cannot be dropped: the limit may be exceeded by them if it is lower
+// than the size of the chains of deltas resolved concurrently.
+//
+// The limit only applies in high memory mode, the contents not being held in
+// low memory mode, and if the reader of the packfile implements io.Seeker.
+func WithMaxMemory(n int64) ParserOption {
+	return func(p *Parser) {
+		p.maxMemory = n
+	}
+}
+
 // WithHighMemoryMode optimises the parser for speed rather than
 // for memory consumption, making the Parser faster from an execution
 // time perspective, but yielding much more allocations, which in the
@@ -39,9 +107,49 @@ func WithScannerObservers(ob ...Observer) ParserOption {
 // When enabled the inflated content of all delta objects (ofs and ref)
 // will be loaded into cache, making it faster to navigate through them.
 // If the reader provided to the parser does not implement io.Seeker,
-// full objects may also be loaded into memory.
+// full objects may also be loaded into memory, unless a storage is set, the
+// bases of the deltas being read from it.
 func WithHighMemoryMode() ParserOption {
 	return func(p *Parser) {
 		p.lowMemoryMode = false
 	}
 }
+
+// WithContinueOnError makes the parser skip the corrupted objects of the
+// packfile, instead of stopping at the first one, to recover the intact
+// ones: they are stored and notified to the observers as usual, and Parse
+// returns an error joining a *CorruptionError for each corrupted object,
+// as returned by Parser.Corruptions. The deltas whose base is corrupted can't
+// be resolved, and are reported as corrupted as well.
+//
+// The parsing resumes after a corrupted object at the next object of idx, if
+// not nil, or else at the first offset where a valid object is found. The
+// objects following a corrupted one can only be recovered if the reader of
+// the packfile implements io.Seeker, the parsing stopping at the first
+// corrupted object otherwise.
+func WithContinueOnError(idx idxfile.Index) ParserOption {
+	return func(p *Parser) {
+		p.continueOnError = true
+		p.offsets = nil
+		if idx == nil {
+			return
+		}
+
+		iter, err := idx.EntriesByOffset()
+		if err != nil {
+			return
+		}
+
+		defer iter.Close()
+		for {
+			e, err := iter.Next()
+			if err != nil {
+				break
+			}
+
+			p.offsets = append(p.offsets, int64(e.Offset))
+		}
+
+		slices.Sort(p.offsets)
+	}
+}
@@ -1,8 +1,14 @@
 package packfile_test
 
 import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
 	"io"
 	"reflect"
+	"runtime"
+	"slices"
 	"testing"
 
 	billy "github.com/go-git/go-billy/v6"
@@ -14,6 +20,7 @@ import (
 	"github.com/go-git/go-git/v6"
 	"github.com/go-git/go-git/v6/plumbing"
 	"github.com/go-git/go-git/v6/plumbing/cache"
+	"github.com/go-git/go-git/v6/plumbing/format/idxfile"
 	"github.com/go-git/go-git/v6/plumbing/format/packfile"
 	"github.com/go-git/go-git/v6/plumbing/storer"
 	"github.com/go-git/go-git/v6/storage/filesystem"
@@ -58,7 +65,7 @@ func TestParserHashes(t *testing.T) {
 			parser := packfile.NewParser(f.Packfile(), packfile.WithScannerObservers(obs),
 				packfile.WithStorage(tc.storage), tc.option)
 
-			field := reflect.ValueOf(*parser).FieldByName("lowMemoryMode")
+			field := reflect.ValueOf(parser).Elem().FieldByName("lowMemoryMode")
 			got := field.Bool()
 			assert.Equal(t, tc.wantLowMemoryMode, got)
 
@@ -293,3 +300,265 @@ func (t *testObserver) put(pos int64, o observerObject) {
 	t.pos[pos] = len(t.objects)
 	t.objects = append(t.objects, o)
 }
+
+type progressRecorder struct {
+	objects, deltas []uint32
+	objectsTotal    uint32
+	deltasTotal     uint32
+}
+
+func (p *progressRecorder) OnObjectRead(current, total uint32) {
+	p.objects = append(p.objects, current)
+	p.objectsTotal = total
+}
+
+func (p *progressRecorder) OnDeltaResolved(current, total uint32) {
+	p.deltas = append(p.deltas, current)
+	p.deltasTotal = total
+}
+
+func TestParserProgress(t *testing.T) {
+	t.Parallel()
+
+	for _, storage := range []storer.Storer{
+		nil,
+		memory.NewStorage(),
+		filesystem.NewStorage(osfs.New(t.TempDir()), cache.NewObjectLRUDefault()),
+	} {
+		f := fixtures.Basic().One()
+
+		progress := new(progressRecorder)
+		parser := packfile.NewParser(f.Packfile(), packfile.WithStorage(storage), packfile.WithProgress(progress))
+		_, err := parser.Parse()
+		require.NoError(t, err)
+
+		assert.Equal(t, uint32(31), progress.objectsTotal)
+		require.Len(t, progress.objects, 31)
+		for i, current := range progress.objects {
+			assert.Equal(t, uint32(i+1), current)
+		}
+
+		assert.Equal(t, uint32(8), progress.deltasTotal)
+		assert.Equal(t, []uint32{1, 2, 3, 4, 5, 6, 7, 8}, progress.deltas)
+	}
+}
+
+func TestParserContextCancel(t *testing.T) {
+	t.Parallel()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	f := fixtures.Basic().One()
+	parser := packfile.NewParser(f.Packfile(), packfile.WithStorage(memory.NewStorage()), packfile.WithContext(ctx))
+	_, err := parser.Parse()
+	assert.ErrorIs(t, err, context.Canceled)
+}
+
+func TestParserWorkers(t *testing.T) {
+	t.Parallel()
+
+	for _, f := range fixtures.ByTag("packfile").Exclude("multi-packfile") {
+		storages := []func() storer.Storer{
+			func() storer.Storer { return nil },
+			func() storer.Storer { return memory.NewStorage() },
+		}
+
+		// The loose objects written to a filesystem storage make the bigger
+		// packfiles too slow to parse.
+		if f.Is("ofs-delta") || f.Is("ref-delta") || f.Is("delta-before-base") {
+			storages = append(storages, func() storer.Storer {
+				return filesystem.NewStorage(osfs.New(t.TempDir()), cache.NewObjectLRUDefault())
+			})
+		}
+
+		for _, storage := range storages {
+			var want *testObserver
+			for _, workers := range []int{1, 8} {
+				obs := new(testObserver)
+				parser := packfile.NewParser(f.Packfile(), packfile.WithScannerObservers(obs),
+					packfile.WithStorage(storage()), packfile.WithWorkers(workers))
+
+				checksum, err := parser.Parse()
+				require.NoError(t, err, f.URL)
+				assert.Equal(t, f.PackfileHash, checksum.String(), f.URL)
+
+				// The objects are notified in the same order, whatever the
+				// number of workers.
+				if want == nil {
+					want = obs
+					continue
+				}
+
+				assert.Equal(t, want.objects, obs.objects, f.URL)
+			}
+		}
+	}
+}
+
+func TestParserNotSeekable(t *testing.T) {
+	t.Parallel()
+
+	for _, f := range fixtures.ByTag("packfile").Exclude("multi-packfile") {
+		want := new(testObserver)
+		parser := packfile.NewParser(f.Packfile(), packfile.WithScannerObservers(want),
+			packfile.WithStorage(memory.NewStorage()))
+		_, err := parser.Parse()
+		require.NoError(t, err, f.URL)
+
+		// The packfile is parsed as it is read, the bases of the deltas
+		// being read from the storage.
+		st := memory.NewStorage()
+		obs := new(testObserver)
+		parser = packfile.NewParser(struct{ io.Reader }{f.Packfile()}, packfile.WithScannerObservers(obs),
+			packfile.WithStorage(st))
+		checksum, err := parser.Parse()
+		require.NoError(t, err, f.URL)
+		assert.Equal(t, f.PackfileHash, checksum.String(), f.URL)
+		assert.Equal(t, want.objects, obs.objects, f.URL)
+		assert.Len(t, st.Objects, len(want.objects), f.URL)
+	}
+}
+
+func TestParserCorrupted(t *testing.T) {
+	t.Parallel()
+
+	pack, _ := readFixture(t, fixtures.Basic().One())
+	for _, corrupt := range []func([]byte) []byte{
+		func(b []byte) []byte { return b[:len(b)/2] },
+		func(b []byte) []byte { b[len(b)/2] ^= 0xff; return b },
+		func(b []byte) []byte { b[len(b)-1] ^= 0xff; return b },
+	} {
+		corrupted := corrupt(bytes.Clone(pack))
+		for _, r := range []io.Reader{bytes.NewReader(corrupted), struct{ io.Reader }{bytes.NewReader(corrupted)}} {
+			_, err := packfile.NewParser(r, packfile.WithStorage(memory.NewStorage())).Parse()
+			assert.Error(t, err)
+
+			var cerr *packfile.CorruptionError
+			assert.False(t, errors.As(err, &cerr))
+		}
+	}
+}
+
+func TestParserContinueOnError(t *testing.T) {
+	t.Parallel()
+
+	pack, idx := readFixture(t, fixtures.Basic().One())
+	index := getIndexFromIdxFile(io.NopCloser(bytes.NewReader(idx)))
+	report, err := packfile.Verify(bytes.NewReader(pack), index)
+	require.NoError(t, err)
+
+	// The compressed data of a tree, the base of a chain of deltas, is
+	// corrupted: the deltas based on it, directly or not, can't be resolved
+	// either.
+	var tree packfile.VerifiedObject
+	for _, obj := range report.Objects {
+		if obj.Type == plumbing.TreeObject && obj.Depth == 0 {
+			tree = obj
+			break
+		}
+	}
+
+	lost := map[plumbing.Hash]bool{tree.Hash: true}
+	var lostOffsets []int64
+	var before int
+	for _, obj := range report.Objects {
+		if lost[obj.Base] {
+			lost[obj.Hash] = true
+		}
+
+		if lost[obj.Hash] {
+			lostOffsets = append(lostOffsets, obj.Offset)
+		}
+
+		if obj.Offset < tree.Offset {
+			before++
+		}
+	}
+	require.Greater(t, len(lostOffsets), 1)
+
+	corrupted := bytes.Clone(pack)
+	corrupted[tree.Offset+tree.PackedSize-5] ^= 0xff
+	checksumOffset := int64(len(pack) - 20)
+
+	tests := []struct {
+		name    string
+		reader  io.Reader
+		idx     idxfile.Index
+		objects int
+		offsets []int64
+	}{
+		{
+			name:    "with index",
+			reader:  bytes.NewReader(corrupted),
+			idx:     index,
+			objects: len(report.Objects) - len(lostOffsets),
+			offsets: append(slices.Clone(lostOffsets), checksumOffset),
+		},
+		{
+			name:    "without index",
+			reader:  bytes.NewReader(corrupted),
+			objects: len(report.Objects) - len(lostOffsets),
+			offsets: append(slices.Clone(lostOffsets), checksumOffset),
+		},
+		{
+			// The objects after the corrupted one can't be found.
+			name:    "not seekable",
+			reader:  struct{ io.Reader }{bytes.NewReader(corrupted)},
+			objects: before,
+			offsets: []int64{tree.Offset},
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			st := memory.NewStorage()
+			obs := new(testObserver)
+			parser := packfile.NewParser(tc.reader, packfile.WithContinueOnError(tc.idx),
+				packfile.WithStorage(st), packfile.WithScannerObservers(obs))
+			_, err := parser.Parse()
+
+			var cerr *packfile.CorruptionError
+			require.ErrorAs(t, err, &cerr)
+			assert.Equal(t, tree.Offset, cerr.Offset)
+
+			var offsets []int64
+			for _, c := range parser.Corruptions() {
+				offsets = append(offsets, c.Offset)
+				assert.ErrorIs(t, err, c)
+			}
+			assert.Equal(t, tc.offsets, offsets)
+
+			// The intact objects are recovered, but not the corrupted ones.
+			assert.Len(t, obs.objects, tc.objects)
+			assert.Len(t, st.Objects, tc.objects)
+			for _, obj := range report.Objects {
+				_, ok := st.Objects[obj.Hash]
+				if ok {
+					assert.False(t, lost[obj.Hash], obj.Hash)
+				} else {
+					assert.True(t, lost[obj.Hash] || obj.Offset > tree.Offset, obj.Hash)
+				}
+			}
+		})
+	}
+
+	// The objects of an intact packfile are all parsed.
+	parser := packfile.NewParser(bytes.NewReader(pack), packfile.WithContinueOnError(nil),
+		packfile.WithStorage(memory.NewStorage()))
+	checksum, err := parser.Parse()
+	require.NoError(t, err)
+	assert.Equal(t, report.Checksum, checksum)
+	assert.Empty(t, parser.Corruptions())
+}
+
+func BenchmarkParseWorkers(b *testing.B) {
+	f := fixtures.ByURL("https://github.com/src-d/go-git.git").ByTag("packfile").One().Packfile()
+	scanner := packfile.NewScanner(f)
+
+	for _, workers := range []int{1, runtime.NumCPU()} {
+		b.Run(fmt.Sprintf("workers=%d", workers), func(b *testing.B) {
+			benchmarkParseBasic(b, f, scanner, packfile.WithWorkers(workers))
+		})
+	}
+}
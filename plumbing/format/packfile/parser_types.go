@@ -16,4 +16,17 @@ type Observer interface {
 	OnFooter(h plumbing.Hash) error
 }
 
+// ParserProgress is notified of the progress of a Parser, see WithProgress.
+type ParserProgress interface {
+	// OnObjectRead is called each time an object is read from the
+	// packfile, with the number of objects read so far, and the number of
+	// objects of the packfile.
+	OnObjectRead(current, total uint32)
+	// OnDeltaResolved is called each time a delta is resolved, once all the
+	// objects are read, with the number of deltas resolved so far, and the
+	// number of deltas of the packfile. It may be called from the
+	// goroutines resolving the deltas, but never concurrently.
+	OnDeltaResolved(current, total uint32)
+}
+
 type objectHeaderWriter func(typ plumbing.ObjectType, sz int64) error
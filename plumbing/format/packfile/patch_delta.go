@@ -20,8 +20,13 @@ import (
 // for details about the delta format.
 
 var (
+	// ErrInvalidDelta is returned when a delta is malformed: truncated, not
+	// made for the size of its base, or whose commands copy out of the base
+	// or write more or less than the size of its result.
 	ErrInvalidDelta = errors.New("invalid delta")
-	ErrDeltaCmd     = errors.New("wrong delta command")
+	// ErrDeltaCmd is returned when a delta has a reserved command, neither a
+	// copy from the base nor an insertion from the delta.
+	ErrDeltaCmd = errors.New("wrong delta command")
 )
 
 const (
@@ -63,24 +68,28 @@ func ApplyDelta(target, base plumbing.EncodedObject, delta *bytes.Buffer) (err e
 
 	defer ioutil.CheckClose(r, &err)
 
-	w, err := target.Writer()
+	buf := sync.GetBytesBuffer()
+	defer sync.PutBytesBuffer(buf)
+	_, err = buf.ReadFrom(r)
 	if err != nil {
 		return err
 	}
 
-	defer ioutil.CheckClose(w, &err)
+	return patchDeltaObject(target, buf.Bytes(), delta.Bytes())
+}
 
-	buf := sync.GetBytesBuffer()
-	defer sync.PutBytesBuffer(buf)
-	_, err = buf.ReadFrom(r)
+// patchDeltaObject writes to target the result of applying delta to src.
+func patchDeltaObject(target plumbing.EncodedObject, src, delta []byte) (err error) {
+	w, err := target.Writer()
 	if err != nil {
 		return err
 	}
-	src := buf.Bytes()
+
+	defer ioutil.CheckClose(w, &err)
 
 	dst := sync.GetBytesBuffer()
 	defer sync.PutBytesBuffer(dst)
-	err = patchDelta(dst, src, delta.Bytes())
+	err = patchDelta(dst, src, delta)
 	if err != nil {
 		return err
 	}
@@ -91,11 +100,20 @@ func ApplyDelta(target, base plumbing.EncodedObject, delta *bytes.Buffer) (err e
 	return err
 }
 
-// PatchDelta returns the result of applying the modification deltas in delta to src.
-// An error will be returned if delta is corrupted (ErrInvalidDelta) or an action command
-// is not copy from source or copy from delta (ErrDeltaCmd).
+// PatchDelta returns the result of applying delta to src, its base, as git
+// does for the objects of the packfiles stored as OFS or REF deltas.
+//
+// A delta is in the binary delta format of git: the sizes of the base and of
+// the result, as LEB128 varints, followed by the commands building the
+// result, either copies of a range of the base or insertions of the bytes
+// following them in the delta, such as the ones of DiffDelta.
+//
+// ErrInvalidDelta is returned if delta is malformed, ErrDeltaCmd if it has a
+// reserved command. The size of the result is checked against the commands
+// as they are applied, the memory allocated upfront being bounded whatever
+// size delta claims.
 func PatchDelta(src, delta []byte) ([]byte, error) {
-	if len(src) == 0 || len(delta) < minDeltaSize {
+	if len(delta) < minDeltaSize {
 		return nil, ErrInvalidDelta
 	}
 
@@ -141,7 +159,7 @@ func ReaderFromDelta(base plumbing.EncodedObject, deltaRC io.Reader) (io.ReadClo
 		baseBuf := bufio.NewReader(baseRd)
 		basePos := uint(0)
 
-		for {
+		for remainingTargetSz > 0 {
 			cmd, err := deltaBuf.ReadByte()
 			if err == io.EOF {
 				_ = dstWr.CloseWithError(ErrInvalidDelta)
@@ -156,18 +174,18 @@ func ReaderFromDelta(base plumbing.EncodedObject, deltaRC io.Reader) (io.ReadClo
 			case isCopyFromSrc(cmd):
 				offset, err := decodeOffsetByteReader(cmd, deltaBuf)
 				if err != nil {
-					_ = dstWr.CloseWithError(err)
+					_ = dstWr.CloseWithError(deltaHeaderError(err))
 					return
 				}
 				sz, err := decodeSizeByteReader(cmd, deltaBuf)
 				if err != nil {
-					_ = dstWr.CloseWithError(err)
+					_ = dstWr.CloseWithError(deltaHeaderError(err))
 					return
 				}
 
-				if invalidSize(sz, targetSz) ||
+				if invalidSize(sz, remainingTargetSz) ||
 					invalidOffsetSize(offset, sz, srcSz) {
-					_ = dstWr.Close()
+					_ = dstWr.CloseWithError(ErrInvalidDelta)
 					return
 				}
 
@@ -209,27 +227,30 @@ func ReaderFromDelta(base plumbing.EncodedObject, deltaRC io.Reader) (io.ReadClo
 
 			case isCopyFromDelta(cmd):
 				sz := uint(cmd) // cmd is the size itself
-				if invalidSize(sz, targetSz) {
+				if invalidSize(sz, remainingTargetSz) {
 					_ = dstWr.CloseWithError(ErrInvalidDelta)
 					return
 				}
-				if _, err := ioutil.CopyBufferPool(dstWr, io.LimitReader(deltaBuf, int64(sz))); err != nil {
+				n, err := ioutil.CopyBufferPool(dstWr, io.LimitReader(deltaBuf, int64(sz)))
+				if err != nil {
 					_ = dstWr.CloseWithError(err)
 					return
 				}
 
+				if n != int64(sz) {
+					_ = dstWr.CloseWithError(ErrInvalidDelta)
+					return
+				}
+
 				remainingTargetSz -= sz
 
 			default:
 				_ = dstWr.CloseWithError(ErrDeltaCmd)
 				return
 			}
-
-			if remainingTargetSz <= 0 {
-				_ = dstWr.Close()
-				return
-			}
 		}
+
+		_ = dstWr.CloseWithError(deltaEnd(deltaBuf))
 	}()
 
 	return dstRd, nil
@@ -240,19 +261,23 @@ func patchDelta(dst *bytes.Buffer, src, delta []byte) error {
 		return ErrInvalidDelta
 	}
 
-	srcSz, delta := decodeLEB128(delta)
-	if srcSz != uint(len(src)) {
+	srcSz, rest := decodeLEB128(delta)
+	if truncatedLEB128(delta, rest) || srcSz != uint(len(src)) {
+		return ErrInvalidDelta
+	}
+
+	targetSz, delta := decodeLEB128(rest)
+	if truncatedLEB128(rest, delta) {
 		return ErrInvalidDelta
 	}
 
-	targetSz, delta := decodeLEB128(delta)
 	remainingTargetSz := targetSz
 
 	var cmd byte
 
 	growSz := min(targetSz, maxPatchPreemptionSize)
 	dst.Grow(int(growSz))
-	for {
+	for remainingTargetSz > 0 {
 		if len(delta) == 0 {
 			return ErrInvalidDelta
 		}
@@ -274,16 +299,16 @@ func patchDelta(dst *bytes.Buffer, src, delta []byte) error {
 				return err
 			}
 
-			if invalidSize(sz, targetSz) ||
+			if invalidSize(sz, remainingTargetSz) ||
 				invalidOffsetSize(offset, sz, srcSz) {
-				break
+				return ErrInvalidDelta
 			}
 			dst.Write(src[offset : offset+sz])
 			remainingTargetSz -= sz
 
 		case isCopyFromDelta(cmd):
 			sz := uint(cmd) // cmd is the size itself
-			if invalidSize(sz, targetSz) {
+			if invalidSize(sz, remainingTargetSz) {
 				return ErrInvalidDelta
 			}
 
@@ -298,17 +323,18 @@ func patchDelta(dst *bytes.Buffer, src, delta []byte) error {
 		default:
 			return ErrDeltaCmd
 		}
+	}
 
-		if remainingTargetSz <= 0 {
-			break
-		}
+	// As git, the commands past the size of the result are refused.
+	if len(delta) != 0 {
+		return ErrInvalidDelta
 	}
 
 	return nil
 }
 
 func patchDeltaWriter(dst io.Writer, base io.ReaderAt, delta io.Reader,
-	typ plumbing.ObjectType, writeHeader objectHeaderWriter,
+	typ plumbing.ObjectType, of format.ObjectFormat, writeHeader objectHeaderWriter,
 ) (uint, plumbing.Hash, error) {
 	deltaBuf := bufio.NewReader(delta)
 	srcSz, err := decodeLEB128ByteReader(deltaBuf)
@@ -332,9 +358,9 @@ func patchDeltaWriter(dst io.Writer, base io.ReaderAt, delta io.Reader,
 	}
 
 	// Avoid several iteractions expanding the buffer, which can be quite
-	// inefficient on large deltas.
+	// inefficient on large deltas, up to a bound for the malformed ones.
 	if b, ok := dst.(*bytes.Buffer); ok {
-		b.Grow(int(targetSz))
+		b.Grow(int(min(targetSz, maxPatchPreemptionSize)))
 	}
 
 	// If header still needs to be written, caller will provide
@@ -349,7 +375,7 @@ func patchDeltaWriter(dst io.Writer, base io.ReaderAt, delta io.Reader,
 
 	remainingTargetSz := targetSz
 
-	hasher := plumbing.NewHasher(format.SHA1, typ, int64(targetSz))
+	hasher := plumbing.NewHasher(of, typ, int64(targetSz))
 	mw := io.MultiWriter(dst, hasher)
 
 	bufp := sync.GetByteSlice()
@@ -360,7 +386,7 @@ func patchDeltaWriter(dst io.Writer, base io.ReaderAt, delta io.Reader,
 	baselr := io.LimitReader(sr, 0).(*io.LimitedReader)
 	deltalr := io.LimitReader(deltaBuf, 0).(*io.LimitedReader)
 
-	for {
+	for remainingTargetSz > 0 {
 		buf := *bufp
 		cmd, err := deltaBuf.ReadByte()
 		if err == io.EOF {
@@ -373,45 +399,54 @@ func patchDeltaWriter(dst io.Writer, base io.ReaderAt, delta io.Reader,
 		if isCopyFromSrc(cmd) {
 			offset, err := decodeOffsetByteReader(cmd, deltaBuf)
 			if err != nil {
-				return 0, plumbing.ZeroHash, err
+				return 0, plumbing.ZeroHash, deltaHeaderError(err)
 			}
 			sz, err := decodeSizeByteReader(cmd, deltaBuf)
 			if err != nil {
-				return 0, plumbing.ZeroHash, err
+				return 0, plumbing.ZeroHash, deltaHeaderError(err)
 			}
 
-			if invalidSize(sz, targetSz) ||
+			if invalidSize(sz, remainingTargetSz) ||
 				invalidOffsetSize(offset, sz, srcSz) {
-				return 0, plumbing.ZeroHash, err
+				return 0, plumbing.ZeroHash, ErrInvalidDelta
 			}
 
 			if _, err := sr.Seek(int64(offset), io.SeekStart); err != nil {
 				return 0, plumbing.ZeroHash, err
 			}
 			baselr.N = int64(sz)
-			if _, err := io.CopyBuffer(mw, baselr, buf); err != nil {
+			n, err := io.CopyBuffer(mw, baselr, buf)
+			if err != nil {
 				return 0, plumbing.ZeroHash, err
 			}
+			if n != int64(sz) {
+				return 0, plumbing.ZeroHash, ErrInvalidDelta
+			}
 			remainingTargetSz -= sz
 		} else if isCopyFromDelta(cmd) {
 			sz := uint(cmd) // cmd is the size itself
-			if invalidSize(sz, targetSz) {
+			if invalidSize(sz, remainingTargetSz) {
 				return 0, plumbing.ZeroHash, ErrInvalidDelta
 			}
 			deltalr.N = int64(sz)
-			if _, err := io.CopyBuffer(mw, deltalr, buf); err != nil {
+			n, err := io.CopyBuffer(mw, deltalr, buf)
+			if err != nil {
 				return 0, plumbing.ZeroHash, err
 			}
+			if n != int64(sz) {
+				return 0, plumbing.ZeroHash, ErrInvalidDelta
+			}
 
 			remainingTargetSz -= sz
 		} else {
-			return 0, plumbing.ZeroHash, err
-		}
-		if remainingTargetSz <= 0 {
-			break
+			return 0, plumbing.ZeroHash, ErrDeltaCmd
 		}
 	}
 
+	if err := deltaEnd(deltaBuf); err != nil {
+		return 0, plumbing.ZeroHash, err
+	}
+
 	return targetSz, hasher.Sum(), nil
 }
 
@@ -441,6 +476,14 @@ func decodeLEB128(input []byte) (uint, []byte) {
 	return num, input[sz:]
 }
 
+// truncatedLEB128 reports whether the number decoded by decodeLEB128 from
+// input, rest being left, is truncated, its last byte having the
+// continuation bit.
+func truncatedLEB128(input, rest []byte) bool {
+	n := len(input) - len(rest)
+	return n == 0 || input[n-1]&continuation != 0
+}
+
 func decodeLEB128ByteReader(input io.ByteReader) (uint, error) {
 	var num, sz uint
 	for {
@@ -460,6 +503,20 @@ func decodeLEB128ByteReader(input io.ByteReader) (uint, error) {
 	return num, nil
 }
 
+// deltaEnd returns ErrInvalidDelta if the delta has commands past the
+// size of the object, refused as git does.
+func deltaEnd(delta io.ByteReader) error {
+	_, err := delta.ReadByte()
+	switch {
+	case errors.Is(err, io.EOF):
+		return nil
+	case err != nil:
+		return err
+	default:
+		return ErrInvalidDelta
+	}
+}
+
 func isCopyFromSrc(cmd byte) bool {
 	return (cmd & continuation) != 0
 }
@@ -547,3 +604,128 @@ func invalidOffsetSize(offset, sz, srcSz uint) bool {
 func sumOverflows(a, b uint) bool {
 	return a+b < a
 }
+
+// deltaReader streams the object patched by a delta, the base object being
+// held in memory, and the delta being read as the object is.
+type deltaReader struct {
+	src   []byte
+	delta *bufio.Reader
+	c     io.Closer
+	// remaining is the number of bytes of the object not read yet.
+	remaining uint
+	// copied are the bytes of the base copied by the current command, not
+	// read yet.
+	copied []byte
+	// inserted is the number of bytes of the delta inserted by the current
+	// command, not read yet.
+	inserted uint
+	err      error
+}
+
+// newDeltaReader returns a reader of the object patched by the delta read
+// from delta, applied to src. The delta is closed with the reader.
+func newDeltaReader(src []byte, delta io.ReadCloser) (*deltaReader, error) {
+	r := &deltaReader{src: src, delta: bufio.NewReader(delta), c: delta}
+	srcSz, err := decodeLEB128ByteReader(r.delta)
+	if err != nil {
+		return nil, deltaHeaderError(err)
+	}
+
+	if srcSz != uint(len(src)) {
+		return nil, ErrInvalidDelta
+	}
+
+	if r.remaining, err = decodeLEB128ByteReader(r.delta); err != nil {
+		return nil, deltaHeaderError(err)
+	}
+
+	return r, nil
+}
+
+func (r *deltaReader) Read(p []byte) (int, error) {
+	if len(p) == 0 || r.err != nil {
+		return 0, r.err
+	}
+
+	for {
+		switch {
+		case len(r.copied) > 0:
+			n := copy(p, r.copied)
+			r.copied = r.copied[n:]
+			r.remaining -= uint(n)
+			return n, nil
+		case r.inserted > 0:
+			n, err := r.delta.Read(p[:min(uint(len(p)), r.inserted)])
+			r.inserted -= uint(n)
+			r.remaining -= uint(n)
+			if errors.Is(err, io.EOF) && r.inserted > 0 {
+				err = ErrInvalidDelta
+			}
+
+			if err != nil && !errors.Is(err, io.EOF) {
+				r.err = err
+				return n, err
+			}
+
+			return n, nil
+		case r.remaining == 0:
+			r.err = io.EOF
+			if err := deltaEnd(r.delta); err != nil {
+				r.err = err
+			}
+
+			return 0, r.err
+		}
+
+		if err := r.next(); err != nil {
+			r.err = err
+			return 0, err
+		}
+	}
+}
+
+// next reads the next command of the delta.
+func (r *deltaReader) next() error {
+	cmd, err := r.delta.ReadByte()
+	if errors.Is(err, io.EOF) {
+		return ErrInvalidDelta
+	}
+
+	if err != nil {
+		return err
+	}
+
+	switch {
+	case isCopyFromSrc(cmd):
+		offset, err := decodeOffsetByteReader(cmd, r.delta)
+		if err != nil {
+			return deltaHeaderError(err)
+		}
+
+		sz, err := decodeSizeByteReader(cmd, r.delta)
+		if err != nil {
+			return deltaHeaderError(err)
+		}
+
+		if sz > r.remaining || invalidOffsetSize(offset, sz, uint(len(r.src))) {
+			return ErrInvalidDelta
+		}
+
+		r.copied = r.src[offset : offset+sz]
+	case isCopyFromDelta(cmd):
+		sz := uint(cmd) // cmd is the size itself
+		if sz > r.remaining {
+			return ErrInvalidDelta
+		}
+
+		r.inserted = sz
+	default:
+		return ErrDeltaCmd
+	}
+
+	return nil
+}
+
+func (r *deltaReader) Close() error {
+	return r.c.Close()
+}
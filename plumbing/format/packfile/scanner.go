@@ -5,10 +5,12 @@ import (
 	"bytes"
 	"crypto"
 	"encoding/hex"
+	"errors"
 	"fmt"
 	"hash"
 	"hash/crc32"
 	"io"
+	"slices"
 	"sync"
 
 	"github.com/go-git/go-git/v6/plumbing"
@@ -79,6 +81,8 @@ type Scanner struct {
 	packhash gogithash.Hash
 	// objectIdSize holds the object ID size.
 	objectIDSize int
+	// format is the object format of the packfile.
+	format format.ObjectFormat
 
 	// next holds what state function should be executed on the next
 	// call to Scan().
@@ -98,12 +102,29 @@ type Scanner struct {
 	rbuf *bufio.Reader
 
 	lowMemoryMode bool
+	// headersOnly is set for the contents of the objects to be inflated
+	// only to find where they end, without hashing nor keeping them.
+	headersOnly bool
+
+	// continueOnError is set for the corrupted objects to be skipped, and
+	// recorded in corruptions, instead of stopping the scan.
+	continueOnError bool
+	// offsets are the sorted offsets of the objects of the packfile, if
+	// known, where the scan resumes after a corrupted object.
+	offsets     []int64
+	corruptions []*CorruptionError
+	// end is the offset of the checksum of the packfile, when the corrupted
+	// objects are skipped and the packfile is seekable.
+	end int64
+	// skipped is set once a corrupted object is skipped, the checksum of
+	// the packfile then being computed again from it.
+	skipped bool
 }
 
 // NewScanner creates a new instance of Scanner.
 func NewScanner(rs io.Reader, opts ...ScannerOption) *Scanner {
 	crc := crc32.NewIEEE()
-	packhash := gogithash.New(crypto.SHA1)
+	packhash := newPackHash(format.SHA1)
 
 	r := &Scanner{
 		objIndex: -1,
@@ -119,7 +140,7 @@ func NewScanner(rs io.Reader, opts ...ScannerOption) *Scanner {
 		opt(r)
 	}
 
-	r.scannerReader = newScannerReader(rs, io.MultiWriter(crc, packhash), r.rbuf)
+	r.scannerReader = newScannerReader(rs, io.MultiWriter(crc, r.packhash), r.rbuf)
 
 	return r
 }
@@ -173,6 +194,9 @@ func (r *Scanner) Reset() {
 	r.packData = PackData{}
 	r.err = nil
 	r.nextFn = packHeaderSignature
+	r.corruptions = nil
+	r.end = 0
+	r.skipped = false
 }
 
 // Data returns the pack data based on the last call to Scan().
@@ -186,6 +210,33 @@ func (r *Scanner) Error() error {
 	return r.err
 }
 
+// Scan reads the packfile of r sequentially, in a single pass, calling fn
+// with the header of each of its objects, in the order of the packfile: its
+// type, offset, size, compressed size from ContentOffset, and the base of
+// the deltas. The contents of the objects
+// are inflated only to find where they end, without being kept, hashed, nor
+// the deltas resolved, the headers then having no Hash. The signature and the
+// version of the packfile, the sizes of the objects and the checksum of the
+// packfile are validated.
+//
+// An error returned by fn stops the scan and is returned.
+func Scan(r io.Reader, fn func(ObjectHeader) error, opts ...ScannerOption) error {
+	s := NewScanner(r, opts...)
+	s.headersOnly = true
+
+	for s.Scan() {
+		if s.packData.Section != ObjectSection {
+			continue
+		}
+
+		if err := fn(s.packData.objectHeader); err != nil {
+			return err
+		}
+	}
+
+	return s.Error()
+}
+
 func (r *Scanner) SeekFromStart(offset int64) error {
 	r.Reset()
 
@@ -243,6 +294,45 @@ func (s *Scanner) inflateContent(contentOffset int64, writer io.Writer) error {
 	return nil
 }
 
+// deltaTargetSize returns the size of the object patched by the delta whose
+// content starts at the given offset, read from the header of the delta,
+// which is the only part inflated.
+func (s *Scanner) deltaTargetSize(contentOffset int64) (int64, error) {
+	_, err := s.Seek(contentOffset, io.SeekStart)
+	if err != nil {
+		return 0, err
+	}
+
+	zr, err := gogitsync.GetZlibReader(s.scannerReader)
+	if err != nil {
+		return 0, fmt.Errorf("zlib reset error: %s", err)
+	}
+	defer gogitsync.PutZlibReader(zr)
+
+	// The header is the size of the base, then the one of the target.
+	br := bufio.NewReaderSize(zr, 16)
+	if _, err := decodeLEB128ByteReader(br); err != nil {
+		return 0, deltaHeaderError(err)
+	}
+
+	size, err := decodeLEB128ByteReader(br)
+	if err != nil {
+		return 0, deltaHeaderError(err)
+	}
+
+	return int64(size), nil
+}
+
+// deltaHeaderError returns the error reading the header of a delta, which is
+// invalid if it is truncated.
+func deltaHeaderError(err error) error {
+	if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+		return ErrInvalidDelta
+	}
+
+	return err
+}
+
 // scan goes through the next stateFn.
 //
 // State functions are chained by returning a non-nil value for stateFn.
@@ -320,9 +410,36 @@ func packObjectsQty(r *Scanner) (stateFn, error) {
 	}
 	r.nextFn = objectEntry
 
+	// The corrupted objects can only be skipped if the packfile is
+	// seekable, up to its checksum.
+	if r.continueOnError && r.seeker != nil {
+		end, err := r.checksumOffset()
+		if err != nil {
+			return nil, err
+		}
+
+		r.end = end
+	}
+
 	return nil, nil
 }
 
+// checksumOffset returns the offset of the checksum of the packfile, at its
+// end.
+func (r *Scanner) checksumOffset() (int64, error) {
+	offset := r.offset
+	size, err := r.Seek(0, io.SeekEnd)
+	if err != nil {
+		return 0, err
+	}
+
+	if _, err := r.Seek(offset, io.SeekStart); err != nil {
+		return 0, err
+	}
+
+	return max(size-int64(r.packhash.Size()), offset), nil
+}
+
 // objectEntry handles the object entries within a packfile. This is generally
 // split between object headers and their contents.
 //
@@ -331,11 +448,33 @@ func packObjectsQty(r *Scanner) (stateFn, error) {
 //
 // When SHA256 is enabled, the scanner will also calculate the SHA256 for each object.
 func objectEntry(r *Scanner) (stateFn, error) {
-	if r.objIndex+1 >= int(r.objects) {
+	if r.objIndex+1 >= int(r.objects) || r.end > 0 && r.offset >= r.end {
 		return packFooter, nil
 	}
 	r.objIndex++
 
+	offset := r.offset
+	oh, err := readObjectEntry(r)
+	if err == nil && r.end > 0 && r.offset > r.end {
+		err = fmt.Errorf("%w: object overlapping the checksum", ErrMalformedPackfile)
+	}
+
+	if err != nil {
+		if !r.continueOnError {
+			return nil, err
+		}
+
+		return r.skipCorrupted(offset, err)
+	}
+
+	r.packData.Section = ObjectSection
+	r.packData.objectHeader = oh
+
+	return nil, nil
+}
+
+// readObjectEntry reads the object entry at the current offset.
+func readObjectEntry(r *Scanner) (ObjectHeader, error) {
 	offset := r.offset
 
 	r.Flush()
@@ -344,17 +483,17 @@ func objectEntry(r *Scanner) (stateFn, error) {
 	b := []byte{0}
 	_, err := r.Read(b)
 	if err != nil {
-		return nil, err
+		return ObjectHeader{}, err
 	}
 
 	typ := parseType(b[0])
 	if !typ.Valid() {
-		return nil, fmt.Errorf("%w: invalid object type: %v", ErrMalformedPackfile, b[0])
+		return ObjectHeader{}, fmt.Errorf("%w: invalid object type: %v", ErrMalformedPackfile, b[0])
 	}
 
 	size, err := readVariableLengthSize(b[0], r)
 	if err != nil {
-		return nil, err
+		return ObjectHeader{}, err
 	}
 
 	oh := ObjectHeader{
@@ -370,14 +509,18 @@ func objectEntry(r *Scanner) (stateFn, error) {
 		if oh.Type == plumbing.OFSDeltaObject {
 			no, err := binary.ReadVariableWidthInt(r.scannerReader)
 			if err != nil {
-				return nil, err
+				return ObjectHeader{}, err
+			}
+
+			if no <= 0 || no > oh.Offset {
+				return ObjectHeader{}, fmt.Errorf("%w: invalid delta base offset: %d", ErrMalformedPackfile, no)
 			}
 			oh.OffsetReference = oh.Offset - no
 		} else {
 			oh.Reference.ResetBySize(r.objectIDSize)
 			_, err := oh.Reference.ReadFrom(r.scannerReader)
 			if err != nil {
-				return nil, err
+				return ObjectHeader{}, err
 			}
 		}
 	}
@@ -386,18 +529,35 @@ func objectEntry(r *Scanner) (stateFn, error) {
 
 	zr, err := gogitsync.GetZlibReader(r.scannerReader)
 	if err != nil {
-		return nil, fmt.Errorf("zlib reset error: %s", err)
+		return ObjectHeader{}, fmt.Errorf("zlib reset error: %s", err)
 	}
 	defer gogitsync.PutZlibReader(zr)
 
-	if !oh.Type.IsDelta() {
+	if r.headersOnly {
+		n, err := ioutil.CopyBufferPool(io.Discard, zr)
+		if err == nil {
+			err = checkInflatedSize(&oh, n)
+		}
+
+		if err != nil {
+			return ObjectHeader{}, err
+		}
+	} else if !oh.Type.IsDelta() {
 		r.hasher.Reset(oh.Type, oh.Size)
 
 		var mw io.Writer = r.hasher
-		if r.storage != nil {
+		// When the corrupted objects are skipped, the objects are only
+		// written to the storage once read entirely, for a corrupted one
+		// not to be stored.
+		var stored *bytes.Buffer
+		if r.storage != nil && r.continueOnError {
+			stored = gogitsync.GetBytesBuffer()
+			defer gogitsync.PutBytesBuffer(stored)
+			mw = io.MultiWriter(mw, stored)
+		} else if r.storage != nil {
 			w, err := r.storage.RawObjectWriter(oh.Type, oh.Size)
 			if err != nil {
-				return nil, err
+				return ObjectHeader{}, err
 			}
 
 			defer w.Close()
@@ -406,8 +566,10 @@ func objectEntry(r *Scanner) (stateFn, error) {
 
 		// If the reader isn't seekable, and low memory mode
 		// isn't supported, keep the contents of the objects in
-		// memory.
-		if !r.lowMemoryMode && r.seeker == nil {
+		// memory, unless they are written to the storage, where
+		// the bases of the deltas are then read from: only the
+		// delta data has to be held until the deltas are resolved.
+		if !r.lowMemoryMode && r.seeker == nil && r.storage == nil {
 			oh.content = gogitsync.GetBytesBuffer()
 			mw = io.MultiWriter(mw, oh.content)
 		}
@@ -417,9 +579,21 @@ func objectEntry(r *Scanner) (stateFn, error) {
 		}
 
 		// For non delta objects, simply calculate the hash of each object.
-		_, err = ioutil.CopyBufferPool(mw, zr)
+		n, err := ioutil.CopyBufferPool(mw, zr)
+		if err == nil {
+			err = checkInflatedSize(&oh, n)
+		}
+
 		if err != nil {
-			return nil, err
+			releaseContent(&oh)
+			return ObjectHeader{}, err
+		}
+
+		if stored != nil {
+			if err := storeObject(r.storage, &oh, stored); err != nil {
+				releaseContent(&oh)
+				return ObjectHeader{}, err
+			}
 		}
 
 		oh.Hash = r.hasher.Sum()
@@ -430,28 +604,200 @@ func objectEntry(r *Scanner) (stateFn, error) {
 	} else {
 		// If data source is not io.Seeker, keep the content
 		// in the cache, so that it can be accessed by the Parser.
+		var n int64
 		if !r.lowMemoryMode {
 			oh.content = gogitsync.GetBytesBuffer()
-			_, err = oh.content.ReadFrom(zr)
-			if err != nil {
-				return nil, err
-			}
+			n, err = oh.content.ReadFrom(zr)
 		} else {
 			// We don't know the compressed length, so we can't seek to
 			// the next object, we must discard the data instead.
-			_, err = ioutil.CopyBufferPool(io.Discard, zr)
-			if err != nil {
-				return nil, err
-			}
+			n, err = ioutil.CopyBufferPool(io.Discard, zr)
+		}
+
+		if err == nil {
+			err = checkInflatedSize(&oh, n)
+		}
+
+		if err != nil {
+			releaseContent(&oh)
+			return ObjectHeader{}, err
 		}
 	}
 	r.Flush()
 	oh.Crc32 = r.crc.Sum32()
+	oh.CompressedSize = r.offset - oh.ContentOffset
 
-	r.packData.Section = ObjectSection
-	r.packData.objectHeader = oh
+	return oh, nil
+}
 
-	return nil, nil
+// checkInflatedSize returns an error if the object wasn't inflated to the
+// size of its header.
+func checkInflatedSize(oh *ObjectHeader, n int64) error {
+	if n != oh.Size {
+		return fmt.Errorf("%w: object of size %d inflated to %d bytes", ErrMalformedPackfile, oh.Size, n)
+	}
+
+	return nil
+}
+
+// releaseContent returns the content of the object to the pool, if any.
+func releaseContent(oh *ObjectHeader) {
+	if oh.content != nil {
+		gogitsync.PutBytesBuffer(oh.content)
+		oh.content = nil
+	}
+}
+
+// storeObject writes the object, whose content was read, to the storage.
+func storeObject(s storer.EncodedObjectStorer, oh *ObjectHeader, content *bytes.Buffer) error {
+	w, err := s.RawObjectWriter(oh.Type, oh.Size)
+	if err != nil {
+		return err
+	}
+
+	if _, err := w.Write(content.Bytes()); err != nil {
+		_ = w.Close()
+		return err
+	}
+
+	return w.Close()
+}
+
+// skipCorrupted records the corrupted object at offset, and resumes the scan
+// at the next object: the following one of the index, if known, or else the
+// first offset after it where a valid object is found, or the checksum of
+// the packfile. If the packfile is not seekable, the end of the corrupted
+// object can't be found, and the scan stops with its error.
+func (r *Scanner) skipCorrupted(offset int64, cause error) (stateFn, error) {
+	cerr := &CorruptionError{Offset: offset, Err: cause}
+	r.corruptions = append(r.corruptions, cerr)
+	if r.end == 0 {
+		return nil, cerr
+	}
+
+	r.skipped = true
+	next, ok := r.nextEntry(offset)
+	if !ok {
+		next = r.end
+	}
+
+	if _, err := r.Seek(next, io.SeekStart); err != nil {
+		return nil, err
+	}
+
+	return objectEntry, nil
+}
+
+// nextEntry returns the offset of the first object after the one at offset.
+func (r *Scanner) nextEntry(offset int64) (int64, bool) {
+	if len(r.offsets) > 0 {
+		i, _ := slices.BinarySearch(r.offsets, offset+1)
+		if i < len(r.offsets) && r.offsets[i] < r.end {
+			return r.offsets[i], true
+		}
+
+		return 0, false
+	}
+
+	// The window is searched for the headers of objects followed by a
+	// zlib header, which are then read entirely.
+	buf := make([]byte, 64<<10)
+	var br bytes.Reader
+	for pos := offset + 1; pos < r.end; {
+		if _, err := r.Seek(pos, io.SeekStart); err != nil {
+			return 0, false
+		}
+
+		n, err := io.ReadFull(r.scannerReader, buf[:min(int64(len(buf)), r.end-pos)])
+		if n == 0 || err != nil && !errors.Is(err, io.ErrUnexpectedEOF) {
+			return 0, false
+		}
+
+		for i := range n {
+			br.Reset(buf[i:n])
+			if entryCandidate(&br, pos+int64(i), r.objectIDSize) && r.validEntry(pos+int64(i)) {
+				return pos + int64(i), true
+			}
+		}
+
+		pos += int64(n)
+	}
+
+	return 0, false
+}
+
+// entryCandidate returns whether the bytes at offset may be the header of an
+// object, followed by a zlib header, or are too few to tell.
+func entryCandidate(br *bytes.Reader, offset int64, idSize int) bool {
+	b, err := br.ReadByte()
+	if err != nil || !parseType(b).Valid() {
+		return false
+	}
+
+	if _, err := readVariableLengthSize(b, br); err != nil {
+		return true
+	}
+
+	switch parseType(b) {
+	case plumbing.OFSDeltaObject:
+		no, err := binary.ReadVariableWidthInt(br)
+		if err != nil {
+			return true
+		}
+
+		if no <= 0 || no > offset {
+			return false
+		}
+	case plumbing.REFDeltaObject:
+		if _, err := br.Seek(int64(idSize), io.SeekCurrent); err != nil {
+			return true
+		}
+	}
+
+	var zh [2]byte
+	if _, err := io.ReadFull(br, zh[:]); err != nil {
+		return true
+	}
+
+	return zh[0]&0x0f == 8 && (uint16(zh[0])<<8|uint16(zh[1]))%31 == 0
+}
+
+// validEntry returns whether a valid object is found at offset, reading it
+// entirely.
+func (r *Scanner) validEntry(offset int64) bool {
+	if _, err := r.Seek(offset, io.SeekStart); err != nil {
+		return false
+	}
+
+	b, err := r.ReadByte()
+	if err != nil {
+		return false
+	}
+
+	size, err := readVariableLengthSize(b, r)
+	if err != nil {
+		return false
+	}
+
+	switch parseType(b) {
+	case plumbing.OFSDeltaObject:
+		if _, err := binary.ReadVariableWidthInt(r.scannerReader); err != nil {
+			return false
+		}
+	case plumbing.REFDeltaObject:
+		if _, err := io.CopyN(io.Discard, r.scannerReader, int64(r.objectIDSize)); err != nil {
+			return false
+		}
+	}
+
+	zr, err := gogitsync.GetZlibReader(r.scannerReader)
+	if err != nil {
+		return false
+	}
+	defer gogitsync.PutZlibReader(zr)
+
+	n, err := ioutil.CopyBufferPool(io.Discard, zr)
+	return err == nil && n == int64(size) && r.offset <= r.end
 }
 
 // packFooter parses the packfile checksum.
@@ -461,17 +807,51 @@ func objectEntry(r *Scanner) (stateFn, error) {
 func packFooter(r *Scanner) (stateFn, error) {
 	r.Flush()
 
+	// The objects read don't end at the checksum, the packfile then having
+	// more objects than its header tells.
+	if r.end > 0 && r.offset != r.end {
+		r.corruptions = append(r.corruptions, &CorruptionError{
+			Offset: r.offset,
+			Err:    fmt.Errorf("%w: unexpected data before the checksum", ErrMalformedPackfile),
+		})
+
+		r.skipped = true
+		if _, err := r.Seek(r.end, io.SeekStart); err != nil {
+			return nil, err
+		}
+	}
+
+	offset := r.offset
 	actual := r.packhash.Sum(nil)
+	if r.skipped {
+		var err error
+		if actual, err = r.packChecksum(offset); err != nil {
+			return nil, err
+		}
+	}
 
 	var checksum plumbing.Hash
+	checksum.ResetBySize(r.packhash.Size())
 	_, err := checksum.ReadFrom(r.scannerReader)
 	if err != nil {
-		return nil, fmt.Errorf("cannot read PACK checksum: %w", ErrMalformedPackfile)
+		err = fmt.Errorf("cannot read PACK checksum: %w", ErrMalformedPackfile)
+		if !r.continueOnError {
+			return nil, err
+		}
+
+		cerr := &CorruptionError{Offset: offset, Err: err}
+		r.corruptions = append(r.corruptions, cerr)
+		return nil, cerr
 	}
 
 	if checksum.Compare(actual) != 0 {
-		return nil, fmt.Errorf("checksum mismatch expected %q but found %q: %w",
+		err := fmt.Errorf("checksum mismatch expected %q but found %q: %w",
 			hex.EncodeToString(actual), checksum, ErrMalformedPackfile)
+		if !r.continueOnError {
+			return nil, err
+		}
+
+		r.corruptions = append(r.corruptions, &CorruptionError{Offset: offset, Err: err})
 	}
 
 	r.packData.Section = FooterSection
@@ -481,6 +861,32 @@ func packFooter(r *Scanner) (stateFn, error) {
 	return nil, nil
 }
 
+// packChecksum returns the checksum of the packfile up to the given offset,
+// reading it again.
+func (r *Scanner) packChecksum(offset int64) ([]byte, error) {
+	if _, err := r.Seek(0, io.SeekStart); err != nil {
+		return nil, err
+	}
+
+	h := newPackHash(r.format)
+	if _, err := io.CopyN(h, r.scannerReader, offset); err != nil {
+		return nil, err
+	}
+
+	r.Flush()
+	return h.Sum(nil), nil
+}
+
+// newPackHash returns the hash of the checksum of a packfile of the given
+// object format.
+func newPackHash(f format.ObjectFormat) gogithash.Hash {
+	if f == format.SHA256 {
+		return gogithash.New(crypto.SHA256)
+	}
+
+	return gogithash.New(crypto.SHA1)
+}
+
 func readVariableLengthSize(first byte, reader io.ByteReader) (uint64, error) {
 	// Extract the first part of the size (last 3 bits of the first byte).
 	size := uint64(first & 0x0F)
@@ -18,6 +18,19 @@ func WithSHA256() ScannerOption {
 	}
 }
 
+// WithScannerObjectFormat sets the object format of the packfile, the one of
+// the hashes of its objects, of the bases of its ref-deltas and of its
+// checksum, SHA1 by default. Unlike WithSHA256, the objects are only hashed
+// with the hash function of the object format.
+func WithScannerObjectFormat(f format.ObjectFormat) ScannerOption {
+	return func(s *Scanner) {
+		s.format = f
+		s.hasher = plumbing.NewHasher(f, plumbing.AnyObject, 0)
+		s.packhash = newPackHash(f)
+		s.objectIDSize = f.Size()
+	}
+}
+
 // WithBufioReader passes a bufio.Reader for scanner to use.
 // It is used for reusing the buffer across multiple scanner instances.
 func WithBufioReader(buf *bufio.Reader) ScannerOption {
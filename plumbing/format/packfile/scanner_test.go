@@ -3,6 +3,7 @@ package packfile
 import (
 	"bytes"
 	"encoding/binary"
+	"errors"
 	"io"
 	"reflect"
 	"runtime"
@@ -13,6 +14,7 @@ import (
 	"github.com/stretchr/testify/assert"
 
 	"github.com/go-git/go-git/v6/plumbing"
+	"github.com/go-git/go-git/v6/storage/memory"
 )
 
 func TestScan(t *testing.T) {
@@ -100,6 +102,99 @@ func TestScan(t *testing.T) {
 	}
 }
 
+func TestScanHeaders(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name     string
+		packfile billy.File
+		want     []ObjectHeader
+	}{
+		{"ofs", fixtures.Basic().One().Packfile(), expectedHeadersOFS256},
+		{"refs", fixtures.Basic().ByTag("ref-delta").One().Packfile(), expectedHeadersREF},
+	}
+
+	for _, tc := range tests {
+		data, err := io.ReadAll(tc.packfile)
+		assert.NoError(t, err)
+
+		var got []ObjectHeader
+		err = Scan(struct{ io.Reader }{bytes.NewReader(data)}, func(oh ObjectHeader) error {
+			got = append(got, oh)
+			return nil
+		})
+		assert.NoError(t, err, tc.name)
+		assert.Len(t, got, len(tc.want), tc.name)
+
+		for i, oh := range got {
+			oo := tc.want[i]
+			assert.Equal(t, oo.Type, oh.Type, "%s: type mismatch index: %d", tc.name, i)
+			assert.Equal(t, oo.Offset, oh.Offset, "%s: offset mismatch index: %d", tc.name, i)
+			assert.Equal(t, oo.Size, oh.Size, "%s: size mismatch index: %d", tc.name, i)
+			assert.Equal(t, oo.Reference, oh.Reference, "%s: reference mismatch index: %d", tc.name, i)
+			assert.Equal(t, oo.OffsetReference, oh.OffsetReference, "%s: offset reference mismatch index: %d", tc.name, i)
+			assert.True(t, oh.Hash.IsZero())
+
+			// The objects follow each other, up to the checksum.
+			end := int64(len(data) - 20)
+			if i+1 < len(got) {
+				end = got[i+1].Offset
+			}
+			assert.Equal(t, end, oh.ContentOffset+oh.CompressedSize, "%s: compressed size mismatch index: %d", tc.name, i)
+		}
+
+		stop := errors.New("stop")
+		calls := 0
+		err = Scan(bytes.NewReader(data), func(ObjectHeader) error {
+			calls++
+			return stop
+		})
+		assert.ErrorIs(t, err, stop)
+		assert.Equal(t, 1, calls)
+
+		corrupted := bytes.Clone(data)
+		corrupted[len(corrupted)-1] ^= 0xff
+		err = Scan(bytes.NewReader(corrupted), func(ObjectHeader) error { return nil })
+		assert.ErrorIs(t, err, ErrMalformedPackfile, tc.name)
+	}
+
+	err := Scan(bytes.NewReader([]byte("KCAP")), func(ObjectHeader) error { return nil })
+	assert.ErrorIs(t, err, ErrBadSignature)
+}
+
+func TestScanNotSeekableWithStorage(t *testing.T) {
+	t.Parallel()
+
+	st := memory.NewStorage()
+	s := NewScanner(struct{ io.Reader }{fixtures.Basic().One().Packfile()})
+	s.storage = st
+
+	var objects, deltas int
+	for s.Scan() {
+		data := s.Data()
+		if data.Section != ObjectSection {
+			continue
+		}
+
+		// Only the delta data is held, the other objects being read from
+		// the storage when the deltas are resolved.
+		oh := data.Value().(ObjectHeader)
+		if oh.Type.IsDelta() {
+			deltas++
+			assert.NotNil(t, oh.content)
+			continue
+		}
+
+		objects++
+		assert.Nil(t, oh.content)
+		assert.NoError(t, st.HasEncodedObject(oh.Hash))
+	}
+
+	assert.NoError(t, s.Error())
+	assert.Equal(t, 23, objects)
+	assert.Equal(t, 8, deltas)
+}
+
 func BenchmarkScannerBasic(b *testing.B) {
 	f := fixtures.Basic().One().Packfile()
 	scanner := NewScanner(f)
@@ -28,6 +28,7 @@ type ObjectHeader struct {
 	Offset          int64
 	ContentOffset   int64
 	Size            int64
+	CompressedSize  int64
 	Reference       plumbing.Hash
 	OffsetReference int64
 	Crc32           uint32
@@ -0,0 +1,280 @@
+package packfile
+
+import (
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/go-git/go-git/v6/plumbing"
+	"github.com/go-git/go-git/v6/plumbing/format/idxfile"
+)
+
+// VerifiedObject is an object of a packfile verified by Verify.
+type VerifiedObject struct {
+	// Hash is the hash of the object. It is zero for the deltas if the
+	// packfile couldn't be read up to their resolution.
+	Hash plumbing.Hash
+	// Type is the type of the object, the one of its base for the deltas.
+	Type plumbing.ObjectType
+	// Size is the size of the object, once inflated and for the deltas
+	// resolved.
+	Size int64
+	// PackedSize is the size of the entry of the object in the packfile.
+	PackedSize int64
+	// Offset is the offset of the object in the packfile.
+	Offset int64
+	// CRC32 is the checksum of the entry of the object in the packfile.
+	CRC32 uint32
+	// Depth is the length of the delta chain of the object, zero if it isn't
+	// a delta.
+	Depth int
+	// Base is the hash of the base of the delta, zero if it isn't a delta.
+	Base plumbing.Hash
+	// DeltaSize is the size of the inflated delta data, zero if it isn't a
+	// delta.
+	DeltaSize int64
+}
+
+// VerifyReport is the result of the verification of a packfile, as reported
+// by git verify-pack -v.
+type VerifyReport struct {
+	// OK is whether the packfile and its index are valid.
+	OK bool
+	// Checksum is the checksum of the packfile, zero if it couldn't be read.
+	Checksum plumbing.Hash
+	// Objects are the objects of the packfile by offset. If the packfile
+	// couldn't be read entirely, they are the ones before the first
+	// corrupted object.
+	Objects []VerifiedObject
+	// ChainLengths are the number of deltas by length of their chain.
+	ChainLengths map[int]int
+}
+
+// Verify verifies the given packfile against its index, as git verify-pack
+// does: its checksum is checked, every object is inflated, the deltas
+// resolved, and their hashes, offsets and checksums compared to the ones of
+// the index. The returned report describes every object of the packfile.
+//
+// If the packfile or the index is corrupted, a *CorruptionError locating the
+// first corrupted object is returned, along with the report of the objects
+// before it.
+func Verify(pack io.ReadSeeker, idx idxfile.Index) (*VerifyReport, error) {
+	report := &VerifyReport{ChainLengths: make(map[int]int)}
+
+	footer, err := scanForVerify(pack, idx, report)
+	if err != nil {
+		return report, err
+	}
+
+	if err := resolveForVerify(pack, report.Objects); err != nil {
+		return report, err
+	}
+
+	for _, obj := range report.Objects {
+		if obj.Depth > 0 {
+			report.ChainLengths[obj.Depth]++
+		}
+	}
+
+	if err := verifyIndex(idx, report, footer); err != nil {
+		return report, err
+	}
+
+	report.OK = true
+	return report, nil
+}
+
+// scanForVerify reads the objects of the packfile, and its checksum, into the
+// report, checking that the index has the same entries for them. It returns
+// the offset of the checksum.
+func scanForVerify(pack io.ReadSeeker, idx idxfile.Index, report *VerifyReport) (int64, error) {
+	if _, err := pack.Seek(0, io.SeekStart); err != nil {
+		return 0, err
+	}
+
+	s := NewScanner(pack)
+	var next int64
+	for s.Scan() {
+		data := s.Data()
+		switch data.Section {
+		case HeaderSection:
+			header := data.Value().(Header)
+			report.Objects = make([]VerifiedObject, 0, header.ObjectsQty)
+		case ObjectSection:
+			oh := data.Value().(ObjectHeader)
+			obj := VerifiedObject{
+				Hash:       oh.Hash,
+				Type:       oh.Type,
+				Size:       oh.Size,
+				PackedSize: s.offset - oh.Offset,
+				Offset:     oh.Offset,
+				CRC32:      oh.Crc32,
+			}
+
+			if oh.Type.IsDelta() {
+				obj.Hash = plumbing.ZeroHash
+				obj.Size = 0
+				obj.DeltaSize = oh.Size
+				obj.Base = oh.Reference
+			}
+
+			// The entry is checked before the following objects are read,
+			// so that a corrupted entry is found even if the packfile can't
+			// be read further.
+			if err := verifyEntry(idx, &obj); err != nil {
+				return 0, err
+			}
+
+			report.Objects = append(report.Objects, obj)
+		case FooterSection:
+			report.Checksum = data.Value().(plumbing.Hash)
+		}
+
+		next = s.offset
+	}
+
+	if err := s.Error(); err != nil {
+		if next == 0 {
+			// The header of the packfile is corrupted.
+			return 0, &CorruptionError{Err: err}
+		}
+
+		return 0, &CorruptionError{Offset: next, Err: err}
+	}
+
+	if len(report.Objects) == 0 {
+		return 0, &CorruptionError{Err: ErrEmptyPackfile}
+	}
+
+	return next - int64(report.Checksum.Size()), nil
+}
+
+// verifyEntry checks that the index has an entry at the offset of the
+// object, with the same checksum.
+func verifyEntry(idx idxfile.Index, obj *VerifiedObject) error {
+	h, err := idx.FindHash(obj.Offset)
+	if errors.Is(err, plumbing.ErrObjectNotFound) {
+		return &CorruptionError{Offset: obj.Offset, Hash: obj.Hash, Err: errors.New("object missing from the index")}
+	}
+	if err != nil {
+		return err
+	}
+
+	crc, err := idx.FindCRC32(h)
+	if err != nil {
+		return err
+	}
+
+	if crc != obj.CRC32 {
+		return &CorruptionError{
+			Offset: obj.Offset,
+			Hash:   h,
+			Err:    fmt.Errorf("crc32 mismatch, expected %08x but found %08x", crc, obj.CRC32),
+		}
+	}
+
+	return nil
+}
+
+// resolveForVerify resolves the deltas of the packfile, filling the hash,
+// type, size, depth and base of the objects.
+func resolveForVerify(pack io.ReadSeeker, objects []VerifiedObject) error {
+	if _, err := pack.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+
+	p := NewParser(pack)
+	if _, err := p.Parse(); err != nil {
+		var derr *deltaOffsetError
+		if errors.As(err, &derr) {
+			return &CorruptionError{Offset: derr.offset, Err: derr.err}
+		}
+
+		return err
+	}
+
+	byOffset := make(map[int64]*VerifiedObject, len(objects))
+	for i := range objects {
+		byOffset[objects[i].Offset] = &objects[i]
+	}
+
+	for _, oh := range p.cache.oi {
+		obj := byOffset[oh.Offset]
+		if obj == nil {
+			continue
+		}
+
+		obj.Hash = oh.Hash
+		obj.Type = oh.Type
+		obj.Size = oh.Size
+		if !oh.diskType.IsDelta() {
+			continue
+		}
+
+		for parent := oh; parent != nil && parent.diskType.IsDelta(); parent = parent.parent {
+			obj.Depth++
+		}
+
+		if oh.parent != nil {
+			obj.Base = oh.parent.Hash
+		}
+	}
+
+	return nil
+}
+
+// verifyIndex checks that the objects of the packfile have the hashes of the
+// index, that the index has no other entry, and that it was built for the
+// packfile.
+func verifyIndex(idx idxfile.Index, report *VerifyReport, footer int64) error {
+	offsets := make(map[int64]bool, len(report.Objects))
+	for _, obj := range report.Objects {
+		offsets[obj.Offset] = true
+
+		h, err := idx.FindHash(obj.Offset)
+		if err != nil {
+			return err
+		}
+
+		if h != obj.Hash {
+			return &CorruptionError{
+				Offset: obj.Offset,
+				Hash:   obj.Hash,
+				Err:    fmt.Errorf("hash mismatch, the index has %s", h),
+			}
+		}
+	}
+
+	iter, err := idx.EntriesByOffset()
+	if err != nil {
+		return err
+	}
+
+	defer iter.Close()
+	for {
+		e, err := iter.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+
+		if !offsets[int64(e.Offset)] {
+			return &CorruptionError{
+				Offset: int64(e.Offset),
+				Hash:   e.Hash,
+				Err:    errors.New("object of the index missing from the packfile"),
+			}
+		}
+	}
+
+	if m, ok := idx.(*idxfile.MemoryIndex); ok && !m.PackfileChecksum.IsZero() && m.PackfileChecksum != report.Checksum {
+		return &CorruptionError{
+			Offset: footer,
+			Err:    fmt.Errorf("checksum mismatch, the index has %s", m.PackfileChecksum),
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,150 @@
+package packfile_test
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	fixtures "github.com/go-git/go-git-fixtures/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/go-git/go-git/v6/plumbing"
+	"github.com/go-git/go-git/v6/plumbing/format/packfile"
+)
+
+func readFixture(t *testing.T, f *fixtures.Fixture) (pack, idx []byte) {
+	pf := f.Packfile()
+	defer pf.Close()
+	pack, err := io.ReadAll(pf)
+	require.NoError(t, err)
+
+	idxf := f.Idx()
+	defer idxf.Close()
+	idx, err = io.ReadAll(idxf)
+	require.NoError(t, err)
+
+	return pack, idx
+}
+
+func verify(t *testing.T, pack, idx []byte) (*packfile.VerifyReport, error) {
+	index := getIndexFromIdxFile(io.NopCloser(bytes.NewReader(idx)))
+	return packfile.Verify(bytes.NewReader(pack), index)
+}
+
+func TestVerify(t *testing.T) {
+	t.Parallel()
+
+	for _, f := range fixtures.Basic().ByTag("packfile") {
+		pack, idx := readFixture(t, f)
+
+		report, err := verify(t, pack, idx)
+		require.NoError(t, err)
+		assert.True(t, report.OK)
+		assert.Equal(t, f.PackfileHash, report.Checksum.String())
+
+		count, err := getIndexFromIdxFile(io.NopCloser(bytes.NewReader(idx))).Count()
+		require.NoError(t, err)
+		assert.Len(t, report.Objects, int(count))
+	}
+}
+
+// TestVerifyLikeGit compares the report of Verify to the one of git
+// verify-pack -v.
+func TestVerifyLikeGit(t *testing.T) {
+	t.Parallel()
+
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not found")
+	}
+
+	pack, idx := readFixture(t, fixtures.Basic().One())
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "pack-test.pack"), pack, 0o644))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "pack-test.idx"), idx, 0o644))
+
+	out, err := exec.Command("git", "verify-pack", "-v", filepath.Join(dir, "pack-test.idx")).Output()
+	require.NoError(t, err)
+
+	report, err := verify(t, pack, idx)
+	require.NoError(t, err)
+
+	var lines []string
+	chains := make(map[int]int)
+	for _, obj := range report.Objects {
+		line := fmt.Sprintf("%s %-6s %d %d %d", obj.Hash, obj.Type, obj.Size, obj.PackedSize, obj.Offset)
+		if obj.Depth > 0 {
+			line = fmt.Sprintf("%s %-6s %d %d %d %d %s", obj.Hash, obj.Type, obj.DeltaSize, obj.PackedSize, obj.Offset, obj.Depth, obj.Base)
+			chains[obj.Depth]++
+		}
+
+		lines = append(lines, line)
+	}
+
+	expected := strings.Split(string(out), "\n")
+	assert.Equal(t, expected[:len(lines)], lines)
+	assert.Equal(t, chains, report.ChainLengths)
+	assert.Equal(t, map[int]int{1: 3, 2: 4, 3: 1}, report.ChainLengths)
+}
+
+func TestVerifyCorrupted(t *testing.T) {
+	t.Parallel()
+
+	pack, idx := readFixture(t, fixtures.Basic().One())
+	report, err := verify(t, pack, idx)
+	require.NoError(t, err)
+
+	for i, obj := range report.Objects {
+		if i == 0 || i == len(report.Objects)-1 {
+			continue
+		}
+
+		// A byte of the compressed data of the object is corrupted.
+		corrupted := bytes.Clone(pack)
+		corrupted[obj.Offset+obj.PackedSize-5] ^= 0xff
+
+		r, err := verify(t, corrupted, idx)
+		var cerr *packfile.CorruptionError
+		require.ErrorAs(t, err, &cerr, "object %s", obj.Hash)
+		assert.Equal(t, obj.Offset, cerr.Offset, "object %s", obj.Hash)
+		assert.False(t, r.OK)
+		require.Len(t, r.Objects, i)
+		for j, o := range r.Objects {
+			assert.Equal(t, report.Objects[j].Offset, o.Offset)
+			assert.Equal(t, report.Objects[j].CRC32, o.CRC32)
+		}
+	}
+}
+
+func TestVerifyBadChecksum(t *testing.T) {
+	t.Parallel()
+
+	pack, idx := readFixture(t, fixtures.Basic().One())
+	pack[len(pack)-1] ^= 0xff
+
+	_, err := verify(t, pack, idx)
+	var cerr *packfile.CorruptionError
+	require.ErrorAs(t, err, &cerr)
+	assert.Equal(t, int64(len(pack)-20), cerr.Offset)
+	assert.ErrorIs(t, err, packfile.ErrMalformedPackfile)
+}
+
+func TestVerifyIndexOfAnotherPackfile(t *testing.T) {
+	t.Parallel()
+
+	pack, _ := readFixture(t, fixtures.Basic().One())
+	_, idx := readFixture(t, fixtures.Basic().ByTag("ref-delta").One())
+
+	_, err := verify(t, pack, idx)
+	var cerr *packfile.CorruptionError
+	require.ErrorAs(t, err, &cerr)
+	assert.True(t, cerr.Offset > 0)
+	assert.False(t, errors.Is(err, packfile.ErrMalformedPackfile))
+	assert.NotEqual(t, plumbing.ZeroHash, cerr.Hash)
+}
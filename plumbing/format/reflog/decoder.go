@@ -0,0 +1,120 @@
+package reflog
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-git/go-git/v6/plumbing"
+)
+
+// A Decoder reads the entries of a reflog from an input stream.
+type Decoder struct {
+	r *bufio.Reader
+}
+
+// NewDecoder returns a new decoder that reads from r.
+func NewDecoder(r io.Reader) *Decoder {
+	return &Decoder{r: bufio.NewReader(r)}
+}
+
+// Decode reads the next entry of the reflog and stores it in the value
+// pointed to by e. It returns io.EOF when there are no more entries.
+func (d *Decoder) Decode(e *Entry) error {
+	line, err := d.r.ReadString('\n')
+	if err == io.EOF && line != "" {
+		err = nil
+	}
+
+	if err != nil {
+		return err
+	}
+
+	line = strings.TrimSuffix(line, "\n")
+	old, rest, ok1 := strings.Cut(line, " ")
+	hash, rest, ok2 := strings.Cut(rest, " ")
+	if !ok1 || !ok2 {
+		return fmt.Errorf("%w: %q", ErrMalformedEntry, line)
+	}
+
+	committer, message, _ := strings.Cut(rest, "\t")
+
+	*e = Entry{Message: message}
+	if e.Old, ok1 = plumbing.FromHex(old); !ok1 {
+		return fmt.Errorf("%w: invalid object id %q", ErrMalformedEntry, old)
+	}
+
+	if e.New, ok2 = plumbing.FromHex(hash); !ok2 {
+		return fmt.Errorf("%w: invalid object id %q", ErrMalformedEntry, hash)
+	}
+
+	return decodeCommitter(e, committer)
+}
+
+// decodeCommitter decodes the committer of an entry, in the form:
+// <name> SP "<" <email> ">" SP <timestamp> SP <timezone>
+func decodeCommitter(e *Entry, committer string) error {
+	open := strings.LastIndexByte(committer, '<')
+	end := strings.LastIndexByte(committer, '>')
+	if open < 0 || end < open {
+		return fmt.Errorf("%w: invalid committer %q", ErrMalformedEntry, committer)
+	}
+
+	e.Name = strings.TrimSpace(committer[:open])
+	e.Email = committer[open+1 : end]
+
+	ts, tz, _ := strings.Cut(strings.TrimSpace(committer[end+1:]), " ")
+	sec, err := strconv.ParseInt(ts, 10, 64)
+	if err != nil {
+		return fmt.Errorf("%w: invalid timestamp %q", ErrMalformedEntry, ts)
+	}
+
+	e.When = time.Unix(sec, 0).In(time.UTC)
+	if offset, ok := decodeTimezone(tz); ok {
+		e.When = e.When.In(time.FixedZone("", offset))
+	}
+
+	return nil
+}
+
+// decodeTimezone returns the offset in seconds of a timezone in the form
+// +hhmm or -hhmm.
+func decodeTimezone(tz string) (int, bool) {
+	if len(tz) != 5 || (tz[0] != '+' && tz[0] != '-') {
+		return 0, false
+	}
+
+	hours, err1 := strconv.Atoi(tz[1:3])
+	mins, err2 := strconv.Atoi(tz[3:])
+	if err1 != nil || err2 != nil {
+		return 0, false
+	}
+
+	offset := hours*60*60 + mins*60
+	if tz[0] == '-' {
+		offset = -offset
+	}
+
+	return offset, true
+}
+
+// DecodeAll reads all the remaining entries of the reflog, the oldest first.
+func (d *Decoder) DecodeAll() ([]*Entry, error) {
+	var entries []*Entry
+	for {
+		e := &Entry{}
+		err := d.Decode(e)
+		if err == io.EOF {
+			return entries, nil
+		}
+
+		if err != nil {
+			return nil, err
+		}
+
+		entries = append(entries, e)
+	}
+}
@@ -0,0 +1,63 @@
+package reflog
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/go-git/go-git/v6/plumbing"
+)
+
+func TestDecode(t *testing.T) {
+	t.Parallel()
+
+	input := "0000000000000000000000000000000000000000 6ecf0ef2c2dffb796033e5a02219af86ec6584e5 John Doe <john@example.com> 1427802434 +0200\tcommit (initial): first\n" +
+		"6ecf0ef2c2dffb796033e5a02219af86ec6584e5 918c48b83bd081e863dbe1b80f8998f058cd8294 Jane Roe <jane@example.com> 1427802494 -0130\n"
+
+	entries, err := NewDecoder(strings.NewReader(input)).DecodeAll()
+	require.NoError(t, err)
+	require.Len(t, entries, 2)
+
+	assert.Equal(t, plumbing.ZeroHash, entries[0].Old)
+	assert.Equal(t, plumbing.NewHash("6ecf0ef2c2dffb796033e5a02219af86ec6584e5"), entries[0].New)
+	assert.Equal(t, "John Doe", entries[0].Name)
+	assert.Equal(t, "john@example.com", entries[0].Email)
+	assert.Equal(t, int64(1427802434), entries[0].When.Unix())
+	_, offset := entries[0].When.Zone()
+	assert.Equal(t, 2*60*60, offset)
+	assert.Equal(t, "commit (initial): first", entries[0].Message)
+
+	assert.Equal(t, entries[0].New, entries[1].Old)
+	assert.Equal(t, "Jane Roe", entries[1].Name)
+	_, offset = entries[1].When.Zone()
+	assert.Equal(t, -90*60, offset)
+	assert.Empty(t, entries[1].Message)
+}
+
+func TestDecodeWithoutTrailingNewline(t *testing.T) {
+	t.Parallel()
+
+	input := "0000000000000000000000000000000000000000 6ecf0ef2c2dffb796033e5a02219af86ec6584e5 John Doe <john@example.com> 1427802434 +0000\tbranch: Created from HEAD"
+
+	entries, err := NewDecoder(strings.NewReader(input)).DecodeAll()
+	require.NoError(t, err)
+	require.Len(t, entries, 1)
+	assert.Equal(t, int64(1427802434), entries[0].When.Unix())
+	assert.Equal(t, "branch: Created from HEAD", entries[0].Message)
+}
+
+func TestDecodeMalformed(t *testing.T) {
+	t.Parallel()
+
+	for _, input := range []string{
+		"foo\n",
+		"0000000000000000000000000000000000000000 foo John Doe <john@example.com> 1427802434 +0000\n",
+		"0000000000000000000000000000000000000000 6ecf0ef2c2dffb796033e5a02219af86ec6584e5 John Doe 1427802434 +0000\n",
+		"0000000000000000000000000000000000000000 6ecf0ef2c2dffb796033e5a02219af86ec6584e5 John Doe <john@example.com> foo +0000\n",
+	} {
+		_, err := NewDecoder(strings.NewReader(input)).DecodeAll()
+		assert.ErrorIs(t, err, ErrMalformedEntry, input)
+	}
+}
@@ -0,0 +1,11 @@
+// Package reflog implements encoding and decoding of reflogs, the logs of
+// the updates of the references kept by git in the .git/logs directory.
+//
+// Each update is recorded in a line appended to the log of the reference,
+// the oldest entry being the first one:
+//
+//	entry     = old-id SP new-id SP committer [HT message] LF
+//	committer = name SP "<" email ">" SP timestamp SP timezone
+//
+// The old id is the zero id when the reference was created by the update.
+package reflog
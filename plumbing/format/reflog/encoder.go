@@ -0,0 +1,40 @@
+package reflog
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// An Encoder writes the entries of a reflog to an output stream.
+type Encoder struct {
+	w io.Writer
+}
+
+// NewEncoder returns a new encoder that writes to w.
+func NewEncoder(w io.Writer) *Encoder {
+	return &Encoder{w: w}
+}
+
+// Encode writes the given entries, one per line. As git does, the messages
+// are written in a single line, with their line breaks replaced by spaces.
+func (e *Encoder) Encode(entries ...*Entry) error {
+	w := bufio.NewWriter(e.w)
+	for _, entry := range entries {
+		fmt.Fprintf(w, "%s %s %s <%s> %d %s", entry.Old, entry.New,
+			entry.Name, entry.Email, max(entry.When.Unix(), 0), entry.When.Format("-0700"))
+
+		if msg := cleanMessage(entry.Message); msg != "" {
+			fmt.Fprintf(w, "\t%s", msg)
+		}
+
+		fmt.Fprintln(w)
+	}
+
+	return w.Flush()
+}
+
+func cleanMessage(msg string) string {
+	return strings.Join(strings.Fields(msg), " ")
+}
@@ -0,0 +1,43 @@
+package reflog
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/go-git/go-git/v6/plumbing"
+)
+
+func TestEncode(t *testing.T) {
+	t.Parallel()
+
+	entries := []*Entry{{
+		New:     plumbing.NewHash("6ecf0ef2c2dffb796033e5a02219af86ec6584e5"),
+		Name:    "John Doe",
+		Email:   "john@example.com",
+		When:    time.Unix(1427802434, 0).In(time.FixedZone("", 2*60*60)),
+		Message: "commit (initial): first",
+	}, {
+		Old:     plumbing.NewHash("6ecf0ef2c2dffb796033e5a02219af86ec6584e5"),
+		New:     plumbing.NewHash("918c48b83bd081e863dbe1b80f8998f058cd8294"),
+		Name:    "Jane Roe",
+		Email:   "jane@example.com",
+		When:    time.Unix(1427802494, 0).In(time.FixedZone("", -90*60)),
+		Message: "  merge:\n\tsome\n\nlines ",
+	}}
+
+	var buf bytes.Buffer
+	require.NoError(t, NewEncoder(&buf).Encode(entries...))
+	assert.Equal(t, "0000000000000000000000000000000000000000 6ecf0ef2c2dffb796033e5a02219af86ec6584e5 John Doe <john@example.com> 1427802434 +0200\tcommit (initial): first\n"+
+		"6ecf0ef2c2dffb796033e5a02219af86ec6584e5 918c48b83bd081e863dbe1b80f8998f058cd8294 Jane Roe <jane@example.com> 1427802494 -0130\tmerge: some lines\n",
+		buf.String())
+
+	decoded, err := NewDecoder(&buf).DecodeAll()
+	require.NoError(t, err)
+	require.Len(t, decoded, 2)
+	assert.Equal(t, "merge: some lines", decoded[1].Message)
+	assert.True(t, entries[1].When.Equal(decoded[1].When))
+}
@@ -0,0 +1,28 @@
+package reflog
+
+import (
+	"errors"
+	"time"
+
+	"github.com/go-git/go-git/v6/plumbing"
+)
+
+// ErrMalformedEntry is returned by Decode when a line of the reflog is
+// corrupted.
+var ErrMalformedEntry = errors.New("malformed reflog entry")
+
+// Entry is an entry of a reflog, recording an update of a reference.
+type Entry struct {
+	// Old is the hash the reference pointed to before the update, zero when
+	// the reference was created.
+	Old plumbing.Hash
+	// New is the hash the reference points to after the update.
+	New plumbing.Hash
+	// Name and Email identify the committer updating the reference.
+	Name  string
+	Email string
+	// When is the time of the update.
+	When time.Time
+	// Message describes the update, such as "commit: <subject>".
+	Message string
+}
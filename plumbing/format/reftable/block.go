@@ -0,0 +1,170 @@
+package reftable
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"fmt"
+)
+
+// restartInterval is the number of records between two restart points of a
+// block, whose key is written as a whole, as git does.
+const restartInterval = 16
+
+// blockWriter writes the records of a block. The block starts with
+// headerSize bytes left for the header of the table, for the first block of
+// a table.
+type blockWriter struct {
+	typ            byte
+	buf            []byte
+	headerSize     int
+	blockSize      int
+	hashSize       int
+	minUpdateIndex uint64
+
+	restarts []int
+	lastKey  []byte
+	records  int
+}
+
+func newBlockWriter(typ byte, headerSize, blockSize, hashSize int, minUpdateIndex uint64) *blockWriter {
+	w := &blockWriter{
+		typ:            typ,
+		headerSize:     headerSize,
+		blockSize:      blockSize,
+		hashSize:       hashSize,
+		minUpdateIndex: minUpdateIndex,
+	}
+
+	w.buf = make([]byte, headerSize+4, blockSize)
+	w.buf[headerSize] = typ
+	return w
+}
+
+// add adds the record to the block, returning false if it doesn't fit. The
+// first record of a log block is always added, a log block growing as
+// needed.
+func (w *blockWriter) add(r record) bool {
+	key := r.key()
+	restart := w.records%restartInterval == 0
+	prefix := 0
+	if !restart {
+		for prefix < len(key) && prefix < len(w.lastKey) && key[prefix] == w.lastKey[prefix] {
+			prefix++
+		}
+	}
+
+	b := appendVarint(nil, uint64(prefix))
+	b = appendVarint(b, uint64(len(key)-prefix)<<3|uint64(r.valueType()))
+	b = append(b, key[prefix:]...)
+	b = r.appendValue(b, w.hashSize, w.minUpdateIndex)
+
+	restarts := len(w.restarts)
+	if restart {
+		restarts++
+	}
+
+	if len(w.buf)+len(b)+3*restarts+2 > w.blockSize && (w.records > 0 || w.typ != blockTypeLog) {
+		return false
+	}
+
+	if restart {
+		w.restarts = append(w.restarts, len(w.buf))
+	}
+
+	w.buf = append(w.buf, b...)
+	w.lastKey = key
+	w.records++
+	return true
+}
+
+// finish returns the block, its restart points written, compressed for a
+// log block. Its first headerSize bytes are left for the header of the table.
+func (w *blockWriter) finish() ([]byte, error) {
+	for _, r := range w.restarts {
+		w.buf = appendUint24(w.buf, uint32(r))
+	}
+
+	w.buf = binary.BigEndian.AppendUint16(w.buf, uint16(len(w.restarts)))
+	if len(w.buf) >= 1<<24 {
+		return nil, ErrRecordTooLarge
+	}
+
+	putUint24(w.buf[w.headerSize+1:], uint32(len(w.buf)))
+	if w.typ != blockTypeLog {
+		return w.buf, nil
+	}
+
+	var out bytes.Buffer
+	out.Write(w.buf[:w.headerSize+4])
+	zw := zlib.NewWriter(&out)
+	if _, err := zw.Write(w.buf[w.headerSize+4:]); err != nil {
+		return nil, err
+	}
+
+	if err := zw.Close(); err != nil {
+		return nil, err
+	}
+
+	return out.Bytes(), nil
+}
+
+// blockRecords calls fn with the key, the value type and the value of each
+// record of the block, data being the block, inflated, whose records start
+// after headerSize bytes. fn returns the number of bytes of the value, and
+// whether to stop.
+func blockRecords(data []byte, headerSize int, fn func(key []byte, vt uint8, value []byte) (int, bool, error)) error {
+	if len(data) < headerSize+6 {
+		return fmt.Errorf("%w: truncated block", ErrMalformedTable)
+	}
+
+	restarts := int(binary.BigEndian.Uint16(data[len(data)-2:]))
+	end := len(data) - 2 - 3*restarts
+	if end < headerSize+4 {
+		return fmt.Errorf("%w: invalid restart count", ErrMalformedTable)
+	}
+
+	var key []byte
+	for pos := headerSize + 4; pos < end; {
+		prefix, n, err := readVarint(data[pos:end])
+		if err != nil {
+			return err
+		}
+
+		pos += n
+		sv, n, err := readVarint(data[pos:end])
+		if err != nil {
+			return err
+		}
+
+		pos += n
+		suffix := int(sv >> 3)
+		if prefix > uint64(len(key)) || end-pos < suffix {
+			return fmt.Errorf("%w: invalid record key", ErrMalformedTable)
+		}
+
+		key = append(key[:prefix:prefix], data[pos:pos+suffix]...)
+		pos += suffix
+
+		n, stop, err := fn(key, uint8(sv&7), data[pos:end])
+		if err != nil || stop {
+			return err
+		}
+
+		pos += n
+	}
+
+	return nil
+}
+
+func appendUint24(b []byte, v uint32) []byte {
+	return append(b, byte(v>>16), byte(v>>8), byte(v))
+}
+
+func putUint24(b []byte, v uint32) {
+	b[0], b[1], b[2] = byte(v>>16), byte(v>>8), byte(v)
+}
+
+func uint24(b []byte) uint32 {
+	return uint32(b[0])<<16 | uint32(b[1])<<8 | uint32(b[2])
+}
@@ -0,0 +1,25 @@
+// Package reftable implements reading and writing of the reftable files, the
+// binary format of the references and the reflogs kept by git in the
+// .git/reftable directory when extensions.refStorage is reftable, and of
+// their stack, the tables listed by the tables.list file.
+//
+// A table holds the ref records, sorted by name, then the log records,
+// sorted by reference name and then by update index, the most recent first,
+// both split in blocks:
+//
+//	table  = header ref-block* log-block* footer
+//	header = "REFT" version block-size min-update-index max-update-index [hash-id]
+//	footer = header ref-index-position obj-position obj-index-position
+//	         log-position log-index-position crc32
+//
+// The ref blocks are padded to the block size, the log blocks being
+// compressed with zlib. The keys of the records of a block are prefix
+// compressed, but at the restart points listed at the end of the block. Each
+// record is given an update index, the table of the most recent one holding
+// the current value of a reference, or its deletion.
+//
+// The indexes of the blocks and the blocks of object ids written by git are
+// optional: they are skipped when reading a table, and not written.
+//
+// See https://git-scm.com/docs/reftable for the format.
+package reftable
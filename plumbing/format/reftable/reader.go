@@ -0,0 +1,413 @@
+package reftable
+
+import (
+	"bufio"
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"fmt"
+	"hash/crc32"
+	"io"
+
+	"github.com/go-git/go-git/v6/plumbing"
+	format "github.com/go-git/go-git/v6/plumbing/format/config"
+)
+
+var magic = []byte("REFT")
+
+const (
+	version1 = 1
+	version2 = 2
+
+	headerSizeV1 = 24
+	headerSizeV2 = 28
+	// footerFields is the size of the fields of the footer following the
+	// copy of the header.
+	footerFields = 44
+
+	hashIDSHA1   uint32 = 0x73686131 // "sha1"
+	hashIDSHA256 uint32 = 0x73323536 // "s256"
+)
+
+// Reader reads the records of a table.
+type Reader struct {
+	r    io.ReaderAt
+	size int64
+
+	headerSize     int
+	blockSize      int64
+	minUpdateIndex uint64
+	maxUpdateIndex uint64
+	format         format.ObjectFormat
+	firstBlockType byte
+
+	refEnd int64
+	logPos int64
+	logEnd int64
+}
+
+// NewReader returns a reader of the table r of the given size, reading its
+// header and its footer.
+func NewReader(r io.ReaderAt, size int64) (*Reader, error) {
+	header := make([]byte, headerSizeV2)
+	if size < headerSizeV1 {
+		return nil, fmt.Errorf("%w: truncated header", ErrMalformedTable)
+	}
+
+	if _, err := r.ReadAt(header[:headerSizeV1], 0); err != nil {
+		return nil, err
+	}
+
+	if !bytes.Equal(header[:4], magic) {
+		return nil, fmt.Errorf("%w: invalid signature", ErrMalformedTable)
+	}
+
+	t := &Reader{r: r, size: size}
+	switch header[4] {
+	case version1:
+		t.headerSize = headerSizeV1
+	case version2:
+		t.headerSize = headerSizeV2
+	default:
+		return nil, fmt.Errorf("%w: %d", ErrUnsupportedVersion, header[4])
+	}
+
+	footerSize := int64(t.headerSize + footerFields)
+	if size < int64(t.headerSize)+footerSize {
+		return nil, fmt.Errorf("%w: truncated table", ErrMalformedTable)
+	}
+
+	footer := make([]byte, footerSize)
+	if _, err := r.ReadAt(footer, size-footerSize); err != nil {
+		return nil, err
+	}
+
+	if _, err := r.ReadAt(header[:t.headerSize], 0); err != nil {
+		return nil, err
+	}
+
+	if !bytes.Equal(footer[:t.headerSize], header[:t.headerSize]) {
+		return nil, fmt.Errorf("%w: footer not matching the header", ErrMalformedTable)
+	}
+
+	crc := binary.BigEndian.Uint32(footer[footerSize-4:])
+	if crc32.ChecksumIEEE(footer[:footerSize-4]) != crc {
+		return nil, fmt.Errorf("%w: invalid footer checksum", ErrMalformedTable)
+	}
+
+	t.blockSize = int64(uint24(header[5:]))
+	t.minUpdateIndex = binary.BigEndian.Uint64(header[8:])
+	t.maxUpdateIndex = binary.BigEndian.Uint64(header[16:])
+	if t.headerSize == headerSizeV2 {
+		switch binary.BigEndian.Uint32(header[24:]) {
+		case hashIDSHA1:
+			t.format = format.SHA1
+		case hashIDSHA256:
+			t.format = format.SHA256
+		default:
+			return nil, fmt.Errorf("%w: unknown hash id", ErrMalformedTable)
+		}
+	}
+
+	fields := footer[t.headerSize:]
+	refIndexPos := int64(binary.BigEndian.Uint64(fields))
+	objPos := int64(binary.BigEndian.Uint64(fields[8:]) >> 5)
+	t.logPos = int64(binary.BigEndian.Uint64(fields[24:]))
+	logIndexPos := int64(binary.BigEndian.Uint64(fields[32:]))
+	footerPos := size - footerSize
+
+	if footerPos > int64(t.headerSize) {
+		typ := make([]byte, 1)
+		if _, err := r.ReadAt(typ, int64(t.headerSize)); err != nil {
+			return nil, err
+		}
+
+		t.firstBlockType = typ[0]
+	}
+
+	// The ref blocks are followed by the first of the other sections, and
+	// the log blocks by their index, if any.
+	t.refEnd = footerPos
+	for _, pos := range []int64{t.logPos, objPos, refIndexPos} {
+		if pos > 0 && pos < t.refEnd {
+			t.refEnd = pos
+		}
+	}
+
+	t.logEnd = footerPos
+	if logIndexPos > 0 {
+		t.logEnd = logIndexPos
+	}
+
+	return t, nil
+}
+
+// MinUpdateIndex returns the minimum update index of the records of the
+// table.
+func (t *Reader) MinUpdateIndex() uint64 { return t.minUpdateIndex }
+
+// MaxUpdateIndex returns the maximum update index of the records of the
+// table.
+func (t *Reader) MaxUpdateIndex() uint64 { return t.maxUpdateIndex }
+
+// ObjectFormat returns the object format of the object ids of the table.
+func (t *Reader) ObjectFormat() format.ObjectFormat { return t.format }
+
+// Refs returns the ref records of the table, sorted by name.
+func (t *Reader) Refs() ([]*Ref, error) {
+	var refs []*Ref
+	err := t.refRecords(func(r *Ref) bool {
+		refs = append(refs, r)
+		return false
+	})
+
+	return refs, err
+}
+
+// Ref returns the ref record of the reference of the given name, which is
+// a deletion if the table records one, or plumbing.ErrReferenceNotFound if
+// the table holds no record of the reference.
+func (t *Reader) Ref(name string) (*Ref, error) {
+	var ref *Ref
+	err := t.refRecords(func(r *Ref) bool {
+		if r.Name >= name {
+			if r.Name == name {
+				ref = r
+			}
+
+			return true
+		}
+
+		return false
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	if ref == nil {
+		return nil, plumbing.ErrReferenceNotFound
+	}
+
+	return ref, nil
+}
+
+// Logs returns the log records of the table, sorted by reference name, the
+// most recent first.
+func (t *Reader) Logs() ([]*Log, error) {
+	return t.logs("")
+}
+
+// RefLogs returns the log records of the reference of the given name, the
+// most recent first.
+func (t *Reader) RefLogs(name string) ([]*Log, error) {
+	return t.logs(name)
+}
+
+func (t *Reader) logs(name string) ([]*Log, error) {
+	var logs []*Log
+	err := t.logRecords(name, func(r *Log) bool {
+		if name != "" && r.RefName > name {
+			return true
+		}
+
+		if name == "" || r.RefName == name {
+			logs = append(logs, r)
+		}
+
+		return false
+	})
+
+	return logs, err
+}
+
+// refRecords calls fn with the ref records, in order, until it returns true.
+func (t *Reader) refRecords(fn func(*Ref) bool) error {
+	if t.firstBlockType != blockTypeRef {
+		return nil
+	}
+
+	hashSize := t.format.Size()
+	for off := int64(0); off < t.refEnd; {
+		data, size, err := t.block(off, t.refEnd)
+		if err != nil {
+			return err
+		}
+
+		if data[t.blockHeaderSize(off)] != blockTypeRef {
+			return nil
+		}
+
+		stop := false
+		err = blockRecords(data, t.blockHeaderSize(off), func(key []byte, vt uint8, value []byte) (int, bool, error) {
+			r, n, err := decodeRef(key, vt, value, hashSize, t.minUpdateIndex)
+			if err != nil {
+				return 0, false, err
+			}
+
+			stop = fn(r)
+			return n, stop, nil
+		})
+
+		if err != nil || stop {
+			return err
+		}
+
+		off += size
+	}
+
+	return nil
+}
+
+// logRecords calls fn with the log records, in order, until it returns true,
+// starting from the block holding the first ones of the given reference.
+func (t *Reader) logRecords(name string, fn func(*Log) bool) error {
+	if t.firstBlockType != blockTypeLog && t.logPos == 0 {
+		return nil
+	}
+
+	hashSize := t.format.Size()
+	for off := t.logPos; off < t.logEnd; {
+		data, size, err := t.block(off, t.logEnd)
+		if err != nil {
+			return err
+		}
+
+		headerSize := t.blockHeaderSize(off)
+		if data[headerSize] != blockTypeLog {
+			return nil
+		}
+
+		stop := false
+		err = blockRecords(data, headerSize, func(key []byte, vt uint8, value []byte) (int, bool, error) {
+			r, n, err := decodeLog(key, vt, value, hashSize)
+			if err != nil {
+				return 0, false, err
+			}
+
+			// The blocks before the first one holding the logs of the
+			// reference are skipped, by their last record.
+			if name != "" && r.RefName < name {
+				return n, false, nil
+			}
+
+			stop = fn(r)
+			return n, stop, nil
+		})
+
+		if err != nil || stop {
+			return err
+		}
+
+		off += size
+	}
+
+	return nil
+}
+
+// blockHeaderSize returns the size of the header of the table before the
+// block at the given offset, the first block including it.
+func (t *Reader) blockHeaderSize(off int64) int {
+	if off == 0 {
+		return t.headerSize
+	}
+
+	return 0
+}
+
+// block returns the block at the given offset, inflated, and the size it
+// takes in the table, up to end.
+func (t *Reader) block(off, end int64) ([]byte, int64, error) {
+	headerSize := int64(t.blockHeaderSize(off))
+	if end-off < headerSize+4 {
+		return nil, 0, fmt.Errorf("%w: truncated block", ErrMalformedTable)
+	}
+
+	header := make([]byte, 4)
+	if _, err := t.r.ReadAt(header, off+headerSize); err != nil {
+		return nil, 0, err
+	}
+
+	length := int64(uint24(header[1:]))
+	if length < headerSize+4 {
+		return nil, 0, fmt.Errorf("%w: invalid block length", ErrMalformedTable)
+	}
+
+	if header[0] == blockTypeLog {
+		return t.logBlock(off, end, headerSize, length)
+	}
+
+	if length > end-off {
+		return nil, 0, fmt.Errorf("%w: truncated block", ErrMalformedTable)
+	}
+
+	// The blocks are padded to the block size, but the last one of their
+	// section, which is followed by the next block.
+	size := length
+	if t.blockSize > length && end-off > length {
+		next := make([]byte, 1)
+		if _, err := t.r.ReadAt(next, off+length); err != nil {
+			return nil, 0, err
+		}
+
+		if next[0] == 0 {
+			size = min(t.blockSize, end-off)
+		}
+	}
+
+	data := make([]byte, length)
+	if _, err := t.r.ReadAt(data, off); err != nil {
+		return nil, 0, err
+	}
+
+	return data, size, nil
+}
+
+// logBlock returns the log block at the given offset, inflated to its given
+// length, and the size of the block, compressed.
+func (t *Reader) logBlock(off, end, headerSize, length int64) ([]byte, int64, error) {
+	data := make([]byte, length)
+	if _, err := t.r.ReadAt(data[:headerSize+4], off); err != nil {
+		return nil, 0, err
+	}
+
+	start := off + headerSize + 4
+	cr := &countingReader{r: bufio.NewReader(io.NewSectionReader(t.r, start, end-start))}
+	zr, err := zlib.NewReader(cr)
+	if err != nil {
+		return nil, 0, fmt.Errorf("%w: %w", ErrMalformedTable, err)
+	}
+
+	if _, err := io.ReadFull(zr, data[headerSize+4:]); err != nil {
+		return nil, 0, fmt.Errorf("%w: %w", ErrMalformedTable, err)
+	}
+
+	// The checksum of the stream is read, and checked, at its end.
+	if n, err := zr.Read(make([]byte, 1)); n != 0 || err != io.EOF {
+		return nil, 0, fmt.Errorf("%w: invalid log block length", ErrMalformedTable)
+	}
+
+	return data, headerSize + 4 + cr.n, nil
+}
+
+// countingReader counts the bytes read from r, read byte by byte by the
+// inflater, for the end of the compressed data to be known.
+type countingReader struct {
+	r *bufio.Reader
+	n int64
+}
+
+func (r *countingReader) Read(p []byte) (int, error) {
+	n, err := r.r.Read(p)
+	r.n += int64(n)
+	return n, err
+}
+
+func (r *countingReader) ReadByte() (byte, error) {
+	b, err := r.r.ReadByte()
+	if err == nil {
+		r.n++
+	}
+
+	return b, err
+}
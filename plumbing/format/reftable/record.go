@@ -0,0 +1,332 @@
+package reftable
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/go-git/go-git/v6/plumbing"
+)
+
+var (
+	// ErrMalformedTable is returned when reading a corrupted table.
+	ErrMalformedTable = errors.New("malformed reftable")
+	// ErrUnsupportedVersion is returned when reading a table of an unknown
+	// version.
+	ErrUnsupportedVersion = errors.New("unsupported reftable version")
+	// ErrRecordTooLarge is returned by Writer.Close when a ref record
+	// doesn't fit in a block.
+	ErrRecordTooLarge = errors.New("reftable record too large for the block size")
+)
+
+// Ref is a ref record, the value of a reference, or its deletion, as of an
+// update index.
+type Ref struct {
+	// Name is the name of the reference.
+	Name string
+	// UpdateIndex is the update index of the record.
+	UpdateIndex uint64
+	// Deleted records the deletion of the reference, hiding its records of
+	// the older tables.
+	Deleted bool
+	// Target is the reference a symbolic reference points to, empty for
+	// the other ones.
+	Target string
+	// Hash is the object the reference points to, unless symbolic.
+	Hash plumbing.Hash
+	// Peeled is the object the annotated tag Hash points to, peeled, or
+	// zero if Hash isn't an annotated tag or if it wasn't peeled.
+	Peeled plumbing.Hash
+}
+
+// Log is a log record, an entry of the reflog of a reference, or its
+// deletion.
+type Log struct {
+	// RefName is the name of the reference.
+	RefName string
+	// UpdateIndex is the update index of the entry, identifying it among
+	// the entries of the reflog of the reference.
+	UpdateIndex uint64
+	// Deleted records the deletion of the entry, hiding it in the older
+	// tables.
+	Deleted bool
+	// Old is the hash the reference pointed to before the update, zero when
+	// the reference was created.
+	Old plumbing.Hash
+	// New is the hash the reference points to after the update.
+	New plumbing.Hash
+	// Name and Email identify the committer updating the reference.
+	Name  string
+	Email string
+	// When is the time of the update, to the second, in the time zone of the
+	// committer.
+	When time.Time
+	// Message describes the update. git ends it with a newline.
+	Message string
+}
+
+const (
+	blockTypeRef   = 'r'
+	blockTypeLog   = 'g'
+	blockTypeObj   = 'o'
+	blockTypeIndex = 'i'
+
+	refValueDeletion = 0
+	refValueHash     = 1
+	refValuePeeled   = 2
+	refValueSymref   = 3
+
+	logValueDeletion = 0
+	logValueUpdate   = 1
+)
+
+// record is a record of a block, encoded as its key, prefix compressed,
+// along with its value type, then its value.
+type record interface {
+	key() []byte
+	valueType() uint8
+	appendValue(b []byte, hashSize int, minUpdateIndex uint64) []byte
+}
+
+type refRecord struct{ *Ref }
+
+func (r refRecord) key() []byte { return []byte(r.Name) }
+
+func (r refRecord) valueType() uint8 {
+	switch {
+	case r.Deleted:
+		return refValueDeletion
+	case r.Target != "":
+		return refValueSymref
+	case !r.Peeled.IsZero():
+		return refValuePeeled
+	default:
+		return refValueHash
+	}
+}
+
+func (r refRecord) appendValue(b []byte, hashSize int, minUpdateIndex uint64) []byte {
+	b = appendVarint(b, r.UpdateIndex-minUpdateIndex)
+	switch r.valueType() {
+	case refValueHash:
+		b = appendHash(b, r.Hash, hashSize)
+	case refValuePeeled:
+		b = appendHash(b, r.Hash, hashSize)
+		b = appendHash(b, r.Peeled, hashSize)
+	case refValueSymref:
+		b = appendVarint(b, uint64(len(r.Target)))
+		b = append(b, r.Target...)
+	}
+
+	return b
+}
+
+type logRecord struct{ *Log }
+
+func (r logRecord) key() []byte { return logKey(r.RefName, r.UpdateIndex) }
+
+// logKey returns the key of the log record of the given reference and update
+// index, sorting the records of a reference the most recent first.
+func logKey(name string, updateIndex uint64) []byte {
+	b := make([]byte, 0, len(name)+9)
+	b = append(b, name...)
+	b = append(b, 0)
+	return binary.BigEndian.AppendUint64(b, ^updateIndex)
+}
+
+func (r logRecord) valueType() uint8 {
+	if r.Deleted {
+		return logValueDeletion
+	}
+
+	return logValueUpdate
+}
+
+func (r logRecord) appendValue(b []byte, hashSize int, _ uint64) []byte {
+	if r.Deleted {
+		return b
+	}
+
+	b = appendHash(b, r.Old, hashSize)
+	b = appendHash(b, r.New, hashSize)
+	b = appendVarint(b, uint64(len(r.Name)))
+	b = append(b, r.Name...)
+	b = appendVarint(b, uint64(len(r.Email)))
+	b = append(b, r.Email...)
+	b = appendVarint(b, uint64(r.When.Unix()))
+	_, offset := r.When.Zone()
+	b = binary.BigEndian.AppendUint16(b, uint16(int16(offset/60)))
+	b = appendVarint(b, uint64(len(r.Message)))
+	return append(b, r.Message...)
+}
+
+// appendHash appends the hash, as hashSize zero bytes if it is zero.
+func appendHash(b []byte, h plumbing.Hash, hashSize int) []byte {
+	if h.IsZero() {
+		return append(b, make([]byte, hashSize)...)
+	}
+
+	return append(b, h.Bytes()...)
+}
+
+// decodeRef decodes the value of the ref record of the given key and value
+// type from b, returning the number of bytes read.
+func decodeRef(key []byte, vt uint8, b []byte, hashSize int, minUpdateIndex uint64) (*Ref, int, error) {
+	delta, n, err := readVarint(b)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	r := &Ref{Name: string(key), UpdateIndex: minUpdateIndex + delta}
+	switch vt {
+	case refValueDeletion:
+		r.Deleted = true
+	case refValueHash, refValuePeeled:
+		if r.Hash, err = readHash(b[n:], hashSize); err != nil {
+			return nil, 0, err
+		}
+
+		n += hashSize
+		if vt == refValuePeeled {
+			if r.Peeled, err = readHash(b[n:], hashSize); err != nil {
+				return nil, 0, err
+			}
+
+			n += hashSize
+		}
+	case refValueSymref:
+		target, m, err := readString(b[n:])
+		if err != nil {
+			return nil, 0, err
+		}
+
+		r.Target = target
+		n += m
+	default:
+		return nil, 0, fmt.Errorf("%w: unknown ref value type %d", ErrMalformedTable, vt)
+	}
+
+	return r, n, nil
+}
+
+// decodeLog decodes the value of the log record of the given key and value
+// type from b, returning the number of bytes read.
+func decodeLog(key []byte, vt uint8, b []byte, hashSize int) (*Log, int, error) {
+	if len(key) < 9 || key[len(key)-9] != 0 {
+		return nil, 0, fmt.Errorf("%w: invalid log key", ErrMalformedTable)
+	}
+
+	r := &Log{
+		RefName:     string(key[:len(key)-9]),
+		UpdateIndex: ^binary.BigEndian.Uint64(key[len(key)-8:]),
+	}
+
+	switch vt {
+	case logValueDeletion:
+		r.Deleted = true
+		return r, 0, nil
+	case logValueUpdate:
+	default:
+		return nil, 0, fmt.Errorf("%w: unknown log value type %d", ErrMalformedTable, vt)
+	}
+
+	var err error
+	if r.Old, err = readHash(b, hashSize); err != nil {
+		return nil, 0, err
+	}
+
+	if r.New, err = readHash(b[hashSize:], hashSize); err != nil {
+		return nil, 0, err
+	}
+
+	n := 2 * hashSize
+	var m int
+	if r.Name, m, err = readString(b[n:]); err != nil {
+		return nil, 0, err
+	}
+
+	n += m
+	if r.Email, m, err = readString(b[n:]); err != nil {
+		return nil, 0, err
+	}
+
+	n += m
+	sec, m, err := readVarint(b[n:])
+	if err != nil {
+		return nil, 0, err
+	}
+
+	n += m
+	if len(b) < n+2 {
+		return nil, 0, fmt.Errorf("%w: truncated log record", ErrMalformedTable)
+	}
+
+	offset := int(int16(binary.BigEndian.Uint16(b[n:]))) * 60
+	n += 2
+	r.When = time.Unix(int64(sec), 0).In(time.FixedZone("", offset))
+	if r.Message, m, err = readString(b[n:]); err != nil {
+		return nil, 0, err
+	}
+
+	return r, n + m, nil
+}
+
+func readHash(b []byte, hashSize int) (plumbing.Hash, error) {
+	if len(b) < hashSize {
+		return plumbing.ZeroHash, fmt.Errorf("%w: truncated object id", ErrMalformedTable)
+	}
+
+	h, _ := plumbing.FromBytes(b[:hashSize])
+	return h, nil
+}
+
+func readString(b []byte) (string, int, error) {
+	l, n, err := readVarint(b)
+	if err != nil {
+		return "", 0, err
+	}
+
+	if uint64(len(b)-n) < l {
+		return "", 0, fmt.Errorf("%w: truncated string", ErrMalformedTable)
+	}
+
+	return string(b[n : n+int(l)]), n + int(l), nil
+}
+
+// appendVarint appends v, encoded as the offsets of the packfiles: 7 bits by
+// byte, the most significant first, each byte but the last one having its
+// high bit set, and being decremented.
+func appendVarint(b []byte, v uint64) []byte {
+	var buf [10]byte
+	i := len(buf) - 1
+	buf[i] = byte(v & 0x7f)
+	for v >>= 7; v != 0; v >>= 7 {
+		v--
+		i--
+		buf[i] = 0x80 | byte(v&0x7f)
+	}
+
+	return append(b, buf[i:]...)
+}
+
+// readVarint reads a varint written by appendVarint, returning the number of
+// bytes read.
+func readVarint(b []byte) (uint64, int, error) {
+	if len(b) == 0 {
+		return 0, 0, fmt.Errorf("%w: truncated varint", ErrMalformedTable)
+	}
+
+	v := uint64(b[0] & 0x7f)
+	n := 1
+	for b[n-1]&0x80 != 0 {
+		if n == len(b) || n == 10 {
+			return 0, 0, fmt.Errorf("%w: truncated varint", ErrMalformedTable)
+		}
+
+		v = (v+1)<<7 | uint64(b[n]&0x7f)
+		n++
+	}
+
+	return v, n, nil
+}
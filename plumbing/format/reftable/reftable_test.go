@@ -0,0 +1,214 @@
+package reftable
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/go-git/go-git/v6/plumbing"
+	format "github.com/go-git/go-git/v6/plumbing/format/config"
+)
+
+func TestVarint(t *testing.T) {
+	t.Parallel()
+
+	for _, v := range []uint64{0, 1, 127, 128, 255, 16383, 16511, 1 << 32, 1<<64 - 1} {
+		b := appendVarint(nil, v)
+		got, n, err := readVarint(b)
+		require.NoError(t, err)
+		assert.Equal(t, v, got)
+		assert.Equal(t, len(b), n)
+	}
+
+	_, _, err := readVarint([]byte{0x80})
+	assert.ErrorIs(t, err, ErrMalformedTable)
+}
+
+func writeTable(t *testing.T, o WriterOptions, refs []*Ref, logs []*Log) *Reader {
+	t.Helper()
+
+	var buf bytes.Buffer
+	w := NewWriter(&buf, o)
+	for _, r := range refs {
+		require.NoError(t, w.AddRef(r))
+	}
+
+	for _, l := range logs {
+		require.NoError(t, w.AddLog(l))
+	}
+
+	require.NoError(t, w.Close())
+	r, err := NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	require.NoError(t, err)
+	return r
+}
+
+func TestWriteRead(t *testing.T) {
+	t.Parallel()
+
+	h1 := plumbing.NewHash("6ecf0ef2c2dffb796033e5a02219af86ec6584e5")
+	h2 := plumbing.NewHash("918c48b83bd081e863dbe1b80f8998f058cd8294")
+	when := time.Unix(1257894000, 0).In(time.FixedZone("", -7*60*60))
+
+	refs := []*Ref{
+		{Name: "refs/tags/v1.0.0", UpdateIndex: 2, Hash: h1, Peeled: h2},
+		{Name: "HEAD", UpdateIndex: 1, Target: "refs/heads/master"},
+		{Name: "refs/heads/master", UpdateIndex: 1, Hash: h1},
+		{Name: "refs/heads/old", UpdateIndex: 2, Deleted: true},
+	}
+
+	logs := []*Log{
+		{RefName: "refs/heads/master", UpdateIndex: 1, New: h2, Name: "foo", Email: "foo@foo.foo", When: when, Message: "commit (initial): foo\n"},
+		{RefName: "refs/heads/master", UpdateIndex: 2, Old: h2, New: h1, Name: "foo", Email: "foo@foo.foo", When: when, Message: "commit: bar\n"},
+		{RefName: "refs/heads/old", UpdateIndex: 2, Deleted: true},
+	}
+
+	r := writeTable(t, WriterOptions{MinUpdateIndex: 1, MaxUpdateIndex: 2}, refs, logs)
+	assert.Equal(t, uint64(1), r.MinUpdateIndex())
+	assert.Equal(t, uint64(2), r.MaxUpdateIndex())
+	assert.Equal(t, format.SHA1, r.ObjectFormat())
+
+	got, err := r.Refs()
+	require.NoError(t, err)
+	assert.Equal(t, []*Ref{refs[1], refs[2], refs[3], refs[0]}, got)
+
+	ref, err := r.Ref("refs/heads/master")
+	require.NoError(t, err)
+	assert.Equal(t, refs[2], ref)
+
+	_, err = r.Ref("refs/heads/missing")
+	assert.ErrorIs(t, err, plumbing.ErrReferenceNotFound)
+
+	gotLogs, err := r.RefLogs("refs/heads/master")
+	require.NoError(t, err)
+	require.Len(t, gotLogs, 2)
+	assert.Equal(t, uint64(2), gotLogs[0].UpdateIndex)
+	assert.Equal(t, h2, gotLogs[0].Old)
+	assert.Equal(t, h1, gotLogs[0].New)
+	assert.Equal(t, "commit: bar\n", gotLogs[0].Message)
+	assert.True(t, when.Equal(gotLogs[1].When))
+	_, offset := gotLogs[1].When.Zone()
+	assert.Equal(t, -7*60*60, offset)
+
+	gotLogs, err = r.Logs()
+	require.NoError(t, err)
+	require.Len(t, gotLogs, 3)
+	assert.True(t, gotLogs[2].Deleted)
+}
+
+func TestWriteReadBlocks(t *testing.T) {
+	t.Parallel()
+
+	h := plumbing.NewHash("6ecf0ef2c2dffb796033e5a02219af86ec6584e5")
+	var refs []*Ref
+	var logs []*Log
+	for i := range 1000 {
+		name := fmt.Sprintf("refs/heads/branch-%04d", i)
+		refs = append(refs, &Ref{Name: name, UpdateIndex: 1, Hash: h})
+		logs = append(logs, &Log{
+			RefName: name, UpdateIndex: 1, New: h,
+			Name: "foo", Email: "foo@foo.foo", When: time.Unix(1257894000, 0).UTC(),
+			Message: strings.Repeat("m", 100) + "\n",
+		})
+	}
+
+	r := writeTable(t, WriterOptions{BlockSize: 1024, MinUpdateIndex: 1, MaxUpdateIndex: 1}, refs, logs)
+	assert.Greater(t, r.refEnd, 10*r.blockSize)
+
+	got, err := r.Refs()
+	require.NoError(t, err)
+	assert.Equal(t, refs, got)
+
+	ref, err := r.Ref("refs/heads/branch-0742")
+	require.NoError(t, err)
+	assert.Equal(t, refs[742], ref)
+
+	gotLogs, err := r.Logs()
+	require.NoError(t, err)
+	assert.Len(t, gotLogs, 1000)
+
+	gotLogs, err = r.RefLogs("refs/heads/branch-0999")
+	require.NoError(t, err)
+	require.Len(t, gotLogs, 1)
+	assert.Equal(t, logs[999].Message, gotLogs[0].Message)
+}
+
+func TestWriteReadLogsOnly(t *testing.T) {
+	t.Parallel()
+
+	h := plumbing.NewHash("6ecf0ef2c2dffb796033e5a02219af86ec6584e5")
+	logs := []*Log{{RefName: "refs/heads/master", UpdateIndex: 1, New: h, When: time.Unix(0, 0).UTC(), Message: "foo\n"}}
+	r := writeTable(t, WriterOptions{MinUpdateIndex: 1, MaxUpdateIndex: 1}, nil, logs)
+
+	refs, err := r.Refs()
+	require.NoError(t, err)
+	assert.Empty(t, refs)
+
+	got, err := r.Logs()
+	require.NoError(t, err)
+	require.Len(t, got, 1)
+	assert.Equal(t, "foo\n", got[0].Message)
+}
+
+func TestWriteReadEmpty(t *testing.T) {
+	t.Parallel()
+
+	r := writeTable(t, WriterOptions{MinUpdateIndex: 1, MaxUpdateIndex: 1}, nil, nil)
+	refs, err := r.Refs()
+	require.NoError(t, err)
+	assert.Empty(t, refs)
+
+	logs, err := r.Logs()
+	require.NoError(t, err)
+	assert.Empty(t, logs)
+}
+
+func TestWriteReadSHA256(t *testing.T) {
+	t.Parallel()
+
+	h := plumbing.NewHash("9ae171a7d5fbd7e2c5ab95a4b2f1456fee1b333e5bc5bd8cb1a7a1a3f61a7548")
+	refs := []*Ref{{Name: "refs/heads/master", UpdateIndex: 1, Hash: h}}
+	r := writeTable(t, WriterOptions{ObjectFormat: format.SHA256, MinUpdateIndex: 1, MaxUpdateIndex: 1}, refs, nil)
+	assert.Equal(t, format.SHA256, r.ObjectFormat())
+
+	got, err := r.Refs()
+	require.NoError(t, err)
+	assert.Equal(t, refs, got)
+
+	w := NewWriter(&bytes.Buffer{}, WriterOptions{MinUpdateIndex: 1, MaxUpdateIndex: 1})
+	assert.Error(t, w.AddRef(refs[0]))
+}
+
+func TestWriterErrors(t *testing.T) {
+	t.Parallel()
+
+	h := plumbing.NewHash("6ecf0ef2c2dffb796033e5a02219af86ec6584e5")
+	w := NewWriter(&bytes.Buffer{}, WriterOptions{MinUpdateIndex: 2, MaxUpdateIndex: 3})
+	assert.Error(t, w.AddRef(&Ref{Name: "refs/heads/master", UpdateIndex: 1, Hash: h}))
+
+	require.NoError(t, w.AddRef(&Ref{Name: "refs/heads/master", UpdateIndex: 2, Hash: h}))
+	require.NoError(t, w.AddRef(&Ref{Name: "refs/heads/master", UpdateIndex: 3, Hash: h}))
+	assert.Error(t, w.Close())
+}
+
+func TestReaderMalformed(t *testing.T) {
+	t.Parallel()
+
+	var buf bytes.Buffer
+	w := NewWriter(&buf, WriterOptions{MinUpdateIndex: 1, MaxUpdateIndex: 1})
+	require.NoError(t, w.AddRef(&Ref{Name: "HEAD", UpdateIndex: 1, Target: "refs/heads/master"}))
+	require.NoError(t, w.Close())
+
+	data := buf.Bytes()
+	data[len(data)-1] ^= 0xff
+	_, err := NewReader(bytes.NewReader(data), int64(len(data)))
+	assert.ErrorIs(t, err, ErrMalformedTable)
+
+	_, err = NewReader(bytes.NewReader([]byte("REFT")), 4)
+	assert.ErrorIs(t, err, ErrMalformedTable)
+}
@@ -0,0 +1,540 @@
+package reftable
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand/v2"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-git/go-billy/v6"
+
+	"github.com/go-git/go-git/v6/plumbing"
+	format "github.com/go-git/go-git/v6/plumbing/format/config"
+	"github.com/go-git/go-git/v6/utils/ioutil"
+)
+
+const (
+	// TablesListName is the name of the file listing the tables of a stack,
+	// the oldest first.
+	TablesListName = "tables.list"
+
+	tablesListLock = TablesListName + ".lock"
+	// lockTimeout is the time waited for the lock of the stack held by
+	// another writer.
+	lockTimeout = 5 * time.Second
+	// compactionFactor is the factor of the geometric sequence the sizes of
+	// the tables are kept in by the auto compaction, as git does.
+	compactionFactor = 2
+)
+
+// ErrStackLocked is returned when the stack stays locked by another writer.
+var ErrStackLocked = errors.New("reftable stack is locked")
+
+// Stack is a stack of tables, listed by the tables.list file, the records of
+// the most recent table overriding the ones of the older tables.
+type Stack struct {
+	fs     billy.Filesystem
+	format format.ObjectFormat
+
+	m      sync.Mutex
+	list   []byte
+	names  []string
+	tables []*Reader
+	sizes  []int64
+}
+
+// OpenStack returns the stack of the tables of the given directory, such as
+// .git/reftable, whose object ids are of the given object format. The stack
+// is empty if there is no tables.list file yet.
+func OpenStack(fs billy.Filesystem, f format.ObjectFormat) (*Stack, error) {
+	s := &Stack{fs: fs, format: f}
+	if err := s.reload(); err != nil {
+		return nil, err
+	}
+
+	return s, nil
+}
+
+// reload reads the tables.list again, for the tables added or compacted by
+// other writers to be read.
+func (s *Stack) reload() error {
+	list, err := s.readList()
+	if err != nil {
+		return err
+	}
+
+	s.m.Lock()
+	defer s.m.Unlock()
+	if s.tables != nil && bytes.Equal(list, s.list) {
+		return nil
+	}
+
+	tables := make(map[string]*Reader, len(s.names))
+	sizes := make(map[string]int64, len(s.names))
+	for i, name := range s.names {
+		tables[name], sizes[name] = s.tables[i], s.sizes[i]
+	}
+
+	var names []string
+	sc := bufio.NewScanner(bytes.NewReader(list))
+	for sc.Scan() {
+		if name := sc.Text(); name != "" {
+			names = append(names, name)
+		}
+	}
+
+	newTables := make([]*Reader, len(names))
+	newSizes := make([]int64, len(names))
+	for i, name := range names {
+		if t, ok := tables[name]; ok {
+			newTables[i], newSizes[i] = t, sizes[name]
+			continue
+		}
+
+		if newTables[i], newSizes[i], err = s.readTable(name); err != nil {
+			return err
+		}
+	}
+
+	s.list, s.names, s.tables, s.sizes = list, names, newTables, newSizes
+	return nil
+}
+
+func (s *Stack) readList() (_ []byte, err error) {
+	f, err := s.fs.Open(TablesListName)
+	if os.IsNotExist(err) {
+		return []byte{}, nil
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer ioutil.CheckClose(f, &err)
+	return io.ReadAll(f)
+}
+
+// readTable reads the table of the given name, held in memory.
+func (s *Stack) readTable(name string) (_ *Reader, _ int64, err error) {
+	f, err := s.fs.Open(name)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	defer ioutil.CheckClose(f, &err)
+	data, err := io.ReadAll(f)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	t, err := NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return nil, 0, fmt.Errorf("%s: %w", name, err)
+	}
+
+	if t.ObjectFormat() != s.format {
+		return nil, 0, fmt.Errorf("%s: %w: table of object format %s", name, ErrMalformedTable, t.ObjectFormat())
+	}
+
+	return t, int64(len(data)), nil
+}
+
+// snapshot returns the tables of the stack, the tables.list being read again.
+func (s *Stack) snapshot() ([]*Reader, error) {
+	if err := s.reload(); err != nil {
+		return nil, err
+	}
+
+	s.m.Lock()
+	defer s.m.Unlock()
+	return s.tables, nil
+}
+
+// Tables returns the number of tables of the stack.
+func (s *Stack) Tables() (int, error) {
+	tables, err := s.snapshot()
+	return len(tables), err
+}
+
+// Ref returns the current ref record of the reference of the given name, the
+// one of the most recent table holding one, or plumbing.ErrReferenceNotFound
+// if there is none or if it records the deletion of the reference.
+func (s *Stack) Ref(name string) (*Ref, error) {
+	tables, err := s.snapshot()
+	if err != nil {
+		return nil, err
+	}
+
+	for i := len(tables) - 1; i >= 0; i-- {
+		r, err := tables[i].Ref(name)
+		if errors.Is(err, plumbing.ErrReferenceNotFound) {
+			continue
+		}
+
+		if err != nil {
+			return nil, err
+		}
+
+		if r.Deleted {
+			break
+		}
+
+		return r, nil
+	}
+
+	return nil, plumbing.ErrReferenceNotFound
+}
+
+// Refs returns the current ref records of the references, sorted by name,
+// the deleted references being left out.
+func (s *Stack) Refs() ([]*Ref, error) {
+	tables, err := s.snapshot()
+	if err != nil {
+		return nil, err
+	}
+
+	refs, err := mergeRefs(tables, true)
+	if err != nil {
+		return nil, err
+	}
+
+	return refs, nil
+}
+
+// mergeRefs returns the current ref records of the tables, sorted by name, the
+// deletions being dropped if drop.
+func mergeRefs(tables []*Reader, drop bool) ([]*Ref, error) {
+	seen := make(map[string]bool)
+	var refs []*Ref
+	for i := len(tables) - 1; i >= 0; i-- {
+		trefs, err := tables[i].Refs()
+		if err != nil {
+			return nil, err
+		}
+
+		for _, r := range trefs {
+			if seen[r.Name] {
+				continue
+			}
+
+			seen[r.Name] = true
+			if !r.Deleted || !drop {
+				refs = append(refs, r)
+			}
+		}
+	}
+
+	sort.Slice(refs, func(i, j int) bool { return refs[i].Name < refs[j].Name })
+	return refs, nil
+}
+
+// Logs returns the current log records of the reference of the given name,
+// the most recent first, the deleted ones being left out.
+func (s *Stack) Logs(name string) ([]*Log, error) {
+	tables, err := s.snapshot()
+	if err != nil {
+		return nil, err
+	}
+
+	return mergeLogs(tables, name, true)
+}
+
+// mergeLogs returns the current log records of the tables, of the reference
+// of the given name or of all of them if empty, sorted by reference name,
+// the most recent first, the deletions being dropped if drop.
+func mergeLogs(tables []*Reader, name string, drop bool) ([]*Log, error) {
+	type key struct {
+		name  string
+		index uint64
+	}
+
+	seen := make(map[key]bool)
+	var logs []*Log
+	for i := len(tables) - 1; i >= 0; i-- {
+		tlogs, err := tables[i].logs(name)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, l := range tlogs {
+			k := key{l.RefName, l.UpdateIndex}
+			if seen[k] {
+				continue
+			}
+
+			seen[k] = true
+			if !l.Deleted || !drop {
+				logs = append(logs, l)
+			}
+		}
+	}
+
+	sort.Slice(logs, func(i, j int) bool {
+		if logs[i].RefName != logs[j].RefName {
+			return logs[i].RefName < logs[j].RefName
+		}
+
+		return logs[i].UpdateIndex > logs[j].UpdateIndex
+	})
+
+	return logs, nil
+}
+
+// Add adds a table on top of the stack, holding the records added by fn to
+// the given writer, whose update indexes are the next update index of the
+// stack, unless fn raises the maximum update index of the table. The stack
+// is locked while fn is called, and read again before, for fn to check the
+// current records against the expected ones, failing the update with an
+// error. The stack is compacted afterwards, as git does, for the sizes of
+// its tables to form a geometric sequence.
+func (s *Stack) Add(fn func(w *Writer) error) error {
+	unlock, err := s.lock()
+	if err != nil {
+		return err
+	}
+
+	defer unlock()
+	if err := s.reload(); err != nil {
+		return err
+	}
+
+	next := s.nextUpdateIndex()
+	var buf bytes.Buffer
+	w := NewWriter(&buf, WriterOptions{ObjectFormat: s.format, MinUpdateIndex: next, MaxUpdateIndex: next})
+	if err := fn(w); err != nil {
+		return err
+	}
+
+	if len(w.refs) == 0 && len(w.logs) == 0 {
+		return nil
+	}
+
+	if err := w.Close(); err != nil {
+		return err
+	}
+
+	name, err := s.writeTable(buf.Bytes(), next, w.MaxUpdateIndex())
+	if err != nil {
+		return err
+	}
+
+	if err := s.writeList(append(append([]string{}, s.names...), name)); err != nil {
+		_ = s.fs.Remove(name)
+		return err
+	}
+
+	// The compaction is only an optimization: the table is added anyway.
+	_ = s.autoCompact()
+	return nil
+}
+
+// nextUpdateIndex returns the update index of the next table.
+func (s *Stack) nextUpdateIndex() uint64 {
+	s.m.Lock()
+	defer s.m.Unlock()
+	if len(s.tables) == 0 {
+		return 1
+	}
+
+	return s.tables[len(s.tables)-1].MaxUpdateIndex() + 1
+}
+
+// Compact compacts all the tables of the stack into a single one, without
+// the deletions, as git pack-refs does.
+func (s *Stack) Compact() error {
+	unlock, err := s.lock()
+	if err != nil {
+		return err
+	}
+
+	defer unlock()
+	if err := s.reload(); err != nil {
+		return err
+	}
+
+	if len(s.names) <= 1 {
+		return nil
+	}
+
+	return s.compact(0, len(s.names))
+}
+
+// autoCompact compacts the most recent tables of the stack, the stack being
+// locked, whose sizes don't form a geometric sequence of factor
+// compactionFactor, as git does.
+func (s *Stack) autoCompact() error {
+	if err := s.reload(); err != nil {
+		return err
+	}
+
+	start, end := compactionSegment(s.sizes)
+	if end-start < 2 {
+		return nil
+	}
+
+	return s.compact(start, end)
+}
+
+// compactionSegment returns the segment of the tables of the given sizes,
+// the oldest first, to compact for their sizes to form a geometric sequence,
+// as git does.
+func compactionSegment(sizes []int64) (start, end int) {
+	if len(sizes) <= 1 {
+		return 0, 0
+	}
+
+	var bytes int64
+	i := len(sizes) - 1
+	for ; i > 0; i-- {
+		if sizes[i-1] < sizes[i]*compactionFactor {
+			end = i + 1
+			bytes = sizes[i]
+			break
+		}
+	}
+
+	start = end
+	for ; i > 0; i-- {
+		curr := bytes
+		bytes += sizes[i-1]
+		if sizes[i-1] < curr*compactionFactor {
+			start = i - 1
+		}
+	}
+
+	return start, end
+}
+
+// compact compacts the tables from start to end, the stack being locked. The
+// deletions are dropped when compacting the oldest table.
+func (s *Stack) compact(start, end int) error {
+	tables := s.tables[start:end]
+	drop := start == 0
+	refs, err := mergeRefs(tables, drop)
+	if err != nil {
+		return err
+	}
+
+	logs, err := mergeLogs(tables, "", drop)
+	if err != nil {
+		return err
+	}
+
+	minIndex, maxIndex := tables[0].MinUpdateIndex(), tables[len(tables)-1].MaxUpdateIndex()
+	var buf bytes.Buffer
+	w := NewWriter(&buf, WriterOptions{ObjectFormat: s.format, MinUpdateIndex: minIndex, MaxUpdateIndex: maxIndex})
+	w.refs, w.logs = refs, logs
+	if err := w.Close(); err != nil {
+		return err
+	}
+
+	name, err := s.writeTable(buf.Bytes(), minIndex, maxIndex)
+	if err != nil {
+		return err
+	}
+
+	old := s.names[start:end]
+	names := append(append(append([]string{}, s.names[:start]...), name), s.names[end:]...)
+	if err := s.writeList(names); err != nil {
+		_ = s.fs.Remove(name)
+		return err
+	}
+
+	for _, name := range old {
+		_ = s.fs.Remove(name)
+	}
+
+	return nil
+}
+
+// lock locks the stack, creating the tables.list.lock file, waiting for the
+// lock held by another writer up to lockTimeout. It returns the function
+// unlocking it.
+func (s *Stack) lock() (func(), error) {
+	deadline := time.Now().Add(lockTimeout)
+	for {
+		f, err := s.fs.OpenFile(tablesListLock, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o666)
+		if err == nil {
+			_ = f.Close()
+			return func() { _ = s.fs.Remove(tablesListLock) }, nil
+		}
+
+		if !os.IsExist(err) {
+			return nil, err
+		}
+
+		if time.Now().After(deadline) {
+			return nil, ErrStackLocked
+		}
+
+		time.Sleep(time.Duration(1+rand.IntN(10)) * time.Millisecond)
+	}
+}
+
+// writeTable writes the table, returning its name, given by its update
+// indexes, as git does.
+func (s *Stack) writeTable(data []byte, minIndex, maxIndex uint64) (_ string, err error) {
+	name := fmt.Sprintf("0x%012x-0x%012x-%08x.ref", minIndex, maxIndex, rand.Uint32())
+	f, err := s.fs.TempFile(".", name+".temp")
+	if err != nil {
+		return "", err
+	}
+
+	if _, err := f.Write(data); err != nil {
+		_ = f.Close()
+		_ = s.fs.Remove(f.Name())
+		return "", err
+	}
+
+	if err := f.Close(); err != nil {
+		_ = s.fs.Remove(f.Name())
+		return "", err
+	}
+
+	if err := s.fs.Rename(f.Name(), name); err != nil {
+		_ = s.fs.Remove(f.Name())
+		return "", err
+	}
+
+	return name, nil
+}
+
+// writeList replaces the tables.list with the given names, the stack being
+// locked, and reads the stack again.
+func (s *Stack) writeList(names []string) error {
+	var b strings.Builder
+	for _, name := range names {
+		b.WriteString(name)
+		b.WriteByte('\n')
+	}
+
+	f, err := s.fs.TempFile(".", TablesListName+".temp")
+	if err != nil {
+		return err
+	}
+
+	if _, err := io.WriteString(f, b.String()); err != nil {
+		_ = f.Close()
+		_ = s.fs.Remove(f.Name())
+		return err
+	}
+
+	if err := f.Close(); err != nil {
+		_ = s.fs.Remove(f.Name())
+		return err
+	}
+
+	if err := s.fs.Rename(f.Name(), TablesListName); err != nil {
+		_ = s.fs.Remove(f.Name())
+		return err
+	}
+
+	return s.reload()
+}
@@ -0,0 +1,199 @@
+package reftable
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/go-git/go-billy/v6/memfs"
+	"github.com/go-git/go-billy/v6/osfs"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/go-git/go-git/v6/plumbing"
+	format "github.com/go-git/go-git/v6/plumbing/format/config"
+)
+
+func TestStack(t *testing.T) {
+	t.Parallel()
+
+	fs := memfs.New()
+	s, err := OpenStack(fs, format.SHA1)
+	require.NoError(t, err)
+
+	_, err = s.Ref("HEAD")
+	assert.ErrorIs(t, err, plumbing.ErrReferenceNotFound)
+
+	h1 := plumbing.NewHash("6ecf0ef2c2dffb796033e5a02219af86ec6584e5")
+	h2 := plumbing.NewHash("918c48b83bd081e863dbe1b80f8998f058cd8294")
+	require.NoError(t, s.Add(func(w *Writer) error {
+		idx := w.MinUpdateIndex()
+		assert.Equal(t, uint64(1), idx)
+		if err := w.AddRef(&Ref{Name: "HEAD", UpdateIndex: idx, Target: "refs/heads/master"}); err != nil {
+			return err
+		}
+
+		if err := w.AddRef(&Ref{Name: "refs/heads/master", UpdateIndex: idx, Hash: h1}); err != nil {
+			return err
+		}
+
+		return w.AddLog(&Log{RefName: "refs/heads/master", UpdateIndex: idx, New: h1, When: time.Unix(0, 0).UTC(), Message: "foo\n"})
+	}))
+
+	require.NoError(t, s.Add(func(w *Writer) error {
+		idx := w.MinUpdateIndex()
+		assert.Equal(t, uint64(2), idx)
+		if err := w.AddRef(&Ref{Name: "refs/heads/master", UpdateIndex: idx, Hash: h2}); err != nil {
+			return err
+		}
+
+		return w.AddLog(&Log{RefName: "refs/heads/master", UpdateIndex: idx, Old: h1, New: h2, When: time.Unix(0, 0).UTC(), Message: "bar\n"})
+	}))
+
+	ref, err := s.Ref("refs/heads/master")
+	require.NoError(t, err)
+	assert.Equal(t, h2, ref.Hash)
+
+	logs, err := s.Logs("refs/heads/master")
+	require.NoError(t, err)
+	require.Len(t, logs, 2)
+	assert.Equal(t, "bar\n", logs[0].Message)
+	assert.Equal(t, "foo\n", logs[1].Message)
+
+	// Another stack of the same directory reads the tables added.
+	other, err := OpenStack(fs, format.SHA1)
+	require.NoError(t, err)
+	require.NoError(t, other.Add(func(w *Writer) error {
+		idx := w.MinUpdateIndex()
+		if err := w.AddRef(&Ref{Name: "refs/heads/master", UpdateIndex: idx, Deleted: true}); err != nil {
+			return err
+		}
+
+		for _, l := range logs {
+			if err := w.AddLog(&Log{RefName: l.RefName, UpdateIndex: l.UpdateIndex, Deleted: true}); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	}))
+
+	_, err = s.Ref("refs/heads/master")
+	assert.ErrorIs(t, err, plumbing.ErrReferenceNotFound)
+
+	logs, err = s.Logs("refs/heads/master")
+	require.NoError(t, err)
+	assert.Empty(t, logs)
+
+	refs, err := s.Refs()
+	require.NoError(t, err)
+	require.Len(t, refs, 1)
+	assert.Equal(t, "HEAD", refs[0].Name)
+
+	require.NoError(t, s.Compact())
+	n, err := s.Tables()
+	require.NoError(t, err)
+	assert.Equal(t, 1, n)
+
+	refs, err = s.Refs()
+	require.NoError(t, err)
+	require.Len(t, refs, 1)
+	assert.Equal(t, "refs/heads/master", refs[0].Target)
+
+	files, err := fs.ReadDir("")
+	require.NoError(t, err)
+	assert.Len(t, files, 2)
+}
+
+func TestStackBoundOS(t *testing.T) {
+	t.Parallel()
+
+	// The tables are written in the directory of the stack, which bounds the
+	// files the filesystem can reach.
+	dir := t.TempDir()
+	fs := osfs.New(dir, osfs.WithBoundOS())
+	s, err := OpenStack(fs, format.SHA1)
+	require.NoError(t, err)
+
+	h := plumbing.NewHash("6ecf0ef2c2dffb796033e5a02219af86ec6584e5")
+	require.NoError(t, s.Add(func(w *Writer) error {
+		return w.AddRef(&Ref{Name: "refs/heads/master", UpdateIndex: w.MinUpdateIndex(), Hash: h})
+	}))
+
+	other, err := OpenStack(osfs.New(dir, osfs.WithBoundOS()), format.SHA1)
+	require.NoError(t, err)
+	ref, err := other.Ref("refs/heads/master")
+	require.NoError(t, err)
+	assert.Equal(t, h, ref.Hash)
+
+	files, err := fs.ReadDir("")
+	require.NoError(t, err)
+	assert.Len(t, files, 2)
+}
+
+func TestStackAutoCompact(t *testing.T) {
+	t.Parallel()
+
+	s, err := OpenStack(memfs.New(), format.SHA1)
+	require.NoError(t, err)
+
+	h := plumbing.NewHash("6ecf0ef2c2dffb796033e5a02219af86ec6584e5")
+	for i := range 50 {
+		require.NoError(t, s.Add(func(w *Writer) error {
+			return w.AddRef(&Ref{Name: fmt.Sprintf("refs/heads/branch-%02d", i), UpdateIndex: w.MinUpdateIndex(), Hash: h})
+		}))
+	}
+
+	n, err := s.Tables()
+	require.NoError(t, err)
+	assert.Less(t, n, 10)
+
+	refs, err := s.Refs()
+	require.NoError(t, err)
+	assert.Len(t, refs, 50)
+	assert.Equal(t, uint64(51), s.nextUpdateIndex())
+}
+
+func TestStackAddError(t *testing.T) {
+	t.Parallel()
+
+	fs := memfs.New()
+	s, err := OpenStack(fs, format.SHA1)
+	require.NoError(t, err)
+
+	assert.ErrorIs(t, s.Add(func(*Writer) error { return plumbing.ErrReferenceNotFound }), plumbing.ErrReferenceNotFound)
+	n, err := s.Tables()
+	require.NoError(t, err)
+	assert.Equal(t, 0, n)
+
+	_, err = fs.Stat(tablesListLock)
+	assert.Error(t, err)
+}
+
+func TestCompactionSegment(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		sizes      []int64
+		start, end int
+	}{
+		{nil, 0, 0},
+		{[]int64{100}, 0, 0},
+		{[]int64{64, 32, 16, 8, 4, 2}, 0, 0},
+		{[]int64{64, 32, 16, 8, 4, 4}, 0, 6},
+		{[]int64{100, 10, 5, 5}, 1, 4},
+		{[]int64{200, 50, 10, 6}, 2, 4},
+		{[]int64{128, 10, 10, 10}, 1, 4},
+	}
+
+	for _, tc := range tests {
+		start, end := compactionSegment(tc.sizes)
+		if tc.end-tc.start < 2 {
+			assert.Less(t, end-start, 2, "%v", tc.sizes)
+			continue
+		}
+
+		assert.Equal(t, tc.start, start, "%v", tc.sizes)
+		assert.Equal(t, tc.end, end, "%v", tc.sizes)
+	}
+}
@@ -0,0 +1,255 @@
+package reftable
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"sort"
+
+	"github.com/go-git/go-git/v6/plumbing"
+	format "github.com/go-git/go-git/v6/plumbing/format/config"
+)
+
+// DefaultBlockSize is the block size of the tables written, as git does.
+const DefaultBlockSize = 4096
+
+// WriterOptions describes the table written by a Writer.
+type WriterOptions struct {
+	// BlockSize is the size of the blocks of the table, DefaultBlockSize if
+	// zero.
+	BlockSize int
+	// ObjectFormat is the object format of the object ids of the table. The
+	// tables of SHA256 object ids are written in version 2 of the format,
+	// the other ones in version 1.
+	ObjectFormat format.ObjectFormat
+	// MinUpdateIndex and MaxUpdateIndex are the bounds of the update indexes
+	// of the ref records of the table.
+	MinUpdateIndex uint64
+	MaxUpdateIndex uint64
+}
+
+// Writer writes a table, holding the records added, once closed.
+type Writer struct {
+	w    io.Writer
+	o    WriterOptions
+	refs []*Ref
+	logs []*Log
+}
+
+// NewWriter returns a writer of a table to w.
+func NewWriter(w io.Writer, o WriterOptions) *Writer {
+	if o.BlockSize == 0 {
+		o.BlockSize = DefaultBlockSize
+	}
+
+	return &Writer{w: w, o: o}
+}
+
+// MinUpdateIndex returns the minimum update index of the records of the
+// table.
+func (w *Writer) MinUpdateIndex() uint64 { return w.o.MinUpdateIndex }
+
+// MaxUpdateIndex returns the maximum update index of the records of the
+// table.
+func (w *Writer) MaxUpdateIndex() uint64 { return w.o.MaxUpdateIndex }
+
+// SetMaxUpdateIndex raises the maximum update index of the table to i, for
+// the records of several updates to be written to it.
+func (w *Writer) SetMaxUpdateIndex(i uint64) {
+	w.o.MaxUpdateIndex = max(w.o.MaxUpdateIndex, i)
+}
+
+// AddRef adds the ref record to the table. Its update index must be within
+// the bounds of the table.
+func (w *Writer) AddRef(r *Ref) error {
+	if r.UpdateIndex < w.o.MinUpdateIndex || r.UpdateIndex > w.o.MaxUpdateIndex {
+		return fmt.Errorf("update index %d of %s out of the bounds of the table", r.UpdateIndex, r.Name)
+	}
+
+	if err := w.checkHashes(r.Name, r.Hash, r.Peeled); err != nil {
+		return err
+	}
+
+	w.refs = append(w.refs, r)
+	return nil
+}
+
+// AddLog adds the log record to the table.
+func (w *Writer) AddLog(l *Log) error {
+	if err := w.checkHashes(l.RefName, l.Old, l.New); err != nil {
+		return err
+	}
+
+	w.logs = append(w.logs, l)
+	return nil
+}
+
+// checkHashes checks that the object ids of the record of the given
+// reference are of the object format of the table.
+func (w *Writer) checkHashes(name string, hashes ...plumbing.Hash) error {
+	for _, h := range hashes {
+		if !h.IsZero() && h.Size() != w.o.ObjectFormat.Size() {
+			return fmt.Errorf("object id of %s not of the object format of the table", name)
+		}
+	}
+
+	return nil
+}
+
+// Close writes the table, its records being sorted. A reference can only
+// have one ref record, and one log record by update index.
+func (w *Writer) Close() error {
+	sort.Slice(w.refs, func(i, j int) bool { return w.refs[i].Name < w.refs[j].Name })
+	for i := 1; i < len(w.refs); i++ {
+		if w.refs[i].Name == w.refs[i-1].Name {
+			return fmt.Errorf("several ref records of %s", w.refs[i].Name)
+		}
+	}
+
+	logs := make([]record, len(w.logs))
+	for i, l := range w.logs {
+		logs[i] = logRecord{l}
+	}
+
+	sort.Slice(logs, func(i, j int) bool { return bytes.Compare(logs[i].key(), logs[j].key()) < 0 })
+	for i := 1; i < len(logs); i++ {
+		if bytes.Equal(logs[i].key(), logs[i-1].key()) {
+			l := logs[i].(logRecord)
+			return fmt.Errorf("several log records of %s at update index %d", l.RefName, l.UpdateIndex)
+		}
+	}
+
+	refs := make([]record, len(w.refs))
+	for i, r := range w.refs {
+		refs[i] = refRecord{r}
+	}
+
+	header := w.header()
+	tw := &tableWriter{w: w, header: header}
+	if err := tw.writeSection(blockTypeRef, refs); err != nil {
+		return err
+	}
+
+	// The last ref block is not padded.
+	tw.padding = 0
+	logPos := tw.off
+	if len(logs) == 0 {
+		logPos = 0
+	}
+
+	if err := tw.writeSection(blockTypeLog, logs); err != nil {
+		return err
+	}
+
+	if tw.off == 0 {
+		if err := tw.write(header); err != nil {
+			return err
+		}
+	}
+
+	footer := append([]byte{}, header...)
+	footer = binary.BigEndian.AppendUint64(footer, 0) // ref index
+	footer = binary.BigEndian.AppendUint64(footer, 0) // obj blocks
+	footer = binary.BigEndian.AppendUint64(footer, 0) // obj index
+	footer = binary.BigEndian.AppendUint64(footer, uint64(logPos))
+	footer = binary.BigEndian.AppendUint64(footer, 0) // log index
+	footer = binary.BigEndian.AppendUint32(footer, crc32.ChecksumIEEE(footer))
+	return tw.write(footer)
+}
+
+func (w *Writer) header() []byte {
+	header := append([]byte{}, magic...)
+	version, hashID := byte(version1), uint32(0)
+	if w.o.ObjectFormat == format.SHA256 {
+		version, hashID = version2, hashIDSHA256
+	}
+
+	header = append(header, version)
+	header = appendUint24(header, uint32(w.o.BlockSize))
+	header = binary.BigEndian.AppendUint64(header, w.o.MinUpdateIndex)
+	header = binary.BigEndian.AppendUint64(header, w.o.MaxUpdateIndex)
+	if version == version2 {
+		header = binary.BigEndian.AppendUint32(header, hashID)
+	}
+
+	return header
+}
+
+// tableWriter writes the blocks of a table, the first one starting with the
+// header of the table.
+type tableWriter struct {
+	w      *Writer
+	header []byte
+	off    int64
+	// padding is the padding of the last block written, written before the
+	// next block of its section.
+	padding int
+}
+
+// writeSection writes the records, of the given type, in blocks.
+func (tw *tableWriter) writeSection(typ byte, records []record) error {
+	var bw *blockWriter
+	for _, r := range records {
+		if bw != nil && bw.add(r) {
+			continue
+		}
+
+		if bw != nil {
+			if err := tw.writeBlock(bw); err != nil {
+				return err
+			}
+		}
+
+		bw = tw.newBlock(typ)
+		if !bw.add(r) {
+			return fmt.Errorf("%w: %s", ErrRecordTooLarge, r.key())
+		}
+	}
+
+	if bw == nil {
+		return nil
+	}
+
+	return tw.writeBlock(bw)
+}
+
+func (tw *tableWriter) newBlock(typ byte) *blockWriter {
+	headerSize := 0
+	if tw.off == 0 {
+		headerSize = len(tw.header)
+	}
+
+	return newBlockWriter(typ, headerSize, tw.w.o.BlockSize, tw.w.o.ObjectFormat.Size(), tw.w.o.MinUpdateIndex)
+}
+
+func (tw *tableWriter) writeBlock(bw *blockWriter) error {
+	if tw.padding > 0 {
+		if err := tw.write(make([]byte, tw.padding)); err != nil {
+			return err
+		}
+	}
+
+	b, err := bw.finish()
+	if err != nil {
+		return err
+	}
+
+	if tw.off == 0 {
+		copy(b, tw.header)
+	}
+
+	tw.padding = 0
+	if bw.typ != blockTypeLog {
+		tw.padding = max(0, bw.blockSize-len(b))
+	}
+
+	return tw.write(b)
+}
+
+func (tw *tableWriter) write(b []byte) error {
+	n, err := tw.w.w.Write(b)
+	tw.off += int64(n)
+	return err
+}
@@ -0,0 +1,268 @@
+package sshsig
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"slices"
+	"strings"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// ErrInvalidAllowedSigners is returned when an allowed signers file is
+// malformed.
+var ErrInvalidAllowedSigners = errors.New("invalid allowed signers")
+
+// AllowedSigner is a line of an allowed signers file, trusting a key to
+// sign as the given principals.
+type AllowedSigner struct {
+	// Principals are the patterns of the principals the key signs as,
+	// usually email addresses.
+	Principals []string
+	// CertAuthority makes Key trust the certificates it signs, for their
+	// principals matching Principals.
+	CertAuthority bool
+	// Namespaces, if not empty, are the patterns of the namespaces the key
+	// signs in.
+	Namespaces []string
+	// ValidAfter and ValidBefore, if not zero, limit the time the key is
+	// trusted.
+	ValidAfter, ValidBefore time.Time
+	// Key is the public key of the signer.
+	Key ssh.PublicKey
+}
+
+// AllowedSigners is a list of the keys trusted to sign, as read from the
+// file of the gpg.ssh.allowedSignersFile config option.
+type AllowedSigners []*AllowedSigner
+
+// Verification is the result of the verification of a signature, by the
+// allowed signers.
+type Verification struct {
+	// Key is the public key the message is signed with.
+	Key ssh.PublicKey
+	// Signer is the allowed signer of the key, nil if the signature is
+	// valid but its key not trusted.
+	Signer *AllowedSigner
+	// Principal is the identity of the signer: the principal of the
+	// certificate for the certificate authorities, the principals of the
+	// allowed signer otherwise.
+	Principal string
+}
+
+// Trusted returns whether the message is signed by an allowed signer.
+func (v *Verification) Trusted() bool {
+	return v.Signer != nil
+}
+
+// ParseAllowedSigners parses an allowed signers file, with a line per
+// signer, formatted as:
+//
+//	principals [options] keytype base64-key [comment]
+//
+// The supported options are cert-authority, namespaces, valid-after and
+// valid-before. Empty lines and lines starting with # are ignored.
+func ParseAllowedSigners(r io.Reader) (AllowedSigners, error) {
+	var signers AllowedSigners
+	s := bufio.NewScanner(r)
+	for n := 1; s.Scan(); n++ {
+		line := bytes.TrimSpace(s.Bytes())
+		if len(line) == 0 || line[0] == '#' {
+			continue
+		}
+
+		signer, err := parseAllowedSigner(line)
+		if err != nil {
+			return nil, fmt.Errorf("%w: line %d: %w", ErrInvalidAllowedSigners, n, err)
+		}
+
+		signers = append(signers, signer)
+	}
+
+	if err := s.Err(); err != nil {
+		return nil, err
+	}
+
+	return signers, nil
+}
+
+func parseAllowedSigner(line []byte) (*AllowedSigner, error) {
+	var principals string
+	if line[0] == '"' {
+		end := bytes.IndexByte(line[1:], '"')
+		if end < 0 {
+			return nil, errors.New("unterminated principals")
+		}
+
+		principals, line = string(line[1:end+1]), line[end+2:]
+	} else {
+		i := bytes.IndexAny(line, " \t")
+		if i < 0 {
+			return nil, errors.New("missing key")
+		}
+
+		principals, line = string(line[:i]), line[i:]
+	}
+
+	// The options and the key are formatted as in the authorized keys
+	// files.
+	key, _, options, _, err := ssh.ParseAuthorizedKey(bytes.TrimSpace(line))
+	if err != nil {
+		return nil, err
+	}
+
+	signer := &AllowedSigner{Principals: strings.Split(principals, ","), Key: key}
+	for _, o := range options {
+		name, value, _ := strings.Cut(o, "=")
+		value = strings.Trim(value, `"`)
+		switch strings.ToLower(name) {
+		case "cert-authority":
+			signer.CertAuthority = true
+		case "namespaces":
+			signer.Namespaces = strings.Split(value, ",")
+		case "valid-after":
+			signer.ValidAfter, err = parseTime(value)
+		case "valid-before":
+			signer.ValidBefore, err = parseTime(value)
+		default:
+			err = fmt.Errorf("unsupported option %q", name)
+		}
+
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return signer, nil
+}
+
+// parseTime parses the times of the valid-after and valid-before options,
+// as YYYYMMDD[HHMM[SS]], in the local time zone unless suffixed with Z.
+func parseTime(value string) (time.Time, error) {
+	loc := time.Local
+	if v, ok := strings.CutSuffix(value, "Z"); ok {
+		value, loc = v, time.UTC
+	}
+
+	for _, layout := range []string{"20060102", "200601021504", "20060102150405"} {
+		if len(value) == len(layout) {
+			return time.ParseInLocation(layout, value, loc)
+		}
+	}
+
+	return time.Time{}, fmt.Errorf("invalid time %q", value)
+}
+
+// Verify verifies the armored signature of the message read from r, made
+// in the given namespace at the given time, and returns its signer. The
+// signature is trusted if its key is an allowed signer in the namespace, at
+// that time. An error is only returned if the signature is invalid.
+func (s AllowedSigners) Verify(r io.Reader, signature []byte, namespace string, when time.Time) (*Verification, error) {
+	key, err := Verify(r, signature, namespace)
+	if err != nil {
+		return nil, err
+	}
+
+	v := &Verification{Key: key}
+	for _, signer := range s {
+		if principal, ok := signer.trusts(key, namespace, when); ok {
+			v.Signer, v.Principal = signer, principal
+			break
+		}
+	}
+
+	return v, nil
+}
+
+// trusts returns whether the signer trusts the given key in the given
+// namespace and at the given time, and the principal of the key.
+func (s *AllowedSigner) trusts(key ssh.PublicKey, namespace string, when time.Time) (string, bool) {
+	if len(s.Namespaces) > 0 && !matchList(s.Namespaces, namespace) {
+		return "", false
+	}
+
+	if (!s.ValidAfter.IsZero() && when.Before(s.ValidAfter)) ||
+		(!s.ValidBefore.IsZero() && !when.Before(s.ValidBefore)) {
+		return "", false
+	}
+
+	cert, isCert := key.(*ssh.Certificate)
+	if !s.CertAuthority {
+		return strings.Join(s.Principals, ","), !isCert && bytes.Equal(key.Marshal(), s.Key.Marshal())
+	}
+
+	if !isCert || cert.CertType != ssh.UserCert || !bytes.Equal(cert.SignatureKey.Marshal(), s.Key.Marshal()) {
+		return "", false
+	}
+
+	checker := &ssh.CertChecker{Clock: func() time.Time { return when }}
+	for _, principal := range cert.ValidPrincipals {
+		if matchList(s.Principals, principal) && checker.CheckCert(principal, cert) == nil {
+			return principal, true
+		}
+	}
+
+	return "", false
+}
+
+// matchList returns whether s matches the given list of patterns, with
+// their negations prefixed by !, as match_pattern_list in OpenSSH.
+func matchList(patterns []string, s string) bool {
+	var matched bool
+	for _, p := range patterns {
+		if negated, ok := strings.CutPrefix(p, "!"); ok {
+			if matchPattern(negated, s) {
+				return false
+			}
+
+			continue
+		}
+
+		matched = matched || matchPattern(p, s)
+	}
+
+	return matched
+}
+
+// matchPattern returns whether s matches the pattern, where * matches any
+// sequence of characters and ? any character.
+func matchPattern(pattern, s string) bool {
+	for len(pattern) > 0 {
+		switch pattern[0] {
+		case '*':
+			pattern = strings.TrimLeft(pattern, "*")
+			if pattern == "" {
+				return true
+			}
+
+			return slices.ContainsFunc(suffixes(s), func(suffix string) bool {
+				return matchPattern(pattern, suffix)
+			})
+		case '?':
+			if s == "" {
+				return false
+			}
+		default:
+			if s == "" || s[0] != pattern[0] {
+				return false
+			}
+		}
+
+		pattern, s = pattern[1:], s[1:]
+	}
+
+	return s == ""
+}
+
+func suffixes(s string) []string {
+	result := make([]string, len(s)+1)
+	for i := range result {
+		result[i] = s[i:]
+	}
+
+	return result
+}
@@ -0,0 +1,125 @@
+package sshsig
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/ssh"
+)
+
+func TestParseAllowedSigners(t *testing.T) {
+	t.Parallel()
+
+	signers, err := ParseAllowedSigners(strings.NewReader(`# comment
+
+foo@example.com,bar@example.com ` + publicKey + ` comment
+"baz@example.com" namespaces="git,file",valid-after="20200101",valid-before="20210102030405Z" ` + publicKey + `
+*@example.com cert-authority ` + publicKey + `
+`))
+	require.NoError(t, err)
+	require.Len(t, signers, 3)
+
+	assert.Equal(t, []string{"foo@example.com", "bar@example.com"}, signers[0].Principals)
+	assert.Equal(t, publicKey, strings.TrimSpace(string(ssh.MarshalAuthorizedKey(signers[0].Key))))
+	assert.False(t, signers[0].CertAuthority)
+
+	assert.Equal(t, []string{"baz@example.com"}, signers[1].Principals)
+	assert.Equal(t, []string{"git", "file"}, signers[1].Namespaces)
+	assert.Equal(t, time.Date(2020, 1, 1, 0, 0, 0, 0, time.Local), signers[1].ValidAfter)
+	assert.Equal(t, time.Date(2021, 1, 2, 3, 4, 5, 0, time.UTC), signers[1].ValidBefore)
+
+	assert.True(t, signers[2].CertAuthority)
+
+	for _, invalid := range []string{
+		"foo@example.com",
+		"foo@example.com ssh-ed25519 foo",
+		"foo@example.com unknown " + publicKey,
+		`foo@example.com valid-after="2020" ` + publicKey,
+		`"foo@example.com ` + publicKey,
+	} {
+		_, err := ParseAllowedSigners(strings.NewReader(invalid))
+		assert.ErrorIs(t, err, ErrInvalidAllowedSigners, invalid)
+	}
+}
+
+func TestAllowedSignersVerify(t *testing.T) {
+	t.Parallel()
+
+	when := time.Date(2020, 6, 1, 0, 0, 0, 0, time.UTC)
+	for _, tc := range []struct {
+		signers   string
+		principal string
+	}{
+		{signers: "foo@example.com " + publicKey, principal: "foo@example.com"},
+		{signers: "foo@example.com,bar@example.com " + publicKey, principal: "foo@example.com,bar@example.com"},
+		{signers: `foo@example.com namespaces="g*" ` + publicKey, principal: "foo@example.com"},
+		{signers: `foo@example.com namespaces="*,!git" ` + publicKey},
+		{signers: `foo@example.com valid-after="20200601" ` + publicKey, principal: "foo@example.com"},
+		{signers: `foo@example.com valid-after="20200602" ` + publicKey},
+		{signers: `foo@example.com valid-before="20200601" ` + publicKey},
+		{signers: "foo@example.com cert-authority " + publicKey},
+		{signers: "foo@example.com ssh-ed25519 AAAAC3NzaC1lZDI1NTE5AAAAIO2sX7nK0ABmCMKCfHqf9pYulUdJXPb7HN2xO6UjJnYR"},
+	} {
+		signers, err := ParseAllowedSigners(strings.NewReader(tc.signers))
+		require.NoError(t, err)
+
+		v, err := signers.Verify(strings.NewReader(message), []byte(signature), GitNamespace, when)
+		require.NoError(t, err, tc.signers)
+		assert.Equal(t, publicKey, strings.TrimSpace(string(ssh.MarshalAuthorizedKey(v.Key))))
+		assert.Equal(t, tc.principal != "", v.Trusted(), tc.signers)
+		assert.Equal(t, tc.principal, v.Principal, tc.signers)
+	}
+
+	_, err := AllowedSigners{}.Verify(strings.NewReader("other\n"), []byte(signature), GitNamespace, when)
+	assert.ErrorIs(t, err, ErrInvalidSignature)
+}
+
+func TestAllowedSignersVerifyCertificate(t *testing.T) {
+	t.Parallel()
+
+	_, key, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	signer, err := ssh.NewSignerFromKey(key)
+	require.NoError(t, err)
+
+	ca := newSigner(t)
+	when := time.Date(2020, 6, 1, 0, 0, 0, 0, time.UTC)
+	cert := &ssh.Certificate{
+		Key:             signer.PublicKey(),
+		CertType:        ssh.UserCert,
+		ValidPrincipals: []string{"foo", "bar@example.com"},
+		ValidAfter:      uint64(when.Add(-time.Hour).Unix()),
+		ValidBefore:     uint64(when.Add(time.Hour).Unix()),
+	}
+	require.NoError(t, cert.SignCert(rand.Reader, ca))
+	certSigner, err := ssh.NewCertSigner(cert, signer)
+	require.NoError(t, err)
+
+	sig, err := Sign(rand.Reader, certSigner, strings.NewReader(message), GitNamespace)
+	require.NoError(t, err)
+
+	signers, err := ParseAllowedSigners(strings.NewReader("*@example.com cert-authority " + publicKey))
+	require.NoError(t, err)
+
+	v, err := signers.Verify(strings.NewReader(message), sig, GitNamespace, when)
+	require.NoError(t, err)
+	assert.True(t, v.Trusted())
+	assert.Equal(t, "bar@example.com", v.Principal)
+
+	// The certificate is not valid at that time.
+	v, err = signers.Verify(strings.NewReader(message), sig, GitNamespace, when.Add(2*time.Hour))
+	require.NoError(t, err)
+	assert.False(t, v.Trusted())
+
+	// The key of the certificate authority does not sign as itself.
+	signers, err = ParseAllowedSigners(strings.NewReader("bar@example.com " + publicKey))
+	require.NoError(t, err)
+	v, err = signers.Verify(strings.NewReader(message), sig, GitNamespace, when)
+	require.NoError(t, err)
+	assert.False(t, v.Trusted())
+}
@@ -0,0 +1,19 @@
+// Package sshsig implements the SSH signatures, as created by
+// `ssh-keygen -Y sign` and used by git to sign the commits and tags when
+// gpg.format is ssh, and the allowed signers files they are verified with.
+//
+//	SSH signature format
+//
+//	signature = "-----BEGIN SSH SIGNATURE-----" LF
+//	            base64(blob) LF
+//	            "-----END SSH SIGNATURE-----" LF
+//	blob = "SSHSIG" uint32(version) string(publickey) string(namespace)
+//	       string(reserved) string(hash_algorithm) string(signature)
+//
+// The signature is made over "SSHSIG" string(namespace) string(reserved)
+// string(hash_algorithm) string(H(message)), the namespace being "git" for
+// git objects.
+//
+// See https://github.com/openssh/openssh-portable/blob/master/PROTOCOL.sshsig
+// and the ALLOWED SIGNERS section of ssh-keygen(1).
+package sshsig
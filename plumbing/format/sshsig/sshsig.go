@@ -0,0 +1,198 @@
+package sshsig
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+
+	"golang.org/x/crypto/ssh"
+)
+
+const (
+	// GitNamespace is the namespace of the signatures of the git objects.
+	GitNamespace = "git"
+
+	magic   = "SSHSIG"
+	version = 1
+
+	hashSHA256 = "sha256"
+	hashSHA512 = "sha512"
+
+	beginSignature = "-----BEGIN SSH SIGNATURE-----"
+	endSignature   = "-----END SSH SIGNATURE-----"
+	lineLength     = 70
+)
+
+var (
+	// ErrInvalidSignature is returned when a signature is malformed, or
+	// does not match the signed message.
+	ErrInvalidSignature = errors.New("invalid ssh signature")
+	// ErrNamespaceMismatch is returned when a signature is not made in the
+	// expected namespace.
+	ErrNamespaceMismatch = errors.New("ssh signature namespace mismatch")
+)
+
+type signedData struct {
+	Magic         [6]byte
+	Namespace     string
+	Reserved      string
+	HashAlgorithm string
+	Hash          string
+}
+
+type signatureBlob struct {
+	Magic         [6]byte
+	Version       uint32
+	PublicKey     string
+	Namespace     string
+	Reserved      string
+	HashAlgorithm string
+	Signature     string
+}
+
+// Sign signs the message read from r with the given signer, in the given
+// namespace, and returns the armored signature. RSA keys sign with
+// SHA-512, as ssh-keygen.
+func Sign(rand io.Reader, signer ssh.Signer, r io.Reader, namespace string) ([]byte, error) {
+	data, err := signedMessage(r, namespace, hashSHA512)
+	if err != nil {
+		return nil, err
+	}
+
+	var sig *ssh.Signature
+	if as, ok := signer.(ssh.AlgorithmSigner); ok && signer.PublicKey().Type() == ssh.KeyAlgoRSA {
+		sig, err = as.SignWithAlgorithm(rand, data, ssh.KeyAlgoRSASHA512)
+	} else {
+		sig, err = signer.Sign(rand, data)
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	blob := signatureBlob{
+		Version:       version,
+		PublicKey:     string(signer.PublicKey().Marshal()),
+		Namespace:     namespace,
+		HashAlgorithm: hashSHA512,
+		Signature:     string(ssh.Marshal(sig)),
+	}
+	copy(blob.Magic[:], magic)
+
+	return armor(ssh.Marshal(&blob)), nil
+}
+
+// Verify verifies the armored signature of the message read from r, made
+// in the given namespace, and returns the public key of the signer. The
+// key is not checked to be trusted, see AllowedSigners.Verify.
+func Verify(r io.Reader, signature []byte, namespace string) (ssh.PublicKey, error) {
+	b, err := unarmor(signature)
+	if err != nil {
+		return nil, err
+	}
+
+	var blob signatureBlob
+	if err := ssh.Unmarshal(b, &blob); err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidSignature, err)
+	}
+
+	if string(blob.Magic[:]) != magic || blob.Version != version {
+		return nil, fmt.Errorf("%w: unsupported format", ErrInvalidSignature)
+	}
+
+	if blob.Namespace != namespace {
+		return nil, fmt.Errorf("%w: %q, expected %q", ErrNamespaceMismatch, blob.Namespace, namespace)
+	}
+
+	key, err := ssh.ParsePublicKey([]byte(blob.PublicKey))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidSignature, err)
+	}
+
+	var sig ssh.Signature
+	if err := ssh.Unmarshal([]byte(blob.Signature), &sig); err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidSignature, err)
+	}
+
+	// As ssh-keygen, RSA signatures must not be made with SHA-1.
+	if sig.Format == ssh.KeyAlgoRSA {
+		return nil, fmt.Errorf("%w: unsupported %s signature", ErrInvalidSignature, sig.Format)
+	}
+
+	data, err := signedMessage(r, namespace, blob.HashAlgorithm)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := key.Verify(data, &sig); err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidSignature, err)
+	}
+
+	return key, nil
+}
+
+// signedMessage returns the data signed for the message read from r.
+func signedMessage(r io.Reader, namespace, hashAlgorithm string) ([]byte, error) {
+	var h hash.Hash
+	switch hashAlgorithm {
+	case hashSHA256:
+		h = sha256.New()
+	case hashSHA512:
+		h = sha512.New()
+	default:
+		return nil, fmt.Errorf("%w: unsupported hash algorithm %q", ErrInvalidSignature, hashAlgorithm)
+	}
+
+	if _, err := io.Copy(h, r); err != nil {
+		return nil, err
+	}
+
+	data := signedData{
+		Namespace:     namespace,
+		HashAlgorithm: hashAlgorithm,
+		Hash:          string(h.Sum(nil)),
+	}
+	copy(data.Magic[:], magic)
+
+	return ssh.Marshal(&data), nil
+}
+
+func armor(blob []byte) []byte {
+	encoded := base64.StdEncoding.EncodeToString(blob)
+
+	var buf bytes.Buffer
+	buf.WriteString(beginSignature + "\n")
+	for len(encoded) > lineLength {
+		buf.WriteString(encoded[:lineLength] + "\n")
+		encoded = encoded[lineLength:]
+	}
+
+	buf.WriteString(encoded + "\n")
+	buf.WriteString(endSignature + "\n")
+	return buf.Bytes()
+}
+
+func unarmor(signature []byte) ([]byte, error) {
+	s := bytes.TrimSpace(signature)
+	s, ok := bytes.CutPrefix(s, []byte(beginSignature))
+	if !ok {
+		return nil, fmt.Errorf("%w: missing %s", ErrInvalidSignature, beginSignature)
+	}
+
+	s, ok = bytes.CutSuffix(s, []byte(endSignature))
+	if !ok {
+		return nil, fmt.Errorf("%w: missing %s", ErrInvalidSignature, endSignature)
+	}
+
+	b, err := base64.StdEncoding.DecodeString(string(bytes.Join(bytes.Fields(s), nil)))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidSignature, err)
+	}
+
+	return b, nil
+}
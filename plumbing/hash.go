@@ -27,11 +27,10 @@ func NewHash(s string) Hash {
 
 type Hasher struct {
 	hash.Hash
-	format format.ObjectFormat
 }
 
 func NewHasher(f format.ObjectFormat, t ObjectType, size int64) Hasher {
-	h := Hasher{format: f}
+	var h Hasher
 	switch f {
 	case format.SHA256:
 		h.Hash = crypto.SHA256.New()
@@ -52,8 +51,10 @@ func (h Hasher) Reset(t ObjectType, size int64) {
 	h.Write([]byte{0})
 }
 
+// Sum returns the hash of the data written, of the object format of the
+// size of the hash function.
 func (h Hasher) Sum() (hash Hash) {
-	hash.format = h.format
+	hash.ResetBySize(h.Size())
 	hash.Write(h.Hash.Sum(nil))
 	return hash
 }
@@ -88,7 +88,10 @@ func (b *Blob) Encode(o plumbing.EncodedObject) (err error) {
 	return err
 }
 
-// Reader returns a reader allow the access to the content of the blob
+// Reader returns a reader allow the access to the content of the blob. The
+// content is streamed if the storer doesn't hold the blob in memory, such as
+// the filesystem storer with a LargeObjectThreshold for the blobs larger than
+// it. Size can be checked before reading the content of a large blob.
 func (b *Blob) Reader() (io.ReadCloser, error) {
 	return b.obj.Reader()
 }
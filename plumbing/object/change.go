@@ -16,6 +16,39 @@ import (
 type Change struct {
 	From ChangeEntry
 	To   ChangeEntry
+	// Kind tells whether the change is a rename or a copy, detected by
+	// DetectRenames.
+	Kind ChangeKind
+	// Similarity is the percentage of the content of From found in To, for
+	// renames and copies.
+	Similarity int
+}
+
+// ChangeKind is the kind of the relation between the From and To entries
+// of a change.
+type ChangeKind int
+
+const (
+	// Changed is the kind of the insertions, deletions and modifications of
+	// a path.
+	Changed ChangeKind = iota
+	// Renamed is the kind of the changes moving a file to another path. The
+	// Action of these changes is a modification.
+	Renamed
+	// Copied is the kind of the changes adding a copy of a file, which is
+	// kept. The Action of these changes is a modification.
+	Copied
+)
+
+func (k ChangeKind) String() string {
+	switch k {
+	case Renamed:
+		return "Rename"
+	case Copied:
+		return "Copy"
+	default:
+		return "Change"
+	}
 }
 
 var empty ChangeEntry
@@ -95,6 +128,14 @@ func (c *Change) PatchContext(ctx context.Context) (*Patch, error) {
 	return getPatchContext(ctx, "", c)
 }
 
+// PatchWithOptions returns a Patch with all the file changes in chunks,
+// the lines being compared as the options say.
+// If context expires, an non-nil error will be returned
+// Provided context must be non-nil
+func (c *Change) PatchWithOptions(ctx context.Context, opts *DiffOptions) (*Patch, error) {
+	return getPatchWithOptions(ctx, "", opts, c)
+}
+
 func (c *Change) name() string {
 	if c.From != empty {
 		return c.From.Name
@@ -157,3 +198,12 @@ func (c Changes) Patch() (*Patch, error) {
 func (c Changes) PatchContext(ctx context.Context) (*Patch, error) {
 	return getPatchContext(ctx, "", c...)
 }
+
+// PatchWithOptions returns a Patch with all the changes in chunks, the lines
+// being compared as the options say. The files only changed in the ways the
+// options ignore are not in the Patch.
+// If context expires, an non-nil error will be returned
+// Provided context must be non-nil
+func (c Changes) PatchWithOptions(ctx context.Context, opts *DiffOptions) (*Patch, error) {
+	return getPatchWithOptions(ctx, "", opts, c...)
+}
@@ -6,11 +6,14 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"slices"
 	"strings"
 
 	"github.com/ProtonMail/go-crypto/openpgp"
+	"golang.org/x/text/encoding/ianaindex"
 
 	"github.com/go-git/go-git/v6/plumbing"
+	"github.com/go-git/go-git/v6/plumbing/format/sshsig"
 	"github.com/go-git/go-git/v6/plumbing/storer"
 	"github.com/go-git/go-git/v6/utils/ioutil"
 	"github.com/go-git/go-git/v6/utils/sync"
@@ -50,9 +53,11 @@ type Commit struct {
 	// Author.
 	Committer Signature
 	// MergeTag is the embedded tag object when a merge commit is created by
-	// merging a signed tag.
+	// merging a signed tag. The tags embedded after the first one, when
+	// several are merged, are mergetag ExtraHeaders.
 	MergeTag string
-	// PGPSignature is the PGP signature of the commit.
+	// PGPSignature is the signature of the commit, an OpenPGP one or an SSH one,
+	// see Verify and VerifySSH.
 	PGPSignature string
 	// Message is the commit message, contains arbitrary text.
 	Message string
@@ -60,14 +65,34 @@ type Commit struct {
 	TreeHash plumbing.Hash
 	// ParentHashes are the hashes of the parent commits of the commit.
 	ParentHashes []plumbing.Hash
-	// Encoding is the encoding of the commit.
+	// Encoding is the encoding of the commit, the one of its message, see
+	// DecodedMessage.
 	Encoding MessageEncoding
 	// List of extra headers of the commit
 	ExtraHeaders []ExtraHeader
 
+	// headerOrder is the order of the headers following the committer of a
+	// decoded commit, if it isn't the one in which they are encoded by
+	// default, for the commit to be encoded as it was.
+	headerOrder []headerKind
+	// noMessageSeparator is whether a decoded commit lacks the blank line
+	// separating its headers from its message, for it to be encoded without
+	// it as long as it has no message.
+	noMessageSeparator bool
+
 	s storer.EncodedObjectStorer
 }
 
+// headerKind is the kind of a header following the committer of a commit.
+type headerKind int
+
+const (
+	encodingHeader headerKind = iota
+	mergeTagHeader
+	extraHeader
+	signatureHeader
+)
+
 // ExtraHeader holds any non-standard header
 type ExtraHeader struct {
 	// Header name
@@ -159,6 +184,26 @@ func (c *Commit) PatchContext(ctx context.Context, to *Commit) (*Patch, error) {
 	return fromTree.PatchContext(ctx, toTree)
 }
 
+// PatchWithOptions returns the Patch between the actual commit and the
+// provided one as PatchContext, the lines being compared as the options say,
+// see Changes.PatchWithOptions.
+func (c *Commit) PatchWithOptions(ctx context.Context, to *Commit, opts *DiffOptions) (*Patch, error) {
+	fromTree, err := c.Tree()
+	if err != nil {
+		return nil, err
+	}
+
+	var toTree *Tree
+	if to != nil {
+		toTree, err = to.Tree()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return fromTree.PatchWithOptions(ctx, toTree, opts)
+}
+
 // Patch returns the Patch between the actual commit and the provided one.
 //
 // NOTE: Since version 5.1.0 the renames are correctly handled, the settings
@@ -168,26 +213,48 @@ func (c *Commit) Patch(to *Commit) (*Patch, error) {
 }
 
 // Parents return a CommitIter to the parent Commits.
+//
+// If the storer of the commit is a storer.GraftStorer, the parents are the
+// ones of its grafts: the shallow commits have no parents, and the parents
+// replaced by refs/replace/* references are the replacing commits.
 func (c *Commit) Parents() CommitIter {
 	return NewCommitIter(c.s,
-		storer.NewEncodedObjectLookupIter(c.s, plumbing.CommitObject, c.ParentHashes),
+		storer.NewEncodedObjectLookupIter(c.s, plumbing.CommitObject, c.parentHashes()),
 	)
 }
 
-// NumParents returns the number of parents in a commit.
+// NumParents returns the number of parents in a commit, once grafted as
+// Parents.
 func (c *Commit) NumParents() int {
-	return len(c.ParentHashes)
+	return len(c.parentHashes())
 }
 
 var ErrParentNotFound = errors.New("commit parent not found")
 
-// Parent returns the ith parent of a commit.
+// Parent returns the ith parent of a commit, once grafted as Parents.
 func (c *Commit) Parent(i int) (*Commit, error) {
-	if len(c.ParentHashes) == 0 || i > len(c.ParentHashes)-1 {
+	parents := c.parentHashes()
+	if len(parents) == 0 || i > len(parents)-1 {
 		return nil, ErrParentNotFound
 	}
 
-	return GetCommit(c.s, c.ParentHashes[i])
+	return GetCommit(c.s, parents[i])
+}
+
+// parentHashes returns the ParentHashes of the commit, grafted by its storer
+// if it is a storer.GraftStorer. The grafts failing to be read are ignored.
+func (c *Commit) parentHashes() []plumbing.Hash {
+	gs, ok := c.s.(storer.GraftStorer)
+	if !ok {
+		return c.ParentHashes
+	}
+
+	g, err := gs.Grafts()
+	if err != nil {
+		return c.ParentHashes
+	}
+
+	return g.ParentHashes(c.Hash, c.ParentHashes)
 }
 
 // File returns the file with the specified "path" in the commit and a
@@ -250,6 +317,7 @@ func (c *Commit) Decode(o plumbing.EncodedObject) (err error) {
 	var pgpsig bool
 	var msgbuf bytes.Buffer
 	var extraheader *ExtraHeader = nil
+	var order []headerKind
 	for {
 		line, err := r.ReadBytes('\n')
 		if err != nil && err != io.EOF {
@@ -258,8 +326,7 @@ func (c *Commit) Decode(o plumbing.EncodedObject) (err error) {
 
 		if mergetag {
 			if len(line) > 0 && line[0] == ' ' {
-				line = bytes.TrimLeft(line, " ")
-				c.MergeTag += string(line)
+				c.MergeTag += string(line[1:])
 				continue
 			} else {
 				mergetag = false
@@ -268,8 +335,7 @@ func (c *Commit) Decode(o plumbing.EncodedObject) (err error) {
 
 		if pgpsig {
 			if len(line) > 0 && line[0] == ' ' {
-				line = bytes.TrimLeft(line, " ")
-				c.PGPSignature += string(line)
+				c.PGPSignature += string(line[1:])
 				continue
 			} else {
 				pgpsig = false
@@ -290,6 +356,10 @@ func (c *Commit) Decode(o plumbing.EncodedObject) (err error) {
 		if !message {
 			original_line := line
 			line = bytes.TrimSpace(line)
+			if len(original_line) == 0 && err == io.EOF {
+				break
+			}
+
 			if len(line) == 0 {
 				message = true
 				continue
@@ -312,14 +382,25 @@ func (c *Commit) Decode(o plumbing.EncodedObject) (err error) {
 			case "committer":
 				c.Committer.Decode(data)
 			case headermergetag:
+				if c.MergeTag != "" {
+					// The next tags embedded are kept as extra headers.
+					order = append(order, extraHeader)
+					extraheader = &ExtraHeader{Key: headermergetag, Value: string(data) + "\n"}
+					break
+				}
+
+				order = append(order, mergeTagHeader)
 				c.MergeTag += string(data) + "\n"
 				mergetag = true
 			case headerencoding:
+				order = append(order, encodingHeader)
 				c.Encoding = MessageEncoding(data)
 			case headerpgp:
+				order = append(order, signatureHeader)
 				c.PGPSignature += string(data) + "\n"
 				pgpsig = true
 			default:
+				order = append(order, extraHeader)
 				h, maybecontinued := parseExtraHeader(original_line)
 				if maybecontinued {
 					extraheader = &h
@@ -336,9 +417,60 @@ func (c *Commit) Decode(o plumbing.EncodedObject) (err error) {
 		}
 	}
 	c.Message = msgbuf.String()
+	c.noMessageSeparator = !message
+
+	c.headerOrder = nil
+	if !slices.Equal(order, c.defaultHeaderOrder()) {
+		c.headerOrder = order
+	}
+
 	return nil
 }
 
+// DecodedMessage returns the message of the commit converted to UTF-8 from
+// its Encoding, as `git log` does, or as is if the encoding is UTF-8 or an
+// unknown one.
+func (c *Commit) DecodedMessage() string {
+	if c.Encoding == "" || strings.EqualFold(string(c.Encoding), string(defaultUtf8CommitMessageEncoding)) {
+		return c.Message
+	}
+
+	enc, err := ianaindex.IANA.Encoding(string(c.Encoding))
+	if err != nil || enc == nil {
+		return c.Message
+	}
+
+	msg, err := enc.NewDecoder().String(c.Message)
+	if err != nil {
+		return c.Message
+	}
+
+	return msg
+}
+
+// defaultHeaderOrder returns the headers following the committer the commit
+// has, in the order in which git writes them.
+func (c *Commit) defaultHeaderOrder() []headerKind {
+	var order []headerKind
+	if c.Encoding != "" && c.Encoding != defaultUtf8CommitMessageEncoding {
+		order = append(order, encodingHeader)
+	}
+
+	if c.MergeTag != "" {
+		order = append(order, mergeTagHeader)
+	}
+
+	for range c.ExtraHeaders {
+		order = append(order, extraHeader)
+	}
+
+	if c.PGPSignature != "" {
+		order = append(order, signatureHeader)
+	}
+
+	return order
+}
+
 // Encode transforms a Commit into a plumbing.EncodedObject.
 func (c *Commit) Encode(o plumbing.EncodedObject) error {
 	return c.encode(o, true)
@@ -384,50 +516,65 @@ func (c *Commit) encode(o plumbing.EncodedObject, includeSig bool) (err error) {
 		return err
 	}
 
-	if c.MergeTag != "" {
-		if _, err = fmt.Fprint(w, "\n"+headermergetag+" "); err != nil {
-			return err
-		}
-
-		// Split tag information lines and re-write with a left padding and
-		// newline. Use join for this so it's clear that a newline should not be
-		// added after this section. The newline will be added either as part of
-		// the PGP signature or the commit message.
-		mergetag := strings.TrimSuffix(c.MergeTag, "\n")
-		lines := strings.Split(mergetag, "\n")
-		if _, err = fmt.Fprint(w, strings.Join(lines, "\n ")); err != nil {
-			return err
-		}
+	// The headers of a decoded commit are written in their order, the ones
+	// set since then in the default one.
+	order := c.defaultHeaderOrder()
+	if c.headerOrder != nil {
+		order = append(slices.Clone(c.headerOrder), order...)
 	}
 
-	if string(c.Encoding) != "" && c.Encoding != defaultUtf8CommitMessageEncoding {
-		if _, err = fmt.Fprintf(w, "\n%s %s", headerencoding, c.Encoding); err != nil {
-			return err
-		}
-	}
+	var wroteEncoding, wroteMergeTag, wroteSignature bool
+	var extra int
+	for _, kind := range order {
+		switch kind {
+		case encodingHeader:
+			if wroteEncoding || c.Encoding == "" {
+				continue
+			}
 
-	for _, header := range c.ExtraHeaders {
-		if _, err = fmt.Fprintf(w, "\n%s", header); err != nil {
-			return err
-		}
-	}
+			wroteEncoding = true
+			if _, err = fmt.Fprintf(w, "\n%s %s", headerencoding, c.Encoding); err != nil {
+				return err
+			}
+		case mergeTagHeader:
+			if wroteMergeTag || c.MergeTag == "" {
+				continue
+			}
 
-	if c.PGPSignature != "" && includeSig {
-		if _, err = fmt.Fprint(w, "\n"+headerpgp+" "); err != nil {
-			return err
-		}
+			wroteMergeTag = true
+			if err = writeFoldedHeader(w, headermergetag, c.MergeTag); err != nil {
+				return err
+			}
+		case extraHeader:
+			if extra >= len(c.ExtraHeaders) {
+				continue
+			}
 
-		// Split all the signature lines and re-write with a left padding and
-		// newline. Use join for this so it's clear that a newline should not be
-		// added after this section, as it will be added when the message is
-		// printed.
-		signature := strings.TrimSuffix(c.PGPSignature, "\n")
-		lines := strings.Split(signature, "\n")
-		if _, err = fmt.Fprint(w, strings.Join(lines, "\n ")); err != nil {
-			return err
+			extra++
+			if _, err = fmt.Fprintf(w, "\n%s", c.ExtraHeaders[extra-1]); err != nil {
+				return err
+			}
+		case signatureHeader:
+			if wroteSignature || c.PGPSignature == "" {
+				continue
+			}
+
+			wroteSignature = true
+			if !includeSig {
+				continue
+			}
+
+			if err = writeFoldedHeader(w, headerpgp, c.PGPSignature); err != nil {
+				return err
+			}
 		}
 	}
 
+	if c.noMessageSeparator && c.Message == "" {
+		_, err = fmt.Fprint(w, "\n")
+		return err
+	}
+
 	if _, err = fmt.Fprintf(w, "\n\n%s", c.Message); err != nil {
 		return err
 	}
@@ -435,6 +582,16 @@ func (c *Commit) encode(o plumbing.EncodedObject, includeSig bool) (err error) {
 	return err
 }
 
+// writeFoldedHeader writes the header of the given value, spread on several
+// lines, each one but the first being prefixed by a space. No newline is
+// written after the header, as it is written either by the next header or
+// before the message.
+func writeFoldedHeader(w io.Writer, key, value string) error {
+	lines := strings.Split(strings.TrimSuffix(value, "\n"), "\n")
+	_, err := fmt.Fprintf(w, "\n%s %s", key, strings.Join(lines, "\n "))
+	return err
+}
+
 // Stats returns the stats of a commit.
 func (c *Commit) Stats() (FileStats, error) {
 	return c.StatsContext(context.Background())
@@ -502,6 +659,25 @@ func (c *Commit) Verify(armoredKeyRing string) (*openpgp.Entity, error) {
 	return openpgp.CheckArmoredDetachedSignature(keyring, er, signature, nil)
 }
 
+// VerifySSH performs the verification of the SSH signature of the commit, as
+// made by git when gpg.format is ssh, with the given allowed signers. An
+// error is returned if the signature is invalid. Otherwise, the signature is
+// trusted if made by an allowed signer for the git namespace, at the time
+// of the commit.
+func (c *Commit) VerifySSH(signers sshsig.AllowedSigners) (*sshsig.Verification, error) {
+	encoded := &plumbing.MemoryObject{}
+	// Encode commit components, excluding signature and get a reader object.
+	if err := c.EncodeWithoutSignature(encoded); err != nil {
+		return nil, err
+	}
+	er, err := encoded.Reader()
+	if err != nil {
+		return nil, err
+	}
+
+	return signers.Verify(er, []byte(c.PGPSignature), sshsig.GitNamespace, c.Committer.When)
+}
+
 // Less defines a compare function to determine which commit is 'earlier' by:
 // - First use Committer.When
 // - If Committer.When are equal then use Author.When
@@ -5,15 +5,18 @@ import (
 	"context"
 	"fmt"
 	"io"
+	"os/exec"
 	"strings"
 	"testing"
 	"time"
 
+	"github.com/go-git/go-billy/v6/util"
 	fixtures "github.com/go-git/go-git-fixtures/v5"
 	"github.com/stretchr/testify/suite"
 
 	"github.com/go-git/go-git/v6/plumbing"
 	"github.com/go-git/go-git/v6/plumbing/cache"
+	"github.com/go-git/go-git/v6/plumbing/format/sshsig"
 	"github.com/go-git/go-git/v6/storage/filesystem"
 )
 
@@ -86,6 +89,51 @@ func (s *SuiteCommit) TestParentNotFound() {
 	s.Nil(commit)
 }
 
+func (s *SuiteCommit) TestParentsGrafted() {
+	fs := fixtures.Basic().One().DotGit()
+	sto := filesystem.NewStorage(fs, cache.NewObjectLRUDefault())
+	head := plumbing.NewHash("6ecf0ef2c2dffb796033e5a02219af86ec6584e5")
+	merge := plumbing.NewHash("1669dce138d9b841a518c64b10914d88f5e488ea")
+
+	log := func() []string {
+		c, err := GetCommit(sto, head)
+		s.Require().NoError(err)
+
+		var hashes []string
+		err = NewCommitPreorderIter(c, nil, nil).ForEach(func(c *Commit) error {
+			hashes = append(hashes, c.Hash.String()[:7])
+			return nil
+		})
+		s.Require().NoError(err)
+		return hashes
+	}
+
+	// The parents of a shallow commit are missing.
+	s.Require().NoError(sto.SetShallow([]plumbing.Hash{plumbing.NewHash("af2d6a6954d532f8ffb47615169c8fdf9d383a1a")}))
+	s.Equal([]string{"6ecf0ef", "918c48b", "af2d6a6"}, log())
+
+	s.Require().NoError(sto.SetShallow(nil))
+	s.Require().NoError(util.WriteFile(fs, "info/grafts", []byte(
+		"# comment\n"+merge.String()+" b8e471f58bcbca63b07bda20e428190409c2db47\n"), 0o644))
+	s.Equal([]string{"6ecf0ef", "918c48b", "af2d6a6", "1669dce", "b8e471f", "b029517"}, log())
+
+	c, err := GetCommit(sto, merge)
+	s.Require().NoError(err)
+	s.Equal(1, c.NumParents())
+	s.Len(c.ParentHashes, 2)
+
+	// The replaced parents are the replacing commits.
+	s.Require().NoError(sto.SetReference(plumbing.NewHashReference(
+		"refs/replace/b8e471f58bcbca63b07bda20e428190409c2db47", plumbing.NewHash("35e85108805c84807bc66a02d91535e1e24b38b9"))))
+	p, err := c.Parent(0)
+	s.Require().NoError(err)
+	s.Equal("35e85108805c84807bc66a02d91535e1e24b38b9", p.Hash.String())
+	s.Equal([]string{"6ecf0ef", "918c48b", "af2d6a6", "1669dce", "35e8510", "b029517"}, log())
+
+	_, err = c.Parent(1)
+	s.ErrorIs(err, ErrParentNotFound)
+}
+
 func (s *SuiteCommit) TestPatch() {
 	from := s.commit(plumbing.NewHash("918c48b83bd081e863dbe1b80f8998f058cd8294"))
 	to := s.commit(plumbing.NewHash("6ecf0ef2c2dffb796033e5a02219af86ec6584e5"))
@@ -513,6 +561,51 @@ YIefGtzXfldDxg4=
 	s.True(ok)
 }
 
+// sshAllowedSigners trusts the key of the SSH signatures of the tests,
+// signed by git with gpg.format set to ssh.
+const sshAllowedSigners = "foo@example.com ssh-ed25519 AAAAC3NzaC1lZDI1NTE5AAAAIIPrkrKNRzFelEYeCfmdQs4Ov/gS9/MxXp/4iH/brVwW"
+
+func (s *SuiteCommit) TestVerifySSH() {
+	objectText := `tree 4b825dc642cb6eb9a060e54bf8d69288fbee4904
+author foo <foo@example.com> 1577836800 +0000
+committer foo <foo@example.com> 1791952497 +0000
+gpgsig -----BEGIN SSH SIGNATURE-----
+ U1NIU0lHAAAAAQAAADMAAAALc3NoLWVkMjU1MTkAAAAgg+uSso1HMV6URh4J+Z1Czg6/+B
+ L38zFen/iIf9utXBYAAAADZ2l0AAAAAAAAAAZzaGE1MTIAAABTAAAAC3NzaC1lZDI1NTE5
+ AAAAQLigrJ6+FYqiYc5d9UaZYlg9Hzuhkjx0W0TFEydya8btL+Qbws7wshhrGipAqh9mnk
+ AAWJdiru88R5pADG1vHQs=
+ -----END SSH SIGNATURE-----
+
+signed
+`
+
+	o := &plumbing.MemoryObject{}
+	o.SetType(plumbing.CommitObject)
+	_, err := o.Write([]byte(objectText))
+	s.NoError(err)
+
+	commit := &Commit{}
+	s.NoError(commit.Decode(o))
+
+	signers, err := sshsig.ParseAllowedSigners(strings.NewReader(sshAllowedSigners))
+	s.NoError(err)
+
+	v, err := commit.VerifySSH(signers)
+	s.NoError(err)
+	s.True(v.Trusted())
+	s.Equal("foo@example.com", v.Principal)
+
+	// Without allowed signers, the signature is valid but not trusted.
+	v, err = commit.VerifySSH(nil)
+	s.NoError(err)
+	s.False(v.Trusted())
+
+	// The gpgsig header is not part of the signed payload, the message is.
+	commit.Message = "modified\n"
+	_, err = commit.VerifySSH(signers)
+	s.ErrorIs(err, sshsig.ErrInvalidSignature)
+}
+
 func (s *SuiteCommit) TestPatchCancel() {
 	from := s.commit(plumbing.NewHash("918c48b83bd081e863dbe1b80f8998f058cd8294"))
 	to := s.commit(plumbing.NewHash("6ecf0ef2c2dffb796033e5a02219af86ec6584e5"))
@@ -542,6 +635,62 @@ func (s *SuiteCommit) TestMalformedHeader() {
 	s.NoError(err)
 }
 
+func (s *SuiteCommit) TestEncodeTimeZones() {
+	offsets := map[string]int{
+		"+0000": 0,
+		"-0000": 0,
+		"+0530": 5*3600 + 30*60,
+		"-0030": -30 * 60,
+		"-1200": -12 * 3600,
+		"+1400": 14 * 3600,
+		"+0090": 90 * 60,
+	}
+
+	for tz, offset := range offsets {
+		raw := fmt.Sprintf("tree 4b825dc642cb6eb9a060e54bf8d69288fbee4904\n"+
+			"author Foo <foo@example.local> 1257894000 %s\n"+
+			"committer Bar <bar@example.local> 1257894001 %s\n\nmessage\n", tz, tz)
+
+		o := &plumbing.MemoryObject{}
+		o.SetType(plumbing.CommitObject)
+		_, err := o.Write([]byte(raw))
+		s.Require().NoError(err)
+
+		c := &Commit{}
+		s.Require().NoError(c.Decode(o))
+		_, got := c.Author.When.Zone()
+		s.Equal(offset, got, tz)
+		s.Equal(int64(1257894000), c.Author.When.Unix(), tz)
+
+		// The commit is encoded as it was written.
+		encoded := &plumbing.MemoryObject{}
+		s.Require().NoError(c.Encode(encoded))
+		rd, err := encoded.Reader()
+		s.Require().NoError(err)
+		content, err := io.ReadAll(rd)
+		s.Require().NoError(err)
+		s.Equal(raw, string(content), tz)
+		s.Equal(o.Hash(), encoded.Hash(), tz)
+
+		if _, err := exec.LookPath("git"); err != nil {
+			continue
+		}
+
+		cmd := exec.Command("git", "hash-object", "-t", "commit", "--stdin")
+		cmd.Stdin = strings.NewReader(raw)
+		out, err := cmd.CombinedOutput()
+		s.Require().NoError(err, string(out))
+		s.Equal(strings.TrimSpace(string(out)), encoded.Hash().String(), tz)
+	}
+
+	// The time zone follows the location of the time once it is changed.
+	c := &Commit{}
+	c.Author.When = time.Unix(1257894000, 0).In(time.FixedZone("-0000", 0)).In(time.FixedZone("", 3600))
+	var b bytes.Buffer
+	s.Require().NoError(c.Author.Encode(&b))
+	s.Equal(" <> 1257894000 +0100", b.String())
+}
+
 func (s *SuiteCommit) TestEncodeWithoutSignature() {
 	// Similar to TestString since no signature
 	encoded := &plumbing.MemoryObject{}
@@ -673,6 +822,131 @@ initial commit
 `, string(payload))
 }
 
+func (s *SuiteCommit) TestEncodeHeadersOrder() {
+	mergetag := "mergetag object 35e85108805c84807bc66a02d91535e1e24b38b9\n" +
+		" type commit\n" +
+		" tag v1.0.0\n" +
+		" tagger John Doe <john.doe@example.com> 1755280730 -0700\n" +
+		" \n" +
+		" v1.0.0\n" +
+		"   indented line\n" +
+		" -----BEGIN PGP SIGNATURE-----\n" +
+		" \n" +
+		" iHUEABMIAB0WIQSZpnSpGKbQbDaLe5iiNQl48cTY5gUCaJ91XQAKCRCiNQl48cTY\n" +
+		" -----END PGP SIGNATURE-----\n"
+	gpgsig := "gpgsig -----BEGIN PGP SIGNATURE-----\n" +
+		" \n" +
+		" iHUEABMIAB0WIQSZpnSpGKbQbDaLe5iiNQl48cTY5gUCaJ91XQAKCRCiNQl48cTY\n" +
+		" -----END PGP SIGNATURE-----\n"
+	head := "tree 4b825dc642cb6eb9a060e54bf8d69288fbee4904\n" +
+		"parent a5b8b09e2f8fcb0bb99d3ccb0958157b40890d69\n" +
+		"parent 35e85108805c84807bc66a02d91535e1e24b38b9\n" +
+		"author John Doe <john.doe@example.com> 1755280730 -0700\n" +
+		"committer John Doe <john.doe@example.com> 1755280730 -0700\n"
+
+	for _, raw := range []string{
+		head + "encoding ISO-8859-1\n" + mergetag + gpgsig + "\nmerge\n",
+		head + mergetag + "encoding ISO-8859-1\n" + gpgsig + "\nmerge\n",
+		head + "encoding UTF-8\n" + "\nmerge\n",
+		head + mergetag + strings.Replace(mergetag, "v1.0.0", "v2.0.0", -1) + "\nmerge\n",
+		head + gpgsig + "change-id wxmuynokkzxmuwxwvnnpnptoyuypknwv\n" + mergetag + "\nmerge\n",
+	} {
+		obj := &plumbing.MemoryObject{}
+		obj.SetType(plumbing.CommitObject)
+		obj.Write([]byte(raw))
+
+		commit, err := DecodeCommit(s.Storer, obj)
+		s.NoError(err)
+		s.Contains(commit.MergeTag+commit.Message, "merge")
+		if strings.Contains(raw, mergetag) {
+			s.Equal(strings.TrimSuffix(strings.ReplaceAll(strings.TrimPrefix(mergetag, "mergetag "), "\n ", "\n"), "\n")+"\n", commit.MergeTag)
+		}
+
+		encoded := &plumbing.MemoryObject{}
+		s.NoError(commit.Encode(encoded))
+		s.Equal(obj.Hash(), encoded.Hash())
+
+		r, err := encoded.Reader()
+		s.NoError(err)
+		b, err := io.ReadAll(r)
+		s.NoError(err)
+		s.Equal(raw, string(b))
+
+		// The signature is removed in place.
+		encoded = &plumbing.MemoryObject{}
+		s.NoError(commit.EncodeWithoutSignature(encoded))
+		r, err = encoded.Reader()
+		s.NoError(err)
+		b, err = io.ReadAll(r)
+		s.NoError(err)
+		s.Equal(strings.Replace(raw, gpgsig, "", 1), string(b))
+	}
+}
+
+func (s *SuiteCommit) TestEncodeNoMessageSeparator() {
+	raw := "tree 4b825dc642cb6eb9a060e54bf8d69288fbee4904\n" +
+		"author John Doe <john.doe@example.com> 1755280730 -0700\n" +
+		"committer John Doe <john.doe@example.com> 1755280730 -0700\n"
+
+	obj := &plumbing.MemoryObject{}
+	obj.SetType(plumbing.CommitObject)
+	obj.Write([]byte(raw))
+
+	commit, err := DecodeCommit(s.Storer, obj)
+	s.NoError(err)
+	s.Equal("", commit.Message)
+
+	encoded := &plumbing.MemoryObject{}
+	s.NoError(commit.Encode(encoded))
+	s.Equal(obj.Hash(), encoded.Hash())
+
+	// The separator is written back once the commit is given a message.
+	commit.Message = "message\n"
+	encoded = &plumbing.MemoryObject{}
+	s.NoError(commit.Encode(encoded))
+	r, err := encoded.Reader()
+	s.NoError(err)
+	b, err := io.ReadAll(r)
+	s.NoError(err)
+	s.Equal(raw+"\nmessage\n", string(b))
+
+	// An empty message after the separator keeps it.
+	obj = &plumbing.MemoryObject{}
+	obj.SetType(plumbing.CommitObject)
+	obj.Write([]byte(raw + "\n"))
+
+	commit, err = DecodeCommit(s.Storer, obj)
+	s.NoError(err)
+	encoded = &plumbing.MemoryObject{}
+	s.NoError(commit.Encode(encoded))
+	s.Equal(obj.Hash(), encoded.Hash())
+}
+
+func (s *SuiteCommit) TestEncodeSeveralMergeTags() {
+	commit := &Commit{
+		Author:    Signature{Name: "Foo", Email: "foo@example.local", When: time.Unix(1755280730, 0).UTC()},
+		Committer: Signature{Name: "Foo", Email: "foo@example.local", When: time.Unix(1755280730, 0).UTC()},
+		TreeHash:  plumbing.NewHash("4b825dc642cb6eb9a060e54bf8d69288fbee4904"),
+		MergeTag:  "object a5b8b09e2f8fcb0bb99d3ccb0958157b40890d69\ntag v1\n",
+		ExtraHeaders: []ExtraHeader{
+			{Key: "mergetag", Value: "object 35e85108805c84807bc66a02d91535e1e24b38b9\ntag v2"},
+		},
+		Encoding: MessageEncoding("ISO-8859-1"),
+		Message:  "caf\xe9\n",
+	}
+
+	obj := &plumbing.MemoryObject{}
+	s.NoError(commit.Encode(obj))
+	decoded, err := DecodeCommit(s.Storer, obj)
+	s.NoError(err)
+	s.Equal(commit.MergeTag, decoded.MergeTag)
+	s.Equal(commit.ExtraHeaders, decoded.ExtraHeaders)
+	s.Equal("café\n", decoded.DecodedMessage())
+
+	decoded.Encoding = "x-unknown"
+	s.Equal(commit.Message, decoded.DecodedMessage())
+}
+
 func (s *SuiteCommit) TestLess() {
 	when1 := time.Now()
 	when2 := when1.Add(time.Hour)
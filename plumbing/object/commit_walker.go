@@ -103,7 +103,7 @@ func (w *commitPreIterator) Next() (*Commit, error) {
 
 func filteredParentIter(c *Commit, seen map[plumbing.Hash]bool) CommitIter {
 	var hashes []plumbing.Hash
-	for _, h := range c.ParentHashes {
+	for _, h := range c.parentHashes() {
 		if !seen[h] {
 			hashes = append(hashes, h)
 		}
@@ -209,7 +209,7 @@ func (w *commitPostIteratorFirstParent) Next() (*Commit, error) {
 		w.seen[c.Hash] = true
 
 		return c, c.Parents().ForEach(func(p *Commit) error {
-			if len(c.ParentHashes) > 0 && p.Hash == c.ParentHashes[0] {
+			if parents := c.parentHashes(); len(parents) > 0 && p.Hash == parents[0] {
 				w.stack = append(w.stack, p)
 			}
 			return nil
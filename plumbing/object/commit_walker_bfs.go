@@ -65,7 +65,7 @@ func (w *bfsCommitIterator) Next() (*Commit, error) {
 
 		w.seen[c.Hash] = true
 
-		for _, h := range c.ParentHashes {
+		for _, h := range c.parentHashes() {
 			err := w.appendHash(c.s, h)
 			if err != nil {
 				return nil, err
@@ -0,0 +1,368 @@
+package object
+
+import (
+	"context"
+	"io"
+	"path"
+	"strings"
+
+	"github.com/emirpasic/gods/trees/binaryheap"
+
+	"github.com/go-git/go-git/v6/plumbing"
+	"github.com/go-git/go-git/v6/plumbing/filemode"
+	"github.com/go-git/go-git/v6/plumbing/format/commitgraph"
+	"github.com/go-git/go-git/v6/plumbing/storer"
+)
+
+// CommitHistoryOptions describes the paths whose history is walked by
+// NewCommitHistoryIter and NewCommitHistoryFilterIter.
+type CommitHistoryOptions struct {
+	// Path is the file or directory whose history is walked, as in
+	// `git log -- <path>`. If empty, the whole tree is.
+	Path string
+	// PathFilter, if set, limits the history to the files, under Path,
+	// whose paths it returns true for.
+	PathFilter func(path string) bool
+	// Follow, if true, continues the history of the file at Path before it
+	// was renamed, as `git log --follow` does.
+	Follow bool
+}
+
+type commitHistoryIter struct {
+	opts CommitHistoryOptions
+	seen map[plumbing.Hash]bool
+	heap *binaryheap.Heap
+}
+
+// NewCommitHistoryIter returns a CommitIter that walks the history of the
+// files given by opts, starting at the given commits, by committer time, as
+// git log does by default.
+//
+// The history is simplified as git does: a commit is only returned if the
+// files differ from all its parents. If it has a parent with the same files,
+// the history is only walked through that parent, as the changes of the
+// other parents have not been kept. The files are compared by the hashes of
+// their trees, the trees in which they are unchanged being skipped. If the
+// storer of the commits provides a commit-graph with changed-path Bloom
+// filters, the trees of a commit and its first parent are not compared when
+// its filter records that Path didn't change, as git does unless following
+// renames.
+func NewCommitHistoryIter(from []*Commit, opts *CommitHistoryOptions) CommitIter {
+	heap := binaryheap.NewWith(func(a, b any) int {
+		if a.(*Commit).Committer.When.Before(b.(*Commit).Committer.When) {
+			return 1
+		}
+		return -1
+	})
+
+	for _, c := range from {
+		heap.Push(c)
+	}
+
+	return &commitHistoryIter{
+		opts: *opts,
+		seen: make(map[plumbing.Hash]bool),
+		heap: heap,
+	}
+}
+
+func (w *commitHistoryIter) Next() (*Commit, error) {
+	for {
+		v, ok := w.heap.Pop()
+		if !ok {
+			return nil, io.EOF
+		}
+
+		c := v.(*Commit)
+		if w.seen[c.Hash] {
+			continue
+		}
+
+		w.seen[c.Hash] = true
+		parents, changed, err := w.opts.simplify(c)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, p := range parents {
+			if !w.seen[p.Hash] {
+				w.heap.Push(p)
+			}
+		}
+
+		if changed {
+			return c, nil
+		}
+	}
+}
+
+func (w *commitHistoryIter) ForEach(cb func(*Commit) error) error {
+	return forEachCommit(w.Next, cb)
+}
+
+func (w *commitHistoryIter) Close() {}
+
+type commitHistoryFilterIter struct {
+	opts       CommitHistoryOptions
+	sourceIter CommitIter
+}
+
+// NewCommitHistoryFilterIter returns a CommitIter that returns the commits of
+// commitIter in which the files given by opts differ from all their parents,
+// like NewCommitHistoryIter, but without simplifying the history walked by
+// commitIter.
+func NewCommitHistoryFilterIter(commitIter CommitIter, opts *CommitHistoryOptions) CommitIter {
+	return &commitHistoryFilterIter{opts: *opts, sourceIter: commitIter}
+}
+
+func (w *commitHistoryFilterIter) Next() (*Commit, error) {
+	for {
+		c, err := w.sourceIter.Next()
+		if err != nil {
+			return nil, err
+		}
+
+		_, changed, err := w.opts.simplify(c)
+		if err != nil {
+			return nil, err
+		}
+
+		if changed {
+			return c, nil
+		}
+	}
+}
+
+func (w *commitHistoryFilterIter) ForEach(cb func(*Commit) error) error {
+	return forEachCommit(w.Next, cb)
+}
+
+func (w *commitHistoryFilterIter) Close() {
+	w.sourceIter.Close()
+}
+
+// simplify returns whether the files differ between the commit and all its
+// parents, and the parents whose history must be walked: the first one with
+// the same files, if any, or all of them.
+//
+// As git does, the history is not simplified when following renames, as the
+// path changes along the history, and the merges are skipped.
+func (o *CommitHistoryOptions) simplify(c *Commit) (parents []*Commit, changed bool, err error) {
+	if c.NumParents() > 0 && !o.Follow && !o.mightChange(c) {
+		p, err := GetCommit(c.s, c.parentHashes()[0])
+		if err != nil {
+			return nil, false, err
+		}
+
+		return []*Commit{p}, false, nil
+	}
+
+	tree, err := c.Tree()
+	if err != nil {
+		return nil, false, err
+	}
+
+	entry, err := o.entry(tree)
+	if err != nil {
+		return nil, false, err
+	}
+
+	if c.NumParents() == 0 {
+		same, err := o.same(c.s, o.Path, entry, nil)
+		return nil, !same, err
+	}
+
+	changed = true
+	for _, h := range c.parentHashes() {
+		p, err := GetCommit(c.s, h)
+		if err != nil {
+			return nil, false, err
+		}
+
+		parents = append(parents, p)
+		parentTree, err := p.Tree()
+		if err != nil {
+			return nil, false, err
+		}
+
+		parentEntry, err := o.entry(parentTree)
+		if err != nil {
+			return nil, false, err
+		}
+
+		same, err := o.same(c.s, o.Path, entry, parentEntry)
+		if err != nil {
+			return nil, false, err
+		}
+
+		if !o.Follow {
+			if same {
+				return []*Commit{p}, false, nil
+			}
+
+			continue
+		}
+
+		changed = !same && c.NumParents() == 1
+		if changed && parentEntry == nil && entry != nil && entry.Mode.IsFile() {
+			if err := o.follow(parentTree, tree); err != nil {
+				return nil, false, err
+			}
+		}
+	}
+
+	return parents, changed, nil
+}
+
+// mightChange returns whether Path might have changed between the commit and
+// its first parent, false only if the changed-path Bloom filter of the commit
+// in the commit-graph of its storer, if any, records that neither Path nor
+// its leading directories changed.
+func (o *CommitHistoryOptions) mightChange(c *Commit) bool {
+	if o.Path == "" {
+		return true
+	}
+
+	gs, ok := c.s.(commitgraph.Storer)
+	if !ok {
+		return true
+	}
+
+	index, err := gs.CommitGraph()
+	if err != nil {
+		return true
+	}
+
+	bi, ok := index.(commitgraph.BloomFilterIndex)
+	if !ok {
+		return true
+	}
+
+	filter, err := bi.GetBloomFilterByHash(c.Hash)
+	if err != nil {
+		return true
+	}
+
+	for p := strings.Trim(o.Path, "/"); p != "." && p != ""; p = path.Dir(p) {
+		if !filter.MightContain(p) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// follow continues the history of the file at Path, which has been added
+// since the first parent, with the file it has been renamed from, if any.
+func (o *CommitHistoryOptions) follow(parent, tree *Tree) error {
+	// The renames are detected as git log --follow does, with a similarity
+	// of 50% at least.
+	changes, err := DiffTreeWithOptions(context.Background(), parent, tree, &DiffTreeOptions{
+		DetectRenames: true,
+		RenameScore:   50,
+	})
+	if err != nil {
+		return err
+	}
+
+	for _, ch := range changes {
+		if ch.To.Name == o.Path && ch.From.Name != "" && ch.From.Name != o.Path {
+			o.Path = ch.From.Name
+			return nil
+		}
+	}
+
+	return nil
+}
+
+// entry returns the entry of Path in the tree, the tree itself if Path is
+// empty, or nil if it doesn't exist.
+func (o *CommitHistoryOptions) entry(t *Tree) (*TreeEntry, error) {
+	entry := &TreeEntry{Mode: filemode.Dir, Hash: t.Hash}
+	if o.Path == "" {
+		return entry, nil
+	}
+
+	for i, name := range strings.Split(o.Path, "/") {
+		if entry.Mode != filemode.Dir {
+			return nil, nil
+		}
+
+		var err error
+		if i > 0 {
+			if t, err = GetTree(t.s, entry.Hash); err != nil {
+				return nil, err
+			}
+		}
+
+		if entry, err = t.entry(name); err != nil {
+			return nil, nil
+		}
+	}
+
+	return entry, nil
+}
+
+// same returns whether the files of PathFilter are the same in the entries
+// of the given path, either of which may be nil if it doesn't exist. The
+// trees are only compared if their hashes differ.
+func (o *CommitHistoryOptions) same(s storer.EncodedObjectStorer, name string, a, b *TreeEntry) (bool, error) {
+	if a == nil && b == nil {
+		return true, nil
+	}
+
+	if a != nil && b != nil && a.Hash == b.Hash && a.Mode == b.Mode {
+		return true, nil
+	}
+
+	if o.PathFilter == nil {
+		return false, nil
+	}
+
+	var trees [2]*Tree
+	for i, e := range []*TreeEntry{a, b} {
+		switch {
+		case e == nil:
+		case e.Mode == filemode.Dir:
+			var err error
+			if trees[i], err = GetTree(s, e.Hash); err != nil {
+				return false, err
+			}
+		case o.PathFilter(name):
+			return false, nil
+		}
+	}
+
+	if trees[0] == nil && trees[1] == nil {
+		return true, nil
+	}
+
+	entries := make(map[string][2]*TreeEntry)
+	var names []string
+	for i, t := range trees {
+		if t == nil {
+			continue
+		}
+
+		for j := range t.Entries {
+			e := &t.Entries[j]
+			pair, ok := entries[e.Name]
+			if !ok {
+				names = append(names, e.Name)
+			}
+
+			pair[i] = e
+			entries[e.Name] = pair
+		}
+	}
+
+	for _, n := range names {
+		pair := entries[n]
+		same, err := o.same(s, path.Join(name, n), pair[0], pair[1])
+		if err != nil || !same {
+			return same, err
+		}
+	}
+
+	return true, nil
+}
@@ -0,0 +1,79 @@
+package object
+
+import (
+	"strings"
+
+	"github.com/go-git/go-git/v6/plumbing"
+)
+
+func (s *CommitWalkerSuite) historyHashes(iter CommitIter) []string {
+	var hashes []string
+	err := iter.ForEach(func(c *Commit) error {
+		hashes = append(hashes, c.Hash.String())
+		return nil
+	})
+	s.NoError(err)
+
+	return hashes
+}
+
+func (s *CommitWalkerSuite) TestCommitHistoryIter() {
+	head := s.commit(plumbing.NewHash(s.Fixture.Head))
+
+	for path, expected := range map[string][]string{
+		// The merges bringing CHANGELOG from the other branch are skipped,
+		// as the file is the same in their first parents.
+		"CHANGELOG":  {"b8e471f58bcbca63b07bda20e428190409c2db47"},
+		"binary.jpg": {"35e85108805c84807bc66a02d91535e1e24b38b9"},
+		"LICENSE":    {"b029517f6300c2da0f4b651b8642506cd6aaf45d"},
+		"json":       {"af2d6a6954d532f8ffb47615169c8fdf9d383a1a"},
+		"vendor":     {"6ecf0ef2c2dffb796033e5a02219af86ec6584e5"},
+		"README":     nil,
+	} {
+		iter := NewCommitHistoryIter([]*Commit{head}, &CommitHistoryOptions{Path: path})
+		s.Equal(expected, s.historyHashes(iter), path)
+	}
+}
+
+func (s *CommitWalkerSuite) TestCommitHistoryIterPathFilter() {
+	head := s.commit(plumbing.NewHash(s.Fixture.Head))
+
+	iter := NewCommitHistoryIter([]*Commit{head}, &CommitHistoryOptions{
+		PathFilter: func(path string) bool { return strings.HasSuffix(path, ".go") },
+	})
+
+	s.Equal([]string{
+		"6ecf0ef2c2dffb796033e5a02219af86ec6584e5",
+		"918c48b83bd081e863dbe1b80f8998f058cd8294",
+	}, s.historyHashes(iter))
+}
+
+func (s *CommitWalkerSuite) TestCommitHistoryIterMultipleTips() {
+	from := []*Commit{
+		s.commit(plumbing.NewHash(s.Fixture.Head)),
+		s.commit(plumbing.NewHash("e8d3ffab552895c19b9fcf7aa264d277cde33881")),
+	}
+
+	iter := NewCommitHistoryIter(from, &CommitHistoryOptions{
+		PathFilter: func(path string) bool { return path == "README" || path == "CHANGELOG" },
+	})
+
+	s.Equal([]string{
+		"e8d3ffab552895c19b9fcf7aa264d277cde33881",
+		"b8e471f58bcbca63b07bda20e428190409c2db47",
+	}, s.historyHashes(iter))
+}
+
+func (s *CommitWalkerSuite) TestCommitHistoryFilterIter() {
+	head := s.commit(plumbing.NewHash(s.Fixture.Head))
+
+	// Without simplification, the merges that changed CHANGELOG compared to
+	// all their parents are kept.
+	iter := NewCommitHistoryFilterIter(NewCommitPreorderIter(head, nil, nil), &CommitHistoryOptions{
+		Path: "CHANGELOG",
+	})
+
+	hashes := s.historyHashes(iter)
+	s.Contains(hashes, "b8e471f58bcbca63b07bda20e428190409c2db47")
+	s.NotContains(hashes, "6ecf0ef2c2dffb796033e5a02219af86ec6584e5")
+}
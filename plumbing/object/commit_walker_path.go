@@ -137,7 +137,7 @@ func (c *commitPathIter) hasFileChange(changes Changes, parent *Commit) bool {
 }
 
 func isParentHash(hash plumbing.Hash, commit *Commit) bool {
-	return slices.Contains(commit.ParentHashes, hash)
+	return slices.Contains(commit.parentHashes(), hash)
 }
 
 func (c *commitPathIter) ForEach(cb func(*Commit) error) error {
@@ -266,6 +266,83 @@ func (s *CommitWalkerSuite) TestCommitCTimeIterator() {
 	}
 }
 
+func (s *CommitWalkerSuite) TestCommitTopoOrderIterator() {
+	commit := s.commit(plumbing.NewHash(s.Fixture.Head))
+
+	var commits []*Commit
+	NewCommitTopoOrderIter([]*Commit{commit}).ForEach(func(c *Commit) error {
+		commits = append(commits, c)
+		return nil
+	})
+
+	// The history of the second parent of the merge 1669dce is visited
+	// first, before the one of its first parent 35e8510.
+	expected := []string{
+		"6ecf0ef2c2dffb796033e5a02219af86ec6584e5",
+		"918c48b83bd081e863dbe1b80f8998f058cd8294",
+		"af2d6a6954d532f8ffb47615169c8fdf9d383a1a",
+		"1669dce138d9b841a518c64b10914d88f5e488ea",
+		"a5b8b09e2f8fcb0bb99d3ccb0958157b40890d69",
+		"b8e471f58bcbca63b07bda20e428190409c2db47",
+		"35e85108805c84807bc66a02d91535e1e24b38b9",
+		"b029517f6300c2da0f4b651b8642506cd6aaf45d",
+	}
+	s.Equal(expected, commitHashes(commits))
+}
+
+func (s *CommitWalkerSuite) TestCommitDateOrderIterator() {
+	commits := []*Commit{
+		s.commit(plumbing.NewHash(s.Fixture.Head)),
+		s.commit(plumbing.NewHash("e8d3ffab552895c19b9fcf7aa264d277cde33881")),
+		s.commit(plumbing.NewHash("af2d6a6954d532f8ffb47615169c8fdf9d383a1a")),
+	}
+
+	iter := NewCommitDateOrderIter(commits)
+	commits = nil
+	iter.ForEach(func(c *Commit) error {
+		commits = append(commits, c)
+		return nil
+	})
+
+	expected := []string{
+		"6ecf0ef2c2dffb796033e5a02219af86ec6584e5",
+		"e8d3ffab552895c19b9fcf7aa264d277cde33881",
+		"918c48b83bd081e863dbe1b80f8998f058cd8294",
+		"af2d6a6954d532f8ffb47615169c8fdf9d383a1a",
+		"1669dce138d9b841a518c64b10914d88f5e488ea",
+		"a5b8b09e2f8fcb0bb99d3ccb0958157b40890d69",
+		"35e85108805c84807bc66a02d91535e1e24b38b9",
+		"b8e471f58bcbca63b07bda20e428190409c2db47",
+		"b029517f6300c2da0f4b651b8642506cd6aaf45d",
+	}
+	s.Equal(expected, commitHashes(commits))
+}
+
+func (s *CommitWalkerSuite) TestCommitTopoOrderIteratorChildrenFirst() {
+	// A commit is not visited before its children, even if it is more
+	// recent than them and given first.
+	root := s.commit(plumbing.NewHash("b029517f6300c2da0f4b651b8642506cd6aaf45d"))
+	root.Committer.When = time.Now()
+	for _, iter := range []CommitIter{
+		NewCommitTopoOrderIter([]*Commit{root, s.commit(plumbing.NewHash(s.Fixture.Head))}),
+		NewCommitDateOrderIter([]*Commit{root, s.commit(plumbing.NewHash(s.Fixture.Head))}),
+	} {
+		seen := make(map[plumbing.Hash]bool)
+		var n int
+		s.NoError(iter.ForEach(func(c *Commit) error {
+			n++
+			seen[c.Hash] = true
+			for _, p := range c.ParentHashes {
+				s.False(seen[p], "%s visited before %s", p, c.Hash)
+			}
+
+			return nil
+		}))
+
+		s.Equal(8, n)
+	}
+}
+
 func (s *CommitWalkerSuite) TestCommitCTimeIteratorWithIgnore() {
 	commit := s.commit(plumbing.NewHash(s.Fixture.Head))
 
@@ -361,3 +438,12 @@ func (s *CommitWalkerSuite) TestCommitPathIteratorInitialCommit() {
 		s.Equal(expected[i], commit.Hash.String())
 	}
 }
+
+func commitHashes(commits []*Commit) []string {
+	hashes := make([]string, 0, len(commits))
+	for _, c := range commits {
+		hashes = append(hashes, c.Hash.String())
+	}
+
+	return hashes
+}
@@ -0,0 +1,188 @@
+package object
+
+import (
+	"container/heap"
+	"errors"
+	"io"
+
+	"github.com/go-git/go-git/v6/plumbing"
+	"github.com/go-git/go-git/v6/plumbing/storer"
+)
+
+type commitSortIterator struct {
+	from   []*Commit
+	byDate bool
+	// children is the number of children of each commit not visited yet.
+	children map[plumbing.Hash]int
+	commits  map[plumbing.Hash]*Commit
+	queue    commitSortQueue
+	started  bool
+}
+
+// NewCommitTopoOrderIter returns a CommitIter that walks the history of the
+// given commits as `git log --topo-order` does: no commit is visited before
+// all its children, and the commits of a line of history are visited
+// together, instead of being interleaved by committer time with the ones of
+// the other lines. The first of the given commits is visited first, and the
+// history of the second parent of a merge before the one of its first parent.
+// The whole history is read before the first commit is returned.
+func NewCommitTopoOrderIter(from []*Commit) CommitIter {
+	return &commitSortIterator{from: from}
+}
+
+// NewCommitDateOrderIter returns a CommitIter that walks the history of the
+// given commits as `git log --date-order` does: no commit is visited before
+// all its children, and the commits are otherwise visited by committer time,
+// the most recent first. The whole history is read before the first commit is
+// returned.
+func NewCommitDateOrderIter(from []*Commit) CommitIter {
+	return &commitSortIterator{from: from, byDate: true}
+}
+
+// start reads the history of the commits and counts the children of each
+// commit, as Kahn's algorithm does, the commits without children being
+// queued.
+func (w *commitSortIterator) start() error {
+	w.children = make(map[plumbing.Hash]int)
+	w.commits = make(map[plumbing.Hash]*Commit)
+	w.queue.byDate = w.byDate
+
+	var from []*Commit
+	for _, c := range w.from {
+		if _, ok := w.commits[c.Hash]; !ok {
+			w.commits[c.Hash] = c
+			from = append(from, c)
+		}
+	}
+
+	pending := append([]*Commit(nil), from...)
+	for len(pending) > 0 {
+		c := pending[len(pending)-1]
+		pending = pending[:len(pending)-1]
+		for _, h := range c.parentHashes() {
+			w.children[h]++
+			if _, ok := w.commits[h]; ok {
+				continue
+			}
+
+			p, err := GetCommit(c.s, h)
+			if err != nil {
+				return err
+			}
+
+			w.commits[h] = p
+			pending = append(pending, p)
+		}
+	}
+
+	var tips []*Commit
+	for _, c := range from {
+		if w.children[c.Hash] == 0 {
+			tips = append(tips, c)
+		}
+	}
+
+	// The last commit pushed is visited first in topological order, the
+	// first given commit has to be pushed last.
+	if !w.byDate {
+		for i, j := 0, len(tips)-1; i < j; i, j = i+1, j-1 {
+			tips[i], tips[j] = tips[j], tips[i]
+		}
+	}
+
+	for _, c := range tips {
+		heap.Push(&w.queue, c)
+	}
+
+	return nil
+}
+
+func (w *commitSortIterator) Next() (*Commit, error) {
+	if !w.started {
+		w.started = true
+		if err := w.start(); err != nil {
+			return nil, err
+		}
+	}
+
+	if w.queue.Len() == 0 {
+		return nil, io.EOF
+	}
+
+	c := heap.Pop(&w.queue).(*Commit)
+	for _, h := range c.parentHashes() {
+		w.children[h]--
+		if w.children[h] == 0 {
+			heap.Push(&w.queue, w.commits[h])
+		}
+	}
+
+	return c, nil
+}
+
+func (w *commitSortIterator) ForEach(cb func(*Commit) error) error {
+	for {
+		c, err := w.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+
+		err = cb(c)
+		if errors.Is(err, storer.ErrStop) {
+			break
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (w *commitSortIterator) Close() {}
+
+type commitSortEntry struct {
+	commit *Commit
+	// order is the order in which the commit was queued.
+	order int
+}
+
+// commitSortQueue is a stack of commits, or a priority queue by committer
+// time if byDate is set, the commits of the same time being visited in the
+// order they were queued.
+type commitSortQueue struct {
+	entries []commitSortEntry
+	byDate  bool
+	count   int
+}
+
+func (q *commitSortQueue) Len() int { return len(q.entries) }
+
+func (q *commitSortQueue) Less(i, j int) bool {
+	a, b := q.entries[i], q.entries[j]
+	if !q.byDate {
+		return a.order > b.order
+	}
+
+	if !a.commit.Committer.When.Equal(b.commit.Committer.When) {
+		return a.commit.Committer.When.After(b.commit.Committer.When)
+	}
+
+	return a.order < b.order
+}
+
+func (q *commitSortQueue) Swap(i, j int) { q.entries[i], q.entries[j] = q.entries[j], q.entries[i] }
+
+func (q *commitSortQueue) Push(x any) {
+	q.entries = append(q.entries, commitSortEntry{commit: x.(*Commit), order: q.count})
+	q.count++
+}
+
+func (q *commitSortQueue) Pop() any {
+	e := q.entries[len(q.entries)-1]
+	q.entries = q.entries[:len(q.entries)-1]
+	return e.commit
+}
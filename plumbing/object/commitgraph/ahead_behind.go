@@ -0,0 +1,87 @@
+package commitgraph
+
+import (
+	"math"
+
+	"github.com/emirpasic/gods/trees/binaryheap"
+
+	"github.com/go-git/go-git/v6/plumbing"
+)
+
+// AheadBehind returns the number of commits reachable from local but not
+// from upstream, and the number of those reachable from upstream but not
+// from local, as `git rev-list --left-right --count local...upstream` does.
+//
+// The history is walked by generation until only the commits reachable from
+// both sides are left, as for MergeBase. The commits which are not in the
+// commit-graph have no generation and their committer time may be skewed, so
+// the history is walked until all of them are painted, the whole history if
+// there is no commit-graph.
+func AheadBehind(local, upstream CommitNode) (ahead, behind int, err error) {
+	flags := make(map[plumbing.Hash]uint8)
+	queue := binaryheap.NewWith(func(a, b any) int {
+		return generationAndDateOrderComparator(a.(*queuedNode).node, b.(*queuedNode).node)
+	})
+
+	// The commits reachable from both sides are painted as stale, and the
+	// walk goes on as long as some of the commits queued are not, or have no
+	// generation, as their descendants may still be queued.
+	nonStale, unsorted := 0, 0
+	push := func(n CommitNode, f uint8) {
+		flags[n.ID()] |= f
+		if flags[n.ID()]&(paintedOne|paintedTwo) == paintedOne|paintedTwo {
+			flags[n.ID()] |= paintedStale
+		}
+
+		counted := flags[n.ID()]&paintedStale == 0
+		if counted {
+			nonStale++
+		}
+
+		if n.Generation() == math.MaxUint64 {
+			unsorted++
+		}
+
+		queue.Push(&queuedNode{node: n, counted: counted})
+	}
+
+	push(local, paintedOne)
+	push(upstream, paintedTwo)
+	for nonStale > 0 || unsorted > 0 {
+		v, _ := queue.Pop()
+		q := v.(*queuedNode)
+		if q.counted {
+			nonStale--
+		}
+
+		if q.node.Generation() == math.MaxUint64 {
+			unsorted--
+		}
+
+		c := q.node
+		f := flags[c.ID()]
+		for i, h := range c.ParentHashes() {
+			if flags[h]&f == f {
+				continue
+			}
+
+			p, err := c.ParentNode(i)
+			if err != nil {
+				return 0, 0, err
+			}
+
+			push(p, f)
+		}
+	}
+
+	for _, f := range flags {
+		switch f & (paintedOne | paintedTwo) {
+		case paintedOne:
+			ahead++
+		case paintedTwo:
+			behind++
+		}
+	}
+
+	return ahead, behind, nil
+}
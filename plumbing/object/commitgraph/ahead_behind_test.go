@@ -0,0 +1,131 @@
+package commitgraph
+
+import (
+	"fmt"
+	"math/rand"
+	"slices"
+	"time"
+
+	"github.com/go-git/go-git/v6/plumbing"
+	commitgraph "github.com/go-git/go-git/v6/plumbing/format/commitgraph"
+	"github.com/go-git/go-git/v6/plumbing/object"
+	"github.com/go-git/go-git/v6/storage/memory"
+)
+
+func (s *MergeBaseSuite) TestAheadBehind() {
+	for _, tc := range []struct {
+		local, upstream string
+		ahead, behind   int
+	}{
+		{"A", "A", 0, 0},
+		{"Q", "dev", 5, 0},
+		{"dev", "Q", 0, 5},
+		{"A", "Q", 0, 17},
+		{"Q", "A", 17, 0},
+		{"G", "Q", 1, 5},
+		{"C", "D", 2, 2},
+		{"G", "dev", 2, 1},
+		{"S", "G", 3, 2},
+		// Both histories are counted when they are disconnected.
+		{"M", "N", 3, 3},
+	} {
+		for name, idx := range s.indexes {
+			nodes := s.nodes(idx, tc.local, tc.upstream)
+			ahead, behind, err := AheadBehind(nodes[0], nodes[1])
+			s.NoError(err)
+			s.Equal(tc.ahead, ahead, "%s %s...%s", name, tc.local, tc.upstream)
+			s.Equal(tc.behind, behind, "%s %s...%s", name, tc.local, tc.upstream)
+		}
+	}
+}
+
+func (s *MergeBaseSuite) TestAheadBehindClockSkew() {
+	// Random histories of merges, whose committer times are out of order, are
+	// compared with the sets of the commits reachable from each side.
+	for seed := int64(1); seed <= 5; seed++ {
+		rnd := rand.New(rand.NewSource(seed))
+		st := memory.NewStorage()
+		full := commitgraph.NewMemoryIndex()
+		partial := commitgraph.NewMemoryIndex()
+
+		var hashes []plumbing.Hash
+		reachable := make(map[plumbing.Hash]map[plumbing.Hash]bool)
+		generations := make(map[plumbing.Hash]uint64)
+		for i := 0; i < 40; i++ {
+			var parents []plumbing.Hash
+			for n := min(i, 1+rnd.Intn(2)); len(parents) < n; {
+				p := hashes[rnd.Intn(i)]
+				if !slices.Contains(parents, p) {
+					parents = append(parents, p)
+				}
+			}
+
+			sig := object.Signature{Name: "foo", Email: "foo@foo.foo", When: time.Unix(int64(1e9+rnd.Intn(100)*60), 0)}
+			c := &object.Commit{
+				Author:       sig,
+				Committer:    sig,
+				Message:      fmt.Sprintf("c%d", i),
+				TreeHash:     plumbing.ZeroHash,
+				ParentHashes: parents,
+			}
+
+			obj := st.NewEncodedObject()
+			s.Require().NoError(c.Encode(obj))
+			h, err := st.SetEncodedObject(obj)
+			s.Require().NoError(err)
+
+			reachable[h] = map[plumbing.Hash]bool{h: true}
+			var g uint64
+			for _, p := range parents {
+				for a := range reachable[p] {
+					reachable[h][a] = true
+				}
+
+				g = max(g, generations[p])
+			}
+
+			generations[h] = g + 1
+			data := &commitgraph.CommitData{ParentHashes: parents, Generation: g + 1, When: sig.When}
+			full.Add(h, data)
+			if i < 30 {
+				partial.Add(h, data)
+			}
+
+			hashes = append(hashes, h)
+		}
+
+		indexes := map[string]CommitNodeIndex{
+			"object":  NewObjectCommitNodeIndex(st),
+			"graph":   NewGraphCommitNodeIndex(full, st),
+			"partial": NewGraphCommitNodeIndex(partial, st),
+		}
+
+		for i, local := range hashes {
+			for j, upstream := range hashes {
+				var ahead, behind int
+				for h := range reachable[local] {
+					if !reachable[upstream][h] {
+						ahead++
+					}
+				}
+
+				for h := range reachable[upstream] {
+					if !reachable[local][h] {
+						behind++
+					}
+				}
+
+				for name, idx := range indexes {
+					l, err := idx.Get(local)
+					s.Require().NoError(err)
+					u, err := idx.Get(upstream)
+					s.Require().NoError(err)
+
+					a, b, err := AheadBehind(l, u)
+					s.Require().NoError(err)
+					s.Equal([]int{ahead, behind}, []int{a, b}, "seed %d %s c%d...c%d", seed, name, i, j)
+				}
+			}
+		}
+	}
+}
@@ -40,6 +40,20 @@ func NewGraphCommitNodeIndex(commitGraph commitgraph.Index, s storer.EncodedObje
 	return &graphCommitNodeIndex{commitGraph, s}
 }
 
+// NewCommitNodeIndex returns a CommitNodeIndex for the given storage. When
+// the storage provides a commit-graph, the nodes are loaded from it and
+// commits are only inflated when they are not in the graph; otherwise
+// the nodes are loaded from the object storage.
+func NewCommitNodeIndex(s storer.EncodedObjectStorer) CommitNodeIndex {
+	if gs, ok := s.(commitgraph.Storer); ok {
+		if index, err := gs.CommitGraph(); err == nil {
+			return NewGraphCommitNodeIndex(index, s)
+		}
+	}
+
+	return NewObjectCommitNodeIndex(s)
+}
+
 func (gci *graphCommitNodeIndex) Get(hash plumbing.Hash) (CommitNode, error) {
 	if gci.commitGraph != nil {
 		// Check the commit graph first
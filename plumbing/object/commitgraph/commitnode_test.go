@@ -151,3 +151,21 @@ func (s *CommitNodeSuite) TestMixedGraph() {
 	testParents(s, nodeIndex)
 	testCommitAndTree(s, nodeIndex)
 }
+
+func (s *CommitNodeSuite) TestCommitNodeIndexFromStorage() {
+	f := fixtures.ByTag("commit-graph").One()
+	storer := unpackRepository(f)
+	defer storer.Close()
+
+	nodeIndex := NewCommitNodeIndex(storer)
+	s.IsType(&graphCommitNodeIndex{}, nodeIndex)
+	testWalker(s, nodeIndex)
+	testParents(s, nodeIndex)
+	testCommitAndTree(s, nodeIndex)
+
+	f = fixtures.Basic().One()
+	storer = unpackRepository(f)
+	defer storer.Close()
+
+	s.IsType(&objectCommitNodeIndex{}, NewCommitNodeIndex(storer))
+}
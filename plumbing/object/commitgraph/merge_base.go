@@ -0,0 +1,238 @@
+package commitgraph
+
+import (
+	"sort"
+
+	"github.com/emirpasic/gods/trees/binaryheap"
+
+	"github.com/go-git/go-git/v6/plumbing"
+)
+
+// The flags with which the commits are painted while looking for the merge
+// bases, as git does.
+const (
+	paintedOne uint8 = 1 << iota
+	paintedTwo
+	paintedStale
+	paintedResult
+)
+
+// queuedNode is a node waiting to be painted, counted as long as it was not
+// stale when it was queued.
+type queuedNode struct {
+	node    CommitNode
+	counted bool
+}
+
+// MergeBase returns the best common ancestors of one and all of twos, as
+// `git merge-base --all one twos...` does. That is, the common ancestors
+// which can't be reached from the other common ancestors. There are several
+// of them for criss-cross merges, and none if the histories are
+// disconnected.
+//
+// The history is walked by generation, as given by the commit-graph, and by
+// committer time for the commits which are not in the commit-graph, until
+// the common ancestors are found.
+func MergeBase(one CommitNode, twos ...CommitNode) ([]CommitNode, error) {
+	for _, two := range twos {
+		if two.ID() == one.ID() {
+			return []CommitNode{one}, nil
+		}
+	}
+
+	bases, err := paintDownToCommon(one, twos)
+	if err != nil || len(bases) < 2 {
+		return bases, err
+	}
+
+	return Independents(bases)
+}
+
+// OctopusMergeBase returns the best common ancestors of all the given
+// commits, as `git merge-base --octopus --all commits...` does.
+func OctopusMergeBase(commits ...CommitNode) ([]CommitNode, error) {
+	if len(commits) == 0 {
+		return nil, nil
+	}
+
+	// The merge bases of each commit with the ones of the commits before it
+	// are found, and the ones reachable from the others are then removed.
+	bases := commits[:1]
+	for _, c := range commits[1:] {
+		var next []CommitNode
+		for _, base := range bases {
+			found, err := MergeBase(c, base)
+			if err != nil {
+				return nil, err
+			}
+
+			next = append(next, found...)
+		}
+
+		bases = next
+	}
+
+	return Independents(bases)
+}
+
+// IsAncestor returns whether ancestor can be reached from commit, as `git
+// merge-base --is-ancestor ancestor commit` does. A commit is an ancestor of
+// itself.
+//
+// The commits whose generation is lower than the one of ancestor are not
+// walked, as ancestor can't be reached from them.
+func IsAncestor(ancestor, commit CommitNode) (bool, error) {
+	generation := ancestor.Generation()
+	seen := map[plumbing.Hash]bool{commit.ID(): true}
+	queue := []CommitNode{commit}
+	for len(queue) > 0 {
+		c := queue[len(queue)-1]
+		queue = queue[:len(queue)-1]
+		if c.ID() == ancestor.ID() {
+			return true, nil
+		}
+
+		if c.Generation() < generation {
+			continue
+		}
+
+		for i, h := range c.ParentHashes() {
+			if seen[h] {
+				continue
+			}
+
+			seen[h] = true
+			p, err := c.ParentNode(i)
+			if err != nil {
+				return false, err
+			}
+
+			queue = append(queue, p)
+		}
+	}
+
+	return false, nil
+}
+
+// Independents returns the commits which can't be reached from the others,
+// as `git merge-base --independent commits...` does, newest first.
+func Independents(commits []CommitNode) ([]CommitNode, error) {
+	var res []CommitNode
+	seen := make(map[plumbing.Hash]bool)
+	for _, c := range commits {
+		if seen[c.ID()] {
+			continue
+		}
+
+		seen[c.ID()] = true
+		res = append(res, c)
+	}
+
+	redundant := make([]bool, len(res))
+	for i, c := range res {
+		for j, other := range res {
+			if i == j || redundant[j] {
+				continue
+			}
+
+			ok, err := IsAncestor(c, other)
+			if err != nil {
+				return nil, err
+			}
+
+			if ok {
+				redundant[i] = true
+				break
+			}
+		}
+	}
+
+	independents := res[:0]
+	for i, c := range res {
+		if !redundant[i] {
+			independents = append(independents, c)
+		}
+	}
+
+	sortByCommitTimeDesc(independents)
+	return independents, nil
+}
+
+// paintDownToCommon walks the history of one and twos, newest first, painting
+// the commits with the sides they are reached from, and returns the common
+// ancestors which are not reached from other common ancestors on the way.
+// The walk ends when only the history of those ancestors, painted as stale,
+// is left.
+func paintDownToCommon(one CommitNode, twos []CommitNode) ([]CommitNode, error) {
+	flags := make(map[plumbing.Hash]uint8)
+	queue := binaryheap.NewWith(func(a, b any) int {
+		return generationAndDateOrderComparator(a.(*queuedNode).node, b.(*queuedNode).node)
+	})
+
+	nonStale := 0
+	push := func(n CommitNode, f uint8) {
+		flags[n.ID()] |= f
+		counted := flags[n.ID()]&paintedStale == 0
+		if counted {
+			nonStale++
+		}
+
+		queue.Push(&queuedNode{node: n, counted: counted})
+	}
+
+	push(one, paintedOne)
+	for _, two := range twos {
+		push(two, paintedTwo)
+	}
+
+	var bases []CommitNode
+	for nonStale > 0 {
+		v, _ := queue.Pop()
+		q := v.(*queuedNode)
+		if q.counted {
+			nonStale--
+		}
+
+		c := q.node
+		f := flags[c.ID()] & (paintedOne | paintedTwo | paintedStale)
+		if f == paintedOne|paintedTwo {
+			if flags[c.ID()]&paintedResult == 0 {
+				flags[c.ID()] |= paintedResult
+				bases = append(bases, c)
+			}
+
+			// The ancestors of a common ancestor are common ancestors too,
+			// which are not the best ones.
+			f |= paintedStale
+		}
+
+		for i, h := range c.ParentHashes() {
+			if flags[h]&f == f {
+				continue
+			}
+
+			p, err := c.ParentNode(i)
+			if err != nil {
+				return nil, err
+			}
+
+			push(p, f)
+		}
+	}
+
+	var res []CommitNode
+	for _, c := range bases {
+		if flags[c.ID()]&paintedStale == 0 {
+			res = append(res, c)
+		}
+	}
+
+	sortByCommitTimeDesc(res)
+	return res, nil
+}
+
+func sortByCommitTimeDesc(nodes []CommitNode) {
+	sort.SliceStable(nodes, func(i, j int) bool {
+		return nodes[i].CommitTime().After(nodes[j].CommitTime())
+	})
+}
@@ -0,0 +1,213 @@
+package commitgraph
+
+import (
+	"testing"
+
+	fixtures "github.com/go-git/go-git-fixtures/v5"
+	"github.com/stretchr/testify/suite"
+
+	"github.com/go-git/go-git/v6/plumbing"
+	"github.com/go-git/go-git/v6/plumbing/cache"
+	commitgraph "github.com/go-git/go-git/v6/plumbing/format/commitgraph"
+	"github.com/go-git/go-git/v6/plumbing/object"
+	"github.com/go-git/go-git/v6/storage/filesystem"
+)
+
+// The history of the merge-base fixture, as described in the tests of
+// object.Commit.MergeBase:
+//
+//	V---o---M----AB----A---CD1--P---C--------S-------------------Q < master
+//	               \         \ /            /                   /
+//	                \         X            GQ1---G < feature   /
+//	                 \       / \          /     /             /
+//	W---o---N----o----B---CD2---o---D----o----GQ2------------o < dev
+var mergeBaseRevs = map[string]plumbing.Hash{
+	"dev":  plumbing.NewHash("25ca6c810c08482d61113fbcaaada38bb59093a8"),
+	"M":    plumbing.NewHash("bb355b64e18386dbc3af63dfd09c015c44cbd9b6"),
+	"N":    plumbing.NewHash("d64b894762ab5f09e2b155221b90c18bd0637236"),
+	"A":    plumbing.NewHash("29740cfaf0c2ee4bb532dba9e80040ca738f367c"),
+	"B":    plumbing.NewHash("2c84807970299ba98951c65fe81ebbaac01030f0"),
+	"AB":   plumbing.NewHash("31a7e081a28f149ee98ffd13ba1a6d841a5f46fd"),
+	"P":    plumbing.NewHash("ff84393134864cf9d3a9853a81bde81778bd5805"),
+	"C":    plumbing.NewHash("8b72fabdc4222c3ff965bc310ded788c601c50ed"),
+	"D":    plumbing.NewHash("14777cf3e209334592fbfd0b878f6868394db836"),
+	"CD1":  plumbing.NewHash("4709e13a3cbb300c2b8a917effda776e1b8955c7"),
+	"CD2":  plumbing.NewHash("38468e274e91e50ffb637b88a1954ab6193fe974"),
+	"S":    plumbing.NewHash("628f1a42b70380ed05734bf01b468b46206ef1ea"),
+	"G":    plumbing.NewHash("d1b0093698e398d596ef94d646c4db37e8d1e970"),
+	"Q":    plumbing.NewHash("dce0e0c20d701c3d260146e443d6b3b079505191"),
+	"GQ1":  plumbing.NewHash("ccaaa99c21dad7e9f392c36ae8cb72dc63bed458"),
+	"GQ2":  plumbing.NewHash("806824d4778e94fe7c3244e92a9cd07090c9ab54"),
+	"A^^":  plumbing.NewHash("bb355b64e18386dbc3af63dfd09c015c44cbd9b6"),
+	"A^^^": plumbing.NewHash("8d08dd1388b82dd354cb43918d83da86c76b0978"),
+}
+
+type MergeBaseSuite struct {
+	suite.Suite
+	indexes map[string]CommitNodeIndex
+}
+
+func TestMergeBaseSuite(t *testing.T) {
+	suite.Run(t, new(MergeBaseSuite))
+}
+
+func (s *MergeBaseSuite) SetupSuite() {
+	f := fixtures.ByTag("merge-base").One()
+	storer := filesystem.NewStorage(f.DotGit(), cache.NewObjectLRUDefault())
+
+	// The commit-graphs are built in memory, with all the commits, and
+	// without the tips of master and dev, so that the walks go through
+	// commits both in and out of the commit-graph.
+	full := commitgraph.NewMemoryIndex()
+	partial := commitgraph.NewMemoryIndex()
+	generations := make(map[plumbing.Hash]uint64)
+	var generation func(c *object.Commit) uint64
+	generation = func(c *object.Commit) uint64 {
+		if g, ok := generations[c.Hash]; ok {
+			return g
+		}
+
+		var g uint64
+		_ = c.Parents().ForEach(func(p *object.Commit) error {
+			g = max(g, generation(p))
+			return nil
+		})
+
+		g++
+		generations[c.Hash] = g
+		data := &commitgraph.CommitData{
+			TreeHash:     c.TreeHash,
+			ParentHashes: c.ParentHashes,
+			Generation:   g,
+			When:         c.Committer.When,
+		}
+
+		full.Add(c.Hash, data)
+		if c.Hash != mergeBaseRevs["Q"] && c.Hash != mergeBaseRevs["dev"] {
+			partialData := *data
+			partial.Add(c.Hash, &partialData)
+		}
+
+		return g
+	}
+
+	for _, rev := range []string{"Q", "G", "dev"} {
+		c, err := object.GetCommit(storer, mergeBaseRevs[rev])
+		s.Require().NoError(err)
+		generation(c)
+	}
+
+	s.indexes = map[string]CommitNodeIndex{
+		"object":  NewObjectCommitNodeIndex(storer),
+		"graph":   NewGraphCommitNodeIndex(full, storer),
+		"partial": NewGraphCommitNodeIndex(partial, storer),
+	}
+}
+
+func (s *MergeBaseSuite) nodes(idx CommitNodeIndex, revs ...string) []CommitNode {
+	nodes := make([]CommitNode, 0, len(revs))
+	for _, rev := range revs {
+		n, err := idx.Get(mergeBaseRevs[rev])
+		s.Require().NoError(err)
+		nodes = append(nodes, n)
+	}
+
+	return nodes
+}
+
+func (s *MergeBaseSuite) assertNodes(expected []string, nodes []CommitNode, msgAndArgs ...any) {
+	var hashes, expectedHashes []string
+	for _, n := range nodes {
+		hashes = append(hashes, n.ID().String())
+	}
+
+	for _, rev := range expected {
+		expectedHashes = append(expectedHashes, mergeBaseRevs[rev].String())
+	}
+
+	s.ElementsMatch(expectedHashes, hashes, msgAndArgs...)
+}
+
+func (s *MergeBaseSuite) TestMergeBase() {
+	for _, tc := range []struct {
+		revs     []string
+		expected []string
+	}{
+		{[]string{"M", "N"}, nil},
+		{[]string{"A", "B"}, []string{"AB"}},
+		{[]string{"A", "A"}, []string{"A"}},
+		{[]string{"Q", "N"}, []string{"N"}},
+		{[]string{"N", "Q"}, []string{"N"}},
+		{[]string{"C", "D"}, []string{"CD1", "CD2"}},
+		{[]string{"G", "Q"}, []string{"GQ1", "GQ2"}},
+		{[]string{"G", "P", "dev"}, []string{"GQ2"}},
+	} {
+		for name, idx := range s.indexes {
+			nodes := s.nodes(idx, tc.revs...)
+			bases, err := MergeBase(nodes[0], nodes[1:]...)
+			s.NoError(err)
+			s.assertNodes(tc.expected, bases, "%s %v", name, tc.revs)
+		}
+	}
+}
+
+func (s *MergeBaseSuite) TestOctopusMergeBase() {
+	for _, tc := range []struct {
+		revs     []string
+		expected []string
+	}{
+		{[]string{"A"}, []string{"A"}},
+		{[]string{"C", "D", "G"}, []string{"CD1", "CD2"}},
+		{[]string{"G", "Q", "dev"}, []string{"GQ2"}},
+		{[]string{"A", "B", "N"}, nil},
+	} {
+		for name, idx := range s.indexes {
+			bases, err := OctopusMergeBase(s.nodes(idx, tc.revs...)...)
+			s.NoError(err)
+			s.assertNodes(tc.expected, bases, "%s %v", name, tc.revs)
+		}
+	}
+}
+
+func (s *MergeBaseSuite) TestIsAncestor() {
+	for _, tc := range []struct {
+		revs     []string
+		expected bool
+	}{
+		{[]string{"A^^", "A"}, true},
+		{[]string{"M", "G"}, true},
+		{[]string{"A", "A"}, true},
+		{[]string{"A", "A^^"}, false},
+		{[]string{"M", "N"}, false},
+		{[]string{"G", "Q"}, false},
+		{[]string{"GQ2", "Q"}, true},
+	} {
+		for name, idx := range s.indexes {
+			nodes := s.nodes(idx, tc.revs...)
+			ok, err := IsAncestor(nodes[0], nodes[1])
+			s.NoError(err)
+			s.Equal(tc.expected, ok, "%s %v", name, tc.revs)
+		}
+	}
+}
+
+func (s *MergeBaseSuite) TestIndependents() {
+	for _, tc := range []struct {
+		revs     []string
+		expected []string
+	}{
+		{[]string{"A"}, []string{"A"}},
+		{[]string{"A", "A", "A"}, []string{"A"}},
+		{[]string{"A", "A", "M", "M", "N"}, []string{"A", "N"}},
+		{[]string{"S", "G", "P"}, []string{"S", "G"}},
+		{[]string{"CD1", "CD2", "M", "N"}, []string{"CD1", "CD2"}},
+		{[]string{"C", "D", "M", "N"}, []string{"C", "D"}},
+		{[]string{"A^^^", "A^^", "A", "N"}, []string{"A", "N"}},
+	} {
+		for name, idx := range s.indexes {
+			independents, err := Independents(s.nodes(idx, tc.revs...))
+			s.NoError(err)
+			s.assertNodes(tc.expected, independents, "%s %v", name, tc.revs)
+		}
+	}
+}
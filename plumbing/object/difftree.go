@@ -43,6 +43,11 @@ type DiffTreeOptions struct {
 	// OnlyExactRenames performs only detection of exact renames and will not perform
 	// any detection of renames based on file similarity.
 	OnlyExactRenames bool
+	// DetectCopies is whether the added files are compared with the files
+	// modified or renamed, to detect copies, as `git diff -C` does. It only
+	// applies if DetectRenames is set, and uses the same RenameScore and
+	// RenameLimit.
+	DetectCopies bool
 }
 
 // DefaultDiffTreeOptions are the default and recommended options for the
@@ -377,3 +377,100 @@ func (s *DiffTreeSuite) TestIssue279() {
 	}
 	s.NotEqual(bb.Hash(), b.Hash())
 }
+
+func (s *DiffTreeSuite) TestDiffTreeSkipsSameSubtrees() {
+	sto := memory.NewStorage()
+
+	// The subtree is missing from the storage: it is never read, as it is
+	// the same in both trees.
+	subtree := plumbing.NewHash("aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa")
+	tree := func(blob string) *Tree {
+		t := &Tree{Entries: []TreeEntry{
+			{Name: "file", Mode: filemode.Regular, Hash: plumbing.NewHash(blob)},
+			{Name: "sub", Mode: filemode.Dir, Hash: subtree},
+		}}
+
+		o := sto.NewEncodedObject()
+		s.Require().NoError(t.Encode(o))
+		h, err := sto.SetEncodedObject(o)
+		s.Require().NoError(err)
+
+		t, err = GetTree(sto, h)
+		s.Require().NoError(err)
+		return t
+	}
+
+	from := tree("bbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbb")
+	to := tree("cccccccccccccccccccccccccccccccccccccccc")
+
+	changes, err := DiffTree(from, to)
+	s.Require().NoError(err)
+	s.Require().Len(changes, 1)
+	s.Equal("file", changes[0].From.Name)
+	s.Equal("file", changes[0].To.Name)
+}
+
+func BenchmarkDiffTree(b *testing.B) {
+	f := fixtures.ByURL("https://github.com/src-d/go-git.git").ByTag("packfile").One()
+	sto := memory.NewStorage()
+	if err := packfile.UpdateObjectStorage(sto, f.Packfile()); err != nil {
+		b.Fatal(err)
+	}
+
+	// Find two commits of the history differing by a single file.
+	var from, to *Tree
+	commit, err := GetCommit(sto, plumbing.NewHash(f.Head))
+	if err != nil {
+		b.Fatal(err)
+	}
+
+	for from == nil {
+		parent, err := commit.Parent(0)
+		if err != nil {
+			b.Fatal(err)
+		}
+
+		if to, err = commit.Tree(); err != nil {
+			b.Fatal(err)
+		}
+
+		candidate, err := parent.Tree()
+		if err != nil {
+			b.Fatal(err)
+		}
+
+		changes, err := DiffTree(candidate, to)
+		if err != nil {
+			b.Fatal(err)
+		}
+
+		if len(changes) == 1 {
+			from = candidate
+		}
+
+		commit = parent
+	}
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		// The trees are decoded again, as their subtrees are cached.
+		a, err := GetTree(sto, from.Hash)
+		if err != nil {
+			b.Fatal(err)
+		}
+
+		c, err := GetTree(sto, to.Hash)
+		if err != nil {
+			b.Fatal(err)
+		}
+
+		changes, err := DiffTree(a, c)
+		if err != nil {
+			b.Fatal(err)
+		}
+
+		if len(changes) != 1 {
+			b.Fatalf("unexpected changes: %v", changes)
+		}
+	}
+}
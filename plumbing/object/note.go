@@ -0,0 +1,299 @@
+package object
+
+import (
+	"errors"
+	"io"
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/go-git/go-git/v6/plumbing"
+	"github.com/go-git/go-git/v6/plumbing/filemode"
+	"github.com/go-git/go-git/v6/plumbing/storer"
+	"github.com/go-git/go-git/v6/utils/ioutil"
+)
+
+// ErrNoteNotFound is returned when an object has no note.
+var ErrNoteNotFound = errors.New("note not found")
+
+// notesFanoutThreshold is the number of notes above which the notes of a
+// directory of a notes tree are fanned out in subdirectories.
+const notesFanoutThreshold = 256
+
+// Note is the note of an object, as stored in a notes tree.
+type Note struct {
+	// Target is the hash of the annotated object.
+	Target plumbing.Hash
+	// Hash is the hash of the blob holding the note.
+	Hash plumbing.Hash
+
+	s storer.EncodedObjectStorer
+}
+
+// Blob returns the blob holding the note.
+func (n *Note) Blob() (*Blob, error) {
+	return GetBlob(n.s, n.Hash)
+}
+
+// Message returns the content of the note.
+func (n *Note) Message() (msg string, err error) {
+	b, err := n.Blob()
+	if err != nil {
+		return "", err
+	}
+
+	r, err := b.Reader()
+	if err != nil {
+		return "", err
+	}
+
+	defer ioutil.CheckClose(r, &err)
+
+	content, err := io.ReadAll(r)
+	return string(content), err
+}
+
+// NotesTree is the tree of a notes reference, such as refs/notes/commits,
+// mapping objects to their notes. As in git, the note of an object is the
+// blob named after its hash, and the notes are fanned out in directories
+// named after the leading bytes of the hashes when they are numerous, such
+// as ab/cd/ef0123... All the fanouts are read, the ones of git included, and
+// a directory is fanned out when written if it holds more than 256 notes.
+//
+// The entries of the tree which are not notes are kept as is.
+type NotesTree struct {
+	s     storer.EncodedObjectStorer
+	notes map[plumbing.Hash]plumbing.Hash
+	other map[string]TreeEntry
+}
+
+// NewNotesTree returns the notes of the given tree, which is nil for a notes
+// reference without notes yet.
+func NewNotesTree(s storer.EncodedObjectStorer, t *Tree) (*NotesTree, error) {
+	n := &NotesTree{
+		s:     s,
+		notes: make(map[plumbing.Hash]plumbing.Hash),
+		other: make(map[string]TreeEntry),
+	}
+
+	if t == nil {
+		return n, nil
+	}
+
+	return n, n.read(t, "", "")
+}
+
+// read reads the notes of t, the directory at dir whose hash prefix is
+// prefix, the concatenation of the names of the fanout directories.
+func (n *NotesTree) read(t *Tree, dir, prefix string) error {
+	for _, e := range t.Entries {
+		name := path.Join(dir, e.Name)
+		hex := prefix + e.Name
+
+		if e.Mode == filemode.Dir && len(e.Name) == 2 && isLowerHex(e.Name) {
+			sub, err := GetTree(n.s, e.Hash)
+			if err != nil {
+				return err
+			}
+
+			if err := n.read(sub, name, hex); err != nil {
+				return err
+			}
+
+			continue
+		}
+
+		if target, ok := plumbing.FromHex(hex); ok && e.Mode.IsFile() {
+			n.notes[target] = e.Hash
+			continue
+		}
+
+		n.other[name] = e
+	}
+
+	return nil
+}
+
+// isLowerHex returns whether s is made of lowercase hexadecimal characters.
+func isLowerHex(s string) bool {
+	for _, c := range s {
+		if (c < '0' || c > '9') && (c < 'a' || c > 'f') {
+			return false
+		}
+	}
+
+	return true
+}
+
+// Len returns the number of notes.
+func (n *NotesTree) Len() int {
+	return len(n.notes)
+}
+
+// Get returns the note of the given object, or ErrNoteNotFound.
+func (n *NotesTree) Get(target plumbing.Hash) (*Note, error) {
+	h, ok := n.notes[target]
+	if !ok {
+		return nil, ErrNoteNotFound
+	}
+
+	return &Note{Target: target, Hash: h, s: n.s}, nil
+}
+
+// Set stores the given message in a blob, and makes it the note of the given
+// object, replacing its existing note. The message is stored as is.
+func (n *NotesTree) Set(target plumbing.Hash, message string) error {
+	o := n.s.NewEncodedObject()
+	o.SetType(plumbing.BlobObject)
+	w, err := o.Writer()
+	if err != nil {
+		return err
+	}
+
+	if _, err := io.WriteString(w, message); err != nil {
+		_ = w.Close()
+		return err
+	}
+
+	if err := w.Close(); err != nil {
+		return err
+	}
+
+	h, err := n.s.SetEncodedObject(o)
+	if err != nil {
+		return err
+	}
+
+	n.notes[target] = h
+	return nil
+}
+
+// Remove removes the note of the given object, or returns ErrNoteNotFound.
+func (n *NotesTree) Remove(target plumbing.Hash) error {
+	if _, ok := n.notes[target]; !ok {
+		return ErrNoteNotFound
+	}
+
+	delete(n.notes, target)
+	return nil
+}
+
+// ForEach calls cb for each note, sorted by the hash of the annotated object.
+// The iteration stops if cb returns an error, which is returned, unless it is
+// storer.ErrStop.
+func (n *NotesTree) ForEach(cb func(*Note) error) error {
+	targets := n.targets()
+	for _, target := range targets {
+		err := cb(&Note{Target: target, Hash: n.notes[target], s: n.s})
+		if errors.Is(err, storer.ErrStop) {
+			return nil
+		}
+
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (n *NotesTree) targets() []plumbing.Hash {
+	targets := make([]plumbing.Hash, 0, len(n.notes))
+	for target := range n.notes {
+		targets = append(targets, target)
+	}
+
+	plumbing.HashesSort(targets)
+	return targets
+}
+
+// WriteTree stores the tree objects of the notes, fanned out as needed, and
+// returns the hash of the root tree.
+func (n *NotesTree) WriteTree() (plumbing.Hash, error) {
+	root := &notesDir{}
+	n.fanout(root, "", n.targets())
+	for name, e := range n.other {
+		root.add(strings.Split(name, "/"), e)
+	}
+
+	return root.write(n.s)
+}
+
+// fanout adds the notes of the given sorted objects to dir, whose hash
+// prefix is prefix, in subdirectories if they are too many.
+func (n *NotesTree) fanout(dir *notesDir, prefix string, targets []plumbing.Hash) {
+	if len(targets) <= notesFanoutThreshold || len(prefix)+2 >= targets[0].HexSize() {
+		for _, target := range targets {
+			name := strings.TrimPrefix(target.String(), prefix)
+			dir.add([]string{name}, TreeEntry{Name: name, Mode: filemode.Regular, Hash: n.notes[target]})
+		}
+
+		return
+	}
+
+	for len(targets) > 0 {
+		sub := hexByte(targets[0], len(prefix))
+		i := sort.Search(len(targets), func(i int) bool {
+			return hexByte(targets[i], len(prefix)) != sub
+		})
+
+		n.fanout(dir.dir(sub), prefix+sub, targets[:i])
+		targets = targets[i:]
+	}
+}
+
+// hexByte returns the two hexadecimal characters of the hash h at offset i.
+func hexByte(h plumbing.Hash, i int) string {
+	return h.String()[i : i+2]
+}
+
+// notesDir is a directory of a notes tree being written.
+type notesDir struct {
+	entries []TreeEntry
+	dirs    map[string]*notesDir
+}
+
+func (d *notesDir) dir(name string) *notesDir {
+	if d.dirs == nil {
+		d.dirs = make(map[string]*notesDir)
+	}
+
+	sub, ok := d.dirs[name]
+	if !ok {
+		sub = &notesDir{}
+		d.dirs[name] = sub
+	}
+
+	return sub
+}
+
+func (d *notesDir) add(parts []string, e TreeEntry) {
+	if len(parts) > 1 {
+		d.dir(parts[0]).add(parts[1:], e)
+		return
+	}
+
+	e.Name = parts[0]
+	d.entries = append(d.entries, e)
+}
+
+func (d *notesDir) write(s storer.EncodedObjectStorer) (plumbing.Hash, error) {
+	t := &Tree{Entries: d.entries}
+	for name, sub := range d.dirs {
+		h, err := sub.write(s)
+		if err != nil {
+			return plumbing.ZeroHash, err
+		}
+
+		t.Entries = append(t.Entries, TreeEntry{Name: name, Mode: filemode.Dir, Hash: h})
+	}
+
+	sort.Sort(TreeEntrySorter(t.Entries))
+
+	o := s.NewEncodedObject()
+	if err := t.Encode(o); err != nil {
+		return plumbing.ZeroHash, err
+	}
+
+	return s.SetEncodedObject(o)
+}
@@ -0,0 +1,177 @@
+package object
+
+import (
+	"crypto/sha1"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/go-git/go-git/v6/plumbing"
+	"github.com/go-git/go-git/v6/plumbing/filemode"
+	"github.com/go-git/go-git/v6/plumbing/storer"
+	"github.com/go-git/go-git/v6/storage/memory"
+)
+
+func noteTarget(i int) plumbing.Hash {
+	return plumbing.NewHash(fmt.Sprintf("%x", sha1.Sum([]byte(fmt.Sprint(i)))))
+}
+
+func TestNotesTree(t *testing.T) {
+	t.Parallel()
+
+	s := memory.NewStorage()
+	n, err := NewNotesTree(s, nil)
+	require.NoError(t, err)
+
+	target := noteTarget(0)
+	_, err = n.Get(target)
+	require.ErrorIs(t, err, ErrNoteNotFound)
+
+	require.NoError(t, n.Set(target, "foo\n"))
+	require.NoError(t, n.Set(target, "bar\n"))
+	require.NoError(t, n.Set(noteTarget(1), "baz\n"))
+	assert.Equal(t, 2, n.Len())
+
+	h, err := n.WriteTree()
+	require.NoError(t, err)
+	tree, err := GetTree(s, h)
+	require.NoError(t, err)
+
+	// Without fanout, the notes are named after the objects.
+	f, err := tree.File(target.String())
+	require.NoError(t, err)
+	content, err := f.Contents()
+	require.NoError(t, err)
+	assert.Equal(t, "bar\n", content)
+
+	read, err := NewNotesTree(s, tree)
+	require.NoError(t, err)
+	note, err := read.Get(target)
+	require.NoError(t, err)
+	msg, err := note.Message()
+	require.NoError(t, err)
+	assert.Equal(t, "bar\n", msg)
+
+	var targets []plumbing.Hash
+	require.NoError(t, read.ForEach(func(note *Note) error {
+		targets = append(targets, note.Target)
+		return storer.ErrStop
+	}))
+	assert.Len(t, targets, 1)
+
+	require.NoError(t, read.Remove(target))
+	assert.ErrorIs(t, read.Remove(target), ErrNoteNotFound)
+	assert.Equal(t, 1, read.Len())
+}
+
+func TestNotesTreeFanout(t *testing.T) {
+	t.Parallel()
+
+	s := memory.NewStorage()
+	n, err := NewNotesTree(s, nil)
+	require.NoError(t, err)
+
+	const count = 1000
+	for i := 0; i < count; i++ {
+		require.NoError(t, n.Set(noteTarget(i), fmt.Sprintln(i)))
+	}
+
+	h, err := n.WriteTree()
+	require.NoError(t, err)
+	tree, err := GetTree(s, h)
+	require.NoError(t, err)
+
+	// With more than 256 notes, the notes are fanned out once, the
+	// directories holding about 4 notes each.
+	target := noteTarget(42).String()
+	_, err = tree.File(target[:2] + "/" + target[2:])
+	require.NoError(t, err)
+	for _, e := range tree.Entries {
+		assert.Equal(t, filemode.Dir, e.Mode)
+		assert.Len(t, e.Name, 2)
+	}
+
+	read, err := NewNotesTree(s, tree)
+	require.NoError(t, err)
+	assert.Equal(t, count, read.Len())
+
+	var prev plumbing.Hash
+	require.NoError(t, read.ForEach(func(note *Note) error {
+		assert.Less(t, prev.Compare(note.Target.Bytes()), 0)
+		prev = note.Target
+		return nil
+	}))
+
+	note, err := read.Get(noteTarget(42))
+	require.NoError(t, err)
+	msg, err := note.Message()
+	require.NoError(t, err)
+	assert.Equal(t, "42\n", msg)
+
+	// Once the notes are few again, they are not fanned out anymore.
+	for i := 1; i < count; i++ {
+		require.NoError(t, read.Remove(noteTarget(i)))
+	}
+
+	h, err = read.WriteTree()
+	require.NoError(t, err)
+	tree, err = GetTree(s, h)
+	require.NoError(t, err)
+	require.Len(t, tree.Entries, 1)
+	assert.Equal(t, noteTarget(0).String(), tree.Entries[0].Name)
+}
+
+func TestNotesTreeNestedFanout(t *testing.T) {
+	t.Parallel()
+
+	s := memory.NewStorage()
+	blob := &plumbing.MemoryObject{}
+	blob.SetType(plumbing.BlobObject)
+	_, err := blob.Write([]byte("foo\n"))
+	require.NoError(t, err)
+	bh, err := s.SetEncodedObject(blob)
+	require.NoError(t, err)
+
+	writeTree := func(entries ...TreeEntry) plumbing.Hash {
+		o := s.NewEncodedObject()
+		require.NoError(t, (&Tree{Entries: entries}).Encode(o))
+		h, err := s.SetEncodedObject(o)
+		require.NoError(t, err)
+		return h
+	}
+
+	// A note fanned out twice, as written by git for large notes trees,
+	// along with entries which are not notes.
+	target := noteTarget(0).String()
+	cd := writeTree(TreeEntry{Name: target[4:], Mode: filemode.Regular, Hash: bh})
+	ab := writeTree(TreeEntry{Name: target[2:4], Mode: filemode.Dir, Hash: cd})
+	root := writeTree(
+		TreeEntry{Name: "README", Mode: filemode.Regular, Hash: bh},
+		TreeEntry{Name: target[:2], Mode: filemode.Dir, Hash: ab},
+	)
+
+	tree, err := GetTree(s, root)
+	require.NoError(t, err)
+	n, err := NewNotesTree(s, tree)
+	require.NoError(t, err)
+	assert.Equal(t, 1, n.Len())
+
+	note, err := n.Get(noteTarget(0))
+	require.NoError(t, err)
+	assert.Equal(t, bh, note.Hash)
+
+	// The notes are written without fanout, the other entries kept.
+	require.NoError(t, n.Set(noteTarget(1), "bar\n"))
+	h, err := n.WriteTree()
+	require.NoError(t, err)
+	tree, err = GetTree(s, h)
+	require.NoError(t, err)
+
+	var names []string
+	for _, e := range tree.Entries {
+		names = append(names, e.Name)
+	}
+	assert.ElementsMatch(t, []string{"README", target, noteTarget(1).String()}, names)
+}
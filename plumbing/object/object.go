@@ -57,6 +57,24 @@ func GetObject(s storer.EncodedObjectStorer, h plumbing.Hash) (Object, error) {
 	return DecodeObject(s, o)
 }
 
+// PeelToCommit returns the commit obj points to, following the tags. An error
+// wrapping plumbing.ErrInvalidType is returned if it is not a commit.
+func PeelToCommit(obj Object) (*Commit, error) {
+	for {
+		switch o := obj.(type) {
+		case *Commit:
+			return o, nil
+		case *Tag:
+			var err error
+			if obj, err = o.Object(); err != nil {
+				return nil, err
+			}
+		default:
+			return nil, fmt.Errorf("%w: %s is a %s, not a commit", plumbing.ErrInvalidType, obj.ID(), obj.Type())
+		}
+	}
+}
+
 // DecodeObject decodes an encoded object into an Object and associates it to
 // the given object storer.
 func DecodeObject(s storer.EncodedObjectStorer, o plumbing.EncodedObject) (Object, error) {
@@ -139,26 +157,56 @@ func (s *Signature) decodeTimeAndTimeZone(b []byte) {
 	}
 
 	timezone := string(b[tzStart : tzStart+timeZoneLength])
-	tzhours, err1 := strconv.ParseInt(timezone[0:3], 10, 64)
-	tzmins, err2 := strconv.ParseInt(timezone[3:], 10, 64)
-	if err1 != nil || err2 != nil {
+	offset, ok := parseTimeZone(timezone)
+	if !ok {
 		return
 	}
-	if tzhours < 0 {
-		tzmins *= -1
-	}
 
-	tz := time.FixedZone("", int(tzhours*60*60+tzmins*60))
+	// The time zones which are not the format of their offset, such as
+	// -0000 or +0090, are kept as the name of the location, for the
+	// signature to be encoded as it was written.
+	name := ""
+	if s.When.In(time.FixedZone("", offset)).Format("-0700") != timezone {
+		name = timezone
+	}
 
-	s.When = s.When.In(tz)
+	s.When = s.When.In(time.FixedZone(name, offset))
 }
 
 func (s *Signature) encodeTimeAndTimeZone(w io.Writer) error {
 	u := max(s.When.Unix(), 0)
-	_, err := fmt.Fprintf(w, "%d %s", u, s.When.Format("-0700"))
+	timezone := s.When.Format("-0700")
+	if name, offset := s.When.Zone(); name != timezone {
+		if o, ok := parseTimeZone(name); ok && o == offset {
+			timezone = name
+		}
+	}
+
+	_, err := fmt.Fprintf(w, "%d %s", u, timezone)
 	return err
 }
 
+// parseTimeZone returns the offset in seconds of the time zone of a
+// signature, a sign followed by the hours and the minutes such as +0530.
+func parseTimeZone(tz string) (int, bool) {
+	if len(tz) != timeZoneLength || tz[0] != '+' && tz[0] != '-' {
+		return 0, false
+	}
+
+	hours, err1 := strconv.ParseUint(tz[1:3], 10, 64)
+	mins, err2 := strconv.ParseUint(tz[3:], 10, 64)
+	if err1 != nil || err2 != nil {
+		return 0, false
+	}
+
+	offset := int(hours*60*60 + mins*60)
+	if tz[0] == '-' {
+		offset = -offset
+	}
+
+	return offset, true
+}
+
 func (s *Signature) String() string {
 	return fmt.Sprintf("%s <%s>", s.Name, s.Email)
 }
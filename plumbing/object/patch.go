@@ -6,6 +6,7 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"slices"
 	"strconv"
 	"strings"
 
@@ -15,20 +16,56 @@ import (
 	"github.com/go-git/go-git/v6/plumbing/filemode"
 	fdiff "github.com/go-git/go-git/v6/plumbing/format/diff"
 	"github.com/go-git/go-git/v6/utils/diff"
+	"github.com/go-git/go-git/v6/utils/ioutil"
 )
 
 var ErrCanceled = errors.New("operation canceled")
 
+// DiffOptions are the options of the patches of PatchWithOptions, ignoring
+// the changes of whitespace as the options of the same name of git diff.
+type DiffOptions struct {
+	// IgnoreAllSpace ignores the whitespace when comparing the lines, as
+	// -w.
+	IgnoreAllSpace bool
+	// IgnoreSpaceChange ignores the whitespace at the end of the lines and
+	// the changes in the amount of whitespace when comparing the lines, as
+	// -b.
+	IgnoreSpaceChange bool
+	// IgnoreBlankLines ignores the changes whose lines are all blank, as
+	// --ignore-blank-lines: they are only encoded in the hunks of other
+	// changes.
+	IgnoreBlankLines bool
+}
+
+func (o *DiffOptions) ignoresSpace() bool {
+	return o.IgnoreAllSpace || o.IgnoreSpaceChange
+}
+
 func getPatch(message string, changes ...*Change) (*Patch, error) {
 	ctx := context.Background()
 	return getPatchContext(ctx, message, changes...)
 }
 
 func getPatchContext(ctx context.Context, message string, changes ...*Change) (*Patch, error) {
+	return getPatchWithOptions(ctx, message, &DiffOptions{}, changes...)
+}
+
+func getPatchWithOptions(ctx context.Context, message string, opts *DiffOptions, changes ...*Change) (*Patch, error) {
+	if opts == nil {
+		opts = &DiffOptions{}
+	}
+
 	if len(changes) == 0 {
 		return &Patch{message: message}, nil
 	}
 
+	// As git does, the files are sorted by path, the renames and copies by
+	// their new one.
+	changes = slices.Clone(changes)
+	slices.SortStableFunc(changes, func(a, b *Change) int {
+		return strings.Compare(changeName(a), changeName(b))
+	})
+
 	filePatches := make([]fdiff.FilePatch, 0, len(changes))
 	for _, c := range changes {
 		select {
@@ -37,18 +74,24 @@ func getPatchContext(ctx context.Context, message string, changes ...*Change) (*
 		default:
 		}
 
-		fp, err := filePatchWithContext(ctx, c)
+		fp, err := filePatchWithContext(ctx, c, opts)
 		if err != nil {
 			return nil, err
 		}
 
+		// As git does, the files only changed in the ignored ways are not
+		// in the patch.
+		if *opts != (DiffOptions{}) && ignoredFilePatch(fp) {
+			continue
+		}
+
 		filePatches = append(filePatches, fp)
 	}
 
 	return &Patch{message, filePatches}, nil
 }
 
-func filePatchWithContext(ctx context.Context, c *Change) (fdiff.FilePatch, error) {
+func filePatchWithContext(ctx context.Context, c *Change, opts *DiffOptions) (fdiff.FilePatch, error) {
 	from, to, err := c.Files()
 	if err != nil {
 		return nil, err
@@ -64,10 +107,21 @@ func filePatchWithContext(ctx context.Context, c *Change) (fdiff.FilePatch, erro
 	}
 
 	if fIsBinary || tIsBinary {
-		return &textFilePatch{from: c.From, to: c.To}, nil
+		return &textFilePatch{
+			from:       c.From,
+			to:         c.To,
+			kind:       c.Kind,
+			similarity: c.Similarity,
+			binary:     true,
+			fromFile:   from,
+			toFile:     to,
+		}, nil
 	}
 
-	diffs := diff.Do(fromContent, toContent)
+	diffs := diff.DoWithOptions(fromContent, toContent, diff.Options{
+		IgnoreAllSpace:    opts.IgnoreAllSpace,
+		IgnoreSpaceChange: opts.IgnoreSpaceChange,
+	})
 
 	chunks := make([]fdiff.Chunk, 0, len(diffs))
 	for _, d := range diffs {
@@ -87,16 +141,83 @@ func filePatchWithContext(ctx context.Context, c *Change) (fdiff.FilePatch, erro
 			op = fdiff.Add
 		}
 
-		chunks = append(chunks, &textChunk{d.Text, op})
+		chunks = append(chunks, &textChunk{content: d.Text, op: op})
+	}
+
+	if opts.IgnoreBlankLines {
+		markBlankChanges(chunks, opts.ignoresSpace())
 	}
 
 	return &textFilePatch{
-		chunks: chunks,
-		from:   c.From,
-		to:     c.To,
+		chunks:     chunks,
+		from:       c.From,
+		to:         c.To,
+		kind:       c.Kind,
+		similarity: c.Similarity,
 	}, nil
 }
 
+// markBlankChanges marks as ignorable the changes, the chunks between two
+// equal ones, whose lines are all blank, empty or only whitespace if
+// whitespace is ignored.
+func markBlankChanges(chunks []fdiff.Chunk, space bool) {
+	for start := 0; start < len(chunks); {
+		if chunks[start].Type() == fdiff.Equal {
+			start++
+			continue
+		}
+
+		end, blank := start, true
+		for ; end < len(chunks) && chunks[end].Type() != fdiff.Equal; end++ {
+			blank = blank && blankLines(chunks[end].Content(), space)
+		}
+
+		if blank {
+			for _, c := range chunks[start:end] {
+				c.(*textChunk).ignorable = true
+			}
+		}
+
+		start = end
+	}
+}
+
+func blankLines(s string, space bool) bool {
+	for _, line := range strings.SplitAfter(s, "\n") {
+		line = strings.TrimSuffix(line, "\n")
+		if space {
+			line = strings.TrimSpace(line)
+		}
+
+		if line != "" {
+			return false
+		}
+	}
+
+	return true
+}
+
+// ignoredFilePatch returns whether fp, a textual patch of a file neither
+// renamed nor changing mode, has only ignored changes.
+func ignoredFilePatch(fp fdiff.FilePatch) bool {
+	from, to := fp.Files()
+	if fp.IsBinary() || from == nil || to == nil || from.Path() != to.Path() || from.Mode() != to.Mode() {
+		return false
+	}
+
+	for _, c := range fp.Chunks() {
+		if c.Type() == fdiff.Equal {
+			continue
+		}
+
+		if ic, ok := c.(fdiff.IgnorableChunk); !ok || !ic.Ignorable() {
+			return false
+		}
+	}
+
+	return true
+}
+
 func fileContent(f *File) (content string, isBinary bool, err error) {
 	if f == nil {
 		return content, isBinary, err
@@ -126,12 +247,19 @@ func (p *Patch) Message() string {
 	return p.message
 }
 
+// Encode encodes the patch in the unified diff format of git, with
+// fdiff.DefaultContextLines lines of context. Use fdiff.NewUnifiedEncoder to
+// encode it with other options, like the number of context lines or binary
+// patches.
 func (p *Patch) Encode(w io.Writer) error {
 	ue := fdiff.NewUnifiedEncoder(w, fdiff.DefaultContextLines)
 
 	return ue.Encode(p)
 }
 
+// Stats returns the lines added and deleted of each file of the patch, as git
+// diff --stat, --numstat and --shortstat count them, from the patch without
+// encoding it.
 func (p *Patch) Stats() FileStats {
 	return getFileStatsFromFilePatches(p.FilePatches())
 }
@@ -175,10 +303,18 @@ func (f *changeEntryWrapper) Empty() bool {
 	return !f.ce.TreeEntry.Mode.IsFile()
 }
 
-// textFilePatch is an implementation of fdiff.FilePatch interface
+// textFilePatch is an implementation of fdiff.FilePatch,
+// fdiff.RenameFilePatch and fdiff.BinaryFilePatch interfaces
 type textFilePatch struct {
-	chunks   []fdiff.Chunk
-	from, to ChangeEntry
+	chunks     []fdiff.Chunk
+	from, to   ChangeEntry
+	kind       ChangeKind
+	similarity int
+
+	// binary is whether any of the files is binary, whose contents are
+	// read from fromFile and toFile.
+	binary           bool
+	fromFile, toFile *File
 }
 
 func (tf *textFilePatch) Files() (from, to fdiff.File) {
@@ -197,17 +333,52 @@ func (tf *textFilePatch) Files() (from, to fdiff.File) {
 }
 
 func (tf *textFilePatch) IsBinary() bool {
-	return len(tf.chunks) == 0
+	return tf.binary
+}
+
+func (tf *textFilePatch) BinaryContents() (from, to []byte, err error) {
+	if from, err = binaryContent(tf.fromFile); err != nil {
+		return nil, nil, err
+	}
+
+	to, err = binaryContent(tf.toFile)
+	return from, to, err
+}
+
+func binaryContent(f *File) (content []byte, err error) {
+	if f == nil {
+		return nil, nil
+	}
+
+	r, err := f.Reader()
+	if err != nil {
+		return nil, err
+	}
+
+	defer ioutil.CheckClose(r, &err)
+	return io.ReadAll(r)
 }
 
 func (tf *textFilePatch) Chunks() []fdiff.Chunk {
 	return tf.chunks
 }
 
-// textChunk is an implementation of fdiff.Chunk interface
+func (tf *textFilePatch) IsCopy() bool {
+	return tf.kind == Copied
+}
+
+func (tf *textFilePatch) Similarity() int {
+	return tf.similarity
+}
+
+// textChunk is an implementation of fdiff.Chunk and fdiff.IgnorableChunk
+// interfaces
 type textChunk struct {
 	content string
 	op      fdiff.Operation
+	// ignorable is whether the chunk is a change ignored by the options of
+	// the patch.
+	ignorable bool
 }
 
 func (t *textChunk) Content() string {
@@ -218,11 +389,20 @@ func (t *textChunk) Type() fdiff.Operation {
 	return t.op
 }
 
+func (t *textChunk) Ignorable() bool {
+	return t.ignorable
+}
+
 // FileStat stores the status of changes in content of a file.
 type FileStat struct {
 	Name     string
 	Addition int
 	Deletion int
+	// Binary is whether the file is binary, whose lines are not counted.
+	Binary bool
+
+	// fromSize and toSize are the sizes of the binary files.
+	fromSize, toSize int64
 }
 
 func (fs FileStat) String() string {
@@ -236,11 +416,77 @@ func (fileStats FileStats) String() string {
 	return printStat(fileStats)
 }
 
+// ShortStat returns the totals of the stats, as git diff --shortstat.
+func (fileStats FileStats) ShortStat() ShortStat {
+	s := ShortStat{Files: len(fileStats)}
+	for _, fs := range fileStats {
+		s.Additions += fs.Addition
+		s.Deletions += fs.Deletion
+	}
+
+	return s
+}
+
+// NumStat returns the stats in the format of git diff --numstat: the lines
+// added and deleted and the name of each file, separated by tabs, the lines
+// of the binary files being "-".
+func (fileStats FileStats) NumStat() string {
+	var result strings.Builder
+	for _, fs := range fileStats {
+		if fs.Binary {
+			fmt.Fprintf(&result, "-\t-\t%s\n", fs.Name)
+			continue
+		}
+
+		fmt.Fprintf(&result, "%d\t%d\t%s\n", fs.Addition, fs.Deletion, fs.Name)
+	}
+
+	return result.String()
+}
+
+// ShortStat is the number of files changed and the total of the lines added
+// and deleted of FileStats.
+type ShortStat struct {
+	Files     int
+	Additions int
+	Deletions int
+}
+
+// String returns the totals in the format of git diff --shortstat, such as
+// " 2 files changed, 3 insertions(+), 1 deletion(-)".
+func (s ShortStat) String() string {
+	if s.Files == 0 {
+		return " 0 files changed\n"
+	}
+
+	plural := func(n int, one, many string) string {
+		if n == 1 {
+			return one
+		}
+
+		return many
+	}
+
+	var result strings.Builder
+	fmt.Fprintf(&result, " %d %s changed", s.Files, plural(s.Files, "file", "files"))
+	if s.Additions != 0 || s.Deletions == 0 {
+		fmt.Fprintf(&result, ", %d %s(+)", s.Additions, plural(s.Additions, "insertion", "insertions"))
+	}
+
+	if s.Deletions != 0 || s.Additions == 0 {
+		fmt.Fprintf(&result, ", %d %s(-)", s.Deletions, plural(s.Deletions, "deletion", "deletions"))
+	}
+
+	result.WriteString("\n")
+	return result.String()
+}
+
 // printStat prints the stats of changes in content of files.
 // Original implementation: https://github.com/git/git/blob/1a87c842ece327d03d08096395969aca5e0a6996/diff.c#L2615
 // Parts of the output:
 // <pad><filename><pad>|<pad><changeNumber><pad><+++/---><newline>
 // example: " main.go | 10 +++++++--- "
+// The binary files are printed as " image.png | Bin 120 -> 140 bytes".
 func printStat(fileStats []FileStat) string {
 	maxGraphWidth := uint(53)
 	maxNameLen := 0
@@ -260,6 +506,10 @@ func printStat(fileStats []FileStat) string {
 		}
 
 		changes := strconv.Itoa(fs.Addition + fs.Deletion)
+		if fs.Binary {
+			changes = "Bin"
+		}
+
 		if len(changes) > maxChangeLen {
 			maxChangeLen = len(changes)
 		}
@@ -267,9 +517,20 @@ func printStat(fileStats []FileStat) string {
 
 	var result strings.Builder
 	for _, fs := range fileStats {
+		namePad := strings.Repeat(" ", maxNameLen-len(fs.Name))
+		if fs.Binary {
+			changePad := strings.Repeat(" ", maxChangeLen-len("Bin"))
+			fmt.Fprintf(&result, " %s%s | %sBin", fs.Name, namePad, changePad)
+			if fs.fromSize != 0 || fs.toSize != 0 {
+				fmt.Fprintf(&result, " %d -> %d bytes", fs.fromSize, fs.toSize)
+			}
+
+			result.WriteString("\n")
+			continue
+		}
+
 		add := uint(fs.Addition)
 		del := uint(fs.Deletion)
-		np := maxNameLen - len(fs.Name)
 		cp := maxChangeLen - len(strconv.Itoa(fs.Addition+fs.Deletion))
 
 		total := add + del
@@ -280,23 +541,25 @@ func printStat(fileStats []FileStat) string {
 
 		adds := strings.Repeat("+", int(add))
 		dels := strings.Repeat("-", int(del))
-		namePad := strings.Repeat(" ", np)
 		changePad := strings.Repeat(" ", cp)
 
-		fmt.Fprintf(&result, " %s%s | %s%d %s%s\n", fs.Name, namePad, changePad, total, adds, dels)
+		graph := ""
+		if total != 0 {
+			graph = " " + adds + dels
+		}
+
+		fmt.Fprintf(&result, " %s%s | %s%d%s\n", fs.Name, namePad, changePad, total, graph)
 	}
 	return result.String()
 }
 
+// getFileStatsFromFilePatches returns the stats of the file patches, counted
+// as git does: the lines of context are not counted, the binary files are
+// flagged, and the submodules count a line for each of their commits.
 func getFileStatsFromFilePatches(filePatches []fdiff.FilePatch) FileStats {
 	fileStats := make(FileStats, 0, len(filePatches))
 
 	for _, fp := range filePatches {
-		// ignore empty patches (binary files, submodule refs updates)
-		if len(fp.Chunks()) == 0 {
-			continue
-		}
-
 		cs := FileStat{}
 		from, to := fp.Files()
 		if from == nil {
@@ -307,11 +570,33 @@ func getFileStatsFromFilePatches(filePatches []fdiff.FilePatch) FileStats {
 			cs.Name = from.Path()
 		} else if from.Path() != to.Path() {
 			// File is renamed.
-			cs.Name = fmt.Sprintf("%s => %s", from.Path(), to.Path())
+			cs.Name = renamedName(from.Path(), to.Path())
 		} else {
 			cs.Name = from.Path()
 		}
 
+		if fp.IsBinary() {
+			cs.Binary = true
+			if tf, ok := fp.(*textFilePatch); ok {
+				if tf.fromFile != nil {
+					cs.fromSize = tf.fromFile.Size
+				}
+
+				if tf.toFile != nil {
+					cs.toSize = tf.toFile.Size
+				}
+			}
+		}
+
+		// The submodules are diffed as a line with their commit.
+		if from != nil && from.Mode() == filemode.Submodule {
+			cs.Deletion++
+		}
+
+		if to != nil && to.Mode() == filemode.Submodule {
+			cs.Addition++
+		}
+
 		for _, chunk := range fp.Chunks() {
 			s := chunk.Content()
 			if len(s) == 0 {
@@ -337,3 +622,38 @@ func getFileStatsFromFilePatches(filePatches []fdiff.FilePatch) FileStats {
 
 	return fileStats
 }
+
+// renamedName returns the name of a file renamed from a to b as git does,
+// the common leading and trailing directories being factored out, such as
+// "dir/{a => b}/file".
+func renamedName(a, b string) string {
+	// The common prefix ends with a slash.
+	prefix := 0
+	for i := 0; i < len(a) && i < len(b) && a[i] == b[i]; i++ {
+		if a[i] == '/' {
+			prefix = i + 1
+		}
+	}
+
+	// The common suffix starts with a slash, and may overlap the slash of
+	// the prefix.
+	suffix := 0
+	adjust := 0
+	if prefix > 0 {
+		adjust = 1
+	}
+
+	for i, j := len(a)-1, len(b)-1; i >= prefix-adjust && j >= prefix-adjust && a[i] == b[j]; i, j = i-1, j-1 {
+		if a[i] == '/' {
+			suffix = len(a) - i
+		}
+	}
+
+	if prefix+suffix == 0 {
+		return a + " => " + b
+	}
+
+	amid := max(len(a)-prefix-suffix, 0)
+	bmid := max(len(b)-prefix-suffix, 0)
+	return a[:prefix] + "{" + a[prefix:prefix+amid] + " => " + b[prefix:prefix+bmid] + "}" + a[len(a)-suffix:]
+}
@@ -1,6 +1,9 @@
 package object_test
 
 import (
+	"os/exec"
+	"path/filepath"
+	"strings"
 	"testing"
 	"time"
 
@@ -54,3 +57,69 @@ func (s *PatchStatsSuite) TestStatsWithRename() {
 	s.NoError(err)
 	s.Equal("foo => bar", fileStats[0].Name)
 }
+
+func (s *PatchStatsSuite) TestStatsGit() {
+	if _, err := exec.LookPath("git"); err != nil {
+		s.T().Skip("git not found")
+	}
+
+	cm := &git.CommitOptions{
+		Author: &object.Signature{Name: "Foo", Email: "foo@example.local", When: time.Now()},
+	}
+
+	dir := s.T().TempDir()
+	r, err := git.PlainInit(dir, false)
+	s.Require().NoError(err)
+	w, err := r.Worktree()
+	s.Require().NoError(err)
+
+	commit := func(files map[string]string, removed ...string) {
+		for name, content := range files {
+			s.Require().NoError(util.WriteFile(w.Filesystem, name, []byte(content), 0o644))
+			_, err := w.Add(name)
+			s.Require().NoError(err)
+		}
+
+		for _, name := range removed {
+			_, err := w.Remove(name)
+			s.Require().NoError(err)
+		}
+
+		_, err := w.Commit("commit\n", cm)
+		s.Require().NoError(err)
+	}
+
+	commit(map[string]string{
+		"a":              "a\nb\nc\n",
+		"dir/sub/old.go": strings.Repeat("package sub\n", 10),
+		"image.bin":      "\x00\x01\x02",
+		"deleted":        "x\ny",
+	})
+	commit(map[string]string{
+		"a":              "a\nB\nc\nd\n",
+		"dir/sub/new.go": strings.Repeat("package sub\n", 10),
+		"image.bin":      "\x00\x01\x02\x03",
+		"empty":          "",
+	}, "dir/sub/old.go", "deleted")
+
+	head, err := r.Head()
+	s.Require().NoError(err)
+	c, err := r.CommitObject(head.Hash())
+	s.Require().NoError(err)
+	stats, err := c.Stats()
+	s.Require().NoError(err)
+
+	git := func(args ...string) string {
+		cmd := exec.Command("git", append([]string{"diff"}, append(args, "HEAD~1", "HEAD")...)...)
+		cmd.Dir = filepath.Clean(dir)
+		out, err := cmd.CombinedOutput()
+		s.Require().NoError(err, string(out))
+		return string(out)
+	}
+
+	s.Equal(git("--numstat"), stats.NumStat())
+	s.Equal(git("--shortstat"), stats.ShortStat().String())
+
+	stat := git("--stat")
+	s.Equal(stat[:strings.LastIndex(stat[:len(stat)-1], "\n")+1], stats.String())
+}
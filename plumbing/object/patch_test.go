@@ -1,13 +1,22 @@
 package object
 
 import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
 	"testing"
 
+	"github.com/go-git/go-billy/v6/osfs"
 	fixtures "github.com/go-git/go-git-fixtures/v5"
 	"github.com/stretchr/testify/suite"
 
 	"github.com/go-git/go-git/v6/plumbing"
 	"github.com/go-git/go-git/v6/plumbing/cache"
+	fdiff "github.com/go-git/go-git/v6/plumbing/format/diff"
 	"github.com/go-git/go-git/v6/storage/filesystem"
 )
 
@@ -69,7 +78,7 @@ func (s *PatchSuite) TestFileStatsString() {
 					Name: "file1",
 				},
 			},
-			expected: " file1 | 0 \n",
+			expected: " file1 | 0\n",
 		},
 		{
 			description: "one file changed",
@@ -152,6 +161,28 @@ func (s *PatchSuite) TestFileStatsString() {
 				" worktree.go               | 324 ++++++++++++++++++-----------------------------------\n" +
 				" worktree_test.go          | 350 ++++++++++++-----------------------------------------\n",
 		},
+		{
+			description: "binary files",
+			input: []FileStat{
+				{
+					Name:     "image.png",
+					Binary:   true,
+					fromSize: 120,
+					toSize:   1400,
+				},
+				{
+					Name:   "empty.bin",
+					Binary: true,
+				},
+				{
+					Name:     "a",
+					Addition: 1,
+				},
+			},
+			expected: " image.png | Bin 120 -> 1400 bytes\n" +
+				" empty.bin | Bin\n" +
+				" a         |   1 +\n",
+		},
 	}
 
 	for _, tc := range testCases {
@@ -159,3 +190,301 @@ func (s *PatchSuite) TestFileStatsString() {
 		s.Equal(tc.expected, printStat(tc.input))
 	}
 }
+
+func (s *PatchSuite) TestFileStatsNumStat() {
+	stats := FileStats{
+		{Name: "a", Addition: 3, Deletion: 1},
+		{Name: "image.png", Binary: true, toSize: 12},
+		{Name: "dir/{b => c}", Addition: 0, Deletion: 0},
+	}
+
+	s.Equal("3\t1\ta\n-\t-\timage.png\n0\t0\tdir/{b => c}\n", stats.NumStat())
+	s.Equal(ShortStat{Files: 3, Additions: 3, Deletions: 1}, stats.ShortStat())
+	s.Equal("", FileStats{}.NumStat())
+}
+
+func (s *PatchSuite) TestShortStatString() {
+	for _, tc := range []struct {
+		stat     ShortStat
+		expected string
+	}{
+		{ShortStat{}, " 0 files changed\n"},
+		{ShortStat{Files: 1}, " 1 file changed, 0 insertions(+), 0 deletions(-)\n"},
+		{ShortStat{Files: 1, Additions: 1}, " 1 file changed, 1 insertion(+)\n"},
+		{ShortStat{Files: 2, Deletions: 3}, " 2 files changed, 3 deletions(-)\n"},
+		{ShortStat{Files: 3, Additions: 2, Deletions: 1}, " 3 files changed, 2 insertions(+), 1 deletion(-)\n"},
+	} {
+		s.Equal(tc.expected, tc.stat.String())
+	}
+}
+
+func (s *PatchSuite) TestRenamedName() {
+	for _, tc := range []struct {
+		from, to, expected string
+	}{
+		{"a", "b", "a => b"},
+		{"dir/a", "dir/b", "dir/{a => b}"},
+		{"a/file", "b/file", "{a => b}/file"},
+		{"dir/a/file", "dir/b/file", "dir/{a => b}/file"},
+		{"a/b/c", "a/c", "a/{b => }/c"},
+		{"x/y", "x/z/y", "x/{ => z}/y"},
+		{"dir/a.go", "other/b.go", "dir/a.go => other/b.go"},
+	} {
+		s.Equal(tc.expected, renamedName(tc.from, tc.to), tc.from)
+	}
+}
+
+// gitDiffRepository is a repository written by git, to compare the patches
+// with the ones of git diff.
+type gitDiffRepository struct {
+	s   *PatchSuite
+	dir string
+}
+
+func (s *PatchSuite) newGitDiffRepository() *gitDiffRepository {
+	if _, err := exec.LookPath("git"); err != nil {
+		s.T().Skip("git not found")
+	}
+
+	r := &gitDiffRepository{s: s, dir: s.T().TempDir()}
+	r.git("init", "-q")
+	r.git("config", "user.name", "foo")
+	r.git("config", "user.email", "foo@foo.com")
+	return r
+}
+
+func (r *gitDiffRepository) git(args ...string) string {
+	cmd := exec.Command("git", args...)
+	cmd.Dir = r.dir
+	cmd.Env = append(os.Environ(), "GIT_CONFIG_NOSYSTEM=1", "HOME="+r.dir)
+
+	out, err := cmd.CombinedOutput()
+	r.s.Require().NoError(err, string(out))
+	return string(out)
+}
+
+func (r *gitDiffRepository) write(name, content string, perm os.FileMode) {
+	path := filepath.Join(r.dir, name)
+	r.s.Require().NoError(os.WriteFile(path, []byte(content), perm))
+	r.s.Require().NoError(os.Chmod(path, perm))
+}
+
+func (r *gitDiffRepository) commit() *Tree {
+	r.git("add", "-A")
+	r.git("commit", "-q", "--allow-empty", "-m", "commit")
+
+	sto := filesystem.NewStorage(osfs.New(filepath.Join(r.dir, ".git")), cache.NewObjectLRUDefault())
+	commit, err := GetCommit(sto, plumbing.NewHash(strings.TrimSpace(r.git("rev-parse", "HEAD"))))
+	r.s.Require().NoError(err)
+
+	tree, err := commit.Tree()
+	r.s.Require().NoError(err)
+	return tree
+}
+
+func (s *PatchSuite) TestEncodeMatchesGitDiff() {
+	lines := func(from, to int) string {
+		var sb strings.Builder
+		for i := from; i <= to; i++ {
+			fmt.Fprintf(&sb, "line %d\n", i)
+		}
+
+		return sb.String()
+	}
+
+	const goFile = "package main\n\nimport \"fmt\"\n\nfunc main() {\n\ta := 1\n\tb := 2\n\tc := 3\n\td := 4\n\te := 5\n\tfmt.Println(a, b, c, d, e)\n}\n"
+
+	for _, tc := range []struct {
+		desc     string
+		from, to func(r *gitDiffRepository)
+		args     []string
+		context  int
+	}{{
+		desc: "function context",
+		from: func(r *gitDiffRepository) { r.write("main.go", goFile, 0o644) },
+		to: func(r *gitDiffRepository) {
+			r.write("main.go", strings.Replace(goFile, "e := 5", "e := 50", 1), 0o644)
+		},
+	}, {
+		desc: "context lines",
+		from: func(r *gitDiffRepository) { r.write("file", lines(1, 30), 0o644) },
+		to: func(r *gitDiffRepository) {
+			content := strings.Replace(lines(1, 30), "line 10\n", "line ten\n", 1)
+			r.write("file", strings.Replace(content, "line 15\n", "", 1), 0o644)
+		},
+		args:    []string{"-U1"},
+		context: 1,
+	}, {
+		desc: "mode change",
+		from: func(r *gitDiffRepository) { r.write("script.sh", "echo foo\n", 0o644) },
+		to:   func(r *gitDiffRepository) { r.write("script.sh", "echo foo\n", 0o755) },
+	}, {
+		desc: "mode and content change",
+		from: func(r *gitDiffRepository) { r.write("script.sh", "echo foo\n", 0o644) },
+		to:   func(r *gitDiffRepository) { r.write("script.sh", "echo bar\n", 0o755) },
+	}, {
+		desc: "binary",
+		from: func(r *gitDiffRepository) { r.write("file.bin", "\x00\x01\x02foo", 0o644) },
+		to:   func(r *gitDiffRepository) { r.write("file.bin", "\x00\x01\x03bar", 0o644) },
+	}, {
+		desc: "rename",
+		from: func(r *gitDiffRepository) { r.write("old", lines(1, 20), 0o644) },
+		to: func(r *gitDiffRepository) {
+			r.s.Require().NoError(os.Remove(filepath.Join(r.dir, "old")))
+			r.write("new", strings.Replace(lines(1, 20), "line 10\n", "line ten\n", 1), 0o644)
+		},
+		args: []string{"-M"},
+	}, {
+		desc: "renames sorted by new name",
+		from: func(r *gitDiffRepository) {
+			r.write("a", "a\n", 0o644)
+			r.write("b", lines(1, 20), 0o644)
+			r.write("c", "c\n", 0o644)
+			r.write("e", lines(21, 40), 0o644)
+		},
+		to: func(r *gitDiffRepository) {
+			r.write("a", "a2\n", 0o644)
+			r.s.Require().NoError(os.Rename(filepath.Join(r.dir, "b"), filepath.Join(r.dir, "d")))
+			r.write("c", "c2\n", 0o644)
+			r.s.Require().NoError(os.Rename(filepath.Join(r.dir, "e"), filepath.Join(r.dir, "0")))
+		},
+		args: []string{"-M"},
+	}, {
+		desc: "no newline at end of file",
+		from: func(r *gitDiffRepository) { r.write("file", "foo\nbar", 0o644) },
+		to:   func(r *gitDiffRepository) { r.write("file", "foo\nbaz", 0o644) },
+	}, {
+		desc: "new empty file",
+		from: func(r *gitDiffRepository) {},
+		to:   func(r *gitDiffRepository) { r.write("empty", "", 0o644) },
+	}, {
+		desc: "deleted file",
+		from: func(r *gitDiffRepository) { r.write("file", "foo\n", 0o644) },
+		to: func(r *gitDiffRepository) {
+			r.s.Require().NoError(os.Remove(filepath.Join(r.dir, "file")))
+		},
+	}} {
+		s.Run(tc.desc, func() {
+			r := s.newGitDiffRepository()
+			tc.from(r)
+			from := r.commit()
+			tc.to(r)
+			to := r.commit()
+
+			changes, err := DiffTreeWithOptions(context.Background(), from, to, DefaultDiffTreeOptions)
+			s.Require().NoError(err)
+			patch, err := changes.Patch()
+			s.Require().NoError(err)
+
+			context := tc.context
+			if context == 0 {
+				context = fdiff.DefaultContextLines
+			}
+
+			buf := bytes.NewBuffer(nil)
+			s.Require().NoError(fdiff.NewUnifiedEncoder(buf, context).Encode(patch))
+
+			args := append([]string{"diff", "--full-index"}, tc.args...)
+			expected := r.git(append(args, from.Hash.String(), to.Hash.String())...)
+			s.Equal(expected, buf.String())
+		})
+	}
+}
+
+func (s *PatchSuite) TestEncodeBinaryPatch() {
+	r := s.newGitDiffRepository()
+	r.write("changed.bin", "\x00\x01\x02foo", 0o644)
+	r.write("deleted.bin", "\x00deleted", 0o644)
+	from := r.commit()
+
+	r.write("changed.bin", "\x00\x01\x03bar"+strings.Repeat("\x00\xff", 100), 0o644)
+	r.s.Require().NoError(os.Remove(filepath.Join(r.dir, "deleted.bin")))
+	r.write("new.bin", "\x00new", 0o644)
+	to := r.commit()
+
+	changes, err := DiffTree(from, to)
+	s.Require().NoError(err)
+	patch, err := changes.Patch()
+	s.Require().NoError(err)
+
+	buf := bytes.NewBuffer(nil)
+	s.Require().NoError(fdiff.NewUnifiedEncoder(buf, fdiff.DefaultContextLines).SetBinary(true).Encode(patch))
+
+	// The deflated data may differ from the one of git, but the headers
+	// are the same.
+	expected := r.git("diff", "--binary", from.Hash.String(), to.Hash.String())
+	header := func(patch string) []string {
+		var lines []string
+		for _, l := range strings.Split(patch, "\n") {
+			if strings.HasPrefix(l, "diff --git") || strings.HasPrefix(l, "literal ") || strings.Contains(l, "file mode") {
+				lines = append(lines, l)
+			}
+		}
+
+		return lines
+	}
+	s.Equal(header(expected), header(buf.String()))
+
+	// The patch applies, and reverts, with git.
+	r.git("checkout", "-q", "HEAD~")
+	patchFile := filepath.Join(s.T().TempDir(), "binary.patch")
+	s.Require().NoError(os.WriteFile(patchFile, buf.Bytes(), 0o644))
+	r.git("apply", "--index", patchFile)
+	s.Equal(to.Hash.String(), strings.TrimSpace(r.git("write-tree")))
+
+	r.git("apply", "--index", "-R", patchFile)
+	s.Equal(from.Hash.String(), strings.TrimSpace(r.git("write-tree")))
+}
+
+func (s *PatchSuite) TestPatchWithOptionsMatchesGitDiff() {
+	const from = "package main\n\nfunc main() {\n\tif a  {\n\t\tb()\n\t}\n\n\n\tc()\n}\n"
+	const to = "package main\n\nfunc main() {\n\tif a {\n    b()\n\t}  \n\tc()\n\td()\n}\n"
+	const spaces = "foo bar\nbaz\n"
+	const words = "the quick brown fox\njumps over\nthe lazy dog\n\nkeep\na b c\n"
+
+	for _, tc := range []struct {
+		desc     string
+		opts     DiffOptions
+		wordDiff bool
+		args     []string
+	}{{
+		desc: "ignore all space",
+		opts: DiffOptions{IgnoreAllSpace: true},
+		args: []string{"-w"},
+	}, {
+		desc: "ignore space change",
+		opts: DiffOptions{IgnoreSpaceChange: true},
+		args: []string{"-b"},
+	}, {
+		desc: "ignore blank lines",
+		opts: DiffOptions{IgnoreAllSpace: true, IgnoreBlankLines: true},
+		args: []string{"-w", "--ignore-blank-lines"},
+	}, {
+		desc:     "word diff",
+		wordDiff: true,
+		args:     []string{"--word-diff=plain"},
+	}} {
+		s.Run(tc.desc, func() {
+			r := s.newGitDiffRepository()
+			r.write("main.go", from, 0o644)
+			r.write("spaces", spaces, 0o644)
+			r.write("words", words, 0o644)
+			fromTree := r.commit()
+			r.write("main.go", to, 0o644)
+			r.write("spaces", "foo  bar \n\tbaz\n", 0o644)
+			r.write("words", "the slow brown fox\njumps\nthe very lazy cat\n\nkeep\na c\nnew line\n", 0o644)
+			toTree := r.commit()
+
+			patch, err := fromTree.PatchWithOptions(context.Background(), toTree, &tc.opts)
+			s.Require().NoError(err)
+
+			buf := bytes.NewBuffer(nil)
+			e := fdiff.NewUnifiedEncoder(buf, fdiff.DefaultContextLines).SetWordDiff(tc.wordDiff)
+			s.Require().NoError(e.Encode(patch))
+
+			args := append([]string{"diff", "--full-index"}, tc.args...)
+			expected := r.git(append(args, fromTree.Hash.String(), toTree.Hash.String())...)
+			s.Equal(expected, buf.String())
+		})
+	}
+}
@@ -28,6 +28,7 @@ func DetectRenames(
 		renameScore: int(opts.RenameScore),
 		renameLimit: int(opts.RenameLimit),
 		onlyExact:   opts.OnlyExactRenames,
+		copies:      opts.DetectCopies,
 	}
 
 	for _, c := range changes {
@@ -59,6 +60,7 @@ type renameDetector struct {
 	renameScore int
 	renameLimit int
 	onlyExact   bool
+	copies      bool
 }
 
 // detectExactRenames detects matches files that were deleted with files that
@@ -86,7 +88,7 @@ func (d *renameDetector) detectExactRenames() {
 
 		if len(deleted) == 1 {
 			if sameMode(c, deleted[0]) {
-				d.modified = append(d.modified, &Change{From: deleted[0].From, To: c.To})
+				d.modified = append(d.modified, newRename(deleted[0], c, 100))
 				delete(deletes, hash)
 			} else {
 				addedLeft = append(addedLeft, c)
@@ -94,7 +96,7 @@ func (d *renameDetector) detectExactRenames() {
 		} else if len(deleted) > 1 {
 			bestMatch := bestNameMatch(c, deleted)
 			if bestMatch != nil && sameMode(c, bestMatch) {
-				d.modified = append(d.modified, &Change{From: bestMatch.From, To: c.To})
+				d.modified = append(d.modified, newRename(bestMatch, c, 100))
 				delete(deletes, hash)
 
 				newDeletes := make([]*Change, 0, len(deleted)-1)
@@ -118,7 +120,7 @@ func (d *renameDetector) detectExactRenames() {
 			deleted := deleted[0]
 			bestMatch := bestNameMatch(deleted, added)
 			if bestMatch != nil && sameMode(deleted, bestMatch) {
-				d.modified = append(d.modified, &Change{From: deleted.From, To: bestMatch.To})
+				d.modified = append(d.modified, newRename(deleted, bestMatch, 100))
 				delete(deletes, hash)
 
 				for _, c := range added {
@@ -171,7 +173,7 @@ func (d *renameDetector) detectExactRenames() {
 
 				usedAdds[add] = struct{}{}
 				usedDeletes[del] = struct{}{}
-				d.modified = append(d.modified, &Change{From: del.From, To: add.To})
+				d.modified = append(d.modified, newRename(del, add, 100))
 				added[matrix[i].added] = nil
 				deleted[matrix[i].deleted] = nil
 			}
@@ -230,7 +232,7 @@ func (d *renameDetector) detectContentRenames() error {
 			continue
 		}
 
-		renames = append(renames, &Change{From: src.From, To: dst.To})
+		renames = append(renames, newRename(src, dst, pair.similarity))
 
 		// Claim destination and source as matched
 		dsts[pair.added] = nil
@@ -244,6 +246,67 @@ func (d *renameDetector) detectContentRenames() error {
 	return nil
 }
 
+// detectCopies detects the added files that are copies of the files modified
+// or renamed, first by hash and then by content, as renames are. Unlike
+// renames, a source can be matched by several copies.
+func (d *renameDetector) detectCopies() error {
+	var srcs []*Change
+	for _, c := range d.modified {
+		srcs = append(srcs, &Change{From: c.From})
+	}
+
+	if len(srcs) == 0 {
+		return nil
+	}
+
+	byHash := groupChangesByHash(srcs)
+	var dsts, copies []*Change
+	for _, c := range d.added {
+		var candidates []*Change
+		for _, src := range byHash[changeHash(c)] {
+			if sameMode(src, c) {
+				candidates = append(candidates, src)
+			}
+		}
+
+		if len(candidates) == 0 {
+			dsts = append(dsts, c)
+			continue
+		}
+
+		src := bestNameMatch(c, candidates)
+		if src == nil {
+			src = candidates[0]
+		}
+
+		copies = append(copies, newCopy(src, c, 100))
+	}
+
+	cnt := max(len(srcs), len(dsts))
+	if !d.onlyExact && len(dsts) > 0 && (d.renameLimit == 0 || cnt <= d.renameLimit) {
+		matrix, err := buildSimilarityMatrix(srcs, dsts, d.renameScore)
+		if err != nil {
+			return err
+		}
+
+		for i := len(matrix) - 1; i >= 0; i-- {
+			pair := matrix[i]
+			dst := dsts[pair.added]
+			if dst == nil {
+				continue
+			}
+
+			copies = append(copies, newCopy(srcs[pair.deleted], dst, pair.similarity))
+			dsts[pair.added] = nil
+		}
+	}
+
+	d.modified = append(d.modified, copies...)
+	d.added = compactChanges(dsts)
+
+	return nil
+}
+
 func (d *renameDetector) detect() (Changes, error) {
 	if len(d.added) > 0 && len(d.deleted) > 0 {
 		d.detectExactRenames()
@@ -255,6 +318,12 @@ func (d *renameDetector) detect() (Changes, error) {
 		}
 	}
 
+	if d.copies && len(d.added) > 0 {
+		if err := d.detectCopies(); err != nil {
+			return nil, err
+		}
+	}
+
 	result := make(Changes, 0, len(d.added)+len(d.deleted)+len(d.modified))
 	result = append(result, d.added...)
 	result = append(result, d.deleted...)
@@ -265,6 +334,14 @@ func (d *renameDetector) detect() (Changes, error) {
 	return result, nil
 }
 
+func newRename(from, to *Change, similarity int) *Change {
+	return &Change{From: from.From, To: to.To, Kind: Renamed, Similarity: similarity}
+}
+
+func newCopy(from, to *Change, similarity int) *Change {
+	return &Change{From: from.From, To: to.To, Kind: Copied, Similarity: similarity}
+}
+
 func bestNameMatch(change *Change, changes []*Change) *Change {
 	var best *Change
 	var bestScore int
@@ -387,6 +464,9 @@ type similarityPair struct {
 	deleted int
 	// similarity score
 	score int
+	// similarity of the contents, as a percentage, which unlike the score
+	// does not account for the names, as reported by git
+	similarity int
 }
 
 const maxMatrixSize = 10000
@@ -493,7 +573,12 @@ outerLoop:
 				continue
 			}
 
-			matrix = append(matrix, similarityPair{added: dstIdx, deleted: srcIdx, score: score})
+			matrix = append(matrix, similarityPair{
+				added:      dstIdx,
+				deleted:    srcIdx,
+				score:      score,
+				similarity: contentScore / 100,
+			})
 		}
 	}
 
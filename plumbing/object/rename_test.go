@@ -276,6 +276,85 @@ func (s *RenameSuite) TestRenameLimit() {
 	}
 }
 
+func (s *RenameSuite) TestRenameSimilarity() {
+	exact := detectRenames(s, Changes{
+		makeAdd(s, makeFile(s, pathA, filemode.Regular, "foo")),
+		makeDelete(s, makeFile(s, pathQ, filemode.Regular, "foo")),
+	}, nil, 1)
+	s.Equal(100, exact[0].Similarity)
+
+	content := detectRenames(s, Changes{
+		makeAdd(s, makeFile(s, pathA, filemode.Regular, "foo\nbar\nbaz\nblarg\n")),
+		makeDelete(s, makeFile(s, pathQ, filemode.Regular, "foo\nbar\nbaz\nblah\n")),
+	}, nil, 1)
+	s.Equal(Renamed, content[0].Kind)
+	s.Equal(66, content[0].Similarity)
+}
+
+func (s *RenameSuite) TestDetectCopies() {
+	opts := &DiffTreeOptions{DetectRenames: true, RenameScore: 60, DetectCopies: true}
+	changes := Changes{
+		makeAdd(s, makeFile(s, pathA, filemode.Regular, "foo\nbar\nbaz\nblah\n")),
+		makeAdd(s, makeFile(s, pathB, filemode.Regular, "a\nb\nc\n")),
+		makeChange(s,
+			makeFile(s, pathH, filemode.Regular, "a\nb\nc\n"),
+			makeFile(s, pathH, filemode.Regular, "a\nb\nc\nd\n"),
+		),
+		makeDelete(s, makeFile(s, pathQ, filemode.Regular, "foo\nbar\nbaz\nblah\n")),
+		makeAdd(s, makeFile(s, "src/R", filemode.Regular, "foo\nbar\nbaz\nblah\nqux\n")),
+		makeAdd(s, makeFile(s, "src/S", filemode.Regular, "unrelated\n")),
+	}
+
+	result := detectRenames(s, changes, opts, 5)
+	byName := make(map[string]*Change)
+	for _, c := range result {
+		byName[changeName(c)] = c
+	}
+
+	s.Equal(changes[3].From, byName[pathA].From)
+	s.Equal(Renamed, byName[pathA].Kind)
+	s.Equal(100, byName[pathA].Similarity)
+
+	// An exact copy of the original content of a modified file.
+	s.Equal(changes[2].From, byName[pathB].From)
+	s.Equal(Copied, byName[pathB].Kind)
+	s.Equal(100, byName[pathB].Similarity)
+	s.Equal(changes[2], byName[pathH])
+
+	// A copy of the source of a rename, which can be copied several times.
+	s.Equal(changes[3].From, byName["src/R"].From)
+	s.Equal(Copied, byName["src/R"].Kind)
+	s.Equal(80, byName["src/R"].Similarity)
+
+	s.Equal(changes[5], byName["src/S"])
+
+	// Without DetectCopies, the additions are left as they are.
+	opts.DetectCopies = false
+	result = detectRenames(s, changes, opts, 5)
+	s.Contains(result, changes[1])
+	s.Contains(result, changes[4])
+}
+
+func (s *RenameSuite) TestRenamePatch() {
+	opts := &DiffTreeOptions{DetectRenames: true, RenameScore: 50, DetectCopies: true}
+	result := detectRenames(s, Changes{
+		makeChange(s,
+			makeFile(s, pathH, filemode.Regular, "a\nb\nc\n"),
+			makeFile(s, pathH, filemode.Regular, "a\nb\nc\nd\n"),
+		),
+		makeAdd(s, makeFile(s, pathA, filemode.Regular, "a\nb\nc\n")),
+		makeAdd(s, makeFile(s, pathB, filemode.Regular, "foo\nbar\nbaz\nqux\n")),
+		makeDelete(s, makeFile(s, pathQ, filemode.Regular, "foo\nbar\nbaz\n")),
+	}, opts, 3)
+
+	patch, err := result.Patch()
+	s.Require().NoError(err)
+
+	out := patch.String()
+	s.Contains(out, "diff --git a/src/H b/src/A\nsimilarity index 100%\ncopy from src/H\ncopy to src/A\n")
+	s.Contains(out, "diff --git a/src/Q b/src/B\nsimilarity index 75%\nrename from src/Q\nrename to src/B\n")
+}
+
 func (s *RenameSuite) TestRenameExactManyAddsManyDeletesNoGaps() {
 	content := "a"
 	detector := &renameDetector{
@@ -310,7 +389,9 @@ func detectRenames(s *RenameSuite, changes Changes, opts *DiffTreeOptions, expec
 }
 
 func assertRename(s *RenameSuite, from, to, rename *Change) {
-	s.Equal(rename, &Change{From: from.From, To: to.To})
+	s.Equal(from.From, rename.From)
+	s.Equal(to.To, rename.To)
+	s.Equal(Renamed, rename.Kind)
 }
 
 type SimilarityIndexSuite struct {
@@ -0,0 +1,209 @@
+package object
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/ProtonMail/go-crypto/openpgp"
+	"github.com/ProtonMail/go-crypto/openpgp/armor"
+	pgperrors "github.com/ProtonMail/go-crypto/openpgp/errors"
+	"github.com/ProtonMail/go-crypto/openpgp/packet"
+
+	"github.com/go-git/go-git/v6/plumbing"
+)
+
+// ErrNotSignedWithOpenPGP is returned when verifying the OpenPGP signature of
+// an object without signature, or signed with another format.
+var ErrNotSignedWithOpenPGP = errors.New("object not signed with openpgp")
+
+// SignatureValidity is the validity of the OpenPGP signature of an object.
+type SignatureValidity int
+
+const (
+	// GoodSignature is a valid signature, made by a valid key.
+	GoodSignature SignatureValidity = iota
+	// BadSignature is a signature not matching the signed object.
+	BadSignature
+	// ExpiredKey is a valid signature, made by an expired key.
+	ExpiredKey
+	// RevokedKey is a valid signature, made by a revoked key.
+	RevokedKey
+	// ExpiredSignature is a valid signature, expired.
+	ExpiredSignature
+	// UnknownKey is a signature made by a key missing from the keyrings.
+	UnknownKey
+)
+
+func (v SignatureValidity) String() string {
+	switch v {
+	case GoodSignature:
+		return "good"
+	case BadSignature:
+		return "bad signature"
+	case ExpiredKey:
+		return "expired key"
+	case RevokedKey:
+		return "revoked key"
+	case ExpiredSignature:
+		return "expired signature"
+	case UnknownKey:
+		return "unknown key"
+	}
+
+	return fmt.Sprintf("SignatureValidity(%d)", int(v))
+}
+
+// SignatureVerification is the result of the verification of the OpenPGP
+// signature of an object.
+type SignatureVerification struct {
+	// Validity is the validity of the signature.
+	Validity SignatureValidity
+	// KeyID is the ID of the key the object is signed with.
+	KeyID uint64
+	// Fingerprint is the fingerprint of the key the object is signed with,
+	// nil if the key is unknown and the signature does not include it.
+	Fingerprint []byte
+	// Entity is the entity of the key the object is signed with, nil if the
+	// key is unknown.
+	Entity *openpgp.Entity
+	// Time is the creation time of the signature.
+	Time time.Time
+}
+
+// Good returns whether the signature is valid, and made by a valid key.
+func (v *SignatureVerification) Good() bool {
+	return v.Validity == GoodSignature
+}
+
+// VerifySignature performs PGP verification of the commit with the keys of
+// the given keyrings, such as the ones returned by
+// openpgp.ReadArmoredKeyRing, and returns the validity of the signature
+// along with its key. An error is only returned if the commit is not signed
+// with OpenPGP, or if its signature is malformed.
+func (c *Commit) VerifySignature(keyrings ...openpgp.KeyRing) (*SignatureVerification, error) {
+	return verifySignature(c, c.PGPSignature, keyrings)
+}
+
+// VerifySignature performs PGP verification of the tag with the keys of the
+// given keyrings, as Commit.VerifySignature.
+func (t *Tag) VerifySignature(keyrings ...openpgp.KeyRing) (*SignatureVerification, error) {
+	return verifySignature(t, t.PGPSignature, keyrings)
+}
+
+func verifySignature(o interface {
+	EncodeWithoutSignature(plumbing.EncodedObject) error
+}, signature string, keyrings []openpgp.KeyRing,
+) (*SignatureVerification, error) {
+	sig, body, err := readOpenPGPSignature(signature)
+	if err != nil {
+		return nil, err
+	}
+
+	encoded := &plumbing.MemoryObject{}
+	// Encode components, excluding signature and get a reader object.
+	if err := o.EncodeWithoutSignature(encoded); err != nil {
+		return nil, err
+	}
+	er, err := encoded.Reader()
+	if err != nil {
+		return nil, err
+	}
+
+	v := &SignatureVerification{
+		KeyID:       *sig.IssuerKeyId,
+		Fingerprint: sig.IssuerFingerprint,
+		Time:        sig.CreationTime,
+	}
+
+	kr := multiKeyRing(keyrings)
+	if keys := kr.KeysById(v.KeyID); len(keys) > 0 {
+		v.Entity = keys[0].Entity
+		v.Fingerprint = keys[0].PublicKey.Fingerprint
+	}
+
+	_, _, err = openpgp.VerifyDetachedSignature(kr, er, bytes.NewReader(body), nil)
+	switch {
+	case err == nil:
+		v.Validity = GoodSignature
+	case errors.Is(err, pgperrors.ErrUnknownIssuer):
+		v.Validity = UnknownKey
+	case errors.Is(err, pgperrors.ErrKeyRevoked):
+		v.Validity = RevokedKey
+	case errors.Is(err, pgperrors.ErrKeyExpired):
+		v.Validity = ExpiredKey
+	case errors.Is(err, pgperrors.ErrSignatureExpired):
+		v.Validity = ExpiredSignature
+	default:
+		v.Validity = BadSignature
+	}
+
+	return v, nil
+}
+
+// readOpenPGPSignature returns the signature packet of the given armored
+// signature, along with its unarmored content.
+func readOpenPGPSignature(signature string) (*packet.Signature, []byte, error) {
+	if signature == "" {
+		return nil, nil, ErrNotSignedWithOpenPGP
+	}
+
+	block, err := armor.Decode(strings.NewReader(signature))
+	if err != nil {
+		return nil, nil, fmt.Errorf("%w: %w", ErrNotSignedWithOpenPGP, err)
+	}
+
+	if block.Type != openpgp.SignatureType {
+		return nil, nil, fmt.Errorf("%w: unexpected %s block", ErrNotSignedWithOpenPGP, block.Type)
+	}
+
+	body, err := io.ReadAll(block.Body)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	p, err := packet.Read(bytes.NewReader(body))
+	if err != nil {
+		return nil, nil, err
+	}
+
+	sig, ok := p.(*packet.Signature)
+	if !ok || sig.IssuerKeyId == nil {
+		return nil, nil, pgperrors.StructuralError("invalid signature packet")
+	}
+
+	return sig, body, nil
+}
+
+// multiKeyRing is a keyring made of the keys of several keyrings.
+type multiKeyRing []openpgp.KeyRing
+
+func (k multiKeyRing) KeysById(id uint64) []openpgp.Key {
+	var keys []openpgp.Key
+	for _, kr := range k {
+		keys = append(keys, kr.KeysById(id)...)
+	}
+
+	return keys
+}
+
+func (k multiKeyRing) KeysByIdUsage(id uint64, requiredUsage byte) []openpgp.Key {
+	var keys []openpgp.Key
+	for _, kr := range k {
+		keys = append(keys, kr.KeysByIdUsage(id, requiredUsage)...)
+	}
+
+	return keys
+}
+
+func (k multiKeyRing) DecryptionKeys() []openpgp.Key {
+	var keys []openpgp.Key
+	for _, kr := range k {
+		keys = append(keys, kr.DecryptionKeys()...)
+	}
+
+	return keys
+}
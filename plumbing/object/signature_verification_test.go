@@ -0,0 +1,159 @@
+package object
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/ProtonMail/go-crypto/openpgp"
+	"github.com/ProtonMail/go-crypto/openpgp/packet"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/go-git/go-git/v6/plumbing"
+)
+
+func newSigningEntity(t *testing.T, config *packet.Config) *openpgp.Entity {
+	t.Helper()
+
+	e, err := openpgp.NewEntity("foo", "", "foo@example.com", config)
+	require.NoError(t, err)
+	return e
+}
+
+// signObject returns the armored signature of o by e, made at the given
+// time.
+func signObject(t *testing.T, o interface {
+	EncodeWithoutSignature(plumbing.EncodedObject) error
+}, e *openpgp.Entity, when time.Time,
+) string {
+	t.Helper()
+
+	encoded := &plumbing.MemoryObject{}
+	require.NoError(t, o.EncodeWithoutSignature(encoded))
+	r, err := encoded.Reader()
+	require.NoError(t, err)
+
+	var sig bytes.Buffer
+	config := &packet.Config{Time: func() time.Time { return when }}
+	require.NoError(t, openpgp.ArmoredDetachSign(&sig, e, r, config))
+	return sig.String()
+}
+
+func TestCommitVerifySignature(t *testing.T) {
+	t.Parallel()
+
+	now := time.Now().Truncate(time.Second)
+	config := &packet.Config{Time: func() time.Time { return now.Add(-time.Hour) }}
+	good := newSigningEntity(t, config)
+	other := newSigningEntity(t, config)
+
+	// The key expires an hour after its creation, three hours ago.
+	created := now.Add(-3 * time.Hour)
+	expired := newSigningEntity(t, &packet.Config{
+		Time:            func() time.Time { return created },
+		KeyLifetimeSecs: 3600,
+	})
+
+	// The key is revoked once the commit is signed.
+	revoked := newSigningEntity(t, config)
+
+	newCommit := func() *Commit {
+		return &Commit{
+			Author:    Signature{Name: "foo", Email: "foo@example.com", When: now},
+			Committer: Signature{Name: "foo", Email: "foo@example.com", When: now},
+			Message:   "signed\n",
+			TreeHash:  plumbing.NewHash("4b825dc642cb6eb9a060e54bf8d69288fbee4904"),
+		}
+	}
+
+	for name, tc := range map[string]struct {
+		signer   *openpgp.Entity
+		when     time.Time
+		keyrings []openpgp.KeyRing
+		modify   bool
+		revoke   bool
+		expected SignatureValidity
+	}{
+		"good":          {signer: good, when: now, keyrings: []openpgp.KeyRing{openpgp.EntityList{good}}, expected: GoodSignature},
+		"other keyring": {signer: good, when: now, keyrings: []openpgp.KeyRing{openpgp.EntityList{other}, openpgp.EntityList{good}}, expected: GoodSignature},
+		"bad":           {signer: good, when: now, keyrings: []openpgp.KeyRing{openpgp.EntityList{good}}, modify: true, expected: BadSignature},
+		"unknown":       {signer: good, when: now, keyrings: []openpgp.KeyRing{openpgp.EntityList{other}}, expected: UnknownKey},
+		"no keyring":    {signer: good, when: now, expected: UnknownKey},
+		"expired":       {signer: expired, when: created.Add(time.Minute), keyrings: []openpgp.KeyRing{openpgp.EntityList{expired}}, expected: ExpiredKey},
+		"revoked":       {signer: revoked, when: now, keyrings: []openpgp.KeyRing{openpgp.EntityList{revoked}}, revoke: true, expected: RevokedKey},
+	} {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			c := newCommit()
+			c.PGPSignature = signObject(t, c, tc.signer, tc.when)
+			if tc.revoke {
+				require.NoError(t, tc.signer.RevokeKey(packet.KeyCompromised, "compromised", nil))
+			}
+
+			if tc.modify {
+				c.Message = "modified\n"
+			}
+
+			v, err := c.VerifySignature(tc.keyrings...)
+			require.NoError(t, err)
+			assert.Equal(t, tc.expected, v.Validity, v.Validity.String())
+			assert.Equal(t, tc.expected == GoodSignature, v.Good())
+			assert.Equal(t, tc.signer.PrimaryKey.KeyId, v.KeyID)
+			assert.Equal(t, tc.signer.PrimaryKey.Fingerprint, v.Fingerprint)
+			assert.True(t, tc.when.Equal(v.Time))
+
+			if tc.expected == UnknownKey {
+				assert.Nil(t, v.Entity)
+			} else {
+				assert.Equal(t, tc.signer, v.Entity)
+			}
+		})
+	}
+}
+
+func TestCommitVerifySignatureNotSigned(t *testing.T) {
+	t.Parallel()
+
+	c := &Commit{Message: "unsigned\n"}
+	_, err := c.VerifySignature()
+	assert.ErrorIs(t, err, ErrNotSignedWithOpenPGP)
+
+	c.PGPSignature = "-----BEGIN SSH SIGNATURE-----\nU1NIU0lH\n-----END SSH SIGNATURE-----\n"
+	_, err = c.VerifySignature()
+	assert.ErrorIs(t, err, ErrNotSignedWithOpenPGP)
+}
+
+func TestTagVerifySignature(t *testing.T) {
+	t.Parallel()
+
+	now := time.Now().Truncate(time.Second)
+	e := newSigningEntity(t, &packet.Config{Time: func() time.Time { return now.Add(-time.Hour) }})
+	tag := &Tag{
+		Name:       "v1.0.0",
+		Tagger:     Signature{Name: "foo", Email: "foo@example.com", When: now},
+		Message:    "signed\n",
+		TargetType: plumbing.CommitObject,
+		Target:     plumbing.NewHash("1eca38290a3131d0c90709496a9b2207a872631e"),
+	}
+	tag.PGPSignature = signObject(t, tag, e, now)
+
+	v, err := tag.VerifySignature(openpgp.EntityList{e})
+	require.NoError(t, err)
+	assert.True(t, v.Good())
+
+	// The signature of a decoded tag is still valid.
+	o := &plumbing.MemoryObject{}
+	require.NoError(t, tag.Encode(o))
+	decoded := &Tag{}
+	require.NoError(t, decoded.Decode(o))
+	v, err = decoded.VerifySignature(openpgp.EntityList{e})
+	require.NoError(t, err)
+	assert.True(t, v.Good())
+
+	decoded.Name = "v2.0.0"
+	v, err = decoded.VerifySignature(openpgp.EntityList{e})
+	require.NoError(t, err)
+	assert.Equal(t, BadSignature, v.Validity)
+}
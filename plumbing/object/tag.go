@@ -9,6 +9,7 @@ import (
 	"github.com/ProtonMail/go-crypto/openpgp"
 
 	"github.com/go-git/go-git/v6/plumbing"
+	"github.com/go-git/go-git/v6/plumbing/format/sshsig"
 	"github.com/go-git/go-git/v6/plumbing/storer"
 	"github.com/go-git/go-git/v6/utils/ioutil"
 	"github.com/go-git/go-git/v6/utils/sync"
@@ -32,7 +33,8 @@ type Tag struct {
 	Tagger Signature
 	// Message is an arbitrary text message.
 	Message string
-	// PGPSignature is the PGP signature of the tag.
+	// PGPSignature is the signature of the tag, an OpenPGP one or an SSH one,
+	// see Verify and VerifySSH.
 	PGPSignature string
 	// TargetType is the object type of the target.
 	TargetType plumbing.ObjectType
@@ -281,6 +283,25 @@ func (t *Tag) Verify(armoredKeyRing string) (*openpgp.Entity, error) {
 	return openpgp.CheckArmoredDetachedSignature(keyring, er, signature, nil)
 }
 
+// VerifySSH performs the verification of the SSH signature of the tag, as
+// made by git when gpg.format is ssh, with the given allowed signers. An
+// error is returned if the signature is invalid. Otherwise, the signature is
+// trusted if made by an allowed signer for the git namespace, at the time
+// of the tag.
+func (t *Tag) VerifySSH(signers sshsig.AllowedSigners) (*sshsig.Verification, error) {
+	encoded := &plumbing.MemoryObject{}
+	// Encode tag components, excluding signature and get a reader object.
+	if err := t.EncodeWithoutSignature(encoded); err != nil {
+		return nil, err
+	}
+	er, err := encoded.Reader()
+	if err != nil {
+		return nil, err
+	}
+
+	return signers.Verify(er, []byte(t.PGPSignature), sshsig.GitNamespace, t.Tagger.When)
+}
+
 // TagIter provides an iterator for a set of tags.
 type TagIter struct {
 	storer.EncodedObjectIter
@@ -12,6 +12,7 @@ import (
 
 	"github.com/go-git/go-git/v6/plumbing"
 	"github.com/go-git/go-git/v6/plumbing/cache"
+	"github.com/go-git/go-git/v6/plumbing/format/sshsig"
 	"github.com/go-git/go-git/v6/storage/filesystem"
 	"github.com/go-git/go-git/v6/storage/memory"
 )
@@ -73,6 +74,21 @@ func (s *TagSuite) TestCommit() {
 	s.Equal("f7b877701fbf855b44c0a9e86f3fdce2c298b07f", commit.ID().String())
 }
 
+func (s *TagSuite) TestPeelToCommit() {
+	tag := s.tag(plumbing.NewHash("ad7897c0fb8e7d9a9ba41fa66072cf06095a6cfc"))
+	commit, err := PeelToCommit(tag)
+	s.NoError(err)
+	s.Equal("f7b877701fbf855b44c0a9e86f3fdce2c298b07f", commit.ID().String())
+
+	same, err := PeelToCommit(commit)
+	s.NoError(err)
+	s.Same(commit, same)
+
+	_, err = PeelToCommit(s.tag(plumbing.NewHash("152175bf7e5580299fa1f0ba41ef6474cc043b70")))
+	s.ErrorIs(err, plumbing.ErrInvalidType)
+	s.ErrorContains(err, "70846e9a10ef7b41064b40f07713d5b8b9a8fc73 is a tree, not a commit")
+}
+
 func (s *TagSuite) TestBlobError() {
 	tag := s.tag(plumbing.NewHash("ad7897c0fb8e7d9a9ba41fa66072cf06095a6cfc"))
 
@@ -465,6 +481,44 @@ eQnkGpsz85DfEviLtk8cZjY/t6o8lPDLiwVjIzUBaA==
 	s.NoError(err)
 }
 
+func (s *TagSuite) TestDecodeAndVerifySSH() {
+	objectText := `object ec264094c502daf206751aedf18a89034f613942
+type commit
+tag v1
+tagger foo <foo@example.com> 1577836800 +0000
+
+signed
+-----BEGIN SSH SIGNATURE-----
+U1NIU0lHAAAAAQAAADMAAAALc3NoLWVkMjU1MTkAAAAgg+uSso1HMV6URh4J+Z1Czg6/+B
+L38zFen/iIf9utXBYAAAADZ2l0AAAAAAAAAAZzaGE1MTIAAABTAAAAC3NzaC1lZDI1NTE5
+AAAAQKwvGOZX+Wb/rSqPH37KctWdnujk5PpdMXMScsloj3Hid9YnAEaLx3h7kO/jylWF1E
+6DjRDjgBv9Oarjw7vPHw8=
+-----END SSH SIGNATURE-----
+`
+
+	o := &plumbing.MemoryObject{}
+	o.SetType(plumbing.TagObject)
+	_, err := o.Write([]byte(objectText))
+	s.NoError(err)
+
+	tag := &Tag{}
+	s.NoError(tag.Decode(o))
+	s.Equal("signed\n", tag.Message)
+
+	signers, err := sshsig.ParseAllowedSigners(strings.NewReader(sshAllowedSigners))
+	s.NoError(err)
+
+	v, err := tag.VerifySSH(signers)
+	s.NoError(err)
+	s.True(v.Trusted())
+
+	// The key is not trusted after the time of the tag.
+	signers[0].ValidBefore = tag.Tagger.When
+	v, err = tag.VerifySSH(signers)
+	s.NoError(err)
+	s.False(v.Trusted())
+}
+
 func (s *TagSuite) TestEncodeWithoutSignature() {
 	// Similar to TestString since no signature
 	encoded := &plumbing.MemoryObject{}
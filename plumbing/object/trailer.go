@@ -0,0 +1,282 @@
+package object
+
+import (
+	"strings"
+)
+
+// gitGeneratedPrefixes are the prefixes of the trailer lines written by git,
+// which make a paragraph mostly made of trailers a trailer block.
+var gitGeneratedPrefixes = []string{"Signed-off-by: ", "(cherry picked from commit "}
+
+// Trailer is a trailer of a commit message, such as a Signed-off-by one.
+type Trailer struct {
+	// Key is the key of the trailer, such as "Signed-off-by".
+	Key string
+	// Value is the value of the trailer, its continuation lines unfolded.
+	Value string
+}
+
+// String returns the trailer as a line of a message, "<key>: <value>".
+func (t Trailer) String() string {
+	return t.Key + ": " + t.Value
+}
+
+// Trailers returns the trailers of the message of the commit, see
+// ParseTrailers.
+func (c *Commit) Trailers() ([]Trailer, error) {
+	return ParseTrailers(c.Message), nil
+}
+
+// ParseTrailers returns the trailers of the message, in order, as
+// `git interpret-trailers --parse` does. The trailers are the lines of the
+// last paragraph of the message, but the first one, of the form
+// "<key>: <value>", with the continuation lines starting with whitespace
+// being folded into the value of their trailer. The paragraph must be only
+// made of trailers, or of at least 25% of trailers, among which one written
+// by git such as Signed-off-by: a body merely containing colons isn't taken
+// for trailers.
+func ParseTrailers(msg string) []Trailer {
+	lines := messageLines(msg)
+	start, end := trailerBlock(lines)
+
+	var trailers []Trailer
+	var last *Trailer
+	for _, line := range lines[start:end] {
+		switch {
+		case strings.HasPrefix(line, "#"):
+			continue
+		case line != "" && isSpace(line[0]) && last != nil:
+			last.Value = strings.TrimSpace(last.Value + " " + strings.TrimSpace(line))
+			continue
+		}
+
+		last = nil
+		if pos := trailerSeparator(line); pos >= 1 {
+			trailers = append(trailers, Trailer{
+				Key:   strings.TrimSpace(line[:pos]),
+				Value: strings.TrimSpace(line[pos+1:]),
+			})
+
+			last = &trailers[len(trailers)-1]
+		}
+	}
+
+	return trailers
+}
+
+// AppendTrailer appends the trailer to the trailers of the message, or as
+// a new paragraph if it has none, unless the last trailer of the message is
+// the same, as `git interpret-trailers --trailer` does by default. The
+// message returned ends with a newline.
+func AppendTrailer(msg string, t Trailer) string {
+	lines := messageLines(msg)
+	start, end := trailerBlock(lines)
+	if start < end {
+		trailers := ParseTrailers(msg)
+		if len(trailers) > 0 {
+			last := trailers[len(trailers)-1]
+			if strings.EqualFold(last.Key, t.Key) && last.Value == t.Value {
+				return joinMessageLines(lines)
+			}
+		}
+	}
+
+	return insertTrailer(lines, start, end, t)
+}
+
+// SetTrailer sets the trailer of the message, replacing the trailers of the
+// same key, compared case insensitively, by the given one, appended to the
+// trailers of the message, or as a new paragraph if it has none. The
+// message returned ends with a newline.
+func SetTrailer(msg string, t Trailer) string {
+	lines := messageLines(msg)
+	start, end := trailerBlock(lines)
+	if start == end {
+		return insertTrailer(lines, start, end, t)
+	}
+
+	kept := append([]string{}, lines[:start]...)
+	removing := false
+	for _, line := range lines[start:end] {
+		if removing && line != "" && isSpace(line[0]) {
+			continue
+		}
+
+		removing = false
+		if pos := trailerSeparator(line); pos >= 1 && strings.EqualFold(strings.TrimSpace(line[:pos]), t.Key) {
+			removing = true
+			continue
+		}
+
+		kept = append(kept, line)
+	}
+
+	newEnd := len(kept)
+	kept = append(kept, lines[end:]...)
+	if newEnd == start {
+		// All the trailers of the block were removed, the blank line
+		// separating it from the body is kept.
+		return insertTrailerAt(kept, newEnd, t)
+	}
+
+	return insertTrailer(kept, start, newEnd, t)
+}
+
+// insertTrailer inserts the trailer at the end of the trailer block of the
+// given lines, from start to end, or as a new paragraph if it's empty.
+func insertTrailer(lines []string, start, end int, t Trailer) string {
+	if start < end {
+		return insertTrailerAt(lines, end, t)
+	}
+
+	// The trailing comments are kept after the new paragraph.
+	i := len(lines)
+	for i > 0 && (isBlankLine(lines[i-1]) || strings.HasPrefix(lines[i-1], "#")) {
+		i--
+	}
+
+	j := i
+	for j < len(lines) && isBlankLine(lines[j]) {
+		j++
+	}
+
+	if i == 0 {
+		return insertTrailerAt(lines[j:], 0, t)
+	}
+
+	lines = append(lines[:i:i], append([]string{""}, lines[j:]...)...)
+	return insertTrailerAt(lines, i+1, t)
+}
+
+func insertTrailerAt(lines []string, i int, t Trailer) string {
+	lines = append(lines[:i:i], append([]string{t.String()}, lines[i:]...)...)
+	return joinMessageLines(lines)
+}
+
+// messageLines returns the lines of the message, without the trailing blank
+// lines.
+func messageLines(msg string) []string {
+	lines := strings.Split(msg, "\n")
+	for len(lines) > 0 && isBlankLine(lines[len(lines)-1]) {
+		lines = lines[:len(lines)-1]
+	}
+
+	return lines
+}
+
+func joinMessageLines(lines []string) string {
+	if len(lines) == 0 {
+		return ""
+	}
+
+	return strings.Join(lines, "\n") + "\n"
+}
+
+// trailerBlock returns the lines of the trailer block of the message, from
+// start to end, empty if there is none, as git does.
+func trailerBlock(lines []string) (start, end int) {
+	// The first paragraph is the title and cannot be trailers.
+	endOfTitle := 0
+	for ; endOfTitle < len(lines); endOfTitle++ {
+		if strings.HasPrefix(lines[endOfTitle], "#") {
+			continue
+		}
+
+		if isBlankLine(lines[endOfTitle]) {
+			break
+		}
+	}
+
+	end = len(lines)
+	onlySpaces := true
+	recognizedPrefix := false
+	trailerLines, nonTrailerLines, possibleContinuationLines := 0, 0, 0
+	for l := len(lines) - 1; l >= endOfTitle; l-- {
+		line := lines[l]
+		if strings.HasPrefix(line, "#") {
+			nonTrailerLines += possibleContinuationLines
+			possibleContinuationLines = 0
+			continue
+		}
+
+		if isBlankLine(line) {
+			if onlySpaces {
+				end = l
+				continue
+			}
+
+			nonTrailerLines += possibleContinuationLines
+			if (recognizedPrefix && trailerLines*3 >= nonTrailerLines) ||
+				(trailerLines > 0 && nonTrailerLines == 0) {
+				return l + 1, end
+			}
+
+			return len(lines), len(lines)
+		}
+
+		onlySpaces = false
+		if hasGitGeneratedPrefix(line) {
+			trailerLines++
+			possibleContinuationLines = 0
+			recognizedPrefix = true
+			continue
+		}
+
+		switch {
+		case trailerSeparator(line) >= 1:
+			trailerLines++
+			possibleContinuationLines = 0
+		case isSpace(line[0]):
+			possibleContinuationLines++
+		default:
+			nonTrailerLines += 1 + possibleContinuationLines
+			possibleContinuationLines = 0
+		}
+	}
+
+	return len(lines), len(lines)
+}
+
+func hasGitGeneratedPrefix(line string) bool {
+	for _, p := range gitGeneratedPrefixes {
+		if strings.HasPrefix(line, p) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// trailerSeparator returns the position of the colon separating the key of a
+// trailer line from its value, the key being made of alphanumeric characters
+// and dashes, optionally followed by whitespace, or -1 if the line isn't a
+// trailer line.
+func trailerSeparator(line string) int {
+	whitespace := false
+	for i := 0; i < len(line); i++ {
+		c := line[i]
+		switch {
+		case !whitespace && (isAlnum(c) || c == '-'):
+		case i > 0 && (c == ' ' || c == '\t'):
+			whitespace = true
+		case c == ':':
+			return i
+		default:
+			return -1
+		}
+	}
+
+	return -1
+}
+
+func isBlankLine(line string) bool {
+	return strings.TrimSpace(line) == ""
+}
+
+func isSpace(c byte) bool {
+	return c == ' ' || c == '\t' || c == '\r' || c == '\n' || c == '\v' || c == '\f'
+}
+
+func isAlnum(c byte) bool {
+	return c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9'
+}
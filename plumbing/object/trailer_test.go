@@ -0,0 +1,129 @@
+package object
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseTrailers(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name string
+		msg  string
+		want []Trailer
+	}{
+		{"title only", "Fix: the parser\n", nil},
+		{"no body", "", nil},
+		{
+			"trailers",
+			"foo\n\nbar\n\nSigned-off-by: Foo <foo@foo.foo>\nCo-authored-by: Bar <bar@bar.bar>\n",
+			[]Trailer{
+				{Key: "Signed-off-by", Value: "Foo <foo@foo.foo>"},
+				{Key: "Co-authored-by", Value: "Bar <bar@bar.bar>"},
+			},
+		},
+		{
+			"body with colons",
+			"foo\n\nThe fix is simple: swap the calls.\nNote: it was broken\nsince the release.\n",
+			nil,
+		},
+		{
+			"body with colons only",
+			"foo\n\nNote: it was broken\nReason: the calls\n\nbar\n",
+			nil,
+		},
+		{
+			"continuation lines",
+			"foo\n\nReviewed-by: Foo\n  <foo@foo.foo>\nBug: 42\n",
+			[]Trailer{
+				{Key: "Reviewed-by", Value: "Foo <foo@foo.foo>"},
+				{Key: "Bug", Value: "42"},
+			},
+		},
+		{
+			"mostly trailers with signed-off-by",
+			"foo\n\nsome text\nSigned-off-by: Foo <foo@foo.foo>\nBug: 42\nAcked-by: Bar\n",
+			[]Trailer{
+				{Key: "Signed-off-by", Value: "Foo <foo@foo.foo>"},
+				{Key: "Bug", Value: "42"},
+				{Key: "Acked-by", Value: "Bar"},
+			},
+		},
+		{
+			"mostly text with signed-off-by",
+			"foo\n\nsome\nlong\ntext\nhere\nSigned-off-by: Foo <foo@foo.foo>\n",
+			nil,
+		},
+		{
+			"mostly trailers without signed-off-by",
+			"foo\n\nsome text\nBug: 42\nAcked-by: Bar\n",
+			nil,
+		},
+		{
+			"comments and trailing blank lines",
+			"foo\n\nBug: 42\n# a comment\n\n\n",
+			[]Trailer{{Key: "Bug", Value: "42"}},
+		},
+		{
+			"space before the separator",
+			"foo\n\nBug : 42\n",
+			[]Trailer{{Key: "Bug", Value: "42"}},
+		},
+	}
+
+	for _, tc := range tests {
+		assert.Equal(t, tc.want, ParseTrailers(tc.msg), tc.name)
+	}
+}
+
+func TestCommitTrailers(t *testing.T) {
+	t.Parallel()
+
+	c := &Commit{Message: "foo\n\nbar\n\nSigned-off-by: Foo <foo@foo.foo>\n"}
+	trailers, err := c.Trailers()
+	require.NoError(t, err)
+	assert.Equal(t, []Trailer{{Key: "Signed-off-by", Value: "Foo <foo@foo.foo>"}}, trailers)
+	assert.Equal(t, "Signed-off-by: Foo <foo@foo.foo>", trailers[0].String())
+}
+
+func TestAppendTrailer(t *testing.T) {
+	t.Parallel()
+
+	bug := Trailer{Key: "Bug", Value: "42"}
+	tests := []struct {
+		msg, want string
+	}{
+		{"", "Bug: 42\n"},
+		{"foo", "foo\n\nBug: 42\n"},
+		{"foo\n\nbar: baz is broken\nsince the release.\n", "foo\n\nbar: baz is broken\nsince the release.\n\nBug: 42\n"},
+		{"foo\n\nAcked-by: Bar\n", "foo\n\nAcked-by: Bar\nBug: 42\n"},
+		{"foo\n\nBug: 42\n\n", "foo\n\nBug: 42\n"},
+		{"foo\n\nBug: 42\nAcked-by: Bar\n", "foo\n\nBug: 42\nAcked-by: Bar\nBug: 42\n"},
+		{"foo\n\n# a comment\n", "foo\n\nBug: 42\n# a comment\n"},
+	}
+
+	for _, tc := range tests {
+		assert.Equal(t, tc.want, AppendTrailer(tc.msg, bug), "%q", tc.msg)
+	}
+}
+
+func TestSetTrailer(t *testing.T) {
+	t.Parallel()
+
+	bug := Trailer{Key: "Bug", Value: "42"}
+	tests := []struct {
+		msg, want string
+	}{
+		{"foo", "foo\n\nBug: 42\n"},
+		{"foo\n\nbug: 1\nAcked-by: Bar\nBug: 2\n  continued\n", "foo\n\nAcked-by: Bar\nBug: 42\n"},
+		{"foo\n\nBug: 1\n", "foo\n\nBug: 42\n"},
+		{"foo\n\nAcked-by: Bar\n", "foo\n\nAcked-by: Bar\nBug: 42\n"},
+	}
+
+	for _, tc := range tests {
+		assert.Equal(t, tc.want, SetTrailer(tc.msg, bug), "%q", tc.msg)
+	}
+}
@@ -199,6 +199,87 @@ func (t *Tree) Files() *FileIter {
 	return NewFileIter(t.s, t)
 }
 
+// SkipDir is used as a return value from a WalkFunc to indicate that the
+// tree named in the call is to be skipped. It is not returned as an error by
+// any function. When returned for an entry which is not a tree, the
+// remaining entries of its parent tree are skipped.
+var SkipDir = errors.New("skip this tree")
+
+// WalkFunc is the type of the function called by Tree.Walk for each entry of
+// the tree and its subtrees, with the path of the entry relative to the tree.
+// If it returns SkipDir for a tree, the subtree is not walked, and if it
+// returns storer.ErrStop the walk stops without an error. Any other error
+// stops the walk and is returned by Tree.Walk.
+type WalkFunc func(path string, entry TreeEntry) error
+
+// WalkOptions describes how a tree is walked by Tree.Walk.
+type WalkOptions struct {
+	// MaxDepth is the maximum depth of the entries walked, the entries of
+	// the tree being at depth 1. If zero, the subtrees are walked at any
+	// depth.
+	MaxDepth int
+}
+
+// Walk calls fn for each entry of the tree and its subtrees, depth first and
+// in the order of the entries, a tree being walked before its entries. Only
+// the subtrees walked are read from the storer, and the blobs are never
+// read. The submodules are not walked.
+func (t *Tree) Walk(fn WalkFunc, opts WalkOptions) error {
+	return t.WalkContext(context.Background(), fn, opts)
+}
+
+// WalkContext is like Walk, but stops with the error of the context once it
+// is done.
+func (t *Tree) WalkContext(ctx context.Context, fn WalkFunc, opts WalkOptions) error {
+	err := t.walk(ctx, "", 1, fn, &opts)
+	if err == storer.ErrStop {
+		return nil
+	}
+
+	return err
+}
+
+func (t *Tree) walk(ctx context.Context, base string, depth int, fn WalkFunc, opts *WalkOptions) error {
+	if depth > maxTreeDepth {
+		return ErrMaxTreeDepth
+	}
+
+	for _, entry := range t.Entries {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		name := simpleJoin(base, entry.Name)
+		err := fn(name, entry)
+		if err == SkipDir {
+			if entry.Mode == filemode.Dir {
+				continue
+			}
+
+			return nil
+		}
+
+		if err != nil {
+			return err
+		}
+
+		if entry.Mode != filemode.Dir || (opts.MaxDepth > 0 && depth >= opts.MaxDepth) {
+			continue
+		}
+
+		tree, err := GetTree(t.s, entry.Hash)
+		if err != nil {
+			return err
+		}
+
+		if err := tree.walk(ctx, name, depth+1, fn, opts); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
 // ID returns the object ID of the tree. The returned value will always match
 // the current value of Tree.Hash.
 //
@@ -256,7 +337,9 @@ func (t *Tree) Decode(o plumbing.EncodedObject) (err error) {
 			return err
 		}
 
+		// The hashes of the entries are in the object format of the tree.
 		var hash plumbing.Hash
+		hash.ResetBySize(t.Hash.Size())
 		if _, err = hash.ReadFrom(r); err != nil {
 			return err
 		}
@@ -372,6 +455,17 @@ func (t *Tree) PatchContext(ctx context.Context, to *Tree) (*Patch, error) {
 	return changes.PatchContext(ctx)
 }
 
+// PatchWithOptions returns the Patch between the trees as PatchContext, the
+// lines being compared as the options say, see Changes.PatchWithOptions.
+func (t *Tree) PatchWithOptions(ctx context.Context, to *Tree, opts *DiffOptions) (*Patch, error) {
+	changes, err := t.DiffContext(ctx, to)
+	if err != nil {
+		return nil, err
+	}
+
+	return changes.PatchWithOptions(ctx, opts)
+}
+
 // treeEntryIter facilitates iterating through the TreeEntry objects in a Tree.
 type treeEntryIter struct {
 	t   *Tree
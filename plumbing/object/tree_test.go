@@ -407,6 +407,101 @@ func (s *TreeSuite) TestTreeWalkerNextNonRecursive() {
 	s.Equal(8, count)
 }
 
+// treeOnlyStorer fails to read any object but the trees.
+type treeOnlyStorer struct {
+	storer.EncodedObjectStorer
+}
+
+func (s treeOnlyStorer) EncodedObject(t plumbing.ObjectType, h plumbing.Hash) (plumbing.EncodedObject, error) {
+	if t != plumbing.TreeObject {
+		return nil, errors.New("unexpected read of a non-tree object")
+	}
+
+	return s.EncodedObjectStorer.EncodedObject(t, h)
+}
+
+func (s *TreeSuite) walkTree(opts WalkOptions, skip string) ([]string, error) {
+	tree, err := GetTree(treeOnlyStorer{s.Storer}, plumbing.NewHash("a8d315b2b1c615d43042c3a62402b8a54288cf5c"))
+	s.Require().NoError(err)
+
+	var paths []string
+	err = tree.Walk(func(path string, entry TreeEntry) error {
+		paths = append(paths, path)
+		if path == skip {
+			return SkipDir
+		}
+
+		return nil
+	}, opts)
+
+	return paths, err
+}
+
+func (s *TreeSuite) TestTreeWalk() {
+	paths, err := s.walkTree(WalkOptions{}, "")
+	s.NoError(err)
+
+	s.Len(paths, len(treeWalkerExpects))
+	for i, e := range treeWalkerExpects {
+		s.Equal(e.Path, paths[i])
+	}
+}
+
+func (s *TreeSuite) TestTreeWalkMaxDepth() {
+	paths, err := s.walkTree(WalkOptions{MaxDepth: 1}, "")
+	s.NoError(err)
+	s.Equal([]string{
+		".gitignore", "CHANGELOG", "LICENSE", "binary.jpg", "go", "json", "php", "vendor",
+	}, paths)
+}
+
+func (s *TreeSuite) TestTreeWalkSkipDir() {
+	paths, err := s.walkTree(WalkOptions{}, "json")
+	s.NoError(err)
+	s.NotContains(paths, "json/long.json")
+	s.Contains(paths, "php/crappy.php")
+	s.Len(paths, len(treeWalkerExpects)-2)
+
+	// Skipping a file skips the remaining entries of its tree.
+	paths, err = s.walkTree(WalkOptions{}, "json/long.json")
+	s.NoError(err)
+	s.NotContains(paths, "json/short.json")
+	s.Contains(paths, "php")
+	s.Len(paths, len(treeWalkerExpects)-1)
+}
+
+func (s *TreeSuite) TestTreeWalkStop() {
+	var paths []string
+	err := s.Tree.Walk(func(path string, entry TreeEntry) error {
+		paths = append(paths, path)
+		if path == "go/example.go" {
+			return storer.ErrStop
+		}
+
+		return nil
+	}, WalkOptions{})
+
+	s.NoError(err)
+	s.Equal([]string{".gitignore", "CHANGELOG", "LICENSE", "binary.jpg", "go", "go/example.go"}, paths)
+}
+
+func (s *TreeSuite) TestTreeWalkContextCancel() {
+	ctx, cancel := context.WithCancel(context.Background())
+
+	var count int
+	err := s.Tree.WalkContext(ctx, func(path string, entry TreeEntry) error {
+		count++
+		if count == 2 {
+			cancel()
+		}
+
+		return nil
+	}, WalkOptions{})
+
+	s.ErrorIs(err, context.Canceled)
+	s.Equal(2, count)
+}
+
 func (s *TreeSuite) TestPatchContext_ToNil() {
 	commit := s.commit(plumbing.NewHash("6ecf0ef2c2dffb796033e5a02219af86ec6584e5"))
 	tree, err := commit.Tree()
@@ -1,8 +1,6 @@
 package object
 
 import (
-	"io"
-
 	"github.com/go-git/go-git/v6/plumbing"
 	"github.com/go-git/go-git/v6/plumbing/filemode"
 	"github.com/go-git/go-git/v6/utils/merkletrie/noder"
@@ -83,7 +81,7 @@ func (t *treeNoder) Children() ([]noder.Noder, error) {
 	parent := t.parent
 	if !t.isRoot() {
 		var err error
-		if parent, err = t.parent.Tree(t.name); err != nil {
+		if parent, err = GetTree(t.parent.s, t.hash); err != nil {
 			return nil, err
 		}
 	}
@@ -94,29 +92,11 @@ func (t *treeNoder) Children() ([]noder.Noder, error) {
 }
 
 // Returns the children of a tree as treenoders.
-// Efficiency is key here.
+// Efficiency is key here: the subtrees are not read until their own
+// children are needed.
 func transformChildren(t *Tree) ([]noder.Noder, error) {
-	var err error
-	var e TreeEntry
-
-	// there will be more tree entries than children in the tree,
-	// due to submodules and empty directories, but I think it is still
-	// worth it to pre-allocate the whole array now, even if sometimes
-	// is bigger than needed.
 	ret := make([]noder.Noder, 0, len(t.Entries))
-
-	walker := NewTreeWalker(t, false, nil) // don't recurse
-	// don't defer walker.Close() for efficiency reasons.
-	for {
-		_, e, err = walker.Next()
-		if err == io.EOF {
-			break
-		}
-		if err != nil {
-			walker.Close()
-			return nil, err
-		}
-
+	for _, e := range t.Entries {
 		ret = append(ret, &treeNoder{
 			parent: t,
 			name:   e.Name,
@@ -124,14 +104,12 @@ func transformChildren(t *Tree) ([]noder.Noder, error) {
 			hash:   e.Hash,
 		})
 	}
-	walker.Close()
 
 	return ret, nil
 }
 
-// len(t.tree.Entries) != the number of elements walked by treewalker
-// for some reason because of empty directories, submodules, etc, so we
-// have to walk here.
+// NumChildren returns the number of entries of the tree, which have to be
+// read for the subtrees.
 func (t *treeNoder) NumChildren() (int, error) {
 	children, err := t.Children()
 	if err != nil {
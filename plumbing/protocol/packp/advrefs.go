@@ -74,11 +74,25 @@ func (a *AdvRefs) addRefs(s storer.ReferenceStorer) error {
 		}
 	}
 
-	if a.supportSymrefs() {
-		return a.addSymbolicRefs(s)
+	if !a.supportSymrefs() {
+		return a.resolveHead(s)
 	}
 
-	return a.resolveHead(s)
+	if err := a.addSymbolicRefs(s); err != nil {
+		return err
+	}
+
+	// HEAD is detached if it is not one of the advertised symrefs.
+	if a.Head == nil {
+		return nil
+	}
+
+	_, err := s.Reference(plumbing.HEAD)
+	if errors.Is(err, plumbing.ErrReferenceNotFound) {
+		return s.SetReference(plumbing.NewHashReference(plumbing.HEAD, *a.Head))
+	}
+
+	return err
 }
 
 // If the server does not support symrefs capability,
@@ -182,7 +196,7 @@ func (a *AdvRefs) addSymbolicRefs(s storer.ReferenceStorer) error {
 		target := plumbing.ReferenceName(chunks[1])
 		ref := plumbing.NewSymbolicReference(name, target)
 		if err := s.SetReference(ref); err != nil {
-			return nil
+			return err
 		}
 	}
 
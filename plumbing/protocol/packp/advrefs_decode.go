@@ -105,20 +105,20 @@ func decodeFirstHash(p *advRefsDecoder) decoderStateFn {
 		return nil
 	}
 
-	// TODO: Use object-format (when available) for hash size. Git 2.41+
 	if len(p.line) < hashSize {
 		p.error("cannot read hash, pkt-line too short")
 		return nil
 	}
 
-	h, ok := plumbing.FromHex(string(p.line[:hashSize]))
+	size := hexHashSize(p.line)
+	h, ok := plumbing.FromHex(string(p.line[:size]))
 	if !ok {
-		p.error("invalid hash text: %s", p.line[:hashSize])
+		p.error("invalid hash text: %s", p.line[:size])
 		return nil
 	}
 
 	p.hash = h
-	p.line = p.line[hashSize:]
+	p.line = p.line[size:]
 
 	if p.hash.IsZero() {
 		return decodeSkipNoRefs
@@ -235,13 +235,13 @@ func decodeShallow(p *advRefsDecoder) decoderStateFn {
 	}
 	p.line = bytes.TrimPrefix(p.line, shallow)
 
-	if len(p.line) != hashSize {
+	if len(p.line) != hashSize && len(p.line) != hexHashSize(p.line) {
 		p.error("malformed shallow hash: wrong length, expected 40 bytes, read %d bytes",
 			len(p.line))
 		return nil
 	}
 
-	text := p.line[:hashSize]
+	text := p.line
 	h, ok := plumbing.FromHex(string(text))
 	if !ok {
 		p.error("invalid hash text: %s", string(text))
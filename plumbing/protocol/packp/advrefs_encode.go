@@ -3,9 +3,11 @@ package packp
 import (
 	"fmt"
 	"io"
+	"slices"
 	"sort"
 
 	"github.com/go-git/go-git/v6/plumbing"
+	format "github.com/go-git/go-git/v6/plumbing/format/config"
 	"github.com/go-git/go-git/v6/plumbing/format/pktline"
 	"github.com/go-git/go-git/v6/plumbing/protocol/packp/capability"
 )
@@ -92,7 +94,13 @@ func encodeFirstLine(e *advRefsEncoder) encoderStateFn {
 	capabilities := formatCaps(e.data.Capabilities)
 
 	if e.firstRefName == "" {
-		firstLine = fmt.Sprintf(formatFirstLine, plumbing.ZeroHash.String(), "capabilities^{}", capabilities)
+		// The zero-id is the one of the object format of the repository.
+		var zero plumbing.Hash
+		if e.data.Capabilities != nil && slices.Contains(e.data.Capabilities.Get(capability.ObjectFormat), format.SHA256.String()) {
+			zero.ResetBySize(format.SHA256Size)
+		}
+
+		firstLine = fmt.Sprintf(formatFirstLine, zero.String(), "capabilities^{}", capabilities)
 	} else {
 		firstLine = fmt.Sprintf(formatFirstLine, e.firstRefHash.String(), e.firstRefName, capabilities)
 	}
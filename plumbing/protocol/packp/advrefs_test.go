@@ -161,6 +161,21 @@ func (s *AdvRefSuite) TestNoSymRefCapabilityHeadToNoMasterAlphabeticallyOrdered(
 	s.Equal(ref2.Name(), head.Target())
 }
 
+func (s *AdvRefSuite) TestSymRefCapabilityDetachedHead() {
+	a := NewAdvRefs()
+	headHash := plumbing.NewHash("5dc01c595e6c6ec9ccda4f6f69c131c0dd945f8c")
+	a.Head = &headHash
+	s.NoError(a.AddReference(plumbing.NewHashReference(plumbing.Master, headHash)))
+	s.NoError(a.AddReference(plumbing.NewSymbolicReference("refs/remotes/origin/HEAD", "refs/remotes/origin/main")))
+
+	storage, err := a.AllReferences()
+	s.NoError(err)
+
+	head, err := storage.Reference(plumbing.HEAD)
+	s.NoError(err)
+	s.Equal(plumbing.NewHashReference(plumbing.HEAD, headHash), head)
+}
+
 type AdvRefsDecodeEncodeSuite struct {
 	suite.Suite
 }
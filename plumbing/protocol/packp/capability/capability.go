@@ -248,6 +248,22 @@ const (
 	// Filter if present, fetch-pack may send "filter" commands to request a
 	// partial clone or partial fetch and request that the server omit various objects from the packfile
 	Filter Capability = "filter"
+
+	// The following capabilities are only advertised with protocol v2, where
+	// they name the commands that the server is able to run. The values of a
+	// command capability are the features the command supports.
+
+	// LsRefs is the command used to request the references of the
+	// repository, optionally filtered by prefix.
+	LsRefs Capability = "ls-refs"
+	// Fetch is the command used to negotiate and request a packfile.
+	Fetch Capability = "fetch"
+	// ServerOption if present, the client may send server specific options
+	// along with any command.
+	ServerOption Capability = "server-option"
+	// ObjectInfo is the command used to request information about objects,
+	// such as their size, without fetching them.
+	ObjectInfo Capability = "object-info"
 )
 
 const userAgent = "go-git/6.x"
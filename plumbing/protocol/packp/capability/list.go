@@ -76,6 +76,29 @@ func (l *List) Decode(raw []byte) error {
 	return nil
 }
 
+// DecodeV2 decodes a single protocol v2 capability line, in the form
+// key[=value], into the list. The value of a capability that is not known to
+// take a single argument, such as a command, is the space separated list of
+// the features it supports; each one of them is added as a value.
+func (l *List) DecodeV2(line []byte) error {
+	line = bytes.TrimSpace(line)
+	if len(line) == 0 {
+		return nil
+	}
+
+	pair := bytes.SplitN(line, []byte{'='}, 2)
+	c := Capability(pair[0])
+	if len(pair) == 1 {
+		return l.Add(c)
+	}
+
+	if known[c] && !multipleArgument[c] {
+		return l.Add(c, string(pair[1]))
+	}
+
+	return l.Add(c, strings.Fields(string(pair[1]))...)
+}
+
 // Get returns the values for a capability
 func (l *List) Get(capability Capability) []string {
 	if _, ok := l.m[capability]; !ok {
@@ -87,6 +87,20 @@ func (s *SuiteCapabilities) TestDecodeWithUnknownCapabilityWithMultipleArgument(
 	s.Nil(cap.Get(ThinPack))
 }
 
+func (s *SuiteCapabilities) TestDecodeV2() {
+	cap := NewList()
+	s.NoError(cap.DecodeV2([]byte("agent=git/2.39.5 extra\n")))
+	s.NoError(cap.DecodeV2([]byte("ls-refs=unborn\n")))
+	s.NoError(cap.DecodeV2([]byte("fetch=shallow wait-for-done filter\n")))
+	s.NoError(cap.DecodeV2([]byte("server-option\n")))
+
+	s.Equal([]string{"git/2.39.5 extra"}, cap.Get(Agent))
+	s.Equal([]string{"unborn"}, cap.Get(LsRefs))
+	s.Equal([]string{"shallow", "wait-for-done", "filter"}, cap.Get(Fetch))
+	s.True(cap.Supports(ServerOption))
+	s.Nil(cap.Get(ServerOption))
+}
+
 func (s *SuiteCapabilities) TestString() {
 	cap := NewList()
 	cap.Set(Agent, "bar")
@@ -2,6 +2,8 @@ package packp
 
 import (
 	"fmt"
+
+	format "github.com/go-git/go-git/v6/plumbing/format/config"
 )
 
 type stateFn func() stateFn
@@ -44,6 +46,23 @@ var (
 	shallowNoSp = []byte("shallow")
 )
 
+// hexHashSize returns the size of the hexadecimal object id starting data,
+// the one of a SHA-256 object id if it starts with as many hexadecimal
+// digits, or else the one of a SHA-1 object id.
+func hexHashSize(data []byte) int {
+	if len(data) < format.SHA256HexSize {
+		return hashSize
+	}
+
+	for _, c := range data[:format.SHA256HexSize] {
+		if !('0' <= c && c <= '9' || 'a' <= c && c <= 'f' || 'A' <= c && c <= 'F') {
+			return hashSize
+		}
+	}
+
+	return format.SHA256HexSize
+}
+
 func isFlush(payload []byte) bool {
 	return len(payload) == 0
 }
@@ -0,0 +1,260 @@
+package packp
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/go-git/go-git/v6/plumbing"
+	"github.com/go-git/go-git/v6/plumbing/format/pktline"
+	"github.com/go-git/go-git/v6/plumbing/protocol/packp/capability"
+)
+
+// Sections of the response to the protocol v2 fetch command.
+const (
+	acknowledgmentsSection = "acknowledgments"
+	shallowInfoSection     = "shallow-info"
+	wantedRefsSection      = "wanted-refs"
+	packfileURIsSection    = "packfile-uris"
+	packfileSection        = "packfile"
+)
+
+// ErrNoPackfile is returned when the response to the fetch command ends
+// without a packfile section.
+var ErrNoPackfile = errors.New("no packfile in fetch response")
+
+// FetchV2Request is the protocol v2 fetch command. Unlike the protocol v0
+// upload-request, the same message carries the wants, the haves and the
+// options of the request.
+// See https://git-scm.com/docs/protocol-v2#_fetch
+type FetchV2Request struct {
+	// Capabilities are the capabilities sent along with the command, such
+	// as the agent and the object-format.
+	Capabilities *capability.List
+	// Wants are the objects the client wants.
+	Wants []plumbing.Hash
+	// WantRefs are the references the client wants, by name. Requires the
+	// server to support the ref-in-want fetch feature.
+	WantRefs []plumbing.ReferenceName
+	// Haves are the objects the client already has.
+	Haves []plumbing.Hash
+	// Done tells the server to send the packfile without waiting for more
+	// haves.
+	Done bool
+	// Shallows are the shallow commits of the client.
+	Shallows []plumbing.Hash
+	// Depth is the depth of the requested history, in commits.
+	Depth int
+	// DeepenRelative makes Depth relative to the shallow boundary of the
+	// client, instead of to the wanted commits.
+	DeepenRelative bool
+	// DeepenSince limits the history to the commits more recent than the
+	// given time.
+	DeepenSince time.Time
+	// DeepenNot are the references whose history is excluded.
+	DeepenNot []string
+	// Filter is the filter applied to the objects of the packfile.
+	Filter Filter
+	// OFSDelta requests offset deltas in the packfile.
+	OFSDelta bool
+	// NoProgress requests the server not to send progress messages.
+	NoProgress bool
+	// IncludeTag requests the annotated tags pointing to the sent objects.
+	IncludeTag bool
+}
+
+// NewFetchV2Request returns a new FetchV2Request ready to be used.
+func NewFetchV2Request() *FetchV2Request {
+	return &FetchV2Request{
+		Capabilities: capability.NewList(),
+	}
+}
+
+// Encode writes the fetch command to w.
+func (r *FetchV2Request) Encode(w io.Writer) error {
+	if err := encodeCommand(w, capability.Fetch, r.Capabilities); err != nil {
+		return err
+	}
+
+	for _, arg := range []struct {
+		name string
+		set  bool
+	}{
+		{"ofs-delta", r.OFSDelta},
+		{"no-progress", r.NoProgress},
+		{"include-tag", r.IncludeTag},
+	} {
+		if !arg.set {
+			continue
+		}
+
+		if _, err := pktline.Writeln(w, arg.name); err != nil {
+			return fmt.Errorf("sending %s: %w", arg.name, err)
+		}
+	}
+
+	for _, s := range r.Shallows {
+		if _, err := pktline.Writef(w, "shallow %s\n", s); err != nil {
+			return fmt.Errorf("sending shallows: %w", err)
+		}
+	}
+
+	if r.Depth > 0 {
+		if _, err := pktline.Writef(w, "deepen %d\n", r.Depth); err != nil {
+			return fmt.Errorf("sending depth: %w", err)
+		}
+
+		if r.DeepenRelative {
+			if _, err := pktline.Writeln(w, "deepen-relative"); err != nil {
+				return fmt.Errorf("sending deepen-relative: %w", err)
+			}
+		}
+	}
+
+	if !r.DeepenSince.IsZero() {
+		if _, err := pktline.Writef(w, "deepen-since %d\n", r.DeepenSince.Unix()); err != nil {
+			return fmt.Errorf("sending deepen-since: %w", err)
+		}
+	}
+
+	for _, ref := range r.DeepenNot {
+		if _, err := pktline.Writef(w, "deepen-not %s\n", ref); err != nil {
+			return fmt.Errorf("sending deepen-not: %w", err)
+		}
+	}
+
+	if r.Filter != "" {
+		if _, err := pktline.Writef(w, "filter %s\n", r.Filter); err != nil {
+			return fmt.Errorf("sending filter: %w", err)
+		}
+	}
+
+	for _, want := range r.Wants {
+		if _, err := pktline.Writef(w, "want %s\n", want); err != nil {
+			return fmt.Errorf("sending wants: %w", err)
+		}
+	}
+
+	for _, name := range r.WantRefs {
+		if _, err := pktline.Writef(w, "want-ref %s\n", name); err != nil {
+			return fmt.Errorf("sending want-refs: %w", err)
+		}
+	}
+
+	for _, have := range r.Haves {
+		if _, err := pktline.Writef(w, "have %s\n", have); err != nil {
+			return fmt.Errorf("sending haves: %w", err)
+		}
+	}
+
+	if r.Done {
+		if _, err := pktline.Writeln(w, "done"); err != nil {
+			return fmt.Errorf("sending done: %w", err)
+		}
+	}
+
+	return pktline.WriteFlush(w)
+}
+
+// FetchV2Response is the response to the fetch command, up to the packfile
+// section. Once decoded, the reader is positioned at the start of the
+// packfile data, which is always multiplexed using side-band-64k.
+type FetchV2Response struct {
+	// ACKs are the objects acknowledged as common by the server.
+	ACKs []plumbing.Hash
+	// Ready is true when the server is ready to send a packfile.
+	Ready bool
+	// ShallowUpdate holds the shallow-info section of the response.
+	ShallowUpdate ShallowUpdate
+	// WantedRefs are the references requested by name, resolved by the
+	// server.
+	WantedRefs []*plumbing.Reference
+	// PackfileURIs are the URIs of the packfiles the client must download
+	// on its own, in the form "<hash> <uri>".
+	PackfileURIs []string
+}
+
+// Decode reads the sections of the response from r, up to the header of
+// the packfile section. ErrNoPackfile is returned if the response ends
+// before it.
+func (r *FetchV2Response) Decode(rd io.Reader) error {
+	var section string
+	for {
+		l, line, err := pktline.ReadLine(rd)
+		if err != nil {
+			return fmt.Errorf("decoding fetch response: %w", err)
+		}
+
+		switch l {
+		case pktline.Flush, pktline.ResponseEnd:
+			return ErrNoPackfile
+		case pktline.Delim:
+			section = ""
+			continue
+		}
+
+		line = bytes.TrimSuffix(line, eol)
+		if section == "" {
+			section = string(line)
+			if section == packfileSection {
+				return nil
+			}
+
+			continue
+		}
+
+		if err := r.decodeLine(section, line); err != nil {
+			return err
+		}
+	}
+}
+
+func (r *FetchV2Response) decodeLine(section string, line []byte) error {
+	switch section {
+	case acknowledgmentsSection:
+		switch {
+		case bytes.Equal(line, nak):
+		case bytes.Equal(line, []byte("ready")):
+			r.Ready = true
+		case bytes.HasPrefix(line, ack):
+			hash, ok := plumbing.FromHex(string(bytes.TrimPrefix(line, []byte("ACK "))))
+			if !ok {
+				return NewErrUnexpectedData("invalid ACK", line)
+			}
+
+			r.ACKs = append(r.ACKs, hash)
+		default:
+			return NewErrUnexpectedData("unexpected acknowledgment", line)
+		}
+	case shallowInfoSection:
+		switch {
+		case bytes.HasPrefix(line, shallow):
+			return r.ShallowUpdate.decodeShallowLine(line)
+		case bytes.HasPrefix(line, unshallow):
+			return r.ShallowUpdate.decodeUnshallowLine(line)
+		default:
+			return NewErrUnexpectedData("unexpected shallow-info", line)
+		}
+	case wantedRefsSection:
+		chunks := bytes.SplitN(line, sp, 2)
+		if len(chunks) != 2 {
+			return NewErrUnexpectedData("malformed wanted-ref", line)
+		}
+
+		hash, ok := plumbing.FromHex(string(chunks[0]))
+		if !ok {
+			return NewErrUnexpectedData("invalid wanted-ref", line)
+		}
+
+		ref := plumbing.NewHashReference(plumbing.ReferenceName(chunks[1]), hash)
+		r.WantedRefs = append(r.WantedRefs, ref)
+	case packfileURIsSection:
+		r.PackfileURIs = append(r.PackfileURIs, string(line))
+	default:
+		return NewErrUnexpectedData("unknown fetch response section", []byte(section))
+	}
+
+	return nil
+}
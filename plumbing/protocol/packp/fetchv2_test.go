@@ -0,0 +1,91 @@
+package packp
+
+import (
+	"bytes"
+	"io"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/go-git/go-git/v6/plumbing"
+	"github.com/go-git/go-git/v6/plumbing/format/pktline"
+)
+
+func TestFetchV2RequestEncode(t *testing.T) {
+	req := NewFetchV2Request()
+	req.OFSDelta = true
+	req.NoProgress = true
+	req.Depth = 1
+	req.Filter = FilterBlobNone()
+	req.Wants = []plumbing.Hash{plumbing.NewHash("6ecf0ef2c2dffb796033e5a02219af86ec6584e5")}
+	req.WantRefs = []plumbing.ReferenceName{"refs/heads/main"}
+	req.Haves = []plumbing.Hash{plumbing.NewHash("918c48b83bd081e863dbe1b80f8998f058cd8294")}
+	req.Done = true
+
+	var buf bytes.Buffer
+	require.NoError(t, req.Encode(&buf))
+	assert.Equal(t,
+		"0012command=fetch\n"+
+			"0001"+
+			"000eofs-delta\n"+
+			"0010no-progress\n"+
+			"000ddeepen 1\n"+
+			"0015filter blob:none\n"+
+			"0032want 6ecf0ef2c2dffb796033e5a02219af86ec6584e5\n"+
+			"001dwant-ref refs/heads/main\n"+
+			"0032have 918c48b83bd081e863dbe1b80f8998f058cd8294\n"+
+			"0009done\n"+
+			"0000",
+		buf.String())
+}
+
+func TestFetchV2ResponseDecode(t *testing.T) {
+	var buf bytes.Buffer
+	pktline.Writeln(&buf, "acknowledgments")
+	pktline.Writeln(&buf, "ACK 918c48b83bd081e863dbe1b80f8998f058cd8294")
+	pktline.Writeln(&buf, "ready")
+	pktline.WriteDelim(&buf)
+	pktline.Writeln(&buf, "shallow-info")
+	pktline.Writeln(&buf, "shallow 6ecf0ef2c2dffb796033e5a02219af86ec6584e5")
+	pktline.WriteDelim(&buf)
+	pktline.Writeln(&buf, "wanted-refs")
+	pktline.Writeln(&buf, "6ecf0ef2c2dffb796033e5a02219af86ec6584e5 refs/heads/main")
+	pktline.WriteDelim(&buf)
+	pktline.Writeln(&buf, "packfile")
+	pktline.Write(&buf, []byte("\x01PACK"))
+	pktline.WriteFlush(&buf)
+
+	var res FetchV2Response
+	require.NoError(t, res.Decode(&buf))
+	assert.True(t, res.Ready)
+	assert.Equal(t, []plumbing.Hash{plumbing.NewHash("918c48b83bd081e863dbe1b80f8998f058cd8294")}, res.ACKs)
+	assert.Equal(t, []plumbing.Hash{plumbing.NewHash("6ecf0ef2c2dffb796033e5a02219af86ec6584e5")}, res.ShallowUpdate.Shallows)
+	assert.Equal(t, []*plumbing.Reference{
+		plumbing.NewReferenceFromStrings("refs/heads/main", "6ecf0ef2c2dffb796033e5a02219af86ec6584e5"),
+	}, res.WantedRefs)
+
+	// The packfile section is left to be read.
+	_, p, err := pktline.ReadLine(&buf)
+	require.NoError(t, err)
+	assert.Equal(t, []byte("\x01PACK"), p)
+}
+
+func TestFetchV2ResponseDecodeNoPackfile(t *testing.T) {
+	var buf bytes.Buffer
+	pktline.Writeln(&buf, "acknowledgments")
+	pktline.Writeln(&buf, "NAK")
+	pktline.WriteFlush(&buf)
+
+	var res FetchV2Response
+	assert.ErrorIs(t, res.Decode(&buf), ErrNoPackfile)
+}
+
+func TestFetchV2ResponseDecodeError(t *testing.T) {
+	var buf bytes.Buffer
+	pktline.WriteError(&buf, io.ErrUnexpectedEOF)
+
+	var res FetchV2Response
+	var errLine *pktline.ErrorLine
+	assert.ErrorAs(t, res.Decode(&buf), &errLine)
+}
@@ -0,0 +1,171 @@
+package packp
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+
+	"github.com/go-git/go-git/v6/plumbing"
+	"github.com/go-git/go-git/v6/plumbing/format/pktline"
+	"github.com/go-git/go-git/v6/plumbing/protocol/packp/capability"
+)
+
+var (
+	symrefTarget = []byte("symref-target:")
+	peeledAttr   = []byte("peeled:")
+	unborn       = []byte("unborn")
+)
+
+// LsRefsRequest is the protocol v2 ls-refs command. It requests the server
+// to list the references of the repository.
+// See https://git-scm.com/docs/protocol-v2#_ls_refs
+type LsRefsRequest struct {
+	// Capabilities are the capabilities sent along with the command, such
+	// as the agent and the object-format.
+	Capabilities *capability.List
+	// Peel requests the peeled value of annotated tags.
+	Peel bool
+	// Symrefs requests the target of symbolic references.
+	Symrefs bool
+	// RefPrefixes limits the listed references to the ones whose name
+	// starts with one of the prefixes. All the references are listed when
+	// empty.
+	RefPrefixes []string
+}
+
+// NewLsRefsRequest returns a new LsRefsRequest that asks for the peeled tags
+// and the symbolic references targets.
+func NewLsRefsRequest() *LsRefsRequest {
+	return &LsRefsRequest{
+		Capabilities: capability.NewList(),
+		Peel:         true,
+		Symrefs:      true,
+	}
+}
+
+// Encode writes the ls-refs command to w.
+func (r *LsRefsRequest) Encode(w io.Writer) error {
+	if err := encodeCommand(w, capability.LsRefs, r.Capabilities); err != nil {
+		return err
+	}
+
+	if r.Peel {
+		if _, err := pktline.Writeln(w, "peel"); err != nil {
+			return err
+		}
+	}
+
+	if r.Symrefs {
+		if _, err := pktline.Writeln(w, "symrefs"); err != nil {
+			return err
+		}
+	}
+
+	for _, prefix := range r.RefPrefixes {
+		if _, err := pktline.Writef(w, "ref-prefix %s\n", prefix); err != nil {
+			return fmt.Errorf("sending ref-prefix %q: %w", prefix, err)
+		}
+	}
+
+	return pktline.WriteFlush(w)
+}
+
+// LsRefsResponse is the response to the ls-refs command.
+type LsRefsResponse struct {
+	// References are the listed references and the object they point to.
+	// Symbolic references are included, pointing to the object of their
+	// target.
+	References map[string]plumbing.Hash
+	// Symrefs maps the symbolic references to their target.
+	Symrefs map[string]string
+	// Peeled are the peeled values of the annotated tags.
+	Peeled map[string]plumbing.Hash
+}
+
+// NewLsRefsResponse returns a new LsRefsResponse ready to be used.
+func NewLsRefsResponse() *LsRefsResponse {
+	return &LsRefsResponse{
+		References: make(map[string]plumbing.Hash),
+		Symrefs:    make(map[string]string),
+		Peeled:     make(map[string]plumbing.Hash),
+	}
+}
+
+// Decode reads the response from r, up to the flush-pkt that ends it.
+func (r *LsRefsResponse) Decode(rd io.Reader) error {
+	for {
+		l, line, err := pktline.ReadLine(rd)
+		if err != nil {
+			return fmt.Errorf("decoding ls-refs response: %w", err)
+		}
+
+		if l == pktline.Flush {
+			return nil
+		}
+
+		if err := r.decodeLine(bytes.TrimSuffix(line, eol)); err != nil {
+			return err
+		}
+	}
+}
+
+func (r *LsRefsResponse) decodeLine(line []byte) error {
+	fields := bytes.Split(line, sp)
+	if len(fields) < 2 {
+		return NewErrUnexpectedData("malformed ls-refs line", line)
+	}
+
+	// Unborn references are only listed on request, and have no object.
+	if bytes.Equal(fields[0], unborn) {
+		return nil
+	}
+
+	hash, ok := plumbing.FromHex(string(fields[0]))
+	if !ok {
+		return NewErrUnexpectedData("invalid object id", fields[0])
+	}
+
+	name := string(fields[1])
+	r.References[name] = hash
+	for _, attr := range fields[2:] {
+		switch {
+		case bytes.HasPrefix(attr, symrefTarget):
+			r.Symrefs[name] = string(attr[len(symrefTarget):])
+		case bytes.HasPrefix(attr, peeledAttr):
+			peeled, ok := plumbing.FromHex(string(attr[len(peeledAttr):]))
+			if !ok {
+				return NewErrUnexpectedData("invalid peeled object id", attr)
+			}
+
+			r.Peeled[name] = peeled
+		}
+	}
+
+	return nil
+}
+
+// AdvRefs returns the listed references as an AdvRefs, so that they can be
+// handled the same way as the references advertised with protocol v0 and v1.
+func (r *LsRefsResponse) AdvRefs() (*AdvRefs, error) {
+	ar := NewAdvRefs()
+	for name, hash := range r.References {
+		if name == head {
+			ar.Head = &hash
+		} else {
+			ar.References[name] = hash
+		}
+	}
+
+	for name, target := range r.Symrefs {
+		ref := plumbing.NewSymbolicReference(plumbing.ReferenceName(name), plumbing.ReferenceName(target))
+		if err := ar.AddReference(ref); err != nil {
+			return nil, err
+		}
+	}
+
+	for name, hash := range r.Peeled {
+		ar.Peeled[name] = hash
+	}
+
+	return ar, nil
+}
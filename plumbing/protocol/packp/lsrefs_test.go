@@ -0,0 +1,97 @@
+package packp
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/go-git/go-git/v6/plumbing"
+	"github.com/go-git/go-git/v6/plumbing/format/pktline"
+	"github.com/go-git/go-git/v6/plumbing/protocol/packp/capability"
+)
+
+func TestCapabilityAdvertisementDecode(t *testing.T) {
+	var buf bytes.Buffer
+	pktline.Writeln(&buf, "agent=git/2.39.5")
+	pktline.Writeln(&buf, "ls-refs=unborn")
+	pktline.Writeln(&buf, "fetch=shallow wait-for-done filter")
+	pktline.Writeln(&buf, "object-format=sha1")
+	pktline.WriteFlush(&buf)
+
+	adv := NewCapabilityAdvertisement()
+	require.NoError(t, adv.Decode(&buf))
+	assert.Equal(t, []string{"git/2.39.5"}, adv.Capabilities.Get(capability.Agent))
+	assert.Equal(t, []string{"unborn"}, adv.Capabilities.Get(capability.LsRefs))
+	assert.Equal(t, []string{"shallow", "wait-for-done", "filter"}, adv.Capabilities.Get(capability.Fetch))
+	assert.Equal(t, []string{"sha1"}, adv.Capabilities.Get(capability.ObjectFormat))
+}
+
+func TestCapabilityAdvertisementEncode(t *testing.T) {
+	adv := NewCapabilityAdvertisement()
+	adv.Capabilities.Add(capability.Agent, "go-git/6.x")
+	adv.Capabilities.Add(capability.Fetch, "shallow", "filter")
+
+	var buf bytes.Buffer
+	require.NoError(t, adv.Encode(&buf))
+	assert.Equal(t,
+		"000eversion 2\n"+
+			"0015agent=go-git/6.x\n"+
+			"0019fetch=shallow filter\n"+
+			"0000",
+		buf.String())
+}
+
+func TestLsRefsRequestEncode(t *testing.T) {
+	req := NewLsRefsRequest()
+	req.Capabilities.Set(capability.Agent, "go-git/6.x")
+	req.RefPrefixes = []string{"HEAD", "refs/heads/main"}
+
+	var buf bytes.Buffer
+	require.NoError(t, req.Encode(&buf))
+	assert.Equal(t,
+		"0014command=ls-refs\n"+
+			"0015agent=go-git/6.x\n"+
+			"0001"+
+			"0009peel\n"+
+			"000csymrefs\n"+
+			"0014ref-prefix HEAD\n"+
+			"001fref-prefix refs/heads/main\n"+
+			"0000",
+		buf.String())
+}
+
+func TestLsRefsResponseDecode(t *testing.T) {
+	var buf bytes.Buffer
+	pktline.Writeln(&buf, "6ecf0ef2c2dffb796033e5a02219af86ec6584e5 HEAD symref-target:refs/heads/master")
+	pktline.Writeln(&buf, "6ecf0ef2c2dffb796033e5a02219af86ec6584e5 refs/heads/master")
+	pktline.Writeln(&buf, "b029517f6300c2da0f4b651b8642506cd6aaf45d refs/tags/v1.0.0 peeled:6ecf0ef2c2dffb796033e5a02219af86ec6584e5")
+	pktline.WriteFlush(&buf)
+
+	res := NewLsRefsResponse()
+	require.NoError(t, res.Decode(&buf))
+	assert.Len(t, res.References, 3)
+	assert.Equal(t, map[string]string{"HEAD": "refs/heads/master"}, res.Symrefs)
+	assert.Equal(t, plumbing.NewHash("6ecf0ef2c2dffb796033e5a02219af86ec6584e5"), res.Peeled["refs/tags/v1.0.0"])
+
+	ar, err := res.AdvRefs()
+	require.NoError(t, err)
+	refs, err := ar.MakeReferenceSlice()
+	require.NoError(t, err)
+	assert.Equal(t, []*plumbing.Reference{
+		plumbing.NewSymbolicReference(plumbing.HEAD, "refs/heads/master"),
+		plumbing.NewReferenceFromStrings("refs/heads/master", "6ecf0ef2c2dffb796033e5a02219af86ec6584e5"),
+		plumbing.NewReferenceFromStrings("refs/tags/v1.0.0", "b029517f6300c2da0f4b651b8642506cd6aaf45d"),
+		plumbing.NewReferenceFromStrings("refs/tags/v1.0.0^{}", "6ecf0ef2c2dffb796033e5a02219af86ec6584e5"),
+	}, refs)
+}
+
+func TestLsRefsResponseDecodeMalformed(t *testing.T) {
+	var buf bytes.Buffer
+	pktline.Writeln(&buf, "foo refs/heads/master")
+	pktline.WriteFlush(&buf)
+
+	res := NewLsRefsResponse()
+	assert.Error(t, res.Decode(&buf))
+}
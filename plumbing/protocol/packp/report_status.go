@@ -36,8 +36,26 @@ func (e CommandStatusErr) Error() string {
 	return fmt.Sprintf("command error on %s: %s", e.ReferenceName.String(), e.Status)
 }
 
+// ReportError is the error of a report status which is not ok. It wraps the
+// error returned by ReportStatus.Error, and holds the whole report so that the
+// status of each command can be known.
+type ReportError struct {
+	Report *ReportStatus
+}
+
+// Error implements the error interface.
+func (e *ReportError) Error() string {
+	return e.Report.Error().Error()
+}
+
+// Unwrap returns the first error of the report.
+func (e *ReportError) Unwrap() error {
+	return e.Report.Error()
+}
+
 // ReportStatus is a report status message, as used in the git-receive-pack
-// process whenever the 'report-status' capability is negotiated.
+// process whenever the 'report-status' or 'report-status-v2' capability is
+// negotiated.
 type ReportStatus struct {
 	UnpackStatus    string
 	CommandStatuses []*CommandStatus
@@ -157,6 +175,10 @@ func (s *ReportStatus) decodeCommandStatus(b []byte) error {
 	b = bytes.TrimSuffix(b, eol)
 
 	line := string(b)
+	if strings.HasPrefix(line, "option ") {
+		return s.decodeCommandOption(line)
+	}
+
 	fields := strings.SplitN(line, " ", 3)
 	status := ok
 	if len(fields) == 3 && fields[0] == "ng" {
@@ -173,11 +195,59 @@ func (s *ReportStatus) decodeCommandStatus(b []byte) error {
 	return nil
 }
 
+// decodeCommandOption decodes an option line of report-status-v2, which
+// applies to the command status preceding it.
+func (s *ReportStatus) decodeCommandOption(line string) error {
+	if len(s.CommandStatuses) == 0 {
+		return fmt.Errorf("option without command status: %s", line)
+	}
+
+	cs := s.CommandStatuses[len(s.CommandStatuses)-1]
+	fields := strings.SplitN(strings.TrimPrefix(line, "option "), " ", 2)
+	switch {
+	case fields[0] == "forced-update" && len(fields) == 1:
+		cs.ForcedUpdate = true
+	case fields[0] == "refname" && len(fields) == 2:
+		cs.RefName = plumbing.ReferenceName(fields[1])
+	case fields[0] == "old-oid" && len(fields) == 2:
+		h, ok := plumbing.FromHex(fields[1])
+		if !ok {
+			return fmt.Errorf("malformed option: %s", line)
+		}
+		cs.OldHash = h
+	case fields[0] == "new-oid" && len(fields) == 2:
+		h, ok := plumbing.FromHex(fields[1])
+		if !ok {
+			return fmt.Errorf("malformed option: %s", line)
+		}
+		cs.NewHash = h
+	default:
+		return fmt.Errorf("malformed option: %s", line)
+	}
+
+	return nil
+}
+
 // CommandStatus is the status of a reference in a report status.
 // See ReportStatus struct.
 type CommandStatus struct {
 	ReferenceName plumbing.ReferenceName
 	Status        string
+
+	// The following fields are only sent with report-status-v2, when the
+	// server updated the reference differently than requested by the
+	// command, such as with a proc-receive hook.
+
+	// RefName is the reference actually updated, if not ReferenceName.
+	RefName plumbing.ReferenceName
+	// OldHash is the old value of the reference, if not the one of the
+	// command.
+	OldHash plumbing.Hash
+	// NewHash is the new value of the reference, if not the one of the
+	// command.
+	NewHash plumbing.Hash
+	// ForcedUpdate is whether the update was not a fast-forward.
+	ForcedUpdate bool
 }
 
 // Error returns the error, if any.
@@ -193,11 +263,34 @@ func (s *CommandStatus) Error() error {
 }
 
 func (s *CommandStatus) encode(w io.Writer) error {
-	if s.Error() == nil {
-		_, err := pktline.Writef(w, "ok %s\n", s.ReferenceName.String())
+	if s.Error() != nil {
+		_, err := pktline.Writef(w, "ng %s %s\n", s.ReferenceName.String(), s.Status)
+		return err
+	}
+
+	if _, err := pktline.Writef(w, "ok %s\n", s.ReferenceName.String()); err != nil {
 		return err
 	}
 
-	_, err := pktline.Writef(w, "ng %s %s\n", s.ReferenceName.String(), s.Status)
-	return err
+	var opts []string
+	if s.RefName != "" {
+		opts = append(opts, "refname "+s.RefName.String())
+	}
+	if !s.OldHash.IsZero() {
+		opts = append(opts, "old-oid "+s.OldHash.String())
+	}
+	if !s.NewHash.IsZero() {
+		opts = append(opts, "new-oid "+s.NewHash.String())
+	}
+	if s.ForcedUpdate {
+		opts = append(opts, "forced-update")
+	}
+
+	for _, opt := range opts {
+		if _, err := pktline.Writef(w, "option %s\n", opt); err != nil {
+			return err
+		}
+	}
+
+	return nil
 }
@@ -312,3 +312,62 @@ func (s *ReportStatusSuite) TestCommandStatusError() {
 	s.Error(cs.Error())
 	s.ErrorAs(cs.Error(), &CommandStatusErr{})
 }
+
+func (s *ReportStatusSuite) TestEncodeDecodeOkV2Options() {
+	rs := NewReportStatus()
+	rs.UnpackStatus = "ok"
+	rs.CommandStatuses = []*CommandStatus{{
+		ReferenceName: plumbing.ReferenceName("refs/for/master"),
+		Status:        "ok",
+		RefName:       plumbing.ReferenceName("refs/changes/01/1/1"),
+		OldHash:       plumbing.NewHash("6ecf0ef2c2dffb796033e5a02219af86ec6584e5"),
+		NewHash:       plumbing.NewHash("e8d3ffab552895c19b9fcf7aa264d277cde33881"),
+		ForcedUpdate:  true,
+	}, {
+		ReferenceName: plumbing.ReferenceName("refs/heads/a"),
+		Status:        "ok",
+	}, {
+		ReferenceName: plumbing.ReferenceName("refs/heads/b"),
+		Status:        "pre-receive hook declined",
+	}}
+
+	s.testEncodeDecodeOk(rs,
+		"unpack ok\n",
+		"ok refs/for/master\n",
+		"option refname refs/changes/01/1/1\n",
+		"option old-oid 6ecf0ef2c2dffb796033e5a02219af86ec6584e5\n",
+		"option new-oid e8d3ffab552895c19b9fcf7aa264d277cde33881\n",
+		"option forced-update\n",
+		"ok refs/heads/a\n",
+		"ng refs/heads/b pre-receive hook declined\n",
+		"",
+	)
+}
+
+func (s *ReportStatusSuite) TestDecodeErrorMalformedOption() {
+	s.testDecodeError("option without command status",
+		"unpack ok\n",
+		"option forced-update\n",
+		"",
+	)
+
+	s.testDecodeError("malformed option: option old-oid foo",
+		"unpack ok\n",
+		"ok refs/heads/master\n",
+		"option old-oid foo\n",
+		"",
+	)
+}
+
+func (s *ReportStatusSuite) TestReportError() {
+	rs := NewReportStatus()
+	rs.UnpackStatus = "ok"
+	rs.CommandStatuses = []*CommandStatus{{
+		ReferenceName: plumbing.ReferenceName("refs/heads/a"),
+		Status:        "hook declined",
+	}}
+
+	var err error = &ReportError{Report: rs}
+	s.EqualError(err, "command error on refs/heads/a: hook declined")
+	s.ErrorAs(err, &CommandStatusErr{})
+}
@@ -76,11 +76,11 @@ func (r *ShallowUpdate) decodeUnshallowLine(line []byte) error {
 }
 
 func (r *ShallowUpdate) decodeLine(line, prefix []byte, expLen int) (plumbing.Hash, error) {
-	if len(line) != expLen {
+	if len(line) != expLen && (len(line) < len(prefix) || len(line) != len(prefix)+hexHashSize(line[len(prefix):])) {
 		return plumbing.ZeroHash, fmt.Errorf("malformed %s%q", prefix, line)
 	}
 
-	raw := string(line[expLen-40 : expLen])
+	raw := string(line[len(prefix):])
 	return plumbing.NewHash(raw), nil
 }
 
@@ -19,7 +19,8 @@ const chLen = 1
 //
 // If t is equal to `Sideband` the max pack size is set to MaxPackedSize, in any
 // other value is given, max pack is set to MaxPackedSize64k, that is the
-// maximum length of a line in pktline format.
+// maximum length of a line in pktline format. The max pack size is the size of
+// the whole packets, their length and channel included.
 func NewMuxer(t Type, w io.Writer) *Muxer {
 	max := MaxPackedSize64k
 	if t == Sideband {
@@ -27,7 +28,7 @@ func NewMuxer(t Type, w io.Writer) *Muxer {
 	}
 
 	return &Muxer{
-		max: max - chLen,
+		max: max - pktline.LenSize - chLen,
 		w:   w,
 	}
 }
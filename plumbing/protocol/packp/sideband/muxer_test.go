@@ -2,6 +2,7 @@ package sideband
 
 import (
 	"bytes"
+	"io"
 )
 
 func (s *SidebandSuite) TestMuxerWrite() {
@@ -9,10 +10,25 @@ func (s *SidebandSuite) TestMuxerWrite() {
 
 	m := NewMuxer(Sideband, buf)
 
-	n, err := m.Write(bytes.Repeat([]byte{'F'}, (MaxPackedSize-1)*2))
+	n, err := m.Write(bytes.Repeat([]byte{'F'}, (MaxPackedSize-5)*2))
 	s.NoError(err)
-	s.Equal(1998, n)
-	s.Equal(2008, buf.Len())
+	s.Equal(1990, n)
+	s.Equal(2000, buf.Len())
+}
+
+func (s *SidebandSuite) TestMuxerWriteMaxPacketSize() {
+	for _, t := range []Type{Sideband, Sideband64k} {
+		buf := bytes.NewBuffer(nil)
+		m := NewMuxer(t, buf)
+
+		_, err := m.Write(bytes.Repeat([]byte{'F'}, MaxPackedSize64k*2))
+		s.NoError(err)
+
+		d := NewDemuxer(t, buf)
+		content, err := io.ReadAll(d)
+		s.NoError(err)
+		s.Len(content, MaxPackedSize64k*2)
+	}
 }
 
 func (s *SidebandSuite) TestMuxerWriteChannelMultipleChannels() {
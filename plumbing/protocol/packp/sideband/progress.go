@@ -0,0 +1,142 @@
+package sideband
+
+import (
+	"bytes"
+	"io"
+	"regexp"
+	"strconv"
+	"sync"
+)
+
+// Phase is a phase of a fetch or a clone whose progress is reported.
+type Phase string
+
+const (
+	// EnumeratingObjects is the phase of the server looking for the objects
+	// to send, reported by recent servers instead of CountingObjects.
+	EnumeratingObjects Phase = "Enumerating objects"
+	// CountingObjects is the phase of the server counting the objects to
+	// send.
+	CountingObjects Phase = "Counting objects"
+	// CompressingObjects is the phase of the server computing the deltas
+	// of the objects to send.
+	CompressingObjects Phase = "Compressing objects"
+	// ReceivingObjects is the phase of the client receiving and reading the
+	// objects of the packfile.
+	ReceivingObjects Phase = "Receiving objects"
+	// ResolvingDeltas is the phase of the client resolving the deltas of
+	// the packfile received.
+	ResolvingDeltas Phase = "Resolving deltas"
+	// Checkout is the phase of the client writing the files of the
+	// worktree.
+	Checkout Phase = "Updating files"
+)
+
+// ProgressEvent is the progress of a phase.
+type ProgressEvent struct {
+	// Phase is the phase whose progress is reported.
+	Phase Phase
+	// Current is the number of objects, deltas or files processed so far.
+	Current uint64
+	// Total is the number of objects, deltas or files to process, or zero
+	// if it is unknown.
+	Total uint64
+	// Bytes is the number of bytes received so far, during the
+	// ReceivingObjects phase.
+	Bytes uint64
+	// Done is whether the phase is complete.
+	Done bool
+}
+
+// ProgressReporter is a Progress receiving the progress of the phases run by
+// the client as well, as events.
+type ProgressReporter interface {
+	Progress
+	// Report reports the progress of a phase.
+	Report(e ProgressEvent)
+}
+
+// ProgressWriter is a ProgressReporter calling a function with the progress
+// events, the ones of the phases run by the server being parsed from the
+// progress messages it sends, as written by `git upload-pack`.
+type ProgressWriter struct {
+	mu      sync.Mutex
+	fn      func(ProgressEvent)
+	raw     io.Writer
+	pending []byte
+}
+
+var _ ProgressReporter = (*ProgressWriter)(nil)
+
+// NewProgressWriter returns a ProgressWriter calling fn with the progress
+// events. The progress messages of the server are written to raw as well, if
+// not nil. The calls to fn are serialized.
+func NewProgressWriter(fn func(ProgressEvent), raw io.Writer) *ProgressWriter {
+	return &ProgressWriter{fn: fn, raw: raw}
+}
+
+// progressLine matches the progress lines of git, such as
+// "Counting objects:  50% (1/2)" or "Enumerating objects: 3, done.", which
+// may be followed by the throughput.
+var progressLine = regexp.MustCompile(`^([A-Za-z][A-Za-z ]*): +(?:\d+% \((\d+)/(\d+)\)|(\d+))(.*?)(, done\.)?$`)
+
+// Write writes the progress messages to the raw writer, and reports the
+// progress lines they contain. The lines which are not progress lines, as
+// the other messages of the server, are ignored.
+func (w *ProgressWriter) Write(p []byte) (int, error) {
+	if w.raw != nil {
+		if _, err := w.raw.Write(p); err != nil {
+			return 0, err
+		}
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	w.pending = append(w.pending, p...)
+	for {
+		i := bytes.IndexAny(w.pending, "\r\n")
+		if i < 0 {
+			break
+		}
+
+		line := w.pending[:i]
+		w.pending = w.pending[i+1:]
+		if e, ok := parseProgressLine(line); ok {
+			w.fn(e)
+		}
+	}
+
+	// The pending bytes are kept for the next write, unless they are a
+	// line too long to be a progress line.
+	if len(w.pending) > MaxPackedSize64k {
+		w.pending = w.pending[:0]
+	}
+
+	return len(p), nil
+}
+
+// Report calls the function of the writer with e.
+func (w *ProgressWriter) Report(e ProgressEvent) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	w.fn(e)
+}
+
+func parseProgressLine(line []byte) (ProgressEvent, bool) {
+	m := progressLine.FindSubmatch(bytes.TrimSpace(line))
+	if m == nil {
+		return ProgressEvent{}, false
+	}
+
+	e := ProgressEvent{Phase: Phase(m[1]), Done: len(m[6]) != 0}
+	if len(m[4]) != 0 {
+		e.Current, _ = strconv.ParseUint(string(m[4]), 10, 64)
+		return e, true
+	}
+
+	e.Current, _ = strconv.ParseUint(string(m[2]), 10, 64)
+	e.Total, _ = strconv.ParseUint(string(m[3]), 10, 64)
+	return e, true
+}
@@ -0,0 +1,72 @@
+package sideband
+
+import (
+	"bytes"
+	"io"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/go-git/go-git/v6/plumbing/format/pktline"
+)
+
+func TestProgressWriter(t *testing.T) {
+	t.Parallel()
+
+	var events []ProgressEvent
+	raw := bytes.NewBuffer(nil)
+	w := NewProgressWriter(func(e ProgressEvent) {
+		events = append(events, e)
+	}, raw)
+
+	messages := "Enumerating objects: 5, done.\n" +
+		"Counting objects:  20% (1/5)\rCounting objects: 100% (5/5), done.\n" +
+		"Compressing objects:  50% (1/2)\rCompressing objects: 100% (2/2), done.\n" +
+		"Total 5 (delta 0), reused 0 (delta 0), pack-reused 0\n"
+
+	// The progress lines may be split across messages.
+	for _, m := range []string{messages[:10], messages[10:45], messages[45:]} {
+		n, err := w.Write([]byte(m))
+		require.NoError(t, err)
+		assert.Equal(t, len(m), n)
+	}
+
+	w.Report(ProgressEvent{Phase: ReceivingObjects, Current: 1, Total: 5, Bytes: 42})
+
+	assert.Equal(t, messages, raw.String())
+	assert.Equal(t, []ProgressEvent{
+		{Phase: EnumeratingObjects, Current: 5, Done: true},
+		{Phase: CountingObjects, Current: 1, Total: 5},
+		{Phase: CountingObjects, Current: 5, Total: 5, Done: true},
+		{Phase: CompressingObjects, Current: 1, Total: 2},
+		{Phase: CompressingObjects, Current: 2, Total: 2, Done: true},
+		{Phase: ReceivingObjects, Current: 1, Total: 5, Bytes: 42},
+	}, events)
+}
+
+func TestProgressWriterDemuxer(t *testing.T) {
+	t.Parallel()
+
+	buf := bytes.NewBuffer(nil)
+	_, err := pktline.Write(buf, ProgressMessage.WithPayload([]byte("Counting objects:  33% (1/3)\r")))
+	require.NoError(t, err)
+	_, err = pktline.Write(buf, PackData.WithPayload([]byte("PACK")))
+	require.NoError(t, err)
+	_, err = pktline.Write(buf, ProgressMessage.WithPayload([]byte("Receiving objects: 100% (3/3), 1.20 KiB | 1.20 MiB/s, done.\n")))
+	require.NoError(t, err)
+
+	var events []ProgressEvent
+	d := NewDemuxer(Sideband64k, buf)
+	d.Progress = NewProgressWriter(func(e ProgressEvent) {
+		events = append(events, e)
+	}, nil)
+
+	content, err := io.ReadAll(d)
+	require.NoError(t, err)
+	assert.Equal(t, "PACK", string(content))
+	assert.Equal(t, []ProgressEvent{
+		{Phase: CountingObjects, Current: 1, Total: 3},
+		{Phase: ReceivingObjects, Current: 3, Total: 3, Done: true},
+	}, events)
+}
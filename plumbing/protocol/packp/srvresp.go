@@ -94,7 +94,6 @@ func (r *ServerResponse) decodeACKLine(line []byte) (err error) {
 	}
 
 	var ack ACK
-	// TODO: Dynamic hash size and sha256 support
 	ack.Hash = plumbing.NewHash(string(bytes.TrimSuffix(parts[1], []byte("\n"))))
 	err = io.EOF
 
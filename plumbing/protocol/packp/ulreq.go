@@ -17,7 +17,10 @@ type UploadRequest struct {
 	Wants        []plumbing.Hash
 	Shallows     []plumbing.Hash
 	Depth        Depth
-	Filter       Filter
+	// DeepenNot are the references whose history is excluded from the
+	// packfile, in addition to the limit of Depth.
+	DeepenNot []string
+	Filter    Filter
 }
 
 // Depth values stores the desired depth of the requested packfile: see
@@ -102,12 +102,13 @@ func (d *ulReqDecoder) readHash() (plumbing.Hash, bool) {
 		return plumbing.ZeroHash, false
 	}
 
-	h, ok := plumbing.FromHex(string(d.line[:hashSize]))
+	size := hexHashSize(d.line)
+	h, ok := plumbing.FromHex(string(d.line[:size]))
 	if !ok {
-		d.error("invalid hash text: %s", d.line[:hashSize])
+		d.error("invalid hash text: %s", d.line[:size])
 		return plumbing.ZeroHash, false
 	}
-	d.line = d.line[hashSize:]
+	d.line = d.line[size:]
 
 	return h, true
 }
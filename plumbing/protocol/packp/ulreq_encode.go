@@ -130,6 +130,13 @@ func (e *ulReqEncoder) encodeDepth() stateFn {
 		return nil
 	}
 
+	for _, reference := range e.data.DeepenNot {
+		if _, err := pktline.Writef(e.w, "deepen-not %s\n", reference); err != nil {
+			e.err = fmt.Errorf("encoding deepen-not %s: %s", reference, err)
+			return nil
+		}
+	}
+
 	return e.encodeFilter
 }
 
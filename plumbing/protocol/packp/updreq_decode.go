@@ -141,7 +141,7 @@ func (d *updReqDecoder) decodeShallow() error {
 		return nil
 	}
 
-	if len(b) != shallowLineLength {
+	if len(b) != shallowLineLength && (len(b) < len(shallow) || len(b) != len(shallow)+hexHashSize(b[len(shallow):])) {
 		return errInvalidShallowLineLength(len(b))
 	}
 
@@ -239,7 +239,7 @@ func parseCommand(b []byte) (*Command, error) {
 }
 
 func parseHash(s string) (plumbing.Hash, error) {
-	if len(s) != hashSize {
+	if len(s) != hashSize && len(s) != hexHashSize([]byte(s)) {
 		return plumbing.ZeroHash, errInvalidHashSize(len(s))
 	}
 
@@ -62,7 +62,14 @@ func (req *UpdateRequests) encodeCommands(w io.Writer,
 }
 
 func formatCommand(cmd *Command) string {
-	o := cmd.Old.String()
-	n := cmd.New.String()
+	o, n := cmd.Old, cmd.New
+	// The zero-ids of the created and deleted references are the ones of
+	// the object format of the other hash.
+	if o.IsZero() {
+		o.ResetBySize(n.Size())
+	} else if n.IsZero() {
+		n.ResetBySize(o.Size())
+	}
+
 	return fmt.Sprintf("%s %s %s", o, n, cmd.Name)
 }
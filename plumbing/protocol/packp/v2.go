@@ -0,0 +1,93 @@
+package packp
+
+import (
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/go-git/go-git/v6/plumbing/format/pktline"
+	"github.com/go-git/go-git/v6/plumbing/protocol/packp/capability"
+)
+
+// CapabilityAdvertisement is the message sent by a server speaking the Git
+// protocol v2 right after the "version 2" line. It lists the commands and
+// capabilities the server supports, one per pkt-line, and ends with a
+// flush-pkt.
+// See https://git-scm.com/docs/protocol-v2#_capability_advertisement
+type CapabilityAdvertisement struct {
+	Capabilities *capability.List
+}
+
+// NewCapabilityAdvertisement returns a new CapabilityAdvertisement ready to
+// be used.
+func NewCapabilityAdvertisement() *CapabilityAdvertisement {
+	return &CapabilityAdvertisement{
+		Capabilities: capability.NewList(),
+	}
+}
+
+// Decode reads the capabilities from r. The version line is expected to be
+// already consumed.
+func (a *CapabilityAdvertisement) Decode(r io.Reader) error {
+	for {
+		l, line, err := pktline.ReadLine(r)
+		if err != nil {
+			return fmt.Errorf("decoding capability advertisement: %w", err)
+		}
+
+		if l == pktline.Flush {
+			return nil
+		}
+
+		if err := a.Capabilities.DecodeV2(line); err != nil {
+			return err
+		}
+	}
+}
+
+// Encode writes the version line and the capabilities to w.
+func (a *CapabilityAdvertisement) Encode(w io.Writer) error {
+	if _, err := pktline.Writeln(w, "version 2"); err != nil {
+		return err
+	}
+
+	if err := encodeCapabilityLines(w, a.Capabilities); err != nil {
+		return err
+	}
+
+	return pktline.WriteFlush(w)
+}
+
+// encodeCommand writes the header of a protocol v2 command request, that is
+// the command line, the capabilities and the delimiter that separates them
+// from the command arguments.
+func encodeCommand(w io.Writer, cmd capability.Capability, caps *capability.List) error {
+	if _, err := pktline.Writef(w, "command=%s\n", cmd); err != nil {
+		return fmt.Errorf("sending command: %w", err)
+	}
+
+	if caps != nil {
+		if err := encodeCapabilityLines(w, caps); err != nil {
+			return fmt.Errorf("sending capabilities: %w", err)
+		}
+	}
+
+	return pktline.WriteDelim(w)
+}
+
+func encodeCapabilityLines(w io.Writer, caps *capability.List) error {
+	for _, c := range caps.All() {
+		var err error
+		if values := caps.Get(c); len(values) > 0 {
+			_, err = pktline.Writef(w, "%s=%s\n", c, strings.Join(values, " "))
+		} else {
+			_, err = pktline.Writeln(w, c.String())
+		}
+
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
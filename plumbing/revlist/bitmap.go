@@ -0,0 +1,182 @@
+package revlist
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/go-git/go-git/v6/plumbing"
+	"github.com/go-git/go-git/v6/plumbing/filemode"
+	"github.com/go-git/go-git/v6/plumbing/format/idxfile"
+	"github.com/go-git/go-git/v6/plumbing/format/packfile/bitmap"
+	"github.com/go-git/go-git/v6/plumbing/object"
+	"github.com/go-git/go-git/v6/plumbing/storer"
+)
+
+// BuildBitmapIndex generates a bitmap index for the packfile indexed by
+// idx, with a bitmap for each of the given commits. All the objects
+// reachable from the commits must be in the packfile, and are read from s.
+func BuildBitmapIndex(
+	s storer.EncodedObjectStorer,
+	idx *idxfile.MemoryIndex,
+	commits []plumbing.Hash,
+) (*bitmap.Index, error) {
+	bi, err := bitmap.NewIndex(idx)
+	if err != nil {
+		return nil, err
+	}
+
+	for pos, h := range bi.Objects() {
+		obj, err := s.EncodedObject(plumbing.AnyObject, h)
+		if err != nil {
+			return nil, err
+		}
+
+		switch obj.Type() {
+		case plumbing.CommitObject:
+			bi.Commits.Set(uint32(pos))
+		case plumbing.TreeObject:
+			bi.Trees.Set(uint32(pos))
+		case plumbing.BlobObject:
+			bi.Blobs.Set(uint32(pos))
+		case plumbing.TagObject:
+			bi.Tags.Set(uint32(pos))
+		}
+	}
+
+	for _, c := range commits {
+		hashes, err := Objects(s, []plumbing.Hash{c}, nil)
+		if err != nil {
+			return nil, err
+		}
+
+		b := bitmap.NewBitmap()
+		for _, h := range hashes {
+			pos, ok := bi.Position(h)
+			if !ok {
+				return nil, fmt.Errorf("object %s reachable from %s is not in the packfile", h, c)
+			}
+			b.Set(pos)
+		}
+
+		if err := bi.SetBitmap(c, b); err != nil {
+			return nil, err
+		}
+	}
+
+	return bi, nil
+}
+
+// IsReachable reports whether the object target is reachable from the
+// commit from. If s implements bitmap.Storer, the bitmaps it provides are
+// used to answer for the commits that have one, so that only the history
+// between from and the closest bitmapped commits is walked. Without
+// bitmaps, the whole history of from is walked.
+func IsReachable(s storer.EncodedObjectStorer, from, target plumbing.Hash) (bool, error) {
+	var indexes []*bitmap.Index
+	if bs, ok := s.(bitmap.Storer); ok {
+		var err error
+		if indexes, err = bs.BitmapIndexes(); err != nil {
+			return false, err
+		}
+	}
+
+	obj, err := s.EncodedObject(plumbing.AnyObject, target)
+	if errors.Is(err, plumbing.ErrObjectNotFound) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	isCommit := obj.Type() == plumbing.CommitObject
+
+	w := &reachabilityWalker{s: s, target: target, seen: make(map[plumbing.Hash]bool)}
+	pending := []plumbing.Hash{from}
+	for len(pending) > 0 {
+		h := pending[len(pending)-1]
+		pending = pending[:len(pending)-1]
+		if w.seen[h] {
+			continue
+		}
+		w.seen[h] = true
+
+		if h == target {
+			return true, nil
+		}
+
+		if found, ok := reachableFromBitmaps(indexes, h, target); ok {
+			if found {
+				return true, nil
+			}
+			continue
+		}
+
+		c, err := object.GetCommit(s, h)
+		if err != nil {
+			return false, err
+		}
+
+		if !isCommit {
+			found, err := w.walkTree(c.TreeHash)
+			if err != nil || found {
+				return found, err
+			}
+		}
+
+		pending = append(pending, c.ParentHashes...)
+	}
+
+	return false, nil
+}
+
+// reachableFromBitmaps answers whether target is reachable from commit,
+// using the first index that has a bitmap for commit. The second value
+// is false if none has.
+func reachableFromBitmaps(indexes []*bitmap.Index, commit, target plumbing.Hash) (found, ok bool) {
+	for _, idx := range indexes {
+		found, err := idx.Reachable(commit, target)
+		if err == nil {
+			return found, true
+		}
+	}
+
+	return false, false
+}
+
+type reachabilityWalker struct {
+	s      storer.EncodedObjectStorer
+	target plumbing.Hash
+	seen   map[plumbing.Hash]bool
+}
+
+func (w *reachabilityWalker) walkTree(h plumbing.Hash) (bool, error) {
+	if h == w.target {
+		return true, nil
+	}
+	if w.seen[h] {
+		return false, nil
+	}
+	w.seen[h] = true
+
+	t, err := object.GetTree(w.s, h)
+	if err != nil {
+		return false, err
+	}
+
+	for _, e := range t.Entries {
+		switch e.Mode {
+		case filemode.Submodule:
+			continue
+		case filemode.Dir:
+			found, err := w.walkTree(e.Hash)
+			if err != nil || found {
+				return found, err
+			}
+		default:
+			if e.Hash == w.target {
+				return true, nil
+			}
+		}
+	}
+
+	return false, nil
+}
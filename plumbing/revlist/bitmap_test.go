@@ -0,0 +1,85 @@
+package revlist
+
+import (
+	"testing"
+
+	fixtures "github.com/go-git/go-git-fixtures/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/go-git/go-git/v6/plumbing"
+	"github.com/go-git/go-git/v6/plumbing/cache"
+	format "github.com/go-git/go-git/v6/plumbing/format/config"
+	"github.com/go-git/go-git/v6/plumbing/format/idxfile"
+	"github.com/go-git/go-git/v6/plumbing/format/packfile/bitmap"
+	"github.com/go-git/go-git/v6/storage/filesystem"
+)
+
+func TestBuildBitmapIndex(t *testing.T) {
+	f := fixtures.Basic().One()
+	sto := filesystem.NewStorage(f.DotGit(), cache.NewObjectLRUDefault())
+
+	idx := idxfile.NewMemoryIndex(format.SHA1Size)
+	require.NoError(t, idxfile.NewDecoder(f.Idx()).Decode(idx))
+
+	head := plumbing.NewHash(f.Head)
+	bi, err := BuildBitmapIndex(sto, idx, []plumbing.Hash{head})
+	require.NoError(t, err)
+
+	want, err := Objects(sto, []plumbing.Hash{head}, nil)
+	require.NoError(t, err)
+
+	b, ok := bi.Bitmap(head)
+	require.True(t, ok)
+	assert.ElementsMatch(t, want, bi.Hashes(b))
+	assert.Equal(t, 9, bi.Commits.Count())
+	assert.Equal(t, len(bi.Objects()), bi.Commits.Count()+bi.Trees.Count()+bi.Blobs.Count()+bi.Tags.Count())
+}
+
+func TestIsReachable(t *testing.T) {
+	f := fixtures.Basic().One()
+	head := plumbing.NewHash(f.Head)
+
+	// A storage without bitmaps, and one with a bitmap for HEAD.
+	plain := filesystem.NewStorage(f.DotGit(), cache.NewObjectLRUDefault())
+
+	fs := f.DotGit()
+	bitmapped := filesystem.NewStorage(fs, cache.NewObjectLRUDefault())
+	idx := idxfile.NewMemoryIndex(format.SHA1Size)
+	require.NoError(t, idxfile.NewDecoder(f.Idx()).Decode(idx))
+	bi, err := BuildBitmapIndex(bitmapped, idx, []plumbing.Hash{head})
+	require.NoError(t, err)
+
+	w, err := fs.Create(fs.Join("objects", "pack", "pack-"+f.PackfileHash+".bitmap"))
+	require.NoError(t, err)
+	require.NoError(t, bitmap.NewEncoder(w, format.SHA1).Encode(bi))
+	require.NoError(t, w.Close())
+
+	bitmaps, err := bitmapped.BitmapIndexes()
+	require.NoError(t, err)
+	require.Len(t, bitmaps, 1)
+
+	tests := []struct {
+		from, target string
+		want         bool
+	}{
+		{f.Head, initialCommit, true},
+		{f.Head, f.Head, true},
+		{initialCommit, f.Head, false},
+		// A blob that is not in the initial commit.
+		{f.Head, "d3ff53e0564a9f87d8e84b6e28e5060e517008aa", true},
+		{initialCommit, "d3ff53e0564a9f87d8e84b6e28e5060e517008aa", false},
+		{initialCommit, "c192bd6a24ea1ab01d78686e417c8bdc7c3d197f", true},
+		// A tree in the history of HEAD.
+		{f.Head, "a8d315b2b1c615d43042c3a62402b8a54288cf5c", true},
+		{f.Head, "0000000000000000000000000000000000000001", false},
+	}
+
+	for _, sto := range []*filesystem.Storage{plain, bitmapped} {
+		for _, tc := range tests {
+			got, err := IsReachable(sto, plumbing.NewHash(tc.from), plumbing.NewHash(tc.target))
+			require.NoError(t, err)
+			assert.Equal(t, tc.want, got, "%s from %s", tc.target, tc.from)
+		}
+	}
+}
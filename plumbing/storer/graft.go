@@ -0,0 +1,153 @@
+package storer
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/go-git/go-git/v6/plumbing"
+)
+
+// ReplaceRefPrefix is the prefix of the references replacing an object, named
+// after the hash of the replaced object and pointing to its replacement.
+const ReplaceRefPrefix = "refs/replace/"
+
+// maxReplaceDepth is the maximum length of the chains of replaced objects
+// followed, as git does.
+const maxReplaceDepth = 5
+
+// GraftStorer is a storage rewriting the history virtually, through the
+// shallow commits, the info/grafts file and the refs/replace/* references.
+type GraftStorer interface {
+	// Grafts returns the grafts of the storage, nil if there is none.
+	Grafts() (*Grafts, error)
+}
+
+// Grafts are the parents overriding the ones of some commits, and the
+// objects replacing others.
+type Grafts struct {
+	// Parents are the parents of the grafted commits, by commit hash. The
+	// shallow commits have no parents.
+	Parents map[plumbing.Hash][]plumbing.Hash
+	// Replaced are the hashes of the replacing objects, by replaced object
+	// hash.
+	Replaced map[plumbing.Hash]plumbing.Hash
+}
+
+// ReadGrafts returns the grafts of the given shallow commits, the given
+// info/grafts file, if not nil, and the refs/replace/* references of the
+// given iterator, if not nil. It returns nil if there is no graft.
+//
+// Each line of the info/grafts file is the hash of a commit followed by the
+// hashes of its parents, separated by spaces. The empty lines and the ones
+// starting with # are ignored.
+func ReadGrafts(shallow []plumbing.Hash, grafts io.Reader, refs ReferenceIter) (*Grafts, error) {
+	g := &Grafts{
+		Parents:  make(map[plumbing.Hash][]plumbing.Hash),
+		Replaced: make(map[plumbing.Hash]plumbing.Hash),
+	}
+
+	if grafts != nil {
+		scn := bufio.NewScanner(grafts)
+		for scn.Scan() {
+			line := strings.TrimSpace(scn.Text())
+			if line == "" || line[0] == '#' {
+				continue
+			}
+
+			fields := strings.Fields(line)
+			hashes := make([]plumbing.Hash, 0, len(fields))
+			for _, f := range fields {
+				if !plumbing.IsHash(f) {
+					return nil, fmt.Errorf("malformed graft: %q", line)
+				}
+
+				hashes = append(hashes, plumbing.NewHash(f))
+			}
+
+			g.Parents[hashes[0]] = hashes[1:]
+		}
+
+		if err := scn.Err(); err != nil {
+			return nil, err
+		}
+	}
+
+	// The parents of a shallow commit are missing, whatever its graft.
+	for _, h := range shallow {
+		g.Parents[h] = nil
+	}
+
+	if refs != nil {
+		err := refs.ForEach(func(ref *plumbing.Reference) error {
+			name := ref.Name().String()
+			if ref.Type() != plumbing.HashReference || !strings.HasPrefix(name, ReplaceRefPrefix) {
+				return nil
+			}
+
+			replaced := strings.TrimPrefix(name, ReplaceRefPrefix)
+			if plumbing.IsHash(replaced) {
+				g.Replaced[plumbing.NewHash(replaced)] = ref.Hash()
+			}
+
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if len(g.Parents) == 0 && len(g.Replaced) == 0 {
+		return nil, nil
+	}
+
+	return g, nil
+}
+
+// ParentHashes returns the parents of the commit with the given hash and
+// parents, once grafted and replaced.
+func (g *Grafts) ParentHashes(commit plumbing.Hash, parents []plumbing.Hash) []plumbing.Hash {
+	if g == nil {
+		return parents
+	}
+
+	if grafted, ok := g.Parents[commit]; ok {
+		parents = grafted
+	}
+
+	if len(g.Replaced) == 0 {
+		return parents
+	}
+
+	replaced := make([]plumbing.Hash, len(parents))
+	for i, h := range parents {
+		if r, ok := g.Replaced[h]; ok {
+			h = r
+		}
+
+		replaced[i] = h
+	}
+
+	return replaced
+}
+
+// Replacement returns the hash of the object replacing the object with the
+// given hash, following the chain of replaced objects, or the hash itself if
+// it is not replaced.
+func (g *Grafts) Replacement(h plumbing.Hash) plumbing.Hash {
+	if g == nil {
+		return h
+	}
+
+	for range maxReplaceDepth {
+		r, ok := g.Replaced[h]
+		if !ok {
+			break
+		}
+
+		h = r
+	}
+
+	return h
+}
@@ -0,0 +1,81 @@
+package storer
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/go-git/go-git/v6/plumbing"
+)
+
+func TestReadGrafts(t *testing.T) {
+	t.Parallel()
+
+	a := plumbing.NewHash("6ecf0ef2c2dffb796033e5a02219af86ec6584e5")
+	b := plumbing.NewHash("918c48b83bd081e863dbe1b80f8998f058cd8294")
+	c := plumbing.NewHash("af2d6a6954d532f8ffb47615169c8fdf9d383a1a")
+
+	grafts := "# comment\n\n" + a.String() + " " + b.String() + " " + c.String() + "\n" + b.String() + "\n" + c.String() + " " + a.String() + "\n"
+	refs := NewReferenceSliceIter([]*plumbing.Reference{
+		plumbing.NewHashReference("refs/replace/"+plumbing.ReferenceName(b.String()), c),
+		plumbing.NewHashReference("refs/replace/foo", c),
+		plumbing.NewHashReference("refs/heads/"+plumbing.ReferenceName(a.String()), c),
+		plumbing.NewSymbolicReference("refs/replace/"+plumbing.ReferenceName(a.String()), plumbing.Master),
+	})
+
+	g, err := ReadGrafts([]plumbing.Hash{c}, strings.NewReader(grafts), refs)
+	require.NoError(t, err)
+	assert.Equal(t, &Grafts{
+		Parents: map[plumbing.Hash][]plumbing.Hash{
+			a: {b, c},
+			b: {},
+			c: nil,
+		},
+		Replaced: map[plumbing.Hash]plumbing.Hash{b: c},
+	}, g)
+
+	assert.Equal(t, []plumbing.Hash{c, c}, g.ParentHashes(a, nil))
+	assert.Empty(t, g.ParentHashes(c, []plumbing.Hash{a}))
+	assert.Equal(t, []plumbing.Hash{a, c}, g.ParentHashes(plumbing.ZeroHash, []plumbing.Hash{a, b}))
+}
+
+func TestReadGraftsEmpty(t *testing.T) {
+	t.Parallel()
+
+	g, err := ReadGrafts(nil, strings.NewReader("# comment\n"), NewReferenceSliceIter(nil))
+	require.NoError(t, err)
+	assert.Nil(t, g)
+
+	parents := []plumbing.Hash{plumbing.NewHash("6ecf0ef2c2dffb796033e5a02219af86ec6584e5")}
+	assert.Equal(t, parents, g.ParentHashes(plumbing.ZeroHash, parents))
+}
+
+func TestReadGraftsMalformed(t *testing.T) {
+	t.Parallel()
+
+	_, err := ReadGrafts(nil, strings.NewReader("foo bar\n"), nil)
+	assert.ErrorContains(t, err, `malformed graft: "foo bar"`)
+}
+
+func TestGraftsReplacement(t *testing.T) {
+	t.Parallel()
+
+	a := plumbing.NewHash("6ecf0ef2c2dffb796033e5a02219af86ec6584e5")
+	b := plumbing.NewHash("918c48b83bd081e863dbe1b80f8998f058cd8294")
+	c := plumbing.NewHash("af2d6a6954d532f8ffb47615169c8fdf9d383a1a")
+
+	var g *Grafts
+	assert.Equal(t, a, g.Replacement(a))
+
+	// The chains of replaced objects are followed, up to a few objects,
+	// the cycles being broken.
+	g = &Grafts{Replaced: map[plumbing.Hash]plumbing.Hash{a: b, b: c}}
+	assert.Equal(t, c, g.Replacement(a))
+	assert.Equal(t, c, g.Replacement(b))
+	assert.Equal(t, c, g.Replacement(c))
+
+	g.Replaced[c] = a
+	assert.Equal(t, c, g.Replacement(a))
+}
@@ -6,6 +6,7 @@ import (
 	"time"
 
 	"github.com/go-git/go-git/v6/plumbing"
+	format "github.com/go-git/go-git/v6/plumbing/format/config"
 )
 
 // ErrStop is used to stop a ForEach function in an Iter
@@ -54,6 +55,19 @@ type DeltaObjectStorer interface {
 	DeltaObject(plumbing.ObjectType, plumbing.Hash) (plumbing.EncodedObject, error)
 }
 
+// ObjectFetcher fetches the given objects into a storer, typically from the
+// promisor remote of a partial clone.
+type ObjectFetcher func(hashes ...plumbing.Hash) error
+
+// PromisorObjectStorer is an EncodedObjectStorer that can fetch on demand
+// the objects it is missing, such as the blobs omitted by a partial clone.
+type PromisorObjectStorer interface {
+	// SetObjectFetcher sets the function called by EncodedObject when an
+	// object is not found in the storer. A nil fetcher disables lazy
+	// fetching.
+	SetObjectFetcher(ObjectFetcher)
+}
+
 // Transactioner is a optional method for ObjectStorer, it enables transactional read and write
 // operations.
 type Transactioner interface {
@@ -89,6 +103,67 @@ type PackedObjectStorer interface {
 	DeleteOldObjectPackAndIndex(plumbing.Hash, time.Time) error
 }
 
+// PackedObjectInfoStorer is an optional interface of the PackedObjectStorer
+// describing their object packs.
+type PackedObjectInfoStorer interface {
+	// ObjectPackTime returns the modification time of the given object pack.
+	ObjectPackTime(plumbing.Hash) (time.Time, error)
+	// ObjectPackHashes returns the hashes of the objects of the given object
+	// pack.
+	ObjectPackHashes(plumbing.Hash) ([]plumbing.Hash, error)
+}
+
+// ObjectSize describes the size of an object, as stored.
+type ObjectSize struct {
+	// Hash is the hash of the object.
+	Hash plumbing.Hash
+	// Type is the type of the object, the one of its base for a delta.
+	Type plumbing.ObjectType
+	// Size is the size of the content of the object, once inflated and its
+	// deltas resolved.
+	Size int64
+	// DiskSize is the size the object takes on disk, compressed, as a delta
+	// if it is stored as one.
+	DiskSize int64
+}
+
+// ObjectSizeStorer is an optional interface of the LooseObjectStorer and
+// PackedObjectStorer giving the sizes of their objects and of their object
+// packs, read from the headers of the objects and the indexes of the packs,
+// without inflating the objects.
+type ObjectSizeStorer interface {
+	// LooseObjectSize returns the size of the given loose object.
+	LooseObjectSize(plumbing.Hash) (ObjectSize, error)
+	// ObjectPackSize returns the size on disk of the given object pack, its
+	// packfile and its index.
+	ObjectPackSize(plumbing.Hash) (int64, error)
+	// ObjectPackSizes returns the sizes of the objects of the given object
+	// pack, ordered by their offset in the packfile.
+	ObjectPackSizes(plumbing.Hash) ([]ObjectSize, error)
+}
+
+// ObjectFormatStorer is an optional interface of the EncodedObjectStorer
+// knowing the object format of its objects, the hash algorithm naming them.
+// The objects of the storers not implementing it are SHA1 ones.
+type ObjectFormatStorer interface {
+	// ObjectFormat returns the object format of the objects of the storage.
+	ObjectFormat() format.ObjectFormat
+	// SetObjectFormat sets the object format of the objects of the storage,
+	// which must not hold any object yet, such as the one of a repository
+	// being cloned.
+	SetObjectFormat(format.ObjectFormat)
+}
+
+// ObjectFormat returns the object format of the objects of s, SHA1 if s does
+// not implement ObjectFormatStorer.
+func ObjectFormat(s EncodedObjectStorer) format.ObjectFormat {
+	if fs, ok := s.(ObjectFormatStorer); ok {
+		return fs.ObjectFormat()
+	}
+
+	return format.SHA1
+}
+
 // PackfileWriter is an optional method for ObjectStorer, it enables directly writing
 // a packfile to storage.
 type PackfileWriter interface {
@@ -99,6 +174,16 @@ type PackfileWriter interface {
 	PackfileWriter() (io.WriteCloser, error)
 }
 
+// ThinPackfileWriter is implemented by the PackfileWriter storers whose
+// packfile writers accept thin packs, completing them with the bases of
+// their deltas read from the storer.
+type ThinPackfileWriter interface {
+	PackfileWriter
+	// AcceptsThinPacks reports whether the packfiles written may be thin
+	// packs.
+	AcceptsThinPacks() bool
+}
+
 // EncodedObjectIter is a generic closable interface for iterating over objects.
 type EncodedObjectIter interface {
 	Next() (plumbing.EncodedObject, error)
@@ -106,6 +191,101 @@ type EncodedObjectIter interface {
 	Close()
 }
 
+// BulkObjectStorer is an optional interface of the EncodedObjectStorer
+// checking the existence of many objects at once, faster than one at a time.
+type BulkObjectStorer interface {
+	// HasObjects returns whether each of the given objects exists, by hash.
+	HasObjects(hashes []plumbing.Hash) (map[plumbing.Hash]bool, error)
+}
+
+// HasObjects returns whether each of the given objects exists in the given
+// storer, by hash, checking them at once if it is a BulkObjectStorer, and
+// one at a time otherwise.
+func HasObjects(s EncodedObjectStorer, hashes []plumbing.Hash) (map[plumbing.Hash]bool, error) {
+	if bs, ok := s.(BulkObjectStorer); ok {
+		return bs.HasObjects(hashes)
+	}
+
+	found := make(map[plumbing.Hash]bool, len(hashes))
+	for _, h := range hashes {
+		err := s.HasEncodedObject(h)
+		if err != nil && !errors.Is(err, plumbing.ErrObjectNotFound) {
+			return nil, err
+		}
+
+		found[h] = err == nil
+	}
+
+	return found, nil
+}
+
+// ObjectWriter writes the content of a new object to a storer, the object
+// being stored once it is closed.
+type ObjectWriter interface {
+	io.WriteCloser
+	// Hash returns the hash of the object, once the writer is closed.
+	Hash() plumbing.Hash
+}
+
+// StreamingObjectStorer is an optional interface of the EncodedObjectStorer
+// writing the objects whose size is not known beforehand with bounded
+// memory, such as huge blobs copied from files.
+type StreamingObjectStorer interface {
+	// NewObjectWriter returns an ObjectWriter of a new object of the given
+	// type, hashing and storing its content as it is written.
+	NewObjectWriter(plumbing.ObjectType) (ObjectWriter, error)
+}
+
+// NewObjectWriter returns an ObjectWriter of a new object of the given type
+// to the given storer, streaming its content if it is a
+// StreamingObjectStorer, and holding it in memory until it is closed to set
+// it with SetEncodedObject otherwise.
+func NewObjectWriter(s EncodedObjectStorer, typ plumbing.ObjectType) (ObjectWriter, error) {
+	if !typ.Valid() || typ.IsDelta() {
+		return nil, plumbing.ErrInvalidType
+	}
+
+	if ss, ok := s.(StreamingObjectStorer); ok {
+		return ss.NewObjectWriter(typ)
+	}
+
+	obj := s.NewEncodedObject()
+	obj.SetType(typ)
+	w, err := obj.Writer()
+	if err != nil {
+		return nil, err
+	}
+
+	return &encodedObjectWriter{WriteCloser: w, s: s, obj: obj}, nil
+}
+
+// encodedObjectWriter is the ObjectWriter of the storers which are not
+// StreamingObjectStorer, setting the object written once closed.
+type encodedObjectWriter struct {
+	io.WriteCloser
+	s    EncodedObjectStorer
+	obj  plumbing.EncodedObject
+	hash plumbing.Hash
+}
+
+func (w *encodedObjectWriter) Close() error {
+	if err := w.WriteCloser.Close(); err != nil {
+		return err
+	}
+
+	h, err := w.s.SetEncodedObject(w.obj)
+	if err != nil {
+		return err
+	}
+
+	w.hash = h
+	return nil
+}
+
+func (w *encodedObjectWriter) Hash() plumbing.Hash {
+	return w.hash
+}
+
 // Transaction is an in-progress storage transaction. A transaction must end
 // with a call to Commit or Rollback.
 type Transaction interface {
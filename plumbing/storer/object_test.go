@@ -80,6 +80,13 @@ func (s *ObjectSuite) TestObjectLookupIter() {
 	i.Close()
 }
 
+func (s *ObjectSuite) TestHasObjects() {
+	missing := plumbing.NewHash("0000000000000000000000000000000000000001")
+	found, err := HasObjects(&MockObjectStorage{s.Objects}, []plumbing.Hash{s.Hash[0], s.Hash[1], missing})
+	s.NoError(err)
+	s.Equal(map[plumbing.Hash]bool{s.Hash[0]: true, s.Hash[1]: true, missing: false}, found)
+}
+
 func (s *ObjectSuite) TestObjectSliceIter() {
 	var count int
 
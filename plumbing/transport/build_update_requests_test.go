@@ -35,6 +35,16 @@ func TestBuildUpdateRequestsWithReportStatus(t *testing.T) {
 	assert.Equal(t, plumbing.NewHash("0123456789012345678901234567890123456789"), upreq.Commands[0].New)
 }
 
+func TestBuildUpdateRequestsWithReportStatusV2(t *testing.T) {
+	caps := capability.NewList()
+	caps.Add(capability.ReportStatus)
+	caps.Add(capability.ReportStatusV2)
+
+	upreq := buildUpdateRequests(caps, &PushRequest{})
+	assert.True(t, upreq.Capabilities.Supports(capability.ReportStatusV2))
+	assert.False(t, upreq.Capabilities.Supports(capability.ReportStatus))
+}
+
 func TestBuildUpdateRequestsWithoutReportStatus(t *testing.T) {
 	caps := capability.NewList()
 
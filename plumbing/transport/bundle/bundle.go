@@ -0,0 +1,251 @@
+// Package bundle implements a transport fetching from git bundles, as
+// created by `git bundle create` or Repository.CreateBundle.
+//
+// Bundles are read-only: only the upload-pack service is supported, and
+// references can be listed and fetched, but not pushed.
+package bundle
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+	"sync"
+
+	"github.com/go-git/go-git/v6/plumbing"
+	"github.com/go-git/go-git/v6/plumbing/format/bundle"
+	"github.com/go-git/go-git/v6/plumbing/format/packfile"
+	"github.com/go-git/go-git/v6/plumbing/protocol"
+	"github.com/go-git/go-git/v6/plumbing/protocol/packp/capability"
+	"github.com/go-git/go-git/v6/plumbing/transport"
+	"github.com/go-git/go-git/v6/storage"
+)
+
+var (
+	// ErrAlreadyFetched is returned when fetching twice from the same
+	// connection, as the packfile of a bundle can only be read once.
+	ErrAlreadyFetched = errors.New("bundle already fetched")
+	// ErrReaderAlreadyLoaded is returned when a bundle read from an
+	// io.Reader is loaded more than once.
+	ErrReaderAlreadyLoaded = errors.New("bundle reader already loaded")
+)
+
+// DefaultTransport is the transport reading bundles from the file system.
+var DefaultTransport = NewTransport(FileLoader)
+
+// Loader opens the bundle of an endpoint.
+type Loader interface {
+	// Load returns a reader of the bundle of the given endpoint.
+	Load(ep *transport.Endpoint) (io.ReadCloser, error)
+}
+
+// FileLoader is a Loader opening the bundle file at the path of the
+// endpoint.
+var FileLoader Loader = fileLoader{}
+
+type fileLoader struct{}
+
+func (fileLoader) Load(ep *transport.Endpoint) (io.ReadCloser, error) {
+	f, err := os.Open(ep.Path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, transport.ErrRepositoryNotFound
+	}
+
+	return f, err
+}
+
+// NewReaderLoader returns a Loader reading the bundle from r, whatever the
+// endpoint. As a reader can only be read once, the bundle can only be
+// loaded once, to be cloned or fetched.
+func NewReaderLoader(r io.Reader) Loader {
+	return &readerLoader{r: r}
+}
+
+type readerLoader struct {
+	mu sync.Mutex
+	r  io.Reader
+}
+
+func (l *readerLoader) Load(*transport.Endpoint) (io.ReadCloser, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.r == nil {
+		return nil, ErrReaderAlreadyLoaded
+	}
+
+	r := l.r
+	l.r = nil
+	if rc, ok := r.(io.ReadCloser); ok {
+		return rc, nil
+	}
+
+	return io.NopCloser(r), nil
+}
+
+// IsBundle returns whether the file at the given path is a bundle, based on
+// its header.
+func IsBundle(path string) bool {
+	f, err := os.Open(path)
+	if err != nil {
+		return false
+	}
+
+	defer f.Close()
+
+	var h bundle.Header
+	return bundle.NewDecoder(f).Decode(&h) == nil
+}
+
+// NewTransport returns a transport reading the bundles opened by the given
+// loader.
+func NewTransport(loader Loader) transport.Transport {
+	return &client{loader: loader}
+}
+
+type client struct {
+	loader Loader
+}
+
+// NewSession returns a new session for an endpoint.
+func (c *client) NewSession(st storage.Storer, ep *transport.Endpoint, _ transport.AuthMethod) (transport.Session, error) {
+	return &session{st: st, ep: ep, loader: c.loader}, nil
+}
+
+// SupportedProtocols returns the protocol versions supported by the
+// transport. Bundles are not read using the wire protocol, so this is only
+// used to negotiate the version.
+func (c *client) SupportedProtocols() []protocol.Version {
+	return []protocol.Version{protocol.V0}
+}
+
+type session struct {
+	st     storage.Storer
+	ep     *transport.Endpoint
+	loader Loader
+}
+
+// Handshake opens the bundle and reads its header.
+func (s *session) Handshake(_ context.Context, service transport.Service, _ ...string) (transport.Connection, error) {
+	if service != transport.UploadPackService {
+		return nil, transport.ErrUnsupportedService
+	}
+
+	rc, err := s.loader.Load(s.ep)
+	if err != nil {
+		return nil, err
+	}
+
+	d := bundle.NewDecoder(rc)
+	var h bundle.Header
+	if err := d.Decode(&h); err != nil {
+		_ = rc.Close()
+		return nil, err
+	}
+
+	return &connection{st: s.st, rc: rc, d: d, header: &h}, nil
+}
+
+type connection struct {
+	st      storage.Storer
+	rc      io.ReadCloser
+	d       *bundle.Decoder
+	header  *bundle.Header
+	fetched bool
+}
+
+var _ transport.Connection = (*connection)(nil)
+
+// Close closes the bundle.
+func (c *connection) Close() error {
+	return c.rc.Close()
+}
+
+// Capabilities returns an empty list, as bundles have no capabilities in
+// the sense of the wire protocol.
+func (c *connection) Capabilities() *capability.List {
+	return capability.NewList()
+}
+
+// Version returns protocol.V0.
+func (c *connection) Version() protocol.Version {
+	return protocol.V0
+}
+
+// StatelessRPC returns false.
+func (c *connection) StatelessRPC() bool {
+	return false
+}
+
+// GetRemoteRefs returns the references of the bundle. As bundles only
+// contain hash references, HEAD is made a symbolic reference to the branch
+// pointing to the same commit, if any, preferring the master branch.
+func (c *connection) GetRemoteRefs(context.Context) ([]*plumbing.Reference, error) {
+	refs := slices.Clone(c.header.References)
+
+	headIdx := slices.IndexFunc(refs, func(ref *plumbing.Reference) bool {
+		return ref.Name() == plumbing.HEAD
+	})
+	if headIdx < 0 {
+		return refs, nil
+	}
+
+	var target plumbing.ReferenceName
+	for _, ref := range refs {
+		if !ref.Name().IsBranch() || ref.Hash() != refs[headIdx].Hash() {
+			continue
+		}
+
+		if target == "" || ref.Name() == plumbing.Master {
+			target = ref.Name()
+		}
+	}
+
+	if target != "" {
+		refs[headIdx] = plumbing.NewSymbolicReference(plumbing.HEAD, target)
+	}
+
+	return refs, nil
+}
+
+// Fetch checks that the prerequisites of the bundle are in the storer, and
+// stores the objects of its packfile. All the objects are stored, whatever
+// the wanted ones.
+func (c *connection) Fetch(ctx context.Context, req *transport.FetchRequest) error {
+	if req.IsShallow() {
+		return transport.ErrShallowNotSupported
+	}
+
+	if req.Filter != "" {
+		return transport.ErrFilterNotSupported
+	}
+
+	if c.fetched {
+		return ErrAlreadyFetched
+	}
+
+	for _, name := range req.WantRefs {
+		i := slices.IndexFunc(c.header.References, func(ref *plumbing.Reference) bool {
+			return ref.Name() == name
+		})
+		if i < 0 {
+			return fmt.Errorf("%w: %s", plumbing.ErrReferenceNotFound, name)
+		}
+
+		req.WantedRefs = append(req.WantedRefs, c.header.References[i])
+	}
+
+	if err := c.header.Verify(c.st); err != nil {
+		return err
+	}
+
+	c.fetched = true
+	return packfile.UpdateObjectStorageWithOptions(c.st, c.d.Packfile(), packfile.WithContext(ctx))
+}
+
+// Push returns transport.ErrUnsupportedService, as bundles are read-only.
+func (c *connection) Push(context.Context, *transport.PushRequest) error {
+	return transport.ErrUnsupportedService
+}
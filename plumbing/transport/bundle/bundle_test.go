@@ -0,0 +1,88 @@
+package bundle
+
+import (
+	"bytes"
+	"context"
+	"testing"
+
+	fixtures "github.com/go-git/go-git-fixtures/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/go-git/go-git/v6/plumbing"
+	"github.com/go-git/go-git/v6/plumbing/format/bundle"
+	"github.com/go-git/go-git/v6/plumbing/transport"
+	"github.com/go-git/go-git/v6/storage/memory"
+)
+
+func newBundle(t *testing.T, h *bundle.Header) *bytes.Buffer {
+	t.Helper()
+
+	var buf bytes.Buffer
+	require.NoError(t, bundle.NewEncoder(&buf).Encode(h))
+
+	_, err := buf.ReadFrom(fixtures.Basic().One().Packfile())
+	require.NoError(t, err)
+	return &buf
+}
+
+func TestFetchFromReader(t *testing.T) {
+	t.Parallel()
+
+	master := plumbing.NewHash("6ecf0ef2c2dffb796033e5a02219af86ec6584e5")
+	r := newBundle(t, &bundle.Header{References: []*plumbing.Reference{
+		plumbing.NewHashReference(plumbing.HEAD, master),
+		plumbing.NewReferenceFromStrings("refs/heads/branch", "e8d3ffab552895c19b9fcf7aa264d277cde33881"),
+		plumbing.NewHashReference(plumbing.Master, master),
+	}})
+
+	st := memory.NewStorage()
+	ep, err := transport.NewEndpoint("bundle://repo.bundle")
+	require.NoError(t, err)
+
+	tr := NewTransport(NewReaderLoader(r))
+	sess, err := tr.NewSession(st, ep, nil)
+	require.NoError(t, err)
+
+	_, err = sess.Handshake(context.Background(), transport.ReceivePackService)
+	assert.ErrorIs(t, err, transport.ErrUnsupportedService)
+
+	conn, err := sess.Handshake(context.Background(), transport.UploadPackService)
+	require.NoError(t, err)
+	defer conn.Close()
+
+	refs, err := conn.GetRemoteRefs(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, plumbing.NewSymbolicReference(plumbing.HEAD, plumbing.Master), refs[0])
+
+	assert.ErrorIs(t, conn.Fetch(context.Background(), &transport.FetchRequest{Depth: 1}), transport.ErrShallowNotSupported)
+	require.NoError(t, conn.Fetch(context.Background(), &transport.FetchRequest{Wants: []plumbing.Hash{master}}))
+	assert.NoError(t, st.HasEncodedObject(master))
+	assert.ErrorIs(t, conn.Fetch(context.Background(), &transport.FetchRequest{}), ErrAlreadyFetched)
+
+	// The reader can only be loaded once.
+	sess, err = tr.NewSession(st, ep, nil)
+	require.NoError(t, err)
+	_, err = sess.Handshake(context.Background(), transport.UploadPackService)
+	assert.ErrorIs(t, err, ErrReaderAlreadyLoaded)
+}
+
+func TestFetchMissingPrerequisites(t *testing.T) {
+	t.Parallel()
+
+	r := newBundle(t, &bundle.Header{
+		Prerequisites: []bundle.Prerequisite{{Hash: plumbing.NewHash("918c48b83bd081e863dbe1b80f8998f058cd8294")}},
+		References:    []*plumbing.Reference{plumbing.NewReferenceFromStrings("refs/heads/master", "6ecf0ef2c2dffb796033e5a02219af86ec6584e5")},
+	})
+
+	ep, err := transport.NewEndpoint("bundle://repo.bundle")
+	require.NoError(t, err)
+	sess, err := NewTransport(NewReaderLoader(r)).NewSession(memory.NewStorage(), ep, nil)
+	require.NoError(t, err)
+	conn, err := sess.Handshake(context.Background(), transport.UploadPackService)
+	require.NoError(t, err)
+	defer conn.Close()
+
+	err = conn.Fetch(context.Background(), &transport.FetchRequest{})
+	assert.ErrorIs(t, err, bundle.ErrMissingPrerequisites)
+}
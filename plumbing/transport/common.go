@@ -9,6 +9,7 @@ import (
 	"context"
 	"errors"
 	"io"
+	"time"
 
 	"github.com/go-git/go-git/v6/plumbing"
 	"github.com/go-git/go-git/v6/plumbing/protocol"
@@ -24,6 +25,9 @@ var (
 	ErrUnsupportedVersion = errors.New("unsupported protocol version")
 	// ErrUnsupportedService is returned when the service is not supported.
 	ErrUnsupportedService = errors.New("unsupported service")
+	// ErrUnsupportedCommand is returned when the server does not support a
+	// protocol v2 command.
+	ErrUnsupportedCommand = errors.New("unsupported command")
 	// ErrInvalidResponse is returned when the response is invalid.
 	ErrInvalidResponse = errors.New("invalid response")
 	// ErrTimeoutExceeded is returned when the timeout is exceeded.
@@ -94,19 +98,64 @@ type FetchRequest struct {
 	// TODO: Build this slice in the transport package.
 	Wants []plumbing.Hash
 
+	// WantRefs is the list of references to fetch by name, without having
+	// to know the objects they point to. Using protocol v2, they are
+	// resolved by the server when it supports the ref-in-want feature.
+	// Otherwise they are resolved using the references of the remote.
+	WantRefs []plumbing.ReferenceName
+
+	// WantedRefs is filled during the fetch with the references of
+	// WantRefs, pointing to the objects they were resolved to.
+	WantedRefs []*plumbing.Reference
+
 	// Haves is the list of references the client already has.
 	// TODO: Build this slice in the transport package.
 	Haves []plumbing.Hash
 
+	// Negotiator, if not nil, chooses the haves sent to the server in place
+	// of Haves, in rounds of increasing size, until the server acknowledges
+	// enough of them as common.
+	Negotiator Negotiator
+
 	// Depth is the depth of the fetch.
 	Depth int
 
+	// DeepenRelative makes Depth relative to the current shallow boundary
+	// of the client, instead of to the tips of the fetched history.
+	DeepenRelative bool
+
+	// DeepenSince limits the fetched history to the commits more recent
+	// than the given time.
+	DeepenSince time.Time
+
+	// DeepenNot limits the fetched history to the commits not reachable
+	// from the given references of the remote.
+	DeepenNot []string
+
 	// Filter holds the filters to be applied when deciding what
 	// objects will be added to the packfile.
 	Filter packp.Filter
 
 	// IncludeTags indicates whether tags should be fetched.
 	IncludeTags bool
+
+	// ThinPack requests a thin pack, whose deltas may be based on objects of
+	// Haves not sent in it, if the server supports it and the storer accepts
+	// thin packs, see packfile.AcceptsThinPacks. The bases of these deltas
+	// are then appended to the stored packfile.
+	ThinPack bool
+
+	// Resumable keeps the files partially downloaded when the fetch fails,
+	// so that the next fetch resumes their download. It is only supported by
+	// the transports downloading the files of the remote, as the dumb HTTP
+	// transport.
+	Resumable bool
+}
+
+// IsShallow returns whether the request changes the shallow boundary of the
+// client, and expects a shallow update from the server.
+func (r *FetchRequest) IsShallow() bool {
+	return r.Depth > 0 || !r.DeepenSince.IsZero() || len(r.DeepenNot) > 0
 }
 
 // PushRequest contains the parameters for a push request.
@@ -187,16 +236,30 @@ type CommandKiller interface {
 }
 
 type client struct {
-	cmdr Commander
+	cmdr     Commander
+	timeouts TimeoutOptions
 }
 
 // NewPackTransport creates a new client using the given Commander.
 func NewPackTransport(runner Commander) Transport {
-	return &client{runner}
+	return &client{cmdr: runner}
+}
+
+// NewPackTransportWithTimeouts creates a new client using the given
+// Commander, with the given timeouts for the endpoints which don't set their
+// own.
+func NewPackTransportWithTimeouts(runner Commander, timeouts TimeoutOptions) Transport {
+	return &client{cmdr: runner, timeouts: timeouts}
 }
 
 // NewSession returns a new session for an endpoint.
 func (c *client) NewSession(st storage.Storer, ep *Endpoint, auth AuthMethod) (Session, error) {
+	if ep != nil && c.timeouts != (TimeoutOptions{}) {
+		withTimeouts := *ep
+		withTimeouts.Timeouts = ep.Timeouts.WithDefaults(c.timeouts)
+		ep = &withTimeouts
+	}
+
 	return NewPackSession(st, ep, auth, c.cmdr)
 }
 
@@ -206,5 +269,6 @@ func (c *client) SupportedProtocols() []protocol.Version {
 	return []protocol.Version{
 		protocol.V0,
 		protocol.V1,
+		protocol.V2,
 	}
 }
@@ -0,0 +1,122 @@
+package credential
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// DefaultCacheTimeout is the time the credentials are kept by the cache
+// helper, as in git.
+const DefaultCacheTimeout = 900 * time.Second
+
+// Cache is the built-in cache helper, which keeps the credentials in memory
+// for a limited time.
+type Cache struct {
+	timeout time.Duration
+	now     func() time.Time
+
+	mu    sync.Mutex
+	creds []cached
+}
+
+type cached struct {
+	cred    *Credential
+	expires time.Time
+}
+
+var (
+	cachesMu sync.Mutex
+	caches   = make(map[time.Duration]*Cache)
+)
+
+// NewCache returns a cache helper keeping the credentials for the given time.
+func NewCache(timeout time.Duration) *Cache {
+	return &Cache{timeout: timeout, now: time.Now}
+}
+
+// sharedCache returns the cache of the process with the given timeout, so that
+// the credentials are kept across the helpers configured in the same way.
+func sharedCache(timeout time.Duration) *Cache {
+	cachesMu.Lock()
+	defer cachesMu.Unlock()
+
+	c, ok := caches[timeout]
+	if !ok {
+		c = NewCache(timeout)
+		caches[timeout] = c
+	}
+
+	return c
+}
+
+// Get returns the credential cached matching c, if it didn't expire.
+func (h *Cache) Get(_ context.Context, c *Credential) (*Credential, error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.expire()
+	for _, cached := range h.creds {
+		if c.matches(cached.cred) {
+			cred := *cached.cred
+			return &cred, nil
+		}
+	}
+
+	return &Credential{}, nil
+}
+
+// Store caches c, replacing the credentials matching it.
+func (h *Cache) Store(_ context.Context, c *Credential) error {
+	if !c.IsComplete() {
+		return nil
+	}
+
+	query := *c
+	query.Password = ""
+
+	cred := *c
+	cred.Quit = false
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.remove(&query)
+	h.creds = append(h.creds, cached{cred: &cred, expires: h.now().Add(h.timeout)})
+	return nil
+}
+
+// Erase removes the credentials matching c from the cache.
+func (h *Cache) Erase(_ context.Context, c *Credential) error {
+	query := *c
+	query.Password = ""
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.remove(&query)
+	return nil
+}
+
+func (h *Cache) remove(query *Credential) {
+	creds := h.creds[:0]
+	for _, cached := range h.creds {
+		if !query.matches(cached.cred) {
+			creds = append(creds, cached)
+		}
+	}
+
+	h.creds = creds
+}
+
+func (h *Cache) expire() {
+	now := h.now()
+	creds := h.creds[:0]
+	for _, cached := range h.creds {
+		if now.Before(cached.expires) {
+			creds = append(creds, cached)
+		}
+	}
+
+	h.creds = creds
+}
@@ -0,0 +1,37 @@
+package credential
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCache(t *testing.T) {
+	t.Parallel()
+
+	now := time.Now()
+	c := NewCache(time.Minute)
+	c.now = func() time.Time { return now }
+
+	ctx := context.Background()
+	cred := &Credential{Protocol: "https", Host: "example.com", Username: "user", Password: "secret"}
+	require.NoError(t, c.Store(ctx, cred))
+	require.NoError(t, c.Store(ctx, &Credential{Protocol: "https", Host: "other.com", Username: "user", Password: "other"}))
+
+	got, err := c.Get(ctx, &Credential{Protocol: "https", Host: "example.com"})
+	require.NoError(t, err)
+	assert.Equal(t, cred, got)
+
+	require.NoError(t, c.Erase(ctx, &Credential{Protocol: "https", Host: "example.com"}))
+	got, err = c.Get(ctx, &Credential{Protocol: "https", Host: "example.com"})
+	require.NoError(t, err)
+	assert.Equal(t, &Credential{}, got)
+
+	now = now.Add(time.Minute)
+	got, err = c.Get(ctx, &Credential{Protocol: "https", Host: "other.com"})
+	require.NoError(t, err)
+	assert.Equal(t, &Credential{}, got)
+}
@@ -0,0 +1,91 @@
+package credential
+
+import (
+	"net/url"
+
+	iurl "github.com/go-git/go-git/v6/internal/url"
+	format "github.com/go-git/go-git/v6/plumbing/format/config"
+)
+
+const (
+	credentialSection = "credential"
+	helperKey         = "helper"
+	useHTTPPathKey    = "useHttpPath"
+)
+
+// Config is the credential configuration of a URL.
+type Config struct {
+	// Helpers are the helpers configured by the credential.helper and
+	// credential.<url>.helper options.
+	Helpers Helpers
+	// Username is the username configured by the credential.username and
+	// credential.<url>.username options, used when the URL has none.
+	Username string
+	// UseHTTPPath is whether the path of the URL is given to the helpers for
+	// the http and https URLs, configured by credential.useHttpPath.
+	UseHTTPPath bool
+}
+
+// ReadConfig returns the credential configuration of the given URL from the
+// credential section and the matching credential.<url> subsections of the
+// given configs, from the lowest to the highest priority. A helper option with
+// an empty value resets the list of helpers, as in git.
+func ReadConfig(u *url.URL, cfgs ...*format.Config) (*Config, error) {
+	c := &Config{}
+	var helpers []string
+	for _, cfg := range cfgs {
+		if cfg == nil || !cfg.HasSection(credentialSection) {
+			continue
+		}
+
+		s := cfg.Section(credentialSection)
+		options := []format.Options{s.Options}
+		for _, ss := range s.Subsections {
+			if iurl.MatchesConfigURL(ss.Name, u) {
+				options = append(options, ss.Options)
+			}
+		}
+
+		for _, opts := range options {
+			for _, o := range opts {
+				switch {
+				case o.IsKey(helperKey) && o.Value == "":
+					helpers = nil
+				case o.IsKey(helperKey):
+					helpers = append(helpers, o.Value)
+				case o.IsKey(usernameKey):
+					c.Username = o.Value
+				case o.IsKey(useHTTPPathKey):
+					c.UseHTTPPath = format.IsTrue(o.Value)
+				}
+			}
+		}
+	}
+
+	for _, value := range helpers {
+		h, err := NewHelper(value)
+		if err != nil {
+			return nil, err
+		}
+
+		c.Helpers = append(c.Helpers, h)
+	}
+
+	return c, nil
+}
+
+// Credential returns the credential to look for to access the given URL, with
+// the configured username if it has none, and without its path if it doesn't
+// matter to the helpers.
+func (c *Config) Credential(u *url.URL) *Credential {
+	cred := FromURL(u)
+	if cred.Username == "" {
+		cred.Username = c.Username
+	}
+
+	if (cred.Protocol == "http" || cred.Protocol == "https") && !c.UseHTTPPath {
+		cred.Path = ""
+	}
+
+	return cred
+}
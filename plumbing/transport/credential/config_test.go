@@ -0,0 +1,64 @@
+package credential
+
+import (
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	format "github.com/go-git/go-git/v6/plumbing/format/config"
+)
+
+func decodeConfig(t *testing.T, content string) *format.Config {
+	t.Helper()
+
+	cfg := format.New()
+	require.NoError(t, format.NewDecoder(strings.NewReader(content)).Decode(cfg))
+	return cfg
+}
+
+func TestReadConfig(t *testing.T) {
+	t.Parallel()
+
+	global := decodeConfig(t, `[credential]
+	helper = cache
+	helper = osxkeychain
+	username = global
+[credential "https://example.com"]
+	helper = store
+[credential "https://other.com"]
+	helper = other
+`)
+	local := decodeConfig(t, `[credential]
+	helper =
+	helper = !local
+[credential "https://example.com/org"]
+	username = org
+	useHttpPath = true
+`)
+
+	u, err := url.Parse("https://example.com/org/repo.git")
+	require.NoError(t, err)
+
+	cfg, err := ReadConfig(u, nil, global, local)
+	require.NoError(t, err)
+	require.Len(t, cfg.Helpers, 1)
+	assert.Equal(t, "local", cfg.Helpers[0].(*command).cmd)
+	assert.Equal(t, "org", cfg.Username)
+	assert.True(t, cfg.UseHTTPPath)
+	assert.Equal(t, &Credential{Protocol: "https", Host: "example.com", Path: "org/repo.git", Username: "org"}, cfg.Credential(u))
+
+	cfg, err = ReadConfig(u, global)
+	require.NoError(t, err)
+	require.Len(t, cfg.Helpers, 3)
+	assert.IsType(t, &Cache{}, cfg.Helpers[0])
+	assert.Equal(t, "git credential-osxkeychain", cfg.Helpers[1].(*command).cmd)
+	assert.IsType(t, &Store{}, cfg.Helpers[2])
+	assert.Equal(t, &Credential{Protocol: "https", Host: "example.com", Username: "global"}, cfg.Credential(u))
+
+	cfg, err = ReadConfig(u)
+	require.NoError(t, err)
+	assert.Empty(t, cfg.Helpers)
+}
@@ -0,0 +1,213 @@
+// Package credential implements the protocol of the git credential helpers,
+// which store and retrieve the credentials used to authenticate with remote
+// repositories, along with the built-in store and cache helpers.
+//
+// See https://git-scm.com/docs/git-credential and
+// https://git-scm.com/docs/gitcredentials.
+package credential
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"strings"
+)
+
+const (
+	protocolKey = "protocol"
+	hostKey     = "host"
+	pathKey     = "path"
+	usernameKey = "username"
+	passwordKey = "password"
+	urlKey      = "url"
+	quitKey     = "quit"
+)
+
+var (
+	// ErrInvalidValue is returned when a credential attribute contains a
+	// newline or a NUL character, which can't be sent to a helper.
+	ErrInvalidValue = errors.New("credential value contains a newline or NUL character")
+	// ErrNoCredential is returned when none of the helpers returns a username
+	// and a password.
+	ErrNoCredential = errors.New("no credential found")
+	// ErrQuit is returned when a helper asks not to look for the credential
+	// any further.
+	ErrQuit = errors.New("credential helper asked to quit")
+)
+
+// Credential is a credential, as described by the attributes of the git
+// credential protocol.
+type Credential struct {
+	// Protocol is the protocol over which the credential is used, such as
+	// https.
+	Protocol string
+	// Host is the remote hostname, with its port if it was given.
+	Host string
+	// Path is the path of the repository, only matched by the helpers when
+	// credential.useHttpPath is set.
+	Path string
+	// Username is the username of the credential.
+	Username string
+	// Password is the password of the credential.
+	Password string
+	// Quit is set by a helper which asks not to look for the credential any
+	// further.
+	Quit bool
+}
+
+// FromURL returns the credential to look for to access the given URL. Its
+// username and password are the ones of the URL, if any.
+func FromURL(u *url.URL) *Credential {
+	c := &Credential{
+		Protocol: u.Scheme,
+		Host:     u.Host,
+		Path:     strings.TrimPrefix(u.Path, "/"),
+	}
+
+	if u.User != nil {
+		c.Username = u.User.Username()
+		c.Password, _ = u.User.Password()
+	}
+
+	return c
+}
+
+// URL returns the URL of the credential, with its username and password.
+func (c *Credential) URL() *url.URL {
+	u := &url.URL{
+		Scheme: c.Protocol,
+		Host:   c.Host,
+	}
+
+	if c.Path != "" {
+		u.Path = "/" + c.Path
+	}
+
+	switch {
+	case c.Password != "":
+		u.User = url.UserPassword(c.Username, c.Password)
+	case c.Username != "":
+		u.User = url.User(c.Username)
+	}
+
+	return u
+}
+
+// IsComplete returns whether both the username and the password of the
+// credential are known.
+func (c *Credential) IsComplete() bool {
+	return c.Username != "" && c.Password != ""
+}
+
+// Encode writes the attributes of the credential to w, in the format read by
+// the helpers: one key=value line per attribute which is set.
+func (c *Credential) Encode(w io.Writer) error {
+	for _, attr := range [][2]string{
+		{protocolKey, c.Protocol},
+		{hostKey, c.Host},
+		{pathKey, c.Path},
+		{usernameKey, c.Username},
+		{passwordKey, c.Password},
+	} {
+		if attr[1] == "" {
+			continue
+		}
+
+		if strings.ContainsAny(attr[1], "\n\x00") {
+			return fmt.Errorf("%w: %s", ErrInvalidValue, attr[0])
+		}
+
+		if _, err := fmt.Fprintf(w, "%s=%s\n", attr[0], attr[1]); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Decode reads the attributes written by a helper from r, until a blank line
+// or the end of the input, and sets them on the credential. The unknown
+// attributes are ignored, and the url attribute is split into the ones it is
+// made of.
+func (c *Credential) Decode(r io.Reader) error {
+	s := bufio.NewScanner(r)
+	for s.Scan() {
+		line := s.Text()
+		if line == "" {
+			break
+		}
+
+		key, value, ok := strings.Cut(line, "=")
+		if !ok {
+			return fmt.Errorf("invalid credential line: %q", line)
+		}
+
+		switch key {
+		case protocolKey:
+			c.Protocol = value
+		case hostKey:
+			c.Host = value
+		case pathKey:
+			c.Path = value
+		case usernameKey:
+			c.Username = value
+		case passwordKey:
+			c.Password = value
+		case urlKey:
+			u, err := url.Parse(value)
+			if err != nil {
+				return err
+			}
+
+			*c = *FromURL(u)
+		case quitKey:
+			c.Quit = value == "1" || value == "true"
+		}
+	}
+
+	return s.Err()
+}
+
+// matches returns whether the credential has is a match for c, as git does:
+// each attribute of c which is set must be equal to the one of has.
+func (c *Credential) matches(has *Credential) bool {
+	for _, attr := range [][2]string{
+		{c.Protocol, has.Protocol},
+		{c.Host, has.Host},
+		{c.Path, has.Path},
+		{c.Username, has.Username},
+	} {
+		if attr[0] != "" && attr[0] != attr[1] {
+			return false
+		}
+	}
+
+	return true
+}
+
+// merge sets the attributes of c which are set in other.
+func (c *Credential) merge(other *Credential) {
+	if other.Protocol != "" {
+		c.Protocol = other.Protocol
+	}
+
+	if other.Host != "" {
+		c.Host = other.Host
+	}
+
+	if other.Path != "" {
+		c.Path = other.Path
+	}
+
+	if other.Username != "" {
+		c.Username = other.Username
+	}
+
+	if other.Password != "" {
+		c.Password = other.Password
+	}
+
+	c.Quit = c.Quit || other.Quit
+}
@@ -0,0 +1,195 @@
+package credential
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os/exec"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	getAction   = "get"
+	storeAction = "store"
+	eraseAction = "erase"
+
+	storeHelper = "store"
+	cacheHelper = "cache"
+)
+
+// Helper is a credential helper.
+type Helper interface {
+	// Get returns the attributes the helper knows for the given credential,
+	// which may be empty.
+	Get(ctx context.Context, c *Credential) (*Credential, error)
+	// Store stores the given credential, which was accepted by the remote.
+	Store(ctx context.Context, c *Credential) error
+	// Erase erases the credentials matching the given one, which was rejected
+	// by the remote.
+	Erase(ctx context.Context, c *Credential) error
+}
+
+// Helpers are the credential helpers configured for a remote, in the order
+// they are asked for a credential.
+type Helpers []Helper
+
+// Fill returns the credential given with its username and password, asking
+// the helpers for them in turn as git credential fill does: the attributes
+// returned by each helper are set on the credential, until both the username
+// and the password are known or a helper asks to quit. It returns
+// ErrNoCredential if none of the helpers knows them.
+func (h Helpers) Fill(ctx context.Context, c *Credential) (*Credential, error) {
+	filled := *c
+	if filled.IsComplete() {
+		return &filled, nil
+	}
+
+	var errs []error
+	for _, helper := range h {
+		got, err := helper.Get(ctx, &filled)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+
+		filled.merge(got)
+		if filled.Quit {
+			return nil, ErrQuit
+		}
+
+		if filled.IsComplete() {
+			return &filled, nil
+		}
+	}
+
+	return nil, errors.Join(append([]error{ErrNoCredential}, errs...)...)
+}
+
+// Approve stores the given credential, which was accepted by the remote, in
+// all the helpers.
+func (h Helpers) Approve(ctx context.Context, c *Credential) error {
+	if !c.IsComplete() {
+		return nil
+	}
+
+	var errs []error
+	for _, helper := range h {
+		errs = append(errs, helper.Store(ctx, c))
+	}
+
+	return errors.Join(errs...)
+}
+
+// Reject erases the given credential, which was rejected by the remote, from
+// all the helpers.
+func (h Helpers) Reject(ctx context.Context, c *Credential) error {
+	var errs []error
+	for _, helper := range h {
+		errs = append(errs, helper.Erase(ctx, c))
+	}
+
+	return errors.Join(errs...)
+}
+
+// NewHelper returns the helper configured by a credential.helper value, as
+// git does: the store and cache helpers are built in, the values starting
+// with ! are shell commands, the absolute paths are programs run with their
+// arguments, and the others are the names of the git-credential-<name>
+// programs run with their arguments by git.
+//
+// The built-in cache helper keeps the credentials in memory, for the lifetime
+// of the process, instead of in the git credential-cache daemon.
+func NewHelper(value string) (Helper, error) {
+	fields := strings.Fields(value)
+	if len(fields) == 0 {
+		return nil, fmt.Errorf("empty credential helper")
+	}
+
+	switch fields[0] {
+	case storeHelper:
+		var files []string
+		for _, arg := range fields[1:] {
+			if file, ok := strings.CutPrefix(arg, "--file="); ok {
+				files = append(files, file)
+			}
+		}
+
+		return NewStore(nil, files...), nil
+	case cacheHelper:
+		timeout := DefaultCacheTimeout
+		for _, arg := range fields[1:] {
+			if v, ok := strings.CutPrefix(arg, "--timeout="); ok {
+				seconds, err := strconv.Atoi(v)
+				if err != nil {
+					return nil, fmt.Errorf("invalid credential cache timeout: %w", err)
+				}
+
+				timeout = time.Duration(seconds) * time.Second
+			}
+		}
+
+		return sharedCache(timeout), nil
+	}
+
+	switch {
+	case strings.HasPrefix(value, "!"):
+		return &command{cmd: value[1:]}, nil
+	case strings.HasPrefix(value, "/"):
+		return &command{cmd: value}, nil
+	default:
+		return &command{cmd: "git credential-" + value}, nil
+	}
+}
+
+// command is a helper run as a shell command, with the action appended to
+// its arguments, which reads the credential from its standard input and
+// writes the attributes it knows to its standard output.
+type command struct {
+	cmd string
+}
+
+func (h *command) Get(ctx context.Context, c *Credential) (*Credential, error) {
+	out, err := h.run(ctx, getAction, c)
+	if err != nil {
+		return nil, err
+	}
+
+	got := &Credential{}
+	if err := got.Decode(bytes.NewReader(out)); err != nil {
+		return nil, err
+	}
+
+	return got, nil
+}
+
+func (h *command) Store(ctx context.Context, c *Credential) error {
+	_, err := h.run(ctx, storeAction, c)
+	return err
+}
+
+func (h *command) Erase(ctx context.Context, c *Credential) error {
+	_, err := h.run(ctx, eraseAction, c)
+	return err
+}
+
+func (h *command) run(ctx context.Context, action string, c *Credential) ([]byte, error) {
+	var in bytes.Buffer
+	if err := c.Encode(&in); err != nil {
+		return nil, err
+	}
+
+	var stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, "sh", "-c", h.cmd+" "+action)
+	cmd.Stdin = &in
+	cmd.Stderr = &stderr
+
+	out, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("credential helper %q: %w: %s", h.cmd, err, bytes.TrimSpace(stderr.Bytes()))
+	}
+
+	return out, nil
+}
@@ -0,0 +1,176 @@
+package credential
+
+import (
+	"context"
+	"os/exec"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type mockHelper struct {
+	get    *Credential
+	err    error
+	gets   []Credential
+	stored []Credential
+	erased []Credential
+}
+
+func (h *mockHelper) Get(_ context.Context, c *Credential) (*Credential, error) {
+	h.gets = append(h.gets, *c)
+	if h.err != nil {
+		return nil, h.err
+	}
+
+	if h.get == nil {
+		return &Credential{}, nil
+	}
+
+	return h.get, nil
+}
+
+func (h *mockHelper) Store(_ context.Context, c *Credential) error {
+	h.stored = append(h.stored, *c)
+	return nil
+}
+
+func (h *mockHelper) Erase(_ context.Context, c *Credential) error {
+	h.erased = append(h.erased, *c)
+	return nil
+}
+
+func TestHelpersFill(t *testing.T) {
+	t.Parallel()
+
+	empty := &mockHelper{}
+	username := &mockHelper{get: &Credential{Username: "user"}}
+	password := &mockHelper{get: &Credential{Password: "secret"}}
+	unused := &mockHelper{get: &Credential{Username: "other", Password: "other"}}
+
+	query := &Credential{Protocol: "https", Host: "example.com"}
+	c, err := Helpers{empty, username, password, unused}.Fill(context.Background(), query)
+	require.NoError(t, err)
+	assert.Equal(t, &Credential{Protocol: "https", Host: "example.com", Username: "user", Password: "secret"}, c)
+	assert.Equal(t, &Credential{Protocol: "https", Host: "example.com"}, query)
+
+	// The attributes known are given to the next helpers.
+	assert.Equal(t, []Credential{{Protocol: "https", Host: "example.com", Username: "user"}}, password.gets)
+	assert.Empty(t, unused.gets)
+
+	_, err = Helpers{empty, username}.Fill(context.Background(), query)
+	assert.ErrorIs(t, err, ErrNoCredential)
+
+	_, err = Helpers{&mockHelper{get: &Credential{Quit: true}}, unused}.Fill(context.Background(), query)
+	assert.ErrorIs(t, err, ErrQuit)
+
+	// The helpers which fail are skipped.
+	failing := &mockHelper{err: assert.AnError}
+	c, err = Helpers{failing, unused}.Fill(context.Background(), query)
+	require.NoError(t, err)
+	assert.Equal(t, "other", c.Username)
+
+	_, err = Helpers{failing}.Fill(context.Background(), query)
+	assert.ErrorIs(t, err, ErrNoCredential)
+	assert.ErrorIs(t, err, assert.AnError)
+}
+
+func TestHelpersApproveReject(t *testing.T) {
+	t.Parallel()
+
+	a, b := &mockHelper{}, &mockHelper{}
+	c := &Credential{Protocol: "https", Host: "example.com", Username: "user", Password: "secret"}
+
+	require.NoError(t, Helpers{a, b}.Approve(context.Background(), c))
+	assert.Equal(t, []Credential{*c}, a.stored)
+	assert.Equal(t, []Credential{*c}, b.stored)
+
+	require.NoError(t, Helpers{a, b}.Approve(context.Background(), &Credential{Protocol: "https", Host: "example.com"}))
+	assert.Len(t, a.stored, 1)
+
+	require.NoError(t, Helpers{a, b}.Reject(context.Background(), c))
+	assert.Equal(t, []Credential{*c}, a.erased)
+	assert.Equal(t, []Credential{*c}, b.erased)
+}
+
+func TestNewHelper(t *testing.T) {
+	t.Parallel()
+
+	h, err := NewHelper("store --file=/tmp/a --file=/tmp/b")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"/tmp/a", "/tmp/b"}, h.(*Store).files)
+
+	h, err = NewHelper("cache --timeout=30")
+	require.NoError(t, err)
+	assert.Equal(t, 30*time.Second, h.(*Cache).timeout)
+
+	h2, err := NewHelper("cache --timeout=30")
+	require.NoError(t, err)
+	assert.Same(t, h, h2)
+
+	_, err = NewHelper("cache --timeout=foo")
+	assert.Error(t, err)
+
+	h, err = NewHelper("osxkeychain")
+	require.NoError(t, err)
+	assert.Equal(t, "git credential-osxkeychain", h.(*command).cmd)
+
+	h, err = NewHelper("/usr/bin/helper --option")
+	require.NoError(t, err)
+	assert.Equal(t, "/usr/bin/helper --option", h.(*command).cmd)
+
+	h, err = NewHelper("!f() { echo password=secret; }; f")
+	require.NoError(t, err)
+	assert.Equal(t, "f() { echo password=secret; }; f", h.(*command).cmd)
+
+	_, err = NewHelper(" ")
+	assert.Error(t, err)
+}
+
+func TestCommandHelper(t *testing.T) {
+	if _, err := exec.LookPath("sh"); err != nil {
+		t.Skip("sh not found")
+	}
+
+	t.Parallel()
+
+	dir := t.TempDir()
+	log := filepath.Join(dir, "log")
+
+	// The helper logs its action and input, and answers with a password
+	// for the user.
+	h, err := NewHelper(`!f() { echo "$1" >>` + log + `; cat >>` + log + `; [ "$1" = get ] && echo password=secret; true; }; f`)
+	require.NoError(t, err)
+
+	c, err := Helpers{h}.Fill(context.Background(), &Credential{Protocol: "https", Host: "example.com", Username: "user"})
+	require.NoError(t, err)
+	assert.Equal(t, &Credential{Protocol: "https", Host: "example.com", Username: "user", Password: "secret"}, c)
+
+	require.NoError(t, Helpers{h}.Approve(context.Background(), c))
+	require.NoError(t, Helpers{h}.Reject(context.Background(), c))
+
+	b, err := exec.Command("cat", log).Output()
+	require.NoError(t, err)
+	assert.Equal(t, `get
+protocol=https
+host=example.com
+username=user
+store
+protocol=https
+host=example.com
+username=user
+password=secret
+erase
+protocol=https
+host=example.com
+username=user
+password=secret
+`, string(b))
+
+	h, err = NewHelper("!echo failed >&2; false")
+	require.NoError(t, err)
+	_, err = h.Get(context.Background(), c)
+	assert.ErrorContains(t, err, "failed")
+}
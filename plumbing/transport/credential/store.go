@@ -0,0 +1,184 @@
+package credential
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/go-git/go-billy/v6"
+	"github.com/go-git/go-billy/v6/osfs"
+	"github.com/go-git/go-billy/v6/util"
+)
+
+// Store is the built-in store helper, which stores the credentials unencrypted
+// in files, one URL with its username and password per line, as git
+// credential-store does.
+type Store struct {
+	fs    billy.Basic
+	files []string
+}
+
+// NewStore returns a store helper reading the credentials from the given
+// files of fs, and storing them in the first one which exists, or else in the
+// first one. If fs is nil, the files are read from the OS filesystem. If no
+// file is given, they are ~/.git-credentials and
+// $XDG_CONFIG_HOME/git/credentials.
+func NewStore(fs billy.Basic, files ...string) *Store {
+	if fs == nil {
+		fs = osfs.Default
+	}
+
+	if len(files) == 0 {
+		files = defaultStoreFiles()
+	}
+
+	return &Store{fs: fs, files: files}
+}
+
+func defaultStoreFiles() []string {
+	var files []string
+	home, err := os.UserHomeDir()
+	if err == nil {
+		files = append(files, filepath.Join(home, ".git-credentials"))
+	}
+
+	if xdg := os.Getenv("XDG_CONFIG_HOME"); xdg != "" {
+		files = append(files, filepath.Join(xdg, "git", "credentials"))
+	} else if home != "" {
+		files = append(files, filepath.Join(home, ".config", "git", "credentials"))
+	}
+
+	return files
+}
+
+// Get returns the first credential of the files matching c.
+func (s *Store) Get(_ context.Context, c *Credential) (*Credential, error) {
+	for _, file := range s.files {
+		creds, err := s.read(file)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, cred := range creds {
+			if c.matches(cred) {
+				return cred, nil
+			}
+		}
+	}
+
+	return &Credential{}, nil
+}
+
+// Store stores c in the first file which exists, replacing the credentials
+// matching it, or else in the first file.
+func (s *Store) Store(_ context.Context, c *Credential) error {
+	if c.Protocol == "" || c.Host == "" || !c.IsComplete() {
+		return nil
+	}
+
+	target := ""
+	for _, file := range s.files {
+		if _, err := s.fs.Stat(file); err == nil {
+			target = file
+			break
+		}
+	}
+
+	if target == "" {
+		if len(s.files) == 0 {
+			return nil
+		}
+
+		target = s.files[0]
+	}
+
+	query := *c
+	query.Password = ""
+	return s.rewrite(target, &query, c)
+}
+
+// Erase removes the credentials matching c from all the files.
+func (s *Store) Erase(_ context.Context, c *Credential) error {
+	if c.Protocol == "" && c.Host == "" && c.Path == "" && c.Username == "" {
+		return nil
+	}
+
+	query := *c
+	query.Password = ""
+	for _, file := range s.files {
+		if _, err := s.fs.Stat(file); err != nil {
+			continue
+		}
+
+		if err := s.rewrite(file, &query, nil); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// read returns the credentials of the file, which may not exist.
+func (s *Store) read(file string) ([]*Credential, error) {
+	b, err := util.ReadFile(s.fs, file)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	var creds []*Credential
+	sc := bufio.NewScanner(bytes.NewReader(b))
+	for sc.Scan() {
+		line := strings.TrimSpace(sc.Text())
+		if line == "" {
+			continue
+		}
+
+		u, err := url.Parse(line)
+		if err != nil || u.Scheme == "" || u.Host == "" {
+			continue
+		}
+
+		creds = append(creds, FromURL(u))
+	}
+
+	return creds, sc.Err()
+}
+
+// rewrite writes the file without the credentials matching query, with added
+// appended if not nil.
+func (s *Store) rewrite(file string, query, added *Credential) error {
+	creds, err := s.read(file)
+	if err != nil {
+		return err
+	}
+
+	var buf bytes.Buffer
+	for _, cred := range creds {
+		if query.matches(cred) {
+			continue
+		}
+
+		buf.WriteString(cred.URL().String() + "\n")
+	}
+
+	if added != nil {
+		buf.WriteString(added.URL().String() + "\n")
+	}
+
+	if fs, ok := s.fs.(billy.Dir); ok {
+		if err := fs.MkdirAll(filepath.Dir(file), 0o700); err != nil {
+			return err
+		}
+	}
+
+	return util.WriteFile(s.fs, file, buf.Bytes(), 0o600)
+}
@@ -3,8 +3,10 @@ package transport
 import (
 	"context"
 	"io"
+	"sync/atomic"
 
 	"github.com/go-git/go-git/v6/plumbing/format/packfile"
+	"github.com/go-git/go-git/v6/plumbing/protocol"
 	"github.com/go-git/go-git/v6/plumbing/protocol/packp"
 	"github.com/go-git/go-git/v6/plumbing/protocol/packp/capability"
 	"github.com/go-git/go-git/v6/plumbing/protocol/packp/sideband"
@@ -28,18 +30,32 @@ func FetchPack(
 	var demuxer *sideband.Demuxer
 	var reader io.Reader = packf
 	caps := conn.Capabilities()
-	if caps.Supports(capability.Sideband64k) {
+	if conn.Version() == protocol.V2 {
+		// Using protocol v2, the packfile is always multiplexed.
 		demuxer = sideband.NewDemuxer(sideband.Sideband64k, reader)
-	} else if caps.Supports(capability.Sideband) {
-		demuxer = sideband.NewDemuxer(sideband.Sideband, reader)
-	}
-
-	if demuxer != nil && req.Progress != nil {
 		demuxer.Progress = req.Progress
 		reader = demuxer
+	} else {
+		if caps.Supports(capability.Sideband64k) {
+			demuxer = sideband.NewDemuxer(sideband.Sideband64k, reader)
+		} else if caps.Supports(capability.Sideband) {
+			demuxer = sideband.NewDemuxer(sideband.Sideband, reader)
+		}
+
+		if demuxer != nil && req.Progress != nil {
+			demuxer.Progress = req.Progress
+			reader = demuxer
+		}
+	}
+
+	opts := []packfile.ParserOption{packfile.WithContext(ctx)}
+	if r, ok := req.Progress.(sideband.ProgressReporter); ok {
+		pr := &packProgress{r: r, reader: reader}
+		reader = pr
+		opts = append(opts, packfile.WithProgress(pr))
 	}
 
-	if err := packfile.UpdateObjectStorage(st, reader); err != nil {
+	if err := packfile.UpdateObjectStorageWithOptions(st, reader, opts...); err != nil {
 		return err
 	}
 
@@ -85,3 +101,38 @@ outer:
 
 	return st.SetShallow(shallows)
 }
+
+// packProgress reports the progress of the reading of a packfile, counting
+// the bytes read from it.
+type packProgress struct {
+	r      sideband.ProgressReporter
+	reader io.Reader
+	// bytes is read by the parser of the packfile, which may run in another
+	// goroutine.
+	bytes atomic.Uint64
+}
+
+func (p *packProgress) Read(b []byte) (int, error) {
+	n, err := p.reader.Read(b)
+	p.bytes.Add(uint64(n))
+	return n, err
+}
+
+func (p *packProgress) OnObjectRead(current, total uint32) {
+	p.r.Report(sideband.ProgressEvent{
+		Phase:   sideband.ReceivingObjects,
+		Current: uint64(current),
+		Total:   uint64(total),
+		Bytes:   p.bytes.Load(),
+		Done:    current == total,
+	})
+}
+
+func (p *packProgress) OnDeltaResolved(current, total uint32) {
+	p.r.Report(sideband.ProgressEvent{
+		Phase:   sideband.ResolvingDeltas,
+		Current: uint64(current),
+		Total:   uint64(total),
+		Done:    current == total,
+	})
+}
@@ -9,6 +9,8 @@ import (
 	"sync"
 
 	"github.com/go-git/go-git/v6/plumbing/transport"
+	"github.com/go-git/go-git/v6/plumbing/transport/bundle"
+	"github.com/go-git/go-git/v6/storage"
 )
 
 func init() {
@@ -23,12 +25,31 @@ type runner struct {
 }
 
 // NewTransport returns a new file transport that users go-git built-in server
-// implementation to serve repositories.
+// implementation to serve repositories. Paths to bundle files are read using
+// the bundle transport.
 func NewTransport(loader transport.Loader) transport.Transport {
 	if loader == nil {
 		loader = transport.DefaultLoader
 	}
-	return transport.NewPackTransport(&runner{loader})
+	return &client{
+		Transport: transport.NewPackTransport(&runner{loader}),
+		bundle:    bundle.DefaultTransport,
+	}
+}
+
+type client struct {
+	transport.Transport
+	bundle transport.Transport
+}
+
+// NewSession returns a new session for an endpoint, using the bundle
+// transport if the endpoint is a bundle file.
+func (c *client) NewSession(st storage.Storer, ep *transport.Endpoint, auth transport.AuthMethod) (transport.Session, error) {
+	if bundle.IsBundle(ep.Path) {
+		return c.bundle.NewSession(st, ep, auth)
+	}
+
+	return c.Transport.NewSession(st, ep, auth)
 }
 
 func (r *runner) Command(ctx context.Context, cmd string, ep *transport.Endpoint, auth transport.AuthMethod, params ...string) (transport.Command, error) {
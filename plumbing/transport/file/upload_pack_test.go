@@ -9,7 +9,9 @@ import (
 	"github.com/stretchr/testify/suite"
 
 	"github.com/go-git/go-git/v6/internal/transport/test"
+	"github.com/go-git/go-git/v6/plumbing"
 	"github.com/go-git/go-git/v6/plumbing/cache"
+	"github.com/go-git/go-git/v6/plumbing/protocol"
 	"github.com/go-git/go-git/v6/plumbing/transport"
 	"github.com/go-git/go-git/v6/storage/filesystem"
 	"github.com/go-git/go-git/v6/storage/memory"
@@ -54,3 +56,26 @@ func (s *UploadPackSuite) TestNonExistentCommand() {
 	s.Nil(conn)
 	s.Error(err)
 }
+
+func (s *UploadPackSuite) TestFallbackFromV2() {
+	st := memory.NewStorage()
+	session, err := DefaultTransport.NewSession(st, s.Endpoint, s.EmptyAuth)
+	s.Require().NoError(err)
+	conn, err := session.Handshake(context.TODO(), transport.UploadPackService, transport.VersionParam(protocol.V2))
+	s.Require().NoError(err)
+	defer func() { s.NoError(conn.Close()) }()
+
+	s.Equal(protocol.V0, conn.Version())
+
+	master := plumbing.NewHash("6ecf0ef2c2dffb796033e5a02219af86ec6584e5")
+	refs, err := transport.ListRefs(context.TODO(), conn, "refs/heads/master")
+	s.Require().NoError(err)
+	s.Equal([]*plumbing.Reference{plumbing.NewHashReference(plumbing.Master, master)}, refs)
+
+	req := &transport.FetchRequest{
+		WantRefs: []plumbing.ReferenceName{plumbing.Master},
+	}
+	s.Require().NoError(conn.Fetch(context.TODO(), req))
+	s.Equal([]*plumbing.Reference{plumbing.NewHashReference(plumbing.Master, master)}, req.WantedRefs)
+	s.NoError(st.HasEncodedObject(master))
+}
@@ -26,7 +26,7 @@ type runner struct{}
 // Command returns a new Command for the given cmd in the given Endpoint
 func (r *runner) Command(ctx context.Context, cmd string, ep *transport.Endpoint, _ transport.AuthMethod, params ...string) (transport.Command, error) {
 	c := &command{command: cmd, endpoint: ep, params: params}
-	if err := c.connect(); err != nil {
+	if err := c.connect(ctx); err != nil {
 		return nil, err
 	}
 
@@ -49,18 +49,21 @@ func (c *command) Start() error {
 		ExtraParams:    c.params,
 	}
 
-	req.Host = c.getHostWithPort()
+	// As git does, the port is only given to the server when it isn't the
+	// default one.
+	req.Host = c.endpoint.Host
 
 	return req.Encode(c.conn)
 }
 
-func (c *command) connect() error {
+func (c *command) connect(ctx context.Context) error {
 	if c.connected {
 		return transport.ErrAlreadyConnected
 	}
 
+	d := net.Dialer{Timeout: c.endpoint.Timeouts.Dial}
 	var err error
-	c.conn, err = net.Dial("tcp", c.getHostWithPort())
+	c.conn, err = d.DialContext(ctx, "tcp", c.getHostWithPort())
 	if err != nil {
 		return err
 	}
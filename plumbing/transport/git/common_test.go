@@ -93,3 +93,12 @@ func waitForPort(ctx context.Context, port int) error {
 		}
 	}
 }
+
+func TestCommandCanceledContext(t *testing.T) {
+	_, port := setupTest(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	_, err := (&runner{}).Command(ctx, transport.UploadPackService.String(), newEndpoint(t, port, "basic.git"), nil)
+	assert.ErrorIs(t, err, context.Canceled)
+}
@@ -1,15 +1,23 @@
 package git
 
 import (
+	"context"
 	"os/exec"
 	"runtime"
 	"testing"
 
 	fixtures "github.com/go-git/go-git-fixtures/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 	"github.com/stretchr/testify/suite"
 
 	"github.com/go-git/go-git/v6/internal/transport/test"
+	"github.com/go-git/go-git/v6/plumbing"
+	"github.com/go-git/go-git/v6/plumbing/protocol"
+	"github.com/go-git/go-git/v6/plumbing/protocol/packp/capability"
+	"github.com/go-git/go-git/v6/plumbing/transport"
 	"github.com/go-git/go-git/v6/storage/filesystem"
+	"github.com/go-git/go-git/v6/storage/memory"
 )
 
 func TestUploadPackSuite(t *testing.T) {
@@ -43,3 +51,60 @@ func (s *UploadPackSuite) SetupTest() {
 func (s *UploadPackSuite) TearDownTest() {
 	stopDaemon(s.T(), s.daemon)
 }
+
+func TestUploadPackV2(t *testing.T) {
+	base, port := setupTest(t)
+	test.PrepareRepository(t, fixtures.Basic().One(), base, "basic.git")
+	daemon := startDaemon(t, base, port)
+	defer stopDaemon(t, daemon)
+
+	st := memory.NewStorage()
+	session, err := DefaultClient.NewSession(st, newEndpoint(t, port, "basic.git"), nil)
+	require.NoError(t, err)
+	conn, err := session.Handshake(context.TODO(), transport.UploadPackService, transport.VersionParam(protocol.V2))
+	require.NoError(t, err)
+	defer func() { require.NoError(t, conn.Close()) }()
+
+	require.Equal(t, protocol.V2, conn.Version())
+	assert.True(t, conn.Capabilities().Supports(capability.LsRefs))
+
+	master := plumbing.NewHash("6ecf0ef2c2dffb796033e5a02219af86ec6584e5")
+	refs, err := transport.ListRefs(context.TODO(), conn, "refs/heads/master")
+	require.NoError(t, err)
+	assert.Equal(t, []*plumbing.Reference{plumbing.NewHashReference(plumbing.Master, master)}, refs)
+
+	require.NoError(t, conn.Fetch(context.TODO(), &transport.FetchRequest{
+		Wants: []plumbing.Hash{master},
+	}))
+	assert.NoError(t, st.HasEncodedObject(master))
+}
+
+func (s *UploadPackSuite) TestUploadPackThinPack() {
+	r, err := s.Client.NewSession(s.Storer, s.Endpoint, s.EmptyAuth)
+	s.Require().NoError(err)
+	conn, err := r.Handshake(context.TODO(), transport.UploadPackService)
+	s.Require().NoError(err)
+	defer func() { s.Require().NoError(conn.Close()) }()
+
+	count := func() int {
+		iter, err := s.Storer.IterEncodedObjects(plumbing.AnyObject)
+		s.Require().NoError(err)
+		var n int
+		s.Require().NoError(iter.ForEach(func(plumbing.EncodedObject) error {
+			n++
+			return nil
+		}))
+		return n
+	}
+
+	before := count()
+	err = conn.Fetch(context.Background(), &transport.FetchRequest{
+		Wants:    []plumbing.Hash{plumbing.NewHash("6ecf0ef2c2dffb796033e5a02219af86ec6584e5")},
+		Haves:    []plumbing.Hash{plumbing.NewHash("918c48b83bd081e863dbe1b80f8998f058cd8294")},
+		ThinPack: true,
+	})
+	s.Require().NoError(err)
+
+	// The base of the delta of the thin pack is appended to it.
+	s.Equal(5, count()-before)
+}
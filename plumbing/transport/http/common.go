@@ -9,11 +9,13 @@ import (
 	"crypto/x509"
 	"fmt"
 	"io"
+	"net"
 	"net/http"
 	"net/url"
 	"reflect"
 	"strings"
 	"sync"
+	"time"
 
 	"github.com/golang/groupcache/lru"
 
@@ -110,6 +112,10 @@ type client struct {
 	transports *lru.Cache
 	mutex      sync.RWMutex
 	useDumb    bool // When true, the client will always use the dumb protocol.
+	retry      *RetryOptions
+	headers    http.Header
+	timeouts   transport.TimeoutOptions
+	err        error // The error of the options, returned by NewSession.
 }
 
 // TransportOptions holds user configurable options for the client.
@@ -128,6 +134,23 @@ type TransportOptions struct {
 	// UseDumb is a flag that when set to true, the client will always use the
 	// dumb protocol.
 	UseDumb bool
+
+	// ProxyOptions is the proxy of the endpoints without any proxy of their
+	// own. It requires the transport of the Client to be an [http.Transport].
+	ProxyOptions *ProxyOptions
+
+	// RetryOptions enables the retries of the idempotent requests failing
+	// with a transient error. If nil, the requests aren't retried.
+	RetryOptions *RetryOptions
+
+	// Headers are added to every request, overriding the ones set by the
+	// transport, for instance to authenticate to a gateway.
+	Headers http.Header
+
+	// Timeouts are the timeouts of the endpoints which don't set their own.
+	// The Dial, TLSHandshake and ResponseHeader timeouts require the
+	// transport of the Client to be an [http.Transport].
+	Timeouts transport.TimeoutOptions
 }
 
 var (
@@ -164,8 +187,14 @@ func NewTransport(opts *TransportOptions) transport.Transport {
 	}
 
 	cl := &client{
-		client:  opts.Client,
-		useDumb: opts.UseDumb,
+		client:   opts.Client,
+		useDumb:  opts.UseDumb,
+		retry:    opts.RetryOptions,
+		headers:  opts.Headers,
+		timeouts: opts.Timeouts,
+	}
+	if opts.ProxyOptions != nil {
+		cl.client, cl.err = clientWithProxy(opts.Client, opts.ProxyOptions)
 	}
 	if opts.CacheMaxEntries > 0 {
 		cl.transports = lru.New(opts.CacheMaxEntries)
@@ -176,6 +205,10 @@ func NewTransport(opts *TransportOptions) transport.Transport {
 
 // NewSession creates a new session for the client.
 func (c *client) NewSession(st storage.Storer, ep *transport.Endpoint, auth transport.AuthMethod) (transport.Session, error) {
+	if c.err != nil {
+		return nil, c.err
+	}
+
 	return newSession(st, c, ep, auth, c.useDumb)
 }
 
@@ -184,6 +217,7 @@ func (c *client) SupportedProtocols() []protocol.Version {
 	return []protocol.Version{
 		protocol.V0,
 		protocol.V1,
+		protocol.V2,
 	}
 }
 
@@ -194,11 +228,15 @@ type HTTPSession struct {
 	client      *http.Client
 	ep          *transport.Endpoint
 	refs        *packp.AdvRefs
+	caps        *capability.List
 	svc         transport.Service // the service we're using for this session
 	gitProtocol string            // the Git-Protocol header to send
 	version     protocol.Version  // the server's protocol version
 	useDumb     bool              // When true, the client will always use the dumb protocol
 	isSmart     bool              // This is true if the session is using the smart protocol
+	retry       *RetryOptions     // The retries of the idempotent requests, if any
+	headers     http.Header       // The headers added to every request
+	idleTimeout time.Duration     // The time after which a stalled response is aborted
 }
 
 // IsSmart returns true if the session is using the smart protocol.
@@ -235,7 +273,54 @@ func transportWithProxy(transport *http.Transport, proxyURL *url.URL) {
 	transport.Proxy = http.ProxyURL(proxyURL)
 }
 
-func configureTransport(transport *http.Transport, ep *transport.Endpoint) error {
+// clientWithProxy returns a copy of the client using the proxy of the options.
+func clientWithProxy(c *http.Client, opts *ProxyOptions) (*http.Client, error) {
+	proxy, err := opts.proxy()
+	if err != nil || proxy == nil {
+		return c, err
+	}
+
+	rt := c.Transport
+	if rt == nil {
+		rt = http.DefaultTransport
+	}
+
+	tr, ok := rt.(*http.Transport)
+	if !ok {
+		return c, fmt.Errorf("expected underlying client transport to be of type: %s; got: %s",
+			reflect.TypeFor[*http.Transport](), reflect.TypeOf(rt))
+	}
+
+	tr = tr.Clone()
+	tr.Proxy = proxy
+
+	withProxy := *c
+	withProxy.Transport = tr
+	return &withProxy, nil
+}
+
+// transportWithTimeouts sets the timeouts of the connections of the
+// transport, the Idle one being enforced on the bodies of the responses.
+func transportWithTimeouts(transport *http.Transport, timeouts transport.TimeoutOptions) {
+	if timeouts.Dial > 0 {
+		transport.DialContext = (&net.Dialer{Timeout: timeouts.Dial, KeepAlive: 30 * time.Second}).DialContext
+	}
+	if timeouts.TLSHandshake > 0 {
+		transport.TLSHandshakeTimeout = timeouts.TLSHandshake
+	}
+	if timeouts.ResponseHeader > 0 {
+		transport.ResponseHeaderTimeout = timeouts.ResponseHeader
+	}
+}
+
+// connectionTimeouts returns the timeouts of the connections of an
+// http.Transport, all of them but the Idle one.
+func connectionTimeouts(timeouts transport.TimeoutOptions) transport.TimeoutOptions {
+	timeouts.Idle = 0
+	return timeouts
+}
+
+func configureTransport(transport *http.Transport, ep *transport.Endpoint, timeouts transport.TimeoutOptions) error {
 	if len(ep.CaBundle) > 0 {
 		if err := transportWithCABundle(transport, ep.CaBundle); err != nil {
 			return err
@@ -252,15 +337,19 @@ func configureTransport(transport *http.Transport, ep *transport.Endpoint) error
 		}
 		transportWithProxy(transport, proxyURL)
 	}
+
+	transportWithTimeouts(transport, timeouts)
 	return nil
 }
 
 func newSession(st storage.Storer, c *client, ep *transport.Endpoint, auth transport.AuthMethod, useDumb bool) (*HTTPSession, error) {
 	var httpClient *http.Client
+	timeouts := ep.Timeouts.WithDefaults(c.timeouts)
 
 	// We need to configure the http transport if there are transport specific
 	// options present in the endpoint.
-	if len(ep.CaBundle) > 0 || ep.InsecureSkipTLS || ep.Proxy.URL != "" {
+	if len(ep.CaBundle) > 0 || ep.InsecureSkipTLS || ep.Proxy.URL != "" ||
+		connectionTimeouts(timeouts) != (transport.TimeoutOptions{}) {
 		var transport *http.Transport
 		// if the client wasn't configured to have a cache for transports then just configure
 		// the transport and use it directly, otherwise try to use the cache.
@@ -272,11 +361,12 @@ func newSession(st storage.Storer, c *client, ep *transport.Endpoint, auth trans
 			}
 
 			transport = tr.Clone()
-			configureTransport(transport, ep)
+			configureTransport(transport, ep, timeouts)
 		} else {
 			transportOpts := transportOptions{
 				caBundle:        string(ep.CaBundle),
 				insecureSkipTLS: ep.InsecureSkipTLS,
+				timeouts:        connectionTimeouts(timeouts),
 			}
 			if ep.Proxy.URL != "" {
 				proxyURL, err := ep.Proxy.FullURL()
@@ -290,7 +380,7 @@ func newSession(st storage.Storer, c *client, ep *transport.Endpoint, auth trans
 
 			if !found {
 				transport = c.client.Transport.(*http.Transport).Clone()
-				configureTransport(transport, ep)
+				configureTransport(transport, ep, timeouts)
 				c.addTransport(transportOpts, transport)
 			}
 		}
@@ -306,11 +396,14 @@ func newSession(st storage.Storer, c *client, ep *transport.Endpoint, auth trans
 	}
 
 	s := &HTTPSession{
-		st:      st,
-		auth:    basicAuthFromEndpoint(ep),
-		client:  httpClient,
-		ep:      ep,
-		useDumb: useDumb,
+		st:          st,
+		auth:        basicAuthFromEndpoint(ep),
+		client:      httpClient,
+		ep:          ep,
+		useDumb:     useDumb,
+		retry:       c.retry,
+		headers:     c.headers,
+		idleTimeout: timeouts.Idle,
 	}
 	if auth != nil {
 		a, ok := auth.(AuthMethod)
@@ -345,7 +438,7 @@ func (s *HTTPSession) Handshake(ctx context.Context, service transport.Service,
 	}
 
 	applyHeaders(req, service.String(), s.ep, s.auth, s.gitProtocol, !s.useDumb)
-	res, err := doRequest(s.client, req)
+	res, err := s.doRequest(ctx, req)
 	if err != nil {
 		return nil, err
 	}
@@ -383,7 +476,17 @@ func (s *HTTPSession) Handshake(ctx context.Context, service transport.Service,
 		s.version, _ = transport.DiscoverVersion(rd)
 		switch s.version {
 		case protocol.V2:
-			return nil, transport.ErrUnsupportedVersion
+			if service != transport.UploadPackService {
+				return nil, transport.ErrUnsupportedVersion
+			}
+
+			adv := packp.NewCapabilityAdvertisement()
+			if err := adv.Decode(rd); err != nil {
+				return nil, err
+			}
+
+			s.caps = adv.Capabilities
+			return s, nil
 		case protocol.V1:
 			// Read the version line
 			fallthrough
@@ -428,6 +531,7 @@ func (s *HTTPSession) Handshake(ctx context.Context, service transport.Service,
 	}
 
 	s.refs = ar
+	s.caps = ar.Capabilities
 
 	return s, nil
 }
@@ -436,7 +540,7 @@ var _ transport.Connection = &HTTPSession{}
 
 // Capabilities implements transport.Connection.
 func (s *HTTPSession) Capabilities() *capability.List {
-	return s.refs.Capabilities
+	return s.caps
 }
 
 // StatelessRPC implements transport.Connection.
@@ -450,12 +554,17 @@ func (s *HTTPSession) Fetch(ctx context.Context, req *transport.FetchRequest) (e
 		return s.fetchDumb(ctx, req)
 	}
 
+	negotiate := transport.NegotiatePack
+	if s.version == protocol.V2 {
+		negotiate = transport.NegotiatePackV2
+	}
+
 	rwc := newRequester(ctx, s, transport.UploadPackService)
 
 	// XXX: packfile will be populated and accessible once rwc.Close() is
 	// called in NegotiatePack.
 	packfile := rwc.BodyCloser()
-	shallows, err := transport.NegotiatePack(ctx, s.st, s, packfile, rwc, req)
+	shallows, err := negotiate(ctx, s.st, s, packfile, rwc, req)
 	if err != nil {
 		if rwc.res != nil {
 			// Make sure the response body is closed.
@@ -469,6 +578,15 @@ func (s *HTTPSession) Fetch(ctx context.Context, req *transport.FetchRequest) (e
 
 // GetRemoteRefs implements transport.Connection.
 func (s *HTTPSession) GetRemoteRefs(ctx context.Context) ([]*plumbing.Reference, error) {
+	if s.refs == nil && s.version == protocol.V2 {
+		ar, err := s.lsRefs(ctx)
+		if err != nil {
+			return nil, err
+		}
+
+		s.refs = ar
+	}
+
 	if s.refs == nil {
 		return nil, transport.ErrEmptyRemoteRepository
 	}
@@ -487,6 +605,43 @@ func (s *HTTPSession) GetRemoteRefs(ctx context.Context) ([]*plumbing.Reference,
 	return s.refs.MakeReferenceSlice()
 }
 
+// ListRefs implements transport.RefLister.
+func (s *HTTPSession) ListRefs(ctx context.Context, prefixes ...string) ([]*plumbing.Reference, error) {
+	if s.version != protocol.V2 || len(prefixes) == 0 {
+		if s.version == protocol.V2 {
+			// The references are listed again, instead of returning the
+			// ones of a previous command.
+			s.refs = nil
+		}
+
+		refs, err := s.GetRemoteRefs(ctx)
+		if err != nil {
+			return nil, err
+		}
+
+		return transport.FilterRefs(refs, prefixes...), nil
+	}
+
+	ar, err := s.lsRefs(ctx, prefixes...)
+	if err != nil {
+		return nil, err
+	}
+
+	return ar.MakeReferenceSlice()
+}
+
+// lsRefs runs the ls-refs command in its own request.
+func (s *HTTPSession) lsRefs(ctx context.Context, prefixes ...string) (ar *packp.AdvRefs, err error) {
+	rwc := newRequester(ctx, s, transport.UploadPackService)
+	body := rwc.BodyCloser()
+	ar, err = transport.LsRefs(ctx, s, body, rwc, prefixes...)
+	if rwc.res != nil {
+		defer ioutil.CheckClose(body, &err)
+	}
+
+	return ar, err
+}
+
 // Push implements transport.Connection.
 func (s *HTTPSession) Push(ctx context.Context, req *transport.PushRequest) (err error) {
 	rwc := newRequester(ctx, s, transport.ReceivePackService)
@@ -550,7 +705,7 @@ func (r *requester) Close() (err error) {
 	}
 
 	applyHeaders(r.req, r.service, r.ep, r.auth, r.gitProtocol, r.IsSmart())
-	r.res, err = doRequest(r.client, r.req)
+	r.res, err = r.doRequest(r.ctx, r.req)
 	if err != nil {
 		return err
 	}
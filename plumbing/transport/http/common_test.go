@@ -1,6 +1,7 @@
 package http
 
 import (
+	"context"
 	"crypto/tls"
 	"errors"
 	"fmt"
@@ -13,16 +14,20 @@ import (
 	"path/filepath"
 	"strings"
 	"testing"
+	"time"
 
 	fixtures "github.com/go-git/go-git-fixtures/v5"
+	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 	"github.com/stretchr/testify/suite"
 
 	"github.com/go-git/go-git/v6/internal/transport/test"
+	"github.com/go-git/go-git/v6/plumbing"
 	"github.com/go-git/go-git/v6/plumbing/cache"
 	"github.com/go-git/go-git/v6/plumbing/transport"
 	"github.com/go-git/go-git/v6/storage"
 	"github.com/go-git/go-git/v6/storage/filesystem"
+	"github.com/go-git/go-git/v6/storage/memory"
 )
 
 func TestClientSuite(t *testing.T) {
@@ -241,6 +246,12 @@ func newEndpoint(t testing.TB, port int, name string) *transport.Endpoint {
 }
 
 func setupServer(t testing.TB, smart bool) (base string, port int) {
+	return setupServerWithMiddleware(t, smart, nil)
+}
+
+// setupServerWithMiddleware sets up a server like setupServer, whose handler
+// is wrapped by the given middleware, if not nil.
+func setupServerWithMiddleware(t testing.TB, smart bool, middleware func(http.Handler) http.Handler) (base string, port int) {
 	l := test.ListenTCP(t)
 
 	port = l.Addr().(*net.TCPAddr).Port
@@ -267,6 +278,10 @@ func setupServer(t testing.TB, smart bool) (base string, port int) {
 		}
 	}
 
+	if middleware != nil {
+		server.Handler = middleware(server.Handler)
+	}
+
 	done := make(chan struct{})
 
 	go func() {
@@ -281,3 +296,75 @@ func setupServer(t testing.TB, smart bool) (base string, port int) {
 
 	return base, port
 }
+
+// stallingWriter writes the first n bytes of a response, then stalls until
+// the request is canceled.
+type stallingWriter struct {
+	http.ResponseWriter
+	n     int
+	stall <-chan struct{}
+}
+
+func (w *stallingWriter) Write(p []byte) (int, error) {
+	if len(p) <= w.n {
+		w.n -= len(p)
+		return w.ResponseWriter.Write(p)
+	}
+
+	n, _ := w.ResponseWriter.Write(p[:w.n])
+	w.n = 0
+	w.ResponseWriter.(http.Flusher).Flush()
+	<-w.stall
+	return n, errors.New("stalled")
+}
+
+func TestIdleTimeout(t *testing.T) {
+	t.Parallel()
+
+	base, port := setupServerWithMiddleware(t, true, func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if strings.HasSuffix(r.URL.Path, "/git-upload-pack") {
+				w = &stallingWriter{ResponseWriter: w, n: 100, stall: r.Context().Done()}
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	})
+	test.PrepareRepository(t, fixtures.Basic().One(), base, "basic.git")
+
+	// The timeout of the transport is used, the endpoint having none.
+	ep := newEndpoint(t, port, "basic.git")
+	tr := NewTransport(&TransportOptions{Timeouts: transport.TimeoutOptions{Idle: 100 * time.Millisecond}})
+	session, err := tr.NewSession(memory.NewStorage(), ep, nil)
+	require.NoError(t, err)
+	conn, err := session.Handshake(context.TODO(), transport.UploadPackService)
+	require.NoError(t, err)
+	defer conn.Close()
+
+	start := time.Now()
+	err = conn.Fetch(context.TODO(), &transport.FetchRequest{
+		Wants: []plumbing.Hash{plumbing.NewHash("6ecf0ef2c2dffb796033e5a02219af86ec6584e5")},
+	})
+	require.ErrorIs(t, err, transport.ErrTimeoutExceeded)
+	assert.Less(t, time.Since(start), 10*time.Second)
+}
+
+func TestResponseHeaderTimeout(t *testing.T) {
+	t.Parallel()
+
+	_, port := setupServerWithMiddleware(t, true, func(http.Handler) http.Handler {
+		return http.HandlerFunc(func(_ http.ResponseWriter, r *http.Request) {
+			<-r.Context().Done()
+		})
+	})
+
+	ep := newEndpoint(t, port, "basic.git")
+	ep.Timeouts.ResponseHeader = 100 * time.Millisecond
+	session, err := DefaultTransport.NewSession(memory.NewStorage(), ep, nil)
+	require.NoError(t, err)
+
+	start := time.Now()
+	_, err = session.Handshake(context.TODO(), transport.UploadPackService)
+	require.ErrorContains(t, err, "timeout awaiting response headers")
+	assert.Less(t, time.Since(start), 10*time.Second)
+}
@@ -0,0 +1,169 @@
+package http
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sync"
+
+	"github.com/go-git/go-git/v6/plumbing/transport"
+	"github.com/go-git/go-git/v6/plumbing/transport/credential"
+	"github.com/go-git/go-git/v6/utils/trace"
+)
+
+// CredentialHelperAuth implements an http.AuthMethod which gets the username
+// and password from git credential helpers when the server requires an
+// authentication, as git does. The credential is stored by the helpers once
+// the server accepted it, and erased from them if it rejected it.
+type CredentialHelperAuth struct {
+	// Helpers are the credential helpers, asked in order.
+	Helpers credential.Helpers
+	// Credential is the credential to look for. If nil, it is the one of the
+	// URL of the remote.
+	Credential *credential.Credential
+
+	mu       sync.Mutex
+	filled   *credential.Credential
+	approved bool
+}
+
+// NewCredentialHelperAuth returns an auth getting the credential of the given
+// URL from the helpers configured for it by cfg.
+func NewCredentialHelperAuth(cfg *credential.Config, u *url.URL) *CredentialHelperAuth {
+	return &CredentialHelperAuth{
+		Helpers:    cfg.Helpers,
+		Credential: cfg.Credential(u),
+	}
+}
+
+// SetAuth sets the basic auth of the request, once the credential is known.
+func (a *CredentialHelperAuth) SetAuth(r *http.Request) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if a.filled != nil {
+		r.SetBasicAuth(a.filled.Username, a.filled.Password)
+	}
+}
+
+// Name is name of the auth
+func (a *CredentialHelperAuth) Name() string {
+	return "http-credential-helper"
+}
+
+func (a *CredentialHelperAuth) String() string {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if a.filled == nil {
+		return fmt.Sprintf("%s - <empty>", a.Name())
+	}
+
+	return fmt.Sprintf("%s - %s:*******", a.Name(), a.filled.Username)
+}
+
+// fill gets the credential of the endpoint from the helpers. It returns false
+// if it was already filled, or if the helpers don't know it.
+func (a *CredentialHelperAuth) fill(ctx context.Context, ep *transport.Endpoint) bool {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if a.filled != nil {
+		return false
+	}
+
+	query := a.Credential
+	if query == nil {
+		u, err := url.Parse(ep.String())
+		if err != nil {
+			return false
+		}
+
+		query = credential.FromURL(u)
+	}
+
+	filled, err := a.Helpers.Fill(ctx, query)
+	if err != nil {
+		trace.HTTP.Printf("credential helpers: %v", err)
+		return false
+	}
+
+	a.filled = filled
+	return true
+}
+
+// approve stores the credential in the helpers, once.
+func (a *CredentialHelperAuth) approve(ctx context.Context) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if a.filled == nil || a.approved {
+		return
+	}
+
+	a.approved = true
+	if err := a.Helpers.Approve(ctx, a.filled); err != nil {
+		trace.HTTP.Printf("credential helpers: %v", err)
+	}
+}
+
+// reject erases the credential from the helpers, and forgets it.
+func (a *CredentialHelperAuth) reject(ctx context.Context) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if a.filled == nil {
+		return
+	}
+
+	if err := a.Helpers.Reject(ctx, a.filled); err != nil {
+		trace.HTTP.Printf("credential helpers: %v", err)
+	}
+
+	a.filled = nil
+	a.approved = false
+}
+
+// doRequest performs the request like doRequest, with the headers of the
+// session and retrying it as configured. If the server requires an
+// authentication and the auth of the session is a CredentialHelperAuth which
+// wasn't filled yet, the request is performed again with the credential of
+// its helpers, which is then stored if accepted or erased if rejected.
+func (s *HTTPSession) doRequest(ctx context.Context, req *http.Request) (*http.Response, error) {
+	for key, values := range s.headers {
+		req.Header[http.CanonicalHeaderKey(key)] = values
+	}
+
+	res, err := s.send(ctx, req)
+	auth, ok := s.auth.(*CredentialHelperAuth)
+	if !ok {
+		return res, err
+	}
+
+	if errors.Is(err, transport.ErrAuthenticationRequired) && auth.fill(ctx, s.ep) {
+		retry := req.Clone(ctx)
+		if req.GetBody != nil {
+			if retry.Body, err = req.GetBody(); err != nil {
+				return nil, err
+			}
+		}
+
+		if res != nil && res.Body != nil {
+			_ = res.Body.Close()
+		}
+
+		auth.SetAuth(retry)
+		res, err = s.send(ctx, retry)
+		if errors.Is(err, transport.ErrAuthenticationRequired) {
+			auth.reject(ctx)
+		}
+	}
+
+	if err == nil {
+		auth.approve(ctx)
+	}
+
+	return res, err
+}
@@ -0,0 +1,122 @@
+package http
+
+import (
+	"context"
+	"net/http"
+	"testing"
+
+	fixtures "github.com/go-git/go-git-fixtures/v5"
+	"github.com/stretchr/testify/suite"
+
+	"github.com/go-git/go-git/v6/internal/transport/test"
+	"github.com/go-git/go-git/v6/plumbing/transport"
+	"github.com/go-git/go-git/v6/plumbing/transport/credential"
+	"github.com/go-git/go-git/v6/storage/memory"
+)
+
+type CredentialSuite struct {
+	suite.Suite
+	endpoint *transport.Endpoint
+}
+
+func TestCredentialSuite(t *testing.T) {
+	suite.Run(t, new(CredentialSuite))
+}
+
+func (s *CredentialSuite) SetupTest() {
+	base, port := setupServerWithMiddleware(s.T(), true, func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if username, password, ok := r.BasicAuth(); !ok || username != "user" || password != "secret" {
+				w.Header().Set("WWW-Authenticate", `Basic realm="git"`)
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	})
+
+	test.PrepareRepository(s.T(), fixtures.Basic().One(), base, "basic.git")
+	s.endpoint = newEndpoint(s.T(), port, "basic.git")
+}
+
+func (s *CredentialSuite) handshake(auth transport.AuthMethod) error {
+	session, err := DefaultTransport.NewSession(memory.NewStorage(), s.endpoint, auth)
+	s.Require().NoError(err)
+
+	conn, err := session.Handshake(context.Background(), transport.UploadPackService)
+	if err != nil {
+		return err
+	}
+
+	defer conn.Close()
+	refs, err := conn.GetRemoteRefs(context.Background())
+	s.NoError(err)
+	s.NotEmpty(refs)
+	return nil
+}
+
+func (s *CredentialSuite) TestCredentialHelper() {
+	cache := credential.NewCache(credential.DefaultCacheTimeout)
+	helper := &mockCredentialHelper{password: "secret"}
+	auth := &CredentialHelperAuth{Helpers: credential.Helpers{cache, helper}}
+	s.Equal("http-credential-helper - <empty>", auth.String())
+
+	s.NoError(s.handshake(auth))
+	s.Equal("http-credential-helper - user:*******", auth.String())
+	s.Equal([]credential.Credential{{Protocol: "http", Host: s.endpoint.Host, Path: "basic.git"}}, helper.gets)
+	s.Len(helper.stored, 1)
+	s.Equal("secret", helper.stored[0].Password)
+
+	// The credential stored is found in the cache first.
+	helper.gets = nil
+	s.NoError(s.handshake(&CredentialHelperAuth{Helpers: credential.Helpers{cache, helper}}))
+	s.Empty(helper.gets)
+}
+
+func (s *CredentialSuite) TestCredentialHelperRejected() {
+	helper := &mockCredentialHelper{password: "wrong"}
+	auth := &CredentialHelperAuth{
+		Helpers:    credential.Helpers{helper},
+		Credential: &credential.Credential{Protocol: "http", Host: s.endpoint.Host},
+	}
+
+	s.ErrorIs(s.handshake(auth), transport.ErrAuthenticationRequired)
+	s.Equal([]credential.Credential{{Protocol: "http", Host: s.endpoint.Host}}, helper.gets)
+	s.Empty(helper.stored)
+	s.Len(helper.erased, 1)
+	s.Equal("http-credential-helper - <empty>", auth.String())
+}
+
+func (s *CredentialSuite) TestCredentialHelperWithoutCredential() {
+	helper := &mockCredentialHelper{}
+	s.ErrorIs(s.handshake(&CredentialHelperAuth{Helpers: credential.Helpers{helper}}), transport.ErrAuthenticationRequired)
+	s.Len(helper.gets, 1)
+	s.Empty(helper.erased)
+}
+
+type mockCredentialHelper struct {
+	password string
+	gets     []credential.Credential
+	stored   []credential.Credential
+	erased   []credential.Credential
+}
+
+func (h *mockCredentialHelper) Get(_ context.Context, c *credential.Credential) (*credential.Credential, error) {
+	h.gets = append(h.gets, *c)
+	if h.password == "" {
+		return &credential.Credential{}, nil
+	}
+
+	return &credential.Credential{Username: "user", Password: h.password}, nil
+}
+
+func (h *mockCredentialHelper) Store(_ context.Context, c *credential.Credential) error {
+	h.stored = append(h.stored, *c)
+	return nil
+}
+
+func (h *mockCredentialHelper) Erase(_ context.Context, c *credential.Credential) error {
+	h.erased = append(h.erased, *c)
+	return nil
+}
@@ -6,9 +6,9 @@ import (
 	"errors"
 	"fmt"
 	"io"
-	"io/fs"
 	"net/http"
 	"net/url"
+	"os"
 	"path"
 	"path/filepath"
 	"strings"
@@ -38,6 +38,7 @@ func (s *HTTPSession) fetchDumb(ctx context.Context, req *transport.FetchRequest
 
 	repoFs := fsi.Filesystem()
 	r := newFetchWalker(s, ctx, repoFs)
+	r.resumable = req.Resumable
 	if err := r.process(); err != nil {
 		return err
 	}
@@ -56,6 +57,8 @@ type fetchWalker struct {
 	fs      billy.Filesystem
 	queue   []plumbing.Hash
 	packIdx map[plumbing.Hash]string
+	// resumable keeps the files partially downloaded, see resumeDownload.
+	resumable bool
 }
 
 func newFetchWalker(s *HTTPSession, ctx context.Context, fs billy.Filesystem) *fetchWalker {
@@ -79,7 +82,7 @@ func (r *fetchWalker) getInfoPacks() ([]string, error) {
 	}
 
 	applyHeaders(req, "", r.ep, r.auth, "", false)
-	res, err := doRequest(r.client, req)
+	res, err := r.doRequest(r.ctx, req)
 	if err != nil {
 		return nil, err
 	}
@@ -108,6 +111,10 @@ func (r *fetchWalker) getInfoPacks() ([]string, error) {
 
 // downloadFile downloads a file from the server and saves it to the filesystem.
 func (r *fetchWalker) downloadFile(fp string) (rErr error) {
+	if r.resumable {
+		return r.resumeDownload(fp)
+	}
+
 	url, err := url.JoinPath(r.ep.String(), fp)
 	if err != nil {
 		return err
@@ -118,7 +125,7 @@ func (r *fetchWalker) downloadFile(fp string) (rErr error) {
 	}
 
 	applyHeaders(req, "", r.ep, r.auth, "", false)
-	res, err := doRequest(r.client, req)
+	res, err := r.doRequest(r.ctx, req)
 	if err != nil {
 		return err
 	}
@@ -163,6 +170,97 @@ func (r *fetchWalker) downloadFile(fp string) (rErr error) {
 	return r.fs.Rename(f.Name(), fp)
 }
 
+// resumeDownload downloads a file from the server as downloadFile does, to a
+// temporary file which is kept if the download fails. As git http-fetch does,
+// the download of the temporary file left by a previous one is resumed with a
+// range request: the files downloaded are named after their checksum, so the
+// bytes already received are always those of the file.
+func (r *fetchWalker) resumeDownload(fp string) (rErr error) {
+	tmp := fp + ".temp"
+	f, err := r.fs.OpenFile(tmp, os.O_RDWR|os.O_CREATE, 0o644)
+	if err != nil {
+		return err
+	}
+
+	closed := false
+	defer func() {
+		if !closed {
+			ioutil.CheckClose(f, &rErr)
+		}
+	}()
+
+	offset, err := f.Seek(0, io.SeekEnd)
+	if err != nil {
+		return err
+	}
+
+	url, err := url.JoinPath(r.ep.String(), fp)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(r.ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return err
+	}
+
+	applyHeaders(req, "", r.ep, r.auth, "", false)
+	if offset > 0 {
+		req.Header.Set("Range", fmt.Sprintf("bytes=%d-", offset))
+	}
+
+	res, err := r.doRequest(r.ctx, req)
+	var herr *Err
+	if offset > 0 && errors.As(err, &herr) && herr.Status == http.StatusRequestedRangeNotSatisfiable {
+		// The temporary file is not a prefix of the file, which is
+		// downloaded again.
+		closed = true
+		if err := f.Close(); err != nil {
+			return err
+		}
+
+		if err := r.fs.Remove(tmp); err != nil {
+			return err
+		}
+
+		return r.resumeDownload(fp)
+	}
+
+	if err != nil {
+		return err
+	}
+
+	defer ioutil.CheckClose(res.Body, &rErr)
+	switch res.StatusCode {
+	case http.StatusPartialContent:
+		if !strings.HasPrefix(res.Header.Get("Content-Range"), fmt.Sprintf("bytes %d-", offset)) {
+			return fmt.Errorf("unexpected content range: %s", res.Header.Get("Content-Range"))
+		}
+	case http.StatusOK:
+		// The server does not support range requests, the whole file is
+		// downloaded.
+		if err := f.Truncate(0); err != nil {
+			return err
+		}
+
+		if _, err := f.Seek(0, io.SeekStart); err != nil {
+			return err
+		}
+	default:
+		return fmt.Errorf("unexpected status code: %d", res.StatusCode)
+	}
+
+	if _, err := ioutil.CopyBufferPool(f, res.Body); err != nil {
+		return err
+	}
+
+	closed = true
+	if err := f.Close(); err != nil {
+		return err
+	}
+
+	return r.fs.Rename(tmp, fp)
+}
+
 // getHead returns the HEAD reference from the server.
 func (r *fetchWalker) getHead() (ref *plumbing.Reference, err error) {
 	url, err := url.JoinPath(r.ep.String(), "HEAD")
@@ -175,7 +273,7 @@ func (r *fetchWalker) getHead() (ref *plumbing.Reference, err error) {
 	}
 
 	applyHeaders(req, "", r.ep, r.auth, "", false)
-	res, err := doRequest(r.client, req)
+	res, err := r.doRequest(r.ctx, req)
 	if err != nil {
 		return nil, err
 	}
@@ -260,7 +358,7 @@ func (r *fetchWalker) process() error {
 		// no way to do so using the storer interfaces except useing
 		// HasEncodedObject which might be an expensive operation.
 		packIdx := path.Join("objects", "pack", fmt.Sprintf("pack-%s.idx", hash))
-		if _, err := r.fs.Stat(packIdx); errors.Is(err, fs.ErrExist) {
+		if _, err := r.fs.Stat(packIdx); err == nil {
 			r.packIdx[h] = packIdx
 		} else {
 			if err := r.downloadFile(packIdx); err != nil {
@@ -304,7 +402,7 @@ func (r *fetchWalker) fetchObject(hash plumbing.Hash, obj plumbing.EncodedObject
 	}
 
 	applyHeaders(req, "", r.ep, r.auth, "", false)
-	res, err := doRequest(r.client, req)
+	res, err := r.doRequest(r.ctx, req)
 	if errors.Is(err, transport.ErrRepositoryNotFound) {
 		// TODO: better error handling
 		return io.EOF
@@ -395,7 +493,7 @@ LOOP:
 						continue LOOP
 					}
 
-					if _, err := r.fs.Stat(packPath); errors.Is(err, fs.ErrExist) {
+					if _, err := r.fs.Stat(packPath); err == nil {
 						packs[packPath] = struct{}{}
 						continue LOOP
 					}
@@ -462,7 +560,7 @@ LOOP:
 			return err
 		}
 
-		if err := packfile.UpdateObjectStorage(r.st, f); err != nil {
+		if err := packfile.UpdateObjectStorageWithOptions(r.st, f, packfile.WithContext(r.ctx)); err != nil {
 			_ = f.Close()
 			return err
 		}
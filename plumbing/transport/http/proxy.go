@@ -0,0 +1,122 @@
+package http
+
+import (
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+
+	"golang.org/x/net/http/httpproxy"
+
+	iurl "github.com/go-git/go-git/v6/internal/url"
+	format "github.com/go-git/go-git/v6/plumbing/format/config"
+	"github.com/go-git/go-git/v6/plumbing/transport"
+)
+
+const (
+	httpSection = "http"
+	proxyKey    = "proxy"
+)
+
+// ProxyOptions configures the proxy used by a transport for the endpoints
+// without any proxy of their own, such as the one of the ProxyOptions of the
+// fetch and push options.
+type ProxyOptions struct {
+	// URL is the URL of the proxy. It is an http proxy if it has no scheme.
+	// If empty, the requests use the proxy of the client of the transport,
+	// which by default is the one of the HTTP_PROXY, HTTPS_PROXY and NO_PROXY
+	// environment variables.
+	URL      string
+	Username string
+	Password string
+	// NoProxy is the comma-separated list of the hosts, domains and IP ranges
+	// accessed without the proxy, in the format of the NO_PROXY environment
+	// variable. If empty, the value of NO_PROXY is used. As with the proxy of
+	// the environment, localhost is always accessed without the proxy.
+	NoProxy string
+}
+
+// proxy returns the proxy function of an http.Transport using the proxy of
+// the options, or nil if the URL is empty.
+func (o *ProxyOptions) proxy() (func(*http.Request) (*url.URL, error), error) {
+	if o == nil || o.URL == "" {
+		return nil, nil
+	}
+
+	opts := transport.ProxyOptions{URL: o.URL, Username: o.Username, Password: o.Password}
+	if err := opts.Validate(); err != nil {
+		return nil, err
+	}
+
+	noProxy := o.NoProxy
+	if noProxy == "" {
+		noProxy = noProxyFromEnvironment()
+	}
+
+	return func(req *http.Request) (*url.URL, error) {
+		proxyURL, err := proxyForURL(opts.URL, noProxy, req.URL)
+		if err != nil || proxyURL == nil || opts.Username == "" {
+			return proxyURL, err
+		}
+
+		withUser := opts
+		withUser.URL = proxyURL.String()
+		return withUser.FullURL()
+	}, nil
+}
+
+// ProxyFromConfig returns the proxy configured for the given URL by the
+// http.proxy and the matching http.<url>.proxy options of the given configs,
+// from the lowest to the highest priority, as git does. It returns nil if
+// there is none, or if the host of the URL is localhost or is excluded by the
+// NO_PROXY environment variable.
+func ProxyFromConfig(u *url.URL, cfgs ...*format.Config) (*url.URL, error) {
+	var proxy string
+	for _, cfg := range cfgs {
+		if cfg == nil || !cfg.HasSection(httpSection) {
+			continue
+		}
+
+		s := cfg.Section(httpSection)
+		if s.Options.Has(proxyKey) {
+			proxy = s.Options.Get(proxyKey)
+		}
+
+		// The most specific subsection wins, whatever its order.
+		matched := -1
+		for _, ss := range s.Subsections {
+			if len(ss.Name) > matched && ss.Options.Has(proxyKey) && iurl.MatchesConfigURL(ss.Name, u) {
+				proxy = ss.Options.Get(proxyKey)
+				matched = len(ss.Name)
+			}
+		}
+	}
+
+	if proxy == "" {
+		return nil, nil
+	}
+
+	return proxyForURL(proxy, noProxyFromEnvironment(), u)
+}
+
+// proxyForURL returns the proxy to use for u, or nil if u is excluded by
+// noProxy.
+func proxyForURL(proxy, noProxy string, u *url.URL) (*url.URL, error) {
+	cfg := &httpproxy.Config{
+		HTTPProxy:  proxy,
+		HTTPSProxy: proxy,
+		NoProxy:    noProxy,
+	}
+
+	return cfg.ProxyFunc()(u)
+}
+
+func noProxyFromEnvironment() string {
+	for _, key := range []string{"NO_PROXY", "no_proxy"} {
+		if v := os.Getenv(key); v != "" {
+			return strings.TrimSpace(v)
+		}
+	}
+
+	return ""
+}
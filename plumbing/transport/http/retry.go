@@ -0,0 +1,172 @@
+package http
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/go-git/go-git/v6/plumbing/transport"
+	"github.com/go-git/go-git/v6/utils/ioutil"
+	"github.com/go-git/go-git/v6/utils/trace"
+)
+
+const (
+	// DefaultMaxRetries is the number of retries of a request, when the
+	// MaxRetries of the RetryOptions is zero.
+	DefaultMaxRetries = 3
+	// DefaultMinBackoff is the time waited before the first retry of a request,
+	// when the MinBackoff of the RetryOptions is zero.
+	DefaultMinBackoff = 500 * time.Millisecond
+	// DefaultMaxBackoff is the longest time waited before a retry, when the
+	// MaxBackoff of the RetryOptions is zero.
+	DefaultMaxBackoff = 10 * time.Second
+)
+
+// RetryOptions configures the retries of the idempotent requests: the
+// requests of the refs advertisement, of the dumb protocol and of the pack
+// negotiation, but not the ones pushing. They are retried when the server
+// fails with a 500, 502, 503 or 504 status code, or when the connection fails
+// with a transient network error. The requests are retried with a fresh body
+// only, they aren't if their body can't be read again from the start.
+type RetryOptions struct {
+	// MaxRetries is the maximum number of times a request is retried. If zero,
+	// DefaultMaxRetries is used.
+	MaxRetries int
+	// MinBackoff is the time waited before the first retry of a request,
+	// doubled before each of the following ones. If zero, DefaultMinBackoff is
+	// used.
+	MinBackoff time.Duration
+	// MaxBackoff is the longest time waited before a retry, including the
+	// ones asked by the Retry-After header of the responses. If zero,
+	// DefaultMaxBackoff is used.
+	MaxBackoff time.Duration
+}
+
+func (o *RetryOptions) maxRetries() int {
+	if o.MaxRetries == 0 {
+		return DefaultMaxRetries
+	}
+
+	return o.MaxRetries
+}
+
+// backoff returns the time to wait before the given retry, the first one
+// being 1.
+func (o *RetryOptions) backoff(retry int, res *http.Response) time.Duration {
+	maxBackoff := o.MaxBackoff
+	if maxBackoff == 0 {
+		maxBackoff = DefaultMaxBackoff
+	}
+
+	d := o.MinBackoff
+	if d == 0 {
+		d = DefaultMinBackoff
+	}
+
+	for i := 1; i < retry && d < maxBackoff; i++ {
+		d *= 2
+	}
+
+	if res != nil {
+		if seconds, err := strconv.Atoi(res.Header.Get("Retry-After")); err == nil && seconds >= 0 {
+			d = time.Duration(seconds) * time.Second
+		}
+	}
+
+	return min(d, maxBackoff)
+}
+
+// isRetryable returns whether the request may be sent again: it must be
+// idempotent, and its body must be read again from the start.
+func isRetryable(req *http.Request) bool {
+	if req.Body != nil && req.Body != http.NoBody && req.GetBody == nil {
+		return false
+	}
+
+	switch req.Method {
+	case http.MethodGet, http.MethodHead:
+		return true
+	case http.MethodPost:
+		return strings.HasSuffix(req.URL.Path, "/"+transport.UploadPackService.String())
+	}
+
+	return false
+}
+
+// isTransient returns whether the request failed because of an error which
+// is likely temporary.
+func isTransient(res *http.Response, err error) bool {
+	if res != nil {
+		switch res.StatusCode {
+		case http.StatusInternalServerError, http.StatusBadGateway,
+			http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+			return true
+		}
+
+		return false
+	}
+
+	if err == nil || errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return false
+	}
+
+	var netErr net.Error
+	if errors.As(err, &netErr) && netErr.Timeout() {
+		return true
+	}
+
+	return errors.Is(err, syscall.ECONNRESET) || errors.Is(err, syscall.ECONNREFUSED) ||
+		errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF)
+}
+
+// send performs the request with do, retrying it as configured by the
+// RetryOptions of the session, if any.
+func (s *HTTPSession) send(ctx context.Context, req *http.Request) (*http.Response, error) {
+	res, err := s.do(req)
+	if s.retry == nil || !isRetryable(req) {
+		return res, err
+	}
+
+	for retry := 1; retry <= s.retry.maxRetries() && isTransient(res, err); retry++ {
+		wait := s.retry.backoff(retry, res)
+		trace.HTTP.Printf("retrying %s %s in %s: %v", req.Method, req.URL, wait, err)
+		if res != nil && res.Body != nil {
+			_ = res.Body.Close()
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(wait):
+		}
+
+		next := req.Clone(ctx)
+		if req.GetBody != nil {
+			if next.Body, err = req.GetBody(); err != nil {
+				return nil, err
+			}
+		}
+
+		res, err = s.do(next)
+	}
+
+	return res, err
+}
+
+// do performs the request with doRequest, the body of the response being
+// aborted once stalled for the idle timeout of the session, if any.
+func (s *HTTPSession) do(req *http.Request) (*http.Response, error) {
+	res, err := doRequest(s.client, req)
+	if res != nil && res.Body != nil && s.idleTimeout > 0 {
+		body := res.Body
+		res.Body = ioutil.NewReadCloser(transport.NewIdleTimeoutReader(body, body, s.idleTimeout), body)
+	}
+
+	return res, err
+}
@@ -0,0 +1,174 @@
+package http
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	fixtures "github.com/go-git/go-git-fixtures/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/go-git/go-git/v6/internal/transport/test"
+	"github.com/go-git/go-git/v6/plumbing"
+	"github.com/go-git/go-git/v6/plumbing/transport"
+	"github.com/go-git/go-git/v6/storage/memory"
+)
+
+// flakyServer is a middleware failing the first requests of each path with a
+// 503, and recording the bodies of all the requests.
+type flakyServer struct {
+	failures int
+
+	mu       sync.Mutex
+	requests map[string]int
+	bodies   map[string][][]byte
+	headers  []http.Header
+}
+
+func (f *flakyServer) middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		f.mu.Lock()
+		f.requests[r.URL.Path]++
+		n := f.requests[r.URL.Path]
+		f.bodies[r.URL.Path] = append(f.bodies[r.URL.Path], body)
+		f.headers = append(f.headers, r.Header.Clone())
+		f.mu.Unlock()
+
+		if n <= f.failures {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+
+		r.Body = io.NopCloser(bytes.NewReader(body))
+		next.ServeHTTP(w, r)
+	})
+}
+
+func setupFlakyServer(t *testing.T, failures int) (*flakyServer, *transport.Endpoint) {
+	f := &flakyServer{
+		failures: failures,
+		requests: make(map[string]int),
+		bodies:   make(map[string][][]byte),
+	}
+
+	base, port := setupServerWithMiddleware(t, true, f.middleware)
+	test.PrepareRepository(t, fixtures.Basic().One(), base, "basic.git")
+	return f, newEndpoint(t, port, "basic.git")
+}
+
+var testRetryOptions = &RetryOptions{
+	MinBackoff: time.Millisecond,
+	MaxBackoff: 10 * time.Millisecond,
+}
+
+func TestRetryHandshakeAndFetch(t *testing.T) {
+	f, ep := setupFlakyServer(t, 2)
+	tr := NewTransport(&TransportOptions{RetryOptions: testRetryOptions})
+
+	st := memory.NewStorage()
+	session, err := tr.NewSession(st, ep, nil)
+	require.NoError(t, err)
+	conn, err := session.Handshake(context.TODO(), transport.UploadPackService)
+	require.NoError(t, err)
+	defer conn.Close()
+
+	head := plumbing.NewHash("6ecf0ef2c2dffb796033e5a02219af86ec6584e5")
+	require.NoError(t, conn.Fetch(context.TODO(), &transport.FetchRequest{
+		Wants: []plumbing.Hash{head},
+	}))
+	assert.NoError(t, st.HasEncodedObject(head))
+
+	assert.Equal(t, 3, f.requests["/basic.git/info/refs"])
+
+	// The failed requests had the same body as the successful one.
+	bodies := f.bodies["/basic.git/git-upload-pack"]
+	require.Len(t, bodies, 3)
+	assert.NotEmpty(t, bodies[0])
+	assert.Equal(t, bodies[0], bodies[1])
+	assert.Equal(t, bodies[0], bodies[2])
+}
+
+func TestRetryGivesUp(t *testing.T) {
+	f, ep := setupFlakyServer(t, 10)
+	tr := NewTransport(&TransportOptions{
+		RetryOptions: &RetryOptions{MaxRetries: 2, MinBackoff: time.Millisecond},
+	})
+
+	session, err := tr.NewSession(memory.NewStorage(), ep, nil)
+	require.NoError(t, err)
+	_, err = session.Handshake(context.TODO(), transport.UploadPackService)
+	var herr *Err
+	require.ErrorAs(t, err, &herr)
+	assert.Equal(t, http.StatusServiceUnavailable, herr.Status)
+	assert.Equal(t, 3, f.requests["/basic.git/info/refs"])
+}
+
+func TestRetryDisabled(t *testing.T) {
+	f, ep := setupFlakyServer(t, 1)
+
+	session, err := DefaultTransport.NewSession(memory.NewStorage(), ep, nil)
+	require.NoError(t, err)
+	_, err = session.Handshake(context.TODO(), transport.UploadPackService)
+	require.Error(t, err)
+	assert.Equal(t, 1, f.requests["/basic.git/info/refs"])
+}
+
+func TestIsRetryable(t *testing.T) {
+	for _, tc := range []struct {
+		method, path string
+		body         io.Reader
+		retryable    bool
+	}{
+		{http.MethodGet, "/repo/info/refs", nil, true},
+		{http.MethodPost, "/repo/git-upload-pack", strings.NewReader("0000"), true},
+		{http.MethodPost, "/repo/git-upload-pack", io.LimitReader(strings.NewReader("0000"), 4), false},
+		{http.MethodPost, "/repo/git-receive-pack", strings.NewReader("0000"), false},
+	} {
+		req, err := http.NewRequest(tc.method, "http://example.com"+tc.path, tc.body)
+		require.NoError(t, err)
+		assert.Equal(t, tc.retryable, isRetryable(req), "%s %s", tc.method, tc.path)
+	}
+}
+
+func TestRetryBackoff(t *testing.T) {
+	o := &RetryOptions{MinBackoff: time.Second, MaxBackoff: 5 * time.Second}
+	assert.Equal(t, time.Second, o.backoff(1, nil))
+	assert.Equal(t, 2*time.Second, o.backoff(2, nil))
+	assert.Equal(t, 4*time.Second, o.backoff(3, nil))
+	assert.Equal(t, 5*time.Second, o.backoff(4, nil))
+
+	res := &http.Response{Header: http.Header{"Retry-After": []string{"3"}}}
+	assert.Equal(t, 3*time.Second, o.backoff(1, res))
+	res.Header.Set("Retry-After", "60")
+	assert.Equal(t, 5*time.Second, o.backoff(1, res))
+}
+
+func TestTransportHeaders(t *testing.T) {
+	f, ep := setupFlakyServer(t, 0)
+	tr := NewTransport(&TransportOptions{
+		Headers: http.Header{"x-gateway-token": []string{"secret"}},
+	})
+
+	session, err := tr.NewSession(memory.NewStorage(), ep, nil)
+	require.NoError(t, err)
+	conn, err := session.Handshake(context.TODO(), transport.UploadPackService)
+	require.NoError(t, err)
+	defer conn.Close()
+
+	require.NotEmpty(t, f.headers)
+	for _, h := range f.headers {
+		assert.Equal(t, "secret", h.Get("X-Gateway-Token"))
+	}
+}
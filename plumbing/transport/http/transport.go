@@ -3,6 +3,8 @@ package http
 import (
 	"net/http"
 	"net/url"
+
+	"github.com/go-git/go-git/v6/plumbing/transport"
 )
 
 // transportOptions contains transport specific configuration.
@@ -11,6 +13,7 @@ type transportOptions struct {
 	// []byte is not comparable.
 	caBundle string
 	proxyURL url.URL
+	timeouts transport.TimeoutOptions
 }
 
 func (c *client) addTransport(opts transportOptions, transport *http.Transport) {
@@ -2,13 +2,24 @@ package http
 
 import (
 	"context"
+	"fmt"
+	"net/http"
 	"net/url"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
 	"testing"
 
 	fixtures "github.com/go-git/go-git-fixtures/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 	"github.com/stretchr/testify/suite"
 
 	"github.com/go-git/go-git/v6/internal/transport/test"
+	"github.com/go-git/go-git/v6/plumbing"
+	"github.com/go-git/go-git/v6/plumbing/protocol"
+	"github.com/go-git/go-git/v6/plumbing/protocol/packp/capability"
 	"github.com/go-git/go-git/v6/plumbing/transport"
 	"github.com/go-git/go-git/v6/storage/filesystem"
 	"github.com/go-git/go-git/v6/storage/memory"
@@ -114,3 +125,99 @@ func (s *UploadPackSuite) TestAdvertisedReferencesContextCanceled() {
 	s.Nil(conn)
 	s.Equal(&url.Error{Op: "Get", URL: "http://github.com/git-fixtures/basic/info/refs?service=git-upload-pack", Err: context.Canceled}, err)
 }
+
+func setupV2Server(t *testing.T) (*transport.Endpoint, string) {
+	base, port := setupServer(t, true)
+	test.PrepareRepository(t, fixtures.Basic().One(), base, "basic.git")
+	return newEndpoint(t, port, "basic.git"), filepath.Join(base, "basic.git")
+}
+
+func TestUploadPackV2ListRefs(t *testing.T) {
+	ep, _ := setupV2Server(t)
+
+	session, err := DefaultTransport.NewSession(memory.NewStorage(), ep, nil)
+	require.NoError(t, err)
+	conn, err := session.Handshake(context.TODO(), transport.UploadPackService, transport.VersionParam(protocol.V2))
+	require.NoError(t, err)
+	defer func() { require.NoError(t, conn.Close()) }()
+
+	assert.Equal(t, protocol.V2, conn.Version())
+	assert.True(t, conn.Capabilities().Supports(capability.LsRefs))
+
+	refs, err := transport.ListRefs(context.TODO(), conn, "refs/heads/master")
+	require.NoError(t, err)
+	assert.Equal(t, []*plumbing.Reference{
+		plumbing.NewReferenceFromStrings("refs/heads/master", "6ecf0ef2c2dffb796033e5a02219af86ec6584e5"),
+	}, refs)
+
+	refs, err = conn.GetRemoteRefs(context.TODO())
+	require.NoError(t, err)
+	assert.Contains(t, refs, plumbing.NewSymbolicReference(plumbing.HEAD, plumbing.Master))
+	assert.Contains(t, refs, plumbing.NewReferenceFromStrings("refs/heads/branch", "e8d3ffab552895c19b9fcf7aa264d277cde33881"))
+}
+
+func TestUploadPackV2FetchWantRefs(t *testing.T) {
+	for _, refInWant := range []bool{false, true} {
+		t.Run(fmt.Sprintf("ref-in-want=%t", refInWant), func(t *testing.T) {
+			ep, path := setupV2Server(t)
+			if refInWant {
+				cmd := exec.Command("git", "-C", path, "config", "uploadpack.allowRefInWant", "true")
+				require.NoError(t, cmd.Run())
+			}
+
+			st := memory.NewStorage()
+			session, err := DefaultTransport.NewSession(st, ep, nil)
+			require.NoError(t, err)
+			conn, err := session.Handshake(context.TODO(), transport.UploadPackService, transport.VersionParam(protocol.V2))
+			require.NoError(t, err)
+			defer func() { require.NoError(t, conn.Close()) }()
+
+			req := &transport.FetchRequest{
+				WantRefs: []plumbing.ReferenceName{"refs/heads/branch"},
+			}
+			require.NoError(t, conn.Fetch(context.TODO(), req))
+
+			branch := plumbing.NewHash("e8d3ffab552895c19b9fcf7aa264d277cde33881")
+			assert.Equal(t, []*plumbing.Reference{
+				plumbing.NewHashReference("refs/heads/branch", branch),
+			}, req.WantedRefs)
+			assert.NoError(t, st.HasEncodedObject(branch))
+		})
+	}
+}
+
+func TestUploadPackV2PersistentSession(t *testing.T) {
+	var handshakes atomic.Int32
+	base, port := setupServerWithMiddleware(t, true, func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if strings.HasSuffix(r.URL.Path, infoRefsPath) {
+				handshakes.Add(1)
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	})
+	test.PrepareRepository(t, fixtures.Basic().One(), base, "basic.git")
+
+	st := memory.NewStorage()
+	session, err := DefaultTransport.NewSession(st, newEndpoint(t, port, "basic.git"), nil)
+	require.NoError(t, err)
+	s := transport.NewPersistentSession(session, transport.VersionParam(protocol.V2))
+	defer func() { require.NoError(t, s.Close()) }()
+
+	master := plumbing.NewHash("6ecf0ef2c2dffb796033e5a02219af86ec6584e5")
+	for i := range 3 {
+		name := fmt.Sprintf("refs/heads/poll-%d", i)
+		cmd := exec.Command("git", "-C", filepath.Join(base, "basic.git"), "update-ref", name, master.String())
+		require.NoError(t, cmd.Run())
+
+		refs, err := s.ListRefs(context.TODO(), "refs/heads/poll-")
+		require.NoError(t, err)
+		assert.Len(t, refs, i+1)
+
+		require.NoError(t, s.Fetch(context.TODO(), []plumbing.Hash{master}, nil))
+	}
+
+	assert.NoError(t, st.HasEncodedObject(master))
+	assert.EqualValues(t, 1, handshakes.Load())
+}
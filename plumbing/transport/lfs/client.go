@@ -0,0 +1,251 @@
+// Package lfs implements a client of the Git LFS batch API, downloading the
+// content of the files stored by Git LFS with the basic transfer adapter.
+//
+// See https://github.com/git-lfs/git-lfs/blob/main/docs/api/batch.md
+package lfs
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/go-git/go-git/v6/plumbing/format/lfs"
+	"github.com/go-git/go-git/v6/plumbing/protocol/packp/capability"
+	"github.com/go-git/go-git/v6/plumbing/transport"
+	githttp "github.com/go-git/go-git/v6/plumbing/transport/http"
+)
+
+const (
+	mediaType     = "application/vnd.git-lfs+json"
+	basicTransfer = "basic"
+)
+
+var (
+	// ErrObjectNotFound is returned when the server does not have the
+	// requested object.
+	ErrObjectNotFound = errors.New("lfs object not found")
+	// ErrUnsupportedEndpoint is returned when the LFS API endpoint cannot be
+	// derived from a remote URL, such as a local path.
+	ErrUnsupportedEndpoint = errors.New("unsupported lfs endpoint")
+)
+
+// Endpoint returns the URL of the LFS API of the repository at the given
+// remote URL, "<url>.git/info/lfs", the ssh and git URLs being converted to
+// https URLs.
+func Endpoint(remoteURL string) (string, error) {
+	ep, err := transport.NewEndpoint(remoteURL)
+	if err != nil {
+		return "", err
+	}
+
+	u := url.URL{Scheme: ep.Scheme, Host: ep.Host, User: ep.User}
+	switch ep.Scheme {
+	case "http", "https":
+	case "ssh", "git":
+		u = url.URL{Scheme: "https", Host: ep.Hostname()}
+	default:
+		return "", fmt.Errorf("%w: %s", ErrUnsupportedEndpoint, remoteURL)
+	}
+
+	p := strings.TrimSuffix(ep.Path, "/")
+	if !strings.HasPrefix(p, "/") {
+		p = "/" + p
+	}
+
+	if !strings.HasSuffix(p, ".git") {
+		p += ".git"
+	}
+
+	u.Path = p + "/info/lfs"
+	return u.String(), nil
+}
+
+// Client is a client of the batch API of a Git LFS server.
+type Client struct {
+	endpoint string
+	client   *http.Client
+	auth     githttp.AuthMethod
+}
+
+// NewClient returns a client of the LFS API at the given endpoint, using the
+// given HTTP client, or http.DefaultClient if nil. The requests to the API are
+// authenticated with auth, or the credentials of the endpoint URL if nil.
+func NewClient(endpoint string, c *http.Client, auth githttp.AuthMethod) (*Client, error) {
+	u, err := url.Parse(endpoint)
+	if err != nil {
+		return nil, err
+	}
+
+	if auth == nil && u.User != nil {
+		password, _ := u.User.Password()
+		auth = &githttp.BasicAuth{Username: u.User.Username(), Password: password}
+	}
+
+	u.User = nil
+	if c == nil {
+		c = http.DefaultClient
+	}
+
+	return &Client{endpoint: strings.TrimSuffix(u.String(), "/"), client: c, auth: auth}, nil
+}
+
+type batchRequest struct {
+	Operation string        `json:"operation"`
+	Transfers []string      `json:"transfers"`
+	Objects   []batchObject `json:"objects"`
+}
+
+type batchObject struct {
+	Oid  string `json:"oid"`
+	Size int64  `json:"size"`
+}
+
+type batchResponse struct {
+	Transfer string                `json:"transfer"`
+	Objects  []batchObjectResponse `json:"objects"`
+	Message  string                `json:"message"`
+}
+
+type batchObjectResponse struct {
+	batchObject
+	Actions map[string]*batchAction `json:"actions"`
+	Error   *batchError             `json:"error"`
+}
+
+type batchAction struct {
+	Href   string            `json:"href"`
+	Header map[string]string `json:"header"`
+}
+
+type batchError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+// Download returns the content of the object of the given pointer. The
+// content is read as sent by the server, and must be verified against the
+// pointer by the caller.
+func (c *Client) Download(ctx context.Context, p *lfs.Pointer) (io.ReadCloser, error) {
+	action, err := c.batch(ctx, "download", p)
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, action.Href, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	for k, v := range action.Header {
+		req.Header.Set(k, v)
+	}
+
+	res, err := c.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := checkError(res); err != nil {
+		return nil, err
+	}
+
+	return res.Body, nil
+}
+
+// batch requests the given operation on the object of the given pointer,
+// and returns the action to perform.
+func (c *Client) batch(ctx context.Context, operation string, p *lfs.Pointer) (*batchAction, error) {
+	body, err := json.Marshal(&batchRequest{
+		Operation: operation,
+		Transfers: []string{basicTransfer},
+		Objects:   []batchObject{{Oid: p.Oid, Size: p.Size}},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.endpoint+"/objects/batch", bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+
+	req.Header.Set("Accept", mediaType)
+	req.Header.Set("Content-Type", mediaType)
+	req.Header.Set("User-Agent", capability.DefaultAgent())
+	if c.auth != nil {
+		c.auth.SetAuth(req)
+	}
+
+	res, err := c.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+
+	defer res.Body.Close()
+	if err := checkError(res); err != nil {
+		return nil, err
+	}
+
+	var br batchResponse
+	if err := json.NewDecoder(res.Body).Decode(&br); err != nil {
+		return nil, fmt.Errorf("%w: %w", transport.ErrInvalidResponse, err)
+	}
+
+	if br.Transfer != "" && br.Transfer != basicTransfer {
+		return nil, fmt.Errorf("%w: unsupported transfer %q", transport.ErrInvalidResponse, br.Transfer)
+	}
+
+	for _, o := range br.Objects {
+		if o.Oid != p.Oid {
+			continue
+		}
+
+		if o.Error != nil {
+			if o.Error.Code == http.StatusNotFound || o.Error.Code == http.StatusGone {
+				return nil, fmt.Errorf("%w: %s: %s", ErrObjectNotFound, p.Oid, o.Error.Message)
+			}
+
+			return nil, fmt.Errorf("lfs object %s: %d: %s", p.Oid, o.Error.Code, o.Error.Message)
+		}
+
+		if action := o.Actions[operation]; action != nil {
+			return action, nil
+		}
+	}
+
+	return nil, fmt.Errorf("%w: no %s action for %s", transport.ErrInvalidResponse, operation, p.Oid)
+}
+
+// checkError returns an error if the response is not successful, with the
+// message sent by the server, if any.
+func checkError(res *http.Response) error {
+	if res.StatusCode >= http.StatusOK && res.StatusCode < http.StatusMultipleChoices {
+		return nil
+	}
+
+	defer res.Body.Close()
+	var br batchResponse
+	_ = json.NewDecoder(io.LimitReader(res.Body, 64*1024)).Decode(&br)
+
+	err := fmt.Errorf("unexpected requesting %q status code: %d", res.Request.URL, res.StatusCode)
+	if br.Message != "" {
+		err = fmt.Errorf("%w: %s", err, br.Message)
+	}
+
+	switch res.StatusCode {
+	case http.StatusUnauthorized:
+		return fmt.Errorf("%w: %w", transport.ErrAuthenticationRequired, err)
+	case http.StatusForbidden:
+		return fmt.Errorf("%w: %w", transport.ErrAuthorizationFailed, err)
+	case http.StatusNotFound:
+		return fmt.Errorf("%w: %w", transport.ErrRepositoryNotFound, err)
+	}
+
+	return err
+}
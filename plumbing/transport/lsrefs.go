@@ -0,0 +1,115 @@
+package transport
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/go-git/go-git/v6/plumbing"
+	"github.com/go-git/go-git/v6/plumbing/protocol/packp"
+	"github.com/go-git/go-git/v6/plumbing/protocol/packp/capability"
+	"github.com/go-git/go-git/v6/utils/ioutil"
+)
+
+// RefLister is implemented by the connections that are able to list only the
+// remote references matching a set of prefixes. Using protocol v2, the
+// prefixes are sent to the server along with the ls-refs command, so that
+// the rest of the references are never transferred.
+type RefLister interface {
+	// ListRefs returns the remote references whose names start with one of
+	// the given prefixes, or all of them if no prefix is given.
+	ListRefs(ctx context.Context, prefixes ...string) ([]*plumbing.Reference, error)
+}
+
+// ListRefs returns the references of the remote whose names start with one
+// of the given prefixes, or all of them if no prefix is given. The
+// references are filtered by the server when the connection implements
+// RefLister, and by the client otherwise.
+func ListRefs(ctx context.Context, conn Connection, prefixes ...string) ([]*plumbing.Reference, error) {
+	if l, ok := conn.(RefLister); ok {
+		return l.ListRefs(ctx, prefixes...)
+	}
+
+	refs, err := conn.GetRemoteRefs(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return FilterRefs(refs, prefixes...), nil
+}
+
+// FilterRefs returns the references whose names start with one of the given
+// prefixes. All the references are returned if no prefix is given.
+func FilterRefs(refs []*plumbing.Reference, prefixes ...string) []*plumbing.Reference {
+	if len(prefixes) == 0 {
+		return refs
+	}
+
+	filtered := make([]*plumbing.Reference, 0, len(refs))
+	for _, ref := range refs {
+		for _, prefix := range prefixes {
+			if strings.HasPrefix(ref.Name().String(), prefix) {
+				filtered = append(filtered, ref)
+				break
+			}
+		}
+	}
+
+	return filtered
+}
+
+// LsRefs runs the protocol v2 ls-refs command on the remote and returns the
+// listed references. The writer is closed once the command is sent when the
+// connection is stateless.
+// See https://git-scm.com/docs/protocol-v2#_ls_refs
+func LsRefs(
+	ctx context.Context,
+	conn Connection,
+	reader io.Reader,
+	writer io.WriteCloser,
+	prefixes ...string,
+) (*packp.AdvRefs, error) {
+	reader = ioutil.NewContextReader(ctx, reader)
+	writer = ioutil.NewContextWriteCloser(ctx, writer)
+
+	caps := conn.Capabilities()
+	if !caps.Supports(capability.LsRefs) {
+		return nil, fmt.Errorf("%w: ls-refs", ErrUnsupportedCommand)
+	}
+
+	req := packp.NewLsRefsRequest()
+	req.Capabilities = commandCapabilities(caps)
+	req.RefPrefixes = prefixes
+	if err := req.Encode(writer); err != nil {
+		return nil, fmt.Errorf("sending ls-refs: %w", err)
+	}
+
+	if conn.StatelessRPC() {
+		if err := writer.Close(); err != nil {
+			return nil, fmt.Errorf("closing writer: %w", err)
+		}
+	}
+
+	res := packp.NewLsRefsResponse()
+	if err := res.Decode(reader); err != nil {
+		return nil, err
+	}
+
+	return res.AdvRefs()
+}
+
+// commandCapabilities returns the capabilities sent along with a protocol
+// v2 command, given the ones advertised by the server.
+func commandCapabilities(caps *capability.List) *capability.List {
+	l := capability.NewList()
+	if caps.Supports(capability.Agent) {
+		l.Set(capability.Agent, capability.DefaultAgent()) // nolint: errcheck
+	}
+
+	if formats := caps.Get(capability.ObjectFormat); len(formats) > 0 {
+		l.Set(capability.ObjectFormat, formats[0]) // nolint: errcheck
+	}
+
+	return l
+}
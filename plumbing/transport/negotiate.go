@@ -8,10 +8,13 @@ import (
 	"slices"
 
 	"github.com/go-git/go-git/v6/plumbing"
+	"github.com/go-git/go-git/v6/plumbing/format/packfile"
 	"github.com/go-git/go-git/v6/plumbing/format/pktline"
 	"github.com/go-git/go-git/v6/plumbing/protocol/packp"
 	"github.com/go-git/go-git/v6/plumbing/protocol/packp/capability"
+	"github.com/go-git/go-git/v6/plumbing/storer"
 	"github.com/go-git/go-git/v6/storage"
+	"github.com/go-git/go-git/v6/storage/memory"
 	"github.com/go-git/go-git/v6/utils/ioutil"
 )
 
@@ -34,6 +37,18 @@ func NegotiatePack(
 	writer = ioutil.NewContextWriteCloser(ctx, writer)
 	caps := conn.Capabilities()
 
+	// References wanted by name are resolved using the advertised ones.
+	if len(req.WantRefs) > 0 {
+		refs, err := conn.GetRemoteRefs(ctx)
+		if err != nil {
+			return nil, err
+		}
+
+		if err := resolveWantRefs(req, refs); err != nil {
+			return nil, err
+		}
+	}
+
 	// Create upload-request
 	upreq := packp.NewUploadRequest()
 	multiAck := caps.Supports(capability.MultiACK)
@@ -54,10 +69,9 @@ func NegotiatePack(
 		upreq.Capabilities.Set(capability.NoProgress) // nolint: errcheck
 	}
 
-	// TODO: support thin-pack
-	// if caps.Supports(capability.ThinPack) {
-	// 	upreq.Capabilities.Set(capability.ThinPack) // nolint: errcheck
-	// }
+	if req.ThinPack && caps.Supports(capability.ThinPack) && packfile.AcceptsThinPacks(st) {
+		upreq.Capabilities.Set(capability.ThinPack) // nolint: errcheck
+	}
 
 	if caps.Supports(capability.OFSDelta) {
 		upreq.Capabilities.Set(capability.OFSDelta) // nolint: errcheck
@@ -67,6 +81,10 @@ func NegotiatePack(
 		upreq.Capabilities.Set(capability.Agent, capability.DefaultAgent()) // nolint: errcheck
 	}
 
+	if formats := caps.Get(capability.ObjectFormat); len(formats) > 0 {
+		upreq.Capabilities.Set(capability.ObjectFormat, formats[0]) // nolint: errcheck
+	}
+
 	if req.IncludeTags && caps.Supports(capability.IncludeTag) {
 		upreq.Capabilities.Set(capability.IncludeTag) // nolint: errcheck
 	}
@@ -84,12 +102,37 @@ func NegotiatePack(
 
 	upreq.Wants = req.Wants
 
-	if req.Depth > 0 {
+	if req.IsShallow() {
 		if !caps.Supports(capability.Shallow) {
 			return nil, ErrShallowNotSupported
 		}
 
-		upreq.Depth = packp.DepthCommits(req.Depth)
+		switch {
+		case req.Depth > 0:
+			upreq.Depth = packp.DepthCommits(req.Depth)
+			if req.DeepenRelative {
+				if !caps.Supports(capability.DeepenRelative) {
+					return nil, fmt.Errorf("%w: %s", ErrShallowNotSupported, capability.DeepenRelative)
+				}
+
+				upreq.Capabilities.Set(capability.DeepenRelative) // nolint: errcheck
+			}
+		case !req.DeepenSince.IsZero():
+			if !caps.Supports(capability.DeepenSince) {
+				return nil, fmt.Errorf("%w: %s", ErrShallowNotSupported, capability.DeepenSince)
+			}
+
+			upreq.Depth = packp.DepthSince(req.DeepenSince)
+		}
+
+		if len(req.DeepenNot) > 0 {
+			if !caps.Supports(capability.DeepenNot) {
+				return nil, fmt.Errorf("%w: %s", ErrShallowNotSupported, capability.DeepenNot)
+			}
+
+			upreq.DeepenNot = req.DeepenNot
+		}
+
 		upreq.Shallows, err = st.Shallow()
 		if err != nil {
 			return nil, err
@@ -112,32 +155,67 @@ func NegotiatePack(
 	}
 
 	// Create upload-haves
+	negotiator := req.Negotiator
+	flush := maxHavesPerRound
+	if negotiator == nil {
+		negotiator = &havesNegotiator{haves: req.Haves}
+	} else {
+		flush = initialFlush
+	}
+
+	next, err := negotiator.Next()
+	exhausted := errors.Is(err, io.EOF)
+	if err != nil && !exhausted {
+		return nil, err
+	}
+
 	common := map[plumbing.Hash]struct{}{}
+	var commonHaves []plumbing.Hash
 
+	var count int
 	var inVein int
 	var done bool
 	var gotContinue bool // whether we got a continue from the server
+	var gotReady bool    // whether the server is ready to send the pack
 	firstRound := true
 	for !done {
-		// Pop the last 32 or depth have commits from the pending list and
-		// insert their parents into the pending list.
-		// TODO: Properly build and implement haves negotiation, and move it
-		// from remote.go to this package.
-		var uphav packp.UploadHaves
-		for i := 0; i < 32 && len(req.Haves) > 0; i++ {
-			uphav.Haves = append(uphav.Haves, req.Haves[len(req.Haves)-1])
-			req.Haves = req.Haves[:len(req.Haves)-1]
+		// Take the next haves from the negotiator, up to the next flush.
+		var haves []plumbing.Hash
+		for ; count < flush && !exhausted && !gotReady; count++ {
+			haves = append(haves, next)
 			inVein++
+
+			next, err = negotiator.Next()
+			if errors.Is(err, io.EOF) {
+				exhausted = true
+			} else if err != nil {
+				return nil, err
+			}
+		}
+
+		if req.Negotiator != nil {
+			flush = nextFlush(conn.StatelessRPC(), flush)
+		} else {
+			flush += maxHavesPerRound
 		}
 
 		// Let the server know we're done
-		const maxInVein = 256
-		done = len(req.Haves) == 0 || (gotContinue && inVein >= maxInVein)
+		done = exhausted || gotReady || (gotContinue && inVein >= maxInVein)
+
+		// The server doesn't keep the state of the negotiation between the
+		// requests of a stateless connection, the common haves are sent
+		// again along with the new ones.
+		var uphav packp.UploadHaves
+		if conn.StatelessRPC() {
+			uphav.Haves = append(uphav.Haves, commonHaves...)
+		}
+
+		uphav.Haves = append(uphav.Haves, haves...)
 		uphav.Done = done
 
 		// Note: empty request means haves are a subset of wants, in that case we have
 		// everything we asked for. Close the connection and return nil.
-		if isSubset(req.Wants, uphav.Haves) && len(upreq.Shallows) == 0 {
+		if isSubset(req.Wants, haves) && len(upreq.Shallows) == 0 {
 			if err := pktline.WriteFlush(writer); err != nil {
 				return nil, err
 			}
@@ -186,7 +264,7 @@ func NegotiatePack(
 		go func() {
 			defer close(readc)
 
-			if done || len(uphav.Haves) > 0 {
+			if done || len(haves) > 0 {
 				var srvrs packp.ServerResponse
 				if err := srvrs.Decode(reader); err != nil {
 					readc <- fmt.Errorf("decoding server-response: %w", err)
@@ -194,11 +272,27 @@ func NegotiatePack(
 				}
 
 				for _, ack := range srvrs.ACKs {
-					if !gotContinue && ack.Status > 0 {
-						gotContinue = true
+					if ack.Status == 0 {
+						continue
 					}
-					if ack.Status == packp.ACKCommon {
-						common[ack.Hash] = struct{}{}
+
+					gotContinue = true
+					if ack.Status == packp.ACKReady {
+						gotReady = true
+					}
+
+					if _, ok := common[ack.Hash]; ok {
+						continue
+					}
+
+					// A new common commit resets the count of the haves
+					// sent in vain.
+					common[ack.Hash] = struct{}{}
+					commonHaves = append(commonHaves, ack.Hash)
+					inVein = 0
+					if err := negotiator.Ack(ack.Hash); err != nil {
+						readc <- err
+						return
 					}
 				}
 			}
@@ -223,6 +317,220 @@ func NegotiatePack(
 	return shallowInfo, nil
 }
 
+// Features of the protocol v2 fetch command.
+const (
+	fetchShallow   = "shallow"
+	fetchFilter    = "filter"
+	fetchRefInWant = "ref-in-want"
+)
+
+// NegotiatePackV2 sends the protocol v2 fetch command and reads the response
+// up to the packfile section, which can then be read using FetchPack. All
+// the haves are sent at once along with "done", so the negotiation always
+// takes a single round. The writer is closed once the command is sent when
+// the connection is stateless.
+// See https://git-scm.com/docs/protocol-v2#_fetch
+func NegotiatePackV2(
+	ctx context.Context,
+	st storage.Storer,
+	conn Connection,
+	reader io.Reader,
+	writer io.WriteCloser,
+	req *FetchRequest,
+) (shallowInfo *packp.ShallowUpdate, err error) {
+	caps := conn.Capabilities()
+	if !caps.Supports(capability.Fetch) {
+		return nil, fmt.Errorf("%w: fetch", ErrUnsupportedCommand)
+	}
+
+	features := caps.Get(capability.Fetch)
+	fetch := packp.NewFetchV2Request()
+	fetch.Capabilities = commandCapabilities(caps)
+	fetch.OFSDelta = true
+	fetch.NoProgress = req.Progress == nil
+	fetch.IncludeTag = req.IncludeTags
+	fetch.Wants = req.Wants
+
+	if len(req.WantRefs) > 0 {
+		if slices.Contains(features, fetchRefInWant) {
+			fetch.WantRefs = req.WantRefs
+		} else {
+			names := make([]string, 0, len(req.WantRefs))
+			for _, name := range req.WantRefs {
+				names = append(names, name.String())
+			}
+
+			refs, err := ListRefs(ctx, conn, names...)
+			if err != nil {
+				return nil, err
+			}
+
+			if err := resolveWantRefs(req, refs); err != nil {
+				return nil, err
+			}
+
+			fetch.Wants = req.Wants
+		}
+	}
+
+	if req.Filter != "" {
+		if !slices.Contains(features, fetchFilter) {
+			return nil, ErrFilterNotSupported
+		}
+
+		fetch.Filter = req.Filter
+	}
+
+	if req.IsShallow() {
+		if !slices.Contains(features, fetchShallow) {
+			return nil, ErrShallowNotSupported
+		}
+
+		fetch.Depth = req.Depth
+		fetch.DeepenRelative = req.DeepenRelative
+		fetch.DeepenSince = req.DeepenSince
+		fetch.DeepenNot = req.DeepenNot
+		fetch.Shallows, err = st.Shallow()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// Note: empty request means haves are a subset of wants, in that case we have
+	// everything we asked for.
+	if len(fetch.WantRefs) == 0 && isSubset(fetch.Wants, req.Haves) && len(fetch.Shallows) == 0 {
+		return nil, ErrNoChange
+	}
+
+	reader = ioutil.NewContextReader(ctx, reader)
+	writer = ioutil.NewContextWriteCloser(ctx, writer)
+	var res *packp.FetchV2Response
+	if req.Negotiator != nil {
+		res, err = negotiateV2(conn, reader, writer, fetch, req.Negotiator)
+	} else {
+		fetch.Haves = req.Haves
+		fetch.Done = true
+		res, err = sendFetchV2(conn, reader, writer, fetch)
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	req.WantedRefs = append(req.WantedRefs, res.WantedRefs...)
+	if req.IsShallow() {
+		shallowInfo = &res.ShallowUpdate
+	}
+
+	return shallowInfo, nil
+}
+
+// sendFetchV2 sends the fetch command and reads its response, up to the
+// packfile section.
+func sendFetchV2(
+	conn Connection,
+	reader io.Reader,
+	writer io.WriteCloser,
+	fetch *packp.FetchV2Request,
+) (*packp.FetchV2Response, error) {
+	if err := fetch.Encode(writer); err != nil {
+		return nil, fmt.Errorf("sending fetch: %w", err)
+	}
+
+	if conn.StatelessRPC() {
+		if err := writer.Close(); err != nil {
+			return nil, fmt.Errorf("closing writer: %w", err)
+		}
+	}
+
+	var res packp.FetchV2Response
+	err := res.Decode(reader)
+	return &res, err
+}
+
+// negotiateV2 sends the haves of the negotiator in rounds of fetch commands,
+// until the server is ready to send the packfile or there are no more haves,
+// and returns the response holding the packfile. As the server doesn't keep
+// the state of the negotiation between the commands, each of them holds the
+// haves acknowledged as common by the previous ones.
+func negotiateV2(
+	conn Connection,
+	reader io.Reader,
+	writer io.WriteCloser,
+	fetch *packp.FetchV2Request,
+	negotiator Negotiator,
+) (*packp.FetchV2Response, error) {
+	next, err := negotiator.Next()
+	exhausted := errors.Is(err, io.EOF)
+	if err != nil && !exhausted {
+		return nil, err
+	}
+
+	common := map[plumbing.Hash]struct{}{}
+	var commonHaves []plumbing.Hash
+
+	var count int
+	var inVein int
+	var gotAck bool
+	flush := initialFlush
+	for {
+		fetch.Haves = slices.Clone(commonHaves)
+		for ; count < flush && !exhausted; count++ {
+			fetch.Haves = append(fetch.Haves, next)
+			inVein++
+
+			next, err = negotiator.Next()
+			if errors.Is(err, io.EOF) {
+				exhausted = true
+			} else if err != nil {
+				return nil, err
+			}
+		}
+
+		flush = nextFlush(true, flush)
+		fetch.Done = exhausted || (gotAck && inVein >= maxInVein)
+		res, err := sendFetchV2(conn, reader, writer, fetch)
+		if err == nil || !errors.Is(err, packp.ErrNoPackfile) || fetch.Done {
+			return res, err
+		}
+
+		for _, h := range res.ACKs {
+			if _, ok := common[h]; ok {
+				continue
+			}
+
+			common[h] = struct{}{}
+			commonHaves = append(commonHaves, h)
+			gotAck = true
+			inVein = 0
+			if err := negotiator.Ack(h); err != nil {
+				return nil, err
+			}
+		}
+	}
+}
+
+// resolveWantRefs adds the objects the references of req.WantRefs point to
+// to the wants of req, given the references of the remote.
+func resolveWantRefs(req *FetchRequest, refs []*plumbing.Reference) error {
+	rs := memory.ReferenceStorage{}
+	for _, ref := range refs {
+		rs.SetReference(ref) // nolint: errcheck
+	}
+
+	for _, name := range req.WantRefs {
+		ref, err := storer.ResolveReference(rs, name)
+		if err != nil {
+			return fmt.Errorf("resolving %s: %w", name, err)
+		}
+
+		req.Wants = append(req.Wants, ref.Hash())
+		req.WantedRefs = append(req.WantedRefs, plumbing.NewHashReference(name, ref.Hash()))
+	}
+
+	return nil
+}
+
 func isSubset(needle, haystack []plumbing.Hash) bool {
 	for _, h := range needle {
 		if !slices.Contains(haystack, h) {
@@ -241,17 +549,16 @@ func readShallows(
 	firstRound bool,
 ) error {
 	// Decode shallow-update
-	// If depth is not zero, then we expect a shallow update from the
+	// If the request is shallow, then we expect a shallow update from the
 	// server.
-	if (firstRound || conn.StatelessRPC()) && req.Depth > 0 {
+	if (firstRound || conn.StatelessRPC()) && req.IsShallow() {
 		var shupd packp.ShallowUpdate
 		if err := shupd.Decode(r); err != nil {
 			return fmt.Errorf("decoding shallow-update: %w", err)
 		}
 
 		// Only return the first shallow update
-		if shallowInfo == nil {
-			shallowInfo = new(*packp.ShallowUpdate)
+		if *shallowInfo == nil {
 			*shallowInfo = &shupd
 		}
 	}
@@ -0,0 +1,282 @@
+package transport
+
+import (
+	"errors"
+	"io"
+
+	"github.com/emirpasic/gods/trees/binaryheap"
+
+	"github.com/go-git/go-git/v6/plumbing"
+	"github.com/go-git/go-git/v6/plumbing/object"
+	"github.com/go-git/go-git/v6/plumbing/storer"
+)
+
+// Negotiator chooses the haves sent to the server during the negotiation of
+// a fetch, taking into account the ones the server acknowledged as common.
+// The haves are sent in rounds of increasing size, so the first haves
+// returned by Next should be the most likely to be common with the server.
+type Negotiator interface {
+	// Next returns the next have to send to the server, or io.EOF if there
+	// are no more.
+	Next() (plumbing.Hash, error)
+	// Ack is called with each have the server acknowledged as common.
+	Ack(h plumbing.Hash) error
+}
+
+// NewNegotiatorFunc returns the Negotiator of a fetch into the given storer,
+// given the local commits to start from, such as the ones pointed to by the
+// local references.
+type NewNegotiatorFunc func(s storer.EncodedObjectStorer, tips []plumbing.Hash) Negotiator
+
+const (
+	// maxHavesPerRound is the number of haves of FetchRequest.Haves sent in
+	// each round of the negotiation.
+	maxHavesPerRound = 32
+	// initialFlush is the number of haves of a Negotiator sent in the first
+	// round of the negotiation, the next rounds sending more of them.
+	initialFlush = 16
+	// largeFlush is the total number of haves past which the rounds of the
+	// stateless connections stop doubling in size.
+	largeFlush = 16384
+	// maxInVein is the number of haves sent since the last one acknowledged
+	// as common past which the client gives up the negotiation.
+	maxInVein = 256
+)
+
+// nextFlush returns the total number of haves sent by the end of the next
+// round of the negotiation, given the one of the current round, as git does:
+// the size of the rounds doubles with the stateless connections, each round
+// being a request of its own, and stops growing past maxHavesPerRound with
+// the stateful ones.
+func nextFlush(stateless bool, count int) int {
+	switch {
+	case stateless && count < largeFlush:
+		return count * 2
+	case stateless:
+		return count * 11 / 10
+	case count < maxHavesPerRound:
+		return count * 2
+	default:
+		return count + maxHavesPerRound
+	}
+}
+
+// havesNegotiator sends the haves of a FetchRequest, from the last one, not
+// taking the acknowledgments into account.
+type havesNegotiator struct {
+	haves []plumbing.Hash
+}
+
+func (n *havesNegotiator) Next() (plumbing.Hash, error) {
+	if len(n.haves) == 0 {
+		return plumbing.ZeroHash, io.EOF
+	}
+
+	h := n.haves[len(n.haves)-1]
+	n.haves = n.haves[:len(n.haves)-1]
+	return h, nil
+}
+
+func (*havesNegotiator) Ack(plumbing.Hash) error {
+	return nil
+}
+
+type negotiationFlags uint8
+
+const (
+	// seen is set on the commits pushed to the queue.
+	seen negotiationFlags = 1 << iota
+	// common is set on the commits the server has, the ones acknowledged
+	// and their ancestors.
+	common
+	// popped is set on the commits taken from the queue.
+	popped
+)
+
+// commitNegotiator walks the history of the local commits as the default
+// negotiator of git, see fetch-negotiator.h.
+type commitNegotiator struct {
+	s       storer.EncodedObjectStorer
+	queue   *binaryheap.Heap
+	flags   map[plumbing.Hash]negotiationFlags
+	parents map[plumbing.Hash][]plumbing.Hash
+	// nonCommon is the number of commits of the queue not known to be
+	// common, the walk stops once there are none.
+	nonCommon int
+	err       error
+}
+
+// NewCommitNegotiator returns a Negotiator walking the history of the given
+// commits as git does by default: the most recent commits are sent first,
+// and the walk goes back in history until the server acknowledges one of
+// them, stopping at the ancestors of the commits acknowledged. The tips which
+// are annotated tags are peeled, the ones which are neither commits nor tags
+// are ignored, as are the missing ancestors of shallow histories.
+func NewCommitNegotiator(s storer.EncodedObjectStorer, tips []plumbing.Hash) Negotiator {
+	n := &commitNegotiator{
+		s: s,
+		queue: binaryheap.NewWith(func(a, b any) int {
+			if a.(*object.Commit).Committer.When.Before(b.(*object.Commit).Committer.When) {
+				return 1
+			}
+
+			return -1
+		}),
+		flags:   make(map[plumbing.Hash]negotiationFlags),
+		parents: make(map[plumbing.Hash][]plumbing.Hash),
+	}
+
+	for _, h := range tips {
+		c, err := n.peelCommit(h)
+		if err != nil {
+			n.err = err
+			return n
+		}
+
+		if c != nil {
+			n.push(c, seen)
+		}
+	}
+
+	return n
+}
+
+// peelCommit returns the commit of the given object, or nil if it is neither
+// a commit nor an annotated tag of one.
+func (n *commitNegotiator) peelCommit(h plumbing.Hash) (*object.Commit, error) {
+	for {
+		o, err := object.GetObject(n.s, h)
+		if errors.Is(err, plumbing.ErrObjectNotFound) {
+			return nil, nil
+		}
+
+		if err != nil {
+			return nil, err
+		}
+
+		switch o := o.(type) {
+		case *object.Commit:
+			return o, nil
+		case *object.Tag:
+			h = o.Target
+		default:
+			return nil, nil
+		}
+	}
+}
+
+// push sets the given flags on the commit and pushes it to the queue, unless
+// they are already set.
+func (n *commitNegotiator) push(c *object.Commit, flags negotiationFlags) {
+	if n.flags[c.Hash]&flags != 0 {
+		return
+	}
+
+	n.flags[c.Hash] |= flags
+	n.parents[c.Hash] = c.ParentHashes
+	n.queue.Push(c)
+	if n.flags[c.Hash]&common == 0 {
+		n.nonCommon++
+	}
+}
+
+// commit returns the given commit, or nil if it is missing, as the parents
+// of the shallow commits are.
+func (n *commitNegotiator) commit(h plumbing.Hash) (*object.Commit, error) {
+	c, err := object.GetCommit(n.s, h)
+	if errors.Is(err, plumbing.ErrObjectNotFound) {
+		return nil, nil
+	}
+
+	return c, err
+}
+
+func (n *commitNegotiator) Next() (plumbing.Hash, error) {
+	if n.err != nil {
+		return plumbing.ZeroHash, n.err
+	}
+
+	for n.nonCommon > 0 && !n.queue.Empty() {
+		v, _ := n.queue.Pop()
+		c := v.(*object.Commit)
+		flags := n.flags[c.Hash]
+		n.flags[c.Hash] |= popped
+		if flags&common == 0 {
+			n.nonCommon--
+		}
+
+		// The ancestors of the common commits are common, and not sent.
+		mark := seen
+		if flags&common != 0 {
+			mark |= common
+		}
+
+		for _, p := range c.ParentHashes {
+			if n.flags[p]&seen == 0 {
+				parent, err := n.commit(p)
+				if err != nil {
+					return plumbing.ZeroHash, err
+				}
+
+				if parent != nil {
+					n.push(parent, mark)
+				}
+			}
+
+			if mark&common != 0 {
+				if err := n.markCommon(p); err != nil {
+					return plumbing.ZeroHash, err
+				}
+			}
+		}
+
+		if flags&common == 0 {
+			return c.Hash, nil
+		}
+	}
+
+	return plumbing.ZeroHash, io.EOF
+}
+
+func (n *commitNegotiator) Ack(h plumbing.Hash) error {
+	return n.markCommon(h)
+}
+
+// markCommon marks the given commit as common along with its ancestors
+// already seen. The ones not seen yet are pushed to the queue, their own
+// ancestors being marked once they are popped.
+func (n *commitNegotiator) markCommon(h plumbing.Hash) error {
+	stack := []plumbing.Hash{h}
+	for len(stack) > 0 {
+		h := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+
+		flags := n.flags[h]
+		if flags&common != 0 {
+			continue
+		}
+
+		if flags&seen == 0 {
+			c, err := n.commit(h)
+			if err != nil {
+				return err
+			}
+
+			if c != nil {
+				n.flags[h] |= common
+				n.push(c, seen)
+			}
+
+			continue
+		}
+
+		n.flags[h] |= common
+		if flags&popped == 0 {
+			n.nonCommon--
+		}
+
+		stack = append(stack, n.parents[h]...)
+	}
+
+	return nil
+}
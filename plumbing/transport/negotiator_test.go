@@ -0,0 +1,116 @@
+package transport
+
+import (
+	"errors"
+	"io"
+	"testing"
+
+	fixtures "github.com/go-git/go-git-fixtures/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/go-git/go-git/v6/plumbing"
+	"github.com/go-git/go-git/v6/plumbing/cache"
+	"github.com/go-git/go-git/v6/plumbing/object"
+	"github.com/go-git/go-git/v6/plumbing/storer"
+	"github.com/go-git/go-git/v6/storage/filesystem"
+)
+
+// ancestors returns the given commit and its ancestors.
+func ancestors(t *testing.T, s storer.EncodedObjectStorer, h plumbing.Hash) map[plumbing.Hash]bool {
+	t.Helper()
+
+	c, err := object.GetCommit(s, h)
+	require.NoError(t, err)
+
+	result := make(map[plumbing.Hash]bool)
+	require.NoError(t, object.NewCommitPreorderIter(c, nil, nil).ForEach(func(c *object.Commit) error {
+		result[c.Hash] = true
+		return nil
+	}))
+
+	return result
+}
+
+func TestCommitNegotiator(t *testing.T) {
+	t.Parallel()
+
+	master := plumbing.NewHash("6ecf0ef2c2dffb796033e5a02219af86ec6584e5")
+
+	for name, ack := range map[string]plumbing.Hash{
+		"none":   plumbing.ZeroHash,
+		"parent": plumbing.NewHash("918c48b83bd081e863dbe1b80f8998f058cd8294"),
+		"merge":  plumbing.NewHash("1669dce138d9b841a518c64b10914d88f5e488ea"),
+		"branch": plumbing.NewHash("a5b8b09e2f8fcb0bb99d3ccb0958157b40890d69"),
+	} {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			s := filesystem.NewStorage(fixtures.Basic().One().DotGit(), cache.NewObjectLRUDefault())
+			all := ancestors(t, s, master)
+
+			// The tips which are not commits are ignored.
+			n := NewCommitNegotiator(s, []plumbing.Hash{
+				master,
+				plumbing.NewHash("a8d315b2b1c615d43042c3a62402b8a54288cf5c"),
+			})
+
+			common := make(map[plumbing.Hash]bool)
+			var sent []plumbing.Hash
+			var last *object.Commit
+			for {
+				h, err := n.Next()
+				if errors.Is(err, io.EOF) {
+					break
+				}
+
+				require.NoError(t, err)
+				assert.False(t, common[h], h)
+				sent = append(sent, h)
+
+				// The most recent commits are sent first.
+				c, err := object.GetCommit(s, h)
+				require.NoError(t, err)
+				if last != nil {
+					assert.False(t, c.Committer.When.After(last.Committer.When), h)
+				}
+
+				last = c
+				if !ack.IsZero() && len(sent) == 2 {
+					require.NoError(t, n.Ack(ack))
+					common = ancestors(t, s, ack)
+				}
+			}
+
+			// The commits sent and the ones known to be common are the
+			// history of the tips.
+			for _, h := range sent {
+				common[h] = true
+			}
+
+			assert.Equal(t, all, common)
+			if ack.IsZero() {
+				assert.Len(t, sent, len(all))
+			}
+		})
+	}
+}
+
+func TestNextFlush(t *testing.T) {
+	t.Parallel()
+
+	var stateful, stateless []int
+	for count, i := initialFlush, 0; i < 5; i++ {
+		stateful = append(stateful, count)
+		count = nextFlush(false, count)
+	}
+
+	for count, i := initialFlush, 0; i < 5; i++ {
+		stateless = append(stateless, count)
+		count = nextFlush(true, count)
+	}
+
+	assert.Equal(t, []int{16, 32, 64, 96, 128}, stateful)
+	assert.Equal(t, []int{16, 32, 64, 128, 256}, stateless)
+	assert.Equal(t, 18026, nextFlush(true, largeFlush+4))
+}
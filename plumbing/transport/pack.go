@@ -9,6 +9,7 @@ import (
 	"sync/atomic"
 
 	"github.com/go-git/go-git/v6/plumbing"
+	"github.com/go-git/go-git/v6/plumbing/format/pktline"
 	"github.com/go-git/go-git/v6/plumbing/protocol"
 	"github.com/go-git/go-git/v6/plumbing/protocol/packp"
 	"github.com/go-git/go-git/v6/plumbing/protocol/packp/capability"
@@ -78,6 +79,10 @@ func (p *PackSession) Handshake(ctx context.Context, service Service, params ...
 		return nil, err
 	}
 
+	// The stalled transfers are aborted by closing the command.
+	if p.ep != nil {
+		stdout = NewIdleTimeoutReader(stdout, cmd, p.ep.Timeouts.Idle)
+	}
 	cr := ioutil.NewContextReaderWithCloser(ctx, stdout, cmd)
 	c.r = bufio.NewReader(cr)
 
@@ -111,7 +116,17 @@ func (p *PackSession) Handshake(ctx context.Context, service Service, params ...
 
 	switch c.version {
 	case protocol.V2:
-		return nil, ErrUnsupportedVersion
+		if service != UploadPackService {
+			return nil, ErrUnsupportedVersion
+		}
+
+		adv := packp.NewCapabilityAdvertisement()
+		if err := adv.Decode(c.r); err != nil {
+			return nil, err
+		}
+
+		c.caps = adv.Capabilities
+		return c, nil
 	case protocol.V1:
 		// Read the version line
 		fallthrough
@@ -141,6 +156,8 @@ type packConnection struct {
 	version protocol.Version
 	caps    *capability.List
 	refs    *packp.AdvRefs
+	// sent is set once a fetch or push request was sent.
+	sent bool
 }
 
 var _ Connection = &packConnection{}
@@ -162,6 +179,12 @@ func (p *packConnection) stderr() error {
 
 // Close implements Connection.
 func (p *packConnection) Close() error {
+	if p.version == protocol.V2 || !p.sent {
+		// Let the server know that no more commands will be sent, or with
+		// protocol v0 and v1 that nothing is requested.
+		_ = pktline.WriteFlush(p.w)
+	}
+
 	return p.cmd.Close()
 }
 
@@ -172,6 +195,15 @@ func (p *packConnection) Capabilities() *capability.List {
 
 // GetRemoteRefs implements Connection.
 func (p *packConnection) GetRemoteRefs(ctx context.Context) ([]*plumbing.Reference, error) {
+	if p.refs == nil && p.version == protocol.V2 {
+		ar, err := LsRefs(ctx, p, p.r, p.w)
+		if err != nil {
+			return nil, err
+		}
+
+		p.refs = ar
+	}
+
 	if p.refs == nil {
 		// TODO: return appropriate error
 		return nil, ErrEmptyRemoteRepository
@@ -188,6 +220,31 @@ func (p *packConnection) GetRemoteRefs(ctx context.Context) ([]*plumbing.Referen
 	return p.refs.MakeReferenceSlice()
 }
 
+// ListRefs implements RefLister.
+func (p *packConnection) ListRefs(ctx context.Context, prefixes ...string) ([]*plumbing.Reference, error) {
+	if p.version != protocol.V2 || len(prefixes) == 0 {
+		if p.version == protocol.V2 {
+			// The references are listed again, instead of returning the
+			// ones of a previous command.
+			p.refs = nil
+		}
+
+		refs, err := p.GetRemoteRefs(ctx)
+		if err != nil {
+			return nil, err
+		}
+
+		return FilterRefs(refs, prefixes...), nil
+	}
+
+	ar, err := LsRefs(ctx, p, p.r, p.w, prefixes...)
+	if err != nil {
+		return nil, err
+	}
+
+	return ar.MakeReferenceSlice()
+}
+
 // Version implements Connection.
 func (p *packConnection) Version() protocol.Version {
 	return p.version
@@ -200,7 +257,13 @@ func (*packConnection) StatelessRPC() bool {
 
 // Fetch implements Connection.
 func (p *packConnection) Fetch(ctx context.Context, req *FetchRequest) (err error) {
-	shallows, err := NegotiatePack(ctx, p.st, p, p.r, p.w, req)
+	negotiate := NegotiatePack
+	if p.version == protocol.V2 {
+		negotiate = NegotiatePackV2
+	}
+
+	p.sent = p.version != protocol.V2
+	shallows, err := negotiate(ctx, p.st, p, p.r, p.w, req)
 	if err != nil {
 		return err
 	}
@@ -210,6 +273,7 @@ func (p *packConnection) Fetch(ctx context.Context, req *FetchRequest) (err erro
 
 // Push implements Connection.
 func (p *packConnection) Push(ctx context.Context, req *PushRequest) (err error) {
+	p.sent = true
 	return SendPack(ctx, p.st, p, p.w, io.NopCloser(p.r), req)
 }
 
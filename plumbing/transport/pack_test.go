@@ -4,10 +4,20 @@ import (
 	"bytes"
 	"context"
 	"io"
+	"os"
+	"os/exec"
+	"strings"
 	"testing"
 
+	fixtures "github.com/go-git/go-git-fixtures/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 	"github.com/stretchr/testify/suite"
 
+	"github.com/go-git/go-git/v6/plumbing"
+	"github.com/go-git/go-git/v6/plumbing/protocol"
+	"github.com/go-git/go-git/v6/storage"
+	"github.com/go-git/go-git/v6/storage/memory"
 	"github.com/go-git/go-git/v6/utils/ioutil"
 )
 
@@ -70,3 +80,89 @@ func (s *CmdStartEOFSuite) TestCmdStartEOFConnectionLeakError() {
 	cmdr := cmdrInterface.(*mockStartEOFCommander)
 	s.False(cmdr.mockCmd.sessionOpened)
 }
+
+// gitCommander runs the git binary, passing the parameters as GIT_PROTOCOL
+// like the ssh and file transports of git do.
+type gitCommander struct{}
+
+func (gitCommander) Command(ctx context.Context, cmd string, ep *Endpoint, _ AuthMethod, params ...string) (Command, error) {
+	c := exec.CommandContext(ctx, "git", strings.TrimPrefix(cmd, "git-"), ep.Path)
+	c.Env = append(os.Environ(), "GIT_PROTOCOL="+strings.Join(params, ":"))
+	return &gitCommand{Cmd: c}, nil
+}
+
+type gitCommand struct {
+	*exec.Cmd
+	stdin io.WriteCloser
+}
+
+func (c *gitCommand) StderrPipe() (io.Reader, error) {
+	return c.Cmd.StderrPipe()
+}
+
+func (c *gitCommand) StdinPipe() (io.WriteCloser, error) {
+	var err error
+	c.stdin, err = c.Cmd.StdinPipe()
+	return c.stdin, err
+}
+
+func (c *gitCommand) StdoutPipe() (io.Reader, error) {
+	return c.Cmd.StdoutPipe()
+}
+
+func (c *gitCommand) Close() error {
+	_ = c.stdin.Close()
+	return c.Wait()
+}
+
+func handshakeV2(t *testing.T, st storage.Storer) Connection {
+	dot := fixtures.Basic().One().DotGit(fixtures.WithTargetDir(t.TempDir))
+	ep, err := NewEndpoint(dot.Root())
+	require.NoError(t, err)
+
+	sess, err := NewPackTransport(gitCommander{}).NewSession(st, ep, nil)
+	require.NoError(t, err)
+	conn, err := sess.Handshake(context.TODO(), UploadPackService, VersionParam(protocol.V2))
+	require.NoError(t, err)
+	t.Cleanup(func() { assert.NoError(t, conn.Close()) })
+
+	require.Equal(t, protocol.V2, conn.Version())
+	return conn
+}
+
+func TestPackConnectionV2ListRefs(t *testing.T) {
+	conn := handshakeV2(t, memory.NewStorage())
+
+	refs, err := ListRefs(context.TODO(), conn, "refs/heads/")
+	require.NoError(t, err)
+	assert.Equal(t, []*plumbing.Reference{
+		plumbing.NewReferenceFromStrings("refs/heads/branch", "e8d3ffab552895c19b9fcf7aa264d277cde33881"),
+		plumbing.NewReferenceFromStrings("refs/heads/master", "6ecf0ef2c2dffb796033e5a02219af86ec6584e5"),
+	}, refs)
+
+	// Commands can be run one after another on the same connection.
+	refs, err = conn.GetRemoteRefs(context.TODO())
+	require.NoError(t, err)
+	assert.Contains(t, refs, plumbing.NewSymbolicReference(plumbing.HEAD, plumbing.Master))
+}
+
+func TestPackConnectionV2Fetch(t *testing.T) {
+	st := memory.NewStorage()
+	conn := handshakeV2(t, st)
+
+	master := plumbing.NewHash("6ecf0ef2c2dffb796033e5a02219af86ec6584e5")
+	req := &FetchRequest{
+		WantRefs: []plumbing.ReferenceName{plumbing.Master},
+		Depth:    1,
+	}
+	require.NoError(t, conn.Fetch(context.TODO(), req))
+	assert.Equal(t, []*plumbing.Reference{plumbing.NewHashReference(plumbing.Master, master)}, req.WantedRefs)
+	assert.NoError(t, st.HasEncodedObject(master))
+
+	shallows, err := st.Shallow()
+	require.NoError(t, err)
+	assert.Equal(t, []plumbing.Hash{master}, shallows)
+
+	_, err = ListRefs(context.TODO(), conn, "refs/heads/master")
+	assert.NoError(t, err)
+}
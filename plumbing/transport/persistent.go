@@ -0,0 +1,153 @@
+package transport
+
+import (
+	"context"
+	"errors"
+	"sync"
+
+	"github.com/go-git/go-git/v6/plumbing"
+	"github.com/go-git/go-git/v6/plumbing/protocol"
+)
+
+// ErrSessionClosed is returned by the commands of a PersistentSession once it
+// was closed.
+var ErrSessionClosed = errors.New("session closed")
+
+// PersistentSession runs many ls-refs and fetch commands against the
+// upload-pack service of a remote, as done by the pollers of a mirror,
+// reusing its connection between them.
+//
+// Using protocol v2 over a stateless connection, such as HTTP, a single
+// handshake is made: the capabilities of the server are advertised once, and
+// the following commands are sent over the keep-alive connections of the
+// client. Otherwise, a new connection is made for each ListRefs, since the
+// references are either only advertised by the handshake, using protocol v0
+// or v1, or read once by the server process, using protocol v2 over the
+// stateful connections. The Fetch following a ListRefs is then made on its
+// connection.
+//
+// The connection is closed when a command fails, and a new one is made by the
+// next command. A PersistentSession is safe for concurrent use, its commands
+// being run one after another.
+type PersistentSession struct {
+	session Session
+	params  []string
+
+	mu     sync.Mutex
+	conn   Connection
+	cancel context.CancelFunc
+	// listed is set once the references of a connection which doesn't list
+	// them again were returned.
+	listed bool
+	closed bool
+}
+
+// NewPersistentSession returns a PersistentSession making its handshakes with
+// the given session and parameters, such as VersionParam(protocol.V2).
+func NewPersistentSession(session Session, params ...string) *PersistentSession {
+	return &PersistentSession{session: session, params: params}
+}
+
+// ListRefs returns the references of the remote whose names start with one
+// of the given prefixes, or all of them if no prefix is given.
+func (s *PersistentSession) ListRefs(ctx context.Context, prefixes ...string) ([]*plumbing.Reference, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.conn != nil && s.listed {
+		s.closeConn()
+	}
+
+	conn, err := s.connect(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	refs, err := ListRefs(ctx, conn, prefixes...)
+	if err != nil {
+		s.closeConn()
+		return nil, err
+	}
+
+	s.listed = !reusable(conn)
+	return refs, nil
+}
+
+// Fetch fetches the objects of wants missing from the storage of the session,
+// given the objects of haves it already has.
+func (s *PersistentSession) Fetch(ctx context.Context, wants, haves []plumbing.Hash) error {
+	return s.FetchWithRequest(ctx, &FetchRequest{Wants: wants, Haves: haves})
+}
+
+// FetchWithRequest is like Fetch, with all the options of a fetch request.
+func (s *PersistentSession) FetchWithRequest(ctx context.Context, req *FetchRequest) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	conn, err := s.connect(ctx)
+	if err != nil {
+		return err
+	}
+
+	err = conn.Fetch(ctx, req)
+	if err != nil || !reusable(conn) {
+		s.closeConn()
+	}
+
+	return err
+}
+
+// Close closes the connection of the session, if any. The following commands
+// fail with ErrSessionClosed.
+func (s *PersistentSession) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.closed = true
+	return s.closeConn()
+}
+
+// connect returns the connection of the session, making a new one if needed.
+func (s *PersistentSession) connect(ctx context.Context) (Connection, error) {
+	if s.closed {
+		return nil, ErrSessionClosed
+	}
+
+	if s.conn != nil {
+		return s.conn, nil
+	}
+
+	// The connection outlives ctx, which only bounds the handshake.
+	connCtx, cancel := context.WithCancel(context.WithoutCancel(ctx))
+	stop := context.AfterFunc(ctx, cancel)
+	conn, err := s.session.Handshake(connCtx, UploadPackService, s.params...)
+	if !stop() || err != nil {
+		cancel()
+		if err == nil {
+			_ = conn.Close()
+			err = ctx.Err()
+		}
+
+		return nil, err
+	}
+
+	s.conn, s.cancel, s.listed = conn, cancel, false
+	return conn, nil
+}
+
+// reusable returns whether all the commands can be run on the connection.
+func reusable(conn Connection) bool {
+	return conn.Version() == protocol.V2 && conn.StatelessRPC()
+}
+
+// closeConn closes the connection of the session, if any.
+func (s *PersistentSession) closeConn() error {
+	if s.conn == nil {
+		return nil
+	}
+
+	err := s.conn.Close()
+	s.cancel()
+	s.conn, s.cancel, s.listed = nil, nil, false
+	return err
+}
@@ -0,0 +1,127 @@
+package transport
+
+import (
+	"context"
+	"errors"
+	"os/exec"
+	"testing"
+
+	fixtures "github.com/go-git/go-git-fixtures/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/go-git/go-git/v6/plumbing"
+	"github.com/go-git/go-git/v6/plumbing/protocol"
+	"github.com/go-git/go-git/v6/storage"
+	"github.com/go-git/go-git/v6/storage/memory"
+)
+
+// countingSession counts the handshakes of a session, failing them when err
+// is set.
+type countingSession struct {
+	Session
+	handshakes int
+	err        error
+}
+
+func (s *countingSession) Handshake(ctx context.Context, service Service, params ...string) (Connection, error) {
+	s.handshakes++
+	if s.err != nil {
+		return nil, s.err
+	}
+
+	return s.Session.Handshake(ctx, service, params...)
+}
+
+func newPersistentSession(t *testing.T, st storage.Storer, v protocol.Version) (*PersistentSession, *countingSession, string) {
+	dot := fixtures.Basic().One().DotGit(fixtures.WithTargetDir(t.TempDir))
+	ep, err := NewEndpoint(dot.Root())
+	require.NoError(t, err)
+
+	sess, err := NewPackTransport(gitCommander{}).NewSession(st, ep, nil)
+	require.NoError(t, err)
+
+	counting := &countingSession{Session: sess}
+	s := NewPersistentSession(counting, VersionParam(v))
+	t.Cleanup(func() { assert.NoError(t, s.Close()) })
+	return s, counting, dot.Root()
+}
+
+func updateRef(t *testing.T, dir, name, hash string) {
+	cmd := exec.Command("git", "--git-dir", dir, "update-ref", name, hash)
+	out, err := cmd.CombinedOutput()
+	require.NoError(t, err, string(out))
+}
+
+func TestPersistentSessionV2Stateful(t *testing.T) {
+	st := memory.NewStorage()
+	s, counting, dir := newPersistentSession(t, st, protocol.V2)
+
+	branch := plumbing.NewReferenceFromStrings("refs/heads/branch", "e8d3ffab552895c19b9fcf7aa264d277cde33881")
+	refs, err := s.ListRefs(context.TODO(), "refs/heads/branch")
+	require.NoError(t, err)
+	assert.Equal(t, []*plumbing.Reference{branch}, refs)
+
+	// The changes of the remote are seen by the next commands.
+	updateRef(t, dir, "refs/heads/new", branch.Hash().String())
+	refs, err = s.ListRefs(context.TODO())
+	require.NoError(t, err)
+	assert.Contains(t, refs, plumbing.NewHashReference("refs/heads/new", branch.Hash()))
+
+	require.NoError(t, s.Fetch(context.TODO(), []plumbing.Hash{branch.Hash()}, nil))
+	assert.NoError(t, st.HasEncodedObject(branch.Hash()))
+
+	master := plumbing.NewHash("6ecf0ef2c2dffb796033e5a02219af86ec6584e5")
+	require.NoError(t, s.Fetch(context.TODO(), []plumbing.Hash{master}, []plumbing.Hash{branch.Hash()}))
+	assert.NoError(t, st.HasEncodedObject(master))
+
+	// The server process reads the references once, so they are listed on a
+	// new connection, which is used by the next fetch.
+	assert.Equal(t, 3, counting.handshakes)
+}
+
+func TestPersistentSessionV0(t *testing.T) {
+	st := memory.NewStorage()
+	s, counting, dir := newPersistentSession(t, st, protocol.V0)
+
+	master := plumbing.NewHash("6ecf0ef2c2dffb796033e5a02219af86ec6584e5")
+	refs, err := s.ListRefs(context.TODO(), "refs/heads/master")
+	require.NoError(t, err)
+	assert.Equal(t, []*plumbing.Reference{plumbing.NewHashReference(plumbing.Master, master)}, refs)
+	require.NoError(t, s.Fetch(context.TODO(), []plumbing.Hash{master}, nil))
+	assert.NoError(t, st.HasEncodedObject(master))
+	assert.Equal(t, 1, counting.handshakes)
+
+	// The references are advertised again by a new handshake.
+	updateRef(t, dir, "refs/heads/new", master.String())
+	refs, err = s.ListRefs(context.TODO(), "refs/heads/new")
+	require.NoError(t, err)
+	assert.Equal(t, []*plumbing.Reference{plumbing.NewHashReference("refs/heads/new", master)}, refs)
+	refs, err = s.ListRefs(context.TODO(), "refs/heads/new")
+	require.NoError(t, err)
+	assert.Len(t, refs, 1)
+	assert.Equal(t, 3, counting.handshakes)
+}
+
+func TestPersistentSessionReconnect(t *testing.T) {
+	s, counting, _ := newPersistentSession(t, memory.NewStorage(), protocol.V2)
+
+	counting.err = errors.New("connection refused")
+	_, err := s.ListRefs(context.TODO())
+	require.ErrorIs(t, err, counting.err)
+
+	counting.err = nil
+	refs, err := s.ListRefs(context.TODO())
+	require.NoError(t, err)
+	assert.NotEmpty(t, refs)
+
+	// A failing command closes the connection.
+	require.Error(t, s.Fetch(context.TODO(), []plumbing.Hash{plumbing.NewHash("0000000000000000000000000000000000000001")}, nil))
+	_, err = s.ListRefs(context.TODO())
+	require.NoError(t, err)
+	assert.Equal(t, 3, counting.handshakes)
+
+	require.NoError(t, s.Close())
+	_, err = s.ListRefs(context.TODO())
+	assert.ErrorIs(t, err, ErrSessionClosed)
+}
@@ -38,7 +38,9 @@ func buildUpdateRequests(caps *capability.List, req *PushRequest) *packp.UpdateR
 	// for more details.
 	//
 	// See https://git-scm.com/docs/gitprotocol-capabilities for more details.
-	if caps.Supports(capability.ReportStatus) {
+	if caps.Supports(capability.ReportStatusV2) {
+		upreq.Capabilities.Set(capability.ReportStatusV2) //nolint:errcheck
+	} else if caps.Supports(capability.ReportStatus) {
 		upreq.Capabilities.Set(capability.ReportStatus) //nolint:errcheck
 	}
 	if req.Progress != nil {
@@ -60,6 +62,9 @@ func buildUpdateRequests(caps *capability.List, req *PushRequest) *packp.UpdateR
 	if caps.Supports(capability.Agent) {
 		upreq.Capabilities.Set(capability.Agent, capability.DefaultAgent()) //nolint:errcheck
 	}
+	if formats := caps.Get(capability.ObjectFormat); len(formats) > 0 {
+		upreq.Capabilities.Set(capability.ObjectFormat, formats[0]) //nolint:errcheck
+	}
 
 	upreq.Commands = req.Commands
 
@@ -158,7 +163,12 @@ func SendPack(
 		return fmt.Errorf("decode report-status: %w", err)
 	}
 
-	reportError := report.Error()
+	// The whole report is returned with its error, so that the status of
+	// each reference is known.
+	var reportError error
+	if report.Error() != nil {
+		reportError = &packp.ReportError{Report: report}
+	}
 
 	// Read any remaining progress messages.
 	if reportStatus > 0 && len(upreq.Commands) > 0 {
@@ -0,0 +1,212 @@
+package transport
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+
+	"github.com/go-git/go-git/v6/plumbing/protocol/packp"
+	"github.com/go-git/go-git/v6/plumbing/storer"
+	"github.com/go-git/go-git/v6/storage"
+)
+
+// ErrHookDeclined is reported for the commands declined by a hook.
+var ErrHookDeclined = errors.New("hook declined")
+
+// ReceiveHookRequest is the push passed to the hooks run by ReceivePack.
+type ReceiveHookRequest struct {
+	// Storer is the storer of the references updated by the push, which
+	// holds its objects once they are received.
+	Storer storage.Storer
+	// Commands are the reference updates of the push, only the applied
+	// ones for PostReceive.
+	Commands []*packp.Command
+	// PushOptions are the push options sent by the client, if any.
+	PushOptions []string
+	// Namespace is the git namespace of the references, if any.
+	Namespace string
+	// Output is relayed to the client, on the progress channel of the
+	// sideband if it requested one. It is discarded otherwise.
+	Output io.Writer
+}
+
+// HookRunner runs the hooks of the pushes served by ReceivePack, such as the
+// scripts of the hooks directory, to enforce the policies of the server.
+type HookRunner interface {
+	// PreReceive is run once the objects of the push are received, before
+	// any reference is updated. If it returns an error, all the commands
+	// are declined.
+	PreReceive(ctx context.Context, req *ReceiveHookRequest) error
+	// Update is run for each command before its reference is updated. If it
+	// returns an error, the command is declined, along with all the others
+	// if the push is atomic.
+	Update(ctx context.Context, req *ReceiveHookRequest, cmd *packp.Command) error
+	// PostReceive is run once the references are updated, for the applied
+	// commands, if any. Its error doesn't change the result of the push.
+	PostReceive(ctx context.Context, req *ReceiveHookRequest) error
+}
+
+// ScriptHookRunner is a HookRunner running the pre-receive, update and
+// post-receive scripts of a hooks directory, as git-receive-pack does. The
+// missing scripts are not run. The pre-receive and post-receive scripts read
+// "<old> <new> <ref>" lines from their standard input, and the update script
+// gets them as arguments. A script declines the push by exiting with a
+// non-zero status. Their output is relayed to the client.
+type ScriptHookRunner struct {
+	// Dir is the hooks directory. If empty, it is the hooks directory of
+	// the git directory of the storer, which must then be a
+	// storer.FilesystemStorer on the OS filesystem.
+	Dir string
+	// Env are environment variables set for the scripts, in addition to
+	// the ones of the process, GIT_DIR, GIT_NAMESPACE and the push options
+	// variables.
+	Env []string
+}
+
+var _ HookRunner = (*ScriptHookRunner)(nil)
+
+// PreReceive implements HookRunner.
+func (h *ScriptHookRunner) PreReceive(ctx context.Context, req *ReceiveHookRequest) error {
+	return h.run(ctx, req, "pre-receive", commandLines(req.Commands))
+}
+
+// Update implements HookRunner.
+func (h *ScriptHookRunner) Update(ctx context.Context, req *ReceiveHookRequest, cmd *packp.Command) error {
+	return h.run(ctx, req, "update", nil, cmd.Name.String(), cmd.Old.String(), cmd.New.String())
+}
+
+// PostReceive implements HookRunner.
+func (h *ScriptHookRunner) PostReceive(ctx context.Context, req *ReceiveHookRequest) error {
+	return h.run(ctx, req, "post-receive", commandLines(req.Commands))
+}
+
+func (h *ScriptHookRunner) run(ctx context.Context, req *ReceiveHookRequest, name string, stdin []byte, args ...string) error {
+	gitDir := gitDirectory(req.Storer)
+	dir := h.Dir
+	if dir == "" {
+		if gitDir == "" {
+			return fmt.Errorf("cannot find the hooks directory of the storer")
+		}
+
+		dir = filepath.Join(gitDir, "hooks")
+	}
+
+	path := filepath.Join(dir, name)
+	if fi, err := os.Stat(path); err != nil || fi.IsDir() || fi.Mode()&0o111 == 0 {
+		// As git, the hooks which are missing or not executable are
+		// ignored.
+		return nil
+	}
+
+	cmd := exec.CommandContext(ctx, path, args...)
+	cmd.Stdin = bytes.NewReader(stdin)
+	cmd.Stdout = req.Output
+	cmd.Stderr = req.Output
+	cmd.Env = append(os.Environ(), h.Env...)
+	if gitDir != "" {
+		cmd.Dir = gitDir
+		cmd.Env = append(cmd.Env, "GIT_DIR="+gitDir)
+	}
+
+	if req.Namespace != "" {
+		cmd.Env = append(cmd.Env, "GIT_NAMESPACE="+req.Namespace)
+	}
+
+	if req.PushOptions != nil {
+		cmd.Env = append(cmd.Env, fmt.Sprintf("GIT_PUSH_OPTION_COUNT=%d", len(req.PushOptions)))
+		for i, opt := range req.PushOptions {
+			cmd.Env = append(cmd.Env, fmt.Sprintf("GIT_PUSH_OPTION_%d=%s", i, opt))
+		}
+	}
+
+	return cmd.Run()
+}
+
+// commandLines returns the "<old> <new> <ref>" lines of the commands, as
+// read by the pre-receive and post-receive hooks.
+func commandLines(cmds []*packp.Command) []byte {
+	var buf bytes.Buffer
+	for _, cmd := range cmds {
+		fmt.Fprintf(&buf, "%s %s %s\n", cmd.Old, cmd.New, cmd.Name)
+	}
+
+	return buf.Bytes()
+}
+
+// gitDirectory returns the git directory of the storer, if it is stored on
+// the OS filesystem, or an empty string.
+func gitDirectory(st storage.Storer) string {
+	for {
+		b, ok := st.(interface{ Base() storage.Storer })
+		if !ok {
+			break
+		}
+
+		st = b.Base()
+	}
+
+	fss, ok := st.(storer.FilesystemStorer)
+	if !ok {
+		return ""
+	}
+
+	root := fss.Filesystem().Root()
+	if fi, err := os.Stat(root); err != nil || !fi.IsDir() {
+		return ""
+	}
+
+	return root
+}
+
+// receiveCommands runs the pre-receive hook and updates the references of
+// the request, running the update hook before each update, and returns the
+// status of each command.
+func receiveCommands(ctx context.Context, st storage.Storer, req *packp.UpdateRequests, hooks HookRunner, hreq *ReceiveHookRequest) []error {
+	if hooks == nil {
+		return updateReferences(st, req, nil)
+	}
+
+	hreq.Commands = req.Commands
+	if err := hooks.PreReceive(ctx, hreq); err != nil {
+		statuses := make([]error, len(req.Commands))
+		for i := range statuses {
+			statuses[i] = fmt.Errorf("pre-receive %w: %w", ErrHookDeclined, err)
+		}
+
+		return statuses
+	}
+
+	return updateReferences(st, req, func(cmd *packp.Command) error {
+		if err := hooks.Update(ctx, hreq, cmd); err != nil {
+			return fmt.Errorf("%w: %w", ErrHookDeclined, err)
+		}
+
+		return nil
+	})
+}
+
+// postReceive runs the post-receive hook for the applied commands, if any.
+func postReceive(ctx context.Context, req *packp.UpdateRequests, statuses []error, hooks HookRunner, hreq *ReceiveHookRequest) {
+	if hooks == nil {
+		return
+	}
+
+	var applied []*packp.Command
+	for i, cmd := range req.Commands {
+		if statuses[i] == nil {
+			applied = append(applied, cmd)
+		}
+	}
+
+	if len(applied) == 0 {
+		return
+	}
+
+	hreq.Commands = applied
+	_ = hooks.PostReceive(ctx, hreq)
+}
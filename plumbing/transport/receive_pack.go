@@ -3,18 +3,22 @@ package transport
 import (
 	"bufio"
 	"context"
+	"errors"
 	"fmt"
 	"io"
+	"strings"
 
 	"github.com/go-git/go-git/v6/plumbing"
+	"github.com/go-git/go-git/v6/plumbing/filemode"
 	"github.com/go-git/go-git/v6/plumbing/format/packfile"
 	"github.com/go-git/go-git/v6/plumbing/format/pktline"
+	"github.com/go-git/go-git/v6/plumbing/object"
 	"github.com/go-git/go-git/v6/plumbing/protocol"
 	"github.com/go-git/go-git/v6/plumbing/protocol/packp"
 	"github.com/go-git/go-git/v6/plumbing/protocol/packp/capability"
 	"github.com/go-git/go-git/v6/plumbing/protocol/packp/sideband"
-	"github.com/go-git/go-git/v6/plumbing/storer"
 	"github.com/go-git/go-git/v6/storage"
+	"github.com/go-git/go-git/v6/storage/namespace"
 	"github.com/go-git/go-git/v6/utils/ioutil"
 )
 
@@ -23,10 +27,18 @@ type ReceivePackOptions struct {
 	GitProtocol   string
 	AdvertiseRefs bool
 	StatelessRPC  bool
+	// Namespace, if not empty, is the git namespace whose references are
+	// served, as GIT_NAMESPACE does: the reference refs/heads/main is
+	// stored as refs/namespaces/<namespace>/refs/heads/main.
+	Namespace string
+	// Hooks, if not nil, runs the hooks of the push: the pre-receive hook
+	// once the objects are received, the update hook before each reference
+	// is updated, and the post-receive hook once they are. Use
+	// ScriptHookRunner to run the hooks scripts of the repository.
+	Hooks HookRunner
 }
 
 // ReceivePack is a server command that serves the receive-pack service.
-// TODO: support hooks
 func ReceivePack(
 	ctx context.Context,
 	st storage.Storer,
@@ -44,6 +56,11 @@ func ReceivePack(
 		opts = &ReceivePackOptions{}
 	}
 
+	st, err := namespace.NewStorage(st, opts.Namespace)
+	if err != nil {
+		return err
+	}
+
 	if opts.AdvertiseRefs || !opts.StatelessRPC {
 		switch version := ProtocolVersion(opts.GitProtocol); version {
 		case protocol.V1:
@@ -95,7 +112,6 @@ func ReceivePack(
 		pushOpts     packp.PushOptions
 	)
 
-	// TODO: Pass the options to the server-side hooks.
 	if updreq.Capabilities.Supports(capability.PushOptions) {
 		if err := pushOpts.Decode(rd); err != nil {
 			return fmt.Errorf("decoding push-options: %w", err)
@@ -122,9 +138,26 @@ func ReceivePack(
 		return fmt.Errorf("closing reader: %w", err)
 	}
 
+	hreq := &ReceiveHookRequest{
+		Storer:      st,
+		PushOptions: pushOpts.Options,
+		Namespace:   opts.Namespace,
+		Output:      io.Discard,
+	}
+
 	// Report status if the client supports it
 	if !updreq.Capabilities.Supports(capability.ReportStatus) {
-		return unpackErr
+		if unpackErr != nil {
+			return unpackErr
+		}
+
+		statuses := receiveCommands(ctx, st, updreq, opts.Hooks, hreq)
+		postReceive(ctx, updreq, statuses, opts.Hooks, hreq)
+		if err := firstError(statuses); err != nil {
+			return err
+		}
+
+		return closeWriter(w)
 	}
 
 	var (
@@ -132,41 +165,74 @@ func ReceivePack(
 		writer      io.Writer = w
 	)
 	if !caps.Supports(capability.NoProgress) {
+		var mux *sideband.Muxer
 		if caps.Supports(capability.Sideband64k) {
-			writer = sideband.NewMuxer(sideband.Sideband64k, w)
-			useSideband = true
+			mux = sideband.NewMuxer(sideband.Sideband64k, w)
 		} else if caps.Supports(capability.Sideband) {
-			writer = sideband.NewMuxer(sideband.Sideband, w)
-			useSideband = true
+			mux = sideband.NewMuxer(sideband.Sideband, w)
+		}
+
+		if mux != nil {
+			writer, useSideband = mux, true
+			hreq.Output = &progressWriter{mux}
 		}
 	}
 
 	writeCloser := ioutil.NewWriteCloser(writer, w)
 	if unpackErr != nil {
-		res := sendReportStatus(writeCloser, unpackErr, nil)
+		statuses := make([]error, len(updreq.Commands))
+		for i := range statuses {
+			statuses[i] = errUnpacker
+		}
+
+		res := sendReportStatus(writeCloser, unpackErr, updreq.Commands, statuses)
 		closeWriter(w)
 		return res
 	}
 
-	var firstErr error
-	cmdStatus := make(map[plumbing.ReferenceName]error)
-	updateReferences(st, updreq, cmdStatus, &firstErr)
-
-	if err := sendReportStatus(writeCloser, firstErr, cmdStatus); err != nil {
+	statuses := receiveCommands(ctx, st, updreq, opts.Hooks, hreq)
+	if err := sendReportStatus(writeCloser, nil, updreq.Commands, statuses); err != nil {
 		return err
 	}
 
+	postReceive(ctx, updreq, statuses, opts.Hooks, hreq)
+
 	if useSideband {
 		if err := pktline.WriteFlush(w); err != nil {
 			return fmt.Errorf("flushing sideband: %w", err)
 		}
 	}
-	if firstErr != nil {
-		return firstErr
+
+	if err := firstError(statuses); err != nil {
+		return err
 	}
+
 	return closeWriter(w)
 }
 
+func firstError(errs []error) error {
+	for _, err := range errs {
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// progressWriter writes to the progress channel of a sideband.
+type progressWriter struct {
+	m *sideband.Muxer
+}
+
+func (w *progressWriter) Write(p []byte) (int, error) {
+	return w.m.WriteChannel(sideband.ProgressMessage, p)
+}
+
+// errUnpacker is reported for the commands not applied because the packfile
+// could not be received.
+var errUnpacker = errors.New("unpacker error")
+
 func closeWriter(w io.WriteCloser) error {
 	if err := w.Close(); err != nil {
 		return fmt.Errorf("closing writer: %w", err)
@@ -174,20 +240,20 @@ func closeWriter(w io.WriteCloser) error {
 	return nil
 }
 
-func sendReportStatus(w io.WriteCloser, unpackErr error, cmdStatus map[plumbing.ReferenceName]error) error {
+func sendReportStatus(w io.WriteCloser, unpackErr error, cmds []*packp.Command, statuses []error) error {
 	rs := packp.NewReportStatus()
 	rs.UnpackStatus = "ok"
 	if unpackErr != nil {
 		rs.UnpackStatus = unpackErr.Error()
 	}
 
-	for ref, err := range cmdStatus {
+	for i, cmd := range cmds {
 		msg := "ok"
-		if err != nil {
-			msg = err.Error()
+		if statuses[i] != nil {
+			msg = statuses[i].Error()
 		}
 		status := &packp.CommandStatus{
-			ReferenceName: ref,
+			ReferenceName: cmd.Name,
 			Status:        msg,
 		}
 		rs.CommandStatuses = append(rs.CommandStatuses, status)
@@ -200,57 +266,240 @@ func sendReportStatus(w io.WriteCloser, unpackErr error, cmdStatus map[plumbing.
 	return nil
 }
 
-func setStatus(cmdStatus map[plumbing.ReferenceName]error, firstErr *error, ref plumbing.ReferenceName, err error) {
-	cmdStatus[ref] = err
-	if *firstErr == nil && err != nil {
-		*firstErr = err
+// updateReferences applies the commands of the request, returning the status
+// of each of them. The new objects of the commands must be connected, and the
+// references must point to their old hashes. The commands are then checked by
+// update, if not nil, before being applied. With the atomic capability, the
+// commands are all applied or none of them is.
+func updateReferences(st storage.Storer, req *packp.UpdateRequests, update func(*packp.Command) error) []error {
+	statuses := make([]error, len(req.Commands))
+	complete, err := referencedObjects(st)
+	if err != nil {
+		for i := range statuses {
+			statuses[i] = err
+		}
+
+		return statuses
+	}
+
+	var failed bool
+	for i, cmd := range req.Commands {
+		statuses[i] = checkCommand(st, cmd, complete)
+		if statuses[i] == nil && update != nil {
+			statuses[i] = update(cmd)
+		}
+
+		failed = failed || statuses[i] != nil
+	}
+
+	ts, transactional := st.(storage.ReferenceTransactionStorer)
+	if req.Capabilities.Supports(capability.Atomic) {
+		if !transactional {
+			failed = true
+			for i := range statuses {
+				statuses[i] = fmt.Errorf("%w: atomic updates not supported", ErrUpdateReference)
+			}
+		}
+
+		if failed {
+			for i := range statuses {
+				if statuses[i] == nil {
+					statuses[i] = ErrAtomicPushFailed
+				}
+			}
+
+			return statuses
+		}
+
+		updates := make([]storage.ReferenceUpdate, len(req.Commands))
+		for i, cmd := range req.Commands {
+			updates[i] = referenceUpdate(cmd)
+		}
+
+		err := ts.UpdateReferences(updates)
+		if err == nil {
+			return statuses
+		}
+
+		var uerr *storage.ReferenceUpdateError
+		errors.As(err, &uerr)
+		for i, cmd := range req.Commands {
+			statuses[i] = ErrAtomicPushFailed
+			if uerr == nil || uerr.Name == cmd.Name {
+				statuses[i] = fmt.Errorf("%w: %w", ErrUpdateReference, err)
+			}
+		}
+
+		return statuses
+	}
+
+	for i, cmd := range req.Commands {
+		if statuses[i] != nil {
+			continue
+		}
+
+		if transactional {
+			err = ts.UpdateReferences([]storage.ReferenceUpdate{referenceUpdate(cmd)})
+		} else {
+			err = updateReference(st, cmd)
+		}
+
+		if err != nil {
+			statuses[i] = fmt.Errorf("%w: %w", ErrUpdateReference, err)
+		}
+	}
+
+	return statuses
+}
+
+func referenceUpdate(cmd *packp.Command) storage.ReferenceUpdate {
+	return storage.ReferenceUpdate{Name: cmd.Name, OldHash: cmd.Old, NewHash: cmd.New}
+}
+
+// referencedObjects returns the objects pointed to by the references, whose
+// reachable objects are assumed to be present.
+func referencedObjects(st storage.Storer) (map[plumbing.Hash]bool, error) {
+	iter, err := st.IterReferences()
+	if err != nil {
+		return nil, err
 	}
+
+	complete := make(map[plumbing.Hash]bool)
+	err = iter.ForEach(func(r *plumbing.Reference) error {
+		if r.Type() == plumbing.HashReference {
+			complete[r.Hash()] = true
+		}
+
+		return nil
+	})
+
+	return complete, err
 }
 
-func referenceExists(s storer.ReferenceStorer, n plumbing.ReferenceName) (bool, error) {
-	_, err := s.Reference(n)
-	if err == plumbing.ErrReferenceNotFound {
-		return false, nil
+// checkCommand checks that the reference name of the command is valid, and
+// that its new object is connected.
+func checkCommand(st storage.Storer, cmd *packp.Command, complete map[plumbing.Hash]bool) error {
+	if !strings.HasPrefix(cmd.Name.String(), "refs/") || cmd.Name.Validate() != nil {
+		return fmt.Errorf("funny refname")
+	}
+
+	if cmd.Action() == packp.Delete {
+		return nil
 	}
 
-	return err == nil, err
+	return checkConnected(st, cmd.New, complete)
 }
 
-func updateReferences(st storage.Storer, req *packp.UpdateRequests, cmdStatus map[plumbing.ReferenceName]error, firstErr *error) {
-	for _, cmd := range req.Commands {
-		exists, err := referenceExists(st, cmd.Name)
-		if err != nil {
-			setStatus(cmdStatus, firstErr, cmd.Name, err)
+// checkConnected returns ErrMissingObjects if an object reachable from h is
+// missing, the objects reachable from the complete ones being present. The
+// objects found to be connected are added to complete.
+func checkConnected(st storage.Storer, h plumbing.Hash, complete map[plumbing.Hash]bool) error {
+	shallow, err := st.Shallow()
+	if err != nil {
+		return err
+	}
+
+	isShallow := make(map[plumbing.Hash]bool, len(shallow))
+	for _, h := range shallow {
+		isShallow[h] = true
+	}
+
+	seen := make(map[plumbing.Hash]bool)
+	pending := []plumbing.Hash{h}
+	for len(pending) > 0 {
+		h := pending[len(pending)-1]
+		pending = pending[:len(pending)-1]
+		if complete[h] || seen[h] {
 			continue
 		}
 
-		switch cmd.Action() {
-		case packp.Create:
-			if exists {
-				setStatus(cmdStatus, firstErr, cmd.Name, ErrUpdateReference)
-				continue
+		seen[h] = true
+		o, err := st.EncodedObject(plumbing.AnyObject, h)
+		if errors.Is(err, plumbing.ErrObjectNotFound) {
+			return ErrMissingObjects
+		}
+
+		if err != nil {
+			return err
+		}
+
+		switch o.Type() {
+		case plumbing.CommitObject:
+			c, err := object.DecodeCommit(st, o)
+			if err != nil {
+				return err
 			}
 
-			ref := plumbing.NewHashReference(cmd.Name, cmd.New)
-			err := st.SetReference(ref)
-			setStatus(cmdStatus, firstErr, cmd.Name, err)
-		case packp.Delete:
-			if !exists {
-				setStatus(cmdStatus, firstErr, cmd.Name, ErrUpdateReference)
-				continue
+			pending = append(pending, c.TreeHash)
+			if !isShallow[c.Hash] {
+				pending = append(pending, c.ParentHashes...)
+			}
+		case plumbing.TreeObject:
+			t, err := object.DecodeTree(st, o)
+			if err != nil {
+				return err
 			}
 
-			err := st.RemoveReference(cmd.Name)
-			setStatus(cmdStatus, firstErr, cmd.Name, err)
-		case packp.Update:
-			if !exists {
-				setStatus(cmdStatus, firstErr, cmd.Name, ErrUpdateReference)
-				continue
+			for _, e := range t.Entries {
+				switch {
+				case e.Mode == filemode.Submodule:
+				case e.Mode == filemode.Dir:
+					pending = append(pending, e.Hash)
+				case !complete[e.Hash] && !seen[e.Hash]:
+					// The blobs are only checked to exist.
+					if err := st.HasEncodedObject(e.Hash); err != nil {
+						if errors.Is(err, plumbing.ErrObjectNotFound) {
+							return ErrMissingObjects
+						}
+
+						return err
+					}
+
+					seen[e.Hash] = true
+				}
+			}
+		case plumbing.TagObject:
+			t, err := object.DecodeTag(st, o)
+			if err != nil {
+				return err
 			}
 
-			ref := plumbing.NewHashReference(cmd.Name, cmd.New)
-			err := st.SetReference(ref)
-			setStatus(cmdStatus, firstErr, cmd.Name, err)
+			pending = append(pending, t.Target)
 		}
 	}
+
+	for h := range seen {
+		complete[h] = true
+	}
+
+	return nil
+}
+
+// updateReference applies the command to a storer without transactions,
+// checking the old hash of the reference first.
+func updateReference(st storage.Storer, cmd *packp.Command) error {
+	ref, err := st.Reference(cmd.Name)
+	if err != nil && !errors.Is(err, plumbing.ErrReferenceNotFound) {
+		return err
+	}
+
+	actual := plumbing.ZeroHash
+	if ref != nil {
+		actual = ref.Hash()
+	}
+
+	if (ref == nil) != cmd.Old.IsZero() || actual != cmd.Old {
+		return &storage.ReferenceUpdateError{Name: cmd.Name, Expected: cmd.Old, Actual: actual}
+	}
+
+	if cmd.Action() == packp.Delete {
+		return st.RemoveReference(cmd.Name)
+	}
+
+	new := plumbing.NewHashReference(cmd.Name, cmd.New)
+	if ref == nil {
+		return st.SetReference(new)
+	}
+
+	return st.CheckAndSetReference(new, ref)
 }
@@ -1,9 +1,27 @@
 package transport
 
 import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"runtime"
 	"testing"
 
+	"github.com/go-git/go-billy/v6/util"
+	fixtures "github.com/go-git/go-git-fixtures/v5"
 	"github.com/stretchr/testify/suite"
+
+	"github.com/go-git/go-git/v6/plumbing"
+	"github.com/go-git/go-git/v6/plumbing/cache"
+	"github.com/go-git/go-git/v6/plumbing/format/packfile"
+	"github.com/go-git/go-git/v6/plumbing/protocol/packp"
+	"github.com/go-git/go-git/v6/plumbing/protocol/packp/capability"
+	"github.com/go-git/go-git/v6/plumbing/protocol/packp/sideband"
+	"github.com/go-git/go-git/v6/storage"
+	"github.com/go-git/go-git/v6/storage/filesystem"
+	"github.com/go-git/go-git/v6/storage/memory"
+	"github.com/go-git/go-git/v6/utils/ioutil"
 )
 
 type ReceivePackSuite struct {
@@ -27,3 +45,327 @@ func (s *ReceivePackSuite) TestReceivePackAdvertiseV1() {
 	buf := testAdvertise(s.T(), ReceivePack, "version=1", false)
 	s.Containsf(buf.String(), "version 1", "advertisement should contain version 1")
 }
+
+func (s *ReceivePackSuite) receivePack(st storage.Storer, atomic bool, cmds ...*packp.Command) (*packp.ReportStatus, error) {
+	return s.receivePackWithOptions(st, &ReceivePackOptions{StatelessRPC: true}, atomic, cmds...)
+}
+
+func (s *ReceivePackSuite) receivePackWithOptions(
+	st storage.Storer, opts *ReceivePackOptions, atomic bool, cmds ...*packp.Command,
+) (*packp.ReportStatus, error) {
+	req := packp.NewUpdateRequests()
+	req.Capabilities.Set(capability.ReportStatus) //nolint:errcheck
+	if atomic {
+		req.Capabilities.Set(capability.Atomic) //nolint:errcheck
+	}
+
+	req.Commands = cmds
+	rs, _, err := s.receivePackRequest(st, opts, req, nil)
+	return rs, err
+}
+
+// receivePackRequest serves the request, sent with the given push options if
+// it supports them, and returns the report status and the progress sent on
+// the sideband, if any.
+func (s *ReceivePackSuite) receivePackRequest(
+	st storage.Storer, opts *ReceivePackOptions, req *packp.UpdateRequests, pushOpts []string,
+) (*packp.ReportStatus, string, error) {
+	var in bytes.Buffer
+	s.Require().NoError(req.Encode(&in))
+	if req.Capabilities.Supports(capability.PushOptions) {
+		s.Require().NoError((&packp.PushOptions{Options: pushOpts}).Encode(&in))
+	}
+
+	for _, cmd := range req.Commands {
+		if cmd.Action() != packp.Delete {
+			_, err := packfile.NewEncoder(&in, memory.NewStorage(), false).Encode(nil, 10)
+			s.Require().NoError(err)
+			break
+		}
+	}
+
+	var out bytes.Buffer
+	err := ReceivePack(context.TODO(), st, io.NopCloser(&in), ioutil.WriteNopCloser(&out), opts)
+
+	var rd io.Reader = &out
+	var progress bytes.Buffer
+	if req.Capabilities.Supports(capability.Sideband64k) {
+		d := sideband.NewDemuxer(sideband.Sideband64k, &out)
+		d.Progress = &progress
+		rd = d
+	}
+
+	rs := packp.NewReportStatus()
+	s.Require().NoError(rs.Decode(rd))
+	return rs, progress.String(), err
+}
+
+func (s *ReceivePackSuite) statuses(rs *packp.ReportStatus) []string {
+	var statuses []string
+	for _, cs := range rs.CommandStatuses {
+		statuses = append(statuses, fmt.Sprintf("%s %s", cs.ReferenceName, cs.Status))
+	}
+
+	return statuses
+}
+
+func (s *ReceivePackSuite) TestReceivePackUpdateReferences() {
+	dot := fixtures.Basic().One().DotGit(fixtures.WithTargetDir(s.T().TempDir))
+	st := filesystem.NewStorage(dot, cache.NewObjectLRUDefault())
+
+	master := plumbing.NewHash("6ecf0ef2c2dffb796033e5a02219af86ec6584e5")
+	branch := plumbing.NewHash("e8d3ffab552895c19b9fcf7aa264d277cde33881")
+	missing := plumbing.NewHash("1111111111111111111111111111111111111111")
+	rs, err := s.receivePack(st, false,
+		&packp.Command{Name: "refs/heads/new", New: branch},
+		&packp.Command{Name: "refs/heads/master", Old: branch, New: master},
+		&packp.Command{Name: "refs/heads/missing", New: missing},
+		&packp.Command{Name: "refs/remotes/origin/branch", Old: branch},
+	)
+	s.ErrorIs(err, ErrUpdateReference)
+	s.Equal("ok", rs.UnpackStatus)
+	s.Equal([]string{
+		"refs/heads/new ok",
+		"refs/heads/master failed to update ref: cannot update reference refs/heads/master: " +
+			"expected e8d3ffab552895c19b9fcf7aa264d277cde33881, found 6ecf0ef2c2dffb796033e5a02219af86ec6584e5",
+		"refs/heads/missing missing necessary objects",
+		"refs/remotes/origin/branch ok",
+	}, s.statuses(rs))
+
+	ref, err := st.Reference("refs/heads/new")
+	s.Require().NoError(err)
+	s.Equal(branch, ref.Hash())
+
+	_, err = st.Reference("refs/heads/missing")
+	s.ErrorIs(err, plumbing.ErrReferenceNotFound)
+	_, err = st.Reference("refs/remotes/origin/branch")
+	s.ErrorIs(err, plumbing.ErrReferenceNotFound)
+}
+
+func (s *ReceivePackSuite) TestReceivePackAtomic() {
+	dot := fixtures.Basic().One().DotGit(fixtures.WithTargetDir(s.T().TempDir))
+	st := filesystem.NewStorage(dot, cache.NewObjectLRUDefault())
+
+	master := plumbing.NewHash("6ecf0ef2c2dffb796033e5a02219af86ec6584e5")
+	branch := plumbing.NewHash("e8d3ffab552895c19b9fcf7aa264d277cde33881")
+	rs, err := s.receivePack(st, true,
+		&packp.Command{Name: "refs/heads/new", New: branch},
+		&packp.Command{Name: "refs/heads/master", Old: branch, New: master},
+	)
+	s.Error(err)
+	s.Equal([]string{
+		"refs/heads/new atomic push failed",
+		"refs/heads/master failed to update ref: cannot update reference refs/heads/master: " +
+			"expected e8d3ffab552895c19b9fcf7aa264d277cde33881, found 6ecf0ef2c2dffb796033e5a02219af86ec6584e5",
+	}, s.statuses(rs))
+
+	_, err = st.Reference("refs/heads/new")
+	s.ErrorIs(err, plumbing.ErrReferenceNotFound)
+
+	rs, err = s.receivePack(st, true,
+		&packp.Command{Name: "refs/heads/new", New: branch},
+		&packp.Command{Name: "refs/heads/master", Old: master, New: branch},
+		&packp.Command{Name: "refs/remotes/origin/branch", Old: branch},
+	)
+	s.Require().NoError(err)
+	s.NoError(rs.Error())
+
+	ref, err := st.Reference("refs/heads/master")
+	s.Require().NoError(err)
+	s.Equal(branch, ref.Hash())
+	_, err = st.Reference("refs/remotes/origin/branch")
+	s.ErrorIs(err, plumbing.ErrReferenceNotFound)
+}
+
+func (s *ReceivePackSuite) TestReceivePackAdvertiseAtomic() {
+	buf := testAdvertise(s.T(), ReceivePack, "", false)
+	s.Contains(buf.String(), "atomic")
+	s.Contains(buf.String(), "delete-refs")
+}
+
+func (s *ReceivePackSuite) TestReceivePackNamespace() {
+	dot := fixtures.Basic().One().DotGit(fixtures.WithTargetDir(s.T().TempDir))
+	st := filesystem.NewStorage(dot, cache.NewObjectLRUDefault())
+
+	master := plumbing.NewHash("6ecf0ef2c2dffb796033e5a02219af86ec6584e5")
+	branch := plumbing.NewHash("e8d3ffab552895c19b9fcf7aa264d277cde33881")
+	s.Require().NoError(st.SetReference(plumbing.NewHashReference("refs/namespaces/foo/refs/heads/main", branch)))
+
+	opts := &ReceivePackOptions{AdvertiseRefs: true, Namespace: "foo"}
+	adv := testServe(s.T(), st, ReceivePack, io.NopCloser(bytes.NewBuffer(nil)), opts)
+	s.Contains(adv.String(), branch.String()+" refs/heads/main")
+	s.NotContains(adv.String(), "refs/heads/master")
+
+	rs, err := s.receivePackWithOptions(st, &ReceivePackOptions{StatelessRPC: true, Namespace: "foo"}, false,
+		&packp.Command{Name: "refs/heads/main", Old: branch, New: master},
+		&packp.Command{Name: "refs/heads/new", New: branch},
+		// The branch exists out of the namespace only.
+		&packp.Command{Name: "refs/heads/master", Old: master},
+	)
+	s.ErrorIs(err, ErrUpdateReference)
+	s.Equal([]string{
+		"refs/heads/main ok",
+		"refs/heads/new ok",
+		"refs/heads/master failed to update ref: cannot update reference refs/heads/master: " +
+			"expected 6ecf0ef2c2dffb796033e5a02219af86ec6584e5, found no reference",
+	}, s.statuses(rs))
+
+	ref, err := st.Reference("refs/namespaces/foo/refs/heads/main")
+	s.Require().NoError(err)
+	s.Equal(master, ref.Hash())
+	ref, err = st.Reference("refs/namespaces/foo/refs/heads/new")
+	s.Require().NoError(err)
+	s.Equal(branch, ref.Hash())
+	ref, err = st.Reference("refs/heads/master")
+	s.Require().NoError(err)
+	s.Equal(master, ref.Hash())
+	_, err = st.Reference("refs/heads/new")
+	s.ErrorIs(err, plumbing.ErrReferenceNotFound)
+}
+
+// testHookRunner is a HookRunner recording the commands of the hooks, and
+// declining the push in pre-receive or the update of a reference.
+type testHookRunner struct {
+	declinePreReceive bool
+	declineUpdate     plumbing.ReferenceName
+
+	preReceive  []string
+	update      []string
+	postReceive []string
+}
+
+func (h *testHookRunner) PreReceive(_ context.Context, req *ReceiveHookRequest) error {
+	h.preReceive = append(h.preReceive, string(commandLines(req.Commands)))
+	fmt.Fprintln(req.Output, "pre-receive")
+	if h.declinePreReceive {
+		return fmt.Errorf("not today")
+	}
+
+	return nil
+}
+
+func (h *testHookRunner) Update(_ context.Context, _ *ReceiveHookRequest, cmd *packp.Command) error {
+	h.update = append(h.update, cmd.Name.String())
+	if cmd.Name == h.declineUpdate {
+		return fmt.Errorf("protected branch")
+	}
+
+	return nil
+}
+
+func (h *testHookRunner) PostReceive(_ context.Context, req *ReceiveHookRequest) error {
+	h.postReceive = append(h.postReceive, string(commandLines(req.Commands)))
+	return fmt.Errorf("ignored")
+}
+
+func (s *ReceivePackSuite) TestReceivePackHooks() {
+	dot := fixtures.Basic().One().DotGit(fixtures.WithTargetDir(s.T().TempDir))
+	st := filesystem.NewStorage(dot, cache.NewObjectLRUDefault())
+
+	master := plumbing.NewHash("6ecf0ef2c2dffb796033e5a02219af86ec6584e5")
+	branch := plumbing.NewHash("e8d3ffab552895c19b9fcf7aa264d277cde33881")
+	cmds := []*packp.Command{
+		{Name: "refs/heads/new", New: branch},
+		{Name: "refs/heads/master", Old: master, New: branch},
+	}
+	lines := fmt.Sprintf("%s %s refs/heads/new\n%s %s refs/heads/master\n", plumbing.ZeroHash, branch, master, branch)
+
+	hooks := &testHookRunner{declinePreReceive: true}
+	rs, err := s.receivePackWithOptions(st, &ReceivePackOptions{StatelessRPC: true, Hooks: hooks}, false, cmds...)
+	s.ErrorIs(err, ErrHookDeclined)
+	s.Equal([]string{
+		"refs/heads/new pre-receive hook declined: not today",
+		"refs/heads/master pre-receive hook declined: not today",
+	}, s.statuses(rs))
+	s.Equal([]string{lines}, hooks.preReceive)
+	s.Nil(hooks.update)
+	s.Nil(hooks.postReceive)
+	_, err = st.Reference("refs/heads/new")
+	s.ErrorIs(err, plumbing.ErrReferenceNotFound)
+
+	hooks = &testHookRunner{declineUpdate: "refs/heads/master"}
+	rs, err = s.receivePackWithOptions(st, &ReceivePackOptions{StatelessRPC: true, Hooks: hooks}, false, cmds...)
+	s.ErrorIs(err, ErrHookDeclined)
+	s.Equal([]string{
+		"refs/heads/new ok",
+		"refs/heads/master hook declined: protected branch",
+	}, s.statuses(rs))
+	s.Equal([]string{"refs/heads/new", "refs/heads/master"}, hooks.update)
+	s.Equal([]string{fmt.Sprintf("%s %s refs/heads/new\n", plumbing.ZeroHash, branch)}, hooks.postReceive)
+
+	ref, err := st.Reference("refs/heads/master")
+	s.Require().NoError(err)
+	s.Equal(master, ref.Hash())
+
+	// The atomic pushes are declined altogether.
+	hooks = &testHookRunner{declineUpdate: "refs/heads/master"}
+	rs, err = s.receivePackWithOptions(st, &ReceivePackOptions{StatelessRPC: true, Hooks: hooks}, true,
+		&packp.Command{Name: "refs/heads/other", New: branch},
+		&packp.Command{Name: "refs/heads/master", Old: master, New: branch},
+	)
+	s.Error(err)
+	s.Equal([]string{
+		"refs/heads/other atomic push failed",
+		"refs/heads/master hook declined: protected branch",
+	}, s.statuses(rs))
+	s.Nil(hooks.postReceive)
+
+	// The output of the hooks is sent on the sideband.
+	req := packp.NewUpdateRequests()
+	req.Capabilities.Set(capability.ReportStatus) //nolint:errcheck
+	req.Capabilities.Set(capability.Sideband64k)  //nolint:errcheck
+	req.Commands = []*packp.Command{{Name: "refs/heads/other", New: branch}}
+	hooks = &testHookRunner{}
+	rs, progress, err := s.receivePackRequest(st, &ReceivePackOptions{StatelessRPC: true, Hooks: hooks}, req, nil)
+	s.Require().NoError(err)
+	s.NoError(rs.Error())
+	s.Equal("pre-receive\n", progress)
+	s.Len(hooks.postReceive, 1)
+}
+
+func (s *ReceivePackSuite) TestReceivePackScriptHooks() {
+	if runtime.GOOS == "windows" {
+		s.T().Skip("the hooks are shell scripts")
+	}
+
+	dot := fixtures.Basic().One().DotGit(fixtures.WithTargetDir(s.T().TempDir))
+	st := filesystem.NewStorage(dot, cache.NewObjectLRUDefault())
+
+	// The hooks append their input to a log file of the git directory.
+	hooks := map[string]string{
+		"pre-receive":  "echo pre-receive $GIT_PUSH_OPTION_COUNT $GIT_PUSH_OPTION_0 >> log\ncat >> log\necho checking\n",
+		"update":       "echo update \"$@\" >> log\ntest \"$1\" != refs/heads/master || { echo protected >&2; exit 1; }\n",
+		"post-receive": "echo post-receive >> log\ncat >> log\n",
+	}
+	for name, script := range hooks {
+		s.Require().NoError(util.WriteFile(dot, dot.Join("hooks", name), []byte("#!/bin/sh\n"+script), 0o755))
+	}
+
+	master := plumbing.NewHash("6ecf0ef2c2dffb796033e5a02219af86ec6584e5")
+	branch := plumbing.NewHash("e8d3ffab552895c19b9fcf7aa264d277cde33881")
+	req := packp.NewUpdateRequests()
+	req.Capabilities.Set(capability.ReportStatus) //nolint:errcheck
+	req.Capabilities.Set(capability.Sideband64k)  //nolint:errcheck
+	req.Capabilities.Set(capability.PushOptions)  //nolint:errcheck
+	req.Commands = []*packp.Command{
+		{Name: "refs/heads/new", New: branch},
+		{Name: "refs/heads/master", Old: master, New: branch},
+	}
+
+	rs, progress, err := s.receivePackRequest(st, &ReceivePackOptions{StatelessRPC: true, Hooks: &ScriptHookRunner{}}, req, []string{"ci.skip"})
+	s.ErrorIs(err, ErrHookDeclined)
+	s.Equal([]string{
+		"refs/heads/new ok",
+		"refs/heads/master hook declined: exit status 1",
+	}, s.statuses(rs))
+	s.Equal("checking\nprotected\n", progress)
+
+	log, err := util.ReadFile(dot, "log")
+	s.Require().NoError(err)
+	s.Equal(fmt.Sprintf("pre-receive 1 ci.skip\n"+
+		"%[1]s %[2]s refs/heads/new\n%[3]s %[2]s refs/heads/master\n"+
+		"update refs/heads/new %[1]s %[2]s\n"+
+		"update refs/heads/master %[3]s %[2]s\n"+
+		"post-receive\n"+
+		"%[1]s %[2]s refs/heads/new\n", plumbing.ZeroHash, branch, master), string(log))
+}
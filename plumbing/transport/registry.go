@@ -1,38 +1,51 @@
 package transport
 
 import (
+	"errors"
 	"fmt"
+	"slices"
+	"strings"
 	"sync"
 )
 
+// ErrUnsupportedScheme is returned by Get for the schemes no transport is
+// registered for.
+var ErrUnsupportedScheme = errors.New("unsupported scheme")
+
 // registry are the protocols supported by default.
 var (
 	registry = map[string]Transport{}
 	mtx      sync.RWMutex
 )
 
-// Register adds or modifies an existing protocol.
+// Register adds or modifies an existing protocol: the transport is used for
+// the endpoints of the given scheme, such as "https" or a custom one, case
+// insensitively. The built-in transports are registered by the init
+// functions of their packages, such as the http one for "http" and "https",
+// which run before the ones of the packages importing them: they can be
+// overridden from there.
 // Equivalent to client.InstallProtocol in go-git before V6.
 func Register(protocol string, c Transport) {
 	mtx.Lock()
-	registry[protocol] = c
+	registry[strings.ToLower(protocol)] = c
 	mtx.Unlock()
 }
 
 // Unregister removes a protocol from the list of supported protocols.
 func Unregister(scheme string) {
 	mtx.Lock()
-	delete(registry, scheme)
+	delete(registry, strings.ToLower(scheme))
 	mtx.Unlock()
 }
 
-// Get returns the appropriate client for the given protocol.
+// Get returns the appropriate client for the given protocol, or
+// ErrUnsupportedScheme if none is registered.
 func Get(p string) (Transport, error) {
 	mtx.RLock()
 	defer mtx.RUnlock()
-	f, ok := registry[p]
+	f, ok := registry[strings.ToLower(p)]
 	if !ok {
-		return nil, fmt.Errorf("unsupported scheme %q", p)
+		return nil, fmt.Errorf("%w %q", ErrUnsupportedScheme, p)
 	}
 
 	if f == nil {
@@ -40,3 +53,16 @@ func Get(p string) (Transport, error) {
 	}
 	return f, nil
 }
+
+// Schemes returns the schemes a transport is registered for, sorted.
+func Schemes() []string {
+	mtx.RLock()
+	defer mtx.RUnlock()
+	schemes := make([]string, 0, len(registry))
+	for s := range registry {
+		schemes = append(schemes, s)
+	}
+
+	slices.Sort(schemes)
+	return schemes
+}
@@ -33,7 +33,7 @@ func (s *RegistrySuite) TestNewClientUnknown() {
 	s.NoError(err)
 
 	_, err = Get(e.Scheme)
-	s.Error(err)
+	s.ErrorIs(err, ErrUnsupportedScheme)
 }
 
 func (s *RegistrySuite) TestNewClientNil() {
@@ -60,6 +60,22 @@ func (s *RegistrySuite) TestInstallProtocolNilValue() {
 	s.Error(err)
 }
 
+func (s *RegistrySuite) TestRegisterCaseInsensitive() {
+	Register("MyGit", &dummyClient{})
+	defer Unregister("mygit")
+
+	e, err := NewEndpoint("mygit://example.com/repo.git")
+	s.NoError(err)
+
+	p, err := Get(e.Scheme)
+	s.NoError(err)
+	s.NotNil(p)
+	s.Contains(Schemes(), "mygit")
+
+	Unregister("MYGIT")
+	s.NotContains(Schemes(), "mygit")
+}
+
 type dummyClient struct {
 	*http.Client
 }
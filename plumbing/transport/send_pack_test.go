@@ -9,6 +9,7 @@ import (
 	"testing"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 
 	"github.com/go-git/go-git/v6/plumbing"
 	"github.com/go-git/go-git/v6/plumbing/protocol"
@@ -163,6 +164,41 @@ func TestSendPackWithReportStatusError(t *testing.T) {
 	assert.True(t, writer.closed)
 }
 
+// TestSendPackWithReportStatusRejectedRef tests that the report of a push
+// with a rejected reference is returned with its error.
+func TestSendPackWithReportStatusRejectedRef(t *testing.T) {
+	caps := capability.NewList()
+	caps.Add(capability.ReportStatus) //nolint:errcheck
+	conn := &mockConnection{caps: caps}
+
+	reportStatusResponse := strings.Join([]string{
+		"000eunpack ok\n",
+		"0019ok refs/heads/master\n",
+		"0031ng refs/heads/main pre-receive hook declined\n",
+		"0000",
+	}, "")
+	reader := newMockRWC([]byte(reportStatusResponse))
+	writer := newMockRWC(nil)
+
+	var buf bytes.Buffer
+	req := &PushRequest{
+		Commands: []*packp.Command{
+			{Name: "refs/heads/master", New: plumbing.NewHash("0123456789012345678901234567890123456789")},
+			{Name: "refs/heads/main", New: plumbing.NewHash("0123456789012345678901234567890123456789")},
+		},
+		Packfile: io.NopCloser(&buf),
+	}
+
+	err := SendPack(context.Background(), memory.NewStorage(), conn, writer, reader, req)
+	var rerr *packp.ReportError
+	require.ErrorAs(t, err, &rerr)
+	assert.ErrorAs(t, err, &packp.CommandStatusErr{})
+	assert.Equal(t, "ok", rerr.Report.UnpackStatus)
+	require.Len(t, rerr.Report.CommandStatuses, 2)
+	assert.Equal(t, "ok", rerr.Report.CommandStatuses[0].Status)
+	assert.Equal(t, "pre-receive hook declined", rerr.Report.CommandStatuses[1].Status)
+}
+
 // TestSendPackWithoutReportStatus tests the SendPack function without ReportStatus capability
 func TestSendPackWithoutReportStatus(t *testing.T) {
 	// Create a mock connection without ReportStatus capability
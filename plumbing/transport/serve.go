@@ -7,6 +7,8 @@ import (
 	"io"
 
 	"github.com/go-git/go-git/v6/plumbing"
+	format "github.com/go-git/go-git/v6/plumbing/format/config"
+	"github.com/go-git/go-git/v6/plumbing/format/packfile"
 	"github.com/go-git/go-git/v6/plumbing/object"
 	"github.com/go-git/go-git/v6/plumbing/protocol/packp"
 	"github.com/go-git/go-git/v6/plumbing/protocol/packp/capability"
@@ -14,7 +16,15 @@ import (
 	"github.com/go-git/go-git/v6/storage"
 )
 
-var ErrUpdateReference = errors.New("failed to update ref")
+var (
+	ErrUpdateReference = errors.New("failed to update ref")
+	// ErrMissingObjects is reported by ReceivePack for the commands whose new
+	// objects are not connected, an object reachable from them missing.
+	ErrMissingObjects = errors.New("missing necessary objects")
+	// ErrAtomicPushFailed is reported by ReceivePack for the commands of an
+	// atomic push not applied because another command failed.
+	ErrAtomicPushFailed = errors.New("atomic push failed")
+)
 
 // AdvertiseReferences is a server command that implements the reference
 // discovery phase of the Git transfer protocol.
@@ -39,16 +49,18 @@ func AdvertiseReferences(
 	ar.Capabilities.Set(capability.OFSDelta)                         //nolint:errcheck
 	ar.Capabilities.Set(capability.Sideband64k)                      //nolint:errcheck
 	if forPush {
-		// TODO: support thin-pack
-		ar.Capabilities.Set(capability.NoThin) //nolint:errcheck
-		// TODO: support atomic
+		if !packfile.AcceptsThinPacks(st) {
+			ar.Capabilities.Set(capability.NoThin) //nolint:errcheck
+		}
+		if _, ok := st.(storage.ReferenceTransactionStorer); ok {
+			ar.Capabilities.Set(capability.Atomic) //nolint:errcheck
+		}
 		ar.Capabilities.Set(capability.DeleteRefs)   //nolint:errcheck
 		ar.Capabilities.Set(capability.ReportStatus) //nolint:errcheck
 		ar.Capabilities.Set(capability.PushOptions)  //nolint:errcheck
 		ar.Capabilities.Set(capability.Quiet)        //nolint:errcheck
 	} else {
 		// TODO: support include-tag
-		// TODO: support deepen
 		// TODO: support deepen-since
 		ar.Capabilities.Set(capability.MultiACK)         //nolint:errcheck
 		ar.Capabilities.Set(capability.MultiACKDetailed) //nolint:errcheck
@@ -56,6 +68,28 @@ func AdvertiseReferences(
 		ar.Capabilities.Set(capability.NoProgress)       //nolint:errcheck
 		ar.Capabilities.Set(capability.SymRef)           //nolint:errcheck
 		ar.Capabilities.Set(capability.Shallow)          //nolint:errcheck
+		ar.Capabilities.Set(capability.DeepenRelative)   //nolint:errcheck
+
+		// The objects are requested by their hash as the uploadpack config
+		// of the repository allows it.
+		cfg, err := st.Config()
+		if err != nil {
+			return err
+		}
+
+		if cfg.UploadPack.AllowTipSHA1InWant || cfg.UploadPack.AllowAnySHA1InWant {
+			ar.Capabilities.Set(capability.AllowTipSHA1InWant) //nolint:errcheck
+		}
+
+		if cfg.UploadPack.AllowReachableSHA1InWant || cfg.UploadPack.AllowAnySHA1InWant {
+			ar.Capabilities.Set(capability.AllowReachableSHA1InWant) //nolint:errcheck
+		}
+	}
+
+	// The object format is advertised for the repositories whose objects
+	// are not SHA1 ones, the clients assuming SHA1 otherwise.
+	if f := storer.ObjectFormat(st); f != format.SHA1 {
+		ar.Capabilities.Set(capability.ObjectFormat, f.String()) //nolint:errcheck
 	}
 
 	// Set references
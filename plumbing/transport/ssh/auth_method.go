@@ -7,6 +7,7 @@ import (
 	"os"
 	"os/user"
 	"path/filepath"
+	"strings"
 
 	"golang.org/x/crypto/ssh"
 
@@ -236,10 +237,19 @@ func (a *PublicKeysCallback) ClientConfig() (*ssh.ClientConfig, error) {
 //
 //	/home/foo/custom_known_hosts_file:/etc/custom_known/hosts_file
 //
-// If SSH_KNOWN_HOSTS is not set the following file locations will be used:
+// If SSH_KNOWN_HOSTS is not set, the files of the UserKnownHostsFile and
+// GlobalKnownHostsFile options of DefaultSSHConfig will be used, by default:
 //
 //	~/.ssh/known_hosts
+//	~/.ssh/known_hosts2
 //	/etc/ssh/ssh_known_hosts
+//	/etc/ssh/ssh_known_hosts2
+//
+// None of these default files need to exist, the hosts are then all unknown.
+//
+// Hashed host names, and the @cert-authority and @revoked markers are
+// supported. When the host is unknown, the callback returns a
+// *knownhosts.UnknownHostError with the key offered by the host.
 func NewKnownHostsCallback(files ...string) (ssh.HostKeyCallback, error) {
 	db, err := newKnownHostsDb(files...)
 	if db == nil {
@@ -250,7 +260,8 @@ func NewKnownHostsCallback(files ...string) (ssh.HostKeyCallback, error) {
 
 func newKnownHostsDb(files ...string) (*knownhosts.HostKeyDB, error) {
 	var err error
-	if len(files) == 0 {
+	defaults := len(files) == 0
+	if defaults {
 		if files, err = getDefaultKnownHostsFiles(); err != nil {
 			return nil, err
 		}
@@ -262,6 +273,10 @@ func newKnownHostsDb(files ...string) (*knownhosts.HostKeyDB, error) {
 	}
 	trace.SSH.Printf("ssh: filtered known_hosts sources %s", files)
 
+	if len(files) == 0 && !defaults {
+		return nil, fmt.Errorf("unable to find any valid known_hosts file, set SSH_KNOWN_HOSTS env variable")
+	}
+
 	return knownhosts.NewDB(files...)
 }
 
@@ -277,10 +292,31 @@ func getDefaultKnownHostsFiles() ([]string, error) {
 		return nil, err
 	}
 
-	return []string{
-		filepath.Join(homeDirPath, "/.ssh/known_hosts"),
-		"/etc/ssh/ssh_known_hosts",
-	}, nil
+	userFiles := []string{"~/.ssh/known_hosts"}
+	globalFiles := []string{"/etc/ssh/ssh_known_hosts"}
+	if DefaultSSHConfig != nil {
+		if v := DefaultSSHConfig.Get("*", "UserKnownHostsFile"); v != "" {
+			userFiles = strings.Fields(v)
+		}
+
+		if v := DefaultSSHConfig.Get("*", "GlobalKnownHostsFile"); v != "" {
+			globalFiles = strings.Fields(v)
+		}
+	}
+
+	for _, file := range append(userFiles, globalFiles...) {
+		if strings.EqualFold(file, "none") {
+			continue
+		}
+
+		if rest, ok := strings.CutPrefix(file, "~/"); ok {
+			file = filepath.Join(homeDirPath, rest)
+		}
+
+		files = append(files, file)
+	}
+
+	return files, nil
 }
 
 func filterKnownHostsFiles(files ...string) ([]string, error) {
@@ -297,10 +333,6 @@ func filterKnownHostsFiles(files ...string) ([]string, error) {
 		}
 	}
 
-	if len(out) == 0 {
-		return nil, fmt.Errorf("unable to find any valid known_hosts file, set SSH_KNOWN_HOSTS env variable")
-	}
-
 	return out, nil
 }
 
@@ -315,25 +347,29 @@ type HostKeyCallbackHelper struct {
 
 // SetHostKeyCallback sets the field HostKeyCallback in the given cfg. If
 // HostKeyCallback is empty a default callback is created using
-// NewKnownHostsCallback.
+// NewKnownHostsCallback, reading the known_hosts files again on each call.
+// It is safe to call it concurrently.
 func (m *HostKeyCallbackHelper) SetHostKeyCallback(cfg *ssh.ClientConfig) (*ssh.ClientConfig, error) {
-	if m.HostKeyCallback == nil {
+	callback := m.HostKeyCallback
+	if callback == nil {
 		db, err := newKnownHostsDb()
 		if err != nil {
 			return cfg, err
 		}
-		m.HostKeyCallback = db.HostKeyCallback()
+		callback = db.HostKeyCallback()
 	}
 
-	cfg.HostKeyCallback = m.traceHostKeyCallback
+	cfg.HostKeyCallback = traceHostKeyCallback(callback)
 	return cfg, nil
 }
 
-func (m *HostKeyCallbackHelper) traceHostKeyCallback(hostname string, remote net.Addr, key ssh.PublicKey) error {
-	trace.SSH.Printf(
-		`ssh: hostkey callback hostname=%s remote=%s pubkey="%s %s"`,
-		hostname, remote, key.Type(), ssh.FingerprintSHA256(key))
-	return m.HostKeyCallback(hostname, remote, key)
+func traceHostKeyCallback(callback ssh.HostKeyCallback) ssh.HostKeyCallback {
+	return func(hostname string, remote net.Addr, key ssh.PublicKey) error {
+		trace.SSH.Printf(
+			`ssh: hostkey callback hostname=%s remote=%s pubkey="%s %s"`,
+			hostname, remote, key.Type(), ssh.FingerprintSHA256(key))
+		return callback(hostname, remote, key)
+	}
 }
 
 func tracePublicKeysCallback(getSigners func() ([]ssh.Signer, error)) ssh.AuthMethod {
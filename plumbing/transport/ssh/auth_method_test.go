@@ -4,6 +4,7 @@ import (
 	"bufio"
 	"fmt"
 	"os"
+	"path/filepath"
 	"runtime"
 	"slices"
 	"strings"
@@ -11,6 +12,7 @@ import (
 
 	"github.com/go-git/go-billy/v6/osfs"
 	"github.com/go-git/go-billy/v6/util"
+	"github.com/kevinburke/ssh_config"
 	"github.com/stretchr/testify/suite"
 	"golang.org/x/crypto/ssh"
 	"golang.org/x/crypto/ssh/testdata"
@@ -319,3 +321,40 @@ func (s *SuiteCommon) TestNewKnownHostsDbWithCert() {
 		}
 	}
 }
+
+func (s *SuiteCommon) TestDefaultKnownHostsFiles() {
+	defer func() {
+		DefaultSSHConfig = ssh_config.DefaultUserSettings
+	}()
+
+	home := s.T().TempDir()
+	s.T().Setenv("HOME", home)
+	s.T().Setenv("SSH_KNOWN_HOSTS", "")
+
+	DefaultSSHConfig = &mockSSHConfig{map[string]map[string]string{
+		"*": {
+			"UserKnownHostsFile":   "~/.ssh/known_hosts ~/custom_known_hosts",
+			"GlobalKnownHostsFile": "none",
+		},
+	}}
+
+	files, err := getDefaultKnownHostsFiles()
+	s.NoError(err)
+	s.Equal([]string{
+		filepath.Join(home, ".ssh", "known_hosts"),
+		filepath.Join(home, "custom_known_hosts"),
+	}, files)
+
+	DefaultSSHConfig = nil
+	files, err = getDefaultKnownHostsFiles()
+	s.NoError(err)
+	s.Equal([]string{
+		filepath.Join(home, ".ssh", "known_hosts"),
+		"/etc/ssh/ssh_known_hosts",
+	}, files)
+
+	s.T().Setenv("SSH_KNOWN_HOSTS", "/foo/known_hosts")
+	files, err = getDefaultKnownHostsFiles()
+	s.NoError(err)
+	s.Equal([]string{"/foo/known_hosts"}, files)
+}
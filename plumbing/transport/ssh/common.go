@@ -9,12 +9,14 @@ import (
 	"reflect"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/kevinburke/ssh_config"
 	"golang.org/x/crypto/ssh"
 	"golang.org/x/net/proxy"
 
 	"github.com/go-git/go-git/v6/plumbing/transport"
+	"github.com/go-git/go-git/v6/plumbing/transport/ssh/knownhosts"
 	"github.com/go-git/go-git/v6/utils/trace"
 )
 
@@ -38,6 +40,31 @@ func NewTransport(config *ssh.ClientConfig) transport.Transport {
 	return transport.NewPackTransport(&runner{config: config})
 }
 
+// TransportOptions holds user configurable options for the SSH client.
+type TransportOptions struct {
+	// ClientConfig, if not nil, overrides the ssh.ClientConfig of the auth
+	// methods, as the one given to NewTransport.
+	ClientConfig *ssh.ClientConfig
+
+	// Pool, if not nil, keeps the connections open to reuse them across the
+	// sessions, instead of connecting to the server for each of them. It may
+	// be shared by several transports.
+	Pool *ConnectionPool
+
+	// Timeouts are the timeouts of the endpoints which don't set their own.
+	// The Dial timeout overrides the Timeout of the ssh.ClientConfig.
+	Timeouts transport.TimeoutOptions
+}
+
+// NewTransportWithOptions creates a new SSH client with the given options.
+func NewTransportWithOptions(opts *TransportOptions) transport.Transport {
+	if opts == nil {
+		opts = &TransportOptions{}
+	}
+
+	return transport.NewPackTransportWithTimeouts(&runner{config: opts.ClientConfig, pool: opts.Pool}, opts.Timeouts)
+}
+
 // DefaultAuthBuilder is the function used to create a default AuthMethod, when
 // the user doesn't provide any.
 var DefaultAuthBuilder = func(user string) (AuthMethod, error) {
@@ -49,10 +76,11 @@ const DefaultPort = 22
 
 type runner struct {
 	config *ssh.ClientConfig
+	pool   *ConnectionPool
 }
 
 func (r *runner) Command(ctx context.Context, cmd string, ep *transport.Endpoint, auth transport.AuthMethod, params ...string) (transport.Command, error) {
-	c := &command{command: cmd, endpoint: ep, config: r.config}
+	c := &command{command: cmd, endpoint: ep, config: r.config, pool: r.pool}
 	if auth != nil {
 		if err := c.setAuth(auth); err != nil {
 			return nil, err
@@ -79,6 +107,9 @@ type command struct {
 	client    *ssh.Client
 	auth      AuthMethod
 	config    *ssh.ClientConfig
+	pool      *ConnectionPool
+	// pooled is the connection of the pool running the command, if any.
+	pooled *pooledClient
 }
 
 func (c *command) setAuth(auth transport.AuthMethod) error {
@@ -107,6 +138,11 @@ func (c *command) Close() error {
 	// XXX: If did read the full packfile, then the session might be already
 	//     closed.
 	_ = c.Session.Close()
+	if c.pooled != nil {
+		c.pool.release(c.pooled, false)
+		return nil
+	}
+
 	err := c.client.Close()
 	if errors.Is(err, net.ErrClosed) {
 		return nil
@@ -124,7 +160,8 @@ func (c *command) connect(ctx context.Context) error {
 		return transport.ErrAlreadyConnected
 	}
 
-	if c.auth == nil {
+	defaultAuth := c.auth == nil
+	if defaultAuth {
 		if err := c.setAuthFromEndpoint(); err != nil {
 			return err
 		}
@@ -148,19 +185,28 @@ func (c *command) connect(ctx context.Context) error {
 		// Set the HostKeyAlgorithms based on HostKeyCallback.
 		// For background see https://github.com/go-git/go-git/issues/411 as well as
 		// https://github.com/golang/go/issues/29286 for root cause.
-		db, err := newKnownHostsDb()
-		if err != nil {
-			return err
-		}
-
-		// Note that the knownhost database is used, as it provides additional functionality
-		// to handle ssh cert-authorities.
-		config.HostKeyAlgorithms = db.HostKeyAlgorithms(hostWithPort)
+		//
+		// The algorithms are looked up from the callback itself, and not from the
+		// default known_hosts files, which may not exist or not be the ones of the
+		// callback, e.g. listing an rsa key of a host offering only an ed25519 one.
+		// The callbacks of the knownhost database still report the ssh
+		// cert-authorities. Callbacks not based on known_hosts files give no
+		// algorithms, and the default ones are then offered.
+		config.HostKeyAlgorithms = knownhosts.HostKeyAlgorithms(config.HostKeyCallback, hostWithPort)
 	}
 
 	trace.SSH.Printf("ssh: host key algorithms %s", config.HostKeyAlgorithms)
 
 	overrideConfig(c.config, config)
+	if d := c.endpoint.Timeouts.Dial; d > 0 {
+		config.Timeout = d
+	}
+
+	if c.pool != nil {
+		if key, ok := newPoolKey(c, hostWithPort, config, defaultAuth); ok {
+			return c.connectPooled(ctx, key, hostWithPort, config)
+		}
+	}
 
 	c.client, err = dial(ctx, "tcp", hostWithPort, c.endpoint.Proxy, config)
 	if err != nil {
@@ -177,6 +223,22 @@ func (c *command) connect(ctx context.Context) error {
 	return nil
 }
 
+// connectPooled runs the command over a connection of the pool, connecting to
+// the SSH server only if none of them is usable.
+func (c *command) connectPooled(ctx context.Context, key poolKey, hostWithPort string, config *ssh.ClientConfig) error {
+	var err error
+	c.pooled, c.Session, err = c.pool.session(key, func() (*ssh.Client, error) {
+		return dial(ctx, "tcp", hostWithPort, c.endpoint.Proxy, config)
+	})
+	if err != nil {
+		return err
+	}
+
+	c.client = c.pooled.Client
+	c.connected = true
+	return nil
+}
+
 func dial(ctx context.Context, network, addr string, proxyOpts transport.ProxyOptions, config *ssh.ClientConfig) (*ssh.Client, error) {
 	var cancel context.CancelFunc
 	if config.Timeout > 0 {
@@ -215,10 +277,17 @@ func dial(ctx context.Context, network, addr string, proxyOpts transport.ProxyOp
 		return nil, dialErr
 	}
 
+	// The SSH handshake is bounded by the timeout too.
+	if deadline, ok := ctx.Deadline(); ok {
+		_ = conn.SetDeadline(deadline)
+	}
+
 	c, chans, reqs, err := ssh.NewClientConn(conn, addr, config)
 	if err != nil {
 		return nil, err
 	}
+
+	_ = conn.SetDeadline(time.Time{})
 	return ssh.NewClient(c, chans, reqs), nil
 }
 
@@ -2,15 +2,21 @@ package ssh
 
 import (
 	"context"
+	"fmt"
+	"os"
+	"path/filepath"
 	"testing"
 
 	"github.com/gliderlabs/ssh"
+	fixtures "github.com/go-git/go-git-fixtures/v5"
 	"github.com/kevinburke/ssh_config"
 	"github.com/stretchr/testify/require"
 	stdssh "golang.org/x/crypto/ssh"
 	"golang.org/x/crypto/ssh/testdata"
 
+	"github.com/go-git/go-git/v6/internal/transport/test"
 	"github.com/go-git/go-git/v6/plumbing/transport"
+	"github.com/go-git/go-git/v6/plumbing/transport/ssh/knownhosts"
 	"github.com/go-git/go-git/v6/storage/memory"
 )
 
@@ -151,6 +157,77 @@ func TestFailHostKeyCallback(t *testing.T) {
 	require.Error(t, err)
 }
 
+func TestKnownHostsCallbackHostKeyAlgorithms(t *testing.T) {
+	opts := []ssh.Option{
+		ssh.HostKeyPEM(testdata.PEMBytes["ed25519"]),
+	}
+	base, port, _ := setupTest(t, opts...)
+	test.PrepareRepository(t, fixtures.Basic().One(), base, "basic.git")
+	hostKey, err := stdssh.ParsePrivateKey(testdata.PEMBytes["ed25519"])
+	require.NoError(t, err)
+	staleKey, err := stdssh.ParsePrivateKey(testdata.PEMBytes["rsa"])
+	require.NoError(t, err)
+
+	// The default known_hosts lists an rsa key of the host, which offers only
+	// an ed25519 one, listed by the known_hosts of the callback.
+	host := fmt.Sprintf("localhost:%d", port)
+	defaultFile := filepath.Join(t.TempDir(), "known_hosts")
+	require.NoError(t, os.WriteFile(defaultFile, []byte(knownhosts.Line([]string{host}, staleKey.PublicKey())+"\n"), 0o600))
+	t.Setenv("SSH_KNOWN_HOSTS", defaultFile)
+	file := filepath.Join(t.TempDir(), "known_hosts")
+	require.NoError(t, os.WriteFile(file, []byte(knownhosts.Line([]string{host}, hostKey.PublicKey())+"\n"), 0o600))
+
+	auth := &Password{User: "git"}
+	auth.HostKeyCallback, err = NewKnownHostsCallback(file)
+	require.NoError(t, err)
+	sess, err := DefaultTransport.NewSession(memory.NewStorage(), newEndpoint(t, base, port, "basic.git"), auth)
+	require.NoError(t, err)
+	conn, err := sess.Handshake(context.TODO(), transport.UploadPackService)
+	require.NoError(t, err)
+	require.NoError(t, conn.Close())
+}
+
+func TestHostKeyCallbackWithoutKnownHosts(t *testing.T) {
+	opts := []ssh.Option{
+		ssh.HostKeyPEM(testdata.PEMBytes["ed25519"]),
+	}
+	base, port, _ := setupTest(t, opts...)
+	test.PrepareRepository(t, fixtures.Basic().One(), base, "basic.git")
+	hostKey, err := stdssh.ParsePrivateKey(testdata.PEMBytes["ed25519"])
+	require.NoError(t, err)
+	t.Setenv("SSH_KNOWN_HOSTS", filepath.Join(t.TempDir(), "known_hosts"))
+
+	auth := &Password{User: "git"}
+	auth.HostKeyCallback = stdssh.FixedHostKey(hostKey.PublicKey())
+	sess, err := DefaultTransport.NewSession(memory.NewStorage(), newEndpoint(t, base, port, "basic.git"), auth)
+	require.NoError(t, err)
+	conn, err := sess.Handshake(context.TODO(), transport.UploadPackService)
+	require.NoError(t, err)
+	require.NoError(t, conn.Close())
+}
+
+func TestUnknownHostError(t *testing.T) {
+	opts := []ssh.Option{
+		ssh.HostKeyPEM(testdata.PEMBytes["ed25519"]),
+	}
+	base, port, _ := setupTest(t, opts...)
+	hostKey, err := stdssh.ParsePrivateKey(testdata.PEMBytes["ed25519"])
+	require.NoError(t, err)
+	file := filepath.Join(t.TempDir(), "known_hosts")
+	require.NoError(t, os.WriteFile(file, nil, 0o600))
+	t.Setenv("SSH_KNOWN_HOSTS", file)
+
+	auth := &Password{User: "git"}
+	sess, err := DefaultTransport.NewSession(memory.NewStorage(), newEndpoint(t, base, port, "bar.git"), auth)
+	require.NoError(t, err)
+	_, err = sess.Handshake(context.TODO(), transport.UploadPackService)
+
+	var unknownErr *knownhosts.UnknownHostError
+	require.ErrorAs(t, err, &unknownErr)
+	require.Equal(t, fmt.Sprintf("localhost:%d", port), unknownErr.Hostname)
+	require.Equal(t, stdssh.FingerprintSHA256(hostKey.PublicKey()), unknownErr.Fingerprint())
+}
+
 func TestIssue70Suite(t *testing.T) {
 	authBuilder := DefaultAuthBuilder
 	defer func() {
@@ -109,57 +109,123 @@ func NewDB(files ...string) (*HostKeyDB, error) {
 // ssh.ClientConfig.HostKeyCallback, as shown in the example for NewDB.
 // Alternatively, you can wrap it with an outer callback to potentially handle
 // appending a new entry to the known_hosts file; see example in WriteKnownHost.
+//
+// When the host has no known_hosts entry, the callback returns an
+// *UnknownHostError holding the key offered by the host. The host key
+// algorithms can also be looked up from the callback alone, with the
+// HostKeyAlgorithms function, @cert-authority lines included.
 func (hkdb *HostKeyDB) HostKeyCallback() ssh.HostKeyCallback {
+	return func(hostname string, remote net.Addr, key ssh.PublicKey) error {
+		err := hkdb.check(hostname, remote, key)
+
+		var keyErr *xknownhosts.KeyError
+		var unknownErr *UnknownHostError
+		var dbErr *dbKeyError
+		switch {
+		case !errors.As(err, &keyErr), errors.As(err, &unknownErr), errors.As(err, &dbErr):
+			// Either not a known_hosts error, or hkdb was created from the
+			// callback of another HostKeyDB with HostKeyCallback.ToDB, which
+			// already returned its annotated error.
+			return err
+		case len(keyErr.Want) == 0:
+			return &UnknownHostError{Hostname: hostname, Remote: remote, Key: key, err: keyErr}
+		default:
+			return &dbKeyError{KeyError: keyErr, isCert: hkdb.isCert}
+		}
+	}
+}
+
+func (hkdb *HostKeyDB) check(hostname string, remote net.Addr, key ssh.PublicKey) error {
 	// Either NewDB found no wildcard host patterns, or hkdb was created from
 	// HostKeyCallback.ToDB in which case we didn't scan known_hosts for them:
-	// return the callback (which came from x/crypto/ssh/knownhosts) as-is
+	// use the callback (which came from x/crypto/ssh/knownhosts) as-is
 	if len(hkdb.isWildcard) == 0 {
-		return hkdb.callback
+		return hkdb.callback(hostname, remote, key)
 	}
 
-	// If we scanned for wildcards and found at least one, return a wrapped
-	// callback with extra behavior: if the host lookup found no matches, and the
-	// host arg had a non-standard port, re-do the lookup on standard port 22. If
-	// that second call returns a *xknownhosts.KeyError, filter down any resulting
-	// Want keys to known wildcard entries.
-	f := func(hostname string, remote net.Addr, key ssh.PublicKey) error {
-		trace.SSH.Printf(
-			`ssh: wildcard knownhosts for hostname=%s pubkey="%s %s"`,
-			hostname, key.Type(), ssh.FingerprintSHA256(key))
-
-		callbackErr := hkdb.callback(hostname, remote, key)
-		if callbackErr == nil || IsHostKeyChanged(callbackErr) { // hostname has known_host entries as-is
-			return callbackErr
-		}
-		justHost, port, splitErr := net.SplitHostPort(hostname)
-		if splitErr != nil || port == "" || port == "22" { // hostname already using standard port
-			return callbackErr
+	// If we scanned for wildcards and found at least one, add extra behavior:
+	// if the host lookup found no matches, and the host arg had a non-standard
+	// port, re-do the lookup on standard port 22. If that second call returns a
+	// *xknownhosts.KeyError, filter down any resulting Want keys to known
+	// wildcard entries.
+	trace.SSH.Printf(
+		`ssh: wildcard knownhosts for hostname=%s pubkey="%s %s"`,
+		hostname, key.Type(), ssh.FingerprintSHA256(key))
+
+	callbackErr := hkdb.callback(hostname, remote, key)
+	if callbackErr == nil || IsHostKeyChanged(callbackErr) { // hostname has known_host entries as-is
+		return callbackErr
+	}
+	justHost, port, splitErr := net.SplitHostPort(hostname)
+	if splitErr != nil || port == "" || port == "22" { // hostname already using standard port
+		return callbackErr
+	}
+	// If we reach here, the port was non-standard and no known_host entries
+	// were found for the non-standard port. Try again with standard port.
+	if tcpAddr, ok := remote.(*net.TCPAddr); ok && tcpAddr.Port != 22 {
+		remote = &net.TCPAddr{
+			IP:   tcpAddr.IP,
+			Port: 22,
+			Zone: tcpAddr.Zone,
 		}
-		// If we reach here, the port was non-standard and no known_host entries
-		// were found for the non-standard port. Try again with standard port.
-		if tcpAddr, ok := remote.(*net.TCPAddr); ok && tcpAddr.Port != 22 {
-			remote = &net.TCPAddr{
-				IP:   tcpAddr.IP,
-				Port: 22,
-				Zone: tcpAddr.Zone,
+	}
+	callbackErr = hkdb.callback(justHost+":22", remote, key)
+	var keyErr *xknownhosts.KeyError
+	if errors.As(callbackErr, &keyErr) && len(keyErr.Want) > 0 {
+		wildcardKeys := make([]xknownhosts.KnownKey, 0, len(keyErr.Want))
+		for _, wantKey := range keyErr.Want {
+			if hkdb.isWildcard[fmt.Sprintf("%s:%d", wantKey.Filename, wantKey.Line)] {
+				wildcardKeys = append(wildcardKeys, wantKey)
 			}
 		}
-		callbackErr = hkdb.callback(justHost+":22", remote, key)
-		var keyErr *xknownhosts.KeyError
-		if errors.As(callbackErr, &keyErr) && len(keyErr.Want) > 0 {
-			wildcardKeys := make([]xknownhosts.KnownKey, 0, len(keyErr.Want))
-			for _, wantKey := range keyErr.Want {
-				if hkdb.isWildcard[fmt.Sprintf("%s:%d", wantKey.Filename, wantKey.Line)] {
-					wildcardKeys = append(wildcardKeys, wantKey)
-				}
-			}
-			callbackErr = &xknownhosts.KeyError{
-				Want: wildcardKeys,
-			}
+		callbackErr = &xknownhosts.KeyError{
+			Want: wildcardKeys,
 		}
-		return callbackErr
 	}
-	return ssh.HostKeyCallback(f)
+	return callbackErr
+}
+
+// UnknownHostError is returned by the callbacks of a HostKeyDB when the host
+// has no known_hosts entry. It holds the key offered by the host, so that
+// callers can show its fingerprint and ask whether to trust it, appending it
+// to the known_hosts file with WriteKnownHost if so.
+type UnknownHostError struct {
+	// Hostname and Remote are the address of the host, as given to the
+	// callback.
+	Hostname string
+	Remote   net.Addr
+	// Key is the key offered by the host.
+	Key ssh.PublicKey
+
+	err *xknownhosts.KeyError
+}
+
+// Fingerprint returns the SHA256 fingerprint of the key offered by the host,
+// in the format used by OpenSSH.
+func (e *UnknownHostError) Fingerprint() string {
+	return ssh.FingerprintSHA256(e.Key)
+}
+
+func (e *UnknownHostError) Error() string {
+	return fmt.Sprintf("knownhosts: key is unknown for %s: %s %s", e.Hostname, e.Key.Type(), e.Fingerprint())
+}
+
+// Unwrap returns the *xknownhosts.KeyError of the unknown host, so that
+// IsHostUnknown reports it.
+func (e *UnknownHostError) Unwrap() error {
+	return e.err
+}
+
+// dbKeyError is returned by the callbacks of a HostKeyDB when the key doesn't
+// match the known ones, telling which of them are from @cert-authority lines,
+// so that the known hosts looked up from the callback alone still have them.
+type dbKeyError struct {
+	*xknownhosts.KeyError
+	isCert map[string]bool
+}
+
+func (e *dbKeyError) Unwrap() error {
+	return e.KeyError
 }
 
 // PublicKey wraps ssh.PublicKey with an additional field, to identify
@@ -176,7 +242,9 @@ type PublicKey struct {
 // line number.
 // If hkdb was originally created by calling NewDB, the Cert boolean field of
 // each result entry reports whether the key corresponded to a @cert-authority
-// line. If hkdb was NOT obtained from NewDB, then Cert will always be false.
+// line. If hkdb was NOT obtained from NewDB, then Cert will always be false,
+// unless it was created by HostKeyCallback.ToDB from the callback of a
+// HostKeyDB obtained from NewDB.
 func (hkdb *HostKeyDB) HostKeys(hostWithPort string) (keys []PublicKey) {
 	var keyErr *xknownhosts.KeyError
 	placeholderAddr := &net.TCPAddr{IP: []byte{0, 0, 0, 0}}
@@ -184,6 +252,12 @@ func (hkdb *HostKeyDB) HostKeys(hostWithPort string) (keys []PublicKey) {
 	var kkeys []xknownhosts.KnownKey
 	callback := hkdb.HostKeyCallback()
 	if hkcbErr := callback(hostWithPort, placeholderAddr, placeholderPubKey); errors.As(hkcbErr, &keyErr) {
+		isCert := hkdb.isCert
+		var dbErr *dbKeyError
+		if errors.As(hkcbErr, &dbErr) {
+			isCert = dbErr.isCert
+		}
+
 		kkeys = append(kkeys, keyErr.Want...)
 		knownKeyLess := func(i, j int) bool {
 			if kkeys[i].Filename < kkeys[j].Filename {
@@ -197,8 +271,8 @@ func (hkdb *HostKeyDB) HostKeys(hostWithPort string) (keys []PublicKey) {
 			keys[n] = PublicKey{
 				PublicKey: kkeys[n].Key,
 			}
-			if len(hkdb.isCert) > 0 {
-				keys[n].Cert = hkdb.isCert[fmt.Sprintf("%s:%d", kkeys[n].Filename, kkeys[n].Line)]
+			if len(isCert) > 0 {
+				keys[n].Cert = isCert[fmt.Sprintf("%s:%d", kkeys[n].Filename, kkeys[n].Line)]
 			}
 		}
 	}
@@ -364,10 +438,11 @@ func (hkcb HostKeyCallback) HostKeyAlgorithms(hostWithPort string) (algos []stri
 // lookups on an ssh.HostKeyCallback directly. It is intended for use in code
 // paths that stay with the New method of golang.org/x/crypto/ssh/knownhosts
 // rather than this package's New or NewDB methods.
-// The returned values will not include ssh.CertAlgo* values. If any
-// known_hosts lines had @cert-authority prefixes, their original key algo will
-// be returned instead. For proper CA support, see NewDB and
-// HostKeyDB.HostKeyAlgorithms instead.
+// Unless cb was returned by HostKeyDB.HostKeyCallback, or wraps such a
+// callback without changing its errors, the returned values will not include
+// ssh.CertAlgo* values. If any known_hosts lines had @cert-authority prefixes,
+// their original key algo will be returned instead. For proper CA support, see
+// NewDB and HostKeyDB.HostKeyAlgorithms instead.
 func HostKeyAlgorithms(cb ssh.HostKeyCallback, hostWithPort string) []string {
 	return HostKeyCallback(cb).HostKeyAlgorithms(hostWithPort)
 }
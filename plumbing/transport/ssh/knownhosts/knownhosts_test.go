@@ -23,12 +23,15 @@ import (
 	"crypto/elliptic"
 	"crypto/rand"
 	"crypto/rsa"
+	"encoding/base64"
+	"errors"
 	"net"
 	"os"
 	"path/filepath"
 	"testing"
 
 	"golang.org/x/crypto/ssh"
+	xknownhosts "golang.org/x/crypto/ssh/knownhosts"
 )
 
 func TestNewDB(t *testing.T) {
@@ -254,6 +257,82 @@ func TestWithCertLines(t *testing.T) {
 				}
 			}
 		}
+		// The callback of the HostKeyDB alone should give the same algorithms
+		algos = HostKeyAlgorithms(kh.HostKeyCallback(), tc.host)
+		if len(algos) != len(tc.expectedAlgos) {
+			t.Errorf("Unexpected return from HostKeyAlgorithms(callback, %q): %v", tc.host, algos)
+		} else {
+			for n := range algos {
+				if algos[n] != tc.expectedAlgos[n] {
+					t.Errorf("Unexpected return from HostKeyAlgorithms(callback, %q) at index %d: %v", tc.host, n, algos)
+					break
+				}
+			}
+		}
+	}
+}
+
+func TestUnknownHostError(t *testing.T) {
+	khPath := getTestKnownHosts(t)
+	kh, err := NewDB(khPath)
+	if err != nil {
+		t.Fatalf("Unexpected error from NewDB: %v", err)
+	}
+	noAddr, _ := net.ResolveTCPAddr("tcp", "0.0.0.0:0")
+	pubKey := generatePubKeyEd25519(t)
+
+	err = kh.HostKeyCallback()("unknown.example.test:22", noAddr, pubKey)
+	var unknownErr *UnknownHostError
+	if !errors.As(err, &unknownErr) {
+		t.Fatalf("Expected an UnknownHostError for unknown host, found %v", err)
+	}
+	if !IsHostUnknown(err) {
+		t.Error("IsHostUnknown unexpectedly returned false for unknown host")
+	}
+	if unknownErr.Hostname != "unknown.example.test:22" || unknownErr.Remote != noAddr {
+		t.Errorf("Unexpected address in UnknownHostError: %s %s", unknownErr.Hostname, unknownErr.Remote)
+	}
+	if fp := unknownErr.Fingerprint(); fp != ssh.FingerprintSHA256(pubKey) {
+		t.Errorf("Unexpected fingerprint in UnknownHostError: %s", fp)
+	}
+
+	// Known host, wrong key: not an UnknownHostError
+	err = kh.HostKeyCallback()("only-ed25519.example.test:22", noAddr, pubKey)
+	if errors.As(err, &unknownErr) || !IsHostKeyChanged(err) {
+		t.Errorf("Unexpected error for known host with different host key: %v", err)
+	}
+}
+
+func TestHashedAndRevokedLines(t *testing.T) {
+	pubKey := generatePubKeyEd25519(t)
+	revokedKey := generatePubKeyEd25519(t)
+	encode := func(key ssh.PublicKey) string {
+		return key.Type() + " " + base64.StdEncoding.EncodeToString(key.Marshal())
+	}
+
+	khPath := filepath.Join(t.TempDir(), "known_hosts")
+	contents := xknownhosts.HashHostname("hashed.example.test") + " " + encode(pubKey) + "\n" +
+		"hashed.example.test " + encode(revokedKey) + "\n" +
+		"@revoked * " + encode(revokedKey) + "\n"
+	if err := os.WriteFile(khPath, []byte(contents), 0o600); err != nil {
+		t.Fatalf("Unable to write to %s: %v", khPath, err)
+	}
+
+	kh, err := NewDB(khPath)
+	if err != nil {
+		t.Fatalf("Unexpected error from NewDB: %v", err)
+	}
+	noAddr, _ := net.ResolveTCPAddr("tcp", "0.0.0.0:0")
+	if err := kh.HostKeyCallback()("hashed.example.test:22", noAddr, pubKey); err != nil {
+		t.Errorf("Unexpected error for hashed known host: %v", err)
+	}
+	if algos := kh.HostKeyAlgorithms("hashed.example.test:22"); len(algos) != 1 || algos[0] != ssh.KeyAlgoED25519 {
+		t.Errorf("Unexpected return from HostKeyAlgorithms for hashed known host: %v", algos)
+	}
+
+	var revokedErr *xknownhosts.RevokedError
+	if err := kh.HostKeyCallback()("hashed.example.test:22", noAddr, revokedKey); !errors.As(err, &revokedErr) {
+		t.Errorf("Expected a RevokedError for revoked key, found %v", err)
 	}
 }
 
@@ -0,0 +1,272 @@
+package ssh
+
+import (
+	"errors"
+	"net"
+	"reflect"
+	"sync"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+
+	"github.com/go-git/go-git/v6/plumbing/transport"
+	"github.com/go-git/go-git/v6/utils/trace"
+)
+
+// DefaultIdleTimeout is the time the connections of a ConnectionPool are kept
+// open without any session, when its IdleTimeout is zero.
+const DefaultIdleTimeout = 30 * time.Second
+
+// ConnectionPool keeps the SSH connections of a transport open, to run the
+// commands of the following sessions to the same host, with the same user and
+// auth method, over them instead of connecting again. The connections are
+// closed once they haven't run any command for IdleTimeout.
+//
+// A ConnectionPool is safe for concurrent use: concurrent sessions share the
+// connections, as many as the servers accept, new connections being opened
+// when they refuse more.
+type ConnectionPool struct {
+	// IdleTimeout is the time after which the connections which don't run any
+	// command are closed. If zero, DefaultIdleTimeout is used.
+	IdleTimeout time.Duration
+
+	mu     sync.Mutex
+	conns  map[poolKey][]*pooledClient
+	closed bool
+}
+
+// NewConnectionPool returns a pool closing the connections idle for the given
+// time.
+func NewConnectionPool(idleTimeout time.Duration) *ConnectionPool {
+	return &ConnectionPool{IdleTimeout: idleTimeout}
+}
+
+// poolKey identifies the connections which can be shared: the ones to the
+// same address, through the same proxy, with the same user and auth method.
+// The auth method is nil when it is the one of DefaultAuthBuilder.
+type poolKey struct {
+	addr   string
+	proxy  string
+	user   string
+	auth   transport.AuthMethod
+	config *ssh.ClientConfig
+}
+
+// pooledClient is a connection of a pool, with the number of its sessions.
+type pooledClient struct {
+	*ssh.Client
+	key      poolKey
+	sessions int
+	// broken is set when the connection refused a new session, so that it
+	// isn't used by the following ones and is closed once idle.
+	broken bool
+	idle   *time.Timer
+}
+
+// newPoolKey returns the key of the connections usable by c, and false if its
+// auth method can't be compared to the ones of the other connections.
+func newPoolKey(c *command, addr string, config *ssh.ClientConfig, defaultAuth bool) (poolKey, bool) {
+	key := poolKey{
+		addr:   addr,
+		proxy:  c.endpoint.Proxy.URL,
+		user:   config.User,
+		config: c.config,
+	}
+
+	if !defaultAuth {
+		if !reflect.TypeOf(c.auth).Comparable() {
+			return key, false
+		}
+
+		key.auth = c.auth
+	}
+
+	return key, true
+}
+
+// session returns a new session of a connection of the pool for the key,
+// connecting with dial if none of them accepts it.
+func (p *ConnectionPool) session(key poolKey, dial func() (*ssh.Client, error)) (*pooledClient, *ssh.Session, error) {
+	for {
+		pc := p.acquire(key)
+		if pc == nil {
+			break
+		}
+
+		s, err := pc.NewSession()
+		if err == nil {
+			trace.SSH.Printf("ssh: reusing connection to %s", key.addr)
+			return pc, s, nil
+		}
+
+		// The connection may be closed, or serve as many sessions as the
+		// server accepts: it isn't used for the next sessions.
+		trace.SSH.Printf("ssh: pooled connection to %s refused a session: %s", key.addr, err)
+		p.release(pc, true)
+	}
+
+	client, err := dial()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	s, err := client.NewSession()
+	if err != nil {
+		_ = client.Close()
+		return nil, nil, err
+	}
+
+	pc := &pooledClient{Client: client, key: key, sessions: 1}
+	if !p.add(pc) {
+		pc.broken = true
+	}
+
+	go func() {
+		_ = client.Wait()
+		p.remove(pc)
+	}()
+
+	return pc, s, nil
+}
+
+// acquire returns a connection of the key with a new session accounted, or nil
+// if there is none.
+func (p *ConnectionPool) acquire(key poolKey) *pooledClient {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	for _, pc := range p.conns[key] {
+		if pc.broken {
+			continue
+		}
+
+		pc.sessions++
+		if pc.idle != nil {
+			pc.idle.Stop()
+			pc.idle = nil
+		}
+
+		return pc
+	}
+
+	return nil
+}
+
+// add adds a new connection to the pool, returning false if it was closed.
+func (p *ConnectionPool) add(pc *pooledClient) bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.closed {
+		return false
+	}
+
+	if p.conns == nil {
+		p.conns = make(map[poolKey][]*pooledClient)
+	}
+
+	p.conns[pc.key] = append(p.conns[pc.key], pc)
+	return true
+}
+
+// release ends a session of the connection, marking it as broken if asked.
+// The connection is closed when it has no more sessions and is broken, or
+// once it stayed without any for IdleTimeout.
+func (p *ConnectionPool) release(pc *pooledClient, broken bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	pc.sessions--
+	pc.broken = pc.broken || broken
+	if pc.sessions > 0 {
+		return
+	}
+
+	if pc.broken || p.closed {
+		p.removeLocked(pc)
+		_ = pc.Close()
+		return
+	}
+
+	timeout := p.IdleTimeout
+	if timeout == 0 {
+		timeout = DefaultIdleTimeout
+	}
+
+	var idle *time.Timer
+	idle = time.AfterFunc(timeout, func() {
+		p.mu.Lock()
+		defer p.mu.Unlock()
+
+		// The connection got a new session, which stopped the timer too late.
+		if pc.idle != idle {
+			return
+		}
+
+		trace.SSH.Printf("ssh: closing idle connection to %s", pc.key.addr)
+		p.removeLocked(pc)
+		_ = pc.Close()
+	})
+
+	pc.idle = idle
+}
+
+// remove removes the connection from the pool, once it was closed.
+func (p *ConnectionPool) remove(pc *pooledClient) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	pc.broken = true
+	p.removeLocked(pc)
+}
+
+func (p *ConnectionPool) removeLocked(pc *pooledClient) {
+	if pc.idle != nil {
+		pc.idle.Stop()
+		pc.idle = nil
+	}
+
+	conns := p.conns[pc.key]
+	for i, c := range conns {
+		if c == pc {
+			conns = append(conns[:i], conns[i+1:]...)
+			break
+		}
+	}
+
+	if len(conns) == 0 {
+		delete(p.conns, pc.key)
+	} else {
+		p.conns[pc.key] = conns
+	}
+}
+
+// Close closes the connections of the pool without any session, and the
+// others once their sessions end. The pool doesn't keep the connections open
+// after it was closed.
+func (p *ConnectionPool) Close() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.closed = true
+
+	var idle []*pooledClient
+	for _, conns := range p.conns {
+		for _, pc := range conns {
+			pc.broken = true
+			if pc.sessions == 0 {
+				idle = append(idle, pc)
+			}
+		}
+	}
+
+	var errs []error
+	for _, pc := range idle {
+		p.removeLocked(pc)
+		if err := pc.Close(); err != nil && !errors.Is(err, net.ErrClosed) {
+			errs = append(errs, err)
+		}
+	}
+
+	return errors.Join(errs...)
+}
@@ -0,0 +1,139 @@
+package ssh
+
+import (
+	"context"
+	"net"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/gliderlabs/ssh"
+	fixtures "github.com/go-git/go-git-fixtures/v5"
+	"github.com/stretchr/testify/require"
+	stdssh "golang.org/x/crypto/ssh"
+
+	"github.com/go-git/go-git/v6/internal/transport/test"
+	"github.com/go-git/go-git/v6/plumbing/transport"
+	"github.com/go-git/go-git/v6/storage/memory"
+)
+
+// setupPoolTest starts a server counting its connections, and returns a
+// transport using the pool to connect to its basic.git repository.
+func setupPoolTest(t *testing.T, pool *ConnectionPool) (transport.Transport, *transport.Endpoint, *atomic.Int32) {
+	conns := &atomic.Int32{}
+	countConns := ssh.WrapConn(func(_ ssh.Context, conn net.Conn) net.Conn {
+		conns.Add(1)
+		return conn
+	})
+
+	base, port, _ := setupTest(t, countConns)
+	test.PrepareRepository(t, fixtures.Basic().One(), base, "basic.git")
+
+	tr := NewTransportWithOptions(&TransportOptions{
+		ClientConfig: &stdssh.ClientConfig{
+			HostKeyCallback: stdssh.InsecureIgnoreHostKey(),
+		},
+		Pool: pool,
+	})
+
+	return tr, newEndpoint(t, base, port, "basic.git"), conns
+}
+
+func handshake(t *testing.T, tr transport.Transport, ep *transport.Endpoint, auth AuthMethod) transport.Connection {
+	sess, err := tr.NewSession(memory.NewStorage(), ep, auth)
+	require.NoError(t, err)
+	conn, err := sess.Handshake(context.TODO(), transport.UploadPackService)
+	require.NoError(t, err)
+	return conn
+}
+
+func poolLen(p *ConnectionPool) int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	n := 0
+	for _, conns := range p.conns {
+		n += len(conns)
+	}
+
+	return n
+}
+
+func TestConnectionPoolReuse(t *testing.T) {
+	pool := NewConnectionPool(time.Hour)
+	defer pool.Close()
+	tr, ep, conns := setupPoolTest(t, pool)
+
+	auth := &Password{User: "git"}
+	for range 3 {
+		conn := handshake(t, tr, ep, auth)
+		refs, err := conn.GetRemoteRefs(context.TODO())
+		require.NoError(t, err)
+		require.NotEmpty(t, refs)
+		require.NoError(t, conn.Close())
+	}
+
+	require.EqualValues(t, 1, conns.Load())
+	require.Equal(t, 1, poolLen(pool))
+
+	// Another auth method doesn't reuse the connection.
+	require.NoError(t, handshake(t, tr, ep, &Password{User: "git"}).Close())
+	require.EqualValues(t, 2, conns.Load())
+	require.Equal(t, 2, poolLen(pool))
+
+	require.NoError(t, pool.Close())
+	require.Equal(t, 0, poolLen(pool))
+
+	// A closed pool doesn't keep the connections.
+	require.NoError(t, handshake(t, tr, ep, auth).Close())
+	require.EqualValues(t, 3, conns.Load())
+	require.Equal(t, 0, poolLen(pool))
+}
+
+func TestConnectionPoolConcurrent(t *testing.T) {
+	pool := NewConnectionPool(time.Hour)
+	defer pool.Close()
+	tr, ep, conns := setupPoolTest(t, pool)
+
+	auth := &Password{User: "git"}
+	var wg sync.WaitGroup
+	for range 5 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for range 3 {
+				conn := handshake(t, tr, ep, auth)
+				_, err := conn.GetRemoteRefs(context.TODO())
+				require.NoError(t, err)
+				require.NoError(t, conn.Close())
+			}
+		}()
+	}
+
+	wg.Wait()
+	require.LessOrEqual(t, conns.Load(), int32(5))
+	require.Equal(t, int(conns.Load()), poolLen(pool))
+}
+
+func TestConnectionPoolIdleTimeout(t *testing.T) {
+	pool := NewConnectionPool(10 * time.Millisecond)
+	defer pool.Close()
+	tr, ep, conns := setupPoolTest(t, pool)
+
+	auth := &Password{User: "git"}
+	conn := handshake(t, tr, ep, auth)
+	require.Equal(t, 1, poolLen(pool))
+
+	// The connection running a command isn't closed.
+	time.Sleep(50 * time.Millisecond)
+	require.Equal(t, 1, poolLen(pool))
+	require.NoError(t, conn.Close())
+
+	require.Eventually(t, func() bool {
+		return poolLen(pool) == 0
+	}, time.Second, 5*time.Millisecond)
+
+	require.NoError(t, handshake(t, tr, ep, auth).Close())
+	require.EqualValues(t, 2, conns.Load())
+}
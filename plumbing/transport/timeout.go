@@ -0,0 +1,115 @@
+package transport
+
+import (
+	"fmt"
+	"io"
+	"sync"
+	"time"
+)
+
+// TimeoutOptions bounds the time the transports wait for a server, apart from
+// the deadline of the context of an operation, so that a dead server or a
+// stalled transfer is given up before it. The zero values set no bound.
+type TimeoutOptions struct {
+	// Dial bounds the time taken to connect to the server, the proxy if any.
+	// With SSH, it also bounds the SSH handshake.
+	Dial time.Duration
+	// TLSHandshake bounds the time taken by the TLS handshake, with HTTPS.
+	TLSHandshake time.Duration
+	// ResponseHeader bounds the time waiting for the headers of a response
+	// once the request is sent, with HTTP.
+	ResponseHeader time.Duration
+	// Idle aborts the transfer once no byte was received for that long while
+	// data was expected from the server, such as a packfile being fetched,
+	// with ErrTimeoutExceeded. The servers which don't send any progress stay
+	// silent while preparing the packfile, which must be taken into account.
+	Idle time.Duration
+}
+
+// WithDefaults returns the timeouts, with the ones of d in place of the zero
+// ones.
+func (o TimeoutOptions) WithDefaults(d TimeoutOptions) TimeoutOptions {
+	if o.Dial == 0 {
+		o.Dial = d.Dial
+	}
+	if o.TLSHandshake == 0 {
+		o.TLSHandshake = d.TLSHandshake
+	}
+	if o.ResponseHeader == 0 {
+		o.ResponseHeader = d.ResponseHeader
+	}
+	if o.Idle == 0 {
+		o.Idle = d.Idle
+	}
+
+	return o
+}
+
+// NewIdleTimeoutReader returns a reader reading from r, which closes c once
+// a read received no byte for the given timeout, to unblock it, the read
+// failing with ErrTimeoutExceeded. The time spent between the reads isn't
+// taken into account. It returns r if the timeout isn't positive.
+func NewIdleTimeoutReader(r io.Reader, c io.Closer, timeout time.Duration) io.Reader {
+	if timeout <= 0 {
+		return r
+	}
+
+	return &idleTimeoutReader{r: r, c: c, timeout: timeout}
+}
+
+type idleTimeoutReader struct {
+	r       io.Reader
+	c       io.Closer
+	timeout time.Duration
+
+	m        sync.Mutex
+	timer    *time.Timer
+	timedOut bool
+}
+
+func (r *idleTimeoutReader) Read(p []byte) (int, error) {
+	if err := r.arm(); err != nil {
+		return 0, err
+	}
+
+	n, err := r.r.Read(p)
+
+	r.m.Lock()
+	defer r.m.Unlock()
+	r.timer.Stop()
+	if r.timedOut {
+		return n, r.err()
+	}
+
+	return n, err
+}
+
+// arm starts the timer of a read, unless the reader timed out already.
+func (r *idleTimeoutReader) arm() error {
+	r.m.Lock()
+	defer r.m.Unlock()
+
+	if r.timedOut {
+		return r.err()
+	}
+
+	if r.timer == nil {
+		r.timer = time.AfterFunc(r.timeout, r.expire)
+	} else {
+		r.timer.Reset(r.timeout)
+	}
+
+	return nil
+}
+
+func (r *idleTimeoutReader) expire() {
+	r.m.Lock()
+	r.timedOut = true
+	r.m.Unlock()
+
+	_ = r.c.Close()
+}
+
+func (r *idleTimeoutReader) err() error {
+	return fmt.Errorf("%w: no data received for %s", ErrTimeoutExceeded, r.timeout)
+}
@@ -0,0 +1,56 @@
+package transport
+
+import (
+	"io"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTimeoutOptionsWithDefaults(t *testing.T) {
+	t.Parallel()
+
+	o := TimeoutOptions{Dial: time.Second, Idle: 2 * time.Second}
+	d := TimeoutOptions{Dial: time.Minute, TLSHandshake: time.Minute, ResponseHeader: time.Minute, Idle: time.Minute}
+	assert.Equal(t, TimeoutOptions{
+		Dial:           time.Second,
+		TLSHandshake:   time.Minute,
+		ResponseHeader: time.Minute,
+		Idle:           2 * time.Second,
+	}, o.WithDefaults(d))
+	assert.Equal(t, o, o.WithDefaults(TimeoutOptions{}))
+}
+
+func TestIdleTimeoutReader(t *testing.T) {
+	t.Parallel()
+
+	pr, pw := io.Pipe()
+	r := NewIdleTimeoutReader(pr, pr, 50*time.Millisecond)
+	go func() {
+		_, _ = pw.Write([]byte("abc"))
+		// The time between the reads isn't taken into account.
+		time.Sleep(100 * time.Millisecond)
+		_, _ = pw.Write([]byte("def"))
+	}()
+
+	buf := make([]byte, 3)
+	_, err := io.ReadFull(r, buf)
+	require.NoError(t, err)
+	time.Sleep(100 * time.Millisecond)
+	_, err = io.ReadFull(r, buf)
+	require.NoError(t, err)
+	assert.Equal(t, "def", string(buf))
+
+	// The stalled read is unblocked, by closing the reader.
+	start := time.Now()
+	_, err = r.Read(buf)
+	require.ErrorIs(t, err, ErrTimeoutExceeded)
+	assert.Less(t, time.Since(start), 10*time.Second)
+	_, err = r.Read(buf)
+	assert.ErrorIs(t, err, ErrTimeoutExceeded)
+
+	// Without timeout, the reader is returned.
+	assert.Equal(t, io.Reader(pr), NewIdleTimeoutReader(pr, pr, 0))
+}
@@ -1,15 +1,18 @@
 // Package transport includes the implementation for different transport
 // protocols.
 //
-// `Client` can be used to fetch and send packfiles to a git server.
-// The `client` package provides higher level functions to instantiate the
-// appropriate `Client` based on the repository URL.
+// A Transport opens the sessions with the git servers of the endpoints of its
+// scheme, the fetches and the pushes running the upload-pack and the
+// receive-pack services over their connections. The transport of the scheme
+// of an endpoint is the one registered for it with Register, and returned by
+// Get: go-git is released with the file, git, http, https and ssh ones,
+// registered by their packages, but you can register your own, for a custom
+// scheme, or in place of a built-in one.
 //
-// go-git supports HTTP and SSH (see `Protocols`), but you can also install
-// your own protocols (see the `client` package).
-//
-// Each protocol has its own implementation of `Client`, but you should
-// generally not use them directly, use `client.NewClient` instead.
+// A transport running the git commands, or talking to a server speaking the
+// git protocol over a stream, is implemented with NewPackTransport, given a
+// Commander starting the commands. The others implement the Session and
+// Connection interfaces.
 package transport
 
 import (
@@ -41,8 +44,15 @@ var (
 
 // Transport can initiate git-upload-pack and git-receive-pack processes.
 // It is implemented both by the client and the server, making this a RPC.
+//
+// The transports are registered for the schemes of their endpoints with
+// Register, for go-git to use them to clone, fetch and push.
 type Transport interface {
-	// NewSession returns a new session for an endpoint.
+	// NewSession returns a new session for an endpoint. The storer is the
+	// local repository, the one the objects are fetched to, or pushed from,
+	// and the auth method the one of the options of the operation, if any.
+	// The session is handshaken with UploadPackService to fetch, and with
+	// ReceivePackService to push.
 	NewSession(storage.Storer, *Endpoint, AuthMethod) (Session, error)
 
 	// SupportedProtocols returns a list of supported Git protocol versions by
@@ -65,6 +75,9 @@ type Endpoint struct {
 	CaBundle []byte
 	// Proxy provides info required for connecting to a proxy.
 	Proxy ProxyOptions
+	// Timeouts bounds the time waiting for the server, the ones of the
+	// transport being used in place of the zero ones.
+	Timeouts TimeoutOptions
 }
 
 type ProxyOptions struct {
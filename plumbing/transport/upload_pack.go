@@ -2,10 +2,13 @@ package transport
 
 import (
 	"bufio"
+	"bytes"
 	"context"
+	"errors"
 	"fmt"
 	"io"
 	"math"
+	"time"
 
 	"github.com/go-git/go-git/v6/plumbing"
 	"github.com/go-git/go-git/v6/plumbing/format/packfile"
@@ -17,6 +20,7 @@ import (
 	"github.com/go-git/go-git/v6/plumbing/protocol/packp/sideband"
 	"github.com/go-git/go-git/v6/plumbing/revlist"
 	"github.com/go-git/go-git/v6/storage"
+	"github.com/go-git/go-git/v6/storage/namespace"
 	"github.com/go-git/go-git/v6/utils/ioutil"
 )
 
@@ -25,9 +29,20 @@ type UploadPackOptions struct {
 	GitProtocol   string
 	AdvertiseRefs bool
 	StatelessRPC  bool
+	// Namespace, if not empty, is the git namespace whose references are
+	// served, as GIT_NAMESPACE does: the reference refs/heads/main is
+	// stored as refs/namespaces/<namespace>/refs/heads/main.
+	Namespace string
 }
 
 // UploadPack is a server command that serves the upload-pack service.
+//
+// The objects the client has in common with the server are negotiated as
+// git-upload-pack does, with the multi_ack and multi_ack_detailed
+// capabilities, and the packfile is then sent, multiplexed if the client
+// requested side-band or side-band-64k, and using offset deltas if it
+// supports ofs-delta. Shallow clients can deepen their history with a depth,
+// which is relative to their shallow commits with deepen-relative.
 func UploadPack(
 	ctx context.Context,
 	st storage.Storer,
@@ -45,6 +60,15 @@ func UploadPack(
 		opts = &UploadPackOptions{}
 	}
 
+	st, err := namespace.NewStorage(st, opts.Namespace)
+	if err != nil {
+		return err
+	}
+
+	// As git-upload-pack, the objects are served as they are stored,
+	// whatever the replace references.
+	st = storage.NoReplaceObjects(st)
+
 	if opts.AdvertiseRefs || !opts.StatelessRPC {
 		switch version := ProtocolVersion(opts.GitProtocol); version {
 		case protocol.V1:
@@ -86,156 +110,29 @@ func UploadPack(
 		return nil
 	}
 
-	var done bool
-	var haves []plumbing.Hash
-	var upreq *packp.UploadRequest
-	var havesWithRef map[plumbing.Hash][]plumbing.Hash
-	var multiAck, multiAckDetailed bool
-	var caps *capability.List
-	var wants []plumbing.Hash
-	firstRound := true
-	for !done {
-		writec := make(chan error)
-		if firstRound || opts.StatelessRPC {
-			upreq = packp.NewUploadRequest()
-			if err := upreq.Decode(rd); err != nil {
-				return fmt.Errorf("decoding upload-request: %w", err)
-			}
-
-			wants = upreq.Wants
-			caps = upreq.Capabilities
-
-			if err := r.Close(); err != nil {
-				return fmt.Errorf("closing reader: %w", err)
-			}
-
-			// Find common commits/objects
-			havesWithRef, err = revlist.ObjectsWithRef(st, wants, nil)
-			if err != nil {
-				return fmt.Errorf("getting objects with ref: %w", err)
-			}
-
-			// Encode objects to packfile and write to client
-			multiAck = caps.Supports(capability.MultiACK)
-			multiAckDetailed = caps.Supports(capability.MultiACKDetailed)
-
-			go func() {
-				// TODO: support deepen-since, and deepen-not
-				var shupd packp.ShallowUpdate
-				if !upreq.Depth.IsZero() {
-					switch depth := upreq.Depth.(type) {
-					case packp.DepthCommits:
-						if err := getShallowCommits(st, wants, int(depth), &shupd); err != nil {
-							writec <- fmt.Errorf("getting shallow commits: %w", err)
-							return
-						}
-					default:
-						writec <- fmt.Errorf("unsupported depth type %T", upreq.Depth)
-						return
-					}
-
-					if err := shupd.Encode(w); err != nil {
-						writec <- fmt.Errorf("sending shallow-update: %w", err)
-						return
-					}
-				}
-
-				writec <- nil
-			}()
-		}
-
-		if err := <-writec; err != nil {
-			return err
-		}
-
-		var uphav packp.UploadHaves
-		if err := uphav.Decode(rd); err != nil {
-			return fmt.Errorf("decoding upload-haves: %w", err)
-		}
-
-		if err := r.Close(); err != nil {
-			return fmt.Errorf("closing reader: %w", err)
-		}
-
-		haves = append(haves, uphav.Haves...)
-		done = uphav.Done
-
-		common := map[plumbing.Hash]struct{}{}
-		var ack packp.ACK
-		var acks []packp.ACK
-		for _, hu := range uphav.Haves {
-			refs, ok := havesWithRef[hu]
-			if ok {
-				for _, ref := range refs {
-					common[ref] = struct{}{}
-				}
-			}
-
-			var status packp.ACKStatus
-			if multiAckDetailed {
-				status = packp.ACKCommon
-				if !ok {
-					status = packp.ACKReady
-				}
-			} else if multiAck {
-				status = packp.ACKContinue
-			}
-
-			if ok || multiAck || multiAckDetailed {
-				ack = packp.ACK{Hash: hu, Status: status}
-				acks = append(acks, ack)
-				if !multiAck && !multiAckDetailed {
-					break
-				}
-			}
-		}
-
-		go func() {
-			defer close(writec)
-
-			if len(haves) > 0 {
-				// Encode ACKs to client when we have haves
-				srvrsp := packp.ServerResponse{ACKs: acks}
-				if err := srvrsp.Encode(w); err != nil {
-					writec <- fmt.Errorf("sending acks server-response: %w", err)
-					return
-				}
-			}
-
-			if !done {
-				if multiAck || multiAckDetailed {
-					// Encode a NAK for multi-ack
-					srvrsp := packp.ServerResponse{}
-					if err := srvrsp.Encode(w); err != nil {
-						writec <- fmt.Errorf("sending nak server-response: %w", err)
-						return
-					}
-				}
-			} else if !ack.Hash.IsZero() && (multiAck || multiAckDetailed) {
-				// We're done, send the final ACK
-				ack.Status = 0
-				srvrsp := packp.ServerResponse{ACKs: []packp.ACK{ack}}
-				if err := srvrsp.Encode(w); err != nil {
-					writec <- fmt.Errorf("sending final ack server-response: %w", err)
-					return
-				}
-			} else if ack.Hash.IsZero() {
-				// We don't have multi-ack and there are no haves. Encode a NAK.
-				srvrsp := packp.ServerResponse{}
-				if err := srvrsp.Encode(w); err != nil {
-					writec <- fmt.Errorf("sending final nak server-response: %w", err)
-					return
-				}
-			}
+	upreq := packp.NewUploadRequest()
+	if err := upreq.Decode(rd); err != nil {
+		return fmt.Errorf("decoding upload-request: %w", err)
+	}
 
-			writec <- nil
-		}()
+	caps := upreq.Capabilities
+	shallows, err := sendShallowUpdate(st, w, upreq)
+	if err != nil {
+		return err
+	}
 
-		if err := <-writec; err != nil {
-			return err
-		}
+	neg := &uploadPackNegotiation{
+		st:               st,
+		w:                w,
+		wants:            upreq.Wants,
+		multiAck:         caps.Supports(capability.MultiACK) || caps.Supports(capability.MultiACKDetailed),
+		multiAckDetailed: caps.Supports(capability.MultiACKDetailed),
+		statelessRPC:     opts.StatelessRPC,
+	}
 
-		firstRound = false
+	done, err := neg.negotiate(rd)
+	if err != nil {
+		return err
 	}
 
 	// Done with the request, now close the reader
@@ -244,7 +141,13 @@ func UploadPack(
 		return fmt.Errorf("closing reader: %w", err)
 	}
 
-	objs, err := objectsToUpload(st, wants, haves)
+	// A stateless client sends a new request for each round of the
+	// negotiation, the pack being only sent once it is done.
+	if !done {
+		return w.Close()
+	}
+
+	objs, err := objectsToUpload(st, append(upreq.Wants, shallows.wants...), neg.haves, shallows.shallows, upreq.Shallows)
 	if err != nil {
 		w.Close() //nolint:errcheck
 		return fmt.Errorf("getting objects to upload: %w", err)
@@ -262,11 +165,20 @@ func UploadPack(
 		useSideband = true
 	}
 
-	// TODO: Support shallow-file
+	cfg, err := st.Config()
+	if err != nil {
+		return err
+	}
+
 	// TODO: Support thin-pack
-	e := packfile.NewEncoder(writer, st, false)
-	_, err = e.Encode(objs, 10)
+	e := packfile.NewEncoder(writer, st, !caps.Supports(capability.OFSDelta), packfile.WithMaxDeltaDepth(cfg.Pack.Depth))
+	_, err = e.Encode(objs, cfg.Pack.Window)
 	if err != nil {
+		if useSideband {
+			// The client is told why the pack is truncated.
+			writer.(*sideband.Muxer).WriteChannel(sideband.ErrorMessage, []byte(err.Error())) //nolint:errcheck
+		}
+
 		return fmt.Errorf("encoding packfile: %w", err)
 	}
 
@@ -283,75 +195,556 @@ func UploadPack(
 	return nil
 }
 
-func objectsToUpload(st storage.Storer, wants, haves []plumbing.Hash) ([]plumbing.Hash, error) {
-	return revlist.Objects(st, wants, haves)
+// uploadPackNegotiation finds the objects which the client of UploadPack has
+// in common with the server, acknowledging them as git-upload-pack does.
+type uploadPackNegotiation struct {
+	st    storage.Storer
+	w     io.Writer
+	wants []plumbing.Hash
+
+	multiAck, multiAckDetailed bool
+	statelessRPC               bool
+
+	// out are the responses to the haves of the batch being read. They are
+	// only written once the batch ends, as clients may only read them once
+	// they sent the whole batch.
+	out bytes.Buffer
+	// haves are the common objects, in the order they were received.
+	haves []plumbing.Hash
+	seen  map[plumbing.Hash]bool
+	// reached are the wants from which a common commit is reachable.
+	reached map[plumbing.Hash]bool
 }
 
-func getShallowCommits(st storage.Storer, heads []plumbing.Hash, depth int, upd *packp.ShallowUpdate) error {
-	var i, curDepth int
-	var commit *object.Commit
-	depths := map[*object.Commit]int{}
-	stack := []object.Object{}
-
-	for commit != nil || i < len(heads) || len(stack) > 0 {
-		if commit == nil {
-			if i < len(heads) {
-				obj, err := st.EncodedObject(plumbing.CommitObject, heads[i])
-				i++
+// negotiate reads the haves of the client, until it is done or, in the
+// stateless mode, until the end of its request, returning whether the client
+// is done.
+//
+// With multi_ack_detailed, the common objects are acknowledged with "ACK
+// <hash> common", and the client is told to stop sending haves with "ACK
+// <hash> ready" once a common commit is reachable from all the wants. Each
+// flush is answered with a NAK, unless the client does not support multi_ack
+// and a common object was already acknowledged, and the final "done" with an
+// ACK of the last common object, or a NAK if there is none.
+func (n *uploadPackNegotiation) negotiate(rd io.Reader) (bool, error) {
+	var gotCommon, gotOther bool
+	var last plumbing.Hash
+	for {
+		l, line, err := pktline.ReadLine(rd)
+		if err == io.EOF && n.statelessRPC {
+			// The request ends without a flush when the client only asked
+			// for the shallow update.
+			return false, nil
+		}
+
+		if err != nil {
+			return false, fmt.Errorf("decoding upload-haves: %w", err)
+		}
+
+		if l == pktline.Flush {
+			if n.multiAckDetailed && gotCommon && !gotOther {
+				ready, err := n.okToGiveUp()
 				if err != nil {
-					continue
+					return false, err
 				}
 
-				commit, err = object.DecodeCommit(st, obj)
-				if err != nil {
-					commit = nil
-					continue
+				if ready {
+					if err := n.ack(last, packp.ACKReady); err != nil {
+						return false, err
+					}
 				}
+			}
 
-				depths[commit] = 0
-				curDepth = 0
-			} else if len(stack) > 0 {
-				commit = stack[len(stack)-1].(*object.Commit)
-				stack = stack[:len(stack)-1]
-				curDepth = depths[commit]
+			if len(n.haves) == 0 || n.multiAck {
+				if err := n.nak(); err != nil {
+					return false, err
+				}
+			}
+
+			if err := n.flush(); err != nil {
+				return false, err
 			}
-		}
 
-		curDepth++
+			if n.statelessRPC {
+				return false, nil
+			}
 
-		if depth != math.MaxInt && curDepth >= depth {
-			upd.Shallows = append(upd.Shallows, commit.Hash)
-			commit = nil
+			gotCommon, gotOther = false, false
 			continue
 		}
 
-		upd.Unshallows = append(upd.Unshallows, commit.Hash)
+		line = bytes.TrimSuffix(line, []byte("\n"))
+		if bytes.Equal(line, []byte("done")) {
+			switch {
+			case len(n.haves) == 0:
+				err = n.nak()
+			case n.multiAck:
+				err = n.ack(last, 0)
+			}
 
-		parents := commit.Parents()
-		commit = nil
-		for {
-			parent, err := parents.Next()
-			if err == io.EOF {
-				break
+			if err != nil {
+				return false, err
 			}
+
+			return true, n.flush()
+		}
+
+		arg, ok := bytes.CutPrefix(line, []byte("have "))
+		if !ok {
+			return false, fmt.Errorf("expected have list, got %q", line)
+		}
+
+		h, ok := plumbing.FromHex(string(arg))
+		if !ok {
+			return false, fmt.Errorf("invalid have line: %q", line)
+		}
+
+		if err := n.st.HasEncodedObject(h); err != nil {
+			// The client has an object we do not have.
+			gotOther = true
+			if !n.multiAck {
+				continue
+			}
+
+			ready, err := n.okToGiveUp()
 			if err != nil {
-				return err
+				return false, err
 			}
 
-			if depths[parent] != 0 && curDepth >= depths[parent] {
+			if !ready {
 				continue
 			}
 
-			depths[parent] = curDepth
+			status := packp.ACKContinue
+			if n.multiAckDetailed {
+				status = packp.ACKReady
+			}
 
-			if _, err := parents.Next(); err == nil {
-				stack = append(stack, parent)
-			} else {
-				commit = parent
-				curDepth = depths[commit]
+			if err := n.ack(h, status); err != nil {
+				return false, err
 			}
+
+			continue
+		}
+
+		gotCommon = true
+		last = h
+		if !n.seen[h] {
+			if n.seen == nil {
+				n.seen = make(map[plumbing.Hash]bool)
+			}
+
+			n.seen[h] = true
+			n.haves = append(n.haves, h)
+		}
+
+		switch {
+		case n.multiAckDetailed:
+			err = n.ack(h, packp.ACKCommon)
+		case n.multiAck:
+			err = n.ack(h, packp.ACKContinue)
+		case len(n.haves) == 1:
+			err = n.ack(h, 0)
 		}
+
+		if err != nil {
+			return false, err
+		}
+	}
+}
+
+func (n *uploadPackNegotiation) ack(h plumbing.Hash, status packp.ACKStatus) error {
+	srvrsp := packp.ServerResponse{ACKs: []packp.ACK{{Hash: h, Status: status}}}
+	if err := srvrsp.Encode(&n.out); err != nil {
+		return fmt.Errorf("sending ack server-response: %w", err)
+	}
+
+	return nil
+}
+
+func (n *uploadPackNegotiation) nak() error {
+	srvrsp := packp.ServerResponse{}
+	if err := srvrsp.Encode(&n.out); err != nil {
+		return fmt.Errorf("sending nak server-response: %w", err)
 	}
 
 	return nil
 }
+
+// flush writes the responses to the haves of the batch.
+func (n *uploadPackNegotiation) flush() error {
+	if n.out.Len() == 0 {
+		return nil
+	}
+
+	defer n.out.Reset()
+	if _, err := n.w.Write(n.out.Bytes()); err != nil {
+		return fmt.Errorf("sending server-response: %w", err)
+	}
+
+	return nil
+}
+
+// okToGiveUp returns whether a common commit is reachable from all the
+// commits wanted by the client, the commits older than all the common ones
+// not being walked. The wants which are not commits are ignored.
+func (n *uploadPackNegotiation) okToGiveUp() (bool, error) {
+	if len(n.haves) == 0 {
+		return false, nil
+	}
+
+	var oldest time.Time
+	for _, h := range n.haves {
+		c, err := object.GetCommit(n.st, h)
+		if err != nil {
+			continue
+		}
+
+		if oldest.IsZero() || c.Committer.When.Before(oldest) {
+			oldest = c.Committer.When
+		}
+	}
+
+	if oldest.IsZero() {
+		return false, nil
+	}
+
+	if n.reached == nil {
+		n.reached = make(map[plumbing.Hash]bool)
+	}
+
+	for _, want := range n.wants {
+		if n.reached[want] {
+			continue
+		}
+
+		c, err := wantedCommit(n.st, want)
+		if err != nil {
+			return false, err
+		}
+
+		if c != nil {
+			ok, err := n.reachesCommon(c, oldest)
+			if err != nil || !ok {
+				return false, err
+			}
+		}
+
+		n.reached[want] = true
+	}
+
+	return true, nil
+}
+
+// reachesCommon returns whether a common commit is reachable from c, not
+// walking the commits older than oldest.
+func (n *uploadPackNegotiation) reachesCommon(c *object.Commit, oldest time.Time) (bool, error) {
+	visited := map[plumbing.Hash]bool{c.Hash: true}
+	pending := []*object.Commit{c}
+	for len(pending) > 0 {
+		c := pending[len(pending)-1]
+		pending = pending[:len(pending)-1]
+		if n.seen[c.Hash] {
+			return true, nil
+		}
+
+		if c.Committer.When.Before(oldest) {
+			continue
+		}
+
+		for _, p := range c.ParentHashes {
+			if visited[p] {
+				continue
+			}
+
+			visited[p] = true
+			parent, err := object.GetCommit(n.st, p)
+			if errors.Is(err, plumbing.ErrObjectNotFound) {
+				// The parents of the shallow commits are missing.
+				continue
+			}
+
+			if err != nil {
+				return false, err
+			}
+
+			pending = append(pending, parent)
+		}
+	}
+
+	return false, nil
+}
+
+// wantedCommit returns the commit the object h points to, following the tags,
+// or nil if it is not a commit.
+func wantedCommit(st storage.Storer, h plumbing.Hash) (*object.Commit, error) {
+	obj, err := object.GetObject(st, h)
+	if err != nil {
+		return nil, err
+	}
+
+	c, err := object.PeelToCommit(obj)
+	if errors.Is(err, plumbing.ErrInvalidType) {
+		return nil, nil
+	}
+
+	return c, err
+}
+
+// uploadPackShallows are the shallow commits of the client of UploadPack once
+// the shallow update is applied, and the parents of the commits it
+// unshallows, which are wanted, in addition to the wants of the client.
+type uploadPackShallows struct {
+	shallows []plumbing.Hash
+	wants    []plumbing.Hash
+}
+
+// sendShallowUpdate sends the shallow update of a client requesting a depth,
+// which lists its new shallow commits, and the ones which are no longer
+// shallow. Nothing is sent if no depth is requested. With deepen-relative, the
+// depth is relative to the current shallow commits of the client.
+func sendShallowUpdate(st storage.Storer, w io.Writer, upreq *packp.UploadRequest) (*uploadPackShallows, error) {
+	clientShallows := make(map[plumbing.Hash]bool, len(upreq.Shallows))
+	for _, h := range upreq.Shallows {
+		clientShallows[h] = true
+	}
+
+	shallows := &uploadPackShallows{}
+	if upreq.Depth.IsZero() {
+		shallows.shallows = upreq.Shallows
+		return shallows, nil
+	}
+
+	// TODO: support deepen-since, and deepen-not
+	depth, ok := upreq.Depth.(packp.DepthCommits)
+	if !ok {
+		return nil, fmt.Errorf("unsupported depth type %T", upreq.Depth)
+	}
+
+	heads, d := upreq.Wants, int(depth)
+	if upreq.Capabilities.Supports(capability.DeepenRelative) && d < infiniteDepth {
+		// The depth is counted from the shallow commits of the client.
+		heads, d = nil, d+1
+		for _, h := range upreq.Shallows {
+			if st.HasEncodedObject(h) == nil {
+				heads = append(heads, h)
+			}
+		}
+	}
+
+	boundary, notShallow, err := getShallowCommits(st, heads, d)
+	if err != nil {
+		return nil, fmt.Errorf("getting shallow commits: %w", err)
+	}
+
+	var shupd packp.ShallowUpdate
+	for _, c := range boundary {
+		shallows.shallows = append(shallows.shallows, c.Hash)
+		if !clientShallows[c.Hash] {
+			shupd.Shallows = append(shupd.Shallows, c.Hash)
+		}
+	}
+
+	for _, c := range notShallow {
+		if !clientShallows[c.Hash] {
+			continue
+		}
+
+		shupd.Unshallows = append(shupd.Unshallows, c.Hash)
+		shallows.wants = append(shallows.wants, c.ParentHashes...)
+	}
+
+	if err := shupd.Encode(w); err != nil {
+		return nil, fmt.Errorf("sending shallow-update: %w", err)
+	}
+
+	return shallows, nil
+}
+
+// infiniteDepth is the depth requested by the clients fetching the whole
+// history, as with git fetch --unshallow.
+const infiniteDepth = math.MaxInt32
+
+// getShallowCommits returns the commits at the given depth from the heads,
+// which are the shallow commits of a client fetching the heads with that
+// depth, and the commits above them.
+func getShallowCommits(st storage.Storer, heads []plumbing.Hash, depth int) (shallow, notShallow []*object.Commit, err error) {
+	// The commits are walked breadth first, so that they are visited at
+	// their smallest depth.
+	var pending []*object.Commit
+	visited := make(map[plumbing.Hash]bool)
+	depths := make(map[plumbing.Hash]int)
+	for _, h := range heads {
+		c, err := wantedCommit(st, h)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		if c == nil || visited[c.Hash] {
+			continue
+		}
+
+		visited[c.Hash] = true
+		pending = append(pending, c)
+	}
+
+	for len(pending) > 0 {
+		c := pending[0]
+		pending = pending[1:]
+		d := depths[c.Hash] + 1
+		if depth < infiniteDepth && d >= depth {
+			shallow = append(shallow, c)
+			continue
+		}
+
+		notShallow = append(notShallow, c)
+		for _, p := range c.ParentHashes {
+			if visited[p] {
+				continue
+			}
+
+			visited[p] = true
+			parent, err := object.GetCommit(st, p)
+			if errors.Is(err, plumbing.ErrObjectNotFound) {
+				// The server may be shallow itself.
+				continue
+			}
+
+			if err != nil {
+				return nil, nil, err
+			}
+
+			depths[p] = d
+			pending = append(pending, parent)
+		}
+	}
+
+	return shallow, notShallow, nil
+}
+
+// objectsToUpload returns the objects reachable from the wants but not from
+// the haves. The history reachable from the wants is not walked past the
+// shallow commits, and the history reachable from the haves past the shallow
+// commits of the client, whose parents it does not have.
+func objectsToUpload(st storage.Storer, wants, haves, shallows, clientShallows []plumbing.Hash) ([]plumbing.Hash, error) {
+	if len(shallows) == 0 && len(clientShallows) == 0 {
+		return revlist.Objects(st, wants, haves)
+	}
+
+	haveCommits, haveObjs, err := walkShallowHistory(st, haves, clientShallows, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	wantCommits, wantObjs, err := walkShallowHistory(st, wants, shallows, haveCommits)
+	if err != nil {
+		return nil, err
+	}
+
+	var objs, ignore, result []plumbing.Hash
+	for _, c := range haveCommits {
+		ignore = append(ignore, c.TreeHash)
+	}
+
+	for _, h := range haveObjs {
+		ignore = append(ignore, h)
+	}
+
+	for _, c := range wantCommits {
+		objs = append(objs, c.TreeHash)
+		result = append(result, c.Hash)
+	}
+
+	seen := make(map[plumbing.Hash]bool, len(haveObjs))
+	for _, h := range haveObjs {
+		seen[h] = true
+	}
+
+	for _, h := range wantObjs {
+		if seen[h] {
+			continue
+		}
+
+		seen[h] = true
+		obj, err := st.EncodedObject(plumbing.AnyObject, h)
+		if err != nil {
+			return nil, err
+		}
+
+		if obj.Type() == plumbing.TagObject {
+			result = append(result, h)
+		} else {
+			objs = append(objs, h)
+		}
+	}
+
+	trees, err := revlist.Objects(st, objs, ignore)
+	if err != nil {
+		return nil, err
+	}
+
+	return append(result, trees...), nil
+}
+
+// walkShallowHistory returns the commits reachable from the given objects,
+// not walking past the shallow commits nor the commits in stop, and the tags
+// and the objects other than commits they point to.
+func walkShallowHistory(
+	st storage.Storer,
+	from, shallows []plumbing.Hash,
+	stop map[plumbing.Hash]*object.Commit,
+) (map[plumbing.Hash]*object.Commit, []plumbing.Hash, error) {
+	isShallow := make(map[plumbing.Hash]bool, len(shallows))
+	for _, h := range shallows {
+		isShallow[h] = true
+	}
+
+	commits := make(map[plumbing.Hash]*object.Commit)
+	var objs []plumbing.Hash
+	var pending []plumbing.Hash
+	for _, h := range from {
+		for {
+			obj, err := st.EncodedObject(plumbing.AnyObject, h)
+			if err != nil {
+				return nil, nil, err
+			}
+
+			if obj.Type() == plumbing.CommitObject {
+				pending = append(pending, h)
+				break
+			}
+
+			objs = append(objs, h)
+			if obj.Type() != plumbing.TagObject {
+				break
+			}
+
+			tag, err := object.DecodeTag(st, obj)
+			if err != nil {
+				return nil, nil, err
+			}
+
+			h = tag.Target
+		}
+	}
+
+	for len(pending) > 0 {
+		h := pending[len(pending)-1]
+		pending = pending[:len(pending)-1]
+		if commits[h] != nil || stop[h] != nil {
+			continue
+		}
+
+		c, err := object.GetCommit(st, h)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		commits[h] = c
+		if !isShallow[h] {
+			pending = append(pending, c.ParentHashes...)
+		}
+	}
+
+	return commits, objs, nil
+}
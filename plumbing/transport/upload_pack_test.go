@@ -2,6 +2,7 @@ package transport
 
 import (
 	"bytes"
+	"encoding/binary"
 	"io"
 	"testing"
 
@@ -11,8 +12,10 @@ import (
 
 	"github.com/go-git/go-git/v6/plumbing"
 	"github.com/go-git/go-git/v6/plumbing/cache"
+	"github.com/go-git/go-git/v6/plumbing/object"
 	"github.com/go-git/go-git/v6/plumbing/protocol/packp"
 	"github.com/go-git/go-git/v6/plumbing/protocol/packp/capability"
+	"github.com/go-git/go-git/v6/plumbing/revlist"
 	"github.com/go-git/go-git/v6/storage/filesystem"
 )
 
@@ -66,3 +69,96 @@ func (s *UploadPackSuite) TestUploadPackAlwaysUseSidebandWhenAvailable() {
 	expected := "0008NAK\n0009\x01PACK" // NAK response + sideband pack header + PACK marker
 	s.Equal(expected, buf.String()[:len(expected)], "pack file should be sent via sideband")
 }
+
+func (s *UploadPackSuite) TestUploadPackNegotiation() {
+	dot := fixtures.Basic().One().DotGit(fixtures.WithTargetDir(s.T().TempDir))
+	st := filesystem.NewStorage(dot, cache.NewObjectLRUDefault())
+	opts := &UploadPackOptions{StatelessRPC: true}
+	master := plumbing.NewHash("6ecf0ef2c2dffb796033e5a02219af86ec6584e5")
+	common := plumbing.NewHash("918c48b83bd081e863dbe1b80f8998f058cd8294")
+	unknown := plumbing.NewHash("ffffffffffffffffffffffffffffffffffffffff")
+
+	request := func(done bool, haves ...plumbing.Hash) io.ReadCloser {
+		upreq := packp.NewUploadRequest()
+		upreq.Wants = []plumbing.Hash{master}
+		upreq.Capabilities.Add(capability.MultiACKDetailed)
+		upreq.Capabilities.Add(capability.OFSDelta)
+
+		var buf bytes.Buffer
+		s.Require().NoError(upreq.Encode(&buf))
+		uphav := packp.UploadHaves{Haves: haves, Done: done}
+		s.Require().NoError(uphav.Encode(&buf))
+		return io.NopCloser(&buf)
+	}
+
+	// The common commit is acknowledged, and the client is told it can stop
+	// sending haves as the want is reachable from it.
+	buf := testServe(s.T(), st, UploadPack, request(false, common, unknown), opts)
+	s.Equal("0038ACK "+common.String()+" common\n"+
+		"0037ACK "+unknown.String()+" ready\n"+
+		"0008NAK\n", buf.String())
+
+	buf = testServe(s.T(), st, UploadPack, request(true, common), opts)
+	expected := "0038ACK " + common.String() + " common\n" +
+		"0031ACK " + common.String() + "\n"
+	s.Require().Equal(expected, buf.String()[:len(expected)])
+	s.Equal("PACK", buf.String()[len(expected):len(expected)+4])
+}
+
+func (s *UploadPackSuite) TestUploadPackShallow() {
+	dot := fixtures.Basic().One().DotGit(fixtures.WithTargetDir(s.T().TempDir))
+	st := filesystem.NewStorage(dot, cache.NewObjectLRUDefault())
+	master := plumbing.NewHash("6ecf0ef2c2dffb796033e5a02219af86ec6584e5")
+
+	upreq := packp.NewUploadRequest()
+	upreq.Wants = []plumbing.Hash{master}
+	upreq.Depth = packp.DepthCommits(1)
+	upreq.Capabilities.Add(capability.MultiACKDetailed)
+	upreq.Capabilities.Add(capability.Shallow)
+
+	var req bytes.Buffer
+	s.Require().NoError(upreq.Encode(&req))
+	s.Require().NoError((&packp.UploadHaves{Done: true}).Encode(&req))
+	buf := testServe(s.T(), st, UploadPack, io.NopCloser(&req), &UploadPackOptions{StatelessRPC: true})
+
+	expected := "0035shallow " + master.String() + "\n0000" + "0008NAK\n"
+	s.Require().Equal(expected, buf.String()[:len(expected)])
+
+	// Only the objects of the shallow commit are sent.
+	c, err := object.GetCommit(st, master)
+	s.Require().NoError(err)
+	objs, err := revlist.Objects(st, []plumbing.Hash{c.TreeHash}, nil)
+	s.Require().NoError(err)
+
+	pack := buf.Bytes()[len(expected):]
+	s.Require().Equal("PACK", string(pack[:4]))
+	s.Equal(uint32(len(objs)+1), binary.BigEndian.Uint32(pack[8:12]))
+}
+
+func (s *UploadPackSuite) TestUploadPackNamespace() {
+	dot := fixtures.Basic().One().DotGit(fixtures.WithTargetDir(s.T().TempDir))
+	st := filesystem.NewStorage(dot, cache.NewObjectLRUDefault())
+	branch := plumbing.NewHash("e8d3ffab552895c19b9fcf7aa264d277cde33881")
+	s.Require().NoError(st.SetReference(plumbing.NewHashReference("refs/namespaces/foo/refs/heads/main", branch)))
+	s.Require().NoError(st.SetReference(plumbing.NewSymbolicReference("refs/namespaces/foo/HEAD", "refs/namespaces/foo/refs/heads/main")))
+
+	opts := &UploadPackOptions{AdvertiseRefs: true, Namespace: "foo"}
+	buf := testServe(s.T(), st, UploadPack, io.NopCloser(bytes.NewBuffer(nil)), opts)
+
+	ar := packp.NewAdvRefs()
+	s.Require().NoError(ar.Decode(buf))
+	s.Equal(map[string]plumbing.Hash{"refs/heads/main": branch}, ar.References)
+	s.Require().NotNil(ar.Head)
+	s.Equal(branch, *ar.Head)
+	s.Contains(ar.Capabilities.Get(capability.SymRef), "HEAD:refs/heads/main")
+
+	// The objects reachable from the references of the namespace are served.
+	upreq := packp.NewUploadRequest()
+	upreq.Wants = []plumbing.Hash{branch}
+	var req bytes.Buffer
+	s.Require().NoError(upreq.Encode(&req))
+	s.Require().NoError((&packp.UploadHaves{Done: true}).Encode(&req))
+
+	buf = testServe(s.T(), st, UploadPack, io.NopCloser(&req), &UploadPackOptions{StatelessRPC: true, Namespace: "foo"})
+	s.Equal("0008NAK\nPACK", buf.String()[:12])
+}
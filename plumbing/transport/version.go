@@ -45,3 +45,11 @@ func ProtocolVersion(p string) protocol.Version {
 	}
 	return ver
 }
+
+// VersionParam returns the parameter to pass to Session.Handshake to request
+// the given protocol version from the server. Servers that do not support the
+// requested version answer using protocol v0, which can be checked using
+// Connection.Version.
+func VersionParam(v protocol.Version) string {
+	return "version=" + v.String()
+}
@@ -0,0 +1,142 @@
+package git
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"sync"
+
+	"github.com/go-git/go-git/v6/plumbing"
+	"github.com/go-git/go-git/v6/plumbing/storer"
+	"github.com/go-git/go-git/v6/plumbing/transport"
+)
+
+// ErrNoPromisorRemote is returned by Repository.FetchMissing when the
+// repository is not a partial clone, or when its storer cannot be given the
+// objects fetched on demand.
+var ErrNoPromisorRemote = errors.New("repository has no promisor remote")
+
+// promisor fetches on demand the objects missing from a partial clone, from
+// the promisor remote named by extensions.partialClone.
+type promisor struct {
+	m      sync.Mutex
+	remote *Remote
+	auth   transport.AuthMethod
+}
+
+// fetch fetches the given objects that are still missing from the storer.
+// Fetches are serialized, so concurrent requests for the same object only
+// hit the remote once.
+func (p *promisor) fetch(hashes ...plumbing.Hash) error {
+	p.m.Lock()
+	defer p.m.Unlock()
+
+	var missing []plumbing.Hash
+	seen := make(map[plumbing.Hash]struct{}, len(hashes))
+	for _, h := range hashes {
+		if _, ok := seen[h]; ok {
+			continue
+		}
+
+		seen[h] = struct{}{}
+		if err := p.remote.s.HasEncodedObject(h); errors.Is(err, plumbing.ErrObjectNotFound) {
+			missing = append(missing, h)
+		} else if err != nil {
+			return err
+		}
+	}
+
+	if len(missing) == 0 {
+		return nil
+	}
+
+	return p.remote.fetchObjects(context.Background(), &FetchOptions{Auth: p.auth}, missing)
+}
+
+// setupPromisor enables the lazy fetching of missing objects when the
+// repository is a partial clone and its storer supports it.
+func (r *Repository) setupPromisor(auth transport.AuthMethod) error {
+	ps, ok := r.Storer.(storer.PromisorObjectStorer)
+	if !ok {
+		return nil
+	}
+
+	cfg, err := r.Config()
+	if err != nil {
+		return err
+	}
+
+	name := cfg.Extensions.PartialClone
+	if name == "" {
+		return nil
+	}
+
+	remote, err := r.Remote(name)
+	if errors.Is(err, ErrRemoteNotFound) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	r.promisor = &promisor{remote: remote, auth: auth}
+	ps.SetObjectFetcher(r.promisor.fetch)
+	return nil
+}
+
+// PromisorRemote returns the name of the promisor remote and its filter
+// spec, such as "blob:none", if the repository is a partial clone, in which
+// case the objects missing from it may be fetched from that remote. The
+// promisor remote is the one named by extensions.partialClone, or else the
+// first one by name with remote.<name>.promisor set.
+func (r *Repository) PromisorRemote() (name, filter string, ok bool) {
+	cfg, err := r.Config()
+	if err != nil {
+		return "", "", false
+	}
+
+	if name := cfg.Extensions.PartialClone; name != "" {
+		if remote, ok := cfg.Remotes[name]; ok {
+			return name, remote.PartialCloneFilter, true
+		}
+
+		return name, "", true
+	}
+
+	names := make([]string, 0, len(cfg.Remotes))
+	for name := range cfg.Remotes {
+		names = append(names, name)
+	}
+
+	slices.Sort(names)
+	for _, name := range names {
+		if remote := cfg.Remotes[name]; remote.Promisor {
+			return name, remote.PartialCloneFilter, true
+		}
+	}
+
+	return "", "", false
+}
+
+// FetchMissing fetches in a single request, from the promisor remote of a
+// partial clone, the given objects missing from the repository, such as the
+// blobs needed to read a set of files, instead of letting them be fetched one
+// at a time when read. The objects already in the repository are not fetched.
+// ErrNoPromisorRemote is returned if the repository is not a partial clone.
+func (r *Repository) FetchMissing(hashes []plumbing.Hash) error {
+	if r.promisor == nil {
+		return ErrNoPromisorRemote
+	}
+
+	return r.promisor.fetch(hashes...)
+}
+
+// fetchMissingObjects fetches in a single request the given objects that
+// are missing from a partial clone. It does nothing for other repositories.
+func (r *Repository) fetchMissingObjects(hashes []plumbing.Hash) error {
+	if r.promisor == nil || len(hashes) == 0 {
+		return nil
+	}
+
+	return r.promisor.fetch(hashes...)
+}
@@ -0,0 +1,204 @@
+package git
+
+import (
+	"fmt"
+	"net/http/cgi"
+	"net/http/httptest"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/go-git/go-billy/v6/memfs"
+	fixtures "github.com/go-git/go-git-fixtures/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/go-git/go-git/v6/config"
+	"github.com/go-git/go-git/v6/plumbing"
+	"github.com/go-git/go-git/v6/plumbing/protocol/packp"
+	"github.com/go-git/go-git/v6/storage/memory"
+)
+
+// setupGitHTTPBackend serves the basic fixture with git-http-backend,
+// allowing filters and arbitrary wants as needed by partial clones.
+func setupGitHTTPBackend(t *testing.T) string {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git is not available")
+	}
+
+	base := t.TempDir()
+	repo := filepath.Join(base, "basic.git")
+	src := fixtures.Basic().One().DotGit(fixtures.WithTargetDir(t.TempDir)).Root()
+
+	for _, args := range [][]string{
+		{"clone", "--quiet", "--bare", src, repo},
+		{"-C", repo, "config", "uploadpack.allowFilter", "true"},
+		{"-C", repo, "config", "uploadpack.allowAnySHA1InWant", "true"},
+	} {
+		out, err := exec.Command("git", args...).CombinedOutput()
+		require.NoError(t, err, string(out))
+	}
+
+	return serveGitHTTPBackend(t, base) + "/basic.git"
+}
+
+// serveGitHTTPBackend serves the repositories of the given directory with
+// git-http-backend, and returns the URL of the server.
+func serveGitHTTPBackend(t *testing.T, root string) string {
+	out, err := exec.Command("git", "--exec-path").CombinedOutput()
+	if err != nil {
+		t.Skip("git is not available")
+	}
+
+	server := httptest.NewServer(&cgi.Handler{
+		Path: filepath.Join(strings.TrimSpace(string(out)), "git-http-backend"),
+		Env:  []string{"GIT_HTTP_EXPORT_ALL=true", fmt.Sprintf("GIT_PROJECT_ROOT=%s", root)},
+	})
+	t.Cleanup(server.Close)
+
+	return server.URL
+}
+
+func TestPartialClone(t *testing.T) {
+	url := setupGitHTTPBackend(t)
+
+	r, err := PlainClone(t.TempDir(), &CloneOptions{
+		URL:    url,
+		Filter: packp.FilterBlobNone(),
+	})
+	require.NoError(t, err)
+
+	cfg, err := r.Config()
+	require.NoError(t, err)
+	assert.Equal(t, DefaultRemoteName, cfg.Extensions.PartialClone)
+	assert.True(t, cfg.Remotes[DefaultRemoteName].Promisor)
+	assert.Equal(t, "blob:none", cfg.Remotes[DefaultRemoteName].PartialCloneFilter)
+
+	name, filter, ok := r.PromisorRemote()
+	assert.True(t, ok)
+	assert.Equal(t, DefaultRemoteName, name)
+	assert.Equal(t, "blob:none", filter)
+
+	w, err := r.Worktree()
+	require.NoError(t, err)
+	status, err := w.Status()
+	require.NoError(t, err)
+	assert.True(t, status.IsClean())
+
+	// Blobs not reachable from HEAD are still missing, and fetched on demand.
+	h := plumbing.NewHash("7e59600739c96546163833214c36459e324bad0a")
+	assert.ErrorIs(t, r.Storer.HasEncodedObject(h), plumbing.ErrObjectNotFound)
+
+	blob, err := r.BlobObject(h)
+	require.NoError(t, err)
+	assert.Equal(t, h, blob.Hash)
+	assert.NoError(t, r.Storer.HasEncodedObject(h))
+}
+
+func TestFetchMissing(t *testing.T) {
+	url := setupGitHTTPBackend(t)
+
+	r, err := Clone(memory.NewStorage(), nil, &CloneOptions{
+		URL:    url,
+		Filter: packp.FilterBlobNone(),
+	})
+	require.NoError(t, err)
+
+	hashes := []plumbing.Hash{
+		plumbing.NewHash("d5c0f4ab811897cadf03aec358ae60d21f91c50d"),
+		plumbing.NewHash("7e59600739c96546163833214c36459e324bad0a"),
+		plumbing.NewHash("d5c0f4ab811897cadf03aec358ae60d21f91c50d"),
+	}
+	for _, h := range hashes {
+		assert.ErrorIs(t, r.Storer.HasEncodedObject(h), plumbing.ErrObjectNotFound)
+	}
+
+	require.NoError(t, r.FetchMissing(hashes))
+	for _, h := range hashes {
+		assert.NoError(t, r.Storer.HasEncodedObject(h))
+	}
+
+	// The objects already fetched are not asked again.
+	require.NoError(t, r.FetchMissing(hashes))
+
+	r, err = Init(memory.NewStorage())
+	require.NoError(t, err)
+	assert.ErrorIs(t, r.FetchMissing(hashes), ErrNoPromisorRemote)
+}
+
+func TestPromisorRemote(t *testing.T) {
+	t.Parallel()
+
+	r, err := Init(memory.NewStorage())
+	require.NoError(t, err)
+	_, _, ok := r.PromisorRemote()
+	assert.False(t, ok)
+
+	cfg, err := r.Config()
+	require.NoError(t, err)
+	cfg.Remotes["upstream"] = &config.RemoteConfig{Name: "upstream", URLs: []string{"https://example.com/upstream.git"}}
+	cfg.Remotes["origin"] = &config.RemoteConfig{Name: "origin", URLs: []string{"https://example.com/origin.git"}}
+	require.NoError(t, r.SetConfig(cfg))
+	_, _, ok = r.PromisorRemote()
+	assert.False(t, ok)
+
+	// Without extensions.partialClone, a remote with promisor set is one.
+	cfg.Remotes["upstream"].Promisor = true
+	cfg.Remotes["upstream"].PartialCloneFilter = "tree:0"
+	require.NoError(t, r.SetConfig(cfg))
+	name, filter, ok := r.PromisorRemote()
+	assert.True(t, ok)
+	assert.Equal(t, "upstream", name)
+	assert.Equal(t, "tree:0", filter)
+
+	cfg.Extensions.PartialClone = "origin"
+	require.NoError(t, r.SetConfig(cfg))
+	name, filter, ok = r.PromisorRemote()
+	assert.True(t, ok)
+	assert.Equal(t, "origin", name)
+	assert.Empty(t, filter)
+}
+
+func TestPartialCloneLazyFetch(t *testing.T) {
+	url := setupGitHTTPBackend(t)
+
+	r, err := Clone(memory.NewStorage(), memfs.New(), &CloneOptions{
+		URL:        url,
+		Filter:     packp.FilterBlobNone(),
+		NoCheckout: true,
+	})
+	require.NoError(t, err)
+
+	h := plumbing.NewHash("d5c0f4ab811897cadf03aec358ae60d21f91c50d")
+	assert.ErrorIs(t, r.Storer.HasEncodedObject(h), plumbing.ErrObjectNotFound)
+
+	w, err := r.Worktree()
+	require.NoError(t, err)
+	require.NoError(t, w.Checkout(&CheckoutOptions{Branch: plumbing.Master}))
+
+	assert.NoError(t, r.Storer.HasEncodedObject(h))
+	f, err := w.Filesystem.Stat("go/example.go")
+	require.NoError(t, err)
+	assert.Equal(t, int64(2780), f.Size())
+}
+
+func TestPartialCloneReopen(t *testing.T) {
+	url := setupGitHTTPBackend(t)
+	dir := t.TempDir()
+
+	_, err := PlainClone(dir, &CloneOptions{
+		URL:        url,
+		Filter:     packp.FilterBlobNone(),
+		NoCheckout: true,
+	})
+	require.NoError(t, err)
+
+	r, err := PlainOpen(dir)
+	require.NoError(t, err)
+
+	h := plumbing.NewHash("d3ff53e0564a9f87d8e84b6e28e5060e517008aa")
+	blob, err := r.BlobObject(h)
+	require.NoError(t, err)
+	assert.Equal(t, int64(18), blob.Size)
+}
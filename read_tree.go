@@ -0,0 +1,281 @@
+package git
+
+import (
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+
+	"github.com/go-git/go-git/v6/plumbing"
+	"github.com/go-git/go-git/v6/plumbing/filemode"
+	"github.com/go-git/go-git/v6/plumbing/format/index"
+	"github.com/go-git/go-git/v6/plumbing/object"
+)
+
+// WriteTree writes the trees of the entries of the index to the storer and
+// returns the hash of the root one, as `git write-tree` does. The
+// intent-to-add entries are left out, and ErrUnmergedPaths is returned if the
+// index has unmerged entries.
+func (r *Repository) WriteTree() (plumbing.Hash, error) {
+	idx, err := r.Storer.Index()
+	if err != nil {
+		return plumbing.ZeroHash, err
+	}
+
+	if unmerged := unmergedPaths(idx.Entries); len(unmerged) > 0 {
+		return plumbing.ZeroHash, fmt.Errorf("%w: %s", ErrUnmergedPaths, strings.Join(unmerged, ", "))
+	}
+
+	h := &buildTreeHelper{s: r.Storer}
+	return h.BuildTree(idx, nil)
+}
+
+// ReadTree reads the tree, or the tree of the commit, with the given hash into
+// the index, as `git read-tree` does, the zero hash reading the empty tree.
+// Unless ReadTreeOptions.Merge is set, the index is replaced by the entries of
+// the tree, without stat data.
+//
+// With ReadTreeOptions.Merge, the entries which are left unchanged keep their
+// stat data. With ReadTreeOptions.Head, the index is switched from Head to
+// the tree, keeping the changes staged since Head, as a checkout does, and
+// ErrLocalChanges is returned for the paths whose staged changes would be
+// lost. With ReadTreeOptions.Base too, Head and the tree are merged: the paths
+// changed on one side only are merged, and the others are left unmerged in
+// the index, in the stages of the base, ours and theirs. ErrLocalChanges is
+// returned for the paths whose entries in the index differ from Head.
+//
+// The working tree is left as it is, see Worktree.CheckoutIndex.
+func (r *Repository) ReadTree(hash plumbing.Hash, opts *ReadTreeOptions) error {
+	if opts == nil {
+		opts = &ReadTreeOptions{}
+	}
+
+	if err := opts.Validate(); err != nil {
+		return err
+	}
+
+	base, err := r.treeEntries(opts.Base)
+	if err != nil {
+		return err
+	}
+
+	head, err := r.treeEntries(opts.Head)
+	if err != nil {
+		return err
+	}
+
+	tree, err := r.treeEntries(hash)
+	if err != nil {
+		return err
+	}
+
+	idx, err := r.Storer.Index()
+	if err != nil {
+		return err
+	}
+
+	if !opts.Merge {
+		entries := make([]*index.Entry, 0, len(tree))
+		for _, e := range tree {
+			entries = append(entries, e)
+		}
+
+		setIndexEntries(idx, entries)
+		return r.Storer.SetIndex(idx)
+	}
+
+	if opts.Reset {
+		removeUnmergedEntries(idx, "")
+	} else if unmerged := unmergedPaths(idx.Entries); len(unmerged) > 0 {
+		return fmt.Errorf("%w: %s", ErrUnmergedPaths, strings.Join(unmerged, ", "))
+	}
+
+	current := make(map[string]*index.Entry, len(idx.Entries))
+	for _, e := range idx.Entries {
+		current[e.Name] = e
+	}
+
+	names := make(map[string]struct{}, len(current)+len(tree))
+	for _, m := range []map[string]*index.Entry{current, base, head, tree} {
+		for name := range m {
+			names[name] = struct{}{}
+		}
+	}
+
+	initial := len(idx.Entries) == 0
+	var entries []*index.Entry
+	var rejected []string
+	for _, name := range slices.Sorted(maps.Keys(names)) {
+		i, o, h, m := current[name], base[name], head[name], tree[name]
+
+		var merged []*index.Entry
+		var ok bool
+		switch {
+		case !opts.Base.IsZero():
+			merged, ok = threeWayReadTree(i, o, h, m, opts.Aggressive)
+		case !opts.Head.IsZero():
+			merged, ok = twoWayReadTree(i, h, m, initial)
+		default:
+			merged, ok = readTreeEntry(m, i), true
+		}
+
+		if !ok {
+			rejected = append(rejected, name)
+			continue
+		}
+
+		entries = append(entries, merged...)
+	}
+
+	if len(rejected) > 0 {
+		return fmt.Errorf("%w: %s", ErrLocalChanges, strings.Join(rejected, ", "))
+	}
+
+	setIndexEntries(idx, entries)
+	return r.Storer.SetIndex(idx)
+}
+
+// twoWayReadTree returns the entries of the path in the index switched from
+// h to m, keeping the staged change i, and false if i would be lost, as
+// described by the "Two Tree Merge" table of git-read-tree(1). The entries of
+// a path are nil if it is missing. initial tells whether the index is empty.
+func twoWayReadTree(i, h, m *index.Entry, initial bool) ([]*index.Entry, bool) {
+	switch {
+	case i == nil:
+		switch {
+		case h == nil:
+			return readTreeEntry(m, nil), true
+		case m == nil:
+			return nil, true
+		case sameEntry(h, m):
+			if initial {
+				return readTreeEntry(m, nil), true
+			}
+
+			return nil, true
+		default:
+			return nil, false
+		}
+	case h == nil && m == nil, sameEntry(h, m), sameEntry(i, m):
+		return []*index.Entry{i}, true
+	case sameEntry(i, h):
+		return readTreeEntry(m, i), true
+	default:
+		return nil, false
+	}
+}
+
+// threeWayReadTree returns the entries of the path in the index from the merge
+// of h and m, whose merge base is o, given its entry i in the index, and
+// false if i differs from h, as git does. The paths which cannot be merged
+// trivially are returned unmerged. The entries of a path are nil if it is
+// missing.
+func threeWayReadTree(i, o, h, m *index.Entry, aggressive bool) ([]*index.Entry, bool) {
+	headMatch := o != nil && sameEntry(o, h)
+	remoteMatch := o != nil && sameEntry(o, m)
+
+	// Changed on their side only. The index may already match the result.
+	if m != nil && headMatch && !remoteMatch {
+		if i != nil && !sameEntry(i, m) && !sameEntry(i, h) {
+			return nil, false
+		}
+
+		return readTreeEntry(m, i), true
+	}
+
+	if i != nil && !sameEntry(i, h) {
+		return nil, false
+	}
+
+	if h != nil && (sameEntry(h, m) || remoteMatch && !headMatch) {
+		return readTreeEntry(h, i), true
+	}
+
+	if h == nil && m == nil && o == nil {
+		return nil, true
+	}
+
+	// Removed on both sides, or on one and unchanged on the other.
+	if aggressive && (h == nil && m == nil || h == nil && remoteMatch || m == nil && headMatch) {
+		return nil, true
+	}
+
+	var entries []*index.Entry
+	for n, e := range []*index.Entry{o, h, m} {
+		if e != nil {
+			entries = append(entries, &index.Entry{
+				Name:  e.Name,
+				Hash:  e.Hash,
+				Mode:  e.Mode,
+				Stage: index.AncestorMode + index.Stage(n),
+			})
+		}
+	}
+
+	return entries, true
+}
+
+// readTreeEntry returns the entry e of a tree read into the index, or the
+// entry i already in the index if they are the same, so that its stat data is
+// kept. Nothing is returned if e is nil.
+func readTreeEntry(e, i *index.Entry) []*index.Entry {
+	switch {
+	case e == nil:
+		return nil
+	case sameEntry(e, i):
+		return []*index.Entry{i}
+	default:
+		return []*index.Entry{e}
+	}
+}
+
+// treeEntries returns the entries of the files of the tree, or of the tree of
+// the commit, with the given hash, by path, none if the hash is zero.
+func (r *Repository) treeEntries(h plumbing.Hash) (map[string]*index.Entry, error) {
+	entries := make(map[string]*index.Entry)
+	t, err := r.treeish(h)
+	if err != nil || t == nil {
+		return entries, err
+	}
+
+	err = t.Walk(func(name string, e object.TreeEntry) error {
+		if e.Mode != filemode.Dir {
+			entries[name] = &index.Entry{Name: name, Hash: e.Hash, Mode: e.Mode}
+		}
+
+		return nil
+	}, object.WalkOptions{})
+
+	return entries, err
+}
+
+// setIndexEntries replaces the entries of the index, sorted by path and stage,
+// invalidating the untracked cache of the paths added or removed.
+func setIndexEntries(idx *index.Index, entries []*index.Entry) {
+	slices.SortFunc(entries, func(a, b *index.Entry) int {
+		if c := strings.Compare(a.Name, b.Name); c != 0 {
+			return c
+		}
+
+		return int(a.Stage) - int(b.Stage)
+	})
+
+	before := make(map[string]bool, len(idx.Entries))
+	for _, e := range idx.Entries {
+		before[e.Name] = true
+	}
+
+	for _, e := range entries {
+		if !before[e.Name] {
+			idx.UntrackedCache.Invalidate(e.Name)
+		}
+
+		delete(before, e.Name)
+	}
+
+	for name := range before {
+		idx.UntrackedCache.Invalidate(name)
+	}
+
+	idx.Entries = entries
+}
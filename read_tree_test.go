@@ -0,0 +1,241 @@
+package git
+
+import (
+	"testing"
+
+	"github.com/go-git/go-billy/v6/memfs"
+	"github.com/go-git/go-billy/v6/util"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/go-git/go-git/v6/plumbing"
+	"github.com/go-git/go-git/v6/plumbing/format/index"
+	"github.com/go-git/go-git/v6/storage/memory"
+)
+
+// readTreeCommit writes the given files to the working tree, the empty ones
+// being removed, and commits them.
+func readTreeCommit(t *testing.T, w *Worktree, files map[string]string) plumbing.Hash {
+	t.Helper()
+
+	for name, content := range files {
+		if content == "" {
+			_, err := w.Remove(name)
+			require.NoError(t, err)
+			continue
+		}
+
+		require.NoError(t, util.WriteFile(w.Filesystem, name, []byte(content), 0o644))
+		_, err := w.Add(name)
+		require.NoError(t, err)
+	}
+
+	h, err := w.Commit("foo\n", &CommitOptions{Author: defaultSignature()})
+	require.NoError(t, err)
+	return h
+}
+
+// indexStages returns the stages of the entries of the index by path, and
+// their contents, such as "1:a1 2:a2".
+func indexStages(t *testing.T, r *Repository) map[string]string {
+	t.Helper()
+
+	idx, err := r.Storer.Index()
+	require.NoError(t, err)
+
+	stages := make(map[string]string)
+	for _, e := range idx.Entries {
+		content, err := r.blobContent(e.Hash)
+		require.NoError(t, err)
+
+		s := string(content)
+		if e.Stage != index.Merged {
+			s = string(rune('0'+e.Stage)) + ":" + s
+		}
+
+		if stages[e.Name] != "" {
+			s = stages[e.Name] + " " + s
+		}
+
+		stages[e.Name] = s
+	}
+
+	return stages
+}
+
+func newReadTreeRepository(t *testing.T) (r *Repository, w *Worktree, base, ours, theirs plumbing.Hash) {
+	t.Helper()
+
+	r, err := Init(memory.NewStorage(), WithWorkTree(memfs.New()))
+	require.NoError(t, err)
+	w, err = r.Worktree()
+	require.NoError(t, err)
+
+	base = readTreeCommit(t, w, map[string]string{"a": "a1", "b": "b1", "dir/d": "d1"})
+	theirs = readTreeCommit(t, w, map[string]string{"a": "a3", "b": "b2", "dir/d": ""})
+	require.NoError(t, w.Reset(&ResetOptions{Commit: base, Mode: HardReset}))
+	ours = readTreeCommit(t, w, map[string]string{"a": "a2", "c": "c1"})
+
+	return r, w, base, ours, theirs
+}
+
+func TestWriteTree(t *testing.T) {
+	t.Parallel()
+
+	r, _, _, ours, _ := newReadTreeRepository(t)
+	c, err := r.CommitObject(ours)
+	require.NoError(t, err)
+
+	h, err := r.WriteTree()
+	require.NoError(t, err)
+	assert.Equal(t, c.TreeHash, h)
+
+	idx, err := r.Storer.Index()
+	require.NoError(t, err)
+	idx.Entries = append(idx.Entries, &index.Entry{Name: "e", Hash: c.TreeHash, Stage: index.OurMode})
+	require.NoError(t, r.Storer.SetIndex(idx))
+
+	_, err = r.WriteTree()
+	assert.ErrorIs(t, err, ErrUnmergedPaths)
+	assert.ErrorContains(t, err, ": e")
+}
+
+func TestReadTree(t *testing.T) {
+	t.Parallel()
+
+	r, _, base, ours, _ := newReadTreeRepository(t)
+
+	require.NoError(t, r.ReadTree(base, nil))
+	assert.Equal(t, map[string]string{"a": "a1", "b": "b1", "dir/d": "d1"}, indexStages(t, r))
+
+	idx, err := r.Storer.Index()
+	require.NoError(t, err)
+	for _, e := range idx.Entries {
+		assert.True(t, e.ModifiedAt.IsZero(), e.Name)
+	}
+
+	require.NoError(t, r.ReadTree(plumbing.ZeroHash, nil))
+	assert.Empty(t, indexStages(t, r))
+
+	// The entries left unchanged by a merge keep their stat data.
+	require.NoError(t, r.ReadTree(ours, nil))
+	idx, err = r.Storer.Index()
+	require.NoError(t, err)
+	for _, e := range idx.Entries {
+		e.Size = 42
+	}
+
+	require.NoError(t, r.Storer.SetIndex(idx))
+	require.NoError(t, r.ReadTree(base, &ReadTreeOptions{Merge: true}))
+
+	idx, err = r.Storer.Index()
+	require.NoError(t, err)
+	sizes := make(map[string]uint32)
+	for _, e := range idx.Entries {
+		sizes[e.Name] = e.Size
+	}
+
+	assert.Equal(t, map[string]uint32{"a": 0, "b": 42, "dir/d": 42}, sizes)
+
+	// Merging requires the conflicts to be resolved first, unless reset.
+	idx.Entries = append(idx.Entries, &index.Entry{Name: "a", Hash: idx.Entries[0].Hash, Stage: index.TheirMode})
+	require.NoError(t, r.Storer.SetIndex(idx))
+	assert.ErrorIs(t, r.ReadTree(base, &ReadTreeOptions{Merge: true}), ErrUnmergedPaths)
+	require.NoError(t, r.ReadTree(base, &ReadTreeOptions{Reset: true}))
+	assert.Equal(t, map[string]string{"a": "a1", "b": "b1", "dir/d": "d1"}, indexStages(t, r))
+
+	assert.ErrorIs(t, r.ReadTree(base, &ReadTreeOptions{Base: base}), ErrBaseRequiresHead)
+}
+
+func TestReadTreeTwoWay(t *testing.T) {
+	t.Parallel()
+
+	r, w, base, ours, _ := newReadTreeRepository(t)
+
+	// The changes staged are kept.
+	require.NoError(t, util.WriteFile(w.Filesystem, "b", []byte("staged"), 0o644))
+	_, err := w.Add("b")
+	require.NoError(t, err)
+
+	require.NoError(t, r.ReadTree(base, &ReadTreeOptions{Head: ours}))
+	assert.Equal(t, map[string]string{"a": "a1", "b": "staged", "dir/d": "d1"}, indexStages(t, r))
+
+	// Unless they would be lost.
+	require.NoError(t, r.ReadTree(ours, nil))
+	require.NoError(t, util.WriteFile(w.Filesystem, "c", []byte("staged"), 0o644))
+	_, err = w.Add("c")
+	require.NoError(t, err)
+
+	err = r.ReadTree(base, &ReadTreeOptions{Head: ours})
+	assert.ErrorIs(t, err, ErrLocalChanges)
+	assert.ErrorContains(t, err, ": c")
+	assert.Equal(t, "staged", indexStages(t, r)["c"])
+}
+
+func TestReadTreeThreeWay(t *testing.T) {
+	t.Parallel()
+
+	r, w, base, ours, theirs := newReadTreeRepository(t)
+
+	require.NoError(t, r.ReadTree(theirs, &ReadTreeOptions{Base: base, Head: ours}))
+	assert.Equal(t, map[string]string{
+		"a":     "1:a1 2:a2 3:a3",
+		"b":     "b2",
+		"c":     "2:c1",
+		"dir/d": "1:d1 2:d1",
+	}, indexStages(t, r))
+
+	_, err := r.WriteTree()
+	assert.ErrorIs(t, err, ErrUnmergedPaths)
+
+	// The trivial merges are written, and the conflicts kept.
+	require.NoError(t, w.CheckoutIndex(&CheckoutIndexOptions{Force: true}))
+	content, err := util.ReadFile(w.Filesystem, "b")
+	require.NoError(t, err)
+	assert.Equal(t, "b2", string(content))
+	assert.Equal(t, "1:a1 2:a2 3:a3", indexStages(t, r)["a"])
+
+	require.NoError(t, r.ReadTree(ours, &ReadTreeOptions{Reset: true}))
+	require.NoError(t, r.ReadTree(theirs, &ReadTreeOptions{Base: base, Head: ours, Aggressive: true}))
+	assert.Equal(t, map[string]string{
+		"a": "1:a1 2:a2 3:a3",
+		"b": "b2",
+		"c": "2:c1",
+	}, indexStages(t, r))
+
+	// The index must match ours.
+	require.NoError(t, r.ReadTree(base, nil))
+	err = r.ReadTree(theirs, &ReadTreeOptions{Base: base, Head: ours})
+	assert.ErrorIs(t, err, ErrLocalChanges)
+	assert.ErrorContains(t, err, ": a")
+}
+
+func TestCheckoutIndex(t *testing.T) {
+	t.Parallel()
+
+	r, w, base, _, _ := newReadTreeRepository(t)
+
+	require.NoError(t, r.ReadTree(base, nil))
+	require.NoError(t, w.CheckoutIndex(nil))
+
+	// The existing files are left as they are, unless forced.
+	content, err := util.ReadFile(w.Filesystem, "a")
+	require.NoError(t, err)
+	assert.Equal(t, "a2", string(content))
+	content, err = util.ReadFile(w.Filesystem, "dir/d")
+	require.NoError(t, err)
+	assert.Equal(t, "d1", string(content))
+
+	require.NoError(t, w.CheckoutIndex(&CheckoutIndexOptions{Paths: []string{"a"}, Force: true}))
+	content, err = util.ReadFile(w.Filesystem, "a")
+	require.NoError(t, err)
+	assert.Equal(t, "a1", string(content))
+
+	// The stat data of the files written is refreshed.
+	status, err := w.StatusWithOptions(StatusOptions{})
+	require.NoError(t, err)
+	assert.Equal(t, Unmodified, status.File("a").Worktree)
+	assert.Equal(t, Untracked, status.File("c").Worktree)
+
+	assert.ErrorIs(t, w.CheckoutIndex(&CheckoutIndexOptions{Paths: []string{"missing"}}), ErrPathSpecNoMatches)
+}
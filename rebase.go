@@ -0,0 +1,542 @@
+package git
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/go-git/go-billy/v6/util"
+
+	"github.com/go-git/go-git/v6/plumbing"
+	"github.com/go-git/go-git/v6/plumbing/format/index"
+	"github.com/go-git/go-git/v6/plumbing/object"
+	"github.com/go-git/go-git/v6/plumbing/storer"
+)
+
+var (
+	// ErrRebaseInProgress is returned by Rebase when a rebase is already in
+	// progress.
+	ErrRebaseInProgress = errors.New("a rebase is already in progress")
+	// ErrNoRebaseInProgress is returned when there is no rebase to continue
+	// or abort.
+	ErrNoRebaseInProgress = errors.New("no rebase in progress")
+	// ErrRebaseConflict is returned when replaying a commit results in
+	// conflicts. Once they are resolved and the files added to the index,
+	// the rebase can be continued with RebaseContinue.
+	ErrRebaseConflict = errors.New("conflicts replaying commit")
+)
+
+// rebaseMergePath is the directory holding the state of a rebase, as used
+// by git.
+const rebaseMergePath = "rebase-merge"
+
+// detachedHeadName is the head-name of a rebase started on a detached HEAD.
+const detachedHeadName = "detached HEAD"
+
+// RebaseState is the state of a rebase in progress, which has stopped on a
+// conflict.
+type RebaseState struct {
+	// HeadName is the branch being rebased, or HEAD if it was detached.
+	HeadName plumbing.ReferenceName
+	// OrigHead is the commit HEAD pointed to before the rebase.
+	OrigHead plumbing.Hash
+	// Onto is the commit the commits are replayed on.
+	Onto plumbing.Hash
+	// Current is the commit being replayed, whose changes conflicted.
+	Current plumbing.Hash
+	// Done are the commits already replayed, including Current.
+	Done []plumbing.Hash
+	// Remaining are the commits to be replayed after Current.
+	Remaining []plumbing.Hash
+	// Committer is the committer of the replayed commits, if given to
+	// Rebase.
+	Committer *object.Signature
+	// Autostash is the stash of the local changes, with
+	// RebaseOptions.Autostash, applied back once the rebase is finished or
+	// aborted.
+	Autostash plumbing.Hash
+}
+
+// Rebase replays the commits of the current branch on top of another
+// commit, as `git rebase <upstream>` does. The changes of each commit are
+// merged into the index and the working tree, and committed with the same
+// author and message. The commits whose changes are already applied are
+// dropped. Once all of them are replayed, the current branch is updated to
+// the last one.
+//
+// If replaying a commit results in conflicts, the rebase stops and returns
+// ErrRebaseConflict, with HEAD detached at the last commit replayed. Its
+// state can be retrieved with RebaseState, and it can be resumed with
+// RebaseContinue once the conflicts are resolved, or cancelled with
+// RebaseAbort.
+//
+// The worktree must not have local changes, unless opts.Autostash is set.
+func (r *Repository) Rebase(opts *RebaseOptions) error {
+	if err := opts.Validate(r); err != nil {
+		return err
+	}
+
+	if _, err := r.RebaseState(); !errors.Is(err, ErrNoRebaseInProgress) {
+		if err == nil {
+			return ErrRebaseInProgress
+		}
+
+		return err
+	}
+
+	w, err := r.Worktree()
+	if err != nil {
+		return err
+	}
+
+	status, err := w.Status()
+	if err != nil {
+		return err
+	}
+
+	dirty := hasLocalChanges(status, false)
+	if dirty && !opts.Autostash {
+		return ErrWorktreeNotClean
+	}
+
+	state := &RebaseState{HeadName: plumbing.HEAD, Onto: opts.Onto, Committer: opts.Committer}
+	head, err := r.Storer.Reference(plumbing.HEAD)
+	if err != nil {
+		return err
+	}
+
+	if head.Type() == plumbing.SymbolicReference {
+		state.HeadName = head.Target()
+	}
+
+	resolved, err := r.Head()
+	if err != nil {
+		return err
+	}
+
+	state.OrigHead = resolved.Hash()
+	if state.Remaining, err = r.rebaseCommits(state.OrigHead, opts.Upstream); err != nil {
+		return err
+	}
+
+	upToDate, err := r.isRebased(state)
+	if err != nil || upToDate {
+		return err
+	}
+
+	if dirty {
+		if state.Autostash, err = w.autostash(opts.Committer); err != nil {
+			return err
+		}
+	}
+
+	if err := w.Checkout(&CheckoutOptions{Hash: state.Onto}); err != nil {
+		return err
+	}
+
+	if err := r.setRebaseState(state); err != nil {
+		return err
+	}
+
+	return r.replayCommits(w, state)
+}
+
+// rebaseCommits returns the commits reachable from head but not from
+// upstream, excluding the merge commits, the oldest first.
+func (r *Repository) rebaseCommits(head, upstream plumbing.Hash) ([]plumbing.Hash, error) {
+	upstreamCommit, err := r.CommitObject(upstream)
+	if err != nil {
+		return nil, err
+	}
+
+	seen := make(map[plumbing.Hash]bool)
+	err = object.NewCommitPreorderIter(upstreamCommit, nil, nil).ForEach(func(c *object.Commit) error {
+		seen[c.Hash] = true
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	headCommit, err := r.CommitObject(head)
+	if err != nil {
+		return nil, err
+	}
+
+	var commits []plumbing.Hash
+	err = object.NewCommitPreorderIter(headCommit, seen, nil).ForEach(func(c *object.Commit) error {
+		if c.NumParents() <= 1 {
+			commits = append(commits, c.Hash)
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	slices.Reverse(commits)
+	return commits, nil
+}
+
+// isRebased returns whether the commits to replay are already on top of
+// Onto, in which case the rebase has nothing to do.
+func (r *Repository) isRebased(state *RebaseState) (bool, error) {
+	parent := state.Onto
+	for _, h := range state.Remaining {
+		c, err := r.CommitObject(h)
+		if err != nil {
+			return false, err
+		}
+
+		if c.NumParents() != 1 || c.ParentHashes[0] != parent {
+			return false, nil
+		}
+
+		parent = h
+	}
+
+	return parent == state.OrigHead, nil
+}
+
+// RebaseContinue resumes the rebase in progress. The commit whose changes
+// conflicted is committed with the content of the index, which must not
+// contain unresolved conflicts, and the remaining commits are replayed.
+func (r *Repository) RebaseContinue() error {
+	state, err := r.RebaseState()
+	if err != nil {
+		return err
+	}
+
+	w, err := r.Worktree()
+	if err != nil {
+		return err
+	}
+
+	idx, err := r.Storer.Index()
+	if err != nil {
+		return err
+	}
+
+	if unmerged := unmergedPaths(idx.Entries); len(unmerged) > 0 {
+		return fmt.Errorf("%w: %s", ErrUnmergedPaths, strings.Join(unmerged, ", "))
+	}
+
+	if !state.Current.IsZero() {
+		c, err := r.CommitObject(state.Current)
+		if err != nil {
+			return err
+		}
+
+		if err := r.commitRebased(w, c, state.Committer); err != nil {
+			return err
+		}
+
+		state.Current = plumbing.ZeroHash
+	}
+
+	return r.replayCommits(w, state)
+}
+
+// RebaseAbort cancels the rebase in progress, restoring HEAD, the index and
+// the working tree to their state before the rebase.
+func (r *Repository) RebaseAbort() error {
+	state, err := r.RebaseState()
+	if err != nil {
+		return err
+	}
+
+	w, err := r.Worktree()
+	if err != nil {
+		return err
+	}
+
+	if state.HeadName != plumbing.HEAD {
+		head := plumbing.NewSymbolicReference(plumbing.HEAD, state.HeadName)
+		if err := r.Storer.SetReference(head); err != nil {
+			return err
+		}
+	}
+
+	if err := w.Reset(&ResetOptions{Commit: state.OrigHead, Mode: HardReset}); err != nil {
+		return err
+	}
+
+	if err := r.setRebaseState(nil); err != nil {
+		return err
+	}
+
+	return w.applyAutostash(state.Autostash)
+}
+
+// replayCommits replays the remaining commits of the rebase, and finishes
+// it once all of them are replayed.
+func (r *Repository) replayCommits(w *Worktree, state *RebaseState) error {
+	for len(state.Remaining) > 0 {
+		c, err := r.CommitObject(state.Remaining[0])
+		if err != nil {
+			return err
+		}
+
+		state.Current = c.Hash
+		state.Done = append(state.Done, c.Hash)
+		state.Remaining = state.Remaining[1:]
+
+		conflicts, err := r.pickCommit(w, c, 0)
+		if err != nil {
+			return err
+		}
+
+		if len(conflicts) > 0 {
+			if err := r.setRebaseState(state); err != nil {
+				return err
+			}
+
+			return fmt.Errorf("%w %s: %s", ErrRebaseConflict, c.Hash, strings.Join(conflicts, ", "))
+		}
+
+		if err := r.commitRebased(w, c, state.Committer); err != nil {
+			return err
+		}
+
+		state.Current = plumbing.ZeroHash
+	}
+
+	if state.HeadName != plumbing.HEAD {
+		head, err := r.Head()
+		if err != nil {
+			return err
+		}
+
+		branch := plumbing.NewHashReference(state.HeadName, head.Hash())
+		if err := r.Storer.SetReference(branch); err != nil {
+			return err
+		}
+
+		if err := r.Storer.SetReference(plumbing.NewSymbolicReference(plumbing.HEAD, state.HeadName)); err != nil {
+			return err
+		}
+	}
+
+	if err := r.setRebaseState(nil); err != nil {
+		return err
+	}
+
+	return w.applyAutostash(state.Autostash)
+}
+
+// commitRebased commits the index with the author and the message of the
+// given commit. Nothing is committed if the index has no changes.
+func (r *Repository) commitRebased(w *Worktree, c *object.Commit, committer *object.Signature) error {
+	_, err := r.commitPicked(w, c, c.Message, committer)
+	if errors.Is(err, ErrEmptyCommit) {
+		return nil
+	}
+
+	return err
+}
+
+func unmergedPaths(entries []*index.Entry) []string {
+	var paths []string
+	for _, e := range entries {
+		if e.Stage != index.Merged && !slices.Contains(paths, e.Name) {
+			paths = append(paths, e.Name)
+		}
+	}
+
+	return paths
+}
+
+// branchUpstream returns the commit of the upstream of the current branch.
+func (r *Repository) branchUpstream() (plumbing.Hash, error) {
+	head, err := r.Storer.Reference(plumbing.HEAD)
+	if err != nil {
+		return plumbing.ZeroHash, err
+	}
+
+	if head.Type() != plumbing.SymbolicReference {
+		return plumbing.ZeroHash, ErrNoUpstream
+	}
+
+	return r.upstream(head.Target().Short())
+}
+
+// RebaseState returns the state of the rebase in progress, or
+// ErrNoRebaseInProgress if there is none.
+//
+// The state is stored in the rebase-merge directory of the repository, as
+// git does, when the storer is backed by a filesystem. Otherwise, it is only
+// kept in memory by the Repository.
+func (r *Repository) RebaseState() (*RebaseState, error) {
+	fss, ok := r.Storer.(storer.FilesystemStorer)
+	if !ok {
+		if r.rebase == nil {
+			return nil, ErrNoRebaseInProgress
+		}
+
+		return r.rebase, nil
+	}
+
+	fs := fss.Filesystem()
+	read := func(name string) (string, error) {
+		b, err := util.ReadFile(fs, fs.Join(rebaseMergePath, name))
+		return strings.TrimSpace(string(b)), err
+	}
+
+	headName, err := read("head-name")
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, ErrNoRebaseInProgress
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	state := &RebaseState{HeadName: plumbing.ReferenceName(headName)}
+	if headName == detachedHeadName {
+		state.HeadName = plumbing.HEAD
+	}
+
+	for name, h := range map[string]*plumbing.Hash{
+		"orig-head":   &state.OrigHead,
+		"onto":        &state.Onto,
+		"stopped-sha": &state.Current,
+		"autostash":   &state.Autostash,
+	} {
+		v, err := read(name)
+		if errors.Is(err, os.ErrNotExist) {
+			continue
+		}
+
+		if err != nil {
+			return nil, err
+		}
+
+		var ok bool
+		if *h, ok = plumbing.FromHex(v); !ok {
+			return nil, fmt.Errorf("malformed %s in rebase state: %q", name, v)
+		}
+	}
+
+	for name, commits := range map[string]*[]plumbing.Hash{
+		"done":            &state.Done,
+		"git-rebase-todo": &state.Remaining,
+	} {
+		v, err := read(name)
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			return nil, err
+		}
+
+		if *commits, err = decodeRebaseTodo(v); err != nil {
+			return nil, err
+		}
+	}
+
+	if v, err := read("committer"); err == nil {
+		state.Committer = &object.Signature{}
+		state.Committer.Decode([]byte(v))
+	} else if !errors.Is(err, os.ErrNotExist) {
+		return nil, err
+	}
+
+	return state, nil
+}
+
+// decodeRebaseTodo decodes the commits of a rebase todo list, in the form
+// "pick <hash> <subject>".
+func decodeRebaseTodo(todo string) ([]plumbing.Hash, error) {
+	var commits []plumbing.Hash
+	sc := bufio.NewScanner(strings.NewReader(todo))
+	for sc.Scan() {
+		line := strings.TrimSpace(sc.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		fields := strings.Fields(line)
+		if len(fields) < 2 || (fields[0] != "pick" && fields[0] != "p") {
+			return nil, fmt.Errorf("unsupported rebase todo line: %q", line)
+		}
+
+		h, ok := plumbing.FromHex(fields[1])
+		if !ok {
+			return nil, fmt.Errorf("malformed rebase todo line: %q", line)
+		}
+
+		commits = append(commits, h)
+	}
+
+	return commits, sc.Err()
+}
+
+// setRebaseState stores the state of the rebase in progress, or removes it
+// if nil.
+func (r *Repository) setRebaseState(state *RebaseState) error {
+	fss, ok := r.Storer.(storer.FilesystemStorer)
+	if !ok {
+		r.rebase = state
+		return nil
+	}
+
+	fs := fss.Filesystem()
+	if state == nil {
+		return util.RemoveAll(fs, rebaseMergePath)
+	}
+
+	headName := state.HeadName.String()
+	if state.HeadName == plumbing.HEAD {
+		headName = detachedHeadName
+	}
+
+	files := map[string]string{
+		"head-name":       headName + "\n",
+		"orig-head":       state.OrigHead.String() + "\n",
+		"onto":            state.Onto.String() + "\n",
+		"done":            encodeRebaseTodo(state.Done),
+		"git-rebase-todo": encodeRebaseTodo(state.Remaining),
+		"msgnum":          strconv.Itoa(len(state.Done)) + "\n",
+		"end":             strconv.Itoa(len(state.Done)+len(state.Remaining)) + "\n",
+		"interactive":     "",
+	}
+
+	if !state.Current.IsZero() {
+		files["stopped-sha"] = state.Current.String() + "\n"
+	} else if err := util.RemoveAll(fs, fs.Join(rebaseMergePath, "stopped-sha")); err != nil {
+		return err
+	}
+
+	if !state.Autostash.IsZero() {
+		files["autostash"] = state.Autostash.String() + "\n"
+	}
+
+	if state.Committer != nil {
+		var buf bytes.Buffer
+		if err := state.Committer.Encode(&buf); err != nil {
+			return err
+		}
+
+		files["committer"] = buf.String() + "\n"
+	}
+
+	for name, content := range files {
+		if err := util.WriteFile(fs, fs.Join(rebaseMergePath, name), []byte(content), 0o644); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func encodeRebaseTodo(commits []plumbing.Hash) string {
+	var buf strings.Builder
+	for _, h := range commits {
+		fmt.Fprintf(&buf, "pick %s\n", h)
+	}
+
+	return buf.String()
+}
@@ -0,0 +1,261 @@
+package git
+
+import (
+	"testing"
+	"time"
+
+	"github.com/go-git/go-billy/v6"
+	"github.com/go-git/go-billy/v6/memfs"
+	"github.com/go-git/go-billy/v6/util"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/go-git/go-git/v6/plumbing"
+	"github.com/go-git/go-git/v6/plumbing/cache"
+	"github.com/go-git/go-git/v6/plumbing/object"
+	"github.com/go-git/go-git/v6/storage"
+	"github.com/go-git/go-git/v6/storage/filesystem"
+	"github.com/go-git/go-git/v6/storage/memory"
+)
+
+// newRebaseRepository returns a repository with a feature branch, checked
+// out, with two commits on top of a base commit, and a master branch with
+// one commit on top of it, changing the given file.
+func newRebaseRepository(t *testing.T, st storage.Storer, masterFile string) (*Repository, billy.Filesystem) {
+	t.Helper()
+
+	fs := memfs.New()
+	r, err := Init(st, WithWorkTree(fs))
+	require.NoError(t, err)
+
+	w, err := r.Worktree()
+	require.NoError(t, err)
+
+	commit := func(msg string, files map[string]string, when time.Time) {
+		for name, content := range files {
+			require.NoError(t, util.WriteFile(fs, name, []byte(content), 0o644))
+			_, err := w.Add(name)
+			require.NoError(t, err)
+		}
+
+		sig := &object.Signature{Name: "foo", Email: "foo@foo.foo", When: when}
+		_, err := w.Commit(msg, &CommitOptions{Author: sig})
+		require.NoError(t, err)
+	}
+
+	when := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	commit("base\n", map[string]string{"a": "a\n", "b": "b\n"}, when)
+	require.NoError(t, w.Checkout(&CheckoutOptions{Branch: "refs/heads/feature", Create: true}))
+	commit("feature 1\n", map[string]string{"a": "feature\n"}, when.Add(time.Hour))
+	commit("feature 2\n", map[string]string{"c": "c\n"}, when.Add(2*time.Hour))
+	require.NoError(t, w.Checkout(&CheckoutOptions{Branch: plumbing.Master}))
+	commit("master\n", map[string]string{masterFile: "master\n"}, when.Add(3*time.Hour))
+	require.NoError(t, w.Checkout(&CheckoutOptions{Branch: "refs/heads/feature"}))
+
+	return r, fs
+}
+
+func TestRebase(t *testing.T) {
+	t.Parallel()
+
+	r, fs := newRebaseRepository(t, memory.NewStorage(), "b")
+
+	master, err := r.Reference(plumbing.Master, false)
+	require.NoError(t, err)
+	orig, err := r.Reference("refs/heads/feature", false)
+	require.NoError(t, err)
+
+	committer := &object.Signature{Name: "bar", Email: "bar@bar.bar", When: time.Now()}
+	require.NoError(t, r.Rebase(&RebaseOptions{Upstream: master.Hash(), Committer: committer}))
+
+	head, err := r.Storer.Reference(plumbing.HEAD)
+	require.NoError(t, err)
+	assert.Equal(t, plumbing.ReferenceName("refs/heads/feature"), head.Target())
+
+	feature, err := r.Reference("refs/heads/feature", false)
+	require.NoError(t, err)
+
+	second, err := r.CommitObject(feature.Hash())
+	require.NoError(t, err)
+	first, err := second.Parent(0)
+	require.NoError(t, err)
+
+	origSecond, err := r.CommitObject(orig.Hash())
+	require.NoError(t, err)
+
+	assert.Equal(t, "feature 2\n", second.Message)
+	assert.Equal(t, "feature 1\n", first.Message)
+	assert.Equal(t, []plumbing.Hash{master.Hash()}, first.ParentHashes)
+	assert.Equal(t, origSecond.Author.When.Unix(), second.Author.When.Unix())
+	assert.Equal(t, "bar", second.Committer.Name)
+
+	for name, content := range map[string]string{"a": "feature\n", "b": "master\n", "c": "c\n"} {
+		data, err := util.ReadFile(fs, name)
+		require.NoError(t, err)
+		assert.Equal(t, content, string(data), name)
+	}
+
+	_, err = r.RebaseState()
+	assert.ErrorIs(t, err, ErrNoRebaseInProgress)
+
+	// Rebasing again has nothing to do.
+	require.NoError(t, r.Rebase(&RebaseOptions{Upstream: master.Hash()}))
+	head, err = r.Head()
+	require.NoError(t, err)
+	assert.Equal(t, feature.Hash(), head.Hash())
+}
+
+func TestRebaseConflict(t *testing.T) {
+	t.Parallel()
+
+	dotgit := memfs.New()
+	r, fs := newRebaseRepository(t, filesystem.NewStorage(dotgit, cache.NewObjectLRUDefault()), "a")
+
+	master, err := r.Reference(plumbing.Master, false)
+	require.NoError(t, err)
+	orig, err := r.Reference("refs/heads/feature", false)
+	require.NoError(t, err)
+
+	err = r.Rebase(&RebaseOptions{Upstream: master.Hash()})
+	require.ErrorIs(t, err, ErrRebaseConflict)
+
+	state, err := r.RebaseState()
+	require.NoError(t, err)
+	assert.Equal(t, plumbing.ReferenceName("refs/heads/feature"), state.HeadName)
+	assert.Equal(t, orig.Hash(), state.OrigHead)
+	assert.Equal(t, master.Hash(), state.Onto)
+	assert.Len(t, state.Done, 1)
+	assert.Equal(t, state.Done[0], state.Current)
+	assert.Len(t, state.Remaining, 1)
+
+	head, err := r.Storer.Reference(plumbing.HEAD)
+	require.NoError(t, err)
+	assert.Equal(t, plumbing.HashReference, head.Type())
+	assert.Equal(t, master.Hash(), head.Hash())
+
+	data, err := util.ReadFile(fs, "a")
+	require.NoError(t, err)
+	assert.Equal(t, "<<<<<<< HEAD\nmaster\n=======\nfeature\n>>>>>>> "+
+		state.Current.String()[:7]+" (feature 1)\n", string(data))
+
+	_, err = util.ReadFile(dotgit, "rebase-merge/head-name")
+	require.NoError(t, err)
+
+	assert.ErrorIs(t, r.Rebase(&RebaseOptions{Upstream: master.Hash()}), ErrRebaseInProgress)
+	assert.ErrorIs(t, r.RebaseContinue(), ErrUnmergedPaths)
+
+	w, err := r.Worktree()
+	require.NoError(t, err)
+	require.NoError(t, util.WriteFile(fs, "a", []byte("resolved\n"), 0o644))
+	_, err = w.Add("a")
+	require.NoError(t, err)
+
+	require.NoError(t, r.RebaseContinue())
+
+	_, err = r.RebaseState()
+	assert.ErrorIs(t, err, ErrNoRebaseInProgress)
+
+	feature, err := r.Reference("refs/heads/feature", false)
+	require.NoError(t, err)
+	second, err := r.CommitObject(feature.Hash())
+	require.NoError(t, err)
+	first, err := second.Parent(0)
+	require.NoError(t, err)
+	assert.Equal(t, "feature 1\n", first.Message)
+	assert.Equal(t, []plumbing.Hash{master.Hash()}, first.ParentHashes)
+
+	f, err := first.File("a")
+	require.NoError(t, err)
+	content, err := f.Contents()
+	require.NoError(t, err)
+	assert.Equal(t, "resolved\n", content)
+
+	status, err := w.Status()
+	require.NoError(t, err)
+	assert.True(t, status.IsClean(), status)
+}
+
+func TestRebaseAbort(t *testing.T) {
+	t.Parallel()
+
+	r, fs := newRebaseRepository(t, memory.NewStorage(), "a")
+
+	assert.ErrorIs(t, r.RebaseAbort(), ErrNoRebaseInProgress)
+	assert.ErrorIs(t, r.RebaseContinue(), ErrNoRebaseInProgress)
+
+	master, err := r.Reference(plumbing.Master, false)
+	require.NoError(t, err)
+	orig, err := r.Reference("refs/heads/feature", false)
+	require.NoError(t, err)
+
+	require.ErrorIs(t, r.Rebase(&RebaseOptions{Upstream: master.Hash()}), ErrRebaseConflict)
+	require.NoError(t, r.RebaseAbort())
+
+	head, err := r.Storer.Reference(plumbing.HEAD)
+	require.NoError(t, err)
+	assert.Equal(t, plumbing.ReferenceName("refs/heads/feature"), head.Target())
+
+	feature, err := r.Reference("refs/heads/feature", false)
+	require.NoError(t, err)
+	assert.Equal(t, orig.Hash(), feature.Hash())
+
+	data, err := util.ReadFile(fs, "a")
+	require.NoError(t, err)
+	assert.Equal(t, "feature\n", string(data))
+
+	w, err := r.Worktree()
+	require.NoError(t, err)
+	status, err := w.Status()
+	require.NoError(t, err)
+	assert.True(t, status.IsClean(), status)
+
+	_, err = r.RebaseState()
+	assert.ErrorIs(t, err, ErrNoRebaseInProgress)
+}
+
+func TestRebaseAutostash(t *testing.T) {
+	t.Parallel()
+
+	dotgit := memfs.New()
+	r, fs := newRebaseRepository(t, filesystem.NewStorage(dotgit, cache.NewObjectLRUDefault()), "a")
+	require.NoError(t, util.WriteFile(fs, "c", []byte("local\n"), 0o644))
+
+	master, err := r.Reference(plumbing.Master, false)
+	require.NoError(t, err)
+
+	committer := &object.Signature{Name: "bar", Email: "bar@bar.bar", When: time.Now()}
+	opts := &RebaseOptions{Upstream: master.Hash(), Committer: committer}
+	require.ErrorIs(t, r.Rebase(opts), ErrWorktreeNotClean)
+
+	opts.Autostash = true
+	require.ErrorIs(t, r.Rebase(opts), ErrRebaseConflict)
+
+	// The stash is kept in the state of the rebase, and applied back once it
+	// is aborted.
+	state, err := r.RebaseState()
+	require.NoError(t, err)
+	assert.False(t, state.Autostash.IsZero())
+
+	data, err := util.ReadFile(dotgit, "rebase-merge/autostash")
+	require.NoError(t, err)
+	assert.Equal(t, state.Autostash.String()+"\n", string(data))
+
+	require.NoError(t, r.RebaseAbort())
+
+	data, err = util.ReadFile(fs, "c")
+	require.NoError(t, err)
+	assert.Equal(t, "local\n", string(data))
+
+	w, err := r.Worktree()
+	require.NoError(t, err)
+	stashes, err := w.StashList()
+	require.NoError(t, err)
+	assert.Empty(t, stashes)
+}
+
+func TestRebaseNoUpstream(t *testing.T) {
+	t.Parallel()
+
+	r, _ := newRebaseRepository(t, memory.NewStorage(), "b")
+	assert.ErrorIs(t, r.Rebase(&RebaseOptions{}), ErrNoUpstream)
+}
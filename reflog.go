@@ -0,0 +1,302 @@
+package git
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/go-git/go-git/v6/config"
+	"github.com/go-git/go-git/v6/internal/revision"
+	"github.com/go-git/go-git/v6/plumbing"
+	"github.com/go-git/go-git/v6/plumbing/format/reflog"
+	"github.com/go-git/go-git/v6/plumbing/object"
+	"github.com/go-git/go-git/v6/plumbing/storer"
+	"github.com/go-git/go-git/v6/storage"
+)
+
+// ErrReflogNotFound is returned when resolving a revision requiring the
+// reflog of a reference without reflog, such as master@{1}.
+var ErrReflogNotFound = errors.New("reflog not found")
+
+// ReflogEntry is an entry of the reflog of a reference, recording one of its
+// updates.
+type ReflogEntry struct {
+	// Old is the hash the reference pointed to before the update, zero when
+	// the reference was created.
+	Old plumbing.Hash
+	// New is the hash the reference points to after the update.
+	New plumbing.Hash
+	// Committer is the identity updating the reference, along with the time
+	// of the update.
+	Committer object.Signature
+	// Message describes the update, such as "commit: <subject>".
+	Message string
+}
+
+// Reflog returns the entries of the reflog of the given reference, the most
+// recent first, as listed by `git reflog`: the n-th entry is the one
+// resolved by the <refname>@{n} revision. No entries are returned when the
+// reference has no reflog, or when the storer does not keep reflogs.
+func (r *Repository) Reflog(name plumbing.ReferenceName) ([]*ReflogEntry, error) {
+	s, ok := r.Storer.(storage.ReflogStorer)
+	if !ok {
+		return nil, nil
+	}
+
+	entries, err := s.Reflog(name)
+	if err != nil {
+		return nil, err
+	}
+
+	result := make([]*ReflogEntry, len(entries))
+	for i, e := range entries {
+		result[len(entries)-1-i] = &ReflogEntry{
+			Old:       e.Old,
+			New:       e.New,
+			Committer: object.Signature{Name: e.Name, Email: e.Email, When: e.When},
+			Message:   e.Message,
+		}
+	}
+
+	return result, nil
+}
+
+func (e *ReflogEntry) encode() *reflog.Entry {
+	return &reflog.Entry{
+		Old:     e.Old,
+		New:     e.New,
+		Name:    e.Committer.Name,
+		Email:   e.Committer.Email,
+		When:    e.Committer.When,
+		Message: e.Message,
+	}
+}
+
+// setReferenceWithLog stores ref, logging its update in its reflog, and in
+// the reflog of HEAD if ref is the current branch. The reflog committer is
+// read from the config when committer is nil.
+func (r *Repository) setReferenceWithLog(ref *plumbing.Reference, committer *object.Signature, msg string) error {
+	old := plumbing.ZeroHash
+	current, err := storer.ResolveReference(r.Storer, ref.Name())
+	switch {
+	case err == nil:
+		old = current.Hash()
+	case !errors.Is(err, plumbing.ErrReferenceNotFound):
+		return err
+	}
+
+	if err := r.Storer.SetReference(ref); err != nil {
+		return err
+	}
+
+	return r.logRefUpdateWithHead(ref.Name(), old, ref.Hash(), committer, msg)
+}
+
+// logRefUpdateWithHead logs the update of the given reference in its reflog,
+// and in the reflog of HEAD if it is the current branch.
+func (r *Repository) logRefUpdateWithHead(name plumbing.ReferenceName, old, new plumbing.Hash, committer *object.Signature, msg string) error {
+	if err := r.logRefUpdate(name, old, new, committer, msg); err != nil {
+		return err
+	}
+
+	if name == plumbing.HEAD {
+		return nil
+	}
+
+	head, err := r.Storer.Reference(plumbing.HEAD)
+	if err != nil || head.Type() != plumbing.SymbolicReference || head.Target() != name {
+		return nil
+	}
+
+	return r.logRefUpdate(plumbing.HEAD, old, new, committer, msg)
+}
+
+// logRefUpdate appends an entry to the reflog of the given reference, if the
+// storer keeps reflogs. As in git, the reflog is only created if allowed by
+// core.logAllRefUpdates, but existing reflogs are always appended to.
+func (r *Repository) logRefUpdate(name plumbing.ReferenceName, old, new plumbing.Hash, committer *object.Signature, msg string) error {
+	s, ok := r.Storer.(storage.ReflogStorer)
+	if !ok {
+		return nil
+	}
+
+	create, err := r.createsReflog(name)
+	if err != nil {
+		return err
+	}
+
+	if !create {
+		entries, err := s.Reflog(name)
+		if err != nil || len(entries) == 0 {
+			return err
+		}
+	}
+
+	if committer == nil {
+		committer, err = r.reflogCommitter()
+		if err != nil {
+			return err
+		}
+	}
+
+	e := &ReflogEntry{Old: old, New: new, Committer: *committer, Message: msg}
+	return s.AppendReflog(name, e.encode())
+}
+
+// createsReflog returns whether the reflog of the given reference is created
+// on its first update, according to core.logAllRefUpdates.
+func (r *Repository) createsReflog(name plumbing.ReferenceName) (bool, error) {
+	cfg, err := r.Config()
+	if err != nil {
+		return false, err
+	}
+
+	switch cfg.Core.LogAllRefUpdates {
+	case "always":
+		return true, nil
+	case "false":
+		return false, nil
+	case "":
+		if cfg.Core.IsBare {
+			return false, nil
+		}
+	}
+
+	return name == plumbing.HEAD || name.IsBranch() || name.IsRemote() || name.IsNote(), nil
+}
+
+// reflogCommitter returns the identity logged in the reflogs for the updates
+// not made by a commit, resolved as the committer of a commit, or read from
+// the config if it cannot be, the update not failing.
+func (r *Repository) reflogCommitter() (*object.Signature, error) {
+	cfg, err := r.ConfigScoped(config.SystemScope)
+	if err != nil {
+		return nil, err
+	}
+
+	if s, err := resolveIdentity(cfg, committerRole, nil); err == nil {
+		return s, nil
+	}
+
+	s := &object.Signature{Name: cfg.User.Name, Email: cfg.User.Email, When: time.Now()}
+	if cfg.Committer.Name != "" && cfg.Committer.Email != "" {
+		s.Name, s.Email = cfg.Committer.Name, cfg.Committer.Email
+	}
+
+	return s, nil
+}
+
+// reflogSubject returns the first line of a commit message, as logged in the
+// reflog messages.
+func reflogSubject(msg string) string {
+	subject, _, _ := strings.Cut(strings.TrimLeft(msg, "\n"), "\n")
+	return subject
+}
+
+// resolveReflogRevision resolves the <refname>@{n} and <refname>@{date}
+// revisions, refname being empty for the current branch.
+func (r *Repository) resolveReflogRevision(refname string, item revision.Revisioner) (*object.Commit, error) {
+	name, err := r.reflogReferenceName(refname)
+	if err != nil {
+		return nil, err
+	}
+
+	entries, err := r.Reflog(name)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(entries) == 0 {
+		return nil, fmt.Errorf("%w: %s", ErrReflogNotFound, name)
+	}
+
+	var hash plumbing.Hash
+	switch item := item.(type) {
+	case revision.AtReflog:
+		if item.Depth >= len(entries) {
+			return nil, fmt.Errorf("%w: log for %s only has %d entries", plumbing.ErrReferenceNotFound, name, len(entries))
+		}
+
+		hash = entries[item.Depth].New
+	case revision.AtDate:
+		// The entry in effect at the given date is the most recent one not
+		// after it. Before the first entry, the reference pointed to its old
+		// hash, if it existed.
+		oldest := entries[len(entries)-1]
+		hash = oldest.Old
+		for _, e := range entries {
+			if !e.Committer.When.After(item.Date) {
+				hash = e.New
+				break
+			}
+		}
+
+		if hash.IsZero() {
+			return nil, fmt.Errorf("%w: log for %s only goes back to %s", plumbing.ErrReferenceNotFound, name, oldest.Committer.When)
+		}
+	}
+
+	return r.CommitObject(hash)
+}
+
+// reflogReferenceName returns the name of the reference whose reflog is
+// used to resolve <refname>@{...}. It is the current branch, or HEAD if
+// detached, when refname is empty.
+func (r *Repository) reflogReferenceName(refname string) (plumbing.ReferenceName, error) {
+	if refname == "" {
+		head, err := r.Storer.Reference(plumbing.HEAD)
+		if err != nil {
+			return "", err
+		}
+
+		if head.Type() == plumbing.SymbolicReference {
+			return head.Target(), nil
+		}
+
+		return plumbing.HEAD, nil
+	}
+
+	for _, rule := range plumbing.RefRevParseRules {
+		name := plumbing.ReferenceName(fmt.Sprintf(rule, refname))
+		if _, err := r.Storer.Reference(name); err == nil {
+			return name, nil
+		}
+	}
+
+	return "", plumbing.ErrReferenceNotFound
+}
+
+// checkoutReflogPrefix is the prefix of the messages logged in the reflog of
+// HEAD by Checkout, followed by "<from> to <to>".
+const checkoutReflogPrefix = "checkout: moving from "
+
+// resolveCheckoutRevision resolves the @{-n} revision, the n-th branch or
+// commit checked out before the current one, read from the reflog of HEAD.
+func (r *Repository) resolveCheckoutRevision(n int) (object.Object, error) {
+	entries, err := r.Reflog(plumbing.HEAD)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(entries) == 0 {
+		return nil, fmt.Errorf("%w: %s", ErrReflogNotFound, plumbing.HEAD)
+	}
+
+	var found int
+	for _, e := range entries {
+		moves, ok := strings.CutPrefix(e.Message, checkoutReflogPrefix)
+		if !ok {
+			continue
+		}
+
+		if found++; found < n {
+			continue
+		}
+
+		from, _, _ := strings.Cut(moves, " ")
+		return r.resolveRefRevision(from)
+	}
+
+	return nil, fmt.Errorf("%w: only %d checkouts in the reflog of HEAD", plumbing.ErrReferenceNotFound, found)
+}
@@ -0,0 +1,167 @@
+package git
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/go-git/go-billy/v6/memfs"
+	"github.com/go-git/go-billy/v6/osfs"
+	"github.com/go-git/go-billy/v6/util"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/go-git/go-git/v6/plumbing"
+	"github.com/go-git/go-git/v6/plumbing/cache"
+	"github.com/go-git/go-git/v6/plumbing/object"
+	"github.com/go-git/go-git/v6/storage"
+	"github.com/go-git/go-git/v6/storage/filesystem"
+	"github.com/go-git/go-git/v6/storage/memory"
+)
+
+func reflogMessages(t *testing.T, r *Repository, name plumbing.ReferenceName) []string {
+	t.Helper()
+
+	entries, err := r.Reflog(name)
+	require.NoError(t, err)
+
+	msgs := make([]string, len(entries))
+	for i, e := range entries {
+		msgs[i] = e.Message
+	}
+
+	return msgs
+}
+
+func resolveCommitMessage(t *testing.T, r *Repository, rev string) string {
+	t.Helper()
+
+	h, err := r.ResolveRevision(plumbing.Revision(rev))
+	require.NoError(t, err, rev)
+	c, err := r.CommitObject(*h)
+	require.NoError(t, err)
+
+	return strings.TrimSuffix(c.Message, "\n")
+}
+
+func TestReflog(t *testing.T) {
+	t.Parallel()
+
+	for name, newStorage := range map[string]func(t *testing.T) *filesystem.Storage{
+		"memfs": func(*testing.T) *filesystem.Storage {
+			return filesystem.NewStorage(memfs.New(), cache.NewObjectLRUDefault())
+		},
+		"osfs": func(t *testing.T) *filesystem.Storage {
+			return filesystem.NewStorage(osfs.New(t.TempDir()), cache.NewObjectLRUDefault())
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			st := newStorage(t)
+			r, _ := newRebaseRepository(t, st, "b")
+
+			assert.Equal(t, []string{
+				"checkout: moving from master to feature",
+				"commit: master",
+				"checkout: moving from feature to master",
+				"commit: feature 2",
+				"commit: feature 1",
+				"checkout: moving from master to feature",
+				"commit (initial): base",
+			}, reflogMessages(t, r, plumbing.HEAD))
+			assert.Equal(t, []string{"commit: master", "commit (initial): base"}, reflogMessages(t, r, plumbing.Master))
+			assert.Equal(t, []string{
+				"commit: feature 2",
+				"commit: feature 1",
+				"branch: Created from HEAD",
+			}, reflogMessages(t, r, "refs/heads/feature"))
+
+			entries, err := r.Reflog(plumbing.Master)
+			require.NoError(t, err)
+			assert.Equal(t, entries[1].New, entries[0].Old)
+			assert.Equal(t, plumbing.ZeroHash, entries[1].Old)
+			assert.Equal(t, "foo", entries[0].Committer.Name)
+
+			content, err := util.ReadFile(st.Filesystem(), "logs/refs/heads/master")
+			require.NoError(t, err)
+			assert.Equal(t, 2, strings.Count(string(content), "\n"))
+
+			w, err := r.Worktree()
+			require.NoError(t, err)
+			require.NoError(t, w.Reset(&ResetOptions{Commit: entries[1].New, Mode: HardReset}))
+
+			assert.Equal(t, "reset: moving to "+entries[1].New.String(), reflogMessages(t, r, plumbing.HEAD)[0])
+			assert.Equal(t, "reset: moving to "+entries[1].New.String(), reflogMessages(t, r, "refs/heads/feature")[0])
+		})
+	}
+}
+
+func TestReflogRevision(t *testing.T) {
+	t.Parallel()
+
+	r, _ := newRebaseRepository(t, memory.NewStorage(), "b")
+
+	for rev, expected := range map[string]string{
+		"HEAD@{0}":                       "feature 2",
+		"HEAD@{1}":                       "master",
+		"HEAD@{3}":                       "feature 2",
+		"@{1}":                           "feature 1",
+		"feature@{2}":                    "base",
+		"refs/heads/master@{1}":          "base",
+		"master@{2020-01-01T01:00:00Z}":  "base",
+		"master@{2020-01-01T04:00:00Z}":  "master",
+		"feature@{2020-01-01T01:30:00Z}": "feature 1",
+		"@{2020-01-01T03:00:00Z}":        "feature 2",
+		"master@{yesterday}":             "master",
+		"HEAD@{1}~1":                     "base",
+		"@{-1}":                          "master",
+		"@{-2}":                          "feature 2",
+		"@{-3}":                          "master",
+	} {
+		assert.Equal(t, expected, resolveCommitMessage(t, r, rev), rev)
+	}
+
+	for _, rev := range []string{"master@{2}", "feature@{2019-01-01T00:00:00Z}", "foo@{0}", "@{-4}"} {
+		_, err := r.ResolveRevision(plumbing.Revision(rev))
+		assert.ErrorIs(t, err, plumbing.ErrReferenceNotFound, rev)
+	}
+
+	// Without reflogs, the reflog selectors are reported as such.
+	st := r.Storer.(storage.ReflogStorer)
+	require.NoError(t, st.RemoveReflog(plumbing.Master))
+	require.NoError(t, st.RemoveReflog(plumbing.HEAD))
+	for _, rev := range []string{"master@{0}", "@{-1}"} {
+		_, err := r.ResolveRevision(plumbing.Revision(rev))
+		assert.ErrorIs(t, err, ErrReflogNotFound, rev)
+	}
+}
+
+func TestReflogLogAllRefUpdates(t *testing.T) {
+	t.Parallel()
+
+	r, fs := newRebaseRepository(t, memory.NewStorage(), "b")
+
+	cfg, err := r.Config()
+	require.NoError(t, err)
+	cfg.Core.LogAllRefUpdates = "false"
+	require.NoError(t, r.SetConfig(cfg))
+
+	w, err := r.Worktree()
+	require.NoError(t, err)
+	require.NoError(t, w.Checkout(&CheckoutOptions{Branch: "refs/heads/other", Create: true}))
+	require.NoError(t, util.WriteFile(fs, "d", []byte("d\n"), 0o644))
+	_, err = w.Add("d")
+	require.NoError(t, err)
+	_, err = w.Commit("other\n", &CommitOptions{Author: &object.Signature{Name: "foo", Email: "foo@foo.foo"}})
+	require.NoError(t, err)
+
+	// The existing reflog of HEAD is still appended to.
+	assert.Equal(t, "commit: other", reflogMessages(t, r, plumbing.HEAD)[0])
+	assert.Empty(t, reflogMessages(t, r, "refs/heads/other"))
+
+	bare, err := Init(memory.NewStorage())
+	require.NoError(t, err)
+	ref := plumbing.NewHashReference(plumbing.Master, plumbing.NewHash("6ecf0ef2c2dffb796033e5a02219af86ec6584e5"))
+	require.NoError(t, bare.setReferenceWithLog(ref, nil, "update"))
+	assert.Empty(t, reflogMessages(t, bare, plumbing.Master))
+}
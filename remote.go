@@ -5,9 +5,12 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	neturl "net/url"
+	"slices"
 	"strings"
 	"time"
 
+	"github.com/go-git/go-billy/v6"
 	"github.com/go-git/go-billy/v6/osfs"
 
 	"github.com/go-git/go-git/v6/config"
@@ -16,13 +19,18 @@ import (
 	"github.com/go-git/go-git/v6/internal/url"
 	"github.com/go-git/go-git/v6/plumbing"
 	"github.com/go-git/go-git/v6/plumbing/cache"
+	"github.com/go-git/go-git/v6/plumbing/filemode"
+	formatcfg "github.com/go-git/go-git/v6/plumbing/format/config"
 	"github.com/go-git/go-git/v6/plumbing/format/packfile"
 	"github.com/go-git/go-git/v6/plumbing/object"
+	"github.com/go-git/go-git/v6/plumbing/protocol"
 	"github.com/go-git/go-git/v6/plumbing/protocol/packp"
 	"github.com/go-git/go-git/v6/plumbing/protocol/packp/capability"
 	"github.com/go-git/go-git/v6/plumbing/revlist"
 	"github.com/go-git/go-git/v6/plumbing/storer"
 	"github.com/go-git/go-git/v6/plumbing/transport"
+	"github.com/go-git/go-git/v6/plumbing/transport/credential"
+	githttp "github.com/go-git/go-git/v6/plumbing/transport/http"
 	"github.com/go-git/go-git/v6/storage"
 	"github.com/go-git/go-git/v6/storage/filesystem"
 	"github.com/go-git/go-git/v6/storage/memory"
@@ -30,12 +38,17 @@ import (
 )
 
 var (
-	NoErrAlreadyUpToDate     = errors.New("already up-to-date") //nolint:staticcheck // Not an error, sentinel value for success
-	ErrDeleteRefNotSupported = errors.New("server does not support delete-refs")
-	ErrForceNeeded           = errors.New("some refs were not updated")
-	ErrExactSHA1NotSupported = errors.New("server does not support exact SHA1 refspec")
-	ErrEmptyUrls             = errors.New("URLs cannot be empty")
-	ErrRemoteRefNotFound     = errors.New("couldn't find remote ref")
+	NoErrAlreadyUpToDate       = errors.New("already up-to-date") //nolint:staticcheck // Not an error, sentinel value for success
+	ErrDeleteRefNotSupported   = errors.New("server does not support delete-refs")
+	ErrForceNeeded             = errors.New("some refs were not updated")
+	ErrExactSHA1NotSupported   = errors.New("server does not support exact SHA1 refspec")
+	ErrAtomicNotSupported      = errors.New("server does not support atomic push")
+	ErrPushOptionsNotSupported = errors.New("server does not support push options")
+	ErrEmptyUrls               = errors.New("URLs cannot be empty")
+	ErrRemoteRefNotFound       = errors.New("couldn't find remote ref")
+	// ErrObjectFormatMismatch is returned when the object format of the
+	// remote is not the one of the repository.
+	ErrObjectFormatMismatch = errors.New("object format of the remote does not match the repository")
 )
 
 const (
@@ -53,6 +66,8 @@ const (
 type Remote struct {
 	c *config.RemoteConfig
 	s storage.Storer
+	// wt is the worktree of the repository, if any, where its hooks are run.
+	wt billy.Filesystem
 }
 
 // NewRemote creates a new Remote.
@@ -71,7 +86,7 @@ func (r *Remote) String() string {
 	var fetch, push string
 	if len(r.c.URLs) > 0 {
 		fetch = r.c.URLs[0]
-		push = r.c.URLs[len(r.c.URLs)-1]
+		push = r.c.PushURL()
 	}
 
 	return fmt.Sprintf("%s\t%s (fetch)\n%[1]s\t%[3]s (push)", r.c.Name, fetch, push)
@@ -84,7 +99,8 @@ func (r *Remote) Push(o *PushOptions) error {
 }
 
 // PushContext performs a push to the remote. Returns NoErrAlreadyUpToDate if
-// the remote was already up-to-date.
+// the remote was already up-to-date, or a *PushError telling the status of
+// each reference if the remote rejected the update of some of them.
 //
 // The provided Context must be non-nil. If the context expires before the
 // operation is complete, an error is returned. The context only affects the
@@ -99,15 +115,15 @@ func (r *Remote) PushContext(ctx context.Context, o *PushOptions) (err error) {
 	}
 
 	if o.RemoteURL == "" && len(r.c.URLs) > 0 {
-		o.RemoteURL = r.c.URLs[len(r.c.URLs)-1]
+		o.RemoteURL = r.c.PushURL()
 	}
 
-	c, ep, err := newClient(o.RemoteURL, o.InsecureSkipTLS, o.CABundle, o.ProxyOptions)
+	c, ep, err := newClient(o.RemoteURL, o.InsecureSkipTLS, o.CABundle, o.ProxyOptions, o.Timeouts)
 	if err != nil {
 		return err
 	}
 
-	s, err := c.NewSession(r.s, ep, o.Auth)
+	s, err := r.newSession(c, ep, o.Auth)
 	if err != nil {
 		return err
 	}
@@ -117,6 +133,10 @@ func (r *Remote) PushContext(ctx context.Context, o *PushOptions) (err error) {
 		return err
 	}
 
+	if err := r.checkObjectFormat(conn.Capabilities(), false); err != nil {
+		return err
+	}
+
 	rRefs, err := conn.GetRemoteRefs(ctx)
 	if err != nil {
 		return err
@@ -150,6 +170,14 @@ func (r *Remote) sendPack(ctx context.Context, conn transport.Connection, remote
 		return ErrDeleteRefNotSupported
 	}
 
+	if o.Atomic && !caps.Supports(capability.Atomic) {
+		return ErrAtomicNotSupported
+	}
+
+	if len(o.Options) > 0 && !caps.Supports(capability.PushOptions) {
+		return ErrPushOptionsNotSupported
+	}
+
 	if o.Force {
 		for i := 0; i < len(o.RefSpecs); i++ {
 			rs := &o.RefSpecs[i]
@@ -179,6 +207,12 @@ func (r *Remote) sendPack(ctx context.Context, conn transport.Connection, remote
 		return NoErrAlreadyUpToDate
 	}
 
+	if o.RunHooks {
+		if err := r.runPrePush(ctx, cmds, o); err != nil {
+			return err
+		}
+	}
+
 	objects := objectsToPush(cmds)
 	haves, err := referencesToHashes(remoteRefs)
 	if err != nil {
@@ -194,6 +228,10 @@ func (r *Remote) sendPack(ctx context.Context, conn transport.Connection, remote
 	// we are aware.
 	haves = append(haves, stop...)
 
+	// As git, the objects are pushed as they are stored, whatever the
+	// replace references.
+	st := storage.NoReplaceObjects(r.s)
+
 	var hashesToPush []plumbing.Hash
 	// Avoid the expensive revlist operation if we're only doing deletes.
 	if !allDelete {
@@ -201,12 +239,20 @@ func (r *Remote) sendPack(ctx context.Context, conn transport.Connection, remote
 			// If we're are pushing to a local repo, it might be much
 			// faster to use a local storage layer to get the commits
 			// to ignore, when calculating the object revlist.
-			localStorer := filesystem.NewStorage(
-				osfs.New(o.RemoteURL, osfs.WithBoundOS()), cache.NewObjectLRUDefault())
+			// The repository is read from its .git directory unless
+			// it is bare.
+			fs := osfs.New(o.RemoteURL, osfs.WithBoundOS())
+			if fi, err := fs.Stat(GitDirName); err == nil && fi.IsDir() {
+				if fs, err = fs.Chroot(GitDirName); err != nil {
+					return err
+				}
+			}
+
+			localStorer := filesystem.NewStorage(fs, cache.NewObjectLRUDefault())
 			hashesToPush, err = revlist.ObjectsWithStorageForIgnores(
-				r.s, localStorer, objects, haves)
+				st, storage.NoReplaceObjects(localStorer), objects, haves)
 		} else {
-			hashesToPush, err = revlist.Objects(r.s, objects, haves)
+			hashesToPush, err = revlist.Objects(st, objects, haves)
 		}
 		if err != nil {
 			return err
@@ -223,13 +269,191 @@ func (r *Remote) sendPack(ctx context.Context, conn transport.Connection, remote
 		}
 	}
 
-	if err := pushHashes(ctx, conn, r.s, cmds, hashesToPush, allDelete, o); err != nil {
-		return err
+	if err := pushHashes(ctx, conn, st, cmds, hashesToPush, allDelete, o); err != nil {
+		var rerr *packp.ReportError
+		if !errors.As(err, &rerr) {
+			return err
+		}
+
+		// The references updated by the remote are updated locally, even if
+		// others were rejected.
+		result := newPushResult(cmds, rerr.Report)
+		if err := r.updateRemoteReferenceStorage(result.updatedCommands(cmds)); err != nil {
+			return err
+		}
+
+		return &PushError{Result: result, err: err}
 	}
 
 	return r.updateRemoteReferenceStorage(cmds)
 }
 
+// runPrePush runs the pre-push hook with the reference updates of the push.
+func (r *Remote) runPrePush(ctx context.Context, cmds []*packp.Command, o *PushOptions) error {
+	hooks := o.Hooks
+	if hooks == nil {
+		hooks = &ScriptHookRunner{}
+	}
+
+	updates := make([]*PrePushUpdate, len(cmds))
+	for i, cmd := range cmds {
+		updates[i] = &PrePushUpdate{
+			LocalHash:  cmd.New,
+			RemoteRef:  cmd.Name,
+			RemoteHash: cmd.Old,
+		}
+
+		if cmd.Action() != packp.Delete {
+			updates[i].LocalRef = pushedReference(o.RefSpecs, cmd.Name)
+		}
+	}
+
+	req := &HookRequest{Storer: r.s, Worktree: r.wt, Output: o.Progress}
+	if err := hooks.PrePush(ctx, req, r.c.Name, o.RemoteURL, updates); err != nil {
+		return &HookError{Hook: "pre-push", Err: err}
+	}
+
+	return nil
+}
+
+// pushedReference returns the local reference pushed to the remote one by
+// the refspecs, or the remote one itself, such as a tag followed by the push.
+func pushedReference(refspecs []config.RefSpec, remote plumbing.ReferenceName) plumbing.ReferenceName {
+	for _, rs := range refspecs {
+		if rs.IsDelete() {
+			continue
+		}
+
+		if !rs.IsWildcard() {
+			if rs.Dst("") == remote {
+				return plumbing.ReferenceName(rs.Src())
+			}
+
+			continue
+		}
+
+		if rev := rs.Reverse(); rev.Match(remote) {
+			return rev.Dst(remote)
+		}
+	}
+
+	return remote
+}
+
+// PushRefStatus is the status of the update of a remote reference by a push.
+type PushRefStatus int
+
+const (
+	// PushRefUpdated is the status of a reference updated by the remote.
+	PushRefUpdated PushRefStatus = iota
+	// PushRefRejected is the status of a reference the remote refused to
+	// update, such as a protected branch rejected by a hook.
+	PushRefRejected
+	// PushRefNotReported is the status of a reference the remote did not
+	// report about.
+	PushRefNotReported
+)
+
+// PushRefResult is the result of the update of a remote reference by a push.
+type PushRefResult struct {
+	// RefName is the name of the remote reference.
+	RefName plumbing.ReferenceName
+	// Old is the hash of the reference before the update, zero if the
+	// reference was created.
+	Old plumbing.Hash
+	// New is the hash of the reference after the update, zero if the
+	// reference was deleted.
+	New plumbing.Hash
+	// Status is the status of the update.
+	Status PushRefStatus
+	// Message is the reason given by the remote for rejecting the update.
+	Message string
+}
+
+// PushResult is the result of a push, as reported by the remote.
+type PushResult struct {
+	// UnpackStatus is the status of the unpacking of the packfile by the
+	// remote, "ok" or the reason of its failure, such as a corrupted
+	// packfile.
+	UnpackStatus string
+	// Refs are the results of the updates of the remote references, in the
+	// order they were sent.
+	Refs []PushRefResult
+}
+
+// PushError is the error returned by a push the remote did not accept
+// entirely, because it failed to unpack the packfile or rejected the update
+// of some references. It wraps the packp.UnpackStatusErr or
+// packp.CommandStatusErr of the first failure.
+type PushError struct {
+	// Result tells which references were updated, and why the others were
+	// not.
+	Result *PushResult
+
+	err error
+}
+
+// Error implements the error interface.
+func (e *PushError) Error() string {
+	return e.err.Error()
+}
+
+// Unwrap returns the error of the first failure.
+func (e *PushError) Unwrap() error {
+	return e.err
+}
+
+func newPushResult(cmds []*packp.Command, report *packp.ReportStatus) *PushResult {
+	statuses := make(map[plumbing.ReferenceName]*packp.CommandStatus, len(report.CommandStatuses))
+	for _, cs := range report.CommandStatuses {
+		statuses[cs.ReferenceName] = cs
+	}
+
+	result := &PushResult{UnpackStatus: report.UnpackStatus}
+	for _, cmd := range cmds {
+		ref := PushRefResult{
+			RefName: cmd.Name,
+			Old:     cmd.Old,
+			New:     cmd.New,
+			Status:  PushRefNotReported,
+		}
+
+		cs, ok := statuses[cmd.Name]
+		switch {
+		case !ok:
+		case cs.Error() != nil:
+			ref.Status = PushRefRejected
+			ref.Message = cs.Status
+		default:
+			ref.Status = PushRefUpdated
+			// With report-status-v2, the remote tells the values it used
+			// if they differ from the ones of the command.
+			if !cs.OldHash.IsZero() {
+				ref.Old = cs.OldHash
+			}
+			if !cs.NewHash.IsZero() {
+				ref.New = cs.NewHash
+			}
+		}
+
+		result.Refs = append(result.Refs, ref)
+	}
+
+	return result
+}
+
+// updatedCommands returns the commands of the references the remote updated.
+func (r *PushResult) updatedCommands(cmds []*packp.Command) []*packp.Command {
+	var updated []*packp.Command
+	for i, ref := range r.Refs {
+		if ref.Status == PushRefUpdated && r.UnpackStatus == "ok" {
+			updated = append(updated, cmds[i])
+		}
+	}
+
+	return updated
+}
+
 func (r *Remote) useRefDeltas(ar *packp.AdvRefs) bool {
 	return !ar.Capabilities.Supports(capability.OFSDelta)
 }
@@ -336,8 +560,9 @@ func (r *Remote) updateRemoteReferenceStorage(
 // no changes to be fetched, or an error.
 //
 // The provided Context must be non-nil. If the context expires before the
-// operation is complete, an error is returned. The context only affects the
-// transport operations.
+// operation is complete, an error is returned. The context affects the
+// transport operations and the resolution of the deltas of the packfile
+// received.
 func (r *Remote) FetchContext(ctx context.Context, o *FetchOptions) error {
 	_, err := r.fetch(ctx, o)
 	return err
@@ -363,32 +588,60 @@ func (r *Remote) fetch(ctx context.Context, o *FetchOptions) (sto storer.Referen
 
 	if len(o.RefSpecs) == 0 {
 		o.RefSpecs = r.c.Fetch
+		// A mirror is kept in sync with the remote, its references deleted
+		// remotely being deleted too.
+		if r.c.Mirror {
+			o.Prune = true
+		}
+	}
+
+	if o.PruneTags {
+		o.Prune = true
+		if !slices.Contains(o.RefSpecs, refspecAllTags) {
+			o.RefSpecs = append(slices.Clone(o.RefSpecs), refspecAllTags)
+		}
 	}
 
 	if o.RemoteURL == "" {
 		o.RemoteURL = r.c.URLs[0]
 	}
 
-	c, ep, err := newClient(o.RemoteURL, o.InsecureSkipTLS, o.CABundle, o.ProxyOptions)
+	// Fetches from a promisor remote keep using the filter of the partial
+	// clone, unless told otherwise.
+	if o.Filter == "" && r.c.Promisor {
+		o.Filter = packp.Filter(r.c.PartialCloneFilter)
+	}
+
+	c, ep, err := newClient(o.RemoteURL, o.InsecureSkipTLS, o.CABundle, o.ProxyOptions, o.Timeouts)
 	if err != nil {
 		return nil, err
 	}
 
-	sess, err := c.NewSession(r.s, ep, o.Auth)
+	sess, err := r.newSession(c, ep, o.Auth)
 	if err != nil {
 		return nil, err
 	}
 
-	conn, err := sess.Handshake(ctx, transport.UploadPackService)
+	conn, err := sess.Handshake(ctx, transport.UploadPackService, r.uploadPackParams(c, o.ProtocolVersion)...)
 	if err != nil {
 		return nil, err
 	}
 
-	if err := r.isSupportedRefSpec(o.RefSpecs, conn.Capabilities()); err != nil {
+	if err := r.isSupportedRefSpec(o.RefSpecs, conn); err != nil {
 		return nil, err
 	}
 
-	rRefs, err := conn.GetRemoteRefs(ctx)
+	if err := r.checkObjectFormat(conn.Capabilities(), true); err != nil {
+		return nil, err
+	}
+
+	var rRefs []*plumbing.Reference
+	if conn.Version() == protocol.V2 {
+		// Only the references that can be fetched are listed.
+		rRefs, err = transport.ListRefs(ctx, conn, refPrefixes(o.RefSpecs, o.Tags)...)
+	} else {
+		rRefs, err = conn.GetRemoteRefs(ctx)
+	}
 	if err != nil {
 		return nil, err
 	}
@@ -404,7 +657,7 @@ func (r *Remote) fetch(ctx context.Context, o *FetchOptions) (sto storer.Referen
 	}
 
 	var shallows []plumbing.Hash
-	if o.Depth != 0 {
+	if o.isShallow() {
 		shallows, err = r.s.Shallow()
 		if err != nil {
 			return nil, err
@@ -419,21 +672,34 @@ func (r *Remote) fetch(ctx context.Context, o *FetchOptions) (sto storer.Referen
 		}
 	}
 
-	var haves []plumbing.Hash
 	wants, _ := getWants(r.s, refs, o.Depth)
 	if len(wants) > 0 {
-		haves, err = getHaves(localRefs, remoteRefs, r.s, o.Depth)
-		if err != nil {
-			return nil, err
-		}
-
 		req := &transport.FetchRequest{
 			Wants:       wants,
-			Haves:       haves,
 			Depth:       o.Depth,
+			DeepenSince: o.ShallowSince,
+			DeepenNot:   o.ShallowExclude,
 			Progress:    o.Progress,
 			IncludeTags: isWildcard && o.Tags == plumbing.TagFollowing,
 			Filter:      o.Filter,
+			ThinPack:    o.ThinPack,
+			Resumable:   o.Resumable,
+		}
+
+		if o.Deepen > 0 {
+			req.Depth = o.Deepen
+			req.DeepenRelative = true
+		}
+
+		if o.Negotiator != nil {
+			req.Negotiator = o.Negotiator(r.s, negotiationTips(localRefs, o.Haves))
+		} else {
+			req.Haves, err = getHaves(localRefs, remoteRefs, r.s, o.Depth)
+			if err != nil {
+				return nil, err
+			}
+
+			req.Haves = append(req.Haves, o.Haves...)
 		}
 
 		if err := conn.Fetch(ctx, req); err != nil && !errors.Is(err, transport.ErrNoChange) {
@@ -449,7 +715,7 @@ func (r *Remote) fetch(ctx context.Context, o *FetchOptions) (sto storer.Referen
 
 	var updatedPrune bool
 	if o.Prune {
-		updatedPrune, err = r.pruneRemotes(o.RefSpecs, localRefs, remoteRefs)
+		updatedPrune, err = r.pruneRemotes(o.RefSpecs, localRefs, remoteRefs, o.OnPrune)
 		if err != nil {
 			return nil, err
 		}
@@ -485,6 +751,98 @@ func (r *Remote) fetch(ctx context.Context, o *FetchOptions) (sto storer.Referen
 	return remoteRefs, nil
 }
 
+// fetchObjects fetches the given objects from the remote without updating
+// any reference. It is used to fetch the objects missing from a partial
+// clone, so the filter of the promisor remote is applied to the objects
+// reachable from the wanted ones.
+func (r *Remote) fetchObjects(ctx context.Context, o *FetchOptions, hashes []plumbing.Hash) error {
+	if o.RemoteURL == "" {
+		o.RemoteURL = r.c.URLs[0]
+	}
+
+	if o.Filter == "" && r.c.Promisor {
+		o.Filter = packp.Filter(r.c.PartialCloneFilter)
+	}
+
+	c, ep, err := newClient(o.RemoteURL, o.InsecureSkipTLS, o.CABundle, o.ProxyOptions, o.Timeouts)
+	if err != nil {
+		return err
+	}
+
+	sess, err := r.newSession(c, ep, o.Auth)
+	if err != nil {
+		return err
+	}
+
+	conn, err := sess.Handshake(ctx, transport.UploadPackService, r.uploadPackParams(c, o.ProtocolVersion)...)
+	if err != nil {
+		return err
+	}
+
+	req := &transport.FetchRequest{
+		Wants:    hashes,
+		Progress: o.Progress,
+		Filter:   o.Filter,
+	}
+
+	if err := conn.Fetch(ctx, req); err != nil && !errors.Is(err, transport.ErrNoChange) {
+		_ = conn.Close()
+		return err
+	}
+
+	if err := conn.Close(); err != nil {
+		return fmt.Errorf("error closing connection: %w", err)
+	}
+
+	return nil
+}
+
+// uploadPackParams returns the parameters used to request the given protocol
+// version, or the one set in the configuration if not set, when connecting
+// to upload-pack. No version is requested if the transport doesn't support
+// it.
+func (r *Remote) uploadPackParams(c transport.Transport, v protocol.Version) []string {
+	if v == protocol.V0 && r.s != nil {
+		if cfg, err := r.s.Config(); err == nil {
+			v = cfg.Protocol.Version
+		}
+	}
+
+	if v == protocol.V0 || !slices.Contains(c.SupportedProtocols(), v) {
+		return nil
+	}
+
+	return []string{transport.VersionParam(v)}
+}
+
+// refPrefixes returns the prefixes of the remote references that can be
+// fetched using the given refspecs and tag mode. HEAD is always included,
+// as it is used to find the default branch of the remote.
+func refPrefixes(specs []config.RefSpec, tags plumbing.TagMode) []string {
+	prefixes := []string{plumbing.HEAD.String()}
+	for _, s := range specs {
+		if s.IsExactSHA1() {
+			continue
+		}
+
+		src := s.Src()
+		if s.IsWildcard() {
+			prefixes = append(prefixes, src[:strings.Index(src, "*")])
+			continue
+		}
+
+		for _, rule := range plumbing.RefRevParseRules {
+			prefixes = append(prefixes, fmt.Sprintf(rule, src))
+		}
+	}
+
+	if tags != plumbing.NoTags {
+		prefixes = append(prefixes, "refs/tags/")
+	}
+
+	return prefixes
+}
+
 func referenceStorageFromRefs(refs []*plumbing.Reference, filterPeeled bool) memory.ReferenceStorage {
 	refStore := memory.ReferenceStorage{}
 	for _, ref := range refs {
@@ -519,7 +877,7 @@ func depthChanged(before []plumbing.Hash, s storage.Storer) (bool, error) {
 	return false, nil
 }
 
-func newClient(url string, insecure bool, cabundle []byte, proxyOpts transport.ProxyOptions) (transport.Transport, *transport.Endpoint, error) {
+func newClient(url string, insecure bool, cabundle []byte, proxyOpts transport.ProxyOptions, timeouts transport.TimeoutOptions) (transport.Transport, *transport.Endpoint, error) {
 	ep, err := transport.NewEndpoint(url)
 	if err != nil {
 		return nil, nil, err
@@ -527,6 +885,7 @@ func newClient(url string, insecure bool, cabundle []byte, proxyOpts transport.P
 	ep.InsecureSkipTLS = insecure
 	ep.CaBundle = cabundle
 	ep.Proxy = proxyOpts
+	ep.Timeouts = timeouts
 
 	c, err := transport.Get(ep.Scheme)
 	if err != nil {
@@ -536,14 +895,108 @@ func newClient(url string, insecure bool, cabundle []byte, proxyOpts transport.P
 	return c, ep, err
 }
 
-func (r *Remote) pruneRemotes(specs []config.RefSpec, localRefs []*plumbing.Reference, remoteRefs storer.ReferenceStorer) (bool, error) {
+// newSession returns a session of the client for the endpoint, with the given
+// auth or, if nil, the one getting the credential from the helpers configured
+// for the endpoint, if any.
+func (r *Remote) newSession(c transport.Transport, ep *transport.Endpoint, auth transport.AuthMethod) (transport.Session, error) {
+	if ep.Scheme != "http" && ep.Scheme != "https" {
+		return c.NewSession(r.s, ep, auth)
+	}
+
+	u, err := neturl.Parse(ep.String())
+	if err != nil {
+		return nil, err
+	}
+
+	raws, err := r.rawConfigs()
+	if err != nil {
+		return nil, err
+	}
+
+	if ep.Proxy.URL == "" {
+		proxyURL, err := githttp.ProxyFromConfig(u, raws...)
+		if err != nil {
+			return nil, err
+		}
+
+		if proxyURL != nil {
+			ep.Proxy.URL = proxyURL.String()
+		}
+	}
+
+	if auth == nil {
+		helperAuth, err := credentialHelperAuth(ep, u, raws)
+		if err != nil {
+			return nil, err
+		}
+
+		if helperAuth != nil {
+			auth = helperAuth
+		}
+	}
+
+	return c.NewSession(r.s, ep, auth)
+}
+
+// rawConfigs returns the system, global and local configs, from the lowest to
+// the highest priority.
+func (r *Remote) rawConfigs() ([]*formatcfg.Config, error) {
+	var raws []*formatcfg.Config
+	for _, scope := range []config.Scope{config.SystemScope, config.GlobalScope} {
+		cfg, err := config.LoadConfig(scope)
+		if err != nil {
+			return nil, err
+		}
+
+		raws = append(raws, cfg.Raw)
+	}
+
+	local, err := r.s.Config()
+	if err != nil {
+		return nil, err
+	}
+
+	return append(raws, local.Raw), nil
+}
+
+// credentialHelperAuth returns the auth getting the credential of an http
+// endpoint from the helpers configured by the given configs, or nil if there
+// are none, or if the endpoint has a password.
+func credentialHelperAuth(ep *transport.Endpoint, u *neturl.URL, raws []*formatcfg.Config) (*githttp.CredentialHelperAuth, error) {
+	if ep.User != nil {
+		if _, ok := ep.User.Password(); ok {
+			return nil, nil
+		}
+	}
+
+	cfg, err := credential.ReadConfig(u, raws...)
+	if err != nil || len(cfg.Helpers) == 0 {
+		return nil, err
+	}
+
+	return githttp.NewCredentialHelperAuth(cfg, u), nil
+}
+
+func (r *Remote) pruneRemotes(
+	specs []config.RefSpec,
+	localRefs []*plumbing.Reference,
+	remoteRefs storer.ReferenceStorer,
+	onPrune func(*plumbing.Reference),
+) (bool, error) {
 	var updatedPrune bool
+	pruned := make(map[plumbing.ReferenceName]struct{})
 	for _, spec := range specs {
 		rev := spec.Reverse()
 		for _, ref := range localRefs {
-			if !rev.Match(ref.Name()) {
+			// Like git, the symbolic references are kept, even if dangling.
+			if ref.Type() != plumbing.HashReference || !rev.Match(ref.Name()) {
+				continue
+			}
+
+			if _, ok := pruned[ref.Name()]; ok {
 				continue
 			}
+
 			_, err := remoteRefs.Reference(rev.Dst(ref.Name()))
 			if errors.Is(err, plumbing.ErrReferenceNotFound) {
 				updatedPrune = true
@@ -551,6 +1004,11 @@ func (r *Remote) pruneRemotes(specs []config.RefSpec, localRefs []*plumbing.Refe
 				if err != nil {
 					return false, err
 				}
+
+				pruned[ref.Name()] = struct{}{}
+				if onPrune != nil {
+					onPrune(ref)
+				}
 			}
 		}
 	}
@@ -736,8 +1194,14 @@ func (r *Remote) addReferenceIfRefSpecMatches(rs config.RefSpec,
 		return nil
 	}
 
+	// A lease naming a reference only protects this one, the others being
+	// updated as without it.
+	if forceWithLease != nil && forceWithLease.RefName != "" && forceWithLease.RefName != cmd.Name {
+		forceWithLease = nil
+	}
+
 	if forceWithLease != nil {
-		if err = r.checkForceWithLease(localRef, cmd, forceWithLease); err != nil {
+		if err = r.checkForceWithLease(cmd, forceWithLease); err != nil {
 			return err
 		}
 	} else if !rs.IsForceUpdate() {
@@ -750,29 +1214,52 @@ func (r *Remote) addReferenceIfRefSpecMatches(rs config.RefSpec,
 	return nil
 }
 
-func (r *Remote) checkForceWithLease(localRef *plumbing.Reference, cmd *packp.Command, forceWithLease *ForceWithLease) error {
-	remotePrefix := fmt.Sprintf("refs/remotes/%s/", r.Config().Name)
+// checkForceWithLease checks that the remote reference updated by cmd is
+// still at the value expected by the lease. The old value of cmd being the
+// one advertised, the server rejects the update if the reference has changed
+// since then.
+func (r *Remote) checkForceWithLease(cmd *packp.Command, forceWithLease *ForceWithLease) error {
+	expected := forceWithLease.Hash
+	if expected.IsZero() {
+		var err error
+		if expected, err = r.remoteTrackingHash(cmd.Name); err != nil {
+			return err
+		}
+	}
 
-	ref, err := storer.ResolveReference(
-		r.s,
-		plumbing.ReferenceName(remotePrefix+strings.ReplaceAll(localRef.Name().String(), "refs/heads/", "")))
-	if err != nil {
-		return err
+	if cmd.Old != expected {
+		return fmt.Errorf("non-fast-forward update: %s", cmd.Name.String())
 	}
 
-	if forceWithLease.RefName.String() == "" || (forceWithLease.RefName == cmd.Name) {
-		expectedOID := ref.Hash()
+	return nil
+}
 
-		if !forceWithLease.Hash.IsZero() {
-			expectedOID = forceWithLease.Hash
+// remoteTrackingHash returns the hash of the remote-tracking reference of the
+// given remote reference, or the zero hash if there is none, meaning that the
+// remote reference is not expected to exist.
+func (r *Remote) remoteTrackingHash(name plumbing.ReferenceName) (plumbing.Hash, error) {
+	specs := r.c.Fetch
+	if len(specs) == 0 {
+		specs = []config.RefSpec{config.RefSpec(fmt.Sprintf(config.DefaultFetchRefSpec, r.c.Name))}
+	}
+
+	for _, rs := range specs {
+		if !rs.Match(name) {
+			continue
 		}
 
-		if cmd.Old != expectedOID {
-			return fmt.Errorf("non-fast-forward update: %s", cmd.Name.String())
+		ref, err := storer.ResolveReference(r.s, rs.Dst(name))
+		if errors.Is(err, plumbing.ErrReferenceNotFound) {
+			continue
+		}
+		if err != nil {
+			return plumbing.ZeroHash, err
 		}
+
+		return ref.Hash(), nil
 	}
 
-	return nil
+	return plumbing.ZeroHash, nil
 }
 
 func getRemoteRefsFromStorer(remoteRefStorer storer.ReferenceStorer) (
@@ -884,6 +1371,19 @@ func getHaves(
 	return result, nil
 }
 
+// negotiationTips returns the commits a Negotiator starts from, the ones of
+// the local references and the given haves.
+func negotiationTips(localRefs []*plumbing.Reference, haves []plumbing.Hash) []plumbing.Hash {
+	tips := make([]plumbing.Hash, 0, len(localRefs)+len(haves))
+	for _, ref := range localRefs {
+		if ref.Type() == plumbing.HashReference {
+			tips = append(tips, ref.Hash())
+		}
+	}
+
+	return append(tips, haves...)
+}
+
 const refspecAllTags = "+refs/tags/*:refs/tags/*"
 
 func calculateRefs(
@@ -1004,7 +1504,9 @@ func getWants(localStorer storage.Storer, refs memory.ReferenceStorage, depth in
 }
 
 func objectExists(s storer.EncodedObjectStorer, h plumbing.Hash) (bool, error) {
-	_, err := s.EncodedObject(plumbing.AnyObject, h)
+	// HasEncodedObject is used so that the objects missing from a partial
+	// clone are not lazily fetched.
+	err := s.HasEncodedObject(h)
 	if errors.Is(err, plumbing.ErrObjectNotFound) {
 		return false, nil
 	}
@@ -1071,24 +1573,81 @@ func isFastForward(s storer.EncodedObjectStorer, old, new plumbing.Hash, earlies
 	return found, err
 }
 
-func (r *Remote) isSupportedRefSpec(refs []config.RefSpec, caps *capability.List) error {
-	var containsIsExact bool
+// checkObjectFormat checks that the object format advertised by the remote,
+// SHA1 if none, is the one of the repository. If adopt is set, a repository
+// without any reference yet, as one being cloned, is given the object format
+// of the remote instead, if its storage supports it.
+func (r *Remote) checkObjectFormat(caps *capability.List, adopt bool) error {
+	remote := formatcfg.SHA1
+	if slices.Contains(caps.Get(capability.ObjectFormat), formatcfg.SHA256.String()) {
+		remote = formatcfg.SHA256
+	}
+
+	local := storer.ObjectFormat(r.s)
+	if remote == local {
+		return nil
+	}
+
+	if _, ok := r.s.(storer.ObjectFormatStorer); !adopt || !ok {
+		return fmt.Errorf("%w: %s instead of %s", ErrObjectFormatMismatch, remote, local)
+	}
+
+	empty, err := hasNoHashReference(r.s)
+	if err != nil {
+		return err
+	}
+
+	if !empty {
+		return fmt.Errorf("%w: %s instead of %s", ErrObjectFormatMismatch, remote, local)
+	}
+
+	return setObjectFormat(r.s, remote)
+}
+
+// hasNoHashReference returns whether s holds no reference to an object, such
+// as the storage of a repository being cloned.
+func hasNoHashReference(s storer.ReferenceStorer) (bool, error) {
+	iter, err := s.IterReferences()
+	if err != nil {
+		return false, err
+	}
+
+	empty := true
+	err = iter.ForEach(func(ref *plumbing.Reference) error {
+		if ref.Type() == plumbing.HashReference {
+			empty = false
+			return storer.ErrStop
+		}
+
+		return nil
+	})
+
+	return empty, err
+}
+
+func (r *Remote) isSupportedRefSpec(refs []config.RefSpec, conn transport.Connection) error {
+	var exact []string
 	for _, ref := range refs {
 		if ref.IsExactSHA1() {
-			containsIsExact = true
+			exact = append(exact, ref.Src())
 		}
 	}
 
-	if !containsIsExact {
+	// Servers speaking protocol v2 don't advertise whether objects can be
+	// requested by id, they reject the request if they can't.
+	if len(exact) == 0 || conn.Version() == protocol.V2 {
 		return nil
 	}
 
+	caps := conn.Capabilities()
 	if caps.Supports(capability.AllowReachableSHA1InWant) ||
 		caps.Supports(capability.AllowTipSHA1InWant) {
 		return nil
 	}
 
-	return ErrExactSHA1NotSupported
+	return fmt.Errorf("%w: cannot fetch %s, the server advertises neither %s nor %s",
+		ErrExactSHA1NotSupported, strings.Join(exact, ", "),
+		capability.AllowTipSHA1InWant, capability.AllowReachableSHA1InWant)
 }
 
 func (r *Remote) updateLocalReferenceStorage(
@@ -1174,7 +1733,7 @@ func (r *Remote) buildFetchedTags(refs memory.ReferenceStorage) (updated bool, e
 			continue
 		}
 
-		_, err := r.s.EncodedObject(plumbing.AnyObject, ref.Hash())
+		err := r.s.HasEncodedObject(ref.Hash())
 		if errors.Is(err, plumbing.ErrObjectNotFound) {
 			continue
 		}
@@ -1196,7 +1755,7 @@ func (r *Remote) buildFetchedTags(refs memory.ReferenceStorage) (updated bool, e
 	return updated, err
 }
 
-// List the references on the remote repository.
+// ListContext lists the references on the remote repository, as List does.
 // The provided Context must be non-nil. If the context expires before the
 // operation is complete, an error is returned. The context only affects to the
 // transport operations.
@@ -1204,6 +1763,11 @@ func (r *Remote) ListContext(ctx context.Context, o *ListOptions) (rfs []*plumbi
 	return r.list(ctx, o)
 }
 
+// List the references on the remote repository, as `git ls-remote` does.
+// HEAD is returned as a symbolic reference to the branch it points to when
+// the remote advertises it. The peeled values of the annotated tags are
+// returned as references named after the tags with the ^{} suffix, according
+// to o.PeelingOption, and can be looked up with PeeledHash.
 func (r *Remote) List(o *ListOptions) (rfs []*plumbing.Reference, err error) {
 	timeout := o.Timeout
 	// Default to the old hardcoded 10s value if a timeout is not explicitly set.
@@ -1223,24 +1787,24 @@ func (r *Remote) list(ctx context.Context, o *ListOptions) (rfs []*plumbing.Refe
 		return nil, ErrEmptyUrls
 	}
 
-	c, ep, err := newClient(r.c.URLs[0], o.InsecureSkipTLS, o.CABundle, o.ProxyOptions)
+	c, ep, err := newClient(r.c.URLs[0], o.InsecureSkipTLS, o.CABundle, o.ProxyOptions, o.Timeouts)
 	if err != nil {
 		return nil, err
 	}
 
-	s, err := c.NewSession(r.s, ep, o.Auth)
+	s, err := r.newSession(c, ep, o.Auth)
 	if err != nil {
 		return nil, err
 	}
 
-	conn, err := s.Handshake(ctx, transport.UploadPackService)
+	conn, err := s.Handshake(ctx, transport.UploadPackService, r.uploadPackParams(c, o.ProtocolVersion)...)
 	if err != nil {
 		return nil, err
 	}
 
 	defer ioutil.CheckClose(conn, &err)
 
-	allRefs, err := conn.GetRemoteRefs(ctx)
+	allRefs, err := transport.ListRefs(ctx, conn, o.RefPrefixes...)
 	if err != nil {
 		return nil, err
 	}
@@ -1265,6 +1829,20 @@ func (r *Remote) list(ctx context.Context, o *ListOptions) (rfs []*plumbing.Refe
 	return resultRefs, nil
 }
 
+// PeeledHash returns the object pointed to by the annotated tag with the
+// given name, from the references listed by Remote.List with AppendPeeled or
+// OnlyPeeled, and whether the tag is annotated.
+func PeeledHash(refs []*plumbing.Reference, name plumbing.ReferenceName) (plumbing.Hash, bool) {
+	peeled := plumbing.ReferenceName(name.String() + peeledSuffix)
+	for _, ref := range refs {
+		if ref.Name() == peeled {
+			return ref.Hash(), true
+		}
+	}
+
+	return plumbing.ZeroHash, false
+}
+
 func objectsToPush(commands []*packp.Command) []plumbing.Hash {
 	objects := make([]plumbing.Hash, 0, len(commands))
 	for _, cmd := range commands {
@@ -1276,6 +1854,126 @@ func objectsToPush(commands []*packp.Command) []plumbing.Hash {
 	return objects
 }
 
+// thinPackBases returns the objects of the parents of the pushed commits
+// which are not pushed, which the server has, differing from the pushed ones
+// at the same paths: the pushed trees and blobs may be deltified against them
+// in a thin pack.
+func thinPackBases(s storer.EncodedObjectStorer, tips, pushed []plumbing.Hash) ([]plumbing.Hash, error) {
+	inPack := make(map[plumbing.Hash]bool, len(pushed))
+	for _, h := range pushed {
+		inPack[h] = true
+	}
+
+	var bases []plumbing.Hash
+	added := make(map[plumbing.Hash]bool)
+	addBase := func(h plumbing.Hash) {
+		if !inPack[h] && !added[h] {
+			added[h] = true
+			bases = append(bases, h)
+		}
+	}
+
+	var pairTrees func(base, tree *object.Tree) error
+	pairTrees = func(base, tree *object.Tree) error {
+		addBase(base.Hash)
+		entries := make(map[string]object.TreeEntry, len(base.Entries))
+		for _, e := range base.Entries {
+			entries[e.Name] = e
+		}
+
+		for _, e := range tree.Entries {
+			be, ok := entries[e.Name]
+			if !ok || be.Hash == e.Hash || !inPack[e.Hash] {
+				continue
+			}
+
+			switch {
+			case e.Mode == filemode.Dir && be.Mode == filemode.Dir:
+				bt, err := object.GetTree(s, be.Hash)
+				if err != nil {
+					return err
+				}
+
+				t, err := object.GetTree(s, e.Hash)
+				if err != nil {
+					return err
+				}
+
+				if err := pairTrees(bt, t); err != nil {
+					return err
+				}
+			case e.Mode.IsFile() && be.Mode.IsFile():
+				addBase(be.Hash)
+			}
+		}
+
+		return nil
+	}
+
+	visited := make(map[plumbing.Hash]bool)
+	for len(tips) > 0 {
+		h := tips[len(tips)-1]
+		tips = tips[:len(tips)-1]
+		if visited[h] || !inPack[h] {
+			continue
+		}
+
+		visited[h] = true
+		o, err := object.GetObject(s, h)
+		if err != nil {
+			return nil, err
+		}
+
+		var c *object.Commit
+		switch o := o.(type) {
+		case *object.Tag:
+			tips = append(tips, o.Target)
+			continue
+		case *object.Commit:
+			c = o
+		default:
+			continue
+		}
+
+		for _, p := range c.ParentHashes {
+			if inPack[p] {
+				tips = append(tips, p)
+				continue
+			}
+
+			// The parents missing from shallow repositories are ignored.
+			parent, err := object.GetCommit(s, p)
+			if errors.Is(err, plumbing.ErrObjectNotFound) {
+				continue
+			}
+
+			if err != nil {
+				return nil, err
+			}
+
+			if parent.TreeHash == c.TreeHash {
+				continue
+			}
+
+			bt, err := parent.Tree()
+			if err != nil {
+				return nil, err
+			}
+
+			t, err := c.Tree()
+			if err != nil {
+				return nil, err
+			}
+
+			if err := pairTrees(bt, t); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	return bases, nil
+}
+
 func referencesToHashes(refs storer.ReferenceStorer) ([]plumbing.Hash, error) {
 	iter, err := refs.IterReferences()
 	if err != nil {
@@ -1328,9 +2026,21 @@ func pushHashes(
 	}
 
 	if !allDelete {
+		opts := []packfile.EncoderOption{packfile.WithMaxDeltaDepth(config.Pack.Depth)}
+		// A thin pack is sent, as git does, unless the server does not
+		// accept them.
+		if !conn.Capabilities().Supports(capability.NoThin) {
+			bases, err := thinPackBases(s, objectsToPush(cmds), hs)
+			if err != nil {
+				return err
+			}
+
+			opts = append(opts, packfile.WithThinPack(bases))
+		}
+
 		req.Packfile = rd
 		go func() {
-			e := packfile.NewEncoder(wr, s, useRefDeltas)
+			e := packfile.NewEncoder(wr, s, useRefDeltas, opts...)
 			if _, err := e.Encode(hs, config.Pack.Window); err != nil {
 				done <- wr.CloseWithError(err)
 				return
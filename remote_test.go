@@ -6,26 +6,40 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"maps"
 	"net/http"
 	"net/http/httptest"
+	"net/url"
+	"os"
 	"path/filepath"
+	"regexp"
 	"runtime"
+	"slices"
+	"strconv"
 	"strings"
 	"testing"
 	"time"
 
 	"github.com/go-git/go-billy/v6/memfs"
+	"github.com/go-git/go-billy/v6/osfs"
 	"github.com/go-git/go-billy/v6/util"
 	fixtures "github.com/go-git/go-git-fixtures/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 	"github.com/stretchr/testify/suite"
 
 	"github.com/go-git/go-git/v6/config"
 	"github.com/go-git/go-git/v6/plumbing"
 	"github.com/go-git/go-git/v6/plumbing/cache"
+	"github.com/go-git/go-git/v6/plumbing/format/packfile"
 	"github.com/go-git/go-git/v6/plumbing/object"
+	"github.com/go-git/go-git/v6/plumbing/protocol"
 	"github.com/go-git/go-git/v6/plumbing/protocol/packp"
 	"github.com/go-git/go-git/v6/plumbing/protocol/packp/capability"
 	"github.com/go-git/go-git/v6/plumbing/storer"
+	"github.com/go-git/go-git/v6/plumbing/transport"
+	"github.com/go-git/go-git/v6/plumbing/transport/file"
+	githttp "github.com/go-git/go-git/v6/plumbing/transport/http"
 	"github.com/go-git/go-git/v6/storage"
 	"github.com/go-git/go-git/v6/storage/filesystem"
 	"github.com/go-git/go-git/v6/storage/memory"
@@ -112,6 +126,33 @@ func (s *RemoteSuite) TestFetchExactSHA1_NotSupported() {
 	})
 
 	s.ErrorIs(err, ErrExactSHA1NotSupported)
+	s.ErrorContains(err, "35e85108805c84807bc66a02d91535e1e24b38b9")
+}
+
+func (s *RemoteSuite) TestFetchExactSHA1_AllowReachable() {
+	url := s.GetBasicLocalRepositoryURL()
+	srv := filesystem.NewStorage(osfs.New(url), cache.NewObjectLRUDefault())
+	cfg, err := srv.Config()
+	s.Require().NoError(err)
+	cfg.UploadPack.AllowReachableSHA1InWant = true
+	s.Require().NoError(srv.SetConfig(cfg))
+
+	sto := memory.NewStorage()
+	r := NewRemote(sto, &config.RemoteConfig{URLs: []string{url}})
+	s.testFetch(r, &FetchOptions{
+		RefSpecs: []config.RefSpec{
+			config.RefSpec("b029517f6300c2da0f4b651b8642506cd6aaf45d:refs/heads/foo"),
+		},
+	}, []*plumbing.Reference{
+		plumbing.NewReferenceFromStrings("refs/heads/foo", "b029517f6300c2da0f4b651b8642506cd6aaf45d"),
+	})
+
+	_, err = object.GetCommit(sto, plumbing.NewHash("b029517f6300c2da0f4b651b8642506cd6aaf45d"))
+	s.NoError(err)
+
+	// The commits newer than the one fetched are not fetched.
+	_, err = object.GetCommit(sto, plumbing.NewHash("6ecf0ef2c2dffb796033e5a02219af86ec6584e5"))
+	s.ErrorIs(err, plumbing.ErrObjectNotFound)
 }
 
 func (s *RemoteSuite) TestFetchWildcardTags() {
@@ -604,6 +645,54 @@ func (s *RemoteSuite) TestPushToEmptyRepository() {
 	AssertReferences(s.T(), server, expected)
 }
 
+// schemeTransport serves the endpoints of a custom scheme as local
+// repositories, counting the sessions opened.
+type schemeTransport struct {
+	transport.Transport
+	sessions int
+}
+
+func (t *schemeTransport) NewSession(st storage.Storer, ep *transport.Endpoint, auth transport.AuthMethod) (transport.Session, error) {
+	t.sessions++
+	local := *ep
+	local.Scheme = "file"
+	return t.Transport.NewSession(st, &local, auth)
+}
+
+func (s *RemoteSuite) TestCustomScheme() {
+	custom := &schemeTransport{Transport: file.DefaultTransport}
+	transport.Register("mygit", custom)
+	defer transport.Unregister("mygit")
+
+	r := NewRemote(memory.NewStorage(), &config.RemoteConfig{
+		Name: DefaultRemoteName,
+		URLs: []string{"mygit://" + s.GetBasicLocalRepositoryURL()},
+	})
+
+	s.testFetch(r, &FetchOptions{
+		RefSpecs: []config.RefSpec{
+			config.RefSpec("+refs/heads/master:refs/remotes/origin/master"),
+		},
+	}, []*plumbing.Reference{
+		plumbing.NewReferenceFromStrings("refs/remotes/origin/master", "6ecf0ef2c2dffb796033e5a02219af86ec6584e5"),
+	})
+
+	url := s.T().TempDir()
+	server, err := PlainInit(url, true)
+	s.Require().NoError(err)
+
+	r = NewRemote(r.s, &config.RemoteConfig{Name: "server", URLs: []string{"mygit://" + url}})
+	s.Require().NoError(r.Push(&PushOptions{
+		RemoteName: "server",
+		RefSpecs:   []config.RefSpec{"refs/remotes/origin/master:refs/heads/master"},
+	}))
+
+	AssertReferences(s.T(), server, map[string]string{
+		"refs/heads/master": "6ecf0ef2c2dffb796033e5a02219af86ec6584e5",
+	})
+	s.Equal(2, custom.sessions)
+}
+
 func (s *RemoteSuite) TestPushContext() {
 	url := s.T().TempDir()
 	_, err := PlainInit(url, true)
@@ -1143,6 +1232,189 @@ func (s *RemoteSuite) TestPushForceWithLease_failure() {
 	}
 }
 
+func (s *RemoteSuite) TestPushForceWithLeaseOnlyNamedRef() {
+	f := fixtures.Basic().One()
+	sto := filesystem.NewStorage(f.DotGit(), cache.NewObjectLRUDefault())
+	dstFs := f.DotGit(fixtures.WithTargetDir(s.T().TempDir))
+	dstSto := filesystem.NewStorage(dstFs, cache.NewObjectLRUDefault())
+
+	// Both branches are rewound.
+	rewound := plumbing.NewHash("35e85108805c84807bc66a02d91535e1e24b38b9")
+	for _, name := range []plumbing.ReferenceName{"refs/heads/branch", plumbing.Master} {
+		s.Require().NoError(sto.SetReference(plumbing.NewHashReference(name, rewound)))
+	}
+
+	r := NewRemote(sto, &config.RemoteConfig{
+		Name: DefaultRemoteName,
+		URLs: []string{dstFs.Root()},
+	})
+
+	// The lease only forces the update of the branch it names.
+	err := r.Push(&PushOptions{
+		RefSpecs:       []config.RefSpec{"refs/heads/branch:refs/heads/branch", "refs/heads/master:refs/heads/master"},
+		ForceWithLease: &ForceWithLease{RefName: "refs/heads/branch"},
+	})
+	s.ErrorContains(err, "non-fast-forward update: refs/heads/master")
+
+	s.NoError(r.Push(&PushOptions{
+		RefSpecs:       []config.RefSpec{"refs/heads/branch:refs/heads/branch"},
+		ForceWithLease: &ForceWithLease{RefName: "refs/heads/branch"},
+	}))
+
+	ref, err := dstSto.Reference("refs/heads/branch")
+	s.Require().NoError(err)
+	s.Equal(rewound, ref.Hash())
+}
+
+func (s *RemoteSuite) TestPushForceWithLeaseRemoteTrackingRef() {
+	f := fixtures.Basic().One()
+	sto := filesystem.NewStorage(f.DotGit(), cache.NewObjectLRUDefault())
+	dstFs := f.DotGit(fixtures.WithTargetDir(s.T().TempDir))
+
+	rewound := plumbing.NewHash("35e85108805c84807bc66a02d91535e1e24b38b9")
+	s.Require().NoError(sto.SetReference(plumbing.NewHashReference("refs/heads/branch", rewound)))
+
+	// Without remote-tracking reference, the remote reference is expected
+	// not to exist.
+	r := NewRemote(sto, &config.RemoteConfig{
+		Name:  "mirror",
+		URLs:  []string{dstFs.Root()},
+		Fetch: []config.RefSpec{"+refs/heads/*:refs/remotes/mirror/*"},
+	})
+
+	err := r.Push(&PushOptions{
+		RemoteName:     "mirror",
+		RefSpecs:       []config.RefSpec{"refs/heads/branch:refs/heads/branch"},
+		ForceWithLease: &ForceWithLease{},
+	})
+	s.ErrorContains(err, "non-fast-forward update: refs/heads/branch")
+
+	s.NoError(r.Push(&PushOptions{
+		RemoteName:     "mirror",
+		RefSpecs:       []config.RefSpec{"refs/heads/branch:refs/heads/new"},
+		ForceWithLease: &ForceWithLease{},
+	}))
+
+	// The remote-tracking reference is the one of the fetch refspec.
+	r = NewRemote(sto, &config.RemoteConfig{
+		Name:  "other",
+		URLs:  []string{dstFs.Root()},
+		Fetch: []config.RefSpec{"+refs/heads/*:refs/remotes/origin/*"},
+	})
+
+	s.NoError(r.Push(&PushOptions{
+		RemoteName:     "other",
+		RefSpecs:       []config.RefSpec{"refs/heads/branch:refs/heads/branch"},
+		ForceWithLease: &ForceWithLease{},
+	}))
+}
+
+// capabilitiesConnection is a connection only advertising the given
+// capabilities.
+type capabilitiesConnection struct {
+	transport.Connection
+	caps *capability.List
+}
+
+func (c *capabilitiesConnection) Capabilities() *capability.List {
+	return c.caps
+}
+
+func (s *RemoteSuite) TestPushNotSupportedCapabilities() {
+	r := NewRemote(memory.NewStorage(), &config.RemoteConfig{
+		Name: DefaultRemoteName,
+		URLs: []string{"https://example.com/foo.git"},
+	})
+
+	caps := capability.NewList()
+	s.Require().NoError(caps.Set(capability.ReportStatus))
+	conn := &capabilitiesConnection{caps: caps}
+	remoteRefs := memory.NewStorage()
+
+	err := r.sendPack(context.Background(), conn, remoteRefs, &PushOptions{
+		RefSpecs: []config.RefSpec{"refs/heads/*:refs/heads/*"},
+		Atomic:   true,
+	})
+	s.ErrorIs(err, ErrAtomicNotSupported)
+
+	err = r.sendPack(context.Background(), conn, remoteRefs, &PushOptions{
+		RefSpecs: []config.RefSpec{"refs/heads/*:refs/heads/*"},
+		Options:  []string{"ci.skip"},
+	})
+	s.ErrorIs(err, ErrPushOptionsNotSupported)
+}
+
+// reportConnection is a connection to a remote rejecting the update of the
+// given references.
+type reportConnection struct {
+	capabilitiesConnection
+	rejected map[plumbing.ReferenceName]string
+}
+
+func (c *reportConnection) Push(_ context.Context, req *transport.PushRequest) error {
+	report := packp.NewReportStatus()
+	report.UnpackStatus = "ok"
+	for _, cmd := range req.Commands {
+		status := "ok"
+		if msg, ok := c.rejected[cmd.Name]; ok {
+			status = msg
+		}
+
+		report.CommandStatuses = append(report.CommandStatuses, &packp.CommandStatus{
+			ReferenceName: cmd.Name,
+			Status:        status,
+		})
+	}
+
+	return &packp.ReportError{Report: report}
+}
+
+func (s *RemoteSuite) TestPushRejectedRefs() {
+	sto := filesystem.NewStorage(fixtures.Basic().One().DotGit(), cache.NewObjectLRUDefault())
+	r := NewRemote(sto, &config.RemoteConfig{
+		Name:  "other",
+		URLs:  []string{"https://example.com/foo.git"},
+		Fetch: []config.RefSpec{"+refs/heads/*:refs/remotes/other/*"},
+	})
+
+	caps := capability.NewList()
+	s.Require().NoError(caps.Set(capability.ReportStatus))
+	conn := &reportConnection{
+		capabilitiesConnection: capabilitiesConnection{caps: caps},
+		rejected:               map[plumbing.ReferenceName]string{"refs/heads/master": "pre-receive hook declined"},
+	}
+
+	err := r.sendPack(context.Background(), conn, memory.NewStorage(), &PushOptions{
+		RemoteName: "other",
+		RemoteURL:  "https://example.com/foo.git",
+		RefSpecs:   []config.RefSpec{"refs/heads/branch:refs/heads/branch", "refs/heads/master:refs/heads/master"},
+	})
+
+	var perr *PushError
+	s.Require().ErrorAs(err, &perr)
+	s.ErrorAs(err, &packp.CommandStatusErr{})
+	s.Equal(&PushResult{
+		UnpackStatus: "ok",
+		Refs: []PushRefResult{{
+			RefName: "refs/heads/branch",
+			New:     plumbing.NewHash("e8d3ffab552895c19b9fcf7aa264d277cde33881"),
+			Status:  PushRefUpdated,
+		}, {
+			RefName: "refs/heads/master",
+			New:     plumbing.NewHash("6ecf0ef2c2dffb796033e5a02219af86ec6584e5"),
+			Status:  PushRefRejected,
+			Message: "pre-receive hook declined",
+		}},
+	}, perr.Result)
+
+	// Only the remote-tracking reference of the updated branch is updated.
+	ref, err := sto.Reference("refs/remotes/other/branch")
+	s.Require().NoError(err)
+	s.Equal(plumbing.NewHash("e8d3ffab552895c19b9fcf7aa264d277cde33881"), ref.Hash())
+	_, err = sto.Reference("refs/remotes/other/master")
+	s.ErrorIs(err, plumbing.ErrReferenceNotFound)
+}
+
 func (s *RemoteSuite) TestPushPrune() {
 	server, err := PlainClone(s.T().TempDir(), &CloneOptions{URL: s.GetBasicLocalRepositoryURL()})
 	s.Require().NoError(err)
@@ -1227,6 +1499,69 @@ func (s *RemoteSuite) TestPushNewReference() {
 	})
 }
 
+func (s *RemoteSuite) TestPushThinPack() {
+	url := s.T().TempDir()
+	server, err := PlainClone(url, &CloneOptions{URL: s.GetBasicLocalRepositoryURL(), Bare: true})
+	s.Require().NoError(err)
+
+	r, err := PlainClone(s.T().TempDir(), &CloneOptions{URL: url})
+	s.Require().NoError(err)
+
+	w, err := r.Worktree()
+	s.Require().NoError(err)
+	f, err := w.Filesystem.OpenFile("LICENSE", os.O_APPEND|os.O_WRONLY, 0)
+	s.Require().NoError(err)
+	_, err = f.Write([]byte("\nSome more terms.\n"))
+	s.Require().NoError(err)
+	s.Require().NoError(f.Close())
+	_, err = w.Add("LICENSE")
+	s.Require().NoError(err)
+	h, err := w.Commit("update license", &CommitOptions{Author: defaultSignature()})
+	s.Require().NoError(err)
+
+	packs, err := server.Storer.(storer.PackedObjectStorer).ObjectPacks()
+	s.Require().NoError(err)
+
+	s.Require().NoError(r.Push(&PushOptions{}))
+	AssertReferences(s.T(), server, map[string]string{
+		"refs/heads/master": h.String(),
+	})
+
+	// The pushed thin pack, whose blob is a delta of the previous LICENSE,
+	// is completed by the server with the bases of its deltas.
+	after, err := server.Storer.(storer.PackedObjectStorer).ObjectPacks()
+	s.Require().NoError(err)
+	s.Require().Len(after, len(packs)+1)
+	for _, pack := range after {
+		if slices.Contains(packs, pack) {
+			continue
+		}
+
+		f, err := os.Open(filepath.Join(url, "objects", "pack", fmt.Sprintf("pack-%s.pack", pack)))
+		s.Require().NoError(err)
+		defer f.Close()
+
+		scanner := packfile.NewScanner(f)
+		s.Require().True(scanner.Scan())
+		s.Greater(scanner.Data().Value().(packfile.Header).ObjectsQty, uint32(3))
+
+		_, err = f.Seek(0, io.SeekStart)
+		s.Require().NoError(err)
+		_, err = packfile.NewParser(f).Parse()
+		s.Require().NoError(err)
+	}
+
+	server, err = PlainOpen(url)
+	s.Require().NoError(err)
+	commit, err := server.CommitObject(h)
+	s.Require().NoError(err)
+	file, err := commit.File("LICENSE")
+	s.Require().NoError(err)
+	content, err := file.Contents()
+	s.Require().NoError(err)
+	s.True(strings.HasSuffix(content, "\nSome more terms.\n"))
+}
+
 func (s *RemoteSuite) TestPushNewReferenceAndDeleteInBatch() {
 	server, err := PlainClone(s.T().TempDir(), &CloneOptions{URL: s.GetBasicLocalRepositoryURL()})
 	s.Require().NoError(err)
@@ -1411,6 +1746,28 @@ func (s *RemoteSuite) TestListPeeling() {
 	}
 }
 
+func (s *RemoteSuite) TestListSymrefAndPeeled() {
+	url := s.GetLocalRepositoryURL(fixtures.ByURL("https://github.com/git-fixtures/tags.git").One())
+
+	for _, version := range []protocol.Version{protocol.V0, protocol.V2} {
+		remote := NewRemote(memory.NewStorage(), &config.RemoteConfig{
+			Name: DefaultRemoteName,
+			URLs: []string{url},
+		})
+
+		refs, err := remote.List(&ListOptions{PeelingOption: AppendPeeled, ProtocolVersion: version})
+		s.Require().NoError(err)
+		s.Contains(refs, plumbing.NewSymbolicReference(plumbing.HEAD, plumbing.Master), version)
+		s.Contains(refs, plumbing.NewReferenceFromStrings("refs/tags/annotated-tag", "b742a2a9fa0afcfa9a6fad080980fbc26b007c69"), version)
+
+		peeled, ok := PeeledHash(refs, "refs/tags/annotated-tag")
+		s.True(ok, version)
+		s.Equal(plumbing.NewHash("f7b877701fbf855b44c0a9e86f3fdce2c298b07f"), peeled, version)
+		_, ok = PeeledHash(refs, "refs/tags/lightweight-tag")
+		s.False(ok, version)
+	}
+}
+
 func (s *RemoteSuite) TestListTimeout() {
 	// Create a server that blocks until the request context is done
 	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
@@ -1430,6 +1787,61 @@ func (s *RemoteSuite) TestListTimeout() {
 	s.ErrorIs(err, context.DeadlineExceeded)
 }
 
+func (s *RemoteSuite) TestListCredentialHelper() {
+	s.T().Setenv("HOME", s.T().TempDir())
+	s.T().Setenv("XDG_CONFIG_HOME", "")
+
+	var authorized int
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if username, password, ok := r.BasicAuth(); !ok || username != "user" || password != "secret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+
+		authorized++
+		pkt := func(line string) string { return fmt.Sprintf("%04x%s", len(line)+4, line) }
+		w.Header().Set("Content-Type", "application/x-git-upload-pack-advertisement")
+		fmt.Fprint(w, pkt("# service=git-upload-pack\n")+"0000"+
+			pkt("6ecf0ef2c2dffb796033e5a02219af86ec6584e5 refs/heads/master\x00agent=test\n")+"0000")
+	}))
+	defer srv.Close()
+
+	u, err := url.Parse(srv.URL)
+	s.Require().NoError(err)
+
+	credentials := filepath.Join(s.T().TempDir(), "credentials")
+	s.Require().NoError(os.WriteFile(credentials, []byte("http://user:secret@"+u.Host+"\n"), 0o600))
+
+	st := memory.NewStorage()
+	cfg, err := st.Config()
+	s.Require().NoError(err)
+	cfg.Raw.Section("credential").AddOption("helper", "store --file="+credentials)
+	s.Require().NoError(st.SetConfig(cfg))
+
+	remote := NewRemote(st, &config.RemoteConfig{
+		Name: DefaultRemoteName,
+		URLs: []string{srv.URL + "/repo.git"},
+	})
+
+	refs, err := remote.List(&ListOptions{})
+	s.Require().NoError(err)
+	s.Len(refs, 1)
+	s.Equal(1, authorized)
+
+	// The explicit auth takes precedence over the credential helpers.
+	_, err = remote.List(&ListOptions{Auth: &githttp.BasicAuth{Username: "user", Password: "wrong"}})
+	s.ErrorIs(err, transport.ErrAuthenticationRequired)
+
+	// The credential rejected by the server is erased.
+	s.Require().NoError(os.WriteFile(credentials, []byte("http://user:wrong@"+u.Host+"\n"), 0o600))
+	_, err = remote.List(&ListOptions{})
+	s.ErrorIs(err, transport.ErrAuthenticationRequired)
+
+	b, err := os.ReadFile(credentials)
+	s.NoError(err)
+	s.Empty(b)
+}
+
 /*
 func (s *RemoteSuite) TestUpdateShallows() {
 	hashes := []plumbing.Hash{
@@ -1664,6 +2076,111 @@ func (s *RemoteSuite) TestFetchPruneTags() {
 	s.ErrorContains(err, "reference not found")
 }
 
+func (s *RemoteSuite) TestFetchPruneOnlyRefSpecs() {
+	url := s.T().TempDir()
+	source, err := PlainClone(url, &CloneOptions{
+		URL:  s.GetBasicLocalRepositoryURL(),
+		Bare: true,
+	})
+	s.Require().NoError(err)
+
+	master, err := source.Reference(plumbing.Master, true)
+	s.Require().NoError(err)
+	for _, name := range []plumbing.ReferenceName{"refs/heads/branch", "refs/tags/v2"} {
+		s.Require().NoError(source.Storer.SetReference(plumbing.NewHashReference(name, master.Hash())))
+	}
+
+	r, err := PlainClone(s.T().TempDir(), &CloneOptions{URL: url, Bare: true})
+	s.Require().NoError(err)
+
+	// The references not covered by the refspec of the remote are kept.
+	for _, name := range []plumbing.ReferenceName{"refs/heads/local", "refs/remotes/other/branch"} {
+		s.Require().NoError(r.Storer.SetReference(plumbing.NewHashReference(name, master.Hash())))
+	}
+	s.Require().NoError(r.Storer.SetReference(plumbing.NewSymbolicReference("refs/remotes/origin/HEAD", "refs/remotes/origin/branch")))
+
+	s.Require().NoError(source.Storer.RemoveReference("refs/heads/branch"))
+	s.Require().NoError(source.Storer.RemoveReference("refs/tags/v2"))
+
+	var pruned []plumbing.ReferenceName
+	onPrune := func(ref *plumbing.Reference) { pruned = append(pruned, ref.Name()) }
+	s.Require().NoError(r.Fetch(&FetchOptions{Prune: true, OnPrune: onPrune}))
+	s.Equal([]plumbing.ReferenceName{"refs/remotes/origin/branch"}, pruned)
+
+	AssertReferences(s.T(), r, map[string]string{
+		"refs/heads/local":           master.Hash().String(),
+		"refs/remotes/other/branch":  master.Hash().String(),
+		"refs/remotes/origin/master": master.Hash().String(),
+		"refs/tags/v2":               master.Hash().String(),
+	})
+	head, err := r.Reference("refs/remotes/origin/HEAD", false)
+	s.Require().NoError(err)
+	s.Equal(plumbing.SymbolicReference, head.Type())
+
+	// Tags are only pruned with PruneTags.
+	pruned = nil
+	s.Require().NoError(r.Fetch(&FetchOptions{PruneTags: true, OnPrune: onPrune}))
+	s.Equal([]plumbing.ReferenceName{"refs/tags/v2"}, pruned)
+	AssertReferencesMissing(s.T(), r, []string{"refs/tags/v2"})
+
+	cfg, err := r.Config()
+	s.Require().NoError(err)
+	s.Equal([]config.RefSpec{"+refs/heads/*:refs/remotes/origin/*"}, cfg.Remotes[DefaultRemoteName].Fetch)
+}
+
+func (s *RemoteSuite) TestFetchMirror() {
+	url := s.T().TempDir()
+	source, err := PlainClone(url, &CloneOptions{
+		URL:  s.GetBasicLocalRepositoryURL(),
+		Bare: true,
+	})
+	s.Require().NoError(err)
+
+	master, err := source.Reference(plumbing.Master, true)
+	s.Require().NoError(err)
+	commit, err := source.CommitObject(master.Hash())
+	s.Require().NoError(err)
+	parent := commit.ParentHashes[0]
+
+	for _, name := range []plumbing.ReferenceName{"refs/notes/commits", "refs/replace/" + plumbing.ReferenceName(parent.String())} {
+		s.Require().NoError(source.Storer.SetReference(plumbing.NewHashReference(name, master.Hash())))
+	}
+
+	r, err := PlainClone(s.T().TempDir(), &CloneOptions{
+		URL:    url,
+		Mirror: true,
+	})
+	s.Require().NoError(err)
+
+	cfg, err := r.Config()
+	s.Require().NoError(err)
+	s.True(cfg.Core.IsBare)
+	s.True(cfg.Remotes[DefaultRemoteName].Mirror)
+	s.Equal([]config.RefSpec{"+refs/*:refs/*"}, cfg.Remotes[DefaultRemoteName].Fetch)
+	s.Empty(cfg.Branches)
+
+	AssertReferences(s.T(), r, map[string]string{
+		"refs/heads/master":               master.Hash().String(),
+		"refs/remotes/origin/branch":      "e8d3ffab552895c19b9fcf7aa264d277cde33881",
+		"refs/notes/commits":              master.Hash().String(),
+		"refs/replace/" + parent.String(): master.Hash().String(),
+	})
+
+	// master is rewound, branch deleted and a new reference created.
+	s.Require().NoError(source.Storer.SetReference(plumbing.NewHashReference(plumbing.Master, parent)))
+	s.Require().NoError(source.Storer.RemoveReference("refs/remotes/origin/branch"))
+	s.Require().NoError(source.Storer.SetReference(plumbing.NewHashReference("refs/heads/new", master.Hash())))
+
+	s.Require().NoError(r.Fetch(&FetchOptions{}))
+	AssertReferences(s.T(), r, map[string]string{
+		"refs/heads/master": parent.String(),
+		"refs/heads/new":    master.Hash().String(),
+	})
+	AssertReferencesMissing(s.T(), r, []string{"refs/remotes/origin/branch"})
+
+	s.ErrorIs(r.Fetch(&FetchOptions{}), NoErrAlreadyUpToDate)
+}
+
 func (s *RemoteSuite) TestCanPushShasToReference() {
 	d := s.T().TempDir()
 
@@ -1910,3 +2427,228 @@ func writeCommitToRef(t *testing.T, repo *Repository, refName string, treeID plu
 
 	return commitID
 }
+
+func (s *RemoteSuite) TestListRefPrefixes() {
+	remote := NewRemote(memory.NewStorage(), &config.RemoteConfig{
+		Name: DefaultRemoteName,
+		URLs: []string{s.GetBasicLocalRepositoryURL()},
+	})
+
+	refs, err := remote.List(&ListOptions{RefPrefixes: []string{"refs/heads/"}})
+	s.NoError(err)
+	s.Equal([]*plumbing.Reference{
+		plumbing.NewReferenceFromStrings("refs/heads/branch", "e8d3ffab552895c19b9fcf7aa264d277cde33881"),
+		plumbing.NewReferenceFromStrings("refs/heads/master", "6ecf0ef2c2dffb796033e5a02219af86ec6584e5"),
+	}, refs)
+}
+
+func (s *RemoteSuite) TestListProtocolV2() {
+	remote := NewRemote(memory.NewStorage(), &config.RemoteConfig{
+		Name: DefaultRemoteName,
+		URLs: []string{setupGitHTTPBackend(s.T())},
+	})
+
+	refs, err := remote.List(&ListOptions{
+		ProtocolVersion: protocol.V2,
+		RefPrefixes:     []string{"refs/heads/"},
+	})
+	s.NoError(err)
+	s.Equal([]*plumbing.Reference{
+		plumbing.NewReferenceFromStrings("refs/heads/branch", "e8d3ffab552895c19b9fcf7aa264d277cde33881"),
+		plumbing.NewReferenceFromStrings("refs/heads/master", "6ecf0ef2c2dffb796033e5a02219af86ec6584e5"),
+	}, refs)
+}
+
+func (s *RemoteSuite) TestFetchProtocolV2() {
+	st := memory.NewStorage()
+	cfg, err := st.Config()
+	s.Require().NoError(err)
+	cfg.Protocol.Version = protocol.V2
+	s.Require().NoError(st.SetConfig(cfg))
+
+	remote := NewRemote(st, &config.RemoteConfig{
+		Name:  DefaultRemoteName,
+		URLs:  []string{setupGitHTTPBackend(s.T())},
+		Fetch: []config.RefSpec{config.RefSpec(fmt.Sprintf(config.DefaultFetchRefSpec, DefaultRemoteName))},
+	})
+
+	s.testFetch(remote, &FetchOptions{}, []*plumbing.Reference{
+		plumbing.NewReferenceFromStrings("refs/remotes/origin/master", "6ecf0ef2c2dffb796033e5a02219af86ec6584e5"),
+		plumbing.NewReferenceFromStrings("refs/remotes/origin/branch", "e8d3ffab552895c19b9fcf7aa264d277cde33881"),
+		plumbing.NewReferenceFromStrings("refs/tags/v1.0.0", "6ecf0ef2c2dffb796033e5a02219af86ec6584e5"),
+	})
+
+	s.ErrorIs(remote.Fetch(&FetchOptions{}), NoErrAlreadyUpToDate)
+}
+
+func (s *RemoteSuite) TestFetchDeepen() {
+	url := setupGitHTTPBackend(s.T())
+
+	r, err := Clone(memory.NewStorage(), nil, &CloneOptions{
+		URL:          url,
+		Depth:        1,
+		SingleBranch: true,
+		Tags:         plumbing.NoTags,
+	})
+	s.Require().NoError(err)
+
+	// countCommits walks the first parents of HEAD up to the shallow
+	// boundary.
+	countCommits := func() int {
+		shallows, err := r.Storer.Shallow()
+		s.Require().NoError(err)
+		head, err := r.Head()
+		s.Require().NoError(err)
+		c, err := r.CommitObject(head.Hash())
+		s.Require().NoError(err)
+
+		n := 1
+		for c.NumParents() > 0 && !slices.Contains(shallows, c.Hash) {
+			c, err = c.Parent(0)
+			s.Require().NoError(err)
+			n++
+		}
+
+		return n
+	}
+
+	shallows, err := r.Storer.Shallow()
+	s.Require().NoError(err)
+	s.Len(shallows, 1)
+	s.Equal(1, countCommits())
+
+	err = r.Fetch(&FetchOptions{Deepen: 4, Tags: plumbing.NoTags})
+	s.Require().NoError(err)
+	s.Equal(5, countCommits())
+
+	err = r.Fetch(&FetchOptions{Deepen: 10, Tags: plumbing.NoTags})
+	s.Require().NoError(err)
+	s.Equal(6, countCommits())
+
+	shallows, err = r.Storer.Shallow()
+	s.Require().NoError(err)
+	s.Empty(shallows)
+}
+
+func (s *RemoteSuite) TestFetchShallowSince() {
+	url := setupGitHTTPBackend(s.T())
+
+	for _, version := range []protocol.Version{protocol.V0, protocol.V2} {
+		r, err := Clone(memory.NewStorage(), nil, &CloneOptions{
+			URL:             url,
+			ReferenceName:   plumbing.Master,
+			Depth:           1,
+			SingleBranch:    true,
+			Tags:            plumbing.NoTags,
+			ProtocolVersion: version,
+		})
+		s.Require().NoError(err)
+
+		err = r.Fetch(&FetchOptions{
+			ShallowSince:    time.Unix(1427802494, 0),
+			Tags:            plumbing.NoTags,
+			ProtocolVersion: version,
+		})
+		s.Require().NoError(err)
+
+		shallows, err := r.Storer.Shallow()
+		s.Require().NoError(err)
+		s.Equal([]plumbing.Hash{plumbing.NewHash("1669dce138d9b841a518c64b10914d88f5e488ea")}, shallows, version)
+	}
+}
+
+func (s *RemoteSuite) TestFetchDeepenExclusive() {
+	r := NewRemote(memory.NewStorage(), &config.RemoteConfig{Name: DefaultRemoteName, URLs: []string{"foo"}})
+
+	s.ErrorIs(r.Fetch(&FetchOptions{Depth: 1, Deepen: 1}), ErrDepthDeepenExclusive)
+	s.ErrorIs(r.Fetch(&FetchOptions{Deepen: 1, ShallowSince: time.Now()}), ErrDepthShallowExclusive)
+	s.ErrorIs(r.Fetch(&FetchOptions{Depth: 1, ShallowExclude: []string{"master"}}), ErrDepthShallowExclusive)
+}
+
+// commitHistory makes n commits in the worktree, each changing the file of the
+// given name.
+func commitHistory(t *testing.T, w *Worktree, name string, n int) plumbing.Hash {
+	t.Helper()
+
+	var h plumbing.Hash
+	for i := 0; i < n; i++ {
+		require.NoError(t, util.WriteFile(w.Filesystem, name, []byte(strconv.Itoa(i)), 0o644))
+		_, err := w.Add(name)
+		require.NoError(t, err)
+
+		h, err = w.Commit(fmt.Sprintf("%s %d\n", name, i), &CommitOptions{Author: &object.Signature{
+			Name:  "foo",
+			Email: "foo@foo.foo",
+			When:  time.Unix(1136239445+int64(i)*60, 0),
+		}})
+		require.NoError(t, err)
+	}
+
+	return h
+}
+
+// fetchedObjects returns the number of objects of the packfile sent by the
+// server, as reported by its progress messages.
+func fetchedObjects(t *testing.T, progress string) int {
+	t.Helper()
+
+	m := regexp.MustCompile(`Total (\d+)`).FindStringSubmatch(progress)
+	require.NotNil(t, m, "%q", progress)
+	n, err := strconv.Atoi(m[1])
+	require.NoError(t, err)
+	return n
+}
+
+func TestFetchNegotiator(t *testing.T) {
+	t.Parallel()
+
+	root := t.TempDir()
+	url := serveGitHTTPBackend(t, root) + "/repo/.git"
+	server, err := PlainInit(filepath.Join(root, "repo"), false)
+	require.NoError(t, err)
+	sw, err := server.Worktree()
+	require.NoError(t, err)
+	commitHistory(t, sw, "server", 20)
+
+	// The local commits outnumber the ancestors sent by default, which
+	// then never reach the history shared with the server.
+	local, err := Clone(memory.NewStorage(), memfs.New(), &CloneOptions{URL: url})
+	require.NoError(t, err)
+	lw, err := local.Worktree()
+	require.NoError(t, err)
+	commitHistory(t, lw, "local", maxHavesToVisitPerRef+20)
+	require.NoError(t, local.Storer.RemoveReference("refs/remotes/origin/master"))
+
+	head := commitHistory(t, sw, "server", 1)
+	for _, version := range []protocol.Version{protocol.V0, protocol.V2} {
+		fetch := func(o *FetchOptions) int {
+			st := memory.NewStorage()
+			for _, obj := range local.Storer.(*memory.Storage).Objects {
+				_, err := st.SetEncodedObject(obj)
+				require.NoError(t, err)
+			}
+
+			st.ReferenceStorage = maps.Clone(local.Storer.(*memory.Storage).ReferenceStorage)
+
+			var progress strings.Builder
+			o.Progress = &progress
+			o.ProtocolVersion = version
+			o.RefSpecs = []config.RefSpec{"+refs/heads/master:refs/remotes/origin/master"}
+			r := NewRemote(st, &config.RemoteConfig{Name: DefaultRemoteName, URLs: []string{url}})
+			require.NoError(t, r.Fetch(o))
+
+			ref, err := st.Reference("refs/remotes/origin/master")
+			require.NoError(t, err)
+			assert.Equal(t, head, ref.Hash())
+			return fetchedObjects(t, progress.String())
+		}
+
+		assert.Greater(t, fetch(&FetchOptions{}), 3, version)
+		assert.Equal(t, 3, fetch(&FetchOptions{Negotiator: transport.NewCommitNegotiator}), version)
+
+		// The haves given are sent along with the local references.
+		base, err := server.ResolveRevision("HEAD~1")
+		require.NoError(t, err)
+		assert.Equal(t, 3, fetch(&FetchOptions{Haves: []plumbing.Hash{*base}}), version)
+	}
+}
@@ -1,7 +1,6 @@
 package git
 
 import (
-	"bytes"
 	"context"
 	"encoding/hex"
 	"errors"
@@ -10,10 +9,10 @@ import (
 	"os"
 	"path"
 	"path/filepath"
+	"regexp"
 	"strings"
 	"time"
 
-	"github.com/ProtonMail/go-crypto/openpgp"
 	"github.com/go-git/go-billy/v6"
 	"github.com/go-git/go-billy/v6/osfs"
 
@@ -26,6 +25,7 @@ import (
 	formatcfg "github.com/go-git/go-git/v6/plumbing/format/config"
 	"github.com/go-git/go-git/v6/plumbing/format/packfile"
 	"github.com/go-git/go-git/v6/plumbing/object"
+	"github.com/go-git/go-git/v6/plumbing/object/commitgraph"
 	"github.com/go-git/go-git/v6/plumbing/storer"
 	"github.com/go-git/go-git/v6/storage"
 	"github.com/go-git/go-git/v6/storage/filesystem"
@@ -37,6 +37,9 @@ import (
 // GitDirName this is a special folder where all the git stuff is.
 const GitDirName = ".git"
 
+// localConfigPath is the path of the config file in the git directory.
+const localConfigPath = "config"
+
 var (
 	// ErrBranchExists an error stating the specified branch already exists
 	ErrBranchExists = errors.New("branch already exists")
@@ -64,6 +67,10 @@ var (
 	ErrUnsupportedMergeStrategy    = errors.New("unsupported merge strategy")
 	ErrFastForwardMergeNotPossible = errors.New("not possible to fast-forward merge changes")
 	ErrTargetDirNotEmpty           = errors.New("destination path already exists and is not empty")
+	// ErrObjectFormatNotSupported is returned when the object format of a
+	// repository cannot be set, its storer not implementing
+	// storer.ObjectFormatStorer.
+	ErrObjectFormatNotSupported = errors.New("object format not supported by the storer")
 )
 
 // Repository represents a git repository
@@ -72,6 +79,11 @@ type Repository struct {
 
 	r  map[string]*Remote
 	wt billy.Filesystem
+
+	promisor *promisor
+	// rebase is the state of the rebase in progress, when the storer is not
+	// backed by a filesystem.
+	rebase *RebaseState
 }
 
 type initOptions struct {
@@ -141,6 +153,12 @@ func Init(s storage.Storer, opts ...InitOption) (*Repository, error) {
 		return nil, err
 	}
 
+	if options.objectFormat != storer.ObjectFormat(s) {
+		if err := setObjectFormat(s, options.objectFormat); err != nil {
+			return nil, err
+		}
+	}
+
 	h := plumbing.NewSymbolicReference(plumbing.HEAD, options.defaultBranch)
 	if err := s.SetReference(h); err != nil {
 		return nil, err
@@ -154,6 +172,32 @@ func Init(s storage.Storer, opts ...InitOption) (*Repository, error) {
 	return r, setWorktreeAndStoragePaths(r, options.workTree)
 }
 
+// setObjectFormat sets the object format of the empty repository of s, in
+// its config and in its storer.
+func setObjectFormat(s storage.Storer, f formatcfg.ObjectFormat) error {
+	fs, ok := s.(storer.ObjectFormatStorer)
+	if !ok {
+		return fmt.Errorf("%w: %s", ErrObjectFormatNotSupported, f)
+	}
+
+	cfg, err := s.Config()
+	if err != nil {
+		return err
+	}
+
+	cfg.Extensions.ObjectFormat = f
+	if f != formatcfg.SHA1 {
+		cfg.Core.RepositoryFormatVersion = formatcfg.Version_1
+	}
+
+	if err := s.SetConfig(cfg); err != nil {
+		return err
+	}
+
+	fs.SetObjectFormat(f)
+	return nil
+}
+
 func initStorer(s storer.Storer) error {
 	if i, ok := s.(storer.Initializer); ok {
 		return i.Init()
@@ -237,7 +281,12 @@ func Open(s storage.Storer, worktree billy.Filesystem) (*Repository, error) {
 		return nil, err
 	}
 
-	return newRepository(s, worktree), nil
+	r := newRepository(s, worktree)
+	if err := r.setupPromisor(nil); err != nil {
+		return nil, err
+	}
+
+	return r, nil
 }
 
 // Clone a repository into the given Storer and worktree Filesystem with the
@@ -249,11 +298,14 @@ func Clone(s storage.Storer, worktree billy.Filesystem, o *CloneOptions) (*Repos
 
 // CloneContext a repository into the given Storer and worktree Filesystem with
 // the given options, if worktree is nil a bare repository is created. If the
-// given storer is not empty ErrTargetDirNotEmpty is returned.
+// given storer is not empty ErrTargetDirNotEmpty is returned, unless
+// CloneOptions.Resumable is set and the storer holds a failed clone of the
+// same URL, which is then resumed.
 //
 // The provided Context must be non-nil. If the context expires before the
-// operation is complete, an error is returned. The context only affects the
-// transport operations.
+// operation is complete, an error is returned. The context affects the
+// transport operations, the resolution of the deltas of the packfile received
+// and the checkout of the worktree.
 func CloneContext(
 	ctx context.Context, s storage.Storer, worktree billy.Filesystem, o *CloneOptions,
 ) (*Repository, error) {
@@ -269,6 +321,13 @@ func CloneContext(
 	r, err := Init(s,
 		WithWorkTree(worktree),
 	)
+	if errors.Is(err, ErrTargetDirNotEmpty) && o.Resumable {
+		r, err = Open(s, worktree)
+		if err == nil {
+			err = r.checkResumableClone(o)
+		}
+	}
+
 	if err != nil {
 		return nil, err
 	}
@@ -334,7 +393,10 @@ func PlainInit(path string, isBare bool, options ...InitOption) (*Repository, er
 
 // PlainOpen opens a git repository from the given path. It detects if the
 // repository is bare or a normal one. If the path doesn't contain a valid
-// repository ErrRepositoryNotExists is returned
+// repository ErrRepositoryNotExists is returned. A linked worktree, whose .git
+// file points to its git directory, is opened with its own HEAD and index,
+// the objects and references being the ones of the repository it is linked
+// to.
 func PlainOpen(path string) (*Repository, error) {
 	return PlainOpenWithOptions(path, &PlainOpenOptions{})
 }
@@ -355,16 +417,16 @@ func PlainOpenWithOptions(path string, o *PlainOpenOptions) (*Repository, error)
 		return nil, err
 	}
 
-	var repositoryFs billy.Filesystem
+	// The git directory of a linked worktree has its own HEAD and index,
+	// sharing the objects and the references of the common one.
+	dotGitCommon, err := dotGitCommonDirectory(dot)
+	if err != nil {
+		return nil, err
+	}
 
-	if o.EnableDotGitCommonDir {
-		dotGitCommon, err := dotGitCommonDirectory(dot)
-		if err != nil {
-			return nil, err
-		}
+	repositoryFs := dot
+	if dotGitCommon != nil {
 		repositoryFs = dotgit.NewRepositoryFilesystem(dot, dotGitCommon)
-	} else {
-		repositoryFs = dot
 	}
 
 	s := filesystem.NewStorage(repositoryFs, cache.NewObjectLRUDefault())
@@ -501,17 +563,21 @@ func PlainClone(path string, o *CloneOptions) (*Repository, error) {
 
 // PlainCloneContext a repository into the path with the given options, isBare
 // defines if the new repository will be bare or normal. If the path is not empty
-// ErrTargetDirNotEmpty is returned.
+// ErrTargetDirNotEmpty is returned, unless CloneOptions.Resumable is set and
+// the path holds a failed clone of the same URL, made with Resumable, which is
+// then resumed.
 //
 // The provided Context must be non-nil. If the context expires before the
-// operation is complete, an error is returned. The context only affects the
-// transport operations.
+// operation is complete, an error is returned. The context affects the
+// transport operations, the resolution of the deltas of the packfile received
+// and the checkout of the worktree, whose files already written are then left
+// in place.
 func PlainCloneContext(ctx context.Context, path string, o *CloneOptions) (*Repository, error) {
 	empty, err := checkTargetDirIsEmpty(path)
 	if err != nil {
 		return nil, err
 	}
-	if !empty {
+	if !empty && !o.Resumable {
 		return nil, fmt.Errorf("%w %s", ErrTargetDirNotEmpty, path)
 	}
 	start := time.Now()
@@ -527,7 +593,13 @@ func PlainCloneContext(ctx context.Context, path string, o *CloneOptions) (*Repo
 	if o.Mirror {
 		isBare = true
 	}
-	r, err := PlainInit(path, isBare)
+
+	var r *Repository
+	if empty {
+		r, err = PlainInit(path, isBare)
+	} else {
+		r, err = resumePlainClone(path, isBare, o)
+	}
 	if err != nil {
 		return nil, err
 	}
@@ -536,6 +608,60 @@ func PlainCloneContext(ctx context.Context, path string, o *CloneOptions) (*Repo
 	return r, err
 }
 
+// resumePlainClone opens the repository at path, whose clone failed, to
+// resume it. ErrTargetDirNotEmpty is returned if it is not a repository whose
+// clone can be resumed, see checkResumableClone.
+func resumePlainClone(path string, isBare bool, o *CloneOptions) (*Repository, error) {
+	r, err := PlainOpen(path)
+	if errors.Is(err, ErrRepositoryNotExists) || err == nil && (r.wt == nil) != isBare {
+		return nil, fmt.Errorf("%w %s", ErrTargetDirNotEmpty, path)
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	if err := r.checkResumableClone(o); err != nil {
+		return nil, fmt.Errorf("%w %s", err, path)
+	}
+
+	return r, nil
+}
+
+// checkResumableClone returns ErrTargetDirNotEmpty unless the repository is
+// an unfinished clone of the URL of o: its remote has the URL, and its HEAD
+// does not point to a commit yet, as the references are only updated once
+// the objects are fetched.
+func (r *Repository) checkResumableClone(o *CloneOptions) error {
+	if err := o.Validate(); err != nil {
+		return err
+	}
+
+	remote, err := r.Remote(o.RemoteName)
+	if errors.Is(err, ErrRemoteNotFound) {
+		return ErrTargetDirNotEmpty
+	}
+
+	if err != nil {
+		return err
+	}
+
+	if urls := remote.Config().URLs; len(urls) == 0 || urls[0] != o.URL {
+		return ErrTargetDirNotEmpty
+	}
+
+	_, err = r.Head()
+	if err == nil {
+		return ErrTargetDirNotEmpty
+	}
+
+	if !errors.Is(err, plumbing.ErrReferenceNotFound) {
+		return err
+	}
+
+	return nil
+}
+
 func newRepository(s storage.Storer, worktree billy.Filesystem) *Repository {
 	return &Repository{
 		Storer: s,
@@ -579,41 +705,163 @@ func (r *Repository) Config() (*config.Config, error) {
 // SetConfig marshall and writes the repository config. In a filesystem backed
 // repository this means write the `.git/config`. This function should be called
 // with the result of `Repository.Config` and never with the output of
-// `Repository.ConfigScoped`.
+// `Repository.ConfigScoped`. See SetConfigScoped to write the config of the
+// other scopes.
 func (r *Repository) SetConfig(cfg *config.Config) error {
 	return r.Storer.SetConfig(cfg)
 }
 
 // ConfigScoped returns the repository config, merged with requested scope and
 // lower. For example if, config.GlobalScope is given the local and global config
-// are returned merged in one config value.
+// are returned merged in one config value. The config of the worktree, when
+// extensions.worktreeConfig is set, is merged last with any scope, as it takes
+// precedence over the local config. See ConfigOfScope for the config of a
+// single file.
+//
+// The files included by the include and includeIf sections of the config
+// files are merged too, the conditions of the includeIf sections being
+// evaluated for the repository: its git directory, the branch checked out and
+// the URLs of its remotes.
 func (r *Repository) ConfigScoped(scope config.Scope) (*config.Config, error) {
 	// TODO(mcuadros): v6, add this as ConfigOptions.Scoped
 
-	var err error
+	cfgs, err := r.scopedConfigs(scope)
+	if err != nil {
+		return nil, err
+	}
+
+	cfg := config.Merge(cfgs...)
+	return &cfg, nil
+}
+
+// scopedConfigs returns the system, global, local and worktree configs of the
+// repository, in this order, the ones out of the requested scope being empty.
+func (r *Repository) scopedConfigs(scope config.Scope) ([]*config.Config, error) {
+	local, err := r.Storer.Config()
+	if err != nil {
+		return nil, err
+	}
+
+	opts := r.includeOptions(local)
+
 	system := config.NewConfig()
-	if scope >= config.SystemScope {
-		system, err = config.LoadConfig(config.SystemScope)
+	if scope == config.SystemScope {
+		system, err = config.LoadConfigWithIncludes(config.SystemScope, opts)
 		if err != nil {
 			return nil, err
 		}
 	}
 
 	global := config.NewConfig()
-	if scope >= config.GlobalScope {
-		global, err = config.LoadConfig(config.GlobalScope)
+	if scope == config.GlobalScope || scope == config.SystemScope {
+		global, err = config.LoadConfigWithIncludes(config.GlobalScope, opts)
 		if err != nil {
 			return nil, err
 		}
 	}
 
-	local, err := r.Storer.Config()
+	worktree := config.NewConfig()
+	if fs, err := r.worktreeConfigFilesystem(local); err == nil {
+		worktree, err = readConfigFile(fs, worktreeConfigPath, opts)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	local, err = r.localConfigWithIncludes(local, opts)
 	if err != nil {
 		return nil, err
 	}
 
-	cfg := config.Merge(system, global, local)
-	return &cfg, nil
+	return []*config.Config{system, global, local, worktree}, nil
+}
+
+// urlRules returns the url rules of the system, global and local configs of
+// the repository. The insteadOf and pushInsteadOf values of the rules with the
+// same base are combined, as git does.
+func (r *Repository) urlRules() (map[string]*config.URL, error) {
+	cfgs, err := r.scopedConfigs(config.SystemScope)
+	if err != nil {
+		return nil, err
+	}
+
+	rules := make(map[string]*config.URL)
+	for _, cfg := range cfgs {
+		for name, u := range cfg.URLs {
+			rule, ok := rules[name]
+			if !ok {
+				rule = &config.URL{Name: u.Name}
+				rules[name] = rule
+			}
+
+			rule.InsteadOfs = append(rule.InsteadOfs, u.InsteadOfs...)
+			rule.PushInsteadOfs = append(rule.PushInsteadOfs, u.PushInsteadOfs...)
+		}
+	}
+
+	return rules, nil
+}
+
+// includeOptions returns the options with which the includeIf sections of the
+// config files of the repository are evaluated.
+func (r *Repository) includeOptions(local *config.Config) *formatcfg.IncludeOptions {
+	opts := &formatcfg.IncludeOptions{}
+	for _, remote := range local.Remotes {
+		opts.RemoteURLs = append(opts.RemoteURLs, remote.URLs...)
+	}
+
+	head, err := r.Storer.Reference(plumbing.HEAD)
+	if err == nil && head.Type() == plumbing.SymbolicReference && head.Target().IsBranch() {
+		opts.Branch = head.Target().Short()
+	}
+
+	if fss, ok := r.Storer.(storer.FilesystemStorer); ok {
+		opts.GitDir, _ = osRoot(fss.Filesystem())
+	}
+
+	return opts
+}
+
+// osRoot returns the path of the root of fs, and true if it is on the OS
+// filesystem.
+func osRoot(fs billy.Filesystem) (string, bool) {
+	var underlying billy.Basic = fs
+	for {
+		switch u := underlying.(type) {
+		case *osfs.BoundOS, *osfs.ChrootOS:
+			return fs.Root(), true
+		case interface{ Underlying() billy.Basic }:
+			underlying = u.Underlying()
+		default:
+			return "", false
+		}
+	}
+}
+
+// localConfigWithIncludes returns the local config along with the files it
+// includes, if any. They are only read if the git directory is on the OS
+// filesystem, as the paths of the included files are.
+func (r *Repository) localConfigWithIncludes(local *config.Config, opts *formatcfg.IncludeOptions) (*config.Config, error) {
+	if !local.Raw.HasSection("include") && !local.Raw.HasSection("includeIf") {
+		return local, nil
+	}
+
+	fss, ok := r.Storer.(storer.FilesystemStorer)
+	if !ok || opts.GitDir == "" {
+		return local, nil
+	}
+
+	f, err := fss.Filesystem().Open(localConfigPath)
+	if err != nil {
+		return nil, err
+	}
+
+	defer ioutil.CheckClose(f, &err)
+
+	o := *opts
+	o.Filesystem = osfs.Default
+	o.Path = filepath.Join(opts.GitDir, localConfigPath)
+	return config.ReadConfigWithIncludes(f, &o)
 }
 
 // Remote return a remote if exists
@@ -628,7 +876,13 @@ func (r *Repository) Remote(name string) (*Remote, error) {
 		return nil, ErrRemoteNotFound
 	}
 
-	return NewRemote(r.Storer, c), nil
+	rules, err := r.urlRules()
+	if err != nil {
+		return nil, err
+	}
+
+	c.ApplyURLRules(rules)
+	return r.newRemote(c), nil
 }
 
 // Remotes returns a list with all the remotes
@@ -638,24 +892,37 @@ func (r *Repository) Remotes() ([]*Remote, error) {
 		return nil, err
 	}
 
+	rules, err := r.urlRules()
+	if err != nil {
+		return nil, err
+	}
+
 	remotes := make([]*Remote, len(cfg.Remotes))
 
 	var i int
 	for _, c := range cfg.Remotes {
-		remotes[i] = NewRemote(r.Storer, c)
+		c.ApplyURLRules(rules)
+		remotes[i] = r.newRemote(c)
 		i++
 	}
 
 	return remotes, nil
 }
 
+// newRemote returns the remote of the repository with the given config.
+func (r *Repository) newRemote(c *config.RemoteConfig) *Remote {
+	remote := NewRemote(r.Storer, c)
+	remote.wt = r.wt
+	return remote
+}
+
 // CreateRemote creates a new remote
 func (r *Repository) CreateRemote(c *config.RemoteConfig) (*Remote, error) {
 	if err := c.Validate(); err != nil {
 		return nil, err
 	}
 
-	remote := NewRemote(r.Storer, c)
+	remote := r.newRemote(c)
 
 	cfg, err := r.Config()
 	if err != nil {
@@ -681,7 +948,7 @@ func (r *Repository) CreateRemoteAnonymous(c *config.RemoteConfig) (*Remote, err
 		return nil, ErrAnonymousRemoteName
 	}
 
-	remote := NewRemote(r.Storer, c)
+	remote := r.newRemote(c)
 
 	return remote, nil
 }
@@ -735,23 +1002,55 @@ func (r *Repository) CreateBranch(c *config.Branch) error {
 	return r.Storer.SetConfig(cfg)
 }
 
-// DeleteBranch delete a Branch from the repository and delete the config
+// DeleteBranch delete a Branch from the repository and delete the config:
+// the branch reference is removed along with its reflog, if it exists.
+// ErrBranchNotFound is returned if neither the branch nor its config exist,
+// and ErrBranchCheckedOut if the branch is the current one.
 func (r *Repository) DeleteBranch(name string) error {
+	rname := plumbing.NewBranchReferenceName(name)
+	current, err := r.isCurrentBranch(rname)
+	if err != nil {
+		return err
+	}
+
+	_, err = r.Storer.Reference(rname)
+	exists := err == nil
+	if err != nil && !errors.Is(err, plumbing.ErrReferenceNotFound) {
+		return err
+	}
+
+	if exists && current {
+		return ErrBranchCheckedOut
+	}
+
 	cfg, err := r.Config()
 	if err != nil {
 		return err
 	}
 
-	if _, ok := cfg.Branches[name]; !ok {
+	if _, ok := cfg.Branches[name]; !ok && !exists {
 		return ErrBranchNotFound
 	}
 
+	if exists {
+		if err := r.Storer.RemoveReference(rname); err != nil {
+			return err
+		}
+	}
+
+	if _, ok := cfg.Branches[name]; !ok {
+		return nil
+	}
+
 	delete(cfg.Branches, name)
 	return r.Storer.SetConfig(cfg)
 }
 
 // CreateTag creates a tag. If opts is included, the tag is an annotated tag,
-// otherwise a lightweight tag is created.
+// signed if opts has a Signer or a SignKey, otherwise a lightweight tag is
+// created. The signatures of the tags are verified as the ones of the
+// commits, with object.Tag.Verify, object.Tag.VerifySSH or
+// object.Tag.VerifySignature.
 func (r *Repository) CreateTag(name string, hash plumbing.Hash, opts *CreateTagOptions) (*plumbing.Reference, error) {
 	rname := plumbing.NewTagReferenceName(name)
 	if err := rname.Validate(); err != nil {
@@ -806,13 +1105,18 @@ func (r *Repository) createTagObject(name string, hash plumbing.Hash, opts *Crea
 		Target:     hash,
 	}
 
-	if opts.SignKey != nil {
-		sig, err := r.buildTagSignature(tag, opts.SignKey)
+	signer := opts.Signer
+	if signer == nil && opts.SignKey != nil {
+		signer = &gpgSigner{key: opts.SignKey}
+	}
+
+	if signer != nil {
+		sig, err := signObject(signer, tag)
 		if err != nil {
 			return plumbing.ZeroHash, err
 		}
 
-		tag.PGPSignature = sig
+		tag.PGPSignature = string(sig)
 	}
 
 	obj := r.Storer.NewEncodedObject()
@@ -823,25 +1127,6 @@ func (r *Repository) createTagObject(name string, hash plumbing.Hash, opts *Crea
 	return r.Storer.SetEncodedObject(obj)
 }
 
-func (r *Repository) buildTagSignature(tag *object.Tag, signKey *openpgp.Entity) (string, error) {
-	encoded := &plumbing.MemoryObject{}
-	if err := tag.Encode(encoded); err != nil {
-		return "", err
-	}
-
-	rdr, err := encoded.Reader()
-	if err != nil {
-		return "", err
-	}
-
-	var b bytes.Buffer
-	if err := openpgp.ArmoredDetachSign(&b, signKey, rdr, nil); err != nil {
-		return "", err
-	}
-
-	return b.String(), nil
-}
-
 // Tag returns a tag from the repository.
 //
 // If you want to check to see if the tag is an annotated tag, you can call
@@ -917,10 +1202,22 @@ func (r *Repository) clone(ctx context.Context, o *CloneOptions) error {
 		Mirror: o.Mirror,
 	}
 
-	if _, err := r.CreateRemote(c); err != nil {
+	if o.Filter != "" {
+		c.Promisor = true
+		c.PartialCloneFilter = string(o.Filter)
+	}
+
+	// The remote of a resumed clone already exists.
+	if _, err := r.CreateRemote(c); err != nil && (!o.Resumable || !errors.Is(err, ErrRemoteExists)) {
 		return err
 	}
 
+	if o.Filter != "" {
+		if err := r.setPartialClone(o.RemoteName); err != nil {
+			return err
+		}
+	}
+
 	// When the repository to clone is on the local machine,
 	// instead of using hard links, automatically setup .git/objects/info/alternates
 	// to share the objects with the source repository
@@ -955,12 +1252,19 @@ func (r *Repository) clone(ctx context.Context, o *CloneOptions) error {
 		InsecureSkipTLS: o.InsecureSkipTLS,
 		CABundle:        o.CABundle,
 		ProxyOptions:    o.ProxyOptions,
+		Timeouts:        o.Timeouts,
 		Filter:          o.Filter,
+		ProtocolVersion: o.ProtocolVersion,
+		Resumable:       o.Resumable,
 	}, o.ReferenceName)
 	if err != nil {
 		return err
 	}
 
+	if err := r.setupPromisor(o.Auth); err != nil {
+		return err
+	}
+
 	if r.wt != nil && !o.NoCheckout {
 		w, err := r.Worktree()
 		if err != nil {
@@ -972,10 +1276,10 @@ func (r *Repository) clone(ctx context.Context, o *CloneOptions) error {
 			return err
 		}
 
-		if err := w.Reset(&ResetOptions{
+		if err := w.reset(ctx, &ResetOptions{
 			Mode:   MergeReset,
 			Commit: head.Hash(),
-		}); err != nil {
+		}, false, o.Progress); err != nil {
 			return err
 		}
 
@@ -999,6 +1303,12 @@ func (r *Repository) clone(ctx context.Context, o *CloneOptions) error {
 		return err
 	}
 
+	if o.ReferenceName == plumbing.HEAD && !o.Mirror && !o.SingleBranch && ref.Name().IsBranch() {
+		if err := r.setRemoteHead(c, ref.Name()); err != nil {
+			return err
+		}
+	}
+
 	if !o.Mirror && ref.Name().IsBranch() {
 		branchRef := ref.Name()
 		branchName := strings.Split(string(branchRef), "refs/heads/")[1]
@@ -1028,6 +1338,19 @@ const (
 	refspecSingleBranchHEAD = "+HEAD:refs/remotes/%s/HEAD"
 )
 
+// setPartialClone records in the config that the repository is a partial
+// clone of the given promisor remote.
+func (r *Repository) setPartialClone(remote string) error {
+	cfg, err := r.Config()
+	if err != nil {
+		return err
+	}
+
+	cfg.Core.RepositoryFormatVersion = formatcfg.Version_1
+	cfg.Extensions.PartialClone = remote
+	return r.SetConfig(cfg)
+}
+
 func (r *Repository) cloneRefSpec(o *CloneOptions) []config.RefSpec {
 	switch {
 	case o.Mirror:
@@ -1051,6 +1374,22 @@ func (r *Repository) cloneRefSpec(o *CloneOptions) []config.RefSpec {
 	}
 }
 
+// setRemoteHead points the HEAD of the given remote, such as
+// refs/remotes/origin/HEAD, to the remote-tracking branch of the given branch
+// of the remote, its default branch, as git clone does.
+func (r *Repository) setRemoteHead(c *config.RemoteConfig, branch plumbing.ReferenceName) error {
+	for _, rs := range c.Fetch {
+		if !rs.Match(branch) {
+			continue
+		}
+
+		head := plumbing.NewSymbolicReference(plumbing.NewRemoteHEADReferenceName(c.Name), rs.Dst(branch))
+		return r.Storer.SetReference(head)
+	}
+
+	return nil
+}
+
 func (r *Repository) setIsBare(isBare bool) error {
 	cfg, err := r.Config()
 	if err != nil {
@@ -1218,8 +1557,9 @@ func (r *Repository) Fetch(o *FetchOptions) error {
 // no changes to be fetched, or an error.
 //
 // The provided Context must be non-nil. If the context expires before the
-// operation is complete, an error is returned. The context only affects the
-// transport operations.
+// operation is complete, an error is returned. The context affects the
+// transport operations and the resolution of the deltas of the packfile
+// received.
 func (r *Repository) FetchContext(ctx context.Context, o *FetchOptions) error {
 	if err := o.Validate(); err != nil {
 		return err
@@ -1267,13 +1607,32 @@ func (r *Repository) Log(o *LogOptions) (object.CommitIter, error) {
 		return nil, fmt.Errorf("invalid Order=%v", o.Order)
 	}
 
+	var history *object.CommitHistoryOptions
+	if o.FileName != nil || o.PathFilter != nil {
+		history = &object.CommitHistoryOptions{PathFilter: o.PathFilter, Follow: o.Follow}
+		if o.FileName != nil {
+			history.Path = *o.FileName
+		}
+	}
+
 	var (
 		it  object.CommitIter
 		err error
 	)
-	if o.All {
+	switch {
+	case history != nil && (o.Order == LogOrderDefault || o.Order == LogOrderCommitterTime):
+		it, err = r.logHistory(o.From, o.All, history)
+	case o.All && (o.Order == LogOrderTopo || o.Order == LogOrderDate):
+		// The history of all the references is sorted at once.
+		var tips []*object.Commit
+		if tips, err = r.logTips(); err == nil {
+			it = sortedCommitIter(o.Order, tips)
+		}
+	case o.All:
 		it, err = r.logAll(fn)
-	} else {
+	case o.Order == LogOrderCommitterTime:
+		it, err = r.logCommitGraph(o.From)
+	default:
 		it, err = r.log(o.From, fn)
 	}
 
@@ -1281,12 +1640,8 @@ func (r *Repository) Log(o *LogOptions) (object.CommitIter, error) {
 		return nil, err
 	}
 
-	if o.FileName != nil {
-		// for `git log --all` also check parent (if the next commit comes from the real parent)
-		it = r.logWithFile(*o.FileName, it, o.All)
-	}
-	if o.PathFilter != nil {
-		it = r.logWithPathFilter(o.PathFilter, it, o.All)
+	if history != nil && o.Order != LogOrderDefault && o.Order != LogOrderCommitterTime {
+		it = object.NewCommitHistoryFilterIter(it, history)
 	}
 
 	if o.Since != nil || o.Until != nil || !o.To.IsZero() {
@@ -1297,54 +1652,172 @@ func (r *Repository) Log(o *LogOptions) (object.CommitIter, error) {
 	return it, nil
 }
 
-func (r *Repository) log(from plumbing.Hash, commitIterFunc func(*object.Commit) object.CommitIter) (object.CommitIter, error) {
-	h := from
-	if from == plumbing.ZeroHash {
-		head, err := r.Head()
-		if err != nil {
-			return nil, err
+// logHistory returns the simplified history of the paths of opts, from the
+// given commit, or from HEAD and all the references if all is true.
+func (r *Repository) logHistory(from plumbing.Hash, all bool, opts *object.CommitHistoryOptions) (object.CommitIter, error) {
+	if !all {
+		return r.log(from, func(c *object.Commit) object.CommitIter {
+			return object.NewCommitHistoryIter([]*object.Commit{c}, opts)
+		})
+	}
+
+	tips, err := r.logTips()
+	if err != nil {
+		return nil, err
+	}
+
+	return object.NewCommitHistoryIter(tips, opts), nil
+}
+
+// logTips returns the commits of HEAD and of all the references, from which
+// the history is walked by Log when LogOptions.All is set.
+func (r *Repository) logTips() ([]*object.Commit, error) {
+	var tips []*object.Commit
+	add := func(ref *plumbing.Reference) error {
+		c, err := r.refCommit(ref)
+		if err != nil || c == nil {
+			return err
 		}
 
-		h = head.Hash()
+		tips = append(tips, c)
+		return nil
+	}
+
+	head, err := storer.ResolveReference(r.Storer, plumbing.HEAD)
+	if err == nil {
+		err = add(head)
 	}
 
-	commit, err := r.CommitObject(h)
+	if err != nil && err != plumbing.ErrReferenceNotFound {
+		return nil, err
+	}
+
+	refs, err := r.Storer.IterReferences()
 	if err != nil {
 		return nil, err
 	}
-	return commitIterFunc(commit), nil
-}
 
-func (r *Repository) logAll(commitIterFunc func(*object.Commit) object.CommitIter) (object.CommitIter, error) {
-	return object.NewCommitAllIter(r.Storer, commitIterFunc)
-}
+	if err := refs.ForEach(add); err != nil {
+		return nil, err
+	}
 
-func (*Repository) logWithFile(fileName string, commitIter object.CommitIter, checkParent bool) object.CommitIter {
-	return object.NewCommitPathIterFromIter(
-		func(path string) bool {
-			return path == fileName
-		},
-		commitIter,
-		checkParent,
-	)
+	return tips, nil
 }
 
-func (*Repository) logWithPathFilter(pathFilter func(string) bool, commitIter object.CommitIter, checkParent bool) object.CommitIter {
-	return object.NewCommitPathIterFromIter(
-		pathFilter,
-		commitIter,
-		checkParent,
-	)
-}
+// refCommit returns the commit a reference points to, peeling the annotated
+// tags, or nil if it doesn't point to a commit.
+func (r *Repository) refCommit(ref *plumbing.Reference) (*object.Commit, error) {
+	if ref.Type() != plumbing.HashReference {
+		return nil, nil
+	}
 
-func (*Repository) logWithLimit(commitIter object.CommitIter, limitOptions object.LogLimitOptions) object.CommitIter {
-	return object.NewCommitLimitIterFromIter(commitIter, limitOptions)
-}
+	obj, err := r.Object(plumbing.AnyObject, ref.Hash())
+	if errors.Is(err, plumbing.ErrObjectNotFound) {
+		return nil, nil
+	}
 
-func commitIterFunc(order LogOrder) func(c *object.Commit) object.CommitIter {
-	switch order {
-	case LogOrderDefault:
-		return func(c *object.Commit) object.CommitIter {
+	if err != nil {
+		return nil, err
+	}
+
+	switch o := obj.(type) {
+	case *object.Commit:
+		return o, nil
+	case *object.Tag:
+		c, err := o.Commit()
+		if errors.Is(err, object.ErrUnsupportedObject) {
+			return nil, nil
+		}
+
+		return c, err
+	}
+
+	return nil, nil
+}
+
+func (r *Repository) log(from plumbing.Hash, commitIterFunc func(*object.Commit) object.CommitIter) (object.CommitIter, error) {
+	h, err := r.logFrom(from)
+	if err != nil {
+		return nil, err
+	}
+
+	commit, err := r.CommitObject(h)
+	if err != nil {
+		return nil, err
+	}
+	return commitIterFunc(commit), nil
+}
+
+// logCommitGraph returns the history from the given commit, or from HEAD, by
+// committer time. The history is walked with the commit-graph, if the storer
+// has one, so that only the commits returned are read.
+func (r *Repository) logCommitGraph(from plumbing.Hash) (object.CommitIter, error) {
+	h, err := r.logFrom(from)
+	if err != nil {
+		return nil, err
+	}
+
+	node, err := commitgraph.NewCommitNodeIndex(r.Storer).Get(h)
+	if err != nil {
+		return nil, err
+	}
+
+	return commitNodeCommitIter{commitgraph.NewCommitNodeIterCTime(node, nil, nil)}, nil
+}
+
+// logFrom returns the commit the history is walked from by Log, the given one
+// or HEAD if it is zero.
+func (r *Repository) logFrom(from plumbing.Hash) (plumbing.Hash, error) {
+	if from != plumbing.ZeroHash {
+		return from, nil
+	}
+
+	head, err := r.Head()
+	if err != nil {
+		return plumbing.ZeroHash, err
+	}
+
+	return head.Hash(), nil
+}
+
+// commitNodeCommitIter is the object.CommitIter of the commits of the nodes of
+// a commitgraph.CommitNodeIter, each read when it is returned.
+type commitNodeCommitIter struct {
+	commitgraph.CommitNodeIter
+}
+
+func (iter commitNodeCommitIter) Next() (*object.Commit, error) {
+	node, err := iter.CommitNodeIter.Next()
+	if err != nil {
+		return nil, err
+	}
+
+	return node.Commit()
+}
+
+func (iter commitNodeCommitIter) ForEach(cb func(*object.Commit) error) error {
+	return iter.CommitNodeIter.ForEach(func(node commitgraph.CommitNode) error {
+		c, err := node.Commit()
+		if err != nil {
+			return err
+		}
+
+		return cb(c)
+	})
+}
+
+func (r *Repository) logAll(commitIterFunc func(*object.Commit) object.CommitIter) (object.CommitIter, error) {
+	return object.NewCommitAllIter(r.Storer, commitIterFunc)
+}
+
+func (*Repository) logWithLimit(commitIter object.CommitIter, limitOptions object.LogLimitOptions) object.CommitIter {
+	return object.NewCommitLimitIterFromIter(commitIter, limitOptions)
+}
+
+func commitIterFunc(order LogOrder) func(c *object.Commit) object.CommitIter {
+	switch order {
+	case LogOrderDefault:
+		return func(c *object.Commit) object.CommitIter {
 			return object.NewCommitPreorderIter(c, nil, nil)
 		}
 	case LogOrderDFS:
@@ -1367,10 +1840,24 @@ func commitIterFunc(order LogOrder) func(c *object.Commit) object.CommitIter {
 		return func(c *object.Commit) object.CommitIter {
 			return object.NewCommitPostorderIterFirstParent(c, nil)
 		}
+	case LogOrderTopo, LogOrderDate:
+		return func(c *object.Commit) object.CommitIter {
+			return sortedCommitIter(order, []*object.Commit{c})
+		}
 	}
 	return nil
 }
 
+// sortedCommitIter returns the iterator of the history of the given commits
+// for LogOrderTopo or LogOrderDate.
+func sortedCommitIter(order LogOrder, tips []*object.Commit) object.CommitIter {
+	if order == LogOrderTopo {
+		return object.NewCommitTopoOrderIter(tips)
+	}
+
+	return object.NewCommitDateOrderIter(tips)
+}
+
 // Tags returns all the tag References in a repository.
 //
 // If you want to check to see if the tag is an annotated tag, you can call
@@ -1407,6 +1894,28 @@ func (r *Repository) Tags() (storer.ReferenceIter, error) {
 		}, refIter), nil
 }
 
+// ForEachTag calls fn with each tag reference and its tag object, nil for the
+// lightweight tags, pointing to another object than a tag. The iteration
+// stops without error if fn returns storer.ErrStop.
+func (r *Repository) ForEachTag(fn func(ref *plumbing.Reference, tag *object.Tag) error) error {
+	iter, err := r.Tags()
+	if err != nil {
+		return err
+	}
+
+	return iter.ForEach(func(ref *plumbing.Reference) error {
+		tag, err := r.TagObject(ref.Hash())
+		switch {
+		case errors.Is(err, plumbing.ErrObjectNotFound):
+			tag = nil
+		case err != nil:
+			return err
+		}
+
+		return fn(ref, tag)
+	})
+}
+
 // Branches returns all the References that are Branches.
 func (r *Repository) Branches() (storer.ReferenceIter, error) {
 	refIter, err := r.Storer.IterReferences()
@@ -1420,7 +1929,8 @@ func (r *Repository) Branches() (storer.ReferenceIter, error) {
 		}, refIter), nil
 }
 
-// Notes returns all the References that are notes. For more information:
+// Notes returns all the References that are notes, whose notes are read and
+// written with NotesTree. For more information:
 // https://git-scm.com/docs/git-notes
 func (r *Repository) Notes() (storer.ReferenceIter, error) {
 	refIter, err := r.Storer.IterReferences()
@@ -1440,6 +1950,46 @@ func (r *Repository) TreeObject(h plumbing.Hash) (*object.Tree, error) {
 	return object.GetTree(r.Storer, h)
 }
 
+// DiffTree returns the changes from the tree a to the tree b, given by their
+// hashes or by the hashes of their commits, as `git diff-tree` does. The zero
+// hash is the empty tree. No rename detection is performed, see
+// object.DetectRenames.
+func (r *Repository) DiffTree(a, b plumbing.Hash) (object.Changes, error) {
+	from, err := r.treeish(a)
+	if err != nil {
+		return nil, err
+	}
+
+	to, err := r.treeish(b)
+	if err != nil {
+		return nil, err
+	}
+
+	return object.DiffTree(from, to)
+}
+
+// treeish returns the tree of the given hash, of a tree or a commit, nil for
+// the zero hash.
+func (r *Repository) treeish(h plumbing.Hash) (*object.Tree, error) {
+	if h.IsZero() {
+		return nil, nil
+	}
+
+	o, err := r.Object(plumbing.AnyObject, h)
+	if err != nil {
+		return nil, err
+	}
+
+	switch o := o.(type) {
+	case *object.Tree:
+		return o, nil
+	case *object.Commit:
+		return o.Tree()
+	default:
+		return nil, fmt.Errorf("%w: %s is a %s, not a tree", plumbing.ErrInvalidType, h, o.Type())
+	}
+}
+
 // TreeObjects returns an unsorted TreeIter with all the trees in the repository
 func (r *Repository) TreeObjects() (*object.TreeIter, error) {
 	iter, err := r.Storer.IterEncodedObjects(plumbing.TreeObject)
@@ -1466,6 +2016,139 @@ func (r *Repository) CommitObjects() (object.CommitIter, error) {
 	return object.NewCommitIter(r.Storer, iter), nil
 }
 
+// MergeBase returns the best common ancestors of the commits a and b, as
+// `git merge-base --all a b` does. There are several of them for criss-cross
+// merges, and none if their histories are disconnected. The commit-graph is
+// used, if any, to limit the history walked.
+func (r *Repository) MergeBase(a, b plumbing.Hash) ([]*object.Commit, error) {
+	nodes, err := r.commitNodes(a, b)
+	if err != nil {
+		return nil, err
+	}
+
+	bases, err := commitgraph.MergeBase(nodes[0], nodes[1])
+	if err != nil {
+		return nil, err
+	}
+
+	return commitsOfNodes(bases)
+}
+
+// MergeBaseOctopus returns the best common ancestors of all the given
+// commits, as `git merge-base --octopus --all commits...` does, for an
+// octopus merge of them.
+func (r *Repository) MergeBaseOctopus(commits ...plumbing.Hash) ([]*object.Commit, error) {
+	nodes, err := r.commitNodes(commits...)
+	if err != nil {
+		return nil, err
+	}
+
+	bases, err := commitgraph.OctopusMergeBase(nodes...)
+	if err != nil {
+		return nil, err
+	}
+
+	return commitsOfNodes(bases)
+}
+
+// IsAncestor returns whether the commit a is an ancestor of the commit b, or
+// b itself, as `git merge-base --is-ancestor a b` does.
+func (r *Repository) IsAncestor(a, b plumbing.Hash) (bool, error) {
+	nodes, err := r.commitNodes(a, b)
+	if err != nil {
+		return false, err
+	}
+
+	return commitgraph.IsAncestor(nodes[0], nodes[1])
+}
+
+// AheadBehind returns the number of commits reachable from local but not
+// from upstream, and the number of those reachable from upstream but not
+// from local, as `git rev-list --left-right --count local...upstream` does.
+// The commit-graph is used, if any, to limit the history walked.
+func (r *Repository) AheadBehind(local, upstream plumbing.Hash) (ahead, behind int, err error) {
+	nodes, err := r.commitNodes(local, upstream)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	return commitgraph.AheadBehind(nodes[0], nodes[1])
+}
+
+// TrackingStatus returns the number of commits the given local branch is
+// ahead and behind of its upstream, as configured by its remote and merge
+// options. ErrNoUpstream is returned if it has no upstream.
+func (r *Repository) TrackingStatus(branch string) (ahead, behind int, err error) {
+	upstream, err := r.upstream(branch)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	local, err := r.Reference(plumbing.NewBranchReferenceName(branch), true)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	return r.AheadBehind(local.Hash(), upstream)
+}
+
+// upstream returns the commit of the upstream of the given branch.
+func (r *Repository) upstream(branch string) (plumbing.Hash, error) {
+	b, err := r.Branch(branch)
+	if errors.Is(err, ErrBranchNotFound) {
+		return plumbing.ZeroHash, ErrNoUpstream
+	}
+
+	if err != nil {
+		return plumbing.ZeroHash, err
+	}
+
+	if b.Remote == "" || b.Merge == "" {
+		return plumbing.ZeroHash, ErrNoUpstream
+	}
+
+	name := b.Merge
+	if b.Remote != "." {
+		name = plumbing.NewRemoteReferenceName(b.Remote, b.Merge.Short())
+	}
+
+	ref, err := r.Reference(name, true)
+	if err != nil {
+		return plumbing.ZeroHash, err
+	}
+
+	return ref.Hash(), nil
+}
+
+// commitNodes returns the nodes of the given commits, read from the
+// commit-graph if the repository has one.
+func (r *Repository) commitNodes(hashes ...plumbing.Hash) ([]commitgraph.CommitNode, error) {
+	idx := commitgraph.NewCommitNodeIndex(r.Storer)
+	nodes := make([]commitgraph.CommitNode, len(hashes))
+	for i, h := range hashes {
+		var err error
+		if nodes[i], err = idx.Get(h); err != nil {
+			return nil, err
+		}
+	}
+
+	return nodes, nil
+}
+
+func commitsOfNodes(nodes []commitgraph.CommitNode) ([]*object.Commit, error) {
+	commits := make([]*object.Commit, 0, len(nodes))
+	for _, n := range nodes {
+		c, err := n.Commit()
+		if err != nil {
+			return nil, err
+		}
+
+		commits = append(commits, c)
+	}
+
+	return commits, nil
+}
+
 // BlobObject returns a Blob with the given hash. If not found
 // plumbing.ErrObjectNotFound is returned.
 func (r *Repository) BlobObject(h plumbing.Hash) (*object.Blob, error) {
@@ -1521,6 +2204,18 @@ func (r *Repository) Objects() (*object.ObjectIter, error) {
 	return object.NewObjectIter(r.Storer, iter), nil
 }
 
+// IsShallow returns whether the repository is a shallow clone, and the
+// commits of its shallow boundary, read from the shallow file, whose parents
+// are missing from the repository.
+func (r *Repository) IsShallow() (bool, []plumbing.Hash, error) {
+	shallow, err := r.Storer.Shallow()
+	if err != nil {
+		return false, nil, err
+	}
+
+	return len(shallow) > 0, shallow, nil
+}
+
 // Head returns the reference where HEAD is pointing to.
 func (r *Repository) Head() (*plumbing.Reference, error) {
 	return storer.ResolveReference(r.Storer, plumbing.HEAD)
@@ -1570,11 +2265,13 @@ func expand_ref(s storer.ReferenceStorer, ref plumbing.ReferenceName) (*plumbing
 	return nil, ret
 }
 
-// ResolveRevision resolves revision to corresponding hash. It will always
-// resolve to a commit hash, not a tree or annotated tag.
+// ResolveRevision resolves revision to corresponding hash. It resolves to a
+// commit hash, unless the revision asks for another object with the peeling
+// suffixes (^{tree}, ^{blob}, ^{tag}, ^{object} and ^{}) or a path.
 //
 // Implemented resolvers : HEAD, branch, tag, heads/branch, refs/heads/branch,
-// refs/tags/tag, refs/remotes/origin/branch, refs/remotes/origin/HEAD, tilde and caret (HEAD~1, master~^, tag~2, ref/heads/master~1, ...), selection by text (HEAD^{/fix nasty bug}), hash (prefix and full)
+// refs/tags/tag, refs/remotes/origin/branch, refs/remotes/origin/HEAD, tilde and caret (HEAD~1, master~^, tag~2, ref/heads/master~1, ...), selection by text (HEAD^{/fix nasty bug}, :/fix nasty bug), hash (prefix and full),
+// reflog entries (HEAD@{1}, master@{2006-01-02T15:04:05Z}, @{yesterday}, @{2 days ago}, @{-1}, ...), peeling (v1.0.0^{tree}, v1.0.0^{}, ...), paths (HEAD:README) and merge bases (master...branch)
 func (r *Repository) ResolveRevision(in plumbing.Revision) (*plumbing.Hash, error) {
 	rev := in.String()
 	if rev == "" {
@@ -1587,128 +2284,248 @@ func (r *Repository) ResolveRevision(in plumbing.Revision) (*plumbing.Hash, erro
 		return nil, err
 	}
 
-	var commit *object.Commit
-
-	for _, item := range items {
-		switch item := item.(type) {
-		case revision.Ref:
-			revisionRef := item
-
-			var tryHashes []plumbing.Hash
-
-			tryHashes = append(tryHashes, r.resolveHashPrefix(string(revisionRef))...)
+	for i, item := range items {
+		if _, ok := item.(revision.TripleDot); ok {
+			return r.resolveMergeBaseRevision(items[:i], items[i+1:])
+		}
+	}
 
-			ref, err := expand_ref(r.Storer, plumbing.ReferenceName(revisionRef))
-			if err == nil {
-				tryHashes = append(tryHashes, ref.Hash())
-			}
+	return r.resolveRevisionItems(items)
+}
 
-			// in ambiguous cases, `git rev-parse` will emit a warning, but
-			// will always return the oid in preference to a ref; we don't have
-			// the ability to emit a warning here, so (for speed purposes)
-			// don't bother to detect the ambiguity either, just return in the
-			// priority that git would.
-			gotOne := false
-			for _, hash := range tryHashes {
-				commitObj, err := r.CommitObject(hash)
-				if err == nil {
-					commit = commitObj
-					gotOne = true
-					break
-				}
+// resolveRevisionItems resolves the parsed items of a revision, but the
+// merge bases of <rev>...<rev>, see ResolveRevision.
+func (r *Repository) resolveRevisionItems(items []revision.Revisioner) (*plumbing.Hash, error) {
+	var obj object.Object
+	var err error
+	// peel is whether the resolved object is peeled to a commit, which is
+	// the case unless the revision ends with a peeling suffix or a path.
+	peel := true
 
-				tagObj, err := r.TagObject(hash)
-				if err == nil {
-					// If the tag target lookup fails here, this most likely
-					// represents some sort of repo corruption, so let the
-					// error bubble up.
-					tagCommit, err := tagObj.Commit()
-					if err != nil {
-						return &plumbing.ZeroHash, err
-					}
-					commit = tagCommit
-					gotOne = true
-					break
-				}
+	for _, item := range items {
+		var commit *object.Commit
+		switch item.(type) {
+		case revision.CaretPath, revision.TildePath, revision.CaretReg:
+			if commit, err = object.PeelToCommit(obj); err != nil {
+				return &plumbing.ZeroHash, err
 			}
+		}
 
-			if !gotOne {
-				return &plumbing.ZeroHash, plumbing.ErrReferenceNotFound
+		peel = true
+		switch item := item.(type) {
+		case revision.Ref:
+			obj, err = r.resolveRefRevision(string(item))
+		case revision.AtReflog, revision.AtDate:
+			var refname string
+			if ref, ok := items[0].(revision.Ref); ok {
+				refname = string(ref)
 			}
 
+			obj, err = r.resolveReflogRevision(refname, item)
+		case revision.AtCheckout:
+			obj, err = r.resolveCheckoutRevision(item.Depth)
 		case revision.CaretPath:
-			depth := item.Depth
-
-			if depth == 0 {
+			obj = commit
+			if item.Depth == 0 {
 				break
 			}
 
 			iter := commit.Parents()
-
-			c, err := iter.Next()
-			if err != nil {
-				return &plumbing.ZeroHash, err
+			obj, err = iter.Next()
+			if err == nil && item.Depth == 2 {
+				obj, err = iter.Next()
+			}
+		case revision.TildePath:
+			for i := 0; i < item.Depth && err == nil; i++ {
+				commit, err = commit.Parents().Next()
 			}
 
-			if depth == 1 {
-				commit = c
-
+			obj = commit
+		case revision.CaretReg:
+			obj, err = searchCommitMessage(commit, item.Regexp, item.Negate)
+		case revision.ColonReg:
+			var head *plumbing.Reference
+			if head, err = r.Head(); err != nil {
 				break
 			}
 
-			c, err = iter.Next()
-			if err != nil {
-				return &plumbing.ZeroHash, err
+			if commit, err = r.CommitObject(head.Hash()); err != nil {
+				break
 			}
 
-			commit = c
-		case revision.TildePath:
-			for i := 0; i < item.Depth; i++ {
-				c, err := commit.Parents().Next()
-				if err != nil {
-					return &plumbing.ZeroHash, err
-				}
+			obj, err = searchCommitMessage(commit, item.Regexp, item.Negate)
+		case revision.CaretType:
+			obj, err = peelObject(obj, item.ObjectType)
+			peel = false
+		case revision.ColonPath:
+			obj, err = r.resolvePathRevision(obj, item.Path)
+			peel = false
+		}
 
-				commit = c
-			}
-		case revision.CaretReg:
-			history := object.NewCommitPreorderIter(commit, nil, nil)
+		if err != nil {
+			return &plumbing.ZeroHash, err
+		}
+	}
 
-			re := item.Regexp
-			negate := item.Negate
+	if obj == nil {
+		return &plumbing.ZeroHash, plumbing.ErrReferenceNotFound
+	}
 
-			var c *object.Commit
+	if peel {
+		commit, err := object.PeelToCommit(obj)
+		if err != nil {
+			return &plumbing.ZeroHash, err
+		}
 
-			err := history.ForEach(func(hc *object.Commit) error {
-				if !negate && re.MatchString(hc.Message) {
-					c = hc
-					return storer.ErrStop
-				}
+		return &commit.Hash, nil
+	}
 
-				if negate && !re.MatchString(hc.Message) {
-					c = hc
-					return storer.ErrStop
-				}
+	hash := obj.ID()
+	return &hash, nil
+}
 
-				return nil
-			})
-			if err != nil {
-				return &plumbing.ZeroHash, err
+// resolveRefRevision resolves a reference name, or a full or partial hash, to
+// the commit or tag it points to.
+func (r *Repository) resolveRefRevision(name string) (object.Object, error) {
+	var tryHashes []plumbing.Hash
+
+	tryHashes = append(tryHashes, r.resolveHashPrefix(name)...)
+
+	ref, err := expand_ref(r.Storer, plumbing.ReferenceName(name))
+	if err == nil {
+		tryHashes = append(tryHashes, ref.Hash())
+	}
+
+	// in ambiguous cases, `git rev-parse` will emit a warning, but
+	// will always return the oid in preference to a ref; we don't have
+	// the ability to emit a warning here, so (for speed purposes)
+	// don't bother to detect the ambiguity either, just return in the
+	// priority that git would.
+	for _, hash := range tryHashes {
+		obj, err := r.Object(plumbing.AnyObject, hash)
+		if err != nil {
+			continue
+		}
+
+		switch obj.Type() {
+		case plumbing.CommitObject, plumbing.TagObject:
+			return obj, nil
+		}
+	}
+
+	return nil, plumbing.ErrReferenceNotFound
+}
+
+// resolveMergeBaseRevision resolves the <left>...<right> revision to the
+// merge base of both sides, HEAD being used for an empty side.
+func (r *Repository) resolveMergeBaseRevision(left, right []revision.Revisioner) (*plumbing.Hash, error) {
+	var hashes [2]plumbing.Hash
+	for i, items := range [][]revision.Revisioner{left, right} {
+		if len(items) == 0 {
+			items = []revision.Revisioner{revision.Ref(plumbing.HEAD)}
+		}
+
+		h, err := r.resolveRevisionItems(items)
+		if err != nil {
+			return &plumbing.ZeroHash, err
+		}
+
+		hashes[i] = *h
+	}
+
+	bases, err := r.MergeBase(hashes[0], hashes[1])
+	if err != nil {
+		return &plumbing.ZeroHash, err
+	}
+
+	if len(bases) == 0 {
+		return &plumbing.ZeroHash, fmt.Errorf("%w: no merge base of %s and %s", plumbing.ErrReferenceNotFound, hashes[0], hashes[1])
+	}
+
+	return &bases[0].Hash, nil
+}
+
+// resolvePathRevision resolves the <rev>:<path> revision to the object at
+// the given path of the tree of obj.
+func (r *Repository) resolvePathRevision(obj object.Object, path string) (object.Object, error) {
+	obj, err := peelObject(obj, plumbing.TreeObject.String())
+	if err != nil {
+		return nil, err
+	}
+
+	path = strings.Trim(strings.TrimPrefix(path, "./"), "/")
+	if path == "" {
+		return obj, nil
+	}
+
+	e, err := obj.(*object.Tree).FindEntry(path)
+	if err != nil {
+		return nil, err
+	}
+
+	return r.Object(plumbing.AnyObject, e.Hash)
+}
+
+// peelObject peels obj to an object of the given type, as the ^{<type>}
+// revision suffix: tags are followed until reaching an object of this type,
+// and commits are peeled to their tree. obj is returned as is for the
+// "object" type, and the tags are followed until reaching another object
+// for the empty type.
+func peelObject(obj object.Object, typ string) (object.Object, error) {
+	if typ == "object" {
+		return obj, nil
+	}
+
+	for {
+		if obj.Type().String() == typ || typ == "" && obj.Type() != plumbing.TagObject {
+			return obj, nil
+		}
+
+		var err error
+		switch o := obj.(type) {
+		case *object.Tag:
+			if typ == plumbing.TagObject.String() {
+				return obj, nil
 			}
 
-			if c == nil {
-				return &plumbing.ZeroHash, fmt.Errorf("no commit message match regexp: %q", re.String())
+			obj, err = o.Object()
+		case *object.Commit:
+			if typ != plumbing.TreeObject.String() {
+				return nil, fmt.Errorf("%w: %s is a %s, not a %s", plumbing.ErrInvalidType, obj.ID(), obj.Type(), typ)
 			}
 
-			commit = c
+			obj, err = o.Tree()
+		default:
+			return nil, fmt.Errorf("%w: %s is a %s, not a %s", plumbing.ErrInvalidType, obj.ID(), obj.Type(), typ)
+		}
+
+		if err != nil {
+			return nil, err
+		}
+	}
+}
+
+// searchCommitMessage returns the youngest commit reachable from commit
+// whose message matches re, or does not match it if negate is set.
+func searchCommitMessage(commit *object.Commit, re *regexp.Regexp, negate bool) (*object.Commit, error) {
+	var c *object.Commit
+	err := object.NewCommitPreorderIter(commit, nil, nil).ForEach(func(hc *object.Commit) error {
+		if re.MatchString(hc.Message) != negate {
+			c = hc
+			return storer.ErrStop
 		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
 	}
 
-	if commit == nil {
-		return &plumbing.ZeroHash, plumbing.ErrReferenceNotFound
+	if c == nil {
+		return nil, fmt.Errorf("no commit message match regexp: %q", re.String())
 	}
 
-	return &commit.Hash, nil
+	return c, nil
 }
 
 // resolveHashPrefix returns a list of potential hashes that the given string
@@ -1793,6 +2610,15 @@ func (r *Repository) RepackObjects(cfg *RepackConfig) (err error) {
 	return nil
 }
 
+// PackRefs moves the loose references into the packed-refs file, as `git
+// pack-refs --all` does, for the enumeration of the references to be fast
+// with many of them. The peeled values of the annotated tags are packed along
+// with them. The symbolic references are kept loose. It is a no-op for the
+// storers without packed references, such as the memory one.
+func (r *Repository) PackRefs() error {
+	return r.Storer.PackRefs()
+}
+
 // Merge merges the reference branch into the current branch.
 //
 // If the merge is not possible (or supported) returns an error without changing
@@ -1825,12 +2651,12 @@ func (r *Repository) Merge(ref plumbing.Reference, opts MergeOptions) error {
 		return ErrFastForwardMergeNotPossible
 	}
 
-	return r.Storer.SetReference(plumbing.NewHashReference(head.Name(), ref.Hash()))
+	msg := fmt.Sprintf("merge %s: Fast-forward", ref.Name().Short())
+	return r.setReferenceWithLog(plumbing.NewHashReference(head.Name(), ref.Hash()), nil, msg)
 }
 
 // createNewObjectPack is a helper for RepackObjects taking care
-// of creating a new pack. It is used so the PackfileWriter
-// deferred close has the right scope.
+// of creating a new pack.
 func (r *Repository) createNewObjectPack(cfg *RepackConfig) (h plumbing.Hash, err error) {
 	ow := newObjectWalker(r.Storer)
 	err = ow.walkAllRefs()
@@ -1841,21 +2667,7 @@ func (r *Repository) createNewObjectPack(cfg *RepackConfig) (h plumbing.Hash, er
 	for h := range ow.seen {
 		objs = append(objs, h)
 	}
-	pfw, ok := r.Storer.(storer.PackfileWriter)
-	if !ok {
-		return h, fmt.Errorf("Repository storer is not a storer.PackfileWriter")
-	}
-	wc, err := pfw.PackfileWriter()
-	if err != nil {
-		return h, err
-	}
-	defer ioutil.CheckClose(wc, &err)
-	scfg, err := r.Config()
-	if err != nil {
-		return h, err
-	}
-	enc := packfile.NewEncoder(wc, r.Storer, cfg.UseRefDeltas)
-	h, err = enc.Encode(objs, scfg.Pack.Window)
+	h, err = r.encodeObjectPack(objs, cfg.UseRefDeltas)
 	if err != nil {
 		return h, err
 	}
@@ -1879,6 +2691,27 @@ func (r *Repository) createNewObjectPack(cfg *RepackConfig) (h plumbing.Hash, er
 	return h, err
 }
 
+// encodeObjectPack writes a new pack of the given objects, with the pack.*
+// config. It is used so the PackfileWriter deferred close has the right
+// scope.
+func (r *Repository) encodeObjectPack(objs []plumbing.Hash, useRefDeltas bool) (h plumbing.Hash, err error) {
+	pfw, ok := r.Storer.(storer.PackfileWriter)
+	if !ok {
+		return h, fmt.Errorf("Repository storer is not a storer.PackfileWriter")
+	}
+	wc, err := pfw.PackfileWriter()
+	if err != nil {
+		return h, err
+	}
+	defer ioutil.CheckClose(wc, &err)
+	scfg, err := r.Config()
+	if err != nil {
+		return h, err
+	}
+	enc := packfile.NewEncoder(wc, storage.NoReplaceObjects(r.Storer), useRefDeltas, packfile.WithMaxDeltaDepth(scfg.Pack.Depth))
+	return enc.Encode(objs, scfg.Pack.Window)
+}
+
 func expandPartialHash(st storer.EncodedObjectStorer, prefix []byte) (hashes []plumbing.Hash) {
 	// The fast version is implemented by storage/filesystem.ObjectStorage.
 	type fastIter interface {
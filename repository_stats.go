@@ -0,0 +1,212 @@
+package git
+
+import (
+	"sort"
+
+	"github.com/go-git/go-git/v6/plumbing"
+	"github.com/go-git/go-git/v6/plumbing/storer"
+)
+
+// DefaultStatsLargestObjects is the number of the largest objects given by
+// Repository.Stats.
+const DefaultStatsLargestObjects = 10
+
+// StatsOptions describes how the statistics of a repository are computed by
+// Repository.StatsWithOptions.
+type StatsOptions struct {
+	// LargestObjects is the number of the largest objects to give,
+	// DefaultStatsLargestObjects if zero, none if negative.
+	LargestObjects int
+}
+
+// RepoStats are the statistics of a repository, as given by `git
+// count-objects -v` and in part by git-sizer.
+type RepoStats struct {
+	// LooseObjects is the number of loose objects.
+	LooseObjects int
+	// LooseSize is the size on disk of the loose objects.
+	LooseSize int64
+	// PackedObjects is the number of objects in the object packs, the ones
+	// held by several packs being counted once by pack.
+	PackedObjects int
+	// Packs are the object packs, ordered by hash.
+	Packs []PackStats
+	// PackSize is the size on disk of the object packs, their packfiles and
+	// their indexes.
+	PackSize int64
+	// Size is the size on disk of the objects, loose and packed.
+	Size int64
+	// Branches, Tags and Remotes are the numbers of the references to
+	// branches, tags and remote branches, OtherRefs the number of the other
+	// references but HEAD, such as the notes.
+	Branches  int
+	Tags      int
+	Remotes   int
+	OtherRefs int
+	// LargestObjects are the largest objects of the repository, by size once
+	// inflated, the largest first.
+	LargestObjects []storer.ObjectSize
+}
+
+// PackStats are the statistics of an object pack.
+type PackStats struct {
+	// Hash is the hash of the object pack.
+	Hash plumbing.Hash
+	// Objects is the number of objects of the pack.
+	Objects int
+	// Size is the size on disk of the pack, its packfile and its index.
+	Size int64
+}
+
+// Stats returns the statistics of the repository, with the default options.
+func (r *Repository) Stats() (*RepoStats, error) {
+	return r.StatsWithOptions(StatsOptions{})
+}
+
+// StatsWithOptions returns the statistics of the repository: the objects,
+// loose and packed, and their size on disk, the references by kind, and the
+// largest objects. The sizes of the objects are read from their headers and
+// the indexes of the packs, without inflating the objects, from the storages
+// implementing storer.ObjectSizeStorer. The objects of the other storages,
+// such as the memory one, are read and counted as loose objects, whose size
+// on disk is their size.
+func (r *Repository) StatsWithOptions(o StatsOptions) (*RepoStats, error) {
+	if o.LargestObjects == 0 {
+		o.LargestObjects = DefaultStatsLargestObjects
+	}
+
+	s := &RepoStats{}
+	l := &largestObjects{max: o.LargestObjects, seen: make(map[plumbing.Hash]bool)}
+	if err := r.objectStats(s, l); err != nil {
+		return nil, err
+	}
+
+	if err := r.refStats(s); err != nil {
+		return nil, err
+	}
+
+	s.Size = s.LooseSize + s.PackSize
+	s.LargestObjects = l.objects
+	return s, nil
+}
+
+func (r *Repository) objectStats(s *RepoStats, l *largestObjects) error {
+	ss, ok := r.Storer.(storer.ObjectSizeStorer)
+	los, lok := r.Storer.(storer.LooseObjectStorer)
+	pos, pok := r.Storer.(storer.PackedObjectStorer)
+	if !ok || !lok || !pok {
+		return r.iterObjectStats(s, l)
+	}
+
+	err := los.ForEachObjectHash(func(h plumbing.Hash) error {
+		size, err := ss.LooseObjectSize(h)
+		if err != nil {
+			return err
+		}
+
+		s.LooseObjects++
+		s.LooseSize += size.DiskSize
+		l.add(size)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	packs, err := pos.ObjectPacks()
+	if err != nil {
+		return err
+	}
+
+	sort.Sort(plumbing.HashSlice(packs))
+	for _, h := range packs {
+		size, err := ss.ObjectPackSize(h)
+		if err != nil {
+			return err
+		}
+
+		sizes, err := ss.ObjectPackSizes(h)
+		if err != nil {
+			return err
+		}
+
+		for _, size := range sizes {
+			l.add(size)
+		}
+
+		s.Packs = append(s.Packs, PackStats{Hash: h, Objects: len(sizes), Size: size})
+		s.PackedObjects += len(sizes)
+		s.PackSize += size
+	}
+
+	return nil
+}
+
+// iterObjectStats computes the statistics of the objects of a storage which
+// doesn't give their sizes, reading them.
+func (r *Repository) iterObjectStats(s *RepoStats, l *largestObjects) error {
+	iter, err := r.Storer.IterEncodedObjects(plumbing.AnyObject)
+	if err != nil {
+		return err
+	}
+
+	return iter.ForEach(func(obj plumbing.EncodedObject) error {
+		s.LooseObjects++
+		s.LooseSize += obj.Size()
+		l.add(storer.ObjectSize{Hash: obj.Hash(), Type: obj.Type(), Size: obj.Size(), DiskSize: obj.Size()})
+		return nil
+	})
+}
+
+func (r *Repository) refStats(s *RepoStats) error {
+	iter, err := r.Storer.IterReferences()
+	if err != nil {
+		return err
+	}
+
+	return iter.ForEach(func(ref *plumbing.Reference) error {
+		switch name := ref.Name(); {
+		case name == plumbing.HEAD:
+		case name.IsBranch():
+			s.Branches++
+		case name.IsTag():
+			s.Tags++
+		case name.IsRemote():
+			s.Remotes++
+		default:
+			s.OtherRefs++
+		}
+
+		return nil
+	})
+}
+
+// largestObjects keeps the largest objects added, the largest first, each
+// object being kept once even if stored several times.
+type largestObjects struct {
+	max     int
+	objects []storer.ObjectSize
+	seen    map[plumbing.Hash]bool
+}
+
+func (l *largestObjects) add(o storer.ObjectSize) {
+	if l.max <= 0 || l.seen[o.Hash] {
+		return
+	}
+
+	if len(l.objects) == l.max && o.Size <= l.objects[len(l.objects)-1].Size {
+		return
+	}
+
+	i := sort.Search(len(l.objects), func(i int) bool { return l.objects[i].Size < o.Size })
+	if len(l.objects) == l.max {
+		last := l.objects[len(l.objects)-1]
+		delete(l.seen, last.Hash)
+		l.objects = l.objects[:len(l.objects)-1]
+	}
+
+	l.objects = append(l.objects, storer.ObjectSize{})
+	copy(l.objects[i+1:], l.objects[i:])
+	l.objects[i] = o
+	l.seen[o.Hash] = true
+}
@@ -0,0 +1,131 @@
+package git
+
+import (
+	"bufio"
+	"bytes"
+	"os/exec"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/go-git/go-billy/v6/memfs"
+	"github.com/go-git/go-billy/v6/osfs"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/go-git/go-git/v6/plumbing"
+	"github.com/go-git/go-git/v6/plumbing/storer"
+	"github.com/go-git/go-git/v6/storage/memory"
+)
+
+func TestLargestObjects(t *testing.T) {
+	t.Parallel()
+
+	l := &largestObjects{max: 3, seen: make(map[plumbing.Hash]bool)}
+	for i, size := range []int64{5, 1, 7, 5, 3, 9, 2} {
+		l.add(storer.ObjectSize{Hash: plumbing.NewHash(strings.Repeat(strconv.Itoa(i+1), 40)), Size: size})
+	}
+
+	// An object stored several times is kept once.
+	l.add(storer.ObjectSize{Hash: plumbing.NewHash(strings.Repeat("6", 40)), Size: 9})
+
+	var sizes []int64
+	for _, o := range l.objects {
+		sizes = append(sizes, o.Size)
+	}
+
+	assert.Equal(t, []int64{9, 7, 5}, sizes)
+}
+
+func TestStatsMemory(t *testing.T) {
+	t.Parallel()
+
+	fs := memfs.New()
+	r, err := Init(memory.NewStorage(), WithWorkTree(fs))
+	require.NoError(t, err)
+	commitFiles(t, r, fs, map[string]string{"small": "small\n", "big": strings.Repeat("big\n", 100)})
+
+	head, err := r.Head()
+	require.NoError(t, err)
+	require.NoError(t, r.Storer.SetReference(plumbing.NewHashReference("refs/tags/v1", head.Hash())))
+
+	s, err := r.StatsWithOptions(StatsOptions{LargestObjects: 1})
+	require.NoError(t, err)
+
+	// The commit, the tree and the two blobs.
+	assert.Equal(t, 4, s.LooseObjects)
+	assert.Equal(t, 0, s.PackedObjects)
+	assert.Empty(t, s.Packs)
+	assert.Equal(t, s.LooseSize, s.Size)
+	assert.Equal(t, 1, s.Branches)
+	assert.Equal(t, 1, s.Tags)
+	require.Len(t, s.LargestObjects, 1)
+	assert.Equal(t, plumbing.BlobObject, s.LargestObjects[0].Type)
+	assert.Equal(t, int64(400), s.LargestObjects[0].Size)
+}
+
+func TestStatsGit(t *testing.T) {
+	t.Parallel()
+
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not found")
+	}
+
+	dir := t.TempDir()
+	r, err := PlainInit(dir, false)
+	require.NoError(t, err)
+
+	git := func(args ...string) string {
+		out, err := exec.Command("git", append([]string{"-C", dir}, args...)...).CombinedOutput()
+		require.NoError(t, err, string(out))
+		return string(out)
+	}
+
+	fs := osfs.New(dir)
+	big := strings.Repeat("a big file\n", 1000)
+	commitFiles(t, r, fs, map[string]string{"big": big, "a": "a\n"})
+	// A pack holding a delta of the big file.
+	commitFiles(t, r, fs, map[string]string{"big": big + "more\n"})
+	git("repack", "-q")
+	// A second pack, and loose objects.
+	commitFiles(t, r, fs, map[string]string{"b": "b\n"})
+	git("repack", "-q")
+	commitFiles(t, r, fs, map[string]string{"c": "c\n"})
+
+	// The repository is opened again, for the packs written by git to be
+	// indexed.
+	r, err = PlainOpen(dir)
+	require.NoError(t, err)
+	head, err := r.Head()
+	require.NoError(t, err)
+	for _, name := range []string{"refs/heads/feature", "refs/tags/v1", "refs/remotes/origin/master", "refs/notes/commits"} {
+		require.NoError(t, r.Storer.SetReference(plumbing.NewHashReference(plumbing.ReferenceName(name), head.Hash())))
+	}
+
+	s, err := r.Stats()
+	require.NoError(t, err)
+
+	counts := make(map[string]int64)
+	sc := bufio.NewScanner(bytes.NewBufferString(git("count-objects", "-v")))
+	for sc.Scan() {
+		key, value, _ := strings.Cut(sc.Text(), ": ")
+		counts[key], err = strconv.ParseInt(value, 10, 64)
+		require.NoError(t, err)
+	}
+
+	assert.Equal(t, counts["count"], int64(s.LooseObjects))
+	assert.Equal(t, counts["in-pack"], int64(s.PackedObjects))
+	assert.Equal(t, counts["packs"], int64(len(s.Packs)))
+	assert.Equal(t, counts["size-pack"], s.PackSize/1024)
+	assert.Equal(t, s.LooseSize+s.PackSize, s.Size)
+
+	assert.Equal(t, 2, s.Branches)
+	assert.Equal(t, 1, s.Tags)
+	assert.Equal(t, 1, s.Remotes)
+	assert.Equal(t, 1, s.OtherRefs)
+
+	require.Len(t, s.LargestObjects, DefaultStatsLargestObjects)
+	assert.Equal(t, plumbing.BlobObject, s.LargestObjects[0].Type)
+	assert.Equal(t, int64(len(big)+5), s.LargestObjects[0].Size)
+	assert.Equal(t, int64(len(big)), s.LargestObjects[1].Size)
+}
@@ -6,6 +6,9 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"math/rand"
+	"net/http"
+	"net/http/httptest"
 	"os"
 	"os/exec"
 	"os/user"
@@ -13,7 +16,9 @@ import (
 	"path/filepath"
 	"regexp"
 	"slices"
+	"strconv"
 	"strings"
+	"sync"
 	"testing"
 	"time"
 
@@ -34,7 +39,9 @@ import (
 	"github.com/go-git/go-git/v6/plumbing/cache"
 	formatcfg "github.com/go-git/go-git/v6/plumbing/format/config"
 	"github.com/go-git/go-git/v6/plumbing/object"
+	"github.com/go-git/go-git/v6/plumbing/protocol"
 	"github.com/go-git/go-git/v6/plumbing/protocol/packp"
+	"github.com/go-git/go-git/v6/plumbing/protocol/packp/sideband"
 	"github.com/go-git/go-git/v6/plumbing/storer"
 	"github.com/go-git/go-git/v6/plumbing/transport"
 	"github.com/go-git/go-git/v6/storage"
@@ -184,6 +191,212 @@ func TestPlainInitAndPlainOpen(t *testing.T) {
 	})
 }
 
+func TestInitObjectFormatStorer(t *testing.T) {
+	t.Parallel()
+
+	// The storer is given the object format of the repository.
+	r, err := Init(memory.NewStorage(), WithObjectFormat(formatcfg.SHA256), WithWorkTree(memfs.New()))
+	require.NoError(t, err)
+
+	cfg, err := r.Config()
+	require.NoError(t, err)
+	assert.Equal(t, formatcfg.SHA256, cfg.Extensions.ObjectFormat)
+	assert.EqualValues(t, formatcfg.Version_1, cfg.Core.RepositoryFormatVersion)
+
+	h := createCommit(t, r)
+	assert.Equal(t, formatcfg.SHA256.HexSize(), len(h.String()))
+	c, err := r.CommitObject(h)
+	require.NoError(t, err)
+	_, err = c.Tree()
+	require.NoError(t, err)
+}
+
+func TestCloneFetchPushObjectFormat(t *testing.T) {
+	t.Parallel()
+
+	forEachFormat(t, func(t *testing.T, of formatcfg.ObjectFormat) {
+		dir := t.TempDir()
+		origin, err := PlainInit(dir, false, WithObjectFormat(of))
+		require.NoError(t, err)
+		createCommit(t, origin)
+
+		// The clone is given the object format of the remote.
+		cloneDir := t.TempDir()
+		r, err := PlainClone(cloneDir, &CloneOptions{URL: dir})
+		require.NoError(t, err)
+
+		cfg, err := r.Config()
+		require.NoError(t, err)
+		assert.Equal(t, of, cfg.Extensions.ObjectFormat)
+
+		head, err := r.Head()
+		require.NoError(t, err)
+		assert.Equal(t, of.HexSize(), len(head.Hash().String()))
+
+		w, err := r.Worktree()
+		require.NoError(t, err)
+		status, err := w.Status()
+		require.NoError(t, err)
+		assert.True(t, status.IsClean(), status)
+
+		pushed := createCommit(t, r)
+		require.NoError(t, r.Push(&PushOptions{RefSpecs: []config.RefSpec{"refs/heads/master:refs/heads/pushed"}}))
+		ref, err := origin.Reference("refs/heads/pushed", false)
+		require.NoError(t, err)
+		assert.Equal(t, pushed, ref.Hash())
+
+		fetched := createCommit(t, origin)
+		require.NoError(t, r.Fetch(&FetchOptions{}))
+		ref, err = r.Reference("refs/remotes/origin/master", false)
+		require.NoError(t, err)
+		assert.Equal(t, fetched, ref.Hash())
+
+		mem, err := Clone(memory.NewStorage(), nil, &CloneOptions{URL: dir})
+		require.NoError(t, err)
+		ref, err = mem.Head()
+		require.NoError(t, err)
+		assert.Equal(t, fetched, ref.Hash())
+
+		if _, err := exec.LookPath("git"); err == nil {
+			for _, d := range []string{dir, cloneDir} {
+				out, err := exec.Command("git", "-C", d, "fsck", "--strict").CombinedOutput()
+				require.NoError(t, err, string(out))
+			}
+		}
+	})
+}
+
+func TestFetchObjectFormatMismatch(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	origin, err := PlainInit(dir, false, WithObjectFormat(formatcfg.SHA256))
+	require.NoError(t, err)
+	createCommit(t, origin)
+
+	r, err := PlainInit(t.TempDir(), false)
+	require.NoError(t, err)
+	createCommit(t, r)
+	_, err = r.CreateRemote(&config.RemoteConfig{Name: DefaultRemoteName, URLs: []string{dir}})
+	require.NoError(t, err)
+
+	assert.ErrorIs(t, r.Fetch(&FetchOptions{}), ErrObjectFormatMismatch)
+	assert.ErrorIs(t, r.Push(&PushOptions{RefSpecs: []config.RefSpec{"refs/heads/master:refs/heads/sha1"}}), ErrObjectFormatMismatch)
+}
+
+func TestRepositoryPackRefs(t *testing.T) {
+	t.Parallel()
+
+	fs := fixtures.ByTag("tags").One().DotGit(fixtures.WithTargetDir(t.TempDir))
+	r, err := Open(filesystem.NewStorage(fs, cache.NewObjectLRUDefault()), nil)
+	require.NoError(t, err)
+
+	before, err := r.References()
+	require.NoError(t, err)
+	var expected []*plumbing.Reference
+	require.NoError(t, before.ForEach(func(ref *plumbing.Reference) error {
+		expected = append(expected, ref)
+		return nil
+	}))
+
+	require.NoError(t, r.PackRefs())
+
+	// The symbolic refs/remotes/origin/HEAD is kept loose.
+	loose, err := r.Storer.CountLooseRefs()
+	require.NoError(t, err)
+	assert.Equal(t, 1, loose)
+
+	// The file is the one of `git pack-refs --all`.
+	packed, err := util.ReadFile(fs, "packed-refs")
+	require.NoError(t, err)
+	assert.Equal(t, `# pack-refs with: peeled fully-peeled sorted 
+f7b877701fbf855b44c0a9e86f3fdce2c298b07f refs/heads/master
+f7b877701fbf855b44c0a9e86f3fdce2c298b07f refs/remotes/origin/master
+b742a2a9fa0afcfa9a6fad080980fbc26b007c69 refs/tags/annotated-tag
+^f7b877701fbf855b44c0a9e86f3fdce2c298b07f
+fe6cb94756faa81e5ed9240f9191b833db5f40ae refs/tags/blob-tag
+^e69de29bb2d1d6434b8b29ae775ad8c2e48c5391
+ad7897c0fb8e7d9a9ba41fa66072cf06095a6cfc refs/tags/commit-tag
+^f7b877701fbf855b44c0a9e86f3fdce2c298b07f
+f7b877701fbf855b44c0a9e86f3fdce2c298b07f refs/tags/lightweight-tag
+152175bf7e5580299fa1f0ba41ef6474cc043b70 refs/tags/tree-tag
+^70846e9a10ef7b41064b40f07713d5b8b9a8fc73
+`, string(packed))
+
+	after, err := r.References()
+	require.NoError(t, err)
+	var refs []*plumbing.Reference
+	require.NoError(t, after.ForEach(func(ref *plumbing.Reference) error {
+		refs = append(refs, ref)
+		return nil
+	}))
+	assert.ElementsMatch(t, expected, refs)
+
+	// A loose reference shadows the packed one.
+	master := plumbing.NewHashReference(plumbing.Master, plumbing.NewHash("b742a2a9fa0afcfa9a6fad080980fbc26b007c69"))
+	require.NoError(t, r.Storer.SetReference(master))
+	ref, err := r.Reference(plumbing.Master, false)
+	require.NoError(t, err)
+	assert.Equal(t, master, ref)
+
+	// The packed tags are removed along with their peeled value.
+	require.NoError(t, r.DeleteTag("annotated-tag"))
+	_, err = r.Tag("annotated-tag")
+	assert.ErrorIs(t, err, ErrTagNotFound)
+	packed, err = util.ReadFile(fs, "packed-refs")
+	require.NoError(t, err)
+	assert.Equal(t, `# pack-refs with: peeled fully-peeled sorted 
+f7b877701fbf855b44c0a9e86f3fdce2c298b07f refs/heads/master
+f7b877701fbf855b44c0a9e86f3fdce2c298b07f refs/remotes/origin/master
+fe6cb94756faa81e5ed9240f9191b833db5f40ae refs/tags/blob-tag
+^e69de29bb2d1d6434b8b29ae775ad8c2e48c5391
+ad7897c0fb8e7d9a9ba41fa66072cf06095a6cfc refs/tags/commit-tag
+^f7b877701fbf855b44c0a9e86f3fdce2c298b07f
+f7b877701fbf855b44c0a9e86f3fdce2c298b07f refs/tags/lightweight-tag
+152175bf7e5580299fa1f0ba41ef6474cc043b70 refs/tags/tree-tag
+^70846e9a10ef7b41064b40f07713d5b8b9a8fc73
+`, string(packed))
+
+	require.NoError(t, r.PackRefs())
+	ref, err = r.Reference(plumbing.Master, false)
+	require.NoError(t, err)
+	assert.Equal(t, master, ref)
+
+	if _, err := exec.LookPath("git"); err != nil {
+		return
+	}
+
+	cmd := exec.Command("git", "show-ref", "--dereference")
+	cmd.Dir = fs.Root()
+	out, err := cmd.CombinedOutput()
+	require.NoError(t, err, string(out))
+	assert.Contains(t, string(out), "fe6cb94756faa81e5ed9240f9191b833db5f40ae refs/tags/blob-tag\ne69de29bb2d1d6434b8b29ae775ad8c2e48c5391 refs/tags/blob-tag^{}\n")
+}
+
+func TestRepositoryPackRefsPlainOpen(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	_, err := PlainInit(dir, false)
+	require.NoError(t, err)
+
+	// The filesystem of the repositories opened by path is bound to the
+	// git directory, which holds the temp packed-refs files.
+	r, err := PlainOpen(dir)
+	require.NoError(t, err)
+
+	h := plumbing.NewHash("6ecf0ef2c2dffb796033e5a02219af86ec6584e5")
+	require.NoError(t, r.Storer.SetReference(plumbing.NewHashReference("refs/heads/foo", h)))
+	require.NoError(t, r.Storer.SetReference(plumbing.NewHashReference("refs/heads/bar", h)))
+	require.NoError(t, r.PackRefs())
+	require.NoError(t, r.Storer.RemoveReference("refs/heads/foo"))
+
+	packed, err := os.ReadFile(filepath.Join(dir, GitDirName, "packed-refs"))
+	require.NoError(t, err)
+	assert.Equal(t, "# pack-refs with: peeled fully-peeled sorted \n"+
+		"6ecf0ef2c2dffb796033e5a02219af86ec6584e5 refs/heads/bar\n", string(packed))
+}
+
 type RepositorySuite struct {
 	BaseSuite
 }
@@ -367,7 +580,7 @@ func (s *RepositorySuite) TestCloneWithTags() {
 	var count int
 	i.ForEach(func(r *plumbing.Reference) error { count++; return nil })
 
-	s.Equal(3, count)
+	s.Equal(4, count)
 }
 
 func (s *RepositorySuite) TestCloneSparse() {
@@ -711,6 +924,103 @@ func (s *RepositorySuite) TestDeleteBranch() {
 	s.ErrorIs(err, ErrBranchNotFound)
 }
 
+func (s *RepositorySuite) TestDeleteBranchReference() {
+	r := s.NewRepository(fixtures.Basic().One())
+	s.Require().NoError(r.DeleteBranch("branch"))
+
+	_, err := r.Reference("refs/heads/branch", false)
+	s.ErrorIs(err, plumbing.ErrReferenceNotFound)
+	_, err = r.Branch("branch")
+	s.ErrorIs(err, ErrBranchNotFound)
+	s.Empty(reflogMessages(s.T(), r, "refs/heads/branch"))
+
+	s.ErrorIs(r.DeleteBranch("master"), ErrBranchCheckedOut)
+	s.ErrorIs(r.DeleteBranch("branch"), ErrBranchNotFound)
+}
+
+func (s *RepositorySuite) TestCreateBranchAt() {
+	r := s.NewRepository(fixtures.Basic().One())
+
+	ref, err := r.CreateBranchAt("foo", plumbing.ZeroHash, nil)
+	s.Require().NoError(err)
+	s.Equal(plumbing.NewHashReference("refs/heads/foo", plumbing.NewHash("6ecf0ef2c2dffb796033e5a02219af86ec6584e5")), ref)
+	s.Equal([]string{"branch: Created from HEAD"}, reflogMessages(s.T(), r, "refs/heads/foo"))
+
+	_, err = r.Branch("foo")
+	s.ErrorIs(err, ErrBranchNotFound)
+
+	_, err = r.CreateBranchAt("foo", plumbing.ZeroHash, nil)
+	s.ErrorIs(err, ErrBranchExists)
+	_, err = r.CreateBranchAt("master", plumbing.ZeroHash, &CreateBranchOptions{Force: true})
+	s.ErrorIs(err, ErrBranchCheckedOut)
+
+	initial := plumbing.NewHash("b029517f6300c2da0f4b651b8642506cd6aaf45d")
+	ref, err = r.CreateBranchAt("foo", initial, &CreateBranchOptions{Force: true})
+	s.Require().NoError(err)
+	s.Equal(initial, ref.Hash())
+	s.Equal([]string{"branch: Reset to " + initial.String(), "branch: Created from HEAD"}, reflogMessages(s.T(), r, "refs/heads/foo"))
+
+	// A branch tracking a remote-tracking branch starts at it.
+	ref, err = r.CreateBranchAt("tracking", plumbing.ZeroHash, &CreateBranchOptions{Upstream: "refs/remotes/origin/branch"})
+	s.Require().NoError(err)
+	s.Equal(plumbing.NewHash("e8d3ffab552895c19b9fcf7aa264d277cde33881"), ref.Hash())
+
+	b, err := r.Branch("tracking")
+	s.Require().NoError(err)
+	s.Equal("origin", b.Remote)
+	s.Equal(plumbing.ReferenceName("refs/heads/branch"), b.Merge)
+
+	_, err = r.CreateBranchAt("local", plumbing.ZeroHash, &CreateBranchOptions{Upstream: "refs/heads/foo"})
+	s.Require().NoError(err)
+	b, err = r.Branch("local")
+	s.Require().NoError(err)
+	s.Equal(".", b.Remote)
+	s.Equal(plumbing.ReferenceName("refs/heads/foo"), b.Merge)
+
+	_, err = r.CreateBranchAt("invalid", plumbing.ZeroHash, &CreateBranchOptions{Upstream: "refs/tags/v1.0.0"})
+	s.ErrorIs(err, ErrInvalidUpstream)
+	_, err = r.CreateBranchAt("-foo", plumbing.ZeroHash, nil)
+	s.ErrorIs(err, plumbing.ErrInvalidReferenceName)
+}
+
+func (s *RepositorySuite) TestRenameBranch() {
+	r := s.NewRepository(fixtures.Basic().One())
+	_, err := r.CreateBranchAt("feature", plumbing.ZeroHash, &CreateBranchOptions{Upstream: "refs/remotes/origin/branch"})
+	s.Require().NoError(err)
+
+	s.Require().NoError(r.RenameBranch("feature", "renamed"))
+	_, err = r.Reference("refs/heads/feature", false)
+	s.ErrorIs(err, plumbing.ErrReferenceNotFound)
+	_, err = r.Branch("feature")
+	s.ErrorIs(err, ErrBranchNotFound)
+
+	b, err := r.Branch("renamed")
+	s.Require().NoError(err)
+	s.Equal("renamed", b.Name)
+	s.Equal(plumbing.ReferenceName("refs/heads/branch"), b.Merge)
+	s.Equal([]string{
+		"Branch: renamed refs/heads/feature to refs/heads/renamed",
+		"branch: Created from refs/remotes/origin/branch",
+	}, reflogMessages(s.T(), r, "refs/heads/renamed"))
+
+	cfg, err := r.Config()
+	s.Require().NoError(err)
+	marshaled, err := cfg.Marshal()
+	s.Require().NoError(err)
+	s.Contains(string(marshaled), `[branch "renamed"]`)
+	s.NotContains(string(marshaled), `[branch "feature"]`)
+
+	// HEAD follows the current branch.
+	s.Require().NoError(r.RenameBranch("master", "main"))
+	head, err := r.Head()
+	s.Require().NoError(err)
+	s.Equal(plumbing.ReferenceName("refs/heads/main"), head.Name())
+	s.Equal("Branch: renamed refs/heads/master to refs/heads/main", reflogMessages(s.T(), r, plumbing.HEAD)[0])
+
+	s.ErrorIs(r.RenameBranch("master", "foo"), ErrBranchNotFound)
+	s.ErrorIs(r.RenameBranch("main", "renamed"), ErrBranchExists)
+}
+
 func (s *RepositorySuite) TestPlainInitAlreadyExists() {
 	dir := s.T().TempDir()
 	r, err := PlainInit(dir, true)
@@ -1031,6 +1341,79 @@ func (s *RepositorySuite) TestPlainCloneOverExistingGitDirectory() {
 	s.ErrorIs(err, ErrTargetDirNotEmpty)
 }
 
+func (s *RepositorySuite) TestPlainCloneResumable() {
+	remote := fixtures.Basic().One().DotGit(fixtures.WithTargetDir(s.T().TempDir))
+	s.Require().NoError(transport.UpdateServerInfo(filesystem.NewStorage(remote, cache.NewObjectLRUDefault()), remote))
+
+	packs, err := filepath.Glob(filepath.Join(remote.Root(), "objects", "pack", "*.pack"))
+	s.Require().NoError(err)
+	s.Require().Len(packs, 1)
+	pack, err := os.ReadFile(packs[0])
+	s.Require().NoError(err)
+	half := len(pack) / 2
+
+	// The server drops the connection in the middle of the first download
+	// of the packfile.
+	var mu sync.Mutex
+	var ranges []string
+	files := http.FileServer(http.Dir(remote.Root()))
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !strings.HasSuffix(r.URL.Path, ".pack") {
+			files.ServeHTTP(w, r)
+			return
+		}
+
+		mu.Lock()
+		ranges = append(ranges, r.Header.Get("Range"))
+		first := len(ranges) == 1
+		mu.Unlock()
+		if !first {
+			files.ServeHTTP(w, r)
+			return
+		}
+
+		w.Header().Set("Content-Length", strconv.Itoa(len(pack)))
+		w.WriteHeader(http.StatusOK)
+		_, _ = w.Write(pack[:half])
+		w.(http.Flusher).Flush()
+		panic(http.ErrAbortHandler)
+	}))
+	defer server.Close()
+
+	dir := s.T().TempDir()
+	o := &CloneOptions{URL: server.URL, Resumable: true}
+	_, err = PlainClone(dir, o)
+	s.Require().Error(err)
+
+	temps, err := filepath.Glob(filepath.Join(dir, GitDirName, "objects", "pack", "*.pack.temp"))
+	s.Require().NoError(err)
+	s.Require().Len(temps, 1)
+	fi, err := os.Stat(temps[0])
+	s.Require().NoError(err)
+	s.Equal(int64(half), fi.Size())
+
+	_, err = PlainClone(dir, &CloneOptions{URL: server.URL})
+	s.ErrorIs(err, ErrTargetDirNotEmpty)
+	_, err = PlainClone(dir, &CloneOptions{URL: "https://example.com/other.git", Resumable: true})
+	s.ErrorIs(err, ErrTargetDirNotEmpty)
+
+	r, err := PlainClone(dir, o)
+	s.Require().NoError(err)
+	mu.Lock()
+	s.Equal([]string{"", fmt.Sprintf("bytes=%d-", half)}, ranges)
+	mu.Unlock()
+
+	head, err := r.Head()
+	s.Require().NoError(err)
+	s.Equal(plumbing.NewHash("6ecf0ef2c2dffb796033e5a02219af86ec6584e5"), head.Hash())
+	_, err = os.Stat(temps[0])
+	s.True(os.IsNotExist(err))
+
+	// A finished clone is not resumed.
+	_, err = PlainClone(dir, o)
+	s.ErrorIs(err, ErrTargetDirNotEmpty)
+}
+
 func (s *RepositorySuite) TestPlainCloneContextCancel() {
 	ctx, cancel := context.WithCancel(context.Background())
 	cancel()
@@ -1315,6 +1698,72 @@ func (s *RepositorySuite) TestCloneWithProgress() {
 	s.NotEqual(0, buf.Len())
 }
 
+func (s *RepositorySuite) TestCloneWithProgressEvents() {
+	for _, st := range []storage.Storer{
+		memory.NewStorage(),
+		filesystem.NewStorage(memfs.New(), cache.NewObjectLRUDefault()),
+	} {
+		last := make(map[sideband.Phase]sideband.ProgressEvent)
+		r, err := Clone(st, memfs.New(), &CloneOptions{
+			URL: s.GetBasicLocalRepositoryURL(),
+			Progress: sideband.NewProgressWriter(func(e sideband.ProgressEvent) {
+				last[e.Phase] = e
+			}, nil),
+		})
+		s.Require().NoError(err)
+
+		receiving := last[sideband.ReceivingObjects]
+		s.True(receiving.Done)
+		s.Equal(uint64(31), receiving.Current)
+		s.Equal(uint64(31), receiving.Total)
+		s.NotZero(receiving.Bytes)
+
+		resolving := last[sideband.ResolvingDeltas]
+		s.True(resolving.Done)
+		s.Equal(resolving.Total, resolving.Current)
+
+		idx, err := r.Storer.Index()
+		s.Require().NoError(err)
+
+		checkout := last[sideband.Checkout]
+		s.True(checkout.Done)
+		s.Equal(uint64(len(idx.Entries)), checkout.Current)
+		s.Equal(uint64(len(idx.Entries)), checkout.Total)
+	}
+}
+
+func (s *RepositorySuite) TestCloneURLRules() {
+	home := s.T().TempDir()
+	s.T().Setenv("HOME", home)
+	s.T().Setenv("XDG_CONFIG_HOME", "")
+
+	// The rules of the global config apply, the longest match winning.
+	url := s.GetBasicLocalRepositoryURL()
+	s.Require().NoError(os.WriteFile(filepath.Join(home, ".gitconfig"), []byte(fmt.Sprintf(`[url "/nonexistent/"]
+	insteadOf = https://example.com/
+[url %q]
+	insteadOf = https://example.com/git-fixtures/basic.git
+`, url)), 0o644))
+
+	r, err := PlainClone(s.T().TempDir(), &CloneOptions{
+		URL: "https://example.com/git-fixtures/basic.git",
+	})
+	s.Require().NoError(err)
+
+	head, err := r.Head()
+	s.NoError(err)
+	s.Equal("6ecf0ef2c2dffb796033e5a02219af86ec6584e5", head.Hash().String())
+
+	// The URL of the remote is kept as given.
+	cfg, err := r.Config()
+	s.NoError(err)
+	s.Equal([]string{"https://example.com/git-fixtures/basic.git"}, cfg.Remotes[DefaultRemoteName].URLs)
+
+	remote, err := r.Remote(DefaultRemoteName)
+	s.NoError(err)
+	s.Equal([]string{url}, remote.Config().URLs)
+}
+
 func (s *RepositorySuite) TestCloneDeep() {
 	fs := memfs.New()
 	r, _ := Init(memory.NewStorage(), WithWorkTree(fs))
@@ -1431,6 +1880,26 @@ func (s *RepositorySuite) testCloneSingleBranchAndNonHEADReference(ref string) {
 	s.Equal("e8d3ffab552895c19b9fcf7aa264d277cde33881", branch.Hash().String())
 }
 
+func (s *RepositorySuite) TestCloneRemoteHEADMain() {
+	url := s.GetLocalRepositoryURL(fixtures.ByTag("no-master-head").One())
+	for _, version := range []protocol.Version{protocol.V0, protocol.V2} {
+		r, err := Clone(memory.NewStorage(), nil, &CloneOptions{URL: url, ProtocolVersion: version})
+		s.Require().NoError(err)
+
+		head, err := r.Reference(plumbing.HEAD, false)
+		s.NoError(err)
+		s.Equal(plumbing.NewSymbolicReference(plumbing.HEAD, "refs/heads/main"), head, version)
+
+		head, err = r.Reference(plumbing.NewRemoteHEADReferenceName(DefaultRemoteName), false)
+		s.NoError(err)
+		s.Equal(plumbing.NewSymbolicReference("refs/remotes/origin/HEAD", "refs/remotes/origin/main"), head, version)
+
+		cfg, err := r.Config()
+		s.NoError(err)
+		s.Equal(&config.Branch{Name: "main", Remote: DefaultRemoteName, Merge: "refs/heads/main"}, cfg.Branches["main"], version)
+	}
+}
+
 func (s *RepositorySuite) TestCloneSingleBranchHEADMain() {
 	r, _ := Init(memory.NewStorage())
 
@@ -1652,9 +2121,14 @@ func (s *RepositorySuite) TestCloneWithFilter() {
 		Filter: packp.FilterTreeDepth(0),
 	})
 	s.Require().NoError(err)
-	blob, err := r.BlobObject(plumbing.NewHash("9a48f23120e880dfbe41f7c9b7b708e9ee62a492"))
-	s.Require().Error(err)
-	s.Nil(blob)
+
+	h := plumbing.NewHash("9a48f23120e880dfbe41f7c9b7b708e9ee62a492")
+	s.ErrorIs(r.Storer.HasEncodedObject(h), plumbing.ErrObjectNotFound)
+
+	// Missing objects are lazily fetched from the promisor remote.
+	blob, err := r.BlobObject(h)
+	s.Require().NoError(err)
+	s.Equal(h, blob.Hash)
 }
 
 func (s *RepositorySuite) TestPush() {
@@ -1684,6 +2158,49 @@ func (s *RepositorySuite) TestPush() {
 	})
 }
 
+func (s *RepositorySuite) TestPushURLRules() {
+	s.T().Setenv("HOME", s.T().TempDir())
+	s.T().Setenv("XDG_CONFIG_HOME", "")
+
+	url := s.T().TempDir()
+	server, err := PlainInit(url, true)
+	s.NoError(err)
+
+	_, err = s.Repository.CreateRemote(&config.RemoteConfig{
+		Name: "rules",
+		URLs: []string{"https://example.com/org/repo.git"},
+	})
+	s.NoError(err)
+
+	cfg, err := s.Repository.Config()
+	s.NoError(err)
+	cfg.URLs[url] = &config.URL{
+		Name:           url,
+		PushInsteadOfs: []string{"https://example.com/org/repo.git"},
+	}
+	cfg.URLs["/nonexistent/"] = &config.URL{
+		Name:           "/nonexistent/",
+		InsteadOfs:     []string{"https://example.com/"},
+		PushInsteadOfs: []string{"https://example.com/org/"},
+	}
+	s.NoError(s.Repository.SetConfig(cfg))
+
+	remote, err := s.Repository.Remote("rules")
+	s.NoError(err)
+	s.Equal([]string{"/nonexistent/org/repo.git"}, remote.Config().URLs)
+	s.Equal(url, remote.Config().PushURL())
+
+	err = s.Repository.Push(&PushOptions{
+		RemoteName: "rules",
+	})
+	s.NoError(err)
+
+	AssertReferences(s.T(), server, map[string]string{
+		"refs/heads/master": "6ecf0ef2c2dffb796033e5a02219af86ec6584e5",
+		"refs/heads/branch": "e8d3ffab552895c19b9fcf7aa264d277cde33881",
+	})
+}
+
 func (s *RepositorySuite) TestPushContext() {
 	url := s.T().TempDir()
 	_, err := PlainInit(url, true)
@@ -1832,6 +2349,166 @@ func (s *RepositorySuite) TestLog() {
 	s.ErrorIs(err, io.EOF)
 }
 
+func (s *RepositorySuite) TestIsShallow() {
+	r, _ := Init(memory.NewStorage())
+	shallow, boundary, err := r.IsShallow()
+	s.NoError(err)
+	s.False(shallow)
+	s.Empty(boundary)
+
+	h := plumbing.NewHash("918c48b83bd081e863dbe1b80f8998f058cd8294")
+	s.Require().NoError(r.Storer.SetShallow([]plumbing.Hash{h}))
+	shallow, boundary, err = r.IsShallow()
+	s.NoError(err)
+	s.True(shallow)
+	s.Equal([]plumbing.Hash{h}, boundary)
+}
+
+func (s *RepositorySuite) TestLogShallowAndReplaced() {
+	r, _ := Init(memory.NewStorage())
+	err := r.clone(context.Background(), &CloneOptions{
+		URL: s.GetBasicLocalRepositoryURL(),
+	})
+	s.Require().NoError(err)
+
+	log := func() []plumbing.Hash {
+		cIter, err := r.Log(&LogOptions{})
+		s.Require().NoError(err)
+
+		var hashes []plumbing.Hash
+		s.Require().NoError(cIter.ForEach(func(c *object.Commit) error {
+			hashes = append(hashes, c.Hash)
+			return nil
+		}))
+		return hashes
+	}
+
+	s.Require().NoError(r.Storer.SetShallow([]plumbing.Hash{
+		plumbing.NewHash("918c48b83bd081e863dbe1b80f8998f058cd8294"),
+	}))
+	s.Equal([]plumbing.Hash{
+		plumbing.NewHash("6ecf0ef2c2dffb796033e5a02219af86ec6584e5"),
+		plumbing.NewHash("918c48b83bd081e863dbe1b80f8998f058cd8294"),
+	}, log())
+
+	s.Require().NoError(r.Storer.SetReference(plumbing.NewHashReference(
+		"refs/replace/918c48b83bd081e863dbe1b80f8998f058cd8294",
+		plumbing.NewHash("b8e471f58bcbca63b07bda20e428190409c2db47"),
+	)))
+	s.Equal([]plumbing.Hash{
+		plumbing.NewHash("6ecf0ef2c2dffb796033e5a02219af86ec6584e5"),
+		plumbing.NewHash("b8e471f58bcbca63b07bda20e428190409c2db47"),
+		plumbing.NewHash("b029517f6300c2da0f4b651b8642506cd6aaf45d"),
+	}, log())
+}
+
+func TestReplaceObjects(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	r, err := PlainInit(dir, false)
+	require.NoError(t, err)
+	w, err := r.Worktree()
+	require.NoError(t, err)
+
+	commit := func(content string) *object.Commit {
+		require.NoError(t, util.WriteFile(w.Filesystem, "secret", []byte(content), 0o644))
+		_, err := w.Add("secret")
+		require.NoError(t, err)
+		h, err := w.Commit(content, &CommitOptions{Author: defaultSignature()})
+		require.NoError(t, err)
+		c, err := r.CommitObject(h)
+		require.NoError(t, err)
+		return c
+	}
+
+	leaked := commit("password\n")
+	rotated := commit("rotated\n")
+
+	fileContent := func(c *object.Commit) string {
+		f, err := c.File("secret")
+		require.NoError(t, err)
+		content, err := f.Contents()
+		require.NoError(t, err)
+		return content
+	}
+
+	entry, err := leaked.File("secret")
+	require.NoError(t, err)
+	secret := entry.Hash
+
+	redacted := r.Storer.NewEncodedObject()
+	redacted.SetType(plumbing.BlobObject)
+	wr, err := redacted.Writer()
+	require.NoError(t, err)
+	_, err = wr.Write([]byte("REDACTED\n"))
+	require.NoError(t, err)
+	require.NoError(t, wr.Close())
+	redactedHash, err := r.Storer.SetEncodedObject(redacted)
+	require.NoError(t, err)
+	require.NoError(t, r.Storer.SetReference(plumbing.NewHashReference(
+		plumbing.ReferenceName(storer.ReplaceRefPrefix+secret.String()), redactedHash)))
+
+	// The replaced object is read as its replacement.
+	obj, err := r.Storer.EncodedObject(plumbing.BlobObject, secret)
+	require.NoError(t, err)
+	assert.Equal(t, redactedHash, obj.Hash())
+	size, err := r.Storer.EncodedObjectSize(secret)
+	require.NoError(t, err)
+	assert.Equal(t, int64(len("REDACTED\n")), size)
+	assert.Equal(t, "REDACTED\n", fileContent(leaked))
+
+	patch, err := leaked.Patch(rotated)
+	require.NoError(t, err)
+	assert.Contains(t, patch.String(), "-REDACTED\n+rotated\n")
+
+	require.NoError(t, w.Checkout(&CheckoutOptions{Hash: leaked.Hash}))
+	content, err := util.ReadFile(w.Filesystem, "secret")
+	require.NoError(t, err)
+	assert.Equal(t, "REDACTED\n", string(content))
+	// As with git, the index holds the replaced blob, the file then
+	// differing from it once checked out.
+	require.NoError(t, w.Checkout(&CheckoutOptions{Branch: plumbing.Master, Force: true}))
+
+	// The callers opt out by reading the objects as they are stored.
+	obj, err = storage.NoReplaceObjects(r.Storer).EncodedObject(plumbing.BlobObject, secret)
+	require.NoError(t, err)
+	assert.Equal(t, secret, obj.Hash())
+
+	fs := osfs.New(filepath.Join(dir, GitDirName), osfs.WithBoundOS())
+	raw, err := Open(filesystem.NewStorageWithOptions(fs, cache.NewObjectLRUDefault(),
+		filesystem.Options{NoReplaceObjects: true}), nil)
+	require.NoError(t, err)
+	c, err := raw.CommitObject(leaked.Hash)
+	require.NoError(t, err)
+	assert.Equal(t, "password\n", fileContent(c))
+
+	mem := memory.NewStorage(memory.WithNoReplaceObjects())
+	clone, err := Clone(mem, nil, &CloneOptions{URL: dir})
+	require.NoError(t, err)
+	c, err = clone.CommitObject(leaked.Hash)
+	require.NoError(t, err)
+	assert.Equal(t, "password\n", fileContent(c))
+
+	// The objects are served, packed and pruned as they are stored.
+	clone, err = Clone(memory.NewStorage(), nil, &CloneOptions{URL: dir, Mirror: true})
+	require.NoError(t, err)
+	c, err = clone.CommitObject(leaked.Hash)
+	require.NoError(t, err)
+	assert.Equal(t, "REDACTED\n", fileContent(c))
+	assert.NoError(t, storage.NoReplaceObjects(clone.Storer).HasEncodedObject(secret))
+
+	require.NoError(t, r.RepackObjects(&RepackConfig{}))
+	require.NoError(t, r.Prune(PruneOptions{Handler: r.DeleteObject}))
+	obj, err = storage.NoReplaceObjects(r.Storer).EncodedObject(plumbing.BlobObject, secret)
+	require.NoError(t, err)
+	assert.Equal(t, secret, obj.Hash())
+
+	report, err := r.Fsck(nil)
+	require.NoError(t, err)
+	assert.Empty(t, report.Issues)
+}
+
 func (s *RepositorySuite) TestLogAll() {
 	r, _ := Init(memory.NewStorage())
 	err := r.clone(context.Background(), &CloneOptions{
@@ -1848,7 +2525,7 @@ func (s *RepositorySuite) TestLogAll() {
 		return nil
 	})
 	s.NoError(err)
-	s.Equal(5, refCount)
+	s.Equal(6, refCount)
 
 	cIter, err := r.Log(&LogOptions{
 		All: true,
@@ -1877,6 +2554,68 @@ func (s *RepositorySuite) TestLogAll() {
 	cIter.Close()
 }
 
+func (s *RepositorySuite) TestLogAllTopoAndDateOrder() {
+	r, _ := Init(memory.NewStorage())
+	err := r.clone(context.Background(), &CloneOptions{
+		URL: s.GetBasicLocalRepositoryURL(),
+	})
+	s.NoError(err)
+
+	// The orders of `git log --all --topo-order` and `git log --all
+	// --date-order`, which differ in the history of the merge a5b8b09.
+	for order, expected := range map[LogOrder][]string{
+		LogOrderTopo: {
+			"6ecf0ef2c2dffb796033e5a02219af86ec6584e5",
+			"e8d3ffab552895c19b9fcf7aa264d277cde33881",
+			"918c48b83bd081e863dbe1b80f8998f058cd8294",
+			"af2d6a6954d532f8ffb47615169c8fdf9d383a1a",
+			"1669dce138d9b841a518c64b10914d88f5e488ea",
+			"a5b8b09e2f8fcb0bb99d3ccb0958157b40890d69",
+			"b8e471f58bcbca63b07bda20e428190409c2db47",
+			"35e85108805c84807bc66a02d91535e1e24b38b9",
+			"b029517f6300c2da0f4b651b8642506cd6aaf45d",
+		},
+		LogOrderDate: {
+			"6ecf0ef2c2dffb796033e5a02219af86ec6584e5",
+			"e8d3ffab552895c19b9fcf7aa264d277cde33881",
+			"918c48b83bd081e863dbe1b80f8998f058cd8294",
+			"af2d6a6954d532f8ffb47615169c8fdf9d383a1a",
+			"1669dce138d9b841a518c64b10914d88f5e488ea",
+			"a5b8b09e2f8fcb0bb99d3ccb0958157b40890d69",
+			"35e85108805c84807bc66a02d91535e1e24b38b9",
+			"b8e471f58bcbca63b07bda20e428190409c2db47",
+			"b029517f6300c2da0f4b651b8642506cd6aaf45d",
+		},
+	} {
+		cIter, err := r.Log(&LogOptions{All: true, Order: order})
+		s.NoError(err)
+
+		var hashes []string
+		s.NoError(cIter.ForEach(func(c *object.Commit) error {
+			hashes = append(hashes, c.Hash.String())
+			return nil
+		}))
+		s.Equal(expected, hashes)
+	}
+
+	cIter, err := r.Log(&LogOptions{
+		From:  plumbing.NewHash("a5b8b09e2f8fcb0bb99d3ccb0958157b40890d69"),
+		Order: LogOrderTopo,
+	})
+	s.NoError(err)
+
+	var hashes []string
+	s.NoError(cIter.ForEach(func(c *object.Commit) error {
+		hashes = append(hashes, c.Hash.String())
+		return nil
+	}))
+	s.Equal([]string{
+		"a5b8b09e2f8fcb0bb99d3ccb0958157b40890d69",
+		"b8e471f58bcbca63b07bda20e428190409c2db47",
+		"b029517f6300c2da0f4b651b8642506cd6aaf45d",
+	}, hashes)
+}
+
 func (s *RepositorySuite) TestLogAllMissingReferences() {
 	r, _ := Init(memory.NewStorage())
 	err := r.clone(context.Background(), &CloneOptions{
@@ -1895,7 +2634,7 @@ func (s *RepositorySuite) TestLogAllMissingReferences() {
 		return nil
 	})
 	s.NoError(err)
-	s.Equal(4, refCount)
+	s.Equal(5, refCount)
 
 	err = r.Storer.SetReference(plumbing.NewHashReference(plumbing.ReferenceName("DUMMY"), plumbing.NewHash("DUMMY")))
 	s.NoError(err)
@@ -1909,7 +2648,7 @@ func (s *RepositorySuite) TestLogAllMissingReferences() {
 		return nil
 	})
 	s.NoError(err)
-	s.Equal(5, refCount)
+	s.Equal(6, refCount)
 
 	cIter, err := r.Log(&LogOptions{
 		All: true,
@@ -2286,6 +3025,235 @@ func (s *RepositorySuite) TestLogPathFilterRegexp() {
 	)
 }
 
+func (s *RepositorySuite) TestLogFileSimplifiesMerges() {
+	r, _ := Init(memory.NewStorage())
+	err := r.clone(context.Background(), &CloneOptions{
+		URL: s.GetBasicLocalRepositoryURL(),
+	})
+	s.NoError(err)
+
+	// CHANGELOG is brought by two merges, which are skipped since it is the
+	// same as in one of their parents.
+	fileName := "CHANGELOG"
+	cIter, err := r.Log(&LogOptions{FileName: &fileName})
+	s.NoError(err)
+	defer cIter.Close()
+
+	var commitIDs []string
+	err = cIter.ForEach(func(commit *object.Commit) error {
+		commitIDs = append(commitIDs, commit.ID().String())
+		return nil
+	})
+	s.NoError(err)
+	s.Equal([]string{"b8e471f58bcbca63b07bda20e428190409c2db47"}, commitIDs)
+}
+
+func (s *RepositorySuite) TestLogFollow() {
+	f := fixtures.ByURL("https://github.com/src-d/go-git.git").ByTag(".git").One()
+	sto := filesystem.NewStorage(f.DotGit(), cache.NewObjectLRUDefault())
+	r, err := Open(sto, nil)
+	s.NoError(err)
+
+	fileName := "storage/filesystem/internal/dotgit/refs.go"
+	expected := []string{
+		"49a82387ad32a07b7721c86d2209e3f3fa00204a",
+		"d7e1fee261234bb3a43c096f558748a569d79eff",
+		"72e5f0083a5eb2707bcfdeafca79eae7785d72cb",
+	}
+
+	for _, follow := range []bool{false, true} {
+		if follow {
+			// The history of the file before it was moved from the gitdir
+			// packages.
+			expected = append(expected,
+				"d66fcf8d4db5986b54a74b227ce9761d4126c66c",
+				"f0ab68088b6f430bfdfa83bdf064ec0bdb79410b",
+				"635c77e0d0be84ff11da826a1d1febe49f082aff",
+			)
+		}
+
+		cIter, err := r.Log(&LogOptions{FileName: &fileName, Follow: follow})
+		s.NoError(err)
+
+		var commitIDs []string
+		err = cIter.ForEach(func(commit *object.Commit) error {
+			commitIDs = append(commitIDs, commit.ID().String())
+			return nil
+		})
+		s.NoError(err)
+		s.Equal(expected, commitIDs)
+		cIter.Close()
+	}
+}
+
+// treeCountingStorage is a storage counting the trees and the commits read
+// from it.
+type treeCountingStorage struct {
+	*filesystem.Storage
+	trees   int
+	commits int
+}
+
+func (s *treeCountingStorage) EncodedObject(t plumbing.ObjectType, h plumbing.Hash) (plumbing.EncodedObject, error) {
+	obj, err := s.Storage.EncodedObject(t, h)
+	if err == nil && obj.Type() == plumbing.TreeObject {
+		s.trees++
+	}
+
+	if err == nil && obj.Type() == plumbing.CommitObject {
+		s.commits++
+	}
+
+	return obj, err
+}
+
+func (s *RepositorySuite) TestLogBloomFilters() {
+	if _, err := exec.LookPath("git"); err != nil {
+		s.T().Skip("git is not available")
+	}
+
+	dir := s.T().TempDir()
+	r, err := PlainInit(dir, false)
+	s.Require().NoError(err)
+	w, err := r.Worktree()
+	s.Require().NoError(err)
+
+	// The files are changed in turn, rare/file only twice.
+	for i := 0; i < 40; i++ {
+		name := fmt.Sprintf("f%d", i%4)
+		if i == 5 || i == 30 {
+			name = "rare/file"
+		}
+
+		s.Require().NoError(util.WriteFile(w.Filesystem, name, []byte(strconv.Itoa(i)), 0o644))
+		_, err = w.Add(name)
+		s.Require().NoError(err)
+		sig := &object.Signature{Name: "foo", Email: "foo@foo.foo", When: time.Unix(int64(1e9+i*60), 0)}
+		_, err = w.Commit(fmt.Sprintf("c%d", i), &CommitOptions{Author: sig})
+		s.Require().NoError(err)
+	}
+
+	paths := []string{"rare/file", "rare", "f1", "missing"}
+	readLogs := func() (map[string][]string, int) {
+		st := &treeCountingStorage{Storage: filesystem.NewStorage(osfs.New(filepath.Join(dir, GitDirName)), cache.NewObjectLRUDefault())}
+		r, err := Open(st, w.Filesystem)
+		s.Require().NoError(err)
+
+		logs := make(map[string][]string)
+		for _, p := range paths {
+			logs[p] = []string{}
+			iter, err := r.Log(&LogOptions{FileName: &p})
+			s.Require().NoError(err)
+			s.Require().NoError(iter.ForEach(func(c *object.Commit) error {
+				logs[p] = append(logs[p], c.Hash.String())
+				return nil
+			}))
+		}
+
+		return logs, st.trees
+	}
+
+	expected, trees := readLogs()
+	s.Len(expected["rare/file"], 2)
+	s.Len(expected["f1"], 9)
+
+	cmd := exec.Command("git", "commit-graph", "write", "--reachable", "--changed-paths")
+	cmd.Dir = dir
+	out, err := cmd.CombinedOutput()
+	s.Require().NoError(err, string(out))
+
+	// The history is the same with the Bloom filters, which spare the
+	// comparison of most trees.
+	logs, bloomTrees := readLogs()
+	s.Equal(expected, logs)
+	s.Less(bloomTrees, trees/4)
+
+	for _, p := range paths {
+		cmd := exec.Command("git", "log", "--format=%H", "--", p)
+		cmd.Dir = dir
+		out, err := cmd.Output()
+		s.Require().NoError(err)
+		s.Equal(strings.Fields(string(out)), logs[p], p)
+	}
+}
+
+func (s *RepositorySuite) TestLogCommitGraph() {
+	if _, err := exec.LookPath("git"); err != nil {
+		s.T().Skip("git is not available")
+	}
+
+	dir := s.T().TempDir()
+	r, err := PlainInit(dir, false)
+	s.Require().NoError(err)
+	w, err := r.Worktree()
+	s.Require().NoError(err)
+
+	// A merge of two lines of history, whose commits interleave in time.
+	tips := make([]plumbing.Hash, 2)
+	for i := 0; i < 10; i++ {
+		if i == 1 {
+			s.Require().NoError(w.Checkout(&CheckoutOptions{Branch: "refs/heads/side", Create: true}))
+		}
+
+		if i > 1 {
+			s.Require().NoError(w.Checkout(&CheckoutOptions{Branch: plumbing.NewBranchReferenceName([]string{"master", "side"}[i%2])}))
+		}
+
+		s.Require().NoError(util.WriteFile(w.Filesystem, fmt.Sprintf("f%d", i), []byte(strconv.Itoa(i)), 0o644))
+		_, err = w.Add(fmt.Sprintf("f%d", i))
+		s.Require().NoError(err)
+		sig := &object.Signature{Name: "foo", Email: "foo@foo.foo", When: time.Unix(int64(1e9+i*60), 0)}
+		h, err := w.Commit(fmt.Sprintf("c%d", i), &CommitOptions{Author: sig})
+		s.Require().NoError(err)
+		tips[i%2] = h
+	}
+
+	sig := &object.Signature{Name: "foo", Email: "foo@foo.foo", When: time.Unix(1e9+3600, 0)}
+	merge, err := w.Commit("merge", &CommitOptions{Author: sig, Parents: tips, AllowEmptyCommits: true})
+	s.Require().NoError(err)
+
+	readLog := func() ([]string, int) {
+		st := &treeCountingStorage{Storage: filesystem.NewStorage(osfs.New(filepath.Join(dir, GitDirName)), cache.NewObjectLRUDefault())}
+		r, err := Open(st, w.Filesystem)
+		s.Require().NoError(err)
+
+		iter, err := r.Log(&LogOptions{From: merge, Order: LogOrderCommitterTime})
+		s.Require().NoError(err)
+		c, err := iter.Next()
+		s.Require().NoError(err)
+		s.Equal(merge, c.Hash)
+		commits := st.commits
+
+		log := []string{c.Hash.String()}
+		s.Require().NoError(iter.ForEach(func(c *object.Commit) error {
+			log = append(log, c.Hash.String())
+			return nil
+		}))
+
+		return log, commits
+	}
+
+	expected, commits := readLog()
+	s.Len(expected, 11)
+	s.Equal(3, commits)
+
+	cmd := exec.Command("git", "commit-graph", "write", "--reachable")
+	cmd.Dir = dir
+	out, err := cmd.CombinedOutput()
+	s.Require().NoError(err, string(out))
+
+	// The parents are walked in the commit-graph, without being read.
+	log, commits := readLog()
+	s.Equal(expected, log)
+	s.Equal(1, commits)
+
+	cmd = exec.Command("git", "log", "--format=%H", merge.String())
+	cmd.Dir = dir
+	out, err = cmd.Output()
+	s.Require().NoError(err)
+	s.Equal(strings.Fields(string(out)), log)
+}
+
 func (s *RepositorySuite) TestLogLimitNext() {
 	r, _ := Init(memory.NewStorage())
 	err := r.clone(context.Background(), &CloneOptions{
@@ -2431,6 +3399,63 @@ func (s *RepositorySuite) TestConfigScoped() {
 	s.NotEqual("", cfg.User.Email)
 }
 
+func (s *RepositorySuite) TestConfigScopedIncludes() {
+	home := s.T().TempDir()
+	s.T().Setenv("HOME", home)
+	s.T().Setenv("XDG_CONFIG_HOME", "")
+
+	dir := filepath.Join(home, "work", "project")
+	r, err := PlainInit(dir, false)
+	s.Require().NoError(err)
+
+	_, err = r.CreateRemote(&config.RemoteConfig{Name: "origin", URLs: []string{"https://example.com/org/project.git"}})
+	s.Require().NoError(err)
+
+	write := func(path, content string) {
+		s.Require().NoError(os.WriteFile(path, []byte(content), 0o644))
+	}
+
+	write(filepath.Join(home, ".gitconfig"), `[user]
+	name = Home
+	email = home@example.com
+[includeIf "gitdir:~/work/"]
+	path = .gitconfig-work
+[includeIf "gitdir:~/other/"]
+	path = .gitconfig-other
+[includeIf "onbranch:master"]
+	path = .gitconfig-master
+[includeIf "hasconfig:remote.*.url:https://example.com/org/**"]
+	path = .gitconfig-org
+`)
+	write(filepath.Join(home, ".gitconfig-work"), "[user]\n\temail = work@example.com\n")
+	write(filepath.Join(home, ".gitconfig-other"), "[user]\n\tname = Other\n")
+	write(filepath.Join(home, ".gitconfig-master"), "[author]\n\tname = Master\n")
+	write(filepath.Join(home, ".gitconfig-org"), "[init]\n\tdefaultBranch = org\n")
+
+	cfg, err := r.ConfigScoped(config.GlobalScope)
+	s.Require().NoError(err)
+	s.Equal("Home", cfg.User.Name)
+	s.Equal("work@example.com", cfg.User.Email)
+	s.Equal("Master", cfg.Author.Name)
+	s.Equal("org", cfg.Init.DefaultBranch)
+
+	// The files included by the local config are resolved against the git
+	// directory, and are not written back to it.
+	write(filepath.Join(dir, "shared.gitconfig"), "[user]\n\tname = Shared\n")
+	local, err := r.Config()
+	s.Require().NoError(err)
+	local.Raw.AddOption("include", "", "path", "../shared.gitconfig")
+	s.Require().NoError(r.SetConfig(local))
+
+	cfg, err = r.ConfigScoped(config.GlobalScope)
+	s.Require().NoError(err)
+	s.Equal("Shared", cfg.User.Name)
+
+	local, err = r.Config()
+	s.Require().NoError(err)
+	s.Equal("", local.User.Name)
+}
+
 func (s *RepositorySuite) TestCommit() {
 	r, _ := Init(memory.NewStorage())
 	err := r.clone(context.Background(), &CloneOptions{
@@ -2478,6 +3503,206 @@ func (s *RepositorySuite) TestCommits() {
 	s.Equal(9, count)
 }
 
+func (s *RepositorySuite) TestMergeBase() {
+	f := fixtures.ByTag("merge-base").One()
+	sto := filesystem.NewStorage(f.DotGit(), cache.NewObjectLRUDefault())
+	r, err := Open(sto, f.DotGit())
+	s.NoError(err)
+
+	// The criss-cross merges of C and D result in two merge bases.
+	bases, err := r.MergeBase(
+		plumbing.NewHash("8b72fabdc4222c3ff965bc310ded788c601c50ed"),
+		plumbing.NewHash("14777cf3e209334592fbfd0b878f6868394db836"),
+	)
+	s.NoError(err)
+	s.Len(bases, 2)
+	s.ElementsMatch([]plumbing.Hash{
+		plumbing.NewHash("4709e13a3cbb300c2b8a917effda776e1b8955c7"),
+		plumbing.NewHash("38468e274e91e50ffb637b88a1954ab6193fe974"),
+	}, []plumbing.Hash{bases[0].Hash, bases[1].Hash})
+
+	// M and N have disconnected histories.
+	bases, err = r.MergeBase(
+		plumbing.NewHash("bb355b64e18386dbc3af63dfd09c015c44cbd9b6"),
+		plumbing.NewHash("d64b894762ab5f09e2b155221b90c18bd0637236"),
+	)
+	s.NoError(err)
+	s.NotNil(bases)
+	s.Empty(bases)
+
+	_, err = r.MergeBase(plumbing.ZeroHash, plumbing.NewHash("d64b894762ab5f09e2b155221b90c18bd0637236"))
+	s.ErrorIs(err, plumbing.ErrObjectNotFound)
+}
+
+func (s *RepositorySuite) TestMergeBaseOctopus() {
+	f := fixtures.ByTag("merge-base").One()
+	sto := filesystem.NewStorage(f.DotGit(), cache.NewObjectLRUDefault())
+	r, err := Open(sto, f.DotGit())
+	s.NoError(err)
+
+	bases, err := r.MergeBaseOctopus(
+		plumbing.NewHash("d1b0093698e398d596ef94d646c4db37e8d1e970"),
+		plumbing.NewHash("dce0e0c20d701c3d260146e443d6b3b079505191"),
+		plumbing.NewHash("25ca6c810c08482d61113fbcaaada38bb59093a8"),
+	)
+	s.NoError(err)
+	s.Len(bases, 1)
+	s.Equal("806824d4778e94fe7c3244e92a9cd07090c9ab54", bases[0].Hash.String())
+}
+
+func (s *RepositorySuite) TestIsAncestor() {
+	f := fixtures.ByTag("merge-base").One()
+	sto := filesystem.NewStorage(f.DotGit(), cache.NewObjectLRUDefault())
+	r, err := Open(sto, f.DotGit())
+	s.NoError(err)
+
+	m := plumbing.NewHash("bb355b64e18386dbc3af63dfd09c015c44cbd9b6")
+	g := plumbing.NewHash("d1b0093698e398d596ef94d646c4db37e8d1e970")
+
+	ok, err := r.IsAncestor(m, g)
+	s.NoError(err)
+	s.True(ok)
+
+	ok, err = r.IsAncestor(g, m)
+	s.NoError(err)
+	s.False(ok)
+
+	ok, err = r.IsAncestor(g, g)
+	s.NoError(err)
+	s.True(ok)
+}
+
+func (s *RepositorySuite) TestAheadBehind() {
+	f := fixtures.ByTag("merge-base").One()
+	sto := filesystem.NewStorage(f.DotGit(), cache.NewObjectLRUDefault())
+	r, err := Open(sto, f.DotGit())
+	s.NoError(err)
+
+	master := plumbing.NewHash("dce0e0c20d701c3d260146e443d6b3b079505191")
+	dev := plumbing.NewHash("25ca6c810c08482d61113fbcaaada38bb59093a8")
+	feature := plumbing.NewHash("d1b0093698e398d596ef94d646c4db37e8d1e970")
+
+	ahead, behind, err := r.AheadBehind(master, dev)
+	s.NoError(err)
+	s.Equal(5, ahead)
+	s.Equal(0, behind)
+
+	ahead, behind, err = r.AheadBehind(feature, master)
+	s.NoError(err)
+	s.Equal(1, ahead)
+	s.Equal(5, behind)
+}
+
+func TestAheadBehindGit(t *testing.T) {
+	t.Parallel()
+
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not found")
+	}
+
+	dir := t.TempDir()
+	r, err := PlainInit(dir, false)
+	require.NoError(t, err)
+	tree, err := NewTreeBuilder(r.Storer, nil).Write()
+	require.NoError(t, err)
+
+	// A history of merges whose committer times are out of order, so that
+	// the side branches are older than the commits they are merged into.
+	rnd := rand.New(rand.NewSource(1))
+	var commits []plumbing.Hash
+	for i := 0; i < 16; i++ {
+		var parents []plumbing.Hash
+		for n := min(i, 1+rnd.Intn(2)); len(parents) < n; {
+			if p := commits[rnd.Intn(i)]; !slices.Contains(parents, p) {
+				parents = append(parents, p)
+			}
+		}
+
+		cb := NewCommitBuilder(r.Storer)
+		cb.Tree = tree
+		cb.Parents = parents
+		cb.Author = &object.Signature{Name: "foo", Email: "foo@foo.foo", When: time.Unix(int64(1e9+rnd.Intn(100)*60), 0)}
+		cb.Message = fmt.Sprintf("c%d\n", i)
+		h, err := cb.Write()
+		require.NoError(t, err)
+		require.NoError(t, r.Storer.SetReference(plumbing.NewHashReference(plumbing.NewBranchReferenceName(fmt.Sprintf("c%d", i)), h)))
+		commits = append(commits, h)
+	}
+
+	git := func(args ...string) string {
+		cmd := exec.Command("git", args...)
+		cmd.Dir = dir
+		out, err := cmd.CombinedOutput()
+		require.NoError(t, err, string(out))
+		return strings.TrimSpace(string(out))
+	}
+
+	expected := make(map[[2]int]string)
+	for i, local := range commits {
+		for j, upstream := range commits {
+			expected[[2]int{i, j}] = git("rev-list", "--left-right", "--count", local.String()+"..."+upstream.String())
+		}
+	}
+
+	// The counts are the same with the commit-graph, walked by generation.
+	for _, graph := range []bool{false, true} {
+		if graph {
+			git("commit-graph", "write", "--reachable")
+		}
+
+		r, err := PlainOpen(dir)
+		require.NoError(t, err)
+		for i, local := range commits {
+			for j, upstream := range commits {
+				ahead, behind, err := r.AheadBehind(local, upstream)
+				require.NoError(t, err)
+				assert.Equal(t, expected[[2]int{i, j}], fmt.Sprintf("%d\t%d", ahead, behind), "graph %t c%d...c%d", graph, i, j)
+			}
+		}
+	}
+}
+
+func (s *RepositorySuite) TestTrackingStatus() {
+	r, err := Clone(memory.NewStorage(), memfs.New(), &CloneOptions{
+		URL: s.GetBasicLocalRepositoryURL(),
+	})
+	s.NoError(err)
+
+	ahead, behind, err := r.TrackingStatus("master")
+	s.NoError(err)
+	s.Equal(0, ahead)
+	s.Equal(0, behind)
+
+	w, err := r.Worktree()
+	s.NoError(err)
+	_, err = w.Commit("foo", &CommitOptions{
+		Author:            defaultSignature(),
+		AllowEmptyCommits: true,
+	})
+	s.NoError(err)
+
+	// The upstream is moved back two commits.
+	err = r.Storer.SetReference(plumbing.NewHashReference(
+		plumbing.NewRemoteReferenceName("origin", "master"),
+		plumbing.NewHash("918c48b83bd081e863dbe1b80f8998f058cd8294"),
+	))
+	s.NoError(err)
+
+	ahead, behind, err = r.TrackingStatus("master")
+	s.NoError(err)
+	s.Equal(2, ahead)
+	s.Equal(0, behind)
+
+	err = r.Storer.SetReference(plumbing.NewHashReference(
+		plumbing.NewBranchReferenceName("foo"),
+		plumbing.NewHash("918c48b83bd081e863dbe1b80f8998f058cd8294"),
+	))
+	s.NoError(err)
+
+	_, _, err = r.TrackingStatus("foo")
+	s.ErrorIs(err, ErrNoUpstream)
+}
+
 func (s *RepositorySuite) TestBlob() {
 	r, _ := Init(memory.NewStorage())
 	err := r.clone(context.Background(), &CloneOptions{
@@ -2564,6 +3789,43 @@ func (s *RepositorySuite) TestTags() {
 	s.Equal(5, count)
 }
 
+func (s *RepositorySuite) TestForEachTag() {
+	url := s.GetLocalRepositoryURL(
+		fixtures.ByURL("https://github.com/git-fixtures/tags.git").One(),
+	)
+
+	r, _ := Init(memory.NewStorage())
+	err := r.clone(context.Background(), &CloneOptions{URL: url})
+	s.Require().NoError(err)
+
+	annotated := map[string]bool{}
+	err = r.ForEachTag(func(ref *plumbing.Reference, tag *object.Tag) error {
+		annotated[ref.Name().Short()] = tag != nil
+		if tag != nil {
+			s.Equal(ref.Hash(), tag.Hash)
+			s.Equal(ref.Name().Short(), tag.Name)
+		}
+
+		return nil
+	})
+	s.Require().NoError(err)
+	s.Equal(map[string]bool{
+		"annotated-tag":   true,
+		"blob-tag":        true,
+		"commit-tag":      true,
+		"lightweight-tag": false,
+		"tree-tag":        true,
+	}, annotated)
+
+	count := 0
+	err = r.ForEachTag(func(*plumbing.Reference, *object.Tag) error {
+		count++
+		return storer.ErrStop
+	})
+	s.NoError(err)
+	s.Equal(1, count)
+}
+
 func (s *RepositorySuite) TestCreateTagLightweight() {
 	url := s.GetLocalRepositoryURL(
 		fixtures.ByURL("https://github.com/git-fixtures/tags.git").One(),
@@ -3194,6 +4456,22 @@ func (s *RepositorySuite) TestResolveRevision() {
 		"branch~1":                   "918c48b83bd081e863dbe1b80f8998f058cd8294",
 		"v1.0.0~1":                   "918c48b83bd081e863dbe1b80f8998f058cd8294",
 		"master~1":                   "918c48b83bd081e863dbe1b80f8998f058cd8294",
+		"HEAD^{commit}":              "6ecf0ef2c2dffb796033e5a02219af86ec6584e5",
+		"HEAD^{tree}":                "a8d315b2b1c615d43042c3a62402b8a54288cf5c",
+		"HEAD~3^2^{tree}":            "c2d30fa8ef288618f65f6eed6e168e0d514886f4",
+		"v1.0.0^{}":                  "6ecf0ef2c2dffb796033e5a02219af86ec6584e5",
+		"v1.0.0^{tree}":              "a8d315b2b1c615d43042c3a62402b8a54288cf5c",
+		"HEAD:CHANGELOG":             "d3ff53e0564a9f87d8e84b6e28e5060e517008aa",
+		"HEAD:go":                    "a39771a7651f97faf5c72e08224d857fc35133db",
+		"HEAD~1:json/short.json":     "c8f1d8c61f9da76f4cb49fd86322b6e685dba956",
+		":/binary file":              "35e85108805c84807bc66a02d91535e1e24b38b9",
+		":/!-some":                   "6ecf0ef2c2dffb796033e5a02219af86ec6584e5",
+		"master...branch":            "918c48b83bd081e863dbe1b80f8998f058cd8294",
+		"branch...master":            "918c48b83bd081e863dbe1b80f8998f058cd8294",
+		"...branch":                  "918c48b83bd081e863dbe1b80f8998f058cd8294",
+		"HEAD~2^{/binary...}":        "35e85108805c84807bc66a02d91535e1e24b38b9",
+		":/binary...":                "35e85108805c84807bc66a02d91535e1e24b38b9",
+		"HEAD~2^{/binary...}...":     "35e85108805c84807bc66a02d91535e1e24b38b9",
 		"918c48b83bd081e863dbe1b80f8998f058cd8294": "918c48b83bd081e863dbe1b80f8998f058cd8294",
 		"918c48b": "918c48b83bd081e863dbe1b80f8998f058cd8294", // odd number of hex digits
 	}
@@ -3215,6 +4493,14 @@ func (s *RepositorySuite) TestResolveRevisionAnnotated() {
 	datas := map[string]string{
 		"refs/tags/annotated-tag":                  "f7b877701fbf855b44c0a9e86f3fdce2c298b07f",
 		"b742a2a9fa0afcfa9a6fad080980fbc26b007c69": "f7b877701fbf855b44c0a9e86f3fdce2c298b07f",
+		"annotated-tag^{}":                         "f7b877701fbf855b44c0a9e86f3fdce2c298b07f",
+		"annotated-tag^{tag}":                      "b742a2a9fa0afcfa9a6fad080980fbc26b007c69",
+		"annotated-tag^{object}":                   "b742a2a9fa0afcfa9a6fad080980fbc26b007c69",
+		"annotated-tag^{tree}":                     "70846e9a10ef7b41064b40f07713d5b8b9a8fc73",
+		"tree-tag^{}":                              "70846e9a10ef7b41064b40f07713d5b8b9a8fc73",
+		"tree-tag^{tree}":                          "70846e9a10ef7b41064b40f07713d5b8b9a8fc73",
+		"blob-tag^{blob}":                          "e69de29bb2d1d6434b8b29ae775ad8c2e48c5391",
+		"blob-tag^{}":                              "e69de29bb2d1d6434b8b29ae775ad8c2e48c5391",
 	}
 
 	for rev, hash := range datas {
@@ -3245,6 +4531,11 @@ func (s *RepositorySuite) TestResolveRevisionWithErrors() {
 		"efs/heads/master~": "reference not found",
 		"HEAD^3":            `Revision invalid : "3" found must be 0, 1 or 2 after "^"`,
 		"HEAD^{/whatever}":  `no commit message match regexp: "whatever"`,
+		"HEAD^{blob}":       "invalid object type: 6ecf0ef2c2dffb796033e5a02219af86ec6584e5 is a commit, not a blob",
+		"HEAD:foo":          "entry not found",
+		"HEAD@{1}":          "reflog not found: HEAD",
+		"@{-1}":             "reflog not found: HEAD",
+		"master...foo":      "reference not found",
 		"4e1243bd22c66e76c2ba9eddc1f91394e57f9f83": "reference not found",
 	}
 
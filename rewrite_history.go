@@ -0,0 +1,382 @@
+package git
+
+import (
+	"slices"
+
+	"github.com/go-git/go-git/v6/plumbing"
+	"github.com/go-git/go-git/v6/plumbing/object"
+	"github.com/go-git/go-git/v6/plumbing/storer"
+)
+
+// RewriteHistoryOptions describes how the history is rewritten by
+// RewriteHistory.
+type RewriteHistoryOptions struct {
+	// Refs are the references whose history is rewritten, and which are
+	// updated to the rewritten commits, all the references of the
+	// repository if empty. The symbolic references are resolved, and the
+	// references to annotated tags are updated to copies of the tags
+	// pointing to the rewritten commits. The references to other objects
+	// than commits and tags are left as is.
+	Refs []plumbing.ReferenceName
+	// Tree returns the hash of the rewritten tree of the given commit,
+	// given its tree, such as the one written by a TreeBuilder starting
+	// from it, which reuses the subtrees left unchanged. The trees are kept
+	// if nil.
+	Tree func(c *object.Commit, tree *object.Tree) (plumbing.Hash, error)
+	// Commit rewrites the given commit, a copy of the original one with the
+	// rewritten tree and parents, changing its author, committer or message.
+	// Its Hash is the one of the original commit. The commits are kept as
+	// they are, but their tree and parents, if nil.
+	Commit func(c *object.Commit) error
+	// PruneEmpty drops the commits made empty by the rewriting, whose tree
+	// is the one of their only parent, or empty for a root commit, as `git
+	// filter-repo` does: they are mapped to their parent, or to
+	// plumbing.ZeroHash for a root commit, the references to such a commit
+	// being deleted. The commits which were empty and the merges of several
+	// rewritten parents are kept.
+	PruneEmpty bool
+	// DryRun rewrites the history without writing the rewritten commits
+	// and tags, nor updating the references, to only get the mapping of the
+	// commits. The trees are written by Tree as usual.
+	DryRun bool
+}
+
+// RewriteHistory rewrites the history of the references of the repository,
+// as `git filter-repo` does, to strip a subdirectory to the root, remove a
+// file from all the commits, or rewrite the emails of their authors for
+// instance. The commits are rewritten parents first, by o.Tree and o.Commit,
+// their parents being the rewritten ones, and the references are then
+// updated atomically, see UpdateRefs. The mapping of the hashes of the
+// original commits to the ones of the rewritten commits is returned.
+//
+// The commits left unchanged keep their hash, and their signature. The
+// signatures of the rewritten commits and tags are dropped, since they no
+// longer match them. The worktree and the index are not updated.
+func (r *Repository) RewriteHistory(o *RewriteHistoryOptions) (map[plumbing.Hash]plumbing.Hash, error) {
+	if o == nil {
+		o = &RewriteHistoryOptions{}
+	}
+
+	refs, err := r.rewrittenRefs(o.Refs)
+	if err != nil {
+		return nil, err
+	}
+
+	w := &historyRewriter{
+		r:       r,
+		o:       o,
+		commits: make(map[plumbing.Hash]plumbing.Hash),
+		trees:   make(map[plumbing.Hash]plumbing.Hash),
+		empty:   make(map[plumbing.Hash]bool),
+	}
+
+	var updates []RefUpdate
+	for _, ref := range refs {
+		h, err := w.rewriteObject(ref.Hash())
+		if err != nil {
+			return nil, err
+		}
+
+		if h != ref.Hash() {
+			updates = append(updates, RefUpdate{Name: ref.Name(), OldHash: ref.Hash(), NewHash: h})
+		}
+	}
+
+	if o.DryRun || len(updates) == 0 {
+		return w.commits, nil
+	}
+
+	if err := r.UpdateRefs(updates); err != nil {
+		return nil, err
+	}
+
+	return w.commits, nil
+}
+
+// rewrittenRefs returns the references of the given names, resolved, or all
+// the references of the repository which are not symbolic if none.
+func (r *Repository) rewrittenRefs(names []plumbing.ReferenceName) ([]*plumbing.Reference, error) {
+	var refs []*plumbing.Reference
+	seen := make(map[plumbing.ReferenceName]bool)
+	add := func(ref *plumbing.Reference) {
+		if !seen[ref.Name()] {
+			seen[ref.Name()] = true
+			refs = append(refs, ref)
+		}
+	}
+
+	if len(names) == 0 {
+		iter, err := r.Storer.IterReferences()
+		if err != nil {
+			return nil, err
+		}
+
+		err = iter.ForEach(func(ref *plumbing.Reference) error {
+			if ref.Type() == plumbing.HashReference {
+				add(ref)
+			}
+
+			return nil
+		})
+
+		return refs, err
+	}
+
+	for _, name := range names {
+		ref, err := storer.ResolveReference(r.Storer, name)
+		if err != nil {
+			return nil, err
+		}
+
+		add(ref)
+	}
+
+	return refs, nil
+}
+
+// historyRewriter rewrites the commits of RewriteHistory.
+type historyRewriter struct {
+	r *Repository
+	o *RewriteHistoryOptions
+	// commits maps the original commits to the rewritten ones.
+	commits map[plumbing.Hash]plumbing.Hash
+	// trees are the trees of the rewritten commits.
+	trees map[plumbing.Hash]plumbing.Hash
+	// empty are the trees known to be empty or not.
+	empty map[plumbing.Hash]bool
+}
+
+// rewriteObject returns the hash of the rewritten object h, a commit or a
+// tag, the other objects being left as is.
+func (w *historyRewriter) rewriteObject(h plumbing.Hash) (plumbing.Hash, error) {
+	obj, err := w.r.Storer.EncodedObject(plumbing.AnyObject, h)
+	if err != nil {
+		return plumbing.ZeroHash, err
+	}
+
+	switch obj.Type() {
+	case plumbing.CommitObject:
+		return w.rewriteHistory(h)
+	case plumbing.TagObject:
+		return w.rewriteTag(h)
+	default:
+		return h, nil
+	}
+}
+
+// rewriteTag returns the hash of a copy of the tag h pointing to its
+// rewritten target, or of the tag itself if its target is unchanged, or
+// plumbing.ZeroHash if its target is pruned.
+func (w *historyRewriter) rewriteTag(h plumbing.Hash) (plumbing.Hash, error) {
+	t, err := w.r.TagObject(h)
+	if err != nil {
+		return plumbing.ZeroHash, err
+	}
+
+	target, err := w.rewriteObject(t.Target)
+	if err != nil || target.IsZero() {
+		return target, err
+	}
+
+	if target == t.Target {
+		return h, nil
+	}
+
+	nt := *t
+	nt.Target = target
+	nt.PGPSignature = ""
+	return w.store(&nt)
+}
+
+// rewriteHistory rewrites the commit h and its history, its parents being
+// rewritten before it, and returns the hash of the rewritten commit.
+func (w *historyRewriter) rewriteHistory(h plumbing.Hash) (plumbing.Hash, error) {
+	if nh, ok := w.commits[h]; ok {
+		return nh, nil
+	}
+
+	c, err := w.r.CommitObject(h)
+	if err != nil {
+		return plumbing.ZeroHash, err
+	}
+
+	// A commit is pushed again once its parents are rewritten, the commits
+	// pushed several times being rewritten once.
+	pending := []*object.Commit{c}
+	for len(pending) > 0 {
+		c := pending[len(pending)-1]
+		if _, ok := w.commits[c.Hash]; ok {
+			pending = pending[:len(pending)-1]
+			continue
+		}
+
+		var parents []*object.Commit
+		for _, p := range c.ParentHashes {
+			if _, ok := w.commits[p]; ok {
+				continue
+			}
+
+			pc, err := w.r.CommitObject(p)
+			if err != nil {
+				return plumbing.ZeroHash, err
+			}
+
+			parents = append(parents, pc)
+		}
+
+		if len(parents) > 0 {
+			pending = append(pending, parents...)
+			continue
+		}
+
+		pending = pending[:len(pending)-1]
+		if err := w.rewriteCommit(c); err != nil {
+			return plumbing.ZeroHash, err
+		}
+	}
+
+	return w.commits[h], nil
+}
+
+// rewriteCommit rewrites the commit c, whose parents are rewritten.
+func (w *historyRewriter) rewriteCommit(c *object.Commit) error {
+	tree := c.TreeHash
+	if w.o.Tree != nil {
+		t, err := c.Tree()
+		if err != nil {
+			return err
+		}
+
+		if tree, err = w.o.Tree(c, t); err != nil {
+			return err
+		}
+	}
+
+	var parents []plumbing.Hash
+	for _, p := range c.ParentHashes {
+		if np := w.commits[p]; !np.IsZero() && !slices.Contains(parents, np) {
+			parents = append(parents, np)
+		}
+	}
+
+	if w.o.PruneEmpty && len(parents) <= 1 {
+		pruned, err := w.madeEmpty(c, tree, parents)
+		if err != nil {
+			return err
+		}
+
+		if pruned {
+			w.commits[c.Hash] = plumbing.ZeroHash
+			if len(parents) == 1 {
+				w.commits[c.Hash] = parents[0]
+			}
+
+			return nil
+		}
+	}
+
+	nc := *c
+	nc.TreeHash = tree
+	nc.ParentHashes = parents
+	nc.ExtraHeaders = slices.Clone(c.ExtraHeaders)
+	if w.o.Commit != nil {
+		if err := w.o.Commit(&nc); err != nil {
+			return err
+		}
+	}
+
+	h, err := w.rewrittenCommit(c, &nc)
+	if err != nil {
+		return err
+	}
+
+	w.commits[c.Hash] = h
+	w.trees[h] = nc.TreeHash
+	return nil
+}
+
+// madeEmpty returns whether the commit c, whose rewritten tree and parents
+// are given, is made empty by the rewriting.
+func (w *historyRewriter) madeEmpty(c *object.Commit, tree plumbing.Hash, parents []plumbing.Hash) (bool, error) {
+	if len(parents) == 1 {
+		if tree != w.trees[parents[0]] {
+			return false, nil
+		}
+	} else {
+		empty, err := w.emptyTree(tree)
+		if !empty || err != nil {
+			return false, err
+		}
+	}
+
+	// The commits which were empty are kept.
+	switch len(c.ParentHashes) {
+	case 0:
+		empty, err := w.emptyTree(c.TreeHash)
+		return !empty, err
+	case 1:
+		p, err := w.r.CommitObject(c.ParentHashes[0])
+		if err != nil {
+			return false, err
+		}
+
+		return p.TreeHash != c.TreeHash, nil
+	default:
+		return true, nil
+	}
+}
+
+func (w *historyRewriter) emptyTree(h plumbing.Hash) (bool, error) {
+	if empty, ok := w.empty[h]; ok {
+		return empty, nil
+	}
+
+	t, err := object.GetTree(w.r.Storer, h)
+	if err != nil {
+		return false, err
+	}
+
+	w.empty[h] = len(t.Entries) == 0
+	return w.empty[h], nil
+}
+
+// rewrittenCommit returns the hash of the rewritten commit nc, the one of
+// the original commit c if they are the same.
+func (w *historyRewriter) rewrittenCommit(c, nc *object.Commit) (plumbing.Hash, error) {
+	same, err := sameCommits(w.r.Storer, c, nc)
+	if err != nil || same {
+		return c.Hash, err
+	}
+
+	nc.PGPSignature = ""
+	return w.store(nc)
+}
+
+// sameCommits returns whether the commits are the same but their signature.
+func sameCommits(s storer.EncodedObjectStorer, a, b *object.Commit) (bool, error) {
+	oa, ob := s.NewEncodedObject(), s.NewEncodedObject()
+	if err := a.EncodeWithoutSignature(oa); err != nil {
+		return false, err
+	}
+
+	if err := b.EncodeWithoutSignature(ob); err != nil {
+		return false, err
+	}
+
+	return oa.Hash() == ob.Hash(), nil
+}
+
+// store encodes the object, and writes it unless the history is only
+// rewritten to get the mapping of the commits.
+func (w *historyRewriter) store(obj object.Object) (plumbing.Hash, error) {
+	o := w.r.Storer.NewEncodedObject()
+	if err := obj.Encode(o); err != nil {
+		return plumbing.ZeroHash, err
+	}
+
+	if w.o.DryRun {
+		return o.Hash(), nil
+	}
+
+	return w.r.Storer.SetEncodedObject(o)
+}
@@ -0,0 +1,293 @@
+package git
+
+import (
+	"errors"
+	"os/exec"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-git/go-billy/v6"
+	"github.com/go-git/go-billy/v6/memfs"
+	"github.com/go-git/go-billy/v6/util"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/go-git/go-git/v6/plumbing"
+	"github.com/go-git/go-git/v6/plumbing/object"
+	"github.com/go-git/go-git/v6/storage/memory"
+)
+
+// newRewriteRepository commits files on master and on a feature branch
+// merged into it, and returns the commits by message.
+func newRewriteRepository(t *testing.T, r *Repository, fs billy.Filesystem) map[string]plumbing.Hash {
+	t.Helper()
+
+	w, err := r.Worktree()
+	require.NoError(t, err)
+
+	commits := make(map[string]plumbing.Hash)
+	when := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	commit := func(msg string, files map[string]string, parents ...string) {
+		for name, content := range files {
+			require.NoError(t, util.WriteFile(fs, name, []byte(content), 0o644))
+			_, err := w.Add(name)
+			require.NoError(t, err)
+		}
+
+		when = when.Add(time.Hour)
+		opts := &CommitOptions{Author: &object.Signature{Name: "foo", Email: "foo@foo.foo", When: when}}
+		if len(parents) > 0 {
+			head, err := r.Head()
+			require.NoError(t, err)
+			opts.Parents = []plumbing.Hash{head.Hash()}
+			for _, p := range parents {
+				opts.Parents = append(opts.Parents, commits[p])
+			}
+		}
+
+		h, err := w.Commit(msg+"\n", opts)
+		require.NoError(t, err)
+		commits[msg] = h
+	}
+
+	commit("c1", map[string]string{"a": "a\n", "dir/b": "b\n", "secret": "1\n"})
+	commit("c2", map[string]string{"a": "a2\n"})
+	require.NoError(t, w.Checkout(&CheckoutOptions{Branch: "refs/heads/feature", Create: true}))
+	commit("f1", map[string]string{"sub/y": "y\n"})
+	require.NoError(t, w.Checkout(&CheckoutOptions{Branch: plumbing.Master}))
+	commit("c3", map[string]string{"secret": "2\n"})
+	commit("c4", map[string]string{"sub/x": "x\n"})
+	commit("merge", map[string]string{"sub/y": "y\n"}, "f1")
+	commit("c5", map[string]string{"secret": "3\n", "a": "a3\n"})
+
+	return commits
+}
+
+// removeFile returns a RewriteHistoryOptions.Tree removing the file from the
+// trees.
+func removeFile(r *Repository, path string) func(*object.Commit, *object.Tree) (plumbing.Hash, error) {
+	return func(_ *object.Commit, tree *object.Tree) (plumbing.Hash, error) {
+		b := NewTreeBuilder(r.Storer, tree)
+		if err := b.Remove(path); err != nil && !errors.Is(err, object.ErrEntryNotFound) {
+			return plumbing.ZeroHash, err
+		}
+
+		return b.Write()
+	}
+}
+
+// history returns the messages of the commits reachable from h, by their
+// parents, which are first parents first.
+func history(t *testing.T, r *Repository, h plumbing.Hash) []string {
+	t.Helper()
+
+	c, err := r.CommitObject(h)
+	require.NoError(t, err)
+	iter := object.NewCommitPreorderIter(c, nil, nil)
+	var messages []string
+	require.NoError(t, iter.ForEach(func(c *object.Commit) error {
+		messages = append(messages, strings.TrimSpace(c.Message))
+		return nil
+	}))
+
+	return messages
+}
+
+func TestRewriteHistoryRemoveFile(t *testing.T) {
+	t.Parallel()
+
+	fs := memfs.New()
+	r, err := Init(memory.NewStorage(), WithWorkTree(fs))
+	require.NoError(t, err)
+	commits := newRewriteRepository(t, r, fs)
+
+	mapping, err := r.RewriteHistory(&RewriteHistoryOptions{Tree: removeFile(r, "secret"), PruneEmpty: true})
+	require.NoError(t, err)
+	assert.Len(t, mapping, len(commits))
+
+	master := mustReference(t, r, plumbing.Master)
+	assert.Equal(t, mapping[commits["c5"]], master)
+	assert.Equal(t, []string{"c5", "merge", "c4", "c2", "c1", "f1"}, history(t, r, master))
+
+	// c3, which only changed the file, is pruned, mapped to its parent.
+	assert.Equal(t, mapping[commits["c2"]], mapping[commits["c3"]])
+	c4, err := r.CommitObject(mapping[commits["c4"]])
+	require.NoError(t, err)
+	assert.Equal(t, []plumbing.Hash{mapping[commits["c2"]]}, c4.ParentHashes)
+
+	iter, err := r.Log(&LogOptions{From: master})
+	require.NoError(t, err)
+	require.NoError(t, iter.ForEach(func(c *object.Commit) error {
+		_, err := c.File("secret")
+		assert.ErrorIs(t, err, object.ErrFileNotFound, c.Message)
+
+		// The subtrees are reused.
+		original, err := r.CommitObject(commits[strings.TrimSpace(c.Message)])
+		require.NoError(t, err)
+		ot, err := original.Tree()
+		require.NoError(t, err)
+		nt, err := c.Tree()
+		require.NoError(t, err)
+		oe, err := ot.FindEntry("dir")
+		require.NoError(t, err)
+		ne, err := nt.FindEntry("dir")
+		require.NoError(t, err)
+		assert.Equal(t, oe.Hash, ne.Hash)
+		return nil
+	}))
+
+	// The feature branch is rewritten too.
+	assert.Equal(t, mapping[commits["f1"]], mustReference(t, r, "refs/heads/feature"))
+	assert.NotEqual(t, commits["f1"], mapping[commits["f1"]])
+}
+
+func TestRewriteHistorySubdirectory(t *testing.T) {
+	t.Parallel()
+
+	fs := memfs.New()
+	r, err := Init(memory.NewStorage(), WithWorkTree(fs))
+	require.NoError(t, err)
+	commits := newRewriteRepository(t, r, fs)
+
+	// sub becomes the root, the commits not changing it being pruned.
+	mapping, err := r.RewriteHistory(&RewriteHistoryOptions{
+		Refs: []plumbing.ReferenceName{plumbing.HEAD},
+		Tree: func(_ *object.Commit, tree *object.Tree) (plumbing.Hash, error) {
+			sub, err := tree.Tree("sub")
+			if errors.Is(err, object.ErrDirectoryNotFound) {
+				return NewTreeBuilder(r.Storer, nil).Write()
+			}
+			if err != nil {
+				return plumbing.ZeroHash, err
+			}
+
+			return sub.Hash, nil
+		},
+		PruneEmpty: true,
+	})
+	require.NoError(t, err)
+
+	for _, name := range []string{"c1", "c2", "c3"} {
+		assert.True(t, mapping[commits[name]].IsZero(), name)
+	}
+
+	master := mustReference(t, r, plumbing.Master)
+	assert.Equal(t, []string{"merge", "c4", "f1"}, history(t, r, master))
+	c, err := r.CommitObject(master)
+	require.NoError(t, err)
+	tree, err := c.Tree()
+	require.NoError(t, err)
+	var names []string
+	for _, e := range tree.Entries {
+		names = append(names, e.Name)
+	}
+	assert.Equal(t, []string{"x", "y"}, names)
+
+	// Only the given references are updated.
+	assert.Equal(t, commits["f1"], mustReference(t, r, "refs/heads/feature"))
+}
+
+func TestRewriteHistoryCommits(t *testing.T) {
+	t.Parallel()
+
+	r, err := Init(memory.NewStorage(), WithWorkTree(memfs.New()))
+	require.NoError(t, err)
+	commits := newDescribeRepository(t, r)
+
+	rewrite := func(c *object.Commit) error {
+		if c.Message == "c2" || c.Message == "s2" {
+			c.Author.Email = "bar@bar.bar"
+			c.Committer.Email = "bar@bar.bar"
+		}
+
+		return nil
+	}
+
+	// The dry run gives the mapping, the references being left as is.
+	dry, err := r.RewriteHistory(&RewriteHistoryOptions{Commit: rewrite, DryRun: true})
+	require.NoError(t, err)
+	assert.Equal(t, commits["c5"], mustReference(t, r, plumbing.Master))
+	_, err = r.CommitObject(dry[commits["c5"]])
+	assert.ErrorIs(t, err, plumbing.ErrObjectNotFound)
+
+	mapping, err := r.RewriteHistory(&RewriteHistoryOptions{Commit: rewrite})
+	require.NoError(t, err)
+	assert.Equal(t, dry, mapping)
+	assert.Equal(t, mapping[commits["c5"]], mustReference(t, r, plumbing.Master))
+
+	// The commits are rewritten from the first one changed.
+	for name, h := range commits {
+		c, err := r.CommitObject(mapping[h])
+		require.NoError(t, err)
+		original, err := r.CommitObject(h)
+		require.NoError(t, err)
+		assert.Equal(t, name == "c1", h == mapping[h], name)
+
+		var parents []plumbing.Hash
+		for _, p := range original.ParentHashes {
+			parents = append(parents, mapping[p])
+		}
+		assert.Equal(t, parents, c.ParentHashes, name)
+		assert.Equal(t, original.Message, c.Message, name)
+	}
+
+	// The tags are rewritten, but the ones of the commits left unchanged.
+	assert.Equal(t, mapping[commits["c3"]], mustReference(t, r, "refs/tags/light"))
+	v1, err := r.Reference("refs/tags/v1", false)
+	require.NoError(t, err)
+	tag, err := r.TagObject(v1.Hash())
+	require.NoError(t, err)
+	assert.Equal(t, commits["c1"], tag.Target)
+
+	side, err := r.Reference("refs/tags/side-new", false)
+	require.NoError(t, err)
+	tag, err = r.TagObject(side.Hash())
+	require.NoError(t, err)
+	assert.Equal(t, mapping[commits["s1"]], tag.Target)
+	assert.Equal(t, "side-new", tag.Name)
+
+	// Nothing is rewritten once rewritten.
+	again, err := r.RewriteHistory(&RewriteHistoryOptions{Commit: rewrite})
+	require.NoError(t, err, "%+v", err)
+	for h, nh := range again {
+		assert.Equal(t, h, nh)
+	}
+}
+
+func TestRewriteHistoryGit(t *testing.T) {
+	t.Parallel()
+
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not found")
+	}
+
+	dir := t.TempDir()
+	r, err := PlainInit(dir, false)
+	require.NoError(t, err)
+	w, err := r.Worktree()
+	require.NoError(t, err)
+	newRewriteRepository(t, r, w.Filesystem)
+
+	git := func(args ...string) string {
+		cmd := exec.Command("git", args...)
+		cmd.Dir = dir
+		cmd.Env = append(cmd.Environ(), "FILTER_BRANCH_SQUELCH_WARNING=1")
+		out, err := cmd.CombinedOutput()
+		require.NoError(t, err, string(out))
+		return strings.TrimSpace(string(out))
+	}
+
+	mapping, err := r.RewriteHistory(&RewriteHistoryOptions{
+		Refs:       []plumbing.ReferenceName{plumbing.Master},
+		Tree:       removeFile(r, "secret"),
+		PruneEmpty: true,
+		DryRun:     true,
+	})
+	require.NoError(t, err)
+
+	// The commits are the ones of git filter-branch.
+	master := mustReference(t, r, plumbing.Master)
+	git("filter-branch", "-f", "--prune-empty", "--index-filter", "git rm -q --cached --ignore-unmatch secret", "master")
+	assert.Equal(t, git("rev-parse", "master"), mapping[master].String())
+}
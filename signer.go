@@ -1,9 +1,13 @@
 package git
 
 import (
+	"crypto/rand"
 	"io"
 
+	"golang.org/x/crypto/ssh"
+
 	"github.com/go-git/go-git/v6/plumbing"
+	"github.com/go-git/go-git/v6/plumbing/format/sshsig"
 )
 
 // signableObject is an object which can be signed.
@@ -31,3 +35,18 @@ func signObject(signer Signer, obj signableObject) ([]byte, error) {
 
 	return signer.Sign(r)
 }
+
+// NewSSHSigner returns a Signer signing the objects with the given SSH key,
+// as git when gpg.format is ssh. The signatures are verified with
+// object.Commit.VerifySSH and object.Tag.VerifySSH.
+func NewSSHSigner(s ssh.Signer) Signer {
+	return &sshSigner{s: s}
+}
+
+type sshSigner struct {
+	s ssh.Signer
+}
+
+func (s *sshSigner) Sign(message io.Reader) ([]byte, error) {
+	return sshsig.Sign(rand.Reader, s.s, message, sshsig.GitNamespace)
+}
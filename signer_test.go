@@ -1,13 +1,24 @@
 package git
 
 import (
+	"crypto/ed25519"
+	"crypto/rand"
 	"encoding/base64"
 	"fmt"
 	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
 	"time"
 
 	"github.com/go-git/go-billy/v6/memfs"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/ssh"
 
+	"github.com/go-git/go-git/v6/plumbing/format/sshsig"
 	"github.com/go-git/go-git/v6/plumbing/object"
 	"github.com/go-git/go-git/v6/storage/memory"
 )
@@ -55,3 +66,69 @@ func ExampleSigner() {
 	fmt.Println(obj.PGPSignature)
 	// Output: dHJlZSA0YjgyNWRjNjQyY2I2ZWI5YTA2MGU1NGJmOGQ2OTI4OGZiZWU0OTA0CmF1dGhvciBKb2huIERvZSA8am9obkBleGFtcGxlLmNvbT4gMTIzNCArMDAwMApjb21taXR0ZXIgSm9obiBEb2UgPGpvaG5AZXhhbXBsZS5jb20+IDEyMzQgKzAwMDAKCmV4YW1wbGUgY29tbWl0
 }
+
+func TestSSHSigner(t *testing.T) {
+	t.Parallel()
+
+	_, key, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	signer, err := ssh.NewSignerFromKey(key)
+	require.NoError(t, err)
+
+	dir := t.TempDir()
+	r, err := PlainInit(dir, false)
+	require.NoError(t, err)
+	w, err := r.Worktree()
+	require.NoError(t, err)
+
+	sig := &object.Signature{Name: "foo", Email: "foo@example.com", When: time.Now()}
+	h, err := w.Commit("signed\n", &CommitOptions{Author: sig, Signer: NewSSHSigner(signer), AllowEmptyCommits: true})
+	require.NoError(t, err)
+	_, err = r.CreateTag("v1", h, &CreateTagOptions{
+		Tagger:  sig,
+		Message: "signed\n\nSigned-off-by: foo <foo@example.com>",
+		Signer:  NewSSHSigner(signer),
+	})
+	require.NoError(t, err)
+
+	allowed := "foo@example.com " + string(ssh.MarshalAuthorizedKey(signer.PublicKey()))
+	signers, err := sshsig.ParseAllowedSigners(strings.NewReader(allowed))
+	require.NoError(t, err)
+
+	commit, err := r.CommitObject(h)
+	require.NoError(t, err)
+	assert.True(t, strings.HasPrefix(commit.PGPSignature, "-----BEGIN SSH SIGNATURE-----\n"))
+	v, err := commit.VerifySSH(signers)
+	require.NoError(t, err)
+	assert.True(t, v.Trusted())
+	assert.Equal(t, "foo@example.com", v.Principal)
+
+	ref, err := r.Tag("v1")
+	require.NoError(t, err)
+	tag, err := r.TagObject(ref.Hash())
+	require.NoError(t, err)
+	assert.Equal(t, "signed\n\nSigned-off-by: foo <foo@example.com>\n", tag.Message)
+	v, err = tag.VerifySSH(signers)
+	require.NoError(t, err)
+	assert.True(t, v.Trusted())
+
+	// A signature over a modified object is invalid.
+	commit.Message = "modified\n"
+	_, err = commit.VerifySSH(signers)
+	assert.ErrorIs(t, err, sshsig.ErrInvalidSignature)
+
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git is not available")
+	}
+
+	// The signatures are verified by git.
+	path := filepath.Join(t.TempDir(), "allowed_signers")
+	require.NoError(t, os.WriteFile(path, []byte(allowed), 0o644))
+	for _, args := range [][]string{{"verify-commit", "HEAD"}, {"verify-tag", "v1"}} {
+		cmd := exec.Command("git", append([]string{"-c", "gpg.format=ssh", "-c", "gpg.ssh.allowedSignersFile=" + path}, args...)...)
+		cmd.Dir = dir
+		out, err := cmd.CombinedOutput()
+		require.NoError(t, err, string(out))
+		assert.Contains(t, string(out), `Good "git" signature for foo@example.com`)
+	}
+}
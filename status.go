@@ -4,6 +4,7 @@ import (
 	"bytes"
 	"fmt"
 	"path/filepath"
+	"sort"
 
 	mindex "github.com/go-git/go-git/v6/utils/merkletrie/index"
 	"github.com/go-git/go-git/v6/utils/merkletrie/noder"
@@ -40,18 +41,35 @@ func (s Status) IsClean() bool {
 	return true
 }
 
+// String returns the status of the files changed, sorted by path, in the
+// short format of git status, without grouping the untracked files by
+// directory, see Worktree.WriteStatus.
 func (s Status) String() string {
+	paths := make([]string, 0, len(s))
+	for path := range s {
+		paths = append(paths, path)
+	}
+
+	sort.Strings(paths)
+
 	buf := bytes.NewBuffer(nil)
-	for path, status := range s {
+	for _, path := range paths {
+		status := s[path]
 		if status.Staging == Unmodified && status.Worktree == Unmodified {
 			continue
 		}
 
-		if status.Staging == Renamed {
-			path = fmt.Sprintf("%s -> %s", path, status.Extra)
+		name := quoteStatusPath(path, true)
+		switch {
+		case status.Staging == Renamed:
+			name = fmt.Sprintf("%s -> %s", quoteStatusPath(status.Extra, true), name)
+		case status.Staging == Deleted && status.Worktree == Untracked:
+			// The file deleted from the index is untracked too.
+			fmt.Fprintf(buf, "%c%c %s\n", Deleted, Unmodified, name)
+			status = &FileStatus{Staging: Untracked, Worktree: Untracked}
 		}
 
-		fmt.Fprintf(buf, "%c%c %s\n", status.Staging, status.Worktree, path)
+		fmt.Fprintf(buf, "%c%c %s\n", status.Staging, status.Worktree, name)
 	}
 
 	return buf.String()
@@ -65,6 +83,17 @@ type FileStatus struct {
 	Worktree StatusCode
 	// Extra contains extra information, such as the previous name in a rename
 	Extra string
+	// Similarity is the percentage of the content of a renamed file which is
+	// the one of its previous name.
+	Similarity int
+}
+
+// unmerged returns whether the file is unmerged, its status being one of the
+// pairs of codes of the conflicts: DD, AU, UD, UA, DU, AA or UU.
+func (fs *FileStatus) unmerged() bool {
+	return fs.Staging == UpdatedButUnmerged || fs.Worktree == UpdatedButUnmerged ||
+		fs.Staging == Added && fs.Worktree == Added ||
+		fs.Staging == Deleted && fs.Worktree == Deleted
 }
 
 // StatusCode status code of a file in the Worktree
@@ -79,6 +108,7 @@ const (
 	Renamed            StatusCode = 'R'
 	Copied             StatusCode = 'C'
 	UpdatedButUnmerged StatusCode = 'U'
+	Ignored            StatusCode = '!'
 )
 
 // StatusStrategy defines the different types of strategies when processing
@@ -4,6 +4,7 @@ package dotgit
 import (
 	"bufio"
 	"bytes"
+	"compress/zlib"
 	"errors"
 	"fmt"
 	"io"
@@ -20,6 +21,10 @@ import (
 	"github.com/go-git/go-billy/v6/helper/chroot"
 
 	"github.com/go-git/go-git/v6/plumbing"
+	formatcfg "github.com/go-git/go-git/v6/plumbing/format/config"
+	"github.com/go-git/go-git/v6/plumbing/format/objfile"
+	"github.com/go-git/go-git/v6/plumbing/format/packfile"
+	"github.com/go-git/go-git/v6/plumbing/storer"
 	"github.com/go-git/go-git/v6/storage"
 	"github.com/go-git/go-git/v6/utils/ioutil"
 )
@@ -29,6 +34,7 @@ const (
 	configPath     = "config"
 	indexPath      = "index"
 	shallowPath    = "shallow"
+	graftsPath     = "grafts"
 	modulePath     = "modules"
 	objectsPath    = "objects"
 	packPath       = "pack"
@@ -43,6 +49,11 @@ const (
 
 	tmpPackedRefsPrefix = "._packed-refs"
 
+	// The headers of the packed-refs files written by PackPeeledRefs, the
+	// ones of git, trailing space included.
+	packedRefsSortedHeader = "# pack-refs with: sorted \n"
+	packedRefsPeeledHeader = "# pack-refs with: peeled fully-peeled sorted \n"
+
 	packPrefix = "pack-"
 	packExt    = ".pack"
 )
@@ -86,6 +97,18 @@ type Options struct {
 	// If none is provided, it falls back to using the underlying instance used for
 	// DotGit.
 	AlternatesFS billy.Filesystem
+	// LooseCompressionLevel is the zlib compression level of the new loose
+	// objects, such as zlib.BestSpeed or zlib.BestCompression. If left unset
+	// or set to 0, zlib.NoCompression included, the default compression level
+	// is used.
+	LooseCompressionLevel int
+	// LooseCompression is the compression of the new loose objects. The
+	// zstd-compressed ones cannot be read by git. LooseCompressionLevel only
+	// applies to the zlib compression.
+	LooseCompression objfile.Compression
+	// ObjectFormat is the object format of the repository, the hash
+	// algorithm naming the new loose objects.
+	ObjectFormat formatcfg.ObjectFormat
 }
 
 // The DotGit type represents a local git repository on disk. This
@@ -210,11 +233,36 @@ func (d *DotGit) Shallow() (billy.File, error) {
 	return f, nil
 }
 
+// Grafts returns a file pointer for read to the info/grafts file, nil if it
+// doesn't exist.
+func (d *DotGit) Grafts() (billy.File, error) {
+	f, err := d.fs.Open(d.fs.Join(infoPath, graftsPath))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+
+		return nil, err
+	}
+
+	return f, nil
+}
+
 // NewObjectPack return a writer for a new packfile, it saves the packfile to
 // disk and also generates and save the index for the given packfile.
 func (d *DotGit) NewObjectPack() (*PackWriter, error) {
+	return d.NewThinObjectPack(nil)
+}
+
+// NewThinObjectPack is like NewObjectPack, but the packfile may be a thin
+// pack, whose deltas are based on objects missing from it, which are read
+// from bases and appended to the packfile once it is written. The options
+// are added to the ones of the parser of the packfile, as
+// packfile.WithProgress.
+func (d *DotGit) NewThinObjectPack(bases storer.EncodedObjectStorer, opts ...packfile.ParserOption) (*PackWriter, error) {
 	d.cleanPackList()
-	return newPackWrite(d.fs)
+	opts = append([]packfile.ParserOption{packfile.WithObjectFormat(d.options.ObjectFormat)}, opts...)
+	return newPackWrite(d.fs, bases, opts...)
 }
 
 // ObjectPacks returns the list of availables packfiles
@@ -308,6 +356,27 @@ func (d *DotGit) ObjectPack(hash plumbing.Hash) (billy.File, error) {
 	return d.objectPackOpen(hash, `pack`)
 }
 
+// ObjectPackStat returns a os.FileInfo of the given packfile.
+func (d *DotGit) ObjectPackStat(hash plumbing.Hash) (os.FileInfo, error) {
+	err := d.hasPack(hash)
+	if err != nil {
+		return nil, err
+	}
+
+	return d.fs.Stat(d.objectPackPath(hash, `pack`))
+}
+
+// ObjectPackIdxStat returns a os.FileInfo of the index file of the given
+// packfile.
+func (d *DotGit) ObjectPackIdxStat(hash plumbing.Hash) (os.FileInfo, error) {
+	err := d.hasPack(hash)
+	if err != nil {
+		return nil, err
+	}
+
+	return d.fs.Stat(d.objectPackPath(hash, `idx`))
+}
+
 // ObjectPackIdx returns a fs.File of the index file for a given packfile.
 func (d *DotGit) ObjectPackIdx(hash plumbing.Hash) (billy.File, error) {
 	err := d.hasPack(hash)
@@ -328,6 +397,17 @@ func (d *DotGit) ObjectPackRev(hash plumbing.Hash) (billy.File, error) {
 	return d.objectPackOpen(hash, `rev`)
 }
 
+// ObjectPackBitmap returns a fs.File of the bitmap index file for a given
+// packfile.
+func (d *DotGit) ObjectPackBitmap(hash plumbing.Hash) (billy.File, error) {
+	err := d.hasPack(hash)
+	if err != nil {
+		return nil, err
+	}
+
+	return d.objectPackOpen(hash, `bitmap`)
+}
+
 func (d *DotGit) DeleteOldObjectPackAndIndex(hash plumbing.Hash, t time.Time) error {
 	d.cleanPackList()
 
@@ -346,6 +426,15 @@ func (d *DotGit) DeleteOldObjectPackAndIndex(hash plumbing.Hash, t time.Time) er
 	if err != nil {
 		return err
 	}
+
+	// The reverse index and the bitmap of the packfile are optional.
+	for _, ext := range []string{`rev`, `bitmap`} {
+		err = d.fs.Remove(d.objectPackPath(hash, ext))
+		if err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+
 	return d.fs.Remove(d.objectPackPath(hash, `idx`))
 }
 
@@ -353,7 +442,25 @@ func (d *DotGit) DeleteOldObjectPackAndIndex(hash plumbing.Hash, t time.Time) er
 func (d *DotGit) NewObject() (*ObjectWriter, error) {
 	d.cleanObjectList()
 
-	return newObjectWriter(d.fs)
+	level := d.options.LooseCompressionLevel
+	if level == 0 {
+		level = zlib.DefaultCompression
+	}
+
+	return newObjectWriter(d.fs, d.options.LooseCompression, level, d.options.ObjectFormat)
+}
+
+// NewObjectTempFile returns a new temporary file in the objects directory,
+// such as the one holding the content of an object being written, which the
+// caller must remove.
+func (d *DotGit) NewObjectTempFile() (billy.File, error) {
+	return d.fs.TempFile(d.fs.Join(objectsPath, packPath), "tmp_obj_")
+}
+
+// SetObjectFormat sets the object format of the repository, naming the new
+// loose objects and packfiles.
+func (d *DotGit) SetObjectFormat(f formatcfg.ObjectFormat) {
+	d.options.ObjectFormat = f
 }
 
 // ObjectsWithPrefix returns the hashes of objects that have the given prefix.
@@ -483,6 +590,63 @@ func (d *DotGit) forEachObjectHash(fun func(plumbing.Hash) error) error {
 	return nil
 }
 
+// LooseObjects returns whether each of the given objects is a loose object,
+// by hash, reading once the directory of each of their prefixes, in objects
+// and in the incoming directory, if any, rather than looking each of them up.
+func (d *DotGit) LooseObjects(hashes []plumbing.Hash) (map[plumbing.Hash]bool, error) {
+	found := make(map[plumbing.Hash]bool, len(hashes))
+	if d.options.ExclusiveAccess {
+		if err := d.genObjectList(); err != nil {
+			return nil, err
+		}
+
+		for _, h := range hashes {
+			_, found[h] = d.objectMap[h]
+		}
+
+		return found, nil
+	}
+
+	byPrefix := make(map[string]map[string]plumbing.Hash)
+	for _, h := range hashes {
+		found[h] = false
+		hex := h.String()
+		names, ok := byPrefix[hex[:2]]
+		if !ok {
+			names = make(map[string]plumbing.Hash)
+			byPrefix[hex[:2]] = names
+		}
+
+		names[hex[2:]] = h
+	}
+
+	dirs := []string{objectsPath}
+	if d.hasIncomingObjects() {
+		dirs = append(dirs, d.fs.Join(objectsPath, d.incomingDirName))
+	}
+
+	for prefix, names := range byPrefix {
+		for _, dir := range dirs {
+			entries, err := d.fs.ReadDir(d.fs.Join(dir, prefix))
+			if os.IsNotExist(err) {
+				continue
+			}
+
+			if err != nil {
+				return nil, err
+			}
+
+			for _, e := range entries {
+				if h, ok := names[e.Name()]; ok {
+					found[h] = true
+				}
+			}
+		}
+	}
+
+	return found, nil
+}
+
 func (d *DotGit) cleanObjectList() {
 	d.objectMap = nil
 	d.objectList = nil
@@ -805,7 +969,7 @@ func (d *DotGit) packedRef(name plumbing.ReferenceName) (*plumbing.Reference, er
 	return nil, plumbing.ErrReferenceNotFound
 }
 
-// RemoveRef removes a reference by name.
+// RemoveRef removes a reference by name, along with its reflog.
 func (d *DotGit) RemoveRef(name plumbing.ReferenceName) error {
 	path := d.fs.Join(".", name.String())
 	_, err := d.fs.Stat(path)
@@ -818,7 +982,11 @@ func (d *DotGit) RemoveRef(name plumbing.ReferenceName) error {
 		return err
 	}
 
-	return d.rewritePackedRefsWithoutRef(name)
+	if err := d.rewritePackedRefsWithoutRef(name); err != nil {
+		return err
+	}
+
+	return d.RemoveReflog(name)
 }
 
 func refsRecvFunc(refs *[]*plumbing.Reference, seen map[plumbing.ReferenceName]bool) refsRecv {
@@ -913,9 +1081,15 @@ func (d *DotGit) rewritePackedRefsWithoutRef(name plumbing.ReferenceName) (err e
 	}
 	defer ioutil.CheckClose(pr, &err)
 
+	return d.rewritePackedRefsWithoutRefs(pr, map[plumbing.ReferenceName]bool{name: true})
+}
+
+// rewritePackedRefsWithoutRefs removes the given references from the locked
+// packed-refs file pr, read from its current offset.
+func (d *DotGit) rewritePackedRefsWithoutRefs(pr billy.File, names map[plumbing.ReferenceName]bool) (err error) {
 	// Creating the temp file in the same directory as the target file
 	// improves our chances for rename operation to be atomic.
-	tmp, err := d.fs.TempFile("", tmpPackedRefsPrefix)
+	tmp, err := d.fs.TempFile(".", tmpPackedRefsPrefix)
 	if err != nil {
 		return err
 	}
@@ -926,7 +1100,7 @@ func (d *DotGit) rewritePackedRefsWithoutRef(name plumbing.ReferenceName) (err e
 	}()
 
 	s := bufio.NewScanner(pr)
-	found := false
+	found, removed := false, false
 	for s.Scan() {
 		line := s.Text()
 		ref, err := d.processLine(line)
@@ -934,7 +1108,14 @@ func (d *DotGit) rewritePackedRefsWithoutRef(name plumbing.ReferenceName) (err e
 			return err
 		}
 
-		if ref != nil && ref.Name() == name {
+		// The peeled value follows the line of its reference, being
+		// removed with it.
+		if removed && strings.HasPrefix(line, "^") {
+			continue
+		}
+
+		removed = ref != nil && names[ref.Name()]
+		if removed {
 			found = true
 			continue
 		}
@@ -1062,7 +1243,21 @@ func (d *DotGit) CountLooseRefs() (int, error) {
 	return len(refs), nil
 }
 
-// PackRefs packs all loose refs into the packed-refs file.
+// PackRefs packs all loose refs into the packed-refs file, without their
+// peeled values, see PackPeeledRefs.
+func (d *DotGit) PackRefs() error {
+	return d.PackPeeledRefs(nil)
+}
+
+// PeelFunc returns the object pointed by the annotated tag h, the tags of
+// tags being peeled to the object which is not a tag, or the zero hash if h
+// is not a tag.
+type PeelFunc func(h plumbing.Hash) (plumbing.Hash, error)
+
+// PackPeeledRefs packs all loose refs into the packed-refs file, sorted by
+// name. If peel is not nil, the refs are written along with their peeled
+// values, as `git pack-refs` does, the file then starting with the
+// "peeled fully-peeled sorted" header.
 //
 // This implementation only works under the assumption that the view
 // of the file system won't be updated during this operation.  This
@@ -1077,7 +1272,7 @@ func (d *DotGit) CountLooseRefs() (int, error) {
 // TODO: add an "all" boolean like the `git pack-refs --all` flag.
 // When `all` is false, it would only pack refs that have already been
 // packed, plus all tags.
-func (d *DotGit) PackRefs() (err error) {
+func (d *DotGit) PackPeeledRefs(peel PeelFunc) (err error) {
 	// Lock packed-refs, and create it if it doesn't exist yet.
 	f, err := d.openAndLockPackedRefs(true)
 	if err != nil {
@@ -1091,17 +1286,30 @@ func (d *DotGit) PackRefs() (err error) {
 	if err = d.addRefsFromRefDir(&refs, seen); err != nil {
 		return err
 	}
+	// The symbolic references are kept loose, as packed-refs only holds
+	// hash references.
+	hashRefs := refs[:0]
+	for _, ref := range refs {
+		if ref.Type() == plumbing.HashReference {
+			hashRefs = append(hashRefs, ref)
+		}
+	}
+	refs = hashRefs
 	if len(refs) == 0 {
 		// Nothing to do!
 		return nil
 	}
-	numLooseRefs := len(refs)
+	loose := append([]*plumbing.Reference(nil), refs...)
 	if err = d.addRefsFromPackedRefsFile(&refs, f, seen); err != nil {
 		return err
 	}
 
+	sort.Slice(refs, func(i, j int) bool {
+		return refs[i].Name() < refs[j].Name()
+	})
+
 	// Write them all to a new temp packed-refs file.
-	tmp, err := d.fs.TempFile("", tmpPackedRefsPrefix)
+	tmp, err := d.fs.TempFile(".", tmpPackedRefsPrefix)
 	if err != nil {
 		return err
 	}
@@ -1111,12 +1319,36 @@ func (d *DotGit) PackRefs() (err error) {
 		_ = d.fs.Remove(tmpName) // don't check err, we might have renamed it
 	}()
 
+	header := packedRefsSortedHeader
+	if peel != nil {
+		header = packedRefsPeeledHeader
+	}
+
 	w := bufio.NewWriter(tmp)
+	if _, err = w.WriteString(header); err != nil {
+		return err
+	}
+
 	for _, ref := range refs {
 		_, err = w.WriteString(ref.String() + "\n")
 		if err != nil {
 			return err
 		}
+
+		if peel == nil {
+			continue
+		}
+
+		peeled, err := peel(ref.Hash())
+		if err != nil {
+			return err
+		}
+
+		if !peeled.IsZero() {
+			if _, err := w.WriteString("^" + peeled.String() + "\n"); err != nil {
+				return err
+			}
+		}
 	}
 	err = w.Flush()
 	if err != nil {
@@ -1131,7 +1363,7 @@ func (d *DotGit) PackRefs() (err error) {
 
 	// Delete all the loose refs, while still holding the packed-refs
 	// lock.
-	for _, ref := range refs[:numLooseRefs] {
+	for _, ref := range loose {
 		path := d.fs.Join(".", ref.Name().String())
 		err = d.fs.Remove(path)
 		if err != nil && !os.IsNotExist(err) {
@@ -1178,7 +1410,10 @@ func (d *DotGit) AddAlternate(remote string) error {
 }
 
 // Alternates returns DotGit(s) based off paths in objects/info/alternates if
-// available. This can be used to checks if it's a shared repository.
+// available. This can be used to checks if it's a shared repository. The
+// empty lines and the ones starting with # are ignored. The relative paths
+// are based on the objects directory, as git does, if the resulting
+// directory is within the filesystem of the alternates.
 func (d *DotGit) Alternates() ([]*DotGit, error) {
 	altpath := d.fs.Join(objectsPath, infoPath, alternatesPath)
 	f, err := d.fs.Open(altpath)
@@ -1198,7 +1433,10 @@ func (d *DotGit) Alternates() ([]*DotGit, error) {
 	// Read alternate paths line-by-line and create DotGit objects.
 	scanner := bufio.NewScanner(f)
 	for scanner.Scan() {
-		path := scanner.Text()
+		path := strings.TrimSuffix(scanner.Text(), "\r")
+		if path == "" || path[0] == '#' {
+			continue
+		}
 
 		// Avoid creating multiple dotgits for the same alternative path.
 		if _, ok := seen[path]; ok {
@@ -1217,6 +1455,8 @@ func (d *DotGit) Alternates() ([]*DotGit, error) {
 					return nil, fmt.Errorf("cannot make path %q relative: %w", path, err)
 				}
 			}
+		} else if rel, ok := d.alternateFromObjects(fs, path); ok {
+			path = rel
 		} else {
 			// By Git conventions, relative paths should be based on the object database (.git/objects/info)
 			// location as per: https://www.kernel.org/pub/software/scm/git/docs/gitrepository-layout.html
@@ -1235,7 +1475,7 @@ func (d *DotGit) Alternates() ([]*DotGit, error) {
 		if err != nil {
 			return nil, fmt.Errorf("cannot chroot %q: %w", path, err)
 		}
-		alternates = append(alternates, New(afs))
+		alternates = append(alternates, NewWithOptions(afs, Options{AlternatesFS: d.options.AlternatesFS}))
 	}
 
 	if err = scanner.Err(); err != nil {
@@ -1245,6 +1485,19 @@ func (d *DotGit) Alternates() ([]*DotGit, error) {
 	return alternates, nil
 }
 
+// alternateFromObjects returns the path in fs of the given relative path of
+// an alternate object directory, based on the objects directory of d, if it
+// is within fs.
+func (d *DotGit) alternateFromObjects(fs billy.Filesystem, path string) (string, bool) {
+	target := filepath.Join(d.fs.Root(), objectsPath, filepath.FromSlash(path))
+	rel, err := filepath.Rel(fs.Root(), target)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", false
+	}
+
+	return filepath.Join(string(filepath.Separator), rel), true
+}
+
 // Fs returns the underlying filesystem of the DotGit folder.
 func (d *DotGit) Fs() billy.Filesystem {
 	return d.fs
@@ -0,0 +1,50 @@
+package dotgit
+
+import (
+	"os"
+
+	"github.com/go-git/go-billy/v6"
+
+	"github.com/go-git/go-git/v6/plumbing"
+)
+
+func (d *DotGit) reflogPath(name plumbing.ReferenceName) string {
+	return d.fs.Join(logsPath, name.String())
+}
+
+// Reflog returns a file pointer for read to the reflog of the given
+// reference, nil if the reference has no reflog.
+func (d *DotGit) Reflog(name plumbing.ReferenceName) (billy.File, error) {
+	f, err := d.fs.Open(d.reflogPath(name))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+
+		return nil, err
+	}
+
+	return f, nil
+}
+
+// ReflogAppender returns a file pointer for appending to the reflog of the
+// given reference, the reflog being created if needed.
+func (d *DotGit) ReflogAppender(name plumbing.ReferenceName) (billy.File, error) {
+	return d.fs.OpenFile(d.reflogPath(name), os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0o666)
+}
+
+// ReflogWriter returns a file pointer for write to the reflog of the given
+// reference.
+func (d *DotGit) ReflogWriter(name plumbing.ReferenceName) (billy.File, error) {
+	return d.fs.Create(d.reflogPath(name))
+}
+
+// RemoveReflog removes the reflog of the given reference, if any.
+func (d *DotGit) RemoveReflog(name plumbing.ReferenceName) error {
+	err := d.fs.Remove(d.reflogPath(name))
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	return nil
+}
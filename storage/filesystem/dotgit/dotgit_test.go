@@ -19,6 +19,7 @@ import (
 	"github.com/go-git/go-billy/v6/util"
 	fixtures "github.com/go-git/go-git-fixtures/v5"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 	"github.com/stretchr/testify/suite"
 
 	"github.com/go-git/go-git/v6/plumbing"
@@ -279,6 +280,73 @@ func (s *SuiteDotGit) TestRemoveRefFromReferenceFileAndPackedRefs() {
 	s.Nil(ref)
 }
 
+func (s *SuiteDotGit) TestUpdateRefs() {
+	fs := fixtures.Basic().ByTag(".git").One().DotGit()
+	dir := New(fs)
+
+	master := plumbing.NewHash("6ecf0ef2c2dffb796033e5a02219af86ec6584e5")
+	branch := plumbing.NewHash("e8d3ffab552895c19b9fcf7aa264d277cde33881")
+	err := dir.UpdateRefs([]storage.ReferenceUpdate{
+		{Name: "refs/heads/master", OldHash: master, NewHash: branch},
+		{Name: "refs/remotes/origin/master", OldHash: master},
+		{Name: "refs/remotes/origin/branch", OldHash: branch},
+		{Name: "refs/heads/new", NewHash: master},
+	})
+	s.Require().NoError(err)
+
+	b, err := util.ReadFile(fs, packedRefsPath)
+	s.Require().NoError(err)
+	s.Equal(""+
+		"# pack-refs with: peeled fully-peeled \n"+
+		"6ecf0ef2c2dffb796033e5a02219af86ec6584e5 refs/heads/master\n",
+		string(b))
+
+	ref, err := dir.Ref("refs/heads/master")
+	s.Require().NoError(err)
+	s.Equal(branch, ref.Hash())
+
+	ref, err = dir.Ref("refs/heads/new")
+	s.Require().NoError(err)
+	s.Equal(master, ref.Hash())
+
+	_, err = dir.Ref("refs/remotes/origin/master")
+	s.ErrorIs(err, plumbing.ErrReferenceNotFound)
+}
+
+func (s *SuiteDotGit) TestUpdateRefsPreconditionFailed() {
+	fs := fixtures.Basic().ByTag(".git").One().DotGit()
+	dir := New(fs)
+
+	master := plumbing.NewHash("6ecf0ef2c2dffb796033e5a02219af86ec6584e5")
+	branch := plumbing.NewHash("e8d3ffab552895c19b9fcf7aa264d277cde33881")
+	err := dir.UpdateRefs([]storage.ReferenceUpdate{
+		{Name: "refs/heads/new", NewHash: master},
+		{Name: "refs/remotes/origin/master", OldHash: master},
+		{Name: "refs/remotes/origin/branch", OldHash: master, NewHash: branch},
+	})
+
+	var uerr *storage.ReferenceUpdateError
+	s.Require().ErrorAs(err, &uerr)
+	s.Equal(plumbing.ReferenceName("refs/remotes/origin/branch"), uerr.Name)
+	s.Equal(branch, uerr.Actual)
+
+	// The loose files created to lock the references are removed.
+	for _, name := range []string{"refs/heads/new", "refs/remotes/origin/master", "refs/remotes/origin/branch"} {
+		_, err = fs.Stat(name)
+		s.True(os.IsNotExist(err), name)
+	}
+
+	ref, err := dir.Ref("refs/remotes/origin/master")
+	s.Require().NoError(err)
+	s.Equal(master, ref.Hash())
+
+	err = dir.UpdateRefs([]storage.ReferenceUpdate{
+		{Name: "HEAD", OldHash: master, NewHash: branch},
+	})
+	s.Require().ErrorAs(err, &uerr)
+	s.Equal(plumbing.ZeroHash, uerr.Actual)
+}
+
 func (s *SuiteDotGit) TestRemoveRefNonExistent() {
 	fs := fixtures.Basic().ByTag(".git").One().DotGit()
 	dir := New(fs)
@@ -756,6 +824,13 @@ func (s *SuiteDotGit) TestPackRefs() {
 	err = dir.PackRefs()
 	s.Require().NoError(err)
 
+	// The refs are sorted, without their peeled values.
+	packed, err := util.ReadFile(fs, packedRefsPath)
+	s.Require().NoError(err)
+	s.Equal("# pack-refs with: sorted \n"+
+		"a8d3ffab552895c19b9fcf7aa264d277cde33881 refs/heads/bar\n"+
+		"e8d3ffab552895c19b9fcf7aa264d277cde33881 refs/heads/foo\n", string(packed))
+
 	// Make sure the refs are still there, but no longer loose.
 	refs, err = dir.Refs()
 	s.Require().NoError(err)
@@ -799,6 +874,67 @@ func (s *SuiteDotGit) TestPackRefs() {
 	s.Equal("b8d3ffab552895c19b9fcf7aa264d277cde33881", ref.Hash().String())
 }
 
+func (s *SuiteDotGit) TestPackRefsKeepsSymbolicRefs() {
+	dir := New(s.EmptyFS())
+
+	s.Require().NoError(dir.SetRef(plumbing.NewReferenceFromStrings(
+		"refs/heads/foo",
+		"e8d3ffab552895c19b9fcf7aa264d277cde33881",
+	), nil))
+	s.Require().NoError(dir.SetRef(plumbing.NewSymbolicReference(
+		"refs/remotes/origin/HEAD", "refs/heads/foo",
+	), nil))
+
+	s.Require().NoError(dir.PackRefs())
+
+	looseCount, err := dir.CountLooseRefs()
+	s.Require().NoError(err)
+	s.Equal(1, looseCount)
+
+	ref, err := dir.Ref("refs/remotes/origin/HEAD")
+	s.Require().NoError(err)
+	s.Equal(plumbing.SymbolicReference, ref.Type())
+	s.Equal(plumbing.ReferenceName("refs/heads/foo"), ref.Target())
+}
+
+func TestPackRefsWithBoundOS(t *testing.T) {
+	// The temp packed-refs file is created in the git directory, which bounds
+	// the files the filesystem can reach.
+	fs := osfs.New(t.TempDir(), osfs.WithBoundOS())
+	dir := New(fs)
+	require.NoError(t, dir.Initialize())
+
+	require.NoError(t, dir.SetRef(plumbing.NewReferenceFromStrings(
+		"refs/heads/foo",
+		"e8d3ffab552895c19b9fcf7aa264d277cde33881",
+	), nil))
+	require.NoError(t, dir.SetRef(plumbing.NewReferenceFromStrings(
+		"refs/heads/bar",
+		"a8d3ffab552895c19b9fcf7aa264d277cde33881",
+	), nil))
+	require.NoError(t, dir.PackRefs())
+
+	require.NoError(t, dir.SetRef(plumbing.NewReferenceFromStrings(
+		"refs/heads/baz",
+		"b8d3ffab552895c19b9fcf7aa264d277cde33881",
+	), nil))
+	require.NoError(t, dir.PackPeeledRefs(func(plumbing.Hash) (plumbing.Hash, error) {
+		return plumbing.ZeroHash, nil
+	}))
+
+	require.NoError(t, dir.RemoveRef("refs/heads/foo"))
+
+	packed, err := util.ReadFile(fs, packedRefsPath)
+	require.NoError(t, err)
+	assert.Equal(t, "# pack-refs with: peeled fully-peeled sorted \n"+
+		"a8d3ffab552895c19b9fcf7aa264d277cde33881 refs/heads/bar\n"+
+		"b8d3ffab552895c19b9fcf7aa264d277cde33881 refs/heads/baz\n", string(packed))
+
+	looseCount, err := dir.CountLooseRefs()
+	require.NoError(t, err)
+	assert.Equal(t, 0, looseCount)
+}
+
 func TestAlternatesDefault(t *testing.T) {
 	// Create a new dotgit object.
 	dotFS := osfs.New(t.TempDir())
@@ -934,6 +1070,27 @@ func TestAlternatesDupes(t *testing.T) {
 	assert.Len(t, dotgits, 1)
 }
 
+func TestAlternatesRelativeToObjects(t *testing.T) {
+	altFS := osfs.New(t.TempDir())
+	dotFS, err := altFS.Chroot(filepath.Join("fork", ".git"))
+	require.NoError(t, err)
+	dir := NewWithOptions(dotFS, Options{AlternatesFS: altFS})
+	require.NoError(t, dir.Initialize())
+	require.NoError(t, altFS.MkdirAll(filepath.Join("base", ".git", "objects"), 0o700))
+
+	content := "# comment\n\n../../../base/.git/objects\n"
+	f, err := dotFS.Create(dotFS.Join("objects", "info", "alternates"))
+	require.NoError(t, err)
+	_, err = f.Write([]byte(content))
+	require.NoError(t, err)
+	require.NoError(t, f.Close())
+
+	dotgits, err := dir.Alternates()
+	require.NoError(t, err)
+	require.Len(t, dotgits, 1)
+	assert.Equal(t, filepath.Join(altFS.Root(), "base", ".git"), dotgits[0].fs.Root())
+}
+
 type norwfs struct {
 	billy.Filesystem
 }
@@ -0,0 +1,267 @@
+package dotgit
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+
+	"github.com/go-git/go-billy/v6"
+
+	"github.com/go-git/go-git/v6/plumbing"
+	"github.com/go-git/go-git/v6/storage"
+	"github.com/go-git/go-git/v6/utils/ioutil"
+)
+
+// lockedRef is a reference updated by UpdateRefs, along with its loose file,
+// opened and locked if the filesystem supports it.
+type lockedRef struct {
+	storage.ReferenceUpdate
+
+	f billy.File
+	// content is the content of the loose file before the update, and
+	// created whether the loose file did not exist.
+	content []byte
+	created bool
+	written bool
+}
+
+// UpdateRefs applies the given updates atomically, as described by
+// storage.ReferenceTransactionStorer. The loose files of the references, and
+// the packed-refs file, are locked while the preconditions are checked and
+// the updates applied, and the updates already written are reverted if
+// applying one of them fails.
+func (d *DotGit) UpdateRefs(updates []storage.ReferenceUpdate) (err error) {
+	// The references are locked in order, avoiding deadlocks between
+	// concurrent transactions.
+	refs := make([]*lockedRef, 0, len(updates))
+	for _, u := range updates {
+		refs = append(refs, &lockedRef{ReferenceUpdate: u})
+	}
+
+	sort.Slice(refs, func(i, j int) bool {
+		return refs[i].Name < refs[j].Name
+	})
+
+	for i := 1; i < len(refs); i++ {
+		if refs[i].Name == refs[i-1].Name {
+			return fmt.Errorf("%w: %s", storage.ErrMultipleReferenceUpdates, refs[i].Name)
+		}
+	}
+
+	locked := 0
+	defer func() {
+		for _, ref := range refs[:locked] {
+			// The loose files created to be locked are removed before being
+			// unlocked, unless the reference was written.
+			if ref.created && !ref.written {
+				_ = d.fs.Remove(ref.Name.String())
+			}
+
+			if ref.f != nil {
+				ioutil.CheckClose(ref.f, &err)
+			}
+		}
+	}()
+
+	for _, ref := range refs {
+		// A reference failing to be locked may have been opened, or created.
+		locked++
+		if err := d.lockRef(ref); err != nil {
+			return err
+		}
+	}
+
+	pr, err := d.openAndLockPackedRefs(false)
+	if err != nil {
+		return err
+	}
+
+	packed := make(map[plumbing.ReferenceName]*plumbing.Reference)
+	if pr != nil {
+		defer ioutil.CheckClose(pr, &err)
+
+		if err := d.findPackedRefsInFile(pr, func(r *plumbing.Reference) bool {
+			if r != nil {
+				packed[r.Name()] = r
+			}
+			return true
+		}); err != nil {
+			return err
+		}
+	}
+
+	for _, ref := range refs {
+		if err := d.checkLockedRef(ref, packed); err != nil {
+			return err
+		}
+	}
+
+	return d.applyLockedRefs(refs, pr, packed)
+}
+
+// lockRef opens and locks the loose file of the reference, creating it if
+// needed, and reads its content.
+func (d *DotGit) lockRef(ref *lockedRef) (err error) {
+	name := ref.Name.String()
+	_, err = d.fs.Stat(name)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	ref.created = err != nil
+	if !billy.CapabilityCheck(d.fs, billy.ReadAndWriteCapability) {
+		if ref.created {
+			return nil
+		}
+
+		var f billy.File
+		f, err = d.fs.Open(name)
+		if err != nil {
+			return err
+		}
+
+		defer ioutil.CheckClose(f, &err)
+
+		ref.content, err = io.ReadAll(f)
+		return err
+	}
+
+	f, err := d.fs.OpenFile(name, os.O_RDWR|os.O_CREATE, 0o666)
+	if err != nil {
+		ref.created = false
+		return err
+	}
+
+	ref.f = f
+	if locker, ok := f.(billy.Locker); ok {
+		if err := locker.Lock(); err != nil {
+			return err
+		}
+	}
+
+	ref.content, err = io.ReadAll(f)
+	if err != nil {
+		return err
+	}
+
+	// The file may have been written by someone else since it was found
+	// missing.
+	ref.created = ref.created && len(ref.content) == 0
+	return nil
+}
+
+// checkLockedRef checks the precondition of the update of the reference,
+// whose current value is read from its loose file or the packed references.
+func (d *DotGit) checkLockedRef(ref *lockedRef, packed map[plumbing.ReferenceName]*plumbing.Reference) error {
+	current := packed[ref.Name]
+	if len(ref.content) != 0 {
+		r, err := d.readReferenceFrom(bytes.NewReader(ref.content), ref.Name.String())
+		if err != nil {
+			return err
+		}
+
+		current = r
+	}
+
+	actual := plumbing.ZeroHash
+	if current != nil && current.Type() == plumbing.HashReference {
+		actual = current.Hash()
+	}
+
+	if current == nil && ref.OldHash.IsZero() || current != nil && !actual.IsZero() && actual == ref.OldHash {
+		return nil
+	}
+
+	return &storage.ReferenceUpdateError{Name: ref.Name, Expected: ref.OldHash, Actual: actual}
+}
+
+// applyLockedRefs writes the updated references, and then removes the deleted
+// ones. The written references are reverted if an update fails before any
+// reference is deleted.
+func (d *DotGit) applyLockedRefs(refs []*lockedRef, pr billy.File, packed map[plumbing.ReferenceName]*plumbing.Reference) (err error) {
+	var deleting bool
+	defer func() {
+		if err == nil || deleting {
+			return
+		}
+
+		for _, ref := range refs {
+			if ref.written && !ref.created {
+				_ = d.writeLockedRef(ref, ref.content)
+			}
+
+			ref.written = false
+		}
+	}()
+
+	deleted := make(map[plumbing.ReferenceName]bool)
+	var deletePacked bool
+	for _, ref := range refs {
+		if ref.NewHash.IsZero() {
+			deleted[ref.Name] = true
+			deletePacked = deletePacked || packed[ref.Name] != nil
+			continue
+		}
+
+		ref.written = true
+		if err := d.writeLockedRef(ref, []byte(fmt.Sprintln(ref.NewHash.String()))); err != nil {
+			return err
+		}
+	}
+
+	deleting = true
+	if deletePacked {
+		if _, err := pr.Seek(0, io.SeekStart); err != nil {
+			return err
+		}
+
+		if err := d.rewritePackedRefsWithoutRefs(pr, deleted); err != nil {
+			return err
+		}
+	}
+
+	for _, ref := range refs {
+		if !deleted[ref.Name] {
+			continue
+		}
+
+		if err := d.fs.Remove(ref.Name.String()); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+
+		if err := d.RemoveReflog(ref.Name); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// writeLockedRef replaces the content of the loose file of the reference.
+func (d *DotGit) writeLockedRef(ref *lockedRef, content []byte) (err error) {
+	if ref.f == nil {
+		var f billy.File
+		f, err = d.fs.Create(ref.Name.String())
+		if err != nil {
+			return err
+		}
+
+		defer ioutil.CheckClose(f, &err)
+
+		_, err = f.Write(content)
+		return err
+	}
+
+	if _, err := ref.f.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+
+	if err := ref.f.Truncate(0); err != nil {
+		return err
+	}
+
+	_, err = ref.f.Write(content)
+	return err
+}
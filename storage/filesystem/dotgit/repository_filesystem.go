@@ -68,7 +68,9 @@ func (fs *RepositoryFilesystem) Stat(filename string) (os.FileInfo, error) {
 }
 
 func (fs *RepositoryFilesystem) Rename(oldpath, newpath string) error {
-	return fs.mapToRepositoryFsByPath(oldpath).Rename(oldpath, newpath)
+	// The old path may be the absolute name of a temporary file, the new one
+	// tells where it belongs.
+	return fs.mapToRepositoryFsByPath(newpath).Rename(oldpath, newpath)
 }
 
 func (fs *RepositoryFilesystem) Remove(filename string) error {
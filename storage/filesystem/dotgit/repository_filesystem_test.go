@@ -49,6 +49,15 @@ func (s *SuiteDotGit) TestRepositoryFilesystem() {
 	err = repositoryFs.Rename("somefile2", "newfile")
 	s.Require().NoError(err)
 
+	// The temporary files of the objects are renamed in the common one.
+	tmpObj, err := repositoryFs.TempFile("objects", "tmp_obj_")
+	s.Require().NoError(err)
+	s.Require().NoError(tmpObj.Close())
+	err = repositoryFs.Rename(tmpObj.Name(), repositoryFs.Join("objects", "obj"))
+	s.Require().NoError(err)
+	_, err = commonDotGitFs.Stat(repositoryFs.Join("objects", "obj"))
+	s.Require().NoError(err)
+
 	tempDir, err := repositoryFs.TempFile("tmp", "myprefix")
 	s.Require().NoError(err)
 	s.Equal(repositoryFs.Join(dotGitFs.Root(), "tmp", tempDir.Name()), repositoryFs.Join(repositoryFs.Root(), "tmp", tempDir.Name()))
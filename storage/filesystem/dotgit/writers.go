@@ -1,20 +1,20 @@
 package dotgit
 
 import (
-	"crypto"
 	"errors"
 	"fmt"
-	"hash"
 	"io"
 	"sync/atomic"
 
 	"github.com/go-git/go-billy/v6"
 
 	"github.com/go-git/go-git/v6/plumbing"
+	formatcfg "github.com/go-git/go-git/v6/plumbing/format/config"
 	"github.com/go-git/go-git/v6/plumbing/format/idxfile"
 	"github.com/go-git/go-git/v6/plumbing/format/objfile"
 	"github.com/go-git/go-git/v6/plumbing/format/packfile"
-	"github.com/go-git/go-git/v6/plumbing/format/revfile"
+	"github.com/go-git/go-git/v6/plumbing/storer"
+	"github.com/go-git/go-git/v6/utils/ioutil"
 )
 
 // PackWriter is a io.Writer that generates the packfile index simultaneously,
@@ -27,6 +27,8 @@ type PackWriter struct {
 	Notify func(plumbing.Hash, *idxfile.Writer)
 
 	fs       billy.Filesystem
+	bases    storer.EncodedObjectStorer
+	opts     []packfile.ParserOption
 	fr, fw   billy.File
 	synced   *syncedReader
 	checksum plumbing.Hash
@@ -35,7 +37,7 @@ type PackWriter struct {
 	result   chan error
 }
 
-func newPackWrite(fs billy.Filesystem) (*PackWriter, error) {
+func newPackWrite(fs billy.Filesystem, bases storer.EncodedObjectStorer, opts ...packfile.ParserOption) (*PackWriter, error) {
 	fw, err := fs.TempFile(fs.Join(objectsPath, packPath), "tmp_pack_")
 	if err != nil {
 		return nil, err
@@ -48,6 +50,8 @@ func newPackWrite(fs billy.Filesystem) (*PackWriter, error) {
 
 	writer := &PackWriter{
 		fs:     fs,
+		bases:  bases,
+		opts:   opts,
 		fw:     fw,
 		fr:     fr,
 		synced: newSyncedReader(fw, fr),
@@ -62,7 +66,11 @@ func (w *PackWriter) buildIndex() {
 	w.writer = new(idxfile.Writer)
 	var err error
 
-	w.parser = packfile.NewParser(w.synced, packfile.WithScannerObservers(w.writer))
+	opts := append([]packfile.ParserOption{
+		packfile.WithScannerObservers(w.writer),
+		packfile.WithThinPackBases(w.bases),
+	}, w.opts...)
+	w.parser = packfile.NewParser(w.synced, opts...)
 
 	h, err := w.parser.Parse()
 	if err != nil {
@@ -106,7 +114,11 @@ func (w *PackWriter) Close() error {
 	}
 
 	if err := w.waitBuildIndex(); err != nil {
-		return err
+		return w.abort(err)
+	}
+
+	if err := w.fixThin(); err != nil {
+		return w.abort(err)
 	}
 
 	if err := w.fr.Close(); err != nil {
@@ -124,58 +136,70 @@ func (w *PackWriter) Close() error {
 	return w.save()
 }
 
-func (w *PackWriter) clean() error {
-	return w.fs.Remove(w.fw.Name())
-}
-
-func (w *PackWriter) save() error {
-	base := w.fs.Join(objectsPath, packPath, fmt.Sprintf("pack-%s", w.checksum))
-
-	idx, err := w.fs.Create(fmt.Sprintf("%s.idx", base))
-	if err != nil {
-		return err
+// fixThin completes the packfile if it is a thin pack, appending the bases
+// of its deltas missing from it.
+func (w *PackWriter) fixThin() error {
+	if w.parser == nil || w.bases == nil {
+		return nil
 	}
-	defer idx.Close()
 
-	h := crypto.SHA1.New()
-	if w.checksum.Size() == crypto.SHA256.Size() {
-		h = crypto.SHA256.New()
+	hashes := w.parser.ExternalBases()
+	if len(hashes) == 0 {
+		return nil
 	}
 
-	if err := w.encodeIdx(idx); err != nil {
-		return err
+	bases := make([]plumbing.EncodedObject, 0, len(hashes))
+	for _, h := range hashes {
+		o, err := w.bases.EncodedObject(plumbing.AnyObject, h)
+		if err != nil {
+			return err
+		}
+
+		bases = append(bases, o)
 	}
 
-	rev, err := w.fs.Create(fmt.Sprintf("%s.rev", base))
+	h, err := packfile.FixThinPack(w.fw, bases, w.writer)
 	if err != nil {
 		return err
 	}
-	defer rev.Close()
-	if err := w.encodeRev(rev, h); err != nil {
-		return err
-	}
 
-	return w.fs.Rename(w.fw.Name(), fmt.Sprintf("%s.pack", base))
+	w.checksum = h
+	return nil
 }
 
-func (w *PackWriter) encodeIdx(writer io.Writer) error {
-	idx, err := w.writer.Index()
+// abort closes and removes the temp file of the packfile, which failed to be
+// parsed, returning err.
+func (w *PackWriter) abort(err error) error {
+	_ = w.fr.Close()
+	_ = w.fw.Close()
+	_ = w.clean()
+	return err
+}
+
+func (w *PackWriter) clean() error {
+	return w.fs.Remove(w.fw.Name())
+}
+
+func (w *PackWriter) save() (err error) {
+	base := w.fs.Join(objectsPath, packPath, fmt.Sprintf("pack-%s", w.checksum))
+
+	idx, err := w.fs.Create(fmt.Sprintf("%s.idx", base))
 	if err != nil {
 		return err
 	}
+	defer ioutil.CheckClose(idx, &err)
 
-	e := idxfile.NewEncoder(writer)
-	_, err = e.Encode(idx)
-	return err
-}
-
-func (w *PackWriter) encodeRev(writer io.Writer, h hash.Hash) error {
-	idx, err := w.writer.Index()
+	rev, err := w.fs.Create(fmt.Sprintf("%s.rev", base))
 	if err != nil {
 		return err
 	}
+	defer ioutil.CheckClose(rev, &err)
+
+	if err := packfile.WriteIndex(w.writer, idx, rev); err != nil {
+		return err
+	}
 
-	return revfile.Encode(writer, h, idx)
+	return w.fs.Rename(w.fw.Name(), fmt.Sprintf("%s.pack", base))
 }
 
 type syncedReader struct {
@@ -271,14 +295,31 @@ type ObjectWriter struct {
 	f  billy.File
 }
 
-func newObjectWriter(fs billy.Filesystem) (*ObjectWriter, error) {
+func newObjectWriter(fs billy.Filesystem, compression objfile.Compression, level int, of formatcfg.ObjectFormat) (*ObjectWriter, error) {
 	f, err := fs.TempFile(fs.Join(objectsPath, packPath), "tmp_obj_")
 	if err != nil {
 		return nil, err
 	}
 
+	var w *objfile.Writer
+	switch compression {
+	case objfile.ZlibCompression:
+		w, err = objfile.NewWriterLevel(f, level)
+	case objfile.ZstdCompression:
+		w = objfile.NewZstdWriter(f)
+	default:
+		err = fmt.Errorf("unsupported loose object compression: %d", compression)
+	}
+
+	if err != nil {
+		_ = f.Close()
+		_ = fs.Remove(f.Name())
+		return nil, err
+	}
+
+	w.SetObjectFormat(of)
 	return &ObjectWriter{
-		Writer: (*objfile.NewWriter(f)),
+		Writer: *w,
 		fs:     fs,
 		f:      f,
 	}, nil
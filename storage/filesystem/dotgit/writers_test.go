@@ -23,7 +23,7 @@ func BenchmarkNewObjectPack(b *testing.B) {
 	fs := osfs.New(b.TempDir())
 
 	for b.Loop() {
-		w, err := newPackWrite(fs)
+		w, err := newPackWrite(fs, nil)
 
 		require.NoError(b, err)
 		_, err = io.Copy(w, f.Packfile())
@@ -151,7 +151,7 @@ func TestSyncedReader(t *testing.T) {
 func TestPackWriterUnusedNotify(t *testing.T) {
 	fs := osfs.New(t.TempDir())
 
-	w, err := newPackWrite(fs)
+	w, err := newPackWrite(fs, nil)
 	require.NoError(t, err)
 
 	w.Notify = func(h plumbing.Hash, idx *idxfile.Writer) {
@@ -0,0 +1,152 @@
+package filesystem
+
+import (
+	"sync"
+
+	"github.com/go-git/go-git/v6/plumbing"
+	"github.com/go-git/go-git/v6/plumbing/storer"
+	"github.com/go-git/go-git/v6/storage"
+	"github.com/go-git/go-git/v6/utils/ioutil"
+)
+
+// graftCache caches the grafts of a storage, until its shallow commits or its
+// references are changed.
+type graftCache struct {
+	mu     sync.Mutex
+	read   bool
+	grafts *storer.Grafts
+}
+
+func (c *graftCache) invalidate() {
+	if c == nil {
+		return
+	}
+
+	c.mu.Lock()
+	c.read = false
+	c.grafts = nil
+	c.mu.Unlock()
+}
+
+// Grafts returns the grafts of the shallow commits, of the info/grafts file
+// and of the refs/replace/* references, unless Options.NoReplaceObjects is
+// set. It implements storer.GraftStorer.
+//
+// The grafts are cached until the shallow commits or the references are
+// changed through the storage: the changes made by other processes may be
+// ignored.
+func (s *Storage) Grafts() (g *storer.Grafts, err error) {
+	s.grafts.mu.Lock()
+	defer s.grafts.mu.Unlock()
+
+	if s.grafts.read {
+		return s.grafts.grafts, nil
+	}
+
+	shallow, err := s.Shallow()
+	if err != nil {
+		return nil, err
+	}
+
+	f, err := s.dir.Grafts()
+	if err != nil {
+		return nil, err
+	}
+
+	if f != nil {
+		defer ioutil.CheckClose(f, &err)
+	}
+
+	var refs storer.ReferenceIter
+	if !s.options.NoReplaceObjects {
+		refs, err = s.IterReferences()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if f == nil {
+		g, err = storer.ReadGrafts(shallow, nil, refs)
+	} else {
+		g, err = storer.ReadGrafts(shallow, f, refs)
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	s.grafts.read = true
+	s.grafts.grafts = g
+	return g, nil
+}
+
+// EncodedObject returns the object with the given hash, or the object
+// replacing it if it is replaced by a refs/replace/* reference, unless
+// Options.NoReplaceObjects is set. The replacement is returned as it is
+// stored, with its own hash.
+func (s *Storage) EncodedObject(t plumbing.ObjectType, h plumbing.Hash) (plumbing.EncodedObject, error) {
+	return s.ObjectStorage.EncodedObject(t, s.replacement(h))
+}
+
+// EncodedObjectSize returns the size of the object with the given hash, or of
+// the object replacing it, as EncodedObject.
+func (s *Storage) EncodedObjectSize(h plumbing.Hash) (int64, error) {
+	return s.ObjectStorage.EncodedObjectSize(s.replacement(h))
+}
+
+// replacement returns the hash of the object replacing the object with the
+// given hash, if any. The grafts failing to be read are ignored.
+func (s *Storage) replacement(h plumbing.Hash) plumbing.Hash {
+	if s.options.NoReplaceObjects {
+		return h
+	}
+
+	g, err := s.Grafts()
+	if err != nil {
+		return h
+	}
+
+	return g.Replacement(h)
+}
+
+// NoReplaceObjects returns the storage reading the objects as they are
+// stored, ignoring the refs/replace/* references. It implements
+// storage.ReplaceObjectsStorer.
+func (s *Storage) NoReplaceObjects() storage.Storer {
+	if s.options.NoReplaceObjects {
+		return s
+	}
+
+	return &noReplaceStorage{s}
+}
+
+// noReplaceStorage is a Storage reading the objects as they are stored.
+type noReplaceStorage struct {
+	*Storage
+}
+
+func (s *noReplaceStorage) EncodedObject(t plumbing.ObjectType, h plumbing.Hash) (plumbing.EncodedObject, error) {
+	return s.ObjectStorage.EncodedObject(t, h)
+}
+
+func (s *noReplaceStorage) EncodedObjectSize(h plumbing.Hash) (int64, error) {
+	return s.ObjectStorage.EncodedObjectSize(h)
+}
+
+// Grafts returns the grafts of the storage, without the replaced objects.
+func (s *noReplaceStorage) Grafts() (*storer.Grafts, error) {
+	g, err := s.Storage.Grafts()
+	if err != nil || g == nil || len(g.Replaced) == 0 {
+		return g, err
+	}
+
+	if len(g.Parents) == 0 {
+		return nil, nil
+	}
+
+	return &storer.Grafts{Parents: g.Parents}, nil
+}
+
+func (s *noReplaceStorage) NoReplaceObjects() storage.Storer {
+	return s
+}
@@ -30,8 +30,20 @@ func (s *IndexStorage) SetIndex(idx *index.Index) (err error) {
 	}()
 
 	e := index.NewEncoder(bw, s.h)
-	err = e.Encode(idx)
-	return err
+	if err := e.Encode(idx); err != nil {
+		return err
+	}
+
+	if err := bw.Flush(); err != nil {
+		return err
+	}
+
+	// The entries are now compared with the index written.
+	if fi, err := f.Stat(); err == nil {
+		idx.ModTime = fi.ModTime()
+	}
+
+	return nil
 }
 
 func (s *IndexStorage) Index() (i *index.Index, err error) {
@@ -42,7 +54,8 @@ func (s *IndexStorage) Index() (i *index.Index, err error) {
 	f, err := s.dir.Index()
 	if err != nil {
 		if os.IsNotExist(err) {
-			return idx, nil
+			idx.Version, err = s.newIndexVersion()
+			return idx, err
 		}
 
 		return nil, err
@@ -50,7 +63,29 @@ func (s *IndexStorage) Index() (i *index.Index, err error) {
 
 	defer ioutil.CheckClose(f, &err)
 
+	if fi, err := f.Stat(); err == nil {
+		idx.ModTime = fi.ModTime()
+	}
+
 	d := index.NewDecoder(f, s.h)
 	err = d.Decode(idx)
 	return idx, err
 }
+
+// newIndexVersion returns the version of a new index file, set by the
+// index.version and feature.manyFiles options of the config, as in git.
+func (s *IndexStorage) newIndexVersion() (uint32, error) {
+	cfg, err := (&ConfigStorage{dir: s.dir}).Config()
+	if err != nil {
+		return 0, err
+	}
+
+	switch v := cfg.Index.Version; {
+	case v >= uint(index.DecodeVersionSupported.Min) && v <= uint(index.EncodeVersionSupported):
+		return uint32(v), nil
+	case cfg.Feature.ManyFiles:
+		return 4, nil
+	default:
+		return 2, nil
+	}
+}
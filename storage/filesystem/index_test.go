@@ -0,0 +1,49 @@
+package filesystem
+
+import (
+	"testing"
+
+	"github.com/go-git/go-billy/v6/memfs"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/go-git/go-git/v6/plumbing/cache"
+	"github.com/go-git/go-git/v6/plumbing/format/index"
+)
+
+func TestIndexVersion(t *testing.T) {
+	t.Parallel()
+
+	for name, tc := range map[string]struct {
+		version   uint
+		manyFiles bool
+		expected  uint32
+	}{
+		"default":    {expected: 2},
+		"version":    {version: 3, expected: 3},
+		"many files": {manyFiles: true, expected: 4},
+		"both":       {version: 2, manyFiles: true, expected: 2},
+		"invalid":    {version: 5, expected: 2},
+	} {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			s := NewStorage(memfs.New(), cache.NewObjectLRUDefault())
+			cfg, err := s.Config()
+			require.NoError(t, err)
+			cfg.Index.Version = tc.version
+			cfg.Feature.ManyFiles = tc.manyFiles
+			require.NoError(t, s.SetConfig(cfg))
+
+			idx, err := s.Index()
+			require.NoError(t, err)
+			assert.Equal(t, tc.expected, idx.Version)
+
+			// The version of an existing index is kept.
+			require.NoError(t, s.SetIndex(&index.Index{Version: 3}))
+			idx, err = s.Index()
+			require.NoError(t, err)
+			assert.Equal(t, uint32(3), idx.Version)
+		})
+	}
+}
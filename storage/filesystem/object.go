@@ -6,14 +6,18 @@ import (
 	"fmt"
 	"io"
 	"os"
+	"slices"
 	"sync"
 	"time"
 
 	"github.com/go-git/go-git/v6/plumbing"
 	"github.com/go-git/go-git/v6/plumbing/cache"
+	"github.com/go-git/go-git/v6/plumbing/format/commitgraph"
+	formatcfg "github.com/go-git/go-git/v6/plumbing/format/config"
 	"github.com/go-git/go-git/v6/plumbing/format/idxfile"
 	"github.com/go-git/go-git/v6/plumbing/format/objfile"
 	"github.com/go-git/go-git/v6/plumbing/format/packfile"
+	"github.com/go-git/go-git/v6/plumbing/format/packfile/bitmap"
 	"github.com/go-git/go-git/v6/plumbing/storer"
 	"github.com/go-git/go-git/v6/storage/filesystem/dotgit"
 	"github.com/go-git/go-git/v6/utils/ioutil"
@@ -25,6 +29,9 @@ type ObjectStorage struct {
 	// objectCache is an object cache used to cache delta's bases and also recently
 	// loaded loose objects.
 	objectCache cache.Object
+	// deltaBaseCache holds the bases of the deltas read from the packfiles,
+	// shared by all of them.
+	deltaBaseCache *packfile.DeltaBaseCache
 
 	dir   *dotgit.DotGit
 	index map[plumbing.Hash]idxfile.Index
@@ -32,8 +39,30 @@ type ObjectStorage struct {
 	packList    []plumbing.Hash
 	packListIdx int
 	packfiles   map[plumbing.Hash]*packfile.Packfile
+	mappings    *packMappings
+	bitmaps     []*bitmap.Index
+	graph       commitgraph.Index
+	fetcher     storer.ObjectFetcher
 	muI         sync.RWMutex
 	muP         sync.RWMutex
+	muG         sync.Mutex
+
+	// muL guards the loose objects counters, used to pack the loose objects
+	// once the auto pack thresholds are exceeded.
+	muL          sync.Mutex
+	looseCounted bool
+	looseCount   int
+	looseSize    int64
+
+	// muA guards the object storages of the alternate object directories,
+	// read once from the alternates files, until Reindex is called.
+	muA            sync.Mutex
+	alternates     []*ObjectStorage
+	alternatesRead bool
+	// isAlternate is set for the object storages of the alternate object
+	// directories, whose own alternates are looked up by the storage
+	// using them.
+	isAlternate bool
 
 	oh *plumbing.ObjectHasher
 }
@@ -45,14 +74,50 @@ func NewObjectStorage(dir *dotgit.DotGit, objectCache cache.Object) *ObjectStora
 
 // NewObjectStorageWithOptions creates a new ObjectStorage with the given .git directory, cache and extra options
 func NewObjectStorageWithOptions(dir *dotgit.DotGit, objectCache cache.Object, ops Options) *ObjectStorage {
+	if ops.SharedObjectCache {
+		objectCache = sharedObjectCache{objectCache}
+	}
+
 	return &ObjectStorage{
-		options:     ops,
-		objectCache: objectCache,
-		dir:         dir,
-		oh:          plumbing.FromObjectFormat(ops.ObjectFormat),
+		options:        ops,
+		objectCache:    objectCache,
+		deltaBaseCache: packfile.NewDeltaBaseCache(ops.DeltaBaseCacheLimit),
+		mappings:       newPackMappings(ops),
+		dir:            dir,
+		oh:             plumbing.FromObjectFormat(ops.ObjectFormat),
+	}
+}
+
+// ObjectFormat returns the object format of the objects of the storage.
+func (s *ObjectStorage) ObjectFormat() formatcfg.ObjectFormat {
+	return s.options.ObjectFormat
+}
+
+// SetObjectFormat sets the object format of the objects of the storage, which
+// must not hold any object yet.
+func (s *ObjectStorage) SetObjectFormat(f formatcfg.ObjectFormat) {
+	s.options.ObjectFormat = f
+	s.oh = plumbing.FromObjectFormat(f)
+	s.dir.SetObjectFormat(f)
+}
+
+// sharedObjectCache is an object cache shared with other storages, only
+// caching the objects held in memory, as they can be read by any storage.
+type sharedObjectCache struct {
+	cache.Object
+}
+
+// Put puts the object into the cache, if held in memory.
+func (c sharedObjectCache) Put(o plumbing.EncodedObject) {
+	if _, ok := o.(*plumbing.MemoryObject); ok {
+		c.Object.Put(o)
 	}
 }
 
+// Clear is a no-op: the objects of the cache, held in memory, remain valid
+// whatever the changes of the storage.
+func (c sharedObjectCache) Clear() {}
+
 func (s *ObjectStorage) requireIndex() error {
 	s.muI.RLock()
 	if s.index != nil {
@@ -82,6 +147,97 @@ func (s *ObjectStorage) requireIndex() error {
 // Reindex indexes again all packfiles. Useful if git changed packfiles externally
 func (s *ObjectStorage) Reindex() {
 	s.index = nil
+	s.bitmaps = nil
+	// The cached objects may be read lazily from a removed packfile.
+	s.objectCache.Clear()
+	// The bases of the removed packfiles are released.
+	s.deltaBaseCache.Clear()
+	_ = s.closeCommitGraph()
+	s.forgetAlternates()
+}
+
+// forgetAlternates makes the alternates files be read again on the next
+// lookup of an alternate object directory.
+func (s *ObjectStorage) forgetAlternates() {
+	s.muA.Lock()
+	s.alternates = nil
+	s.alternatesRead = false
+	s.muA.Unlock()
+}
+
+// BitmapIndexes returns the bitmap indexes of the packfiles that have one.
+// It implements bitmap.Storer.
+func (s *ObjectStorage) BitmapIndexes() ([]*bitmap.Index, error) {
+	if err := s.requireIndex(); err != nil {
+		return nil, err
+	}
+
+	s.muI.Lock()
+	defer s.muI.Unlock()
+
+	if s.bitmaps != nil {
+		return s.bitmaps, nil
+	}
+
+	bitmaps := make([]*bitmap.Index, 0)
+	for h, idx := range s.index {
+		bi, err := s.loadBitmapFile(h, idx)
+		if errors.Is(err, dotgit.ErrPackfileNotFound) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		bitmaps = append(bitmaps, bi)
+	}
+
+	s.bitmaps = bitmaps
+	return bitmaps, nil
+}
+
+// CommitGraph returns the commit-graph of the repository, read from either
+// objects/info/commit-graph or the commit-graph chain. It implements
+// commitgraph.Storer.
+func (s *ObjectStorage) CommitGraph() (commitgraph.Index, error) {
+	s.muG.Lock()
+	defer s.muG.Unlock()
+
+	if s.graph != nil {
+		return s.graph, nil
+	}
+
+	graph, err := commitgraph.OpenChainOrFileIndex(s.dir.Fs())
+	if err != nil {
+		return nil, err
+	}
+
+	s.graph = graph
+	return graph, nil
+}
+
+func (s *ObjectStorage) closeCommitGraph() error {
+	s.muG.Lock()
+	defer s.muG.Unlock()
+
+	if s.graph == nil {
+		return nil
+	}
+
+	err := s.graph.Close()
+	s.graph = nil
+	return err
+}
+
+func (s *ObjectStorage) loadBitmapFile(h plumbing.Hash, idx idxfile.Index) (bi *bitmap.Index, err error) {
+	f, err := s.dir.ObjectPackBitmap(h)
+	if err != nil {
+		return nil, err
+	}
+
+	defer ioutil.CheckClose(f, &err)
+
+	return bitmap.Decode(f, idx)
 }
 
 func (s *ObjectStorage) loadIdxFile(h plumbing.Hash) (err error) {
@@ -103,7 +259,7 @@ func (s *ObjectStorage) loadIdxFile(h plumbing.Hash) (err error) {
 }
 
 func (s *ObjectStorage) RawObjectWriter(typ plumbing.ObjectType, sz int64) (w io.WriteCloser, err error) {
-	ow, err := s.dir.NewObject()
+	ow, err := s.newObject()
 	if err != nil {
 		return nil, err
 	}
@@ -121,11 +277,20 @@ func (s *ObjectStorage) NewEncodedObject() plumbing.EncodedObject {
 }
 
 func (s *ObjectStorage) PackfileWriter() (io.WriteCloser, error) {
+	return s.PackfileWriterWithOptions()
+}
+
+// PackfileWriterWithOptions implements packfile.ParserOptionsPackfileWriter.
+func (s *ObjectStorage) PackfileWriterWithOptions(opts ...packfile.ParserOption) (io.WriteCloser, error) {
 	if err := s.requireIndex(); err != nil {
 		return nil, err
 	}
 
-	w, err := s.dir.NewObjectPack()
+	if s.options.PackfileMaxMemory > 0 {
+		opts = append([]packfile.ParserOption{packfile.WithMaxMemory(s.options.PackfileMaxMemory)}, opts...)
+	}
+
+	w, err := s.dir.NewThinObjectPack(s, opts...)
 	if err != nil {
 		return nil, err
 	}
@@ -140,13 +305,20 @@ func (s *ObjectStorage) PackfileWriter() (io.WriteCloser, error) {
 	return w, nil
 }
 
+// AcceptsThinPacks implements storer.ThinPackfileWriter: the packfiles
+// written by PackfileWriter may be thin packs, completed with the bases of
+// their deltas read from the storage.
+func (s *ObjectStorage) AcceptsThinPacks() bool {
+	return true
+}
+
 // SetEncodedObject adds a new object to the storage.
 func (s *ObjectStorage) SetEncodedObject(o plumbing.EncodedObject) (h plumbing.Hash, err error) {
 	if o.Type() == plumbing.OFSDeltaObject || o.Type() == plumbing.REFDeltaObject {
 		return plumbing.ZeroHash, plumbing.ErrInvalidType
 	}
 
-	ow, err := s.dir.NewObject()
+	ow, err := s.newObject()
 	if err != nil {
 		return plumbing.ZeroHash, err
 	}
@@ -176,7 +348,7 @@ func (s *ObjectStorage) SetEncodedObject(o plumbing.EncodedObject) (h plumbing.H
 // that the object contents can be written later, without the need to
 // create a MemoryObject and buffering its entire contents into memory.
 func (s *ObjectStorage) LazyWriter() (w io.WriteCloser, wh func(typ plumbing.ObjectType, sz int64) error, err error) {
-	ow, err := s.dir.NewObject()
+	ow, err := s.newObject()
 	if err != nil {
 		return nil, nil, err
 	}
@@ -204,10 +376,116 @@ func (s *ObjectStorage) HasEncodedObject(h plumbing.Hash) (err error) {
 		return err
 	}
 	_, _, offset := s.findObjectInPackfile(h)
-	if offset == -1 {
-		return plumbing.ErrObjectNotFound
+	if offset != -1 {
+		return nil
 	}
-	return nil
+
+	// Check the alternate object directories.
+	for _, o := range s.alternateStorages() {
+		if o.HasEncodedObject(h) == nil {
+			return nil
+		}
+	}
+
+	return plumbing.ErrObjectNotFound
+}
+
+// alternateStorages returns the object storages of the alternate object
+// directories, listed in objects/info/alternates, and of their own
+// alternates, recursively. Each directory is listed once, whatever the
+// cycles of the alternates. The alternates which can't be read are ignored.
+// The storages are built on the first call, and then reused.
+func (s *ObjectStorage) alternateStorages() []*ObjectStorage {
+	if s.isAlternate {
+		return nil
+	}
+
+	s.muA.Lock()
+	defer s.muA.Unlock()
+
+	if s.alternatesRead {
+		return s.alternates
+	}
+
+	var storages []*ObjectStorage
+	seen := map[string]bool{s.dir.Fs().Root(): true}
+	for queue := []*dotgit.DotGit{s.dir}; len(queue) > 0; queue = queue[1:] {
+		dotgits, err := queue[0].Alternates()
+		if err != nil {
+			continue
+		}
+
+		for _, dg := range dotgits {
+			root := dg.Fs().Root()
+			if seen[root] {
+				continue
+			}
+
+			seen[root] = true
+			o := NewObjectStorage(dg, s.objectCache)
+			o.isAlternate = true
+			storages = append(storages, o)
+			queue = append(queue, dg)
+		}
+	}
+
+	s.alternates = storages
+	s.alternatesRead = true
+	return storages
+}
+
+// HasObjects returns whether each of the given objects exists, by hash,
+// looking them up in the indexes of the packfiles, then in the directories
+// of the loose objects, each read once, and in the alternate object
+// directories. It implements storer.BulkObjectStorer.
+func (s *ObjectStorage) HasObjects(hashes []plumbing.Hash) (map[plumbing.Hash]bool, error) {
+	if err := s.requireIndex(); err != nil {
+		return nil, err
+	}
+
+	found := make(map[plumbing.Hash]bool, len(hashes))
+	var missing []plumbing.Hash
+	for _, h := range hashes {
+		if _, _, offset := s.findObjectInPackfile(h); offset != -1 {
+			found[h] = true
+			continue
+		}
+
+		found[h] = false
+		missing = append(missing, h)
+	}
+
+	if len(missing) == 0 {
+		return found, nil
+	}
+
+	loose, err := s.dir.LooseObjects(missing)
+	if err != nil {
+		return nil, err
+	}
+
+	missing = slices.DeleteFunc(missing, func(h plumbing.Hash) bool {
+		found[h] = loose[h]
+		return loose[h]
+	})
+
+	for _, o := range s.alternateStorages() {
+		if len(missing) == 0 {
+			break
+		}
+
+		alternate, err := o.HasObjects(missing)
+		if err != nil {
+			continue
+		}
+
+		missing = slices.DeleteFunc(missing, func(h plumbing.Hash) bool {
+			found[h] = alternate[h]
+			return alternate[h]
+		})
+	}
+
+	return found, nil
 }
 
 func (s *ObjectStorage) encodedObjectSizeFromUnpacked(h plumbing.Hash) (size int64, err error) {
@@ -240,11 +518,13 @@ func (s *ObjectStorage) packfile(idx idxfile.Index, pack plumbing.Hash) (*packfi
 		return nil, err
 	}
 
-	p := packfile.NewPackfile(f,
+	p := packfile.NewPackfile(s.mappings.open(s.dir.Fs(), f),
 		packfile.WithIdx(idx),
 		packfile.WithFs(s.dir.Fs()),
 		packfile.WithCache(s.objectCache),
+		packfile.WithDeltaBaseCache(s.deltaBaseCache),
 		packfile.WithObjectIDSize(pack.Size()),
+		packfile.WithLargeObjectThreshold(s.options.LargeObjectThreshold),
 	)
 	return p, s.storePackfileInCache(pack, p)
 }
@@ -345,12 +625,48 @@ func (s *ObjectStorage) EncodedObjectSize(h plumbing.Hash) (size int64, err erro
 		return size, nil
 	}
 
-	return s.encodedObjectSizeFromPackfile(h)
+	size, err = s.encodedObjectSizeFromPackfile(h)
+	if !errors.Is(err, plumbing.ErrObjectNotFound) {
+		return size, err
+	}
+
+	for _, o := range s.alternateStorages() {
+		if size, aerr := o.EncodedObjectSize(h); aerr == nil {
+			return size, nil
+		}
+	}
+
+	return 0, err
+}
+
+// SetObjectFetcher sets the function used to fetch the objects missing from the
+// storage. It implements storer.PromisorObjectStorer.
+func (s *ObjectStorage) SetObjectFetcher(f storer.ObjectFetcher) {
+	s.fetcher = f
 }
 
 // EncodedObject returns the object with the given hash, by searching for it in
-// the packfile and the git object directories.
+// the packfile and the git object directories. Objects that are not found are
+// fetched with the ObjectFetcher, if any.
 func (s *ObjectStorage) EncodedObject(t plumbing.ObjectType, h plumbing.Hash) (plumbing.EncodedObject, error) {
+	obj, err := s.encodedObject(t, h)
+	if !errors.Is(err, plumbing.ErrObjectNotFound) || s.fetcher == nil {
+		return obj, err
+	}
+
+	// The object may exist with a different type.
+	if s.HasEncodedObject(h) == nil {
+		return nil, err
+	}
+
+	if err := s.fetcher(h); err != nil {
+		return nil, err
+	}
+
+	return s.encodedObject(t, h)
+}
+
+func (s *ObjectStorage) encodedObject(t plumbing.ObjectType, h plumbing.Hash) (plumbing.EncodedObject, error) {
 	var obj plumbing.EncodedObject
 	var err error
 
@@ -369,18 +685,12 @@ func (s *ObjectStorage) EncodedObject(t plumbing.ObjectType, h plumbing.Hash) (p
 	// If the error is still object not found, check if it's a shared object
 	// repository.
 	if errors.Is(err, plumbing.ErrObjectNotFound) {
-		dotgits, e := s.dir.Alternates()
-		if e == nil {
-			// Create a new object storage with the DotGit(s) and check for the
-			// required hash object. Skip when not found.
-			for _, dg := range dotgits {
-				o := NewObjectStorage(dg, s.objectCache)
-				enobj, enerr := o.EncodedObject(t, h)
-				if enerr != nil {
-					continue
-				}
-				return enobj, nil
+		for _, o := range s.alternateStorages() {
+			enobj, enerr := o.EncodedObject(t, h)
+			if enerr != nil {
+				continue
 			}
+			return enobj, nil
 		}
 	}
 
@@ -646,8 +956,8 @@ func (s *ObjectStorage) buildPackfileIters(
 				return nil, err
 			}
 			return newPackfileIter(
-				s.dir.Fs(), pack, t, seen, s.index[h],
-				s.objectCache, s.options.KeepDescriptors, crypto.SHA1.Size(),
+				s.dir.Fs(), s.mappings.open(s.dir.Fs(), pack), t, seen, s.index[h],
+				s.objectCache, s.deltaBaseCache, s.options.KeepDescriptors, crypto.SHA1.Size(),
 			)
 		},
 	}, nil
@@ -670,11 +980,30 @@ func (s *ObjectStorage) Close() error {
 	}
 
 	s.packfiles = nil
+	if err := s.closeCommitGraph(); firstError == nil && err != nil {
+		firstError = err
+	}
 	s.dir.Close()
 
+	s.muA.Lock()
+	for _, o := range s.alternates {
+		if err := o.Close(); firstError == nil && err != nil {
+			firstError = err
+		}
+	}
+	s.alternates = nil
+	s.alternatesRead = false
+	s.muA.Unlock()
+
 	return firstError
 }
 
+// PackMappingStats returns the packfiles currently mapped in memory, see
+// Options.PackAccess.
+func (s *ObjectStorage) PackMappingStats() PackMappingStats {
+	return s.mappings.stats()
+}
+
 func hashListAsMap(l []plumbing.Hash) map[plumbing.Hash]struct{} {
 	m := make(map[plumbing.Hash]struct{}, len(l))
 	for _, h := range l {
@@ -710,3 +1039,182 @@ func (s *ObjectStorage) ObjectPacks() ([]plumbing.Hash, error) {
 func (s *ObjectStorage) DeleteOldObjectPackAndIndex(h plumbing.Hash, t time.Time) error {
 	return s.dir.DeleteOldObjectPackAndIndex(h, t)
 }
+
+// ObjectPackTime returns the modification time of the given packfile. It
+// implements storer.PackedObjectInfoStorer.
+func (s *ObjectStorage) ObjectPackTime(h plumbing.Hash) (time.Time, error) {
+	fi, err := s.dir.ObjectPackStat(h)
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	return fi.ModTime(), nil
+}
+
+// ObjectPackHashes returns the hashes of the objects of the given packfile,
+// read from its index. It implements storer.PackedObjectInfoStorer.
+func (s *ObjectStorage) ObjectPackHashes(h plumbing.Hash) ([]plumbing.Hash, error) {
+	if err := s.requireIndex(); err != nil {
+		return nil, err
+	}
+
+	s.muI.RLock()
+	idx, ok := s.index[h]
+	s.muI.RUnlock()
+	if !ok {
+		return nil, plumbing.ErrObjectNotFound
+	}
+
+	iter, err := idx.Entries()
+	if err != nil {
+		return nil, err
+	}
+
+	defer iter.Close()
+	var hashes []plumbing.Hash
+	for {
+		e, err := iter.Next()
+		if err == io.EOF {
+			return hashes, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		hashes = append(hashes, e.Hash)
+	}
+}
+
+// LooseObjectSize returns the size of the given loose object, read from its
+// header. It implements storer.ObjectSizeStorer.
+func (s *ObjectStorage) LooseObjectSize(h plumbing.Hash) (_ storer.ObjectSize, err error) {
+	fi, err := s.dir.ObjectStat(h)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return storer.ObjectSize{}, plumbing.ErrObjectNotFound
+		}
+
+		return storer.ObjectSize{}, err
+	}
+
+	f, err := s.dir.Object(h)
+	if err != nil {
+		return storer.ObjectSize{}, err
+	}
+	defer ioutil.CheckClose(f, &err)
+
+	r, err := objfile.NewReader(f)
+	if err != nil {
+		return storer.ObjectSize{}, err
+	}
+	defer ioutil.CheckClose(r, &err)
+
+	typ, size, err := r.Header()
+	if err != nil {
+		return storer.ObjectSize{}, err
+	}
+
+	return storer.ObjectSize{Hash: h, Type: typ, Size: size, DiskSize: fi.Size()}, nil
+}
+
+// ObjectPackSize returns the size of the given packfile and of its index. It
+// implements storer.ObjectSizeStorer.
+func (s *ObjectStorage) ObjectPackSize(h plumbing.Hash) (int64, error) {
+	pack, err := s.dir.ObjectPackStat(h)
+	if err != nil {
+		return 0, err
+	}
+
+	idx, err := s.dir.ObjectPackIdxStat(h)
+	if err != nil {
+		return 0, err
+	}
+
+	return pack.Size() + idx.Size(), nil
+}
+
+// ObjectPackSizes returns the sizes of the objects of the given packfile,
+// their size on disk being the distance between their offsets, read from its
+// index, and their type and size being read from their headers. It
+// implements storer.ObjectSizeStorer.
+func (s *ObjectStorage) ObjectPackSizes(h plumbing.Hash) (_ []storer.ObjectSize, err error) {
+	if err := s.requireIndex(); err != nil {
+		return nil, err
+	}
+
+	s.muI.RLock()
+	idx, ok := s.index[h]
+	s.muI.RUnlock()
+	if !ok {
+		return nil, plumbing.ErrObjectNotFound
+	}
+
+	fi, err := s.dir.ObjectPackStat(h)
+	if err != nil {
+		return nil, err
+	}
+
+	iter, err := idx.EntriesByOffset()
+	if err != nil {
+		return nil, err
+	}
+
+	var entries []*idxfile.Entry
+	for {
+		e, err := iter.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			_ = iter.Close()
+			return nil, err
+		}
+
+		entries = append(entries, e)
+	}
+
+	if err := iter.Close(); err != nil {
+		return nil, err
+	}
+
+	p, err := s.packfile(idx, h)
+	if err != nil {
+		return nil, err
+	}
+
+	if !s.options.KeepDescriptors && s.options.MaxOpenDescriptors == 0 {
+		defer ioutil.CheckClose(p, &err)
+	}
+
+	// The last object ends at the checksum of the packfile.
+	end := fi.Size() - int64(h.Size())
+	sizes := make([]storer.ObjectSize, len(entries))
+	for i := len(entries) - 1; i >= 0; i-- {
+		offset := int64(entries[i].Offset)
+		typ, err := p.GetTypeByOffset(offset)
+		if err != nil {
+			return nil, err
+		}
+
+		size, err := p.GetSizeByOffset(offset)
+		if err != nil {
+			return nil, err
+		}
+
+		sizes[i] = storer.ObjectSize{Hash: entries[i].Hash, Type: typ, Size: size, DiskSize: end - offset}
+		end = offset
+	}
+
+	return sizes, nil
+}
+
+// AddAlternate adds the objects of the given repository as an alternate
+// object directory.
+func (s *ObjectStorage) AddAlternate(remote string) error {
+	if err := s.dir.AddAlternate(remote); err != nil {
+		return err
+	}
+
+	s.forgetAlternates()
+	return nil
+}
@@ -0,0 +1,157 @@
+package filesystem
+
+import (
+	"github.com/go-git/go-git/v6/config"
+	"github.com/go-git/go-git/v6/plumbing"
+	"github.com/go-git/go-git/v6/plumbing/format/packfile"
+	"github.com/go-git/go-git/v6/storage/filesystem/dotgit"
+	"github.com/go-git/go-git/v6/utils/ioutil"
+)
+
+// looseObjectWriter is a dotgit.ObjectWriter which packs the loose objects
+// once it is closed, if the auto pack thresholds are exceeded.
+type looseObjectWriter struct {
+	*dotgit.ObjectWriter
+	s *ObjectStorage
+}
+
+// newObject returns a writer of a new loose object, packing the loose
+// objects once it is closed if auto packing is enabled.
+func (s *ObjectStorage) newObject() (*looseObjectWriter, error) {
+	ow, err := s.dir.NewObject()
+	if err != nil {
+		return nil, err
+	}
+
+	return &looseObjectWriter{ObjectWriter: ow, s: s}, nil
+}
+
+// Close writes the loose object, and packs the loose objects if the auto pack
+// thresholds are exceeded. The object is written even if packing fails.
+func (w *looseObjectWriter) Close() error {
+	if err := w.ObjectWriter.Close(); err != nil {
+		return err
+	}
+
+	return w.s.looseObjectWritten(w.Hash())
+}
+
+func (s *ObjectStorage) autoPackEnabled() bool {
+	return s.options.AutoPackThreshold > 0 || s.options.AutoPackThresholdBytes > 0
+}
+
+func (s *ObjectStorage) autoPackThresholdExceeded() bool {
+	return s.options.AutoPackThreshold > 0 && s.looseCount > s.options.AutoPackThreshold ||
+		s.options.AutoPackThresholdBytes > 0 && s.looseSize > s.options.AutoPackThresholdBytes
+}
+
+// looseObjectWritten accounts for the new loose object h, and packs the loose
+// objects if the auto pack thresholds are exceeded.
+//
+// The counters are an estimate, as the objects written more than once, or by
+// others, are not accounted for: they are counted again before packing.
+func (s *ObjectStorage) looseObjectWritten(h plumbing.Hash) error {
+	if !s.autoPackEnabled() {
+		return nil
+	}
+
+	s.muL.Lock()
+	defer s.muL.Unlock()
+
+	if !s.looseCounted {
+		if err := s.countLooseObjects(); err != nil {
+			return err
+		}
+	} else {
+		s.looseCount++
+		if s.options.AutoPackThresholdBytes > 0 {
+			fi, err := s.dir.ObjectStat(h)
+			if err != nil {
+				return err
+			}
+
+			s.looseSize += fi.Size()
+		}
+
+		if !s.autoPackThresholdExceeded() {
+			return nil
+		}
+
+		if err := s.countLooseObjects(); err != nil {
+			return err
+		}
+	}
+
+	if !s.autoPackThresholdExceeded() {
+		return nil
+	}
+
+	return s.packLooseObjects()
+}
+
+// countLooseObjects sets the loose objects counters from the object files.
+func (s *ObjectStorage) countLooseObjects() error {
+	var count int
+	var size int64
+	err := s.ForEachObjectHash(func(h plumbing.Hash) error {
+		count++
+		if s.options.AutoPackThresholdBytes == 0 {
+			return nil
+		}
+
+		fi, err := s.dir.ObjectStat(h)
+		if err != nil {
+			return err
+		}
+
+		size += fi.Size()
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	s.looseCounted = true
+	s.looseCount, s.looseSize = count, size
+	return nil
+}
+
+// packLooseObjects writes all the loose objects to a new packfile, and then
+// deletes them. The packfile is only renamed to its final name once its index
+// is written, and the loose objects are only deleted afterwards, so that the
+// objects are always readable, and left as is if packing fails.
+func (s *ObjectStorage) packLooseObjects() error {
+	var hashes []plumbing.Hash
+	err := s.ForEachObjectHash(func(h plumbing.Hash) error {
+		hashes = append(hashes, h)
+		return nil
+	})
+	if err != nil || len(hashes) == 0 {
+		return err
+	}
+
+	if err := s.writePackfile(hashes); err != nil {
+		return err
+	}
+
+	for _, h := range hashes {
+		if err := s.dir.ObjectDelete(h); err != nil {
+			return err
+		}
+	}
+
+	s.looseCount, s.looseSize = 0, 0
+	return nil
+}
+
+func (s *ObjectStorage) writePackfile(hashes []plumbing.Hash) (err error) {
+	w, err := s.PackfileWriter()
+	if err != nil {
+		return err
+	}
+
+	defer ioutil.CheckClose(w, &err)
+
+	_, err = packfile.NewEncoder(w, s, false).Encode(hashes, config.DefaultPackWindow)
+	return err
+}
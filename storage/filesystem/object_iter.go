@@ -91,7 +91,7 @@ func NewPackfileIter(
 	}
 
 	seen := make(map[plumbing.Hash]struct{})
-	return newPackfileIter(fs, f, t, seen, idx, nil, keepPack, objectIDSize)
+	return newPackfileIter(fs, f, t, seen, idx, nil, nil, keepPack, objectIDSize)
 }
 
 func newPackfileIter(
@@ -101,12 +101,14 @@ func newPackfileIter(
 	seen map[plumbing.Hash]struct{},
 	index idxfile.Index,
 	cache cache.Object,
+	deltaBaseCache *packfile.DeltaBaseCache,
 	keepPack bool,
 	objectIDSize int,
 ) (storer.EncodedObjectIter, error) {
 	p := packfile.NewPackfile(f,
 		packfile.WithFs(fs),
 		packfile.WithCache(cache),
+		packfile.WithDeltaBaseCache(deltaBaseCache),
 		packfile.WithIdx(index),
 		packfile.WithObjectIDSize(objectIDSize),
 	)
@@ -1,21 +1,30 @@
 package filesystem
 
 import (
+	"compress/zlib"
+	"context"
 	"crypto"
 	"encoding/hex"
 	"fmt"
 	"io"
 	"os"
+	"os/exec"
 	"path/filepath"
+	"slices"
+	"strings"
 	"testing"
 
 	"github.com/go-git/go-billy/v6"
+	"github.com/go-git/go-billy/v6/osfs"
 	fixtures "github.com/go-git/go-git-fixtures/v5"
 	"github.com/stretchr/testify/suite"
 
 	"github.com/go-git/go-git/v6/plumbing"
 	"github.com/go-git/go-git/v6/plumbing/cache"
+	"github.com/go-git/go-git/v6/plumbing/format/objfile"
+	"github.com/go-git/go-git/v6/plumbing/format/packfile"
 	"github.com/go-git/go-git/v6/storage/filesystem/dotgit"
+	"github.com/go-git/go-git/v6/utils/ioutil"
 )
 
 type FsSuite struct {
@@ -128,6 +137,149 @@ func (s *FsSuite) TestGetFromPackfileMaxOpenDescriptorsLargeObjectThreshold() {
 	s.Require().NoError(err)
 }
 
+func (s *FsSuite) TestGetFromPackfilePackAccess() {
+	hashes := []plumbing.Hash{
+		plumbing.NewHash("8d45a34641d73851e01d3754320b33bb5be3c4d3"),
+		plumbing.NewHash("e9cfa4c9ca160546efd7e8582ec77952a27b17db"),
+	}
+
+	want := make(map[plumbing.Hash][]byte)
+	fs := fixtures.ByTag(".git").ByTag("multi-packfile").One().DotGit(fixtures.WithTargetDir(s.T().TempDir))
+	o := NewObjectStorage(dotgit.New(fs), cache.NewObjectLRUDefault())
+	for _, h := range hashes {
+		obj, err := o.getFromPackfile(h, false)
+		s.Require().NoError(err)
+		want[h], err = readObject(obj)
+		s.Require().NoError(err)
+	}
+	s.Equal(PackMappingStats{}, o.PackMappingStats())
+
+	tests := []struct {
+		name  string
+		ops   Options
+		packs []int
+	}{
+		{name: "read"},
+		{name: "mmap", ops: Options{PackAccess: PackAccessMmap}, packs: []int{1, 2}},
+		{name: "max mapped", ops: Options{PackAccess: PackAccessMmap, MaxMappedPacks: 1}, packs: []int{1, 1}},
+		{name: "auto", ops: Options{PackAccess: PackAccessAuto}, packs: []int{1, 2}},
+		{name: "auto threshold", ops: Options{PackAccess: PackAccessAuto, PackMmapThreshold: 1}},
+	}
+
+	for _, tc := range tests {
+		s.Run(tc.name, func() {
+			if tc.packs != nil && !mmapSupported {
+				s.T().Skip("mmap is not supported")
+			}
+
+			tc.ops.KeepDescriptors = true
+			o := NewObjectStorageWithOptions(dotgit.New(fs), cache.NewObjectLRUDefault(), tc.ops)
+			for i, h := range hashes {
+				obj, err := o.getFromPackfile(h, false)
+				s.Require().NoError(err)
+				content, err := readObject(obj)
+				s.Require().NoError(err)
+				s.Equal(want[h], content)
+
+				stats := o.PackMappingStats()
+				if tc.packs == nil {
+					s.Equal(PackMappingStats{}, stats)
+					continue
+				}
+
+				s.Equal(tc.packs[i], stats.Packs)
+				s.Positive(stats.Bytes)
+			}
+
+			// The unmapped packfiles are mapped again once read.
+			for _, h := range hashes {
+				o.objectCache.Clear()
+				obj, err := o.getFromPackfile(h, false)
+				s.Require().NoError(err)
+				content, err := readObject(obj)
+				s.Require().NoError(err)
+				s.Equal(want[h], content)
+			}
+
+			s.Require().NoError(o.Close())
+			s.Equal(PackMappingStats{}, o.PackMappingStats())
+		})
+	}
+}
+
+func (s *FsSuite) TestGetFromPackfileLargeDeltaObjects() {
+	fs := fixtures.Basic().ByTag(".git").One().DotGit()
+	o := NewObjectStorage(dotgit.New(fs), cache.NewObjectLRUDefault())
+	large := NewObjectStorageWithOptions(dotgit.New(fs), cache.NewObjectLRUDefault(), Options{LargeObjectThreshold: 1})
+
+	iter, err := o.IterEncodedObjects(plumbing.AnyObject)
+	s.Require().NoError(err)
+
+	var deltas int
+	s.Require().NoError(iter.ForEach(func(expected plumbing.EncodedObject) error {
+		obj, err := large.EncodedObject(plumbing.AnyObject, expected.Hash())
+		s.Require().NoError(err)
+		s.Equal(expected.Type(), obj.Type())
+		s.Equal(expected.Size(), obj.Size())
+		switch obj.(type) {
+		case *plumbing.MemoryObject, *packfile.FSObject:
+		default:
+			deltas++
+		}
+
+		content, err := readObject(expected)
+		s.Require().NoError(err)
+		got, err := readObject(obj)
+		s.Require().NoError(err)
+		s.Equal(content, got, expected.Hash().String())
+		return nil
+	}))
+
+	// The objects stored as deltas are streamed too.
+	s.NotZero(deltas)
+}
+
+func (s *FsSuite) TestGetFromPackfileDeltaBaseCache() {
+	fs := fixtures.Basic().ByTag(".git").One().DotGit()
+	o := NewObjectStorage(dotgit.New(fs), cache.NewObjectLRUDefault())
+	iter, err := o.IterEncodedObjects(plumbing.AnyObject)
+	s.Require().NoError(err)
+
+	want := make(map[plumbing.Hash][]byte)
+	s.Require().NoError(iter.ForEach(func(obj plumbing.EncodedObject) error {
+		content, err := readObject(obj)
+		want[obj.Hash()] = content
+		return err
+	}))
+
+	// The bases are held by the delta base cache, the object cache holding
+	// none of them, but not once it is disabled.
+	for _, limit := range []int64{0, -1} {
+		o := NewObjectStorageWithOptions(dotgit.New(fs), cache.NewObjectLRU(1), Options{DeltaBaseCacheLimit: limit})
+		for h, content := range want {
+			obj, err := o.EncodedObject(plumbing.AnyObject, h)
+			s.Require().NoError(err)
+			got, err := readObject(obj)
+			s.Require().NoError(err)
+			s.Equal(content, got, h.String())
+		}
+
+		s.Equal(limit == 0, o.deltaBaseCache.Size() > 0, limit)
+		o.Reindex()
+		s.Zero(o.deltaBaseCache.Size())
+	}
+}
+
+func readObject(obj plumbing.EncodedObject) (_ []byte, err error) {
+	r, err := obj.Reader()
+	if err != nil {
+		return nil, err
+	}
+	defer ioutil.CheckClose(r, &err)
+
+	return io.ReadAll(r)
+}
+
 func (s *FsSuite) TestGetSizeOfObjectFile() {
 	fs := fixtures.ByTag(".git").ByTag("unpacked").One().DotGit()
 	o := NewObjectStorage(dotgit.New(fs), cache.NewObjectLRUDefault())
@@ -166,6 +318,34 @@ func (s *FsSuite) TestGetSizeOfAllObjectFiles() {
 	s.Require().NoError(err)
 }
 
+func (s *FsSuite) TestHasObjectsUnpacked() {
+	fs := fixtures.ByTag(".git").ByTag("unpacked").One().DotGit()
+	for _, exclusive := range []bool{false, true} {
+		o := NewObjectStorageWithOptions(dotgit.NewWithOptions(fs, dotgit.Options{ExclusiveAccess: exclusive}),
+			cache.NewObjectLRUDefault(), Options{ExclusiveAccess: exclusive})
+
+		expected := map[plumbing.Hash]bool{
+			plumbing.NewHash("cbd81c47be12341eb1185b379d1c82675aeded6a"): true,
+			plumbing.NewHash("cbd81c47be12341eb1185b379d1c82675aeded6b"): false,
+			plumbing.NewHash("0000000000000000000000000000000000000001"): false,
+		}
+
+		s.Require().NoError(o.ForEachObjectHash(func(h plumbing.Hash) error {
+			expected[h] = true
+			return nil
+		}))
+
+		var hashes []plumbing.Hash
+		for h := range expected {
+			hashes = append(hashes, h)
+		}
+
+		found, err := o.HasObjects(hashes)
+		s.Require().NoError(err)
+		s.Equal(expected, found)
+	}
+}
+
 func (s *FsSuite) TestGetFromPackfileMultiplePackfiles() {
 	fs := fixtures.ByTag(".git").ByTag("multi-packfile").One().DotGit()
 	o := NewObjectStorage(dotgit.New(fs), cache.NewObjectLRUDefault())
@@ -338,6 +518,76 @@ func (s *FsSuite) TestPackfileReindex() {
 	}
 }
 
+func (s *FsSuite) TestObjectPackHashes() {
+	f := fixtures.Basic().ByTag(".git").One()
+	o := NewObjectStorage(dotgit.New(f.DotGit()), cache.NewObjectLRUDefault())
+
+	pack := plumbing.NewHash(f.PackfileHash)
+	hashes, err := o.ObjectPackHashes(pack)
+	s.Require().NoError(err)
+	s.Len(hashes, 31)
+	s.Contains(hashes, plumbing.NewHash("6ecf0ef2c2dffb796033e5a02219af86ec6584e5"))
+
+	t, err := o.ObjectPackTime(pack)
+	s.Require().NoError(err)
+	s.False(t.IsZero())
+
+	_, err = o.ObjectPackHashes(plumbing.ZeroHash)
+	s.ErrorIs(err, plumbing.ErrObjectNotFound)
+}
+
+func (s *FsSuite) TestObjectPackSizes() {
+	f := fixtures.Basic().ByTag(".git").One()
+	o := NewObjectStorage(dotgit.New(f.DotGit()), cache.NewObjectLRUDefault())
+
+	pack := plumbing.NewHash(f.PackfileHash)
+	sizes, err := o.ObjectPackSizes(pack)
+	s.Require().NoError(err)
+	s.Len(sizes, 31)
+
+	// The objects, some of them deltas, fill the packfile between its header
+	// and its checksum.
+	var disk int64
+	for _, size := range sizes {
+		obj, err := o.EncodedObject(plumbing.AnyObject, size.Hash)
+		s.Require().NoError(err)
+		s.Equal(obj.Type(), size.Type, size.Hash.String())
+		s.Equal(obj.Size(), size.Size, size.Hash.String())
+		disk += size.DiskSize
+	}
+
+	fi, err := o.dir.ObjectPackStat(pack)
+	s.Require().NoError(err)
+	s.Equal(fi.Size()-12-int64(pack.Size()), disk)
+
+	packSize, err := o.ObjectPackSize(pack)
+	s.Require().NoError(err)
+	idx, err := o.dir.ObjectPackIdxStat(pack)
+	s.Require().NoError(err)
+	s.Equal(fi.Size()+idx.Size(), packSize)
+
+	_, err = o.ObjectPackSizes(plumbing.ZeroHash)
+	s.ErrorIs(err, plumbing.ErrObjectNotFound)
+}
+
+func (s *FsSuite) TestLooseObjectSize() {
+	fs := fixtures.ByTag(".git").ByTag("unpacked").One().DotGit()
+	o := NewObjectStorage(dotgit.New(fs), cache.NewObjectLRUDefault())
+
+	h := plumbing.NewHash("0097821d427a3c3385898eb13b50dcbc8702b8a3")
+	size, err := o.LooseObjectSize(h)
+	s.Require().NoError(err)
+	s.Equal(plumbing.BlobObject, size.Type)
+	s.Equal(int64(6019), size.Size)
+
+	fi, err := o.dir.ObjectStat(h)
+	s.Require().NoError(err)
+	s.Equal(fi.Size(), size.DiskSize)
+
+	_, err = o.LooseObjectSize(plumbing.ZeroHash)
+	s.ErrorIs(err, plumbing.ErrObjectNotFound)
+}
+
 func (s *FsSuite) TestPackfileIterKeepDescriptors() {
 	for _, f := range fixtures.ByTag(".git") {
 		fs := f.DotGit()
@@ -607,3 +857,407 @@ func (s *FsSuite) TestGetFromUnpackedDoesNotCacheLargeObjects() {
 	_, ok = objectCache.Get(hash)
 	s.False(ok)
 }
+
+func (s *FsSuite) TestSharedObjectCache() {
+	shared := cache.NewObjectLRUDefault()
+	newStorage := func(f *fixtures.Fixture) *Storage {
+		return NewStorageWithOptions(f.DotGit(), shared, Options{SharedObjectCache: true})
+	}
+
+	readAll := func(sto *Storage) []plumbing.Hash {
+		iter, err := sto.IterEncodedObjects(plumbing.AnyObject)
+		s.Require().NoError(err)
+
+		var hashes []plumbing.Hash
+		s.Require().NoError(iter.ForEach(func(o plumbing.EncodedObject) error {
+			h := o.Hash()
+			obj, err := sto.EncodedObject(plumbing.AnyObject, h)
+			s.Require().NoError(err)
+
+			r, err := obj.Reader()
+			s.Require().NoError(err)
+			_, err = io.Copy(io.Discard, r)
+			s.Require().NoError(err)
+			s.Require().NoError(r.Close())
+
+			hashes = append(hashes, h)
+			return nil
+		}))
+		return hashes
+	}
+
+	fork := newStorage(fixtures.Basic().One())
+	hashes := readAll(fork)
+
+	// Only the objects held in memory, the delta ones, are cached.
+	stats := shared.Stats()
+	s.NotZero(stats.Objects)
+	s.Less(stats.Objects, len(hashes))
+	for _, h := range hashes {
+		if obj, ok := shared.Get(h); ok {
+			s.IsType(&plumbing.MemoryObject{}, obj)
+		}
+	}
+
+	// The cached objects are reused by the other storages.
+	hits := shared.Stats().Hits
+	readAll(newStorage(fixtures.Basic().One()))
+	s.Greater(shared.Stats().Hits, hits)
+
+	// A storage doesn't return the cached objects it doesn't hold.
+	other := newStorage(fixtures.ByTag("tags").One())
+	for _, h := range hashes {
+		if _, ok := shared.Get(h); ok {
+			_, err := other.EncodedObject(plumbing.AnyObject, h)
+			s.ErrorIs(err, plumbing.ErrObjectNotFound)
+		}
+	}
+
+	fork.Reindex()
+	s.Equal(stats.Objects, shared.Stats().Objects)
+}
+
+func (s *FsSuite) TestAlternatesRecursive() {
+	dir := s.T().TempDir()
+	fixtures.Basic().One().DotGit(fixtures.WithTargetDir(func() string { return filepath.Join(dir, "base.git") }))
+
+	newRepository := func(name string, alternates ...string) {
+		fs, err := osfs.New(dir).Chroot(name)
+		s.Require().NoError(err)
+		s.Require().NoError(dotgit.New(fs).Initialize())
+		s.Require().NoError(fs.MkdirAll(fs.Join("objects", "info"), 0o755))
+		content := "# shared objects\n\n" + strings.Join(alternates, "\n") + "\n"
+		s.Require().NoError(os.WriteFile(filepath.Join(dir, name, "objects", "info", "alternates"), []byte(content), 0o644))
+	}
+
+	// The alternates of fork are relative to its objects directory, and
+	// point back to it.
+	newRepository("fork.git", "../../mid.git/objects")
+	newRepository("mid.git", filepath.Join(dir, "base.git", "objects"), "../../fork.git/objects")
+
+	fs, err := osfs.New(dir).Chroot("fork.git")
+	s.Require().NoError(err)
+	sto := NewStorageWithOptions(fs, cache.NewObjectLRUDefault(), Options{AlternatesFS: osfs.New(dir)})
+
+	master := plumbing.NewHash("6ecf0ef2c2dffb796033e5a02219af86ec6584e5")
+	obj, err := sto.EncodedObject(plumbing.CommitObject, master)
+	s.Require().NoError(err)
+	s.Equal(master, obj.Hash())
+	s.NoError(sto.HasEncodedObject(master))
+	size, err := sto.EncodedObjectSize(master)
+	s.Require().NoError(err)
+	s.Equal(obj.Size(), size)
+
+	missing := plumbing.NewHash("1111111111111111111111111111111111111111")
+	_, err = sto.EncodedObject(plumbing.AnyObject, missing)
+	s.ErrorIs(err, plumbing.ErrObjectNotFound)
+	s.ErrorIs(sto.HasEncodedObject(missing), plumbing.ErrObjectNotFound)
+	found, err := sto.HasObjects([]plumbing.Hash{master, missing})
+	s.Require().NoError(err)
+	s.Equal(map[plumbing.Hash]bool{master: true, missing: false}, found)
+
+	// The objects are written to the primary object directory.
+	h := writeBlob(s, sto, "fork\n")
+	_, err = os.Stat(filepath.Join(dir, "fork.git", "objects", h.String()[:2], h.String()[2:]))
+	s.NoError(err)
+	_, err = os.Stat(filepath.Join(dir, "base.git", "objects", h.String()[:2], h.String()[2:]))
+	s.True(os.IsNotExist(err))
+
+	// The alternates are read once, until the storage is reindexed or an
+	// alternate is added.
+	storages := sto.alternateStorages()
+	s.Len(storages, 2)
+	s.Require().NoError(os.Remove(filepath.Join(dir, "fork.git", "objects", "info", "alternates")))
+	s.NoError(sto.HasEncodedObject(master))
+	s.Equal(storages, sto.alternateStorages())
+
+	sto.Reindex()
+	s.ErrorIs(sto.HasEncodedObject(master), plumbing.ErrObjectNotFound)
+	s.Require().NoError(sto.AddAlternate(filepath.Join(dir, "base.git")))
+	s.NoError(sto.HasEncodedObject(master))
+}
+
+func writeBlob(s *FsSuite, sto *Storage, content string) plumbing.Hash {
+	o := sto.NewEncodedObject()
+	o.SetType(plumbing.BlobObject)
+	w, err := o.Writer()
+	s.Require().NoError(err)
+	_, err = io.WriteString(w, content)
+	s.Require().NoError(err)
+	s.Require().NoError(w.Close())
+
+	h, err := sto.SetEncodedObject(o)
+	s.Require().NoError(err)
+	return h
+}
+
+func (s *FsSuite) TestLooseCompressionLevel() {
+	content := strings.Repeat("go-git compresses loose objects. ", 1000)
+
+	size := func(level int) int64 {
+		fs := osfs.New(s.T().TempDir())
+		sto := NewStorageWithOptions(fs, cache.NewObjectLRUDefault(), Options{LooseCompressionLevel: level})
+		h := writeBlob(s, sto, content)
+
+		fi, err := sto.dir.ObjectStat(h)
+		s.Require().NoError(err)
+
+		obj, err := sto.EncodedObject(plumbing.BlobObject, h)
+		s.Require().NoError(err)
+		r, err := obj.Reader()
+		s.Require().NoError(err)
+		b, err := io.ReadAll(r)
+		s.Require().NoError(err)
+		s.Require().NoError(r.Close())
+		s.Equal(content, string(b))
+
+		return fi.Size()
+	}
+
+	def := size(0)
+	s.Greater(size(zlib.HuffmanOnly), def)
+	s.Equal(def, size(zlib.DefaultCompression))
+	s.LessOrEqual(size(zlib.BestCompression), def)
+}
+
+func (s *FsSuite) TestLooseCompressionZstd() {
+	fs := osfs.New(s.T().TempDir())
+	zlibSto := NewStorage(fs, cache.NewObjectLRUDefault())
+	zstdSto := NewStorageWithOptions(fs, cache.NewObjectLRUDefault(), Options{LooseCompression: objfile.ZstdCompression})
+
+	zlibHash := writeBlob(s, zlibSto, "compressed with zlib")
+	zstdHash := writeBlob(s, zstdSto, "compressed with zstd")
+
+	f, err := zstdSto.dir.Object(zstdHash)
+	s.Require().NoError(err)
+	magic := make([]byte, 4)
+	_, err = io.ReadFull(f, magic)
+	s.Require().NoError(err)
+	s.Require().NoError(f.Close())
+	s.Equal([]byte{0x28, 0xb5, 0x2f, 0xfd}, magic)
+
+	// Both storages read the loose objects whatever their compression.
+	for _, sto := range []*Storage{zlibSto, zstdSto} {
+		for h, content := range map[plumbing.Hash]string{
+			zlibHash: "compressed with zlib",
+			zstdHash: "compressed with zstd",
+		} {
+			obj, err := sto.EncodedObject(plumbing.AnyObject, h)
+			s.Require().NoError(err)
+			s.Equal(int64(len(content)), obj.Size())
+
+			r, err := obj.Reader()
+			s.Require().NoError(err)
+			b, err := io.ReadAll(r)
+			s.Require().NoError(err)
+			s.Require().NoError(r.Close())
+			s.Equal(content, string(b))
+		}
+	}
+}
+
+func (s *FsSuite) TestPackfileWriterThinPack() {
+	fs := osfs.New(s.T().TempDir())
+	sto := NewStorage(fs, cache.NewObjectLRUDefault())
+	spinnaker := fixtures.ByURL("https://github.com/spinnaker/spinnaker.git").One()
+	s.Require().NoError(packfile.UpdateObjectStorage(sto, spinnaker.Packfile()))
+	thinpack := fixtures.ByTag("thinpack").One()
+	head := plumbing.NewHash(thinpack.Head)
+
+	packs, err := sto.ObjectPacks()
+	s.Require().NoError(err)
+
+	w, err := sto.PackfileWriter()
+	s.Require().NoError(err)
+	_, err = io.Copy(w, thinpack.Packfile())
+	s.Require().NoError(err)
+	s.Require().NoError(w.Close())
+
+	after, err := sto.ObjectPacks()
+	s.Require().NoError(err)
+	s.Require().Len(after, len(packs)+1)
+
+	var fixed plumbing.Hash
+	for _, h := range after {
+		if !slices.Contains(packs, h) {
+			fixed = h
+		}
+	}
+
+	// The written packfile is completed with the bases of its deltas, so it
+	// is parsed without the other objects of the repository.
+	f, err := sto.dir.ObjectPack(fixed)
+	s.Require().NoError(err)
+	checksum, err := packfile.NewParser(f).Parse()
+	s.Require().NoError(err)
+	s.Equal(fixed, checksum)
+	s.Require().NoError(f.Close())
+
+	sto = NewStorage(fs, cache.NewObjectLRUDefault())
+	_, err = sto.EncodedObject(plumbing.CommitObject, head)
+	s.Require().NoError(err)
+}
+
+func (s *FsSuite) TestPackfileWriterContextCancel() {
+	fs := osfs.New(s.T().TempDir())
+	sto := NewStorage(fs, cache.NewObjectLRUDefault())
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	err := packfile.UpdateObjectStorageWithOptions(sto, fixtures.Basic().One().Packfile(), packfile.WithContext(ctx))
+	s.ErrorIs(err, context.Canceled)
+
+	// The temp file of the packfile is removed.
+	entries, err := fs.ReadDir("objects/pack")
+	s.Require().NoError(err)
+	s.Empty(entries)
+}
+
+func (s *FsSuite) TestPackfileWriterMaxMemory() {
+	f := fixtures.Basic().One()
+	sto := NewStorageWithOptions(osfs.New(s.T().TempDir()), cache.NewObjectLRUDefault(), Options{PackfileMaxMemory: 1})
+
+	err := packfile.UpdateObjectStorage(sto, f.Packfile())
+	s.Require().NoError(err)
+
+	iter, err := sto.IterEncodedObjects(plumbing.AnyObject)
+	s.Require().NoError(err)
+
+	var count int
+	err = iter.ForEach(func(o plumbing.EncodedObject) error {
+		count++
+		return nil
+	})
+	s.Require().NoError(err)
+	s.Equal(31, count)
+
+	packs, err := sto.ObjectPacks()
+	s.Require().NoError(err)
+	s.Equal([]plumbing.Hash{plumbing.NewHash(f.PackfileHash)}, packs)
+}
+
+func (s *FsSuite) TestAutoPackThreshold() {
+	dir := s.T().TempDir()
+	sto := NewStorageWithOptions(osfs.New(dir), cache.NewObjectLRUDefault(), Options{AutoPackThreshold: 3})
+
+	var hashes []plumbing.Hash
+	for i := 0; i < 3; i++ {
+		hashes = append(hashes, writeBlob(s, sto, fmt.Sprintf("blob %d", i)))
+	}
+
+	packs, err := sto.ObjectPacks()
+	s.Require().NoError(err)
+	s.Len(packs, 0)
+
+	hashes = append(hashes, writeBlob(s, sto, "blob 3"))
+	packs, err = sto.ObjectPacks()
+	s.Require().NoError(err)
+	s.Require().Len(packs, 1)
+	s.Equal(0, countLooseObjects(s, sto))
+
+	hashes = append(hashes, writeBlob(s, sto, "blob 4"))
+	s.Equal(1, countLooseObjects(s, sto))
+
+	for i, h := range hashes {
+		obj, err := sto.EncodedObject(plumbing.BlobObject, h)
+		s.Require().NoError(err)
+		r, err := obj.Reader()
+		s.Require().NoError(err)
+		b, err := io.ReadAll(r)
+		s.Require().NoError(err)
+		s.Require().NoError(r.Close())
+		s.Equal(fmt.Sprintf("blob %d", i), string(b))
+	}
+
+	// The objects are read from the packfile by a new storage as well.
+	sto = NewStorage(osfs.New(dir), cache.NewObjectLRUDefault())
+	for _, h := range hashes {
+		s.NoError(sto.HasEncodedObject(h))
+	}
+
+	if _, err := exec.LookPath("git"); err != nil {
+		return
+	}
+
+	idx := filepath.Join(dir, "objects", "pack", fmt.Sprintf("pack-%s.idx", packs[0]))
+	out, err := exec.Command("git", "verify-pack", "-v", idx).CombinedOutput()
+	s.Require().NoError(err, string(out))
+	for _, h := range hashes[:4] {
+		s.Contains(string(out), h.String())
+	}
+}
+
+func (s *FsSuite) TestAutoPackThresholdBytes() {
+	sto := NewStorageWithOptions(osfs.New(s.T().TempDir()), cache.NewObjectLRUDefault(), Options{AutoPackThresholdBytes: 1})
+
+	h := writeBlob(s, sto, "blob")
+	packs, err := sto.ObjectPacks()
+	s.Require().NoError(err)
+	s.Len(packs, 1)
+	s.Equal(0, countLooseObjects(s, sto))
+	s.NoError(sto.HasEncodedObject(h))
+}
+
+func (s *FsSuite) TestNewObjectWriterBigFileThreshold() {
+	dir := s.T().TempDir()
+	sto := NewStorageWithOptions(osfs.New(dir), cache.NewObjectLRUDefault(), Options{BigFileThreshold: 1024})
+
+	write := func(content string) plumbing.Hash {
+		w, err := sto.NewObjectWriter(plumbing.BlobObject)
+		s.Require().NoError(err)
+		_, err = io.WriteString(w, content)
+		s.Require().NoError(err)
+		s.Require().NoError(w.Close())
+		return w.Hash()
+	}
+
+	// The small objects are written as loose objects, the big ones to a
+	// packfile of their own.
+	small := write("small")
+	s.Equal(1, countLooseObjects(s, sto))
+	big := strings.Repeat("big\n", 1024)
+	h := write(big)
+	s.Equal(1, countLooseObjects(s, sto))
+	packs, err := sto.ObjectPacks()
+	s.Require().NoError(err)
+	s.Require().Len(packs, 1)
+
+	// The temporary files are removed.
+	entries, err := os.ReadDir(filepath.Join(dir, "objects", "pack"))
+	s.Require().NoError(err)
+	for _, e := range entries {
+		s.False(strings.HasPrefix(e.Name(), "tmp_"), e.Name())
+	}
+
+	sto = NewStorage(osfs.New(dir), cache.NewObjectLRUDefault())
+	for h, content := range map[plumbing.Hash]string{small: "small", h: big} {
+		obj, err := sto.EncodedObject(plumbing.BlobObject, h)
+		s.Require().NoError(err)
+		r, err := obj.Reader()
+		s.Require().NoError(err)
+		b, err := io.ReadAll(r)
+		s.Require().NoError(err)
+		s.Require().NoError(r.Close())
+		s.Equal(content, string(b))
+	}
+
+	if _, err := exec.LookPath("git"); err != nil {
+		return
+	}
+
+	idx := filepath.Join(dir, "objects", "pack", fmt.Sprintf("pack-%s.idx", packs[0]))
+	out, err := exec.Command("git", "verify-pack", "-v", idx).CombinedOutput()
+	s.Require().NoError(err, string(out))
+	s.Contains(string(out), h.String())
+}
+
+func countLooseObjects(s *FsSuite, sto *Storage) int {
+	var n int
+	err := sto.ForEachObjectHash(func(plumbing.Hash) error {
+		n++
+		return nil
+	})
+	s.Require().NoError(err)
+	return n
+}
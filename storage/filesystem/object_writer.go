@@ -0,0 +1,123 @@
+package filesystem
+
+import (
+	"io"
+
+	"github.com/go-git/go-billy/v6"
+
+	"github.com/go-git/go-git/v6/plumbing"
+	"github.com/go-git/go-git/v6/plumbing/format/packfile"
+	"github.com/go-git/go-git/v6/plumbing/storer"
+	"github.com/go-git/go-git/v6/utils/ioutil"
+)
+
+// NewObjectWriter implements storer.StreamingObjectStorer. As the size of
+// an object is part of its header, and so of its hash, the content is
+// written to a temporary file, from which the object is hashed and written
+// once the writer is closed: to a loose object, or to a packfile of its own
+// if it is larger than Options.BigFileThreshold. The temporary file is then
+// removed.
+func (s *ObjectStorage) NewObjectWriter(typ plumbing.ObjectType) (storer.ObjectWriter, error) {
+	if !typ.Valid() || typ.IsDelta() {
+		return nil, plumbing.ErrInvalidType
+	}
+
+	f, err := s.dir.NewObjectTempFile()
+	if err != nil {
+		return nil, err
+	}
+
+	return &objectWriter{s: s, typ: typ, f: f}, nil
+}
+
+// objectWriter is the storer.ObjectWriter of an ObjectStorage.
+type objectWriter struct {
+	s    *ObjectStorage
+	typ  plumbing.ObjectType
+	f    billy.File
+	size int64
+	hash plumbing.Hash
+}
+
+func (w *objectWriter) Write(p []byte) (int, error) {
+	n, err := w.f.Write(p)
+	w.size += int64(n)
+	return n, err
+}
+
+// Close writes the object from the temporary file, and removes it.
+func (w *objectWriter) Close() (err error) {
+	fs := w.s.dir.Fs()
+	defer func() {
+		if rerr := fs.Remove(w.f.Name()); err == nil {
+			err = rerr
+		}
+	}()
+
+	if err := w.f.Close(); err != nil {
+		return err
+	}
+
+	f, err := fs.Open(w.f.Name())
+	if err != nil {
+		return err
+	}
+
+	defer ioutil.CheckClose(f, &err)
+
+	if t := w.s.options.BigFileThreshold; t > 0 && w.size > t {
+		w.hash, err = w.s.writeObjectPackfile(w.typ, w.size, f)
+	} else {
+		w.hash, err = w.s.writeLooseObject(w.typ, w.size, f)
+	}
+
+	return err
+}
+
+// Hash returns the hash of the object, once the writer is closed.
+func (w *objectWriter) Hash() plumbing.Hash {
+	return w.hash
+}
+
+// writeLooseObject writes a loose object of the given type and size, whose
+// content is read from r.
+func (s *ObjectStorage) writeLooseObject(typ plumbing.ObjectType, size int64, r io.Reader) (plumbing.Hash, error) {
+	ow, err := s.newObject()
+	if err != nil {
+		return plumbing.ZeroHash, err
+	}
+
+	if err := ow.WriteHeader(typ, size); err != nil {
+		_ = ow.Close()
+		return plumbing.ZeroHash, err
+	}
+
+	if _, err := ioutil.CopyBufferPool(ow, r); err != nil {
+		_ = ow.Close()
+		return plumbing.ZeroHash, err
+	}
+
+	if err := ow.Close(); err != nil {
+		return plumbing.ZeroHash, err
+	}
+
+	return ow.Hash(), nil
+}
+
+// writeObjectPackfile writes a packfile holding the single object of the
+// given type and size, whose content is read from r.
+func (s *ObjectStorage) writeObjectPackfile(typ plumbing.ObjectType, size int64, r io.Reader) (h plumbing.Hash, err error) {
+	w, err := s.PackfileWriter()
+	if err != nil {
+		return plumbing.ZeroHash, err
+	}
+
+	defer ioutil.CheckClose(w, &err)
+
+	hasher := plumbing.NewHasher(s.options.ObjectFormat, typ, size)
+	if _, err := packfile.NewEncoder(w, s, false).EncodeObject(typ, size, io.TeeReader(r, hasher)); err != nil {
+		return plumbing.ZeroHash, err
+	}
+
+	return hasher.Sum(), nil
+}
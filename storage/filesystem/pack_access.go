@@ -0,0 +1,318 @@
+package filesystem
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+
+	"github.com/go-git/go-billy/v6"
+)
+
+// PackAccess is how the packfiles of a storage are accessed.
+type PackAccess int
+
+const (
+	// PackAccessRead reads the packfiles from their files, as the objects
+	// are read. It is the default.
+	PackAccessRead PackAccess = iota
+	// PackAccessMmap maps the packfiles in memory, their objects being read
+	// from the mapping, whose pages are cached by the OS. The packfiles are
+	// read instead where they can't be mapped: on the filesystems other than
+	// the OS one, and on the systems other than the unix ones.
+	PackAccessMmap
+	// PackAccessAuto maps the packfiles up to Options.PackMmapThreshold
+	// bytes, as PackAccessMmap, and reads the bigger ones, as
+	// PackAccessRead, for the address space mapped to remain bounded.
+	PackAccessAuto
+)
+
+// DefaultPackMmapThreshold is the size, in bytes, of the biggest packfiles
+// mapped with PackAccessAuto, if Options.PackMmapThreshold is unset.
+const DefaultPackMmapThreshold = 256 << 20
+
+func (a PackAccess) String() string {
+	switch a {
+	case PackAccessRead:
+		return "read"
+	case PackAccessMmap:
+		return "mmap"
+	case PackAccessAuto:
+		return "auto"
+	default:
+		return "unknown"
+	}
+}
+
+// PackMappingStats are the packfiles of a storage currently mapped in
+// memory, see Options.PackAccess.
+type PackMappingStats struct {
+	// Packs is the number of packfiles mapped.
+	Packs int
+	// Bytes is the size, in bytes, of the packfiles mapped.
+	Bytes int64
+}
+
+// packMappings maps the packfiles of a storage in memory, following its
+// PackAccess, unmapping the least recently used ones once more than
+// MaxMappedPacks are mapped.
+type packMappings struct {
+	access    PackAccess
+	threshold int64
+	max       int
+
+	// mu guards the mapped packfiles, and is locked before their own mutex.
+	mu     sync.Mutex
+	mapped map[*mappedPack]struct{}
+	bytes  int64
+	clock  atomic.Int64
+}
+
+func newPackMappings(ops Options) *packMappings {
+	threshold := ops.PackMmapThreshold
+	if threshold <= 0 {
+		threshold = DefaultPackMmapThreshold
+	}
+
+	return &packMappings{
+		access:    ops.PackAccess,
+		threshold: threshold,
+		max:       ops.MaxMappedPacks,
+		mapped:    make(map[*mappedPack]struct{}),
+	}
+}
+
+// open returns the file of the packfile, opened from fs, read from its
+// mapping if it is to be mapped. The packfile is only mapped once read.
+func (m *packMappings) open(fs billy.Filesystem, f billy.File) billy.File {
+	if m == nil || m.access == PackAccessRead || !mmapSupported {
+		return f
+	}
+
+	fi, err := f.Stat()
+	if err != nil || fi.Size() == 0 || m.access == PackAccessAuto && fi.Size() > m.threshold {
+		return f
+	}
+
+	p := &mappedPack{File: f, m: m, size: fi.Size()}
+	if fd, ok := f.(interface{ Fd() uintptr }); ok {
+		p.fd = fd.Fd()
+		return p
+	}
+
+	// The files of some filesystems, such as the chroot ones, don't expose
+	// their descriptor: the packfile is then opened from the OS filesystem,
+	// if it is the same file.
+	osf, err := os.Open(filepath.Join(fs.Root(), f.Name()))
+	if err != nil {
+		return f
+	}
+
+	if osfi, err := osf.Stat(); err != nil || !os.SameFile(fi, osfi) {
+		_ = osf.Close()
+		return f
+	}
+
+	p.osFile = osf
+	p.fd = osf.Fd()
+	return p
+}
+
+// mmap maps the packfile, unmapping the least recently used ones if the
+// limit of mapped packfiles is exceeded.
+func (m *packMappings) mmap(p *mappedPack) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	p.mu.Lock()
+	if p.closed || p.data != nil {
+		p.mu.Unlock()
+		return nil
+	}
+
+	data, err := mmapFile(p.fd, p.size)
+	if err != nil {
+		p.failed = true
+		p.mu.Unlock()
+		return err
+	}
+
+	p.data = data
+	p.used.Store(m.clock.Add(1))
+	p.mu.Unlock()
+
+	m.mapped[p] = struct{}{}
+	m.bytes += p.size
+
+	for m.max > 0 && len(m.mapped) > m.max {
+		var lru *mappedPack
+		for q := range m.mapped {
+			if q != p && (lru == nil || q.used.Load() < lru.used.Load()) {
+				lru = q
+			}
+		}
+
+		lru.mu.Lock()
+		err := m.unmap(lru)
+		lru.mu.Unlock()
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// unmap unmaps the packfile, whose mutex must be held along with the one of
+// the mappings.
+func (m *packMappings) unmap(p *mappedPack) error {
+	if p.data == nil {
+		return nil
+	}
+
+	delete(m.mapped, p)
+	m.bytes -= p.size
+
+	data := p.data
+	p.data = nil
+	return munmapFile(data)
+}
+
+func (m *packMappings) stats() PackMappingStats {
+	if m == nil {
+		return PackMappingStats{}
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return PackMappingStats{Packs: len(m.mapped), Bytes: m.bytes}
+}
+
+// mappedPack is the file of a packfile read from its mapping in memory. It is
+// mapped again once read if it was unmapped to remain within the limit of
+// mapped packfiles, and read from the file if it can't be mapped.
+type mappedPack struct {
+	billy.File
+	m *packMappings
+	// osFile is the packfile opened from the OS filesystem, if its file
+	// doesn't expose its descriptor, fd.
+	osFile *os.File
+	fd     uintptr
+	size   int64
+	used   atomic.Int64
+
+	mu   sync.Mutex
+	data []byte
+	pos  int64
+	// failed is set if the packfile can't be mapped, it is then read from
+	// its file.
+	failed bool
+	closed bool
+}
+
+func (p *mappedPack) Read(b []byte) (int, error) {
+	p.mu.Lock()
+	pos := p.pos
+	p.mu.Unlock()
+
+	n, err := p.ReadAt(b, pos)
+
+	p.mu.Lock()
+	p.pos = pos + int64(n)
+	p.mu.Unlock()
+
+	return n, err
+}
+
+func (p *mappedPack) ReadAt(b []byte, off int64) (int, error) {
+	for {
+		p.mu.Lock()
+		if p.closed {
+			p.mu.Unlock()
+			return 0, os.ErrClosed
+		}
+
+		if p.data != nil {
+			p.used.Store(p.m.clock.Add(1))
+			n, err := readMapping(p.data, b, off)
+			p.mu.Unlock()
+			return n, err
+		}
+
+		failed := p.failed
+		p.mu.Unlock()
+		if failed || p.m.mmap(p) != nil {
+			return p.File.ReadAt(b, off)
+		}
+	}
+}
+
+func readMapping(data, b []byte, off int64) (int, error) {
+	if off < 0 {
+		return 0, os.ErrInvalid
+	}
+
+	if off >= int64(len(data)) {
+		return 0, io.EOF
+	}
+
+	n := copy(b, data[off:])
+	if n < len(b) {
+		return n, io.EOF
+	}
+
+	return n, nil
+}
+
+func (p *mappedPack) Seek(offset int64, whence int) (int64, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.closed {
+		return 0, os.ErrClosed
+	}
+
+	switch whence {
+	case io.SeekCurrent:
+		offset += p.pos
+	case io.SeekEnd:
+		offset += p.size
+	}
+
+	if offset < 0 {
+		return 0, os.ErrInvalid
+	}
+
+	p.pos = offset
+	return offset, nil
+}
+
+// Close unmaps the packfile and closes its file.
+func (p *mappedPack) Close() error {
+	p.m.mu.Lock()
+	p.mu.Lock()
+	if p.closed {
+		p.mu.Unlock()
+		p.m.mu.Unlock()
+		return os.ErrClosed
+	}
+
+	p.closed = true
+	err := p.m.unmap(p)
+	p.mu.Unlock()
+	p.m.mu.Unlock()
+
+	if p.osFile != nil {
+		if cerr := p.osFile.Close(); err == nil {
+			err = cerr
+		}
+	}
+
+	if cerr := p.File.Close(); err == nil {
+		err = cerr
+	}
+
+	return err
+}
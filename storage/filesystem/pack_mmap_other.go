@@ -0,0 +1,19 @@
+//go:build !unix
+// +build !unix
+
+package filesystem
+
+import "errors"
+
+// The packfiles are only mapped on the unix systems, and read elsewhere.
+const mmapSupported = false
+
+var errMmapNotSupported = errors.New("mmap not supported")
+
+func mmapFile(uintptr, int64) ([]byte, error) {
+	return nil, errMmapNotSupported
+}
+
+func munmapFile([]byte) error {
+	return errMmapNotSupported
+}
@@ -0,0 +1,16 @@
+//go:build unix
+// +build unix
+
+package filesystem
+
+import "golang.org/x/sys/unix"
+
+const mmapSupported = true
+
+func mmapFile(fd uintptr, size int64) ([]byte, error) {
+	return unix.Mmap(int(fd), 0, int(size), unix.PROT_READ, unix.MAP_SHARED)
+}
+
+func munmapFile(data []byte) error {
+	return unix.Munmap(data)
+}
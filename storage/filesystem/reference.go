@@ -1,29 +1,64 @@
 package filesystem
 
 import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
 	"github.com/go-git/go-git/v6/plumbing"
 	"github.com/go-git/go-git/v6/plumbing/storer"
+	"github.com/go-git/go-git/v6/storage"
 	"github.com/go-git/go-git/v6/storage/filesystem/dotgit"
+	"github.com/go-git/go-git/v6/utils/ioutil"
 )
 
 type ReferenceStorage struct {
-	dir *dotgit.DotGit
+	dir    *dotgit.DotGit
+	grafts *graftCache
+	// objects are read to peel the annotated tags packed by PackRefs.
+	objects *ObjectStorage
+	// reftable stores the references, instead of the loose references and
+	// the packed-refs file, if extensions.refStorage is reftable.
+	reftable *reftableRefs
 }
 
 func (r *ReferenceStorage) SetReference(ref *plumbing.Reference) error {
+	defer r.grafts.invalidate()
+	if r.reftable != nil {
+		return r.reftable.SetReference(ref, nil)
+	}
+
 	return r.dir.SetRef(ref, nil)
 }
 
 func (r *ReferenceStorage) CheckAndSetReference(ref, old *plumbing.Reference) error {
+	defer r.grafts.invalidate()
+	if r.reftable != nil {
+		return r.reftable.SetReference(ref, old)
+	}
+
 	return r.dir.SetRef(ref, old)
 }
 
 func (r *ReferenceStorage) Reference(n plumbing.ReferenceName) (*plumbing.Reference, error) {
+	if r.reftable != nil {
+		return r.reftable.Reference(n)
+	}
+
 	return r.dir.Ref(n)
 }
 
 func (r *ReferenceStorage) IterReferences() (storer.ReferenceIter, error) {
-	refs, err := r.dir.Refs()
+	var refs []*plumbing.Reference
+	var err error
+	if r.reftable != nil {
+		refs, err = r.reftable.References()
+	} else {
+		refs, err = r.dir.Refs()
+	}
+
 	if err != nil {
 		return nil, err
 	}
@@ -32,13 +67,98 @@ func (r *ReferenceStorage) IterReferences() (storer.ReferenceIter, error) {
 }
 
 func (r *ReferenceStorage) RemoveReference(n plumbing.ReferenceName) error {
+	defer r.grafts.invalidate()
+	if r.reftable != nil {
+		return r.reftable.RemoveReference(n)
+	}
+
 	return r.dir.RemoveRef(n)
 }
 
 func (r *ReferenceStorage) CountLooseRefs() (int, error) {
+	if r.reftable != nil {
+		return r.reftable.CountLooseRefs()
+	}
+
 	return r.dir.CountLooseRefs()
 }
 
+// PackRefs packs the loose references into the packed-refs file, along with
+// the peeled values of the annotated tags, as `git pack-refs` does. The
+// tables of a reftable are compacted into a single one.
 func (r *ReferenceStorage) PackRefs() error {
-	return r.dir.PackRefs()
+	if r.reftable != nil {
+		return r.reftable.PackRefs()
+	}
+
+	if r.objects == nil {
+		return r.dir.PackRefs()
+	}
+
+	return r.dir.PackPeeledRefs(r.peel)
+}
+
+// peel returns the object pointed by the annotated tag h, peeling the tags
+// of tags, or the zero hash if h is not a tag. The objects missing from the
+// storage are not peeled, as git does.
+func (r *ReferenceStorage) peel(h plumbing.Hash) (plumbing.Hash, error) {
+	peeled := plumbing.ZeroHash
+	for {
+		o, err := r.objects.EncodedObject(plumbing.AnyObject, h)
+		if errors.Is(err, plumbing.ErrObjectNotFound) {
+			return peeled, nil
+		}
+
+		if err != nil {
+			return plumbing.ZeroHash, err
+		}
+
+		if o.Type() != plumbing.TagObject {
+			return peeled, nil
+		}
+
+		if h, err = tagTarget(o); err != nil {
+			return plumbing.ZeroHash, err
+		}
+
+		peeled = h
+	}
+}
+
+// tagTarget returns the object of the tag o, read from its first header,
+// without decoding the whole tag.
+func tagTarget(o plumbing.EncodedObject) (h plumbing.Hash, err error) {
+	rd, err := o.Reader()
+	if err != nil {
+		return plumbing.ZeroHash, err
+	}
+	defer ioutil.CheckClose(rd, &err)
+
+	line, err := bufio.NewReader(rd).ReadString('\n')
+	if err != nil && !errors.Is(err, io.EOF) {
+		return plumbing.ZeroHash, err
+	}
+
+	target, ok := strings.CutPrefix(strings.TrimSuffix(line, "\n"), "object ")
+	if !ok {
+		return plumbing.ZeroHash, fmt.Errorf("malformed tag %s: missing object", o.Hash())
+	}
+
+	h, ok = plumbing.FromHex(target)
+	if !ok {
+		return plumbing.ZeroHash, fmt.Errorf("malformed tag %s: invalid object %q", o.Hash(), target)
+	}
+
+	return h, nil
+}
+
+// UpdateReferences applies the given updates atomically. It implements
+// storage.ReferenceTransactionStorer.
+func (r *ReferenceStorage) UpdateReferences(updates []storage.ReferenceUpdate) error {
+	defer r.grafts.invalidate()
+	if r.reftable != nil {
+		return r.reftable.UpdateReferences(r, updates)
+	}
+
+	return r.dir.UpdateRefs(updates)
 }
@@ -0,0 +1,75 @@
+package filesystem
+
+import (
+	"github.com/go-git/go-git/v6/plumbing"
+	"github.com/go-git/go-git/v6/plumbing/format/reflog"
+	"github.com/go-git/go-git/v6/storage/filesystem/dotgit"
+	"github.com/go-git/go-git/v6/utils/ioutil"
+)
+
+// ReflogStorage stores the reflogs in the logs folder of the .git directory,
+// or in the log records of the reftable.
+type ReflogStorage struct {
+	dir      *dotgit.DotGit
+	reftable *reftableRefs
+}
+
+// Reflog returns the entries of the reflog of the given reference, the
+// oldest first.
+func (s *ReflogStorage) Reflog(name plumbing.ReferenceName) (entries []*reflog.Entry, err error) {
+	if s.reftable != nil {
+		return s.reftable.Reflog(name)
+	}
+
+	f, err := s.dir.Reflog(name)
+	if f == nil || err != nil {
+		return nil, err
+	}
+
+	defer ioutil.CheckClose(f, &err)
+	return reflog.NewDecoder(f).DecodeAll()
+}
+
+// AppendReflog appends an entry to the reflog of the given reference.
+func (s *ReflogStorage) AppendReflog(name plumbing.ReferenceName, e *reflog.Entry) (err error) {
+	if s.reftable != nil {
+		return s.reftable.AppendReflog(name, e)
+	}
+
+	f, err := s.dir.ReflogAppender(name)
+	if err != nil {
+		return err
+	}
+
+	defer ioutil.CheckClose(f, &err)
+	return reflog.NewEncoder(f).Encode(e)
+}
+
+// SetReflog replaces the entries of the reflog of the given reference. The
+// reflog is removed if there are no entries.
+func (s *ReflogStorage) SetReflog(name plumbing.ReferenceName, entries []*reflog.Entry) (err error) {
+	if s.reftable != nil {
+		return s.reftable.SetReflog(name, entries)
+	}
+
+	if len(entries) == 0 {
+		return s.dir.RemoveReflog(name)
+	}
+
+	f, err := s.dir.ReflogWriter(name)
+	if err != nil {
+		return err
+	}
+
+	defer ioutil.CheckClose(f, &err)
+	return reflog.NewEncoder(f).Encode(entries...)
+}
+
+// RemoveReflog removes the reflog of the given reference.
+func (s *ReflogStorage) RemoveReflog(name plumbing.ReferenceName) error {
+	if s.reftable != nil {
+		return s.reftable.RemoveReflog(name)
+	}
+
+	return s.dir.RemoveReflog(name)
+}
@@ -0,0 +1,301 @@
+package filesystem
+
+import (
+	"errors"
+	"strings"
+
+	"github.com/go-git/go-billy/v6"
+
+	"github.com/go-git/go-git/v6/plumbing"
+	formatcfg "github.com/go-git/go-git/v6/plumbing/format/config"
+	"github.com/go-git/go-git/v6/plumbing/format/reflog"
+	"github.com/go-git/go-git/v6/plumbing/format/reftable"
+	"github.com/go-git/go-git/v6/plumbing/storer"
+	"github.com/go-git/go-git/v6/storage"
+)
+
+const (
+	// RefStorageReftable is the extensions.refStorage of the repositories
+	// whose references are stored in the reftable directory.
+	RefStorageReftable = "reftable"
+
+	reftableDir = "reftable"
+)
+
+// reftableRefs stores the references and their reflogs in the stack of
+// tables of the reftable directory, as git does with
+// extensions.refStorage=reftable.
+type reftableRefs struct {
+	stack *reftable.Stack
+	// err is the error opening the stack, returned by all the operations.
+	err error
+}
+
+func newReftableRefs(fs billy.Filesystem, f formatcfg.ObjectFormat) *reftableRefs {
+	dir, err := fs.Chroot(reftableDir)
+	if err != nil {
+		return &reftableRefs{err: err}
+	}
+
+	stack, err := reftable.OpenStack(dir, f)
+	return &reftableRefs{stack: stack, err: err}
+}
+
+func (r *reftableRefs) Reference(n plumbing.ReferenceName) (*plumbing.Reference, error) {
+	if r.err != nil {
+		return nil, r.err
+	}
+
+	rec, err := r.stack.Ref(n.String())
+	if err != nil {
+		return nil, err
+	}
+
+	return reftableReference(rec), nil
+}
+
+func (r *reftableRefs) References() ([]*plumbing.Reference, error) {
+	if r.err != nil {
+		return nil, r.err
+	}
+
+	recs, err := r.stack.Refs()
+	if err != nil {
+		return nil, err
+	}
+
+	refs := make([]*plumbing.Reference, 0, len(recs))
+	for _, rec := range recs {
+		refs = append(refs, reftableReference(rec))
+	}
+
+	return refs, nil
+}
+
+// SetReference sets the reference, if old is nil or if the reference points
+// to the hash of old.
+func (r *reftableRefs) SetReference(ref, old *plumbing.Reference) error {
+	if r.err != nil {
+		return r.err
+	}
+
+	return r.stack.Add(func(w *reftable.Writer) error {
+		if old != nil {
+			current, err := r.stack.Ref(old.Name().String())
+			if err != nil {
+				return err
+			}
+
+			if current.Hash != old.Hash() {
+				return storage.ErrReferenceHasChanged
+			}
+		}
+
+		return w.AddRef(reftableRecord(ref, w.MinUpdateIndex()))
+	})
+}
+
+// RemoveReference removes the reference and its reflog.
+func (r *reftableRefs) RemoveReference(n plumbing.ReferenceName) error {
+	if r.err != nil {
+		return r.err
+	}
+
+	return r.stack.Add(func(w *reftable.Writer) error {
+		_, err := r.stack.Ref(n.String())
+		switch {
+		case errors.Is(err, plumbing.ErrReferenceNotFound):
+		case err != nil:
+			return err
+		default:
+			if err := w.AddRef(&reftable.Ref{Name: n.String(), UpdateIndex: w.MinUpdateIndex(), Deleted: true}); err != nil {
+				return err
+			}
+		}
+
+		return r.removeLogs(w, n)
+	})
+}
+
+// UpdateReferences applies the updates in a single table, once their
+// preconditions are checked against the references of s, the stack being
+// locked.
+func (r *reftableRefs) UpdateReferences(s storer.ReferenceStorer, updates []storage.ReferenceUpdate) error {
+	if r.err != nil {
+		return r.err
+	}
+
+	return r.stack.Add(func(w *reftable.Writer) error {
+		if err := storage.CheckReferenceUpdates(s, updates); err != nil {
+			return err
+		}
+
+		for _, u := range updates {
+			if !u.NewHash.IsZero() {
+				ref := plumbing.NewHashReference(u.Name, u.NewHash)
+				if err := w.AddRef(reftableRecord(ref, w.MinUpdateIndex())); err != nil {
+					return err
+				}
+
+				continue
+			}
+
+			if err := w.AddRef(&reftable.Ref{Name: u.Name.String(), UpdateIndex: w.MinUpdateIndex(), Deleted: true}); err != nil {
+				return err
+			}
+
+			if err := r.removeLogs(w, u.Name); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+}
+
+// CountLooseRefs returns the number of tables on top of the first one of the
+// stack, compacted by PackRefs.
+func (r *reftableRefs) CountLooseRefs() (int, error) {
+	if r.err != nil {
+		return 0, r.err
+	}
+
+	n, err := r.stack.Tables()
+	return max(0, n-1), err
+}
+
+// PackRefs compacts the stack into a single table, as `git pack-refs` does.
+func (r *reftableRefs) PackRefs() error {
+	if r.err != nil {
+		return r.err
+	}
+
+	return r.stack.Compact()
+}
+
+// Reflog returns the entries of the reflog of the given reference, the
+// oldest first.
+func (r *reftableRefs) Reflog(n plumbing.ReferenceName) ([]*reflog.Entry, error) {
+	if r.err != nil {
+		return nil, r.err
+	}
+
+	logs, err := r.stack.Logs(n.String())
+	if err != nil {
+		return nil, err
+	}
+
+	var entries []*reflog.Entry
+	for i := len(logs) - 1; i >= 0; i-- {
+		l := logs[i]
+		entries = append(entries, &reflog.Entry{
+			Old:     l.Old,
+			New:     l.New,
+			Name:    l.Name,
+			Email:   l.Email,
+			When:    l.When,
+			Message: strings.TrimSuffix(l.Message, "\n"),
+		})
+	}
+
+	return entries, nil
+}
+
+// AppendReflog appends the entry to the reflog of the given reference.
+func (r *reftableRefs) AppendReflog(n plumbing.ReferenceName, e *reflog.Entry) error {
+	if r.err != nil {
+		return r.err
+	}
+
+	return r.stack.Add(func(w *reftable.Writer) error {
+		return w.AddLog(reftableLog(n, w.MinUpdateIndex(), e))
+	})
+}
+
+// SetReflog replaces the entries of the reflog of given reference, given
+// update indexes of their own in the table.
+func (r *reftableRefs) SetReflog(n plumbing.ReferenceName, entries []*reflog.Entry) error {
+	if r.err != nil {
+		return r.err
+	}
+
+	return r.stack.Add(func(w *reftable.Writer) error {
+		if err := r.removeLogs(w, n); err != nil {
+			return err
+		}
+
+		if len(entries) == 0 {
+			return nil
+		}
+
+		w.SetMaxUpdateIndex(w.MinUpdateIndex() + uint64(len(entries)) - 1)
+		for i, e := range entries {
+			if err := w.AddLog(reftableLog(n, w.MinUpdateIndex()+uint64(i), e)); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+}
+
+// RemoveReflog removes the reflog of the given reference.
+func (r *reftableRefs) RemoveReflog(n plumbing.ReferenceName) error {
+	if r.err != nil {
+		return r.err
+	}
+
+	return r.stack.Add(func(w *reftable.Writer) error {
+		return r.removeLogs(w, n)
+	})
+}
+
+// removeLogs adds the deletions of the current log records of the given
+// reference to w.
+func (r *reftableRefs) removeLogs(w *reftable.Writer, n plumbing.ReferenceName) error {
+	logs, err := r.stack.Logs(n.String())
+	if err != nil {
+		return err
+	}
+
+	for _, l := range logs {
+		if err := w.AddLog(&reftable.Log{RefName: l.RefName, UpdateIndex: l.UpdateIndex, Deleted: true}); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func reftableReference(rec *reftable.Ref) *plumbing.Reference {
+	name := plumbing.ReferenceName(rec.Name)
+	if rec.Target != "" {
+		return plumbing.NewSymbolicReference(name, plumbing.ReferenceName(rec.Target))
+	}
+
+	return plumbing.NewHashReference(name, rec.Hash)
+}
+
+func reftableRecord(ref *plumbing.Reference, updateIndex uint64) *reftable.Ref {
+	rec := &reftable.Ref{Name: ref.Name().String(), UpdateIndex: updateIndex}
+	if ref.Type() == plumbing.SymbolicReference {
+		rec.Target = ref.Target().String()
+	} else {
+		rec.Hash = ref.Hash()
+	}
+
+	return rec
+}
+
+func reftableLog(n plumbing.ReferenceName, updateIndex uint64, e *reflog.Entry) *reftable.Log {
+	return &reftable.Log{
+		RefName:     n.String(),
+		UpdateIndex: updateIndex,
+		Old:         e.Old,
+		New:         e.New,
+		Name:        e.Name,
+		Email:       e.Email,
+		When:        e.When,
+		Message:     e.Message + "\n",
+	}
+}
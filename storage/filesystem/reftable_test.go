@@ -0,0 +1,160 @@
+package filesystem_test
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/go-git/go-billy/v6"
+	"github.com/go-git/go-billy/v6/memfs"
+	"github.com/go-git/go-billy/v6/util"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/go-git/go-git/v6/plumbing"
+	"github.com/go-git/go-git/v6/plumbing/cache"
+	"github.com/go-git/go-git/v6/plumbing/format/reflog"
+	"github.com/go-git/go-git/v6/plumbing/storer"
+	"github.com/go-git/go-git/v6/storage"
+	"github.com/go-git/go-git/v6/storage/filesystem"
+)
+
+// newReftableRepository returns the .git directory of a repository whose
+// references are stored in a reftable, laid out as git does.
+func newReftableRepository(t *testing.T) billy.Filesystem {
+	t.Helper()
+
+	fs := memfs.New()
+	require.NoError(t, util.WriteFile(fs, "config", []byte("[core]\n\trepositoryformatversion = 1\n[extensions]\n\trefStorage = reftable\n"), 0o644))
+	require.NoError(t, util.WriteFile(fs, "HEAD", []byte("ref: refs/heads/.invalid\n"), 0o644))
+	require.NoError(t, fs.MkdirAll("reftable", 0o755))
+	require.NoError(t, util.WriteFile(fs, "reftable/tables.list", nil, 0o644))
+	return fs
+}
+
+func TestReftableReferences(t *testing.T) {
+	t.Parallel()
+
+	fs := newReftableRepository(t)
+	sto := filesystem.NewStorage(fs, cache.NewObjectLRUDefault())
+
+	h1 := plumbing.NewHash("6ecf0ef2c2dffb796033e5a02219af86ec6584e5")
+	h2 := plumbing.NewHash("918c48b83bd081e863dbe1b80f8998f058cd8294")
+	require.NoError(t, sto.SetReference(plumbing.NewSymbolicReference(plumbing.HEAD, "refs/heads/master")))
+	require.NoError(t, sto.SetReference(plumbing.NewHashReference("refs/heads/master", h1)))
+	require.NoError(t, sto.SetReference(plumbing.NewHashReference("refs/tags/v1.0.0", h1)))
+
+	// The references are not written as loose references.
+	_, err := fs.Stat("refs/heads/master")
+	assert.Error(t, err)
+
+	err = sto.CheckAndSetReference(plumbing.NewHashReference("refs/heads/master", h2), plumbing.NewHashReference("refs/heads/master", h2))
+	assert.ErrorIs(t, err, storage.ErrReferenceHasChanged)
+	require.NoError(t, sto.CheckAndSetReference(plumbing.NewHashReference("refs/heads/master", h2), plumbing.NewHashReference("refs/heads/master", h1)))
+
+	// The references are read by another storage of the same repository.
+	other := filesystem.NewStorage(fs, cache.NewObjectLRUDefault())
+	head, err := storer.ResolveReference(other, plumbing.HEAD)
+	require.NoError(t, err)
+	assert.Equal(t, h2, head.Hash())
+
+	require.NoError(t, other.RemoveReference("refs/tags/v1.0.0"))
+	_, err = sto.Reference("refs/tags/v1.0.0")
+	assert.ErrorIs(t, err, plumbing.ErrReferenceNotFound)
+
+	iter, err := sto.IterReferences()
+	require.NoError(t, err)
+	var names []string
+	require.NoError(t, iter.ForEach(func(r *plumbing.Reference) error {
+		names = append(names, r.Name().String())
+		return nil
+	}))
+	assert.Equal(t, []string{"HEAD", "refs/heads/master"}, names)
+
+	require.NoError(t, sto.PackRefs())
+	n, err := sto.CountLooseRefs()
+	require.NoError(t, err)
+	assert.Equal(t, 0, n)
+
+	ref, err := sto.Reference("refs/heads/master")
+	require.NoError(t, err)
+	assert.Equal(t, h2, ref.Hash())
+}
+
+func TestReftableUpdateReferences(t *testing.T) {
+	t.Parallel()
+
+	sto := filesystem.NewStorage(newReftableRepository(t), cache.NewObjectLRUDefault())
+	h1 := plumbing.NewHash("6ecf0ef2c2dffb796033e5a02219af86ec6584e5")
+	h2 := plumbing.NewHash("918c48b83bd081e863dbe1b80f8998f058cd8294")
+
+	require.NoError(t, sto.UpdateReferences([]storage.ReferenceUpdate{
+		{Name: "refs/heads/a", NewHash: h1},
+		{Name: "refs/heads/b", NewHash: h1},
+	}))
+
+	err := sto.UpdateReferences([]storage.ReferenceUpdate{
+		{Name: "refs/heads/a", OldHash: h1, NewHash: h2},
+		{Name: "refs/heads/b", OldHash: h2},
+	})
+
+	var updateErr *storage.ReferenceUpdateError
+	require.True(t, errors.As(err, &updateErr))
+	assert.Equal(t, plumbing.ReferenceName("refs/heads/b"), updateErr.Name)
+
+	ref, err := sto.Reference("refs/heads/a")
+	require.NoError(t, err)
+	assert.Equal(t, h1, ref.Hash())
+
+	require.NoError(t, sto.UpdateReferences([]storage.ReferenceUpdate{
+		{Name: "refs/heads/a", OldHash: h1, NewHash: h2},
+		{Name: "refs/heads/b", OldHash: h1},
+	}))
+
+	ref, err = sto.Reference("refs/heads/a")
+	require.NoError(t, err)
+	assert.Equal(t, h2, ref.Hash())
+
+	_, err = sto.Reference("refs/heads/b")
+	assert.ErrorIs(t, err, plumbing.ErrReferenceNotFound)
+}
+
+func TestReftableReflog(t *testing.T) {
+	t.Parallel()
+
+	sto := filesystem.NewStorage(newReftableRepository(t), cache.NewObjectLRUDefault())
+	h1 := plumbing.NewHash("6ecf0ef2c2dffb796033e5a02219af86ec6584e5")
+	h2 := plumbing.NewHash("918c48b83bd081e863dbe1b80f8998f058cd8294")
+	when := time.Unix(1257894000, 0).In(time.FixedZone("", 2*60*60))
+	name := plumbing.ReferenceName("refs/heads/master")
+
+	e1 := &reflog.Entry{New: h1, Name: "foo", Email: "foo@foo.foo", When: when, Message: "commit (initial): foo"}
+	e2 := &reflog.Entry{Old: h1, New: h2, Name: "foo", Email: "foo@foo.foo", When: when, Message: "commit: bar"}
+	require.NoError(t, sto.AppendReflog(name, e1))
+	require.NoError(t, sto.AppendReflog(name, e2))
+
+	entries, err := sto.Reflog(name)
+	require.NoError(t, err)
+	require.Len(t, entries, 2)
+	assert.Equal(t, "commit (initial): foo", entries[0].Message)
+	assert.Equal(t, h2, entries[1].New)
+	assert.True(t, when.Equal(entries[1].When))
+
+	require.NoError(t, sto.SetReflog(name, []*reflog.Entry{e2, e1, e2}))
+	entries, err = sto.Reflog(name)
+	require.NoError(t, err)
+	require.Len(t, entries, 3)
+	assert.Equal(t, "commit (initial): foo", entries[1].Message)
+
+	require.NoError(t, sto.AppendReflog(name, e1))
+	entries, err = sto.Reflog(name)
+	require.NoError(t, err)
+	require.Len(t, entries, 4)
+	assert.Equal(t, e1.Message, entries[3].Message)
+
+	require.NoError(t, sto.SetReference(plumbing.NewHashReference(name, h2)))
+	require.NoError(t, sto.RemoveReference(name))
+	entries, err = sto.Reflog(name)
+	require.NoError(t, err)
+	assert.Empty(t, entries)
+}
@@ -12,13 +12,16 @@ import (
 // ShallowStorage where the shallow commits are stored, an internal to
 // manipulate the shallow file
 type ShallowStorage struct {
-	dir *dotgit.DotGit
+	dir    *dotgit.DotGit
+	grafts *graftCache
 }
 
 // SetShallow save the shallows in the shallow file in the .git folder as one
 // commit per line represented by 40-byte hexadecimal object terminated by a
 // newline.
 func (s *ShallowStorage) SetShallow(commits []plumbing.Hash) error {
+	defer s.grafts.invalidate()
+
 	f, err := s.dir.ShallowWriter()
 	if err != nil {
 		return err
@@ -7,6 +7,7 @@ import (
 	"github.com/go-git/go-git/v6/plumbing"
 	"github.com/go-git/go-git/v6/plumbing/cache"
 	formatcfg "github.com/go-git/go-git/v6/plumbing/format/config"
+	"github.com/go-git/go-git/v6/plumbing/format/objfile"
 	"github.com/go-git/go-git/v6/storage/filesystem/dotgit"
 )
 
@@ -17,6 +18,7 @@ type Storage struct {
 	fs     billy.Filesystem
 	dir    *dotgit.DotGit
 	hasher plumbing.Hasher
+	grafts *graftCache
 
 	ObjectStorage
 	ReferenceStorage
@@ -24,6 +26,7 @@ type Storage struct {
 	ShallowStorage
 	ConfigStorage
 	ModuleStorage
+	ReflogStorage
 }
 
 // Options holds configuration for the storage.
@@ -38,7 +41,10 @@ type Options struct {
 	// open. If KeepDescriptors is true, all file descriptors will remain open.
 	MaxOpenDescriptors int
 	// LargeObjectThreshold maximum object size (in bytes) that will be read in to memory.
-	// If left unset or set to 0 there is no limit
+	// If left unset or set to 0 there is no limit. The larger loose objects
+	// are streamed from their file, and the larger packed objects stored as
+	// deltas are streamed as their delta is applied, their base being read
+	// in to memory.
 	LargeObjectThreshold int64
 	// AlternatesFS provides the billy filesystem to be used for Git Alternates.
 	// If none is provided, it falls back to using the underlying instance used for
@@ -48,6 +54,75 @@ type Options struct {
 	// mode. This defaults to false. For more information refer to packfile's Parser
 	// WithHighMemoryMode option.
 	HighMemoryMode bool
+	// LooseCompressionLevel is the zlib compression level of the new loose
+	// objects, from zlib.BestSpeed to zlib.BestCompression, or
+	// zlib.HuffmanOnly. If left unset or set to 0, the default compression
+	// level is used: as zlib.NoCompression is 0, the loose objects are
+	// always compressed.
+	LooseCompressionLevel int
+	// LooseCompression is the compression of the new loose objects, zlib by
+	// default. objfile.ZstdCompression compresses them with zstd, faster to
+	// decompress, but the repositories holding such objects cannot be read
+	// by git, which reports them as corrupt: it must only be used for the
+	// repositories only accessed by go-git. The loose objects are read
+	// whatever their compression.
+	LooseCompression objfile.Compression
+	// AutoPackThreshold is the number of loose objects above which the loose
+	// objects are packed, as `git gc --auto` does with gc.auto, once a new
+	// loose object is written. If left unset or set to 0, the loose objects
+	// are only packed by the threshold in bytes, if any.
+	AutoPackThreshold int
+	// AutoPackThresholdBytes is the size, in bytes, of the loose object files
+	// above which the loose objects are packed, as AutoPackThreshold. If left
+	// unset or set to 0 there is no limit.
+	AutoPackThresholdBytes int64
+	// BigFileThreshold is the size, in bytes, of the objects written by
+	// NewObjectWriter above which they are written to a packfile of their
+	// own instead of a loose object, as core.bigFileThreshold makes git add
+	// do. If left unset or set to 0, the objects are written as loose
+	// objects.
+	BigFileThreshold int64
+	// PackfileMaxMemory is the maximum size, in bytes, of the inflated
+	// contents held in memory while the packfiles written by PackfileWriter
+	// are parsed, see packfile's Parser WithMaxMemory option. If left unset
+	// or set to 0 there is no limit.
+	PackfileMaxMemory int64
+	// DeltaBaseCacheLimit is the size, in bytes, of the cache of the bases of
+	// the deltas read from the packfiles, as core.deltaBaseCacheLimit in git.
+	// The bases are held independently of the object cache, so that the
+	// chains of deltas sharing them are resolved without inflating them
+	// again. If left unset or set to 0, packfile.DefaultDeltaBaseCacheLimit
+	// is used, a negative value disabling the cache.
+	DeltaBaseCacheLimit int64
+	// SharedObjectCache declares the object cache given to the storage as
+	// shared with other storages, such as the ones of the forks of a
+	// repository, for the objects common to them to be cached once, within
+	// the size of the cache. Only the objects held in memory are then cached,
+	// the others being read lazily from the packfiles of a single storage,
+	// and the cache is not cleared by Reindex. A storage only returns the
+	// cached objects it holds, as a cached object is only looked up once
+	// found in the storage.
+	SharedObjectCache bool
+	// PackAccess is how the packfiles are accessed: read from their files
+	// by default, or mapped in memory. Mapping them is mostly worth it if
+	// the packfiles are kept open, with KeepDescriptors or
+	// MaxOpenDescriptors, as they are otherwise mapped each time they are
+	// opened. The mapped packfiles are reported by PackMappingStats.
+	PackAccess PackAccess
+	// PackMmapThreshold is the size, in bytes, of the biggest packfiles
+	// mapped with PackAccessAuto. If left unset or set to 0,
+	// DefaultPackMmapThreshold is used.
+	PackMmapThreshold int64
+	// MaxMappedPacks is the maximum number of packfiles mapped at the same
+	// time, the least recently read ones being unmapped once it is
+	// exceeded: they are mapped again once read. If left unset or set to 0
+	// there is no limit.
+	MaxMappedPacks int
+	// NoReplaceObjects makes the objects replaced by refs/replace/*
+	// references read as they are stored, as git does with
+	// --no-replace-objects, instead of as their replacement. The objects
+	// are always read as stored through NoReplaceObjects.
+	NoReplaceObjects bool
 
 	ObjectFormat formatcfg.ObjectFormat
 }
@@ -60,10 +135,26 @@ func NewStorage(fs billy.Filesystem, cache cache.Object) *Storage {
 // NewStorageWithOptions returns a new Storage with extra options,
 // backed by a given `fs.Filesystem` and cache.
 func NewStorageWithOptions(fs billy.Filesystem, c cache.Object, ops Options) *Storage {
+	// The object format of an existing repository is the one of its
+	// config, its extensions.objectFormat, and its references are stored as
+	// its extensions.refStorage says.
+	var refStorage string
+	if cfg, err := (&ConfigStorage{dir: dotgit.New(fs)}).Config(); err == nil {
+		if ops.ObjectFormat == formatcfg.SHA1 {
+			ops.ObjectFormat = cfg.Extensions.ObjectFormat
+		}
+
+		refStorage = cfg.Extensions.RefStorage
+	}
+
 	dirOps := dotgit.Options{
 		ExclusiveAccess: ops.ExclusiveAccess,
 		AlternatesFS:    ops.AlternatesFS,
 		KeepDescriptors: ops.KeepDescriptors,
+
+		LooseCompressionLevel: ops.LooseCompressionLevel,
+		LooseCompression:      ops.LooseCompression,
+		ObjectFormat:          ops.ObjectFormat,
 	}
 	dir := dotgit.NewWithOptions(fs, dirOps)
 
@@ -71,16 +162,26 @@ func NewStorageWithOptions(fs billy.Filesystem, c cache.Object, ops Options) *St
 		c = cache.NewObjectLRUDefault()
 	}
 
+	grafts := &graftCache{}
 	s := &Storage{
-		fs:  fs,
-		dir: dir,
+		fs:     fs,
+		dir:    dir,
+		grafts: grafts,
 
 		ObjectStorage:    *NewObjectStorageWithOptions(dir, c, ops),
-		ReferenceStorage: ReferenceStorage{dir: dir},
+		ReferenceStorage: ReferenceStorage{dir: dir, grafts: grafts},
 		IndexStorage:     IndexStorage{dir: dir},
-		ShallowStorage:   ShallowStorage{dir: dir},
+		ShallowStorage:   ShallowStorage{dir: dir, grafts: grafts},
 		ConfigStorage:    ConfigStorage{dir: dir, objectFormat: ops.ObjectFormat},
 		ModuleStorage:    ModuleStorage{dir: dir},
+		ReflogStorage:    ReflogStorage{dir: dir},
+	}
+
+	s.ReferenceStorage.objects = &s.ObjectStorage
+	if refStorage == RefStorageReftable {
+		refs := newReftableRefs(fs, ops.ObjectFormat)
+		s.ReferenceStorage.reftable = refs
+		s.ReflogStorage.reftable = refs
 	}
 
 	s.hasher = plumbing.NewHasher(ops.ObjectFormat, plumbing.AnyObject, 0)
@@ -100,9 +201,18 @@ func (s *Storage) Init() error {
 }
 
 func (s *Storage) AddAlternate(remote string) error {
-	return s.dir.AddAlternate(remote)
+	return s.ObjectStorage.AddAlternate(remote)
 }
 
 func (s *Storage) LowMemoryMode() bool {
 	return !s.options.HighMemoryMode
 }
+
+// SetObjectFormat sets the object format of the repository, which must not
+// hold any object yet. Its config is not changed.
+func (s *Storage) SetObjectFormat(f formatcfg.ObjectFormat) {
+	s.ObjectStorage.SetObjectFormat(f)
+	s.ConfigStorage.objectFormat = f
+	s.hasher = plumbing.NewHasher(f, plumbing.AnyObject, 0)
+	s.h = s.hasher.Hash
+}
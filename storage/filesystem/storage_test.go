@@ -9,6 +9,7 @@ import (
 
 	"github.com/go-git/go-git/v6/plumbing/cache"
 	"github.com/go-git/go-git/v6/plumbing/storer"
+	"github.com/go-git/go-git/v6/storage"
 	"github.com/go-git/go-git/v6/storage/filesystem"
 )
 
@@ -23,6 +24,7 @@ var (
 	_ storer.ShallowStorer       = sto
 	_ storer.DeltaObjectStorer   = sto
 	_ storer.PackfileWriter      = sto
+	_ storage.ReflogStorer       = sto
 )
 
 func TestFilesystem(t *testing.T) {
@@ -3,7 +3,8 @@ package memory
 import formatcfg "github.com/go-git/go-git/v6/plumbing/format/config"
 
 type options struct {
-	objectFormat formatcfg.ObjectFormat
+	objectFormat     formatcfg.ObjectFormat
+	noReplaceObjects bool
 }
 
 func newOptions() options {
@@ -20,3 +21,12 @@ func WithObjectFormat(of formatcfg.ObjectFormat) StorageOption {
 		o.objectFormat = of
 	}
 }
+
+// WithNoReplaceObjects makes the objects replaced by refs/replace/*
+// references read as they are stored, as git does with --no-replace-objects,
+// instead of as their replacement.
+func WithNoReplaceObjects() StorageOption {
+	return func(o *options) {
+		o.noReplaceObjects = true
+	}
+}
@@ -5,12 +5,15 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"slices"
+	"sync"
 	"time"
 
 	"github.com/go-git/go-git/v6/config"
 	"github.com/go-git/go-git/v6/plumbing"
 	formatcfg "github.com/go-git/go-git/v6/plumbing/format/config"
 	"github.com/go-git/go-git/v6/plumbing/format/index"
+	"github.com/go-git/go-git/v6/plumbing/format/reflog"
 	"github.com/go-git/go-git/v6/plumbing/storer"
 	"github.com/go-git/go-git/v6/storage"
 	"github.com/go-git/go-git/v6/utils/ioutil"
@@ -29,7 +32,9 @@ type Storage struct {
 	IndexStorage
 	ReferenceStorage
 	ModuleStorage
+	ReflogStorage
 	options options
+	grafts  graftCache
 }
 
 // NewStorage returns a new in memory Storage base.
@@ -53,6 +58,7 @@ func NewStorage(o ...StorageOption) *Storage {
 			Tags:    make(map[plumbing.Hash]plumbing.EncodedObject),
 		},
 		ModuleStorage: make(ModuleStorage),
+		ReflogStorage: make(ReflogStorage),
 	}
 
 	if opts.objectFormat == formatcfg.SHA256 {
@@ -64,6 +70,18 @@ func NewStorage(o ...StorageOption) *Storage {
 	return s
 }
 
+// ObjectFormat returns the object format of the storage.
+func (s *Storage) ObjectFormat() formatcfg.ObjectFormat {
+	return s.options.objectFormat
+}
+
+// SetObjectFormat sets the object format of the storage, which must not hold
+// any object yet. Its config is not changed.
+func (s *Storage) SetObjectFormat(f formatcfg.ObjectFormat) {
+	s.options.objectFormat = f
+	s.oh = plumbing.FromObjectFormat(f)
+}
+
 type ConfigStorage struct {
 	config *config.Config
 }
@@ -109,6 +127,8 @@ type ObjectStorage struct {
 	Trees   map[plumbing.Hash]plumbing.EncodedObject
 	Blobs   map[plumbing.Hash]plumbing.EncodedObject
 	Tags    map[plumbing.Hash]plumbing.EncodedObject
+
+	fetcher storer.ObjectFetcher
 }
 
 type lazyCloser struct {
@@ -175,6 +195,17 @@ func (o *ObjectStorage) HasEncodedObject(h plumbing.Hash) (err error) {
 	return nil
 }
 
+// HasObjects returns whether each of the given objects exists, by hash. It
+// implements storer.BulkObjectStorer.
+func (o *ObjectStorage) HasObjects(hashes []plumbing.Hash) (map[plumbing.Hash]bool, error) {
+	found := make(map[plumbing.Hash]bool, len(hashes))
+	for _, h := range hashes {
+		_, found[h] = o.Objects[h]
+	}
+
+	return found, nil
+}
+
 func (o *ObjectStorage) EncodedObjectSize(h plumbing.Hash) (
 	size int64, err error,
 ) {
@@ -186,8 +217,22 @@ func (o *ObjectStorage) EncodedObjectSize(h plumbing.Hash) (
 	return obj.Size(), nil
 }
 
+// SetObjectFetcher sets the function used to fetch the objects missing from
+// the storage. It implements storer.PromisorObjectStorer.
+func (o *ObjectStorage) SetObjectFetcher(f storer.ObjectFetcher) {
+	o.fetcher = f
+}
+
 func (o *ObjectStorage) EncodedObject(t plumbing.ObjectType, h plumbing.Hash) (plumbing.EncodedObject, error) {
 	obj, ok := o.Objects[h]
+	if !ok && o.fetcher != nil {
+		if err := o.fetcher(h); err != nil {
+			return nil, err
+		}
+
+		obj, ok = o.Objects[h]
+	}
+
 	if !ok || (plumbing.AnyObject != t && obj.Type() != t) {
 		return nil, plumbing.ErrObjectNotFound
 	}
@@ -357,6 +402,53 @@ func (r ReferenceStorage) RemoveReference(n plumbing.ReferenceName) error {
 	return nil
 }
 
+// SetReference stores a reference.
+func (s *Storage) SetReference(ref *plumbing.Reference) error {
+	defer s.grafts.invalidate()
+	return s.ReferenceStorage.SetReference(ref)
+}
+
+// CheckAndSetReference stores a reference, if the stored one is old.
+func (s *Storage) CheckAndSetReference(ref, old *plumbing.Reference) error {
+	defer s.grafts.invalidate()
+	return s.ReferenceStorage.CheckAndSetReference(ref, old)
+}
+
+// RemoveReference removes a reference by name, along with its reflog.
+func (s *Storage) RemoveReference(n plumbing.ReferenceName) error {
+	defer s.grafts.invalidate()
+	if err := s.ReferenceStorage.RemoveReference(n); err != nil {
+		return err
+	}
+
+	return s.RemoveReflog(n)
+}
+
+// UpdateReferences applies the given updates atomically, checking all their
+// preconditions before applying any of them. It implements
+// storage.ReferenceTransactionStorer.
+func (s *Storage) UpdateReferences(updates []storage.ReferenceUpdate) error {
+	if err := storage.CheckReferenceUpdates(s.ReferenceStorage, updates); err != nil {
+		return err
+	}
+
+	for _, u := range updates {
+		if u.NewHash.IsZero() {
+			if err := s.RemoveReference(u.Name); err != nil {
+				return err
+			}
+
+			continue
+		}
+
+		if err := s.SetReference(plumbing.NewHashReference(u.Name, u.NewHash)); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
 type ShallowStorage []plumbing.Hash
 
 func (s *ShallowStorage) SetShallow(commits []plumbing.Hash) error {
@@ -368,6 +460,159 @@ func (s ShallowStorage) Shallow() ([]plumbing.Hash, error) {
 	return s, nil
 }
 
+// SetShallow stores the shallow commits.
+func (s *Storage) SetShallow(commits []plumbing.Hash) error {
+	defer s.grafts.invalidate()
+	return s.ShallowStorage.SetShallow(commits)
+}
+
+// graftCache caches the grafts of a storage, until its shallow commits or its
+// references are changed.
+type graftCache struct {
+	mu     sync.Mutex
+	read   bool
+	grafts *storer.Grafts
+}
+
+func (c *graftCache) invalidate() {
+	c.mu.Lock()
+	c.read = false
+	c.grafts = nil
+	c.mu.Unlock()
+}
+
+// Grafts returns the grafts of the shallow commits and of the refs/replace/*
+// references, unless the storage was created WithNoReplaceObjects. It
+// implements storer.GraftStorer.
+//
+// The grafts are cached until the shallow commits or the references are
+// changed through the storage: the changes made directly to ShallowStorage
+// or ReferenceStorage are ignored.
+func (s *Storage) Grafts() (*storer.Grafts, error) {
+	s.grafts.mu.Lock()
+	defer s.grafts.mu.Unlock()
+
+	if s.grafts.read {
+		return s.grafts.grafts, nil
+	}
+
+	var refs storer.ReferenceIter
+	if !s.options.noReplaceObjects {
+		var err error
+		refs, err = s.ReferenceStorage.IterReferences()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	g, err := storer.ReadGrafts(s.ShallowStorage, nil, refs)
+	if err != nil {
+		return nil, err
+	}
+
+	s.grafts.read = true
+	s.grafts.grafts = g
+	return g, nil
+}
+
+// EncodedObject returns the object with the given hash, or the object
+// replacing it if it is replaced by a refs/replace/* reference, unless the
+// storage was created WithNoReplaceObjects. The replacement is returned as it
+// is stored, with its own hash.
+func (s *Storage) EncodedObject(t plumbing.ObjectType, h plumbing.Hash) (plumbing.EncodedObject, error) {
+	return s.ObjectStorage.EncodedObject(t, s.replacement(h))
+}
+
+// EncodedObjectSize returns the size of the object with the given hash, or of
+// the object replacing it, as EncodedObject.
+func (s *Storage) EncodedObjectSize(h plumbing.Hash) (int64, error) {
+	return s.ObjectStorage.EncodedObjectSize(s.replacement(h))
+}
+
+// replacement returns the hash of the object replacing the object with the
+// given hash, if any.
+func (s *Storage) replacement(h plumbing.Hash) plumbing.Hash {
+	if s.options.noReplaceObjects {
+		return h
+	}
+
+	g, err := s.Grafts()
+	if err != nil {
+		return h
+	}
+
+	return g.Replacement(h)
+}
+
+// NoReplaceObjects returns the storage reading the objects as they are
+// stored, ignoring the refs/replace/* references. It implements
+// storage.ReplaceObjectsStorer.
+func (s *Storage) NoReplaceObjects() storage.Storer {
+	if s.options.noReplaceObjects {
+		return s
+	}
+
+	return &noReplaceStorage{s}
+}
+
+// noReplaceStorage is a Storage reading the objects as they are stored.
+type noReplaceStorage struct {
+	*Storage
+}
+
+func (s *noReplaceStorage) EncodedObject(t plumbing.ObjectType, h plumbing.Hash) (plumbing.EncodedObject, error) {
+	return s.ObjectStorage.EncodedObject(t, h)
+}
+
+func (s *noReplaceStorage) EncodedObjectSize(h plumbing.Hash) (int64, error) {
+	return s.ObjectStorage.EncodedObjectSize(h)
+}
+
+// Grafts returns the grafts of the storage, without the replaced objects.
+func (s *noReplaceStorage) Grafts() (*storer.Grafts, error) {
+	g, err := s.Storage.Grafts()
+	if err != nil || g == nil || len(g.Replaced) == 0 {
+		return g, err
+	}
+
+	if len(g.Parents) == 0 {
+		return nil, nil
+	}
+
+	return &storer.Grafts{Parents: g.Parents}, nil
+}
+
+func (s *noReplaceStorage) NoReplaceObjects() storage.Storer {
+	return s
+}
+
+// ReflogStorage stores the reflogs, the oldest entry of each reflog first.
+type ReflogStorage map[plumbing.ReferenceName][]*reflog.Entry
+
+func (r ReflogStorage) Reflog(n plumbing.ReferenceName) ([]*reflog.Entry, error) {
+	return slices.Clone(r[n]), nil
+}
+
+func (r ReflogStorage) AppendReflog(n plumbing.ReferenceName, e *reflog.Entry) error {
+	r[n] = append(r[n], e)
+	return nil
+}
+
+func (r ReflogStorage) SetReflog(n plumbing.ReferenceName, entries []*reflog.Entry) error {
+	if len(entries) == 0 {
+		delete(r, n)
+		return nil
+	}
+
+	r[n] = slices.Clone(entries)
+	return nil
+}
+
+func (r ReflogStorage) RemoveReflog(n plumbing.ReferenceName) error {
+	delete(r, n)
+	return nil
+}
+
 type ModuleStorage map[string]*Storage
 
 func (s ModuleStorage) Module(name string) (storage.Storer, error) {
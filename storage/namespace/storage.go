@@ -0,0 +1,322 @@
+// Package namespace implements a storage scoping the references of another
+// storage to a git namespace, as GIT_NAMESPACE does. The references of the
+// namespace foo are stored as refs/namespaces/foo/<name>, and are read and
+// written as <name>, so that several logical repositories share the objects
+// of a single one.
+package namespace
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/go-git/go-git/v6/plumbing"
+	"github.com/go-git/go-git/v6/plumbing/format/packfile"
+	"github.com/go-git/go-git/v6/plumbing/format/reflog"
+	"github.com/go-git/go-git/v6/plumbing/storer"
+	"github.com/go-git/go-git/v6/storage"
+)
+
+// ErrInvalidNamespace is returned when a namespace is not a valid part of a
+// reference name.
+var ErrInvalidNamespace = errors.New("invalid namespace")
+
+// Storage is a storage.Storer whose references are the ones of a namespace
+// of a base storer. The objects, the config, the index and the shallow
+// commits are the ones of the base storer.
+//
+// The objects can't be pruned or repacked through a Storage, since the
+// objects reachable from the other namespaces would be considered
+// unreachable: it doesn't implement storer.LooseObjectStorer nor
+// storer.PackedObjectStorer.
+type Storage struct {
+	storage.Storer
+	prefix string
+}
+
+// packfileWriter is a Storage whose base storer is a storer.PackfileWriter.
+type packfileWriter struct {
+	*Storage
+	pw storer.PackfileWriter
+}
+
+// NewStorage returns a storer whose references are the ones of the given
+// namespace of s. The nested namespaces are separated by slashes, the
+// references of the namespace "a/b" being stored under
+// refs/namespaces/a/refs/namespaces/b/. It returns s if the namespace is
+// empty.
+func NewStorage(s storage.Storer, namespace string) (storage.Storer, error) {
+	if namespace == "" {
+		return s, nil
+	}
+
+	prefix, err := Prefix(namespace)
+	if err != nil {
+		return nil, err
+	}
+
+	return newStorage(s, prefix), nil
+}
+
+func newStorage(s storage.Storer, prefix string) storage.Storer {
+	st := &Storage{Storer: s, prefix: prefix}
+	if pw, ok := s.(storer.PackfileWriter); ok {
+		return &packfileWriter{Storage: st, pw: pw}
+	}
+
+	return st
+}
+
+// Prefix returns the prefix of the names of the references of the given
+// namespace, such as refs/namespaces/foo/ for foo.
+func Prefix(namespace string) (string, error) {
+	var b strings.Builder
+	for _, part := range strings.Split(namespace, "/") {
+		if part == "" {
+			return "", fmt.Errorf("%w: %q", ErrInvalidNamespace, namespace)
+		}
+
+		b.WriteString("refs/namespaces/")
+		b.WriteString(part)
+		b.WriteString("/")
+	}
+
+	prefix := b.String()
+	if err := plumbing.ReferenceName(prefix + "HEAD").Validate(); err != nil {
+		return "", fmt.Errorf("%w: %q", ErrInvalidNamespace, namespace)
+	}
+
+	return prefix, nil
+}
+
+// Base returns the storer whose references are scoped to the namespace.
+func (s *Storage) Base() storage.Storer {
+	return s.Storer
+}
+
+// Prefix returns the prefix of the names of the references of the
+// namespace in the base storer.
+func (s *Storage) Prefix() string {
+	return s.prefix
+}
+
+// SetReference stores the given reference in the namespace.
+func (s *Storage) SetReference(ref *plumbing.Reference) error {
+	return s.Storer.SetReference(s.toBase(ref))
+}
+
+// CheckAndSetReference stores the given reference in the namespace, if old
+// is nil or matches the current reference of the namespace.
+func (s *Storage) CheckAndSetReference(ref, old *plumbing.Reference) error {
+	if old != nil {
+		old = s.toBase(old)
+	}
+
+	return s.Storer.CheckAndSetReference(s.toBase(ref), old)
+}
+
+// Reference returns the reference of the namespace with the given name.
+func (s *Storage) Reference(name plumbing.ReferenceName) (*plumbing.Reference, error) {
+	ref, err := s.Storer.Reference(s.name(name))
+	if err != nil {
+		return nil, err
+	}
+
+	return s.fromBase(name, ref), nil
+}
+
+// IterReferences iterates over the references of the namespace.
+func (s *Storage) IterReferences() (storer.ReferenceIter, error) {
+	iter, err := s.Storer.IterReferences()
+	if err != nil {
+		return nil, err
+	}
+
+	var refs []*plumbing.Reference
+	err = iter.ForEach(func(ref *plumbing.Reference) error {
+		name, ok := strings.CutPrefix(ref.Name().String(), s.prefix)
+		if ok {
+			refs = append(refs, s.fromBase(plumbing.ReferenceName(name), ref))
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return storer.NewReferenceSliceIter(refs), nil
+}
+
+// RemoveReference removes the reference of the namespace with the given
+// name.
+func (s *Storage) RemoveReference(name plumbing.ReferenceName) error {
+	return s.Storer.RemoveReference(s.name(name))
+}
+
+// UpdateReferences applies the given updates of the references of the
+// namespace atomically, if the base storer implements
+// storage.ReferenceTransactionStorer. They are checked and applied one by
+// one otherwise.
+func (s *Storage) UpdateReferences(updates []storage.ReferenceUpdate) error {
+	mapped := make([]storage.ReferenceUpdate, len(updates))
+	for i, u := range updates {
+		u.Name = s.name(u.Name)
+		mapped[i] = u
+	}
+
+	if ts, ok := s.Storer.(storage.ReferenceTransactionStorer); ok {
+		err := ts.UpdateReferences(mapped)
+		var uerr *storage.ReferenceUpdateError
+		if errors.As(err, &uerr) {
+			uerr.Name = s.stripName(uerr.Name)
+		}
+
+		return err
+	}
+
+	if err := storage.CheckReferenceUpdates(s, updates); err != nil {
+		return err
+	}
+
+	for _, u := range mapped {
+		var err error
+		if u.NewHash.IsZero() {
+			err = s.Storer.RemoveReference(u.Name)
+		} else {
+			err = s.Storer.SetReference(plumbing.NewHashReference(u.Name, u.NewHash))
+		}
+
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Reflog returns the reflog of the reference of the namespace with the given
+// name. No entries are returned if the base storer doesn't implement
+// storage.ReflogStorer.
+func (s *Storage) Reflog(name plumbing.ReferenceName) ([]*reflog.Entry, error) {
+	rs, ok := s.Storer.(storage.ReflogStorer)
+	if !ok {
+		return nil, nil
+	}
+
+	return rs.Reflog(s.name(name))
+}
+
+// AppendReflog appends an entry to the reflog of the reference of the
+// namespace with the given name, if the base storer implements
+// storage.ReflogStorer.
+func (s *Storage) AppendReflog(name plumbing.ReferenceName, e *reflog.Entry) error {
+	if rs, ok := s.Storer.(storage.ReflogStorer); ok {
+		return rs.AppendReflog(s.name(name), e)
+	}
+
+	return nil
+}
+
+// SetReflog replaces the reflog of the reference of the namespace with the
+// given name, if the base storer implements storage.ReflogStorer.
+func (s *Storage) SetReflog(name plumbing.ReferenceName, entries []*reflog.Entry) error {
+	if rs, ok := s.Storer.(storage.ReflogStorer); ok {
+		return rs.SetReflog(s.name(name), entries)
+	}
+
+	return nil
+}
+
+// RemoveReflog removes the reflog of the reference of the namespace with the
+// given name, if the base storer implements storage.ReflogStorer.
+func (s *Storage) RemoveReflog(name plumbing.ReferenceName) error {
+	if rs, ok := s.Storer.(storage.ReflogStorer); ok {
+		return rs.RemoveReflog(s.name(name))
+	}
+
+	return nil
+}
+
+// DeltaObject returns the object with the given hash without resolving it,
+// if the base storer implements storer.DeltaObjectStorer.
+func (s *Storage) DeltaObject(t plumbing.ObjectType, h plumbing.Hash) (plumbing.EncodedObject, error) {
+	if ds, ok := s.Storer.(storer.DeltaObjectStorer); ok {
+		return ds.DeltaObject(t, h)
+	}
+
+	return s.Storer.EncodedObject(t, h)
+}
+
+// HasObjects returns which of the given objects are stored in the base
+// storer.
+func (s *Storage) HasObjects(hashes []plumbing.Hash) (map[plumbing.Hash]bool, error) {
+	return storer.HasObjects(s.Storer, hashes)
+}
+
+// Grafts returns the grafts of the base storer, the replace references not
+// being scoped to the namespace.
+func (s *Storage) Grafts() (*storer.Grafts, error) {
+	if gs, ok := s.Storer.(storer.GraftStorer); ok {
+		return gs.Grafts()
+	}
+
+	return nil, nil
+}
+
+// NoReplaceObjects returns the storage of the namespace reading the objects
+// of the base storer as they are stored, see storage.NoReplaceObjects.
+func (s *Storage) NoReplaceObjects() storage.Storer {
+	return newStorage(storage.NoReplaceObjects(s.Storer), s.prefix)
+}
+
+// name returns the name in the base storer of the reference of the
+// namespace with the given name.
+func (s *Storage) name(name plumbing.ReferenceName) plumbing.ReferenceName {
+	return plumbing.ReferenceName(s.prefix + name.String())
+}
+
+// stripName returns the name in the namespace of the reference of the base
+// storer with the given name, or the name itself if it is out of the
+// namespace.
+func (s *Storage) stripName(name plumbing.ReferenceName) plumbing.ReferenceName {
+	return plumbing.ReferenceName(strings.TrimPrefix(name.String(), s.prefix))
+}
+
+func (s *Storage) toBase(ref *plumbing.Reference) *plumbing.Reference {
+	if ref.Type() == plumbing.SymbolicReference {
+		return plumbing.NewSymbolicReference(s.name(ref.Name()), s.name(ref.Target()))
+	}
+
+	return plumbing.NewHashReference(s.name(ref.Name()), ref.Hash())
+}
+
+func (s *Storage) fromBase(name plumbing.ReferenceName, ref *plumbing.Reference) *plumbing.Reference {
+	if ref.Type() == plumbing.SymbolicReference {
+		return plumbing.NewSymbolicReference(name, s.stripName(ref.Target()))
+	}
+
+	return plumbing.NewHashReference(name, ref.Hash())
+}
+
+// PackfileWriter returns a writer of a packfile to the base storer.
+func (s *packfileWriter) PackfileWriter() (io.WriteCloser, error) {
+	return s.pw.PackfileWriter()
+}
+
+// PackfileWriterWithOptions returns a writer of a packfile to the base
+// storer, parsed with the given options if the base storer implements
+// packfile.ParserOptionsPackfileWriter.
+func (s *packfileWriter) PackfileWriterWithOptions(opts ...packfile.ParserOption) (io.WriteCloser, error) {
+	if pw, ok := s.pw.(packfile.ParserOptionsPackfileWriter); ok {
+		return pw.PackfileWriterWithOptions(opts...)
+	}
+
+	return s.pw.PackfileWriter()
+}
+
+// AcceptsThinPacks reports whether the base storer accepts thin packs.
+func (s *packfileWriter) AcceptsThinPacks() bool {
+	return packfile.AcceptsThinPacks(s.Storer)
+}
@@ -0,0 +1,170 @@
+package namespace
+
+import (
+	"testing"
+
+	fixtures "github.com/go-git/go-git-fixtures/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/go-git/go-git/v6/plumbing"
+	"github.com/go-git/go-git/v6/plumbing/cache"
+	"github.com/go-git/go-git/v6/plumbing/format/packfile"
+	"github.com/go-git/go-git/v6/plumbing/format/reflog"
+	"github.com/go-git/go-git/v6/plumbing/storer"
+	"github.com/go-git/go-git/v6/storage"
+	"github.com/go-git/go-git/v6/storage/filesystem"
+	"github.com/go-git/go-git/v6/storage/memory"
+)
+
+var (
+	master = plumbing.NewHash("6ecf0ef2c2dffb796033e5a02219af86ec6584e5")
+	branch = plumbing.NewHash("e8d3ffab552895c19b9fcf7aa264d277cde33881")
+)
+
+func TestPrefix(t *testing.T) {
+	t.Parallel()
+
+	for namespace, expected := range map[string]string{
+		"foo":   "refs/namespaces/foo/",
+		"a/b":   "refs/namespaces/a/refs/namespaces/b/",
+		"a.b-c": "refs/namespaces/a.b-c/",
+	} {
+		prefix, err := Prefix(namespace)
+		require.NoError(t, err)
+		assert.Equal(t, expected, prefix)
+	}
+
+	for _, namespace := range []string{"/", "a//b", "a/", "a..b", "a:b"} {
+		_, err := Prefix(namespace)
+		assert.ErrorIs(t, err, ErrInvalidNamespace, namespace)
+	}
+}
+
+func TestNewStorageEmptyNamespace(t *testing.T) {
+	t.Parallel()
+
+	base := memory.NewStorage()
+	st, err := NewStorage(base, "")
+	require.NoError(t, err)
+	assert.Same(t, base, st)
+}
+
+func TestReferences(t *testing.T) {
+	t.Parallel()
+
+	base := memory.NewStorage()
+	require.NoError(t, base.SetReference(plumbing.NewHashReference(plumbing.Master, master)))
+	require.NoError(t, base.SetReference(plumbing.NewHashReference("refs/namespaces/bar/refs/heads/main", master)))
+
+	st, err := NewStorage(base, "foo")
+	require.NoError(t, err)
+
+	main := plumbing.NewBranchReferenceName("main")
+	require.NoError(t, st.SetReference(plumbing.NewHashReference(main, branch)))
+	require.NoError(t, st.SetReference(plumbing.NewSymbolicReference(plumbing.HEAD, main)))
+
+	ref, err := base.Reference("refs/namespaces/foo/refs/heads/main")
+	require.NoError(t, err)
+	assert.Equal(t, branch, ref.Hash())
+	ref, err = base.Reference("refs/namespaces/foo/HEAD")
+	require.NoError(t, err)
+	assert.Equal(t, plumbing.ReferenceName("refs/namespaces/foo/refs/heads/main"), ref.Target())
+
+	ref, err = st.Reference(plumbing.HEAD)
+	require.NoError(t, err)
+	assert.Equal(t, plumbing.NewSymbolicReference(plumbing.HEAD, main), ref)
+	ref, err = storer.ResolveReference(st, plumbing.HEAD)
+	require.NoError(t, err)
+	assert.Equal(t, plumbing.NewHashReference(main, branch), ref)
+	_, err = st.Reference(plumbing.Master)
+	assert.ErrorIs(t, err, plumbing.ErrReferenceNotFound)
+
+	iter, err := st.IterReferences()
+	require.NoError(t, err)
+	var names []string
+	require.NoError(t, iter.ForEach(func(ref *plumbing.Reference) error {
+		names = append(names, ref.String())
+		return nil
+	}))
+	assert.ElementsMatch(t, []string{
+		"ref: refs/heads/main HEAD",
+		branch.String() + " refs/heads/main",
+	}, names)
+
+	err = st.CheckAndSetReference(plumbing.NewHashReference(main, master), plumbing.NewHashReference(main, master))
+	assert.ErrorIs(t, err, storage.ErrReferenceHasChanged)
+	require.NoError(t, st.CheckAndSetReference(plumbing.NewHashReference(main, master), plumbing.NewHashReference(main, branch)))
+
+	require.NoError(t, st.RemoveReference(main))
+	_, err = base.Reference("refs/namespaces/foo/refs/heads/main")
+	assert.ErrorIs(t, err, plumbing.ErrReferenceNotFound)
+	_, err = base.Reference("refs/namespaces/bar/refs/heads/main")
+	assert.NoError(t, err)
+}
+
+func TestUpdateReferences(t *testing.T) {
+	t.Parallel()
+
+	base := memory.NewStorage()
+	require.NoError(t, base.SetReference(plumbing.NewHashReference(plumbing.Master, master)))
+
+	st, err := NewStorage(base, "foo")
+	require.NoError(t, err)
+	ts, ok := st.(storage.ReferenceTransactionStorer)
+	require.True(t, ok)
+
+	require.NoError(t, ts.UpdateReferences([]storage.ReferenceUpdate{
+		{Name: plumbing.Master, NewHash: branch},
+	}))
+	ref, err := base.Reference("refs/namespaces/foo/refs/heads/master")
+	require.NoError(t, err)
+	assert.Equal(t, branch, ref.Hash())
+
+	err = ts.UpdateReferences([]storage.ReferenceUpdate{
+		{Name: plumbing.Master, OldHash: master, NewHash: branch},
+	})
+	assert.Equal(t, &storage.ReferenceUpdateError{Name: plumbing.Master, Expected: master, Actual: branch}, err)
+}
+
+func TestReflog(t *testing.T) {
+	t.Parallel()
+
+	base := memory.NewStorage()
+	st, err := NewStorage(base, "foo")
+	require.NoError(t, err)
+
+	rs, ok := st.(storage.ReflogStorer)
+	require.True(t, ok)
+	entry := &reflog.Entry{New: master, Message: "created"}
+	require.NoError(t, rs.AppendReflog(plumbing.Master, entry))
+
+	entries, err := base.Reflog("refs/namespaces/foo/refs/heads/master")
+	require.NoError(t, err)
+	assert.Equal(t, []*reflog.Entry{entry}, entries)
+	entries, err = rs.Reflog(plumbing.Master)
+	require.NoError(t, err)
+	assert.Equal(t, []*reflog.Entry{entry}, entries)
+}
+
+func TestObjects(t *testing.T) {
+	t.Parallel()
+
+	dot := fixtures.Basic().One().DotGit(fixtures.WithTargetDir(t.TempDir))
+	base := filesystem.NewStorage(dot, cache.NewObjectLRUDefault())
+	st, err := NewStorage(base, "foo")
+	require.NoError(t, err)
+
+	// The objects of the base storer are shared by all the namespaces.
+	assert.NoError(t, st.HasEncodedObject(master))
+	assert.True(t, packfile.AcceptsThinPacks(st))
+	_, ok := st.(packfile.ParserOptionsPackfileWriter)
+	assert.True(t, ok)
+	_, ok = st.(storer.PackedObjectStorer)
+	assert.False(t, ok)
+
+	st, err = NewStorage(memory.NewStorage(), "foo")
+	require.NoError(t, err)
+	_, ok = st.(storer.PackfileWriter)
+	assert.False(t, ok)
+}
@@ -2,12 +2,20 @@ package storage
 
 import (
 	"errors"
+	"fmt"
 
 	"github.com/go-git/go-git/v6/config"
+	"github.com/go-git/go-git/v6/plumbing"
+	"github.com/go-git/go-git/v6/plumbing/format/reflog"
 	"github.com/go-git/go-git/v6/plumbing/storer"
 )
 
-var ErrReferenceHasChanged = errors.New("reference has changed concurrently")
+var (
+	ErrReferenceHasChanged = errors.New("reference has changed concurrently")
+	// ErrMultipleReferenceUpdates is returned when updating a reference more
+	// than once in the same transaction.
+	ErrMultipleReferenceUpdates = errors.New("multiple updates of the same reference")
+)
 
 // Storer is a generic storage of objects, references and any information
 // related to a particular repository. The package github.com/go-git/go-git/v6/storage
@@ -22,9 +30,136 @@ type Storer interface {
 	ModuleStorer
 }
 
+// ReplaceObjectsStorer is implemented by the storers reading the objects
+// replaced by refs/replace/* references as their replacement, as git does.
+type ReplaceObjectsStorer interface {
+	// NoReplaceObjects returns the storer reading the objects as they are
+	// stored, as git does with --no-replace-objects. Its grafts are the
+	// shallow commits and the grafts of the info/grafts file only.
+	NoReplaceObjects() Storer
+}
+
+// NoReplaceObjects returns the storer reading the objects of s as they are
+// stored, ignoring the refs/replace/* references, if s is a
+// ReplaceObjectsStorer, or s itself. It is used where the objects must be
+// read as they are stored, such as when they are packed or checked.
+func NoReplaceObjects(s Storer) Storer {
+	if rs, ok := s.(ReplaceObjectsStorer); ok {
+		return rs.NoReplaceObjects()
+	}
+
+	return s
+}
+
 // ModuleStorer allows interact with the modules' Storers
 type ModuleStorer interface {
 	// Module returns a Storer representing a submodule, if not exists returns a
 	// new empty Storer is returned
 	Module(name string) (Storer, error)
 }
+
+// ReflogStorer is implemented by the storers keeping the reflogs, the logs of
+// the updates of the references. It is optional: the updates of the
+// references are not logged by the storers not implementing it.
+type ReflogStorer interface {
+	// Reflog returns the entries of the reflog of the given reference, the
+	// oldest first. No entries are returned if the reference has no reflog.
+	Reflog(name plumbing.ReferenceName) ([]*reflog.Entry, error)
+	// AppendReflog appends an entry to the reflog of the given reference,
+	// creating the reflog if needed.
+	AppendReflog(name plumbing.ReferenceName, e *reflog.Entry) error
+	// SetReflog replaces the entries of the reflog of the given reference.
+	SetReflog(name plumbing.ReferenceName, entries []*reflog.Entry) error
+	// RemoveReflog removes the reflog of the given reference, if any.
+	RemoveReflog(name plumbing.ReferenceName) error
+}
+
+// ReferenceUpdate is an update of a reference, applied along with the other
+// updates of a transaction by a ReferenceTransactionStorer.
+type ReferenceUpdate struct {
+	// Name is the name of the updated reference.
+	Name plumbing.ReferenceName
+	// OldHash is the hash the reference must point to for the transaction
+	// to be applied, or plumbing.ZeroHash if the reference must not exist.
+	OldHash plumbing.Hash
+	// NewHash is the hash the reference is updated to, or plumbing.ZeroHash
+	// to delete the reference.
+	NewHash plumbing.Hash
+}
+
+// ReferenceUpdateError is returned when the precondition of an update of a
+// transaction is not met, the reference not pointing to the expected hash.
+// It wraps ErrReferenceHasChanged.
+type ReferenceUpdateError struct {
+	// Name is the name of the reference.
+	Name plumbing.ReferenceName
+	// Expected is the OldHash of the update.
+	Expected plumbing.Hash
+	// Actual is the hash the reference points to, or plumbing.ZeroHash if it
+	// does not exist or is a symbolic reference.
+	Actual plumbing.Hash
+}
+
+func (e *ReferenceUpdateError) Error() string {
+	return fmt.Sprintf("cannot update reference %s: expected %s, found %s",
+		e.Name, describeReferenceHash(e.Expected), describeReferenceHash(e.Actual))
+}
+
+func (e *ReferenceUpdateError) Unwrap() error {
+	return ErrReferenceHasChanged
+}
+
+func describeReferenceHash(h plumbing.Hash) string {
+	if h.IsZero() {
+		return "no reference"
+	}
+
+	return h.String()
+}
+
+// ReferenceTransactionStorer is implemented by the storers updating several
+// references atomically, as `git update-ref --stdin` does.
+type ReferenceTransactionStorer interface {
+	// UpdateReferences checks the preconditions of all the updates, and
+	// applies them all if they are met, or none of them, returning a
+	// *ReferenceUpdateError, otherwise. The references are updated as is,
+	// the symbolic ones are not resolved, and the reflogs of the deleted
+	// references are removed.
+	UpdateReferences(updates []ReferenceUpdate) error
+}
+
+// CheckReferenceUpdates checks the preconditions of the given updates against
+// the references of s, returning ErrMultipleReferenceUpdates if a reference
+// is updated more than once, or a *ReferenceUpdateError. It is meant for
+// implementing ReferenceTransactionStorer in the storers whose updates cannot
+// happen concurrently.
+func CheckReferenceUpdates(s storer.ReferenceStorer, updates []ReferenceUpdate) error {
+	seen := make(map[plumbing.ReferenceName]bool, len(updates))
+	for _, u := range updates {
+		if seen[u.Name] {
+			return fmt.Errorf("%w: %s", ErrMultipleReferenceUpdates, u.Name)
+		}
+
+		seen[u.Name] = true
+		ref, err := s.Reference(u.Name)
+		switch {
+		case errors.Is(err, plumbing.ErrReferenceNotFound):
+			if u.OldHash.IsZero() {
+				continue
+			}
+		case err != nil:
+			return err
+		case ref.Type() == plumbing.HashReference && !u.OldHash.IsZero() && ref.Hash() == u.OldHash:
+			continue
+		}
+
+		actual := plumbing.ZeroHash
+		if ref != nil && ref.Type() == plumbing.HashReference {
+			actual = ref.Hash()
+		}
+
+		return &ReferenceUpdateError{Name: u.Name, Expected: u.OldHash, Actual: actual}
+	}
+
+	return nil
+}
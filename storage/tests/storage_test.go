@@ -1,6 +1,7 @@
 package tests
 
 import (
+	"bytes"
 	"fmt"
 	"io"
 	"testing"
@@ -191,6 +192,81 @@ func TestSetEncodedObjectAndEncodedObject(t *testing.T) {
 	})
 }
 
+func TestHasObjects(t *testing.T) {
+	t.Parallel()
+
+	forEachStorage(t, func(sto Storer, t *testing.T) {
+		bs, ok := sto.(storer.BulkObjectStorer)
+		if !ok {
+			t.Skip("not a BulkObjectStorer")
+		}
+
+		expected := make(map[plumbing.Hash]bool)
+		if pwr, ok := sto.(storer.PackfileWriter); ok {
+			pw, err := pwr.PackfileWriter()
+			require.NoError(t, err)
+			_, err = io.Copy(pw, fixtures.Basic().One().Packfile())
+			require.NoError(t, err)
+			require.NoError(t, pw.Close())
+
+			expected[plumbing.NewHash("32858aad3c383ed1ff0a0f9bdf231d54a00c9e88")] = true
+		}
+
+		for _, to := range testObjects() {
+			h, err := sto.SetEncodedObject(to.Object)
+			require.NoError(t, err)
+			expected[h] = true
+		}
+
+		expected[plumbing.NewHash("0000000000000000000000000000000000000001")] = false
+		expected[plumbing.NewHash("32858aad3c383ed1ff0a0f9bdf231d54a00c9e89")] = false
+
+		hashes := make([]plumbing.Hash, 0, len(expected))
+		for h := range expected {
+			hashes = append(hashes, h)
+		}
+
+		found, err := bs.HasObjects(hashes)
+		require.NoError(t, err)
+		assert.Equal(t, expected, found)
+
+		found, err = storer.HasObjects(sto, hashes)
+		require.NoError(t, err)
+		assert.Equal(t, expected, found)
+	})
+}
+
+func TestNewObjectWriter(t *testing.T) {
+	t.Parallel()
+
+	forEachStorage(t, func(sto Storer, t *testing.T) {
+		content := bytes.Repeat([]byte("content\n"), 1<<16)
+		expected := &plumbing.MemoryObject{}
+		expected.SetType(plumbing.BlobObject)
+		_, err := expected.Write(content)
+		require.NoError(t, err)
+
+		w, err := storer.NewObjectWriter(sto, plumbing.BlobObject)
+		require.NoError(t, err)
+		_, err = io.Copy(w, bytes.NewReader(content))
+		require.NoError(t, err)
+		require.NoError(t, w.Close())
+		assert.Equal(t, expected.Hash(), w.Hash())
+
+		obj, err := sto.EncodedObject(plumbing.BlobObject, w.Hash())
+		require.NoError(t, err)
+		r, err := obj.Reader()
+		require.NoError(t, err)
+		b, err := io.ReadAll(r)
+		require.NoError(t, err)
+		require.NoError(t, r.Close())
+		assert.Equal(t, content, b)
+
+		_, err = storer.NewObjectWriter(sto, plumbing.OFSDeltaObject)
+		assert.ErrorIs(t, err, plumbing.ErrInvalidType)
+	})
+}
+
 func TestSetEncodedObjectInvalid(t *testing.T) {
 	t.Parallel()
 
@@ -435,6 +511,85 @@ func TestCheckAndSetReferenceError(t *testing.T) {
 	})
 }
 
+func TestUpdateReferences(t *testing.T) {
+	t.Parallel()
+
+	forEachStorage(t, func(sto Storer, t *testing.T) {
+		ts, ok := sto.(storage.ReferenceTransactionStorer)
+		require.True(t, ok)
+
+		foo := plumbing.NewHash("6ecf0ef2c2dffb796033e5a02219af86ec6584e5")
+		bar := plumbing.NewHash("bc9968d75e48de59f0870ffb71f5e160bbbdcf52")
+		require.NoError(t, sto.SetReference(plumbing.NewHashReference("refs/heads/foo", foo)))
+		require.NoError(t, sto.SetReference(plumbing.NewHashReference("refs/heads/bar", bar)))
+
+		err := ts.UpdateReferences([]storage.ReferenceUpdate{
+			{Name: "refs/heads/foo", OldHash: foo, NewHash: bar},
+			{Name: "refs/heads/bar", OldHash: bar},
+			{Name: "refs/heads/qux", NewHash: foo},
+		})
+		require.NoError(t, err)
+
+		e, err := sto.Reference("refs/heads/foo")
+		require.NoError(t, err)
+		assert.Equal(t, bar, e.Hash())
+
+		_, err = sto.Reference("refs/heads/bar")
+		assert.ErrorIs(t, err, plumbing.ErrReferenceNotFound)
+
+		e, err = sto.Reference("refs/heads/qux")
+		require.NoError(t, err)
+		assert.Equal(t, foo, e.Hash())
+	})
+}
+
+func TestUpdateReferencesPreconditionFailed(t *testing.T) {
+	t.Parallel()
+
+	forEachStorage(t, func(sto Storer, t *testing.T) {
+		ts, ok := sto.(storage.ReferenceTransactionStorer)
+		require.True(t, ok)
+
+		foo := plumbing.NewHash("6ecf0ef2c2dffb796033e5a02219af86ec6584e5")
+		bar := plumbing.NewHash("bc9968d75e48de59f0870ffb71f5e160bbbdcf52")
+		require.NoError(t, sto.SetReference(plumbing.NewHashReference("refs/heads/foo", foo)))
+
+		for _, tc := range []struct {
+			update storage.ReferenceUpdate
+			actual plumbing.Hash
+		}{
+			{storage.ReferenceUpdate{Name: "refs/heads/foo", OldHash: bar, NewHash: bar}, foo},
+			{storage.ReferenceUpdate{Name: "refs/heads/foo", NewHash: bar}, foo},
+			{storage.ReferenceUpdate{Name: "refs/heads/qux", OldHash: foo, NewHash: bar}, plumbing.ZeroHash},
+		} {
+			err := ts.UpdateReferences([]storage.ReferenceUpdate{
+				{Name: "refs/heads/bar", NewHash: bar},
+				tc.update,
+			})
+			assert.ErrorIs(t, err, storage.ErrReferenceHasChanged)
+
+			var uerr *storage.ReferenceUpdateError
+			require.ErrorAs(t, err, &uerr)
+			assert.Equal(t, tc.update.Name, uerr.Name)
+			assert.Equal(t, tc.update.OldHash, uerr.Expected)
+			assert.Equal(t, tc.actual, uerr.Actual)
+		}
+
+		err := ts.UpdateReferences([]storage.ReferenceUpdate{
+			{Name: "refs/heads/foo", OldHash: foo, NewHash: bar},
+			{Name: "refs/heads/foo", OldHash: foo},
+		})
+		assert.ErrorIs(t, err, storage.ErrMultipleReferenceUpdates)
+
+		e, err := sto.Reference("refs/heads/foo")
+		require.NoError(t, err)
+		assert.Equal(t, foo, e.Hash())
+
+		_, err = sto.Reference("refs/heads/bar")
+		assert.ErrorIs(t, err, plumbing.ErrReferenceNotFound)
+	})
+}
+
 func TestRemoveReference(t *testing.T) {
 	t.Parallel()
 
@@ -34,6 +34,36 @@ func (o *ObjectStorage) HasEncodedObject(h plumbing.Hash) error {
 	return err
 }
 
+// HasObjects honors the storer.BulkObjectStorer interface.
+func (o *ObjectStorage) HasObjects(hashes []plumbing.Hash) (map[plumbing.Hash]bool, error) {
+	found, err := storer.HasObjects(o.EncodedObjectStorer, hashes)
+	if err != nil {
+		return nil, err
+	}
+
+	var missing []plumbing.Hash
+	for _, h := range hashes {
+		if !found[h] {
+			missing = append(missing, h)
+		}
+	}
+
+	if len(missing) == 0 {
+		return found, nil
+	}
+
+	temporal, err := storer.HasObjects(o.temporal, missing)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, h := range missing {
+		found[h] = temporal[h]
+	}
+
+	return found, nil
+}
+
 // EncodedObjectSize honors the storer.EncodedObjectStorer interface.
 func (o *ObjectStorage) EncodedObjectSize(h plumbing.Hash) (int64, error) {
 	sz, err := o.EncodedObjectStorer.EncodedObjectSize(h)
@@ -114,6 +114,30 @@ func (r ReferenceStorage) RemoveReference(n plumbing.ReferenceName) error {
 	return r.temporal.RemoveReference(n)
 }
 
+// UpdateReferences honors the storage.ReferenceTransactionStorer interface,
+// the updates being applied to the base storer on commit.
+func (r *ReferenceStorage) UpdateReferences(updates []storage.ReferenceUpdate) error {
+	if err := storage.CheckReferenceUpdates(r, updates); err != nil {
+		return err
+	}
+
+	for _, u := range updates {
+		if u.NewHash.IsZero() {
+			if err := r.RemoveReference(u.Name); err != nil {
+				return err
+			}
+
+			continue
+		}
+
+		if err := r.SetReference(plumbing.NewHashReference(u.Name, u.NewHash)); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
 // Commit it copies the reference information of the temporal storage into the
 // base storage.
 func (r ReferenceStorage) Commit() error {
@@ -5,19 +5,39 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"io/fs"
+	"os"
 	"path"
+	"path/filepath"
+	"slices"
+	"strings"
 
 	"github.com/go-git/go-billy/v6"
+	"github.com/go-git/go-billy/v6/osfs"
+	"github.com/go-git/go-billy/v6/util"
 
 	"github.com/go-git/go-git/v6/config"
 	"github.com/go-git/go-git/v6/plumbing"
+	"github.com/go-git/go-git/v6/plumbing/cache"
 	"github.com/go-git/go-git/v6/plumbing/format/index"
+	"github.com/go-git/go-git/v6/plumbing/storer"
 	"github.com/go-git/go-git/v6/plumbing/transport"
+	"github.com/go-git/go-git/v6/storage/filesystem"
 )
 
 var (
 	ErrSubmoduleAlreadyInitialized = errors.New("submodule already initialized")
 	ErrSubmoduleNotInitialized     = errors.New("submodule not initialized")
+	// ErrSubmoduleModified is returned by Submodule.Deinit, without force,
+	// when the worktree of the submodule has local modifications.
+	ErrSubmoduleModified = errors.New("submodule worktree contains local modifications")
+	// ErrSubmoduleGitDir is returned by Submodule.Deinit when the worktree
+	// of the submodule contains its repository, that would be lost.
+	ErrSubmoduleGitDir = errors.New("submodule worktree contains a .git directory")
+	// ErrGitlinkWithoutCommit is returned by Worktree.Add when the directory
+	// added is a repository whose HEAD has no commit, to be staged as the
+	// commit of a gitlink.
+	ErrGitlinkWithoutCommit = errors.New("directory does not have a commit checked out")
 )
 
 // Submodule a submodule allows you to keep another Git repository in a
@@ -54,6 +74,85 @@ func (s *Submodule) Init() error {
 	return s.w.r.Storer.SetConfig(cfg)
 }
 
+// Deinit unregisters the submodule, as `git submodule deinit`: its entry is
+// removed from the config and its worktree is emptied, while its repository
+// is kept to be initialized again. Without force, the submodule is not
+// deinitialized if its worktree has local modifications.
+func (s *Submodule) Deinit(force bool) error {
+	fi, err := s.w.Filesystem.Lstat(path.Join(s.c.Path, GitDirName))
+	if err == nil && fi.IsDir() {
+		return ErrSubmoduleGitDir
+	}
+
+	if s.initialized && !force {
+		if err := s.checkUnmodified(); err != nil {
+			return err
+		}
+	}
+
+	files, err := s.w.Filesystem.ReadDir(s.c.Path)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	for _, fi := range files {
+		if err := util.RemoveAll(s.w.Filesystem, path.Join(s.c.Path, fi.Name())); err != nil {
+			return err
+		}
+	}
+
+	cfg, err := s.w.r.Config()
+	if err != nil {
+		return err
+	}
+
+	s.initialized = false
+	if _, ok := cfg.Submodules[s.c.Name]; !ok {
+		return nil
+	}
+
+	delete(cfg.Submodules, s.c.Name)
+	return s.w.r.Storer.SetConfig(cfg)
+}
+
+// checkUnmodified returns ErrSubmoduleModified if the worktree of the
+// submodule, when checked out, is not clean.
+func (s *Submodule) checkUnmodified() error {
+	storer, err := s.w.r.Storer.Module(s.c.Name)
+	if err != nil {
+		return err
+	}
+
+	if _, err := storer.Reference(plumbing.HEAD); err != nil {
+		if errors.Is(err, plumbing.ErrReferenceNotFound) {
+			return nil
+		}
+
+		return err
+	}
+
+	r, err := s.Repository()
+	if err != nil {
+		return err
+	}
+
+	w, err := r.Worktree()
+	if err != nil {
+		return err
+	}
+
+	status, err := w.Status()
+	if err != nil {
+		return err
+	}
+
+	if !status.IsClean() {
+		return ErrSubmoduleModified
+	}
+
+	return nil
+}
+
 // Status returns the status of the submodule.
 func (s *Submodule) Status() (*SubmoduleStatus, error) {
 	idx, err := s.w.r.Storer.Index()
@@ -126,7 +225,17 @@ func (s *Submodule) Repository() (*Repository, error) {
 	}
 
 	if exists {
-		return Open(storer, worktree)
+		r, err := Open(storer, worktree)
+		if err != nil {
+			return nil, err
+		}
+
+		// The .git file of the worktree is removed by Deinit.
+		if _, err := worktree.Lstat(GitDirName); os.IsNotExist(err) {
+			return r, setWorktreeAndStoragePaths(r, worktree)
+		}
+
+		return r, nil
 	}
 
 	r, err := Init(storer, WithWorkTree(worktree))
@@ -134,26 +243,13 @@ func (s *Submodule) Repository() (*Repository, error) {
 		return nil, err
 	}
 
+	// The relative URLs were resolved by Worktree.Submodules, against the URL
+	// of the superproject remote.
 	moduleEndpoint, err := transport.NewEndpoint(s.c.URL)
 	if err != nil {
 		return nil, err
 	}
 
-	if !path.IsAbs(moduleEndpoint.Path) && moduleEndpoint.Scheme == "file" {
-		remotes, err := s.w.r.Remotes()
-		if err != nil {
-			return nil, err
-		}
-
-		rootEndpoint, err := transport.NewEndpoint(remotes[0].c.URLs[0])
-		if err != nil {
-			return nil, err
-		}
-
-		rootEndpoint.Path = path.Join(rootEndpoint.Path, moduleEndpoint.Path)
-		*moduleEndpoint = *rootEndpoint
-	}
-
 	_, err = r.CreateRemote(&config.RemoteConfig{
 		Name: DefaultRemoteName,
 		URLs: []string{moduleEndpoint.String()},
@@ -233,6 +329,13 @@ func (s *Submodule) doRecursiveUpdate(ctx context.Context, r *Repository, o *Sub
 		return err
 	}
 
+	if !o.Init {
+		// As in git, the nested submodules not initialized are skipped.
+		l = slices.DeleteFunc(l, func(sub *Submodule) bool {
+			return !sub.initialized
+		})
+	}
+
 	new := &SubmoduleUpdateOptions{}
 	*new = *o
 
@@ -274,7 +377,14 @@ func (s *Submodule) fetchAndCheckout(
 		}
 	}
 
-	if err := w.Checkout(&CheckoutOptions{Hash: hash}); err != nil {
+	// As in git, the checkout is forced when the submodule is not populated,
+	// such as after Deinit.
+	populated, err := s.isPopulated()
+	if err != nil {
+		return err
+	}
+
+	if err := w.Checkout(&CheckoutOptions{Hash: hash, Force: !populated}); err != nil {
 		return err
 	}
 
@@ -282,6 +392,18 @@ func (s *Submodule) fetchAndCheckout(
 	return r.Storer.SetReference(head)
 }
 
+// isPopulated returns whether the worktree of the submodule contains files.
+func (s *Submodule) isPopulated() (bool, error) {
+	files, err := s.w.Filesystem.ReadDir(s.c.Path)
+	if err != nil && !os.IsNotExist(err) {
+		return false, err
+	}
+
+	return slices.ContainsFunc(files, func(fi fs.DirEntry) bool {
+		return fi.Name() != GitDirName
+	}), nil
+}
+
 // Submodules list of several submodules from the same repository.
 type Submodules []*Submodule
 
@@ -397,3 +519,59 @@ func (s *SubmoduleStatus) String() string {
 
 	return fmt.Sprintf("%c%s %s%s", status, s.Expected, s.Path, extra)
 }
+
+// nestedRepositoryHead returns the commit of the HEAD of the repository nested
+// in the directory path of fs, the commit of its gitlink, along with true if
+// the directory is a repository, with a .git directory or a .git file pointing
+// to its git directory. The zero hash is returned for the repositories whose
+// HEAD has no commit.
+func nestedRepositoryHead(fs billy.Filesystem, dir string) (plumbing.Hash, bool) {
+	if dir == "" || dir == "." {
+		return plumbing.ZeroHash, false
+	}
+
+	gitDir := fs.Join(dir, GitDirName)
+	fi, err := fs.Lstat(gitDir)
+	if err != nil {
+		return plumbing.ZeroHash, false
+	}
+
+	if !fi.IsDir() {
+		content, err := util.ReadFile(fs, gitDir)
+		if err != nil {
+			return plumbing.ZeroHash, false
+		}
+
+		target, ok := strings.CutPrefix(strings.TrimSpace(string(content)), "gitdir: ")
+		if !ok {
+			return plumbing.ZeroHash, false
+		}
+
+		gitDir = fs.Join(dir, target)
+		if filepath.IsAbs(target) {
+			return repositoryHead(osfs.New(target, osfs.WithBoundOS()))
+		}
+	}
+
+	dot, err := fs.Chroot(gitDir)
+	if err != nil {
+		return plumbing.ZeroHash, false
+	}
+
+	return repositoryHead(dot)
+}
+
+// repositoryHead returns the commit of the HEAD of the repository whose git
+// directory is dot, see nestedRepositoryHead.
+func repositoryHead(dot billy.Filesystem) (plumbing.Hash, bool) {
+	if _, err := dot.Stat("HEAD"); err != nil {
+		return plumbing.ZeroHash, false
+	}
+
+	ref, err := storer.ResolveReference(filesystem.NewStorage(dot, cache.NewObjectLRUDefault()), plumbing.HEAD)
+	if err != nil {
+		return plumbing.ZeroHash, true
+	}
+
+	return ref.Hash(), true
+}
@@ -2,14 +2,21 @@ package git
 
 import (
 	"context"
+	"os"
+	"path/filepath"
 	"testing"
 
 	"github.com/go-git/go-billy/v6/memfs"
+	"github.com/go-git/go-billy/v6/util"
 	fixtures "github.com/go-git/go-git-fixtures/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 	"github.com/stretchr/testify/suite"
 
 	"github.com/go-git/go-git/v6/config"
 	"github.com/go-git/go-git/v6/plumbing"
+	"github.com/go-git/go-git/v6/plumbing/filemode"
+	"github.com/go-git/go-git/v6/plumbing/format/index"
 	"github.com/go-git/go-git/v6/storage/memory"
 )
 
@@ -273,3 +280,217 @@ func (s *SubmoduleSuite) TestSubmoduleParseScp() {
 	_, err := submodule.Repository()
 	s.Require().NoError(err)
 }
+
+// newSubmoduleRepository initializes a repository at dir, with a commit adding
+// the given file and the given submodules, at the given commits. The URLs of
+// the submodules are relative, their repositories being next to dir.
+func newSubmoduleRepository(t *testing.T, dir, file string, submodules map[string]plumbing.Hash) plumbing.Hash {
+	t.Helper()
+
+	r, err := PlainInit(dir, false)
+	require.NoError(t, err)
+	w, err := r.Worktree()
+	require.NoError(t, err)
+
+	require.NoError(t, util.WriteFile(w.Filesystem, file, []byte(file+"\n"), 0o644))
+	_, err = w.Add(file)
+	require.NoError(t, err)
+
+	if len(submodules) > 0 {
+		modules := config.NewModules()
+		for name := range submodules {
+			modules.Submodules[name] = &config.Submodule{Name: name, Path: name, URL: "../" + name}
+		}
+
+		content, err := modules.Marshal()
+		require.NoError(t, err)
+		require.NoError(t, util.WriteFile(w.Filesystem, gitmodulesFile, content, 0o644))
+		_, err = w.Add(gitmodulesFile)
+		require.NoError(t, err)
+
+		idx, err := r.Storer.Index()
+		require.NoError(t, err)
+		for name, hash := range submodules {
+			idx.Entries = append(idx.Entries, &index.Entry{Name: name, Mode: filemode.Submodule, Hash: hash})
+		}
+		require.NoError(t, r.Storer.SetIndex(idx))
+	}
+
+	h, err := w.Commit(file+"\n", &CommitOptions{Author: defaultSignature()})
+	require.NoError(t, err)
+	return h
+}
+
+// newNestedSubmodules creates a superproject with the submodule sub, having
+// itself the submodule nested, and returns the path of the superproject.
+func newNestedSubmodules(t *testing.T) string {
+	t.Helper()
+
+	root := t.TempDir()
+	nested := newSubmoduleRepository(t, filepath.Join(root, "nested"), "nested.txt", nil)
+	sub := newSubmoduleRepository(t, filepath.Join(root, "sub"), "sub.txt", map[string]plumbing.Hash{"nested": nested})
+	newSubmoduleRepository(t, filepath.Join(root, "super"), "super.txt", map[string]plumbing.Hash{"sub": sub})
+
+	return filepath.Join(root, "super")
+}
+
+func cloneNestedSubmodules(t *testing.T) (*Repository, *Worktree) {
+	t.Helper()
+
+	r, err := PlainClone(t.TempDir(), &CloneOptions{URL: newNestedSubmodules(t)})
+	require.NoError(t, err)
+	w, err := r.Worktree()
+	require.NoError(t, err)
+
+	return r, w
+}
+
+func TestSubmoduleUpdateRecursive(t *testing.T) {
+	t.Parallel()
+
+	for _, tc := range []struct {
+		depth  SubmoduleRecursivity
+		nested bool
+	}{
+		{NoRecurseSubmodules, false},
+		{1, true},
+		{DefaultSubmoduleRecursionDepth, true},
+	} {
+		_, w := cloneNestedSubmodules(t)
+		l, err := w.Submodules()
+		require.NoError(t, err)
+		require.NoError(t, l.Update(&SubmoduleUpdateOptions{Init: true, RecurseSubmodules: tc.depth}))
+
+		_, err = w.Filesystem.Lstat("sub/sub.txt")
+		assert.NoError(t, err)
+		_, err = w.Filesystem.Lstat("sub/nested/nested.txt")
+		assert.Equal(t, tc.nested, err == nil, tc.depth)
+
+		status, err := w.Status()
+		require.NoError(t, err)
+		assert.True(t, status.IsClean(), status)
+	}
+}
+
+func TestSubmoduleUpdateRecursiveWithoutInit(t *testing.T) {
+	t.Parallel()
+
+	_, w := cloneNestedSubmodules(t)
+	l, err := w.Submodules()
+	require.NoError(t, err)
+	require.NoError(t, l.Init())
+
+	// The nested submodules, not initialized, are skipped.
+	require.NoError(t, l.Update(&SubmoduleUpdateOptions{RecurseSubmodules: DefaultSubmoduleRecursionDepth}))
+
+	_, err = w.Filesystem.Lstat("sub/sub.txt")
+	assert.NoError(t, err)
+	_, err = w.Filesystem.Lstat("sub/nested/nested.txt")
+	assert.ErrorIs(t, err, os.ErrNotExist)
+}
+
+func TestSubmoduleRelativeURL(t *testing.T) {
+	t.Parallel()
+
+	// The URLs are relative to the URL of the remote of the superproject.
+	_, w := cloneNestedSubmodules(t)
+	sub, err := w.Submodule("sub")
+	require.NoError(t, err)
+	require.NoError(t, sub.Update(&SubmoduleUpdateOptions{Init: true, RecurseSubmodules: DefaultSubmoduleRecursionDepth}))
+
+	r, err := PlainOpen(w.Filesystem.Root())
+	require.NoError(t, err)
+	origin, err := r.Remote(DefaultRemoteName)
+	require.NoError(t, err)
+	root := filepath.Dir(origin.Config().URLs[0])
+
+	subRepo, err := sub.Repository()
+	require.NoError(t, err)
+	remote, err := subRepo.Remote(DefaultRemoteName)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"file://" + filepath.Join(root, "sub")}, remote.Config().URLs)
+
+	subWorktree, err := subRepo.Worktree()
+	require.NoError(t, err)
+	nested, err := subWorktree.Submodule("nested")
+	require.NoError(t, err)
+	assert.Equal(t, "file://"+filepath.Join(root, "nested"), nested.Config().URL)
+
+	// Without remote, they are relative to the superproject itself.
+	super, err := PlainOpen(newNestedSubmodules(t))
+	require.NoError(t, err)
+	w, err = super.Worktree()
+	require.NoError(t, err)
+	sub, err = w.Submodule("sub")
+	require.NoError(t, err)
+	assert.Equal(t, filepath.Join(filepath.Dir(w.Filesystem.Root()), "sub"), sub.Config().URL)
+	require.NoError(t, sub.Update(&SubmoduleUpdateOptions{Init: true}))
+
+	_, err = w.Filesystem.Lstat("sub/sub.txt")
+	assert.NoError(t, err)
+}
+
+func TestSubmoduleDeinit(t *testing.T) {
+	t.Parallel()
+
+	r, w := cloneNestedSubmodules(t)
+	sub, err := w.Submodule("sub")
+	require.NoError(t, err)
+	require.NoError(t, sub.Update(&SubmoduleUpdateOptions{Init: true}))
+
+	require.NoError(t, util.WriteFile(w.Filesystem, "sub/sub.txt", []byte("modified\n"), 0o644))
+	assert.ErrorIs(t, sub.Deinit(false), ErrSubmoduleModified)
+
+	require.NoError(t, sub.Deinit(true))
+
+	files, err := w.Filesystem.ReadDir("sub")
+	require.NoError(t, err)
+	assert.Empty(t, files)
+
+	cfg, err := r.Config()
+	require.NoError(t, err)
+	assert.NotContains(t, cfg.Submodules, "sub")
+
+	status, err := sub.Status()
+	require.NoError(t, err)
+	assert.True(t, status.Current.IsZero())
+
+	// The submodule can be initialized again, its repository being kept.
+	require.NoError(t, sub.Update(&SubmoduleUpdateOptions{Init: true, NoFetch: true}))
+	_, err = w.Filesystem.Lstat("sub/sub.txt")
+	assert.NoError(t, err)
+	st, err := w.Filesystem.Lstat("sub/.git")
+	require.NoError(t, err)
+	assert.False(t, st.IsDir())
+	require.NoError(t, sub.Deinit(false))
+}
+
+func TestSubmoduleWorktreeStatus(t *testing.T) {
+	t.Parallel()
+
+	_, w := cloneNestedSubmodules(t)
+	sub, err := w.Submodule("sub")
+	require.NoError(t, err)
+	require.NoError(t, sub.Update(&SubmoduleUpdateOptions{Init: true}))
+
+	subRepo, err := sub.Repository()
+	require.NoError(t, err)
+	subWorktree, err := subRepo.Worktree()
+	require.NoError(t, err)
+	require.NoError(t, util.WriteFile(subWorktree.Filesystem, "new.txt", []byte("new\n"), 0o644))
+	_, err = subWorktree.Add("new.txt")
+	require.NoError(t, err)
+	_, err = subWorktree.Commit("new\n", &CommitOptions{Author: defaultSignature()})
+	require.NoError(t, err)
+
+	// The submodule not being at the commit recorded by the superproject,
+	// it is reported as modified.
+	status, err := w.Status()
+	require.NoError(t, err)
+	assert.Equal(t, Modified, status.File("sub").Worktree)
+	assert.Equal(t, Unmodified, status.File("sub").Staging)
+
+	s, err := sub.Status()
+	require.NoError(t, err)
+	assert.False(t, s.IsClean())
+}
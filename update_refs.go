@@ -0,0 +1,77 @@
+package git
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/go-git/go-git/v6/plumbing"
+	"github.com/go-git/go-git/v6/storage"
+)
+
+// ErrReferenceTransactionNotSupported is returned by UpdateRefs when the
+// storer cannot update several references atomically.
+var ErrReferenceTransactionNotSupported = errors.New("atomic reference updates not supported by the storer")
+
+// RefUpdate is an update of a reference, applied along with the other updates
+// given to UpdateRefs.
+type RefUpdate struct {
+	// Name is the name of the updated reference.
+	Name plumbing.ReferenceName
+	// OldHash is the hash the reference must point to for the updates to be
+	// applied, or plumbing.ZeroHash if the reference must not exist.
+	OldHash plumbing.Hash
+	// NewHash is the hash the reference is updated to, or plumbing.ZeroHash
+	// to delete the reference.
+	NewHash plumbing.Hash
+}
+
+// UpdateRefs updates several references atomically, as a transaction of
+// `git update-ref --stdin` does: the updates are all applied if the
+// references point to their OldHash, or none of them is, a
+// *storage.ReferenceUpdateError naming the first reference whose
+// precondition failed being returned, which wraps
+// storage.ErrReferenceHasChanged.
+//
+// The references are updated as is, without resolving the symbolic ones, and
+// their new objects must exist. The updates are logged in the reflogs, with
+// an empty message as `git update-ref` without -m, and the reflogs of the
+// deleted references are removed. ErrReferenceTransactionNotSupported is
+// returned if the storer does not implement
+// storage.ReferenceTransactionStorer.
+func (r *Repository) UpdateRefs(updates []RefUpdate) error {
+	s, ok := r.Storer.(storage.ReferenceTransactionStorer)
+	if !ok {
+		return ErrReferenceTransactionNotSupported
+	}
+
+	txn := make([]storage.ReferenceUpdate, 0, len(updates))
+	for _, u := range updates {
+		if err := u.Name.Validate(); err != nil {
+			return fmt.Errorf("%w: %s", err, u.Name)
+		}
+
+		if !u.NewHash.IsZero() {
+			if err := r.Storer.HasEncodedObject(u.NewHash); err != nil {
+				return fmt.Errorf("cannot update reference %s to %s: %w", u.Name, u.NewHash, err)
+			}
+		}
+
+		txn = append(txn, storage.ReferenceUpdate(u))
+	}
+
+	if err := s.UpdateReferences(txn); err != nil {
+		return err
+	}
+
+	for _, u := range updates {
+		if u.NewHash.IsZero() {
+			continue
+		}
+
+		if err := r.logRefUpdateWithHead(u.Name, u.OldHash, u.NewHash, nil, ""); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,89 @@
+package git
+
+import (
+	"testing"
+
+	"github.com/go-git/go-billy/v6/memfs"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/go-git/go-git/v6/plumbing"
+	"github.com/go-git/go-git/v6/plumbing/cache"
+	"github.com/go-git/go-git/v6/storage"
+	"github.com/go-git/go-git/v6/storage/filesystem"
+)
+
+func TestUpdateRefs(t *testing.T) {
+	t.Parallel()
+
+	st := filesystem.NewStorage(memfs.New(), cache.NewObjectLRUDefault())
+	r, _ := newRebaseRepository(t, st, "b")
+
+	master, err := r.Reference(plumbing.Master, false)
+	require.NoError(t, err)
+	feature, err := r.Reference("refs/heads/feature", false)
+	require.NoError(t, err)
+
+	err = r.UpdateRefs([]RefUpdate{
+		{Name: plumbing.Master, OldHash: master.Hash(), NewHash: feature.Hash()},
+		{Name: "refs/heads/feature", OldHash: feature.Hash(), NewHash: master.Hash()},
+		{Name: "refs/tags/v1", NewHash: master.Hash()},
+	})
+	require.NoError(t, err)
+
+	for name, h := range map[plumbing.ReferenceName]plumbing.Hash{
+		plumbing.Master:      feature.Hash(),
+		"refs/heads/feature": master.Hash(),
+		"refs/tags/v1":       master.Hash(),
+	} {
+		ref, err := r.Reference(name, false)
+		require.NoError(t, err)
+		assert.Equal(t, h, ref.Hash(), name)
+	}
+
+	// The updates are logged, in the reflog of HEAD as well for the current
+	// branch.
+	assert.Equal(t, []string{"", "commit: master", "commit (initial): base"}, reflogMessages(t, r, plumbing.Master))
+	entries, err := r.Reflog(plumbing.HEAD)
+	require.NoError(t, err)
+	assert.Equal(t, "", entries[0].Message)
+	assert.Equal(t, feature.Hash(), entries[0].Old)
+	assert.Equal(t, master.Hash(), entries[0].New)
+
+	err = r.UpdateRefs([]RefUpdate{
+		{Name: "refs/tags/v1", OldHash: master.Hash()},
+		{Name: plumbing.Master, OldHash: master.Hash(), NewHash: master.Hash()},
+	})
+	var uerr *storage.ReferenceUpdateError
+	require.ErrorAs(t, err, &uerr)
+	assert.Equal(t, plumbing.Master, uerr.Name)
+	assert.Equal(t, feature.Hash(), uerr.Actual)
+
+	_, err = r.Reference("refs/tags/v1", false)
+	require.NoError(t, err)
+
+	err = r.UpdateRefs([]RefUpdate{{Name: "refs/tags/v1", OldHash: master.Hash()}})
+	require.NoError(t, err)
+	_, err = r.Reference("refs/tags/v1", false)
+	assert.ErrorIs(t, err, plumbing.ErrReferenceNotFound)
+}
+
+func TestUpdateRefsInvalid(t *testing.T) {
+	t.Parallel()
+
+	st := filesystem.NewStorage(memfs.New(), cache.NewObjectLRUDefault())
+	r, _ := newRebaseRepository(t, st, "b")
+
+	err := r.UpdateRefs([]RefUpdate{
+		{Name: "refs/heads/missing", NewHash: plumbing.NewHash("1111111111111111111111111111111111111111")},
+	})
+	assert.ErrorIs(t, err, plumbing.ErrObjectNotFound)
+
+	master, err := r.Reference(plumbing.Master, false)
+	require.NoError(t, err)
+	err = r.UpdateRefs([]RefUpdate{{Name: "refs/heads/a..b", NewHash: master.Hash()}})
+	assert.ErrorIs(t, err, plumbing.ErrInvalidReferenceName)
+
+	_, err = r.Reference("refs/heads/missing", false)
+	assert.ErrorIs(t, err, plumbing.ErrReferenceNotFound)
+}
@@ -106,3 +106,48 @@ func (conv *lfToCRLFWriter) Write(data []byte) (int, error) {
 	rest, err := conv.w.Write(data[n:])
 	return n + rest, err
 }
+
+type writerReader struct {
+	r     io.Reader
+	w     io.Writer
+	buf   bytes.Buffer
+	chunk []byte
+	err   error
+}
+
+// NewLFReader wraps a reader to convert CRLF line endings into LF line
+// endings, as NewLFWriter. It assumes that data is text; not binary.
+func NewLFReader(r io.Reader) io.Reader {
+	c := &writerReader{r: r}
+	c.w = NewLFWriter(&c.buf)
+	return c
+}
+
+// NewCRLFReader wraps a reader to convert LF line endings into CRLF line
+// endings, as NewCRLFWriter. It assumes that data is text; not binary.
+func NewCRLFReader(r io.Reader) io.Reader {
+	c := &writerReader{r: r}
+	c.w = NewCRLFWriter(&c.buf)
+	return c
+}
+
+func (c *writerReader) Read(p []byte) (int, error) {
+	if c.chunk == nil {
+		c.chunk = make([]byte, 32*1024)
+	}
+
+	for c.buf.Len() == 0 && c.err == nil {
+		n, err := c.r.Read(c.chunk)
+		if _, werr := c.w.Write(c.chunk[:n]); werr != nil {
+			return 0, werr
+		}
+
+		c.err = err
+	}
+
+	if c.buf.Len() > 0 {
+		return c.buf.Read(p)
+	}
+
+	return 0, c.err
+}
@@ -2,7 +2,9 @@ package convert
 
 import (
 	"bytes"
+	"io"
 	"testing"
+	"testing/iotest"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
@@ -65,3 +67,23 @@ func TestLFToCRLFConverter(t *testing.T) {
 		})
 	}
 }
+
+func TestEOLReaders(t *testing.T) {
+	// The line endings split between reads are converted.
+	input := bytes.Repeat([]byte("line\r\n"), 20000)
+
+	b, err := io.ReadAll(NewLFReader(iotest.OneByteReader(bytes.NewReader(input))))
+	require.NoError(t, err)
+	assert.Equal(t, bytes.Repeat([]byte("line\n"), 20000), b)
+
+	b, err = io.ReadAll(NewLFReader(bytes.NewReader(input)))
+	require.NoError(t, err)
+	assert.Equal(t, bytes.Repeat([]byte("line\n"), 20000), b)
+
+	b, err = io.ReadAll(NewCRLFReader(iotest.OneByteReader(bytes.NewReader([]byte("a\nb\r\nc")))))
+	require.NoError(t, err)
+	assert.Equal(t, []byte("a\r\nb\r\nc"), b)
+
+	_, err = io.ReadAll(NewCRLFReader(iotest.ErrReader(io.ErrUnexpectedEOF)))
+	assert.ErrorIs(t, err, io.ErrUnexpectedEOF)
+}
@@ -8,9 +8,12 @@ package diff
 
 import (
 	"bytes"
+	"strings"
 	"time"
 
 	"github.com/sergi/go-diff/diffmatchpatch"
+
+	"github.com/go-git/go-git/v6/internal/text"
 )
 
 // Do computes the (line oriented) modifications needed to turn the src
@@ -59,3 +62,71 @@ func Src(diffs []diffmatchpatch.Diff) string {
 	}
 	return text.String()
 }
+
+// Options are the options of DoWithOptions, the lines equal once their
+// whitespace is ignored being equal, as with the options of the same name
+// of git diff.
+type Options struct {
+	// IgnoreAllSpace ignores the whitespace of the lines, as -w.
+	IgnoreAllSpace bool
+	// IgnoreSpaceChange ignores the whitespace at the end of the lines and
+	// the changes in the amount of whitespace, as -b.
+	IgnoreSpaceChange bool
+}
+
+// DoWithOptions computes the (line oriented) modifications needed to turn
+// the src string into the dst string, as Do, comparing the lines as the
+// options say. The equal lines are the ones of dst, as git shows them, so
+// Src does not return src if lines only equal ignoring whitespace are.
+func DoWithOptions(src, dst string, opts Options) (diffs []diffmatchpatch.Diff) {
+	if !opts.IgnoreAllSpace && !opts.IgnoreSpaceChange {
+		return Do(src, dst)
+	}
+
+	srcLines, dstLines := text.SplitLines(src), text.SplitLines(dst)
+	dmp := diffmatchpatch.New()
+	dmp.DiffTimeout = time.Hour
+	wSrc, wDst, _ := dmp.DiffLinesToRunes(normalizeLines(srcLines, opts), normalizeLines(dstLines, opts))
+	for _, d := range dmp.DiffMainRunes(wSrc, wDst, false) {
+		n := len([]rune(d.Text))
+		var lines []string
+		switch d.Type {
+		case diffmatchpatch.DiffEqual:
+			lines, srcLines, dstLines = dstLines[:n], srcLines[n:], dstLines[n:]
+		case diffmatchpatch.DiffDelete:
+			lines, srcLines = srcLines[:n], srcLines[n:]
+		case diffmatchpatch.DiffInsert:
+			lines, dstLines = dstLines[:n], dstLines[n:]
+		}
+
+		diffs = append(diffs, diffmatchpatch.Diff{Type: d.Type, Text: strings.Join(lines, "")})
+	}
+
+	return diffs
+}
+
+// normalizeLines returns the lines joined once their whitespace is ignored
+// as the options say.
+func normalizeLines(lines []string, opts Options) string {
+	var sb strings.Builder
+	for _, line := range lines {
+		text, eol := strings.CutSuffix(line, "\n")
+		fields := strings.Fields(text)
+		if opts.IgnoreAllSpace {
+			sb.WriteString(strings.Join(fields, ""))
+		} else {
+			// The leading whitespace is still compared, as a single space.
+			if len(fields) > 0 && strings.TrimLeft(text, " \t\v\f\r") != text {
+				sb.WriteByte(' ')
+			}
+
+			sb.WriteString(strings.Join(fields, " "))
+		}
+
+		if eol {
+			sb.WriteByte('\n')
+		}
+	}
+
+	return sb.String()
+}
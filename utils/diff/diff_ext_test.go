@@ -141,3 +141,23 @@ func (s *suiteCommon) TestDo() {
 		s.Equal(t.exp, diffs, fmt.Sprintf("subtest %d", i))
 	}
 }
+
+func (s *suiteCommon) TestDoWithOptions() {
+	const src = "a  b\n\tc\nd \ne\n"
+	const dst = "a b\n    c\nd\n e\n"
+
+	diffs := diff.DoWithOptions(src, dst, diff.Options{})
+	s.Equal(diff.Do(src, dst), diffs)
+
+	// The equal lines are the ones of dst.
+	diffs = diff.DoWithOptions(src, dst, diff.Options{IgnoreAllSpace: true})
+	s.Equal([]diffmatchpatch.Diff{{Type: 0, Text: dst}}, diffs)
+
+	diffs = diff.DoWithOptions(src, dst, diff.Options{IgnoreSpaceChange: true})
+	s.Equal([]diffmatchpatch.Diff{
+		{Type: 0, Text: "a b\n    c\nd\n"},
+		{Type: -1, Text: "e\n"},
+		{Type: 1, Text: " e\n"},
+	}, diffs)
+	s.Equal(dst, diff.Dst(diffs))
+}
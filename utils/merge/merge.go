@@ -0,0 +1,318 @@
+// Package merge implements line oriented three-way merges of files, similar
+// to git merge-file.
+//
+// The lines changed on each side are computed with the same diff algorithm
+// as the diff package, and the changes are combined: the changes made on
+// only one side, or identically on both sides, are merged cleanly, and the
+// other ones are left as conflicts, delimited by conflict markers.
+package merge
+
+import (
+	"bytes"
+	"errors"
+	"sort"
+	"time"
+	"unicode/utf8"
+
+	"github.com/sergi/go-diff/diffmatchpatch"
+
+	"github.com/go-git/go-git/v6/internal/text"
+	"github.com/go-git/go-git/v6/utils/binary"
+)
+
+// ErrBinary is returned when merging binary content.
+var ErrBinary = errors.New("cannot merge binary files")
+
+// DefaultMarkerSize is the default length of the conflict markers.
+const DefaultMarkerSize = 7
+
+// ConflictStyle is the way conflicts are written.
+type ConflictStyle int
+
+const (
+	// MergeStyle writes the ours and theirs versions of the conflicting
+	// lines. The lines common to both at the start and the end of a
+	// conflict are left out of it.
+	MergeStyle ConflictStyle = iota
+	// Diff3Style writes the base version of the conflicting lines too,
+	// between the ours and theirs versions.
+	Diff3Style
+)
+
+// MergeFileOptions describes how a file is merged.
+type MergeFileOptions struct {
+	// OursLabel, BaseLabel and TheirsLabel are written after the conflict
+	// markers of each version. If empty, the markers are written alone.
+	OursLabel   string
+	BaseLabel   string
+	TheirsLabel string
+	// MarkerSize is the length of the conflict markers. If zero,
+	// DefaultMarkerSize is used.
+	MarkerSize int
+	// Style is the way conflicts are written.
+	Style ConflictStyle
+}
+
+// File merges the changes made from base to ours and from base to theirs.
+// It returns the merged content and the number of conflicts in it, or
+// ErrBinary if any of the contents is binary.
+//
+// The end of line of the conflict markers is CRLF if the lines of ours
+// end with CRLF, and LF otherwise. A missing newline at the end of a
+// conflicting version is added before the next marker.
+func File(base, ours, theirs []byte, opts *MergeFileOptions) (result []byte, conflicts int, err error) {
+	if opts == nil {
+		opts = &MergeFileOptions{}
+	}
+
+	for _, content := range [][]byte{base, ours, theirs} {
+		isBinary, err := binary.IsBinary(bytes.NewReader(content))
+		if err != nil {
+			return nil, 0, err
+		}
+
+		if isBinary {
+			return nil, 0, ErrBinary
+		}
+	}
+
+	m := &merger{
+		base:   text.SplitLines(base),
+		ours:   text.SplitLines(ours),
+		theirs: text.SplitLines(theirs),
+		opts:   opts,
+		size:   opts.MarkerSize,
+	}
+
+	if m.size <= 0 {
+		m.size = DefaultMarkerSize
+	}
+
+	m.eol = "\n"
+	for _, lines := range [][][]byte{m.ours, m.theirs, m.base} {
+		if crlf, ok := lineEnding(lines); ok {
+			if crlf {
+				m.eol = "\r\n"
+			}
+
+			break
+		}
+	}
+
+	m.merge()
+	return m.buf.Bytes(), m.conflicts, nil
+}
+
+type merger struct {
+	base, ours, theirs [][]byte
+	opts               *MergeFileOptions
+	size               int
+	eol                string
+
+	buf       bytes.Buffer
+	conflicts int
+}
+
+// hunk is a range of lines of the base replaced by a range of lines of one
+// of the sides.
+type hunk struct {
+	theirs             bool
+	baseStart, baseEnd int
+	sideStart, sideEnd int
+}
+
+func (m *merger) merge() {
+	hunks := append(diffLines(m.base, m.ours, false), diffLines(m.base, m.theirs, true)...)
+	sort.SliceStable(hunks, func(i, j int) bool {
+		return hunks[i].baseStart < hunks[j].baseStart
+	})
+
+	pos := 0
+	for i := 0; i < len(hunks); {
+		start, end := hunks[i].baseStart, hunks[i].baseEnd
+		j := i + 1
+		// The hunks overlapping or adjacent to the region, from any of the
+		// sides, are part of it.
+		for ; j < len(hunks) && hunks[j].baseStart <= end; j++ {
+			end = max(end, hunks[j].baseEnd)
+		}
+
+		m.write(m.base[pos:start])
+
+		ours, oursChanged := sideLines(hunks[i:j], false, m.ours, m.base, start, end)
+		theirs, theirsChanged := sideLines(hunks[i:j], true, m.theirs, m.base, start, end)
+		switch {
+		case !theirsChanged:
+			m.write(ours)
+		case !oursChanged:
+			m.write(theirs)
+		case text.EqualLines(ours, theirs):
+			m.write(ours)
+		default:
+			m.conflict(m.base[start:end], ours, theirs)
+		}
+
+		pos = end
+		i = j
+	}
+
+	m.write(m.base[pos:])
+}
+
+// sideLines returns the lines of one side corresponding to the given base
+// region, and whether they are changed.
+func sideLines(hunks []hunk, theirs bool, side, base [][]byte, start, end int) ([][]byte, bool) {
+	var first, last *hunk
+	for i := range hunks {
+		if hunks[i].theirs == theirs {
+			if first == nil {
+				first = &hunks[i]
+			}
+
+			last = &hunks[i]
+		}
+	}
+
+	if first == nil {
+		return base[start:end], false
+	}
+
+	sideStart := first.sideStart - (first.baseStart - start)
+	sideEnd := last.sideEnd + (end - last.baseEnd)
+	return side[sideStart:sideEnd], true
+}
+
+func (m *merger) conflict(base, ours, theirs [][]byte) {
+	m.conflicts++
+
+	var prefix, suffix int
+	if m.opts.Style != Diff3Style {
+		for prefix < min(len(ours), len(theirs)) && bytes.Equal(ours[prefix], theirs[prefix]) {
+			prefix++
+		}
+
+		for suffix < min(len(ours), len(theirs))-prefix &&
+			bytes.Equal(ours[len(ours)-1-suffix], theirs[len(theirs)-1-suffix]) {
+			suffix++
+		}
+	}
+
+	m.write(ours[:prefix])
+	m.marker('<', m.opts.OursLabel)
+	m.writeSide(ours[prefix : len(ours)-suffix])
+	if m.opts.Style == Diff3Style {
+		m.marker('|', m.opts.BaseLabel)
+		m.writeSide(base)
+	}
+
+	m.marker('=', "")
+	m.writeSide(theirs[prefix : len(theirs)-suffix])
+	m.marker('>', m.opts.TheirsLabel)
+	m.write(ours[len(ours)-suffix:])
+}
+
+func (m *merger) marker(c byte, label string) {
+	m.buf.Write(bytes.Repeat([]byte{c}, m.size))
+	if label != "" {
+		m.buf.WriteByte(' ')
+		m.buf.WriteString(label)
+	}
+
+	m.buf.WriteString(m.eol)
+}
+
+func (m *merger) write(lines [][]byte) {
+	for _, l := range lines {
+		m.buf.Write(l)
+	}
+}
+
+// writeSide writes the lines of one of the versions of a conflict, ending
+// them with a newline, as a marker follows.
+func (m *merger) writeSide(lines [][]byte) {
+	m.write(lines)
+	if len(lines) > 0 && !bytes.HasSuffix(lines[len(lines)-1], []byte("\n")) {
+		m.buf.WriteString(m.eol)
+	}
+}
+
+// diffLines returns the hunks changing base into side.
+func diffLines(base, side [][]byte, theirs bool) []hunk {
+	runes := make(map[string]rune)
+	toRunes := func(lines [][]byte) []rune {
+		rs := make([]rune, len(lines))
+		for i, l := range lines {
+			r, ok := runes[string(l)]
+			if !ok {
+				r = rune(len(runes))
+				// Skip the surrogates, which are not valid runes.
+				if r >= 0xd800 {
+					r += 0x800
+				}
+
+				runes[string(l)] = r
+			}
+
+			rs[i] = r
+		}
+
+		return rs
+	}
+
+	dmp := diffmatchpatch.New()
+	dmp.DiffTimeout = time.Hour
+	diffs := dmp.DiffMainRunes(toRunes(base), toRunes(side), false)
+
+	var hunks []hunk
+	var current *hunk
+	var baseIdx, sideIdx int
+	for _, d := range diffs {
+		n := utf8.RuneCountInString(d.Text)
+		if d.Type == diffmatchpatch.DiffEqual {
+			if current != nil {
+				hunks = append(hunks, *current)
+				current = nil
+			}
+
+			baseIdx += n
+			sideIdx += n
+			continue
+		}
+
+		if current == nil {
+			current = &hunk{theirs: theirs, baseStart: baseIdx, baseEnd: baseIdx, sideStart: sideIdx, sideEnd: sideIdx}
+		}
+
+		if d.Type == diffmatchpatch.DiffDelete {
+			baseIdx += n
+			current.baseEnd = baseIdx
+		} else {
+			sideIdx += n
+			current.sideEnd = sideIdx
+		}
+	}
+
+	if current != nil {
+		hunks = append(hunks, *current)
+	}
+
+	return hunks
+}
+
+// lineEnding returns whether all the lines ending with a newline end with
+// CRLF, and whether there is any such line.
+func lineEnding(lines [][]byte) (crlf, ok bool) {
+	crlf = true
+	for _, l := range lines {
+		if !bytes.HasSuffix(l, []byte("\n")) {
+			continue
+		}
+
+		ok = true
+		if !bytes.HasSuffix(l, []byte("\r\n")) {
+			crlf = false
+		}
+	}
+
+	return crlf && ok, ok
+}
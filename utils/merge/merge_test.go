@@ -0,0 +1,174 @@
+package merge
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFile(t *testing.T) {
+	t.Parallel()
+
+	labels := &MergeFileOptions{OursLabel: "ours", BaseLabel: "base", TheirsLabel: "theirs"}
+	tests := []struct {
+		name               string
+		base, ours, theirs string
+		opts               *MergeFileOptions
+		expected           string
+		conflicts          int
+	}{
+		{
+			name:     "unchanged",
+			base:     "a\nb\nc\n",
+			ours:     "a\nb\nc\n",
+			theirs:   "a\nb\nc\n",
+			expected: "a\nb\nc\n",
+		},
+		{
+			name:     "changes on different lines",
+			base:     "a\nb\nc\nd\ne\n",
+			ours:     "A\nb\nc\nd\ne\n",
+			theirs:   "a\nb\nc\nd\nE\n",
+			expected: "A\nb\nc\nd\nE\n",
+		},
+		{
+			name:     "change on one side",
+			base:     "a\nb\nc\n",
+			ours:     "a\nb\nc\n",
+			theirs:   "a\nB\nB2\nc\n",
+			expected: "a\nB\nB2\nc\n",
+		},
+		{
+			name:     "identical additions",
+			base:     "a\nb\n",
+			ours:     "a\nx\nb\ny\n",
+			theirs:   "a\nx\nb\n",
+			expected: "a\nx\nb\ny\n",
+		},
+		{
+			name:     "identical additions to an empty base",
+			base:     "",
+			ours:     "a\n",
+			theirs:   "a\n",
+			expected: "a\n",
+		},
+		{
+			name:      "conflict",
+			base:      "a\nb\nc\n",
+			ours:      "a\nours\nc\n",
+			theirs:    "a\ntheirs\nc\n",
+			opts:      labels,
+			expected:  "a\n<<<<<<< ours\nours\n=======\ntheirs\n>>>>>>> theirs\nc\n",
+			conflicts: 1,
+		},
+		{
+			name:      "conflict without labels",
+			base:      "a\n",
+			ours:      "b\n",
+			theirs:    "c\n",
+			expected:  "<<<<<<<\nb\n=======\nc\n>>>>>>>\n",
+			conflicts: 1,
+		},
+		{
+			name:      "adjacent changes conflict",
+			base:      "a\nb\n",
+			ours:      "A\nb\n",
+			theirs:    "a\nB\n",
+			opts:      labels,
+			expected:  "<<<<<<< ours\nA\nb\n=======\na\nB\n>>>>>>> theirs\n",
+			conflicts: 1,
+		},
+		{
+			name:      "common lines are left out of the conflict",
+			base:      "a\n",
+			ours:      "x\nours\ny\n",
+			theirs:    "x\ntheirs\ny\n",
+			opts:      labels,
+			expected:  "x\n<<<<<<< ours\nours\n=======\ntheirs\n>>>>>>> theirs\ny\n",
+			conflicts: 1,
+		},
+		{
+			name:      "diff3",
+			base:      "a\nbase\nc\n",
+			ours:      "a\nx\nours\nc\n",
+			theirs:    "a\nx\ntheirs\nc\n",
+			opts:      &MergeFileOptions{OursLabel: "ours", BaseLabel: "base", TheirsLabel: "theirs", Style: Diff3Style},
+			expected:  "a\n<<<<<<< ours\nx\nours\n||||||| base\nbase\n=======\nx\ntheirs\n>>>>>>> theirs\nc\n",
+			conflicts: 1,
+		},
+		{
+			name:      "marker size",
+			base:      "a\n",
+			ours:      "b\n",
+			theirs:    "c\n",
+			opts:      &MergeFileOptions{MarkerSize: 3},
+			expected:  "<<<\nb\n===\nc\n>>>\n",
+			conflicts: 1,
+		},
+		{
+			name:      "multiple conflicts",
+			base:      "a\nb\nc\nd\ne\n",
+			ours:      "1\nb\nc\nd\n1\n",
+			theirs:    "2\nb\nc\nd\n2\n",
+			expected:  "<<<<<<<\n1\n=======\n2\n>>>>>>>\nb\nc\nd\n<<<<<<<\n1\n=======\n2\n>>>>>>>\n",
+			conflicts: 2,
+		},
+		{
+			name:     "without trailing newline",
+			base:     "a\nb\nc",
+			ours:     "A\nb\nc",
+			theirs:   "a\nb\nc\nd",
+			expected: "A\nb\nc\nd",
+		},
+		{
+			name:      "conflict without trailing newline",
+			base:      "a",
+			ours:      "b",
+			theirs:    "c",
+			expected:  "<<<<<<<\nb\n=======\nc\n>>>>>>>\n",
+			conflicts: 1,
+		},
+		{
+			name:     "crlf",
+			base:     "a\r\nb\r\nc\r\n",
+			ours:     "A\r\nb\r\nc\r\n",
+			theirs:   "a\r\nb\r\nC\r\n",
+			expected: "A\r\nb\r\nC\r\n",
+		},
+		{
+			name:      "crlf conflict",
+			base:      "a\r\n",
+			ours:      "b\r\n",
+			theirs:    "c\r\n",
+			expected:  "<<<<<<<\r\nb\r\n=======\r\nc\r\n>>>>>>>\r\n",
+			conflicts: 1,
+		},
+		{
+			name:      "crlf and lf lines differ",
+			base:      "a\n",
+			ours:      "a\r\n",
+			theirs:    "b\n",
+			expected:  "<<<<<<<\r\na\r\n=======\r\nb\n>>>>>>>\r\n",
+			conflicts: 1,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			result, conflicts, err := File([]byte(tc.base), []byte(tc.ours), []byte(tc.theirs), tc.opts)
+			require.NoError(t, err)
+			assert.Equal(t, tc.expected, string(result))
+			assert.Equal(t, tc.conflicts, conflicts)
+		})
+	}
+}
+
+func TestFileBinary(t *testing.T) {
+	t.Parallel()
+
+	_, _, err := File([]byte("a\n"), []byte("a\x00\n"), []byte("b\n"), nil)
+	assert.ErrorIs(t, err, ErrBinary)
+}
@@ -147,6 +147,13 @@ func (d *doubleIter) compare() (s comparison, err error) {
 	s.bothAreFiles = !fromIsDir && !toIsDir
 	s.fileAndDir = !s.bothAreDirs && !s.bothAreFiles
 
+	// The children of the dirs are only needed to tell if they are empty,
+	// which only matters if their contents are compared: reading them can
+	// be expensive, like reading a tree object from the storage.
+	if s.sameHash || !s.bothAreDirs {
+		return s, nil
+	}
+
 	fromNumChildren, err := d.from.current.NumChildren()
 	if err != nil {
 		return comparison{}, fmt.Errorf("from: %s", err)
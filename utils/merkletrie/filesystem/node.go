@@ -1,7 +1,9 @@
 package filesystem
 
 import (
+	"bytes"
 	"io"
+	gofs "io/fs"
 	"os"
 	"path"
 
@@ -23,6 +25,24 @@ var ignore = map[string]bool{
 type Options struct {
 	// AutoCRLF converts CRLF line endings in text files into LF line endings.
 	AutoCRLF bool
+	// Filter returns the function converting the content of the file at the
+	// given path before it is hashed, as git converts the files according to
+	// their attributes when adding them, or nil if the content is hashed as
+	// is. AutoCRLF is not applied to the converted content.
+	Filter func(path string) func(io.Reader) io.Reader
+	// Known returns the hash of the blob of the file at the given path,
+	// along with true, if it is known from its file info, such as when its
+	// stat data did not change since it was added to the index, sparing it
+	// from being read and hashed.
+	Known func(path string, fi os.FileInfo) (plumbing.Hash, bool)
+	// ObjectFormat is the object format of the hashes of the files, SHA1
+	// by default.
+	ObjectFormat format.ObjectFormat
+	// Gitlink returns the commit of the HEAD of the repository nested in the
+	// directory at the given path, along with true, if it is one, the
+	// directory being then a gitlink rather than a tree, as the submodules.
+	// The nested repositories without commit are skipped.
+	Gitlink func(path string) (plumbing.Hash, bool)
 }
 
 // The node represents a file or a directory in a billy.Filesystem. It
@@ -40,8 +60,14 @@ type node struct {
 	hash     []byte
 	children []noder.Noder
 	isDir    bool
-	mode     os.FileMode
-	size     int64
+	// gitlink is the commit of the HEAD of the repository nested in the
+	// directory, if it is one.
+	gitlink plumbing.Hash
+	// entry is the directory entry of the file, whose mode and size are only
+	// read when its hash is calculated.
+	entry gofs.DirEntry
+	mode  os.FileMode
+	size  int64
 }
 
 // NewRootNode returns the root node based on a given billy.Filesystem.
@@ -136,26 +162,29 @@ func (n *node) calculateChildren() error {
 			continue
 		}
 
-		fi, err := file.Info()
-		if err != nil {
-			return err
-		}
-		if fi.Mode()&os.ModeSocket != 0 {
+		if file.Type()&os.ModeSocket != 0 {
 			continue
 		}
 
-		c, err := n.newChildNode(fi)
-		if err != nil {
-			return err
+		child := n.newChildNode(file)
+		if child.isDir && n.options != nil && n.options.Gitlink != nil {
+			if h, ok := n.options.Gitlink(child.path); ok {
+				if h.IsZero() {
+					continue
+				}
+
+				child.isDir = false
+				child.gitlink = h
+			}
 		}
 
-		n.children = append(n.children, c)
+		n.children = append(n.children, child)
 	}
 
 	return nil
 }
 
-func (n *node) newChildNode(file os.FileInfo) (*node, error) {
+func (n *node) newChildNode(file gofs.DirEntry) *node {
 	path := path.Join(n.path, file.Name())
 
 	node := &node{
@@ -165,15 +194,14 @@ func (n *node) newChildNode(file os.FileInfo) (*node, error) {
 
 		path:  path,
 		isDir: file.IsDir(),
-		size:  file.Size(),
-		mode:  file.Mode(),
+		entry: file,
 	}
 
 	if _, isSubmodule := n.submodules[path]; isSubmodule {
 		node.isDir = false
 	}
 
-	return node, nil
+	return node
 }
 
 func (n *node) calculateHash() {
@@ -181,6 +209,16 @@ func (n *node) calculateHash() {
 		n.hash = make([]byte, 24)
 		return
 	}
+	var fi os.FileInfo
+	if n.entry != nil {
+		var err error
+		fi, err = n.entry.Info()
+		if err != nil {
+			n.hash = plumbing.ZeroHash.Bytes()
+			return
+		}
+		n.mode, n.size = fi.Mode(), fi.Size()
+	}
 	mode, err := filemode.NewFromOSFileMode(n.mode)
 	if err != nil {
 		n.hash = plumbing.ZeroHash.Bytes()
@@ -190,8 +228,14 @@ func (n *node) calculateHash() {
 		n.hash = append(submoduleHash.Bytes(), filemode.Submodule.Bytes()...)
 		return
 	}
+	if !n.gitlink.IsZero() {
+		n.hash = append(n.gitlink.Bytes(), filemode.Submodule.Bytes()...)
+		return
+	}
 	var hash plumbing.Hash
-	if n.mode&os.ModeSymlink != 0 {
+	if known, ok := n.known(fi); ok {
+		hash = known
+	} else if n.mode&os.ModeSymlink != 0 {
 		hash = n.doCalculateHashForSymlink()
 	} else {
 		hash = n.doCalculateHashForRegular()
@@ -199,6 +243,15 @@ func (n *node) calculateHash() {
 	n.hash = append(hash.Bytes(), mode.Bytes()...)
 }
 
+// known returns the hash of the file if it is known from its file info.
+func (n *node) known(fi os.FileInfo) (plumbing.Hash, bool) {
+	if fi == nil || n.options == nil || n.options.Known == nil {
+		return plumbing.ZeroHash, false
+	}
+
+	return n.options.Known(n.path, fi)
+}
+
 func (n *node) doCalculateHashForRegular() plumbing.Hash {
 	f, err := n.fs.Open(n.path)
 	if err != nil {
@@ -206,7 +259,13 @@ func (n *node) doCalculateHashForRegular() plumbing.Hash {
 	}
 	defer f.Close()
 
-	h := plumbing.NewHasher(format.SHA1, plumbing.BlobObject, n.size)
+	if n.options != nil && n.options.Filter != nil {
+		if filter := n.options.Filter(n.path); filter != nil {
+			return hashFiltered(filter(f), n.objectFormat())
+		}
+	}
+
+	h := plumbing.NewHasher(n.objectFormat(), plumbing.BlobObject, n.size)
 	var dst io.Writer = h
 
 	if n.options != nil && n.options.AutoCRLF {
@@ -235,13 +294,29 @@ func (n *node) doCalculateHashForRegular() plumbing.Hash {
 	return h.Sum()
 }
 
+// hashFiltered returns the hash of the blob of the content read from r, whose
+// size is unknown until read.
+func hashFiltered(r io.Reader, f format.ObjectFormat) plumbing.Hash {
+	var buf bytes.Buffer
+	if _, err := ioutil.CopyBufferPool(&buf, r); err != nil {
+		return plumbing.ZeroHash
+	}
+
+	h := plumbing.NewHasher(f, plumbing.BlobObject, int64(buf.Len()))
+	if _, err := h.Write(buf.Bytes()); err != nil {
+		return plumbing.ZeroHash
+	}
+
+	return h.Sum()
+}
+
 func (n *node) doCalculateHashForSymlink() plumbing.Hash {
 	target, err := n.fs.Readlink(n.path)
 	if err != nil {
 		return plumbing.ZeroHash
 	}
 
-	h := plumbing.NewHasher(format.SHA1, plumbing.BlobObject, n.size)
+	h := plumbing.NewHasher(n.objectFormat(), plumbing.BlobObject, n.size)
 	if _, err := h.Write([]byte(target)); err != nil {
 		return plumbing.ZeroHash
 	}
@@ -249,6 +324,14 @@ func (n *node) doCalculateHashForSymlink() plumbing.Hash {
 	return h.Sum()
 }
 
+func (n *node) objectFormat() format.ObjectFormat {
+	if n.options == nil {
+		return format.SHA1
+	}
+
+	return n.options.ObjectFormat
+}
+
 func (n *node) String() string {
 	return n.path
 }
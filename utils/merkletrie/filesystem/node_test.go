@@ -16,6 +16,7 @@ import (
 	"github.com/stretchr/testify/suite"
 
 	"github.com/go-git/go-git/v6/plumbing"
+	format "github.com/go-git/go-git/v6/plumbing/format/config"
 	"github.com/go-git/go-git/v6/utils/merkletrie"
 	"github.com/go-git/go-git/v6/utils/merkletrie/noder"
 )
@@ -112,6 +113,41 @@ func (s *NoderSuite) TestDiffChangeContent() {
 	s.Len(ch, 1)
 }
 
+func (s *NoderSuite) TestDiffKnown() {
+	fsA := memfs.New()
+	WriteFile(fsA, "foo", []byte("foo"), 0o644)
+	WriteFile(fsA, "qux/bar", []byte("foo"), 0o644)
+
+	fsB := memfs.New()
+	WriteFile(fsB, "foo", []byte("bar"), 0o644)
+	WriteFile(fsB, "qux/bar", []byte("bar"), 0o644)
+
+	// The hash of foo is taken as known, so its content is not read.
+	var known []string
+	ch, err := merkletrie.DiffTree(
+		NewRootNode(fsA, nil),
+		NewRootNodeWithOptions(fsB, nil, Options{
+			Known: func(path string, fi os.FileInfo) (plumbing.Hash, bool) {
+				known = append(known, path)
+				s.Equal(int64(3), fi.Size())
+				if path != "foo" {
+					return plumbing.ZeroHash, false
+				}
+
+				h := plumbing.NewHasher(format.SHA1, plumbing.BlobObject, 3)
+				h.Write([]byte("foo"))
+				return h.Sum(), true
+			},
+		}),
+		IsEquals,
+	)
+
+	s.NoError(err)
+	s.Len(ch, 1)
+	s.Equal("qux/bar", ch[0].To.String())
+	s.Equal([]string{"foo", "qux/bar"}, known)
+}
+
 func (s *NoderSuite) TestDiffSymlinkDirOnA() {
 	fsA := memfs.New()
 	WriteFile(fsA, "qux/qux", []byte("foo"), 0o644)
@@ -23,10 +23,14 @@ type node struct {
 	skip     bool
 
 	upholdExecutableBit bool
+	regularSymlinks     bool
 }
 
 type RootNodeOptions struct {
 	UpholdExecutableBit bool
+	// RegularSymlinks compares the symbolic links as regular files, as
+	// they are checked out when core.symlinks is false.
+	RegularSymlinks bool
 }
 
 // NewRootNode returns the root node of a computed tree from a index.Index,
@@ -60,7 +64,12 @@ func NewRootNodeWithOptions(idx *index.Index, options RootNodeOptions) noder.Nod
 				continue
 			}
 
-			n := &node{path: fullpath, skip: e.SkipWorktree, upholdExecutableBit: options.UpholdExecutableBit}
+			n := &node{
+				path:                fullpath,
+				skip:                e.SkipWorktree,
+				upholdExecutableBit: options.UpholdExecutableBit,
+				regularSymlinks:     options.RegularSymlinks,
+			}
 			if fullpath == e.Name {
 				n.entry = e
 			} else {
@@ -96,7 +105,8 @@ func (n *node) Hash() []byte {
 	}
 
 	mode := n.entry.Mode
-	if mode == filemode.Executable && !n.upholdExecutableBit {
+	if mode == filemode.Executable && !n.upholdExecutableBit ||
+		mode == filemode.Symlink && n.regularSymlinks {
 		mode = filemode.Regular
 	}
 
@@ -0,0 +1,61 @@
+package sync
+
+import (
+	"io"
+	"sync"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+var (
+	zstdReader = sync.Pool{
+		New: func() any {
+			r, _ := zstd.NewReader(nil, zstd.WithDecoderConcurrency(1))
+			return r
+		},
+	}
+	zstdWriter = sync.Pool{
+		New: func() any {
+			w, _ := zstd.NewWriter(nil, zstd.WithEncoderConcurrency(1))
+			return w
+		},
+	}
+)
+
+// GetZstdReader returns a *zstd.Decoder that is managed by a sync.Pool.
+// Returns a decoder that is reset with r and ready for use.
+//
+// After use, the *zstd.Decoder should be put back into the sync.Pool
+// by calling PutZstdReader.
+func GetZstdReader(r io.Reader) (*zstd.Decoder, error) {
+	z := zstdReader.Get().(*zstd.Decoder)
+	if err := z.Reset(r); err != nil {
+		PutZstdReader(z)
+		return nil, err
+	}
+
+	return z, nil
+}
+
+// PutZstdReader puts z back into its sync.Pool, releasing its reader.
+func PutZstdReader(z *zstd.Decoder) {
+	_ = z.Reset(nil)
+	zstdReader.Put(z)
+}
+
+// GetZstdWriter returns a *zstd.Encoder that is managed by a sync.Pool.
+// Returns an encoder that is reset with w and ready for use.
+//
+// After use, the *zstd.Encoder should be put back into the sync.Pool
+// by calling PutZstdWriter.
+func GetZstdWriter(w io.Writer) *zstd.Encoder {
+	z := zstdWriter.Get().(*zstd.Encoder)
+	z.Reset(w)
+	return z
+}
+
+// PutZstdWriter puts w back into its sync.Pool, releasing its writer.
+func PutZstdWriter(w *zstd.Encoder) {
+	w.Reset(nil)
+	zstdWriter.Put(w)
+}
@@ -1,17 +1,18 @@
 package git
 
 import (
+	"bufio"
+	"bytes"
 	"context"
 	"errors"
 	"fmt"
 	"io"
-	"io/fs"
 	"net/url"
 	"os"
 	"path"
 	"path/filepath"
+	"regexp"
 	"runtime"
-	"slices"
 	"strings"
 	"time"
 
@@ -19,30 +20,71 @@ import (
 	"github.com/go-git/go-billy/v6/util"
 
 	"github.com/go-git/go-git/v6/config"
+	"github.com/go-git/go-git/v6/internal/pathspec"
 	giturl "github.com/go-git/go-git/v6/internal/url"
 	"github.com/go-git/go-git/v6/plumbing"
 	"github.com/go-git/go-git/v6/plumbing/filemode"
 	"github.com/go-git/go-git/v6/plumbing/format/gitignore"
 	"github.com/go-git/go-git/v6/plumbing/format/index"
 	"github.com/go-git/go-git/v6/plumbing/object"
+	"github.com/go-git/go-git/v6/plumbing/protocol/packp/sideband"
 	"github.com/go-git/go-git/v6/plumbing/storer"
-	"github.com/go-git/go-git/v6/utils/convert"
 	"github.com/go-git/go-git/v6/utils/ioutil"
 	"github.com/go-git/go-git/v6/utils/merkletrie"
-	"github.com/go-git/go-git/v6/utils/sync"
 	"github.com/go-git/go-git/v6/utils/trace"
 )
 
 var (
-	ErrWorktreeNotClean                = errors.New("worktree is not clean")
-	ErrSubmoduleNotFound               = errors.New("submodule not found")
-	ErrUnstagedChanges                 = errors.New("worktree contains unstaged changes")
-	ErrGitModulesSymlink               = errors.New(gitmodulesFile + " is a symlink")
-	ErrNonFastForwardUpdate            = errors.New("non-fast-forward update")
+	ErrWorktreeNotClean     = errors.New("worktree is not clean")
+	ErrSubmoduleNotFound    = errors.New("submodule not found")
+	ErrUnstagedChanges      = errors.New("worktree contains unstaged changes")
+	ErrLocalChanges         = errors.New("local changes would be overwritten")
+	ErrGitModulesSymlink    = errors.New(gitmodulesFile + " is a symlink")
+	ErrNonFastForwardUpdate = errors.New("non-fast-forward update")
+	// Deprecated: Restore supports restoring the working tree only, this
+	// error is no longer returned.
 	ErrRestoreWorktreeOnlyNotSupported = errors.New("worktree only is not supported")
 	ErrSparseResetDirectoryNotFound    = errors.New("sparse-reset directory not found on commit")
+	// ErrMalformedPath is the error of an InvalidPathError whose path is
+	// empty.
+	ErrMalformedPath = errors.New("malformed path")
+	// ErrPathTraversal is the error of an InvalidPathError whose path is
+	// absolute, contains a '..' component, or leads through a symbolic
+	// link, escaping the worktree.
+	ErrPathTraversal = errors.New("path escapes the worktree")
+	// ErrPathInGitDir is the error of an InvalidPathError whose path is in
+	// a .git directory, or in the git directory of the repository if it is
+	// in the worktree.
+	ErrPathInGitDir = errors.New("path is in a git directory")
+	// ErrPathCollision is the error of an InvalidPathError whose path
+	// collides with another one on a case-insensitive filesystem, differing
+	// from it only by its case or its Unicode normalization.
+	ErrPathCollision = errors.New("path collides with another path")
 )
 
+// InvalidPathError is returned when a file can't be checked out safely to
+// the worktree, its path being refused.
+type InvalidPathError struct {
+	// Path is the refused path.
+	Path string
+	// Other is the path colliding with Path, for ErrPathCollision.
+	Other string
+	// Err is the reason why the path is refused, such as ErrPathTraversal.
+	Err error
+}
+
+func (e *InvalidPathError) Error() string {
+	if e.Other != "" {
+		return fmt.Sprintf("invalid path %q: %s: %q", e.Path, e.Err, e.Other)
+	}
+
+	return fmt.Sprintf("invalid path %q: %s", e.Path, e.Err)
+}
+
+func (e *InvalidPathError) Unwrap() error {
+	return e.Err
+}
+
 // Worktree represents a git worktree.
 type Worktree struct {
 	// Filesystem underlying filesystem.
@@ -58,6 +100,8 @@ type Worktree struct {
 // no changes to be fetched, or an error.
 //
 // Pull only supports merges where the can be resolved as a fast-forward.
+// Otherwise, the local commits can be rebased on the fetched branch with
+// PullOptions.Rebase.
 func (w *Worktree) Pull(o *PullOptions) error {
 	return w.PullContext(context.Background(), o)
 }
@@ -67,10 +111,13 @@ func (w *Worktree) Pull(o *PullOptions) error {
 // there are no changes to be fetched, or an error.
 //
 // Pull only supports merges where the can be resolved as a fast-forward.
+// Otherwise, the local commits can be rebased on the fetched branch with
+// PullOptions.Rebase.
 //
 // The provided Context must be non-nil. If the context expires before the
-// operation is complete, an error is returned. The context only affects the
-// transport operations.
+// operation is complete, an error is returned. The context affects the
+// transport operations, the resolution of the deltas of the packfile received
+// and the update of the worktree.
 func (w *Worktree) PullContext(ctx context.Context, o *PullOptions) error {
 	if err := o.Validate(); err != nil {
 		return err
@@ -91,6 +138,7 @@ func (w *Worktree) PullContext(ctx context.Context, o *PullOptions) error {
 		InsecureSkipTLS: o.InsecureSkipTLS,
 		CABundle:        o.CABundle,
 		ProxyOptions:    o.ProxyOptions,
+		Timeouts:        o.Timeouts,
 	})
 
 	updated := true
@@ -129,26 +177,51 @@ func (w *Worktree) PullContext(ctx context.Context, o *PullOptions) error {
 			return err
 		}
 
-		if !ff {
+		if !ff && (!o.Rebase || o.FastForwardOnly) {
 			return ErrNonFastForwardUpdate
 		}
+
+		if !ff {
+			if err := w.r.Rebase(&RebaseOptions{Upstream: ref.Hash(), Autostash: o.Autostash}); err != nil {
+				return err
+			}
+
+			return w.pullSubmodules(ctx, o)
+		}
 	}
 
 	if err != nil && !errors.Is(err, plumbing.ErrReferenceNotFound) {
 		return err
 	}
 
-	if err := w.updateHEAD(ref.Hash()); err != nil {
+	var stash plumbing.Hash
+	if o.Autostash && head != nil {
+		if stash, err = w.autostash(nil); err != nil {
+			return err
+		}
+	}
+
+	if err := w.updateHEAD(ref.Hash(), nil, "pull: Fast-forward"); err != nil {
 		return err
 	}
 
-	if err := w.Reset(&ResetOptions{
+	if err := w.reset(ctx, &ResetOptions{
 		Mode:   MergeReset,
 		Commit: ref.Hash(),
-	}); err != nil {
+	}, false, o.Progress); err != nil {
+		return err
+	}
+
+	if err := w.applyAutostash(stash); err != nil {
 		return err
 	}
 
+	return w.pullSubmodules(ctx, o)
+}
+
+// pullSubmodules updates the submodules once pulled, following
+// o.RecurseSubmodules.
+func (w *Worktree) pullSubmodules(ctx context.Context, o *PullOptions) error {
 	if o.RecurseSubmodules != NoRecurseSubmodules {
 		return w.updateSubmodules(ctx, &SubmoduleUpdateOptions{
 			RecurseSubmodules: o.RecurseSubmodules,
@@ -169,26 +242,99 @@ func (w *Worktree) updateSubmodules(ctx context.Context, o *SubmoduleUpdateOptio
 }
 
 // Checkout switch branches or restore working tree files.
+//
+// Unless opts.Force or opts.Keep is set, a checkout overwriting the local
+// changes of some files is refused with a *ResetError, wrapping
+// ErrLocalChanges, before the branch of opts.Create is created or HEAD is
+// moved. The local changes of the files which are the same in both commits
+// are kept, as `git checkout` does.
 func (w *Worktree) Checkout(opts *CheckoutOptions) error {
+	return w.CheckoutContext(context.Background(), opts)
+}
+
+// SwitchDetachedResult describes the detached HEAD left by SwitchDetached.
+type SwitchDetachedResult struct {
+	// Hash is the hash of the commit HEAD is detached at.
+	Hash plumbing.Hash
+	// From is the branch HEAD pointed to, empty if it was already detached.
+	From plumbing.ReferenceName
+	// Warning is the advice given by git when detaching HEAD: the commits
+	// made on a detached HEAD are not on any branch.
+	Warning string
+}
+
+// SwitchDetached checks out the commit of the given hash, or the commit
+// tagged by it, detaching HEAD from the current branch, as `git switch
+// --detach` does. As Checkout, it is refused if the local changes of some
+// files would be overwritten.
+func (w *Worktree) SwitchDetached(hash plumbing.Hash) (*SwitchDetachedResult, error) {
+	head, err := w.r.Storer.Reference(plumbing.HEAD)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := w.Checkout(&CheckoutOptions{Hash: hash}); err != nil {
+		return nil, err
+	}
+
+	detached, err := w.r.Head()
+	if err != nil {
+		return nil, err
+	}
+
+	result := &SwitchDetachedResult{Hash: detached.Hash()}
+	if head.Type() == plumbing.SymbolicReference {
+		result.From = head.Target()
+	}
+
+	result.Warning = fmt.Sprintf("HEAD is now detached at %s: the commits made in this state are not on any branch, "+
+		"and are lost once another branch is checked out unless a branch is created for them", result.Hash.String()[:7])
+	return result, nil
+}
+
+// CheckoutContext switch branches or restore working tree files, as Checkout
+// does. The provided Context must be non-nil. If the context is done before
+// all the files are written, the checkout is stopped and the error of the
+// context returned, the index recording the files already written: the
+// worktree can then be restored with another checkout, or a HardReset.
+func (w *Worktree) CheckoutContext(ctx context.Context, opts *CheckoutOptions) error {
 	if err := opts.Validate(); err != nil {
 		return err
 	}
 
+	if len(opts.Paths) > 0 {
+		return w.checkoutPaths(opts)
+	}
+
+	if opts.Orphan {
+		return w.checkoutOrphan(ctx, opts)
+	}
+
+	var start string
 	if opts.Create {
-		if err := w.createBranch(opts); err != nil {
+		var err error
+		if start, err = w.checkCreateBranch(opts); err != nil {
 			return err
 		}
 	}
 
+	from, err := w.checkoutFrom()
+	if err != nil {
+		return err
+	}
+
 	c, err := w.getCommitFromCheckoutOptions(opts)
 	if err != nil {
 		return err
 	}
 
 	ro := &ResetOptions{
-		Commit:     c,
-		Mode:       MergeReset,
-		SparseDirs: opts.SparseCheckoutDirectories,
+		Commit:              c,
+		Mode:                MergeReset,
+		SparseDirs:          opts.SparseCheckoutDirectories,
+		SparsePatterns:      opts.SparseCheckoutPatterns,
+		SymlinkMode:         opts.SymlinkMode,
+		AllowPathCollisions: opts.AllowPathCollisions,
 	}
 	if opts.Force {
 		ro.Mode = HardReset
@@ -196,245 +342,1025 @@ func (w *Worktree) Checkout(opts *CheckoutOptions) error {
 		ro.Mode = SoftReset
 	}
 
+	// The local changes are checked before the branch is created and HEAD
+	// is moved, for a refused checkout to leave the repository as it is.
+	if ro.Mode == MergeReset {
+		if err := w.checkoutFiles(ro); err != nil {
+			return err
+		}
+	}
+
+	if opts.Create {
+		if err := w.r.createBranchReference(opts.Branch, c, start); err != nil {
+			return err
+		}
+	}
+
 	if !opts.Hash.IsZero() && !opts.Create {
-		err = w.setHEADToCommit(opts.Hash)
+		err = w.setHEADToCommit(opts.Hash, from)
 	} else {
-		err = w.setHEADToBranch(opts.Branch, c)
+		err = w.setHEADToBranch(opts.Branch, c, from)
 	}
 
 	if err != nil {
 		return err
 	}
 
-	return w.Reset(ro)
+	if err := w.reset(ctx, ro, false, nil); err != nil {
+		return err
+	}
+
+	if sparse := newSparseCheckout(ro.SparseDirs, ro.SparsePatterns); sparse != nil {
+		return w.setSparseCheckout(sparse)
+	}
+
+	return nil
 }
 
-func (w *Worktree) createBranch(opts *CheckoutOptions) error {
-	if err := opts.Branch.Validate(); err != nil {
+// checkoutPaths writes the files matching the pathspec of opts.Paths to the
+// working tree and the index, from the tree of the commit given by opts, or
+// from the index if none is given. Nothing is written if an item of the
+// pathspec doesn't match any file, or if any of the files can't be written
+// safely.
+func (w *Worktree) checkoutPaths(opts *CheckoutOptions) error {
+	ps, err := pathspec.Parse(opts.Paths)
+	if err != nil {
 		return err
 	}
 
-	_, err := w.r.Storer.Reference(opts.Branch)
-	if err == nil {
-		return fmt.Errorf("a branch named %q already exists", opts.Branch)
+	idx, err := w.r.Storer.Index()
+	if err != nil {
+		return err
 	}
 
-	if !errors.Is(err, plumbing.ErrReferenceNotFound) {
-		return err
+	matched := make([]bool, len(ps))
+	match := func(name string) bool {
+		if !ps.Match(name) {
+			return false
+		}
+
+		for i, p := range ps {
+			if !p.Exclude && p.Match(name) {
+				matched[i] = true
+			}
+		}
+
+		return true
 	}
 
-	if opts.Hash.IsZero() {
-		ref, err := w.r.Head()
+	var entries []*index.Entry
+	var conv *converter
+	if opts.Hash.IsZero() && opts.Branch == "" {
+		for _, e := range idx.Entries {
+			if e.SkipWorktree || !match(e.Name) {
+				continue
+			}
+
+			if e.Stage != index.Merged {
+				if opts.Force {
+					continue
+				}
+
+				return fmt.Errorf("%w: %s", ErrUnmergedPaths, e.Name)
+			}
+
+			entries = append(entries, e)
+		}
+
+		if conv, err = w.newWorktreeConverter(); err != nil {
+			return err
+		}
+	} else {
+		c, err := w.getCommitFromCheckoutOptions(opts)
 		if err != nil {
 			return err
 		}
 
-		opts.Hash = ref.Hash()
-	}
+		t, err := w.r.getTreeFromCommitHash(c)
+		if err != nil {
+			return err
+		}
 
-	return w.r.Storer.SetReference(
-		plumbing.NewHashReference(opts.Branch, opts.Hash),
-	)
-}
+		err = t.Walk(func(name string, e object.TreeEntry) error {
+			if e.Mode != filemode.Dir && match(name) {
+				entries = append(entries, &index.Entry{Name: name, Hash: e.Hash, Mode: e.Mode})
+			}
 
-func (w *Worktree) getCommitFromCheckoutOptions(opts *CheckoutOptions) (plumbing.Hash, error) {
-	hash := opts.Hash
-	if hash.IsZero() {
-		b, err := w.r.Reference(opts.Branch, true)
+			return nil
+		}, object.WalkOptions{})
 		if err != nil {
-			return plumbing.ZeroHash, err
+			return err
 		}
 
-		hash = b.Hash()
+		if conv, err = w.r.newTreeConverter(t); err != nil {
+			return err
+		}
 	}
 
-	o, err := w.r.Object(plumbing.AnyObject, hash)
-	if err != nil {
-		return plumbing.ZeroHash, err
+	conv.setSymlinkMode(opts.SymlinkMode)
+	for i, p := range ps {
+		if !p.Exclude && !matched[i] {
+			return fmt.Errorf("%w: %s", ErrPathSpecNoMatches, opts.Paths[i])
+		}
 	}
 
-	switch o := o.(type) {
-	case *object.Tag:
-		if o.TargetType != plumbing.CommitObject {
-			return plumbing.ZeroHash, fmt.Errorf("%w: tag target %q", object.ErrUnsupportedObject, o.TargetType)
+	g := w.newCheckoutGuard()
+	names := make([]string, len(entries))
+	for i, e := range entries {
+		if err := g.validPath(e.Name); err != nil {
+			return err
 		}
 
-		return o.Target, nil
-	case *object.Commit:
-		return o.Hash, nil
+		names[i] = e.Name
 	}
 
-	return plumbing.ZeroHash, fmt.Errorf("%w: %q", object.ErrUnsupportedObject, o.Type())
-}
+	if err := w.checkPathCollisions(idx, names, opts.AllowPathCollisions, nil); err != nil {
+		return err
+	}
 
-func (w *Worktree) setHEADToCommit(commit plumbing.Hash) error {
-	head := plumbing.NewHashReference(plumbing.HEAD, commit)
-	return w.r.Storer.SetReference(head)
+	b := newIndexBuilder(idx)
+	for _, e := range entries {
+		if err := g.validLeadingDirs(e.Name); err != nil {
+			return err
+		}
+
+		if err := w.checkoutEntry(e, b, conv); err != nil {
+			return err
+		}
+
+		g.written(e.Name)
+	}
+
+	b.Write(idx)
+	return w.r.Storer.SetIndex(idx)
 }
 
-func (w *Worktree) setHEADToBranch(branch plumbing.ReferenceName, commit plumbing.Hash) error {
-	target, err := w.r.Storer.Reference(branch)
-	if err != nil {
-		return err
+// checkoutEntry writes the file of the given index entry to the working
+// tree, replacing the one there, if any, and stages it.
+func (w *Worktree) checkoutEntry(e *index.Entry, b *indexBuilder, conv *converter) error {
+	if e.Mode == filemode.Submodule {
+		b.Remove(e.Name)
+		b.Add(&index.Entry{Name: e.Name, Hash: e.Hash, Mode: e.Mode})
+		return w.Filesystem.MkdirAll(e.Name, 0o755)
 	}
 
-	var head *plumbing.Reference
-	if target.Name().IsBranch() {
-		head = plumbing.NewSymbolicReference(plumbing.HEAD, target.Name())
-	} else {
-		head = plumbing.NewHashReference(plumbing.HEAD, commit)
+	if err := w.writeEntry(e, conv); err != nil {
+		return err
 	}
 
-	return w.r.Storer.SetReference(head)
+	return w.addIndexFromCheckout(e.Name, e.Hash, e.Mode, b, conv)
 }
 
-// Reset the worktree to a specified state.
-func (w *Worktree) Reset(opts *ResetOptions) error {
-	start := time.Now()
-	defer func() {
-		trace.Performance.Printf("performance: %.9f s: reset_worktree", time.Since(start).Seconds())
-	}()
+// writeEntry writes the file of the given index entry to the working tree,
+// replacing the one there, if any. The submodules are only created as
+// directories.
+func (w *Worktree) writeEntry(e *index.Entry, conv *converter) error {
+	if e.Mode == filemode.Submodule {
+		return w.Filesystem.MkdirAll(e.Name, 0o755)
+	}
 
-	if err := opts.Validate(w.r); err != nil {
+	blob, err := w.r.BlobObject(e.Hash)
+	if err != nil {
 		return err
 	}
 
-	if opts.Mode == MergeReset {
-		unstaged, err := w.containsUnstagedChanges()
-		if err != nil {
+	// The file is removed first, so that a symbolic link is not followed.
+	if fi, err := w.Filesystem.Lstat(e.Name); err == nil && !fi.IsDir() {
+		if err := w.Filesystem.Remove(e.Name); err != nil {
 			return err
 		}
+	}
 
-		if unstaged {
-			return ErrUnstagedChanges
-		}
+	return w.checkoutFile(&object.File{Name: e.Name, Mode: e.Mode, Blob: *blob}, conv)
+}
+
+// CheckoutIndex writes the files of the index matching the pathspec of
+// opts.Paths to the working tree, refreshing their stat data in the index, as
+// `git checkout-index -u` does. The files already in the working tree are left
+// as they are, unless opts.Force is set. The unmerged paths and the entries
+// out of the sparse checkout are skipped.
+func (w *Worktree) CheckoutIndex(opts *CheckoutIndexOptions) error {
+	if opts == nil {
+		opts = &CheckoutIndexOptions{}
 	}
 
-	if opts.Mode == SoftReset {
-		return w.setHEADCommit(opts.Commit)
+	ps, err := pathspec.Parse(opts.Paths)
+	if err != nil {
+		return err
 	}
 
-	t, err := w.r.getTreeFromCommitHash(opts.Commit)
+	idx, err := w.r.Storer.Index()
 	if err != nil {
 		return err
 	}
 
-	if len(opts.SparseDirs) > 0 && !opts.SkipSparseDirValidation {
-		if !treeContainsDirs(t, opts.SparseDirs) {
-			return ErrSparseResetDirectoryNotFound
+	matched := make([]bool, len(ps))
+	var merged, unmerged, entries []*index.Entry
+	var missing []plumbing.Hash
+	for _, e := range idx.Entries {
+		if e.Stage == index.Merged {
+			merged = append(merged, e)
+		} else {
+			unmerged = append(unmerged, e)
+		}
+
+		if !ps.Match(e.Name) {
+			continue
+		}
+
+		for i, p := range ps {
+			if !p.Exclude && p.Match(e.Name) {
+				matched[i] = true
+			}
+		}
+
+		if e.Stage != index.Merged || e.SkipWorktree || e.IntentToAdd {
+			continue
+		}
+
+		if _, err := w.Filesystem.Lstat(e.Name); err == nil && !opts.Force {
+			continue
+		}
+
+		entries = append(entries, e)
+		if e.Mode != filemode.Submodule {
+			missing = append(missing, e.Hash)
+		}
+	}
+
+	for i, p := range ps {
+		if !p.Exclude && !matched[i] {
+			return fmt.Errorf("%w: %s", ErrPathSpecNoMatches, opts.Paths[i])
 		}
 	}
 
-	if err := w.setHEADCommit(opts.Commit); err != nil {
+	// The blobs missing from a partial clone are fetched at once.
+	if err := w.r.fetchMissingObjects(missing); err != nil {
 		return err
 	}
 
-	var removedFiles []string
-	if opts.Mode == MixedReset || opts.Mode == MergeReset || opts.Mode == HardReset {
-		if removedFiles, err = w.resetIndex(t, opts.SparseDirs, opts.Files); err != nil {
+	conv, err := w.newWorktreeConverter()
+	if err != nil {
+		return err
+	}
+
+	g := w.newCheckoutGuard()
+	for _, e := range entries {
+		if err := g.validPath(e.Name); err != nil {
 			return err
 		}
 	}
 
-	if opts.Mode == MergeReset && len(removedFiles) > 0 {
-		if err := w.resetWorktree(t, removedFiles); err != nil {
+	// The unmerged entries are kept apart from the builder, which holds a
+	// single entry per path.
+	b := newIndexBuilder(&index.Index{Entries: merged})
+	for _, e := range entries {
+		if err := g.validLeadingDirs(e.Name); err != nil {
 			return err
 		}
-	}
 
-	if opts.Mode == HardReset {
-		if err := w.resetWorktree(t, opts.Files); err != nil {
+		if err := w.checkoutEntry(e, b, conv); err != nil {
 			return err
 		}
+
+		g.written(e.Name)
 	}
 
-	return nil
+	b.Write(idx)
+	idx.Entries = append(idx.Entries, unmerged...)
+	return w.r.Storer.SetIndex(idx)
 }
 
-// treeContainsDirs checks if the given tree contains all the directories.
-// if dirs is empty, it returns false.
-func treeContainsDirs(tree *object.Tree, dirs []string) bool {
-	if len(dirs) == 0 {
-		return false
+// checkCreateBranch checks that the branch of opts can be created, setting
+// opts.Hash to HEAD if not set. It returns the start point of the branch, as
+// logged in its reflog.
+func (w *Worktree) checkCreateBranch(opts *CheckoutOptions) (string, error) {
+	if err := w.checkNewBranch(opts.Branch); err != nil {
+		return "", err
 	}
 
-	for _, dir := range dirs {
-		entry, err := tree.FindEntry(dir)
-		if err != nil {
-			return false
-		}
-		if entry.Mode != filemode.Dir {
-			return false
-		}
+	if !opts.Hash.IsZero() {
+		return opts.Hash.String(), nil
 	}
 
-	return true
+	ref, err := w.r.Head()
+	if err != nil {
+		return "", err
+	}
+
+	opts.Hash = ref.Hash()
+	return plumbing.HEAD.String(), nil
 }
 
-// Restore restores specified files in the working tree or stage with contents from
-// a restore source. If a path is tracked but does not exist in the restore
-// source, it will be removed to match the source.
-//
-// If Staged and Worktree are true, then the restore source will be the index.
-// If only Staged is true, then the restore source will be HEAD.
-// If only Worktree is true or neither Staged nor Worktree are true, will
-// result in ErrRestoreWorktreeOnlyNotSupported because restoring the working
-// tree while leaving the stage untouched is not currently supported.
-//
-// Restore with no files specified will return ErrNoRestorePaths.
-func (w *Worktree) Restore(o *RestoreOptions) error {
-	if err := o.Validate(); err != nil {
+// checkNewBranch returns an error if the given branch name is invalid, or if
+// the branch already exists.
+func (w *Worktree) checkNewBranch(name plumbing.ReferenceName) error {
+	if err := name.Validate(); err != nil {
 		return err
 	}
 
-	if o.Staged {
-		opts := &ResetOptions{
-			Files: o.Files,
-		}
-
-		if o.Worktree {
-			// If we are doing both Worktree and Staging then it is a hard reset
-			opts.Mode = HardReset
-		} else {
-			// If we are doing just staging then it is a mixed reset
-			opts.Mode = MixedReset
-		}
+	_, err := w.r.Storer.Reference(name)
+	if err == nil {
+		return fmt.Errorf("a branch named %q already exists", name)
+	}
 
-		return w.Reset(opts)
+	if !errors.Is(err, plumbing.ErrReferenceNotFound) {
+		return err
 	}
 
-	return ErrRestoreWorktreeOnlyNotSupported
+	return nil
 }
 
-func (w *Worktree) resetIndex(t *object.Tree, dirs, files []string) ([]string, error) {
-	idx, err := w.r.Storer.Index()
-	if err != nil {
-		return nil, err
+// checkoutOrphan points HEAD at the branch of opts.Branch, which is left
+// unborn until the next commit. The files of HEAD are removed from the index
+// and the working tree unless opts.Keep is set, as the staged files missing
+// from HEAD are if opts.Force is set. A *ResetError is returned if the local
+// changes of some files would be lost, unless opts.Force is set.
+func (w *Worktree) checkoutOrphan(ctx context.Context, opts *CheckoutOptions) error {
+	if err := w.checkNewBranch(opts.Branch); err != nil {
+		return err
 	}
 
-	b := newIndexBuilder(idx)
-
-	changes, err := w.diffTreeWithStaging(t, true)
-	if err != nil {
-		return nil, err
+	if !opts.Keep {
+		if err := w.removeTrackedFiles(ctx, opts); err != nil {
+			return err
+		}
 	}
 
-	removedFiles := make([]string, 0, len(changes))
-	for _, ch := range changes {
-		a, err := ch.Action()
+	return w.r.Storer.SetReference(plumbing.NewSymbolicReference(plumbing.HEAD, opts.Branch))
+}
+
+// removeTrackedFiles removes the files of HEAD from the index and the working
+// tree for checkoutOrphan, or all the files of the index if opts.Force is set.
+func (w *Worktree) removeTrackedFiles(ctx context.Context, opts *CheckoutOptions) error {
+	t := &object.Tree{}
+	ro := &ResetOptions{Mode: KeepReset, SymlinkMode: opts.SymlinkMode}
+	if !opts.Force {
+		_, err := w.r.Head()
+		if errors.Is(err, plumbing.ErrReferenceNotFound) {
+			// Nothing is tracked on an unborn branch, the files
+			// staged are kept.
+			return nil
+		}
+
 		if err != nil {
-			return nil, err
+			return err
 		}
 
-		var name string
-		var e *object.TreeEntry
+		files, conflicts, err := w.resetFiles(t, ro)
+		if err != nil {
+			return err
+		}
 
-		switch a {
-		case merkletrie.Modify, merkletrie.Insert:
-			name = ch.To.String()
+		if len(conflicts) > 0 {
+			return &ResetError{Mode: ro.Mode, Files: conflicts}
+		}
+
+		if len(files) == 0 {
+			return nil
+		}
+
+		ro.Files = files
+	}
+
+	sparse, err := w.sparseCheckout()
+	if err != nil {
+		return err
+	}
+
+	removed, _, err := w.resetIndex(t, sparse, ro.Files)
+	if err != nil || len(removed) == 0 {
+		return err
+	}
+
+	return w.resetWorktree(ctx, t, removed, ro, nil)
+}
+
+// checkoutFiles restricts the MergeReset of opts, switching from HEAD to
+// opts.Commit, to the files which differ between both commits, as `git
+// checkout` does: the local changes of the other files, staged or not, are
+// kept. A *ResetError is returned if the local changes of some files would be
+// overwritten. The whole index is reset if it is empty, as in a new worktree.
+func (w *Worktree) checkoutFiles(opts *ResetOptions) error {
+	t, err := w.r.getTreeFromCommitHash(opts.Commit)
+	if err != nil {
+		return err
+	}
+
+	idx, err := w.r.Storer.Index()
+	if err != nil {
+		return err
+	}
+
+	keep := *opts
+	keep.Mode = KeepReset
+	if _, err := w.r.Head(); err != nil || len(idx.Entries) == 0 {
+		keep.Mode = MergeReset
+	}
+
+	files, conflicts, err := w.resetFiles(t, &keep)
+	if err != nil {
+		return err
+	}
+
+	if len(conflicts) > 0 {
+		return &ResetError{Mode: keep.Mode, Files: conflicts}
+	}
+
+	if keep.Mode == MergeReset {
+		return nil
+	}
+
+	// No file differs: only HEAD is moved.
+	if len(files) == 0 {
+		opts.Mode = SoftReset
+		return nil
+	}
+
+	opts.Files = files
+	return nil
+}
+
+func (w *Worktree) getCommitFromCheckoutOptions(opts *CheckoutOptions) (plumbing.Hash, error) {
+	hash := opts.Hash
+	if hash.IsZero() {
+		b, err := w.r.Reference(opts.Branch, true)
+		if err != nil {
+			return plumbing.ZeroHash, err
+		}
+
+		hash = b.Hash()
+	}
+
+	o, err := w.r.Object(plumbing.AnyObject, hash)
+	if err != nil {
+		return plumbing.ZeroHash, err
+	}
+
+	switch o := o.(type) {
+	case *object.Tag:
+		if o.TargetType != plumbing.CommitObject {
+			return plumbing.ZeroHash, fmt.Errorf("%w: tag target %q", object.ErrUnsupportedObject, o.TargetType)
+		}
+
+		return o.Target, nil
+	case *object.Commit:
+		return o.Hash, nil
+	}
+
+	return plumbing.ZeroHash, fmt.Errorf("%w: %q", object.ErrUnsupportedObject, o.Type())
+}
+
+// checkoutFrom returns the name of the current branch, or the HEAD commit if
+// detached, as logged in the reflog of HEAD by Checkout.
+func (w *Worktree) checkoutFrom() (string, error) {
+	head, err := w.r.Storer.Reference(plumbing.HEAD)
+	if err != nil {
+		return "", err
+	}
+
+	if head.Type() == plumbing.SymbolicReference {
+		return head.Target().Short(), nil
+	}
+
+	return head.Hash().String(), nil
+}
+
+func (w *Worktree) setHEADToCommit(commit plumbing.Hash, from string) error {
+	head := plumbing.NewHashReference(plumbing.HEAD, commit)
+	return w.r.setReferenceWithLog(head, nil, fmt.Sprintf("%s%s to %s", checkoutReflogPrefix, from, commit))
+}
+
+func (w *Worktree) setHEADToBranch(branch plumbing.ReferenceName, commit plumbing.Hash, from string) error {
+	target, err := w.r.Storer.Reference(branch)
+	if err != nil {
+		return err
+	}
+
+	if !target.Name().IsBranch() {
+		return w.setHEADToCommit(commit, from)
+	}
+
+	old := plumbing.ZeroHash
+	if ref, err := w.r.Head(); err == nil {
+		old = ref.Hash()
+	}
+
+	head := plumbing.NewSymbolicReference(plumbing.HEAD, target.Name())
+	if err := w.r.Storer.SetReference(head); err != nil {
+		return err
+	}
+
+	msg := fmt.Sprintf("%s%s to %s", checkoutReflogPrefix, from, target.Name().Short())
+	return w.r.logRefUpdate(plumbing.HEAD, old, commit, nil, msg)
+}
+
+// Reset the worktree to a specified state.
+func (w *Worktree) Reset(opts *ResetOptions) error {
+	return w.reset(context.Background(), opts, true, nil)
+}
+
+// reset resets the worktree, logging the update of HEAD in the reflogs if
+// logUpdate is set, and the whole worktree is reset. The progress of the
+// checkout is reported to progress if it is a sideband.ProgressReporter, and
+// it is stopped once ctx is done.
+func (w *Worktree) reset(ctx context.Context, opts *ResetOptions, logUpdate bool, progress sideband.Progress) error {
+	start := time.Now()
+	defer func() {
+		trace.Performance.Printf("performance: %.9f s: reset_worktree", time.Since(start).Seconds())
+	}()
+
+	if err := opts.Validate(w.r); err != nil {
+		return err
+	}
+
+	var msg string
+	if logUpdate && len(opts.Files) == 0 {
+		msg = fmt.Sprintf("reset: moving to %s", opts.Commit)
+	}
+
+	if opts.Mode == SoftReset {
+		return w.setHEADCommit(opts.Commit, msg)
+	}
+
+	t, err := w.r.getTreeFromCommitHash(opts.Commit)
+	if err != nil {
+		return err
+	}
+
+	if len(opts.SparseDirs) > 0 && !opts.SkipSparseDirValidation {
+		if !treeContainsDirs(t, opts.SparseDirs) {
+			return ErrSparseResetDirectoryNotFound
+		}
+	}
+
+	sparse := newSparseCheckout(opts.SparseDirs, opts.SparsePatterns)
+	if sparse == nil {
+		if sparse, err = w.sparseCheckout(); err != nil {
+			return err
+		}
+	}
+
+	files := opts.Files
+	if opts.Mode == MergeReset || opts.Mode == KeepReset {
+		changed, conflicts, err := w.resetFiles(t, opts)
+		if err != nil {
+			return err
+		}
+
+		if len(conflicts) > 0 {
+			return &ResetError{Mode: opts.Mode, Files: conflicts}
+		}
+
+		// A KeepReset leaves the index entries of the other files as they
+		// are.
+		if opts.Mode == KeepReset {
+			files = changed
+		}
+	}
+
+	if err := w.setHEADCommit(opts.Commit, msg); err != nil {
+		return err
+	}
+
+	var removedFiles, skippedFiles []string
+	if opts.Mode == MixedReset || opts.Mode == MergeReset || opts.Mode == HardReset ||
+		opts.Mode == KeepReset && len(files) > 0 {
+		if removedFiles, skippedFiles, err = w.resetIndex(t, sparse, files); err != nil {
+			return err
+		}
+	}
+
+	if opts.Mode == MergeReset || opts.Mode == KeepReset || opts.Mode == HardReset {
+		if err := w.removeSkippedFiles(skippedFiles); err != nil {
+			return err
+		}
+	}
+
+	if (opts.Mode == MergeReset || opts.Mode == KeepReset) && len(removedFiles) > 0 {
+		if err := w.resetWorktree(ctx, t, removedFiles, opts, progress); err != nil {
+			return err
+		}
+	}
+
+	if opts.Mode == HardReset {
+		if err := w.resetWorktree(ctx, t, opts.Files, opts, progress); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// ResetError is returned by a MergeReset or a KeepReset which is aborted, as
+// it would overwrite the local changes of some files. It wraps
+// ErrLocalChanges, and ErrUnstagedChanges too for a MergeReset.
+type ResetError struct {
+	// Mode is the mode of the reset, MergeReset or KeepReset.
+	Mode ResetMode
+	// Files are the names of the files with local changes.
+	Files []string
+}
+
+func (e *ResetError) Error() string {
+	return fmt.Sprintf("%s by reset: %s", ErrLocalChanges, strings.Join(e.Files, ", "))
+}
+
+func (e *ResetError) Unwrap() []error {
+	if e.Mode == MergeReset {
+		return []error{ErrUnstagedChanges, ErrLocalChanges}
+	}
+
+	return []error{ErrLocalChanges}
+}
+
+// resetFiles returns the files to be reset by a MergeReset or a KeepReset to
+// the tree t, and those of them whose local changes would be overwritten, as
+// git does.
+//
+// A MergeReset resets the files which differ between t and the index, unless
+// they have unstaged changes. A KeepReset resets the files which differ
+// between t and HEAD, unless they have local changes, staged or not. The
+// files already staged as in t are left as they are.
+func (w *Worktree) resetFiles(t *object.Tree, opts *ResetOptions) (files, conflicts []string, err error) {
+	var head *object.Tree
+	if opts.Mode == KeepReset {
+		ref, err := w.r.Head()
+		if err != nil {
+			return nil, nil, err
+		}
+
+		if head, err = w.r.getTreeFromCommitHash(ref.Hash()); err != nil {
+			return nil, nil, err
+		}
+
+		changes, err := object.DiffTree(head, t)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		for _, ch := range changes {
+			files = append(files, changeName(ch))
+		}
+	} else {
+		changes, err := w.diffTreeWithStaging(t, true)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		for _, ch := range changes {
+			files = append(files, nameFromAction(&ch))
+		}
+	}
+
+	if len(opts.Files) > 0 {
+		filtered := files[:0]
+		for _, name := range files {
+			if inFiles(opts.Files, name) {
+				filtered = append(filtered, name)
+			}
+		}
+
+		files = filtered
+	}
+
+	if len(files) == 0 {
+		return files, nil, nil
+	}
+
+	// The ignored files are overwritten, as they are not local changes.
+	changes, err := w.diffStagingWithWorktree(false, true)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	unstaged := make(map[string]merkletrie.Action, len(changes))
+	for _, ch := range changes {
+		a, err := ch.Action()
+		if err != nil {
+			return nil, nil, err
+		}
+
+		unstaged[nameFromAction(&ch)] = a
+	}
+
+	idx, err := w.r.Storer.Index()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	for _, name := range files {
+		target := findEntry(t, name)
+		a, ok := unstaged[name]
+		switch {
+		case ok && a == merkletrie.Delete && target == nil:
+			// The file is already deleted.
+		case ok:
+			if opts.Mode == MergeReset || !stagedAs(idx, name, target) {
+				conflicts = append(conflicts, name)
+			}
+		case opts.Mode == KeepReset:
+			if !stagedAs(idx, name, findEntry(head, name)) && !stagedAs(idx, name, target) {
+				conflicts = append(conflicts, name)
+			}
+		}
+	}
+
+	return files, conflicts, nil
+}
+
+// findEntry returns the entry of the given file in the tree, or nil if it
+// doesn't exist.
+func findEntry(t *object.Tree, name string) *object.TreeEntry {
+	e, err := t.FindEntry(name)
+	if err != nil {
+		return nil
+	}
+
+	return e
+}
+
+// stagedAs returns whether the file is staged in the index as the given tree
+// entry, or not staged if it is nil.
+func stagedAs(idx *index.Index, name string, e *object.TreeEntry) bool {
+	entry, err := idx.Entry(name)
+	if err != nil {
+		return e == nil
+	}
+
+	return e != nil && entry.Hash == e.Hash && entry.Mode == e.Mode
+}
+
+// treeContainsDirs checks if the given tree contains all the directories.
+// if dirs is empty, it returns false.
+func treeContainsDirs(tree *object.Tree, dirs []string) bool {
+	if len(dirs) == 0 {
+		return false
+	}
+
+	for _, dir := range dirs {
+		entry, err := tree.FindEntry(dir)
+		if err != nil {
+			return false
+		}
+		if entry.Mode != filemode.Dir {
+			return false
+		}
+	}
+
+	return true
+}
+
+// Restore restores the files given by o in the working tree, the index, or
+// both, from a restore source, as `git restore` does. If a path is tracked but
+// does not exist in the restore source, it is removed to match the source: the
+// files added to the index are unstaged.
+//
+// The restore source is o.Source if set. Otherwise, it is HEAD, or the empty
+// tree on an unborn branch, if o.Staged is set, and the index if only the
+// working tree is restored, as it is if neither o.Staged nor o.Worktree are
+// set.
+//
+// Restore with no files specified will return ErrNoRestorePaths, and with an
+// item of o.PathSpec matching no file, ErrPathSpecNoMatches.
+func (w *Worktree) Restore(o *RestoreOptions) error {
+	if err := o.Validate(); err != nil {
+		return err
+	}
+
+	ps, err := pathspec.Parse(o.PathSpec)
+	if err != nil {
+		return err
+	}
+
+	idx, err := w.r.Storer.Index()
+	if err != nil {
+		return err
+	}
+
+	var t *object.Tree
+	fromIndex := o.Source.IsZero() && !o.Staged
+	if !fromIndex {
+		if t, err = w.restoreSource(o.Source); err != nil {
+			return err
+		}
+	}
+
+	matched := make([]bool, len(ps))
+	seen := make(map[string]bool)
+	var names []string
+	match := func(name string) {
+		found := inFiles(o.Files, name)
+		if len(ps) > 0 && ps.Match(name) {
+			found = true
+			for i, p := range ps {
+				if !p.Exclude && p.Match(name) {
+					matched[i] = true
+				}
+			}
+		}
+
+		if found && !seen[name] {
+			seen[name] = true
+			names = append(names, name)
+		}
+	}
+
+	for _, e := range idx.Entries {
+		match(e.Name)
+	}
+
+	if t != nil {
+		err = t.Walk(func(name string, e object.TreeEntry) error {
+			if e.Mode != filemode.Dir {
+				match(name)
+			}
+
+			return nil
+		}, object.WalkOptions{})
+		if err != nil {
+			return err
+		}
+	}
+
+	for i, p := range ps {
+		if !p.Exclude && !matched[i] {
+			return fmt.Errorf("%w: %s", ErrPathSpecNoMatches, o.PathSpec[i])
+		}
+	}
+
+	if len(names) == 0 {
+		return nil
+	}
+
+	if o.Staged {
+		if _, _, err := w.resetIndex(t, nil, names); err != nil {
+			return err
+		}
+
+		if !o.Worktree {
+			return nil
+		}
+
+		return w.resetWorktree(context.Background(), t, names, &ResetOptions{}, nil)
+	}
+
+	return w.restoreWorktree(idx, t, names)
+}
+
+// restoreSource returns the tree of the given commit, or of HEAD if zero,
+// which is the empty tree on an unborn branch.
+func (w *Worktree) restoreSource(commit plumbing.Hash) (*object.Tree, error) {
+	if commit.IsZero() {
+		head, err := w.r.Head()
+		if errors.Is(err, plumbing.ErrReferenceNotFound) {
+			return &object.Tree{}, nil
+		}
+
+		if err != nil {
+			return nil, err
+		}
+
+		commit = head.Hash()
+	}
+
+	return w.r.getTreeFromCommitHash(commit)
+}
+
+// restoreWorktree writes the given files to the working tree from the tree, or
+// from the index if nil, leaving the index untouched but for the stat
+// information of the files written from it. The tracked files missing from
+// the tree are removed.
+func (w *Worktree) restoreWorktree(idx *index.Index, t *object.Tree, names []string) error {
+	var entries []*index.Entry
+	var removed []string
+	var conv *converter
+	var err error
+	if t == nil {
+		for _, name := range names {
+			e, err := idx.Entry(name)
+			if err != nil {
+				continue
+			}
+
+			if e.Stage != index.Merged {
+				return fmt.Errorf("%w: %s", ErrUnmergedPaths, name)
+			}
+
+			if !e.SkipWorktree {
+				entries = append(entries, e)
+			}
+		}
+
+		conv, err = w.newWorktreeConverter()
+	} else {
+		for _, name := range names {
+			e, err := t.FindEntry(name)
+			switch {
+			case errors.Is(err, object.ErrEntryNotFound) || errors.Is(err, object.ErrDirectoryNotFound):
+				removed = append(removed, name)
+			case err != nil:
+				return err
+			default:
+				entries = append(entries, &index.Entry{Name: name, Hash: e.Hash, Mode: e.Mode})
+			}
+		}
+
+		conv, err = w.r.newTreeConverter(t)
+	}
+
+	if err != nil {
+		return err
+	}
+
+	g := w.newCheckoutGuard()
+	for _, e := range entries {
+		if err := g.validPath(e.Name); err != nil {
+			return err
+		}
+	}
+
+	for _, name := range removed {
+		if err := rmFileAndDirsIfEmpty(w.Filesystem, name); err != nil {
+			return err
+		}
+	}
+
+	b := newIndexBuilder(idx)
+	for _, e := range entries {
+		if err := g.validLeadingDirs(e.Name); err != nil {
+			return err
+		}
+
+		if err := w.writeEntry(e, conv); err != nil {
+			return err
+		}
+
+		g.written(e.Name)
+
+		// The stat information of the files written from the index is
+		// refreshed, as their content is the staged one.
+		if t == nil && e.Mode != filemode.Submodule {
+			if err := w.addIndexFromCheckout(e.Name, e.Hash, e.Mode, b, conv); err != nil {
+				return err
+			}
+		}
+	}
+
+	b.Write(idx)
+	return w.r.Storer.SetIndex(idx)
+}
+
+// resetIndex resets the index to the given tree, and returns the names of
+// the files that changed. When a sparse checkout is given, it also returns
+// the files that have been flagged as skip-worktree; the files whose flag
+// has been cleared are returned as changed, so that they are checked out.
+func (w *Worktree) resetIndex(t *object.Tree, sparse *sparseCheckout, files []string) ([]string, []string, error) {
+	idx, err := w.r.Storer.Index()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// The unresolved conflicts are discarded, the files being reset to their
+	// version of the tree.
+	if removeUnmergedEntries(idx, "") {
+		if err := w.r.Storer.SetIndex(idx); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	// The files checked out before the reset, which have to be removed from
+	// the working tree if they are left out of the sparse checkout.
+	checkedOut := make(map[string]bool)
+	if sparse != nil {
+		for _, e := range idx.Entries {
+			checkedOut[e.Name] = !e.SkipWorktree
+		}
+	}
+
+	b := newIndexBuilder(idx)
+
+	changes, err := w.diffTreeWithStaging(t, true)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	removedFiles := make([]string, 0, len(changes))
+	for _, ch := range changes {
+		a, err := ch.Action()
+		if err != nil {
+			return nil, nil, err
+		}
+
+		var name string
+		var e *object.TreeEntry
+
+		switch a {
+		case merkletrie.Modify, merkletrie.Insert:
+			name = ch.To.String()
 			e, err = t.FindEntry(name)
 			if err != nil {
-				return nil, err
+				return nil, nil, err
 			}
 		case merkletrie.Delete:
 			name = ch.From.String()
@@ -462,11 +1388,31 @@ func (w *Worktree) resetIndex(t *object.Tree, dirs, files []string) ([]string, e
 
 	b.Write(idx)
 
-	if len(dirs) > 0 {
-		idx.SkipUnless(dirs)
+	var skippedFiles []string
+	if sparse != nil {
+		skipped, unskipped := sparse.apply(idx)
+		for _, name := range skipped {
+			if checkedOut[name] {
+				skippedFiles = append(skippedFiles, name)
+			}
+		}
+
+		removedFiles = append(removedFiles, unskipped...)
 	}
 
-	return removedFiles, w.r.Storer.SetIndex(idx)
+	return removedFiles, skippedFiles, w.r.Storer.SetIndex(idx)
+}
+
+// removeSkippedFiles removes from the working tree the files that have been
+// left out of the sparse checkout.
+func (w *Worktree) removeSkippedFiles(files []string) error {
+	for _, name := range files {
+		if err := rmFileAndDirsIfEmpty(w.Filesystem, name); err != nil {
+			return err
+		}
+	}
+
+	return nil
 }
 
 func inFiles(files []string, v string) bool {
@@ -477,51 +1423,158 @@ func inFiles(files []string, v string) bool {
 		}
 	}
 
-	return false
-}
-
-func (w *Worktree) resetWorktree(t *object.Tree, files []string) error {
-	changes, err := w.diffStagingWithWorktree(true, false)
-	if err != nil {
+	return false
+}
+
+// checkoutContextCheckInterval is the number of files written by a checkout
+// between two checks of its context.
+const checkoutContextCheckInterval = 64
+
+// resetWorktree writes the files of the worktree which differ from the
+// index, the symbolic links according to opts. The paths of the files are
+// validated before they are written. If ctx is done before all the files are
+// written, the index is updated with the files already written, and the
+// error of ctx returned.
+func (w *Worktree) resetWorktree(ctx context.Context, t *object.Tree, files []string, opts *ResetOptions, progress sideband.Progress) error {
+	changes, err := w.diffStagingWithWorktree(true, false)
+	if err != nil {
+		return err
+	}
+
+	if err := w.fetchMissingBlobs(changes, t, files); err != nil {
+		return err
+	}
+
+	idx, err := w.r.Storer.Index()
+	if err != nil {
+		return err
+	}
+	b := newIndexBuilder(idx)
+	conv, err := w.r.newTreeConverter(t)
+	if err != nil {
+		return err
+	}
+
+	conv.setSymlinkMode(opts.SymlinkMode)
+
+	g := w.newCheckoutGuard()
+	checkout := changes[:0:0]
+	for _, ch := range changes {
+		// The files of the git directory are not tracked, but they are
+		// not removed as the untracked files are.
+		if ch.To == nil && g.inGitDir(ch.From.String()) {
+			continue
+		}
+
+		if err := g.validChange(ch); err != nil {
+			return err
+		}
+
+		if len(files) > 0 {
+			file := ""
+			if ch.From != nil {
+				file = ch.From.String()
+			} else if ch.To != nil {
+				file = ch.To.String()
+			}
+
+			if file == "" {
+				continue
+			}
+
+			contains := inFiles(files, file)
+			if !contains {
+				continue
+			}
+		}
+
+		checkout = append(checkout, ch)
+	}
+
+	var written []string
+	for _, ch := range checkout {
+		if ch.To != nil {
+			written = append(written, ch.To.String())
+		}
+	}
+
+	if err := w.checkPathCollisions(idx, written, opts.AllowPathCollisions, progress); err != nil {
+		return err
+	}
+
+	var ctxErr error
+	r, _ := progress.(sideband.ProgressReporter)
+	for i, ch := range checkout {
+		if i%checkoutContextCheckInterval == 0 {
+			if ctxErr = ctx.Err(); ctxErr != nil {
+				break
+			}
+		}
+
+		var name string
+		if ch.To != nil {
+			// The file is written: the symbolic links written before
+			// could lead it out of the worktree.
+			name = ch.To.String()
+			if err := g.validLeadingDirs(name); err != nil {
+				return err
+			}
+		}
+
+		if err := w.checkoutChange(ch, t, b, conv); err != nil {
+			return err
+		}
+
+		g.written(name)
+
+		if r != nil {
+			r.Report(sideband.ProgressEvent{
+				Phase:   sideband.Checkout,
+				Current: uint64(i + 1),
+				Total:   uint64(len(checkout)),
+				Done:    i+1 == len(checkout),
+			})
+		}
+	}
+
+	b.Write(idx)
+	if err := w.r.Storer.SetIndex(idx); err != nil {
 		return err
 	}
 
-	idx, err := w.r.Storer.Index()
-	if err != nil {
-		return err
+	return ctxErr
+}
+
+// fetchMissingBlobs fetches in a single request the blobs missing from a
+// partial clone that are needed to apply the changes, instead of letting
+// them be fetched one at a time on checkout.
+func (w *Worktree) fetchMissingBlobs(changes merkletrie.Changes, t *object.Tree, files []string) error {
+	if w.r.promisor == nil {
+		return nil
 	}
-	b := newIndexBuilder(idx)
 
+	var missing []plumbing.Hash
 	for _, ch := range changes {
-		if err := w.validChange(ch); err != nil {
-			return err
+		if ch.To == nil {
+			continue
 		}
 
-		if len(files) > 0 {
-			file := ""
-			if ch.From != nil {
-				file = ch.From.String()
-			} else if ch.To != nil {
-				file = ch.To.String()
-			}
-
-			if file == "" {
-				continue
-			}
+		name := ch.To.String()
+		if len(files) > 0 && !inFiles(files, name) {
+			continue
+		}
 
-			contains := inFiles(files, file)
-			if !contains {
-				continue
-			}
+		e, err := t.FindEntry(name)
+		if err != nil || e.Mode == filemode.Submodule {
+			continue
 		}
 
-		if err := w.checkoutChange(ch, t, b); err != nil {
-			return err
+		if errors.Is(w.r.Storer.HasEncodedObject(e.Hash), plumbing.ErrObjectNotFound) {
+			missing = append(missing, e.Hash)
 		}
 	}
 
-	b.Write(idx)
-	return w.r.Storer.SetIndex(idx)
+	return w.r.fetchMissingObjects(missing)
 }
 
 // worktreeDeny is a list of paths that are not allowed
@@ -549,26 +1602,32 @@ func validPath(paths ...string) error {
 	for _, p := range paths {
 		parts := strings.FieldsFunc(p, func(r rune) bool { return (r == '\\' || r == '/') })
 		if len(parts) == 0 {
-			return fmt.Errorf("invalid path: %q", p)
+			return &InvalidPathError{Path: p, Err: ErrMalformedPath}
 		}
 
-		if _, denied := worktreeDeny[strings.ToLower(parts[0])]; denied {
-			return fmt.Errorf("invalid path prefix: %q", p)
+		if p[0] == '/' || p[0] == '\\' {
+			return &InvalidPathError{Path: p, Err: ErrPathTraversal}
 		}
 
-		if runtime.GOOS == "windows" {
-			// Volume names are not supported, in both formats: \\ and <DRIVE_LETTER>:.
-			if vol := filepath.VolumeName(p); vol != "" {
-				return fmt.Errorf("invalid path: %q", p)
+		// Volume names are not supported, in both formats: \\ and <DRIVE_LETTER>:.
+		if runtime.GOOS == "windows" && filepath.VolumeName(p) != "" {
+			return &InvalidPathError{Path: p, Err: ErrPathTraversal}
+		}
+
+		for _, part := range parts {
+			if part == ".." {
+				return &InvalidPathError{Path: p, Err: ErrPathTraversal}
 			}
 
-			if !windowsValidPath(parts[0]) {
-				return fmt.Errorf("invalid path: %q", p)
+			// The .git directories are refused at any depth, as a nested
+			// repository could run its hooks.
+			if _, denied := worktreeDeny[strings.ToLower(part)]; denied {
+				return &InvalidPathError{Path: p, Err: ErrPathInGitDir}
 			}
-		}
 
-		if slices.Contains(parts, "..") {
-			return fmt.Errorf("invalid path %q: cannot use '..'", p)
+			if runtime.GOOS == "windows" && !windowsValidPath(part) {
+				return &InvalidPathError{Path: p, Err: ErrPathInGitDir}
+			}
 		}
 	}
 	return nil
@@ -606,7 +1665,7 @@ func windowsValidPath(part string) bool {
 	return true
 }
 
-func (w *Worktree) validChange(ch merkletrie.Change) error {
+func (g *checkoutGuard) validChange(ch merkletrie.Change) error {
 	action, err := ch.Action()
 	if err != nil {
 		return nil
@@ -614,17 +1673,21 @@ func (w *Worktree) validChange(ch merkletrie.Change) error {
 
 	switch action {
 	case merkletrie.Delete:
-		return validPath(ch.From.String())
+		return g.validPath(ch.From.String())
 	case merkletrie.Insert:
-		return validPath(ch.To.String())
+		return g.validPath(ch.To.String())
 	case merkletrie.Modify:
-		return validPath(ch.From.String(), ch.To.String())
+		if err := g.validPath(ch.From.String()); err != nil {
+			return err
+		}
+
+		return g.validPath(ch.To.String())
 	}
 
 	return nil
 }
 
-func (w *Worktree) checkoutChange(ch merkletrie.Change, t *object.Tree, idx *indexBuilder) error {
+func (w *Worktree) checkoutChange(ch merkletrie.Change, t *object.Tree, idx *indexBuilder, conv *converter) error {
 	a, err := ch.Action()
 	if err != nil {
 		return err
@@ -651,32 +1714,12 @@ func (w *Worktree) checkoutChange(ch merkletrie.Change, t *object.Tree, idx *ind
 		return w.checkoutChangeSubmodule(name, a, e, idx)
 	}
 
-	return w.checkoutChangeRegularFile(name, a, t, e, idx)
-}
-
-func (w *Worktree) containsUnstagedChanges() (bool, error) {
-	ch, err := w.diffStagingWithWorktree(false, true)
-	if err != nil {
-		return false, err
-	}
-
-	for _, c := range ch {
-		a, err := c.Action()
-		if err != nil {
-			return false, err
-		}
-
-		if a == merkletrie.Insert {
-			continue
-		}
-
-		return true, nil
-	}
-
-	return false, nil
+	return w.checkoutChangeRegularFile(name, a, t, e, idx, conv)
 }
 
-func (w *Worktree) setHEADCommit(commit plumbing.Hash) error {
+// setHEADCommit moves HEAD, or the current branch, to the given commit. The
+// update is logged in the reflogs with the given message, if not empty.
+func (w *Worktree) setHEADCommit(commit plumbing.Hash, msg string) error {
 	head, err := w.r.Reference(plumbing.HEAD, false)
 	if err != nil {
 		return err
@@ -684,7 +1727,7 @@ func (w *Worktree) setHEADCommit(commit plumbing.Hash) error {
 
 	if head.Type() == plumbing.HashReference {
 		head = plumbing.NewHashReference(plumbing.HEAD, commit)
-		return w.r.Storer.SetReference(head)
+		return w.setReference(head, msg)
 	}
 
 	branch, err := w.r.Reference(head.Target(), false)
@@ -697,7 +1740,16 @@ func (w *Worktree) setHEADCommit(commit plumbing.Hash) error {
 	}
 
 	branch = plumbing.NewHashReference(branch.Name(), commit)
-	return w.r.Storer.SetReference(branch)
+	return w.setReference(branch, msg)
+}
+
+// setReference stores ref, logging its update if msg is not empty.
+func (w *Worktree) setReference(ref *plumbing.Reference, msg string) error {
+	if msg == "" {
+		return w.r.Storer.SetReference(ref)
+	}
+
+	return w.r.setReferenceWithLog(ref, nil, msg)
 }
 
 func (w *Worktree) checkoutChangeSubmodule(name string,
@@ -708,15 +1760,27 @@ func (w *Worktree) checkoutChangeSubmodule(name string,
 	switch a {
 	case merkletrie.Modify:
 		sub, err := w.Submodule(name)
-		if err != nil {
+		if err != nil && !errors.Is(err, ErrSubmoduleNotFound) {
 			return err
 		}
 
-		if !sub.initialized {
+		if sub != nil && sub.initialized {
+			return w.addIndexFromTreeEntry(name, e, idx)
+		}
+
+		// The submodule is not initialized, or not in .gitmodules: its
+		// directory is left as a placeholder, replacing the file checked
+		// out there, if any.
+		fi, err := w.Filesystem.Lstat(name)
+		if err != nil || fi.IsDir() {
 			return nil
 		}
 
-		return w.addIndexFromTreeEntry(name, e, idx)
+		if err := w.Filesystem.Remove(name); err != nil {
+			return err
+		}
+
+		fallthrough
 	case merkletrie.Insert:
 		mode, err := e.Mode.ToOSFileMode()
 		if err != nil {
@@ -738,6 +1802,7 @@ func (w *Worktree) checkoutChangeRegularFile(name string,
 	t *object.Tree,
 	e *object.TreeEntry,
 	idx *indexBuilder,
+	conv *converter,
 ) error {
 	switch a {
 	case merkletrie.Modify:
@@ -756,24 +1821,34 @@ func (w *Worktree) checkoutChangeRegularFile(name string,
 			return err
 		}
 
-		if err := w.checkoutFile(f); err != nil {
+		if err := w.checkoutFile(f, conv); err != nil {
 			return err
 		}
 
-		return w.addIndexFromFile(name, e.Hash, idx)
+		return w.addIndexFromCheckout(name, e.Hash, e.Mode, idx, conv)
 	}
 
 	return nil
 }
 
-func (w *Worktree) checkoutFile(f *object.File) (err error) {
+// checkoutFile writes the given file to the worktree, converted according to
+// its attributes.
+func (w *Worktree) checkoutFile(f *object.File, conv *converter) (err error) {
 	mode, err := f.Mode.ToOSFileMode()
 	if err != nil {
 		return err
 	}
 
 	if mode&os.ModeSymlink != 0 {
-		return w.checkoutFileSymlink(f)
+		switch conv.symlinks {
+		case SkipSymlinks:
+			return nil
+		case RegularSymlinks:
+			// The target of the link is written as the content of the file.
+			mode = 0o644
+		default:
+			return w.checkoutFileSymlink(f)
+		}
 	}
 
 	dstFile, err := w.Filesystem.OpenFile(f.Name, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, mode.Perm())
@@ -782,45 +1857,17 @@ func (w *Worktree) checkoutFile(f *object.File) (err error) {
 	}
 	defer ioutil.CheckClose(dstFile, &err)
 
-	return w.copyObjectToWorktree(f, dstFile)
+	return w.copyObjectToWorktree(f, dstFile, conv)
 }
 
-func (w *Worktree) copyObjectToWorktree(object *object.File, file billy.File) (err error) {
-	cfg, err := w.r.Config()
-	if err != nil {
-		return err
-	}
-
-	var src io.ReadCloser
-	var dst io.Writer = file
-
-	src, err = object.Reader()
+func (w *Worktree) copyObjectToWorktree(object *object.File, file billy.File, conv *converter) (err error) {
+	src, err := conv.toWorktree(object)
 	if err != nil {
 		return err
 	}
 	defer ioutil.CheckClose(src, &err)
 
-	if cfg.Core.AutoCRLF == "true" {
-		br := sync.GetBufioReader(src)
-		defer sync.PutBufioReader(br)
-
-		stat, err := convert.GetStat(br)
-		if err != nil {
-			return err
-		}
-
-		src, err = object.Reader()
-		if err != nil {
-			return err
-		}
-		defer ioutil.CheckClose(src, &err)
-
-		if !stat.IsBinary() {
-			dst = convert.NewCRLFWriter(dst)
-		}
-	}
-
-	_, err = ioutil.CopyBufferPool(dst, src)
+	_, err = ioutil.CopyBufferPool(file, src)
 	return err
 }
 
@@ -873,15 +1920,39 @@ func (w *Worktree) addIndexFromTreeEntry(name string, f *object.TreeEntry, idx *
 }
 
 func (w *Worktree) addIndexFromFile(name string, h plumbing.Hash, idx *indexBuilder) error {
+	return w.addIndexFromFileMode(name, h, 0, idx)
+}
+
+// addIndexFromCheckout stages the file checked out from a blob with the given
+// mode. The symbolic links are staged as symbolic links even if written as
+// regular files, and the skipped ones are flagged as skip-worktree.
+func (w *Worktree) addIndexFromCheckout(name string, h plumbing.Hash, mode filemode.FileMode, idx *indexBuilder, conv *converter) error {
+	if mode != filemode.Symlink {
+		return w.addIndexFromFile(name, h, idx)
+	}
+
+	if conv.symlinks == SkipSymlinks {
+		idx.Remove(name)
+		idx.Add(&index.Entry{Hash: h, Name: name, Mode: mode, SkipWorktree: true})
+		return nil
+	}
+
+	return w.addIndexFromFileMode(name, h, mode, idx)
+}
+
+// addIndexFromFileMode stages the file with the given mode, or with the mode
+// of the file in the worktree if zero.
+func (w *Worktree) addIndexFromFileMode(name string, h plumbing.Hash, mode filemode.FileMode, idx *indexBuilder) error {
 	idx.Remove(name)
 	fi, err := w.Filesystem.Lstat(name)
 	if err != nil {
 		return err
 	}
 
-	mode, err := filemode.NewFromOSFileMode(fi.Mode())
-	if err != nil {
-		return err
+	if mode == filemode.Empty {
+		if mode, err = filemode.NewFromOSFileMode(fi.Mode()); err != nil {
+			return err
+		}
 	}
 
 	e := &index.Entry{
@@ -968,13 +2039,7 @@ func (w *Worktree) Submodules() (Submodules, error) {
 		return nil, err
 	}
 
-	var originURL string
-	if origin, err := w.r.Remote(DefaultRemoteName); err == nil {
-		if origin.c != nil && len(origin.c.URLs) > 0 {
-			originURL = origin.c.URLs[0]
-		}
-	}
-
+	originURL := w.submodulesBaseURL(c)
 	for _, s := range m.Submodules {
 		sub := w.newSubmodule(s, c.Submodules[s.Name])
 		cfg := sub.Config()
@@ -989,6 +2054,24 @@ func (w *Worktree) Submodules() (Submodules, error) {
 	return l, nil
 }
 
+// submodulesBaseURL returns the URL the relative URLs of the submodules are
+// resolved against: as in git, the URL of the remote of the current branch,
+// or of origin, or the worktree itself when there is no such remote.
+func (w *Worktree) submodulesBaseURL(c *config.Config) string {
+	name := DefaultRemoteName
+	if head, err := w.r.Storer.Reference(plumbing.HEAD); err == nil && head.Target().IsBranch() {
+		if b, ok := c.Branches[head.Target().Short()]; ok && b.Remote != "" {
+			name = b.Remote
+		}
+	}
+
+	if remote, ok := c.Remotes[name]; ok && len(remote.URLs) > 0 {
+		return remote.URLs[0]
+	}
+
+	return w.Filesystem.Root()
+}
+
 func (w *Worktree) newSubmodule(fromModules, fromConfig *config.Submodule) *Submodule {
 	m := &Submodule{w: w}
 	m.initialized = fromConfig != nil
@@ -1038,58 +2121,200 @@ func (w *Worktree) readGitmodulesFile() (*config.Modules, error) {
 	return m, nil
 }
 
-// Clean the worktree by removing untracked files.
-// An empty dir could be removed - this is what  `git clean -f -d .` does.
+// Clean the worktree by removing untracked files, as `git clean -f`. Tracked
+// files and nested repositories, such as submodules, are never removed. See
+// CleanPaths for the paths removed.
 func (w *Worktree) Clean(opts *CleanOptions) error {
-	s, err := w.Status()
+	_, err := w.CleanPaths(opts)
+	return err
+}
+
+// CleanPaths cleans the worktree as Clean does, and returns the removed
+// paths, the directories ending with a slash. With CleanOptions.DryRun, the
+// paths that would be removed are returned, and nothing is removed, as
+// `git clean -n` does.
+func (w *Worktree) CleanPaths(opts *CleanOptions) ([]string, error) {
+	if opts == nil {
+		opts = &CleanOptions{}
+	}
+
+	if err := opts.Validate(); err != nil {
+		return nil, err
+	}
+
+	idx, err := w.r.Storer.Index()
 	if err != nil {
-		return err
+		return nil, err
+	}
+
+	// tracked holds the tracked files along with their directories.
+	tracked := make(map[string]bool, len(idx.Entries))
+	for _, e := range idx.Entries {
+		for name := e.Name; name != "." && !tracked[name]; name = path.Dir(name) {
+			tracked[name] = true
+		}
 	}
 
-	root := ""
-	files, err := w.Filesystem.ReadDir(root)
+	patterns, err := gitignore.ReadPatterns(w.Filesystem, nil)
 	if err != nil {
-		return err
+		return nil, err
+	}
+
+	patterns = append(patterns, w.Excludes...)
+
+	c := &cleaner{
+		w:        w,
+		opts:     opts,
+		tracked:  tracked,
+		m:        gitignore.NewMatcher(patterns),
+		pathSpec: make([]string, 0, len(opts.PathSpec)),
+	}
+
+	for _, p := range opts.PathSpec {
+		p = strings.Trim(path.Clean(filepath.ToSlash(p)), "/")
+		if p == "." || p == "" {
+			c.pathSpec = nil
+			break
+		}
+
+		c.pathSpec = append(c.pathSpec, p)
 	}
-	return w.doClean(s, opts, root, files)
+
+	if _, err := c.clean("", false); err != nil {
+		return c.removed, err
+	}
+
+	return c.removed, nil
+}
+
+type cleaner struct {
+	w        *Worktree
+	opts     *CleanOptions
+	tracked  map[string]bool
+	m        gitignore.Matcher
+	pathSpec []string
+	removed  []string
 }
 
-func (w *Worktree) doClean(status Status, opts *CleanOptions, dir string, files []fs.DirEntry) error {
+// clean removes the untracked files of the given directory, ignored being
+// whether the directory is ignored, and returns whether all its entries were
+// removed.
+func (c *cleaner) clean(dir string, ignored bool) (bool, error) {
+	files, err := c.w.Filesystem.ReadDir(dir)
+	if err != nil {
+		return false, err
+	}
+
+	all := true
 	for _, fi := range files {
-		if fi.Name() == GitDirName {
+		name := path.Join(dir, fi.Name())
+		inPathSpec, inParentOfPathSpec := c.matchPathSpec(name)
+		if fi.Name() == GitDirName || !inPathSpec && !(inParentOfPathSpec && fi.IsDir()) {
+			all = false
 			continue
 		}
 
-		// relative path under the root
-		path := filepath.Join(dir, fi.Name())
-		if fi.IsDir() {
-			if !opts.Dir {
-				continue
-			}
+		isIgnored := ignored || c.m.Match(strings.Split(name, "/"), fi.IsDir())
+		removed, err := c.cleanEntry(name, fi.IsDir(), isIgnored, inPathSpec)
+		if err != nil {
+			return false, err
+		}
 
-			subfiles, err := w.Filesystem.ReadDir(path)
-			if err != nil {
-				return err
-			}
-			err = w.doClean(status, opts, path, subfiles)
-			if err != nil {
-				return err
-			}
-		} else {
-			if status.IsUntracked(path) {
-				if err := w.Filesystem.Remove(path); err != nil {
-					return err
-				}
-			}
+		all = all && removed
+	}
+
+	return all, nil
+}
+
+// cleanEntry removes the given file or directory if untracked, or cleans the
+// directory, and returns whether it was removed.
+func (c *cleaner) cleanEntry(name string, isDir, ignored, inPathSpec bool) (bool, error) {
+	if !isDir {
+		if c.tracked[name] || !c.removes(ignored) {
+			return false, nil
 		}
+
+		return true, c.remove(name, name)
 	}
 
-	if opts.Dir && dir != "" {
-		_, err := removeDirIfEmpty(w.Filesystem, dir)
-		return err
+	if _, err := c.w.Filesystem.Lstat(path.Join(name, GitDirName)); err == nil {
+		// Nested repositories are left untouched.
+		return false, nil
 	}
 
-	return nil
+	if c.tracked[name] || !inPathSpec {
+		_, err := c.clean(name, ignored)
+		return false, err
+	}
+
+	switch {
+	case ignored:
+		if !c.opts.Dir || !c.removes(ignored) {
+			return false, nil
+		}
+
+		return true, c.remove(name, name+"/")
+	case c.opts.IgnoredOnly:
+		// The ignored files of the untracked directory are removed.
+		_, err := c.clean(name, ignored)
+		return false, err
+	case !c.opts.Dir:
+		return false, nil
+	}
+
+	// The untracked directory is removed if all its entries are, such as
+	// when it contains no ignored files or nested repository.
+	n := len(c.removed)
+	all, err := c.clean(name, ignored)
+	if err != nil || !all {
+		return false, err
+	}
+
+	c.removed = c.removed[:n]
+	return true, c.remove(name, name+"/")
+}
+
+// removes returns whether an untracked file is removed, according to whether
+// it is ignored.
+func (c *cleaner) removes(ignored bool) bool {
+	switch {
+	case c.opts.IgnoredOnly:
+		return ignored
+	case c.opts.IncludeIgnored:
+		return true
+	default:
+		return !ignored
+	}
+}
+
+func (c *cleaner) remove(name, reported string) error {
+	c.removed = append(c.removed, reported)
+	if c.opts.DryRun {
+		return nil
+	}
+
+	return util.RemoveAll(c.w.Filesystem, name)
+}
+
+// matchPathSpec returns whether name matches the path spec, being one of its
+// paths or in one of them, and whether it is a parent directory of one of its
+// paths.
+func (c *cleaner) matchPathSpec(name string) (match, parent bool) {
+	if len(c.pathSpec) == 0 {
+		return true, false
+	}
+
+	for _, p := range c.pathSpec {
+		if p == name || strings.HasPrefix(name, p+"/") {
+			return true, false
+		}
+
+		if strings.HasPrefix(p, name+"/") {
+			parent = true
+		}
+	}
+
+	return false, parent
 }
 
 // GrepResult is structure of a grep result.
@@ -1109,10 +2334,31 @@ func (gr GrepResult) String() string {
 	return fmt.Sprintf("%s:%s:%d:%s", gr.TreeName, gr.FileName, gr.LineNumber, gr.Content)
 }
 
-// Grep performs grep on a repository.
+// Grep performs grep on a repository, returning the matched lines of the
+// files of the tree of a commit, as `git grep <pattern> <commit>` does. The
+// blobs are read from the storer, so any commit of the history can be
+// searched.
 func (r *Repository) Grep(opts *GrepOptions) ([]GrepResult, error) {
+	var results []GrepResult
+	err := r.ForEachGrepResult(opts, func(gr GrepResult) error {
+		results = append(results, gr)
+		return nil
+	})
+
+	return results, err
+}
+
+// ForEachGrepResult performs grep on a repository as Grep does, calling fn
+// with each matched line as the files are searched instead of returning all
+// of them. The iteration stops without error if fn returns storer.ErrStop.
+func (r *Repository) ForEachGrepResult(opts *GrepOptions, fn func(GrepResult) error) error {
 	if err := opts.validate(r); err != nil {
-		return nil, err
+		return err
+	}
+
+	patterns, err := opts.patterns()
+	if err != nil {
+		return err
 	}
 
 	// Obtain commit hash from options (CommitHash or ReferenceName).
@@ -1123,7 +2369,7 @@ func (r *Repository) Grep(opts *GrepOptions) ([]GrepResult, error) {
 	if opts.ReferenceName != "" {
 		ref, err := r.Reference(opts.ReferenceName, true)
 		if err != nil {
-			return nil, err
+			return err
 		}
 		commitHash = ref.Hash()
 		treeName = opts.ReferenceName.String()
@@ -1136,11 +2382,16 @@ func (r *Repository) Grep(opts *GrepOptions) ([]GrepResult, error) {
 	// the tree.
 	tree, err := r.getTreeFromCommitHash(commitHash)
 	if err != nil {
-		return nil, err
+		return err
 	}
 	fileiter := tree.Files()
 
-	return findMatchInFiles(fileiter, treeName, opts)
+	err = findMatchInFiles(fileiter, treeName, patterns, opts, fn)
+	if errors.Is(err, storer.ErrStop) {
+		return nil
+	}
+
+	return err
 }
 
 // Grep performs grep on a worktree.
@@ -1148,13 +2399,11 @@ func (w *Worktree) Grep(opts *GrepOptions) ([]GrepResult, error) {
 	return w.r.Grep(opts)
 }
 
-// findMatchInFiles takes a FileIter, worktree name and GrepOptions, and
-// returns a slice of GrepResult containing the result of regex pattern matching
-// in content of all the files.
-func findMatchInFiles(fileiter *object.FileIter, treeName string, opts *GrepOptions) ([]GrepResult, error) {
-	var results []GrepResult
-
-	err := fileiter.ForEach(func(file *object.File) error {
+// findMatchInFiles takes a FileIter, worktree name, the patterns of the
+// GrepOptions and the GrepOptions, and calls fn with the result of regex
+// pattern matching in content of all the files.
+func findMatchInFiles(fileiter *object.FileIter, treeName string, patterns []*regexp.Regexp, opts *GrepOptions, fn func(GrepResult) error) error {
+	return fileiter.ForEach(func(file *object.File) error {
 		var fileInPathSpec bool
 
 		// When no pathspecs are provided, search all the files.
@@ -1176,62 +2425,72 @@ func findMatchInFiles(fileiter *object.FileIter, treeName string, opts *GrepOpti
 			return nil
 		}
 
-		grepResults, err := findMatchInFile(file, treeName, opts)
-		if err != nil {
+		return findMatchInFile(file, treeName, patterns, opts, fn)
+	})
+}
+
+// findMatchInFile takes a single File, worktree name, the patterns of the
+// GrepOptions and the GrepOptions, and calls fn with the result of regex
+// pattern matching in the given file, read line by line. The binary files
+// are skipped unless opts.Text is set.
+func findMatchInFile(file *object.File, treeName string, patterns []*regexp.Regexp, opts *GrepOptions, fn func(GrepResult) error) (err error) {
+	reader, err := file.Reader()
+	if err != nil {
+		return err
+	}
+	defer ioutil.CheckClose(reader, &err)
+
+	br := bufio.NewReaderSize(reader, grepBinarySniffLen)
+	if !opts.Text {
+		// A file is binary if a NUL byte is found in its first bytes, as
+		// git does.
+		head, err := br.Peek(grepBinarySniffLen)
+		if err != nil && err != io.EOF {
 			return err
 		}
-		results = append(results, grepResults...)
 
-		return nil
-	})
+		if bytes.IndexByte(head, 0) >= 0 {
+			return nil
+		}
+	}
 
-	return results, err
-}
+	for lineNum := 1; ; lineNum++ {
+		line, err := br.ReadString('\n')
+		if err != nil && err != io.EOF {
+			return err
+		}
 
-// findMatchInFile takes a single File, worktree name and GrepOptions,
-// and returns a slice of GrepResult containing the result of regex pattern
-// matching in the given file.
-func findMatchInFile(file *object.File, treeName string, opts *GrepOptions) ([]GrepResult, error) {
-	var grepResults []GrepResult
+		if line == "" && err == io.EOF {
+			return nil
+		}
 
-	content, err := file.Contents()
-	if err != nil {
-		return grepResults, err
-	}
-
-	// Split the file content and parse line-by-line.
-	contentByLine := strings.Split(content, "\n")
-	for lineNum, cnt := range contentByLine {
-		addToResult := false
-
-		// Match the patterns and content. Break out of the loop once a
-		// match is found.
-		for _, pattern := range opts.Patterns {
-			if pattern != nil && pattern.MatchString(cnt) {
-				// Add to result only if invert match is not enabled.
-				if !opts.InvertMatch {
-					addToResult = true
-					break
-				}
-			} else if opts.InvertMatch {
-				// If matching fails, and invert match is enabled, add to
-				// results.
-				addToResult = true
+		cnt := strings.TrimSuffix(line, "\n")
+
+		// A line is selected if it matches one of the patterns, or none of
+		// them if invert match is enabled.
+		matched := false
+		for _, pattern := range patterns {
+			if pattern.MatchString(cnt) {
+				matched = true
 				break
 			}
 		}
 
-		if addToResult {
-			grepResults = append(grepResults, GrepResult{
+		if matched != opts.InvertMatch {
+			if err := fn(GrepResult{
 				FileName:   file.Name,
-				LineNumber: lineNum + 1,
+				LineNumber: lineNum,
 				Content:    cnt,
 				TreeName:   treeName,
-			})
+			}); err != nil {
+				return err
+			}
 		}
-	}
 
-	return grepResults, nil
+		if err == io.EOF {
+			return nil
+		}
+	}
 }
 
 // will walk up the directory tree removing all encountered empty
@@ -1241,8 +2500,9 @@ func rmFileAndDirsIfEmpty(fs billy.Filesystem, name string) error {
 		return err
 	}
 
+	// The root of the worktree is never removed, even once empty.
 	dir := filepath.Dir(name)
-	for {
+	for dir != "." && dir != string(filepath.Separator) {
 		removed, err := removeDirIfEmpty(fs, dir)
 		if err != nil && !os.IsNotExist(err) {
 			return err
@@ -1297,6 +2557,12 @@ func newIndexBuilder(idx *index.Index) *indexBuilder {
 }
 
 func (b *indexBuilder) Write(idx *index.Index) {
+	for _, e := range idx.Entries {
+		if _, ok := b.entries[e.Name]; !ok {
+			idx.UntrackedCache.Invalidate(e.Name)
+		}
+	}
+
 	idx.Entries = idx.Entries[:0]
 	for _, e := range b.entries {
 		idx.Entries = append(idx.Entries, e)
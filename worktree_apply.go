@@ -0,0 +1,526 @@
+package git
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/go-git/go-billy/v6/util"
+
+	"github.com/go-git/go-git/v6/plumbing"
+	"github.com/go-git/go-git/v6/plumbing/filemode"
+	"github.com/go-git/go-git/v6/plumbing/format/diff"
+	"github.com/go-git/go-git/v6/plumbing/format/index"
+	"github.com/go-git/go-git/v6/plumbing/object"
+	"github.com/go-git/go-git/v6/utils/merge"
+)
+
+var (
+	// ErrPatchDoesNotApply is returned when a patch cannot be applied: some
+	// of its hunks are rejected, or the files it changes are missing or
+	// already exist.
+	ErrPatchDoesNotApply = errors.New("patch does not apply")
+	// ErrPatchConflicts is returned when a patch, applied with a three-way
+	// merge, results in conflicts.
+	ErrPatchConflicts = errors.New("conflicts applying patch")
+)
+
+// ApplyError is the error returned when the hunks of a patch are rejected,
+// or result in conflicts. It wraps ErrPatchDoesNotApply, or
+// ErrPatchConflicts.
+type ApplyError struct {
+	// Rejected are the files with rejected hunks.
+	Rejected []*RejectedFile
+	// Conflicts are the names of the files with conflicts, left unmerged in
+	// the index.
+	Conflicts []string
+}
+
+func (e *ApplyError) Error() string {
+	var msgs []string
+	for _, f := range e.Rejected {
+		msgs = append(msgs, fmt.Sprintf("%s: %d hunks rejected", f.Name, len(f.Hunks)))
+	}
+
+	if len(e.Conflicts) > 0 {
+		msgs = append(msgs, fmt.Sprintf("%s: %s", ErrPatchConflicts, strings.Join(e.Conflicts, ", ")))
+	}
+
+	if len(e.Rejected) > 0 {
+		return fmt.Sprintf("%s: %s", ErrPatchDoesNotApply, strings.Join(msgs, ", "))
+	}
+
+	return strings.Join(msgs, ", ")
+}
+
+func (e *ApplyError) Unwrap() []error {
+	var errs []error
+	if len(e.Rejected) > 0 {
+		errs = append(errs, ErrPatchDoesNotApply)
+	}
+
+	if len(e.Conflicts) > 0 {
+		errs = append(errs, ErrPatchConflicts)
+	}
+
+	return errs
+}
+
+// RejectedFile is a file of a patch whose hunks have been rejected.
+type RejectedFile struct {
+	Name  string
+	Hunks []*diff.Hunk
+}
+
+// String returns the rejected hunks as written by git apply --reject in the
+// .rej file of the file.
+func (f *RejectedFile) String() string {
+	sb := &strings.Builder{}
+	fmt.Fprintf(sb, "diff a/%s b/%s\t(rejected hunks)\n", f.Name, f.Name)
+	for _, h := range f.Hunks {
+		sb.WriteString(h.String())
+	}
+
+	return sb.String()
+}
+
+// ApplyPatch applies a patch, in the unified diff format of git diff, to the
+// working tree, as git apply does. The files created, deleted, renamed and
+// copied, their modes and their binary patches are applied.
+//
+// The patch is applied atomically: if a file doesn't apply, nothing is
+// changed, and an error wrapping ErrPatchDoesNotApply is returned, an
+// *ApplyError if hunks are rejected, unless Reject is set.
+func (w *Worktree) ApplyPatch(r io.Reader, opts *ApplyOptions) error {
+	if opts == nil {
+		opts = &ApplyOptions{}
+	}
+
+	files, err := diff.NewUnifiedDecoder(r).Decode()
+	if err != nil {
+		return err
+	}
+
+	a := &patchApplier{r: w.r, opts: opts, read: w.patchedFile}
+	if err := a.apply(files); err != nil {
+		return err
+	}
+
+	if opts.Check || len(a.rejected) > 0 && !opts.Reject {
+		return a.err()
+	}
+
+	if err := w.writePatchResults(a); err != nil {
+		return err
+	}
+
+	return a.err()
+}
+
+// patchedFile returns the content and the mode of a file of the working
+// tree.
+func (w *Worktree) patchedFile(name string) ([]byte, filemode.FileMode, error) {
+	fi, err := w.Filesystem.Lstat(name)
+	if err != nil {
+		return nil, filemode.Empty, err
+	}
+
+	mode, err := filemode.NewFromOSFileMode(fi.Mode())
+	if err != nil {
+		return nil, filemode.Empty, err
+	}
+
+	if mode == filemode.Symlink {
+		target, err := w.Filesystem.Readlink(name)
+		return []byte(target), mode, err
+	}
+
+	content, err := util.ReadFile(w.Filesystem, name)
+	return content, mode, err
+}
+
+func (w *Worktree) writePatchResults(a *patchApplier) error {
+	for _, f := range a.results {
+		if err := w.writePatchResult(f); err != nil {
+			return err
+		}
+	}
+
+	if a.opts.Reject {
+		for _, rf := range a.rejected {
+			if err := util.WriteFile(w.Filesystem, rf.Name+".rej", []byte(rf.String()), 0o644); err != nil {
+				return err
+			}
+		}
+	}
+
+	if !a.opts.Index && !a.opts.ThreeWay {
+		return nil
+	}
+
+	idx, err := w.r.Storer.Index()
+	if err != nil {
+		return err
+	}
+
+	b := newIndexBuilder(idx)
+	var conflicts []*index.Entry
+	for _, f := range a.results {
+		switch {
+		case f.deleted:
+			b.Remove(f.name)
+		case f.conflict != nil:
+			b.Remove(f.name)
+			conflicts = append(conflicts, f.conflict...)
+		default:
+			h, err := w.r.storeBlob(f.content)
+			if err != nil {
+				return err
+			}
+
+			if err := w.addIndexFromFile(f.name, h, b); err != nil {
+				return err
+			}
+		}
+	}
+
+	b.Write(idx)
+	idx.Entries = append(idx.Entries, conflicts...)
+	return w.r.Storer.SetIndex(idx)
+}
+
+func (w *Worktree) writePatchResult(f *patchResult) error {
+	if f.deleted {
+		return rmFileAndDirsIfEmpty(w.Filesystem, f.name)
+	}
+
+	// The file is removed first, as its mode may change.
+	if err := w.Filesystem.Remove(f.name); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	if f.mode == filemode.Symlink {
+		return w.Filesystem.Symlink(string(f.content), f.name)
+	}
+
+	perm, err := f.mode.ToOSFileMode()
+	if err != nil {
+		return err
+	}
+
+	return util.WriteFile(w.Filesystem, f.name, f.content, perm.Perm())
+}
+
+// ApplyPatchToTree applies a patch, in the unified diff format of git diff,
+// to the files of a tree, and returns the hash of the resulting tree, which
+// is stored with its blobs. Unlike Worktree.ApplyPatch, the conflicts of a
+// three-way merge cannot be stored, and fail to apply.
+func (r *Repository) ApplyPatchToTree(t *object.Tree, patch io.Reader, opts *ApplyOptions) (plumbing.Hash, error) {
+	if opts == nil {
+		opts = &ApplyOptions{}
+	}
+
+	files, err := diff.NewUnifiedDecoder(patch).Decode()
+	if err != nil {
+		return plumbing.ZeroHash, err
+	}
+
+	a := &patchApplier{r: r, opts: opts, read: func(name string) ([]byte, filemode.FileMode, error) {
+		f, err := t.File(name)
+		if errors.Is(err, object.ErrFileNotFound) {
+			return nil, filemode.Empty, os.ErrNotExist
+		}
+
+		if err != nil {
+			return nil, filemode.Empty, err
+		}
+
+		content, err := r.blobContent(f.Hash)
+		return content, f.Mode, err
+	}}
+
+	if err := a.apply(files); err != nil {
+		return plumbing.ZeroHash, err
+	}
+
+	if len(a.conflicts) > 0 {
+		return plumbing.ZeroHash, a.err()
+	}
+
+	if opts.Check || len(a.rejected) > 0 && !opts.Reject {
+		return plumbing.ZeroHash, a.err()
+	}
+
+	entries := make(map[string]*index.Entry)
+	if err := t.Walk(func(name string, e object.TreeEntry) error {
+		if e.Mode != filemode.Dir {
+			entries[name] = &index.Entry{Name: name, Hash: e.Hash, Mode: e.Mode}
+		}
+
+		return nil
+	}, object.WalkOptions{}); err != nil {
+		return plumbing.ZeroHash, err
+	}
+
+	for _, f := range a.results {
+		if f.deleted {
+			delete(entries, f.name)
+			continue
+		}
+
+		h, err := r.storeBlob(f.content)
+		if err != nil {
+			return plumbing.ZeroHash, err
+		}
+
+		entries[f.name] = &index.Entry{Name: f.name, Hash: h, Mode: f.mode}
+	}
+
+	idx := &index.Index{}
+	for _, e := range entries {
+		idx.Entries = append(idx.Entries, e)
+	}
+
+	h := &buildTreeHelper{s: r.Storer}
+	hash, err := h.BuildTree(idx, &CommitOptions{})
+	if err != nil {
+		return plumbing.ZeroHash, err
+	}
+
+	return hash, a.err()
+}
+
+// patchApplier applies the diffs of the files of a patch in memory, the
+// results being then written by the caller.
+type patchApplier struct {
+	r    *Repository
+	opts *ApplyOptions
+	// read returns the content and the mode of a file, or an error
+	// satisfying os.IsNotExist if it doesn't exist.
+	read func(name string) ([]byte, filemode.FileMode, error)
+
+	// results are the files changed by the patch, by order of change, and
+	// byName the results by their names, as a file can be changed by
+	// several diffs of the patch.
+	results   []*patchResult
+	byName    map[string]*patchResult
+	rejected  []*RejectedFile
+	conflicts []string
+}
+
+// patchResult is the new state of a file changed by a patch.
+type patchResult struct {
+	name    string
+	content []byte
+	mode    filemode.FileMode
+	deleted bool
+	// conflict are the index entries of the stages of the three-way merge,
+	// if it results in conflicts.
+	conflict []*index.Entry
+}
+
+func (a *patchApplier) err() error {
+	if len(a.rejected) == 0 && len(a.conflicts) == 0 {
+		return nil
+	}
+
+	return &ApplyError{Rejected: a.rejected, Conflicts: a.conflicts}
+}
+
+func (a *patchApplier) apply(files []*diff.FileDiff) error {
+	a.byName = make(map[string]*patchResult)
+	for _, fd := range files {
+		if a.opts.Reverse {
+			fd = fd.Reverse()
+		}
+
+		if err := a.applyFile(fd); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (a *patchApplier) file(name string) (content []byte, mode filemode.FileMode, exists bool, err error) {
+	if f, ok := a.byName[name]; ok {
+		return f.content, f.mode, !f.deleted, nil
+	}
+
+	content, mode, err = a.read(name)
+	if os.IsNotExist(err) {
+		return nil, filemode.Empty, false, nil
+	}
+
+	return content, mode, err == nil, err
+}
+
+func (a *patchApplier) applyFile(fd *diff.FileDiff) error {
+	var content []byte
+	var mode filemode.FileMode
+	if !fd.IsNew() {
+		var exists bool
+		var err error
+		content, mode, exists, err = a.file(fd.OldName)
+		if err != nil {
+			return err
+		}
+
+		if !exists {
+			return fmt.Errorf("%w: %s: no such file", ErrPatchDoesNotApply, fd.OldName)
+		}
+	}
+
+	if fd.NewName != "" && fd.NewName != fd.OldName {
+		_, _, exists, err := a.file(fd.NewName)
+		if err != nil {
+			return err
+		}
+
+		if exists {
+			return fmt.Errorf("%w: %s: already exists", ErrPatchDoesNotApply, fd.NewName)
+		}
+	}
+
+	result, rejected, err := fd.Apply(content)
+	if err != nil {
+		return fmt.Errorf("%w: %s: %w", ErrPatchDoesNotApply, fd.OldName, err)
+	}
+
+	var conflict []*index.Entry
+	if len(rejected) > 0 && a.opts.ThreeWay {
+		merged, entries, ok, err := a.merge(fd, content, mode)
+		if err != nil {
+			return err
+		}
+
+		if ok {
+			result, rejected, conflict = merged, nil, entries
+		}
+	}
+
+	name := fd.NewName
+	if name == "" {
+		name = fd.OldName
+	}
+
+	if len(rejected) > 0 {
+		a.rejected = append(a.rejected, &RejectedFile{Name: name, Hunks: rejected})
+	}
+
+	if conflict != nil {
+		a.conflicts = append(a.conflicts, name)
+	}
+
+	if fd.IsDelete() && len(rejected) == 0 {
+		if len(result) > 0 {
+			return fmt.Errorf("%w: %s: removed file still has content", ErrPatchDoesNotApply, fd.OldName)
+		}
+
+		a.setResult(&patchResult{name: fd.OldName, deleted: true})
+		return nil
+	}
+
+	if fd.OldName != "" && fd.OldName != fd.NewName && !fd.IsCopy {
+		a.setResult(&patchResult{name: fd.OldName, deleted: true})
+	}
+
+	switch {
+	case fd.NewMode != filemode.Empty:
+		mode = fd.NewMode
+	case mode == filemode.Empty:
+		mode = filemode.Regular
+	}
+
+	a.setResult(&patchResult{name: name, content: result, mode: mode, conflict: conflict})
+	return nil
+}
+
+func (a *patchApplier) setResult(f *patchResult) {
+	if prev, ok := a.byName[f.name]; ok {
+		*prev = *f
+		return
+	}
+
+	a.byName[f.name] = f
+	a.results = append(a.results, f)
+}
+
+// merge falls back to a three-way merge of the changes of the diff, applied
+// to the original content of the file, read from the full hash of its index
+// line, with the current content of the file. It returns false if the
+// original content is not available, or if the diff doesn't apply to it.
+// Otherwise, the merged content, and the index entries of the stages of the
+// merge if it results in conflicts, are returned.
+func (a *patchApplier) merge(fd *diff.FileDiff, ours []byte, mode filemode.FileMode) ([]byte, []*index.Entry, bool, error) {
+	baseHash, ok := plumbing.FromHex(fd.OldHash)
+	if !ok || len(fd.OldHash) != baseHash.HexSize() || fd.IsBinary {
+		return nil, nil, false, nil
+	}
+
+	base, err := a.r.blobContent(baseHash)
+	if errors.Is(err, plumbing.ErrObjectNotFound) {
+		return nil, nil, false, nil
+	}
+
+	if err != nil {
+		return nil, nil, false, err
+	}
+
+	theirs, rejected, err := fd.Apply(base)
+	if err != nil || len(rejected) > 0 {
+		return nil, nil, false, nil
+	}
+
+	merged, conflicts, err := merge.File(base, ours, theirs, &merge.MergeFileOptions{
+		OursLabel:   "ours",
+		TheirsLabel: "theirs",
+	})
+	if errors.Is(err, merge.ErrBinary) {
+		return nil, nil, false, nil
+	}
+
+	if err != nil || conflicts == 0 {
+		return merged, nil, err == nil, err
+	}
+
+	name := fd.NewName
+	if name == "" {
+		name = fd.OldName
+	}
+
+	baseMode := fd.OldMode
+	if baseMode == filemode.Empty {
+		baseMode = mode
+	}
+
+	theirsMode := fd.NewMode
+	if theirsMode == filemode.Empty {
+		theirsMode = mode
+	}
+
+	var entries []*index.Entry
+	for i, stage := range []struct {
+		content []byte
+		mode    filemode.FileMode
+	}{{base, baseMode}, {ours, mode}, {theirs, theirsMode}} {
+		// The stages are only stored when the patch is applied.
+		var h plumbing.Hash
+		if !a.opts.Check {
+			if h, err = a.r.storeBlob(stage.content); err != nil {
+				return nil, nil, false, err
+			}
+		}
+
+		entries = append(entries, &index.Entry{
+			Name:  name,
+			Hash:  h,
+			Mode:  stage.mode,
+			Stage: index.AncestorMode + index.Stage(i),
+		})
+	}
+
+	return merged, entries, true, nil
+}
@@ -0,0 +1,348 @@
+package git
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/go-git/go-billy/v6/memfs"
+	"github.com/go-git/go-billy/v6/util"
+
+	"github.com/go-git/go-git/v6/plumbing"
+	"github.com/go-git/go-git/v6/plumbing/format/diff"
+	"github.com/go-git/go-git/v6/plumbing/format/index"
+	"github.com/go-git/go-git/v6/plumbing/object"
+	"github.com/go-git/go-git/v6/storage/memory"
+)
+
+// numberedLines returns n lines, numbered from 1, of the given prefix.
+func numberedLines(prefix string, n int) string {
+	sb := &strings.Builder{}
+	for i := 1; i <= n; i++ {
+		fmt.Fprintf(sb, "%s %d\n", prefix, i)
+	}
+
+	return sb.String()
+}
+
+// newApplyRepository returns a repository with two commits, the second one
+// modifying, adding, deleting, renaming, and changing the mode of files,
+// and the patch of the changes of the second commit, with the first one
+// checked out.
+func (s *WorktreeSuite) newApplyRepository() (r *Repository, w *Worktree, from, to *object.Tree, patch string) {
+	fs := memfs.New()
+	r, err := Init(memory.NewStorage(), WithWorkTree(fs))
+	s.Require().NoError(err)
+
+	w, err = r.Worktree()
+	s.Require().NoError(err)
+
+	commit := func(files map[string]string, removed ...string) *object.Commit {
+		for name, content := range files {
+			s.Require().NoError(util.WriteFile(fs, name, []byte(content), 0o644))
+		}
+
+		for _, name := range removed {
+			s.Require().NoError(fs.Remove(name))
+		}
+
+		s.Require().NoError(w.AddWithOptions(&AddOptions{All: true}))
+		h, err := w.Commit("commit\n", &CommitOptions{Author: defaultSignature()})
+		s.Require().NoError(err)
+
+		c, err := r.CommitObject(h)
+		s.Require().NoError(err)
+		return c
+	}
+
+	lines := numberedLines("line", 20)
+	c1 := commit(map[string]string{
+		"modified":       lines,
+		"deleted":        "deleted\n",
+		"dir/renamed":    numberedLines("renamed", 10),
+		"script.sh":      "echo\n",
+		"dir/unchanged":  "unchanged\n",
+		"no-newline.txt": "a\nb",
+	})
+
+	s.Require().NoError(fs.Remove("script.sh"))
+	s.Require().NoError(util.WriteFile(fs, "script.sh", []byte("echo\n"), 0o755))
+	c2 := commit(map[string]string{
+		"modified":       strings.Replace(strings.Replace(lines, "line 2\n", "line two\n", 1), "line 18\n", "line eighteen\n", 1),
+		"added":          "added\n",
+		"dir/moved":      numberedLines("renamed", 10) + "more\n",
+		"no-newline.txt": "a\nc",
+	}, "deleted", "dir/renamed")
+
+	from, err = c1.Tree()
+	s.Require().NoError(err)
+	to, err = c2.Tree()
+	s.Require().NoError(err)
+
+	changes, err := object.DiffTreeWithOptions(context.Background(), from, to, object.DefaultDiffTreeOptions)
+	s.Require().NoError(err)
+	p, err := changes.Patch()
+	s.Require().NoError(err)
+
+	s.Require().NoError(w.Checkout(&CheckoutOptions{Hash: c1.Hash, Force: true}))
+	return r, w, from, to, p.String()
+}
+
+func (s *WorktreeSuite) worktreeTree(r *Repository, w *Worktree) plumbing.Hash {
+	s.Require().NoError(w.AddWithOptions(&AddOptions{All: true}))
+	h, err := w.Commit("applied\n", &CommitOptions{Author: defaultSignature(), AllowEmptyCommits: true})
+	s.Require().NoError(err)
+
+	c, err := r.CommitObject(h)
+	s.Require().NoError(err)
+	return c.TreeHash
+}
+
+func (s *WorktreeSuite) TestApplyPatch() {
+	r, w, _, to, patch := s.newApplyRepository()
+	s.Contains(patch, "rename from dir/renamed\nrename to dir/moved\n")
+
+	s.Require().NoError(w.ApplyPatch(strings.NewReader(patch), nil))
+
+	// The index is not updated.
+	status, err := w.Status()
+	s.Require().NoError(err)
+	s.Equal(Modified, status.File("modified").Worktree)
+	s.Equal(Unmodified, status.File("modified").Staging)
+	s.Equal(Untracked, status.File("added").Worktree)
+
+	fi, err := w.Filesystem.Lstat("script.sh")
+	s.Require().NoError(err)
+	s.Equal(0o755, int(fi.Mode().Perm()))
+	s.False(fileExists(w.Filesystem, "deleted"))
+	s.False(fileExists(w.Filesystem, "dir/renamed"))
+
+	content, err := util.ReadFile(w.Filesystem, "no-newline.txt")
+	s.Require().NoError(err)
+	s.Equal("a\nc", string(content))
+
+	s.Equal(to.Hash, s.worktreeTree(r, w))
+}
+
+func (s *WorktreeSuite) TestApplyPatchIndex() {
+	_, w, _, to, patch := s.newApplyRepository()
+
+	s.Require().NoError(w.ApplyPatch(strings.NewReader(patch), &ApplyOptions{Index: true}))
+
+	status, err := w.Status()
+	s.Require().NoError(err)
+	s.Equal(Unmodified, status.File("modified").Worktree)
+	s.Equal(Modified, status.File("modified").Staging)
+	s.Equal(Added, status.File("added").Staging)
+	s.Equal(Deleted, status.File("deleted").Staging)
+
+	h, err := w.Commit("applied\n", &CommitOptions{Author: defaultSignature()})
+	s.Require().NoError(err)
+	c, err := w.r.CommitObject(h)
+	s.Require().NoError(err)
+	s.Equal(to.Hash, c.TreeHash)
+}
+
+func (s *WorktreeSuite) TestApplyPatchReverse() {
+	r, w, from, _, patch := s.newApplyRepository()
+
+	head, err := r.Head()
+	s.Require().NoError(err)
+	c, err := r.CommitObject(head.Hash())
+	s.Require().NoError(err)
+	s.Equal(from.Hash, c.TreeHash)
+
+	s.Require().NoError(w.ApplyPatch(strings.NewReader(patch), nil))
+	s.Require().NoError(w.ApplyPatch(strings.NewReader(patch), &ApplyOptions{Reverse: true}))
+	s.Equal(from.Hash, s.worktreeTree(r, w))
+
+	// The patch has already been reverted.
+	err = w.ApplyPatch(strings.NewReader(patch), &ApplyOptions{Reverse: true})
+	s.ErrorIs(err, ErrPatchDoesNotApply)
+}
+
+func (s *WorktreeSuite) TestApplyPatchCheck() {
+	r, w, from, _, patch := s.newApplyRepository()
+
+	s.Require().NoError(w.ApplyPatch(strings.NewReader(patch), &ApplyOptions{Check: true}))
+	s.Equal(from.Hash, s.worktreeTree(r, w))
+
+	s.Require().NoError(util.WriteFile(w.Filesystem, "added", []byte("conflict\n"), 0o644))
+	err := w.ApplyPatch(strings.NewReader(patch), &ApplyOptions{Check: true})
+	s.ErrorIs(err, ErrPatchDoesNotApply)
+	s.ErrorContains(err, "added: already exists")
+}
+
+func (s *WorktreeSuite) TestApplyPatchMissingFile() {
+	_, w, _, _, patch := s.newApplyRepository()
+
+	s.Require().NoError(w.Filesystem.Remove("modified"))
+	err := w.ApplyPatch(strings.NewReader(patch), nil)
+	s.ErrorIs(err, ErrPatchDoesNotApply)
+	s.ErrorContains(err, "modified: no such file")
+
+	// Nothing has been applied.
+	s.False(fileExists(w.Filesystem, "added"))
+	s.True(fileExists(w.Filesystem, "deleted"))
+}
+
+func (s *WorktreeSuite) TestApplyPatchRejected() {
+	_, w, _, _, patch := s.newApplyRepository()
+
+	lines := strings.Replace(numberedLines("line", 20), "line 18\n", "line 18 changed\n", 1)
+	s.Require().NoError(util.WriteFile(w.Filesystem, "modified", []byte(lines), 0o644))
+
+	err := w.ApplyPatch(strings.NewReader(patch), nil)
+	s.ErrorIs(err, ErrPatchDoesNotApply)
+
+	var applyErr *ApplyError
+	s.Require().ErrorAs(err, &applyErr)
+	s.Require().Len(applyErr.Rejected, 1)
+	s.Equal("modified", applyErr.Rejected[0].Name)
+	s.Require().Len(applyErr.Rejected[0].Hunks, 1)
+	s.Equal(15, applyErr.Rejected[0].Hunks[0].OldStart)
+
+	// Nothing has been applied.
+	s.False(fileExists(w.Filesystem, "added"))
+	s.False(fileExists(w.Filesystem, "modified.rej"))
+
+	err = w.ApplyPatch(strings.NewReader(patch), &ApplyOptions{Reject: true})
+	s.ErrorIs(err, ErrPatchDoesNotApply)
+	s.True(fileExists(w.Filesystem, "added"))
+
+	content, err := util.ReadFile(w.Filesystem, "modified")
+	s.Require().NoError(err)
+	s.Equal(strings.Replace(lines, "line 2\n", "line two\n", 1), string(content))
+
+	rej, err := util.ReadFile(w.Filesystem, "modified.rej")
+	s.Require().NoError(err)
+	s.Equal("diff a/modified b/modified\t(rejected hunks)\n"+
+		"@@ -15,6 +15,6 @@ line 14\n"+
+		" line 15\n"+
+		" line 16\n"+
+		" line 17\n"+
+		"-line 18\n"+
+		"+line eighteen\n"+
+		" line 19\n"+
+		" line 20\n", string(rej))
+}
+
+func (s *WorktreeSuite) TestApplyPatchThreeWay() {
+	_, w, _, _, patch := s.newApplyRepository()
+
+	// The context of the second hunk has changed, but not the lines it
+	// changes: the three-way merge applies it cleanly.
+	lines := strings.Replace(numberedLines("line", 20), "line 16\n", "line sixteen\n", 1)
+	s.Require().NoError(util.WriteFile(w.Filesystem, "modified", []byte(lines), 0o644))
+
+	err := w.ApplyPatch(strings.NewReader(patch), nil)
+	s.ErrorIs(err, ErrPatchDoesNotApply)
+
+	s.Require().NoError(w.ApplyPatch(strings.NewReader(patch), &ApplyOptions{ThreeWay: true}))
+
+	content, err := util.ReadFile(w.Filesystem, "modified")
+	s.Require().NoError(err)
+	s.Equal(strings.NewReplacer("line 2\n", "line two\n", "line 18\n", "line eighteen\n").Replace(lines), string(content))
+
+	status, err := w.Status()
+	s.Require().NoError(err)
+	s.Equal(Unmodified, status.File("modified").Worktree)
+	s.Equal(Modified, status.File("modified").Staging)
+}
+
+func (s *WorktreeSuite) TestApplyPatchThreeWayConflict() {
+	r, w, _, _, patch := s.newApplyRepository()
+
+	lines := strings.Replace(numberedLines("line", 20), "line 18\n", "line 18 changed\n", 1)
+	s.Require().NoError(util.WriteFile(w.Filesystem, "modified", []byte(lines), 0o644))
+
+	err := w.ApplyPatch(strings.NewReader(patch), &ApplyOptions{ThreeWay: true})
+	s.ErrorIs(err, ErrPatchConflicts)
+	s.NotErrorIs(err, ErrPatchDoesNotApply)
+
+	var applyErr *ApplyError
+	s.Require().ErrorAs(err, &applyErr)
+	s.Equal([]string{"modified"}, applyErr.Conflicts)
+
+	content, err := util.ReadFile(w.Filesystem, "modified")
+	s.Require().NoError(err)
+	s.Contains(string(content), "line two\n")
+	s.Contains(string(content), "<<<<<<< ours\nline 18 changed\n=======\nline eighteen\n>>>>>>> theirs\n")
+
+	idx, err := r.Storer.Index()
+	s.Require().NoError(err)
+
+	var stages []index.Stage
+	for _, e := range idx.Entries {
+		if e.Name == "modified" {
+			stages = append(stages, e.Stage)
+		}
+	}
+
+	s.ElementsMatch([]index.Stage{index.AncestorMode, index.OurMode, index.TheirMode}, stages)
+
+	// The other files of the patch are applied and staged.
+	_, err = idx.Entry("added")
+	s.NoError(err)
+}
+
+func (s *WorktreeSuite) TestApplyPatchToTree() {
+	r, w, from, to, patch := s.newApplyRepository()
+
+	h, err := r.ApplyPatchToTree(from, strings.NewReader(patch), nil)
+	s.Require().NoError(err)
+	s.Equal(to.Hash, h)
+
+	h, err = r.ApplyPatchToTree(to, strings.NewReader(patch), &ApplyOptions{Reverse: true})
+	s.Require().NoError(err)
+	s.Equal(from.Hash, h)
+
+	_, err = r.ApplyPatchToTree(to, strings.NewReader(patch), nil)
+	s.ErrorIs(err, ErrPatchDoesNotApply)
+
+	// The working tree is not changed.
+	s.Equal(from.Hash, s.worktreeTree(r, w))
+}
+
+func (s *WorktreeSuite) TestApplyPatchBinary() {
+	fs := memfs.New()
+	r, err := Init(memory.NewStorage(), WithWorkTree(fs))
+	s.Require().NoError(err)
+	w, err := r.Worktree()
+	s.Require().NoError(err)
+
+	from := bytes.Repeat([]byte{0, 1, 2, 3}, 64)
+	to := append([]byte{0xff, 0}, from...)
+
+	commit := func(content []byte) *object.Tree {
+		s.Require().NoError(util.WriteFile(fs, "image.bin", content, 0o644))
+		_, err := w.Add("image.bin")
+		s.Require().NoError(err)
+		h, err := w.Commit("commit\n", &CommitOptions{Author: defaultSignature()})
+		s.Require().NoError(err)
+		c, err := r.CommitObject(h)
+		s.Require().NoError(err)
+		t, err := c.Tree()
+		s.Require().NoError(err)
+		return t
+	}
+
+	t1, t2 := commit(from), commit(to)
+	p, err := t1.Patch(t2)
+	s.Require().NoError(err)
+
+	var buf bytes.Buffer
+	s.Require().NoError(diff.NewUnifiedEncoder(&buf, diff.DefaultContextLines).SetBinary(true).Encode(p))
+	s.Contains(buf.String(), "GIT binary patch\n")
+
+	h, err := r.ApplyPatchToTree(t1, bytes.NewReader(buf.Bytes()), nil)
+	s.Require().NoError(err)
+	s.Equal(t2.Hash, h)
+
+	s.Require().NoError(w.ApplyPatch(bytes.NewReader(buf.Bytes()), &ApplyOptions{Reverse: true}))
+	content, err := util.ReadFile(fs, "image.bin")
+	s.Require().NoError(err)
+	s.Equal(from, content)
+
+}
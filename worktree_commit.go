@@ -3,6 +3,7 @@ package git
 import (
 	"bytes"
 	"errors"
+	"fmt"
 	"io"
 	"path"
 	"regexp"
@@ -27,6 +28,11 @@ var (
 	ErrEmptyCommit = errors.New("cannot create empty commit: clean working tree")
 	// ErrCannotCherryPickWithoutCommitOptions happens when no commitOptions is not provided for cherry-picking commit
 	ErrCannotCherryPickWithoutCommitOptions = errors.New("cannot cherry-pick without commit options")
+	// ErrEmptyCommitMessage is returned when committing with an empty
+	// message, unless CommitOptions.AllowEmptyMessage is set.
+	ErrEmptyCommitMessage = errors.New("cannot create commit: empty commit message")
+	// ErrNoCommitToAmend is returned when amending while HEAD has no commit.
+	ErrNoCommitToAmend = errors.New("cannot amend: HEAD has no commit")
 
 	// characters to be removed from user name and/or email before using them to build a commit object
 	// See https://git-scm.com/docs/git-commit#_commit_information
@@ -34,20 +40,19 @@ var (
 )
 
 // Commit stores the current contents of the index in a new commit along with
-// a log message from the user describing the changes.
+// a log message from the user describing the changes. ErrEmptyCommit is
+// returned if the tree of the commit is the one of its parent, and
+// ErrEmptyCommitMessage if the message is empty, unless allowed by opts.
 func (w *Worktree) Commit(msg string, opts *CommitOptions) (plumbing.Hash, error) {
 	if err := opts.Validate(w.r); err != nil {
 		return plumbing.ZeroHash, err
 	}
 
-	if opts.All {
-		if err := w.autoAddModifiedAndDeleted(); err != nil {
-			return plumbing.ZeroHash, err
-		}
-	}
-
 	if opts.Amend {
 		head, err := w.r.Head()
+		if errors.Is(err, plumbing.ErrReferenceNotFound) {
+			return plumbing.ZeroHash, ErrNoCommitToAmend
+		}
 		if err != nil {
 			return plumbing.ZeroHash, err
 		}
@@ -57,6 +62,30 @@ func (w *Worktree) Commit(msg string, opts *CommitOptions) (plumbing.Hash, error
 		}
 
 		opts.Parents = headCommit.ParentHashes
+		if msg == "" {
+			msg = headCommit.Message
+		}
+	}
+
+	if !opts.AllowEmptyMessage && strings.TrimSpace(msg) == "" {
+		return plumbing.ZeroHash, ErrEmptyCommitMessage
+	}
+
+	if opts.SignOff {
+		msg = appendSignOff(msg, w.sanitize(*opts.Committer))
+	}
+
+	if opts.All {
+		if err := w.autoAddModifiedAndDeleted(); err != nil {
+			return plumbing.ZeroHash, err
+		}
+	}
+
+	if opts.RunHooks {
+		var err error
+		if msg, err = w.runCommitHooks(msg, opts); err != nil {
+			return plumbing.ZeroHash, err
+		}
 	}
 
 	idx, err := w.r.Storer.Index()
@@ -88,7 +117,7 @@ func (w *Worktree) Commit(msg string, opts *CommitOptions) (plumbing.Hash, error
 		previousTree = parentCommit.TreeHash
 	}
 
-	if treeHash == previousTree && !opts.AllowEmptyCommits {
+	if treeHash == previousTree && len(opts.Parents) < 2 && !opts.AllowEmptyCommits {
 		return plumbing.ZeroHash, ErrEmptyCommit
 	}
 
@@ -97,7 +126,26 @@ func (w *Worktree) Commit(msg string, opts *CommitOptions) (plumbing.Hash, error
 		return plumbing.ZeroHash, err
 	}
 
-	return commit, w.updateHEAD(commit)
+	kind := ""
+	switch {
+	case opts.Amend:
+		kind = " (amend)"
+	case len(opts.Parents) == 0:
+		kind = " (initial)"
+	}
+
+	if err := w.updateHEAD(commit, opts.Committer, fmt.Sprintf("commit%s: %s", kind, reflogSubject(msg))); err != nil {
+		return plumbing.ZeroHash, err
+	}
+
+	// The merge in progress, if any, is concluded by a merge commit.
+	if len(opts.Parents) > 1 {
+		if err := w.r.Storer.RemoveReference(MergeHead); err != nil && !errors.Is(err, plumbing.ErrReferenceNotFound) {
+			return plumbing.ZeroHash, err
+		}
+	}
+
+	return commit, nil
 }
 
 // CherryPick cherry picks commits and merge them into the worktree based on the selected
@@ -177,6 +225,7 @@ func (w *Worktree) CherryPick(commitOpts *CommitOptions, ortStrategyOption OrtMe
 			SignKey:           commitOpts.SignKey,
 			Signer:            commitOpts.Signer,
 			AllowEmptyCommits: commitOpts.AllowEmptyCommits,
+			AllowEmptyMessage: true,
 		})
 		if err != nil {
 			return err
@@ -209,7 +258,9 @@ func (w *Worktree) autoAddModifiedAndDeleted() error {
 	return w.r.Storer.SetIndex(idx)
 }
 
-func (w *Worktree) updateHEAD(commit plumbing.Hash) error {
+// updateHEAD moves HEAD, or the current branch, to the given commit, logging
+// the update in the reflogs.
+func (w *Worktree) updateHEAD(commit plumbing.Hash, committer *object.Signature, msg string) error {
 	head, err := w.r.Storer.Reference(plumbing.HEAD)
 	if err != nil {
 		return err
@@ -221,7 +272,7 @@ func (w *Worktree) updateHEAD(commit plumbing.Hash) error {
 	}
 
 	ref := plumbing.NewHashReference(name, commit)
-	return w.r.Storer.SetReference(ref)
+	return w.r.setReferenceWithLog(ref, committer, msg)
 }
 
 func (w *Worktree) buildCommitObject(msg string, opts *CommitOptions, tree plumbing.Hash) (plumbing.Hash, error) {
@@ -253,7 +304,23 @@ func (w *Worktree) buildCommitObject(msg string, opts *CommitOptions, tree plumb
 	return w.r.Storer.SetEncodedObject(obj)
 }
 
+// appendSignOff appends the Signed-off-by trailer of the given signature to
+// msg, in its trailers if it ends with some, unless it is already the last
+// one.
+func appendSignOff(msg string, sig object.Signature) string {
+	return object.AppendTrailer(msg, object.Trailer{
+		Key:   "Signed-off-by",
+		Value: fmt.Sprintf("%s <%s>", sig.Name, sig.Email),
+	})
+}
+
 func (w *Worktree) sanitize(signature object.Signature) object.Signature {
+	return sanitizeSignature(signature)
+}
+
+// sanitizeSignature removes the characters invalid in a commit from the name
+// and the email of the signature.
+func sanitizeSignature(signature object.Signature) object.Signature {
 	return object.Signature{
 		Name:  invalidCharactersRe.ReplaceAllString(signature.Name, ""),
 		Email: invalidCharactersRe.ReplaceAllString(signature.Email, ""),
@@ -293,6 +360,11 @@ func (h *buildTreeHelper) BuildTree(idx *index.Index, opts *CommitOptions) (plum
 	h.entries = map[string]*object.TreeEntry{}
 
 	for _, e := range idx.Entries {
+		// As git, the intent-to-add entries are not committed.
+		if e.IntentToAdd {
+			continue
+		}
+
 		if err := h.commitIndexEntry(e); err != nil {
 			return plumbing.ZeroHash, err
 		}
@@ -281,6 +281,148 @@ func (s *WorktreeSuite) TestCommitAmendNothingToCommit() {
 	s.Equal(plumbing.ZeroHash, amendedHash)
 }
 
+func (s *WorktreeSuite) TestCommitEmptyMessage() {
+	fs := memfs.New()
+	r, err := Init(memory.NewStorage(), WithWorkTree(fs))
+	s.Require().NoError(err)
+	w, err := r.Worktree()
+	s.Require().NoError(err)
+
+	s.Require().NoError(util.WriteFile(fs, "foo", []byte("foo"), 0o644))
+	_, err = w.Add("foo")
+	s.Require().NoError(err)
+
+	for _, msg := range []string{"", " \n\t\n"} {
+		hash, err := w.Commit(msg, &CommitOptions{Author: defaultSignature()})
+		s.ErrorIs(err, ErrEmptyCommitMessage)
+		s.Equal(plumbing.ZeroHash, hash)
+	}
+
+	hash, err := w.Commit("", &CommitOptions{Author: defaultSignature(), AllowEmptyMessage: true})
+	s.Require().NoError(err)
+	commit, err := r.CommitObject(hash)
+	s.Require().NoError(err)
+	s.Equal("", commit.Message)
+}
+
+func (s *WorktreeSuite) TestCommitMergeSameTree() {
+	fs := memfs.New()
+	r, err := Init(memory.NewStorage(), WithWorkTree(fs))
+	s.Require().NoError(err)
+	w, err := r.Worktree()
+	s.Require().NoError(err)
+
+	s.Require().NoError(util.WriteFile(fs, "foo", []byte("foo"), 0o644))
+	_, err = w.Add("foo")
+	s.Require().NoError(err)
+	first, err := w.Commit("first\n", &CommitOptions{Author: defaultSignature()})
+	s.Require().NoError(err)
+	second, err := w.Commit("second\n", &CommitOptions{Author: defaultSignature(), AllowEmptyCommits: true})
+	s.Require().NoError(err)
+
+	_, err = w.Commit("empty\n", &CommitOptions{Author: defaultSignature()})
+	s.ErrorIs(err, ErrEmptyCommit)
+
+	// A merge keeping the tree of its first parent is not empty.
+	merge, err := w.Commit("merge\n", &CommitOptions{Author: defaultSignature(), Parents: []plumbing.Hash{second, first}})
+	s.Require().NoError(err)
+	commit, err := r.CommitObject(merge)
+	s.Require().NoError(err)
+	s.Equal([]plumbing.Hash{second, first}, commit.ParentHashes)
+}
+
+func (s *WorktreeSuite) TestCommitAmendReuseMessage() {
+	fs := memfs.New()
+	w := &Worktree{
+		r:          s.Repository,
+		Filesystem: fs,
+	}
+
+	s.Require().NoError(w.Checkout(&CheckoutOptions{}))
+	s.Require().NoError(util.WriteFile(fs, "foo", []byte("foo"), 0o644))
+	_, err := w.Add("foo")
+	s.Require().NoError(err)
+	prevHash, err := w.Commit("foo\n", &CommitOptions{Author: defaultSignature()})
+	s.Require().NoError(err)
+
+	s.Require().NoError(util.WriteFile(fs, "foo", []byte("bar"), 0o644))
+	amendedHash, err := w.Commit("", &CommitOptions{Author: defaultSignature(), Amend: true, SignOff: true})
+	s.Require().NoError(err)
+	s.NotEqual(prevHash, amendedHash)
+
+	// The modification of foo is not staged.
+	commit, err := w.r.CommitObject(amendedHash)
+	s.Require().NoError(err)
+	s.Equal("foo\n\nSigned-off-by: foo <foo@foo.foo>\n", commit.Message)
+
+	prev, err := w.r.CommitObject(prevHash)
+	s.Require().NoError(err)
+	s.Equal(prev.ParentHashes, commit.ParentHashes)
+	s.Equal(prev.TreeHash, commit.TreeHash)
+
+	head, err := w.r.Head()
+	s.Require().NoError(err)
+	s.Equal(amendedHash, head.Hash())
+	s.Equal([]string{"commit (amend): foo", "commit: foo"}, reflogMessages(s.T(), w.r, head.Name())[:2])
+}
+
+func (s *WorktreeSuite) TestCommitAmendWithoutCommit() {
+	r, err := Init(memory.NewStorage(), WithWorkTree(memfs.New()))
+	s.Require().NoError(err)
+	w, err := r.Worktree()
+	s.Require().NoError(err)
+
+	_, err = w.Commit("foo\n", &CommitOptions{Author: defaultSignature(), Amend: true, AllowEmptyCommits: true})
+	s.ErrorIs(err, ErrNoCommitToAmend)
+}
+
+func (s *WorktreeSuite) TestCommitAllSignOff() {
+	fs := memfs.New()
+	w := &Worktree{
+		r:          s.Repository,
+		Filesystem: fs,
+	}
+
+	s.Require().NoError(w.Checkout(&CheckoutOptions{}))
+	s.Require().NoError(util.WriteFile(fs, "CHANGELOG", []byte("changed"), 0o644))
+	s.Require().NoError(fs.Remove("LICENSE"))
+	s.Require().NoError(util.WriteFile(fs, "new", []byte("new"), 0o644))
+
+	hash, err := w.Commit("subject\n\nReviewed-by: bar <bar@bar.bar>\n", &CommitOptions{
+		Author:    defaultSignature(),
+		Committer: &object.Signature{Name: "baz", Email: "baz@baz.baz", When: defaultSignature().When},
+		All:       true,
+		SignOff:   true,
+	})
+	s.Require().NoError(err)
+
+	commit, err := w.r.CommitObject(hash)
+	s.Require().NoError(err)
+	s.Equal("subject\n\nReviewed-by: bar <bar@bar.bar>\nSigned-off-by: baz <baz@baz.baz>\n", commit.Message)
+
+	// The modification and the deletion are committed, not the new file.
+	status, err := w.Status()
+	s.Require().NoError(err)
+	s.Equal(Status{"new": &FileStatus{Staging: Untracked, Worktree: Untracked}}, status)
+}
+
+func TestAppendSignOff(t *testing.T) {
+	t.Parallel()
+
+	sig := object.Signature{Name: "foo", Email: "foo@foo.foo"}
+	signOff := "Signed-off-by: foo <foo@foo.foo>\n"
+	for msg, expected := range map[string]string{
+		"":                                   signOff,
+		"subject":                            "subject\n\n" + signOff,
+		"subject\n\nbody\n":                  "subject\n\nbody\n\n" + signOff,
+		"subject\n\nFixes: #1\n":             "subject\n\nFixes: #1\n" + signOff,
+		"subject\n\n" + signOff:              "subject\n\n" + signOff,
+		"subject\n\n" + signOff + "Ack: b\n": "subject\n\n" + signOff + "Ack: b\n" + signOff,
+	} {
+		assert.Equal(t, expected, appendSignOff(msg, sig), msg)
+	}
+}
+
 func TestCount(t *testing.T) {
 	f := fixtures.Basic().One()
 	r := NewRepositoryWithEmptyWorktree(f)
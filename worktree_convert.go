@@ -0,0 +1,543 @@
+package git
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"path"
+	"runtime"
+	"strings"
+	stdsync "sync"
+
+	"golang.org/x/text/encoding"
+	"golang.org/x/text/encoding/ianaindex"
+	"golang.org/x/text/transform"
+
+	"github.com/go-git/go-git/v6/plumbing/format/gitattributes"
+	"github.com/go-git/go-git/v6/plumbing/object"
+	"github.com/go-git/go-git/v6/plumbing/storer"
+	"github.com/go-git/go-git/v6/utils/convert"
+	"github.com/go-git/go-git/v6/utils/ioutil"
+	"github.com/go-git/go-git/v6/utils/sync"
+)
+
+const (
+	gitattributesFile  = ".gitattributes"
+	infoAttributesPath = "info/attributes"
+
+	filterAttribute              = "filter"
+	textAttribute                = "text"
+	eolAttribute                 = "eol"
+	workingTreeEncodingAttribute = "working-tree-encoding"
+)
+
+// eolConversion is the conversion of the line endings of a file, the
+// crlf_action of git.
+type eolConversion int
+
+const (
+	// eolNone leaves the line endings as is.
+	eolNone eolConversion = iota
+	// eolText converts the line endings of a text file to LF in the
+	// repository, and according to core.autocrlf and core.eol in the
+	// worktree.
+	eolText
+	// eolTextInput converts the line endings of a text file to LF in the
+	// repository, leaving them as is in the worktree.
+	eolTextInput
+	// eolTextCRLF converts the line endings of a text file to LF in the
+	// repository, and to CRLF in the worktree.
+	eolTextCRLF
+	// eolAuto, eolAutoInput and eolAutoCRLF are as eolText, eolTextInput and
+	// eolTextCRLF, for the files detected as text.
+	eolAuto
+	eolAutoInput
+	eolAutoCRLF
+)
+
+// conversion describes how the content of a file is converted between the
+// repository and the worktree.
+type conversion struct {
+	driver   FilterDriver
+	eol      eolConversion
+	encoding encoding.Encoding
+}
+
+// converter converts the content of the files between the repository and
+// the worktree, according to their attributes: filter selects a filter
+// driver, text and eol the conversion of the line endings, along with the
+// core.autocrlf and core.eol config options, and working-tree-encoding the
+// encoding of the files in the worktree. The attributes are read on demand,
+// from the .gitattributes files of the directories of the files, and from
+// .git/info/attributes, which takes precedence over them. It is safe for
+// concurrent use.
+type converter struct {
+	r *Repository
+	// mu guards matchers and drivers, filled on demand.
+	mu stdsync.Mutex
+	// read reads the .gitattributes file of the given directory, if any.
+	read     func(dir string, domain []string) ([]gitattributes.MatchAttribute, error)
+	info     []gitattributes.MatchAttribute
+	autoCRLF string
+	eol      string
+	matchers map[string]*dirAttributes
+	drivers  map[string]FilterDriver
+	// symlinks is how the symbolic links are checked out.
+	symlinks SymlinkMode
+}
+
+type dirAttributes struct {
+	stack []gitattributes.MatchAttribute
+	m     gitattributes.Matcher
+}
+
+// newWorktreeConverter returns the converter of the files added from the
+// worktree, reading its .gitattributes files.
+func (w *Worktree) newWorktreeConverter() (*converter, error) {
+	return w.r.newConverter(func(dir string, domain []string) ([]gitattributes.MatchAttribute, error) {
+		return gitattributes.ReadAttributesFile(w.Filesystem, domain, gitattributesFile, dir == "")
+	})
+}
+
+// newTreeConverter returns the converter of the files checked out from the
+// given tree, reading its .gitattributes files.
+func (r *Repository) newTreeConverter(t *object.Tree) (*converter, error) {
+	return r.newConverter(func(dir string, domain []string) ([]gitattributes.MatchAttribute, error) {
+		f, err := t.File(path.Join(dir, gitattributesFile))
+		if err != nil {
+			return nil, nil
+		}
+
+		rd, err := f.Reader()
+		if err != nil {
+			return nil, err
+		}
+
+		defer rd.Close()
+		return gitattributes.ReadAttributes(rd, domain, dir == "")
+	})
+}
+
+func (r *Repository) newConverter(read func(string, []string) ([]gitattributes.MatchAttribute, error)) (*converter, error) {
+	cfg, err := r.Config()
+	if err != nil {
+		return nil, err
+	}
+
+	info, err := r.infoAttributes()
+	if err != nil {
+		return nil, err
+	}
+
+	symlinks := RealSymlinks
+	if cfg.Raw.Section("core").Option("symlinks") == "false" {
+		symlinks = RegularSymlinks
+	}
+
+	return &converter{
+		r:        r,
+		read:     read,
+		info:     info,
+		autoCRLF: cfg.Core.AutoCRLF,
+		eol:      cfg.Raw.Section("core").Option("eol"),
+		matchers: make(map[string]*dirAttributes),
+		drivers:  make(map[string]FilterDriver),
+		symlinks: symlinks,
+	}, nil
+}
+
+// setSymlinkMode sets how the symbolic links are checked out, unless mode is
+// RealSymlinks, leaving the mode of core.symlinks.
+func (c *converter) setSymlinkMode(mode SymlinkMode) {
+	if mode != RealSymlinks {
+		c.symlinks = mode
+	}
+}
+
+// infoAttributes reads the attributes of .git/info/attributes, if any.
+func (r *Repository) infoAttributes() ([]gitattributes.MatchAttribute, error) {
+	fss, ok := r.Storer.(storer.FilesystemStorer)
+	if !ok {
+		return nil, nil
+	}
+
+	return gitattributes.ReadAttributesFile(fss.Filesystem(), nil, infoAttributesPath, true)
+}
+
+// Attributes returns the attributes of the file with the given name in the
+// worktree, as `git check-attr --all` does. They are read from the
+// .gitattributes files of its directories, the deepest ones taking
+// precedence, and from .git/info/attributes, which takes precedence over
+// them. The macros set, such as binary, are expanded, and the attributes
+// which are unspecified are left out.
+func (w *Worktree) Attributes(name string) (map[string]gitattributes.Attribute, error) {
+	c, err := w.newWorktreeConverter()
+	if err != nil {
+		return nil, err
+	}
+
+	c.mu.Lock()
+	results, err := c.match(name, nil)
+	c.mu.Unlock()
+	if err != nil {
+		return nil, err
+	}
+
+	for n, attr := range results {
+		if attr.IsUnspecified() {
+			delete(results, n)
+		}
+	}
+
+	return results, nil
+}
+
+// conversion returns the conversion of the file with the given name, nil if
+// it is stored as is.
+func (c *converter) conversion(name string) (*conversion, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	results, err := c.match(name, []string{
+		filterAttribute, textAttribute, eolAttribute, workingTreeEncodingAttribute,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	conv := &conversion{eol: c.eolConversion(results[textAttribute], results[eolAttribute])}
+	if attr, ok := results[filterAttribute]; ok && attr.IsValueSet() {
+		if conv.driver, err = c.driver(attr.Value()); err != nil {
+			return nil, err
+		}
+	}
+
+	if attr, ok := results[workingTreeEncodingAttribute]; ok && attr.IsValueSet() {
+		if conv.encoding, err = lookupEncoding(attr.Value()); err != nil {
+			return nil, err
+		}
+	}
+
+	if conv.driver == nil && conv.eol == eolNone && conv.encoding == nil {
+		return nil, nil
+	}
+
+	return conv, nil
+}
+
+// eolConversion returns the conversion of the line endings, given the text
+// and eol attributes of a file, as convert_attrs in git.
+func (c *converter) eolConversion(text, eol gitattributes.Attribute) eolConversion {
+	conv, defined := eolNone, true
+	switch {
+	case text == nil || text.IsUnspecified():
+		defined = false
+	case text.IsUnset():
+		return eolNone
+	case text.IsSet():
+		conv = eolText
+	case text.Value() == "auto":
+		conv = eolAuto
+	case text.Value() == "input":
+		conv = eolTextInput
+	default:
+		defined = false
+	}
+
+	// The eol attribute makes the files text, unless they are explicitly
+	// not.
+	if eol != nil && eol.IsValueSet() && (eol.Value() == "lf" || eol.Value() == "crlf") {
+		if conv != eolAuto {
+			conv = eolText
+		}
+
+		if eol.Value() == "lf" {
+			return conv + 1
+		}
+
+		return conv + 2
+	}
+
+	if defined {
+		return conv
+	}
+
+	switch c.autoCRLF {
+	case "true":
+		return eolAutoCRLF
+	case "input":
+		return eolAutoInput
+	}
+
+	return eolNone
+}
+
+// worktreeCRLF returns whether the line endings are CRLF in the worktree,
+// for the given conversion.
+func (c *converter) worktreeCRLF(conv eolConversion) bool {
+	switch conv {
+	case eolTextCRLF, eolAutoCRLF:
+		return true
+	case eolText, eolAuto:
+		switch c.autoCRLF {
+		case "true":
+			return true
+		case "input":
+			return false
+		}
+
+		switch c.eol {
+		case "crlf":
+			return true
+		case "lf":
+			return false
+		}
+
+		return runtime.GOOS == "windows"
+	}
+
+	return false
+}
+
+// driver returns the filter driver with the given name, nil if unknown.
+func (c *converter) driver(name string) (FilterDriver, error) {
+	if d, ok := c.drivers[name]; ok {
+		return d, nil
+	}
+
+	filterDriversMu.RLock()
+	newDriver, ok := filterDrivers[name]
+	filterDriversMu.RUnlock()
+
+	// As in git, the files with an unknown filter driver are not converted.
+	var d FilterDriver
+	if ok {
+		var err error
+		if d, err = newDriver(c.r); err != nil {
+			return nil, err
+		}
+	}
+
+	c.drivers[name] = d
+	return d, nil
+}
+
+// match returns the given attributes of the file with the given name, or all
+// of them if none is given.
+func (c *converter) match(name string, attributes []string) (map[string]gitattributes.Attribute, error) {
+	name = strings.TrimPrefix(path.Clean(strings.ReplaceAll(name, "\\", "/")), "/")
+	dir := path.Dir(name)
+	if dir == "." {
+		dir = ""
+	}
+
+	attrs, err := c.attributes(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	results, _ := attrs.m.Match(strings.Split(name, "/"), attributes)
+	return results, nil
+}
+
+// attributes returns the attributes of the files of the given directory,
+// read from its .gitattributes file and the ones of its parents.
+func (c *converter) attributes(dir string) (*dirAttributes, error) {
+	if a, ok := c.matchers[dir]; ok {
+		return a, nil
+	}
+
+	var domain []string
+	var stack []gitattributes.MatchAttribute
+	if dir != "" {
+		domain = strings.Split(dir, "/")
+
+		parentDir := path.Dir(dir)
+		if parentDir == "." {
+			parentDir = ""
+		}
+
+		parent, err := c.attributes(parentDir)
+		if err != nil {
+			return nil, err
+		}
+
+		stack = parent.stack[:len(parent.stack):len(parent.stack)]
+	}
+
+	own, err := c.read(dir, domain)
+	if err != nil {
+		return nil, err
+	}
+
+	stack = append(stack, own...)
+	a := &dirAttributes{
+		stack: stack,
+		m:     gitattributes.NewMatcher(append(stack[:len(stack):len(stack)], c.info...)),
+	}
+	c.matchers[dir] = a
+	return a, nil
+}
+
+// lookupEncoding returns the encoding with the given name, nil for UTF-8,
+// in which the content is stored.
+func lookupEncoding(name string) (encoding.Encoding, error) {
+	if n := strings.ToUpper(name); n == "UTF-8" || n == "UTF8" {
+		return nil, nil
+	}
+
+	enc, err := ianaindex.IANA.Encoding(name)
+	if err == nil && enc == nil {
+		err = fmt.Errorf("unsupported encoding")
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf("working-tree-encoding %s: %w", name, err)
+	}
+
+	return enc, nil
+}
+
+// toGit converts the content read from r, of the worktree file with the
+// given name, into the content stored in the repository: the filter driver
+// cleans the content, which is then encoded to UTF-8, and its line endings
+// converted to LF, as convert_to_git in git.
+func (c *converter) toGit(name string, r io.Reader) (io.Reader, error) {
+	conv, err := c.conversion(name)
+	if err != nil || conv == nil {
+		return r, err
+	}
+
+	if conv.driver != nil {
+		r = conv.driver.Clean(r)
+	}
+
+	if conv.encoding != nil {
+		r = transform.NewReader(r, conv.encoding.NewDecoder())
+	}
+
+	if conv.eol == eolNone {
+		return r, nil
+	}
+
+	if conv.eol >= eolAuto {
+		stat, sr, err := readStat(r)
+		if err != nil {
+			return nil, err
+		}
+
+		r = sr
+		if stat.IsBinary() || stat.CRLF == 0 {
+			return r, nil
+		}
+	}
+
+	return convert.NewLFReader(r), nil
+}
+
+// toWorktree returns a reader of the content of the given file in the
+// worktree: its line endings are converted to CRLF if required, the content
+// is then encoded from UTF-8, and smudged by the filter driver, as
+// convert_to_working_tree in git.
+func (c *converter) toWorktree(f *object.File) (io.ReadCloser, error) {
+	conv, err := c.conversion(f.Name)
+	if err != nil {
+		return nil, err
+	}
+
+	if conv == nil {
+		return f.Reader()
+	}
+
+	convertEOL := c.worktreeCRLF(conv.eol)
+	if convertEOL && conv.eol >= eolAuto {
+		// The files with CRLF line endings in the repository are left as is.
+		stat, err := fileStat(f)
+		if err != nil {
+			return nil, err
+		}
+
+		convertEOL = !stat.IsBinary() && stat.CRLF == 0
+	}
+
+	rc, err := f.Reader()
+	if err != nil {
+		return nil, err
+	}
+
+	var r io.Reader = rc
+	if convertEOL {
+		r = convert.NewCRLFReader(r)
+	}
+
+	if conv.encoding != nil {
+		r = transform.NewReader(r, conv.encoding.NewEncoder())
+	}
+
+	if conv.driver != nil {
+		r = conv.driver.Smudge(r)
+	}
+
+	return ioutil.NewReadCloser(r, rc), nil
+}
+
+// filter returns the function converting the content of the worktree file
+// with the given name into the content stored in the repository, used to
+// hash the files of the worktree. It is nil when the file is stored as is,
+// or when its conversion fails to be read.
+func (c *converter) filter(name string) func(io.Reader) io.Reader {
+	conv, err := c.conversion(name)
+	if err != nil || conv == nil {
+		return nil
+	}
+
+	return func(r io.Reader) io.Reader {
+		r, err := c.toGit(name, r)
+		if err != nil {
+			return errReader{err}
+		}
+
+		return r
+	}
+}
+
+// readStat returns the stat of the content read from r, and a reader of the
+// whole content. The content is read again from the start if r can seek,
+// and buffered otherwise.
+func readStat(r io.Reader) (convert.Stat, io.Reader, error) {
+	if rs, ok := r.(io.ReadSeeker); ok {
+		br := sync.GetBufioReader(rs)
+		defer sync.PutBufioReader(br)
+
+		stat, err := convert.GetStat(br)
+		if err != nil {
+			return stat, nil, err
+		}
+
+		_, err = rs.Seek(0, io.SeekStart)
+		return stat, rs, err
+	}
+
+	var buf bytes.Buffer
+	if _, err := buf.ReadFrom(r); err != nil {
+		return convert.Stat{}, nil, err
+	}
+
+	stat, err := convert.GetStat(bytes.NewReader(buf.Bytes()))
+	return stat, &buf, err
+}
+
+// fileStat returns the stat of the content of the given file.
+func fileStat(f *object.File) (_ convert.Stat, err error) {
+	rc, err := f.Reader()
+	if err != nil {
+		return convert.Stat{}, err
+	}
+
+	defer ioutil.CheckClose(rc, &err)
+
+	br := sync.GetBufioReader(rc)
+	defer sync.PutBufioReader(br)
+
+	return convert.GetStat(br)
+}
@@ -0,0 +1,173 @@
+package git
+
+import (
+	"testing"
+
+	"github.com/go-git/go-billy/v6/memfs"
+	"github.com/go-git/go-billy/v6/util"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/text/encoding/unicode"
+
+	"github.com/go-git/go-git/v6/plumbing/cache"
+	"github.com/go-git/go-git/v6/storage/filesystem"
+	"github.com/go-git/go-git/v6/storage/memory"
+)
+
+func TestWorktreeConvert(t *testing.T) {
+	t.Parallel()
+
+	utf16, err := unicode.UTF16(unicode.LittleEndian, unicode.IgnoreBOM).NewEncoder().String("é\r\nà\r\n")
+	require.NoError(t, err)
+
+	for _, tc := range []struct {
+		name       string
+		autoCRLF   string
+		eol        string
+		attributes string
+		// worktree is the content of the file in the worktree, before
+		// being added and after being checked out.
+		worktree string
+		// checkout, if not empty, is the content of the file in the worktree
+		// after being checked out.
+		checkout string
+		blob     string
+	}{
+		{name: "none", worktree: "a\r\nb\r\n", blob: "a\r\nb\r\n"},
+		{name: "autocrlf", autoCRLF: "true", worktree: "a\r\nb\r\n", blob: "a\nb\n"},
+		{name: "autocrlf input", autoCRLF: "input", worktree: "a\r\nb\r\n", checkout: "a\nb\n", blob: "a\nb\n"},
+		{name: "autocrlf binary", autoCRLF: "true", worktree: "a\r\n\x00\r\n", blob: "a\r\n\x00\r\n"},
+		{name: "autocrlf -text", autoCRLF: "true", attributes: "*.txt -text", worktree: "a\r\nb\r\n", blob: "a\r\nb\r\n"},
+		{name: "autocrlf binary macro", autoCRLF: "true", attributes: "*.txt binary", worktree: "a\r\nb\r\n", blob: "a\r\nb\r\n"},
+		{name: "text=auto", attributes: "*.txt text=auto", eol: "lf", worktree: "a\r\nb\r\n", checkout: "a\nb\n", blob: "a\nb\n"},
+		{name: "text=auto binary", attributes: "*.txt text=auto", worktree: "a\r\n\x00\r\n", blob: "a\r\n\x00\r\n"},
+		{name: "text=auto autocrlf", autoCRLF: "true", attributes: "*.txt text=auto", worktree: "a\r\nb\r\n", blob: "a\nb\n"},
+		{name: "text core.eol", eol: "crlf", attributes: "*.txt text", worktree: "a\nb\n", checkout: "a\r\nb\r\n", blob: "a\nb\n"},
+		{name: "text binary", eol: "lf", attributes: "*.txt text", worktree: "a\r\n\x00\r\n", checkout: "a\n\x00\n", blob: "a\n\x00\n"},
+		{name: "eol=crlf", autoCRLF: "input", attributes: "*.txt eol=crlf", worktree: "a\nb\r\n", checkout: "a\r\nb\r\n", blob: "a\nb\n"},
+		{name: "eol=lf", autoCRLF: "true", attributes: "*.txt eol=lf", worktree: "a\r\nb\n", checkout: "a\nb\n", blob: "a\nb\n"},
+		{name: "other file", autoCRLF: "true", attributes: "*.md eol=lf", worktree: "a\r\nb\r\n", blob: "a\nb\n"},
+		{name: "priority", attributes: "*.txt eol=crlf\na.txt -text", worktree: "a\nb\n", blob: "a\nb\n"},
+		{
+			name:       "working-tree-encoding",
+			attributes: "*.txt working-tree-encoding=UTF-16LE text eol=crlf",
+			worktree:   utf16,
+			blob:       "é\nà\n",
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			fs := memfs.New()
+			r, err := Init(memory.NewStorage(), WithWorkTree(fs))
+			require.NoError(t, err)
+
+			cfg, err := r.Config()
+			require.NoError(t, err)
+			cfg.Core.AutoCRLF = tc.autoCRLF
+			if tc.eol != "" {
+				cfg.Raw.Section("core").SetOption("eol", tc.eol)
+			}
+			require.NoError(t, r.SetConfig(cfg))
+
+			files := map[string]string{"a.txt": tc.worktree}
+			if tc.attributes != "" {
+				files[".gitattributes"] = tc.attributes + "\n"
+			}
+
+			commitFiles(t, r, fs, files)
+			assert.Equal(t, tc.blob, readBlob(t, r, "a.txt"))
+
+			w, err := r.Worktree()
+			require.NoError(t, err)
+			status, err := w.Status()
+			require.NoError(t, err)
+			assert.True(t, status.IsClean(), status)
+
+			require.NoError(t, fs.Remove("a.txt"))
+			require.NoError(t, w.Reset(&ResetOptions{Mode: HardReset}))
+
+			expected := tc.checkout
+			if expected == "" {
+				expected = tc.worktree
+			}
+
+			content, err := util.ReadFile(fs, "a.txt")
+			require.NoError(t, err)
+			assert.Equal(t, expected, string(content))
+		})
+	}
+}
+
+func TestWorktreeConvertUnknownEncoding(t *testing.T) {
+	t.Parallel()
+
+	fs := memfs.New()
+	r, err := Init(memory.NewStorage(), WithWorkTree(fs))
+	require.NoError(t, err)
+	require.NoError(t, util.WriteFile(fs, ".gitattributes", []byte("*.txt working-tree-encoding=FOO\n"), 0o644))
+	require.NoError(t, util.WriteFile(fs, "a.txt", []byte("a\n"), 0o644))
+
+	w, err := r.Worktree()
+	require.NoError(t, err)
+	_, err = w.Add("a.txt")
+	assert.ErrorContains(t, err, "working-tree-encoding FOO")
+}
+
+func TestWorktreeAttributes(t *testing.T) {
+	t.Parallel()
+
+	fs := memfs.New()
+	dot := memfs.New()
+	r, err := Init(filesystem.NewStorage(dot, cache.NewObjectLRUDefault()), WithWorkTree(fs))
+	require.NoError(t, err)
+
+	cfg, err := r.Config()
+	require.NoError(t, err)
+	cfg.Core.AutoCRLF = "true"
+	require.NoError(t, r.SetConfig(cfg))
+
+	require.NoError(t, util.WriteFile(fs, ".gitattributes", []byte("*.bin binary\n*.md linguist-documentation\n"), 0o644))
+	require.NoError(t, util.WriteFile(fs, "sub/.gitattributes", []byte("*.bin diff\n*.md !linguist-documentation\n"), 0o644))
+	require.NoError(t, util.WriteFile(dot, "info/attributes", []byte("*.bin merge=ours\n*.txt -text\n"), 0o644))
+
+	w, err := r.Worktree()
+	require.NoError(t, err)
+
+	attributes := func(name string) map[string]string {
+		attrs, err := w.Attributes(name)
+		require.NoError(t, err)
+
+		res := make(map[string]string, len(attrs))
+		for n, attr := range attrs {
+			res[n] = attr.String()
+		}
+
+		return res
+	}
+
+	assert.Equal(t, map[string]string{
+		"binary": "binary: set",
+		"diff":   "diff: unset",
+		"merge":  "merge: ours",
+		"text":   "text: unset",
+	}, attributes("a.bin"))
+
+	// The attributes set by the binary macro are overridden by
+	// sub/.gitattributes.
+	assert.Equal(t, map[string]string{
+		"binary": "binary: set",
+		"diff":   "diff: set",
+		"merge":  "merge: ours",
+		"text":   "text: unset",
+	}, attributes("sub/a.bin"))
+
+	assert.Equal(t, map[string]string{
+		"linguist-documentation": "linguist-documentation: set",
+	}, attributes("README.md"))
+	assert.Empty(t, attributes("sub/README.md"))
+
+	// .git/info/attributes is used to convert the files too.
+	commitFiles(t, r, fs, map[string]string{"a.txt": "a\r\nb\r\n"})
+	assert.Equal(t, "a\r\nb\r\n", readBlob(t, r, "a.txt"))
+}
@@ -0,0 +1,197 @@
+package git
+
+import (
+	"errors"
+
+	"github.com/go-git/go-git/v6/plumbing"
+	"github.com/go-git/go-git/v6/plumbing/filemode"
+	"github.com/go-git/go-git/v6/plumbing/format/index"
+	"github.com/go-git/go-git/v6/plumbing/object"
+	"github.com/go-git/go-git/v6/storage"
+	"github.com/go-git/go-git/v6/storage/memory"
+	"github.com/go-git/go-git/v6/storage/transactional"
+	"github.com/go-git/go-git/v6/utils/merkletrie"
+)
+
+// DiffStaged returns the changes staged for the next commit, from the tree of
+// HEAD, or the empty tree if HEAD has no commit, to the index, as
+// `git diff --cached` does. The conflicted paths and the intent-to-add
+// entries of the index are left out.
+func (w *Worktree) DiffStaged() (object.Changes, error) {
+	var from *object.Tree
+	head, err := w.r.Head()
+	switch {
+	case errors.Is(err, plumbing.ErrReferenceNotFound):
+	case err != nil:
+		return nil, err
+	default:
+		if from, err = w.r.getTreeFromCommitHash(head.Hash()); err != nil {
+			return nil, err
+		}
+	}
+
+	idx, err := w.r.Storer.Index()
+	if err != nil {
+		return nil, err
+	}
+
+	s := newDiffStorage(w.r.Storer)
+	to, err := buildIndexTree(s, mergedEntries(idx))
+	if err != nil {
+		return nil, err
+	}
+
+	return object.DiffTree(from, to)
+}
+
+// DiffWorktree returns the changes not staged, from the index to the files
+// of the worktree, as `git diff` does. As Status, the files whose stat data
+// did not change since they were staged are not hashed, and the untracked
+// files, ignored or not, are not changes. The conflicted paths and the
+// intent-to-add entries of the index are left out.
+//
+// The blobs of the modified files are not written in the storer of the
+// repository, but kept in memory along with the changes.
+func (w *Worktree) DiffWorktree() (object.Changes, error) {
+	idx, err := w.r.Storer.Index()
+	if err != nil {
+		return nil, err
+	}
+
+	changes, err := w.diffIndexWithWorktree(idx, w.Filesystem, false, true, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	cfg, err := w.r.Config()
+	if err != nil {
+		return nil, err
+	}
+
+	regularSymlinks := cfg.Raw.Section("core").Option("symlinks") == "false"
+
+	entries := mergedEntries(idx)
+	positions := make(map[string]int, len(entries))
+	for i, e := range entries {
+		positions[e.Name] = i
+	}
+
+	s := newDiffStorage(w.r.Storer)
+	from, err := buildIndexTree(s, entries)
+	if err != nil {
+		return nil, err
+	}
+
+	files := append([]*index.Entry(nil), entries...)
+	for _, ch := range changes {
+		i, ok := positions[nameFromAction(&ch)]
+		if !ok {
+			// An untracked file.
+			continue
+		}
+
+		action, err := ch.Action()
+		if err != nil {
+			return nil, err
+		}
+
+		if action == merkletrie.Delete {
+			files[i] = nil
+			continue
+		}
+
+		e := *entries[i]
+		if err := w.hashWorktreeEntry(s, &e, cfg.Core.FileMode, regularSymlinks); err != nil {
+			return nil, err
+		}
+
+		files[i] = &e
+	}
+
+	to, err := buildIndexTree(s, files)
+	if err != nil {
+		return nil, err
+	}
+
+	return object.DiffTree(from, to)
+}
+
+// hashWorktreeEntry sets the hash and the mode of the entry to the ones of
+// its file in the worktree, its blob being written to s. The executable bit
+// is only taken from the file if fileMode is set, and the symlinks are
+// regular files in the worktree if regularSymlinks is set, as core.fileMode
+// and core.symlinks say.
+func (w *Worktree) hashWorktreeEntry(s storage.Storer, e *index.Entry, fileMode, regularSymlinks bool) error {
+	if e.Mode == filemode.Submodule {
+		if h, ok := nestedRepositoryHead(w.Filesystem, e.Name); ok {
+			e.Hash = h
+		}
+
+		return nil
+	}
+
+	fi, err := w.Filesystem.Lstat(e.Name)
+	if err != nil {
+		return err
+	}
+
+	if e.Hash, err = w.copyFileToStorage(s, e.Name); err != nil {
+		return err
+	}
+
+	mode, err := filemode.NewFromOSFileMode(fi.Mode())
+	if err != nil {
+		return err
+	}
+
+	isRegular := func(m filemode.FileMode) bool {
+		return m.IsRegular() || m == filemode.Executable
+	}
+
+	switch {
+	case isRegular(mode) && e.Mode == filemode.Symlink && regularSymlinks:
+	case isRegular(mode) && isRegular(e.Mode) && !fileMode:
+	default:
+		e.Mode = mode
+	}
+
+	return nil
+}
+
+// newDiffStorage returns a storage reading the objects of s, and keeping the
+// objects written in memory.
+func newDiffStorage(s storage.Storer) storage.Storer {
+	return transactional.NewStorage(s, memory.NewStorage())
+}
+
+// mergedEntries returns the entries of the index which are not conflicted nor
+// intent-to-add.
+func mergedEntries(idx *index.Index) []*index.Entry {
+	entries := make([]*index.Entry, 0, len(idx.Entries))
+	for _, e := range idx.Entries {
+		if e.Stage == index.Merged && !e.IntentToAdd {
+			entries = append(entries, e)
+		}
+	}
+
+	return entries
+}
+
+// buildIndexTree writes the trees of the given entries to s, the nil ones
+// being skipped, and returns the root one.
+func buildIndexTree(s storage.Storer, entries []*index.Entry) (*object.Tree, error) {
+	idx := &index.Index{}
+	for _, e := range entries {
+		if e != nil {
+			idx.Entries = append(idx.Entries, e)
+		}
+	}
+
+	h := &buildTreeHelper{s: s}
+	hash, err := h.BuildTree(idx, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	return object.GetTree(s, hash)
+}
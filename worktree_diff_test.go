@@ -0,0 +1,127 @@
+package git
+
+import (
+	"testing"
+
+	"github.com/go-git/go-billy/v6/memfs"
+	"github.com/go-git/go-billy/v6/util"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/go-git/go-git/v6/plumbing"
+	"github.com/go-git/go-git/v6/plumbing/object"
+	"github.com/go-git/go-git/v6/storage/memory"
+)
+
+// changeActions returns the action and the path of the changes, such as
+// "Modify a".
+func changeActions(t *testing.T, changes object.Changes) []string {
+	t.Helper()
+
+	var actions []string
+	for _, ch := range changes {
+		action, err := ch.Action()
+		require.NoError(t, err)
+
+		name := ch.To.Name
+		if name == "" {
+			name = ch.From.Name
+		}
+
+		actions = append(actions, action.String()+" "+name)
+	}
+
+	return actions
+}
+
+func TestWorktreeDiff(t *testing.T) {
+	t.Parallel()
+
+	fs := memfs.New()
+	r, err := Init(memory.NewStorage(), WithWorkTree(fs))
+	require.NoError(t, err)
+	w, err := r.Worktree()
+	require.NoError(t, err)
+
+	// Without commit, the index is diffed with the empty tree.
+	require.NoError(t, util.WriteFile(fs, "a", []byte("a\n"), 0o644))
+	_, err = w.Add("a")
+	require.NoError(t, err)
+	changes, err := w.DiffStaged()
+	require.NoError(t, err)
+	assert.Equal(t, []string{"Insert a"}, changeActions(t, changes))
+
+	for name, content := range map[string]string{"b": "b\n", "dir/c": "c\n", ".gitignore": "*.log\n"} {
+		require.NoError(t, util.WriteFile(fs, name, []byte(content), 0o644))
+		_, err = w.Add(name)
+		require.NoError(t, err)
+	}
+
+	_, err = w.Commit("foo\n", &CommitOptions{Author: defaultSignature()})
+	require.NoError(t, err)
+
+	changes, err = w.DiffStaged()
+	require.NoError(t, err)
+	assert.Empty(t, changes)
+	changes, err = w.DiffWorktree()
+	require.NoError(t, err)
+	assert.Empty(t, changes)
+
+	require.NoError(t, util.WriteFile(fs, "a", []byte("staged\n"), 0o644))
+	_, err = w.Add("a")
+	require.NoError(t, err)
+	require.NoError(t, util.WriteFile(fs, "a", []byte("not staged\n"), 0o644))
+	require.NoError(t, util.WriteFile(fs, "dir/c", []byte("modified\n"), 0o644))
+	require.NoError(t, fs.Remove("b"))
+	require.NoError(t, util.WriteFile(fs, "untracked", []byte("untracked\n"), 0o644))
+	require.NoError(t, util.WriteFile(fs, "debug.log", []byte("ignored\n"), 0o644))
+
+	changes, err = w.DiffStaged()
+	require.NoError(t, err)
+	assert.Equal(t, []string{"Modify a"}, changeActions(t, changes))
+
+	changes, err = w.DiffWorktree()
+	require.NoError(t, err)
+	assert.Equal(t, []string{"Modify a", "Delete b", "Modify dir/c"}, changeActions(t, changes))
+
+	// The content of the worktree side is available, without being written
+	// in the storer of the repository.
+	_, to, err := changes[0].Files()
+	require.NoError(t, err)
+	content, err := to.Contents()
+	require.NoError(t, err)
+	assert.Equal(t, "not staged\n", content)
+	_, err = r.BlobObject(to.Hash)
+	assert.ErrorIs(t, err, plumbing.ErrObjectNotFound)
+
+	patch, err := changes.Patch()
+	require.NoError(t, err)
+	assert.Contains(t, patch.String(), "+modified")
+}
+
+func TestRepositoryDiffTree(t *testing.T) {
+	t.Parallel()
+
+	r, _ := newRebaseRepository(t, memory.NewStorage(), "b")
+
+	master := mustReference(t, r, plumbing.Master)
+	feature := mustReference(t, r, "refs/heads/feature")
+	changes, err := r.DiffTree(master, feature)
+	require.NoError(t, err)
+	assert.NotEmpty(t, changes)
+
+	c, err := r.CommitObject(feature)
+	require.NoError(t, err)
+	treeChanges, err := r.DiffTree(master, c.TreeHash)
+	require.NoError(t, err)
+	assert.Equal(t, changeActions(t, changes), changeActions(t, treeChanges))
+
+	changes, err = r.DiffTree(plumbing.ZeroHash, c.TreeHash)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"Insert a", "Insert b", "Insert c"}, changeActions(t, changes))
+
+	blob, err := c.File("a")
+	require.NoError(t, err)
+	_, err = r.DiffTree(blob.Hash, c.TreeHash)
+	assert.ErrorIs(t, err, plumbing.ErrInvalidType)
+}
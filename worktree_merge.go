@@ -0,0 +1,464 @@
+package git
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/go-git/go-billy/v6/util"
+
+	"github.com/go-git/go-git/v6/plumbing"
+	"github.com/go-git/go-git/v6/plumbing/filemode"
+	"github.com/go-git/go-git/v6/plumbing/format/index"
+	"github.com/go-git/go-git/v6/plumbing/object"
+	"github.com/go-git/go-git/v6/utils/merge"
+)
+
+// MergeHead is the reference to the commit being merged, while the merge is
+// stopped on conflicts.
+const MergeHead plumbing.ReferenceName = "MERGE_HEAD"
+
+var (
+	// ErrMergeInProgress is returned by Worktree.Merge when a merge is
+	// already in progress.
+	ErrMergeInProgress = errors.New("a merge is already in progress")
+	// ErrNoMergeInProgress is returned by Worktree.MergeAbort when there is
+	// no merge to abort.
+	ErrNoMergeInProgress = errors.New("no merge in progress")
+	// ErrMergeConflict is returned when the changes of the commit being
+	// merged conflict with the current ones. Once they are resolved and the
+	// files added to the index, the merge is concluded by Worktree.Commit.
+	ErrMergeConflict = errors.New("conflicts merging commit")
+	// ErrUnrelatedHistories is returned by Worktree.Merge when the commit
+	// being merged has no common ancestor with the current branch.
+	ErrUnrelatedHistories = errors.New("refusing to merge unrelated histories")
+)
+
+// Merge merges the given commit into the current branch, as `git merge`
+// does, and returns the hash of the resulting commit, the merged one if the
+// branch is fast-forwarded. NoErrAlreadyUpToDate is returned if the commit
+// is already merged.
+//
+// Unless the branch is fast-forwarded, the changes made since the merge base
+// of the commits are merged into the index and the working tree, which must
+// be clean, with a three-way merge, and committed with both commits as
+// parents. If there are several merge bases, as with criss-cross merges, the
+// first one is used.
+//
+// If the changes conflict with the current ones, the merge stops and returns
+// ErrMergeConflict, leaving the conflicting files unmerged in the index and
+// MERGE_HEAD pointing to the commit: Commit creates the merge commit once the
+// conflicts are resolved, and MergeAbort cancels the merge. With
+// MergeOptions.Squash, the changes are merged without being committed, and
+// the zero hash is returned.
+func (w *Worktree) Merge(theirs plumbing.Hash, opts *MergeOptions) (plumbing.Hash, error) {
+	if opts == nil {
+		opts = &MergeOptions{}
+	}
+
+	if err := opts.Validate(); err != nil {
+		return plumbing.ZeroHash, err
+	}
+
+	if _, err := w.r.Storer.Reference(MergeHead); err == nil {
+		return plumbing.ZeroHash, ErrMergeInProgress
+	} else if !errors.Is(err, plumbing.ErrReferenceNotFound) {
+		return plumbing.ZeroHash, err
+	}
+
+	c, err := w.r.CommitObject(theirs)
+	if err != nil {
+		return plumbing.ZeroHash, err
+	}
+
+	status, err := w.Status()
+	if err != nil {
+		return plumbing.ZeroHash, err
+	}
+
+	if hasLocalChanges(status, false) {
+		return plumbing.ZeroHash, ErrWorktreeNotClean
+	}
+
+	head, err := w.r.Head()
+	if errors.Is(err, plumbing.ErrReferenceNotFound) {
+		// As git, a branch without commit is only fast-forwarded.
+		if opts.Squash || opts.FastForward == FastForwardNever {
+			return plumbing.ZeroHash, ErrFastForwardMergeNotPossible
+		}
+
+		return c.Hash, w.fastForward(c.Hash)
+	}
+
+	if err != nil {
+		return plumbing.ZeroHash, err
+	}
+
+	bases, err := w.r.MergeBase(head.Hash(), c.Hash)
+	if err != nil {
+		return plumbing.ZeroHash, err
+	}
+
+	if len(bases) == 0 {
+		return plumbing.ZeroHash, ErrUnrelatedHistories
+	}
+
+	base := bases[0]
+	switch {
+	case base.Hash == c.Hash:
+		return head.Hash(), NoErrAlreadyUpToDate
+	case base.Hash == head.Hash() && !opts.Squash && opts.FastForward != FastForwardNever:
+		return c.Hash, w.fastForward(c.Hash)
+	case opts.FastForward == FastForwardOnly:
+		return plumbing.ZeroHash, ErrFastForwardMergeNotPossible
+	}
+
+	// The author is known before the merge.
+	commitOpts := &CommitOptions{
+		Author:    opts.Author,
+		Committer: opts.Committer,
+		Parents:   []plumbing.Hash{head.Hash(), c.Hash},
+	}
+
+	if !opts.Squash {
+		if err := commitOpts.Validate(w.r); err != nil {
+			return plumbing.ZeroHash, err
+		}
+	}
+
+	conflicts, err := w.mergeCommit(base, c)
+	if err != nil {
+		return plumbing.ZeroHash, err
+	}
+
+	if len(conflicts) > 0 {
+		if !opts.Squash {
+			if err := w.r.Storer.SetReference(plumbing.NewHashReference(MergeHead, c.Hash)); err != nil {
+				return plumbing.ZeroHash, err
+			}
+		}
+
+		return plumbing.ZeroHash, fmt.Errorf("%w %s: %s", ErrMergeConflict, c.Hash, strings.Join(conflicts, ", "))
+	}
+
+	if opts.Squash {
+		return plumbing.ZeroHash, nil
+	}
+
+	msg := opts.Message
+	if msg == "" {
+		msg = fmt.Sprintf("Merge commit '%s'\n", c.Hash)
+	}
+
+	return w.Commit(msg, commitOpts)
+}
+
+// MergeAbort cancels the merge in progress, restoring the index and the
+// working tree to HEAD.
+func (w *Worktree) MergeAbort() error {
+	if _, err := w.r.Storer.Reference(MergeHead); errors.Is(err, plumbing.ErrReferenceNotFound) {
+		return ErrNoMergeInProgress
+	} else if err != nil {
+		return err
+	}
+
+	if err := w.Reset(&ResetOptions{Mode: HardReset}); err != nil {
+		return err
+	}
+
+	return w.r.Storer.RemoveReference(MergeHead)
+}
+
+// fastForward moves the current branch to the given commit, updating the
+// index and the working tree.
+func (w *Worktree) fastForward(commit plumbing.Hash) error {
+	if err := w.updateHEAD(commit, nil, fmt.Sprintf("merge %s: Fast-forward", commit)); err != nil {
+		return err
+	}
+
+	return w.reset(context.Background(), &ResetOptions{
+		Mode:   MergeReset,
+		Commit: commit,
+	}, false, nil)
+}
+
+// mergeCommit merges the changes made from the merge base to the given
+// commit into the index and the working tree. The names of the conflicting
+// files are returned.
+func (w *Worktree) mergeCommit(base, c *object.Commit) ([]string, error) {
+	baseTree, err := base.Tree()
+	if err != nil {
+		return nil, err
+	}
+
+	tree, err := c.Tree()
+	if err != nil {
+		return nil, err
+	}
+
+	changes, err := object.DiffTree(baseTree, tree)
+	if err != nil {
+		return nil, err
+	}
+
+	return w.mergeChanges(changes, tree, &changesMerge{
+		ours:   "HEAD",
+		theirs: c.Hash.String(),
+		stage:  true,
+	})
+}
+
+// changesMerge describes how the changes made to a tree are merged into the
+// index and the working tree.
+type changesMerge struct {
+	// ours and theirs are the labels of the conflict markers, for the
+	// current version of a file and for the changed one.
+	ours, theirs string
+	// stage, if true, stages the changes merged cleanly. Otherwise, only the
+	// added files are staged.
+	stage bool
+	// conv converts the files checked out, set by mergeChanges from the
+	// .gitattributes files of the tree.
+	conv *converter
+}
+
+// mergeChanges does a three-way merge of the given changes, made from a base
+// tree to the given tree, with the current state of the files, which must
+// be the same in the index and in the working tree.
+//
+// The changes to the files that have not changed since the base are
+// applied. The files changed both since the base and by the changes are
+// merged line by line, with merge.File. If that results in conflicts, the
+// file is left unmerged: the index holds one entry for each of the stages of
+// the merge, and the working tree holds the conflicting lines delimited by
+// conflict markers. The names of these files are returned.
+func (w *Worktree) mergeChanges(changes object.Changes, tree *object.Tree, m *changesMerge) ([]string, error) {
+	idx, err := w.r.Storer.Index()
+	if err != nil {
+		return nil, err
+	}
+
+	b := newIndexBuilder(idx)
+	if m.conv, err = w.r.newTreeConverter(tree); err != nil {
+		return nil, err
+	}
+
+	var names []string
+	var conflicts []*index.Entry
+	for _, ch := range changes {
+		entries, err := w.mergeChange(ch, tree, b, m)
+		if err != nil {
+			return nil, err
+		}
+
+		if len(entries) > 0 {
+			names = append(names, changeName(ch))
+			conflicts = append(conflicts, entries...)
+		}
+	}
+
+	b.Write(idx)
+	idx.Entries = append(idx.Entries, conflicts...)
+	return names, w.r.Storer.SetIndex(idx)
+}
+
+func changeName(ch *object.Change) string {
+	if ch.To.Name != "" {
+		return ch.To.Name
+	}
+
+	return ch.From.Name
+}
+
+// mergeChange merges a single change, and returns the index entries of the
+// stages of the merge if it results in a conflict.
+func (w *Worktree) mergeChange(ch *object.Change, tree *object.Tree, b *indexBuilder, m *changesMerge) ([]*index.Entry, error) {
+	name := changeName(ch)
+	ours := b.entries[name]
+
+	var base, theirs *index.Entry
+	if ch.From.Name != "" {
+		base = &index.Entry{Name: name, Hash: ch.From.TreeEntry.Hash, Mode: ch.From.TreeEntry.Mode}
+	}
+
+	if ch.To.Name != "" {
+		theirs = &index.Entry{Name: name, Hash: ch.To.TreeEntry.Hash, Mode: ch.To.TreeEntry.Mode}
+	}
+
+	switch {
+	case sameEntry(ours, theirs):
+		return nil, nil
+	case sameEntry(ours, base):
+		if theirs == nil {
+			if m.stage {
+				b.Remove(name)
+			}
+
+			return nil, rmFileAndDirsIfEmpty(w.Filesystem, name)
+		}
+
+		f, err := tree.File(name)
+		if err != nil {
+			return nil, err
+		}
+
+		if err := w.checkoutFile(f, m.conv); err != nil {
+			return nil, err
+		}
+
+		if ours == nil || m.stage {
+			return nil, w.addIndexFromCheckout(name, theirs.Hash, f.Mode, b, m.conv)
+		}
+
+		return nil, nil
+	}
+
+	merged, err := w.writeMerge(base, ours, theirs, m)
+	if err != nil {
+		return nil, err
+	}
+
+	if !merged.IsZero() {
+		if m.stage {
+			return nil, w.addIndexFromFile(name, merged, b)
+		}
+
+		return nil, nil
+	}
+
+	b.Remove(name)
+	var entries []*index.Entry
+	for i, e := range []*index.Entry{base, ours, theirs} {
+		if e == nil {
+			continue
+		}
+
+		entries = append(entries, &index.Entry{
+			Name:  name,
+			Hash:  e.Hash,
+			Mode:  e.Mode,
+			Stage: index.AncestorMode + index.Stage(i),
+		})
+	}
+
+	return entries, nil
+}
+
+func sameEntry(a, b *index.Entry) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+
+	return a.Hash == b.Hash && a.Mode == b.Mode
+}
+
+// writeMerge writes to the working tree the result of merging the versions
+// of a file changed on both sides, and returns, if it has been merged
+// cleanly, the hash of the merged content. The changes to text files are
+// merged line by line, leaving the conflicting ones delimited by conflict
+// markers. Otherwise, the version of ours is kept, or the one of theirs if
+// ours has been deleted.
+func (w *Worktree) writeMerge(base, ours, theirs *index.Entry, m *changesMerge) (plumbing.Hash, error) {
+	if ours == nil {
+		f, err := w.r.BlobObject(theirs.Hash)
+		if err != nil {
+			return plumbing.ZeroHash, err
+		}
+
+		return plumbing.ZeroHash, w.checkoutFile(&object.File{Name: theirs.Name, Mode: theirs.Mode, Blob: *f}, m.conv)
+	}
+
+	if theirs == nil || !ours.Mode.IsFile() || !theirs.Mode.IsFile() ||
+		ours.Mode == filemode.Symlink || theirs.Mode == filemode.Symlink {
+		return plumbing.ZeroHash, nil
+	}
+
+	var contents [3][]byte
+	for i, e := range []*index.Entry{base, ours, theirs} {
+		if e == nil {
+			continue
+		}
+
+		var err error
+		if contents[i], err = w.r.blobContent(e.Hash); err != nil {
+			return plumbing.ZeroHash, err
+		}
+	}
+
+	content, conflicts, err := merge.File(contents[0], contents[1], contents[2], &merge.MergeFileOptions{
+		OursLabel:   m.ours,
+		TheirsLabel: m.theirs,
+	})
+	if errors.Is(err, merge.ErrBinary) {
+		return plumbing.ZeroHash, nil
+	}
+
+	if err != nil {
+		return plumbing.ZeroHash, err
+	}
+
+	mode := ours.Mode
+	if base != nil && ours.Mode == base.Mode {
+		mode = theirs.Mode
+	}
+
+	perm, err := mode.ToOSFileMode()
+	if err != nil {
+		return plumbing.ZeroHash, err
+	}
+
+	if err := util.WriteFile(w.Filesystem, ours.Name, content, perm.Perm()); err != nil {
+		return plumbing.ZeroHash, err
+	}
+
+	if conflicts > 0 {
+		return plumbing.ZeroHash, nil
+	}
+
+	// The merged content is stored, so that it can be staged.
+	return w.r.storeBlob(content)
+}
+
+func (r *Repository) storeBlob(content []byte) (plumbing.Hash, error) {
+	obj := r.Storer.NewEncodedObject()
+	obj.SetType(plumbing.BlobObject)
+	obj.SetSize(int64(len(content)))
+
+	writer, err := obj.Writer()
+	if err != nil {
+		return plumbing.ZeroHash, err
+	}
+
+	if _, err := writer.Write(content); err != nil {
+		writer.Close()
+		return plumbing.ZeroHash, err
+	}
+
+	if err := writer.Close(); err != nil {
+		return plumbing.ZeroHash, err
+	}
+
+	return r.Storer.SetEncodedObject(obj)
+}
+
+func (r *Repository) blobContent(h plumbing.Hash) ([]byte, error) {
+	blob, err := r.BlobObject(h)
+	if err != nil {
+		return nil, err
+	}
+
+	reader, err := blob.Reader()
+	if err != nil {
+		return nil, err
+	}
+	defer reader.Close()
+
+	var buf bytes.Buffer
+	if _, err := buf.ReadFrom(reader); err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,232 @@
+package git
+
+import (
+	"testing"
+
+	"github.com/go-git/go-billy/v6/util"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/go-git/go-git/v6/plumbing"
+	"github.com/go-git/go-git/v6/plumbing/format/index"
+	"github.com/go-git/go-git/v6/storage/memory"
+)
+
+func TestWorktreeMerge(t *testing.T) {
+	t.Parallel()
+
+	r, fs := newRebaseRepository(t, memory.NewStorage(), "b")
+	w, err := r.Worktree()
+	require.NoError(t, err)
+	require.NoError(t, w.Checkout(&CheckoutOptions{Branch: plumbing.Master}))
+
+	master := mustReference(t, r, plumbing.Master)
+	feature := mustReference(t, r, "refs/heads/feature")
+	h, err := w.Merge(feature, &MergeOptions{Author: defaultSignature()})
+	require.NoError(t, err)
+	assert.Equal(t, h, mustReference(t, r, plumbing.Master))
+
+	merge, err := r.CommitObject(h)
+	require.NoError(t, err)
+	assert.Equal(t, []plumbing.Hash{master, feature}, merge.ParentHashes)
+	assert.Equal(t, "Merge commit '"+feature.String()+"'\n", merge.Message)
+
+	for name, content := range map[string]string{"a": "feature\n", "b": "master\n", "c": "c\n"} {
+		data, err := util.ReadFile(fs, name)
+		require.NoError(t, err)
+		assert.Equal(t, content, string(data), name)
+	}
+
+	status, err := w.Status()
+	require.NoError(t, err)
+	assert.True(t, status.IsClean(), status)
+
+	_, err = w.Merge(feature, nil)
+	assert.ErrorIs(t, err, NoErrAlreadyUpToDate)
+}
+
+func TestWorktreeMergeFastForward(t *testing.T) {
+	t.Parallel()
+
+	r, fs := newRebaseRepository(t, memory.NewStorage(), "b")
+	w, err := r.Worktree()
+	require.NoError(t, err)
+
+	feature := mustReference(t, r, "refs/heads/feature")
+	c, err := r.CommitObject(feature)
+	require.NoError(t, err)
+	first, err := c.Parent(0)
+	require.NoError(t, err)
+	base, err := first.Parent(0)
+	require.NoError(t, err)
+
+	require.NoError(t, w.Checkout(&CheckoutOptions{Branch: "refs/heads/old", Create: true, Hash: base.Hash}))
+	_, err = w.Merge(mustReference(t, r, plumbing.Master), &MergeOptions{FastForward: FastForwardOnly})
+	require.NoError(t, err)
+
+	// master and feature have diverged.
+	_, err = w.Merge(feature, &MergeOptions{FastForward: FastForwardOnly})
+	assert.ErrorIs(t, err, ErrFastForwardMergeNotPossible)
+
+	require.NoError(t, w.Checkout(&CheckoutOptions{Branch: "refs/heads/ff", Create: true, Hash: base.Hash}))
+	h, err := w.Merge(first.Hash, nil)
+	require.NoError(t, err)
+	assert.Equal(t, first.Hash, h)
+	assert.Equal(t, first.Hash, mustReference(t, r, "refs/heads/ff"))
+	data, err := util.ReadFile(fs, "a")
+	require.NoError(t, err)
+	assert.Equal(t, "feature\n", string(data))
+
+	require.NoError(t, w.Checkout(&CheckoutOptions{Branch: "refs/heads/noff", Create: true, Hash: base.Hash}))
+	h, err = w.Merge(first.Hash, &MergeOptions{FastForward: FastForwardNever, Author: defaultSignature()})
+	require.NoError(t, err)
+	merge, err := r.CommitObject(h)
+	require.NoError(t, err)
+	assert.Equal(t, []plumbing.Hash{base.Hash, first.Hash}, merge.ParentHashes)
+	assert.Equal(t, first.TreeHash, merge.TreeHash)
+
+	_, err = w.Merge(first.Hash, &MergeOptions{FastForward: FastForwardNever, Squash: true})
+	assert.Error(t, err)
+
+	// A branch without commit is fast-forwarded.
+	require.NoError(t, w.Checkout(&CheckoutOptions{Branch: "refs/heads/orphan", Create: true, Orphan: true}))
+	_, err = w.Merge(first.Hash, &MergeOptions{FastForward: FastForwardNever})
+	assert.ErrorIs(t, err, ErrFastForwardMergeNotPossible)
+	h, err = w.Merge(first.Hash, nil)
+	require.NoError(t, err)
+	assert.Equal(t, first.Hash, mustReference(t, r, "refs/heads/orphan"))
+	status, err := w.Status()
+	require.NoError(t, err)
+	assert.True(t, status.IsClean(), status)
+}
+
+func TestWorktreeMergeConflict(t *testing.T) {
+	t.Parallel()
+
+	r, fs := newRebaseRepository(t, memory.NewStorage(), "a")
+	w, err := r.Worktree()
+	require.NoError(t, err)
+	require.NoError(t, w.Checkout(&CheckoutOptions{Branch: plumbing.Master}))
+
+	master := mustReference(t, r, plumbing.Master)
+	feature := mustReference(t, r, "refs/heads/feature")
+	_, err = w.Merge(feature, &MergeOptions{Author: defaultSignature()})
+	assert.ErrorIs(t, err, ErrMergeConflict)
+	assert.Equal(t, feature, mustReference(t, r, MergeHead))
+	assert.Equal(t, master, mustReference(t, r, plumbing.Master))
+
+	_, err = w.Merge(feature, nil)
+	assert.ErrorIs(t, err, ErrMergeInProgress)
+
+	idx, err := r.Storer.Index()
+	require.NoError(t, err)
+	assert.Equal(t, []string{"a"}, unmergedPaths(idx.Entries))
+	for _, e := range idx.Entries {
+		if e.Name == "a" {
+			assert.NotEqual(t, index.Merged, e.Stage)
+		}
+	}
+
+	data, err := util.ReadFile(fs, "a")
+	require.NoError(t, err)
+	assert.Equal(t, "<<<<<<< HEAD\nmaster\n=======\nfeature\n>>>>>>> "+feature.String()+"\n", string(data))
+
+	// The new files merged cleanly are staged.
+	data, err = util.ReadFile(fs, "c")
+	require.NoError(t, err)
+	assert.Equal(t, "c\n", string(data))
+
+	// The commit concluding the merge is the merge commit.
+	require.NoError(t, util.WriteFile(fs, "a", []byte("merged\n"), 0o644))
+	_, err = w.Add("a")
+	require.NoError(t, err)
+	h, err := w.Commit("merge\n", &CommitOptions{Author: defaultSignature()})
+	require.NoError(t, err)
+
+	merge, err := r.CommitObject(h)
+	require.NoError(t, err)
+	assert.Equal(t, []plumbing.Hash{master, feature}, merge.ParentHashes)
+	_, err = r.Storer.Reference(MergeHead)
+	assert.ErrorIs(t, err, plumbing.ErrReferenceNotFound)
+
+	f, err := merge.File("c")
+	require.NoError(t, err)
+	content, err := f.Contents()
+	require.NoError(t, err)
+	assert.Equal(t, "c\n", content)
+}
+
+func TestWorktreeMergeAbort(t *testing.T) {
+	t.Parallel()
+
+	r, fs := newRebaseRepository(t, memory.NewStorage(), "a")
+	w, err := r.Worktree()
+	require.NoError(t, err)
+	require.NoError(t, w.Checkout(&CheckoutOptions{Branch: plumbing.Master}))
+
+	assert.ErrorIs(t, w.MergeAbort(), ErrNoMergeInProgress)
+
+	_, err = w.Merge(mustReference(t, r, "refs/heads/feature"), &MergeOptions{Author: defaultSignature()})
+	require.ErrorIs(t, err, ErrMergeConflict)
+	require.NoError(t, w.MergeAbort())
+
+	_, err = r.Storer.Reference(MergeHead)
+	assert.ErrorIs(t, err, plumbing.ErrReferenceNotFound)
+	data, err := util.ReadFile(fs, "a")
+	require.NoError(t, err)
+	assert.Equal(t, "master\n", string(data))
+	assert.False(t, fileExists(fs, "c"))
+
+	status, err := w.Status()
+	require.NoError(t, err)
+	assert.True(t, status.IsClean(), status)
+}
+
+func TestWorktreeMergeSquash(t *testing.T) {
+	t.Parallel()
+
+	r, fs := newRebaseRepository(t, memory.NewStorage(), "b")
+	w, err := r.Worktree()
+	require.NoError(t, err)
+	require.NoError(t, w.Checkout(&CheckoutOptions{Branch: plumbing.Master}))
+
+	master := mustReference(t, r, plumbing.Master)
+	h, err := w.Merge(mustReference(t, r, "refs/heads/feature"), &MergeOptions{Squash: true})
+	require.NoError(t, err)
+	assert.True(t, h.IsZero())
+	assert.Equal(t, master, mustReference(t, r, plumbing.Master))
+
+	data, err := util.ReadFile(fs, "a")
+	require.NoError(t, err)
+	assert.Equal(t, "feature\n", string(data))
+
+	status, err := w.Status()
+	require.NoError(t, err)
+	assert.Equal(t, Modified, status.File("a").Staging)
+	assert.Equal(t, Added, status.File("c").Staging)
+
+	h, err = w.Commit("squashed\n", &CommitOptions{Author: defaultSignature()})
+	require.NoError(t, err)
+	squashed, err := r.CommitObject(h)
+	require.NoError(t, err)
+	assert.Equal(t, []plumbing.Hash{master}, squashed.ParentHashes)
+}
+
+func TestWorktreeMergeUnrelatedHistories(t *testing.T) {
+	t.Parallel()
+
+	r, _ := newRebaseRepository(t, memory.NewStorage(), "b")
+	w, err := r.Worktree()
+	require.NoError(t, err)
+
+	tree, err := NewTreeBuilder(r.Storer, nil).Write()
+	require.NoError(t, err)
+	cb := NewCommitBuilder(r.Storer)
+	cb.Tree = tree
+	cb.Author = defaultSignature()
+	root, err := cb.Write()
+	require.NoError(t, err)
+
+	_, err = w.Merge(root, nil)
+	assert.ErrorIs(t, err, ErrUnrelatedHistories)
+}
@@ -0,0 +1,237 @@
+package git
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"strings"
+
+	"golang.org/x/text/unicode/norm"
+
+	formatcfg "github.com/go-git/go-git/v6/plumbing/format/config"
+	"github.com/go-git/go-git/v6/plumbing/format/index"
+	"github.com/go-git/go-git/v6/plumbing/protocol/packp/sideband"
+	"github.com/go-git/go-git/v6/plumbing/storer"
+)
+
+// checkoutGuard validates the paths of the files written to the worktree by
+// a checkout.
+type checkoutGuard struct {
+	w *Worktree
+	// gitDir is the path of the git directory in the worktree, if it is in
+	// it under another name than .git.
+	gitDir string
+	// dirs are the leading directories known not to be symbolic links.
+	dirs map[string]struct{}
+}
+
+func (w *Worktree) newCheckoutGuard() *checkoutGuard {
+	g := &checkoutGuard{w: w, dirs: make(map[string]struct{})}
+
+	fss, ok := w.r.Storer.(storer.FilesystemStorer)
+	if !ok {
+		return g
+	}
+
+	rel, err := filepath.Rel(w.Filesystem.Root(), fss.Filesystem().Root())
+	if err != nil {
+		return g
+	}
+
+	rel = filepath.ToSlash(rel)
+	if rel != "." && rel != GitDirName && rel != ".." && !strings.HasPrefix(rel, "../") {
+		g.gitDir = rel
+	}
+
+	return g
+}
+
+// validPath returns an error if the file can't be written to the worktree,
+// its path being invalid, or in the git directory.
+func (g *checkoutGuard) validPath(name string) error {
+	if err := validPath(name); err != nil {
+		return err
+	}
+
+	if g.inGitDir(name) {
+		return &InvalidPathError{Path: name, Err: ErrPathInGitDir}
+	}
+
+	return nil
+}
+
+// inGitDir returns whether the file is in the git directory, if it is in the
+// worktree under another name than .git.
+func (g *checkoutGuard) inGitDir(name string) bool {
+	if g.gitDir == "" {
+		return false
+	}
+
+	return strings.EqualFold(name, g.gitDir) ||
+		len(name) > len(g.gitDir) && name[len(g.gitDir)] == '/' && strings.EqualFold(name[:len(g.gitDir)], g.gitDir)
+}
+
+// validLeadingDirs returns an error if any of the leading directories of the
+// file is a symbolic link, through which it could be written out of the
+// worktree.
+func (g *checkoutGuard) validLeadingDirs(name string) error {
+	for dir := path.Dir(name); dir != "."; dir = path.Dir(dir) {
+		if _, ok := g.dirs[dir]; ok {
+			continue
+		}
+
+		fi, err := g.w.Filesystem.Lstat(dir)
+		if err != nil {
+			continue
+		}
+
+		if fi.Mode()&os.ModeSymlink != 0 {
+			return &InvalidPathError{Path: name, Err: fmt.Errorf("%w: beyond a symbolic link", ErrPathTraversal)}
+		}
+
+		g.dirs[dir] = struct{}{}
+	}
+
+	return nil
+}
+
+// written forgets the file as a leading directory, once written.
+func (g *checkoutGuard) written(name string) {
+	delete(g.dirs, name)
+}
+
+// caseInsensitive returns whether the worktree may be on a case-insensitive
+// filesystem, core.ignoreCase being set or the default filesystems of the OS
+// being case-insensitive.
+func (w *Worktree) caseInsensitive() (bool, error) {
+	cfg, err := w.r.Config()
+	if err != nil {
+		return false, err
+	}
+
+	if v := cfg.Raw.Section("core").Option("ignorecase"); v != "" {
+		return formatcfg.IsTrue(v), nil
+	}
+
+	return runtime.GOOS == "windows" || runtime.GOOS == "darwin", nil
+}
+
+// checkPathCollisions returns the collisions between the given files and the
+// other files of idx, or their leading directories, on a case-insensitive
+// filesystem. If allow is set, the collisions are reported to progress
+// instead, if any, as git warns about them.
+func (w *Worktree) checkPathCollisions(idx *index.Index, names []string, allow bool, progress sideband.Progress) error {
+	if len(names) == 0 {
+		return nil
+	}
+
+	insensitive, err := w.caseInsensitive()
+	if err != nil || !insensitive {
+		return err
+	}
+
+	collisions := pathCollisions(idx, names)
+	if len(collisions) == 0 {
+		return nil
+	}
+
+	if !allow {
+		return &PathCollisionError{Paths: collisions}
+	}
+
+	if progress != nil {
+		for _, c := range collisions {
+			if _, err := fmt.Fprintf(progress, "warning: the paths %q and %q collide\n", c.Other, c.Path); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// pathCollisions returns the collisions between the given files, their
+// leading directories, and the files of idx and their leading directories,
+// the paths differing only by their case or Unicode normalization.
+func pathCollisions(idx *index.Index, names []string) []*InvalidPathError {
+	// first is the first path of each folded path, and others the paths
+	// colliding with it.
+	first := make(map[string]string)
+	others := make(map[string][]string)
+	for _, e := range idx.Entries {
+		if e.Stage != index.Merged || e.SkipWorktree {
+			continue
+		}
+
+		for p := e.Name; p != "."; p = path.Dir(p) {
+			key := foldPath(p)
+			f, ok := first[key]
+			if !ok {
+				first[key] = p
+				continue
+			}
+
+			if f == p {
+				// The leading directories were already walked.
+				break
+			}
+
+			if !slices.Contains(others[key], p) {
+				others[key] = append(others[key], p)
+			}
+		}
+	}
+
+	var collisions []*InvalidPathError
+	reported := make(map[string]bool)
+	for _, name := range names {
+		for p := name; p != "."; p = path.Dir(p) {
+			key := foldPath(p)
+			if len(others[key]) == 0 || reported[key] {
+				continue
+			}
+
+			reported[key] = true
+			for _, o := range others[key] {
+				collisions = append(collisions, &InvalidPathError{Path: o, Other: first[key], Err: ErrPathCollision})
+			}
+		}
+	}
+
+	return collisions
+}
+
+// foldPath returns the path as compared by the case-insensitive
+// filesystems, normalized to NFC, as on macOS, and lower-cased.
+func foldPath(p string) string {
+	return strings.ToLower(norm.NFC.String(p))
+}
+
+// PathCollisionError is returned by a checkout when some files collide on a
+// case-insensitive filesystem, unless the collisions are allowed.
+type PathCollisionError struct {
+	// Paths are the colliding paths, with the path each one collides with.
+	Paths []*InvalidPathError
+}
+
+func (e *PathCollisionError) Error() string {
+	msg := make([]string, len(e.Paths))
+	for i, p := range e.Paths {
+		msg[i] = p.Error()
+	}
+
+	return strings.Join(msg, "\n")
+}
+
+// Unwrap returns the errors of the colliding paths.
+func (e *PathCollisionError) Unwrap() []error {
+	errs := make([]error, len(e.Paths))
+	for i, p := range e.Paths {
+		errs[i] = p
+	}
+
+	return errs
+}
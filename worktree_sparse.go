@@ -0,0 +1,268 @@
+package git
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"io"
+	"os"
+	"path"
+	"strings"
+
+	"github.com/go-git/go-billy/v6/util"
+
+	"github.com/go-git/go-git/v6/plumbing/format/gitignore"
+	"github.com/go-git/go-git/v6/plumbing/format/index"
+	"github.com/go-git/go-git/v6/plumbing/storer"
+)
+
+const sparseCheckoutPath = "info/sparse-checkout"
+
+// sparseCheckout is the set of paths materialized in the working tree by a
+// sparse checkout. The paths outside of it are kept in the index, flagged as
+// skip-worktree.
+// See https://git-scm.com/docs/git-sparse-checkout
+type sparseCheckout struct {
+	// dirs are the directories checked out recursively, in cone mode.
+	dirs []string
+	// root is true if the files at the root of the working tree are checked
+	// out, in cone mode.
+	root bool
+	// patterns are the gitignore-style patterns of the non-cone mode. A path
+	// is checked out if it matches them.
+	patterns []string
+	matcher  gitignore.Matcher
+}
+
+// newSparseCheckout returns the sparse checkout of the given directories, in
+// cone mode, or of the given patterns otherwise. It returns nil if both are
+// empty.
+func newSparseCheckout(dirs, patterns []string) *sparseCheckout {
+	if len(dirs) > 0 {
+		s := &sparseCheckout{}
+		for _, dir := range dirs {
+			dir = strings.Trim(path.Clean(dir), "/")
+			if dir != "" && dir != "." {
+				s.dirs = append(s.dirs, dir)
+			}
+		}
+
+		return s
+	}
+
+	if len(patterns) == 0 {
+		return nil
+	}
+
+	ps := make([]gitignore.Pattern, 0, len(patterns))
+	for _, p := range patterns {
+		ps = append(ps, gitignore.ParsePattern(p, nil))
+	}
+
+	return &sparseCheckout{
+		patterns: patterns,
+		matcher:  sparseMatcher(ps),
+	}
+}
+
+// sparseMatcher matches a path to the non-cone patterns, the last matching
+// one taking precedence. Unlike with gitignore.NewMatcher, the patterns of a
+// directory apply to the files under it, so that all the files of a negated
+// directory are left out of the sparse checkout.
+type sparseMatcher []gitignore.Pattern
+
+func (m sparseMatcher) Match(path []string, isDir bool) bool {
+	for i := len(m) - 1; i >= 0; i-- {
+		if match := m[i].Match(path, isDir); match != gitignore.NoMatch {
+			return match == gitignore.Exclude
+		}
+	}
+
+	return false
+}
+
+// includes returns true if the file with the given name is checked out.
+func (s *sparseCheckout) includes(name string) bool {
+	if s.matcher != nil {
+		return s.matcher.Match(strings.Split(name, "/"), false)
+	}
+
+	if s.root && !strings.Contains(name, "/") {
+		return true
+	}
+
+	for _, dir := range s.dirs {
+		if name == dir || strings.HasPrefix(name, dir+"/") {
+			return true
+		}
+	}
+
+	return false
+}
+
+// apply flags the entries of the index outside of the sparse checkout as
+// skip-worktree, and clears the flag of the ones inside of it. It returns
+// the names of the entries whose flag was set and cleared.
+func (s *sparseCheckout) apply(idx *index.Index) (skipped, unskipped []string) {
+	for _, e := range idx.Entries {
+		skip := !s.includes(e.Name)
+		if skip == e.SkipWorktree {
+			continue
+		}
+
+		e.SkipWorktree = skip
+		if skip {
+			skipped = append(skipped, e.Name)
+		} else {
+			unskipped = append(unskipped, e.Name)
+		}
+	}
+
+	return skipped, unskipped
+}
+
+// encode writes the sparse checkout to w, in the format of the
+// sparse-checkout file.
+func (s *sparseCheckout) encode(w io.Writer) error {
+	var buf bytes.Buffer
+	if s.root {
+		buf.WriteString("/*\n!/*/\n")
+	}
+
+	for _, dir := range s.dirs {
+		buf.WriteString("/" + dir + "/\n")
+	}
+
+	for _, p := range s.patterns {
+		buf.WriteString(p + "\n")
+	}
+
+	_, err := w.Write(buf.Bytes())
+	return err
+}
+
+// decodeSparseCheckout reads the sparse-checkout file from r. In cone mode,
+// the directories are read from the patterns written by git or go-git; if
+// any of the patterns is not a cone pattern, the non-cone mode is used
+// instead, as git does.
+func decodeSparseCheckout(r io.Reader, cone bool) (*sparseCheckout, error) {
+	var patterns []string
+	sc := bufio.NewScanner(r)
+	for sc.Scan() {
+		line := strings.TrimSpace(sc.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		patterns = append(patterns, line)
+	}
+
+	if err := sc.Err(); err != nil {
+		return nil, err
+	}
+
+	if cone {
+		if s, ok := parseConePatterns(patterns); ok {
+			return s, nil
+		}
+	}
+
+	// An empty sparse-checkout file would leave no file in the working
+	// tree, so it is ignored.
+	return newSparseCheckout(nil, patterns), nil
+}
+
+// parseConePatterns returns the sparse checkout of the given cone mode
+// patterns. The parent directories, which git lists followed by a negated
+// "/<dir>/*/" pattern, are not checked out recursively. It returns false if
+// any of the patterns is not a cone pattern.
+func parseConePatterns(patterns []string) (*sparseCheckout, bool) {
+	s := &sparseCheckout{}
+	var dirs []string
+	parents := make(map[string]bool)
+	for _, p := range patterns {
+		switch {
+		case p == "/*":
+			s.root = true
+		case p == "!/*/":
+		case strings.HasPrefix(p, "!/") && strings.HasSuffix(p, "/*/"):
+			parents[strings.TrimSuffix(p[2:], "/*/")] = true
+		case strings.HasPrefix(p, "/") && strings.HasSuffix(p, "/") && len(p) > 2:
+			dir := strings.Trim(p, "/")
+			if strings.ContainsAny(dir, "*?[\\") {
+				return nil, false
+			}
+
+			dirs = append(dirs, dir)
+		default:
+			return nil, false
+		}
+	}
+
+	for _, dir := range dirs {
+		if !parents[dir] {
+			s.dirs = append(s.dirs, dir)
+		}
+	}
+
+	return s, true
+}
+
+// sparseCheckout returns the sparse checkout configured for the worktree
+// with core.sparseCheckout, or nil if it is not enabled.
+func (w *Worktree) sparseCheckout() (*sparseCheckout, error) {
+	cfg, err := w.r.Config()
+	if err != nil {
+		return nil, err
+	}
+
+	if !cfg.Core.SparseCheckout {
+		return nil, nil
+	}
+
+	fss, ok := w.r.Storer.(storer.FilesystemStorer)
+	if !ok {
+		return nil, nil
+	}
+
+	f, err := fss.Filesystem().Open(sparseCheckoutPath)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	return decodeSparseCheckout(f, cfg.Core.SparseCheckoutCone)
+}
+
+// setSparseCheckout writes the sparse-checkout file and enables
+// core.sparseCheckout, so that the following checkouts keep checking out
+// the same paths. Nothing is persisted if the storage is not backed by a
+// filesystem.
+func (w *Worktree) setSparseCheckout(s *sparseCheckout) error {
+	fss, ok := w.r.Storer.(storer.FilesystemStorer)
+	if !ok {
+		return nil
+	}
+
+	var buf bytes.Buffer
+	if err := s.encode(&buf); err != nil {
+		return err
+	}
+
+	if err := util.WriteFile(fss.Filesystem(), sparseCheckoutPath, buf.Bytes(), 0o644); err != nil {
+		return err
+	}
+
+	cfg, err := w.r.Config()
+	if err != nil {
+		return err
+	}
+
+	cfg.Core.SparseCheckout = true
+	cfg.Core.SparseCheckoutCone = s.matcher == nil
+	return w.r.Storer.SetConfig(cfg)
+}
@@ -0,0 +1,185 @@
+package git
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/go-git/go-billy/v6"
+	"github.com/go-git/go-billy/v6/memfs"
+	"github.com/go-git/go-billy/v6/util"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/go-git/go-git/v6/plumbing"
+	"github.com/go-git/go-git/v6/plumbing/cache"
+	"github.com/go-git/go-git/v6/storage/filesystem"
+)
+
+func TestSparseCheckoutIncludes(t *testing.T) {
+	t.Parallel()
+
+	cone := newSparseCheckout([]string{"go/", "json"}, nil)
+	assert.True(t, cone.includes("go/example.go"))
+	assert.True(t, cone.includes("json/short.json"))
+	assert.False(t, cone.includes("golang/main.go"))
+	assert.False(t, cone.includes("LICENSE"))
+
+	patterns := newSparseCheckout(nil, []string{"*.go", "!vendor/"})
+	assert.True(t, patterns.includes("go/example.go"))
+	assert.False(t, patterns.includes("vendor/foo.go"))
+	assert.False(t, patterns.includes("json/short.json"))
+
+	assert.Nil(t, newSparseCheckout(nil, nil))
+}
+
+func TestDecodeSparseCheckout(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name     string
+		input    string
+		cone     bool
+		included []string
+		excluded []string
+	}{
+		{
+			name:     "go-git cone",
+			input:    "/go/\n/json/\n",
+			cone:     true,
+			included: []string{"go/example.go", "json/short.json"},
+			excluded: []string{"LICENSE", "php/crappy.php"},
+		},
+		{
+			name:     "git cone",
+			input:    "/*\n!/*/\n/a/\n!/a/*/\n/a/b/\n",
+			cone:     true,
+			included: []string{"LICENSE", "a/b/c.go", "a/b/c/d.go"},
+			excluded: []string{"a/c.go", "a/c/d.go", "php/crappy.php"},
+		},
+		{
+			name:     "non-cone patterns with cone enabled",
+			input:    "# comment\n*.json\n",
+			cone:     true,
+			included: []string{"json/short.json"},
+			excluded: []string{"go/example.go"},
+		},
+		{
+			name:     "non-cone",
+			input:    "/go/\n",
+			included: []string{"go/example.go"},
+			excluded: []string{"LICENSE"},
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			s, err := decodeSparseCheckout(strings.NewReader(tc.input), tc.cone)
+			require.NoError(t, err)
+			for _, name := range tc.included {
+				assert.True(t, s.includes(name), name)
+			}
+
+			for _, name := range tc.excluded {
+				assert.False(t, s.includes(name), name)
+			}
+		})
+	}
+}
+
+func (s *WorktreeSuite) TestCheckoutSparsePatterns() {
+	fs := memfs.New()
+	w := &Worktree{
+		r:          s.Repository,
+		Filesystem: fs,
+	}
+
+	err := w.Checkout(&CheckoutOptions{
+		SparseCheckoutPatterns: []string{"*.go", "!vendor/"},
+		Force:                  true,
+	})
+	s.Require().NoError(err)
+
+	s.True(fileExists(fs, "go/example.go"), "go/example.go")
+	s.False(fileExists(fs, "vendor/foo.go"), "vendor/foo.go")
+	s.False(fileExists(fs, "json/short.json"), "json/short.json")
+	s.False(fileExists(fs, "LICENSE"), "LICENSE")
+
+	status, err := w.Status()
+	s.Require().NoError(err)
+	s.True(status.IsClean(), status)
+
+	idx, err := s.Repository.Storer.Index()
+	s.Require().NoError(err)
+	for _, e := range idx.Entries {
+		s.Equal(e.Name != "go/example.go", e.SkipWorktree, e.Name)
+	}
+}
+
+func (s *WorktreeSuite) TestCheckoutSparsePersisted() {
+	dotgit := memfs.New()
+	fs := memfs.New()
+	r, err := Clone(filesystem.NewStorage(dotgit, cache.NewObjectLRUDefault()), fs, &CloneOptions{
+		URL:        s.GetBasicLocalRepositoryURL(),
+		NoCheckout: true,
+	})
+	s.Require().NoError(err)
+
+	w, err := r.Worktree()
+	s.Require().NoError(err)
+
+	s.Require().NoError(w.Checkout(&CheckoutOptions{
+		SparseCheckoutDirectories: []string{"go"},
+	}))
+
+	cfg, err := r.Config()
+	s.Require().NoError(err)
+	s.True(cfg.Core.SparseCheckout)
+	s.True(cfg.Core.SparseCheckoutCone)
+
+	content, err := util.ReadFile(dotgit, "info/sparse-checkout")
+	s.Require().NoError(err)
+	s.Equal("/go/\n", string(content))
+
+	// Switching branches keeps the sparse checkout.
+	s.Require().NoError(w.Checkout(&CheckoutOptions{
+		Branch: plumbing.NewRemoteReferenceName("origin", "branch"),
+	}))
+	s.assertSparseWorktree(w, fs, "go")
+
+	// Changing the directories removes the files left out.
+	s.Require().NoError(w.Checkout(&CheckoutOptions{
+		Branch:                    plumbing.Master,
+		SparseCheckoutDirectories: []string{"json"},
+	}))
+	s.assertSparseWorktree(w, fs, "json")
+	s.False(fileExists(fs, "go/example.go"), "go/example.go")
+	s.True(fileExists(fs, "json/short.json"), "json/short.json")
+
+	content, err = util.ReadFile(dotgit, "info/sparse-checkout")
+	s.Require().NoError(err)
+	s.Equal("/json/\n", string(content))
+}
+
+func (s *WorktreeSuite) assertSparseWorktree(w *Worktree, fs billy.Filesystem, dir string) {
+	fis, err := fs.ReadDir("/")
+	s.Require().NoError(err)
+
+	var names []string
+	for _, fi := range fis {
+		if fi.Name() != GitDirName {
+			names = append(names, fi.Name())
+		}
+	}
+	s.Equal([]string{dir}, names)
+
+	status, err := w.Status()
+	s.Require().NoError(err)
+	s.True(status.IsClean(), status)
+}
+
+func fileExists(fs billy.Filesystem, name string) bool {
+	_, err := fs.Stat(name)
+	return err == nil
+}
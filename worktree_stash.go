@@ -0,0 +1,487 @@
+package git
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/go-git/go-git/v6/plumbing"
+	"github.com/go-git/go-git/v6/plumbing/format/index"
+	"github.com/go-git/go-git/v6/plumbing/format/reflog"
+	"github.com/go-git/go-git/v6/plumbing/object"
+	"github.com/go-git/go-git/v6/storage"
+)
+
+// StashRefName is the reference pointing to the most recent stash.
+const StashRefName plumbing.ReferenceName = "refs/stash"
+
+var (
+	// ErrNoLocalChanges is returned by Stash when there are no changes in the
+	// index or in the working tree.
+	ErrNoLocalChanges = errors.New("no local changes to save")
+	// ErrStashNotFound is returned when the requested stash does not exist.
+	ErrStashNotFound = errors.New("stash entry not found")
+	// ErrStashConflict is returned when applying a stash results in
+	// conflicts. The conflicting files are left unmerged in the index, with
+	// one entry for each of the stages of the merge.
+	ErrStashConflict = errors.New("conflicts applying stash")
+	// ErrUnmergedPaths is returned by Stash when the index contains
+	// unresolved conflicts.
+	ErrUnmergedPaths = errors.New("index contains unmerged paths")
+)
+
+// Stash is an entry of the stash list.
+type Stash struct {
+	// Index is the position of the stash in the list, the most recent one
+	// being 0, as in stash@{0}.
+	Index int
+	// Hash is the hash of the stash commit.
+	Hash plumbing.Hash
+	// Message is the description of the stash.
+	Message string
+}
+
+// Stash saves the local changes of the index and the working tree, and
+// reverts them to the HEAD commit. As with git, the stash is a commit on
+// refs/stash whose tree is the state of the working tree, and whose parents
+// are the HEAD commit, a commit with the state of the index and, when
+// IncludeUntracked is set, a commit with the untracked files.
+//
+// The stash list is kept in the reflog of refs/stash, which is only
+// available with storers keeping reflogs; otherwise creating a stash
+// replaces the previous one.
+func (w *Worktree) Stash(opts *StashOptions) (plumbing.Hash, error) {
+	if err := opts.Validate(w.r); err != nil {
+		return plumbing.ZeroHash, err
+	}
+
+	head, err := w.r.Head()
+	if err != nil {
+		return plumbing.ZeroHash, err
+	}
+
+	headCommit, err := w.r.CommitObject(head.Hash())
+	if err != nil {
+		return plumbing.ZeroHash, err
+	}
+
+	status, err := w.Status()
+	if err != nil {
+		return plumbing.ZeroHash, err
+	}
+
+	if !hasLocalChanges(status, opts.IncludeUntracked) {
+		return plumbing.ZeroHash, ErrNoLocalChanges
+	}
+
+	idx, err := w.r.Storer.Index()
+	if err != nil {
+		return plumbing.ZeroHash, err
+	}
+
+	for _, e := range idx.Entries {
+		if e.Stage != index.Merged {
+			return plumbing.ZeroHash, fmt.Errorf("%w: %s", ErrUnmergedPaths, e.Name)
+		}
+	}
+
+	branch := "(no branch)"
+	if ref, err := w.r.Storer.Reference(plumbing.HEAD); err == nil && ref.Type() == plumbing.SymbolicReference {
+		branch = ref.Target().Short()
+	}
+
+	subject := fmt.Sprintf("%s: %s %s", branch, headCommit.Hash.String()[:7], strings.SplitN(headCommit.Message, "\n", 2)[0])
+
+	commit := func(msg string, idx *index.Index, parents ...plumbing.Hash) (plumbing.Hash, error) {
+		h := &buildTreeHelper{fs: w.Filesystem, s: w.r.Storer}
+		tree, err := h.BuildTree(idx, nil)
+		if err != nil {
+			return plumbing.ZeroHash, err
+		}
+
+		return w.buildCommitObject(msg, &CommitOptions{
+			Author:    opts.Author,
+			Committer: opts.Author,
+			Parents:   parents,
+		}, tree)
+	}
+
+	indexCommit, err := commit("index on "+subject+"\n", idx, headCommit.Hash)
+	if err != nil {
+		return plumbing.ZeroHash, err
+	}
+
+	parents := []plumbing.Hash{headCommit.Hash, indexCommit}
+
+	// The state of the working tree is the index updated with the changes
+	// of the tracked files, and the untracked files go in a separate commit.
+	worktreeIdx := copyIndex(idx)
+	untrackedIdx := &index.Index{Version: idx.Version}
+	var added, untracked []string
+	for name, fs := range status {
+		switch {
+		case fs.Worktree == Untracked:
+			if !opts.IncludeUntracked {
+				continue
+			}
+
+			if _, _, err := w.doAddFile(untrackedIdx, status, name, nil); err != nil {
+				return plumbing.ZeroHash, err
+			}
+
+			untracked = append(untracked, name)
+		case fs.Worktree == Modified || fs.Worktree == Deleted:
+			if _, _, err := w.doAddFile(worktreeIdx, status, name, nil); err != nil {
+				return plumbing.ZeroHash, err
+			}
+		}
+
+		if fs.Staging == Added {
+			added = append(added, name)
+		}
+	}
+
+	if len(untracked) > 0 {
+		untrackedCommit, err := commit("untracked files on "+subject+"\n", untrackedIdx)
+		if err != nil {
+			return plumbing.ZeroHash, err
+		}
+
+		parents = append(parents, untrackedCommit)
+	}
+
+	msg := "WIP on " + subject
+	if opts.Message != "" {
+		msg = fmt.Sprintf("On %s: %s", branch, opts.Message)
+	}
+
+	hash, err := commit(msg+"\n", worktreeIdx, parents...)
+	if err != nil {
+		return plumbing.ZeroHash, err
+	}
+
+	if err := w.pushStash(hash, *opts.Author, msg); err != nil {
+		return plumbing.ZeroHash, err
+	}
+
+	if err := w.Reset(&ResetOptions{Commit: headCommit.Hash, Mode: HardReset}); err != nil {
+		return plumbing.ZeroHash, err
+	}
+
+	// The files added to the index and the untracked ones are not tracked by
+	// HEAD, so they are left in the working tree by the reset.
+	for _, name := range append(added, untracked...) {
+		if err := rmFileAndDirsIfEmpty(w.Filesystem, name); err != nil {
+			return plumbing.ZeroHash, err
+		}
+	}
+
+	return hash, nil
+}
+
+// autostash stashes the local changes, if any, before an operation which
+// requires a clean worktree, as the autostash of git does. It returns the hash
+// of the stash, zero if there are no local changes.
+func (w *Worktree) autostash(author *object.Signature) (plumbing.Hash, error) {
+	h, err := w.Stash(&StashOptions{Message: "autostash", Author: author})
+	if errors.Is(err, ErrNoLocalChanges) {
+		return plumbing.ZeroHash, nil
+	}
+
+	return h, err
+}
+
+// applyAutostash applies the stash created by autostash, if any, and removes
+// it from the stash list. If it can't be applied, it is kept in the list.
+func (w *Worktree) applyAutostash(hash plumbing.Hash) error {
+	if hash.IsZero() {
+		return nil
+	}
+
+	if err := w.applyStash(hash); err != nil {
+		return fmt.Errorf("applying autostash %s, kept in the stash list: %w", hash, err)
+	}
+
+	entries, err := w.stashLog()
+	if err != nil {
+		return err
+	}
+
+	for i, e := range entries {
+		if e.New == hash {
+			return w.setStashLog(append(entries[:i], entries[i+1:]...))
+		}
+	}
+
+	return nil
+}
+
+func hasLocalChanges(s Status, includeUntracked bool) bool {
+	for _, fs := range s {
+		if fs.Worktree == Untracked {
+			if includeUntracked {
+				return true
+			}
+
+			continue
+		}
+
+		if fs.Worktree != Unmodified || fs.Staging != Unmodified {
+			return true
+		}
+	}
+
+	return false
+}
+
+func copyIndex(idx *index.Index) *index.Index {
+	c := &index.Index{Version: idx.Version}
+	for _, e := range idx.Entries {
+		entry := *e
+		c.Entries = append(c.Entries, &entry)
+	}
+
+	return c
+}
+
+// StashList returns the stash list, the most recent stash first.
+func (w *Worktree) StashList() ([]*Stash, error) {
+	entries, err := w.stashLog()
+	if err != nil {
+		return nil, err
+	}
+
+	stashes := make([]*Stash, len(entries))
+	for i, e := range entries {
+		stashes[i] = &Stash{Index: i, Hash: e.New, Message: e.Message}
+	}
+
+	return stashes, nil
+}
+
+// StashApply applies the changes of the stash at the given position of the
+// stash list to the working tree, merging them with its current state. The
+// stash is kept in the list.
+//
+// The changes are left unstaged, except for the added files. The files
+// changed by the stash must not have local changes, otherwise
+// ErrUnstagedChanges is returned and nothing is applied. If a file has been
+// changed both by the stash and since the stash was created, it is left
+// unmerged in the index and ErrStashConflict is returned.
+func (w *Worktree) StashApply(n int) error {
+	entries, err := w.stashLog()
+	if err != nil {
+		return err
+	}
+
+	if n < 0 || n >= len(entries) {
+		return fmt.Errorf("%w: stash@{%d}", ErrStashNotFound, n)
+	}
+
+	return w.applyStash(entries[n].New)
+}
+
+// StashPop applies the most recent stash, as StashApply does, and removes
+// it from the stash list. The stash is kept if applying it fails.
+func (w *Worktree) StashPop() error {
+	if err := w.StashApply(0); err != nil {
+		return err
+	}
+
+	return w.StashDrop(0)
+}
+
+// StashDrop removes the stash at the given position from the stash list.
+func (w *Worktree) StashDrop(n int) error {
+	entries, err := w.stashLog()
+	if err != nil {
+		return err
+	}
+
+	if n < 0 || n >= len(entries) {
+		return fmt.Errorf("%w: stash@{%d}", ErrStashNotFound, n)
+	}
+
+	entries = append(entries[:n], entries[n+1:]...)
+	return w.setStashLog(entries)
+}
+
+func (w *Worktree) applyStash(hash plumbing.Hash) error {
+	stash, err := w.r.CommitObject(hash)
+	if err != nil {
+		return err
+	}
+
+	if stash.NumParents() < 2 {
+		return fmt.Errorf("%w: %s is not a stash commit", ErrStashNotFound, hash)
+	}
+
+	base, err := stash.Parent(0)
+	if err != nil {
+		return err
+	}
+
+	baseTree, err := base.Tree()
+	if err != nil {
+		return err
+	}
+
+	stashTree, err := stash.Tree()
+	if err != nil {
+		return err
+	}
+
+	changes, err := object.DiffTree(baseTree, stashTree)
+	if err != nil {
+		return err
+	}
+
+	var untrackedTree *object.Tree
+	if stash.NumParents() > 2 {
+		untracked, err := stash.Parent(2)
+		if err != nil {
+			return err
+		}
+
+		if untrackedTree, err = untracked.Tree(); err != nil {
+			return err
+		}
+	}
+
+	status, err := w.Status()
+	if err != nil {
+		return err
+	}
+
+	// Nothing is applied if any of the files to be written has local
+	// changes, so that they are not overwritten.
+	var names []string
+	for _, ch := range changes {
+		names = append(names, changeName(ch))
+	}
+
+	if untrackedTree != nil {
+		err := untrackedTree.Files().ForEach(func(f *object.File) error {
+			names = append(names, f.Name)
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	for _, name := range names {
+		if fs, ok := status[name]; ok && fs.Worktree != Unmodified {
+			return fmt.Errorf("%w: %s", ErrUnstagedChanges, name)
+		}
+	}
+
+	if untrackedTree != nil {
+		conv, err := w.newWorktreeConverter()
+		if err != nil {
+			return err
+		}
+
+		err = untrackedTree.Files().ForEach(func(f *object.File) error {
+			return w.checkoutFile(f, conv)
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	conflicts, err := w.mergeChanges(changes, stashTree, &changesMerge{
+		ours:   "Updated upstream",
+		theirs: "Stashed changes",
+	})
+	if err != nil {
+		return err
+	}
+
+	if len(conflicts) > 0 {
+		return ErrStashConflict
+	}
+
+	return nil
+}
+
+// stashLog returns the entries of the stash list, the most recent first.
+// When the reflog of refs/stash is not available, the stash list only
+// contains the stash refs/stash points to.
+func (w *Worktree) stashLog() ([]*ReflogEntry, error) {
+	ref, err := w.r.Storer.Reference(StashRefName)
+	if errors.Is(err, plumbing.ErrReferenceNotFound) {
+		return nil, nil
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	entries, err := w.r.Reflog(StashRefName)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(entries) == 0 {
+		return w.singleStashLog(ref.Hash())
+	}
+
+	return entries, nil
+}
+
+func (w *Worktree) singleStashLog(hash plumbing.Hash) ([]*ReflogEntry, error) {
+	c, err := w.r.CommitObject(hash)
+	if err != nil {
+		return nil, err
+	}
+
+	return []*ReflogEntry{{
+		New:       hash,
+		Committer: c.Committer,
+		Message:   strings.TrimSuffix(c.Message, "\n"),
+	}}, nil
+}
+
+func (w *Worktree) pushStash(hash plumbing.Hash, committer object.Signature, msg string) error {
+	entries, err := w.stashLog()
+	if err != nil {
+		return err
+	}
+
+	e := &ReflogEntry{New: hash, Committer: committer, Message: msg}
+	if len(entries) > 0 {
+		e.Old = entries[0].New
+	}
+
+	return w.setStashLog(append([]*ReflogEntry{e}, entries...))
+}
+
+// setStashLog updates refs/stash to the most recent of the given entries,
+// and writes them to its reflog. refs/stash is removed if there are no
+// entries.
+func (w *Worktree) setStashLog(entries []*ReflogEntry) error {
+	s, hasLog := w.r.Storer.(storage.ReflogStorer)
+	if len(entries) == 0 {
+		if hasLog {
+			if err := s.RemoveReflog(StashRefName); err != nil {
+				return err
+			}
+		}
+
+		return w.r.Storer.RemoveReference(StashRefName)
+	}
+
+	if hasLog {
+		log := make([]*reflog.Entry, len(entries))
+		for i, e := range entries {
+			log[len(entries)-1-i] = e.encode()
+		}
+
+		if err := s.SetReflog(StashRefName, log); err != nil {
+			return err
+		}
+	}
+
+	return w.r.Storer.SetReference(plumbing.NewHashReference(StashRefName, entries[0].New))
+}
@@ -0,0 +1,206 @@
+package git
+
+import (
+	"github.com/go-git/go-billy/v6"
+	"github.com/go-git/go-billy/v6/memfs"
+	"github.com/go-git/go-billy/v6/util"
+
+	"github.com/go-git/go-git/v6/plumbing"
+	"github.com/go-git/go-git/v6/plumbing/cache"
+	"github.com/go-git/go-git/v6/plumbing/format/index"
+	"github.com/go-git/go-git/v6/plumbing/object"
+	"github.com/go-git/go-git/v6/storage/filesystem"
+)
+
+func (s *WorktreeSuite) newStashRepository() (*Repository, *Worktree, billy.Filesystem) {
+	fs := memfs.New()
+	r, err := Clone(filesystem.NewStorage(memfs.New(), cache.NewObjectLRUDefault()), fs, &CloneOptions{
+		URL: s.GetBasicLocalRepositoryURL(),
+	})
+	s.Require().NoError(err)
+
+	w, err := r.Worktree()
+	s.Require().NoError(err)
+
+	return r, w, fs
+}
+
+func (s *WorktreeSuite) TestStash() {
+	r, w, fs := s.newStashRepository()
+
+	s.Require().NoError(util.WriteFile(fs, "LICENSE", []byte("modified"), 0o644))
+	s.Require().NoError(util.WriteFile(fs, "added", []byte("added"), 0o644))
+	_, err := w.Add("added")
+	s.Require().NoError(err)
+	s.Require().NoError(fs.Remove("CHANGELOG"))
+
+	hash, err := w.Stash(&StashOptions{Author: defaultSignature()})
+	s.Require().NoError(err)
+
+	status, err := w.Status()
+	s.Require().NoError(err)
+	s.True(status.IsClean(), status)
+	s.False(fileExists(fs, "added"))
+
+	ref, err := r.Reference(StashRefName, false)
+	s.Require().NoError(err)
+	s.Equal(hash, ref.Hash())
+
+	head, err := r.Head()
+	s.Require().NoError(err)
+
+	stash, err := r.CommitObject(hash)
+	s.Require().NoError(err)
+	s.Equal("WIP on master: 6ecf0ef vendor stuff\n", stash.Message)
+	s.Len(stash.ParentHashes, 2)
+	s.Equal(head.Hash(), stash.ParentHashes[0])
+
+	f, err := stash.File("LICENSE")
+	s.Require().NoError(err)
+	content, err := f.Contents()
+	s.Require().NoError(err)
+	s.Equal("modified", content)
+
+	_, err = stash.File("CHANGELOG")
+	s.ErrorIs(err, object.ErrFileNotFound)
+
+	indexCommit, err := stash.Parent(1)
+	s.Require().NoError(err)
+	s.Equal("index on master: 6ecf0ef vendor stuff\n", indexCommit.Message)
+	_, err = indexCommit.File("added")
+	s.NoError(err)
+	f, err = indexCommit.File("LICENSE")
+	s.Require().NoError(err)
+	content, err = f.Contents()
+	s.Require().NoError(err)
+	s.NotEqual("modified", content)
+
+	stashes, err := w.StashList()
+	s.Require().NoError(err)
+	s.Equal([]*Stash{{Index: 0, Hash: hash, Message: "WIP on master: 6ecf0ef vendor stuff"}}, stashes)
+
+	s.Require().NoError(w.StashPop())
+
+	data, err := util.ReadFile(fs, "LICENSE")
+	s.Require().NoError(err)
+	s.Equal("modified", string(data))
+	s.False(fileExists(fs, "CHANGELOG"))
+
+	status, err = w.Status()
+	s.Require().NoError(err)
+	s.Equal(Modified, status.File("LICENSE").Worktree)
+	s.Equal(Deleted, status.File("CHANGELOG").Worktree)
+	s.Equal(Added, status.File("added").Staging)
+
+	stashes, err = w.StashList()
+	s.Require().NoError(err)
+	s.Empty(stashes)
+
+	_, err = r.Reference(StashRefName, false)
+	s.ErrorIs(err, plumbing.ErrReferenceNotFound)
+}
+
+func (s *WorktreeSuite) TestStashIncludeUntracked() {
+	r, w, fs := s.newStashRepository()
+
+	s.Require().NoError(util.WriteFile(fs, "untracked", []byte("untracked"), 0o644))
+
+	_, err := w.Stash(&StashOptions{Author: defaultSignature()})
+	s.ErrorIs(err, ErrNoLocalChanges)
+
+	hash, err := w.Stash(&StashOptions{
+		Author:           defaultSignature(),
+		Message:          "foo",
+		IncludeUntracked: true,
+	})
+	s.Require().NoError(err)
+	s.False(fileExists(fs, "untracked"))
+
+	stash, err := r.CommitObject(hash)
+	s.Require().NoError(err)
+	s.Equal("On master: foo\n", stash.Message)
+	s.Len(stash.ParentHashes, 3)
+
+	untracked, err := stash.Parent(2)
+	s.Require().NoError(err)
+	s.Empty(untracked.ParentHashes)
+	_, err = untracked.File("untracked")
+	s.NoError(err)
+
+	s.Require().NoError(w.StashApply(0))
+
+	status, err := w.Status()
+	s.Require().NoError(err)
+	s.True(status.IsUntracked("untracked"))
+
+	stashes, err := w.StashList()
+	s.Require().NoError(err)
+	s.Len(stashes, 1)
+}
+
+func (s *WorktreeSuite) TestStashList() {
+	_, w, fs := s.newStashRepository()
+
+	var hashes []plumbing.Hash
+	for _, content := range []string{"foo", "bar", "qux"} {
+		s.Require().NoError(util.WriteFile(fs, "LICENSE", []byte(content), 0o644))
+		hash, err := w.Stash(&StashOptions{Author: defaultSignature(), Message: content})
+		s.Require().NoError(err)
+		hashes = append(hashes, hash)
+	}
+
+	s.Require().NoError(w.StashDrop(1))
+	s.ErrorIs(w.StashDrop(2), ErrStashNotFound)
+	s.ErrorIs(w.StashApply(-1), ErrStashNotFound)
+
+	stashes, err := w.StashList()
+	s.Require().NoError(err)
+	s.Equal([]*Stash{
+		{Index: 0, Hash: hashes[2], Message: "On master: qux"},
+		{Index: 1, Hash: hashes[0], Message: "On master: foo"},
+	}, stashes)
+
+	s.Require().NoError(w.StashApply(1))
+	data, err := util.ReadFile(fs, "LICENSE")
+	s.Require().NoError(err)
+	s.Equal("foo", string(data))
+
+	s.ErrorIs(w.StashApply(0), ErrUnstagedChanges)
+}
+
+func (s *WorktreeSuite) TestStashApplyConflict() {
+	r, w, fs := s.newStashRepository()
+
+	s.Require().NoError(util.WriteFile(fs, "LICENSE", []byte("stashed\n"), 0o644))
+	_, err := w.Stash(&StashOptions{Author: defaultSignature()})
+	s.Require().NoError(err)
+
+	s.Require().NoError(util.WriteFile(fs, "LICENSE", []byte("committed\n"), 0o644))
+	_, err = w.Commit("update license", &CommitOptions{All: true, Author: defaultSignature()})
+	s.Require().NoError(err)
+
+	s.ErrorIs(w.StashPop(), ErrStashConflict)
+
+	data, err := util.ReadFile(fs, "LICENSE")
+	s.Require().NoError(err)
+	s.Equal("<<<<<<< Updated upstream\ncommitted\n=======\nstashed\n>>>>>>> Stashed changes\n", string(data))
+
+	idx, err := r.Storer.Index()
+	s.Require().NoError(err)
+
+	var stages []index.Stage
+	for _, e := range idx.Entries {
+		if e.Name == "LICENSE" {
+			stages = append(stages, e.Stage)
+		}
+	}
+	s.Equal([]index.Stage{index.AncestorMode, index.OurMode, index.TheirMode}, stages)
+
+	// The stash is kept, as it has not been applied cleanly.
+	stashes, err := w.StashList()
+	s.Require().NoError(err)
+	s.Len(stashes, 1)
+
+	_, err = w.Stash(&StashOptions{Author: defaultSignature()})
+	s.ErrorIs(err, ErrUnmergedPaths)
+}
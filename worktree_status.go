@@ -3,26 +3,30 @@ package git
 import (
 	"bytes"
 	"errors"
+	"fmt"
 	"io"
 	"os"
 	"path"
 	"path/filepath"
+	"slices"
 	"strings"
+	"sync"
 
+	"github.com/go-git/go-billy/v6"
 	"github.com/go-git/go-billy/v6/util"
 
+	"github.com/go-git/go-git/v6/internal/pathspec"
 	"github.com/go-git/go-git/v6/plumbing"
 	"github.com/go-git/go-git/v6/plumbing/filemode"
 	"github.com/go-git/go-git/v6/plumbing/format/gitignore"
 	"github.com/go-git/go-git/v6/plumbing/format/index"
 	"github.com/go-git/go-git/v6/plumbing/object"
-	"github.com/go-git/go-git/v6/utils/convert"
+	"github.com/go-git/go-git/v6/plumbing/storer"
 	"github.com/go-git/go-git/v6/utils/ioutil"
 	"github.com/go-git/go-git/v6/utils/merkletrie"
 	"github.com/go-git/go-git/v6/utils/merkletrie/filesystem"
 	mindex "github.com/go-git/go-git/v6/utils/merkletrie/index"
 	"github.com/go-git/go-git/v6/utils/merkletrie/noder"
-	"github.com/go-git/go-git/v6/utils/sync"
 )
 
 var (
@@ -32,9 +36,27 @@ var (
 	// ErrGlobNoMatches in an AddGlob if the glob pattern does not match any
 	// files in the worktree.
 	ErrGlobNoMatches = errors.New("glob pattern did not match any files")
+	// ErrPathSpecNoMatches in an AddWithOptions if an item of the pathspec
+	// does not match any files in the worktree or the index.
+	ErrPathSpecNoMatches = errors.New("pathspec did not match any files")
+	// ErrPathIgnored in an AddWithOptions if an item of the pathspec only
+	// matches ignored files, which are only added with AddOptions.Force.
+	ErrPathIgnored = errors.New("paths are ignored by one of the .gitignore files")
 	// ErrUnsupportedStatusStrategy occurs when an invalid StatusStrategy is used
 	// when processing the Worktree status.
 	ErrUnsupportedStatusStrategy = errors.New("unsupported status strategy")
+	// ErrStagedChanges in a Remove operation means that the file has changes
+	// staged in the index, which are only removed with RemoveOptions.Force,
+	// or kept with RemoveOptions.Cached.
+	ErrStagedChanges = errors.New("file has changes staged in the index")
+	// ErrLocalModifications in a Remove operation means that the file has
+	// changes not staged in the index, which are only removed with
+	// RemoveOptions.Force, or kept with RemoveOptions.Cached.
+	ErrLocalModifications = errors.New("file has local modifications")
+	// ErrStagedContentDiffers in a Remove operation means that the file
+	// staged in the index differs both from the file and from HEAD, its
+	// changes being only removed with RemoveOptions.Force.
+	ErrStagedContentDiffers = errors.New("file has staged content different from both the file and HEAD")
 )
 
 // Status returns the working tree status.
@@ -45,6 +67,27 @@ func (w *Worktree) Status() (Status, error) {
 // StatusOptions defines the options for Worktree.StatusWithOptions().
 type StatusOptions struct {
 	Strategy StatusStrategy
+	// UseUntrackedCache makes the status use and update the untracked cache
+	// of the index, as git does with core.untrackedCache: the directories
+	// whose stat data did not change since they were cached are not read
+	// again. It requires a filesystem updating the modification time of the
+	// directories when their entries change, as the ones of the operating
+	// systems do, but not memfs.
+	UseUntrackedCache bool
+	// Workers is the number of goroutines reading and hashing the files of
+	// the worktree tracked by the index, one at a time if 0 or 1. The Clean
+	// methods of the filter drivers must be safe for concurrent use if
+	// there are several.
+	Workers int
+	// DetectRenames detects the renames staged in the index, as git status
+	// does: the files deleted from HEAD and added to the index whose contents
+	// are similar are reported as Renamed in the staging area, under their
+	// new path, their Extra being their previous path.
+	DetectRenames bool
+	// Ignored reports the ignored files which are not tracked as Ignored,
+	// both in the staging area and in the worktree, instead of leaving them
+	// out of the status.
+	Ignored bool
 }
 
 // StatusWithOptions returns the working tree status.
@@ -60,11 +103,11 @@ func (w *Worktree) StatusWithOptions(o StatusOptions) (Status, error) {
 		hash = ref.Hash()
 	}
 
-	return w.status(o.Strategy, hash)
+	return w.status(o, hash)
 }
 
-func (w *Worktree) status(ss StatusStrategy, commit plumbing.Hash) (Status, error) {
-	s, err := ss.new(w)
+func (w *Worktree) status(o StatusOptions, commit plumbing.Hash) (Status, error) {
+	s, err := o.Strategy.new(w)
 	if err != nil {
 		return nil, err
 	}
@@ -93,11 +136,28 @@ func (w *Worktree) status(ss StatusStrategy, commit plumbing.Hash) (Status, erro
 		}
 	}
 
-	right, err := w.diffStagingWithWorktree(false, true)
+	if o.DetectRenames {
+		if err := w.renamesStatus(s, commit, left); err != nil {
+			return nil, err
+		}
+	}
+
+	var right merkletrie.Changes
+	if o.UseUntrackedCache {
+		right, err = w.diffStagingWithUntrackedCache(o.Workers, !o.Ignored)
+	} else {
+		right, err = w.diffStagingWithWorkers(o.Workers, !o.Ignored)
+	}
+
 	if err != nil {
 		return nil, err
 	}
 
+	var ignored merkletrie.Changes
+	if o.Ignored {
+		right, ignored = w.splitIgnoredChanges(w.Filesystem, right)
+	}
+
 	for _, ch := range right {
 		a, err := ch.Action()
 		if err != nil {
@@ -113,14 +173,191 @@ func (w *Worktree) status(ss StatusStrategy, commit plumbing.Hash) (Status, erro
 		case merkletrie.Delete:
 			fs.Worktree = Deleted
 		case merkletrie.Insert:
+			// A file deleted from the index is both deleted in the staging
+			// area and untracked.
 			fs.Worktree = Untracked
-			fs.Staging = Untracked
+			if fs.Staging != Deleted {
+				fs.Staging = Untracked
+			}
 		case merkletrie.Modify:
 			fs.Worktree = Modified
 		}
 	}
 
-	return s, nil
+	for _, ch := range ignored {
+		fs := s.File(nameFromAction(&ch))
+		fs.Staging = Ignored
+		fs.Worktree = Ignored
+	}
+
+	if err := w.unmergedStatus(s); err != nil {
+		return nil, err
+	}
+
+	return s, w.intentToAddStatus(s)
+}
+
+// renamesStatus reports the files deleted from the tree of the given commit
+// and added to the index by the given changes whose contents are similar as
+// renamed, under their new path, as git status does.
+func (w *Worktree) renamesStatus(s Status, commit plumbing.Hash, changes merkletrie.Changes) error {
+	if commit.IsZero() {
+		return nil
+	}
+
+	c, err := w.r.CommitObject(commit)
+	if err != nil {
+		return err
+	}
+
+	tree, err := c.Tree()
+	if err != nil {
+		return err
+	}
+
+	idx, err := w.r.Storer.Index()
+	if err != nil {
+		return err
+	}
+
+	entries := make(map[string]*index.Entry, len(idx.Entries))
+	for _, e := range idx.Entries {
+		if e.Stage == index.Merged {
+			entries[e.Name] = e
+		}
+	}
+
+	var candidates object.Changes
+	for _, ch := range changes {
+		a, err := ch.Action()
+		if err != nil {
+			return err
+		}
+
+		switch a {
+		case merkletrie.Delete:
+			name := ch.From.String()
+			e, err := tree.FindEntry(name)
+			if err != nil || !e.Mode.IsFile() {
+				continue
+			}
+
+			candidates = append(candidates, &object.Change{From: renameEntry(tree, name, e.Mode, e.Hash)})
+		case merkletrie.Insert:
+			name := ch.To.String()
+			e, ok := entries[name]
+			if !ok || !e.Mode.IsFile() || e.IntentToAdd {
+				continue
+			}
+
+			candidates = append(candidates, &object.Change{To: renameEntry(tree, name, e.Mode, e.Hash)})
+		}
+	}
+
+	if len(candidates) == 0 {
+		return nil
+	}
+
+	renames, err := object.DetectRenames(candidates, &object.DiffTreeOptions{
+		DetectRenames: true,
+		RenameScore:   50,
+	})
+	if err != nil {
+		return err
+	}
+
+	for _, ch := range renames {
+		if ch.Kind != object.Renamed {
+			continue
+		}
+
+		delete(s, ch.From.Name)
+		fs := s.File(ch.To.Name)
+		fs.Staging = Renamed
+		fs.Extra = ch.From.Name
+		fs.Similarity = ch.Similarity
+	}
+
+	return nil
+}
+
+// renameEntry returns the object.ChangeEntry of the file of the given path,
+// whose blob is read from the storer of tree.
+func renameEntry(tree *object.Tree, name string, mode filemode.FileMode, h plumbing.Hash) object.ChangeEntry {
+	return object.ChangeEntry{
+		Name:      name,
+		Tree:      tree,
+		TreeEntry: object.TreeEntry{Name: path.Base(name), Mode: mode, Hash: h},
+	}
+}
+
+// unmergedStatus reports the files of the unmerged entries of the index with
+// the pair of codes git status gives to their conflict, by the stages of
+// their entries: DD if only the common ancestor is left, AU or UA if only
+// added by ours or theirs, UD or DU if deleted by theirs or ours, AA if added
+// by both and UU if modified by both.
+func (w *Worktree) unmergedStatus(s Status) error {
+	idx, err := w.r.Storer.Index()
+	if err != nil {
+		return err
+	}
+
+	stages := make(map[string]int)
+	for _, e := range idx.Entries {
+		if e.Stage != index.Merged {
+			stages[e.Name] |= 1 << (e.Stage - 1)
+		}
+	}
+
+	for name, mask := range stages {
+		fs := s.File(name)
+		fs.Extra = ""
+		switch mask {
+		case 1:
+			fs.Staging, fs.Worktree = Deleted, Deleted
+		case 2:
+			fs.Staging, fs.Worktree = Added, UpdatedButUnmerged
+		case 4:
+			fs.Staging, fs.Worktree = UpdatedButUnmerged, Added
+		case 1 | 2:
+			fs.Staging, fs.Worktree = UpdatedButUnmerged, Deleted
+		case 1 | 4:
+			fs.Staging, fs.Worktree = Deleted, UpdatedButUnmerged
+		case 2 | 4:
+			fs.Staging, fs.Worktree = Added, Added
+		default:
+			fs.Staging, fs.Worktree = UpdatedButUnmerged, UpdatedButUnmerged
+		}
+	}
+
+	return nil
+}
+
+// intentToAddStatus reports the files of the intent-to-add entries of the
+// index as added in the working tree, as git does, instead of added in the
+// staging area, as they are not committed.
+func (w *Worktree) intentToAddStatus(s Status) error {
+	idx, err := w.r.Storer.Index()
+	if err != nil {
+		return err
+	}
+
+	for _, e := range idx.Entries {
+		if !e.IntentToAdd {
+			continue
+		}
+
+		fs := s.File(e.Name)
+		if fs.Staging == Added || fs.Staging == Untracked {
+			fs.Staging = Unmodified
+		}
+
+		if fs.Worktree != Deleted {
+			fs.Worktree = Added
+		}
+	}
+
+	return nil
 }
 
 func nameFromAction(ch *merkletrie.Change) string {
@@ -138,6 +375,25 @@ func (w *Worktree) diffStagingWithWorktree(reverse, excludeIgnoredChanges bool)
 		return nil, err
 	}
 
+	return w.diffIndexWithWorktree(idx, w.Filesystem, reverse, excludeIgnoredChanges, 0)
+}
+
+// diffStagingWithWorkers is diffStagingWithWorktree, hashing the tracked
+// files with the given number of workers.
+func (w *Worktree) diffStagingWithWorkers(workers int, excludeIgnoredChanges bool) (merkletrie.Changes, error) {
+	idx, err := w.r.Storer.Index()
+	if err != nil {
+		return nil, err
+	}
+
+	return w.diffIndexWithWorktree(idx, w.Filesystem, false, excludeIgnoredChanges, workers)
+}
+
+// diffIndexWithWorktree diffs idx with the worktree, read from fs. The files
+// whose stat data did not change since they were added to idx are not hashed,
+// unless they are racily clean. The other tracked files are hashed by the
+// given number of workers beforehand, if more than one.
+func (w *Worktree) diffIndexWithWorktree(idx *index.Index, fs billy.Filesystem, reverse, excludeIgnoredChanges bool, workers int) (merkletrie.Changes, error) {
 	cfg, err := w.r.Config()
 	if err != nil {
 		return nil, err
@@ -145,17 +401,46 @@ func (w *Worktree) diffStagingWithWorktree(reverse, excludeIgnoredChanges bool)
 
 	from := mindex.NewRootNodeWithOptions(idx, mindex.RootNodeOptions{
 		UpholdExecutableBit: cfg.Core.FileMode,
+		RegularSymlinks:     cfg.Raw.Section("core").Option("symlinks") == "false",
 	})
 	submodules, err := w.getSubmodulesStatus()
 	if err != nil {
 		return nil, err
 	}
 
-	fsOpts := filesystem.Options{
-		AutoCRLF: cfg.Core.AutoCRLF == "true" || cfg.Core.AutoCRLF == "input",
+	conv, err := w.newWorktreeConverter()
+	if err != nil {
+		return nil, err
+	}
+
+	entries := make(map[string]*index.Entry, len(idx.Entries))
+	for _, e := range idx.Entries {
+		if e.Stage == index.Merged {
+			entries[e.Name] = e
+		}
 	}
 
-	to := filesystem.NewRootNodeWithOptions(w.Filesystem, submodules, fsOpts)
+	to := filesystem.NewRootNodeWithOptions(fs, submodules, filesystem.Options{
+		Filter:       conv.filter,
+		ObjectFormat: cfg.Extensions.ObjectFormat,
+		Gitlink: func(path string) (plumbing.Hash, bool) {
+			return nestedRepositoryHead(fs, path)
+		},
+		Known: func(path string, fi os.FileInfo) (plumbing.Hash, bool) {
+			e, ok := entries[path]
+			if !ok || !isStatClean(idx, e, fi) {
+				return plumbing.ZeroHash, false
+			}
+
+			return e.Hash, true
+		},
+	})
+
+	if workers > 1 {
+		if err := hashTrackedNodes(to, entries, workers); err != nil {
+			return nil, err
+		}
+	}
 
 	var c merkletrie.Changes
 	if reverse {
@@ -169,26 +454,100 @@ func (w *Worktree) diffStagingWithWorktree(reverse, excludeIgnoredChanges bool)
 	}
 
 	if excludeIgnoredChanges {
-		return w.excludeIgnoredChanges(c), nil
+		return w.excludeIgnoredChanges(fs, c), nil
 	}
 	return c, nil
 }
 
-func (w *Worktree) excludeIgnoredChanges(changes merkletrie.Changes) merkletrie.Changes {
-	patterns, err := gitignore.ReadPatterns(w.Filesystem, nil)
+// isStatClean returns whether the file with the given info is unchanged
+// since it was added to idx as the given entry, as told by its stat data:
+// its size, modification time and mode. A racily clean entry isn't, as its
+// file could have been changed without changing its stat data.
+func isStatClean(idx *index.Index, e *index.Entry, fi os.FileInfo) bool {
+	if e.IntentToAdd || e.Mode == filemode.Submodule || idx.IsRacilyClean(e) {
+		return false
+	}
+
+	mode, err := filemode.NewFromOSFileMode(fi.Mode())
+	if err != nil {
+		return false
+	}
+
+	return mode == e.Mode && e.Size == uint32(fi.Size()) && e.ModifiedAt.Equal(fi.ModTime())
+}
+
+// hashTrackedNodes hashes the files of the tree of the given root which are
+// tracked by the given entries, by name, with the given number of workers,
+// the nodes caching their hash.
+func hashTrackedNodes(root noder.Noder, entries map[string]*index.Entry, workers int) error {
+	dirs := make(map[string]bool)
+	for name := range entries {
+		for dir := path.Dir(name); dir != "." && !dirs[dir]; dir = path.Dir(dir) {
+			dirs[dir] = true
+		}
+	}
+
+	files := make(chan noder.Noder, workers)
+	var wg sync.WaitGroup
+	for range workers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for n := range files {
+				n.Hash()
+			}
+		}()
+	}
+
+	var walk func(n noder.Noder) error
+	walk = func(n noder.Noder) error {
+		children, err := n.Children()
+		if err != nil {
+			return err
+		}
+
+		for _, child := range children {
+			name := child.String()
+			switch {
+			case child.IsDir() && dirs[name]:
+				if err := walk(child); err != nil {
+					return err
+				}
+			case !child.IsDir() && entries[name] != nil:
+				files <- child
+			}
+		}
+
+		return nil
+	}
+
+	err := walk(root)
+	close(files)
+	wg.Wait()
+	return err
+}
+
+func (w *Worktree) excludeIgnoredChanges(fs billy.Filesystem, changes merkletrie.Changes) merkletrie.Changes {
+	res, _ := w.splitIgnoredChanges(fs, changes)
+	return res
+}
+
+// splitIgnoredChanges splits the changes into the ones kept and the ones
+// inserting the files ignored by the patterns of fs and w.Excludes.
+func (w *Worktree) splitIgnoredChanges(fs billy.Filesystem, changes merkletrie.Changes) (res, ignored merkletrie.Changes) {
+	patterns, err := gitignore.ReadPatterns(fs, nil)
 	if err != nil {
-		return changes
+		return changes, nil
 	}
 
 	patterns = append(patterns, w.Excludes...)
 
 	if len(patterns) == 0 {
-		return changes
+		return changes, nil
 	}
 
 	m := gitignore.NewMatcher(patterns)
 
-	var res merkletrie.Changes
 	for _, ch := range changes {
 		var path []string
 		for _, n := range ch.To {
@@ -203,13 +562,14 @@ func (w *Worktree) excludeIgnoredChanges(changes merkletrie.Changes) merkletrie.
 			isDir := (len(ch.To) > 0 && ch.To.IsDir()) || (len(ch.From) > 0 && ch.From.IsDir())
 			if m.Match(path, isDir) {
 				if len(ch.From) == 0 {
+					ignored = append(ignored, ch)
 					continue
 				}
 			}
 		}
 		res = append(res, ch)
 	}
-	return res
+	return res, ignored
 }
 
 func (w *Worktree) getSubmodulesStatus() (map[string]plumbing.Hash, error) {
@@ -234,6 +594,29 @@ func (w *Worktree) getSubmodulesStatus() (map[string]plumbing.Hash, error) {
 		o[s.Path] = s.Current
 	}
 
+	// The directories of the gitlinks missing from .gitmodules match the
+	// commit of their repository, or the commit of the index if they are
+	// left empty.
+	idx, err := w.r.Storer.Index()
+	if err != nil {
+		return nil, err
+	}
+
+	for _, e := range idx.Entries {
+		if _, ok := o[e.Name]; ok || e.Mode != filemode.Submodule {
+			continue
+		}
+
+		if h, ok := nestedRepositoryHead(w.Filesystem, e.Name); ok && !h.IsZero() {
+			o[e.Name] = h
+			continue
+		}
+
+		if fi, err := w.Filesystem.Lstat(e.Name); err == nil && fi.IsDir() {
+			o[e.Name] = e.Hash
+		}
+	}
+
 	return o, nil
 }
 
@@ -350,6 +733,10 @@ func (w *Worktree) AddWithOptions(opts *AddOptions) error {
 		return err
 	}
 
+	if len(opts.PathSpec) > 0 || opts.Update || opts.All && opts.Force {
+		return w.addPathSpec(opts)
+	}
+
 	if opts.All {
 		_, err := w.doAdd(".", w.Excludes, false)
 		return err
@@ -363,6 +750,97 @@ func (w *Worktree) AddWithOptions(opts *AddOptions) error {
 	return err
 }
 
+// addPathSpec stages the changes of the worktree matching the pathspec of
+// opts, updating the index once all of them are staged.
+func (w *Worktree) addPathSpec(opts *AddOptions) error {
+	ps, err := pathspec.Parse(opts.PathSpec)
+	if err != nil {
+		return err
+	}
+
+	idx, err := w.r.Storer.Index()
+	if err != nil {
+		return err
+	}
+
+	changes, err := w.diffStagingWithWorktree(false, false)
+	if err != nil {
+		return err
+	}
+
+	notIgnored := make(map[string]bool)
+	for _, ch := range w.excludeIgnoredChanges(w.Filesystem, changes) {
+		notIgnored[nameFromAction(&ch)] = true
+	}
+
+	// matched records, for each item of the pathspec, whether it matches a
+	// file to add or a tracked file, or only ignored files.
+	const (
+		matchedNone = iota
+		matchedIgnored
+		matchedFile
+	)
+
+	matched := make([]int, len(ps))
+	match := func(name string, result int) {
+		for i, p := range ps {
+			if !p.Exclude && p.Match(name) {
+				matched[i] = max(matched[i], result)
+			}
+		}
+	}
+
+	for _, e := range idx.Entries {
+		if ps.Match(e.Name) {
+			match(e.Name, matchedFile)
+		}
+	}
+
+	var names []string
+	for _, ch := range changes {
+		name := nameFromAction(&ch)
+		if !ps.Match(name) {
+			continue
+		}
+
+		// Only the new files are not in the index, and skipped by Update.
+		tracked := ch.From != nil
+		if !tracked && opts.Update {
+			continue
+		}
+
+		if !tracked && !notIgnored[name] && !opts.Force {
+			match(name, matchedIgnored)
+			continue
+		}
+
+		match(name, matchedFile)
+		names = append(names, name)
+	}
+
+	for i, p := range ps {
+		switch {
+		case p.Exclude || matched[i] == matchedFile:
+		case matched[i] == matchedIgnored:
+			return fmt.Errorf("%w: %s", ErrPathIgnored, opts.PathSpec[i])
+		default:
+			return fmt.Errorf("%w: %s", ErrPathSpecNoMatches, opts.PathSpec[i])
+		}
+	}
+
+	if len(names) == 0 {
+		return nil
+	}
+
+	for _, name := range names {
+		if _, _, err := w.doAddFile(idx, nil, name, nil); err != nil {
+			return err
+		}
+	}
+
+	return w.r.Storer.SetIndex(idx)
+}
+
 func (w *Worktree) doAdd(path string, ignorePattern []gitignore.Pattern, skipStatus bool) (plumbing.Hash, error) {
 	idx, err := w.r.Storer.Index()
 	if err != nil {
@@ -386,7 +864,8 @@ func (w *Worktree) doAdd(path string, ignorePattern []gitignore.Pattern, skipSta
 
 	path = filepath.Clean(path)
 
-	if err != nil || !fi.IsDir() {
+	// The nested repositories are added as gitlinks, not recursed into.
+	if _, isGitlink := nestedRepositoryHead(w.Filesystem, path); err != nil || !fi.IsDir() || isGitlink {
 		added, h, err = w.doAddFile(idx, s, path, ignorePattern)
 	} else {
 		added, err = w.doAddDirectory(idx, s, path, ignorePattern)
@@ -457,6 +936,71 @@ func (w *Worktree) AddGlob(pattern string) error {
 	return nil
 }
 
+// AddIntent records that the file at the given path will be added later, as
+// `git add -N` does, or the untracked files of the directory. The file is
+// staged as an intent-to-add entry, whose content is empty: it is reported as
+// added in the working tree by Status, but not in the staging area, and is
+// left out of the commits until added with Add. The ignored files are not
+// recorded, and the tracked files are left untouched.
+func (w *Worktree) AddIntent(path string) error {
+	idx, err := w.r.Storer.Index()
+	if err != nil {
+		return err
+	}
+
+	changes, err := w.diffStagingWithWorktree(false, true)
+	if err != nil {
+		return err
+	}
+
+	path = filepath.ToSlash(filepath.Clean(path))
+	var names []string
+	for _, ch := range changes {
+		if ch.From != nil {
+			continue
+		}
+
+		if name := ch.To.String(); name == path || isPathInDirectory(name, path) {
+			names = append(names, name)
+		}
+	}
+
+	if len(names) == 0 {
+		fi, err := w.Filesystem.Lstat(path)
+		if err != nil {
+			return err
+		}
+
+		if _, err := idx.Entry(path); err != nil && !fi.IsDir() {
+			return fmt.Errorf("%w: %s", ErrPathIgnored, path)
+		}
+
+		return nil
+	}
+
+	empty := w.r.Storer.NewEncodedObject()
+	empty.SetType(plumbing.BlobObject)
+	h, err := w.r.Storer.SetEncodedObject(empty)
+	if err != nil {
+		return err
+	}
+
+	for _, name := range names {
+		if err := w.doAddFileToIndex(idx, name, h); err != nil {
+			return err
+		}
+
+		e, err := idx.Entry(name)
+		if err != nil {
+			return err
+		}
+
+		e.IntentToAdd = true
+	}
+
+	return w.r.Storer.SetIndex(idx)
+}
+
 // doAddFile create a new blob from path and update the index, added is true if
 // the file added is different from the index.
 // if s status is nil will skip the status check and update the index anyway
@@ -473,7 +1017,15 @@ func (w *Worktree) doAddFile(idx *index.Index, s Status, path string, ignorePatt
 		}
 	}
 
-	h, err = w.copyFileToStorage(path)
+	if gitlink, ok := nestedRepositoryHead(w.Filesystem, path); ok {
+		if gitlink.IsZero() {
+			return false, h, fmt.Errorf("%w: %s", ErrGitlinkWithoutCommit, path)
+		}
+
+		return true, gitlink, w.addOrUpdateFileToIndex(idx, path, gitlink)
+	}
+
+	h, err = w.copyFileToStorage(w.r.Storer, path)
 	if err != nil {
 		if os.IsNotExist(err) {
 			added = true
@@ -490,13 +1042,13 @@ func (w *Worktree) doAddFile(idx *index.Index, s Status, path string, ignorePatt
 	return true, h, err
 }
 
-func (w *Worktree) copyFileToStorage(path string) (hash plumbing.Hash, err error) {
+func (w *Worktree) copyFileToStorage(s storer.EncodedObjectStorer, path string) (hash plumbing.Hash, err error) {
 	fi, err := w.Filesystem.Lstat(path)
 	if err != nil {
 		return plumbing.ZeroHash, err
 	}
 
-	obj := w.r.Storer.NewEncodedObject()
+	obj := s.NewEncodedObject()
 	obj.SetType(plumbing.BlobObject)
 	obj.SetSize(fi.Size())
 
@@ -517,7 +1069,7 @@ func (w *Worktree) copyFileToStorage(path string) (hash plumbing.Hash, err error
 		return plumbing.ZeroHash, err
 	}
 
-	return w.r.Storer.SetEncodedObject(obj)
+	return s.SetEncodedObject(obj)
 }
 
 func (w *Worktree) fillEncodedObjectFromFile(dst io.Writer, path string, _ os.FileInfo) (err error) {
@@ -527,31 +1079,17 @@ func (w *Worktree) fillEncodedObjectFromFile(dst io.Writer, path string, _ os.Fi
 	}
 	defer ioutil.CheckClose(file, &err)
 
-	cfg, err := w.r.Config()
+	conv, err := w.newWorktreeConverter()
 	if err != nil {
 		return err
 	}
 
-	switch cfg.Core.AutoCRLF {
-	case "true", "input":
-		br := sync.GetBufioReader(file)
-		defer sync.PutBufioReader(br)
-
-		stat, err := convert.GetStat(br)
-		if err != nil {
-			return err
-		}
-
-		if _, err = file.Seek(0, io.SeekStart); err != nil {
-			return err
-		}
-
-		if !stat.IsBinary() {
-			dst = convert.NewLFWriter(dst)
-		}
+	src, err := conv.toGit(path, file)
+	if err != nil {
+		return err
 	}
 
-	_, err = ioutil.CopyBufferPool(dst, file)
+	_, err = ioutil.CopyBufferPool(dst, src)
 	return err
 }
 
@@ -566,6 +1104,10 @@ func (w *Worktree) fillEncodedObjectFromSymlink(dst io.Writer, path string, _ os
 }
 
 func (w *Worktree) addOrUpdateFileToIndex(idx *index.Index, filename string, h plumbing.Hash) error {
+	// Adding a file resolves its conflict, if any: the entries of the stages
+	// of the merge are replaced by a single one.
+	removeUnmergedEntries(idx, filename)
+
 	e, err := idx.Entry(filename)
 	if err != nil && !errors.Is(err, index.ErrEntryNotFound) {
 		return err
@@ -578,6 +1120,24 @@ func (w *Worktree) addOrUpdateFileToIndex(idx *index.Index, filename string, h p
 	return w.doUpdateFileToIndex(e, filename, h)
 }
 
+// removeUnmergedEntries removes the entries of the stages of a merge from
+// the index, for the given path or for all of them if empty. It returns
+// true if any entry was removed.
+func removeUnmergedEntries(idx *index.Index, path string) bool {
+	path = filepath.ToSlash(path)
+	n := len(idx.Entries)
+	idx.Entries = slices.DeleteFunc(idx.Entries, func(e *index.Entry) bool {
+		if e.Stage == index.Merged || path != "" && e.Name != path {
+			return false
+		}
+
+		idx.UntrackedCache.Invalidate(e.Name)
+		return true
+	})
+
+	return len(idx.Entries) != n
+}
+
 func (w *Worktree) doAddFileToIndex(idx *index.Index, filename string, h plumbing.Hash) error {
 	return w.doUpdateFileToIndex(idx.Add(filename), filename, h)
 }
@@ -588,98 +1148,242 @@ func (w *Worktree) doUpdateFileToIndex(e *index.Entry, filename string, h plumbi
 		return err
 	}
 
-	e.Hash = h
-	e.ModifiedAt = info.ModTime()
-	e.Mode, err = filemode.NewFromOSFileMode(info.Mode())
+	mode, err := filemode.NewFromOSFileMode(info.Mode())
 	if err != nil {
 		return err
 	}
 
+	if info.IsDir() {
+		mode = filemode.Submodule
+	}
+
+	e.Mode, err = w.indexMode(e.Mode, mode)
+	if err != nil {
+		return err
+	}
+
+	e.Hash = h
+	e.IntentToAdd = false
+	e.ModifiedAt = info.ModTime()
+
 	// The entry size must always reflect the current state, otherwise
 	// it will cause go-git's Worktree.Status() to divert from "git status".
 	// The size of a symlink is the length of the path to the target.
 	// The size of Regular and Executable files is the size of the files.
-	e.Size = uint32(info.Size())
+	// The size of a gitlink is zero.
+	e.Size = 0
+	if mode != filemode.Submodule {
+		e.Size = uint32(info.Size())
+	}
 
 	fillSystemInfo(e, info.Sys())
 	return nil
 }
 
-// Remove removes files from the working tree and from the index.
+// indexMode returns the mode of the entry of the index of a file whose mode
+// in the worktree is mode, the entry having the mode old, empty if new. As
+// git does, the mode of the entry is kept when the worktree does not record
+// it: the executable bit when core.fileMode is false, the new files being
+// regular ones, and the symlinks written as regular files when core.symlinks
+// is false.
+func (w *Worktree) indexMode(old, mode filemode.FileMode) (filemode.FileMode, error) {
+	// The config is only read when the mode may have been lost.
+	switch {
+	case mode == filemode.Executable:
+	case mode == filemode.Regular && (old == filemode.Executable || old == filemode.Symlink):
+	default:
+		return mode, nil
+	}
+
+	cfg, err := w.r.Config()
+	if err != nil {
+		return filemode.Empty, err
+	}
+
+	switch {
+	case old == filemode.Symlink && cfg.Raw.Section("core").Option("symlinks") == "false":
+		return old, nil
+	case !cfg.Core.FileMode && (old == filemode.Regular || old == filemode.Executable):
+		return old, nil
+	case !cfg.Core.FileMode:
+		return filemode.Regular, nil
+	}
+
+	return mode, nil
+}
+
+// Remove removes files from the working tree and from the index, a directory
+// being removed recursively. As `git rm`, the files with changes, staged or
+// not, are not removed, use RemoveWithOptions and RemoveOptions.Force to
+// remove them.
 func (w *Worktree) Remove(path string) (plumbing.Hash, error) {
 	// TODO(mcuadros): remove plumbing.Hash from signature at v5.
+	return w.remove(&RemoveOptions{Path: path})
+}
+
+// RemoveGlob removes all paths, matching pattern, from the index and the
+// working tree. If pattern matches a directory path, all directory contents
+// are removed recursively. As Remove, the files with changes are not removed.
+func (w *Worktree) RemoveGlob(pattern string) error {
+	_, err := w.remove(&RemoveOptions{Glob: pattern})
+	return err
+}
+
+// RemoveWithOptions removes files from the index, and from the working tree
+// unless RemoveOptions.Cached is set, as `git rm` does.
+func (w *Worktree) RemoveWithOptions(opts *RemoveOptions) error {
+	if err := opts.Validate(); err != nil {
+		return err
+	}
+
+	_, err := w.remove(opts)
+	return err
+}
+
+// remove removes the files given by opts, returning the hash of the removed
+// file if it is given by its path.
+func (w *Worktree) remove(opts *RemoveOptions) (plumbing.Hash, error) {
 	idx, err := w.r.Storer.Index()
 	if err != nil {
 		return plumbing.ZeroHash, err
 	}
 
+	names, single, err := removedEntries(idx, opts)
+	if err != nil {
+		return plumbing.ZeroHash, err
+	}
+
+	if !opts.Force {
+		if err := w.checkRemove(names, opts.Cached); err != nil {
+			return plumbing.ZeroHash, err
+		}
+	}
+
 	var h plumbing.Hash
+	for _, name := range names {
+		if h, err = w.deleteFromIndex(idx, name); err != nil {
+			return plumbing.ZeroHash, err
+		}
 
-	fi, err := w.Filesystem.Lstat(path)
-	if err != nil || !fi.IsDir() {
-		h, err = w.doRemoveFile(idx, path)
-	} else {
-		_, err = w.doRemoveDirectory(idx, path)
+		removeUnmergedEntries(idx, name)
+		if opts.Cached {
+			continue
+		}
+
+		if err := w.deleteFromFilesystem(filepath.FromSlash(name)); err != nil {
+			return h, err
+		}
+
+		if err := w.removeEmptyDirectories(path.Dir(name)); err != nil {
+			return h, err
+		}
 	}
-	if err != nil {
-		return h, err
+
+	if !single {
+		h = plumbing.ZeroHash
 	}
 
 	return h, w.r.Storer.SetIndex(idx)
 }
 
-func (w *Worktree) doRemoveDirectory(idx *index.Index, directory string) (removed bool, err error) {
-	files, err := w.Filesystem.ReadDir(directory)
-	if err != nil {
-		return false, err
+// removedEntries returns the names of the index entries removed by opts, and
+// whether a single file is removed by its path. A path naming no entry is
+// returned as is.
+func removedEntries(idx *index.Index, opts *RemoveOptions) ([]string, bool, error) {
+	var names []string
+	add := func(name string) {
+		if !slices.Contains(names, name) {
+			names = append(names, name)
+		}
 	}
 
-	for _, file := range files {
-		name := path.Join(directory, file.Name())
-
-		var r bool
-		if file.IsDir() {
-			r, err = w.doRemoveDirectory(idx, name)
-		} else {
-			_, err = w.doRemoveFile(idx, name)
-			if errors.Is(err, index.ErrEntryNotFound) {
-				err = nil
-			}
+	if opts.Glob != "" {
+		entries, err := idx.Glob(opts.Glob)
+		if err != nil {
+			return nil, false, err
 		}
 
-		if err != nil {
-			return removed, err
+		for _, e := range entries {
+			add(e.Name)
 		}
 
-		if !removed && r {
-			removed = true
+		return names, false, nil
+	}
+
+	name := path.Clean(filepath.ToSlash(opts.Path))
+	if _, err := idx.Entry(name); err == nil {
+		return []string{name}, true, nil
+	}
+
+	// A directory is removed recursively, even if it was deleted from the
+	// worktree.
+	for _, e := range idx.Entries {
+		if name == "." || strings.HasPrefix(e.Name, name+"/") {
+			add(e.Name)
 		}
 	}
 
-	err = w.removeEmptyDirectory(directory)
-	return removed, err
+	if len(names) == 0 {
+		return []string{name}, true, nil
+	}
+
+	return names, false, nil
 }
 
-func (w *Worktree) removeEmptyDirectory(path string) error {
-	files, err := w.Filesystem.ReadDir(path)
+// checkRemove returns an error if any of the files can't be removed without
+// losing its changes, as git rm does. The staged changes of a file are kept if
+// only removed from the index, unless the file differs from them.
+func (w *Worktree) checkRemove(names []string, cached bool) error {
+	status, err := w.Status()
 	if err != nil {
 		return err
 	}
 
-	if len(files) != 0 {
-		return nil
+	for _, name := range names {
+		fs, ok := status[name]
+		if !ok || fs.Worktree == Deleted || fs.unmerged() {
+			continue
+		}
+
+		staged := fs.Staging != Unmodified && fs.Staging != Untracked
+		local := fs.Worktree != Unmodified && fs.Worktree != Untracked
+		switch {
+		case staged && local:
+			return fmt.Errorf("cannot remove %s: %w", name, ErrStagedContentDiffers)
+		case cached:
+		case staged:
+			return fmt.Errorf("cannot remove %s: %w", name, ErrStagedChanges)
+		case local:
+			return fmt.Errorf("cannot remove %s: %w", name, ErrLocalModifications)
+		}
 	}
 
-	return w.Filesystem.Remove(path)
+	return nil
 }
 
-func (w *Worktree) doRemoveFile(idx *index.Index, path string) (plumbing.Hash, error) {
-	hash, err := w.deleteFromIndex(idx, path)
-	if err != nil {
-		return plumbing.ZeroHash, err
+// removeEmptyDirectories removes the directory if it is empty, and then its
+// leading directories which become empty, as git does.
+func (w *Worktree) removeEmptyDirectories(dir string) error {
+	for ; dir != "." && dir != "/"; dir = path.Dir(dir) {
+		files, err := w.Filesystem.ReadDir(filepath.FromSlash(dir))
+		if os.IsNotExist(err) {
+			continue
+		}
+
+		if err != nil {
+			return err
+		}
+
+		if len(files) != 0 {
+			return nil
+		}
+
+		if err := w.Filesystem.Remove(filepath.FromSlash(dir)); err != nil {
+			return err
+		}
 	}
 
-	return hash, w.deleteFromFilesystem(path)
+	return nil
 }
 
 func (w *Worktree) deleteFromIndex(idx *index.Index, path string) (plumbing.Hash, error) {
@@ -700,59 +1404,59 @@ func (w *Worktree) deleteFromFilesystem(path string) error {
 	return err
 }
 
-// RemoveGlob removes all paths, matching pattern, from the index. If pattern
-// matches a directory path, all directory contents are removed from the index
-// recursively.
-func (w *Worktree) RemoveGlob(pattern string) error {
-	idx, err := w.r.Storer.Index()
-	if err != nil {
-		return err
-	}
+// Move moves or renames a file or a directory in the worktree and the index,
+// as `git mv` does. A file moved to an existing directory is moved into it.
+// ErrDestinationExists is returned if the destination exists, use
+// MoveWithOptions and MoveOptions.Force to overwrite a file.
+func (w *Worktree) Move(from, to string) (plumbing.Hash, error) {
+	return w.MoveWithOptions(from, to, &MoveOptions{})
+}
 
-	entries, err := idx.Glob(pattern)
+// MoveWithOptions moves or renames a file or a directory in the worktree and
+// the index, returning the hash of the moved file, or a zero hash for a
+// directory.
+func (w *Worktree) MoveWithOptions(from, to string, opts *MoveOptions) (plumbing.Hash, error) {
+	fi, err := w.Filesystem.Lstat(from)
 	if err != nil {
-		return err
+		return plumbing.ZeroHash, err
 	}
 
-	for _, e := range entries {
-		file := filepath.FromSlash(e.Name)
-		if _, err := w.Filesystem.Lstat(file); err != nil && !os.IsNotExist(err) {
-			return err
-		}
-
-		if _, err := w.doRemoveFile(idx, file); err != nil {
-			return err
-		}
+	if fi, err := w.Filesystem.Lstat(to); err == nil && fi.IsDir() {
+		to = w.Filesystem.Join(to, path.Base(filepath.ToSlash(from)))
+	}
 
-		dir, _ := filepath.Split(file)
-		if err := w.removeEmptyDirectory(dir); err != nil {
-			return err
-		}
+	idx, err := w.r.Storer.Index()
+	if err != nil {
+		return plumbing.ZeroHash, err
 	}
 
-	return w.r.Storer.SetIndex(idx)
-}
+	if fi.IsDir() {
+		if err := w.moveDirectory(idx, from, to); err != nil {
+			return plumbing.ZeroHash, err
+		}
 
-// Move moves or rename a file in the worktree and the index, directories are
-// not supported.
-func (w *Worktree) Move(from, to string) (plumbing.Hash, error) {
-	// TODO(mcuadros): support directories and/or implement support for glob
-	if _, err := w.Filesystem.Lstat(from); err != nil {
-		return plumbing.ZeroHash, err
+		return plumbing.ZeroHash, w.r.Storer.SetIndex(idx)
 	}
 
-	if _, err := w.Filesystem.Lstat(to); err == nil {
+	dst, err := w.Filesystem.Lstat(to)
+	if err == nil && (!opts.Force || dst.IsDir()) {
 		return plumbing.ZeroHash, ErrDestinationExists
 	}
 
-	idx, err := w.r.Storer.Index()
+	hash, err := w.deleteFromIndex(idx, from)
 	if err != nil {
 		return plumbing.ZeroHash, err
 	}
 
-	hash, err := w.deleteFromIndex(idx, from)
-	if err != nil {
-		return plumbing.ZeroHash, err
+	if dst != nil {
+		// The overwritten file is replaced in the index as well.
+		if _, err := w.deleteFromIndex(idx, to); err != nil && !errors.Is(err, index.ErrEntryNotFound) {
+			return hash, err
+		}
+
+		if err := w.Filesystem.Remove(to); err != nil {
+			return hash, err
+		}
 	}
 
 	if err := w.Filesystem.Rename(from, to); err != nil {
@@ -765,3 +1469,40 @@ func (w *Worktree) Move(from, to string) (plumbing.Hash, error) {
 
 	return hash, w.r.Storer.SetIndex(idx)
 }
+
+// moveDirectory moves the directory, and renames the entries of its files in
+// the index, keeping them as they are staged.
+func (w *Worktree) moveDirectory(idx *index.Index, from, to string) error {
+	if _, err := w.Filesystem.Lstat(to); err == nil {
+		return ErrDestinationExists
+	}
+
+	src := path.Clean(filepath.ToSlash(from)) + "/"
+	dst := path.Clean(filepath.ToSlash(to)) + "/"
+	if strings.HasPrefix(dst, src) {
+		return fmt.Errorf("cannot move %s into itself", from)
+	}
+
+	var entries []*index.Entry
+	for _, e := range idx.Entries {
+		if strings.HasPrefix(e.Name, src) {
+			entries = append(entries, e)
+		}
+	}
+
+	if len(entries) == 0 {
+		return fmt.Errorf("%w: %s", index.ErrEntryNotFound, from)
+	}
+
+	if err := w.Filesystem.Rename(from, to); err != nil {
+		return err
+	}
+
+	for _, e := range entries {
+		idx.UntrackedCache.Invalidate(e.Name)
+		e.Name = dst + strings.TrimPrefix(e.Name, src)
+		idx.UntrackedCache.Invalidate(e.Name)
+	}
+
+	return nil
+}
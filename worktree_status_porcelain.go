@@ -0,0 +1,361 @@
+package git
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/go-git/go-git/v6/plumbing"
+	"github.com/go-git/go-git/v6/plumbing/filemode"
+	"github.com/go-git/go-git/v6/plumbing/format/index"
+	"github.com/go-git/go-git/v6/plumbing/object"
+)
+
+// StatusFormat is the format of the status written by Worktree.WriteStatus.
+type StatusFormat int
+
+const (
+	// StatusPorcelain is the format of git status --porcelain: a line "XY
+	// path" by file, X being its status in the staging area and Y its status
+	// in the worktree, or "XY orig -> path" for a rename.
+	StatusPorcelain StatusFormat = iota
+	// StatusPorcelainV2 is the format of git status --porcelain=v2, which
+	// also gives the modes and the hashes of the files changed, in HEAD, the
+	// index and the worktree.
+	StatusPorcelainV2
+)
+
+// WriteStatus writes the status of the worktree, given by StatusWithOptions
+// with the given options, to out in the given format, as git status does:
+// the files changed, sorted by path, then the untracked files and the ignored
+// files if o.Ignored, the untracked directories holding no tracked file being
+// given as a whole, as "dir/". The paths are quoted as git does when they
+// hold special characters, and in the porcelain format when they hold
+// spaces.
+func (w *Worktree) WriteStatus(out io.Writer, f StatusFormat, o StatusOptions) error {
+	if f != StatusPorcelain && f != StatusPorcelainV2 {
+		return fmt.Errorf("unknown status format: %d", f)
+	}
+
+	var commit plumbing.Hash
+	ref, err := w.r.Head()
+	if err == nil {
+		commit = ref.Hash()
+	} else if !errors.Is(err, plumbing.ErrReferenceNotFound) {
+		return err
+	}
+
+	s, err := w.status(o, commit)
+	if err != nil {
+		return err
+	}
+
+	idx, err := w.r.Storer.Index()
+	if err != nil {
+		return err
+	}
+
+	sw := &statusWriter{w: w, idx: idx, format: f}
+	if !commit.IsZero() {
+		c, err := w.r.CommitObject(commit)
+		if err != nil {
+			return err
+		}
+
+		if sw.head, err = c.Tree(); err != nil {
+			return err
+		}
+	}
+
+	var changed, untracked, ignored []string
+	for name, fs := range s {
+		switch {
+		case fs.Staging == Ignored:
+			ignored = append(ignored, name)
+		case fs.Worktree == Untracked:
+			untracked = append(untracked, name)
+			if fs.Staging == Deleted {
+				changed = append(changed, name)
+			}
+		case fs.Staging != Unmodified || fs.Worktree != Unmodified:
+			changed = append(changed, name)
+		}
+	}
+
+	sort.Strings(changed)
+	untracked, ignored = collapseUntracked(idx, untracked, ignored)
+
+	bw := bufio.NewWriter(out)
+	for _, name := range changed {
+		if err := sw.writeChanged(bw, name, s[name]); err != nil {
+			return err
+		}
+	}
+
+	for _, name := range untracked {
+		sw.writeOther(bw, Untracked, name)
+	}
+
+	for _, name := range ignored {
+		sw.writeOther(bw, Ignored, name)
+	}
+
+	return bw.Flush()
+}
+
+// collapseUntracked returns the sorted paths of the untracked and ignored
+// files to report, as git status does: the top-most untracked directory
+// holding a file, that is none of whose files is tracked, is reported as a
+// whole, as "dir/", instead of its files, and so is the top-most one holding
+// an ignored file whose files are all ignored.
+func collapseUntracked(idx *index.Index, untracked, ignored []string) ([]string, []string) {
+	tracked := make(map[string]bool)
+	for _, e := range idx.Entries {
+		for dir := path.Dir(e.Name); dir != "." && !tracked[dir]; dir = path.Dir(dir) {
+			tracked[dir] = true
+		}
+	}
+
+	dirty := make(map[string]bool)
+	for _, name := range untracked {
+		for dir := path.Dir(name); dir != "." && !dirty[dir]; dir = path.Dir(dir) {
+			dirty[dir] = true
+		}
+	}
+
+	collapse := func(names []string, keep func(dir string) bool) []string {
+		seen := make(map[string]bool)
+		var res []string
+		for _, name := range names {
+			parts := strings.Split(name, "/")
+			for i := 1; i < len(parts); i++ {
+				dir := strings.Join(parts[:i], "/")
+				if !tracked[dir] && keep(dir) {
+					name = dir + "/"
+					break
+				}
+			}
+
+			if !seen[name] {
+				seen[name] = true
+				res = append(res, name)
+			}
+		}
+
+		sort.Strings(res)
+		return res
+	}
+
+	untracked = collapse(untracked, func(string) bool { return true })
+	ignored = collapse(ignored, func(dir string) bool { return !dirty[dir] })
+	return untracked, ignored
+}
+
+// statusWriter writes the lines of WriteStatus.
+type statusWriter struct {
+	w      *Worktree
+	idx    *index.Index
+	head   *object.Tree
+	format StatusFormat
+}
+
+func (sw *statusWriter) writeChanged(out io.Writer, name string, fs *FileStatus) error {
+	x, y := fs.Staging, fs.Worktree
+	if y == Untracked {
+		// The file deleted from the index, whose file is reported again as
+		// untracked.
+		y = Unmodified
+	}
+
+	if sw.format == StatusPorcelain {
+		p := quoteStatusPath(name, true)
+		if x == Renamed {
+			p = quoteStatusPath(fs.Extra, true) + " -> " + p
+		}
+
+		_, err := fmt.Fprintf(out, "%c%c %s\n", x, y, p)
+		return err
+	}
+
+	xy := string(porcelainV2Code(x)) + string(porcelainV2Code(y))
+	if fs.unmerged() {
+		return sw.writeUnmerged(out, xy, name)
+	}
+
+	headName := name
+	if x == Renamed {
+		headName = fs.Extra
+	}
+
+	mH, hH := sw.headEntry(headName)
+	var mI filemode.FileMode
+	hI := plumbing.ZeroHash
+	for _, e := range sw.idx.Entries {
+		if e.Name == name && e.Stage == index.Merged && !e.IntentToAdd {
+			mI, hI = e.Mode, e.Hash
+			break
+		}
+	}
+
+	mW := sw.worktreeMode(name, mI, y)
+	sub := "N..."
+	if mH == filemode.Submodule || mI == filemode.Submodule {
+		sub = "S..."
+		if y == Modified {
+			sub = "SC.."
+		}
+	}
+
+	var err error
+	if x == Renamed {
+		_, err = fmt.Fprintf(out, "2 %s %s %06o %06o %06o %s %s R%d %s\t%s\n", xy, sub, mH, mI, mW, hH, hI,
+			fs.Similarity, quoteStatusPath(name, false), quoteStatusPath(fs.Extra, false))
+	} else {
+		_, err = fmt.Fprintf(out, "1 %s %s %06o %06o %06o %s %s %s\n", xy, sub, mH, mI, mW, hH, hI,
+			quoteStatusPath(name, false))
+	}
+
+	return err
+}
+
+// writeUnmerged writes the line of the unmerged file of the given name, in
+// the porcelain v2 format, with the modes and the hashes of its stages.
+func (sw *statusWriter) writeUnmerged(out io.Writer, xy, name string) error {
+	var modes [3]filemode.FileMode
+	var hashes [3]plumbing.Hash
+	for i := range hashes {
+		hashes[i] = plumbing.ZeroHash
+	}
+
+	for _, e := range sw.idx.Entries {
+		if e.Name == name && e.Stage != index.Merged {
+			modes[e.Stage-1], hashes[e.Stage-1] = e.Mode, e.Hash
+		}
+	}
+
+	var mW filemode.FileMode
+	if fi, err := sw.w.Filesystem.Lstat(name); err == nil {
+		mW, _ = filemode.NewFromOSFileMode(fi.Mode())
+	}
+
+	_, err := fmt.Fprintf(out, "u %s N... %06o %06o %06o %06o %s %s %s %s\n", xy,
+		modes[0], modes[1], modes[2], mW, hashes[0], hashes[1], hashes[2], quoteStatusPath(name, false))
+	return err
+}
+
+// headEntry returns the mode and the hash of the file of the given name in
+// HEAD, or zeroes if it isn't there.
+func (sw *statusWriter) headEntry(name string) (filemode.FileMode, plumbing.Hash) {
+	if sw.head == nil {
+		return filemode.Empty, plumbing.ZeroHash
+	}
+
+	e, err := sw.head.FindEntry(name)
+	if err != nil {
+		return filemode.Empty, plumbing.ZeroHash
+	}
+
+	return e.Mode, e.Hash
+}
+
+// worktreeMode returns the mode of the file of the given name in the
+// worktree, given its mode in the index and its status in the worktree.
+func (sw *statusWriter) worktreeMode(name string, indexMode filemode.FileMode, code StatusCode) filemode.FileMode {
+	switch code {
+	case Unmodified:
+		return indexMode
+	case Deleted:
+		return filemode.Empty
+	}
+
+	fi, err := sw.w.Filesystem.Lstat(name)
+	if err != nil {
+		return filemode.Empty
+	}
+
+	if fi.IsDir() {
+		return filemode.Submodule
+	}
+
+	mode, err := filemode.NewFromOSFileMode(fi.Mode())
+	if err != nil {
+		return filemode.Empty
+	}
+
+	return mode
+}
+
+func (sw *statusWriter) writeOther(out io.Writer, code StatusCode, name string) {
+	p := quoteStatusPath(name, sw.format == StatusPorcelain)
+	if sw.format == StatusPorcelain {
+		fmt.Fprintf(out, "%c%c %s\n", code, code, p)
+		return
+	}
+
+	fmt.Fprintf(out, "%c %s\n", code, p)
+}
+
+// porcelainV2Code returns the code of the status in the porcelain v2 format,
+// which gives the unmodified files as '.'.
+func porcelainV2Code(c StatusCode) StatusCode {
+	if c == Unmodified {
+		return '.'
+	}
+
+	return c
+}
+
+// quoteStatusPath quotes the path as git does, if it holds a double quote, a
+// backslash, a control character or a byte which isn't ASCII, or a space if
+// spaces is true, as in the porcelain format. The special characters are
+// escaped, as in C, the bytes which aren't ASCII as octal.
+func quoteStatusPath(p string, spaces bool) string {
+	quote := false
+	for i := 0; i < len(p); i++ {
+		if c := p[i]; c < 0x20 || c >= 0x7f || c == '"' || c == '\\' || spaces && c == ' ' {
+			quote = true
+			break
+		}
+	}
+
+	if !quote {
+		return p
+	}
+
+	var b strings.Builder
+	b.WriteByte('"')
+	for i := 0; i < len(p); i++ {
+		switch c := p[i]; c {
+		case '"', '\\':
+			b.WriteByte('\\')
+			b.WriteByte(c)
+		case '\a':
+			b.WriteString(`\a`)
+		case '\b':
+			b.WriteString(`\b`)
+		case '\t':
+			b.WriteString(`\t`)
+		case '\n':
+			b.WriteString(`\n`)
+		case '\v':
+			b.WriteString(`\v`)
+		case '\f':
+			b.WriteString(`\f`)
+		case '\r':
+			b.WriteString(`\r`)
+		default:
+			if c < 0x20 || c >= 0x7f {
+				fmt.Fprintf(&b, `\%03o`, c)
+			} else {
+				b.WriteByte(c)
+			}
+		}
+	}
+
+	b.WriteByte('"')
+	return b.String()
+}
@@ -0,0 +1,188 @@
+package git
+
+import (
+	"bytes"
+	"os/exec"
+	"strings"
+	"testing"
+
+	"github.com/go-git/go-billy/v6/memfs"
+	"github.com/go-git/go-billy/v6/osfs"
+	"github.com/go-git/go-billy/v6/util"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/go-git/go-git/v6/plumbing/format/index"
+	"github.com/go-git/go-git/v6/storage/memory"
+)
+
+func TestQuoteStatusPath(t *testing.T) {
+	t.Parallel()
+
+	for _, tc := range []struct {
+		path, quoted, spaces string
+	}{
+		{"a/b", "a/b", "a/b"},
+		{"sp ace", "sp ace", `"sp ace"`},
+		{"t\tab", `"t\tab"`, `"t\tab"`},
+		{`q"b\s`, `"q\"b\\s"`, `"q\"b\\s"`},
+		{"\x01\x7f", `"\001\177"`, `"\001\177"`},
+		{"é", `"\303\251"`, `"\303\251"`},
+	} {
+		assert.Equal(t, tc.quoted, quoteStatusPath(tc.path, false), tc.path)
+		assert.Equal(t, tc.spaces, quoteStatusPath(tc.path, true), tc.path)
+	}
+}
+
+func TestCollapseUntracked(t *testing.T) {
+	t.Parallel()
+
+	idx := &index.Index{Entries: []*index.Entry{{Name: "a"}, {Name: "d/e/f"}}}
+	untracked, ignored := collapseUntracked(idx,
+		[]string{"u/a", "u/b/c", "d/x", "d/y/z", "mix/a", "b"},
+		[]string{"d/x.o", "d/e/g/h.o", "ig/a.o", "ig/b/c.o", "mix/b.o", "mix/sub/c.o"},
+	)
+
+	assert.Equal(t, []string{"b", "d/x", "d/y/", "mix/", "u/"}, untracked)
+	assert.Equal(t, []string{"d/e/g/", "d/x.o", "ig/", "mix/b.o", "mix/sub/"}, ignored)
+}
+
+func TestStatusDetectRenames(t *testing.T) {
+	t.Parallel()
+
+	fs := memfs.New()
+	r, err := Init(memory.NewStorage(), WithWorkTree(fs))
+	require.NoError(t, err)
+	content := strings.Repeat("line\n", 20)
+	commitFiles(t, r, fs, map[string]string{"old": content, "other": "other\n"})
+
+	w, err := r.Worktree()
+	require.NoError(t, err)
+	_, err = w.Move("old", "new")
+	require.NoError(t, err)
+
+	status, err := w.StatusWithOptions(StatusOptions{DetectRenames: true})
+	require.NoError(t, err)
+	require.Len(t, status, 1)
+	assert.Equal(t, &FileStatus{Staging: Renamed, Worktree: Unmodified, Extra: "old", Similarity: 100}, status["new"])
+	assert.Equal(t, "R  old -> new\n", status.String())
+
+	// Without the option, the rename is a deletion and an addition.
+	status, err = w.Status()
+	require.NoError(t, err)
+	assert.Equal(t, "A  new\nD  old\n", status.String())
+}
+
+func TestWriteStatusGit(t *testing.T) {
+	t.Parallel()
+
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not found")
+	}
+
+	dir := t.TempDir()
+	r, err := PlainInit(dir, false)
+	require.NoError(t, err)
+
+	fs := osfs.New(dir)
+	content := strings.Repeat("line\n", 20)
+	commitFiles(t, r, fs, map[string]string{
+		".gitignore": "*.o\nbuild/\nig/\n",
+		"a":          "a\n",
+		"old":        content,
+		"del":        "del\n",
+		"rmc":        "rmc\n",
+		"d/keep":     "keep\n",
+	})
+
+	w, err := r.Worktree()
+	require.NoError(t, err)
+	require.NoError(t, util.WriteFile(fs, "a", []byte("a2\n"), 0o644))
+	_, err = w.Add("a")
+	require.NoError(t, err)
+	require.NoError(t, util.WriteFile(fs, "a", []byte("a3\n"), 0o644))
+	_, err = w.Move("old", "new")
+	require.NoError(t, err)
+	require.NoError(t, fs.Remove("del"))
+	require.NoError(t, w.RemoveWithOptions(&RemoveOptions{Path: "rmc", Cached: true}))
+	require.NoError(t, util.WriteFile(fs, "added", []byte("added\n"), 0o644))
+	_, err = w.Add("added")
+	require.NoError(t, err)
+	require.NoError(t, util.WriteFile(fs, "intent", []byte("intent\n"), 0o644))
+	require.NoError(t, w.AddIntent("intent"))
+
+	for _, name := range []string{"mix/a", "mix/b.o", "sp ace", "t\tab", "u/x", "é", "build/x", "d/x.o", "ig/y"} {
+		require.NoError(t, util.WriteFile(fs, name, []byte(name), 0o644))
+	}
+
+	git := func(args ...string) string {
+		out, err := exec.Command("git", append([]string{"-C", dir}, args...)...).CombinedOutput()
+		require.NoError(t, err, string(out))
+		return string(out)
+	}
+
+	// The status is written before git refreshes the index.
+	o := StatusOptions{DetectRenames: true, Ignored: true}
+	var v1, v2 bytes.Buffer
+	require.NoError(t, w.WriteStatus(&v1, StatusPorcelain, o))
+	require.NoError(t, w.WriteStatus(&v2, StatusPorcelainV2, o))
+
+	assert.Equal(t, git("status", "--porcelain", "--ignored"), v1.String())
+	assert.Equal(t, git("status", "--porcelain=v2", "--ignored"), v2.String())
+	assert.Contains(t, v1.String(), "R  old -> new\n")
+}
+
+func TestWriteStatusUnmergedGit(t *testing.T) {
+	t.Parallel()
+
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not found")
+	}
+
+	dir := t.TempDir()
+	git := func(args ...string) string {
+		cmd := exec.Command("git", append([]string{"-C", dir, "-c", "user.name=foo", "-c", "user.email=foo@foo.foo"}, args...)...)
+		out, _ := cmd.CombinedOutput()
+		return string(out)
+	}
+
+	// The conflicts of a merge, by both sides, added, modified or deleted.
+	git("init", "-q", "-b", "master")
+	fs := osfs.New(dir)
+	for _, name := range []string{"uu", "ud", "du"} {
+		require.NoError(t, util.WriteFile(fs, name, []byte(name+"\n"), 0o644))
+	}
+
+	git("add", ".")
+	git("commit", "-q", "-m", "base")
+	git("checkout", "-q", "-b", "side")
+	require.NoError(t, util.WriteFile(fs, "aa", []byte("side\n"), 0o644))
+	require.NoError(t, util.WriteFile(fs, "uu", []byte("side\n"), 0o644))
+	require.NoError(t, util.WriteFile(fs, "du", []byte("side\n"), 0o644))
+	require.NoError(t, fs.Remove("ud"))
+	git("add", "-A")
+	git("commit", "-q", "-m", "side")
+	git("checkout", "-q", "master")
+	require.NoError(t, util.WriteFile(fs, "aa", []byte("master\n"), 0o644))
+	require.NoError(t, util.WriteFile(fs, "uu", []byte("master\n"), 0o644))
+	require.NoError(t, util.WriteFile(fs, "ud", []byte("master\n"), 0o644))
+	require.NoError(t, fs.Remove("du"))
+	git("add", "-A")
+	git("commit", "-q", "-m", "master")
+	git("merge", "-q", "side")
+
+	r, err := PlainOpen(dir)
+	require.NoError(t, err)
+	w, err := r.Worktree()
+	require.NoError(t, err)
+
+	status, err := w.Status()
+	require.NoError(t, err)
+	assert.Equal(t, "AA aa\nDU du\nUD ud\nUU uu\n", status.String())
+
+	var v1, v2 bytes.Buffer
+	require.NoError(t, w.WriteStatus(&v1, StatusPorcelain, StatusOptions{}))
+	require.NoError(t, w.WriteStatus(&v2, StatusPorcelainV2, StatusOptions{}))
+	assert.Equal(t, git("status", "--porcelain"), v1.String())
+	assert.Equal(t, git("status", "--porcelain=v2"), v2.String())
+}
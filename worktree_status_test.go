@@ -1,19 +1,27 @@
 package git
 
 import (
+	"bytes"
 	"os"
+	"os/exec"
 	"path/filepath"
+	"runtime"
+	"sort"
+	"strconv"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/go-git/go-billy/v6/memfs"
 	"github.com/go-git/go-billy/v6/osfs"
+	"github.com/go-git/go-billy/v6/util"
 	fixtures "github.com/go-git/go-git-fixtures/v5"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 
 	"github.com/go-git/go-git/v6/plumbing/cache"
 	"github.com/go-git/go-git/v6/storage/filesystem"
+	"github.com/go-git/go-git/v6/storage/memory"
 )
 
 // For additional context: #1159.
@@ -112,3 +120,303 @@ func BenchmarkWorktreeStatus(b *testing.B) {
 		wt.Status()
 	}
 }
+
+func TestIndexV4Git(t *testing.T) {
+	t.Parallel()
+
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git is not available")
+	}
+
+	dir := t.TempDir()
+	r, err := PlainInit(dir, false)
+	require.NoError(t, err)
+
+	cfg, err := r.Config()
+	require.NoError(t, err)
+	cfg.Index.Version = 4
+	require.NoError(t, r.SetConfig(cfg))
+
+	files := map[string]string{}
+	for _, name := range []string{"a", "b/c.txt", "b/cd", "b/c/d", "b/c/e/f", "bb", "z/y/x"} {
+		files[name] = name + "\n"
+	}
+
+	commitFiles(t, r, osfs.New(dir), files)
+
+	idx, err := r.Storer.Index()
+	require.NoError(t, err)
+	assert.Equal(t, uint32(4), idx.Version)
+
+	git := func(args ...string) string {
+		out, err := exec.Command("git", append([]string{"-C", dir}, args...)...).CombinedOutput()
+		require.NoError(t, err, string(out))
+		return string(out)
+	}
+
+	// The index written by go-git is read by git, and the other way around.
+	assert.Empty(t, git("status", "--porcelain"))
+	var names []string
+	for _, e := range idx.Entries {
+		names = append(names, e.Name)
+	}
+	assert.Equal(t, strings.Join(names, "\n")+"\n", git("ls-files"))
+
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "b", "c", "new"), []byte("new\n"), 0o644))
+	git("add", "b/c/new")
+
+	idx, err = r.Storer.Index()
+	require.NoError(t, err)
+	assert.Equal(t, uint32(4), idx.Version)
+	_, err = idx.Entry("b/c/new")
+	require.NoError(t, err)
+
+	w, err := r.Worktree()
+	require.NoError(t, err)
+	status, err := w.Status()
+	require.NoError(t, err)
+	assert.Len(t, status, 1)
+	assert.Equal(t, Added, status.File("b/c/new").Staging)
+}
+
+// ageDirectories sets the modification time of the directories of the
+// worktree at dir in the past, so that they are not racy for the untracked
+// cache.
+func ageDirectories(t *testing.T, dir string) {
+	t.Helper()
+
+	past := time.Now().Add(-time.Hour)
+	err := filepath.WalkDir(dir, func(path string, d os.DirEntry, err error) error {
+		if err != nil || !d.IsDir() {
+			return err
+		}
+
+		if d.Name() == GitDirName {
+			return filepath.SkipDir
+		}
+
+		return os.Chtimes(path, past, past)
+	})
+	require.NoError(t, err)
+}
+
+func untrackedFiles(t *testing.T, w *Worktree) []string {
+	t.Helper()
+
+	status, err := w.StatusWithOptions(StatusOptions{UseUntrackedCache: true})
+	require.NoError(t, err)
+
+	var names []string
+	for name, fs := range status {
+		if fs.Worktree == Untracked {
+			names = append(names, name)
+		}
+	}
+
+	sort.Strings(names)
+	return names
+}
+
+func TestStatusUntrackedCache(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	r, err := PlainInit(dir, false)
+	require.NoError(t, err)
+
+	fs := osfs.New(dir)
+	commitFiles(t, r, fs, map[string]string{"a/t": "t\n", ".gitignore": "*.log\n"})
+	for _, name := range []string{"a/u", "a/u.log", "b/c/v", "top"} {
+		require.NoError(t, util.WriteFile(fs, name, []byte(name), 0o644))
+	}
+
+	ageDirectories(t, dir)
+	w, err := r.Worktree()
+	require.NoError(t, err)
+	assert.Equal(t, []string{"a/u", "b/c/v", "top"}, untrackedFiles(t, w))
+
+	idx, err := r.Storer.Index()
+	require.NoError(t, err)
+	require.NotNil(t, idx.UntrackedCache)
+	root := idx.UntrackedCache.Root
+	require.NotNil(t, root)
+	assert.True(t, root.Valid)
+	assert.Equal(t, []string{"top"}, root.Untracked)
+	assert.Equal(t, []string{"u", "u.log"}, root.Dir("a").Untracked)
+	assert.True(t, root.Dir("b").Dir("c").Valid)
+
+	// The valid directories are not read again.
+	root.Untracked = append(root.Untracked, "cached")
+	require.NoError(t, r.Storer.SetIndex(idx))
+	assert.Equal(t, []string{"a/u", "b/c/v", "cached", "top"}, untrackedFiles(t, w))
+
+	// The directories modified since are read again.
+	require.NoError(t, util.WriteFile(fs, "new", []byte("new"), 0o644))
+	require.NoError(t, fs.Remove("b/c/v"))
+	assert.Equal(t, []string{"a/u", "new", "top"}, untrackedFiles(t, w))
+
+	// Removing a file from the index invalidates its directory, which is not
+	// modified.
+	ageDirectories(t, dir)
+	assert.Equal(t, []string{"a/u", "new", "top"}, untrackedFiles(t, w))
+	idx, err = r.Storer.Index()
+	require.NoError(t, err)
+	_, err = idx.Remove("a/t")
+	require.NoError(t, err)
+	require.NoError(t, r.Storer.SetIndex(idx))
+	assert.Equal(t, []string{"a/t", "a/u", "new", "top"}, untrackedFiles(t, w))
+
+	// A tracked file deleted from the worktree is reported as such.
+	_, err = w.Add("a/t")
+	require.NoError(t, err)
+	ageDirectories(t, dir)
+	assert.Equal(t, []string{"a/u", "new", "top"}, untrackedFiles(t, w))
+	require.NoError(t, fs.Remove("a/t"))
+	status, err := w.StatusWithOptions(StatusOptions{UseUntrackedCache: true})
+	require.NoError(t, err)
+	assert.Equal(t, Deleted, status.File("a/t").Worktree)
+}
+
+func TestStatusUntrackedCacheGit(t *testing.T) {
+	t.Parallel()
+
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git is not available")
+	}
+
+	dir := t.TempDir()
+	r, err := PlainInit(dir, false)
+	require.NoError(t, err)
+
+	fs := osfs.New(dir)
+	commitFiles(t, r, fs, map[string]string{"a/t": "t\n", ".gitignore": "*.log\n"})
+	for _, name := range []string{"a/u", "a/u.log", "b/c/v"} {
+		require.NoError(t, util.WriteFile(fs, name, []byte(name), 0o644))
+	}
+
+	git := func(args ...string) string {
+		out, err := exec.Command("git", append([]string{"-C", dir, "-c", "core.untrackedCache=true"}, args...)...).CombinedOutput()
+		require.NoError(t, err, string(out))
+		return string(out)
+	}
+
+	ageDirectories(t, dir)
+	w, err := r.Worktree()
+	require.NoError(t, err)
+	assert.Equal(t, []string{"a/u", "b/c/v"}, untrackedFiles(t, w))
+
+	// git does not use the cache of go-git, and the other way around.
+	expected := "?? a/u\n?? b/c/v\n"
+	assert.Equal(t, expected, git("status", "--porcelain", "-uall"))
+	assert.Equal(t, expected, git("status", "--porcelain", "-uall"))
+
+	require.NoError(t, util.WriteFile(fs, "b/w", []byte("w"), 0o644))
+	assert.Equal(t, []string{"a/u", "b/c/v", "b/w"}, untrackedFiles(t, w))
+	assert.Equal(t, expected+"?? b/w\n", git("status", "--porcelain", "-uall"))
+}
+
+func TestStatusRacilyClean(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	r, err := PlainInit(dir, false)
+	require.NoError(t, err)
+
+	fs := osfs.New(dir)
+	commitFiles(t, r, fs, map[string]string{"a": "a\n", "b/c": "c\n"})
+	w, err := r.Worktree()
+	require.NoError(t, err)
+
+	// The file is added and the index written within the same timestamp,
+	// then the file is changed, keeping its size and modification time.
+	mtime := time.Now().Add(-time.Hour).Truncate(time.Second)
+	require.NoError(t, os.Chtimes(filepath.Join(dir, "a"), mtime, mtime))
+	_, err = w.Add("a")
+	require.NoError(t, err)
+	index := filepath.Join(dir, GitDirName, "index")
+	require.NoError(t, os.Chtimes(index, mtime, mtime))
+	require.NoError(t, util.WriteFile(fs, "a", []byte("x\n"), 0o644))
+	require.NoError(t, os.Chtimes(filepath.Join(dir, "a"), mtime, mtime))
+
+	for _, workers := range []int{0, 4} {
+		status, err := w.StatusWithOptions(StatusOptions{Workers: workers})
+		require.NoError(t, err)
+		assert.Len(t, status, 1)
+		assert.Equal(t, Modified, status.File("a").Worktree)
+	}
+
+	// As in git, the stat data of the entries older than the index is
+	// trusted, the file not being hashed.
+	later := mtime.Add(time.Minute)
+	require.NoError(t, os.Chtimes(index, later, later))
+	status, err := w.Status()
+	require.NoError(t, err)
+	assert.True(t, status.IsClean())
+}
+
+func TestStatusWorkers(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	r, err := PlainInit(dir, false)
+	require.NoError(t, err)
+
+	fs := osfs.New(dir)
+	files := map[string]string{".gitignore": "*.log\n"}
+	for i := range 50 {
+		name := filepath.ToSlash(filepath.Join(strings.Repeat("d/", i%5), "f"+strconv.Itoa(i)))
+		files[name] = strings.Repeat(name, i)
+	}
+
+	commitFiles(t, r, fs, files)
+	require.NoError(t, util.WriteFile(fs, "d/f1", []byte("changed"), 0o644))
+	require.NoError(t, util.WriteFile(fs, "d/d/d/f3", []byte("changed"), 0o644))
+	require.NoError(t, fs.Remove("f0"))
+	require.NoError(t, util.WriteFile(fs, "d/new", []byte("new"), 0o644))
+	require.NoError(t, util.WriteFile(fs, "d/new.log", []byte("new"), 0o644))
+
+	w, err := r.Worktree()
+	require.NoError(t, err)
+	expected, err := w.Status()
+	require.NoError(t, err)
+	assert.Len(t, expected, 4)
+
+	for _, o := range []StatusOptions{
+		{Workers: 1},
+		{Workers: 8},
+		{Workers: 8, UseUntrackedCache: true},
+	} {
+		status, err := w.StatusWithOptions(o)
+		require.NoError(t, err)
+		assert.Equal(t, expected, status)
+	}
+}
+
+// BenchmarkWorktreeStatusWorkers benchmarks the status of a worktree whose
+// files all need to be hashed, as the index of a memory storage has no
+// modification time, by an increasing number of workers.
+func BenchmarkWorktreeStatusWorkers(b *testing.B) {
+	dir := b.TempDir()
+	r, err := Init(memory.NewStorage(), WithWorkTree(osfs.New(dir)))
+	require.NoError(b, err)
+
+	content := bytes.Repeat([]byte("0123456789abcdef\n"), 4096)
+	for i := range 1000 {
+		name := filepath.Join(dir, "d"+strconv.Itoa(i%10), "f"+strconv.Itoa(i))
+		require.NoError(b, os.MkdirAll(filepath.Dir(name), 0o755))
+		require.NoError(b, os.WriteFile(name, content, 0o644))
+	}
+
+	w, err := r.Worktree()
+	require.NoError(b, err)
+	require.NoError(b, w.AddWithOptions(&AddOptions{All: true}))
+
+	for workers := 1; workers <= runtime.GOMAXPROCS(0); workers *= 2 {
+		b.Run("workers="+strconv.Itoa(workers), func(b *testing.B) {
+			for b.Loop() {
+				_, err := w.StatusWithOptions(StatusOptions{Workers: workers})
+				require.NoError(b, err)
+			}
+		})
+	}
+}
@@ -7,6 +7,7 @@ import (
 	"fmt"
 	"io"
 	"os"
+	"os/exec"
 	"path/filepath"
 	"regexp"
 	"runtime"
@@ -26,12 +27,14 @@ import (
 	"golang.org/x/text/unicode/norm"
 
 	"github.com/go-git/go-git/v6/config"
+	"github.com/go-git/go-git/v6/internal/pathspec"
 	"github.com/go-git/go-git/v6/plumbing"
 	"github.com/go-git/go-git/v6/plumbing/cache"
 	"github.com/go-git/go-git/v6/plumbing/filemode"
 	"github.com/go-git/go-git/v6/plumbing/format/gitignore"
 	"github.com/go-git/go-git/v6/plumbing/format/index"
 	"github.com/go-git/go-git/v6/plumbing/object"
+	"github.com/go-git/go-git/v6/plumbing/storer"
 	"github.com/go-git/go-git/v6/storage/filesystem"
 	"github.com/go-git/go-git/v6/storage/memory"
 )
@@ -128,6 +131,134 @@ func (s *WorktreeSuite) TestPullNonFastForward() {
 	s.ErrorIs(err, ErrNonFastForwardUpdate)
 }
 
+// newPullRebaseRepositories returns the worktree of a server, and a clone of
+// it, with a user in its config for the autostash.
+func (s *WorktreeSuite) newPullRebaseRepositories() (server, w *Worktree) {
+	url := s.GetLocalRepositoryURL(fixtures.Basic().ByTag("worktree").One())
+
+	sr, err := PlainClone(s.T().TempDir(), &CloneOptions{URL: url})
+	s.Require().NoError(err)
+
+	r, err := Clone(memory.NewStorage(), memfs.New(), &CloneOptions{URL: sr.wt.Root()})
+	s.Require().NoError(err)
+
+	cfg, err := r.Config()
+	s.Require().NoError(err)
+	cfg.User.Name = "foo"
+	cfg.User.Email = "foo@foo.foo"
+	s.Require().NoError(r.SetConfig(cfg))
+
+	server, err = sr.Worktree()
+	s.Require().NoError(err)
+	w, err = r.Worktree()
+	s.Require().NoError(err)
+
+	return server, w
+}
+
+// commitFile writes the file to the worktree and commits it.
+func (s *WorktreeSuite) commitFile(w *Worktree, name, content string) plumbing.Hash {
+	s.Require().NoError(util.WriteFile(w.Filesystem, name, []byte(content), 0o644))
+	_, err := w.Add(name)
+	s.Require().NoError(err)
+
+	h, err := w.Commit(name+"\n", &CommitOptions{Author: defaultSignature()})
+	s.Require().NoError(err)
+
+	return h
+}
+
+func (s *WorktreeSuite) TestPullRebase() {
+	server, w := s.newPullRebaseRepositories()
+	upstream := s.commitFile(server, "foo", "foo")
+	s.commitFile(w, "bar", "bar")
+	s.Require().NoError(util.WriteFile(w.Filesystem, "LICENSE", []byte("local"), 0o644))
+
+	err := w.Pull(&PullOptions{Rebase: true})
+	s.ErrorIs(err, ErrWorktreeNotClean)
+
+	err = w.Pull(&PullOptions{Rebase: true, Autostash: true, FastForwardOnly: true})
+	s.ErrorIs(err, ErrNonFastForwardUpdate)
+
+	s.Require().NoError(w.Pull(&PullOptions{Rebase: true, Autostash: true}))
+
+	head, err := w.r.Head()
+	s.Require().NoError(err)
+	s.Equal(plumbing.Master, head.Name())
+
+	commit, err := w.r.CommitObject(head.Hash())
+	s.Require().NoError(err)
+	s.Equal("bar\n", commit.Message)
+	s.Equal([]plumbing.Hash{upstream}, commit.ParentHashes)
+
+	// The local changes are applied back, and the stash dropped.
+	for name, content := range map[string]string{"foo": "foo", "bar": "bar", "LICENSE": "local"} {
+		data, err := util.ReadFile(w.Filesystem, name)
+		s.Require().NoError(err)
+		s.Equal(content, string(data), name)
+	}
+
+	stashes, err := w.StashList()
+	s.Require().NoError(err)
+	s.Empty(stashes)
+
+	err = w.Pull(&PullOptions{Rebase: true, Autostash: true})
+	s.ErrorIs(err, NoErrAlreadyUpToDate)
+}
+
+func (s *WorktreeSuite) TestPullRebaseConflict() {
+	server, w := s.newPullRebaseRepositories()
+	s.commitFile(server, "CHANGELOG", "upstream\n")
+	s.commitFile(w, "CHANGELOG", "local\n")
+	s.Require().NoError(util.WriteFile(w.Filesystem, "LICENSE", []byte("local"), 0o644))
+
+	err := w.Pull(&PullOptions{Rebase: true, Autostash: true})
+	s.ErrorIs(err, ErrRebaseConflict)
+
+	// The local changes are stashed until the rebase is finished.
+	state, err := w.r.RebaseState()
+	s.Require().NoError(err)
+	s.False(state.Autostash.IsZero())
+
+	data, err := util.ReadFile(w.Filesystem, "LICENSE")
+	s.Require().NoError(err)
+	s.NotEqual("local", string(data))
+
+	s.Require().NoError(util.WriteFile(w.Filesystem, "CHANGELOG", []byte("resolved\n"), 0o644))
+	_, err = w.Add("CHANGELOG")
+	s.Require().NoError(err)
+	s.Require().NoError(w.r.RebaseContinue())
+
+	for name, content := range map[string]string{"CHANGELOG": "resolved\n", "LICENSE": "local"} {
+		data, err := util.ReadFile(w.Filesystem, name)
+		s.Require().NoError(err)
+		s.Equal(content, string(data), name)
+	}
+
+	stashes, err := w.StashList()
+	s.Require().NoError(err)
+	s.Empty(stashes)
+}
+
+func (s *WorktreeSuite) TestPullAutostash() {
+	server, w := s.newPullRebaseRepositories()
+	upstream := s.commitFile(server, "LICENSE", "upstream")
+	s.Require().NoError(util.WriteFile(w.Filesystem, "LICENSE", []byte("local"), 0o644))
+
+	// The local changes conflict with the fast-forward: they are kept in
+	// the stash list.
+	err := w.Pull(&PullOptions{Autostash: true, FastForwardOnly: true})
+	s.ErrorIs(err, ErrStashConflict)
+
+	head, err := w.r.Head()
+	s.Require().NoError(err)
+	s.Equal(upstream, head.Hash())
+
+	stashes, err := w.StashList()
+	s.Require().NoError(err)
+	s.Len(stashes, 1)
+}
+
 func (s *WorktreeSuite) TestPullUpdateReferencesIfNeeded() {
 	r, _ := Init(memory.NewStorage(), WithWorkTree(memfs.New()))
 	r.CreateRemote(&config.RemoteConfig{
@@ -392,6 +523,40 @@ func (s *WorktreeSuite) TestCheckoutForce() {
 	s.Len(entries, 8)
 }
 
+func (s *WorktreeSuite) TestCheckoutContextCancel() {
+	fs := memfs.New()
+	w := &Worktree{
+		r:          s.Repository,
+		Filesystem: fs,
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	err := w.CheckoutContext(ctx, &CheckoutOptions{
+		Force: true,
+	})
+	s.ErrorIs(err, context.Canceled)
+
+	entries, err := fs.ReadDir("/")
+	s.NoError(err)
+	s.Len(entries, 0)
+
+	// The worktree is restored by a further checkout.
+	err = w.Checkout(&CheckoutOptions{
+		Force: true,
+	})
+	s.NoError(err)
+
+	entries, err = fs.ReadDir("/")
+	s.NoError(err)
+	s.Len(entries, 8)
+
+	status, err := w.Status()
+	s.NoError(err)
+	s.True(status.IsClean())
+}
+
 func (s *WorktreeSuite) TestCheckoutKeep() {
 	w := &Worktree{
 		r:          s.Repository,
@@ -464,6 +629,102 @@ func (s *WorktreeSuite) TestCheckoutSymlink() {
 	s.NoError(err)
 }
 
+func (s *WorktreeSuite) TestCheckoutSymlinkMode() {
+	r, err := Init(memory.NewStorage(), WithWorkTree(memfs.New()))
+	s.Require().NoError(err)
+	w, err := r.Worktree()
+	s.Require().NoError(err)
+
+	s.Require().NoError(util.WriteFile(w.Filesystem, "README", []byte("hello\n"), 0o644))
+	s.Require().NoError(w.Filesystem.Symlink("README", "link"))
+	s.Require().NoError(w.AddWithOptions(&AddOptions{All: true}))
+	_, err = w.Commit("foo", &CommitOptions{Author: defaultSignature()})
+	s.Require().NoError(err)
+
+	for _, mode := range []SymlinkMode{RealSymlinks, RegularSymlinks, SkipSymlinks} {
+		s.Require().NoError(r.Storer.SetIndex(&index.Index{Version: 2}))
+		w.Filesystem = memfs.New()
+		s.Require().NoError(w.Checkout(&CheckoutOptions{Force: true, SymlinkMode: mode}))
+
+		idx, err := r.Storer.Index()
+		s.Require().NoError(err)
+		e, err := idx.Entry("link")
+		s.Require().NoError(err)
+		s.Equal(filemode.Symlink, e.Mode, mode)
+		s.Equal(mode == SkipSymlinks, e.SkipWorktree, mode)
+
+		fi, err := w.Filesystem.Lstat("link")
+		switch mode {
+		case RealSymlinks:
+			s.Require().NoError(err)
+			target, err := w.Filesystem.Readlink("link")
+			s.NoError(err)
+			s.Equal("README", target)
+		case RegularSymlinks:
+			s.Require().NoError(err)
+			s.True(fi.Mode().IsRegular())
+			content, err := util.ReadFile(w.Filesystem, "link")
+			s.NoError(err)
+			s.Equal("README", string(content))
+		case SkipSymlinks:
+			s.ErrorIs(err, os.ErrNotExist)
+		}
+
+		if mode == RegularSymlinks {
+			cfg, err := r.Config()
+			s.Require().NoError(err)
+			cfg.Raw.Section("core").SetOption("symlinks", "false")
+			s.Require().NoError(r.SetConfig(cfg))
+		}
+
+		status, err := w.Status()
+		s.NoError(err)
+		s.True(status.IsClean(), "%d %s", mode, status)
+	}
+
+	// With core.symlinks set to false, the symbolic links are written as
+	// regular files by default.
+	s.Require().NoError(r.Storer.SetIndex(&index.Index{Version: 2}))
+	w.Filesystem = memfs.New()
+	s.Require().NoError(w.Checkout(&CheckoutOptions{Force: true}))
+	fi, err := w.Filesystem.Lstat("link")
+	s.Require().NoError(err)
+	s.True(fi.Mode().IsRegular())
+}
+
+func (s *WorktreeSuite) TestCheckoutGitlinkReplacingFile() {
+	r, err := Init(memory.NewStorage(), WithWorkTree(memfs.New()))
+	s.Require().NoError(err)
+	w, err := r.Worktree()
+	s.Require().NoError(err)
+
+	s.Require().NoError(util.WriteFile(w.Filesystem, "sub", []byte("file\n"), 0o644))
+	s.Require().NoError(w.AddWithOptions(&AddOptions{All: true}))
+	file, err := w.Commit("file", &CommitOptions{Author: defaultSignature()})
+	s.Require().NoError(err)
+
+	idx, err := r.Storer.Index()
+	s.Require().NoError(err)
+	e, err := idx.Entry("sub")
+	s.Require().NoError(err)
+	e.Mode, e.Hash = filemode.Submodule, file
+	s.Require().NoError(r.Storer.SetIndex(idx))
+	gitlink, err := w.Commit("gitlink", &CommitOptions{Author: defaultSignature()})
+	s.Require().NoError(err)
+
+	s.Require().NoError(w.Checkout(&CheckoutOptions{Hash: file, Force: true}))
+	s.Require().NoError(w.Checkout(&CheckoutOptions{Hash: gitlink, Force: true}))
+
+	// The submodule, not in .gitmodules, is written as an empty directory.
+	fi, err := w.Filesystem.Lstat("sub")
+	s.Require().NoError(err)
+	s.True(fi.IsDir())
+
+	status, err := w.Status()
+	s.NoError(err)
+	s.True(status.IsClean(), status.String())
+}
+
 func (s *WorktreeSuite) TestCheckoutSparse() {
 	fs := memfs.New()
 	r, err := Clone(memory.NewStorage(), fs, &CloneOptions{
@@ -598,7 +859,8 @@ func (s *WorktreeSuite) TestFilenameNormalization() {
 	// Still dirty - the second file is added.
 	s.False(status.IsClean())
 
-	_, err = w.Remove(modFilename)
+	// The file only being staged, it is removed with Force, as git does.
+	err = w.RemoveWithOptions(&RemoveOptions{Path: modFilename, Force: true})
 	s.NoError(err)
 
 	status, err = w.Status()
@@ -901,6 +1163,121 @@ func (s *WorktreeSuite) TestCheckoutCreateInvalidBranch() {
 	}
 }
 
+func (s *WorktreeSuite) TestCheckoutOrphan() {
+	fs := memfs.New()
+	w := &Worktree{
+		r:          s.Repository,
+		Filesystem: fs,
+	}
+
+	s.Require().NoError(w.Checkout(&CheckoutOptions{Force: true}))
+	s.Require().NoError(util.WriteFile(fs, "untracked", []byte("foo"), 0o644))
+	s.Require().NoError(util.WriteFile(fs, "new", []byte("new"), 0o644))
+	_, err := w.Add("new")
+	s.Require().NoError(err)
+
+	err = w.Checkout(&CheckoutOptions{
+		Create: true,
+		Orphan: true,
+		Branch: "refs/heads/gh-pages",
+	})
+	s.Require().NoError(err)
+
+	head, err := w.r.Storer.Reference(plumbing.HEAD)
+	s.Require().NoError(err)
+	s.Equal(plumbing.NewSymbolicReference(plumbing.HEAD, "refs/heads/gh-pages"), head)
+	_, err = w.r.Storer.Reference("refs/heads/gh-pages")
+	s.ErrorIs(err, plumbing.ErrReferenceNotFound)
+
+	// The files of the previous branch are removed, the untracked files and
+	// the ones staged are kept.
+	idx, err := w.r.Storer.Index()
+	s.Require().NoError(err)
+	s.Len(idx.Entries, 1)
+	s.Equal("new", idx.Entries[0].Name)
+
+	files, err := fs.ReadDir("/")
+	s.Require().NoError(err)
+	var names []string
+	for _, fi := range files {
+		names = append(names, fi.Name())
+	}
+
+	s.Equal([]string{"new", "untracked"}, names)
+
+	h, err := w.Commit("root\n", &CommitOptions{Author: defaultSignature()})
+	s.Require().NoError(err)
+	commit, err := w.r.CommitObject(h)
+	s.Require().NoError(err)
+	s.Empty(commit.ParentHashes)
+
+	ref, err := w.r.Reference("refs/heads/gh-pages", false)
+	s.Require().NoError(err)
+	s.Equal(h, ref.Hash())
+	_, err = commit.File("CHANGELOG")
+	s.ErrorIs(err, object.ErrFileNotFound)
+}
+
+func (s *WorktreeSuite) TestCheckoutOrphanLocalChanges() {
+	fs := memfs.New()
+	w := &Worktree{
+		r:          s.Repository,
+		Filesystem: fs,
+	}
+
+	s.Require().NoError(w.Checkout(&CheckoutOptions{Force: true}))
+	s.Require().NoError(util.WriteFile(fs, "CHANGELOG", []byte("foo"), 0o644))
+
+	opts := &CheckoutOptions{Create: true, Orphan: true, Branch: "refs/heads/orphan"}
+	err := w.Checkout(opts)
+	s.ErrorIs(err, ErrLocalChanges)
+	head, err := w.r.Head()
+	s.Require().NoError(err)
+	s.Equal(plumbing.Master, head.Name())
+
+	// With Keep, the files are left as they are.
+	opts.Keep = true
+	s.Require().NoError(w.Checkout(opts))
+	status, err := w.Status()
+	s.Require().NoError(err)
+	s.Equal(Added, status.File("CHANGELOG").Staging)
+	s.Equal(Modified, status.File("CHANGELOG").Worktree)
+
+	// With Force, they are removed.
+	s.Require().NoError(w.Checkout(&CheckoutOptions{
+		Create: true,
+		Orphan: true,
+		Force:  true,
+		Branch: "refs/heads/other",
+	}))
+	idx, err := w.r.Storer.Index()
+	s.Require().NoError(err)
+	s.Empty(idx.Entries)
+	_, err = fs.Stat("CHANGELOG")
+	s.ErrorIs(err, os.ErrNotExist)
+}
+
+func (s *WorktreeSuite) TestCheckoutOrphanInvalidOptions() {
+	w := &Worktree{
+		r:          s.Repository,
+		Filesystem: memfs.New(),
+	}
+
+	err := w.Checkout(&CheckoutOptions{Orphan: true, Branch: "refs/heads/orphan"})
+	s.ErrorIs(err, ErrOrphanRequiresCreate)
+
+	err = w.Checkout(&CheckoutOptions{
+		Create: true,
+		Orphan: true,
+		Branch: "refs/heads/orphan",
+		Hash:   plumbing.NewHash("35e85108805c84807bc66a02d91535e1e24b38b9"),
+	})
+	s.ErrorIs(err, ErrOrphanHashExclusive)
+
+	err = w.Checkout(&CheckoutOptions{Create: true, Orphan: true, Branch: plumbing.Master})
+	s.ErrorContains(err, "already exists")
+}
+
 func (s *WorktreeSuite) TestCheckoutTag() {
 	f := fixtures.ByTag("tags").One()
 	r := NewRepositoryWithEmptyWorktree(f)
@@ -973,6 +1350,313 @@ func (s *WorktreeSuite) TestCheckoutTagHash() {
 	}
 }
 
+func (s *WorktreeSuite) TestCheckoutPaths() {
+	fs := memfs.New()
+	w := &Worktree{
+		r:          s.Repository,
+		Filesystem: fs,
+	}
+
+	err := w.Checkout(&CheckoutOptions{})
+	s.NoError(err)
+
+	err = util.WriteFile(fs, "CHANGELOG", []byte("foo"), 0o644)
+	s.NoError(err)
+	err = util.WriteFile(fs, "json/long.json", []byte("bar"), 0o644)
+	s.NoError(err)
+	err = fs.Remove("json/short.json")
+	s.NoError(err)
+
+	// The files are restored from the index, without a commit.
+	err = w.Checkout(&CheckoutOptions{Paths: []string{"json"}})
+	s.NoError(err)
+
+	status, err := w.Status()
+	s.NoError(err)
+	s.Len(status, 1)
+	s.Equal(Modified, status.File("CHANGELOG").Worktree)
+
+	content, err := util.ReadFile(fs, "json/short.json")
+	s.NoError(err)
+	s.Contains(string(content), "glossary")
+}
+
+func (s *WorktreeSuite) TestCheckoutPathsFromCommit() {
+	fs := memfs.New()
+	w := &Worktree{
+		r:          s.Repository,
+		Filesystem: fs,
+	}
+
+	err := w.Checkout(&CheckoutOptions{})
+	s.NoError(err)
+
+	err = util.WriteFile(fs, "CHANGELOG", []byte("foo"), 0o644)
+	s.NoError(err)
+
+	// README only exists in the branch, and is staged as added, HEAD being
+	// left unchanged.
+	err = w.Checkout(&CheckoutOptions{
+		Branch: "refs/heads/branch",
+		Paths:  []string{"README", "CHANGELOG"},
+	})
+	s.NoError(err)
+
+	head, err := w.r.Head()
+	s.NoError(err)
+	s.Equal(plumbing.Master, head.Name())
+	s.Equal("6ecf0ef2c2dffb796033e5a02219af86ec6584e5", head.Hash().String())
+
+	content, err := util.ReadFile(fs, "CHANGELOG")
+	s.NoError(err)
+	s.Equal("Initial changelog\n", string(content))
+
+	status, err := w.Status()
+	s.NoError(err)
+	s.Len(status, 1)
+	s.Equal(Added, status.File("README").Staging)
+	s.Equal(Unmodified, status.File("README").Worktree)
+}
+
+func (s *WorktreeSuite) TestCheckoutPathsNoMatches() {
+	w := &Worktree{
+		r:          s.Repository,
+		Filesystem: memfs.New(),
+	}
+
+	err := w.Checkout(&CheckoutOptions{})
+	s.NoError(err)
+
+	err = w.Checkout(&CheckoutOptions{Paths: []string{"CHANGELOG", "foo"}})
+	s.ErrorIs(err, ErrPathSpecNoMatches)
+
+	err = w.Checkout(&CheckoutOptions{
+		Hash:  plumbing.NewHash("b029517f6300c2da0f4b651b8642506cd6aaf45d"),
+		Paths: []string{"CHANGELOG"},
+	})
+	s.ErrorIs(err, ErrPathSpecNoMatches)
+
+	err = w.Checkout(&CheckoutOptions{
+		Create: true,
+		Branch: "refs/heads/foo",
+		Paths:  []string{"CHANGELOG"},
+	})
+	s.ErrorIs(err, ErrCreatePathsExclusive)
+}
+
+func (s *WorktreeSuite) TestCheckoutPathsBeyondSymlink() {
+	fs := memfs.New()
+	w := &Worktree{
+		r:          s.Repository,
+		Filesystem: fs,
+	}
+
+	err := w.Checkout(&CheckoutOptions{})
+	s.NoError(err)
+
+	// The vendor directory is replaced by a link to another directory, in
+	// which the files must not be written.
+	err = util.RemoveAll(fs, "vendor")
+	s.NoError(err)
+	err = fs.MkdirAll("outside", 0o755)
+	s.NoError(err)
+	err = fs.Symlink("outside", "vendor")
+	s.NoError(err)
+
+	err = w.Checkout(&CheckoutOptions{
+		Branch: "refs/heads/master",
+		Paths:  []string{"vendor"},
+	})
+	s.ErrorContains(err, "symbolic link")
+
+	_, err = fs.Lstat("outside/foo.go")
+	s.ErrorIs(err, os.ErrNotExist)
+}
+
+func (s *WorktreeSuite) TestCheckoutPathCollisions() {
+	r, err := Init(memory.NewStorage(), WithWorkTree(memfs.New()))
+	s.Require().NoError(err)
+	w, err := r.Worktree()
+	s.Require().NoError(err)
+
+	nfc, nfd := norm.NFC.String("café"), norm.NFD.String("café")
+	for _, name := range []string{"README", "readme", "Dir/a", "dir/b", nfc, nfd, "other"} {
+		s.Require().NoError(util.WriteFile(w.Filesystem, name, []byte(name), 0o644))
+	}
+
+	s.Require().NoError(w.AddWithOptions(&AddOptions{All: true}))
+	_, err = w.Commit("foo", &CommitOptions{Author: defaultSignature()})
+	s.Require().NoError(err)
+
+	// The paths don't collide on a case-sensitive filesystem.
+	cfg, err := r.Config()
+	s.Require().NoError(err)
+	cfg.Raw.Section("core").SetOption("ignorecase", "false")
+	s.Require().NoError(r.SetConfig(cfg))
+	s.Require().NoError(r.Storer.SetIndex(&index.Index{Version: 2}))
+	w.Filesystem = memfs.New()
+	s.Require().NoError(w.Checkout(&CheckoutOptions{Force: true}))
+
+	cfg.Raw.Section("core").SetOption("ignorecase", "Yes")
+	s.Require().NoError(r.SetConfig(cfg))
+	s.Require().NoError(r.Storer.SetIndex(&index.Index{Version: 2}))
+	w.Filesystem = memfs.New()
+	err = w.Checkout(&CheckoutOptions{Force: true})
+	s.ErrorIs(err, ErrPathCollision)
+
+	var collisions *PathCollisionError
+	s.Require().ErrorAs(err, &collisions)
+	var paths [][]string
+	for _, p := range collisions.Paths {
+		pair := []string{p.Other, p.Path}
+		slices.Sort(pair)
+		paths = append(paths, pair)
+	}
+
+	s.ElementsMatch([][]string{{"Dir", "dir"}, {"README", "readme"}, {nfd, nfc}}, paths)
+	_, err = w.Filesystem.Lstat("other")
+	s.ErrorIs(err, os.ErrNotExist)
+
+	s.Require().NoError(w.Checkout(&CheckoutOptions{Force: true, AllowPathCollisions: true}))
+	_, err = w.Filesystem.Lstat("other")
+	s.NoError(err)
+}
+
+func (s *WorktreeSuite) TestCheckoutPathInGitDir() {
+	fs := memfs.New()
+	dot, err := fs.Chroot("repo.git")
+	s.Require().NoError(err)
+	r, err := Init(filesystem.NewStorage(dot, cache.NewObjectLRUDefault()), WithWorkTree(memfs.New()))
+	s.Require().NoError(err)
+	w, err := r.Worktree()
+	s.Require().NoError(err)
+
+	s.Require().NoError(util.WriteFile(w.Filesystem, "repo.git/hooks/post-checkout", []byte("#!/bin/sh\n"), 0o755))
+	s.Require().NoError(w.AddWithOptions(&AddOptions{All: true}))
+	_, err = w.Commit("foo", &CommitOptions{Author: defaultSignature()})
+	s.Require().NoError(err)
+
+	// The git directory is in the worktree, as repo.git.
+	s.Require().NoError(r.Storer.SetIndex(&index.Index{Version: 2}))
+	w.Filesystem = fs
+	err = w.Checkout(&CheckoutOptions{Force: true})
+	s.ErrorIs(err, ErrPathInGitDir)
+
+	var pathErr *InvalidPathError
+	s.Require().ErrorAs(err, &pathErr)
+	s.Equal("repo.git/hooks/post-checkout", pathErr.Path)
+	_, err = fs.Lstat("repo.git/hooks/post-checkout")
+	s.ErrorIs(err, os.ErrNotExist)
+}
+
+func (s *WorktreeSuite) TestCheckoutLocalChanges() {
+	w := &Worktree{
+		r:          s.Repository,
+		Filesystem: memfs.New(),
+	}
+
+	s.Require().NoError(w.Checkout(&CheckoutOptions{Force: true}))
+	s.Require().NoError(util.WriteFile(w.Filesystem, "CHANGELOG", []byte("changed"), 0o644))
+
+	// CHANGELOG doesn't exist in the initial commit.
+	err := w.Checkout(&CheckoutOptions{
+		Create: true,
+		Branch: "refs/heads/foo",
+		Hash:   plumbing.NewHash("b029517f6300c2da0f4b651b8642506cd6aaf45d"),
+	})
+	var rerr *ResetError
+	s.Require().ErrorAs(err, &rerr)
+	s.ErrorIs(err, ErrLocalChanges)
+	s.Equal([]string{"CHANGELOG"}, rerr.Files)
+
+	// Nothing is changed by the refused checkout.
+	_, err = s.Repository.Reference("refs/heads/foo", false)
+	s.ErrorIs(err, plumbing.ErrReferenceNotFound)
+	head, err := s.Repository.Head()
+	s.Require().NoError(err)
+	s.Equal(plumbing.Master, head.Name())
+
+	// The local changes of files unchanged by the checkout are kept,
+	// staged or not.
+	s.Require().NoError(util.WriteFile(w.Filesystem, "LICENSE", []byte("staged"), 0o644))
+	_, err = w.Add("LICENSE")
+	s.Require().NoError(err)
+	s.Require().NoError(w.Checkout(&CheckoutOptions{
+		Create: true,
+		Branch: "refs/heads/foo",
+	}))
+
+	head, err = s.Repository.Head()
+	s.Require().NoError(err)
+	s.Equal(plumbing.ReferenceName("refs/heads/foo"), head.Name())
+
+	status, err := w.Status()
+	s.Require().NoError(err)
+	s.Equal(Modified, status.File("LICENSE").Staging)
+	s.Equal(Modified, status.File("CHANGELOG").Worktree)
+
+	// The checkout is forced by Force.
+	s.Require().NoError(w.Checkout(&CheckoutOptions{
+		Hash:  plumbing.NewHash("b029517f6300c2da0f4b651b8642506cd6aaf45d"),
+		Force: true,
+	}))
+	status, err = w.Status()
+	s.Require().NoError(err)
+	s.True(status.IsClean())
+}
+
+func (s *WorktreeSuite) TestCheckoutCreateFromTag() {
+	f := fixtures.ByTag("tags").One()
+	r := NewRepositoryWithEmptyWorktree(f)
+	w, err := r.Worktree()
+	s.Require().NoError(err)
+
+	tag, err := r.Tag("annotated-tag")
+	s.Require().NoError(err)
+
+	s.Require().NoError(w.Checkout(&CheckoutOptions{
+		Create: true,
+		Branch: "refs/heads/foo",
+		Hash:   tag.Hash(),
+	}))
+
+	// The branch points to the tagged commit, not to the tag.
+	ref, err := r.Reference("refs/heads/foo", false)
+	s.Require().NoError(err)
+	s.NotEqual(tag.Hash(), ref.Hash())
+	s.Equal(plumbing.NewHash("f7b877701fbf855b44c0a9e86f3fdce2c298b07f"), ref.Hash())
+}
+
+func (s *WorktreeSuite) TestSwitchDetached() {
+	w := &Worktree{
+		r:          s.Repository,
+		Filesystem: memfs.New(),
+	}
+
+	s.Require().NoError(w.Checkout(&CheckoutOptions{Force: true}))
+
+	hash := plumbing.NewHash("918c48b83bd081e863dbe1b80f8998f058cd8294")
+	result, err := w.SwitchDetached(hash)
+	s.Require().NoError(err)
+	s.Equal(hash, result.Hash)
+	s.Equal(plumbing.Master, result.From)
+	s.Contains(result.Warning, "HEAD is now detached at 918c48b")
+
+	head, err := s.Repository.Storer.Reference(plumbing.HEAD)
+	s.Require().NoError(err)
+	s.Equal(plumbing.HashReference, head.Type())
+	s.Equal(hash, head.Hash())
+
+	result, err = w.SwitchDetached(plumbing.NewHash("af2d6a6954d532f8ffb47615169c8fdf9d383a1a"))
+	s.Require().NoError(err)
+	s.Empty(result.From)
+
+	// The local changes which would be overwritten refuse the switch.
+	s.Require().NoError(util.WriteFile(w.Filesystem, "CHANGELOG", []byte("changed"), 0o644))
+	_, err = w.SwitchDetached(plumbing.NewHash("b029517f6300c2da0f4b651b8642506cd6aaf45d"))
+	s.ErrorIs(err, ErrLocalChanges)
+}
+
 func (s *WorktreeSuite) TestCheckoutBisect() {
 	if testing.Short() {
 		s.T().Skip("skipping test in short mode.")
@@ -1166,82 +1850,237 @@ func (s *WorktreeSuite) TestResetWithUntracked() {
 		Filesystem: fs,
 	}
 
-	commit := plumbing.NewHash("35e85108805c84807bc66a02d91535e1e24b38b9")
+	commit := plumbing.NewHash("35e85108805c84807bc66a02d91535e1e24b38b9")
+
+	err := w.Checkout(&CheckoutOptions{})
+	s.NoError(err)
+
+	err = util.WriteFile(fs, "foo", nil, 0o755)
+	s.NoError(err)
+
+	err = w.Reset(&ResetOptions{Mode: MergeReset, Commit: commit})
+	s.NoError(err)
+
+	status, err := w.Status()
+	s.NoError(err)
+	for file, st := range status {
+		if file == "foo" {
+			s.Equal(Untracked, st.Worktree)
+			s.Equal(Untracked, st.Staging)
+			continue
+		}
+		if st.Worktree != Unmodified || st.Staging != Unmodified {
+			s.Fail("file %s not unmodified", file)
+		}
+	}
+}
+
+func (s *WorktreeSuite) TestResetSoft() {
+	fs := memfs.New()
+	w := &Worktree{
+		r:          s.Repository,
+		Filesystem: fs,
+	}
+
+	commit := plumbing.NewHash("35e85108805c84807bc66a02d91535e1e24b38b9")
+
+	err := w.Checkout(&CheckoutOptions{})
+	s.NoError(err)
+
+	err = w.Reset(&ResetOptions{Mode: SoftReset, Commit: commit})
+	s.NoError(err)
+
+	branch, err := w.r.Reference(plumbing.Master, false)
+	s.NoError(err)
+	s.Equal(commit, branch.Hash())
+
+	status, err := w.Status()
+	s.NoError(err)
+	s.False(status.IsClean())
+	s.Equal(Added, status.File("CHANGELOG").Staging)
+}
+
+func (s *WorktreeSuite) TestResetMixed() {
+	fs := memfs.New()
+	w := &Worktree{
+		r:          s.Repository,
+		Filesystem: fs,
+	}
+
+	commit := plumbing.NewHash("35e85108805c84807bc66a02d91535e1e24b38b9")
+
+	err := w.Checkout(&CheckoutOptions{})
+	s.NoError(err)
+
+	err = w.Reset(&ResetOptions{Mode: MixedReset, Commit: commit})
+	s.NoError(err)
+
+	branch, err := w.r.Reference(plumbing.Master, false)
+	s.NoError(err)
+	s.Equal(commit, branch.Hash())
+
+	status, err := w.Status()
+	s.NoError(err)
+	s.False(status.IsClean())
+	s.Equal(Untracked, status.File("CHANGELOG").Staging)
+}
+
+func (s *WorktreeSuite) TestResetMerge() {
+	fs := memfs.New()
+	w := &Worktree{
+		r:          s.Repository,
+		Filesystem: fs,
+	}
+
+	commitA := plumbing.NewHash("918c48b83bd081e863dbe1b80f8998f058cd8294")
+	commitB := plumbing.NewHash("35e85108805c84807bc66a02d91535e1e24b38b9")
+
+	err := w.Checkout(&CheckoutOptions{})
+	s.NoError(err)
+
+	err = w.Reset(&ResetOptions{Mode: MergeReset, Commit: commitA})
+	s.NoError(err)
+
+	branch, err := w.r.Reference(plumbing.Master, false)
+	s.NoError(err)
+	s.Equal(commitA, branch.Hash())
+
+	// CHANGELOG is deleted by commitB.
+	f, err := fs.Create("CHANGELOG")
+	s.NoError(err)
+	_, err = f.Write([]byte("foo"))
+	s.NoError(err)
+	err = f.Close()
+	s.NoError(err)
+
+	err = w.Reset(&ResetOptions{Mode: MergeReset, Commit: commitB})
+	s.ErrorIs(err, ErrUnstagedChanges)
+
+	var resetErr *ResetError
+	s.ErrorAs(err, &resetErr)
+	s.Equal([]string{"CHANGELOG"}, resetErr.Files)
+
+	branch, err = w.r.Reference(plumbing.Master, false)
+	s.NoError(err)
+	s.Equal(commitA, branch.Hash())
+
+	content, err := util.ReadFile(fs, "CHANGELOG")
+	s.NoError(err)
+	s.Equal("foo", string(content))
+}
+
+func (s *WorktreeSuite) TestResetMergeKeepsUnstagedChanges() {
+	fs := memfs.New()
+	w := &Worktree{
+		r:          s.Repository,
+		Filesystem: fs,
+	}
+
+	commitA := plumbing.NewHash("918c48b83bd081e863dbe1b80f8998f058cd8294")
+	commitB := plumbing.NewHash("35e85108805c84807bc66a02d91535e1e24b38b9")
+
+	err := w.Checkout(&CheckoutOptions{})
+	s.NoError(err)
+
+	err = w.Reset(&ResetOptions{Mode: MergeReset, Commit: commitA})
+	s.NoError(err)
+
+	// .gitignore is the same in both commits.
+	err = util.WriteFile(fs, ".gitignore", []byte("foo"), 0o644)
+	s.NoError(err)
 
-	err := w.Checkout(&CheckoutOptions{})
+	err = w.Reset(&ResetOptions{Mode: MergeReset, Commit: commitB})
 	s.NoError(err)
 
-	err = util.WriteFile(fs, "foo", nil, 0o755)
+	branch, err := w.r.Reference(plumbing.Master, false)
 	s.NoError(err)
+	s.Equal(commitB, branch.Hash())
 
-	err = w.Reset(&ResetOptions{Mode: MergeReset, Commit: commit})
+	content, err := util.ReadFile(fs, ".gitignore")
 	s.NoError(err)
+	s.Equal("foo", string(content))
+
+	_, err = fs.Stat("CHANGELOG")
+	s.ErrorIs(err, os.ErrNotExist)
 
 	status, err := w.Status()
 	s.NoError(err)
-	for file, st := range status {
-		if file == "foo" {
-			s.Equal(Untracked, st.Worktree)
-			s.Equal(Untracked, st.Staging)
-			continue
-		}
-		if st.Worktree != Unmodified || st.Staging != Unmodified {
-			s.Fail("file %s not unmodified", file)
-		}
-	}
+	s.Len(status, 1)
+	s.Equal(Modified, status.File(".gitignore").Worktree)
 }
 
-func (s *WorktreeSuite) TestResetSoft() {
+func (s *WorktreeSuite) TestResetMergeUntracked() {
 	fs := memfs.New()
 	w := &Worktree{
 		r:          s.Repository,
 		Filesystem: fs,
 	}
 
-	commit := plumbing.NewHash("35e85108805c84807bc66a02d91535e1e24b38b9")
+	commitB := plumbing.NewHash("35e85108805c84807bc66a02d91535e1e24b38b9")
 
 	err := w.Checkout(&CheckoutOptions{})
 	s.NoError(err)
 
-	err = w.Reset(&ResetOptions{Mode: SoftReset, Commit: commit})
+	err = w.Reset(&ResetOptions{Mode: MergeReset, Commit: commitB})
 	s.NoError(err)
 
-	branch, err := w.r.Reference(plumbing.Master, false)
+	// The untracked CHANGELOG would be overwritten by the one of HEAD.
+	err = util.WriteFile(fs, "CHANGELOG", []byte("foo"), 0o644)
 	s.NoError(err)
-	s.Equal(commit, branch.Hash())
 
-	status, err := w.Status()
+	err = w.Reset(&ResetOptions{Mode: MergeReset, Commit: plumbing.NewHash("6ecf0ef2c2dffb796033e5a02219af86ec6584e5")})
+	s.ErrorIs(err, ErrLocalChanges)
+
+	branch, err := w.r.Reference(plumbing.Master, false)
 	s.NoError(err)
-	s.False(status.IsClean())
-	s.Equal(Added, status.File("CHANGELOG").Staging)
+	s.Equal(commitB, branch.Hash())
 }
 
-func (s *WorktreeSuite) TestResetMixed() {
+func (s *WorktreeSuite) TestResetKeep() {
 	fs := memfs.New()
 	w := &Worktree{
 		r:          s.Repository,
 		Filesystem: fs,
 	}
 
-	commit := plumbing.NewHash("35e85108805c84807bc66a02d91535e1e24b38b9")
+	commitA := plumbing.NewHash("918c48b83bd081e863dbe1b80f8998f058cd8294")
+	commitB := plumbing.NewHash("35e85108805c84807bc66a02d91535e1e24b38b9")
 
 	err := w.Checkout(&CheckoutOptions{})
 	s.NoError(err)
 
-	err = w.Reset(&ResetOptions{Mode: MixedReset, Commit: commit})
+	err = w.Reset(&ResetOptions{Mode: HardReset, Commit: commitA})
+	s.NoError(err)
+
+	// The staged and unstaged changes of the files which are the same in both
+	// commits are kept.
+	err = util.WriteFile(fs, ".gitignore", []byte("foo"), 0o644)
+	s.NoError(err)
+	_, err = w.Add(".gitignore")
+	s.NoError(err)
+	err = util.WriteFile(fs, "LICENSE", []byte("bar"), 0o644)
+	s.NoError(err)
+
+	err = w.Reset(&ResetOptions{Mode: KeepReset, Commit: commitB})
 	s.NoError(err)
 
 	branch, err := w.r.Reference(plumbing.Master, false)
 	s.NoError(err)
-	s.Equal(commit, branch.Hash())
+	s.Equal(commitB, branch.Hash())
+
+	_, err = fs.Stat("CHANGELOG")
+	s.ErrorIs(err, os.ErrNotExist)
 
 	status, err := w.Status()
 	s.NoError(err)
-	s.False(status.IsClean())
-	s.Equal(Untracked, status.File("CHANGELOG").Staging)
+	s.Len(status, 2)
+	s.Equal(Modified, status.File(".gitignore").Staging)
+	s.Equal(Unmodified, status.File(".gitignore").Worktree)
+	s.Equal(Unmodified, status.File("LICENSE").Staging)
+	s.Equal(Modified, status.File("LICENSE").Worktree)
 }
 
-func (s *WorktreeSuite) TestResetMerge() {
+func (s *WorktreeSuite) TestResetKeepLocalChanges() {
 	fs := memfs.New()
 	w := &Worktree{
 		r:          s.Repository,
@@ -1254,26 +2093,34 @@ func (s *WorktreeSuite) TestResetMerge() {
 	err := w.Checkout(&CheckoutOptions{})
 	s.NoError(err)
 
-	err = w.Reset(&ResetOptions{Mode: MergeReset, Commit: commitA})
-	s.NoError(err)
-
-	branch, err := w.r.Reference(plumbing.Master, false)
+	err = w.Reset(&ResetOptions{Mode: HardReset, Commit: commitA})
 	s.NoError(err)
-	s.Equal(commitA, branch.Hash())
 
-	f, err := fs.Create(".gitignore")
+	// Both files are changed by commitB, CHANGELOG being deleted, and have
+	// local changes, staged or not.
+	err = util.WriteFile(fs, "CHANGELOG", []byte("foo"), 0o644)
 	s.NoError(err)
-	_, err = f.Write([]byte("foo"))
+	_, err = w.Add("CHANGELOG")
 	s.NoError(err)
-	err = f.Close()
+	err = util.WriteFile(fs, "json/short.json", []byte("bar"), 0o644)
 	s.NoError(err)
 
-	err = w.Reset(&ResetOptions{Mode: MergeReset, Commit: commitB})
-	s.ErrorIs(err, ErrUnstagedChanges)
+	err = w.Reset(&ResetOptions{Mode: KeepReset, Commit: commitB})
+	s.ErrorIs(err, ErrLocalChanges)
+	s.NotErrorIs(err, ErrUnstagedChanges)
 
-	branch, err = w.r.Reference(plumbing.Master, false)
+	var resetErr *ResetError
+	s.ErrorAs(err, &resetErr)
+	s.ElementsMatch([]string{"CHANGELOG", "json/short.json"}, resetErr.Files)
+
+	branch, err := w.r.Reference(plumbing.Master, false)
 	s.NoError(err)
 	s.Equal(commitA, branch.Hash())
+
+	status, err := w.Status()
+	s.NoError(err)
+	s.Equal(Modified, status.File("CHANGELOG").Staging)
+	s.Equal(Modified, status.File("json/short.json").Worktree)
 }
 
 func (s *WorktreeSuite) TestResetHard() {
@@ -1885,6 +2732,85 @@ func (s *WorktreeSuite) TestAddUntracked() {
 	s.Equal(int64(3), obj.Size())
 }
 
+func TestAddIntent(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	r, err := PlainInit(dir, false)
+	require.NoError(t, err)
+	w, err := r.Worktree()
+	require.NoError(t, err)
+
+	fs := w.Filesystem
+	require.NoError(t, util.WriteFile(fs, ".gitignore", []byte("*.log\n"), 0o644))
+	_, err = w.Add(".gitignore")
+	require.NoError(t, err)
+	_, err = w.Commit("initial\n", &CommitOptions{Author: defaultSignature()})
+	require.NoError(t, err)
+
+	for _, name := range []string{"foo", "dir/bar", "dir/baz", "dir/debug.log", "debug.log"} {
+		require.NoError(t, util.WriteFile(fs, name, []byte(name), 0o644))
+	}
+
+	require.NoError(t, w.AddIntent("foo"))
+	require.NoError(t, w.AddIntent("dir"))
+	require.NoError(t, w.AddIntent(".gitignore"))
+	assert.ErrorIs(t, w.AddIntent("debug.log"), ErrPathIgnored)
+
+	// The intent-to-add entries are empty, and written as such.
+	r, err = PlainOpen(dir)
+	require.NoError(t, err)
+	w, err = r.Worktree()
+	require.NoError(t, err)
+	idx, err := r.Storer.Index()
+	require.NoError(t, err)
+	var names []string
+	for _, e := range idx.Entries {
+		if e.IntentToAdd {
+			names = append(names, e.Name)
+			assert.Equal(t, "e69de29bb2d1d6434b8b29ae775ad8c2e48c5391", e.Hash.String())
+		}
+	}
+
+	assert.Equal(t, []string{"dir/bar", "dir/baz", "foo"}, names)
+
+	status, err := w.Status()
+	require.NoError(t, err)
+	assert.Equal(t, FileStatus{Staging: Unmodified, Worktree: Added}, *status.File("foo"))
+	assert.Equal(t, FileStatus{Staging: Unmodified, Worktree: Added}, *status.File("dir/bar"))
+	assert.NotContains(t, status, ".gitignore")
+	assert.NotContains(t, status, "dir/debug.log")
+
+	if _, err := exec.LookPath("git"); err == nil {
+		cmd := exec.Command("git", "status", "--porcelain")
+		cmd.Dir = dir
+		out, err := cmd.CombinedOutput()
+		require.NoError(t, err, string(out))
+		assert.Equal(t, " A dir/bar\n A dir/baz\n A foo\n", string(out))
+	}
+
+	// The intent-to-add entries are not committed.
+	h, err := w.Commit("empty\n", &CommitOptions{Author: defaultSignature(), AllowEmptyCommits: true})
+	require.NoError(t, err)
+	commit, err := r.CommitObject(h)
+	require.NoError(t, err)
+	_, err = commit.File("foo")
+	assert.ErrorIs(t, err, object.ErrFileNotFound)
+
+	// Adding the file stages its content.
+	_, err = w.Add("foo")
+	require.NoError(t, err)
+	idx, err = r.Storer.Index()
+	require.NoError(t, err)
+	e, err := idx.Entry("foo")
+	require.NoError(t, err)
+	assert.False(t, e.IntentToAdd)
+
+	status, err = w.Status()
+	require.NoError(t, err)
+	assert.Equal(t, FileStatus{Staging: Added, Worktree: Unmodified}, *status.File("foo"))
+}
+
 func (s *WorktreeSuite) TestAddCRLF() {
 	runTest := func(t *testing.T, autoCRLF string) (result []byte) {
 		r := NewRepositoryWithEmptyWorktree(fixtures.Basic().One())
@@ -2234,6 +3160,187 @@ func (s *WorktreeSuite) TestAddSymlink() {
 	s.Equal(int64(3), obj.Size())
 }
 
+func TestAddModes(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	r, err := PlainInit(dir, false)
+	require.NoError(t, err)
+	w, err := r.Worktree()
+	require.NoError(t, err)
+
+	fs := w.Filesystem
+	require.NoError(t, util.WriteFile(fs, "target", []byte("foo\n"), 0o644))
+	require.NoError(t, fs.Symlink("target", "link"))
+	require.NoError(t, fs.Symlink("dir", "dirlink"))
+	require.NoError(t, util.WriteFile(fs, "dir/file", []byte("bar\n"), 0o644))
+	require.NoError(t, util.WriteFile(fs, "exe", []byte("#!/bin/sh\n"), 0o755))
+
+	// A nested repository is staged as a gitlink, not recursed into.
+	sub, err := PlainInit(filepath.Join(dir, "sub"), false)
+	require.NoError(t, err)
+	subw, err := sub.Worktree()
+	require.NoError(t, err)
+	require.NoError(t, util.WriteFile(subw.Filesystem, "foo", []byte("foo\n"), 0o644))
+	_, err = subw.Add("foo")
+	require.NoError(t, err)
+	first, err := subw.Commit("foo\n", &CommitOptions{Author: defaultSignature()})
+	require.NoError(t, err)
+
+	status, err := w.Status()
+	require.NoError(t, err)
+	assert.Equal(t, Untracked, status.File("sub").Worktree)
+	assert.NotContains(t, status, "sub/foo")
+
+	h, err := w.Add("sub")
+	require.NoError(t, err)
+	assert.Equal(t, first, h)
+	require.NoError(t, w.AddWithOptions(&AddOptions{All: true}))
+
+	idx, err := r.Storer.Index()
+	require.NoError(t, err)
+	modes := make(map[string]filemode.FileMode)
+	for _, e := range idx.Entries {
+		modes[e.Name] = e.Mode
+	}
+
+	assert.Equal(t, map[string]filemode.FileMode{
+		"target":   filemode.Regular,
+		"link":     filemode.Symlink,
+		"dirlink":  filemode.Symlink,
+		"dir/file": filemode.Regular,
+		"exe":      filemode.Executable,
+		"sub":      filemode.Submodule,
+	}, modes)
+
+	e, err := idx.Entry("link")
+	require.NoError(t, err)
+	blob, err := object.GetBlob(r.Storer, e.Hash)
+	require.NoError(t, err)
+	content, err := blob.Reader()
+	require.NoError(t, err)
+	target, err := io.ReadAll(content)
+	require.NoError(t, err)
+	assert.Equal(t, "target", string(target))
+
+	status, err = w.Status()
+	require.NoError(t, err)
+	for name, fs := range status {
+		assert.Equal(t, Unmodified, fs.Worktree, name)
+	}
+
+	_, err = w.Commit("modes\n", &CommitOptions{Author: defaultSignature()})
+	require.NoError(t, err)
+
+	// The modes round-trip through the checkout of a clone.
+	clone := t.TempDir()
+	cr, err := PlainClone(clone, &CloneOptions{URL: dir})
+	require.NoError(t, err)
+	fi, err := os.Lstat(filepath.Join(clone, "link"))
+	require.NoError(t, err)
+	assert.NotZero(t, fi.Mode()&os.ModeSymlink)
+	fi, err = os.Lstat(filepath.Join(clone, "exe"))
+	require.NoError(t, err)
+	assert.NotZero(t, fi.Mode()&0o100)
+	fi, err = os.Lstat(filepath.Join(clone, "sub"))
+	require.NoError(t, err)
+	assert.True(t, fi.IsDir())
+
+	cw, err := cr.Worktree()
+	require.NoError(t, err)
+	status, err = cw.Status()
+	require.NoError(t, err)
+	assert.True(t, status.IsClean(), status)
+
+	// The new commits of the nested repository modify the gitlink.
+	second, err := subw.Commit("empty\n", &CommitOptions{Author: defaultSignature(), AllowEmptyCommits: true})
+	require.NoError(t, err)
+	status, err = w.Status()
+	require.NoError(t, err)
+	assert.Equal(t, Modified, status.File("sub").Worktree)
+	h, err = w.Add("sub")
+	require.NoError(t, err)
+	assert.Equal(t, second, h)
+
+	if _, err := exec.LookPath("git"); err != nil {
+		return
+	}
+
+	cmd := exec.Command("git", "ls-files", "--stage", "exe", "link", "sub")
+	cmd.Dir = dir
+	out, err := cmd.CombinedOutput()
+	require.NoError(t, err, string(out))
+	assert.Equal(t, fmt.Sprintf("100755 %s 0\texe\n120000 %s 0\tlink\n160000 %s 0\tsub\n",
+		mustIndexEntry(t, r, "exe").Hash, e.Hash, second), string(out))
+}
+
+func TestAddGitlinkWithoutCommit(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	r, err := PlainInit(dir, false)
+	require.NoError(t, err)
+	_, err = PlainInit(filepath.Join(dir, "sub"), false)
+	require.NoError(t, err)
+
+	w, err := r.Worktree()
+	require.NoError(t, err)
+	require.NoError(t, util.WriteFile(w.Filesystem, "sub/foo", []byte("foo\n"), 0o644))
+
+	_, err = w.Add("sub")
+	assert.ErrorIs(t, err, ErrGitlinkWithoutCommit)
+
+	// The repositories without commit are not reported.
+	status, err := w.Status()
+	require.NoError(t, err)
+	assert.True(t, status.IsClean(), status)
+}
+
+func TestAddKeepsModesNotRecordedByTheWorktree(t *testing.T) {
+	t.Parallel()
+
+	fs := memfs.New()
+	r, err := Init(memory.NewStorage(), WithWorkTree(fs))
+	require.NoError(t, err)
+	w, err := r.Worktree()
+	require.NoError(t, err)
+
+	require.NoError(t, util.WriteFile(fs, "exe", []byte("#!/bin/sh\n"), 0o755))
+	require.NoError(t, fs.Symlink("exe", "link"))
+	_, err = w.Add(".")
+	require.NoError(t, err)
+
+	cfg, err := r.Config()
+	require.NoError(t, err)
+	cfg.Core.FileMode = false
+	cfg.Raw.Section("core").SetOption("symlinks", "false")
+	require.NoError(t, r.SetConfig(cfg))
+
+	// The worktree loses the executable bit and the symlink, as on the
+	// filesystems not recording them.
+	require.NoError(t, fs.Remove("link"))
+	require.NoError(t, util.WriteFile(fs, "link", []byte("exe"), 0o644))
+	require.NoError(t, fs.Remove("exe"))
+	require.NoError(t, util.WriteFile(fs, "exe", []byte("#!/bin/bash\n"), 0o644))
+	require.NoError(t, util.WriteFile(fs, "new", []byte("new\n"), 0o755))
+	_, err = w.Add(".")
+	require.NoError(t, err)
+
+	assert.Equal(t, filemode.Executable, mustIndexEntry(t, r, "exe").Mode)
+	assert.Equal(t, filemode.Symlink, mustIndexEntry(t, r, "link").Mode)
+	assert.Equal(t, filemode.Regular, mustIndexEntry(t, r, "new").Mode)
+}
+
+func mustIndexEntry(t *testing.T, r *Repository, name string) *index.Entry {
+	t.Helper()
+
+	idx, err := r.Storer.Index()
+	require.NoError(t, err)
+	e, err := idx.Entry(name)
+	require.NoError(t, err)
+	return e
+}
+
 func (s *WorktreeSuite) TestAddDirectory() {
 	fs := memfs.New()
 	w := &Worktree{
@@ -2765,11 +3872,113 @@ func (s *WorktreeSuite) TestRemoveGlobDirectory() {
 	s.Equal(Deleted, status.File("json/short.json").Staging)
 	s.Equal(Deleted, status.File("json/long.json").Staging)
 
-	_, err = w.Filesystem.Stat("json")
-	s.True(os.IsNotExist(err))
+	_, err = w.Filesystem.Stat("json")
+	s.True(os.IsNotExist(err))
+}
+
+func (s *WorktreeSuite) TestRemoveGlobDirectoryDeleted() {
+	fs := memfs.New()
+	w := &Worktree{
+		r:          s.Repository,
+		Filesystem: fs,
+	}
+
+	err := w.Checkout(&CheckoutOptions{Force: true})
+	s.NoError(err)
+
+	err = fs.Remove("json/short.json")
+	s.NoError(err)
+
+	err = util.WriteFile(w.Filesystem, "json/foo", []byte("FOO"), 0o755)
+	s.NoError(err)
+
+	err = w.RemoveGlob("js*")
+	s.NoError(err)
+
+	status, err := w.Status()
+	s.NoError(err)
+	s.Len(status, 3)
+	s.Equal(Deleted, status.File("json/short.json").Staging)
+	s.Equal(Deleted, status.File("json/long.json").Staging)
+}
+
+func (s *WorktreeSuite) TestRemoveWithChanges() {
+	fs := memfs.New()
+	w := &Worktree{
+		r:          s.Repository,
+		Filesystem: fs,
+	}
+
+	err := w.Checkout(&CheckoutOptions{Force: true})
+	s.NoError(err)
+
+	// Local modifications.
+	s.Require().NoError(util.WriteFile(fs, "LICENSE", []byte("foo"), 0o644))
+	_, err = w.Remove("LICENSE")
+	s.ErrorIs(err, ErrLocalModifications)
+	s.ErrorIs(w.RemoveGlob("LIC*"), ErrLocalModifications)
+
+	// Staged changes, kept with Cached.
+	_, err = w.Add("LICENSE")
+	s.Require().NoError(err)
+	_, err = w.Remove("LICENSE")
+	s.ErrorIs(err, ErrStagedChanges)
+
+	// Staged changes differing from the file, only removed with Force.
+	s.Require().NoError(util.WriteFile(fs, "LICENSE", []byte("bar"), 0o644))
+	err = w.RemoveWithOptions(&RemoveOptions{Path: "LICENSE", Cached: true})
+	s.ErrorIs(err, ErrStagedContentDiffers)
+
+	status, err := w.Status()
+	s.NoError(err)
+	s.Equal(Modified, status.File("LICENSE").Staging)
+
+	s.NoError(w.RemoveWithOptions(&RemoveOptions{Path: "LICENSE", Force: true}))
+	_, err = fs.Lstat("LICENSE")
+	s.True(os.IsNotExist(err))
+
+	// The new files are staged changes too.
+	s.Require().NoError(util.WriteFile(fs, "new", []byte("new"), 0o644))
+	_, err = w.Add("new")
+	s.Require().NoError(err)
+	_, err = w.Remove("new")
+	s.ErrorIs(err, ErrStagedChanges)
+}
+
+func (s *WorktreeSuite) TestRemoveCached() {
+	fs := memfs.New()
+	w := &Worktree{
+		r:          s.Repository,
+		Filesystem: fs,
+	}
+
+	err := w.Checkout(&CheckoutOptions{Force: true})
+	s.NoError(err)
+
+	s.Require().NoError(util.WriteFile(fs, "CHANGELOG", []byte("foo"), 0o644))
+	_, err = w.Add("CHANGELOG")
+	s.Require().NoError(err)
+
+	s.NoError(w.RemoveWithOptions(&RemoveOptions{Path: "CHANGELOG", Cached: true}))
+	s.NoError(w.RemoveWithOptions(&RemoveOptions{Path: "json", Cached: true}))
+	s.Error(w.RemoveWithOptions(&RemoveOptions{Cached: true}))
+
+	idx, err := w.r.Storer.Index()
+	s.NoError(err)
+	status, err := w.Status()
+	s.NoError(err)
+	s.Len(status, 3)
+	for _, name := range []string{"CHANGELOG", "json/long.json", "json/short.json"} {
+		_, err = idx.Entry(name)
+		s.ErrorIs(err, index.ErrEntryNotFound)
+		s.Equal(Untracked, status.File(name).Worktree, name)
+
+		_, err = fs.Lstat(name)
+		s.NoError(err)
+	}
 }
 
-func (s *WorktreeSuite) TestRemoveGlobDirectoryDeleted() {
+func (s *WorktreeSuite) TestRemoveDirectoryDeleted() {
 	fs := memfs.New()
 	w := &Worktree{
 		r:          s.Repository,
@@ -2779,20 +3988,15 @@ func (s *WorktreeSuite) TestRemoveGlobDirectoryDeleted() {
 	err := w.Checkout(&CheckoutOptions{Force: true})
 	s.NoError(err)
 
-	err = fs.Remove("json/short.json")
-	s.NoError(err)
-
-	err = util.WriteFile(w.Filesystem, "json/foo", []byte("FOO"), 0o755)
-	s.NoError(err)
-
-	err = w.RemoveGlob("js*")
+	s.Require().NoError(util.RemoveAll(fs, "go"))
+	hash, err := w.Remove("go")
+	s.True(hash.IsZero())
 	s.NoError(err)
 
 	status, err := w.Status()
 	s.NoError(err)
-	s.Len(status, 3)
-	s.Equal(Deleted, status.File("json/short.json").Staging)
-	s.Equal(Deleted, status.File("json/long.json").Staging)
+	s.Len(status, 1)
+	s.Equal(Deleted, status.File("go/example.go").Staging)
 }
 
 func (s *WorktreeSuite) TestMove() {
@@ -2846,6 +4050,89 @@ func (s *WorktreeSuite) TestMoveToExistent() {
 	s.ErrorIs(err, ErrDestinationExists)
 }
 
+func (s *WorktreeSuite) TestMoveForce() {
+	fs := memfs.New()
+	w := &Worktree{
+		r:          s.Repository,
+		Filesystem: fs,
+	}
+
+	err := w.Checkout(&CheckoutOptions{Force: true})
+	s.NoError(err)
+
+	hash, err := w.MoveWithOptions(".gitignore", "LICENSE", &MoveOptions{Force: true})
+	s.NoError(err)
+	s.Equal("32858aad3c383ed1ff0a0f9bdf231d54a00c9e88", hash.String())
+
+	_, err = w.MoveWithOptions("CHANGELOG", "json", &MoveOptions{Force: true})
+	s.NoError(err)
+	_, err = w.MoveWithOptions("LICENSE", "go", &MoveOptions{Force: true})
+	s.NoError(err)
+	_, err = w.MoveWithOptions("go/LICENSE", "json", &MoveOptions{Force: true})
+	s.NoError(err)
+
+	status, err := w.Status()
+	s.NoError(err)
+	s.Len(status, 5)
+	s.Equal(Deleted, status.File(".gitignore").Staging)
+	s.Equal(Deleted, status.File("LICENSE").Staging)
+	s.Equal(Deleted, status.File("CHANGELOG").Staging)
+	s.Equal(Added, status.File("json/CHANGELOG").Staging)
+	s.Equal(Added, status.File("json/LICENSE").Staging)
+
+	// The moved file keeps its hash.
+	idx, err := w.r.Storer.Index()
+	s.NoError(err)
+	e, err := idx.Entry("json/LICENSE")
+	s.NoError(err)
+	s.Equal(hash, e.Hash)
+}
+
+func (s *WorktreeSuite) TestMoveDirectory() {
+	fs := memfs.New()
+	w := &Worktree{
+		r:          s.Repository,
+		Filesystem: fs,
+	}
+
+	err := w.Checkout(&CheckoutOptions{Force: true})
+	s.NoError(err)
+
+	// The changes of the files are moved with them.
+	s.Require().NoError(util.WriteFile(fs, "json/short.json", []byte("{}"), 0o644))
+	s.Require().NoError(util.WriteFile(fs, "json/untracked", []byte("foo"), 0o644))
+
+	hash, err := w.Move("json", "data")
+	s.True(hash.IsZero())
+	s.NoError(err)
+
+	status, err := w.Status()
+	s.NoError(err)
+	s.Len(status, 5)
+	s.Equal(Deleted, status.File("json/long.json").Staging)
+	s.Equal(Deleted, status.File("json/short.json").Staging)
+	s.Equal(Added, status.File("data/long.json").Staging)
+	s.Equal(Unmodified, status.File("data/long.json").Worktree)
+	s.Equal(Added, status.File("data/short.json").Staging)
+	s.Equal(Modified, status.File("data/short.json").Worktree)
+	s.Equal(Untracked, status.File("data/untracked").Worktree)
+
+	// A directory moved to another one is moved into it.
+	_, err = w.Move("data", "go")
+	s.NoError(err)
+	_, err = fs.Lstat("go/data/untracked")
+	s.NoError(err)
+
+	_, err = w.Move("go/data", "LICENSE")
+	s.ErrorIs(err, ErrDestinationExists)
+	_, err = w.Move("go/data", "go/data/sub")
+	s.Error(err)
+
+	s.Require().NoError(fs.MkdirAll("empty", 0o755))
+	_, err = w.Move("empty", "other")
+	s.ErrorIs(err, index.ErrEntryNotFound)
+}
+
 func (s *WorktreeSuite) TestClean() {
 	fs := fixtures.ByTag("dirty").One().Worktree(fixtures.WithTargetDir(s.T().TempDir))
 
@@ -2923,6 +4210,87 @@ func (s *WorktreeSuite) TestCleanBare() {
 	s.NoError(err)
 }
 
+func TestCleanOptions(t *testing.T) {
+	t.Parallel()
+
+	newWorktree := func(t *testing.T) *Worktree {
+		fs := memfs.New()
+		r, err := Init(memory.NewStorage(), WithWorkTree(fs))
+		require.NoError(t, err)
+
+		for _, name := range []string{
+			".gitignore", "tracked", "dir/tracked", "dir/ignored.log", "dir/untracked",
+			"build/out", "untracked", "ignored.log", "new/untracked", "new/ignored.log",
+			"new/sub/untracked", "nested/.git/HEAD", "nested/untracked",
+		} {
+			content := "content\n"
+			if name == ".gitignore" {
+				content = "*.log\nbuild/\n"
+			}
+
+			require.NoError(t, util.WriteFile(fs, name, []byte(content), 0o644))
+		}
+
+		w, err := r.Worktree()
+		require.NoError(t, err)
+		for _, name := range []string{".gitignore", "tracked", "dir/tracked"} {
+			_, err = w.Add(name)
+			require.NoError(t, err)
+		}
+
+		require.NoError(t, fs.MkdirAll("empty", 0o755))
+		return w
+	}
+
+	for _, tc := range []struct {
+		name     string
+		opts     CleanOptions
+		expected []string
+	}{
+		{"default", CleanOptions{}, []string{"dir/untracked", "untracked"}},
+		{"dir", CleanOptions{Dir: true}, []string{"dir/untracked", "empty/", "new/sub/", "new/untracked", "untracked"}},
+		{"ignored-only", CleanOptions{IgnoredOnly: true}, []string{"dir/ignored.log", "ignored.log", "new/ignored.log"}},
+		{"dir-ignored-only", CleanOptions{Dir: true, IgnoredOnly: true}, []string{"build/", "dir/ignored.log", "ignored.log", "new/ignored.log"}},
+		{"include-ignored", CleanOptions{IncludeIgnored: true}, []string{"dir/ignored.log", "dir/untracked", "ignored.log", "untracked"}},
+		{"dir-include-ignored", CleanOptions{Dir: true, IncludeIgnored: true}, []string{"build/", "dir/ignored.log", "dir/untracked", "empty/", "ignored.log", "new/", "untracked"}},
+		{"path-spec", CleanOptions{Dir: true, PathSpec: []string{"dir", "new/untracked", "nested"}}, []string{"dir/untracked", "new/untracked"}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			w := newWorktree(t)
+
+			tc.opts.DryRun = true
+			removed, err := w.CleanPaths(&tc.opts)
+			require.NoError(t, err)
+			assert.Equal(t, tc.expected, removed)
+
+			for _, name := range removed {
+				_, err := w.Filesystem.Lstat(name)
+				assert.NoError(t, err, name)
+			}
+
+			tc.opts.DryRun = false
+			removed, err = w.CleanPaths(&tc.opts)
+			require.NoError(t, err)
+			assert.Equal(t, tc.expected, removed)
+
+			for _, name := range removed {
+				_, err := w.Filesystem.Lstat(name)
+				assert.ErrorIs(t, err, os.ErrNotExist, name)
+			}
+
+			for _, name := range []string{"tracked", "dir/tracked", "nested/untracked"} {
+				_, err := w.Filesystem.Lstat(name)
+				assert.NoError(t, err, name)
+			}
+		})
+	}
+
+	err := newWorktree(t).Clean(&CleanOptions{IgnoredOnly: true, IncludeIgnored: true})
+	assert.ErrorIs(t, err, ErrIgnoredOnlyIncludeIgnoredExclusive)
+}
+
 func TestAlternatesRepo(t *testing.T) {
 	fs := fixtures.ByTag("alternates").One().Worktree()
 
@@ -3241,6 +4609,52 @@ func (s *WorktreeSuite) TestGrepBare() {
 	}
 }
 
+func TestGrepOptions(t *testing.T) {
+	t.Parallel()
+
+	fs := memfs.New()
+	r, err := Init(memory.NewStorage(), WithWorkTree(fs))
+	require.NoError(t, err)
+	commitFiles(t, r, fs, map[string]string{
+		"a.txt":   "foo.bar\nfooXbar\nFOO bar\n-foo-\nfoobar\n",
+		"bin.dat": "foo\x00\n",
+	})
+
+	for _, tc := range []struct {
+		name     string
+		opts     GrepOptions
+		expected []string
+	}{
+		{"pattern", GrepOptions{Patterns: []*regexp.Regexp{regexp.MustCompile("foo.bar")}}, []string{"a.txt:1", "a.txt:2"}},
+		{"fixed string", GrepOptions{FixedStrings: []string{"foo.bar"}}, []string{"a.txt:1"}},
+		{"ignore case", GrepOptions{Patterns: []*regexp.Regexp{regexp.MustCompile("foo ")}, IgnoreCase: true}, []string{"a.txt:3"}},
+		{"word", GrepOptions{Patterns: []*regexp.Regexp{regexp.MustCompile("fo+")}, WordRegexp: true}, []string{"a.txt:1", "a.txt:4"}},
+		{"word ignore case", GrepOptions{FixedStrings: []string{"foo"}, WordRegexp: true, IgnoreCase: true}, []string{"a.txt:1", "a.txt:3", "a.txt:4"}},
+		{"invert", GrepOptions{Patterns: []*regexp.Regexp{regexp.MustCompile("X"), regexp.MustCompile("-")}, InvertMatch: true}, []string{"a.txt:1", "a.txt:3", "a.txt:5"}},
+		{"text", GrepOptions{FixedStrings: []string{"foo\x00"}, Text: true}, []string{"bin.dat:1"}},
+		{"binary", GrepOptions{FixedStrings: []string{"foo\x00"}}, nil},
+	} {
+		results, err := r.Grep(&tc.opts)
+		require.NoError(t, err)
+
+		var got []string
+		for _, gr := range results {
+			got = append(got, fmt.Sprintf("%s:%d", gr.FileName, gr.LineNumber))
+		}
+
+		assert.Equal(t, tc.expected, got, tc.name)
+	}
+
+	var results []GrepResult
+	err = r.ForEachGrepResult(&GrepOptions{FixedStrings: []string{"foo"}}, func(gr GrepResult) error {
+		results = append(results, gr)
+		return storer.ErrStop
+	})
+	require.NoError(t, err)
+	assert.Len(t, results, 1)
+	assert.Equal(t, "foo.bar", results[0].Content)
+}
+
 func (s *WorktreeSuite) TestResetLingeringDirectories() {
 	dir := s.T().TempDir()
 
@@ -3492,10 +4906,14 @@ func TestValidPath(t *testing.T) {
 		{".gitignore", false},
 		{"a..b", false},
 		{".", false},
-		{"a/.git", false},
-		{"a\\.git", false},
-		{"a/.git/b", false},
-		{"a\\.git\\b", false},
+		{"a/.git", true},
+		{"a\\.git", true},
+		{"a/.git/b", true},
+		{"a\\.git\\b", true},
+		{"a/GIT~1/b", true},
+		{"/a", true},
+		{"\\a", true},
+		{"a/.github", false},
 	}
 
 	if runtime.GOOS == "windows" {
@@ -3677,16 +5095,129 @@ func (s *WorktreeSuite) TestRestoreStaged() {
 }
 
 func (s *WorktreeSuite) TestRestoreWorktree() {
-	_, w, names := setupForRestore(s)
+	fs, w, names := setupForRestore(s)
 
 	// Attempt without files should throw an error like the git restore
 	opts := RestoreOptions{}
 	err := w.Restore(&opts)
 	s.ErrorIs(err, ErrNoRestorePaths)
 
+	// The working tree is restored from the index, which is left as it is.
 	opts.Files = []string{names[0], names[1]}
 	err = w.Restore(&opts)
-	s.ErrorIs(err, ErrRestoreWorktreeOnlyNotSupported)
+	s.NoError(err)
+	verifyStatus(s, "Restored", w, names, []FileStatus{
+		{Worktree: Unmodified, Staging: Added},
+		{Worktree: Unmodified, Staging: Modified},
+		{Worktree: Modified, Staging: Modified},
+		{Worktree: Unmodified, Staging: Deleted},
+	})
+
+	contents, err := util.ReadFile(fs, names[1])
+	s.NoError(err)
+	s.Equal("Foo Bar", string(contents))
+}
+
+func (s *WorktreeSuite) TestRestoreSource() {
+	fs, w, names := setupForRestore(s)
+
+	head, err := w.r.Head()
+	s.NoError(err)
+	commit, err := w.r.CommitObject(head.Hash())
+	s.NoError(err)
+	parent, err := commit.Parent(0)
+	s.NoError(err)
+
+	// The working tree is restored from the source, the index is left as it
+	// is, and the tracked files missing from the source are removed.
+	err = w.Restore(&RestoreOptions{Source: parent.Hash, Files: []string{names[0], names[1], "vendor/foo.go"}})
+	s.NoError(err)
+	_, err = fs.Lstat(names[0])
+	s.ErrorIs(err, os.ErrNotExist)
+	_, err = fs.Lstat("vendor/foo.go")
+	s.ErrorIs(err, os.ErrNotExist)
+
+	f, err := parent.File(names[1])
+	s.NoError(err)
+	expected, err := f.Contents()
+	s.NoError(err)
+	contents, err := util.ReadFile(fs, names[1])
+	s.NoError(err)
+	s.Equal(expected, string(contents))
+
+	status, err := w.Status()
+	s.NoError(err)
+	s.Equal(Added, status.File(names[0]).Staging)
+	s.Equal(Modified, status.File(names[1]).Staging)
+	s.Equal(Deleted, status.File("vendor/foo.go").Worktree)
+
+	// With Staged, both are restored from the source, whose CHANGELOG is
+	// the one of HEAD.
+	err = w.Restore(&RestoreOptions{Source: parent.Hash, Staged: true, Worktree: true, Files: []string{names[1]}})
+	s.NoError(err)
+	status, err = w.Status()
+	s.NoError(err)
+	s.NotContains(status, names[1])
+	contents, err = util.ReadFile(fs, names[1])
+	s.NoError(err)
+	s.Equal(expected, string(contents))
+}
+
+func (s *WorktreeSuite) TestRestorePathSpec() {
+	fs, w, names := setupForRestore(s)
+
+	err := w.Restore(&RestoreOptions{Staged: true, PathSpec: []string{"*.jpg", "nothing"}})
+	s.ErrorIs(err, ErrPathSpecNoMatches)
+
+	err = w.Restore(&RestoreOptions{Staged: true, Worktree: true, PathSpec: []string{"*[A-Z]*", ":!LICENSE"}})
+	s.NoError(err)
+	verifyStatus(s, "Restored", w, names, []FileStatus{
+		{Worktree: Unmodified, Staging: Added},
+		{Worktree: Untracked, Staging: Untracked},
+		{Worktree: Modified, Staging: Modified},
+		{Worktree: Unmodified, Staging: Deleted},
+	})
+
+	contents, err := util.ReadFile(fs, names[2])
+	s.NoError(err)
+	s.Equal("Foo Bar:22", string(contents))
+}
+
+func TestRestoreStagedUnborn(t *testing.T) {
+	t.Parallel()
+
+	fs := memfs.New()
+	r, err := Init(memory.NewStorage(), WithWorkTree(fs))
+	require.NoError(t, err)
+	w, err := r.Worktree()
+	require.NoError(t, err)
+
+	for _, name := range []string{"foo", "bar"} {
+		require.NoError(t, util.WriteFile(fs, name, []byte(name), 0o644))
+		_, err = w.Add(name)
+		require.NoError(t, err)
+	}
+
+	// The intent-to-add entries are unstaged as the other ones.
+	idx, err := r.Storer.Index()
+	require.NoError(t, err)
+	e, err := idx.Entry("bar")
+	require.NoError(t, err)
+	e.IntentToAdd = true
+	require.NoError(t, r.Storer.SetIndex(idx))
+
+	// The files are removed from the index of the unborn branch, and kept in
+	// the working tree.
+	require.NoError(t, w.Restore(&RestoreOptions{Staged: true, Files: []string{"foo", "bar"}}))
+	idx, err = r.Storer.Index()
+	require.NoError(t, err)
+	assert.Empty(t, idx.Entries)
+
+	for _, name := range []string{"foo", "bar"} {
+		contents, err := util.ReadFile(fs, name)
+		require.NoError(t, err)
+		assert.Equal(t, name, string(contents))
+	}
 }
 
 func (s *WorktreeSuite) TestRestoreBoth() {
@@ -3718,3 +5249,129 @@ func (s *WorktreeSuite) TestRestoreBoth() {
 		{Worktree: Untracked, Staging: Untracked},
 	})
 }
+
+func (s *WorktreeSuite) TestAddPathSpec() {
+	fs := memfs.New()
+	w := &Worktree{
+		r:          s.Repository,
+		Filesystem: fs,
+	}
+
+	err := w.Checkout(&CheckoutOptions{Force: true})
+	s.NoError(err)
+
+	s.NoError(util.WriteFile(fs, "go/new.go", []byte("package main"), 0o644))
+	s.NoError(util.WriteFile(fs, "vendor/new.go", []byte("package vendor"), 0o644))
+	s.NoError(util.WriteFile(fs, "qux/new.go", []byte("package qux"), 0o644))
+	s.NoError(util.WriteFile(fs, "go/example.go", []byte("package modified"), 0o644))
+	s.NoError(util.WriteFile(fs, "vendor/foo.go", []byte("package modified"), 0o644))
+	s.NoError(fs.Remove("php/crappy.php"))
+
+	err = w.AddWithOptions(&AddOptions{PathSpec: []string{"*.go", "php", ":!vendor/**", ":(exclude)qux"}})
+	s.NoError(err)
+
+	status, err := w.Status()
+	s.NoError(err)
+	s.Equal(Added, status.File("go/new.go").Staging)
+	s.Equal(Modified, status.File("go/example.go").Staging)
+	s.Equal(Deleted, status.File("php/crappy.php").Staging)
+	s.Equal(Untracked, status.File("vendor/new.go").Staging)
+	s.Equal(Untracked, status.File("qux/new.go").Staging)
+	s.Equal(Unmodified, status.File("vendor/foo.go").Staging)
+	s.Equal(Modified, status.File("vendor/foo.go").Worktree)
+
+	// An item matching no file fails, adding nothing.
+	err = w.AddWithOptions(&AddOptions{PathSpec: []string{"vendor", "foo"}})
+	s.ErrorIs(err, ErrPathSpecNoMatches)
+	status, err = w.Status()
+	s.NoError(err)
+	s.Equal(Unmodified, status.File("vendor/foo.go").Staging)
+
+	err = w.AddWithOptions(&AddOptions{PathSpec: []string{":(foo)bar"}})
+	s.ErrorIs(err, pathspec.ErrInvalidMagic)
+
+	err = w.AddWithOptions(&AddOptions{Path: "vendor", PathSpec: []string{"vendor"}})
+	s.Error(err)
+}
+
+func (s *WorktreeSuite) TestAddUpdate() {
+	fs := memfs.New()
+	w := &Worktree{
+		r:          s.Repository,
+		Filesystem: fs,
+	}
+
+	err := w.Checkout(&CheckoutOptions{Force: true})
+	s.NoError(err)
+
+	s.NoError(util.WriteFile(fs, "go/new.go", []byte("package main"), 0o644))
+	s.NoError(util.WriteFile(fs, "go/example.go", []byte("package modified"), 0o644))
+	s.NoError(util.WriteFile(fs, "vendor/foo.go", []byte("package modified"), 0o644))
+	s.NoError(fs.Remove("php/crappy.php"))
+
+	err = w.AddWithOptions(&AddOptions{Update: true, PathSpec: []string{":!vendor"}})
+	s.NoError(err)
+
+	status, err := w.Status()
+	s.NoError(err)
+	s.Equal(Modified, status.File("go/example.go").Staging)
+	s.Equal(Deleted, status.File("php/crappy.php").Staging)
+	s.Equal(Untracked, status.File("go/new.go").Staging)
+	s.Equal(Unmodified, status.File("vendor/foo.go").Staging)
+
+	// The untracked files do not match with Update.
+	err = w.AddWithOptions(&AddOptions{Update: true, PathSpec: []string{"go/new.go"}})
+	s.ErrorIs(err, ErrPathSpecNoMatches)
+
+	err = w.AddWithOptions(&AddOptions{Update: true})
+	s.NoError(err)
+
+	status, err = w.Status()
+	s.NoError(err)
+	s.Equal(Modified, status.File("vendor/foo.go").Staging)
+	s.Equal(Untracked, status.File("go/new.go").Staging)
+
+	err = w.AddWithOptions(&AddOptions{Update: true, All: true})
+	s.Error(err)
+}
+
+func (s *WorktreeSuite) TestAddPathSpecIgnored() {
+	fs := memfs.New()
+	w := &Worktree{
+		r:          s.Repository,
+		Filesystem: fs,
+	}
+
+	err := w.Checkout(&CheckoutOptions{Force: true})
+	s.NoError(err)
+
+	s.NoError(util.WriteFile(fs, ".gitignore", []byte("*.log\nvendor/\n"), 0o644))
+	s.NoError(util.WriteFile(fs, "build.log", []byte("log"), 0o644))
+	s.NoError(util.WriteFile(fs, "go/build.log", []byte("log"), 0o644))
+	s.NoError(util.WriteFile(fs, "go/new.go", []byte("package main"), 0o644))
+	s.NoError(util.WriteFile(fs, "vendor/foo.go", []byte("package modified"), 0o644))
+
+	// The ignored files inside the directories are skipped, but the tracked
+	// ones are updated.
+	err = w.AddWithOptions(&AddOptions{PathSpec: []string{"go", "vendor"}})
+	s.NoError(err)
+
+	status, err := w.Status()
+	s.NoError(err)
+	s.Equal(Added, status.File("go/new.go").Staging)
+	s.Equal(Modified, status.File("vendor/foo.go").Staging)
+	s.Equal(Untracked, status.File("go/build.log").Staging)
+
+	err = w.AddWithOptions(&AddOptions{PathSpec: []string{"*.log"}})
+	s.ErrorIs(err, ErrPathIgnored)
+
+	err = w.AddWithOptions(&AddOptions{PathSpec: []string{"*.log"}, Force: true})
+	s.NoError(err)
+
+	idx, err := w.r.Storer.Index()
+	s.NoError(err)
+	_, err = idx.Entry("build.log")
+	s.NoError(err)
+	_, err = idx.Entry("go/build.log")
+	s.NoError(err)
+}
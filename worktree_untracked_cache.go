@@ -0,0 +1,266 @@
+package git
+
+import (
+	"fmt"
+	gofs "io/fs"
+	"path"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/go-git/go-billy/v6"
+
+	"github.com/go-git/go-git/v6/plumbing/format/index"
+	"github.com/go-git/go-git/v6/utils/merkletrie"
+)
+
+// untrackedCacheRacyDelay is the delay during which a modified directory is
+// not cached: a later change could keep its modification time, as the
+// timestamps of some filesystems are coarse.
+const untrackedCacheRacyDelay = 2 * time.Second
+
+// diffStagingWithUntrackedCache is diffStagingWithWorktree, using and
+// updating the untracked cache of the index, and hashing the tracked files
+// with the given number of workers.
+func (w *Worktree) diffStagingWithUntrackedCache(workers int, excludeIgnoredChanges bool) (merkletrie.Changes, error) {
+	idx, err := w.r.Storer.Index()
+	if err != nil {
+		return nil, err
+	}
+
+	fs := newUntrackedCacheFS(w.Filesystem, idx)
+	changes, err := w.diffIndexWithWorktree(idx, fs, false, excludeIgnoredChanges, workers)
+	if err != nil {
+		return nil, err
+	}
+
+	if fs.changed {
+		if err := w.r.Storer.SetIndex(idx); err != nil {
+			return nil, err
+		}
+	}
+
+	return changes, nil
+}
+
+// untrackedCacheFS is a billy.Filesystem reading the directories of the
+// worktree from the untracked cache of an index when their stat data did not
+// change since they were cached, and caching the other ones when they are
+// read.
+//
+// The untracked files of a directory are its files missing from the index,
+// the ignored ones included, as the ignore rules are applied to the changes
+// afterwards, and all the subdirectories are cached. As these are not the
+// semantics of the cache of git, no per-directory exclude file is recorded,
+// which makes git ignore the cache, and the caches of git are discarded.
+type untrackedCacheFS struct {
+	billy.Filesystem
+
+	cache *index.UntrackedCache
+	// tracked are the names of the files of the index by directory.
+	tracked map[string][]string
+	start   time.Time
+	changed bool
+}
+
+func newUntrackedCacheFS(fs billy.Filesystem, idx *index.Index) *untrackedCacheFS {
+	ufs := &untrackedCacheFS{
+		Filesystem: fs,
+		cache:      idx.UntrackedCache,
+		tracked:    make(map[string][]string),
+		start:      time.Now(),
+	}
+
+	ident := fmt.Sprintf("Location %s, system %s", fs.Root(), runtime.GOOS)
+	c := ufs.cache
+	if c == nil || c.ExcludePerDir != "" || c.DirFlags != 0 ||
+		len(c.Ident) != 1 || c.Ident[0] != ident {
+		ufs.cache = &index.UntrackedCache{Ident: []string{ident}}
+		idx.UntrackedCache = ufs.cache
+		ufs.changed = true
+	}
+
+	if ufs.cache.Root == nil {
+		ufs.cache.Root = &index.UntrackedCacheDir{}
+		ufs.changed = true
+	}
+
+	seen := make(map[string]bool, len(idx.Entries))
+	for _, e := range idx.Entries {
+		if seen[e.Name] {
+			continue
+		}
+
+		seen[e.Name] = true
+		dir, name := path.Split(e.Name)
+		dir = strings.TrimSuffix(dir, "/")
+		ufs.tracked[dir] = append(ufs.tracked[dir], name)
+	}
+
+	return ufs
+}
+
+// ReadDir returns the entries of the directory from the cache if it is still
+// valid, or reads them and caches them otherwise.
+func (fs *untrackedCacheFS) ReadDir(dirname string) ([]gofs.DirEntry, error) {
+	dirname = path.Clean("/" + filepath.ToSlash(dirname))[1:]
+	d := fs.cache.Root
+	if dirname != "" {
+		for _, name := range strings.Split(dirname, "/") {
+			d = fs.dir(d, name)
+		}
+	}
+
+	fi, err := fs.Lstat(dirname)
+	if err != nil {
+		return fs.Filesystem.ReadDir(dirname)
+	}
+
+	stat := newUntrackedCacheStat(fi)
+	if d.Valid && sameUntrackedCacheStat(stat, d.Stat) {
+		return fs.cachedEntries(dirname, d), nil
+	}
+
+	entries, err := fs.Filesystem.ReadDir(dirname)
+	if err != nil {
+		return nil, err
+	}
+
+	fs.update(dirname, d, entries, stat)
+	return entries, nil
+}
+
+// dir returns the subdirectory of d with the given name, adding it if needed.
+func (fs *untrackedCacheFS) dir(d *index.UntrackedCacheDir, name string) *index.UntrackedCacheDir {
+	if sub := d.Dir(name); sub != nil {
+		return sub
+	}
+
+	sub := &index.UntrackedCacheDir{Name: name}
+	d.Dirs = append(d.Dirs, sub)
+	fs.changed = true
+	return sub
+}
+
+// update caches the entries of the directory d at dirname, read when it had
+// the given stat data.
+func (fs *untrackedCacheFS) update(dirname string, d *index.UntrackedCacheDir, entries []gofs.DirEntry, stat index.UntrackedCacheStat) {
+	tracked := make(map[string]bool, len(fs.tracked[dirname]))
+	for _, name := range fs.tracked[dirname] {
+		tracked[name] = true
+	}
+
+	dirs := d.Dirs
+	d.Dirs, d.Untracked = nil, nil
+	for _, e := range entries {
+		switch {
+		case e.IsDir():
+			sub := &index.UntrackedCacheDir{Name: e.Name()}
+			for _, old := range dirs {
+				if old.Name == e.Name() {
+					sub = old
+					break
+				}
+			}
+
+			d.Dirs = append(d.Dirs, sub)
+		case !tracked[e.Name()]:
+			d.Untracked = append(d.Untracked, e.Name())
+		}
+	}
+
+	d.Stat = stat
+	d.Valid = stat.ModifiedAt.Before(fs.start.Add(-untrackedCacheRacyDelay))
+	fs.changed = true
+}
+
+// cachedEntries returns the entries of the directory d at dirname: its cached
+// subdirectories and untracked files, and its tracked files which exist.
+func (fs *untrackedCacheFS) cachedEntries(dirname string, d *index.UntrackedCacheDir) []gofs.DirEntry {
+	entries := make([]gofs.DirEntry, 0, len(d.Dirs)+len(d.Untracked)+len(fs.tracked[dirname]))
+	seen := make(map[string]bool, cap(entries))
+	for _, sub := range d.Dirs {
+		seen[sub.Name] = true
+		entries = append(entries, &untrackedCacheEntry{fs: fs.Filesystem, path: path.Join(dirname, sub.Name), isDir: true})
+	}
+
+	for _, name := range d.Untracked {
+		seen[name] = true
+		entries = append(entries, &untrackedCacheEntry{fs: fs.Filesystem, path: path.Join(dirname, name)})
+	}
+
+	// The tracked files deleted from the worktree modify the directory, but
+	// the ones which never were in the worktree, as after a reset of the
+	// index, do not.
+	for _, name := range fs.tracked[dirname] {
+		if seen[name] {
+			continue
+		}
+
+		fi, err := fs.Lstat(path.Join(dirname, name))
+		if err != nil {
+			continue
+		}
+
+		entries = append(entries, gofs.FileInfoToDirEntry(fi))
+	}
+
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].Name() < entries[j].Name()
+	})
+
+	return entries
+}
+
+// untrackedCacheEntry is a directory entry read from the untracked cache,
+// whose info is only read when needed. The type of the files, not recorded in
+// the cache, is unknown until then.
+type untrackedCacheEntry struct {
+	fs    billy.Filesystem
+	path  string
+	isDir bool
+}
+
+func (e *untrackedCacheEntry) Name() string {
+	return path.Base(e.path)
+}
+
+func (e *untrackedCacheEntry) IsDir() bool {
+	return e.isDir
+}
+
+func (e *untrackedCacheEntry) Type() gofs.FileMode {
+	if e.isDir {
+		return gofs.ModeDir
+	}
+
+	return 0
+}
+
+func (e *untrackedCacheEntry) Info() (gofs.FileInfo, error) {
+	return e.fs.Lstat(e.path)
+}
+
+func newUntrackedCacheStat(fi gofs.FileInfo) index.UntrackedCacheStat {
+	e := &index.Entry{}
+	fillSystemInfo(e, fi.Sys())
+
+	return index.UntrackedCacheStat{
+		CreatedAt:  e.CreatedAt,
+		ModifiedAt: fi.ModTime(),
+		Dev:        e.Dev,
+		Inode:      e.Inode,
+		UID:        e.UID,
+		GID:        e.GID,
+		Size:       uint32(fi.Size()),
+	}
+}
+
+func sameUntrackedCacheStat(a, b index.UntrackedCacheStat) bool {
+	return a.CreatedAt.Equal(b.CreatedAt) && a.ModifiedAt.Equal(b.ModifiedAt) &&
+		a.Dev == b.Dev && a.Inode == b.Inode &&
+		a.UID == b.UID && a.GID == b.GID &&
+		a.Size == b.Size
+}